@@ -0,0 +1,104 @@
+package adapter_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/marshallshelly/beacon-auth/adapter"
+	"github.com/marshallshelly/beacon-auth/adapters/memory"
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// plainAdapter hides the memory adapter's Capabilities method
+type plainAdapter struct {
+	core.Adapter
+}
+
+// transactionalAdapter reports transaction support and records calls
+type transactionalAdapter struct {
+	*memory.MemoryAdapter
+	transactions int
+}
+
+func (a *transactionalAdapter) Capabilities() core.Capabilities {
+	caps := a.MemoryAdapter.Capabilities()
+	caps.TransactionsSupported = true
+	return caps
+}
+
+func (a *transactionalAdapter) Transaction(ctx context.Context, fn func(core.Adapter) error) error {
+	a.transactions++
+	return fn(a)
+}
+
+func TestAdapterCapabilities(t *testing.T) {
+	mem := memory.New()
+
+	caps := core.AdapterCapabilities(mem)
+	if !caps.ReturningSupported || !caps.JSONSupported {
+		t.Errorf("memory capabilities = %+v, want returning and JSON support", caps)
+	}
+	if caps.TransactionsSupported {
+		t.Error("memory adapter should not report transaction support")
+	}
+
+	if caps := core.AdapterCapabilities(plainAdapter{mem}); caps != (core.Capabilities{}) {
+		t.Errorf("adapter without CapabilityProvider reported %+v, want zero value", caps)
+	}
+}
+
+func TestFactoryCapabilities(t *testing.T) {
+	custom := &transactionalAdapter{MemoryAdapter: memory.New()}
+
+	caps := adapter.NewFactory(adapter.AdapterConfig{SupportsTransaction: true}, custom).Capabilities()
+	if !caps.TransactionsSupported {
+		t.Error("expected transaction support when custom adapter and config allow it")
+	}
+
+	caps = adapter.NewFactory(adapter.AdapterConfig{}, custom).Capabilities()
+	if caps.TransactionsSupported {
+		t.Error("expected no transaction support when config disables it")
+	}
+	if !caps.JSONSupported {
+		t.Error("expected JSON support reported by custom adapter to be kept")
+	}
+}
+
+func TestInternalAdapterWithTransaction(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("uses transaction when supported", func(t *testing.T) {
+		custom := &transactionalAdapter{MemoryAdapter: memory.New()}
+		ia := adapter.NewInternalAdapter(custom, nil)
+
+		err := ia.WithTransaction(ctx, func(tx *adapter.InternalAdapter) error {
+			_, err := tx.CreateUser(ctx, "tx@example.com", "Tx")
+			return err
+		})
+		if err != nil {
+			t.Fatalf("WithTransaction() error = %v", err)
+		}
+		if custom.transactions != 1 {
+			t.Errorf("transactions = %d, want 1", custom.transactions)
+		}
+		if _, err := ia.FindUserByEmail(ctx, "tx@example.com"); err != nil {
+			t.Errorf("user not found after transaction: %v", err)
+		}
+	})
+
+	t.Run("runs directly without transaction support", func(t *testing.T) {
+		ia := adapter.NewInternalAdapter(memory.New(), nil)
+		wantErr := errors.New("boom")
+
+		err := ia.WithTransaction(ctx, func(tx *adapter.InternalAdapter) error {
+			if tx != ia {
+				t.Error("expected the same internal adapter without transaction support")
+			}
+			return wantErr
+		})
+		if !errors.Is(err, wantErr) {
+			t.Errorf("WithTransaction() error = %v, want %v", err, wantErr)
+		}
+	})
+}
@@ -3,6 +3,7 @@ package adapter
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/marshallshelly/beacon-auth/core"
@@ -30,12 +31,20 @@ type CustomAdapter interface {
 	Delete(ctx context.Context, query *core.Query) error
 	DeleteMany(ctx context.Context, query *core.Query) (int64, error)
 	Count(ctx context.Context, query *core.Query) (int64, error)
+	Upsert(ctx context.Context, model string, conflictFields []string, data map[string]interface{}) (map[string]interface{}, error)
 	Transaction(ctx context.Context, fn func(core.Adapter) error) error
 	Ping(ctx context.Context) error
 	Close() error
 	ID() string
 }
 
+// BatchCreator is implemented by custom adapters that can insert several
+// records in one statement. Factory.CreateMany falls back to one Create per
+// record for adapters without it.
+type BatchCreator interface {
+	CreateMany(ctx context.Context, model string, data []map[string]interface{}) (int64, error)
+}
+
 // Factory wraps a custom adapter with transformation logic
 type Factory struct {
 	config AdapterConfig
@@ -120,6 +129,42 @@ func (f *Factory) Count(ctx context.Context, query *core.Query) (int64, error) {
 	return f.custom.Count(ctx, query)
 }
 
+// CreateMany wraps the custom adapter's CreateMany with transformations,
+// creating the records one at a time when it does not implement BatchCreator
+func (f *Factory) CreateMany(ctx context.Context, model string, data []map[string]interface{}) (int64, error) {
+	batcher, ok := f.custom.(BatchCreator)
+	if !ok {
+		return core.CreateEach(ctx, f, model, data)
+	}
+
+	transformed := make([]map[string]interface{}, len(data))
+	for i, record := range data {
+		transformed[i] = f.transformInput(record)
+	}
+	return batcher.CreateMany(ctx, model, transformed)
+}
+
+// Upsert wraps the custom adapter's Upsert with transformations
+func (f *Factory) Upsert(ctx context.Context, model string, conflictFields []string, data map[string]interface{}) (map[string]interface{}, error) {
+	fields := make([]string, len(conflictFields))
+	for i, field := range conflictFields {
+		fields[i] = field
+		if mapped, ok := f.config.FieldNameMapping[field]; ok {
+			fields[i] = mapped
+		}
+	}
+
+	transformed := f.transformInput(data)
+	result, err := f.custom.Upsert(ctx, model, fields, transformed)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, nil
+	}
+	return f.transformOutput(result), nil
+}
+
 // Transaction wraps the custom adapter's Transaction
 func (f *Factory) Transaction(ctx context.Context, fn func(core.Adapter) error) error {
 	if !f.config.SupportsTransaction {
@@ -129,6 +174,20 @@ func (f *Factory) Transaction(ctx context.Context, fn func(core.Adapter) error)
 	return f.custom.Transaction(ctx, fn)
 }
 
+// TransactionWithOptions wraps the custom adapter's TransactionWithOptions.
+// Options are rejected with core.ErrTxOptionsUnsupported when the custom
+// adapter does not implement core.TxOptionsAdapter or transactions are
+// disabled.
+func (f *Factory) TransactionWithOptions(ctx context.Context, opts core.TxOptions, fn func(core.Adapter) error) error {
+	if txAdapter, ok := f.custom.(core.TxOptionsAdapter); ok && f.config.SupportsTransaction {
+		return txAdapter.TransactionWithOptions(ctx, opts, fn)
+	}
+	if opts != (core.TxOptions{}) {
+		return fmt.Errorf("%w: adapter %s", core.ErrTxOptionsUnsupported, f.ID())
+	}
+	return f.Transaction(ctx, fn)
+}
+
 // Ping wraps the custom adapter's Ping
 func (f *Factory) Ping(ctx context.Context) error {
 	return f.custom.Ping(ctx)
@@ -144,6 +203,19 @@ func (f *Factory) ID() string {
 	return f.custom.ID()
 }
 
+// Capabilities reports the custom adapter's capabilities, with JSON and
+// transaction support limited by the factory configuration
+func (f *Factory) Capabilities() core.Capabilities {
+	var caps core.Capabilities
+	if provider, ok := f.custom.(core.CapabilityProvider); ok {
+		caps = provider.Capabilities()
+	}
+	// Values are stored as JSON strings when the database lacks native support
+	caps.JSONSupported = caps.JSONSupported || f.config.SupportsJSON
+	caps.TransactionsSupported = caps.TransactionsSupported && f.config.SupportsTransaction
+	return caps
+}
+
 // transformInput applies input transformations to data
 func (f *Factory) transformInput(data map[string]interface{}) map[string]interface{} {
 	result := make(map[string]interface{})
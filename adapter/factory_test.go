@@ -0,0 +1,51 @@
+package adapter_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/marshallshelly/beacon-auth/adapter"
+	"github.com/marshallshelly/beacon-auth/adapters/memory"
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// unbatchedAdapter hides the memory adapter's CreateMany method
+type unbatchedAdapter struct {
+	adapter.CustomAdapter
+	creates int
+}
+
+func (a *unbatchedAdapter) Create(ctx context.Context, model string, data map[string]interface{}) (map[string]interface{}, error) {
+	a.creates++
+	return a.CustomAdapter.Create(ctx, model, data)
+}
+
+func TestFactoryCreateMany(t *testing.T) {
+	ctx := context.Background()
+	data := []map[string]interface{}{
+		{"id": "code1", "used": false},
+		{"id": "code2", "used": false},
+	}
+
+	mem := memory.New()
+	created, err := adapter.NewFactory(adapter.AdapterConfig{}, mem).CreateMany(ctx, "codes", data)
+	if err != nil || created != 2 {
+		t.Fatalf("CreateMany() = %d, %v, want 2", created, err)
+	}
+	record, _ := mem.FindOne(ctx, &core.Query{
+		Model: "codes",
+		Where: []core.WhereClause{{Field: "id", Operator: core.OpEqual, Value: "code1"}},
+	})
+	if record["used"] != 0 {
+		t.Errorf("used = %v, want input transformed to 0", record["used"])
+	}
+
+	custom := &unbatchedAdapter{CustomAdapter: memory.New()}
+	created, err = adapter.NewFactory(adapter.AdapterConfig{}, custom).CreateMany(ctx, "codes", data)
+	if err != nil || created != 2 {
+		t.Fatalf("fallback CreateMany() = %d, %v, want 2", created, err)
+	}
+	if custom.creates != 2 {
+		t.Errorf("fallback made %d Create calls, want 2", custom.creates)
+	}
+}
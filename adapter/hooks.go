@@ -0,0 +1,315 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// Operation names the adapter method a QueryEvent describes
+type Operation string
+
+const (
+	OperationCreate     Operation = "create"
+	OperationCreateMany Operation = "create_many"
+	OperationFindOne    Operation = "find_one"
+	OperationFindMany   Operation = "find_many"
+	OperationUpdate     Operation = "update"
+	OperationUpdateMany Operation = "update_many"
+	OperationDelete     Operation = "delete"
+	OperationDeleteMany Operation = "delete_many"
+	OperationCount      Operation = "count"
+	OperationUpsert     Operation = "upsert"
+)
+
+// QueryEvent describes one call to a wrapped adapter. Query, Data and
+// Records are copies, so BeforeQuery hooks can change them, e.g. to add a
+// tenant condition to every query, without affecting the caller.
+type QueryEvent struct {
+	Operation Operation
+	Model     string
+
+	// Query is set for reads, updates, deletes and counts
+	Query *core.Query
+
+	// Data is set for Create, Update, UpdateMany and Upsert
+	Data map[string]interface{}
+
+	// Records is set for CreateMany
+	Records []map[string]interface{}
+
+	// ConflictFields is set for Upsert
+	ConflictFields []string
+
+	// Result, Duration and Err are set once the call returns. Result holds
+	// what the method returns: a record, a slice of records, a count or
+	// nil. AfterQuery hooks may replace Result and Err.
+	Result   interface{}
+	Duration time.Duration
+	Err      error
+
+	answered bool
+}
+
+// SetResult answers the call from a BeforeQuery hook, e.g. from a cache.
+// The wrapped adapter is not called and result is returned instead; it must
+// have the type the method returns.
+func (e *QueryEvent) SetResult(result interface{}) {
+	e.Result = result
+	e.answered = true
+}
+
+// QueryHook intercepts the calls made through a HookedAdapter.
+//
+// BeforeQuery runs before the call and may change the event or return an
+// error to abort the call. The context it returns is used for the call
+// and the following hooks. AfterQuery runs once the call returns, in
+// reverse order, and also for the hooks that ran before a hook aborted.
+type QueryHook interface {
+	BeforeQuery(ctx context.Context, event *QueryEvent) (context.Context, error)
+	AfterQuery(ctx context.Context, event *QueryEvent)
+}
+
+// QueryHookFuncs implements QueryHook with optional functions, for hooks
+// that only need one side:
+//
+//	logQueries := adapter.QueryHookFuncs{
+//		After: func(ctx context.Context, e *adapter.QueryEvent) {
+//			log.Printf("%s %s took %s (err=%v)", e.Operation, e.Model, e.Duration, e.Err)
+//		},
+//	}
+type QueryHookFuncs struct {
+	Before func(ctx context.Context, event *QueryEvent) (context.Context, error)
+	After  func(ctx context.Context, event *QueryEvent)
+}
+
+// BeforeQuery calls Before when set
+func (h QueryHookFuncs) BeforeQuery(ctx context.Context, event *QueryEvent) (context.Context, error) {
+	if h.Before == nil {
+		return ctx, nil
+	}
+	return h.Before(ctx, event)
+}
+
+// AfterQuery calls After when set
+func (h QueryHookFuncs) AfterQuery(ctx context.Context, event *QueryEvent) {
+	if h.After != nil {
+		h.After(ctx, event)
+	}
+}
+
+// HookedAdapter runs QueryHooks around the calls of another adapter, which
+// adds logging, metrics, caching or row filters to any adapter
+type HookedAdapter struct {
+	inner core.Adapter
+	hooks []QueryHook
+}
+
+// Wrap returns inner with hooks run around every record operation. Hooks
+// run in the order given before the call and in reverse order after it.
+// Adapters passed to Transaction callbacks are wrapped with the same hooks.
+//
+// The wrapper does not expose SessionUserFinder, so session lookups go
+// through FindOne and are seen by the hooks.
+func Wrap(inner core.Adapter, hooks ...QueryHook) *HookedAdapter {
+	return &HookedAdapter{inner: inner, hooks: hooks}
+}
+
+// Unwrap returns the wrapped adapter
+func (h *HookedAdapter) Unwrap() core.Adapter {
+	return h.inner
+}
+
+// run passes event through the hooks and calls call unless a hook aborted
+// or answered it
+func (h *HookedAdapter) run(ctx context.Context, event *QueryEvent, call func(context.Context) (interface{}, error)) (interface{}, error) {
+	entered := 0
+	for _, hook := range h.hooks {
+		next, err := hook.BeforeQuery(ctx, event)
+		if err != nil {
+			event.Err = err
+			break
+		}
+		ctx = next
+		entered++
+	}
+
+	if event.Err == nil && !event.answered {
+		start := time.Now()
+		event.Result, event.Err = call(ctx)
+		event.Duration = time.Since(start)
+	}
+
+	for i := entered - 1; i >= 0; i-- {
+		h.hooks[i].AfterQuery(ctx, event)
+	}
+	return event.Result, event.Err
+}
+
+// result converts the result of run to the type a method returns
+func result[T any](event *QueryEvent, value interface{}, err error) (T, error) {
+	var zero T
+	if err != nil || value == nil {
+		return zero, err
+	}
+	typed, ok := value.(T)
+	if !ok {
+		return zero, fmt.Errorf("query hook: %s result has type %T, want %T", event.Operation, value, zero)
+	}
+	return typed, nil
+}
+
+// queryEvent returns an event for a call taking a query
+func queryEvent(op Operation, query *core.Query, data map[string]interface{}) *QueryEvent {
+	event := &QueryEvent{Operation: op, Data: maps.Clone(data)}
+	if query != nil {
+		q := *query
+		q.Select = slices.Clone(query.Select)
+		q.Where = slices.Clone(query.Where)
+		q.Joins = slices.Clone(query.Joins)
+		q.OrderBy = slices.Clone(query.OrderBy)
+		event.Query = &q
+		event.Model = q.Model
+	}
+	return event
+}
+
+// Create runs the hooks around the wrapped adapter's Create
+func (h *HookedAdapter) Create(ctx context.Context, model string, data map[string]interface{}) (map[string]interface{}, error) {
+	event := &QueryEvent{Operation: OperationCreate, Model: model, Data: maps.Clone(data)}
+	value, err := h.run(ctx, event, func(ctx context.Context) (interface{}, error) {
+		return h.inner.Create(ctx, event.Model, event.Data)
+	})
+	return result[map[string]interface{}](event, value, err)
+}
+
+// FindOne runs the hooks around the wrapped adapter's FindOne
+func (h *HookedAdapter) FindOne(ctx context.Context, query *core.Query) (map[string]interface{}, error) {
+	event := queryEvent(OperationFindOne, query, nil)
+	value, err := h.run(ctx, event, func(ctx context.Context) (interface{}, error) {
+		return h.inner.FindOne(ctx, event.Query)
+	})
+	return result[map[string]interface{}](event, value, err)
+}
+
+// FindMany runs the hooks around the wrapped adapter's FindMany
+func (h *HookedAdapter) FindMany(ctx context.Context, query *core.Query) ([]map[string]interface{}, error) {
+	event := queryEvent(OperationFindMany, query, nil)
+	value, err := h.run(ctx, event, func(ctx context.Context) (interface{}, error) {
+		return h.inner.FindMany(ctx, event.Query)
+	})
+	return result[[]map[string]interface{}](event, value, err)
+}
+
+// Update runs the hooks around the wrapped adapter's Update
+func (h *HookedAdapter) Update(ctx context.Context, query *core.Query, data map[string]interface{}) (map[string]interface{}, error) {
+	event := queryEvent(OperationUpdate, query, data)
+	value, err := h.run(ctx, event, func(ctx context.Context) (interface{}, error) {
+		return h.inner.Update(ctx, event.Query, event.Data)
+	})
+	return result[map[string]interface{}](event, value, err)
+}
+
+// UpdateMany runs the hooks around the wrapped adapter's UpdateMany
+func (h *HookedAdapter) UpdateMany(ctx context.Context, query *core.Query, data map[string]interface{}) (int64, error) {
+	event := queryEvent(OperationUpdateMany, query, data)
+	value, err := h.run(ctx, event, func(ctx context.Context) (interface{}, error) {
+		return h.inner.UpdateMany(ctx, event.Query, event.Data)
+	})
+	return result[int64](event, value, err)
+}
+
+// Delete runs the hooks around the wrapped adapter's Delete
+func (h *HookedAdapter) Delete(ctx context.Context, query *core.Query) error {
+	event := queryEvent(OperationDelete, query, nil)
+	_, err := h.run(ctx, event, func(ctx context.Context) (interface{}, error) {
+		return nil, h.inner.Delete(ctx, event.Query)
+	})
+	return err
+}
+
+// DeleteMany runs the hooks around the wrapped adapter's DeleteMany
+func (h *HookedAdapter) DeleteMany(ctx context.Context, query *core.Query) (int64, error) {
+	event := queryEvent(OperationDeleteMany, query, nil)
+	value, err := h.run(ctx, event, func(ctx context.Context) (interface{}, error) {
+		return h.inner.DeleteMany(ctx, event.Query)
+	})
+	return result[int64](event, value, err)
+}
+
+// Count runs the hooks around the wrapped adapter's Count
+func (h *HookedAdapter) Count(ctx context.Context, query *core.Query) (int64, error) {
+	event := queryEvent(OperationCount, query, nil)
+	value, err := h.run(ctx, event, func(ctx context.Context) (interface{}, error) {
+		return h.inner.Count(ctx, event.Query)
+	})
+	return result[int64](event, value, err)
+}
+
+// CreateMany runs the hooks around the wrapped adapter's CreateMany
+func (h *HookedAdapter) CreateMany(ctx context.Context, model string, data []map[string]interface{}) (int64, error) {
+	records := make([]map[string]interface{}, len(data))
+	for i, record := range data {
+		records[i] = maps.Clone(record)
+	}
+
+	event := &QueryEvent{Operation: OperationCreateMany, Model: model, Records: records}
+	value, err := h.run(ctx, event, func(ctx context.Context) (interface{}, error) {
+		return h.inner.CreateMany(ctx, event.Model, event.Records)
+	})
+	return result[int64](event, value, err)
+}
+
+// Upsert runs the hooks around the wrapped adapter's Upsert
+func (h *HookedAdapter) Upsert(ctx context.Context, model string, conflictFields []string, data map[string]interface{}) (map[string]interface{}, error) {
+	event := &QueryEvent{
+		Operation:      OperationUpsert,
+		Model:          model,
+		Data:           maps.Clone(data),
+		ConflictFields: slices.Clone(conflictFields),
+	}
+	value, err := h.run(ctx, event, func(ctx context.Context) (interface{}, error) {
+		return h.inner.Upsert(ctx, event.Model, event.ConflictFields, event.Data)
+	})
+	return result[map[string]interface{}](event, value, err)
+}
+
+// Transaction runs fn in a transaction of the wrapped adapter, with the
+// transaction adapter wrapped in the same hooks
+func (h *HookedAdapter) Transaction(ctx context.Context, fn func(core.Adapter) error) error {
+	return h.inner.Transaction(ctx, func(tx core.Adapter) error {
+		return fn(Wrap(tx, h.hooks...))
+	})
+}
+
+// TransactionWithOptions runs fn in a transaction of the wrapped adapter
+// started with opts (see core.TransactionWithOptions)
+func (h *HookedAdapter) TransactionWithOptions(ctx context.Context, opts core.TxOptions, fn func(core.Adapter) error) error {
+	return core.TransactionWithOptions(ctx, h.inner, opts, func(tx core.Adapter) error {
+		return fn(Wrap(tx, h.hooks...))
+	})
+}
+
+// Capabilities reports the wrapped adapter's capabilities
+func (h *HookedAdapter) Capabilities() core.Capabilities {
+	return core.AdapterCapabilities(h.inner)
+}
+
+// Ping checks the wrapped adapter's connection
+func (h *HookedAdapter) Ping(ctx context.Context) error {
+	return h.inner.Ping(ctx)
+}
+
+// Close closes the wrapped adapter
+func (h *HookedAdapter) Close() error {
+	return h.inner.Close()
+}
+
+// ID returns the wrapped adapter's identifier
+func (h *HookedAdapter) ID() string {
+	return h.inner.ID()
+}
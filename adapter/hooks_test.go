@@ -0,0 +1,173 @@
+package adapter_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/marshallshelly/beacon-auth/adapter"
+	"github.com/marshallshelly/beacon-auth/adapters/memory"
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// recorder logs the order hooks run in
+type recorder struct {
+	name string
+	log  *[]string
+	err  error
+}
+
+func (r recorder) BeforeQuery(ctx context.Context, e *adapter.QueryEvent) (context.Context, error) {
+	*r.log = append(*r.log, "before "+r.name)
+	return ctx, r.err
+}
+
+func (r recorder) AfterQuery(ctx context.Context, e *adapter.QueryEvent) {
+	*r.log = append(*r.log, "after "+r.name)
+}
+
+func TestWrap_Order(t *testing.T) {
+	ctx := context.Background()
+	var log []string
+
+	db := adapter.Wrap(memory.New(), recorder{name: "a", log: &log}, recorder{name: "b", log: &log})
+	if _, err := db.Count(ctx, core.NewQuery("users").Build()); err != nil {
+		t.Fatalf("Count() error = %v", err)
+	}
+	want := []string{"before a", "before b", "after b", "after a"}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("hooks ran %v, want %v", log, want)
+	}
+
+	// A hook that fails aborts the call; hooks already entered still see it
+	log = nil
+	denied := errors.New("denied")
+	db = adapter.Wrap(memory.New(), recorder{name: "a", log: &log}, recorder{name: "b", log: &log, err: denied}, recorder{name: "c", log: &log})
+	if _, err := db.Create(ctx, "users", map[string]interface{}{"id": "u1"}); !errors.Is(err, denied) {
+		t.Fatalf("Create() error = %v, want denied", err)
+	}
+	want = []string{"before a", "before b", "after a"}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("hooks ran %v, want %v", log, want)
+	}
+}
+
+func TestWrap_TenantFilter(t *testing.T) {
+	ctx := context.Background()
+	mem := memory.New()
+	mem.Create(ctx, "notes", map[string]interface{}{"id": "n1", "tenant_id": "t1"})
+	mem.Create(ctx, "notes", map[string]interface{}{"id": "n2", "tenant_id": "t2"})
+
+	tenant := adapter.QueryHookFuncs{
+		Before: func(ctx context.Context, e *adapter.QueryEvent) (context.Context, error) {
+			if e.Query != nil {
+				e.Query.Where = append(e.Query.Where, core.WhereClause{Field: "tenant_id", Operator: core.OpEqual, Value: "t1"})
+			}
+			if e.Data != nil && e.Operation == adapter.OperationCreate {
+				e.Data["tenant_id"] = "t1"
+			}
+			return ctx, nil
+		},
+	}
+	db := adapter.Wrap(mem, tenant)
+
+	query := core.NewQuery("notes").Build()
+	notes, err := db.FindMany(ctx, query)
+	if err != nil {
+		t.Fatalf("FindMany() error = %v", err)
+	}
+	if len(notes) != 1 || notes[0]["id"] != "n1" {
+		t.Errorf("FindMany() = %v, want only n1", notes)
+	}
+	if len(query.Where) != 0 {
+		t.Errorf("hook changed the caller's query: %v", query.Where)
+	}
+
+	data := map[string]interface{}{"id": "n3"}
+	created, err := db.Create(ctx, "notes", data)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if created["tenant_id"] != "t1" {
+		t.Errorf("Create() = %v, want tenant_id t1", created)
+	}
+	if _, ok := data["tenant_id"]; ok {
+		t.Error("hook changed the caller's data")
+	}
+
+	// The transaction adapter is wrapped too
+	err = db.Transaction(ctx, func(tx core.Adapter) error {
+		count, err := tx.Count(ctx, core.NewQuery("notes").Build())
+		if count != 2 {
+			t.Errorf("Count() in transaction = %d, want 2", count)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+}
+
+func TestWrap_Cache(t *testing.T) {
+	ctx := context.Background()
+	mem := memory.New()
+	mem.Create(ctx, "users", map[string]interface{}{"id": "u1"})
+
+	cache := map[string]map[string]interface{}{}
+	var calls []adapter.Operation
+	hook := adapter.QueryHookFuncs{
+		Before: func(ctx context.Context, e *adapter.QueryEvent) (context.Context, error) {
+			if record, ok := cache[e.Model]; ok && e.Operation == adapter.OperationFindOne {
+				e.SetResult(record)
+			}
+			return ctx, nil
+		},
+		After: func(ctx context.Context, e *adapter.QueryEvent) {
+			calls = append(calls, e.Operation)
+			if record, ok := e.Result.(map[string]interface{}); ok && e.Err == nil {
+				cache[e.Model] = record
+			}
+		},
+	}
+	db := adapter.Wrap(mem, hook)
+
+	byID := core.NewQuery("users").Where("id", core.OpEqual, "u1").Build()
+	if _, err := db.FindOne(ctx, byID); err != nil {
+		t.Fatalf("FindOne() error = %v", err)
+	}
+
+	// Served from the cache although the record is gone
+	mem.DeleteMany(ctx, core.NewQuery("users").Build())
+	user, err := db.FindOne(ctx, byID)
+	if err != nil || user == nil || user["id"] != "u1" {
+		t.Errorf("FindOne() = %v, %v, want the cached record", user, err)
+	}
+	if len(calls) != 2 {
+		t.Errorf("After ran %d times, want 2", len(calls))
+	}
+
+	// A result of the wrong type is an error rather than a panic
+	wrong := adapter.Wrap(mem, adapter.QueryHookFuncs{
+		Before: func(ctx context.Context, e *adapter.QueryEvent) (context.Context, error) {
+			e.SetResult("not a count")
+			return ctx, nil
+		},
+	})
+	if _, err := wrong.Count(ctx, byID); err == nil {
+		t.Error("Count() expected error for a result of the wrong type")
+	}
+}
+
+func TestWrap_TxOptions(t *testing.T) {
+	db := adapter.Wrap(memory.New())
+	err := db.TransactionWithOptions(context.Background(), core.TxOptions{ReadOnly: true}, func(core.Adapter) error {
+		return nil
+	})
+	if !errors.Is(err, core.ErrTxOptionsUnsupported) {
+		t.Errorf("TransactionWithOptions() error = %v, want ErrTxOptionsUnsupported", err)
+	}
+	if db.ID() != "memory" || db.Unwrap().ID() != "memory" {
+		t.Errorf("ID() = %q", db.ID())
+	}
+}
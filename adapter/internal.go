@@ -4,10 +4,14 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/tokens"
 )
 
 // IDStrategy defines how IDs are generated
@@ -24,11 +28,25 @@ const (
 type InternalAdapter struct {
 	adapter    core.Adapter
 	idStrategy IDStrategy
+	tables     *core.TableNames
+	users      core.UserStore
+	cache      core.UserCache
 }
 
 // InternalAdapterConfig configuration for InternalAdapter
 type InternalAdapterConfig struct {
 	IDStrategy IDStrategy
+
+	// TableNames overrides the default table names (nil keeps the defaults)
+	TableNames *core.TableNames
+
+	// UserStore keeps users outside the database (nil uses the users
+	// table). Its writes are not part of WithTransaction's transaction.
+	UserStore core.UserStore
+
+	// UserCache serves the users of FindSessionWithUser and FindUserByID
+	// from memory. UpdateUser drops the user from it. Nil disables caching.
+	UserCache core.UserCache
 }
 
 // Adapter returns the underlying adapter
@@ -39,13 +57,67 @@ func (ia *InternalAdapter) Adapter() core.Adapter {
 // NewInternalAdapter creates a new internal adapter
 func NewInternalAdapter(adapter core.Adapter, config *InternalAdapterConfig) *InternalAdapter {
 	strategy := IDStrategyApplication
-	if config != nil && config.IDStrategy != "" {
-		strategy = config.IDStrategy
+	var tables *core.TableNames
+	var users core.UserStore
+	var cache core.UserCache
+	if config != nil {
+		if config.IDStrategy != "" {
+			strategy = config.IDStrategy
+		}
+		tables = config.TableNames
+		users = config.UserStore
+		cache = config.UserCache
 	}
 	return &InternalAdapter{
 		adapter:    adapter,
 		idStrategy: strategy,
+		tables:     tables,
+		users:      users,
+		cache:      cache,
+	}
+}
+
+// UserStore returns the external user store, or nil when users are kept
+// in the users table
+func (ia *InternalAdapter) UserStore() core.UserStore {
+	return ia.users
+}
+
+// Capabilities returns the capabilities of the underlying adapter
+func (ia *InternalAdapter) Capabilities() core.Capabilities {
+	return core.AdapterCapabilities(ia.adapter)
+}
+
+// WithTransaction runs fn inside a transaction when the adapter supports
+// them. Otherwise fn runs directly against the adapter and earlier writes
+// are not rolled back if it fails.
+func (ia *InternalAdapter) WithTransaction(ctx context.Context, fn func(*InternalAdapter) error) error {
+	if !ia.Capabilities().TransactionsSupported {
+		return fn(ia)
 	}
+	return ia.adapter.Transaction(ctx, func(tx core.Adapter) error {
+		return fn(ia.WithAdapter(tx))
+	})
+}
+
+// WithAdapter returns an InternalAdapter with the same configuration that
+// runs its queries on a, e.g. a transaction adapter
+func (ia *InternalAdapter) WithAdapter(a core.Adapter) *InternalAdapter {
+	clone := *ia
+	clone.adapter = a
+	return &clone
+}
+
+// Transaction implements core.DataManager with WithTransaction
+func (ia *InternalAdapter) Transaction(ctx context.Context, fn func(core.DataManager) error) error {
+	return ia.WithTransaction(ctx, func(tx *InternalAdapter) error {
+		return fn(tx)
+	})
+}
+
+// Table returns the configured table name for a model
+func (ia *InternalAdapter) Table(model string) string {
+	return ia.tables.Table(model)
 }
 
 // generateID returns a new ID if using Application strategy, or nil if Database strategy
@@ -59,6 +131,10 @@ func (ia *InternalAdapter) generateID() interface{} {
 
 // CreateUser creates a new user
 func (ia *InternalAdapter) CreateUser(ctx context.Context, email, name string) (*core.User, error) {
+	if ia.users != nil {
+		return ia.users.CreateUser(ctx, email, name)
+	}
+
 	now := time.Now()
 	data := map[string]interface{}{
 		"email":          email,
@@ -72,7 +148,7 @@ func (ia *InternalAdapter) CreateUser(ctx context.Context, email, name string) (
 		data["id"] = id
 	}
 
-	result, err := ia.adapter.Create(ctx, "users", data)
+	result, err := ia.adapter.Create(ctx, ia.Table(core.ModelUsers), data)
 	if err != nil {
 		return nil, err
 	}
@@ -82,13 +158,14 @@ func (ia *InternalAdapter) CreateUser(ctx context.Context, email, name string) (
 
 // FindUserByEmail finds a user by email
 func (ia *InternalAdapter) FindUserByEmail(ctx context.Context, email string) (*core.User, error) {
-	query := &core.Query{
-		Model: "users",
-		Where: []core.WhereClause{
-			{Field: "email", Operator: core.OpEqual, Value: email},
-		},
+	if ia.users != nil {
+		return ia.users.FindUserByEmail(ctx, email)
 	}
 
+	query := core.NewQuery(ia.Table(core.ModelUsers)).
+		Where("email", core.OpEqual, email).
+		Build()
+
 	result, err := ia.adapter.FindOne(ctx, query)
 	if err != nil {
 		return nil, err
@@ -100,15 +177,31 @@ func (ia *InternalAdapter) FindUserByEmail(ctx context.Context, email string) (*
 	return mapToUser(result), nil
 }
 
-// FindUserByID finds a user by ID
+// FindUserByID finds a user by ID, in the user cache when there is one
 func (ia *InternalAdapter) FindUserByID(ctx context.Context, id string) (*core.User, error) {
-	query := &core.Query{
-		Model: "users",
-		Where: []core.WhereClause{
-			{Field: "id", Operator: core.OpEqual, Value: id},
-		},
+	if ia.cache == nil {
+		return ia.findUserByID(ctx, id)
+	}
+	if user, ok := ia.cache.GetUser(ctx, id); ok {
+		return user, nil
+	}
+	user, err := ia.findUserByID(ctx, id)
+	if err == nil && user != nil {
+		ia.cache.SetUser(ctx, user)
+	}
+	return user, err
+}
+
+// findUserByID looks a user up in the user store or the users table
+func (ia *InternalAdapter) findUserByID(ctx context.Context, id string) (*core.User, error) {
+	if ia.users != nil {
+		return ia.users.FindUserByID(ctx, id)
 	}
 
+	query := core.NewQuery(ia.Table(core.ModelUsers)).
+		Where("id", core.OpEqual, id).
+		Build()
+
 	result, err := ia.adapter.FindOne(ctx, query)
 	if err != nil {
 		return nil, err
@@ -120,16 +213,23 @@ func (ia *InternalAdapter) FindUserByID(ctx context.Context, id string) (*core.U
 	return mapToUser(result), nil
 }
 
-// UpdateUser updates a user
+// UpdateUser updates a user and drops them from the user cache
 func (ia *InternalAdapter) UpdateUser(ctx context.Context, userID string, data map[string]interface{}) (*core.User, error) {
+	if ia.cache != nil {
+		// Also after the update, in case a lookup cached the old user
+		// while it ran
+		ia.cache.InvalidateUser(ctx, userID)
+		defer ia.cache.InvalidateUser(ctx, userID)
+	}
+	if ia.users != nil {
+		return ia.users.UpdateUser(ctx, userID, data)
+	}
+
 	data["updated_at"] = time.Now()
 
-	query := &core.Query{
-		Model: "users",
-		Where: []core.WhereClause{
-			{Field: "id", Operator: core.OpEqual, Value: userID},
-		},
-	}
+	query := core.NewQuery(ia.Table(core.ModelUsers)).
+		Where("id", core.OpEqual, userID).
+		Build()
 
 	result, err := ia.adapter.Update(ctx, query, data)
 	if err != nil {
@@ -177,7 +277,7 @@ func (ia *InternalAdapter) CreateSession(ctx context.Context, userID string, opt
 		}
 	}
 
-	result, err := ia.adapter.Create(ctx, "sessions", data)
+	result, err := ia.adapter.Create(ctx, ia.Table(core.ModelSessions), data)
 	if err != nil {
 		return nil, err
 	}
@@ -185,17 +285,34 @@ func (ia *InternalAdapter) CreateSession(ctx context.Context, userID string, opt
 	return mapToSession(result), nil
 }
 
-// FindSessionWithUser finds a session and joins with user
+// FindSessionWithUser finds a session and joins with user. Adapters
+// implementing core.SessionUserFinder load both in one query; others take
+// two. Both rows are loaded in full because columns added to the schema
+// populate Metadata. With a UserStore, the user is looked up there, and
+// with a UserCache, the session is loaded alone and its user taken from
+// the cache when it is there.
 func (ia *InternalAdapter) FindSessionWithUser(ctx context.Context, token string) (*core.Session, *core.User, error) {
-	// First find the session
-	sessionQuery := &core.Query{
-		Model: "sessions",
-		Where: []core.WhereClause{
-			{Field: "token", Operator: core.OpEqual, Value: token},
-			{Field: "expires_at", Operator: core.OpGreaterThan, Value: time.Now()},
-		},
+	if finder, ok := ia.adapter.(core.SessionUserFinder); ok && ia.users == nil && ia.cache == nil {
+		sessionResult, userResult, err := finder.FindSessionWithUser(ctx, ia.Table(core.ModelSessions), ia.Table(core.ModelUsers), token, time.Now())
+		if err != nil {
+			return nil, nil, err
+		}
+		if sessionResult == nil {
+			return nil, nil, core.ErrSessionNotFound
+		}
+		session := mapToSession(sessionResult)
+		if userResult == nil {
+			return session, nil, core.ErrUserNotFound
+		}
+		return session, mapToUser(userResult), nil
 	}
 
+	// First find the session
+	sessionQuery := core.NewQuery(ia.Table(core.ModelSessions)).
+		Where("token", core.OpEqual, token).
+		Where("expires_at", core.OpGreaterThan, time.Now()).
+		Build()
+
 	sessionResult, err := ia.adapter.FindOne(ctx, sessionQuery)
 	if err != nil {
 		return nil, nil, err
@@ -207,12 +324,19 @@ func (ia *InternalAdapter) FindSessionWithUser(ctx context.Context, token string
 	session := mapToSession(sessionResult)
 
 	// Then find the user
-	userQuery := &core.Query{
-		Model: "users",
-		Where: []core.WhereClause{
-			{Field: "id", Operator: core.OpEqual, Value: session.UserID},
-		},
+	if ia.users != nil || ia.cache != nil {
+		user, err := ia.FindUserByID(ctx, session.UserID)
+		if errors.Is(err, core.ErrUserNotFound) || (err == nil && user == nil) {
+			return session, nil, core.ErrUserNotFound
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return session, user, nil
 	}
+	userQuery := core.NewQuery(ia.Table(core.ModelUsers)).
+		Where("id", core.OpEqual, session.UserID).
+		Build()
 
 	userResult, err := ia.adapter.FindOne(ctx, userQuery)
 	if err != nil {
@@ -227,26 +351,56 @@ func (ia *InternalAdapter) FindSessionWithUser(ctx context.Context, token string
 	return session, user, nil
 }
 
+// SessionExists reports whether a session with the token is stored,
+// expired or not, without loading it
+func (ia *InternalAdapter) SessionExists(ctx context.Context, token string) (bool, error) {
+	query := core.NewQuery(ia.Table(core.ModelSessions)).
+		Select("id").
+		Where("token", core.OpEqual, token).
+		Build()
+
+	result, err := ia.adapter.FindOne(ctx, query)
+	if err != nil {
+		return false, err
+	}
+	return result != nil, nil
+}
+
+// ListUserSessions returns a user's unexpired sessions, oldest first
+func (ia *InternalAdapter) ListUserSessions(ctx context.Context, userID string) ([]*core.Session, error) {
+	query := core.NewQuery(ia.Table(core.ModelSessions)).
+		Where("user_id", core.OpEqual, userID).
+		Where("expires_at", core.OpGreaterThan, time.Now()).
+		OrderBy("created_at", false).
+		Build()
+
+	results, err := ia.adapter.FindMany(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]*core.Session, len(results))
+	for i, result := range results {
+		sessions[i] = mapToSession(result)
+	}
+
+	return sessions, nil
+}
+
 // RevokeSession revokes a session by token
 func (ia *InternalAdapter) RevokeSession(ctx context.Context, token string) error {
-	query := &core.Query{
-		Model: "sessions",
-		Where: []core.WhereClause{
-			{Field: "token", Operator: core.OpEqual, Value: token},
-		},
-	}
+	query := core.NewQuery(ia.Table(core.ModelSessions)).
+		Where("token", core.OpEqual, token).
+		Build()
 
 	return ia.adapter.Delete(ctx, query)
 }
 
 // RevokeAllUserSessions revokes all sessions for a user
 func (ia *InternalAdapter) RevokeAllUserSessions(ctx context.Context, userID string) (int64, error) {
-	query := &core.Query{
-		Model: "sessions",
-		Where: []core.WhereClause{
-			{Field: "user_id", Operator: core.OpEqual, Value: userID},
-		},
-	}
+	query := core.NewQuery(ia.Table(core.ModelSessions)).
+		Where("user_id", core.OpEqual, userID).
+		Build()
 
 	return ia.adapter.DeleteMany(ctx, query)
 }
@@ -267,7 +421,7 @@ func (ia *InternalAdapter) CreateAccount(ctx context.Context, userID, provider,
 		data["id"] = id
 	}
 
-	result, err := ia.adapter.Create(ctx, "accounts", data)
+	result, err := ia.adapter.Create(ctx, ia.Table(core.ModelAccounts), data)
 	if err != nil {
 		return nil, err
 	}
@@ -294,7 +448,7 @@ func (ia *InternalAdapter) CreateOAuthAccount(ctx context.Context, userID, provi
 		data["id"] = id
 	}
 
-	result, err := ia.adapter.Create(ctx, "accounts", data)
+	result, err := ia.adapter.Create(ctx, ia.Table(core.ModelAccounts), data)
 	if err != nil {
 		return nil, err
 	}
@@ -319,7 +473,7 @@ func (ia *InternalAdapter) CreateCredentialAccount(ctx context.Context, userID,
 		data["id"] = id
 	}
 
-	result, err := ia.adapter.Create(ctx, "accounts", data)
+	result, err := ia.adapter.Create(ctx, ia.Table(core.ModelAccounts), data)
 	if err != nil {
 		return nil, err
 	}
@@ -327,64 +481,110 @@ func (ia *InternalAdapter) CreateCredentialAccount(ctx context.Context, userID,
 	return mapToAccount(result), nil
 }
 
-// FindAccountByProvider finds an account by provider and account ID
-func (ia *InternalAdapter) FindAccountByProvider(ctx context.Context, provider, accountID string) (*core.Account, error) {
-	query := &core.Query{
-		Model: "accounts",
-		Where: []core.WhereClause{
-			{Field: "provider_id", Operator: core.OpEqual, Value: provider},
-			{Field: "account_id", Operator: core.OpEqual, Value: accountID},
-		},
+// UpdateCredentialPassword replaces the password hash of a user's credential
+// account, the one FindCredentialAccount finds. It returns core.ErrNotFound
+// when no account was updated.
+func (ia *InternalAdapter) UpdateCredentialPassword(ctx context.Context, userID, passwordHash string) error {
+	account, err := ia.FindCredentialAccount(ctx, userID)
+	if err != nil {
+		return err
 	}
 
-	result, err := ia.adapter.FindOne(ctx, query)
+	query := core.NewQuery(ia.Table(core.ModelAccounts)).
+		Where("id", core.OpEqual, account.ID).
+		Where("user_id", core.OpEqual, userID).
+		Build()
+
+	updated, err := ia.adapter.UpdateMany(ctx, query, map[string]interface{}{
+		"password":   passwordHash,
+		"updated_at": time.Now(),
+	})
 	if err != nil {
-		return nil, err
+		return err
 	}
-	if result == nil {
-		return nil, nil
+	if updated == 0 {
+		return core.ErrNotFound
 	}
 
-	return mapToAccount(result), nil
+	return nil
 }
 
-// CreateVerification creates a verification token
-func (ia *InternalAdapter) CreateVerification(ctx context.Context, identifier, verifyType string, expiresIn time.Duration) (*core.Verification, error) {
-	token, err := generateVerificationToken()
+// FindCredentialAccount finds the credential (email/password) account of a
+// user. Accounts written by v0.6.1 and earlier have no provider_type until
+// migrated; one with a password counts as the credential account.
+func (ia *InternalAdapter) FindCredentialAccount(ctx context.Context, userID string) (*core.Account, error) {
+	query := core.NewQuery(ia.Table(core.ModelAccounts)).
+		Where("user_id", core.OpEqual, userID).
+		Build()
+
+	results, err := ia.adapter.FindMany(ctx, query)
 	if err != nil {
 		return nil, err
 	}
 
-	now := time.Now()
-	data := map[string]interface{}{
-		"identifier": identifier,
-		"token":      token,
-		"type":       verifyType,
-		"expires_at": now.Add(expiresIn),
-		"created_at": now,
+	var legacy *core.Account
+	for _, result := range results {
+		account := mapToAccount(result)
+		switch {
+		case account.ProviderType == "credential":
+			return account, nil
+		case account.ProviderType == "" && account.Password != "" && legacy == nil:
+			legacy = account
+		}
 	}
-
-	if id := ia.generateID(); id != nil {
-		data["id"] = id
+	if legacy != nil {
+		return legacy, nil
 	}
 
-	result, err := ia.adapter.Create(ctx, "verifications", data)
+	return nil, core.ErrNotFound
+}
+
+// FindAccountByProvider finds an account by provider and account ID
+func (ia *InternalAdapter) FindAccountByProvider(ctx context.Context, provider, accountID string) (*core.Account, error) {
+	query := core.NewQuery(ia.Table(core.ModelAccounts)).
+		Where("provider_id", core.OpEqual, provider).
+		Where("account_id", core.OpEqual, accountID).
+		Build()
+
+	result, err := ia.adapter.FindOne(ctx, query)
 	if err != nil {
 		return nil, err
 	}
+	if result == nil {
+		return nil, nil
+	}
 
-	return mapToVerification(result), nil
+	return mapToAccount(result), nil
 }
 
-// FindVerification finds a verification by token
-func (ia *InternalAdapter) FindVerification(ctx context.Context, token string) (*core.Verification, error) {
-	query := &core.Query{
-		Model: "verifications",
-		Where: []core.WhereClause{
-			{Field: "token", Operator: core.OpEqual, Value: token},
-			{Field: "expires_at", Operator: core.OpGreaterThan, Value: time.Now()},
-		},
+// Tokens returns the token service of the verifications table, with the
+// table names and ID strategy of ia
+func (ia *InternalAdapter) Tokens() *tokens.Service {
+	return tokens.New(ia.adapter, tokens.Config{
+		TableNames:  ia.tables,
+		DatabaseIDs: ia.idStrategy == IDStrategyDatabase,
+	})
+}
+
+// CreateVerification creates a verification token of verifyType for
+// identifier. The Token of the returned verification is the token to send
+// to the user; the database keeps its hash.
+func (ia *InternalAdapter) CreateVerification(ctx context.Context, identifier, verifyType string, expiresIn time.Duration) (*core.Verification, error) {
+	token, verification, err := ia.Tokens().Create(ctx, tokens.Purpose(verifyType), identifier, expiresIn)
+	if err != nil {
+		return nil, err
 	}
+	verification.Token = token
+	return verification, nil
+}
+
+// FindVerification finds an unexpired verification by token, whatever its
+// type
+func (ia *InternalAdapter) FindVerification(ctx context.Context, token string) (*core.Verification, error) {
+	query := core.NewQuery(ia.Table(core.ModelVerifications)).
+		Where("token", core.OpEqual, tokens.Hash(token)).
+		Where("expires_at", core.OpGreaterThan, time.Now()).
+		Build()
 
 	result, err := ia.adapter.FindOne(ctx, query)
 	if err != nil {
@@ -397,6 +597,13 @@ func (ia *InternalAdapter) FindVerification(ctx context.Context, token string) (
 	return mapToVerification(result), nil
 }
 
+// ConsumeVerification returns and deletes the verification of token if it
+// is of verifyType and unexpired. It returns tokens.ErrInvalidToken
+// otherwise.
+func (ia *InternalAdapter) ConsumeVerification(ctx context.Context, verifyType, token string) (*core.Verification, error) {
+	return ia.Tokens().Consume(ctx, tokens.Purpose(verifyType), token)
+}
+
 // Helper functions
 
 func mapToUser(data map[string]interface{}) *core.User {
@@ -417,6 +624,7 @@ func mapToUser(data map[string]interface{}) *core.User {
 		"banned":             true,
 		"ban_reason":         true,
 		"ban_expires":        true,
+		"tenant_id":          true,
 	}
 
 	if id, ok := data["id"]; ok {
@@ -425,8 +633,8 @@ func mapToUser(data map[string]interface{}) *core.User {
 	if email, ok := data["email"].(string); ok {
 		user.Email = email
 	}
-	if emailVerified, ok := data["email_verified"].(bool); ok {
-		user.EmailVerified = emailVerified
+	if v, ok := data["email_verified"]; ok {
+		user.EmailVerified = toBool(v)
 	}
 	if name, ok := data["name"].(string); ok {
 		user.Name = name
@@ -434,14 +642,17 @@ func mapToUser(data map[string]interface{}) *core.User {
 	if image, ok := data["image"].(string); ok {
 		user.Image = image
 	}
-	if twoFactor, ok := data["two_factor_enabled"].(bool); ok {
-		user.TwoFactorEnabled = twoFactor
+	if v, ok := data["two_factor_enabled"]; ok {
+		user.TwoFactorEnabled = toBool(v)
+	}
+	if tenantID, ok := data["tenant_id"].(string); ok {
+		user.TenantID = tenantID
 	}
 	if role, ok := data["role"].(string); ok {
 		user.Role = role
 	}
-	if banned, ok := data["banned"].(bool); ok {
-		user.Banned = banned
+	if v, ok := data["banned"]; ok {
+		user.Banned = toBool(v)
 	}
 	if banReason, ok := data["ban_reason"].(string); ok {
 		user.BanReason = banReason
@@ -483,6 +694,9 @@ func mapToSession(data map[string]interface{}) *core.Session {
 		"created_at":      true,
 		"updated_at":      true,
 		"impersonated_by": true,
+		"fingerprint":     true,
+		"tenant_id":       true,
+		"metadata":        true,
 	}
 
 	if id, ok := data["id"]; ok {
@@ -509,9 +723,28 @@ func mapToSession(data map[string]interface{}) *core.Session {
 	if updatedAt, ok := data["updated_at"].(time.Time); ok {
 		session.UpdatedAt = updatedAt
 	}
+	if fingerprint, ok := data["fingerprint"].(string); ok {
+		session.Fingerprint = fingerprint
+	}
 	if impersonatedBy, ok := data["impersonated_by"].(string); ok {
 		session.ImpersonatedBy = impersonatedBy
 	}
+	if tenantID, ok := data["tenant_id"].(string); ok {
+		session.TenantID = tenantID
+	}
+
+	// Metadata set with session.Manager.SetMetadata is stored as JSON.
+	// Columns added to the schema take precedence.
+	var metadata map[string]interface{}
+	switch v := data["metadata"].(type) {
+	case string:
+		_ = json.Unmarshal([]byte(v), &metadata)
+	case []byte:
+		_ = json.Unmarshal(v, &metadata)
+	}
+	for k, v := range metadata {
+		session.Metadata[k] = v
+	}
 
 	for k, v := range data {
 		if !knownFields[k] {
@@ -542,6 +775,11 @@ func mapToAccount(data map[string]interface{}) *core.Account {
 		"id_token":                 true,
 		"created_at":               true,
 		"updated_at":               true,
+		"tenant_id":                true,
+
+		// Deprecated columns written by v0.6.1 and earlier
+		"provider":      true,
+		"password_hash": true,
 	}
 
 	if id, ok := data["id"]; ok {
@@ -562,6 +800,15 @@ func mapToAccount(data map[string]interface{}) *core.Account {
 	if password, ok := data["password"].(string); ok {
 		account.Password = password
 	}
+
+	// Rows not yet moved to the current columns by `beacon migrate --from
+	// beacon-legacy` still carry their values in the deprecated ones
+	if provider, ok := data["provider"].(string); ok && account.ProviderID == "" {
+		account.ProviderID = provider
+	}
+	if passwordHash, ok := data["password_hash"].(string); ok && account.Password == "" {
+		account.Password = passwordHash
+	}
 	if accessToken, ok := data["access_token"].(string); ok {
 		account.AccessToken = accessToken
 	}
@@ -584,6 +831,9 @@ func mapToAccount(data map[string]interface{}) *core.Account {
 	if idToken, ok := data["id_token"].(string); ok {
 		account.IDToken = idToken
 	}
+	if tenantID, ok := data["tenant_id"].(string); ok {
+		account.TenantID = tenantID
+	}
 
 	if createdAt, ok := data["created_at"].(time.Time); ok {
 		account.CreatedAt = createdAt
@@ -610,8 +860,11 @@ func mapToVerification(data map[string]interface{}) *core.Verification {
 	if identifier, ok := data["identifier"].(string); ok {
 		verification.Identifier = identifier
 	}
-	if value, ok := data["value"].(string); ok {
-		verification.Value = value
+	if token, ok := data["token"].(string); ok {
+		verification.Token = token
+	}
+	if verifyType, ok := data["type"].(string); ok {
+		verification.Type = verifyType
 	}
 	if expiresAt, ok := data["expires_at"].(time.Time); ok {
 		verification.ExpiresAt = expiresAt
@@ -642,14 +895,6 @@ func generateSessionToken() (string, error) {
 	return base64.URLEncoding.EncodeToString(b), nil
 }
 
-func generateVerificationToken() (string, error) {
-	b := make([]byte, 32)
-	if _, err := rand.Read(b); err != nil {
-		return "", err
-	}
-	return base64.URLEncoding.EncodeToString(b), nil
-}
-
 // toString safely converts an interface{} (usually from DB) to a string
 func toString(v interface{}) string {
 	if v == nil {
@@ -670,3 +915,22 @@ func toString(v interface{}) string {
 		return ""
 	}
 }
+
+// toBool safely converts an interface{} (usually from DB) to a bool.
+// Databases without a boolean type, such as SQLite, return integers.
+func toBool(v interface{}) bool {
+	switch val := v.(type) {
+	case bool:
+		return val
+	case int64:
+		return val != 0
+	case int:
+		return val != 0
+	case []byte:
+		return string(val) == "1" || strings.EqualFold(string(val), "true")
+	case string:
+		return val == "1" || strings.EqualFold(val, "true")
+	default:
+		return false
+	}
+}
@@ -0,0 +1,237 @@
+package adapter_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/adapter"
+	"github.com/marshallshelly/beacon-auth/adapters/memory"
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+func TestInternalAdapterTableNames(t *testing.T) {
+	ctx := context.Background()
+	mem := memory.New()
+
+	// A legacy table that happens to use a default name
+	if _, err := mem.Create(ctx, "users", map[string]interface{}{"id": "legacy", "email": "legacy@example.com"}); err != nil {
+		t.Fatalf("Failed to create legacy row: %v", err)
+	}
+
+	ia := adapter.NewInternalAdapter(mem, &adapter.InternalAdapterConfig{
+		TableNames: &core.TableNames{
+			Users:         "auth_users",
+			Sessions:      "auth_sessions",
+			Accounts:      "auth_accounts",
+			Verifications: "auth_verifications",
+		},
+	})
+
+	if _, err := ia.FindUserByEmail(ctx, "legacy@example.com"); err == nil {
+		t.Error("Expected legacy users table to be ignored")
+	}
+
+	user, err := ia.CreateUser(ctx, "new@example.com", "New")
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	if _, err := ia.CreateSession(ctx, user.ID, nil); err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+	if _, err := ia.CreateCredentialAccount(ctx, user.ID, user.Email, "hash"); err != nil {
+		t.Fatalf("CreateCredentialAccount() error = %v", err)
+	}
+	if _, err := ia.CreateVerification(ctx, user.Email, "email", time.Hour); err != nil {
+		t.Fatalf("CreateVerification() error = %v", err)
+	}
+
+	for _, table := range []string{"auth_users", "auth_sessions", "auth_accounts", "auth_verifications"} {
+		count, err := mem.Count(ctx, &core.Query{Model: table})
+		if err != nil {
+			t.Fatalf("Count(%s) error = %v", table, err)
+		}
+		if count != 1 {
+			t.Errorf("Count(%s) = %d, want 1", table, count)
+		}
+	}
+
+	if count, _ := mem.Count(ctx, &core.Query{Model: "users"}); count != 1 {
+		t.Errorf("legacy users table has %d rows, want 1", count)
+	}
+}
+
+func TestInternalAdapterSessionExists(t *testing.T) {
+	ctx := context.Background()
+	ia := adapter.NewInternalAdapter(memory.New(), nil)
+
+	user, err := ia.CreateUser(ctx, "user@example.com", "User")
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	session, err := ia.CreateSession(ctx, user.ID, nil)
+	if err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+
+	if exists, err := ia.SessionExists(ctx, session.Token); err != nil || !exists {
+		t.Errorf("SessionExists() = %v, %v, want true", exists, err)
+	}
+	if exists, err := ia.SessionExists(ctx, "missing"); err != nil || exists {
+		t.Errorf("SessionExists(missing) = %v, %v, want false", exists, err)
+	}
+}
+
+// joinAdapter serves session lookups through core.SessionUserFinder
+type joinAdapter struct {
+	*memory.MemoryAdapter
+	joins int
+}
+
+func (a *joinAdapter) FindSessionWithUser(ctx context.Context, sessionModel, userModel, token string, now time.Time) (map[string]interface{}, map[string]interface{}, error) {
+	a.joins++
+	if token != "tok" {
+		return nil, nil, nil
+	}
+	return map[string]interface{}{"id": "s1", "user_id": "u1", "token": token},
+		map[string]interface{}{"id": "u1", "email": "user@example.com", "plan": "pro"}, nil
+}
+
+func TestInternalAdapterFindSessionWithUserJoin(t *testing.T) {
+	ctx := context.Background()
+	join := &joinAdapter{MemoryAdapter: memory.New()}
+	ia := adapter.NewInternalAdapter(join, nil)
+
+	session, user, err := ia.FindSessionWithUser(ctx, "tok")
+	if err != nil {
+		t.Fatalf("FindSessionWithUser() error = %v", err)
+	}
+	if session.ID != "s1" || user.Email != "user@example.com" || user.Metadata["plan"] != "pro" {
+		t.Errorf("FindSessionWithUser() = %+v, %+v", session, user)
+	}
+	if join.joins != 1 {
+		t.Errorf("joins = %d, want 1", join.joins)
+	}
+
+	if _, _, err := ia.FindSessionWithUser(ctx, "missing"); err != core.ErrSessionNotFound {
+		t.Errorf("FindSessionWithUser(missing) error = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestInternalAdapterFindCredentialAccountLegacyColumns(t *testing.T) {
+	ctx := context.Background()
+	mem := memory.New()
+	ia := adapter.NewInternalAdapter(mem, nil)
+
+	// An account written by v0.6.1, before the columns were renamed
+	if _, err := mem.Create(ctx, "accounts", map[string]interface{}{
+		"id": "a1", "user_id": "u1", "account_id": "ada@example.com",
+		"provider": "credential", "password_hash": "legacy-hash",
+	}); err != nil {
+		t.Fatalf("Failed to create legacy account: %v", err)
+	}
+
+	account, err := ia.FindCredentialAccount(ctx, "u1")
+	if err != nil {
+		t.Fatalf("FindCredentialAccount() error = %v", err)
+	}
+	if account.Password != "legacy-hash" || account.ProviderID != "credential" {
+		t.Errorf("FindCredentialAccount() = %+v, want the legacy password and provider", account)
+	}
+	if _, ok := account.Metadata["password_hash"]; ok {
+		t.Error("Expected legacy columns to be kept out of Metadata")
+	}
+
+	if _, err := ia.FindCredentialAccount(ctx, "u2"); err != core.ErrNotFound {
+		t.Errorf("FindCredentialAccount() for a user without accounts error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestInternalAdapterUpdateCredentialPassword(t *testing.T) {
+	ctx := context.Background()
+	mem := memory.New()
+	ia := adapter.NewInternalAdapter(mem, nil)
+
+	// A legacy account without provider_type, next to an OAuth account
+	for _, account := range []map[string]interface{}{
+		{"id": "a1", "user_id": "u1", "provider_id": "github", "provider_type": "oauth", "account_id": "1"},
+		{"id": "a2", "user_id": "u1", "provider_id": "local", "account_id": "ada@example.com", "password": "old-hash"},
+	} {
+		if _, err := mem.Create(ctx, "accounts", account); err != nil {
+			t.Fatalf("Failed to create account: %v", err)
+		}
+	}
+
+	if err := ia.UpdateCredentialPassword(ctx, "u1", "new-hash"); err != nil {
+		t.Fatalf("UpdateCredentialPassword() error = %v", err)
+	}
+	account, err := ia.FindCredentialAccount(ctx, "u1")
+	if err != nil {
+		t.Fatalf("FindCredentialAccount() error = %v", err)
+	}
+	if account.ID != "a2" || account.Password != "new-hash" {
+		t.Errorf("FindCredentialAccount() = %+v, want a2 with the new hash", account)
+	}
+	oauth, err := mem.FindOne(ctx, core.NewQuery("accounts").Where("id", core.OpEqual, "a1").Build())
+	if err != nil || oauth["password"] != nil {
+		t.Errorf("Expected the OAuth account to keep no password, got %v (%v)", oauth, err)
+	}
+
+	if err := ia.UpdateCredentialPassword(ctx, "u2", "new-hash"); err != core.ErrNotFound {
+		t.Errorf("UpdateCredentialPassword() for a user without accounts error = %v, want ErrNotFound", err)
+	}
+}
+
+// mapUserCache is a core.UserCache that counts its hits
+type mapUserCache struct {
+	users map[string]core.User
+	hits  int
+}
+
+func (c *mapUserCache) GetUser(_ context.Context, id string) (*core.User, bool) {
+	u, ok := c.users[id]
+	if ok {
+		c.hits++
+	}
+	return &u, ok
+}
+
+func (c *mapUserCache) SetUser(_ context.Context, u *core.User) { c.users[u.ID] = *u }
+
+func (c *mapUserCache) InvalidateUser(_ context.Context, id string) { delete(c.users, id) }
+
+func TestInternalAdapterUserCache(t *testing.T) {
+	ctx := context.Background()
+	join := &joinAdapter{MemoryAdapter: memory.New()}
+	cache := &mapUserCache{users: make(map[string]core.User)}
+	ia := adapter.NewInternalAdapter(join, &adapter.InternalAdapterConfig{UserCache: cache})
+
+	user, err := ia.CreateUser(ctx, "user@example.com", "User")
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	session, err := ia.CreateSession(ctx, user.ID, nil)
+	if err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		_, got, err := ia.FindSessionWithUser(ctx, session.Token)
+		if err != nil || got.ID != user.ID {
+			t.Fatalf("FindSessionWithUser() = %+v, %v", got, err)
+		}
+	}
+	if cache.hits != 1 || join.joins != 0 {
+		t.Errorf("hits = %d, joins = %d, want the second lookup served from the cache", cache.hits, join.joins)
+	}
+
+	if _, err := ia.UpdateUser(ctx, user.ID, map[string]interface{}{"name": "Renamed"}); err != nil {
+		t.Fatalf("UpdateUser() error = %v", err)
+	}
+	if _, ok := cache.users[user.ID]; ok {
+		t.Error("UpdateUser() left the old user cached")
+	}
+	if _, got, _ := ia.FindSessionWithUser(ctx, session.Token); got.Name != "Renamed" {
+		t.Errorf("user after update = %+v", got)
+	}
+}
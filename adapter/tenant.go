@@ -0,0 +1,83 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// WithTenancy returns inner with every call on the tenant-scoped tables
+// (core.TenantModels, named by tables) limited to the tenant set on the
+// caller's context with core.WithTenant. Reads, updates and deletes only
+// see the tenant's records, created records are given the tenant, and
+// updates cannot move a record to another tenant.
+//
+// Like Wrap, the result does not expose SessionUserFinder, so session
+// lookups are scoped as well.
+func WithTenancy(inner core.Adapter, tenancy core.TenancyConfig, tables *core.TableNames) *HookedAdapter {
+	scoped := make(map[string]bool, len(core.TenantModels))
+	for _, model := range core.TenantModels {
+		scoped[tables.Table(model)] = true
+	}
+	return Wrap(inner, &tenantHook{tables: scoped, require: tenancy.RequireTenant})
+}
+
+// tenantHook is a QueryHook scoping tenant tables to the context's tenant
+type tenantHook struct {
+	tables  map[string]bool
+	require bool
+}
+
+// BeforeQuery adds the tenant to the query or the written records
+func (h *tenantHook) BeforeQuery(ctx context.Context, event *QueryEvent) (context.Context, error) {
+	if !h.tables[event.Model] {
+		return ctx, nil
+	}
+
+	tenantID, _ := core.TenantFromContext(ctx)
+	if tenantID == "" && h.require {
+		return ctx, fmt.Errorf("adapter: %s %s: %w", event.Operation, event.Model, core.ErrTenantRequired)
+	}
+
+	if query := event.Query; query != nil {
+		// The tenant condition is ANDed with the others, which would not
+		// scope an OR, and joined tables would be left unscoped
+		if len(query.Joins) > 0 || slices.ContainsFunc(query.Where, func(c core.WhereClause) bool { return c.Or }) {
+			return ctx, fmt.Errorf("adapter: %s queries with joins or OR conditions cannot be scoped to a tenant", event.Model)
+		}
+		query.Where = append(query.Where, core.WhereClause{Field: core.TenantColumn, Operator: core.OpEqual, Value: tenantID})
+	}
+
+	switch event.Operation {
+	case OperationCreate:
+		event.Data = withTenant(event.Data, tenantID)
+	case OperationCreateMany:
+		for i, record := range event.Records {
+			event.Records[i] = withTenant(record, tenantID)
+		}
+	case OperationUpsert:
+		// Unique keys of tenant tables include the tenant
+		event.Data = withTenant(event.Data, tenantID)
+		if !slices.Contains(event.ConflictFields, core.TenantColumn) {
+			event.ConflictFields = append([]string{core.TenantColumn}, event.ConflictFields...)
+		}
+	case OperationUpdate, OperationUpdateMany:
+		delete(event.Data, core.TenantColumn)
+	}
+	return ctx, nil
+}
+
+// AfterQuery does nothing
+func (h *tenantHook) AfterQuery(ctx context.Context, event *QueryEvent) {}
+
+// withTenant sets the tenant column of a record copy, creating the map for
+// a nil record
+func withTenant(record map[string]interface{}, tenantID string) map[string]interface{} {
+	if record == nil {
+		record = make(map[string]interface{}, 1)
+	}
+	record[core.TenantColumn] = tenantID
+	return record
+}
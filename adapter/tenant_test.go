@@ -0,0 +1,86 @@
+package adapter_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/marshallshelly/beacon-auth/adapter"
+	"github.com/marshallshelly/beacon-auth/adapters/memory"
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+func TestWithTenancy(t *testing.T) {
+	inner := memory.New(memory.WithTenantUniques())
+	db := adapter.WithTenancy(inner, core.TenancyConfig{}, nil)
+	acme := core.WithTenant(context.Background(), "acme")
+	globex := core.WithTenant(context.Background(), "globex")
+	byEmail := core.NewQuery("users").Where("email", core.OpEqual, "a@example.com").Build()
+
+	for _, ctx := range []context.Context{acme, globex} {
+		if _, err := db.Create(ctx, "users", map[string]interface{}{"email": "a@example.com", "tenant_id": "other"}); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+	if _, err := db.Create(acme, "users", map[string]interface{}{"email": "a@example.com"}); !errors.Is(err, core.ErrDuplicate) {
+		t.Errorf("Create() duplicate in tenant error = %v, want ErrDuplicate", err)
+	}
+
+	user, err := db.FindOne(acme, byEmail)
+	if err != nil || user == nil || user["tenant_id"] != "acme" {
+		t.Fatalf("FindOne() = %v, %v, want the acme user", user, err)
+	}
+	if n, _ := inner.Count(context.Background(), core.NewQuery("users").Build()); n != 2 {
+		t.Errorf("inner Count() = %d, want 2", n)
+	}
+
+	// Without a tenant only the default tenant is visible
+	if found, _ := db.FindOne(context.Background(), byEmail); found != nil {
+		t.Errorf("FindOne() without a tenant = %v, want nil", found)
+	}
+
+	// Updates cannot move records to another tenant or reach other tenants
+	if _, err := db.Update(acme, byEmail, map[string]interface{}{"tenant_id": "globex", "name": "A"}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if found, _ := db.FindOne(globex, byEmail); found["name"] != nil {
+		t.Errorf("Update() in acme changed the globex user: %v", found)
+	}
+	if found, _ := db.FindOne(acme, byEmail); found["tenant_id"] != "acme" || found["name"] != "A" {
+		t.Errorf("FindOne() after Update() = %v", found)
+	}
+
+	if n, _ := db.DeleteMany(globex, core.NewQuery("users").Build()); n != 1 {
+		t.Errorf("DeleteMany() = %d, want 1", n)
+	}
+	if found, _ := db.FindOne(acme, byEmail); found == nil {
+		t.Error("DeleteMany() in globex deleted the acme user")
+	}
+
+	// Other tables are not scoped
+	if _, err := db.Create(acme, "verifications", map[string]interface{}{"token": "t"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if found, _ := db.FindOne(globex, core.NewQuery("verifications").Build()); found == nil || found["tenant_id"] != nil {
+		t.Errorf("FindOne() on verifications = %v, want the unscoped record", found)
+	}
+
+	or := core.NewQuery("users").Where("email", core.OpEqual, "a").OrWhere("email", core.OpEqual, "b").Build()
+	if _, err := db.FindMany(acme, or); err == nil {
+		t.Error("FindMany() with OR conditions succeeded, want an error")
+	}
+}
+
+func TestWithTenancy_RequireTenant(t *testing.T) {
+	db := adapter.WithTenancy(memory.New(), core.TenancyConfig{RequireTenant: true}, &core.TableNames{Prefix: "auth_"})
+
+	if _, err := db.FindOne(context.Background(), core.NewQuery("auth_users").Build()); !errors.Is(err, core.ErrTenantRequired) {
+		t.Errorf("FindOne() error = %v, want ErrTenantRequired", err)
+	}
+	if _, err := db.FindOne(core.WithTenant(context.Background(), "acme"), core.NewQuery("auth_users").Build()); err != nil {
+		t.Errorf("FindOne() with a tenant error = %v", err)
+	}
+	if _, err := db.FindOne(context.Background(), core.NewQuery("users").Build()); err != nil {
+		t.Errorf("FindOne() on an unscoped table error = %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package adapter
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -25,6 +26,7 @@ type TestSuite struct {
 // RunAll runs all tests in the suite
 func (suite *TestSuite) RunAll(t *testing.T) {
 	t.Run("Create", suite.TestCreate)
+	t.Run("CreateMany", suite.TestCreateMany)
 	t.Run("FindOne", suite.TestFindOne)
 	t.Run("FindMany", suite.TestFindMany)
 	t.Run("Update", suite.TestUpdate)
@@ -32,9 +34,12 @@ func (suite *TestSuite) RunAll(t *testing.T) {
 	t.Run("Delete", suite.TestDelete)
 	t.Run("DeleteMany", suite.TestDeleteMany)
 	t.Run("Count", suite.TestCount)
+	t.Run("Upsert", suite.TestUpsert)
+	t.Run("Unique", suite.TestUnique)
 	t.Run("Operators", suite.TestOperators)
 	t.Run("LimitOffset", suite.TestLimitOffset)
 	t.Run("OrderBy", suite.TestOrderBy)
+	t.Run("Select", suite.TestSelect)
 	t.Run("Transaction", suite.TestTransaction)
 	t.Run("Ping", suite.TestPing)
 }
@@ -72,6 +77,60 @@ func (suite *TestSuite) TestCreate(t *testing.T) {
 	}
 }
 
+// TestCreateMany tests the CreateMany operation
+func (suite *TestSuite) TestCreateMany(t *testing.T) {
+	if suite.SetupFunc != nil {
+		suite.SetupFunc(t, suite.Adapter)
+	}
+	if suite.TeardownFunc != nil {
+		defer suite.TeardownFunc(t, suite.Adapter)
+	}
+
+	ctx := context.Background()
+
+	data := []map[string]interface{}{
+		{"id": "user1", "email": "user1@example.com", "name": "User 1"},
+		{"id": "user2", "email": "user2@example.com", "name": "User 2"},
+		{"id": "user3", "email": "user3@example.com", "name": "User 3"},
+	}
+
+	created, err := suite.Adapter.CreateMany(ctx, "users", data)
+	if err != nil {
+		t.Fatalf("CreateMany failed: %v", err)
+	}
+	if created != 3 {
+		t.Errorf("Expected 3 records created, got %d", created)
+	}
+
+	result, err := suite.Adapter.FindOne(ctx, &core.Query{
+		Model: "users",
+		Where: []core.WhereClause{
+			{Field: "id", Operator: core.OpEqual, Value: "user2"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("FindOne failed: %v", err)
+	}
+	if result == nil || result["email"] != "user2@example.com" {
+		t.Errorf("Expected user2 to be created, got %v", result)
+	}
+
+	// An empty batch is a no-op
+	created, err = suite.Adapter.CreateMany(ctx, "users", nil)
+	if err != nil || created != 0 {
+		t.Errorf("Expected empty CreateMany to create nothing, got %d, %v", created, err)
+	}
+
+	// Records must share the same fields
+	_, err = suite.Adapter.CreateMany(ctx, "users", []map[string]interface{}{
+		{"id": "user4", "email": "user4@example.com"},
+		{"id": "user5", "name": "User 5"},
+	})
+	if err == nil {
+		t.Error("Expected error for records with different fields")
+	}
+}
+
 // TestFindOne tests the FindOne operation
 func (suite *TestSuite) TestFindOne(t *testing.T) {
 	if suite.SetupFunc != nil {
@@ -405,6 +464,143 @@ func (suite *TestSuite) TestCount(t *testing.T) {
 	}
 }
 
+// TestUpsert tests the Upsert operation
+func (suite *TestSuite) TestUpsert(t *testing.T) {
+	if suite.SetupFunc != nil {
+		suite.SetupFunc(t, suite.Adapter)
+	}
+	if suite.TeardownFunc != nil {
+		defer suite.TeardownFunc(t, suite.Adapter)
+	}
+
+	ctx := context.Background()
+
+	// Insert when no record exists
+	result, err := suite.Adapter.Upsert(ctx, "users", []string{"id"}, map[string]interface{}{
+		"id":    "user1",
+		"email": "test@example.com",
+		"name":  "Old Name",
+	})
+	if err != nil {
+		t.Fatalf("Upsert (insert) failed: %v", err)
+	}
+	if result["name"] != "Old Name" {
+		t.Errorf("Expected name=Old Name, got %v", result["name"])
+	}
+
+	// Update the existing record
+	result, err = suite.Adapter.Upsert(ctx, "users", []string{"id"}, map[string]interface{}{
+		"id":    "user1",
+		"email": "test@example.com",
+		"name":  "New Name",
+	})
+	if err != nil {
+		t.Fatalf("Upsert (update) failed: %v", err)
+	}
+	if result["id"] != "user1" || result["name"] != "New Name" {
+		t.Errorf("Expected updated user1, got %v", result)
+	}
+
+	count, err := suite.Adapter.Count(ctx, &core.Query{
+		Model: "users",
+		Where: []core.WhereClause{
+			{Field: "id", Operator: core.OpEqual, Value: "user1"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Count failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 record after upserts, got %d", count)
+	}
+
+	// Only conflict fields: the existing record is returned unchanged
+	result, err = suite.Adapter.Upsert(ctx, "users", []string{"id"}, map[string]interface{}{
+		"id": "user1",
+	})
+	if err != nil {
+		t.Fatalf("Upsert (conflict fields only) failed: %v", err)
+	}
+	if result["id"] != "user1" {
+		t.Errorf("Expected id=user1, got %v", result["id"])
+	}
+
+	// Conflict fields must be present in data
+	if _, err := suite.Adapter.Upsert(ctx, "users", []string{"id"}, map[string]interface{}{
+		"name": "No ID",
+	}); err == nil {
+		t.Error("Expected error for missing conflict field")
+	}
+}
+
+// TestUnique tests that writes keep users.email unique, as the generated
+// schema does, failing with core.ErrDuplicate
+func (suite *TestSuite) TestUnique(t *testing.T) {
+	if suite.SetupFunc != nil {
+		suite.SetupFunc(t, suite.Adapter)
+	}
+	if suite.TeardownFunc != nil {
+		defer suite.TeardownFunc(t, suite.Adapter)
+	}
+
+	ctx := context.Background()
+	byID := func(id string) *core.Query {
+		return &core.Query{
+			Model: "users",
+			Where: []core.WhereClause{{Field: "id", Operator: core.OpEqual, Value: id}},
+		}
+	}
+
+	if _, err := suite.Adapter.Create(ctx, "users", map[string]interface{}{"id": "user1", "email": "taken@example.com"}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := suite.Adapter.Create(ctx, "users", map[string]interface{}{"id": "user2", "email": "taken@example.com"}); !errors.Is(err, core.ErrDuplicate) {
+		t.Errorf("Create with a taken email: expected ErrDuplicate, got %v", err)
+	}
+
+	// A batch with a taken email stores none of its records
+	_, err := suite.Adapter.CreateMany(ctx, "users", []map[string]interface{}{
+		{"id": "user3", "email": "free@example.com"},
+		{"id": "user4", "email": "taken@example.com"},
+	})
+	if !errors.Is(err, core.ErrDuplicate) {
+		t.Errorf("CreateMany with a taken email: expected ErrDuplicate, got %v", err)
+	}
+	if found, _ := suite.Adapter.FindOne(ctx, byID("user3")); found != nil {
+		t.Errorf("Expected CreateMany to store nothing, found %v", found)
+	}
+
+	// Updating to a taken email fails and leaves the record unchanged
+	if _, err := suite.Adapter.Create(ctx, "users", map[string]interface{}{"id": "user2", "email": "other@example.com"}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := suite.Adapter.Update(ctx, byID("user2"), map[string]interface{}{"email": "taken@example.com"}); !errors.Is(err, core.ErrDuplicate) {
+		t.Errorf("Update to a taken email: expected ErrDuplicate, got %v", err)
+	}
+	if found, _ := suite.Adapter.FindOne(ctx, byID("user2")); found == nil || found["email"] != "other@example.com" {
+		t.Errorf("Expected user2 to keep its email, got %v", found)
+	}
+
+	// Keeping its own email is not a conflict
+	if _, err := suite.Adapter.Update(ctx, byID("user1"), map[string]interface{}{"email": "taken@example.com", "name": "Renamed"}); err != nil {
+		t.Errorf("Update keeping the email failed: %v", err)
+	}
+
+	// Emails are released by updates and deletes
+	if _, err := suite.Adapter.Update(ctx, byID("user2"), map[string]interface{}{"email": "moved@example.com"}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if _, err := suite.Adapter.Create(ctx, "users", map[string]interface{}{"id": "user3", "email": "other@example.com"}); err != nil {
+		t.Errorf("Create with a released email failed: %v", err)
+	}
+	if err := suite.Adapter.Delete(ctx, byID("user1")); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := suite.Adapter.Create(ctx, "users", map[string]interface{}{"id": "user4", "email": "taken@example.com"}); err != nil {
+		t.Errorf("Create with a deleted user's email failed: %v", err)
+	}
+}
+
 // TestOperators tests all query operators
 func (suite *TestSuite) TestOperators(t *testing.T) {
 	if suite.SetupFunc != nil {
@@ -669,6 +865,62 @@ func (suite *TestSuite) TestOrderBy(t *testing.T) {
 	}
 }
 
+// TestSelect tests field selection in FindOne and FindMany
+func (suite *TestSuite) TestSelect(t *testing.T) {
+	if suite.SetupFunc != nil {
+		suite.SetupFunc(t, suite.Adapter)
+	}
+	if suite.TeardownFunc != nil {
+		defer suite.TeardownFunc(t, suite.Adapter)
+	}
+
+	ctx := context.Background()
+
+	suite.Adapter.Create(ctx, "users", map[string]interface{}{
+		"id":    "user1",
+		"email": "user1@example.com",
+		"name":  "User 1",
+	})
+	suite.Adapter.Create(ctx, "users", map[string]interface{}{
+		"id":    "user2",
+		"email": "user2@example.com",
+		"name":  "User 2",
+	})
+
+	result, err := suite.Adapter.FindOne(ctx, &core.Query{
+		Model:  "users",
+		Select: []string{"id", "email"},
+		Where: []core.WhereClause{
+			{Field: "id", Operator: core.OpEqual, Value: "user1"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("FindOne failed: %v", err)
+	}
+	if result["email"] != "user1@example.com" {
+		t.Errorf("Expected email=user1@example.com, got %v", result["email"])
+	}
+	if _, ok := result["name"]; ok {
+		t.Errorf("Expected name to be excluded, got %v", result)
+	}
+
+	// Ordering by an unselected field still works
+	results, err := suite.Adapter.FindMany(ctx, &core.Query{
+		Model:   "users",
+		Select:  []string{"email"},
+		OrderBy: []core.OrderBy{{Field: "id", Desc: true}},
+	})
+	if err != nil {
+		t.Fatalf("FindMany failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	if results[0]["email"] != "user2@example.com" || len(results[0]) != 1 {
+		t.Errorf("Expected only email of user2 first, got %v", results[0])
+	}
+}
+
 // TestTransaction tests transaction functionality
 func (suite *TestSuite) TestTransaction(t *testing.T) {
 	if suite.SetupFunc != nil {
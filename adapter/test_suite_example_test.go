@@ -36,6 +36,10 @@ func TestMemoryAdapterIndividualTests(t *testing.T) {
 
 	suite := &adapter.TestSuite{
 		Adapter: memAdapter,
+		TeardownFunc: func(t *testing.T, a core.Adapter) {
+			// The tests reuse IDs, which the adapter keeps unique
+			a.Close()
+		},
 	}
 
 	// Run only specific tests
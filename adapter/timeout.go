@@ -0,0 +1,72 @@
+package adapter
+
+import (
+	"context"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// WithTimeouts returns inner with every call bounded by timeouts when the
+// caller's context has no deadline. Calls whose context already has a
+// deadline keep it.
+//
+// Unlike Wrap, the result keeps inner's single-query session lookup
+// (core.SessionUserFinder), bounded by the read timeout.
+func WithTimeouts(inner core.Adapter, timeouts core.QueryTimeouts) core.Adapter {
+	wrapped := Wrap(inner, timeoutHook(timeouts))
+	if finder, ok := inner.(core.SessionUserFinder); ok {
+		return &timeoutSessionAdapter{HookedAdapter: wrapped, finder: finder, timeout: timeouts.Read}
+	}
+	return wrapped
+}
+
+// timeoutHook is a QueryHook applying QueryTimeouts
+type timeoutHook core.QueryTimeouts
+
+type cancelKey struct{}
+
+// BeforeQuery adds the timeout for the operation to a context without a
+// deadline
+func (t timeoutHook) BeforeQuery(ctx context.Context, event *QueryEvent) (context.Context, error) {
+	timeout := t.Write
+	switch event.Operation {
+	case OperationFindOne, OperationFindMany, OperationCount:
+		timeout = t.Read
+	}
+
+	ctx, cancel := withTimeout(ctx, timeout)
+	return context.WithValue(ctx, cancelKey{}, cancel), nil
+}
+
+// AfterQuery releases the timeout's resources
+func (t timeoutHook) AfterQuery(ctx context.Context, event *QueryEvent) {
+	if cancel, ok := ctx.Value(cancelKey{}).(context.CancelFunc); ok {
+		cancel()
+	}
+}
+
+// withTimeout bounds ctx by timeout unless it already has a deadline or
+// timeout is zero
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// timeoutSessionAdapter is the result of WithTimeouts for adapters that
+// implement core.SessionUserFinder
+type timeoutSessionAdapter struct {
+	*HookedAdapter
+	finder  core.SessionUserFinder
+	timeout time.Duration
+}
+
+// FindSessionWithUser runs the wrapped adapter's session lookup within the
+// read timeout
+func (a *timeoutSessionAdapter) FindSessionWithUser(ctx context.Context, sessionModel, userModel, token string, now time.Time) (map[string]interface{}, map[string]interface{}, error) {
+	ctx, cancel := withTimeout(ctx, a.timeout)
+	defer cancel()
+	return a.finder.FindSessionWithUser(ctx, sessionModel, userModel, token, now)
+}
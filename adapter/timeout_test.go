@@ -0,0 +1,84 @@
+package adapter_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/adapter"
+	"github.com/marshallshelly/beacon-auth/adapters/memory"
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// slowAdapter blocks reads until the context ends and records the deadline
+// it was given
+type slowAdapter struct {
+	*memory.MemoryAdapter
+	deadline time.Time
+}
+
+func (s *slowAdapter) FindOne(ctx context.Context, query *core.Query) (map[string]interface{}, error) {
+	s.deadline, _ = ctx.Deadline()
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (s *slowAdapter) Create(ctx context.Context, model string, data map[string]interface{}) (map[string]interface{}, error) {
+	s.deadline, _ = ctx.Deadline()
+	return s.MemoryAdapter.Create(ctx, model, data)
+}
+
+func (s *slowAdapter) FindSessionWithUser(ctx context.Context, sessionModel, userModel, token string, now time.Time) (map[string]interface{}, map[string]interface{}, error) {
+	s.deadline, _ = ctx.Deadline()
+	return nil, nil, nil
+}
+
+func TestWithTimeouts(t *testing.T) {
+	slow := &slowAdapter{MemoryAdapter: memory.New()}
+	db := adapter.WithTimeouts(slow, core.QueryTimeouts{Read: 20 * time.Millisecond, Write: time.Hour})
+	ctx := context.Background()
+
+	start := time.Now()
+	if _, err := db.FindOne(ctx, core.NewQuery("users").Build()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("FindOne() error = %v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("FindOne() returned after %s", elapsed)
+	}
+
+	// Writes get the write timeout
+	if _, err := db.Create(ctx, "users", map[string]interface{}{"id": "u1"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if remaining := time.Until(slow.deadline); remaining < 50*time.Minute {
+		t.Errorf("Create() deadline in %s, want about an hour", remaining)
+	}
+
+	// A deadline set by the caller is kept
+	callerCtx, cancel := context.WithTimeout(ctx, 2*time.Hour)
+	defer cancel()
+	want, _ := callerCtx.Deadline()
+	if _, err := db.Create(callerCtx, "users", map[string]interface{}{"id": "u2"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if !slow.deadline.Equal(want) {
+		t.Errorf("Create() deadline = %s, want the caller's %s", slow.deadline, want)
+	}
+
+	// The single-query session lookup is kept and bounded
+	finder, ok := db.(core.SessionUserFinder)
+	if !ok {
+		t.Fatal("WithTimeouts() dropped core.SessionUserFinder")
+	}
+	if _, _, err := finder.FindSessionWithUser(ctx, "sessions", "users", "token", time.Now()); err != nil {
+		t.Fatalf("FindSessionWithUser() error = %v", err)
+	}
+	if slow.deadline.IsZero() || time.Until(slow.deadline) > time.Second {
+		t.Errorf("FindSessionWithUser() deadline = %s, want the read timeout", slow.deadline)
+	}
+
+	if _, ok := adapter.WithTimeouts(memory.New(), core.QueryTimeouts{Read: time.Second}).(core.SessionUserFinder); ok {
+		t.Error("WithTimeouts() added core.SessionUserFinder to an adapter without it")
+	}
+}
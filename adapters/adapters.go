@@ -0,0 +1,69 @@
+// Package adapters opens a database adapter from a connection URL, so the
+// database can be chosen by configuration such as DATABASE_URL:
+//
+//	adapter, err := adapters.Open(ctx, os.Getenv("DATABASE_URL"))
+//
+// Importing this package links every database driver. Import a single
+// adapter package and use its NewFromDSN to keep binaries small.
+package adapters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/marshallshelly/beacon-auth/adapters/memory"
+	"github.com/marshallshelly/beacon-auth/adapters/mongodb"
+	"github.com/marshallshelly/beacon-auth/adapters/mssql"
+	"github.com/marshallshelly/beacon-auth/adapters/mysql"
+	"github.com/marshallshelly/beacon-auth/adapters/postgres"
+	"github.com/marshallshelly/beacon-auth/adapters/redis"
+	"github.com/marshallshelly/beacon-auth/adapters/sqlite"
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// Open creates the adapter for the URL scheme of dsn:
+//
+//	postgres://, postgresql://     PostgreSQL
+//	cockroachdb://, cockroach://   CockroachDB (PostgreSQL adapter with retries)
+//	mysql://                       MySQL
+//	sqlserver://, mssql://         SQL Server
+//	sqlite://, sqlite3://, file:   SQLite (sqlite://:memory: for in-memory)
+//	mongodb://, mongodb+srv://     MongoDB (database from the URL path)
+//	redis://, rediss://            Redis (rediss:// for TLS)
+//	memory://                      in-memory adapter for tests
+//
+// See each adapter's NewFromDSN for the accepted parameters.
+func Open(ctx context.Context, dsn string) (core.Adapter, error) {
+	if dsn == "" {
+		return nil, errors.New("connection URL is empty")
+	}
+
+	scheme, _, ok := strings.Cut(dsn, ":")
+	if !ok {
+		return nil, errors.New("connection URL has no scheme")
+	}
+
+	scheme = strings.ToLower(scheme)
+	dsn = scheme + dsn[len(scheme):]
+
+	switch scheme {
+	case "postgres", "postgresql", "cockroachdb", "cockroach":
+		return postgres.NewFromDSN(ctx, dsn)
+	case "mysql":
+		return mysql.NewFromDSN(ctx, dsn)
+	case "sqlserver", "mssql":
+		return mssql.NewFromDSN(ctx, dsn)
+	case "sqlite", "sqlite3", "file":
+		return sqlite.NewFromDSN(ctx, dsn)
+	case "mongodb", "mongodb+srv":
+		return mongodb.NewFromDSN(ctx, dsn)
+	case "redis", "rediss":
+		return redis.NewFromDSN(ctx, dsn)
+	case "memory":
+		return memory.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported connection URL scheme: %q", scheme)
+	}
+}
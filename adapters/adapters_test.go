@@ -0,0 +1,37 @@
+package adapters
+
+import (
+	"context"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		dsn string
+		id  string
+	}{
+		{"memory://", "memory"},
+		{"sqlite://:memory:", "sqlite"},
+		{"SQLite://:memory:", "sqlite"},
+		{"file:" + t.TempDir() + "/auth.db?mode=rwc", "sqlite"},
+	}
+	for _, tt := range tests {
+		a, err := Open(ctx, tt.dsn)
+		if err != nil {
+			t.Errorf("Open(%q) error = %v", tt.dsn, err)
+			continue
+		}
+		if a.ID() != tt.id {
+			t.Errorf("Open(%q).ID() = %q, want %q", tt.dsn, a.ID(), tt.id)
+		}
+		_ = a.Close()
+	}
+
+	for _, dsn := range []string{"", "auth.db", "oracle://db/auth"} {
+		if _, err := Open(ctx, dsn); err == nil {
+			t.Errorf("Open(%q) expected error", dsn)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+// Package dberr translates database driver errors into the adapter errors
+// of package core (core.ErrDuplicate, core.ErrConstraint, core.ErrTxConflict
+// and core.ErrNotFound). Each adapter supplies a function that classifies
+// its driver's errors.
+package dberr
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// kinds are the errors a classify function may return
+var kinds = []error{core.ErrDuplicate, core.ErrConstraint, core.ErrTxConflict, core.ErrNotFound}
+
+// Translate wraps err with the core error classify returns for it. Both
+// stay in the chain, so errors.Is matches the core error and errors.As
+// still finds the driver error. Errors that are nil, already translated or
+// unclassified are returned unchanged.
+func Translate(err error, classify func(error) error) error {
+	if err == nil {
+		return nil
+	}
+	for _, kind := range kinds {
+		if errors.Is(err, kind) {
+			return err
+		}
+	}
+
+	kind := classify(err)
+	if kind == nil {
+		return err
+	}
+	return fmt.Errorf("%w: %w", kind, err)
+}
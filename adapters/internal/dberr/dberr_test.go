@@ -0,0 +1,45 @@
+package dberr
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+type driverError struct{ code int }
+
+func (e *driverError) Error() string { return fmt.Sprintf("driver error %d", e.code) }
+
+func classify(err error) error {
+	var de *driverError
+	if errors.As(err, &de) && de.code == 1 {
+		return core.ErrDuplicate
+	}
+	return nil
+}
+
+func TestTranslate(t *testing.T) {
+	err := Translate(fmt.Errorf("insert: %w", &driverError{code: 1}), classify)
+	if !errors.Is(err, core.ErrDuplicate) {
+		t.Errorf("Translate() = %v, want ErrDuplicate", err)
+	}
+	var de *driverError
+	if !errors.As(err, &de) {
+		t.Error("Translate() dropped the driver error")
+	}
+
+	// Translating twice does not wrap again
+	if again := Translate(err, classify); again != err {
+		t.Errorf("Translate() of a translated error = %v", again)
+	}
+
+	other := &driverError{code: 2}
+	if got := Translate(other, classify); got != other {
+		t.Errorf("Translate() of an unclassified error = %v", got)
+	}
+	if Translate(nil, classify) != nil {
+		t.Error("Translate(nil) != nil")
+	}
+}
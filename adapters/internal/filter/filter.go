@@ -0,0 +1,279 @@
+// Package filter evaluates queries against records held in Go maps, for
+// the adapters that filter and sort records themselves instead of in the
+// database.
+package filter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// Sort orders records by the query's order clauses
+func Sort(records []map[string]interface{}, orderBy []core.OrderBy) {
+	if len(orderBy) == 0 {
+		return
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		for _, order := range orderBy {
+			cmp := Compare(records[i][order.Field], records[j][order.Field])
+			if cmp == 0 {
+				continue
+			}
+			if order.Desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+}
+
+// Page applies a query's offset and limit (0 = no limit) to sorted records
+func Page(records []map[string]interface{}, offset, limit int) []map[string]interface{} {
+	if offset > 0 {
+		if offset >= len(records) {
+			return []map[string]interface{}{}
+		}
+		records = records[offset:]
+	}
+	if limit > 0 && limit < len(records) {
+		records = records[:limit]
+	}
+	return records
+}
+
+// Matches reports whether a record matches every where clause. A record
+// lacking a clause's field does not match.
+func Matches(record map[string]interface{}, where []core.WhereClause) bool {
+	if len(where) == 0 {
+		return true
+	}
+
+	for _, clause := range where {
+		value, exists := record[clause.Field]
+		if !exists {
+			return false
+		}
+
+		if !matchesClause(value, clause.Operator, clause.Value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchesClause checks if a value matches a where clause
+func matchesClause(value interface{}, op core.Operator, clauseValue interface{}) bool {
+	switch op {
+	case core.OpEqual:
+		return equal(value, clauseValue)
+
+	case core.OpNotEqual:
+		return !equal(value, clauseValue)
+
+	case core.OpGreaterThan:
+		return greaterThan(value, clauseValue)
+
+	case core.OpGreaterOrEqual:
+		return greaterThan(value, clauseValue) || equal(value, clauseValue)
+
+	case core.OpLessThan:
+		return lessThan(value, clauseValue)
+
+	case core.OpLessOrEqual:
+		return lessThan(value, clauseValue) || equal(value, clauseValue)
+
+	case core.OpLike:
+		str, ok := value.(string)
+		if !ok {
+			return false
+		}
+		pattern, ok := clauseValue.(string)
+		if !ok {
+			return false
+		}
+		// Simple LIKE implementation: % is wildcard
+		pattern = strings.ReplaceAll(pattern, "%", ".*")
+		return strings.Contains(str, strings.Trim(pattern, ".*"))
+
+	case core.OpIn:
+		list, ok := clauseValue.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, item := range list {
+			if equal(value, item) {
+				return true
+			}
+		}
+		return false
+
+	case core.OpNotIn:
+		list, ok := clauseValue.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, item := range list {
+			if equal(value, item) {
+				return false
+			}
+		}
+		return true
+
+	case core.OpIsNull:
+		return value == nil
+
+	case core.OpIsNotNull:
+		return value != nil
+
+	default:
+		return false
+	}
+}
+
+// Helper comparison functions
+
+func equal(a, b interface{}) bool {
+	// Handle time.Time comparison
+	if ta, ok := a.(time.Time); ok {
+		if tb, ok := b.(time.Time); ok {
+			return ta.Equal(tb)
+		}
+	}
+
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func greaterThan(a, b interface{}) bool {
+	// Handle time.Time comparison
+	if ta, ok := a.(time.Time); ok {
+		if tb, ok := b.(time.Time); ok {
+			return ta.After(tb)
+		}
+	}
+
+	// Handle numeric comparison
+	if na, ok := toFloat64(a); ok {
+		if nb, ok := toFloat64(b); ok {
+			return na > nb
+		}
+	}
+
+	// String comparison
+	return fmt.Sprint(a) > fmt.Sprint(b)
+}
+
+func lessThan(a, b interface{}) bool {
+	// Handle time.Time comparison
+	if ta, ok := a.(time.Time); ok {
+		if tb, ok := b.(time.Time); ok {
+			return ta.Before(tb)
+		}
+	}
+
+	// Handle numeric comparison
+	if na, ok := toFloat64(a); ok {
+		if nb, ok := toFloat64(b); ok {
+			return na < nb
+		}
+	}
+
+	// String comparison
+	return fmt.Sprint(a) < fmt.Sprint(b)
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
+
+// Copy returns a shallow copy of a record
+func Copy(m map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	for k, v := range m {
+		result[k] = v
+	}
+	return result
+}
+
+// Select copies the given fields of a record, or all of them when fields
+// is empty
+func Select(m map[string]interface{}, fields []string) map[string]interface{} {
+	if len(fields) == 0 {
+		return Copy(m)
+	}
+	result := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		if v, ok := m[f]; ok {
+			result[f] = v
+		}
+	}
+	return result
+}
+
+// Compare compares two field values for sorting: -1 if a < b, 0 if a == b,
+// 1 if a > b. nil sorts first.
+func Compare(a, b interface{}) int {
+	// Handle nil values
+	if a == nil && b == nil {
+		return 0
+	}
+	if a == nil {
+		return -1
+	}
+	if b == nil {
+		return 1
+	}
+
+	// Handle time.Time comparison
+	if ta, ok := a.(time.Time); ok {
+		if tb, ok := b.(time.Time); ok {
+			if ta.Before(tb) {
+				return -1
+			}
+			if ta.After(tb) {
+				return 1
+			}
+			return 0
+		}
+	}
+
+	// Handle numeric comparison
+	if na, ok := toFloat64(a); ok {
+		if nb, ok := toFloat64(b); ok {
+			if na < nb {
+				return -1
+			}
+			if na > nb {
+				return 1
+			}
+			return 0
+		}
+	}
+
+	// String comparison
+	sa := fmt.Sprint(a)
+	sb := fmt.Sprint(b)
+	if sa < sb {
+		return -1
+	}
+	if sa > sb {
+		return 1
+	}
+	return 0
+}
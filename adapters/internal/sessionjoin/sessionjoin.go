@@ -0,0 +1,62 @@
+// Package sessionjoin builds the single-query session and user lookup the
+// SQL adapters use to implement core.SessionUserFinder. The session and
+// user columns are selected side by side, separated by a marker column, so
+// columns present in both tables (id, created_at, ...) stay apart.
+package sessionjoin
+
+import (
+	"errors"
+	"fmt"
+)
+
+// marker separates the session columns from the user columns
+const marker = "beacon_user_columns"
+
+// Query returns the statement loading the unexpired session with a token
+// and its user. sessions and users are quoted table names; tokenParam and
+// nowParam are the dialect's placeholders for the token and current time.
+func Query(sessions, users, tokenParam, nowParam string) string {
+	return fmt.Sprintf(
+		"SELECT s.*, 1 AS %s, u.* FROM %s s LEFT JOIN %s u ON u.id = s.user_id WHERE s.token = %s AND s.expires_at > %s",
+		marker, sessions, users, tokenParam, nowParam,
+	)
+}
+
+// Split divides a row returned by Query into the session and user records.
+// user is nil when the session's user does not exist.
+func Split(columns []string, values []interface{}) (session, user map[string]interface{}, err error) {
+	if len(columns) != len(values) {
+		return nil, nil, errors.New("column and value counts differ")
+	}
+
+	split := -1
+	for i, col := range columns {
+		if col == marker {
+			split = i
+			break
+		}
+	}
+	if split < 0 {
+		return nil, nil, errors.New("session join marker column not found")
+	}
+
+	session = make(map[string]interface{}, split)
+	for i := 0; i < split; i++ {
+		session[columns[i]] = values[i]
+	}
+
+	// A LEFT JOIN without a user yields only NULL user columns
+	found := false
+	user = make(map[string]interface{}, len(columns)-split-1)
+	for i := split + 1; i < len(columns); i++ {
+		user[columns[i]] = values[i]
+		if values[i] != nil {
+			found = true
+		}
+	}
+	if !found {
+		user = nil
+	}
+
+	return session, user, nil
+}
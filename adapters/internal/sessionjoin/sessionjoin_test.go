@@ -0,0 +1,38 @@
+package sessionjoin
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	got := Query(`"sessions"`, `"users"`, "$1", "$2")
+	want := `SELECT s.*, 1 AS beacon_user_columns, u.* FROM "sessions" s LEFT JOIN "users" u ON u.id = s.user_id WHERE s.token = $1 AND s.expires_at > $2`
+	if got != want {
+		t.Errorf("Query() = %s", got)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	columns := []string{"id", "token", marker, "id", "email"}
+
+	session, user, err := Split(columns, []interface{}{"s1", "tok", 1, "u1", "a@example.com"})
+	if err != nil {
+		t.Fatalf("Split() error = %v", err)
+	}
+	if session["id"] != "s1" || session["token"] != "tok" || len(session) != 2 {
+		t.Errorf("session = %v", session)
+	}
+	if user["id"] != "u1" || user["email"] != "a@example.com" || len(user) != 2 {
+		t.Errorf("user = %v", user)
+	}
+
+	_, user, err = Split(columns, []interface{}{"s1", "tok", 1, nil, nil})
+	if err != nil || user != nil {
+		t.Errorf("Split() without user = %v, %v, want nil user", user, err)
+	}
+
+	if _, _, err := Split([]string{"id"}, []interface{}{"s1"}); err == nil || !strings.Contains(err.Error(), "marker") {
+		t.Errorf("Split() without marker error = %v", err)
+	}
+}
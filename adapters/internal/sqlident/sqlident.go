@@ -0,0 +1,102 @@
+// Package sqlident validates and quotes SQL identifiers for the SQL
+// adapters. Table and column names reach the adapters from queries and
+// data maps, and may be derived from plugin or metadata fields, so they are
+// never interpolated into SQL without passing through Quote.
+package sqlident
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// Dialect selects the quoting style and identifier length limit
+type Dialect int
+
+const (
+	Postgres Dialect = iota // "name", at most 63 bytes
+	MySQL                   // `name`, at most 64 bytes
+	SQLite                  // "name"
+	MSSQL                   // [name], at most 128 characters
+)
+
+// maxLength returns the longest identifier the dialect accepts (0 = no limit)
+func (d Dialect) maxLength() int {
+	switch d {
+	case Postgres:
+		return 63
+	case MySQL:
+		return 64
+	case MSSQL:
+		return 128
+	default:
+		return 0
+	}
+}
+
+// Valid reports whether name is a plain identifier: an ASCII letter or
+// underscore followed by letters, digits or underscores
+func Valid(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Validate returns an error wrapping core.ErrInvalidIdentifier when name is
+// not a valid identifier for the dialect
+func Validate(d Dialect, name string) error {
+	if !Valid(name) {
+		return fmt.Errorf("%w: %q", core.ErrInvalidIdentifier, name)
+	}
+	if max := d.maxLength(); max > 0 && len(name) > max {
+		return fmt.Errorf("%w: %q is longer than %d characters", core.ErrInvalidIdentifier, name, max)
+	}
+	return nil
+}
+
+// Quote validates name and returns it quoted for the dialect
+func Quote(d Dialect, name string) (string, error) {
+	if err := Validate(d, name); err != nil {
+		return "", err
+	}
+	switch d {
+	case MySQL:
+		return "`" + name + "`", nil
+	case MSSQL:
+		return "[" + name + "]", nil
+	default:
+		return `"` + name + `"`, nil
+	}
+}
+
+// QuoteAll quotes each name and joins them with ", "
+func QuoteAll(d Dialect, names []string) (string, error) {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		q, err := Quote(d, name)
+		if err != nil {
+			return "", err
+		}
+		quoted[i] = q
+	}
+	return strings.Join(quoted, ", "), nil
+}
+
+// SelectList returns the quoted column list of a SELECT, or "*" when no
+// fields are given
+func SelectList(d Dialect, fields []string) (string, error) {
+	if len(fields) == 0 {
+		return "*", nil
+	}
+	return QuoteAll(d, fields)
+}
@@ -0,0 +1,75 @@
+package sqlident
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		want    string
+	}{
+		{Postgres, `"email_verified"`},
+		{MySQL, "`email_verified`"},
+		{SQLite, `"email_verified"`},
+		{MSSQL, "[email_verified]"},
+	}
+	for _, tt := range tests {
+		got, err := Quote(tt.dialect, "email_verified")
+		if err != nil || got != tt.want {
+			t.Errorf("Quote(%d) = %q, %v; want %q", tt.dialect, got, err, tt.want)
+		}
+	}
+}
+
+func TestQuote_RejectsInvalid(t *testing.T) {
+	for _, name := range []string{
+		"",
+		"1users",
+		"users; DROP TABLE users",
+		"email = email OR 1=1 --",
+		`name"`,
+		"name`",
+		"name]",
+		"schema.table",
+		"naïve",
+	} {
+		if _, err := Quote(Postgres, name); !errors.Is(err, core.ErrInvalidIdentifier) {
+			t.Errorf("Quote(%q) error = %v, want ErrInvalidIdentifier", name, err)
+		}
+	}
+
+	long := strings.Repeat("a", 64)
+	if _, err := Quote(Postgres, long); err == nil {
+		t.Error("expected a 64 byte name to be rejected for Postgres")
+	}
+	if _, err := Quote(MySQL, long); err != nil {
+		t.Errorf("expected a 64 byte name to be accepted for MySQL: %v", err)
+	}
+}
+
+func TestQuoteAll(t *testing.T) {
+	got, err := QuoteAll(MySQL, []string{"id", "user_id"})
+	if err != nil || got != "`id`, `user_id`" {
+		t.Errorf("QuoteAll() = %q, %v", got, err)
+	}
+	if _, err := QuoteAll(MySQL, []string{"id", "bad name"}); err == nil {
+		t.Error("expected an invalid column to be rejected")
+	}
+}
+
+func TestSelectList(t *testing.T) {
+	if got, err := SelectList(Postgres, nil); err != nil || got != "*" {
+		t.Errorf("SelectList(nil) = %q, %v", got, err)
+	}
+	if got, err := SelectList(MSSQL, []string{"id", "token"}); err != nil || got != "[id], [token]" {
+		t.Errorf("SelectList() = %q, %v", got, err)
+	}
+	if _, err := SelectList(SQLite, []string{"*"}); err == nil {
+		t.Error("expected a wildcard field to be rejected")
+	}
+}
@@ -0,0 +1,77 @@
+// Package sqltx maps core.TxOptions onto database/sql and runs nested
+// transactions on savepoints for the database/sql adapters.
+package sqltx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/marshallshelly/beacon-auth/adapters/internal/sqlident"
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// Options converts opts to the options passed to sql.DB.BeginTx
+func Options(opts core.TxOptions) (*sql.TxOptions, error) {
+	var level sql.IsolationLevel
+	switch opts.Isolation {
+	case core.IsolationDefault:
+		level = sql.LevelDefault
+	case core.IsolationReadUncommitted:
+		level = sql.LevelReadUncommitted
+	case core.IsolationReadCommitted:
+		level = sql.LevelReadCommitted
+	case core.IsolationRepeatableRead:
+		level = sql.LevelRepeatableRead
+	case core.IsolationSerializable:
+		level = sql.LevelSerializable
+	default:
+		return nil, fmt.Errorf("%w: isolation level %s", core.ErrTxOptionsUnsupported, opts.Isolation)
+	}
+	return &sql.TxOptions{Isolation: level, ReadOnly: opts.ReadOnly}, nil
+}
+
+// Run runs fn in tx, committing when it succeeds and rolling back when it
+// fails
+func Run(tx *sql.Tx, fn func() error) error {
+	if err := fn(); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("transaction error: %w, rollback error: %v", err, rbErr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// Savepoint runs fn inside a savepoint of tx. When fn fails the work done
+// since the savepoint is rolled back and the enclosing transaction carries
+// on. depth is the nesting level, used to name the savepoint.
+func Savepoint(ctx context.Context, tx *sql.Tx, d sqlident.Dialect, depth int, fn func() error) error {
+	name := fmt.Sprintf("beacon_sp_%d", depth)
+
+	save, rollback, release := "SAVEPOINT "+name, "ROLLBACK TO SAVEPOINT "+name, "RELEASE SAVEPOINT "+name
+	if d == sqlident.MSSQL {
+		// SQL Server has no RELEASE; a saved point lives until the
+		// transaction ends
+		save, rollback, release = "SAVE TRANSACTION "+name, "ROLLBACK TRANSACTION "+name, ""
+	}
+
+	if _, err := tx.ExecContext(ctx, save); err != nil {
+		return fmt.Errorf("failed to create savepoint: %w", err)
+	}
+
+	err := fn()
+	if err != nil {
+		if _, rbErr := tx.ExecContext(ctx, rollback); rbErr != nil {
+			return fmt.Errorf("transaction error: %w, rollback error: %v", err, rbErr)
+		}
+	}
+
+	// Rolling back to a savepoint keeps it open, so release it either way
+	if release != "" {
+		if _, relErr := tx.ExecContext(ctx, release); relErr != nil && err == nil {
+			return fmt.Errorf("failed to release savepoint: %w", relErr)
+		}
+	}
+	return err
+}
@@ -0,0 +1,125 @@
+package stmtcache
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// remoteDriver models a network database whose driver prepares every
+// statement on the server, as go-sql-driver/mysql does without
+// interpolateParams: an unprepared query costs a prepare, an execute and a
+// close round trip, a prepared one only the execute.
+type remoteDriver struct {
+	roundTrip time.Duration
+	prepares  atomic.Int64
+}
+
+func (d *remoteDriver) Open(string) (driver.Conn, error) { return &remoteConn{d: d}, nil }
+
+type remoteConn struct{ d *remoteDriver }
+
+func (c *remoteConn) Prepare(query string) (driver.Stmt, error) {
+	c.d.prepares.Add(1)
+	time.Sleep(c.d.roundTrip)
+	return &remoteStmt{d: c.d}, nil
+}
+func (c *remoteConn) Close() error              { return nil }
+func (c *remoteConn) Begin() (driver.Tx, error) { return nil, driver.ErrSkip }
+
+type remoteStmt struct{ d *remoteDriver }
+
+func (s *remoteStmt) Close() error {
+	time.Sleep(s.d.roundTrip)
+	return nil
+}
+func (s *remoteStmt) NumInput() int { return -1 }
+func (s *remoteStmt) Exec([]driver.Value) (driver.Result, error) {
+	time.Sleep(s.d.roundTrip)
+	return driver.RowsAffected(1), nil
+}
+func (s *remoteStmt) Query([]driver.Value) (driver.Rows, error) {
+	time.Sleep(s.d.roundTrip)
+	return &remoteRows{}, nil
+}
+
+type remoteRows struct{ done bool }
+
+func (r *remoteRows) Columns() []string { return []string{"id"} }
+func (r *remoteRows) Close() error      { return nil }
+func (r *remoteRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = "s1"
+	return nil
+}
+
+const sessionQuery = `SELECT * FROM "sessions" WHERE "token" = ? AND "expires_at" > ? LIMIT 1`
+
+func findSession(b testing.TB, ctx context.Context, c *Cache) {
+	rows, err := c.QueryContext(ctx, sessionQuery, "token", time.Now())
+	if err != nil {
+		b.Fatalf("QueryContext() error = %v", err)
+	}
+	for rows.Next() {
+	}
+	_ = rows.Close()
+}
+
+func TestCache_PreparesOnce(t *testing.T) {
+	d := &remoteDriver{}
+	db := sql.OpenDB(driverConnector{d})
+	defer func() { _ = db.Close() }()
+
+	c := New(db, 0)
+	for i := 0; i < 10; i++ {
+		findSession(t, context.Background(), c)
+	}
+	if n := d.prepares.Load(); n != 1 {
+		t.Errorf("prepared %d times, want 1", n)
+	}
+
+	d.prepares.Store(0)
+	uncached := New(db, -1)
+	for i := 0; i < 10; i++ {
+		findSession(t, context.Background(), uncached)
+	}
+	if n := d.prepares.Load(); n != 10 {
+		t.Errorf("prepared %d times without cache, want 10", n)
+	}
+}
+
+// BenchmarkCache_FindOneSession measures a session lookup against a remote
+// database; the cached lookup saves two of three round trips
+func BenchmarkCache_FindOneSession(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		size int
+	}{
+		{"Cached", 0},
+		{"Uncached", -1},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			db := sql.OpenDB(driverConnector{&remoteDriver{roundTrip: 100 * time.Microsecond}})
+			defer func() { _ = db.Close() }()
+			c := New(db, bc.size)
+			ctx := context.Background()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				findSession(b, ctx, c)
+			}
+		})
+	}
+}
+
+type driverConnector struct{ d *remoteDriver }
+
+func (c driverConnector) Connect(context.Context) (driver.Conn, error) { return c.d.Open("") }
+func (c driverConnector) Driver() driver.Driver                        { return c.d }
@@ -0,0 +1,185 @@
+// Package stmtcache keeps prepared statements for the database/sql adapters.
+// The adapters generate the same SQL for every lookup of a given shape, so
+// preparing each statement once saves the database a parse and plan per
+// call. Statements are keyed by their SQL text and evicted least recently
+// used first.
+package stmtcache
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// DefaultSize is the number of statements kept when no size is configured
+const DefaultSize = 100
+
+// Cache prepares statements on a database and reuses them. It implements
+// the ExecContext/QueryContext/QueryRowContext methods of *sql.DB, so an
+// adapter can use it wherever it would use the database directly.
+type Cache struct {
+	db   *sql.DB
+	size int
+
+	mu      sync.Mutex
+	lru     *list.List // of *entry, most recently used first
+	entries map[string]*list.Element
+	closed  bool
+}
+
+// entry is a cached statement. refs counts callers between acquire and
+// release; an evicted statement is closed once no caller holds it.
+type entry struct {
+	query   string
+	stmt    *sql.Stmt
+	refs    int
+	evicted bool
+}
+
+// New creates a cache of up to size statements on db. A size of 0 uses
+// DefaultSize; a negative size disables caching, so every call goes to db
+// directly.
+func New(db *sql.DB, size int) *Cache {
+	if size == 0 {
+		size = DefaultSize
+	}
+	return &Cache{
+		db:      db,
+		size:    size,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// ExecContext executes a statement
+func (c *Cache) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	e, err := c.acquire(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		return c.db.ExecContext(ctx, query, args...)
+	}
+	defer c.release(e)
+	return e.stmt.ExecContext(ctx, args...)
+}
+
+// QueryContext executes a query that returns rows. The statement stays open
+// until the rows are closed, even if it is evicted meanwhile.
+func (c *Cache) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	e, err := c.acquire(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		return c.db.QueryContext(ctx, query, args...)
+	}
+	defer c.release(e)
+	return e.stmt.QueryContext(ctx, args...)
+}
+
+// QueryRowContext executes a query that returns at most one row
+func (c *Cache) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	e, err := c.acquire(ctx, query)
+	if err != nil || e == nil {
+		// Let database/sql report the error through the returned row
+		return c.db.QueryRowContext(ctx, query, args...)
+	}
+	defer c.release(e)
+	return e.stmt.QueryRowContext(ctx, args...)
+}
+
+// Len returns the number of cached statements
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Reset closes all cached statements, e.g. after the schema changed.
+// Statements in use are closed when their callers finish.
+func (c *Cache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.lru.Len() > 0 {
+		c.evict(c.lru.Back())
+	}
+}
+
+// Close resets the cache and stops caching; later calls go to the database
+// directly. It does not close the database.
+func (c *Cache) Close() {
+	c.Reset()
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+}
+
+// acquire returns the statement for query, preparing it on a miss. It
+// returns nil when caching is disabled.
+func (c *Cache) acquire(ctx context.Context, query string) (*entry, error) {
+	c.mu.Lock()
+	if c.size < 0 || c.closed {
+		c.mu.Unlock()
+		return nil, nil
+	}
+	if el, ok := c.entries[query]; ok {
+		c.lru.MoveToFront(el)
+		e := el.Value.(*entry)
+		e.refs++
+		c.mu.Unlock()
+		return e, nil
+	}
+	c.mu.Unlock()
+
+	// Prepare outside the lock so a slow round trip does not block hits
+	stmt, err := c.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[query]; ok {
+		// Another caller prepared the same statement meanwhile
+		_ = stmt.Close()
+		c.lru.MoveToFront(el)
+		e := el.Value.(*entry)
+		e.refs++
+		return e, nil
+	}
+
+	e := &entry{query: query, stmt: stmt, refs: 1}
+	if c.closed {
+		// Closed while preparing: use the statement once, then close it
+		e.evicted = true
+		return e, nil
+	}
+	c.entries[query] = c.lru.PushFront(e)
+	for c.lru.Len() > c.size {
+		c.evict(c.lru.Back())
+	}
+	return e, nil
+}
+
+// release returns a statement obtained from acquire
+func (c *Cache) release(e *entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.refs--
+	if e.evicted && e.refs == 0 {
+		_ = e.stmt.Close()
+	}
+}
+
+// evict removes an element from the cache, closing its statement unless it
+// is in use. The caller must hold mu.
+func (c *Cache) evict(el *list.Element) {
+	e := c.lru.Remove(el).(*entry)
+	delete(c.entries, e.query)
+	e.evicted = true
+	if e.refs == 0 {
+		_ = e.stmt.Close()
+	}
+}
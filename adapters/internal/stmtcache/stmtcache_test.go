@@ -0,0 +1,132 @@
+package stmtcache
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	if _, err := db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatalf("create table error = %v", err)
+	}
+	return db
+}
+
+func TestCache_ReusesStatements(t *testing.T) {
+	ctx := context.Background()
+	c := New(openDB(t), 2)
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.ExecContext(ctx, "INSERT INTO items (name) VALUES (?)", fmt.Sprint(i)); err != nil {
+			t.Fatalf("ExecContext() error = %v", err)
+		}
+	}
+	if c.Len() != 1 {
+		t.Errorf("Len() = %d, want 1 statement for identical SQL", c.Len())
+	}
+
+	var n int
+	if err := c.QueryRowContext(ctx, "SELECT COUNT(*) FROM items").Scan(&n); err != nil || n != 3 {
+		t.Errorf("QueryRowContext() = %d, %v, want 3", n, err)
+	}
+
+	rows, err := c.QueryContext(ctx, "SELECT name FROM items WHERE id > ?", 1)
+	if err != nil {
+		t.Fatalf("QueryContext() error = %v", err)
+	}
+	// Evicting the statement while its rows are open must not break them
+	for _, query := range []string{"SELECT 1", "SELECT 2"} {
+		if err := c.QueryRowContext(ctx, query).Scan(new(int)); err != nil {
+			t.Fatalf("QueryRowContext() error = %v", err)
+		}
+	}
+	count := 0
+	for rows.Next() {
+		count++
+	}
+	if err := rows.Err(); err != nil || count != 2 {
+		t.Errorf("rows = %d, %v, want 2", count, err)
+	}
+	_ = rows.Close()
+
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d, want the size limit of 2", c.Len())
+	}
+}
+
+func TestCache_PrepareError(t *testing.T) {
+	c := New(openDB(t), 0)
+
+	if _, err := c.ExecContext(context.Background(), "INSERT INTO missing VALUES (1)"); err == nil {
+		t.Error("expected an error for an invalid statement")
+	}
+	if err := c.QueryRowContext(context.Background(), "SELECT * FROM missing").Scan(new(int)); err == nil {
+		t.Error("expected QueryRowContext to report the error through the row")
+	}
+}
+
+func TestCache_DisabledAndClosed(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+
+	disabled := New(db, -1)
+	if _, err := disabled.ExecContext(ctx, "INSERT INTO items (name) VALUES ('a')"); err != nil {
+		t.Fatalf("ExecContext() error = %v", err)
+	}
+	if disabled.Len() != 0 {
+		t.Errorf("Len() = %d, want 0 when disabled", disabled.Len())
+	}
+
+	c := New(db, 0)
+	if _, err := c.ExecContext(ctx, "INSERT INTO items (name) VALUES ('b')"); err != nil {
+		t.Fatalf("ExecContext() error = %v", err)
+	}
+	c.Close()
+	if c.Len() != 0 {
+		t.Errorf("Len() = %d after Close, want 0", c.Len())
+	}
+	if _, err := c.ExecContext(ctx, "INSERT INTO items (name) VALUES ('c')"); err != nil {
+		t.Errorf("ExecContext() after Close error = %v", err)
+	}
+	if c.Len() != 0 {
+		t.Errorf("Len() = %d, want nothing cached after Close", c.Len())
+	}
+}
+
+func TestCache_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	c := New(openDB(t), 3)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				query := fmt.Sprintf("SELECT COUNT(*) FROM items WHERE id > %d", (g+i)%5)
+				var n int
+				if err := c.QueryRowContext(ctx, query).Scan(&n); err != nil {
+					t.Errorf("QueryRowContext() error = %v", err)
+					return
+				}
+				if i%10 == 0 {
+					c.Reset()
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
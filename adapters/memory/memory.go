@@ -2,28 +2,39 @@ package memory
 
 import (
 	"context"
-	"fmt"
-	"sort"
-	"strings"
+	"maps"
 	"sync"
-	"time"
 
+	"github.com/marshallshelly/beacon-auth/adapters/internal/filter"
 	"github.com/marshallshelly/beacon-auth/core"
 )
 
-// MemoryAdapter is an in-memory adapter for testing
+// MemoryAdapter is an in-memory adapter for testing. Like the SQL
+// adapters, it rejects writes that break a unique constraint (see
+// DefaultUniques and WithUnique).
 type MemoryAdapter struct {
 	mu     sync.RWMutex
 	data   map[string][]map[string]interface{} // model -> records
 	nextID int
+
+	uniques    map[string][][]string // model -> constraints added by options
+	noDefaults bool
+	tenancy    bool                // use TenantUniques instead of DefaultUniques
+	indexes    map[string][]*index // model -> constraint indexes
 }
 
 // New creates a new memory adapter
-func New() *MemoryAdapter {
-	return &MemoryAdapter{
-		data:   make(map[string][]map[string]interface{}),
-		nextID: 1,
+func New(opts ...Option) *MemoryAdapter {
+	m := &MemoryAdapter{
+		data:    make(map[string][]map[string]interface{}),
+		nextID:  1,
+		uniques: make(map[string][][]string),
+		indexes: make(map[string][]*index),
+	}
+	for _, opt := range opts {
+		opt(m)
 	}
+	return m
 }
 
 // ID returns the adapter identifier
@@ -31,13 +42,28 @@ func (m *MemoryAdapter) ID() string {
 	return "memory"
 }
 
+// Capabilities reports the optional features supported by the adapter
+func (m *MemoryAdapter) Capabilities() core.Capabilities {
+	// Transaction runs the callback directly without rollback
+	return core.Capabilities{
+		ReturningSupported:    true,
+		JoinSupported:         false,
+		JSONSupported:         true,
+		TransactionsSupported: false,
+		CaseInsensitiveLike:   false,
+	}
+}
+
 // Create creates a new record
 func (m *MemoryAdapter) Create(ctx context.Context, model string, data map[string]interface{}) (map[string]interface{}, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	// Copy data to avoid mutations
-	record := copyMap(data)
+	record := filter.Copy(data)
+	if err := m.replace(model, nil, []map[string]interface{}{record}); err != nil {
+		return nil, err
+	}
 
 	// Ensure model exists
 	if m.data[model] == nil {
@@ -46,7 +72,7 @@ func (m *MemoryAdapter) Create(ctx context.Context, model string, data map[strin
 
 	m.data[model] = append(m.data[model], record)
 
-	return copyMap(record), nil
+	return filter.Copy(record), nil
 }
 
 // FindOne finds a single record matching the query
@@ -54,14 +80,9 @@ func (m *MemoryAdapter) FindOne(ctx context.Context, query *core.Query) (map[str
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	records, ok := m.data[query.Model]
-	if !ok {
-		return nil, nil
-	}
-
-	for _, record := range records {
-		if m.matchesWhere(record, query.Where) {
-			return copyMap(record), nil
+	for _, record := range m.candidates(query.Model, query.Where) {
+		if filter.Matches(record, query.Where) {
+			return filter.Select(record, query.Select), nil
 		}
 	}
 
@@ -73,52 +94,26 @@ func (m *MemoryAdapter) FindMany(ctx context.Context, query *core.Query) ([]map[
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	records, ok := m.data[query.Model]
-	if !ok {
+	if _, ok := m.data[query.Model]; !ok {
 		return []map[string]interface{}{}, nil
 	}
 
 	var results []map[string]interface{}
-	for _, record := range records {
-		if m.matchesWhere(record, query.Where) {
-			results = append(results, copyMap(record))
+	for _, record := range m.candidates(query.Model, query.Where) {
+		if filter.Matches(record, query.Where) {
+			results = append(results, filter.Copy(record))
 		}
 	}
 
-	// Apply ordering
-	if len(query.OrderBy) > 0 {
-		sort.Slice(results, func(i, j int) bool {
-			for _, order := range query.OrderBy {
-				valI := results[i][order.Field]
-				valJ := results[j][order.Field]
-
-				cmp := compareValues(valI, valJ)
-				if cmp == 0 {
-					continue
-				}
-
-				if order.Desc {
-					return cmp > 0
-				}
-				return cmp < 0
-			}
-			return false
-		})
-	}
+	filter.Sort(results, query.OrderBy)
+	results = filter.Page(results, query.Offset, query.Limit)
 
-	// Apply limit and offset
-	if query.Offset > 0 {
-		if query.Offset >= len(results) {
-			results = []map[string]interface{}{}
-		} else {
-			results = results[query.Offset:]
+	if len(query.Select) > 0 {
+		for i, result := range results {
+			results[i] = filter.Select(result, query.Select)
 		}
 	}
 
-	if query.Limit > 0 && query.Limit < len(results) {
-		results = results[:query.Limit]
-	}
-
 	return results, nil
 }
 
@@ -133,13 +128,15 @@ func (m *MemoryAdapter) Update(ctx context.Context, query *core.Query, data map[
 	}
 
 	for i, record := range records {
-		if m.matchesWhere(record, query.Where) {
-			// Update fields
-			for k, v := range data {
-				record[k] = v
+		if filter.Matches(record, query.Where) {
+			// Update a copy, so a conflict leaves the record unchanged
+			updated := filter.Copy(record)
+			maps.Copy(updated, data)
+			if err := m.replace(query.Model, records[i:i+1], []map[string]interface{}{updated}); err != nil {
+				return nil, err
 			}
-			m.data[query.Model][i] = record
-			return copyMap(record), nil
+			m.data[query.Model][i] = updated
+			return filter.Copy(updated), nil
 		}
 	}
 
@@ -156,18 +153,27 @@ func (m *MemoryAdapter) UpdateMany(ctx context.Context, query *core.Query, data
 		return 0, nil
 	}
 
-	var count int64
+	var positions []int
+	var old, updated []map[string]interface{}
 	for i, record := range records {
-		if m.matchesWhere(record, query.Where) {
-			for k, v := range data {
-				record[k] = v
-			}
-			m.data[query.Model][i] = record
-			count++
+		if filter.Matches(record, query.Where) {
+			record := filter.Copy(record)
+			maps.Copy(record, data)
+			positions = append(positions, i)
+			old = append(old, records[i])
+			updated = append(updated, record)
 		}
 	}
 
-	return count, nil
+	// The records are updated together or not at all
+	if err := m.replace(query.Model, old, updated); err != nil {
+		return 0, err
+	}
+	for j, i := range positions {
+		records[i] = updated[j]
+	}
+
+	return int64(len(updated)), nil
 }
 
 // Delete deletes a single record matching the query
@@ -181,7 +187,8 @@ func (m *MemoryAdapter) Delete(ctx context.Context, query *core.Query) error {
 	}
 
 	for i, record := range records {
-		if m.matchesWhere(record, query.Where) {
+		if filter.Matches(record, query.Where) {
+			_ = m.replace(query.Model, records[i:i+1], nil)
 			// Remove by creating new slice without this element
 			m.data[query.Model] = append(records[:i], records[i+1:]...)
 			return nil
@@ -201,19 +208,19 @@ func (m *MemoryAdapter) DeleteMany(ctx context.Context, query *core.Query) (int6
 		return 0, nil
 	}
 
-	var newRecords []map[string]interface{}
-	var count int64
+	var newRecords, deleted []map[string]interface{}
 
 	for _, record := range records {
-		if !m.matchesWhere(record, query.Where) {
+		if !filter.Matches(record, query.Where) {
 			newRecords = append(newRecords, record)
 		} else {
-			count++
+			deleted = append(deleted, record)
 		}
 	}
 
+	_ = m.replace(query.Model, deleted, nil)
 	m.data[query.Model] = newRecords
-	return count, nil
+	return int64(len(deleted)), nil
 }
 
 // Count counts records matching the query
@@ -221,14 +228,9 @@ func (m *MemoryAdapter) Count(ctx context.Context, query *core.Query) (int64, er
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	records, ok := m.data[query.Model]
-	if !ok {
-		return 0, nil
-	}
-
 	var count int64
-	for _, record := range records {
-		if m.matchesWhere(record, query.Where) {
+	for _, record := range m.candidates(query.Model, query.Where) {
+		if filter.Matches(record, query.Where) {
 			count++
 		}
 	}
@@ -236,238 +238,80 @@ func (m *MemoryAdapter) Count(ctx context.Context, query *core.Query) (int64, er
 	return count, nil
 }
 
-// Transaction executes a function in a transaction (no-op for memory adapter)
-func (m *MemoryAdapter) Transaction(ctx context.Context, fn func(core.Adapter) error) error {
-	// For memory adapter, just execute the function
-	// Real databases would handle rollback on error
-	return fn(m)
-}
-
-// Ping checks the connection (always succeeds for memory adapter)
-func (m *MemoryAdapter) Ping(ctx context.Context) error {
-	return nil
-}
+// CreateMany creates several records at once
+func (m *MemoryAdapter) CreateMany(ctx context.Context, model string, data []map[string]interface{}) (int64, error) {
+	if _, err := core.BatchColumns(data); err != nil {
+		return 0, err
+	}
 
-// Close closes the adapter (no-op for memory adapter)
-func (m *MemoryAdapter) Close() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.data = make(map[string][]map[string]interface{})
-	return nil
-}
-
-// matchesWhere checks if a record matches the where clauses
-func (m *MemoryAdapter) matchesWhere(record map[string]interface{}, where []core.WhereClause) bool {
-	if len(where) == 0 {
-		return true
+	records := make([]map[string]interface{}, len(data))
+	for i, record := range data {
+		records[i] = filter.Copy(record)
 	}
 
-	for _, clause := range where {
-		value, exists := record[clause.Field]
-		if !exists {
-			return false
-		}
-
-		if !m.matchesClause(value, clause.Operator, clause.Value) {
-			return false
-		}
+	// The batch is stored whole or not at all
+	if err := m.replace(model, nil, records); err != nil {
+		return 0, err
 	}
-
-	return true
+	m.data[model] = append(m.data[model], records...)
+	return int64(len(records)), nil
 }
 
-// matchesClause checks if a value matches a where clause
-func (m *MemoryAdapter) matchesClause(value interface{}, op core.Operator, clauseValue interface{}) bool {
-	switch op {
-	case core.OpEqual:
-		return equal(value, clauseValue)
-
-	case core.OpNotEqual:
-		return !equal(value, clauseValue)
-
-	case core.OpGreaterThan:
-		return greaterThan(value, clauseValue)
-
-	case core.OpGreaterOrEqual:
-		return greaterThan(value, clauseValue) || equal(value, clauseValue)
-
-	case core.OpLessThan:
-		return lessThan(value, clauseValue)
+// Upsert updates the record matching the conflict fields of data, or
+// creates it when none exists
+func (m *MemoryAdapter) Upsert(ctx context.Context, model string, conflictFields []string, data map[string]interface{}) (map[string]interface{}, error) {
+	_, updates, err := core.UpsertColumns(conflictFields, data)
+	if err != nil {
+		return nil, err
+	}
 
-	case core.OpLessOrEqual:
-		return lessThan(value, clauseValue) || equal(value, clauseValue)
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	case core.OpLike:
-		str, ok := value.(string)
-		if !ok {
-			return false
-		}
-		pattern, ok := clauseValue.(string)
-		if !ok {
-			return false
-		}
-		// Simple LIKE implementation: % is wildcard
-		pattern = strings.ReplaceAll(pattern, "%", ".*")
-		return strings.Contains(str, strings.Trim(pattern, ".*"))
-
-	case core.OpIn:
-		list, ok := clauseValue.([]interface{})
-		if !ok {
-			return false
-		}
-		for _, item := range list {
-			if equal(value, item) {
-				return true
+	where := core.ConflictQuery(model, conflictFields, data).Where
+	for i, record := range m.data[model] {
+		if filter.Matches(record, where) {
+			updated := filter.Copy(record)
+			for _, k := range updates {
+				updated[k] = data[k]
 			}
-		}
-		return false
-
-	case core.OpNotIn:
-		list, ok := clauseValue.([]interface{})
-		if !ok {
-			return false
-		}
-		for _, item := range list {
-			if equal(value, item) {
-				return false
+			if err := m.replace(model, m.data[model][i:i+1], []map[string]interface{}{updated}); err != nil {
+				return nil, err
 			}
-		}
-		return true
-
-	case core.OpIsNull:
-		return value == nil
-
-	case core.OpIsNotNull:
-		return value != nil
-
-	default:
-		return false
-	}
-}
-
-// Helper comparison functions
-
-func equal(a, b interface{}) bool {
-	// Handle time.Time comparison
-	if ta, ok := a.(time.Time); ok {
-		if tb, ok := b.(time.Time); ok {
-			return ta.Equal(tb)
+			m.data[model][i] = updated
+			return filter.Copy(updated), nil
 		}
 	}
 
-	return fmt.Sprint(a) == fmt.Sprint(b)
-}
-
-func greaterThan(a, b interface{}) bool {
-	// Handle time.Time comparison
-	if ta, ok := a.(time.Time); ok {
-		if tb, ok := b.(time.Time); ok {
-			return ta.After(tb)
-		}
-	}
-
-	// Handle numeric comparison
-	if na, ok := toFloat64(a); ok {
-		if nb, ok := toFloat64(b); ok {
-			return na > nb
-		}
-	}
-
-	// String comparison
-	return fmt.Sprint(a) > fmt.Sprint(b)
-}
-
-func lessThan(a, b interface{}) bool {
-	// Handle time.Time comparison
-	if ta, ok := a.(time.Time); ok {
-		if tb, ok := b.(time.Time); ok {
-			return ta.Before(tb)
-		}
-	}
-
-	// Handle numeric comparison
-	if na, ok := toFloat64(a); ok {
-		if nb, ok := toFloat64(b); ok {
-			return na < nb
-		}
+	record := filter.Copy(data)
+	if err := m.replace(model, nil, []map[string]interface{}{record}); err != nil {
+		return nil, err
 	}
-
-	// String comparison
-	return fmt.Sprint(a) < fmt.Sprint(b)
+	m.data[model] = append(m.data[model], record)
+	return filter.Copy(record), nil
 }
 
-func toFloat64(v interface{}) (float64, bool) {
-	switch n := v.(type) {
-	case int:
-		return float64(n), true
-	case int64:
-		return float64(n), true
-	case float64:
-		return n, true
-	case float32:
-		return float64(n), true
-	default:
-		return 0, false
-	}
+// Transaction executes a function in a transaction (no-op for memory adapter)
+func (m *MemoryAdapter) Transaction(ctx context.Context, fn func(core.Adapter) error) error {
+	// For memory adapter, just execute the function
+	// Real databases would handle rollback on error
+	return fn(m)
 }
 
-func copyMap(m map[string]interface{}) map[string]interface{} {
-	result := make(map[string]interface{})
-	for k, v := range m {
-		result[k] = v
-	}
-	return result
+// Ping checks the connection (always succeeds for memory adapter)
+func (m *MemoryAdapter) Ping(ctx context.Context) error {
+	return nil
 }
 
-// compareValues compares two values for sorting
-// Returns: -1 if a < b, 0 if a == b, 1 if a > b
-func compareValues(a, b interface{}) int {
-	// Handle nil values
-	if a == nil && b == nil {
-		return 0
-	}
-	if a == nil {
-		return -1
-	}
-	if b == nil {
-		return 1
-	}
-
-	// Handle time.Time comparison
-	if ta, ok := a.(time.Time); ok {
-		if tb, ok := b.(time.Time); ok {
-			if ta.Before(tb) {
-				return -1
-			}
-			if ta.After(tb) {
-				return 1
-			}
-			return 0
-		}
-	}
-
-	// Handle numeric comparison
-	if na, ok := toFloat64(a); ok {
-		if nb, ok := toFloat64(b); ok {
-			if na < nb {
-				return -1
-			}
-			if na > nb {
-				return 1
-			}
-			return 0
-		}
-	}
+// Close closes the adapter (no-op for memory adapter)
+func (m *MemoryAdapter) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	// String comparison
-	sa := fmt.Sprint(a)
-	sb := fmt.Sprint(b)
-	if sa < sb {
-		return -1
-	}
-	if sa > sb {
-		return 1
-	}
-	return 0
+	m.data = make(map[string][]map[string]interface{})
+	m.indexes = make(map[string][]*index)
+	return nil
 }
@@ -2,6 +2,8 @@ package memory
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -137,6 +139,43 @@ func TestMemoryAdapter_Update(t *testing.T) {
 	}
 }
 
+func TestMemoryAdapter_Upsert(t *testing.T) {
+	adapter := New()
+	ctx := context.Background()
+
+	result, err := adapter.Upsert(ctx, "users", []string{"email"}, map[string]interface{}{
+		"id":    "user1",
+		"email": "test@example.com",
+		"name":  "Old Name",
+	})
+	if err != nil {
+		t.Fatalf("Upsert failed: %v", err)
+	}
+	if result["name"] != "Old Name" {
+		t.Errorf("Expected name=Old Name, got %v", result["name"])
+	}
+
+	result, err = adapter.Upsert(ctx, "users", []string{"email"}, map[string]interface{}{
+		"email": "test@example.com",
+		"name":  "New Name",
+	})
+	if err != nil {
+		t.Fatalf("Upsert failed: %v", err)
+	}
+	if result["id"] != "user1" || result["name"] != "New Name" {
+		t.Errorf("Expected updated user1, got %v", result)
+	}
+
+	count, _ := adapter.Count(ctx, &core.Query{Model: "users"})
+	if count != 1 {
+		t.Errorf("Expected 1 record, got %d", count)
+	}
+
+	if _, err := adapter.Upsert(ctx, "users", nil, map[string]interface{}{"id": "user2"}); err == nil {
+		t.Error("Expected error without conflict fields")
+	}
+}
+
 func TestMemoryAdapter_Delete(t *testing.T) {
 	adapter := New()
 	ctx := context.Background()
@@ -318,3 +357,145 @@ func TestMemoryAdapter_LimitOffset(t *testing.T) {
 		t.Errorf("Expected 2 results with limit=2 offset=5, got %d", len(results))
 	}
 }
+
+func TestMemoryAdapter_UniqueConstraints(t *testing.T) {
+	adapter := New()
+	ctx := context.Background()
+	byID := func(id string) *core.Query {
+		return core.NewQuery("users").Where("id", core.OpEqual, id).Build()
+	}
+
+	adapter.Create(ctx, "users", map[string]interface{}{"id": "u1", "email": "a@example.com"})
+	adapter.Create(ctx, "users", map[string]interface{}{"id": "u2", "email": "b@example.com"})
+
+	if _, err := adapter.Create(ctx, "users", map[string]interface{}{"id": "u3", "email": "a@example.com"}); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("Create() duplicate email error = %v, want ErrUniqueViolation", err)
+	}
+	if _, err := adapter.Create(ctx, "users", map[string]interface{}{"id": "u1", "email": "c@example.com"}); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("Create() duplicate id error = %v, want ErrUniqueViolation", err)
+	}
+
+	// Like SQL NULLs, missing values never conflict
+	for _, id := range []string{"n1", "n2"} {
+		if _, err := adapter.Create(ctx, "users", map[string]interface{}{"id": id, "email": nil}); err != nil {
+			t.Errorf("Create() without email error = %v", err)
+		}
+	}
+
+	// A failed update leaves the record unchanged
+	if _, err := adapter.Update(ctx, byID("u2"), map[string]interface{}{"email": "a@example.com", "name": "B"}); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("Update() error = %v, want ErrUniqueViolation", err)
+	}
+	if user, _ := adapter.FindOne(ctx, byID("u2")); user["email"] != "b@example.com" || user["name"] != nil {
+		t.Errorf("FindOne() after failed update = %v", user)
+	}
+
+	// So does an update that would give several records the same value
+	all := core.NewQuery("users").Where("email", core.OpIsNotNull, nil).Build()
+	if _, err := adapter.UpdateMany(ctx, all, map[string]interface{}{"email": "same@example.com"}); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("UpdateMany() error = %v, want ErrUniqueViolation", err)
+	}
+
+	// A batch with a conflict stores nothing
+	_, err := adapter.CreateMany(ctx, "users", []map[string]interface{}{
+		{"id": "u4", "email": "d@example.com"},
+		{"id": "u5", "email": "d@example.com"},
+	})
+	if !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("CreateMany() error = %v, want ErrUniqueViolation", err)
+	}
+	if count, _ := adapter.Count(ctx, core.NewQuery("users").Build()); count != 4 {
+		t.Errorf("Count() = %d, want 4", count)
+	}
+
+	// Deleting a record frees its values
+	adapter.Delete(ctx, byID("u1"))
+	if _, err := adapter.Update(ctx, byID("u2"), map[string]interface{}{"email": "a@example.com"}); err != nil {
+		t.Errorf("Update() after delete error = %v", err)
+	}
+	user, err := adapter.FindOne(ctx, core.NewQuery("users").Where("email", core.OpEqual, "a@example.com").Build())
+	if err != nil || user == nil || user["id"] != "u2" {
+		t.Errorf("FindOne() by email = %v, %v, want u2", user, err)
+	}
+}
+
+func TestMemoryAdapter_CompositeUnique(t *testing.T) {
+	adapter := New()
+	ctx := context.Background()
+
+	adapter.Create(ctx, "accounts", map[string]interface{}{"id": "a1", "provider_id": "github", "account_id": "1"})
+	if _, err := adapter.Create(ctx, "accounts", map[string]interface{}{"id": "a2", "provider_id": "google", "account_id": "1"}); err != nil {
+		t.Errorf("Create() other provider error = %v", err)
+	}
+	if _, err := adapter.Create(ctx, "accounts", map[string]interface{}{"id": "a3", "provider_id": "github", "account_id": "1"}); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("Create() error = %v, want ErrUniqueViolation", err)
+	}
+
+	// Upsert on the constraint updates the existing record
+	updated, err := adapter.Upsert(ctx, "accounts", []string{"provider_id", "account_id"}, map[string]interface{}{
+		"provider_id": "github", "account_id": "1", "scope": "repo",
+	})
+	if err != nil || updated["id"] != "a1" || updated["scope"] != "repo" {
+		t.Errorf("Upsert() = %v, %v, want a1 with scope repo", updated, err)
+	}
+}
+
+func TestMemoryAdapter_UniqueOptions(t *testing.T) {
+	ctx := context.Background()
+
+	adapter := New(WithoutDefaultUniques(), WithUnique("consents", "user_id", "app_id"))
+	for _, id := range []string{"u1", "u2"} {
+		if _, err := adapter.Create(ctx, "users", map[string]interface{}{"id": id, "email": "a@example.com"}); err != nil {
+			t.Errorf("Create() without default constraints error = %v", err)
+		}
+	}
+
+	adapter.Create(ctx, "consents", map[string]interface{}{"id": "c1", "user_id": "u1", "app_id": "app"})
+	if _, err := adapter.Create(ctx, "consents", map[string]interface{}{"id": "c2", "user_id": "u1", "app_id": "app"}); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("Create() error = %v, want ErrUniqueViolation", err)
+	}
+
+	// Indexed lookups compare values as scans do
+	adapter.Create(ctx, "items", map[string]interface{}{"id": int64(7)})
+	if item, _ := adapter.FindOne(ctx, core.NewQuery("items").Where("id", core.OpEqual, 7).Build()); item == nil {
+		t.Error("FindOne() by int id found nothing for an int64 id")
+	}
+}
+
+func TestMemoryAdapter_TenantUniques(t *testing.T) {
+	adapter := New(WithTenantUniques())
+	ctx := context.Background()
+
+	adapter.Create(ctx, "users", map[string]interface{}{"id": "u1", "tenant_id": "acme", "email": "a@example.com"})
+	if _, err := adapter.Create(ctx, "users", map[string]interface{}{"id": "u2", "tenant_id": "globex", "email": "a@example.com"}); err != nil {
+		t.Errorf("Create() in another tenant error = %v", err)
+	}
+	if _, err := adapter.Create(ctx, "users", map[string]interface{}{"id": "u3", "tenant_id": "acme", "email": "a@example.com"}); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("Create() error = %v, want ErrUniqueViolation", err)
+	}
+}
+
+func BenchmarkMemoryAdapter_FindOne(b *testing.B) {
+	adapter := New()
+	ctx := context.Background()
+	for i := 0; i < 1000; i++ {
+		if _, err := adapter.Create(ctx, "users", map[string]interface{}{
+			"id":    fmt.Sprintf("user%d", i),
+			"email": fmt.Sprintf("user%d@example.com", i),
+		}); err != nil {
+			b.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	query := core.NewQuery("users").
+		Where("email", core.OpEqual, "user500@example.com").
+		Build()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if user, err := adapter.FindOne(ctx, query); err != nil || user == nil {
+			b.Fatalf("FindOne() = %v, %v", user, err)
+		}
+	}
+}
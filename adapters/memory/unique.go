@@ -0,0 +1,201 @@
+package memory
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// ErrUniqueViolation is returned when a write would give two records of a
+// model the same values for a unique constraint. The write changes nothing,
+// as a failed statement does in a SQL database. It wraps core.ErrDuplicate.
+var ErrUniqueViolation = fmt.Errorf("memory: unique constraint violated: %w", core.ErrDuplicate)
+
+// DefaultUniques are the unique constraints of the schema generated by
+// `beacon schema`, keyed by model. Every model is also unique on "id".
+var DefaultUniques = map[string][][]string{
+	core.ModelUsers:         {{"email"}},
+	core.ModelSessions:      {{"token"}},
+	core.ModelAccounts:      {{"provider_id", "account_id"}},
+	core.ModelVerifications: {{"token"}},
+}
+
+// TenantUniques replace DefaultUniques with WithTenantUniques. They are the
+// constraints of the schema generated by `beacon generate --tenancy`, where
+// emails and provider accounts are unique per tenant.
+var TenantUniques = map[string][][]string{
+	core.ModelUsers:         {{core.TenantColumn, "email"}},
+	core.ModelSessions:      {{"token"}},
+	core.ModelAccounts:      {{core.TenantColumn, "provider_id", "account_id"}},
+	core.ModelVerifications: {{"token"}},
+}
+
+// Option configures a MemoryAdapter
+type Option func(*MemoryAdapter)
+
+// WithUnique adds a unique constraint on fields of model, e.g. for a plugin
+// table. Equality lookups on all of the fields use the constraint's index.
+func WithUnique(model string, fields ...string) Option {
+	return func(m *MemoryAdapter) {
+		m.uniques[model] = append(m.uniques[model], fields)
+	}
+}
+
+// WithoutDefaultUniques drops DefaultUniques, keeping only the id
+// constraints and those added with WithUnique
+func WithoutDefaultUniques() Option {
+	return func(m *MemoryAdapter) {
+		m.noDefaults = true
+	}
+}
+
+// WithTenantUniques uses TenantUniques instead of DefaultUniques, for use
+// with beaconauth.WithTenancy
+func WithTenantUniques() Option {
+	return func(m *MemoryAdapter) {
+		m.tenancy = true
+	}
+}
+
+// index is a hash index backing a unique constraint. Records with a nil
+// or missing value for any of the fields are not indexed, so like SQL
+// NULLs they never conflict.
+type index struct {
+	fields  []string
+	entries map[string]map[string]interface{}
+}
+
+// key returns the index key of record's values for the fields
+func (ix *index) key(record map[string]interface{}) (string, bool) {
+	var b strings.Builder
+	for _, field := range ix.fields {
+		value := record[field]
+		if value == nil {
+			return "", false
+		}
+		// Equal times may print differently, e.g. in other zones
+		part := fmt.Sprint(value)
+		if t, ok := value.(time.Time); ok {
+			part = t.UTC().Format(time.RFC3339Nano)
+		}
+		fmt.Fprintf(&b, "%d:%s", len(part), part)
+	}
+	return b.String(), true
+}
+
+// add indexes record, reporting false if another record has its key
+func (ix *index) add(record map[string]interface{}) bool {
+	key, ok := ix.key(record)
+	if !ok {
+		return true
+	}
+	if _, taken := ix.entries[key]; taken {
+		return false
+	}
+	ix.entries[key] = record
+	return true
+}
+
+// remove drops record from the index
+func (ix *index) remove(record map[string]interface{}) {
+	if key, ok := ix.key(record); ok {
+		delete(ix.entries, key)
+	}
+}
+
+// indexesFor returns the indexes of model, creating them on first use.
+// The caller must hold the write lock.
+func (m *MemoryAdapter) indexesFor(model string) []*index {
+	if indexes, ok := m.indexes[model]; ok {
+		return indexes
+	}
+
+	specs := [][]string{{"id"}}
+	if !m.noDefaults {
+		defaults := DefaultUniques
+		if m.tenancy {
+			defaults = TenantUniques
+		}
+		specs = append(specs, defaults[model]...)
+	}
+	specs = append(specs, m.uniques[model]...)
+
+	indexes := make([]*index, len(specs))
+	for i, fields := range specs {
+		indexes[i] = &index{fields: fields, entries: make(map[string]map[string]interface{})}
+		for _, record := range m.data[model] {
+			indexes[i].add(record)
+		}
+	}
+	m.indexes[model] = indexes
+	return indexes
+}
+
+// replace updates the indexes of model for a write that removes old and
+// stores records. If one of records conflicts with a stored record or
+// another of records, the indexes are left unchanged and
+// ErrUniqueViolation is returned. The caller must hold the write lock.
+func (m *MemoryAdapter) replace(model string, old, records []map[string]interface{}) error {
+	indexes := m.indexesFor(model)
+	for _, ix := range indexes {
+		for _, record := range old {
+			ix.remove(record)
+		}
+	}
+
+	for i, record := range records {
+		for j, ix := range indexes {
+			if ix.add(record) {
+				continue
+			}
+
+			for _, added := range indexes[:j] {
+				added.remove(record)
+			}
+			for _, other := range indexes {
+				for _, record := range records[:i] {
+					other.remove(record)
+				}
+				for _, record := range old {
+					other.add(record)
+				}
+			}
+			return fmt.Errorf("%w: %s(%s)", ErrUniqueViolation, model, strings.Join(ix.fields, ", "))
+		}
+	}
+	return nil
+}
+
+// candidates returns the records of model that may match where. When where
+// compares every field of a unique constraint for equality with a string
+// or integer, the constraint's index narrows the result to at most one
+// record. The caller must hold the read lock.
+func (m *MemoryAdapter) candidates(model string, where []core.WhereClause) []map[string]interface{} {
+	equal := make(map[string]interface{}, len(where))
+	for _, clause := range where {
+		if clause.Operator != core.OpEqual {
+			continue
+		}
+		switch clause.Value.(type) {
+		case string, int, int64, int32:
+			equal[clause.Field] = clause.Value
+		}
+	}
+
+	if len(equal) > 0 {
+		for _, ix := range m.indexes[model] {
+			key, ok := ix.key(equal)
+			if !ok {
+				continue
+			}
+			if record, found := ix.entries[key]; found {
+				return []map[string]interface{}{record}
+			}
+			return nil
+		}
+	}
+
+	return m.data[model]
+}
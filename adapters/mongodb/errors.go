@@ -0,0 +1,42 @@
+package mongodb
+
+import (
+	"errors"
+
+	"github.com/marshallshelly/beacon-auth/adapters/internal/dberr"
+	"github.com/marshallshelly/beacon-auth/core"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// MongoDB server error codes
+const (
+	codeWriteConflict      = 112
+	codeDocumentValidation = 121
+)
+
+// classify maps MongoDB server errors to the core adapter errors
+func classify(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return core.ErrNotFound
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return core.ErrDuplicate
+	}
+
+	var serverErr mongo.ServerError
+	if !errors.As(err, &serverErr) {
+		return nil
+	}
+	switch {
+	case serverErr.HasErrorCode(codeDocumentValidation):
+		return core.ErrConstraint
+	case serverErr.HasErrorCode(codeWriteConflict), serverErr.HasErrorLabel("TransientTransactionError"):
+		return core.ErrTxConflict
+	}
+	return nil
+}
+
+// translateError wraps err with the core error for its MongoDB error
+func translateError(err error) error {
+	return dberr.Translate(err, classify)
+}
@@ -0,0 +1,40 @@
+package mssql
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/marshallshelly/beacon-auth/adapters/internal/dberr"
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// classify maps SQL Server error numbers to the core adapter errors
+func classify(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return core.ErrNotFound
+	}
+
+	var sqlErr interface{ SQLErrorNumber() int32 }
+	if !errors.As(err, &sqlErr) {
+		return nil
+	}
+	switch sqlErr.SQLErrorNumber() {
+	case 2601, 2627: // duplicate key in a unique index or constraint
+		return core.ErrDuplicate
+	case 515, 547: // NOT NULL, foreign key and CHECK violations
+		return core.ErrConstraint
+	case 1205, 3960: // deadlock victim, snapshot update conflict
+		return core.ErrTxConflict
+	}
+	return nil
+}
+
+// translateError wraps err with the core error for its SQL Server error
+func translateError(err error) error {
+	return dberr.Translate(err, classify)
+}
+
+// translate applies translateError to the error of a call's results
+func translate[T any](v T, err error) (T, error) {
+	return v, translateError(err)
+}
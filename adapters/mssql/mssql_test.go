@@ -0,0 +1,109 @@
+package mssql
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+func TestBuildSelectQuery_Schema(t *testing.T) {
+	query := &core.Query{
+		Model: "users",
+		Where: []core.WhereClause{
+			{Field: "email", Operator: core.OpEqual, Value: "test@example.com"},
+		},
+	}
+
+	sqlStr, args, err := buildSelectQuery("auth", query, true)
+	if err != nil {
+		t.Fatalf("buildSelectQuery failed: %v", err)
+	}
+
+	if !strings.Contains(sqlStr, "FROM [auth].[users] WHERE") {
+		t.Errorf("Expected schema-qualified table, got %s", sqlStr)
+	}
+	if len(args) != 1 {
+		t.Errorf("Expected 1 argument, got %d", len(args))
+	}
+
+	sqlStr, _, err = buildSelectQuery("", query, true)
+	if err != nil {
+		t.Fatalf("buildSelectQuery failed: %v", err)
+	}
+	if !strings.Contains(sqlStr, "FROM [users] WHERE") {
+		t.Errorf("Expected unqualified table, got %s", sqlStr)
+	}
+}
+
+func TestBuildSelectQuery_Select(t *testing.T) {
+	query := &core.Query{Model: "sessions", Select: []string{"id", "user_id"}}
+
+	sqlStr, _, err := buildSelectQuery("", query, true)
+	if err != nil {
+		t.Fatalf("buildSelectQuery failed: %v", err)
+	}
+	if !strings.HasPrefix(sqlStr, "SELECT TOP 1 [id], [user_id] FROM [sessions]") {
+		t.Errorf("Expected selected columns, got %s", sqlStr)
+	}
+}
+
+func TestNew_InvalidSchema(t *testing.T) {
+	_, err := New(context.Background(), &Config{Host: "localhost", Schema: "auth; DROP TABLE users"})
+	if err == nil || !strings.Contains(err.Error(), "invalid schema") {
+		t.Errorf("Expected invalid schema error, got %v", err)
+	}
+}
+
+func TestParseDSN(t *testing.T) {
+	dsn, schema, err := parseDSN("mssql://sa:p%40ss@db:1433?database=auth&schema=authz&encrypt=true")
+	if err != nil {
+		t.Fatalf("parseDSN() error = %v", err)
+	}
+	if schema != "authz" {
+		t.Errorf("schema = %q, want authz", schema)
+	}
+	if !strings.HasPrefix(dsn, "sqlserver://sa:p%40ss@db:1433?") || strings.Contains(dsn, "schema=") {
+		t.Errorf("dsn = %q", dsn)
+	}
+	if !strings.Contains(dsn, "database=auth") || !strings.Contains(dsn, "encrypt=true") {
+		t.Errorf("dsn = %q, want driver parameters kept", dsn)
+	}
+
+	if _, _, err := parseDSN("sqlserver://db?schema=auth%20users"); err == nil {
+		t.Error("expected invalid schema to be rejected")
+	}
+	if _, _, err := parseDSN("postgres://db"); err == nil {
+		t.Error("expected unsupported scheme to be rejected")
+	}
+}
+
+func TestBuildUpsertQuery(t *testing.T) {
+	sqlStr, args, err := buildUpsertQuery("auth", "users", []string{"id"}, map[string]interface{}{
+		"id":    "u1",
+		"email": "a@example.com",
+	})
+	if err != nil {
+		t.Fatalf("buildUpsertQuery failed: %v", err)
+	}
+
+	for _, want := range []string{
+		"MERGE INTO [auth].[users] WITH (HOLDLOCK) AS target",
+		"USING (SELECT ? AS [email], ? AS [id]) AS source ON target.[id] = source.[id]",
+		"WHEN MATCHED THEN UPDATE SET target.[email] = source.[email]",
+		"WHEN NOT MATCHED THEN INSERT ([email], [id]) VALUES (source.[email], source.[id])",
+		"OUTPUT Inserted.*;",
+	} {
+		if !strings.Contains(sqlStr, want) {
+			t.Errorf("Expected %q in %s", want, sqlStr)
+		}
+	}
+	if len(args) != 2 || args[0] != "a@example.com" || args[1] != "u1" {
+		t.Errorf("Unexpected args %v", args)
+	}
+
+	if _, _, err := buildUpsertQuery("", "users", []string{"email"}, map[string]interface{}{"id": "u1"}); err == nil {
+		t.Error("Expected error for conflict field missing from data")
+	}
+}
@@ -0,0 +1,41 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/marshallshelly/beacon-auth/adapters/internal/dberr"
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// classify maps MySQL server errors to the core adapter errors
+func classify(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return core.ErrNotFound
+	}
+
+	var myErr *mysql.MySQLError
+	if !errors.As(err, &myErr) {
+		return nil
+	}
+	switch myErr.Number {
+	case 1062, 1586: // ER_DUP_ENTRY, ER_DUP_ENTRY_WITH_KEY_NAME
+		return core.ErrDuplicate
+	case 1048, 1216, 1217, 1451, 1452, 3819: // NOT NULL, foreign key and CHECK violations
+		return core.ErrConstraint
+	case 1205, 1213: // ER_LOCK_WAIT_TIMEOUT, ER_LOCK_DEADLOCK
+		return core.ErrTxConflict
+	}
+	return nil
+}
+
+// translateError wraps err with the core error for its MySQL error
+func translateError(err error) error {
+	return dberr.Translate(err, classify)
+}
+
+// translate applies translateError to the error of a call's results
+func translate[T any](v T, err error) (T, error) {
+	return v, translateError(err)
+}
@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/marshallshelly/beacon-auth/adapters/internal/dberr"
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// classify maps PostgreSQL SQLSTATE codes to the core adapter errors.
+// CockroachDB uses the same codes.
+func classify(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return core.ErrNotFound
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return nil
+	}
+	switch pgErr.Code {
+	case "23505": // unique_violation
+		return core.ErrDuplicate
+	case "23502", "23503", "23514", "23P01": // not null, foreign key, check, exclusion
+		return core.ErrConstraint
+	case "40001", "40P01": // serialization_failure, deadlock_detected
+		return core.ErrTxConflict
+	}
+	return nil
+}
+
+// translateError wraps err with the core error for its SQLSTATE code
+func translateError(err error) error {
+	return dberr.Translate(err, classify)
+}
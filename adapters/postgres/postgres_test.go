@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/marshallshelly/beacon-auth/core"
 )
 
@@ -614,3 +615,39 @@ func TestPostgresAdapter_Ping(t *testing.T) {
 		t.Fatalf("Ping failed: %v", err)
 	}
 }
+
+func TestNewFromDSN_Cockroach(t *testing.T) {
+	ctx := context.Background()
+
+	// The pool connects lazily, so no server is needed
+	adapter, err := NewFromDSN(ctx, "cockroachdb://root@localhost:26257/defaultdb?sslmode=disable")
+	if err != nil {
+		t.Fatalf("NewFromDSN failed: %v", err)
+	}
+	defer adapter.Close()
+
+	if adapter.ID() != "cockroach" {
+		t.Errorf("Expected ID cockroach, got %q", adapter.ID())
+	}
+	if adapter.maxTxRetries != DefaultMaxTxRetries {
+		t.Errorf("Expected %d retries, got %d", DefaultMaxTxRetries, adapter.maxTxRetries)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	serialization := &pgconn.PgError{Code: "40001", Message: "restart transaction"}
+
+	if !isRetryable(serialization) {
+		t.Error("Expected 40001 to be retryable")
+	}
+	if !isRetryable(fmt.Errorf("transaction error: %w, rollback error: closed", serialization)) {
+		t.Error("Expected a wrapped 40001 to be retryable")
+	}
+	if isRetryable(&pgconn.PgError{Code: "23505"}) || isRetryable(nil) {
+		t.Error("Expected other errors not to be retryable")
+	}
+
+	if retryDelay(0) != 10*time.Millisecond || retryDelay(20) != time.Second {
+		t.Errorf("Unexpected retry delays %v, %v", retryDelay(0), retryDelay(20))
+	}
+}
@@ -0,0 +1,141 @@
+package redis
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Redis hashes hold strings, so every value is stored with a one-letter
+// type tag and read back as the Go type the SQL adapters return for it
+const (
+	tagNull   = "n:"
+	tagString = "s:"
+	tagInt    = "i:"
+	tagFloat  = "f:"
+	tagBool   = "b:"
+	tagTime   = "t:"
+	tagBytes  = "x:"
+	tagJSON   = "j:"
+)
+
+// encodeValue converts a record value to its stored form. Integers are
+// widened to int64 and times converted to UTC, so equal values always have
+// the same stored form and can be used as index keys.
+func encodeValue(v interface{}) (string, error) {
+	switch val := v.(type) {
+	case nil:
+		return tagNull, nil
+	case string:
+		return tagString + val, nil
+	case bool:
+		if val {
+			return tagBool + "1", nil
+		}
+		return tagBool + "0", nil
+	case int:
+		return tagInt + strconv.FormatInt(int64(val), 10), nil
+	case int8:
+		return tagInt + strconv.FormatInt(int64(val), 10), nil
+	case int16:
+		return tagInt + strconv.FormatInt(int64(val), 10), nil
+	case int32:
+		return tagInt + strconv.FormatInt(int64(val), 10), nil
+	case int64:
+		return tagInt + strconv.FormatInt(val, 10), nil
+	case uint:
+		return tagInt + strconv.FormatUint(uint64(val), 10), nil
+	case uint8:
+		return tagInt + strconv.FormatUint(uint64(val), 10), nil
+	case uint16:
+		return tagInt + strconv.FormatUint(uint64(val), 10), nil
+	case uint32:
+		return tagInt + strconv.FormatUint(uint64(val), 10), nil
+	case uint64:
+		return tagInt + strconv.FormatUint(val, 10), nil
+	case float32:
+		return tagFloat + strconv.FormatFloat(float64(val), 'g', -1, 32), nil
+	case float64:
+		return tagFloat + strconv.FormatFloat(val, 'g', -1, 64), nil
+	case time.Time:
+		return tagTime + val.UTC().Format(time.RFC3339Nano), nil
+	case *time.Time:
+		if val == nil {
+			return tagNull, nil
+		}
+		return encodeValue(*val)
+	case []byte:
+		return tagBytes + base64.StdEncoding.EncodeToString(val), nil
+	default:
+		data, err := json.Marshal(val)
+		if err != nil {
+			return "", fmt.Errorf("cannot store %T: %w", v, err)
+		}
+		return tagJSON + string(data), nil
+	}
+}
+
+// decodeValue converts a stored value back to a record value
+func decodeValue(s string) (interface{}, error) {
+	if len(s) < 2 {
+		return nil, fmt.Errorf("malformed stored value %q", s)
+	}
+	tag, text := s[:2], s[2:]
+
+	switch tag {
+	case tagNull:
+		return nil, nil
+	case tagString:
+		return text, nil
+	case tagBool:
+		return text == "1", nil
+	case tagInt:
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return n, nil
+		}
+		// Values above math.MaxInt64 come from uint64
+		return strconv.ParseUint(text, 10, 64)
+	case tagFloat:
+		return strconv.ParseFloat(text, 64)
+	case tagTime:
+		return time.Parse(time.RFC3339Nano, text)
+	case tagBytes:
+		return base64.StdEncoding.DecodeString(text)
+	case tagJSON:
+		var v interface{}
+		if err := json.Unmarshal([]byte(text), &v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	default:
+		return nil, fmt.Errorf("malformed stored value %q", s)
+	}
+}
+
+// encodeRecord converts record values to their stored form
+func encodeRecord(data map[string]interface{}) (map[string]interface{}, error) {
+	fields := make(map[string]interface{}, len(data))
+	for field, value := range data {
+		encoded, err := encodeValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field, err)
+		}
+		fields[field] = encoded
+	}
+	return fields, nil
+}
+
+// decodeRecord converts a hash read from Redis back to a record
+func decodeRecord(hash map[string]string) (map[string]interface{}, error) {
+	record := make(map[string]interface{}, len(hash))
+	for field, stored := range hash {
+		value, err := decodeValue(stored)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field, err)
+		}
+		record[field] = value
+	}
+	return record, nil
+}
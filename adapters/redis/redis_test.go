@@ -0,0 +1,300 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/marshallshelly/beacon-auth/adapter"
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+func newTestAdapter(t *testing.T, cfg *Config) (*RedisAdapter, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	cfg.Addr = server.Addr()
+
+	a, err := New(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = a.Close() })
+	return a, server
+}
+
+func TestRedisAdapter_Suite(t *testing.T) {
+	a, server := newTestAdapter(t, nil)
+
+	suite := &adapter.TestSuite{
+		Adapter: a,
+		SetupFunc: func(t *testing.T, _ core.Adapter) {
+			server.FlushAll()
+		},
+	}
+	suite.RunAll(t)
+}
+
+func TestRedisAdapter_IndexedLookup(t *testing.T) {
+	a, server := newTestAdapter(t, nil)
+	ctx := context.Background()
+
+	for _, user := range []map[string]interface{}{
+		{"id": "u1", "email": "a@example.com"},
+		{"id": "u2", "email": "b@example.com"},
+	} {
+		if _, err := a.Create(ctx, core.ModelUsers, user); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	key := "beacon:{users}:i:email:s:b@example.com"
+	if members, _ := server.Members(key); !reflect.DeepEqual(members, []string{"u2"}) {
+		t.Fatalf("index %s = %v, want [u2]", key, members)
+	}
+
+	byEmail := core.NewQuery(core.ModelUsers).
+		Where("email", core.OpEqual, "b@example.com").
+		Build()
+	user, err := a.FindOne(ctx, byEmail)
+	if err != nil || user == nil || user["id"] != "u2" {
+		t.Fatalf("FindOne() = %v, %v", user, err)
+	}
+
+	// Changing an indexed field moves the record to the new index set
+	if _, err := a.Update(ctx, byEmail, map[string]interface{}{"email": "c@example.com"}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if server.Exists(key) {
+		t.Errorf("index %s still exists after the update", key)
+	}
+	user, err = a.FindOne(ctx, core.NewQuery(core.ModelUsers).
+		Where("email", core.OpEqual, "c@example.com").
+		Build())
+	if err != nil || user == nil || user["id"] != "u2" {
+		t.Fatalf("FindOne() after update = %v, %v", user, err)
+	}
+
+	// Deleting removes the record from the index
+	if err := a.Delete(ctx, core.NewQuery(core.ModelUsers).Where("id", core.OpEqual, "u2").Build()); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if server.Exists("beacon:{users}:i:email:s:c@example.com") || server.Exists("beacon:{users}:r:u2") {
+		t.Error("Delete() left keys of the record behind")
+	}
+}
+
+func TestRedisAdapter_Values(t *testing.T) {
+	a, _ := newTestAdapter(t, nil)
+	ctx := context.Background()
+	now := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+
+	want := map[string]interface{}{
+		"id":         "v1",
+		"count":      int64(3),
+		"ratio":      0.5,
+		"enabled":    true,
+		"expires_at": now,
+		"deleted_at": nil,
+		"raw":        []byte{0, 1, 2},
+		"scopes":     []interface{}{"openid", "email"},
+	}
+	if _, err := a.Create(ctx, "values", want); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	got, err := a.FindOne(ctx, core.NewQuery("values").Where("id", core.OpEqual, "v1").Build())
+	if err != nil {
+		t.Fatalf("FindOne() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FindOne() =\n%#v\nwant\n%#v", got, want)
+	}
+}
+
+func TestRedisAdapter_CreateIDs(t *testing.T) {
+	a, _ := newTestAdapter(t, nil)
+	ctx := context.Background()
+
+	first, err := a.Create(ctx, "items", map[string]interface{}{"name": "a"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	second, err := a.Create(ctx, "items", map[string]interface{}{"name": "b"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if first["id"] != int64(1) || second["id"] != int64(2) {
+		t.Errorf("generated ids = %v, %v, want 1, 2", first["id"], second["id"])
+	}
+
+	if _, err := a.Create(ctx, "items", map[string]interface{}{"id": int64(1)}); !errors.Is(err, ErrDuplicateID) {
+		t.Errorf("Create() duplicate error = %v, want ErrDuplicateID", err)
+	}
+
+	// A batch with a taken ID stores nothing
+	_, err = a.CreateMany(ctx, "items", []map[string]interface{}{
+		{"id": int64(3), "name": "c"},
+		{"id": int64(2), "name": "b"},
+	})
+	if !errors.Is(err, ErrDuplicateID) {
+		t.Errorf("CreateMany() error = %v, want ErrDuplicateID", err)
+	}
+	if count, _ := a.Count(ctx, core.NewQuery("items").Build()); count != 2 {
+		t.Errorf("Count() = %d, want 2", count)
+	}
+
+	if _, err := a.Create(ctx, "bad-model", map[string]interface{}{"id": "x"}); !errors.Is(err, core.ErrInvalidIdentifier) {
+		t.Errorf("Create() error = %v, want ErrInvalidIdentifier", err)
+	}
+}
+
+func TestRedisAdapter_UpsertByIndexedField(t *testing.T) {
+	a, _ := newTestAdapter(t, nil)
+	ctx := context.Background()
+
+	created, err := a.Upsert(ctx, core.ModelUsers, []string{"email"}, map[string]interface{}{
+		"email": "a@example.com",
+		"name":  "Old",
+	})
+	if err != nil {
+		t.Fatalf("Upsert() insert error = %v", err)
+	}
+
+	updated, err := a.Upsert(ctx, core.ModelUsers, []string{"email"}, map[string]interface{}{
+		"id":    "other",
+		"email": "a@example.com",
+		"name":  "New",
+	})
+	if err != nil {
+		t.Fatalf("Upsert() update error = %v", err)
+	}
+	if updated["id"] != created["id"] || updated["name"] != "New" {
+		t.Errorf("Upsert() = %v, want id %v and name New", updated, created["id"])
+	}
+	if count, _ := a.Count(ctx, core.NewQuery(core.ModelUsers).Build()); count != 1 {
+		t.Errorf("Count() = %d, want 1", count)
+	}
+}
+
+func TestRedisAdapter_Reindex(t *testing.T) {
+	a, server := newTestAdapter(t, &Config{Indexes: map[string][]string{}})
+	ctx := context.Background()
+
+	if _, err := a.Create(ctx, "devices", map[string]interface{}{"id": "d1", "user_id": "u1"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	indexed, err := New(ctx, &Config{
+		Client:  a.Client(),
+		Indexes: map[string][]string{"devices": {"user_id"}},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := indexed.Reindex(ctx, "devices"); err != nil {
+		t.Fatalf("Reindex() error = %v", err)
+	}
+
+	if members, _ := server.Members("beacon:{devices}:i:user_id:s:u1"); !reflect.DeepEqual(members, []string{"d1"}) {
+		t.Errorf("index after Reindex() = %v, want [d1]", members)
+	}
+	found, err := indexed.FindMany(ctx, core.NewQuery("devices").Where("user_id", core.OpEqual, "u1").Build())
+	if err != nil || len(found) != 1 {
+		t.Errorf("FindMany() = %v, %v", found, err)
+	}
+
+	// The client was passed in, so Close leaves it open for its owner
+	if err := indexed.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := a.Ping(ctx); err != nil {
+		t.Errorf("Ping() after closing a borrowed client = %v", err)
+	}
+}
+
+func TestNewFromDSN(t *testing.T) {
+	server := miniredis.RunT(t)
+	ctx := context.Background()
+
+	a, err := NewFromDSN(ctx, "redis://"+server.Addr()+"/0?prefix=app:")
+	if err != nil {
+		t.Fatalf("NewFromDSN() error = %v", err)
+	}
+	defer a.Close()
+
+	if _, err := a.Create(ctx, core.ModelUsers, map[string]interface{}{"id": "u1"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if !server.Exists("app:{users}:r:u1") {
+		t.Errorf("keys = %v, want the app: prefix", server.Keys())
+	}
+
+	if _, err := NewFromDSN(ctx, "http://"+server.Addr()); err == nil {
+		t.Error("NewFromDSN() expected error for a non-Redis URL")
+	}
+}
+
+func TestRedisAdapter_CompositeUnique(t *testing.T) {
+	a, _ := newTestAdapter(t, nil)
+	ctx := context.Background()
+
+	account := map[string]interface{}{"id": "a1", "user_id": "u1", "provider_id": "github", "account_id": "42"}
+	if _, err := a.Create(ctx, core.ModelAccounts, account); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	// The same account ID at another provider is a different account
+	other := map[string]interface{}{"id": "a2", "user_id": "u1", "provider_id": "google", "account_id": "42"}
+	if _, err := a.Create(ctx, core.ModelAccounts, other); err != nil {
+		t.Fatalf("Create() at another provider error = %v", err)
+	}
+
+	duplicate := map[string]interface{}{"id": "a3", "user_id": "u2", "provider_id": "github", "account_id": "42"}
+	if _, err := a.Create(ctx, core.ModelAccounts, duplicate); !errors.Is(err, ErrUniqueViolation) || !errors.Is(err, core.ErrDuplicate) {
+		t.Errorf("Create() of a linked account error = %v, want ErrUniqueViolation", err)
+	}
+
+	// Records without a value never conflict, like SQL NULLs
+	for _, id := range []string{"a4", "a5"} {
+		if _, err := a.Create(ctx, core.ModelAccounts, map[string]interface{}{"id": id, "provider_id": "credential", "account_id": nil}); err != nil {
+			t.Errorf("Create() without account_id error = %v", err)
+		}
+	}
+}
+
+func TestRedisAdapter_ReindexUniques(t *testing.T) {
+	a, _ := newTestAdapter(t, &Config{Uniques: map[string][][]string{}})
+	ctx := context.Background()
+
+	for _, id := range []string{"d1", "d2"} {
+		if _, err := a.Create(ctx, "devices", map[string]interface{}{"id": id, "serial": "s-1"}); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	unique, err := New(ctx, &Config{
+		Client:  a.Client(),
+		Uniques: map[string][][]string{"devices": {{"serial"}}},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := unique.Reindex(ctx, "devices"); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("Reindex() of duplicate records error = %v, want ErrUniqueViolation", err)
+	}
+	if err := unique.Delete(ctx, core.NewQuery("devices").Where("id", core.OpEqual, "d2").Build()); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := unique.Reindex(ctx, "devices"); err != nil {
+		t.Errorf("Reindex() after removing the duplicate error = %v", err)
+	}
+	if _, err := unique.Create(ctx, "devices", map[string]interface{}{"id": "d3", "serial": "s-1"}); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("Create() with a reindexed serial error = %v, want ErrUniqueViolation", err)
+	}
+}
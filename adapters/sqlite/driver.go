@@ -0,0 +1,63 @@
+//go:build !sqlite_cgo
+
+package sqlite
+
+import (
+	"errors"
+
+	"modernc.org/sqlite"
+)
+
+// driverName is the database/sql driver the adapter opens. Building with
+// the sqlite_cgo tag switches to mattn/go-sqlite3 (see driver_cgo.go).
+const driverName = "sqlite"
+
+// driverParams are appended to every DSN
+var driverParams []string
+
+// pragmaParam returns the DSN parameter that runs PRAGMA name = value on
+// every new connection
+func pragmaParam(name, value string) string {
+	return "_pragma=" + name + "(" + value + ")"
+}
+
+// errorCode returns the extended SQLite result code of err
+func errorCode(err error) (int, bool) {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return 0, false
+	}
+	return sqliteErr.Code(), true
+}
+
+// serialize returns the contents of the database open on driverConn
+func serialize(driverConn interface{}) ([]byte, error) {
+	serializer, ok := driverConn.(interface{ Serialize() ([]byte, error) })
+	if !ok {
+		return nil, errors.New("sqlite: driver does not support serialization")
+	}
+	return serializer.Serialize()
+}
+
+// restoreFile copies the database file at path into the database open on
+// driverConn
+func restoreFile(driverConn interface{}, path string) error {
+	restorer, ok := driverConn.(interface {
+		NewRestore(string) (*sqlite.Backup, error)
+	})
+	if !ok {
+		return errors.New("sqlite: driver does not support restore")
+	}
+
+	backup, err := restorer.NewRestore("file:" + path + "?mode=ro")
+	if err != nil {
+		return err
+	}
+
+	if _, err := backup.Step(-1); err != nil {
+		_ = backup.Finish()
+		return err
+	}
+
+	return backup.Finish()
+}
@@ -0,0 +1,69 @@
+//go:build sqlite_cgo
+
+package sqlite
+
+import (
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// driverName is the database/sql driver the adapter opens. mattn/go-sqlite3
+// links the SQLite C library and needs CGO.
+const driverName = "sqlite3"
+
+// driverParams are appended to every DSN. go-sqlite3 waits 5 seconds for
+// locks unless told otherwise; it uses the first value of a parameter, so
+// a busy timeout from the DSN or Config takes precedence over this one.
+var driverParams = []string{"_busy_timeout=0"}
+
+// pragmaParam returns the DSN parameter that runs PRAGMA name = value on
+// every new connection. go-sqlite3 takes each pragma as its own parameter.
+func pragmaParam(name, value string) string {
+	return "_" + name + "=" + value
+}
+
+// errorCode returns the extended SQLite result code of err
+func errorCode(err error) (int, bool) {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return 0, false
+	}
+	return int(sqliteErr.ExtendedCode), true
+}
+
+// serialize returns the contents of the database open on driverConn
+func serialize(driverConn interface{}) ([]byte, error) {
+	conn, ok := driverConn.(*sqlite3.SQLiteConn)
+	if !ok {
+		return nil, errors.New("sqlite: driver does not support serialization")
+	}
+	return conn.Serialize("main")
+}
+
+// restoreFile copies the database file at path into the database open on
+// driverConn
+func restoreFile(driverConn interface{}, path string) error {
+	dest, ok := driverConn.(*sqlite3.SQLiteConn)
+	if !ok {
+		return errors.New("sqlite: driver does not support restore")
+	}
+
+	src, err := (&sqlite3.SQLiteDriver{}).Open("file:" + path + "?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+
+	backup, err := dest.Backup("main", src.(*sqlite3.SQLiteConn), "main")
+	if err != nil {
+		return err
+	}
+
+	if _, err := backup.Step(-1); err != nil {
+		_ = backup.Finish()
+		return err
+	}
+
+	return backup.Finish()
+}
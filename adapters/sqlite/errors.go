@@ -0,0 +1,52 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/marshallshelly/beacon-auth/adapters/internal/dberr"
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// SQLite result codes (https://www.sqlite.org/rescode.html). Extended codes
+// keep the primary code in their low byte.
+const (
+	codeBusy                 = 5
+	codeLocked               = 6
+	codeConstraint           = 19
+	codeConstraintPrimaryKey = 1555
+	codeConstraintUnique     = 2067
+)
+
+// classify maps SQLite result codes to the core adapter errors
+func classify(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return core.ErrNotFound
+	}
+
+	code, ok := errorCode(err)
+	if !ok {
+		return nil
+	}
+	switch code {
+	case codeConstraintPrimaryKey, codeConstraintUnique:
+		return core.ErrDuplicate
+	}
+	switch code & 0xff {
+	case codeConstraint:
+		return core.ErrConstraint
+	case codeBusy, codeLocked:
+		return core.ErrTxConflict
+	}
+	return nil
+}
+
+// translateError wraps err with the core error for its SQLite result code
+func translateError(err error) error {
+	return dberr.Translate(err, classify)
+}
+
+// translate applies translateError to the error of a call's results
+func translate[T any](v T, err error) (T, error) {
+	return v, translateError(err)
+}
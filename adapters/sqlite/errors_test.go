@@ -0,0 +1,66 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+func TestSQLiteAdapter_Errors(t *testing.T) {
+	ctx := context.Background()
+	dsn := "file:" + t.TempDir() + "/errors.db?mode=rwc"
+	a, err := New(ctx, &Config{DataSourceName: dsn, ForeignKeys: true})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer a.Close()
+
+	if err := a.Exec(ctx, testSchema+testSessionsSchema+`
+		CREATE TABLE devices (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL REFERENCES users(id)
+		);
+	`); err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+
+	user := map[string]interface{}{"id": "u1", "email": "a@example.com"}
+	if _, err := a.Create(ctx, "users", user); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := a.Create(ctx, "users", map[string]interface{}{"id": "u2", "email": "a@example.com"}); !errors.Is(err, core.ErrDuplicate) {
+		t.Errorf("Create() duplicate email error = %v, want ErrDuplicate", err)
+	}
+	if _, err := a.CreateMany(ctx, "users", []map[string]interface{}{user}); !errors.Is(err, core.ErrDuplicate) {
+		t.Errorf("CreateMany() duplicate id error = %v, want ErrDuplicate", err)
+	}
+	if _, err := a.Create(ctx, "users", map[string]interface{}{"id": "u3"}); !errors.Is(err, core.ErrConstraint) {
+		t.Errorf("Create() without email error = %v, want ErrConstraint", err)
+	}
+	if _, err := a.Create(ctx, "devices", map[string]interface{}{"id": "d1", "user_id": "missing"}); !errors.Is(err, core.ErrConstraint) {
+		t.Errorf("Create() with unknown user error = %v, want ErrConstraint", err)
+	}
+
+	// A second connection cannot write while the first holds the lock
+	other, err := New(ctx, &Config{DataSourceName: dsn})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer other.Close()
+
+	err = a.Transaction(ctx, func(tx core.Adapter) error {
+		if _, err := tx.Create(ctx, "users", map[string]interface{}{"id": "u4", "email": "d@example.com"}); err != nil {
+			return err
+		}
+		_, err := other.Create(ctx, "users", map[string]interface{}{"id": "u5", "email": "e@example.com"})
+		if !errors.Is(err, core.ErrTxConflict) {
+			t.Errorf("Create() on a locked database error = %v, want ErrTxConflict", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+}
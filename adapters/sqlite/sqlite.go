@@ -2,106 +2,453 @@ package sqlite
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/marshallshelly/beacon-auth/adapters/internal/sessionjoin"
+	"github.com/marshallshelly/beacon-auth/adapters/internal/sqlident"
+	"github.com/marshallshelly/beacon-auth/adapters/internal/sqltx"
+	"github.com/marshallshelly/beacon-auth/adapters/internal/stmtcache"
 	"github.com/marshallshelly/beacon-auth/core"
-	_ "modernc.org/sqlite"
 )
 
 type SQLiteAdapter struct {
-	db *sql.DB
+	db    *sql.DB
+	stmts *stmtcache.Cache
+	dsn   string
+
+	// reader and reads serve FindOne, FindMany, Count and session lookups
+	// when ReadConns is set. Otherwise reader is nil and reads is stmts.
+	reader *sql.DB
+	reads  *stmtcache.Cache
 }
 
 type Config struct {
 	DataSourceName string
+
+	// InMemory opens a private in-memory database instead of a file.
+	// Each adapter instance gets its own uniquely named shared-cache
+	// database, so parallel tests do not see each other's data. The
+	// database is discarded when the adapter is closed.
+	// DataSourceName must be empty when InMemory is set.
+	InMemory bool
+
+	// StatementCacheSize is the number of prepared statements kept for
+	// reuse (default 100). A negative value disables the cache.
+	StatementCacheSize int
+
+	// JournalMode sets the journal_mode pragma, e.g. "WAL". WAL lets
+	// readers run while a write is in progress and is recommended with
+	// ReadConns. Empty keeps the database's current mode.
+	JournalMode string
+
+	// BusyTimeout is how long a connection waits for a lock held by
+	// another connection or process before failing with SQLITE_BUSY.
+	// Zero fails immediately.
+	BusyTimeout time.Duration
+
+	// ForeignKeys enforces foreign key constraints, which SQLite leaves
+	// off by default
+	ForeignKeys bool
+
+	// ReadConns opens a separate pool of up to ReadConns read-only
+	// connections for FindOne, FindMany, Count, session lookups and
+	// read-only transactions, next to the single writer connection. Zero
+	// runs everything on the writer. Requires a file database.
+	ReadConns int
 }
 
+// journalModes are the values accepted for Config.JournalMode
+var journalModes = []string{"DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF"}
+
 func New(ctx context.Context, cfg *Config) (*SQLiteAdapter, error) {
-	if cfg.DataSourceName == "" {
-		cfg.DataSourceName = "file:beaconauth.db?cache=shared&mode=rwc"
+	// The DSN is resolved without writing to cfg, so a Config can be
+	// passed to New again
+	dsn := cfg.DataSourceName
+	if cfg.InMemory {
+		if dsn != "" {
+			return nil, errors.New("sqlite: DataSourceName cannot be used with InMemory")
+		}
+		var err error
+		if dsn, err = inMemoryDSN(); err != nil {
+			return nil, err
+		}
+	}
+
+	if dsn == "" {
+		dsn = "file:beaconauth.db?cache=shared&mode=rwc"
 	}
 
-	db, err := sql.Open("sqlite", cfg.DataSourceName)
+	if cfg.ReadConns < 0 {
+		return nil, errors.New("sqlite: ReadConns cannot be negative")
+	}
+	if cfg.ReadConns > 0 && cfg.InMemory {
+		// A private read connection would open an empty database
+		return nil, errors.New("sqlite: ReadConns cannot be used with InMemory")
+	}
+
+	pragmas, err := configPragmas(cfg, false)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open(driverName, withParams(dsn, pragmas...))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	// SQLite guidelines for concurrency
+	// SQLite guidelines for concurrency.
+	// Keeping the single connection open forever also keeps in-memory
+	// databases alive, since they are dropped with their last connection.
 	db.SetMaxOpenConns(1)
 	db.SetMaxIdleConns(1)
 	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
 
 	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	return &SQLiteAdapter{db: db}, nil
+	s := &SQLiteAdapter{db: db, stmts: stmtcache.New(db, cfg.StatementCacheSize), dsn: dsn}
+	s.reads = s.stmts
+	if cfg.ReadConns == 0 {
+		return s, nil
+	}
+
+	// Readers use private caches, since connections sharing a cache lock
+	// each other out at the table level, and reject writes with query_only
+	readPragmas, err := configPragmas(cfg, true)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	reader, err := sql.Open(driverName, withParams(dsn, append(readPragmas, "cache=private")...))
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to open read pool: %w", err)
+	}
+	reader.SetMaxOpenConns(cfg.ReadConns)
+	reader.SetMaxIdleConns(cfg.ReadConns)
+
+	if err := reader.PingContext(ctx); err != nil {
+		_ = reader.Close()
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to ping read pool: %w", err)
+	}
+
+	s.reader = reader
+	s.reads = stmtcache.New(reader, cfg.StatementCacheSize)
+	return s, nil
+}
+
+// configPragmas returns the DSN parameters applying cfg's pragmas to every
+// connection of the writer or, with reader set, of the read pool
+func configPragmas(cfg *Config, reader bool) ([]string, error) {
+	var params []string
+	if cfg.BusyTimeout < 0 {
+		return nil, errors.New("sqlite: BusyTimeout cannot be negative")
+	}
+	if cfg.BusyTimeout > 0 {
+		params = append(params, pragmaParam("busy_timeout", strconv.FormatInt(cfg.BusyTimeout.Milliseconds(), 10)))
+	}
+	if cfg.JournalMode != "" {
+		mode := strings.ToUpper(cfg.JournalMode)
+		if !slices.Contains(journalModes, mode) {
+			return nil, fmt.Errorf("sqlite: unknown JournalMode %q", cfg.JournalMode)
+		}
+		// The journal mode is stored in the database file, so readers
+		// pick up the mode the writer set
+		if !reader {
+			params = append(params, pragmaParam("journal_mode", mode))
+		}
+	}
+	if cfg.ForeignKeys {
+		params = append(params, pragmaParam("foreign_keys", "1"))
+	}
+	if reader {
+		params = append(params, pragmaParam("query_only", "1"))
+	}
+	return params, nil
+}
+
+// withParams appends query parameters and the driver's parameters to dsn.
+// SQLite uses the last value of a repeated URI parameter such as cache, so
+// those override dsn.
+func withParams(dsn string, params ...string) string {
+	params = append(slices.Clip(params), driverParams...)
+	if len(params) == 0 {
+		return dsn
+	}
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + strings.Join(params, "&")
+}
+
+// NewFromDSN creates a SQLite adapter from a connection string. It accepts
+// sqlite://path/to/file.db (sqlite:///abs/path.db for absolute paths),
+// sqlite://:memory: for a private in-memory database, and driver DSNs
+// such as file:app.db?mode=rwc or a plain file path.
+func NewFromDSN(ctx context.Context, dsn string) (*SQLiteAdapter, error) {
+	cfg := &Config{}
+
+	scheme, rest, ok := strings.Cut(dsn, "://")
+	ok = ok && (strings.EqualFold(scheme, "sqlite") || strings.EqualFold(scheme, "sqlite3"))
+	switch {
+	case !ok:
+		cfg.DataSourceName = dsn
+	case rest == ":memory:":
+		cfg.InMemory = true
+	case rest == "":
+		return nil, errors.New("sqlite: connection URL has no database path")
+	default:
+		cfg.DataSourceName = "file:" + rest
+		if !strings.Contains(rest, "?") {
+			cfg.DataSourceName += "?cache=shared&mode=rwc"
+		}
+	}
+
+	return New(ctx, cfg)
+}
+
+// inMemoryDSN returns a DSN for a uniquely named shared-cache in-memory database
+func inMemoryDSN() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate database name: %w", err)
+	}
+	return fmt.Sprintf("file:beaconauth-%s?mode=memory&cache=shared", hex.EncodeToString(b)), nil
+}
+
+// Snapshot returns a serialized copy of the entire database.
+// The result can be passed to Restore to roll the database back,
+// e.g. between tests or when resetting a preview environment.
+func (s *SQLiteAdapter) Snapshot(ctx context.Context) ([]byte, error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	var snapshot []byte
+	err = conn.Raw(func(driverConn interface{}) error {
+		snapshot, err = serialize(driverConn)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot database: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+// Restore replaces the contents of the database with a snapshot taken by Snapshot
+func (s *SQLiteAdapter) Restore(ctx context.Context, snapshot []byte) error {
+	// The backup API needs a database to copy from, so the snapshot is
+	// staged in a temporary file and copied page by page into the
+	// adapter's own connection. This keeps in-memory databases attached
+	// to their shared cache.
+	f, err := os.CreateTemp("", "beaconauth-snapshot-*.db")
+	if err != nil {
+		return fmt.Errorf("failed to stage snapshot: %w", err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	if _, err := f.Write(snapshot); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to stage snapshot: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to stage snapshot: %w", err)
+	}
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	err = conn.Raw(func(driverConn interface{}) error {
+		return restoreFile(driverConn, f.Name())
+	})
+	if err != nil {
+		return fmt.Errorf("failed to restore snapshot: %w", err)
+	}
+
+	// The snapshot may hold a different schema than the cached statements
+	s.stmts.Reset()
+	if s.reader != nil {
+		s.reads.Reset()
+	}
+	return nil
+}
+
+// Exec runs a raw SQL statement, e.g. one statement of a schema script
+// generated by `beacon schema`
+func (s *SQLiteAdapter) Exec(ctx context.Context, query string, args ...interface{}) error {
+	_, err := s.db.ExecContext(ctx, query, args...)
+	return err
 }
 
 func (s *SQLiteAdapter) ID() string {
 	return "sqlite"
 }
 
+// Capabilities reports the optional features supported by the adapter
+func (s *SQLiteAdapter) Capabilities() core.Capabilities {
+	// Rows are read back after writes. LIKE is case-insensitive for ASCII.
+	return core.Capabilities{
+		ReturningSupported:    false,
+		JoinSupported:         false,
+		JSONSupported:         true,
+		TransactionsSupported: true,
+		CaseInsensitiveLike:   true,
+	}
+}
+
 func (s *SQLiteAdapter) Create(ctx context.Context, model string, data map[string]interface{}) (map[string]interface{}, error) {
-	return create(ctx, s.db, model, data, s)
+	return translate(create(ctx, s.stmts, model, data))
 }
 
 func (s *SQLiteAdapter) FindOne(ctx context.Context, query *core.Query) (map[string]interface{}, error) {
-	return findOne(ctx, s.db, query)
+	return translate(findOne(ctx, s.reads, query))
 }
 
 func (s *SQLiteAdapter) FindMany(ctx context.Context, query *core.Query) ([]map[string]interface{}, error) {
-	return findMany(ctx, s.db, query)
+	return translate(findMany(ctx, s.reads, query))
 }
 
 func (s *SQLiteAdapter) Update(ctx context.Context, query *core.Query, data map[string]interface{}) (map[string]interface{}, error) {
-	return update(ctx, s.db, query, data, s)
+	return translate(update(ctx, s.stmts, query, data, s))
 }
 
 func (s *SQLiteAdapter) UpdateMany(ctx context.Context, query *core.Query, data map[string]interface{}) (int64, error) {
-	return updateMany(ctx, s.db, query, data)
+	return translate(updateMany(ctx, s.stmts, query, data))
 }
 
 func (s *SQLiteAdapter) Delete(ctx context.Context, query *core.Query) error {
-	return deleteOne(ctx, s.db, query)
+	return translateError(deleteOne(ctx, s.stmts, query))
 }
 
 func (s *SQLiteAdapter) DeleteMany(ctx context.Context, query *core.Query) (int64, error) {
-	return deleteMany(ctx, s.db, query)
+	return translate(deleteMany(ctx, s.stmts, query))
 }
 
 func (s *SQLiteAdapter) Count(ctx context.Context, query *core.Query) (int64, error) {
-	return count(ctx, s.db, query)
+	return translate(count(ctx, s.reads, query))
+}
+
+func (s *SQLiteAdapter) CreateMany(ctx context.Context, model string, data []map[string]interface{}) (int64, error) {
+	return translate(createMany(ctx, s.stmts, model, data))
+}
+
+func (s *SQLiteAdapter) Upsert(ctx context.Context, model string, conflictFields []string, data map[string]interface{}) (map[string]interface{}, error) {
+	return translate(upsert(ctx, s.stmts, model, conflictFields, data, s))
 }
 
 func (s *SQLiteAdapter) Transaction(ctx context.Context, fn func(core.Adapter) error) error {
-	tx, err := s.db.BeginTx(ctx, nil)
+	return s.TransactionWithOptions(ctx, core.TxOptions{}, fn)
+}
+
+// TransactionWithOptions runs fn in a transaction started with opts. SQLite
+// transactions are always serializable, so every isolation level is
+// accepted. Read-only transactions run with PRAGMA query_only, which makes
+// SQLite reject writes, and use the read pool when there is one.
+func (s *SQLiteAdapter) TransactionWithOptions(ctx context.Context, opts core.TxOptions, fn func(core.Adapter) error) error {
+	txOpts, err := sqltx.Options(opts)
 	if err != nil {
 		return err
 	}
 
-	txAdapter := &sqliteTransaction{
-		tx:      tx,
-		adapter: s,
+	db := s.db
+	if opts.ReadOnly && s.reader != nil {
+		db = s.reader
 	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
 
-	if err := fn(txAdapter); err != nil {
-		if rbErr := tx.Rollback(); rbErr != nil {
-			return fmt.Errorf("transaction error: %w, rollback error: %v", err, rbErr)
+	// Read pool connections are always query_only
+	if opts.ReadOnly && db == s.db {
+		if _, err := conn.ExecContext(ctx, "PRAGMA query_only = ON"); err != nil {
+			return err
 		}
-		return err
+		defer func() {
+			// The pragma outlives the transaction, so a connection that
+			// cannot be reset is discarded instead of returned to the pool
+			if _, err := conn.ExecContext(context.Background(), "PRAGMA query_only = OFF"); err != nil {
+				_ = conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+			}
+		}()
+	}
+
+	tx, err := conn.BeginTx(ctx, txOpts)
+	if err != nil {
+		return translateError(err)
 	}
 
-	return tx.Commit()
+	return translateError(sqltx.Run(tx, func() error {
+		return fn(&sqliteTransaction{tx: tx, adapter: s})
+	}))
+}
+
+// FindSessionWithUser loads an unexpired session and its user with a
+// single join
+func (s *SQLiteAdapter) FindSessionWithUser(ctx context.Context, sessionModel, userModel, token string, now time.Time) (map[string]interface{}, map[string]interface{}, error) {
+	sessions, err := quoteIdent(sessionModel)
+	if err != nil {
+		return nil, nil, err
+	}
+	users, err := quoteIdent(userModel)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := s.reads.QueryContext(ctx, sessionjoin.Query(sessions, users, "?", "?"), token, now)
+	if err != nil {
+		return nil, nil, translateError(err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	if !rows.Next() {
+		return nil, nil, translateError(rows.Err())
+	}
+
+	columns, values, err := scanValues(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sessionjoin.Split(columns, values)
 }
 
 func (s *SQLiteAdapter) Ping(ctx context.Context) error {
+	if s.reader != nil {
+		if err := s.reader.PingContext(ctx); err != nil {
+			return err
+		}
+	}
 	return s.db.PingContext(ctx)
 }
 
 func (s *SQLiteAdapter) Close() error {
+	if s.reader != nil {
+		s.reads.Close()
+		_ = s.reader.Close()
+	}
+	s.stmts.Close()
 	return s.db.Close()
 }
 
@@ -109,44 +456,60 @@ func (s *SQLiteAdapter) Close() error {
 type sqliteTransaction struct {
 	tx      *sql.Tx
 	adapter *SQLiteAdapter
+	depth   int // savepoint nesting level, 0 for the outer transaction
 }
 
 func (t *sqliteTransaction) ID() string { return "sqlite-tx" }
 
+func (t *sqliteTransaction) Capabilities() core.Capabilities { return t.adapter.Capabilities() }
+
 func (t *sqliteTransaction) Create(ctx context.Context, model string, data map[string]interface{}) (map[string]interface{}, error) {
-	return create(ctx, t.tx, model, data, t)
+	return translate(create(ctx, t.tx, model, data))
 }
 
 func (t *sqliteTransaction) FindOne(ctx context.Context, query *core.Query) (map[string]interface{}, error) {
-	return findOne(ctx, t.tx, query)
+	return translate(findOne(ctx, t.tx, query))
 }
 
 func (t *sqliteTransaction) FindMany(ctx context.Context, query *core.Query) ([]map[string]interface{}, error) {
-	return findMany(ctx, t.tx, query)
+	return translate(findMany(ctx, t.tx, query))
 }
 
 func (t *sqliteTransaction) Update(ctx context.Context, query *core.Query, data map[string]interface{}) (map[string]interface{}, error) {
-	return update(ctx, t.tx, query, data, t)
+	return translate(update(ctx, t.tx, query, data, t))
 }
 
 func (t *sqliteTransaction) UpdateMany(ctx context.Context, query *core.Query, data map[string]interface{}) (int64, error) {
-	return updateMany(ctx, t.tx, query, data)
+	return translate(updateMany(ctx, t.tx, query, data))
 }
 
 func (t *sqliteTransaction) Delete(ctx context.Context, query *core.Query) error {
-	return deleteOne(ctx, t.tx, query)
+	return translateError(deleteOne(ctx, t.tx, query))
 }
 
 func (t *sqliteTransaction) DeleteMany(ctx context.Context, query *core.Query) (int64, error) {
-	return deleteMany(ctx, t.tx, query)
+	return translate(deleteMany(ctx, t.tx, query))
 }
 
 func (t *sqliteTransaction) Count(ctx context.Context, query *core.Query) (int64, error) {
-	return count(ctx, t.tx, query)
+	return translate(count(ctx, t.tx, query))
+}
+
+func (t *sqliteTransaction) CreateMany(ctx context.Context, model string, data []map[string]interface{}) (int64, error) {
+	return translate(createMany(ctx, t.tx, model, data))
 }
 
+func (t *sqliteTransaction) Upsert(ctx context.Context, model string, conflictFields []string, data map[string]interface{}) (map[string]interface{}, error) {
+	return translate(upsert(ctx, t.tx, model, conflictFields, data, t))
+}
+
+// Transaction runs fn in a savepoint, so an error rolls back only the work
+// done by fn
 func (t *sqliteTransaction) Transaction(ctx context.Context, fn func(core.Adapter) error) error {
-	return fn(t)
+	nested := &sqliteTransaction{tx: t.tx, adapter: t.adapter, depth: t.depth + 1}
+	return translateError(sqltx.Savepoint(ctx, t.tx, sqlident.SQLite, nested.depth, func() error {
+		return fn(nested)
+	}))
 }
 
 func (t *sqliteTransaction) Ping(ctx context.Context) error { return nil }
@@ -158,7 +521,7 @@ type queryExecuter interface {
 	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
 }
 
-func create(ctx context.Context, db queryExecuter, model string, data map[string]interface{}, finder core.Adapter) (map[string]interface{}, error) {
+func create(ctx context.Context, db queryExecuter, model string, data map[string]interface{}) (map[string]interface{}, error) {
 	if len(data) == 0 {
 		return nil, fmt.Errorf("no data provided")
 	}
@@ -173,27 +536,37 @@ func create(ctx context.Context, db queryExecuter, model string, data map[string
 		values = append(values, val)
 	}
 
+	table, err := quoteIdent(model)
+	if err != nil {
+		return nil, err
+	}
+	columnList, err := sqlident.QuoteAll(sqlident.SQLite, columns)
+	if err != nil {
+		return nil, err
+	}
+
+	// RETURNING reports the row as stored, including an id generated by
+	// the database (INTEGER PRIMARY KEY or a DEFAULT expression)
 	query := fmt.Sprintf(
-		"INSERT INTO %s (%s) VALUES (%s)",
-		model,
-		strings.Join(columns, ", "),
+		"INSERT INTO %s (%s) VALUES (%s) RETURNING *",
+		table,
+		columnList,
 		strings.Join(placeholders, ", "),
 	)
 
-	_, err := db.ExecContext(ctx, query, values...)
+	rows, err := db.QueryContext(ctx, query, values...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	if id, ok := data["id"]; ok {
-		return finder.FindOne(ctx, &core.Query{
-			Model: model,
-			Where: []core.WhereClause{
-				{Field: "id", Operator: core.OpEqual, Value: id},
-			},
-		})
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return data, nil
 	}
-	return data, nil
+	return scanRowsDynamic(rows)
 }
 
 func findOne(ctx context.Context, db queryExecuter, query *core.Query) (map[string]interface{}, error) {
@@ -248,7 +621,11 @@ func update(ctx context.Context, db queryExecuter, query *core.Query, data map[s
 	values := make([]interface{}, 0, len(data))
 
 	for col, val := range data {
-		setClauses = append(setClauses, fmt.Sprintf("%s = ?", col))
+		column, err := quoteIdent(col)
+		if err != nil {
+			return nil, err
+		}
+		setClauses = append(setClauses, fmt.Sprintf("%s = ?", column))
 		values = append(values, val)
 	}
 
@@ -258,10 +635,15 @@ func update(ctx context.Context, db queryExecuter, query *core.Query, data map[s
 	}
 	values = append(values, whereArgs...)
 
+	table, err := quoteIdent(query.Model)
+	if err != nil {
+		return nil, err
+	}
+
 	// SQLite doesn't support LIMIT in UPDATE
 	sqlStr := fmt.Sprintf(
 		"UPDATE %s SET %s%s",
-		query.Model,
+		table,
 		strings.Join(setClauses, ", "),
 		whereClause,
 	)
@@ -274,6 +656,105 @@ func update(ctx context.Context, db queryExecuter, query *core.Query, data map[s
 	return finder.FindOne(ctx, query)
 }
 
+// maxParams is SQLite's default limit on bind parameters per statement
+const maxParams = 32766
+
+func createMany(ctx context.Context, db queryExecuter, model string, data []map[string]interface{}) (int64, error) {
+	columns, err := core.BatchColumns(data)
+	if err != nil || len(data) == 0 {
+		return 0, err
+	}
+
+	table, err := quoteIdent(model)
+	if err != nil {
+		return 0, err
+	}
+	columnList, err := sqlident.QuoteAll(sqlident.SQLite, columns)
+	if err != nil {
+		return 0, err
+	}
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+
+	var created int64
+	for batch := range slices.Chunk(data, core.BatchSize(len(columns), maxParams)) {
+		rows := make([]string, len(batch))
+		values := make([]interface{}, 0, len(batch)*len(columns))
+		for i, record := range batch {
+			rows[i] = row
+			for _, col := range columns {
+				values = append(values, record[col])
+			}
+		}
+
+		sqlStr := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", table, columnList, strings.Join(rows, ", "))
+		result, err := db.ExecContext(ctx, sqlStr, values...)
+		if err != nil {
+			return created, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return created, err
+		}
+		created += n
+	}
+	return created, nil
+}
+
+func upsert(ctx context.Context, db queryExecuter, model string, conflictFields []string, data map[string]interface{}, finder core.Adapter) (map[string]interface{}, error) {
+	columns, updates, err := core.UpsertColumns(conflictFields, data)
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := quoteIdent(model)
+	if err != nil {
+		return nil, err
+	}
+	columnList, err := sqlident.QuoteAll(sqlident.SQLite, columns)
+	if err != nil {
+		return nil, err
+	}
+	conflictList, err := sqlident.QuoteAll(sqlident.SQLite, conflictFields)
+	if err != nil {
+		return nil, err
+	}
+
+	placeholders := make([]string, len(columns))
+	values := make([]interface{}, len(columns))
+	for i, col := range columns {
+		placeholders[i] = "?"
+		values[i] = data[col]
+	}
+
+	action := "DO NOTHING"
+	if len(updates) > 0 {
+		setClauses := make([]string, len(updates))
+		for i, col := range updates {
+			column, err := quoteIdent(col)
+			if err != nil {
+				return nil, err
+			}
+			setClauses[i] = fmt.Sprintf("%s = excluded.%s", column, column)
+		}
+		action = "DO UPDATE SET " + strings.Join(setClauses, ", ")
+	}
+
+	sqlStr := fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) %s",
+		table,
+		columnList,
+		strings.Join(placeholders, ", "),
+		conflictList,
+		action,
+	)
+
+	if _, err := db.ExecContext(ctx, sqlStr, values...); err != nil {
+		return nil, err
+	}
+
+	return finder.FindOne(ctx, core.ConflictQuery(model, conflictFields, data))
+}
+
 func updateMany(ctx context.Context, db queryExecuter, query *core.Query, data map[string]interface{}) (int64, error) {
 	if len(data) == 0 {
 		return 0, fmt.Errorf("no data provided")
@@ -283,7 +764,11 @@ func updateMany(ctx context.Context, db queryExecuter, query *core.Query, data m
 	values := make([]interface{}, 0, len(data))
 
 	for col, val := range data {
-		setClauses = append(setClauses, fmt.Sprintf("%s = ?", col))
+		column, err := quoteIdent(col)
+		if err != nil {
+			return 0, err
+		}
+		setClauses = append(setClauses, fmt.Sprintf("%s = ?", column))
 		values = append(values, val)
 	}
 
@@ -293,9 +778,14 @@ func updateMany(ctx context.Context, db queryExecuter, query *core.Query, data m
 	}
 	values = append(values, whereArgs...)
 
+	table, err := quoteIdent(query.Model)
+	if err != nil {
+		return 0, err
+	}
+
 	sqlStr := fmt.Sprintf(
 		"UPDATE %s SET %s%s",
-		query.Model,
+		table,
 		strings.Join(setClauses, ", "),
 		whereClause,
 	)
@@ -314,8 +804,13 @@ func deleteOne(ctx context.Context, db queryExecuter, query *core.Query) error {
 		return err
 	}
 
+	table, err := quoteIdent(query.Model)
+	if err != nil {
+		return err
+	}
+
 	// SQLite doesn't support LIMIT in DELETE (without compile flag)
-	sqlStr := fmt.Sprintf("DELETE FROM %s%s", query.Model, whereClause)
+	sqlStr := fmt.Sprintf("DELETE FROM %s%s", table, whereClause)
 	_, err = db.ExecContext(ctx, sqlStr, args...)
 	return err
 }
@@ -326,7 +821,12 @@ func deleteMany(ctx context.Context, db queryExecuter, query *core.Query) (int64
 		return 0, err
 	}
 
-	sqlStr := fmt.Sprintf("DELETE FROM %s%s", query.Model, whereClause)
+	table, err := quoteIdent(query.Model)
+	if err != nil {
+		return 0, err
+	}
+
+	sqlStr := fmt.Sprintf("DELETE FROM %s%s", table, whereClause)
 	result, err := db.ExecContext(ctx, sqlStr, args...)
 	if err != nil {
 		return 0, err
@@ -341,7 +841,12 @@ func count(ctx context.Context, db queryExecuter, query *core.Query) (int64, err
 		return 0, err
 	}
 
-	sqlStr := fmt.Sprintf("SELECT COUNT(*) FROM %s%s", query.Model, whereClause)
+	table, err := quoteIdent(query.Model)
+	if err != nil {
+		return 0, err
+	}
+
+	sqlStr := fmt.Sprintf("SELECT COUNT(*) FROM %s%s", table, whereClause)
 
 	var count int64
 	err = db.QueryRowContext(ctx, sqlStr, args...).Scan(&count)
@@ -358,7 +863,17 @@ func buildSelectQuery(query *core.Query, limit1 bool) (string, []interface{}, er
 		return "", nil, err
 	}
 
-	sqlStr := fmt.Sprintf("SELECT * FROM %s%s", query.Model, whereClause)
+	table, err := quoteIdent(query.Model)
+	if err != nil {
+		return "", nil, err
+	}
+
+	columns, err := sqlident.SelectList(sqlident.SQLite, query.Select)
+	if err != nil {
+		return "", nil, err
+	}
+
+	sqlStr := fmt.Sprintf("SELECT %s FROM %s%s", columns, table, whereClause)
 
 	if len(query.OrderBy) > 0 {
 		orderClauses := make([]string, 0, len(query.OrderBy))
@@ -367,7 +882,11 @@ func buildSelectQuery(query *core.Query, limit1 bool) (string, []interface{}, er
 			if order.Desc {
 				direction = "DESC"
 			}
-			orderClauses = append(orderClauses, fmt.Sprintf("%s %s", order.Field, direction))
+			field, err := quoteIdent(order.Field)
+			if err != nil {
+				return "", nil, err
+			}
+			orderClauses = append(orderClauses, fmt.Sprintf("%s %s", field, direction))
 		}
 		sqlStr += " ORDER BY " + strings.Join(orderClauses, ", ")
 	}
@@ -376,6 +895,9 @@ func buildSelectQuery(query *core.Query, limit1 bool) (string, []interface{}, er
 		sqlStr += " LIMIT 1"
 	} else if query.Limit > 0 {
 		sqlStr += fmt.Sprintf(" LIMIT %d", query.Limit)
+	} else if query.Offset > 0 {
+		// OFFSET is only valid after LIMIT; a negative limit means none
+		sqlStr += " LIMIT -1"
 	}
 
 	if query.Offset > 0 {
@@ -406,21 +928,26 @@ func buildWhereClause(where []core.WhereClause) (string, []interface{}, error) {
 }
 
 func buildSingleWhereClause(clause core.WhereClause) (string, []interface{}, error) {
+	field, err := quoteIdent(clause.Field)
+	if err != nil {
+		return "", nil, err
+	}
+
 	switch clause.Operator {
 	case core.OpEqual:
-		return fmt.Sprintf("%s = ?", clause.Field), []interface{}{clause.Value}, nil
+		return fmt.Sprintf("%s = ?", field), []interface{}{clause.Value}, nil
 	case core.OpNotEqual:
-		return fmt.Sprintf("%s != ?", clause.Field), []interface{}{clause.Value}, nil
+		return fmt.Sprintf("%s != ?", field), []interface{}{clause.Value}, nil
 	case core.OpGreaterThan:
-		return fmt.Sprintf("%s > ?", clause.Field), []interface{}{clause.Value}, nil
+		return fmt.Sprintf("%s > ?", field), []interface{}{clause.Value}, nil
 	case core.OpGreaterOrEqual:
-		return fmt.Sprintf("%s >= ?", clause.Field), []interface{}{clause.Value}, nil
+		return fmt.Sprintf("%s >= ?", field), []interface{}{clause.Value}, nil
 	case core.OpLessThan:
-		return fmt.Sprintf("%s < ?", clause.Field), []interface{}{clause.Value}, nil
+		return fmt.Sprintf("%s < ?", field), []interface{}{clause.Value}, nil
 	case core.OpLessOrEqual:
-		return fmt.Sprintf("%s <= ?", clause.Field), []interface{}{clause.Value}, nil
+		return fmt.Sprintf("%s <= ?", field), []interface{}{clause.Value}, nil
 	case core.OpLike:
-		return fmt.Sprintf("%s LIKE ?", clause.Field), []interface{}{clause.Value}, nil
+		return fmt.Sprintf("%s LIKE ?", field), []interface{}{clause.Value}, nil
 	case core.OpIn:
 		values, ok := clause.Value.([]interface{})
 		if !ok {
@@ -430,7 +957,7 @@ func buildSingleWhereClause(clause core.WhereClause) (string, []interface{}, err
 		for i := range values {
 			placeholders[i] = "?"
 		}
-		return fmt.Sprintf("%s IN (%s)", clause.Field, strings.Join(placeholders, ", ")), values, nil
+		return fmt.Sprintf("%s IN (%s)", field, strings.Join(placeholders, ", ")), values, nil
 	case core.OpNotIn:
 		values, ok := clause.Value.([]interface{})
 		if !ok {
@@ -440,22 +967,38 @@ func buildSingleWhereClause(clause core.WhereClause) (string, []interface{}, err
 		for i := range values {
 			placeholders[i] = "?"
 		}
-		return fmt.Sprintf("%s NOT IN (%s)", clause.Field, strings.Join(placeholders, ", ")), values, nil
+		return fmt.Sprintf("%s NOT IN (%s)", field, strings.Join(placeholders, ", ")), values, nil
 	case core.OpIsNull:
-		return fmt.Sprintf("%s IS NULL", clause.Field), nil, nil
+		return fmt.Sprintf("%s IS NULL", field), nil, nil
 	case core.OpIsNotNull:
-		return fmt.Sprintf("%s IS NOT NULL", clause.Field), nil, nil
+		return fmt.Sprintf("%s IS NOT NULL", field), nil, nil
 	default:
 		return "", nil, fmt.Errorf("unsupported operator: %v", clause.Operator)
 	}
 }
 
 func scanRowsDynamic(rows *sql.Rows) (map[string]interface{}, error) {
-	columns, err := rows.Columns()
+	columns, values, err := scanValues(rows)
 	if err != nil {
 		return nil, err
 	}
 
+	result := make(map[string]interface{})
+	for i, col := range columns {
+		result[col] = values[i]
+	}
+
+	return result, nil
+}
+
+// scanValues scans the current row into its column names and values, with
+// byte slices converted to strings
+func scanValues(rows *sql.Rows) ([]string, []interface{}, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+
 	values := make([]interface{}, len(columns))
 	valuePtrs := make([]interface{}, len(columns))
 	for i := range values {
@@ -463,18 +1006,19 @@ func scanRowsDynamic(rows *sql.Rows) (map[string]interface{}, error) {
 	}
 
 	if err := rows.Scan(valuePtrs...); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	result := make(map[string]interface{})
-	for i, col := range columns {
-		val := values[i]
+	for i, val := range values {
 		if b, ok := val.([]byte); ok {
-			result[col] = string(b)
-		} else {
-			result[col] = val
+			values[i] = string(b)
 		}
 	}
 
-	return result, nil
+	return columns, values, nil
+}
+
+// quoteIdent validates and quotes a table or column name
+func quoteIdent(name string) (string, error) {
+	return sqlident.Quote(sqlident.SQLite, name)
 }
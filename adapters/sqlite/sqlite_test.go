@@ -0,0 +1,651 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/adapter"
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+const testSchema = `
+	CREATE TABLE users (
+		id TEXT PRIMARY KEY,
+		email TEXT UNIQUE NOT NULL,
+		name TEXT,
+		email_verified BOOLEAN DEFAULT false,
+		created_at DATETIME,
+		updated_at DATETIME
+	);
+`
+
+const testSessionsSchema = `
+	CREATE TABLE sessions (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		token TEXT UNIQUE NOT NULL,
+		expires_at DATETIME NOT NULL,
+		created_at DATETIME
+	);
+`
+
+func newTestAdapter(t *testing.T) *SQLiteAdapter {
+	t.Helper()
+
+	ctx := context.Background()
+	a, err := New(ctx, &Config{InMemory: true})
+	if err != nil {
+		t.Fatalf("Failed to create adapter: %v", err)
+	}
+	t.Cleanup(func() { _ = a.Close() })
+
+	if _, err := a.db.ExecContext(ctx, testSchema); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	return a
+}
+
+// suiteSchema has the columns used by adapter.TestSuite
+const suiteSchema = `
+	DROP TABLE IF EXISTS users;
+	DROP TABLE IF EXISTS sessions;
+	CREATE TABLE users (
+		id TEXT PRIMARY KEY,
+		email TEXT UNIQUE,
+		name TEXT,
+		email_verified BOOLEAN,
+		active BOOLEAN,
+		count INTEGER,
+		created_at DATETIME,
+		updated_at DATETIME
+	);
+	CREATE TABLE sessions (
+		id TEXT PRIMARY KEY,
+		user_id TEXT,
+		count INTEGER,
+		expires_at DATETIME
+	);
+`
+
+// TestSQLiteAdapter_Suite runs the shared adapter tests. Run it with
+// -tags sqlite_cgo as well to check the go-sqlite3 driver.
+func TestSQLiteAdapter_Suite(t *testing.T) {
+	a, err := New(context.Background(), &Config{InMemory: true})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer a.Close()
+
+	suite := &adapter.TestSuite{
+		Adapter: a,
+		SetupFunc: func(t *testing.T, _ core.Adapter) {
+			if err := a.Exec(context.Background(), suiteSchema); err != nil {
+				t.Fatalf("failed to create schema: %v", err)
+			}
+		},
+	}
+	suite.RunAll(t)
+}
+
+func TestSQLiteAdapter_InMemoryIsolation(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAdapter(t)
+	b := newTestAdapter(t)
+
+	_, err := a.Create(ctx, "users", map[string]interface{}{
+		"id":         "user1",
+		"email":      "isolated@example.com",
+		"created_at": time.Now(),
+		"updated_at": time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	count, err := b.Count(ctx, &core.Query{Model: "users"})
+	if err != nil {
+		t.Fatalf("Count failed: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected adapters to be isolated, second adapter sees %d users", count)
+	}
+}
+
+func TestSQLiteAdapter_ConfigReused(t *testing.T) {
+	cfg := &Config{InMemory: true}
+	for i := 0; i < 2; i++ {
+		a, err := New(context.Background(), cfg)
+		if err != nil {
+			t.Fatalf("New() #%d error = %v", i+1, err)
+		}
+		_ = a.Close()
+	}
+	if cfg.DataSourceName != "" {
+		t.Errorf("Expected New not to modify the config, DataSourceName = %q", cfg.DataSourceName)
+	}
+}
+
+func TestSQLiteAdapter_InMemoryRejectsDSN(t *testing.T) {
+	_, err := New(context.Background(), &Config{InMemory: true, DataSourceName: "file:test.db"})
+	if err == nil {
+		t.Fatal("Expected error when combining InMemory with DataSourceName")
+	}
+}
+
+func TestSQLiteAdapter_SnapshotRestore(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAdapter(t)
+
+	create := func(id, email string) {
+		t.Helper()
+		_, err := a.Create(ctx, "users", map[string]interface{}{
+			"id":         id,
+			"email":      email,
+			"created_at": time.Now(),
+			"updated_at": time.Now(),
+		})
+		if err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+
+	create("user1", "first@example.com")
+
+	snapshot, err := a.Snapshot(ctx)
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+
+	create("user2", "second@example.com")
+
+	if err := a.Restore(ctx, snapshot); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	count, err := a.Count(ctx, &core.Query{Model: "users"})
+	if err != nil {
+		t.Fatalf("Count failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 user after restore, got %d", count)
+	}
+
+	// The adapter keeps working after a restore
+	create("user3", "third@example.com")
+
+	count, err = a.Count(ctx, &core.Query{Model: "users"})
+	if err != nil {
+		t.Fatalf("Count failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 users, got %d", count)
+	}
+}
+
+func TestNewFromDSN(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	for _, dsn := range []string{
+		"sqlite://:memory:",
+		"sqlite://" + dir + "/url.db",
+		"sqlite3://" + dir + "/url3.db?mode=rwc",
+		"file:" + dir + "/file.db?mode=rwc",
+	} {
+		a, err := NewFromDSN(ctx, dsn)
+		if err != nil {
+			t.Errorf("NewFromDSN(%q) error = %v", dsn, err)
+			continue
+		}
+		if err := a.Exec(ctx, testSchema); err != nil {
+			t.Errorf("NewFromDSN(%q): failed to create schema: %v", dsn, err)
+		}
+		_ = a.Close()
+	}
+
+	if _, err := NewFromDSN(ctx, "sqlite://"); err == nil {
+		t.Error("expected an empty path to be rejected")
+	}
+}
+
+func TestSQLiteAdapter_RejectsInvalidIdentifiers(t *testing.T) {
+	a := newTestAdapter(t)
+	ctx := context.Background()
+
+	if _, err := a.Create(ctx, "users", map[string]interface{}{
+		"id":                         "u1",
+		"email":                      "a@example.com",
+		"name) VALUES ('x','y'); --": "x",
+	}); !errors.Is(err, core.ErrInvalidIdentifier) {
+		t.Errorf("Create() error = %v, want ErrInvalidIdentifier", err)
+	}
+
+	if _, err := a.FindOne(ctx, &core.Query{
+		Model: "users",
+		Where: []core.WhereClause{{Field: "1=1 OR email", Operator: core.OpEqual, Value: "x"}},
+	}); !errors.Is(err, core.ErrInvalidIdentifier) {
+		t.Errorf("FindOne() error = %v, want ErrInvalidIdentifier", err)
+	}
+
+	if _, err := a.FindMany(ctx, &core.Query{Model: "users; DROP TABLE users"}); !errors.Is(err, core.ErrInvalidIdentifier) {
+		t.Errorf("FindMany() error = %v, want ErrInvalidIdentifier", err)
+	}
+
+	if _, err := a.FindMany(ctx, &core.Query{
+		Model:   "users",
+		OrderBy: []core.OrderBy{{Field: "(SELECT 1)"}},
+	}); !errors.Is(err, core.ErrInvalidIdentifier) {
+		t.Errorf("FindMany(order) error = %v, want ErrInvalidIdentifier", err)
+	}
+
+	// Quoted identifiers still match the unquoted schema
+	if _, err := a.Create(ctx, "users", map[string]interface{}{"id": "u1", "email": "a@example.com"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if n, err := a.Count(ctx, &core.Query{Model: "users"}); err != nil || n != 1 {
+		t.Errorf("Count() = %d, %v", n, err)
+	}
+}
+
+func TestSQLiteAdapter_Upsert(t *testing.T) {
+	a := newTestAdapter(t)
+	ctx := context.Background()
+
+	created, err := a.Upsert(ctx, "users", []string{"email"}, map[string]interface{}{
+		"id":    "u1",
+		"email": "a@example.com",
+		"name":  "Old",
+	})
+	if err != nil {
+		t.Fatalf("Upsert() insert error = %v", err)
+	}
+	if created["id"] != "u1" || created["name"] != "Old" {
+		t.Errorf("Upsert() insert = %v", created)
+	}
+
+	// Conflicting on the unique email updates the existing row
+	err = a.Transaction(ctx, func(tx core.Adapter) error {
+		updated, err := tx.Upsert(ctx, "users", []string{"email"}, map[string]interface{}{
+			"email": "a@example.com",
+			"name":  "New",
+		})
+		if err != nil {
+			return err
+		}
+		if updated["id"] != "u1" || updated["name"] != "New" {
+			t.Errorf("Upsert() update = %v", updated)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+
+	if n, err := a.Count(ctx, &core.Query{Model: "users"}); err != nil || n != 1 {
+		t.Errorf("Count() = %d, %v, want 1", n, err)
+	}
+
+	if _, err := a.Upsert(ctx, "users", []string{"email; --"}, map[string]interface{}{
+		"email; --": "x",
+	}); !errors.Is(err, core.ErrInvalidIdentifier) {
+		t.Errorf("Upsert() error = %v, want ErrInvalidIdentifier", err)
+	}
+}
+
+func TestSQLiteAdapter_CreateMany(t *testing.T) {
+	a := newTestAdapter(t)
+	ctx := context.Background()
+
+	// More records than fit in one statement are split into batches
+	n := maxParams/3 + 10
+	data := make([]map[string]interface{}, n)
+	for i := range data {
+		id := fmt.Sprintf("u%d", i)
+		data[i] = map[string]interface{}{"id": id, "email": id + "@example.com", "name": id}
+	}
+
+	created, err := a.CreateMany(ctx, "users", data)
+	if err != nil {
+		t.Fatalf("CreateMany() error = %v", err)
+	}
+	if created != int64(n) {
+		t.Errorf("CreateMany() = %d, want %d", created, n)
+	}
+	if count, err := a.Count(ctx, &core.Query{Model: "users"}); err != nil || count != int64(n) {
+		t.Errorf("Count() = %d, %v, want %d", count, err, n)
+	}
+
+	// A failing batch inside a transaction is rolled back entirely
+	err = a.Transaction(ctx, func(tx core.Adapter) error {
+		_, err := tx.CreateMany(ctx, "users", []map[string]interface{}{
+			{"id": "dup1", "email": "dup@example.com"},
+			{"id": "dup2", "email": "dup@example.com"},
+		})
+		return err
+	})
+	if err == nil {
+		t.Fatal("Transaction() expected unique constraint error")
+	}
+	if count, _ := a.Count(ctx, &core.Query{Model: "users"}); count != int64(n) {
+		t.Errorf("Count() after rollback = %d, want %d", count, n)
+	}
+}
+
+func TestSQLiteAdapter_NestedTransaction(t *testing.T) {
+	a := newTestAdapter(t)
+	ctx := context.Background()
+	errInner := errors.New("inner failed")
+
+	err := a.Transaction(ctx, func(tx core.Adapter) error {
+		if _, err := tx.Create(ctx, "users", map[string]interface{}{"id": "outer", "email": "outer@example.com"}); err != nil {
+			return err
+		}
+
+		// A failing nested transaction rolls back only its own writes
+		err := tx.Transaction(ctx, func(inner core.Adapter) error {
+			if _, err := inner.Create(ctx, "users", map[string]interface{}{"id": "inner", "email": "inner@example.com"}); err != nil {
+				return err
+			}
+			return errInner
+		})
+		if !errors.Is(err, errInner) {
+			t.Errorf("nested Transaction() error = %v, want %v", err, errInner)
+		}
+
+		return tx.Transaction(ctx, func(inner core.Adapter) error {
+			_, err := inner.Create(ctx, "users", map[string]interface{}{"id": "sibling", "email": "sibling@example.com"})
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+
+	users, err := a.FindMany(ctx, &core.Query{Model: "users", Select: []string{"id"}, OrderBy: []core.OrderBy{{Field: "id"}}})
+	if err != nil {
+		t.Fatalf("FindMany() error = %v", err)
+	}
+	if len(users) != 2 || users[0]["id"] != "outer" || users[1]["id"] != "sibling" {
+		t.Errorf("FindMany() = %v, want outer and sibling", users)
+	}
+}
+
+func TestSQLiteAdapter_TransactionWithOptions(t *testing.T) {
+	a := newTestAdapter(t)
+	ctx := context.Background()
+
+	readOnly := core.TxOptions{Isolation: core.IsolationSerializable, ReadOnly: true}
+	err := a.TransactionWithOptions(ctx, readOnly, func(tx core.Adapter) error {
+		if _, err := tx.Count(ctx, &core.Query{Model: "users"}); err != nil {
+			return err
+		}
+		_, err := tx.Create(ctx, "users", map[string]interface{}{"id": "u1", "email": "a@example.com"})
+		return err
+	})
+	if err == nil {
+		t.Fatal("TransactionWithOptions() expected read-only transaction to reject writes")
+	}
+
+	// The connection is writable again once the read-only transaction ends
+	if _, err := a.Create(ctx, "users", map[string]interface{}{"id": "u1", "email": "a@example.com"}); err != nil {
+		t.Fatalf("Create() after read-only transaction error = %v", err)
+	}
+
+	err = a.TransactionWithOptions(ctx, core.TxOptions{Isolation: core.IsolationLevel(99)}, func(core.Adapter) error {
+		return nil
+	})
+	if !errors.Is(err, core.ErrTxOptionsUnsupported) {
+		t.Errorf("TransactionWithOptions() error = %v, want ErrTxOptionsUnsupported", err)
+	}
+}
+
+func TestSQLiteAdapter_Select(t *testing.T) {
+	a := newTestAdapter(t)
+	ctx := context.Background()
+
+	if _, err := a.Create(ctx, "users", map[string]interface{}{"id": "u1", "email": "a@example.com", "name": "A"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	result, err := a.FindOne(ctx, &core.Query{Model: "users", Select: []string{"id", "email"}})
+	if err != nil {
+		t.Fatalf("FindOne() error = %v", err)
+	}
+	if len(result) != 2 || result["email"] != "a@example.com" {
+		t.Errorf("FindOne() = %v, want only id and email", result)
+	}
+
+	if _, err := a.FindMany(ctx, &core.Query{Model: "users", Select: []string{"*"}}); !errors.Is(err, core.ErrInvalidIdentifier) {
+		t.Errorf("FindMany() error = %v, want ErrInvalidIdentifier", err)
+	}
+}
+
+func TestSQLiteAdapter_FindSessionWithUser(t *testing.T) {
+	a := newTestAdapter(t)
+	ctx := context.Background()
+
+	if _, err := a.db.ExecContext(ctx, testSessionsSchema); err != nil {
+		t.Fatalf("Failed to create sessions table: %v", err)
+	}
+
+	now := time.Now()
+	mustCreate := func(model string, data map[string]interface{}) {
+		t.Helper()
+		if _, err := a.Create(ctx, model, data); err != nil {
+			t.Fatalf("Create(%s) error = %v", model, err)
+		}
+	}
+	mustCreate("users", map[string]interface{}{"id": "u1", "email": "a@example.com", "name": "A", "created_at": now})
+	mustCreate("sessions", map[string]interface{}{"id": "s1", "user_id": "u1", "token": "live", "expires_at": now.Add(time.Hour), "created_at": now})
+	mustCreate("sessions", map[string]interface{}{"id": "s2", "user_id": "u1", "token": "expired", "expires_at": now.Add(-time.Hour)})
+	mustCreate("sessions", map[string]interface{}{"id": "s3", "user_id": "gone", "token": "orphan", "expires_at": now.Add(time.Hour)})
+
+	session, user, err := a.FindSessionWithUser(ctx, "sessions", "users", "live", now)
+	if err != nil {
+		t.Fatalf("FindSessionWithUser() error = %v", err)
+	}
+	if session["id"] != "s1" || session["token"] != "live" {
+		t.Errorf("session = %v", session)
+	}
+	if user["id"] != "u1" || user["email"] != "a@example.com" {
+		t.Errorf("user = %v", user)
+	}
+
+	if session, _, err := a.FindSessionWithUser(ctx, "sessions", "users", "expired", now); err != nil || session != nil {
+		t.Errorf("expired session = %v, %v, want nil", session, err)
+	}
+
+	session, user, err = a.FindSessionWithUser(ctx, "sessions", "users", "orphan", now)
+	if err != nil || session["id"] != "s3" || user != nil {
+		t.Errorf("orphaned session = %v, %v, %v, want session without user", session, user, err)
+	}
+}
+
+func BenchmarkSQLiteAdapter_FindOneSession(b *testing.B) {
+	for _, bc := range []struct {
+		name      string
+		cacheSize int
+	}{
+		{"Cached", 0},
+		{"Uncached", -1},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			ctx := context.Background()
+			a, err := New(ctx, &Config{InMemory: true, StatementCacheSize: bc.cacheSize})
+			if err != nil {
+				b.Fatalf("Failed to create adapter: %v", err)
+			}
+			defer func() { _ = a.Close() }()
+
+			if _, err := a.db.ExecContext(ctx, testSessionsSchema); err != nil {
+				b.Fatalf("Failed to create schema: %v", err)
+			}
+			for i := 0; i < 1000; i++ {
+				if _, err := a.Create(ctx, "sessions", map[string]interface{}{
+					"id":         fmt.Sprintf("s%d", i),
+					"user_id":    "u1",
+					"token":      fmt.Sprintf("token-%d", i),
+					"expires_at": time.Now().Add(time.Hour),
+				}); err != nil {
+					b.Fatalf("Create() error = %v", err)
+				}
+			}
+
+			query := &core.Query{
+				Model: "sessions",
+				Where: []core.WhereClause{
+					{Field: "token", Operator: core.OpEqual, Value: "token-500"},
+					{Field: "expires_at", Operator: core.OpGreaterThan, Value: time.Now()},
+				},
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := a.FindOne(ctx, query); err != nil {
+					b.Fatalf("FindOne() error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestSQLiteAdapter_ReadPool(t *testing.T) {
+	ctx := context.Background()
+	a, err := New(ctx, &Config{
+		DataSourceName: "file:" + t.TempDir() + "/pool.db?mode=rwc",
+		JournalMode:    "wal",
+		BusyTimeout:    time.Second,
+		ForeignKeys:    true,
+		ReadConns:      4,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer a.Close()
+
+	for pragma, want := range map[string]string{"journal_mode": "wal", "busy_timeout": "1000", "foreign_keys": "1"} {
+		var got string
+		if err := a.reader.QueryRowContext(ctx, "PRAGMA "+pragma).Scan(&got); err != nil || got != want {
+			t.Errorf("PRAGMA %s = %q, %v, want %q", pragma, got, err, want)
+		}
+	}
+
+	if err := a.Exec(ctx, testSchema); err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+	if _, err := a.Create(ctx, "users", map[string]interface{}{"id": "u1", "email": "a@example.com"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	// Reads do not wait for the writer connection, which the open
+	// transaction holds, and see the last committed state
+	err = a.Transaction(ctx, func(tx core.Adapter) error {
+		if _, err := tx.Create(ctx, "users", map[string]interface{}{"id": "u2", "email": "b@example.com"}); err != nil {
+			return err
+		}
+		count, err := a.Count(ctx, &core.Query{Model: "users"})
+		if err != nil {
+			return err
+		}
+		if count != 1 {
+			t.Errorf("Count() during write transaction = %d, want 1", count)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+	if count, _ := a.Count(ctx, &core.Query{Model: "users"}); count != 2 {
+		t.Errorf("Count() after commit = %d, want 2", count)
+	}
+
+	// Read-only transactions run on the read pool
+	err = a.TransactionWithOptions(ctx, core.TxOptions{ReadOnly: true}, func(tx core.Adapter) error {
+		_, err := tx.Create(ctx, "users", map[string]interface{}{"id": "u3", "email": "c@example.com"})
+		return err
+	})
+	if err == nil {
+		t.Error("TransactionWithOptions() expected read-only transaction to reject writes")
+	}
+}
+
+func TestSQLiteAdapter_ConfigValidation(t *testing.T) {
+	ctx := context.Background()
+	for name, cfg := range map[string]*Config{
+		"read pool in memory": {InMemory: true, ReadConns: 2},
+		"negative ReadConns":  {DataSourceName: "file:" + t.TempDir() + "/a.db", ReadConns: -1},
+		"unknown JournalMode": {InMemory: true, JournalMode: "fast"},
+		"negative timeout":    {InMemory: true, BusyTimeout: -time.Second},
+	} {
+		if a, err := New(ctx, cfg); err == nil {
+			_ = a.Close()
+			t.Errorf("%s: New() expected error", name)
+		}
+	}
+}
+
+func TestSQLiteAdapter_DatabaseGeneratedIDs(t *testing.T) {
+	ctx := context.Background()
+	a, err := New(ctx, &Config{InMemory: true})
+	if err != nil {
+		t.Fatalf("Failed to create adapter: %v", err)
+	}
+	t.Cleanup(func() { _ = a.Close() })
+
+	_, err = a.db.ExecContext(ctx, `
+		CREATE TABLE users (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			email TEXT UNIQUE NOT NULL,
+			name TEXT,
+			email_verified BOOLEAN DEFAULT false,
+			created_at DATETIME,
+			updated_at DATETIME
+		);
+		CREATE TABLE accounts (
+			id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+			user_id INTEGER NOT NULL,
+			account_id TEXT NOT NULL,
+			provider_id TEXT NOT NULL,
+			provider_type TEXT NOT NULL,
+			created_at DATETIME,
+			updated_at DATETIME
+		);
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	internal := adapter.NewInternalAdapter(a, &adapter.InternalAdapterConfig{IDStrategy: adapter.IDStrategyDatabase})
+	first, err := internal.CreateUser(ctx, "first@example.com", "First")
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	second, err := internal.CreateUser(ctx, "second@example.com", "Second")
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	if first.ID != "1" || second.ID != "2" || second.Email != "second@example.com" {
+		t.Errorf("Expected serial IDs 1 and 2, got %q and %q", first.ID, second.ID)
+	}
+
+	found, err := internal.FindUserByID(ctx, second.ID)
+	if err != nil || found.Email != "second@example.com" {
+		t.Errorf("FindUserByID(%q) = %v, %v", second.ID, found, err)
+	}
+
+	account, err := internal.CreateAccount(ctx, first.ID, "github", "gh-1")
+	if err != nil {
+		t.Fatalf("CreateAccount() error = %v", err)
+	}
+	if len(account.ID) != 32 {
+		t.Errorf("Expected the DEFAULT expression's id, got %q", account.ID)
+	}
+
+	if _, err := internal.CreateUser(ctx, "first@example.com", "Again"); !errors.Is(err, core.ErrDuplicate) {
+		t.Errorf("CreateUser() duplicate error = %v, want ErrDuplicate", err)
+	}
+}
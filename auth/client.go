@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// ClientConfig is the public configuration served by GET
+// /auth/client-config, so single-page apps can render their sign-in forms
+// without duplicating server settings
+type ClientConfig struct {
+	SignupEnabled             bool           `json:"signupEnabled"`
+	EmailVerificationRequired bool           `json:"emailVerificationRequired"`
+	PasswordPolicy            PasswordPolicy `json:"passwordPolicy"`
+
+	// Providers lists the IDs of the enabled OAuth providers
+	Providers []string `json:"providers"`
+}
+
+// PasswordPolicy describes the passwords sign-up accepts
+type PasswordPolicy struct {
+	MinLength int `json:"minLength"`
+}
+
+// ClientConfig serves the public configuration of the handler. It holds
+// no secrets and may be requested without a session.
+func (h *Handler) ClientConfig(w http.ResponseWriter, r *http.Request) {
+	providers := h.config.Providers
+	if providers == nil {
+		providers = []string{}
+	}
+
+	h.writeCachedJSON(w, r, "no-cache", &ClientConfig{
+		SignupEnabled:             h.config.AllowSignup,
+		EmailVerificationRequired: h.config.RequireVerification || h.config.DoubleOptIn,
+		PasswordPolicy:            PasswordPolicy{MinLength: h.config.MinPasswordLength},
+		Providers:                 providers,
+	})
+}
+
+// writeCachedJSON writes data with an ETag of its encoding, answering 304
+// Not Modified when the request's If-None-Match carries the same tag, so
+// clients polling unchanged data receive no body
+func (h *Handler) writeCachedJSON(w http.ResponseWriter, r *http.Request, cacheControl string, data interface{}) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		h.writeJSON(w, http.StatusOK, data)
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Add("Vary", "Cookie")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(append(body, '\n'))
+}
+
+// etagMatches reports whether an If-None-Match header lists etag. Weak
+// tags match their strong form, as If-None-Match uses weak comparison.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
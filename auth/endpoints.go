@@ -0,0 +1,38 @@
+package auth
+
+import "net/http"
+
+// Endpoint describes an authentication route independently of any router.
+// Framework integrations register every endpoint returned by
+// Handler.Endpoints instead of listing routes themselves, so new endpoints
+// are available in all integrations at once.
+type Endpoint struct {
+	// Name is a stable identifier, e.g. "signin"
+	Name string
+
+	// Method is the HTTP method, e.g. http.MethodPost
+	Method string
+
+	// Path is the route path, e.g. "/auth/signin"
+	Path string
+
+	// Handler serves the endpoint. It expects the current session, if any,
+	// in the request context (see core.WithSession).
+	Handler http.HandlerFunc
+}
+
+// Endpoints returns the authentication endpoints served by the handler
+func (h *Handler) Endpoints() []Endpoint {
+	endpoints := []Endpoint{
+		{Name: "signup", Method: http.MethodPost, Path: "/auth/signup", Handler: h.SignUp},
+		{Name: "signin", Method: http.MethodPost, Path: "/auth/signin", Handler: h.SignIn},
+		{Name: "signout", Method: http.MethodPost, Path: "/auth/signout", Handler: h.SignOut},
+		{Name: "session", Method: http.MethodGet, Path: "/auth/session", Handler: h.GetSession},
+		{Name: "client-config", Method: http.MethodGet, Path: "/auth/client-config", Handler: h.ClientConfig},
+	}
+	// Only double opt-in sends links, so only it confirms them
+	if h.config.DoubleOptIn {
+		endpoints = append(endpoints, Endpoint{Name: "verify-email", Method: http.MethodPost, Path: "/auth/verify-email", Handler: h.VerifyEmail})
+	}
+	return endpoints
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// decodeRequest reads a sign-up or sign-in request from a JSON body or an
+// HTML form post. JSON bodies must be sent as application/json, which
+// browsers only send cross-site after a CORS preflight; form posts must
+// come from the app's own pages (see core.FormOriginAllowed). It writes the
+// error response and returns false when the request cannot be read.
+func (h *Handler) decodeRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if !core.IsFormPost(r) {
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+			h.writeError(w, r, http.StatusUnsupportedMediaType, core.CodeInvalidRequest, "Content-Type must be application/json or a form")
+			return false
+		}
+		if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+			h.writeError(w, r, http.StatusBadRequest, core.CodeInvalidRequest, "Invalid request body")
+			return false
+		}
+		return true
+	}
+
+	if !core.FormOriginAllowed(r, h.config.RedirectOrigins) {
+		h.writeError(w, r, http.StatusForbidden, core.CodeForbidden, "Form posts from other sites are not allowed")
+		return false
+	}
+	if err := r.ParseForm(); err != nil {
+		h.writeError(w, r, http.StatusBadRequest, core.CodeInvalidRequest, "Invalid request body")
+		return false
+	}
+
+	form := r.PostForm
+	switch req := v.(type) {
+	case *SignUpRequest:
+		req.Email = form.Get("email")
+		req.Password = form.Get("password")
+		req.Name = form.Get("name")
+		req.CallbackURL = form.Get("callbackURL")
+	case *SignInRequest:
+		req.Email = form.Get("email")
+		req.Password = form.Get("password")
+		req.CallbackURL = form.Get("callbackURL")
+		if value := form.Get("rememberMe"); value != "" {
+			// Checkboxes post "on" unless they have a value
+			remember := value == "true" || value == "on"
+			req.RememberMe = &remember
+		}
+	}
+	return true
+}
+
+// callbackURL checks a request's callbackURL against the allowed redirect
+// origins. It writes the error response and returns false when the URL is
+// not allowed.
+func (h *Handler) callbackURL(w http.ResponseWriter, r *http.Request, target string) (string, bool) {
+	if target == "" {
+		return "", true
+	}
+	if safe := core.SafeRedirect(target, "", h.config.RedirectOrigins); safe != "" {
+		return safe, true
+	}
+	h.writeError(w, r, http.StatusBadRequest, core.CodeValidation, "callbackURL is not allowed",
+		core.FieldError{Field: "callbackURL", Code: "not_allowed", Message: "callbackURL must be a local path or on an allowed origin"})
+	return "", false
+}
+
+// writeAuthResponse answers a sign-up or sign-in. Form posts with a
+// callbackURL are redirected to it with 302 Found; everything else gets
+// the JSON response, carrying the URL for API clients to navigate to.
+func (h *Handler) writeAuthResponse(w http.ResponseWriter, r *http.Request, status int, resp *AuthResponse) {
+	if resp.URL != "" && core.IsFormPost(r) {
+		http.Redirect(w, r, resp.URL, http.StatusFound)
+		return
+	}
+	h.writeJSON(w, status, resp)
+}
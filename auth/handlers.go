@@ -3,6 +3,7 @@ package auth
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -11,6 +12,7 @@ import (
 	"github.com/marshallshelly/beacon-auth/core"
 	"github.com/marshallshelly/beacon-auth/crypto"
 	"github.com/marshallshelly/beacon-auth/session"
+	"github.com/marshallshelly/beacon-auth/tokens"
 )
 
 // Handler provides HTTP handlers for authentication
@@ -18,6 +20,7 @@ type Handler struct {
 	internal       *adapter.InternalAdapter
 	sessionManager *session.Manager
 	hasher         crypto.PasswordHasher
+	dummy          *crypto.DummyVerifier
 	config         *Config
 }
 
@@ -26,6 +29,56 @@ type Config struct {
 	MinPasswordLength   int
 	RequireVerification bool
 	AllowSignup         bool
+
+	// DoubleOptIn makes sign-up create the user unverified and without a
+	// session. The user is emailed a link to VerifyEmailURL and cannot
+	// sign in with their password until its token is posted to
+	// /auth/verify-email. It needs Mailer and Localizer.
+	DoubleOptIn bool
+
+	// Mailer sends double opt-in confirmation emails
+	Mailer core.Mailer
+
+	// VerifyEmailURL is the page opened by confirmation links, which gets
+	// the token in its token query parameter
+	VerifyEmailURL string
+
+	// AppName is shown in emails
+	AppName string
+
+	// TableNames overrides the default table names (nil keeps the defaults)
+	TableNames *core.TableNames
+
+	// PasswordHasher hashes and verifies passwords (nil = Argon2id with
+	// the default parameters). Wrap it with crypto.NewLimitedHasher to
+	// bound concurrent hashing.
+	PasswordHasher crypto.PasswordHasher
+
+	// UserStore keeps users outside the database (nil = the users table).
+	// Pass the same store to the session manager's config.
+	UserStore core.UserStore
+
+	// SecurityEvents receives failed sign-ins (nil = disabled)
+	SecurityEvents core.SecurityEventSink
+
+	// Lifecycle hooks run after sign-ups and sign-ins (nil = none)
+	Lifecycle *core.LifecycleHooks
+
+	// Events receives sign-up and sign-in events (nil = none)
+	Events *core.EventBus
+
+	// Localizer translates error responses into the request's locale
+	// (nil = English only)
+	Localizer core.Localizer
+
+	// Providers lists the IDs of the enabled OAuth providers in the
+	// client configuration (see ClientConfig)
+	Providers []string
+
+	// RedirectOrigins lists the origins a callbackURL may point to.
+	// Local paths are always allowed. Form posts from these origins are
+	// accepted too.
+	RedirectOrigins []string
 }
 
 // NewHandler creates a new authentication handler
@@ -38,10 +91,15 @@ func NewHandler(dbAdapter core.Adapter, sessionManager *session.Manager, config
 		}
 	}
 
+	hasher := config.PasswordHasher
+	if hasher == nil {
+		hasher = crypto.NewDefaultHasher()
+	}
 	return &Handler{
-		internal:       adapter.NewInternalAdapter(dbAdapter, nil),
+		internal:       adapter.NewInternalAdapter(dbAdapter, &adapter.InternalAdapterConfig{TableNames: config.TableNames, UserStore: config.UserStore}),
 		sessionManager: sessionManager,
-		hasher:         crypto.NewArgon2Hasher(),
+		hasher:         hasher,
+		dummy:          crypto.NewDummyVerifier(hasher),
 		config:         config,
 	}
 }
@@ -51,12 +109,25 @@ type SignUpRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 	Name     string `json:"name,omitempty"`
+
+	// CallbackURL is where to send the user once signed up (see
+	// Config.RedirectOrigins)
+	CallbackURL string `json:"callbackURL,omitempty"`
 }
 
 // SignInRequest represents a sign in request
 type SignInRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+
+	// RememberMe set to false signs in for the browser session only: the
+	// session gets the short lifetime and a session cookie. Omitted means
+	// true.
+	RememberMe *bool `json:"rememberMe,omitempty"`
+
+	// CallbackURL is where to send the user once signed in (see
+	// Config.RedirectOrigins)
+	CallbackURL string `json:"callbackURL,omitempty"`
 }
 
 // AuthResponse represents an authentication response
@@ -64,169 +135,328 @@ type AuthResponse struct {
 	User    *core.User    `json:"user"`
 	Session *core.Session `json:"session,omitempty"`
 	Token   string        `json:"token,omitempty"`
+
+	// URL is the request's callbackURL, for the client to navigate to
+	URL string `json:"url,omitempty"`
 }
 
-// ErrorResponse represents an error response
-type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message"`
+// TwoFactorResponse answers a correct password of a user with two-factor
+// authentication enabled. The user signs in by posting the token and their
+// code to the two-factor plugin's /2fa/verify endpoint.
+type TwoFactorResponse struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	TwoFactorToken    string `json:"twoFactorToken"`
 }
 
+// ErrorResponse represents an error response. See core.WriteError.
+type ErrorResponse = core.ErrorResponse
+
 // SignUp handles user registration
 func (h *Handler) SignUp(w http.ResponseWriter, r *http.Request) {
 	if !h.config.AllowSignup {
-		h.writeError(w, http.StatusForbidden, "signup_disabled", "Sign up is disabled")
+		h.writeError(w, r, http.StatusForbidden, core.CodeSignupDisabled, "Sign up is disabled")
 		return
 	}
 
 	var req SignUpRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeError(w, http.StatusBadRequest, "invalid_request", "Invalid request body")
+	if !h.decodeRequest(w, r, &req) {
 		return
 	}
 
 	// Validate input
-	if err := h.validateSignUpRequest(&req); err != nil {
-		h.writeError(w, http.StatusBadRequest, "validation_error", err.Error())
+	if invalid := h.validateSignUpRequest(&req); invalid != nil {
+		h.writeError(w, r, http.StatusBadRequest, core.CodeValidation, invalid.Message, *invalid)
+		return
+	}
+	callbackURL, ok := h.callbackURL(w, r, req.CallbackURL)
+	if !ok {
+		return
+	}
+	if h.config.DoubleOptIn && !h.confirmationConfigured() {
+		h.writeError(w, r, http.StatusInternalServerError, core.CodeInternal, "Sign-up confirmation is not configured")
 		return
 	}
 
 	ctx := r.Context()
 
-	// Check if user already exists
+	// Reject known emails before hashing the password. The unique index
+	// below still catches addresses registered concurrently.
 	existingUser, err := h.internal.FindUserByEmail(ctx, req.Email)
-	if err != nil && err != core.ErrUserNotFound {
-		h.writeError(w, http.StatusInternalServerError, "database_error", "Failed to check existing user")
+	if err != nil && !errors.Is(err, core.ErrUserNotFound) {
+		h.writeError(w, r, http.StatusInternalServerError, core.CodeDatabaseError, "Failed to check existing user")
 		return
 	}
-
 	if existingUser != nil {
-		h.writeError(w, http.StatusConflict, "user_exists", "User with this email already exists")
+		h.writeError(w, r, http.StatusConflict, core.CodeUserExists, "User with this email already exists")
 		return
 	}
 
 	// Hash password
 	hashedPassword, err := h.hasher.Hash(req.Password)
+	if errors.Is(err, crypto.ErrHasherBusy) {
+		h.writeBusyError(w, r)
+		return
+	}
 	if err != nil {
-		h.writeError(w, http.StatusInternalServerError, "hash_error", "Failed to hash password")
+		h.writeError(w, r, http.StatusInternalServerError, core.CodeHashError, "Failed to hash password")
 		return
 	}
 
-	// Create user with hashed password
-	user, err := h.createUserWithPassword(ctx, req.Email, req.Name, hashedPassword)
-	if err != nil {
-		h.writeError(w, http.StatusInternalServerError, "create_error", "Failed to create user")
+	if h.config.DoubleOptIn {
+		h.signUpUnconfirmed(w, r, &req, hashedPassword)
 		return
 	}
 
-	// Create session
-	session, _, token, err := h.sessionManager.Create(ctx, user.ID, &core.SessionOptions{
-		User:      user, // Pass pre-fetched user to avoid redundant lookup
-		IPAddress: getIPAddress(r),
-		UserAgent: r.UserAgent(),
+	// Create the user, credential account and session in one transaction,
+	// so a failure midway leaves no user behind. The unique index on email
+	// rejects an address registered by a concurrent request since the
+	// check above.
+	var (
+		user       *core.User
+		session    *core.Session
+		token      string
+		sessionErr error
+	)
+	err = h.internal.WithTransaction(ctx, func(tx *adapter.InternalAdapter) error {
+		var err error
+		user, err = createUserWithPassword(ctx, tx, req.Email, req.Name, hashedPassword)
+		if err != nil {
+			return err
+		}
+
+		session, _, token, sessionErr = h.sessionManager.Create(ctx, user.ID, &core.SessionOptions{
+			User:      user, // Pass pre-fetched user to avoid redundant lookup
+			IPAddress: h.clientInfo(r).IPAddress,
+			UserAgent: r.UserAgent(),
+			Tx:        tx.Adapter(),
+		})
+		return sessionErr
 	})
-	if err != nil {
-		h.writeError(w, http.StatusInternalServerError, "session_error", "Failed to create session")
+	if err != nil && session != nil {
+		// The commit failed after the session reached the cache stores
+		_ = h.sessionManager.Delete(ctx, token)
+	}
+	switch {
+	case errors.Is(err, core.ErrDuplicate):
+		h.writeError(w, r, http.StatusConflict, core.CodeUserExists, "User with this email already exists")
+		return
+	case sessionErr != nil:
+		h.writeError(w, r, http.StatusInternalServerError, core.CodeSessionError, "Failed to create session")
+		return
+	case err != nil:
+		h.writeError(w, r, http.StatusInternalServerError, core.CodeCreateError, "Failed to create user")
 		return
 	}
 
+	// Never carry a session from before authentication over to the new one
+	h.revokeRequestSession(r)
+
+	h.userCreated(r, user)
+	h.signedIn(r, user, session)
+
 	// Set session cookie
-	h.setSessionCookie(w, token, session.ExpiresAt)
+	h.setSessionCookie(w, r, token, session.ExpiresAt)
 
 	// Send response
-	h.writeJSON(w, http.StatusCreated, &AuthResponse{
+	h.writeAuthResponse(w, r, http.StatusCreated, &AuthResponse{
 		User:    user,
 		Session: session,
 		Token:   token,
+		URL:     callbackURL,
 	})
 }
 
+// signUpUnconfirmed creates a double opt-in user without a session and
+// emails them the confirmation link
+func (h *Handler) signUpUnconfirmed(w http.ResponseWriter, r *http.Request, req *SignUpRequest, hashedPassword string) {
+	var user *core.User
+	err := h.internal.WithTransaction(r.Context(), func(tx *adapter.InternalAdapter) error {
+		var err error
+		user, err = createUserWithPassword(r.Context(), tx, req.Email, req.Name, hashedPassword)
+		return err
+	})
+	switch {
+	case errors.Is(err, core.ErrDuplicate):
+		h.writeError(w, r, http.StatusConflict, core.CodeUserExists, "User with this email already exists")
+		return
+	case err != nil:
+		h.writeError(w, r, http.StatusInternalServerError, core.CodeCreateError, "Failed to create user")
+		return
+	}
+	h.userCreated(r, user)
+
+	// If sending fails, the user gets a new link when they try to sign in
+	_ = h.sendLink(r, user.Email, tokens.SignupConfirmation)
+
+	w.Header().Set("Cache-Control", "no-store")
+	h.writeJSON(w, http.StatusAccepted, &ConfirmationResponse{ConfirmationRequired: true})
+}
+
 // SignIn handles user authentication
 func (h *Handler) SignIn(w http.ResponseWriter, r *http.Request) {
 	var req SignInRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeError(w, http.StatusBadRequest, "invalid_request", "Invalid request body")
+	if !h.decodeRequest(w, r, &req) {
 		return
 	}
 
 	// Validate input
 	if req.Email == "" || req.Password == "" {
-		h.writeError(w, http.StatusBadRequest, "validation_error", "Email and password are required")
+		var missing []core.FieldError
+		if req.Email == "" {
+			missing = append(missing, core.FieldError{Field: "email", Code: "required", Message: "email is required"})
+		}
+		if req.Password == "" {
+			missing = append(missing, core.FieldError{Field: "password", Code: "required", Message: "password is required"})
+		}
+		h.writeError(w, r, http.StatusBadRequest, core.CodeValidation, "Email and password are required", missing...)
+		return
+	}
+	callbackURL, ok := h.callbackURL(w, r, req.CallbackURL)
+	if !ok {
 		return
 	}
 
 	ctx := r.Context()
 
-	// Find user by email
+	// Find user by email. Unknown accounts and accounts without a password
+	// are verified against a dummy hash, so they take as long to reject as
+	// a wrong password and timing does not reveal which emails exist.
 	user, err := h.internal.FindUserByEmail(ctx, req.Email)
 	if err != nil {
 		if err == core.ErrUserNotFound {
-			h.writeError(w, http.StatusUnauthorized, "invalid_credentials", "Invalid email or password")
+			if err := h.dummy.Verify(req.Password); errors.Is(err, crypto.ErrHasherBusy) {
+				h.writeBusyError(w, r)
+				return
+			}
+			h.loginFailed(r, req.Email, "", "unknown account")
+			h.writeError(w, r, http.StatusUnauthorized, core.CodeInvalidCredentials, "Invalid email or password")
 			return
 		}
-		h.writeError(w, http.StatusInternalServerError, "database_error", "Failed to find user")
+		h.writeError(w, r, http.StatusInternalServerError, core.CodeDatabaseError, "Failed to find user")
 		return
 	}
 
 	// Get user's password hash
 	passwordHash, err := h.getUserPasswordHash(ctx, user.ID)
+	if errors.Is(err, core.ErrUserNotFound) || errors.Is(err, errNoPassword) {
+		if err := h.dummy.Verify(req.Password); errors.Is(err, crypto.ErrHasherBusy) {
+			h.writeBusyError(w, r)
+			return
+		}
+		h.loginFailed(r, req.Email, user.ID, "no password")
+		h.writeError(w, r, http.StatusUnauthorized, core.CodeInvalidCredentials, "Invalid email or password")
+		return
+	}
 	if err != nil {
-		h.writeError(w, http.StatusInternalServerError, "database_error", "Failed to retrieve credentials")
+		h.writeError(w, r, http.StatusInternalServerError, core.CodeDatabaseError, "Failed to retrieve credentials")
 		return
 	}
 
 	// Verify password
 	valid, err := h.hasher.Verify(req.Password, passwordHash)
+	if errors.Is(err, crypto.ErrHasherBusy) {
+		h.writeBusyError(w, r)
+		return
+	}
 	if err != nil || !valid {
-		h.writeError(w, http.StatusUnauthorized, "invalid_credentials", "Invalid email or password")
+		h.loginFailed(r, req.Email, user.ID, "invalid password")
+		h.writeError(w, r, http.StatusUnauthorized, core.CodeInvalidCredentials, "Invalid email or password")
+		return
+	}
+
+	// Upgrade legacy or outdated hashes now that we know the plaintext.
+	// Failures are not fatal: the old hash still verifies.
+	if rehasher, ok := h.hasher.(core.PasswordRehasher); ok && rehasher.NeedsRehash(passwordHash) {
+		if newHash, err := h.hasher.Hash(req.Password); err == nil {
+			_ = h.internal.UpdateCredentialPassword(ctx, user.ID, newHash)
+		}
+	}
+
+	// Check if email verification is required. Double opt-in users get a
+	// new link in case the first one was lost.
+	if (h.config.RequireVerification || h.config.DoubleOptIn) && !user.EmailVerified {
+		if h.config.DoubleOptIn {
+			_ = h.sendLink(r, user.Email, tokens.EmailVerification)
+		}
+		h.loginFailed(r, req.Email, user.ID, "email not verified")
+		h.writeError(w, r, http.StatusForbidden, core.CodeEmailNotVerified, "Please verify your email before signing in")
 		return
 	}
 
-	// Check if email verification is required
-	if h.config.RequireVerification && !user.EmailVerified {
-		h.writeError(w, http.StatusForbidden, "email_not_verified", "Please verify your email before signing in")
+	// Users with two-factor authentication get a session only after
+	// POST /2fa/verify with this token and their code
+	if user.TwoFactorEnabled {
+		token, err := h.internal.Tokens().BeginTwoFactor(ctx, user.ID)
+		if err != nil {
+			h.writeError(w, r, http.StatusInternalServerError, core.CodeDatabaseError, "Failed to start two-factor sign-in")
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		h.writeJSON(w, http.StatusOK, &TwoFactorResponse{TwoFactorRequired: true, TwoFactorToken: token})
 		return
 	}
 
+	// Never carry a session from before authentication over to the new one
+	h.revokeRequestSession(r)
+
 	// Create session
+	transient := req.RememberMe != nil && !*req.RememberMe
 	session, _, token, err := h.sessionManager.Create(ctx, user.ID, &core.SessionOptions{
-		User:      user, // Pass pre-fetched user to avoid redundant lookup
-		IPAddress: getIPAddress(r),
-		UserAgent: r.UserAgent(),
+		User:       user, // Pass pre-fetched user to avoid redundant lookup
+		IPAddress:  h.clientInfo(r).IPAddress,
+		UserAgent:  r.UserAgent(),
+		RememberMe: !transient,
+		Transient:  transient,
 	})
+	if errors.Is(err, core.ErrSessionLimit) {
+		h.writeError(w, r, http.StatusForbidden, core.CodeSessionLimitReached, "Maximum number of active sessions reached")
+		return
+	}
+	var ban *core.BanError
+	if errors.As(err, &ban) {
+		h.writeBanError(w, r, ban)
+		return
+	}
 	if err != nil {
-		h.writeError(w, http.StatusInternalServerError, "session_error", "Failed to create session")
+		h.writeError(w, r, http.StatusInternalServerError, core.CodeSessionError, "Failed to create session")
 		return
 	}
+	h.signedIn(r, user, session)
 
-	// Set session cookie
-	h.setSessionCookie(w, token, session.ExpiresAt)
+	// Set session cookie; transient sessions get one without an expiry,
+	// which the browser drops when it closes
+	expires := session.ExpiresAt
+	if transient {
+		expires = time.Time{}
+	}
+	h.setSessionCookie(w, r, token, expires)
 
 	// Send response
-	h.writeJSON(w, http.StatusOK, &AuthResponse{
+	h.writeAuthResponse(w, r, http.StatusOK, &AuthResponse{
 		User:    user,
 		Session: session,
 		Token:   token,
+		URL:     callbackURL,
 	})
 }
 
 // SignOut handles user logout
 func (h *Handler) SignOut(w http.ResponseWriter, r *http.Request) {
 	// Get session from cookie
-	cookie, err := r.Cookie(h.sessionManager.Config().CookieName)
+	token, err := core.ReadChunkedCookie(r, h.sessionManager.Config().CookieName)
 	if err != nil {
-		h.writeError(w, http.StatusBadRequest, "no_session", "No session found")
+		h.writeError(w, r, http.StatusBadRequest, core.CodeNoSession, "No session found")
 		return
 	}
 
 	ctx := r.Context()
 
 	// Delete the session
-	_ = h.sessionManager.Delete(ctx, cookie.Value)
+	_ = h.sessionManager.Delete(ctx, token)
 	// Ignore error as session cookie is being cleared anyway
 
 	// Clear session cookie
-	h.clearSessionCookie(w)
+	h.clearSessionCookie(w, r)
 
 	// Send response
 	h.writeJSON(w, http.StatusOK, map[string]interface{}{
@@ -235,17 +465,19 @@ func (h *Handler) SignOut(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// GetSession retrieves the current session
+// GetSession retrieves the current session. The response carries an ETag,
+// so clients polling the session get 304 Not Modified while it is
+// unchanged.
 func (h *Handler) GetSession(w http.ResponseWriter, r *http.Request) {
 	session := core.GetSession(r.Context())
 	user := core.GetUser(r.Context())
 
 	if session == nil {
-		h.writeError(w, http.StatusUnauthorized, "no_session", "No active session")
+		h.writeError(w, r, http.StatusUnauthorized, core.CodeNoSession, "No active session")
 		return
 	}
 
-	h.writeJSON(w, http.StatusOK, &AuthResponse{
+	h.writeCachedJSON(w, r, "private, no-cache", &AuthResponse{
 		User:    user,
 		Session: session,
 	})
@@ -253,36 +485,40 @@ func (h *Handler) GetSession(w http.ResponseWriter, r *http.Request) {
 
 // Helper methods
 
-func (h *Handler) validateSignUpRequest(req *SignUpRequest) error {
+func (h *Handler) validateSignUpRequest(req *SignUpRequest) *core.FieldError {
 	if req.Email == "" {
-		return fmt.Errorf("email is required")
+		return &core.FieldError{Field: "email", Code: "required", Message: "email is required"}
 	}
 
 	if req.Password == "" {
-		return fmt.Errorf("password is required")
+		return &core.FieldError{Field: "password", Code: "required", Message: "password is required"}
 	}
 
 	if len(req.Password) < h.config.MinPasswordLength {
-		return fmt.Errorf("password must be at least %d characters", h.config.MinPasswordLength)
+		return &core.FieldError{
+			Field:   "password",
+			Code:    "too_short",
+			Message: fmt.Sprintf("password must be at least %d characters", h.config.MinPasswordLength),
+		}
 	}
 
 	// Basic email validation
 	if !isValidEmail(req.Email) {
-		return fmt.Errorf("invalid email format")
+		return &core.FieldError{Field: "email", Code: "invalid_format", Message: "invalid email format"}
 	}
 
 	return nil
 }
 
-func (h *Handler) createUserWithPassword(ctx context.Context, email, name, hashedPassword string) (*core.User, error) {
-	// Create user
-	user, err := h.internal.CreateUser(ctx, email, name)
+// createUserWithPassword creates a user and its credential account
+func createUserWithPassword(ctx context.Context, internal *adapter.InternalAdapter, email, name, hashedPassword string) (*core.User, error) {
+	user, err := internal.CreateUser(ctx, email, name)
 	if err != nil {
 		return nil, err
 	}
 
 	// Create credential account using InternalAdapter (uses correct column names)
-	_, err = h.internal.CreateCredentialAccount(ctx, user.ID, email, hashedPassword)
+	_, err = internal.CreateCredentialAccount(ctx, user.ID, email, hashedPassword)
 	if err != nil {
 		return nil, err
 	}
@@ -290,34 +526,79 @@ func (h *Handler) createUserWithPassword(ctx context.Context, email, name, hashe
 	return user, nil
 }
 
+// errNoPassword is returned for credential accounts without a password
+var errNoPassword = errors.New("password hash not found")
+
 func (h *Handler) getUserPasswordHash(ctx context.Context, userID string) (string, error) {
-	query := &core.Query{
-		Model: "accounts",
-		Where: []core.WhereClause{
-			{Field: "user_id", Operator: core.OpEqual, Value: userID},
-			{Field: "provider_type", Operator: core.OpEqual, Value: "credential"},
-		},
+	account, err := h.internal.FindCredentialAccount(ctx, userID)
+	if errors.Is(err, core.ErrNotFound) {
+		return "", core.ErrUserNotFound
 	}
-
-	result, err := h.internal.Adapter().FindOne(ctx, query)
 	if err != nil {
 		return "", err
 	}
 
-	if result == nil {
-		return "", core.ErrUserNotFound
+	if account.Password == "" {
+		return "", errNoPassword
 	}
 
-	// The column name is "password", not "password_hash"
-	hash, ok := result["password"].(string)
-	if !ok {
-		return "", fmt.Errorf("password hash not found")
+	return account.Password, nil
+}
+
+// revokeRequestSession revokes the session the request arrived with, if any
+func (h *Handler) revokeRequestSession(r *http.Request) {
+	if token, err := core.ReadChunkedCookie(r, h.sessionManager.Config().CookieName); err == nil {
+		_ = h.sessionManager.Delete(r.Context(), token)
+	}
+}
+
+// loginFailed reports a rejected sign-in as a security event
+func (h *Handler) loginFailed(r *http.Request, email, userID, reason string) {
+	_ = core.EmitSecurityEvent(r.Context(), h.config.SecurityEvents, &core.SecurityEvent{
+		Type:      core.EventLoginFailed,
+		UserID:    userID,
+		Email:     email,
+		IPAddress: h.clientInfo(r).IPAddress,
+		UserAgent: r.UserAgent(),
+		Reason:    reason,
+	})
+}
+
+// userCreated runs the OnUserCreated hooks for a signed-up user and
+// publishes the event
+func (h *Handler) userCreated(r *http.Request, user *core.User) {
+	event := &core.UserCreatedEvent{
+		User:   user,
+		Method: core.MethodPassword,
+		Client: h.clientInfo(r),
+	}
+	_ = h.config.Lifecycle.UserCreated(r.Context(), event)
+	h.config.Events.Publish(r.Context(), core.TopicUserCreated, event)
+}
+
+// signedIn runs the OnSessionCreated and OnSignIn hooks for a new session
+// and publishes the events
+func (h *Handler) signedIn(r *http.Request, user *core.User, session *core.Session) {
+	client := h.clientInfo(r)
+	created := &core.SessionCreatedEvent{
+		Session: session,
+		User:    user,
+		Client:  client,
 	}
+	_ = h.config.Lifecycle.SessionCreated(r.Context(), created)
+	h.config.Events.Publish(r.Context(), core.TopicSessionCreated, created)
 
-	return hash, nil
+	signIn := &core.SignInEvent{
+		User:    user,
+		Session: session,
+		Method:  core.MethodPassword,
+		Client:  client,
+	}
+	_ = h.config.Lifecycle.SignIn(r.Context(), signIn)
+	h.config.Events.Publish(r.Context(), core.TopicSignIn, signIn)
 }
 
-func (h *Handler) setSessionCookie(w http.ResponseWriter, token string, expiresAt time.Time) {
+func (h *Handler) setSessionCookie(w http.ResponseWriter, r *http.Request, token string, expiresAt time.Time) {
 	config := h.sessionManager.Config()
 	cookie := &http.Cookie{
 		Name:     config.CookieName,
@@ -330,10 +611,10 @@ func (h *Handler) setSessionCookie(w http.ResponseWriter, token string, expiresA
 		SameSite: parseSameSite(config.CookieSameSite),
 	}
 
-	http.SetCookie(w, cookie)
+	core.SetChunkedCookie(w, r, cookie, config.CookieChunkSize)
 }
 
-func (h *Handler) clearSessionCookie(w http.ResponseWriter) {
+func (h *Handler) clearSessionCookie(w http.ResponseWriter, r *http.Request) {
 	config := h.sessionManager.Config()
 	cookie := &http.Cookie{
 		Name:     config.CookieName,
@@ -346,7 +627,7 @@ func (h *Handler) clearSessionCookie(w http.ResponseWriter) {
 		HttpOnly: config.CookieHTTPOnly,
 	}
 
-	http.SetCookie(w, cookie)
+	core.SetChunkedCookie(w, r, cookie, config.CookieChunkSize)
 }
 
 func (h *Handler) writeJSON(w http.ResponseWriter, statusCode int, data interface{}) {
@@ -359,26 +640,36 @@ func (h *Handler) writeJSON(w http.ResponseWriter, statusCode int, data interfac
 	}
 }
 
-func (h *Handler) writeError(w http.ResponseWriter, status int, code, message string) {
-	h.writeJSON(w, status, &ErrorResponse{
-		Error:   code,
-		Message: message,
-	})
+func (h *Handler) writeError(w http.ResponseWriter, r *http.Request, status int, code core.ErrorCode, message string, details ...core.FieldError) {
+	if h.config.Localizer != nil && core.RequestLocalizer(r.Context()) == nil {
+		r = r.WithContext(core.WithRequestLocalizer(r.Context(), h.config.Localizer))
+	}
+	core.WriteError(w, r, status, code, message, details...)
 }
 
-func getIPAddress(r *http.Request) string {
-	// Check X-Forwarded-For header first
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		return xff
-	}
+// writeBusyError writes the server_busy error of a saturated password
+// hasher. Unknown and known accounts fail alike, so it reveals nothing
+// about which emails exist.
+func (h *Handler) writeBusyError(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", "1")
+	h.writeError(w, r, http.StatusServiceUnavailable, core.CodeServerBusy, "Server busy, try again")
+}
 
-	// Check X-Real-IP header
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
+// writeBanError writes the account_banned error of a banned user
+func (h *Handler) writeBanError(w http.ResponseWriter, r *http.Request, ban *core.BanError) {
+	if h.config.Localizer != nil && core.RequestLocalizer(r.Context()) == nil {
+		r = r.WithContext(core.WithRequestLocalizer(r.Context(), h.config.Localizer))
 	}
+	core.WriteBanError(w, r, ban)
+}
 
-	// Fall back to RemoteAddr
-	return r.RemoteAddr
+// clientInfo identifies the client of a request, believing forwarding
+// headers only from the session manager's trusted proxies
+func (h *Handler) clientInfo(r *http.Request) core.ClientInfo {
+	if h.sessionManager == nil {
+		return core.ClientInfoFromRequest(r)
+	}
+	return h.sessionManager.ClientInfo(r)
 }
 
 func parseSameSite(s string) http.SameSite {
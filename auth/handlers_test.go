@@ -4,14 +4,24 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/marshallshelly/beacon-auth/adapters/memory"
+	"github.com/marshallshelly/beacon-auth/adapters/sqlite"
+	"github.com/marshallshelly/beacon-auth/cmd/beacon/schema"
 	"github.com/marshallshelly/beacon-auth/core"
 	"github.com/marshallshelly/beacon-auth/crypto"
+	"github.com/marshallshelly/beacon-auth/i18n"
 	"github.com/marshallshelly/beacon-auth/session"
 )
 
@@ -54,6 +64,13 @@ func setupTestHandler(t *testing.T) (*Handler, *session.Manager) {
 	return handler, sessionManager
 }
 
+// jsonRequest returns a POST of a JSON body to path
+func jsonRequest(path string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, path, body)
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
 func TestSignUp_Success(t *testing.T) {
 	handler, _ := setupTestHandler(t)
 
@@ -146,6 +163,137 @@ func TestSignUp_DuplicateUser(t *testing.T) {
 	}
 }
 
+// countingHasher counts the passwords it hashes
+type countingHasher struct {
+	crypto.PasswordHasher
+	hashed atomic.Int32
+}
+
+func (h *countingHasher) Hash(password string) (string, error) {
+	h.hashed.Add(1)
+	return h.PasswordHasher.Hash(password)
+}
+
+func TestSignUp_DuplicateSkipsHashing(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	body, _ := json.Marshal(SignUpRequest{Email: "known@example.com", Password: "secure-password-123"})
+
+	w := httptest.NewRecorder()
+	handler.SignUp(w, jsonRequest("/auth/signup", bytes.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("First signup failed: %d", w.Code)
+	}
+
+	// A known email is rejected before the password is hashed
+	hasher := &countingHasher{PasswordHasher: handler.hasher}
+	handler.hasher = hasher
+	w = httptest.NewRecorder()
+	handler.SignUp(w, jsonRequest("/auth/signup", bytes.NewReader(body)))
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d, got %d", http.StatusConflict, w.Code)
+	}
+	if n := hasher.hashed.Load(); n != 0 {
+		t.Errorf("Expected no password hash for a known email, got %d", n)
+	}
+}
+
+func TestSignUp_ConcurrentDuplicate(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+
+	body, _ := json.Marshal(SignUpRequest{
+		Email:    "race@example.com",
+		Password: "secure-password-123",
+	})
+
+	const requests = 8
+	codes := make(chan int, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := jsonRequest("/auth/signup", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+			handler.SignUp(w, req)
+			codes <- w.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	created := 0
+	for code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+		default:
+			t.Errorf("Unexpected status %d", code)
+		}
+	}
+	if created != 1 {
+		t.Errorf("Expected 1 successful signup, got %d", created)
+	}
+}
+
+// failingStore is a session store whose writes fail
+type failingStore struct{}
+
+func (failingStore) Get(ctx context.Context, token string) (*core.Session, *core.User, error) {
+	return nil, nil, nil
+}
+func (failingStore) Set(ctx context.Context, session *core.Session) error {
+	return errors.New("store unavailable")
+}
+func (failingStore) Delete(ctx context.Context, token string) error          { return nil }
+func (failingStore) DeleteByUserID(ctx context.Context, userID string) error { return nil }
+func (failingStore) Cleanup(ctx context.Context) error                       { return nil }
+func (failingStore) Close() error                                            { return nil }
+
+func TestSignUp_RollsBackOnSessionFailure(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlite.New(ctx, &sqlite.Config{InMemory: true})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	script, err := schema.GenerateSQL(&schema.Config{Adapter: "sqlite", IDType: "string"})
+	if err != nil {
+		t.Fatalf("Failed to generate schema: %v", err)
+	}
+	for _, stmt := range schema.SplitStatements(script, "sqlite") {
+		if err := db.Exec(ctx, stmt); err != nil {
+			t.Fatalf("Failed to apply schema: %v", err)
+		}
+	}
+
+	// The database session is written before the failing store
+	sessionManager, err := session.NewManager(&session.Config{
+		ExpiresIn:     time.Hour,
+		EnableDBStore: true,
+		Stores:        []session.StoreLayer{{Name: "failing", Store: failingStore{}}},
+		StoreOrder:    []string{"failing", session.StoreDB},
+	}, db)
+	if err != nil {
+		t.Fatalf("Failed to create session manager: %v", err)
+	}
+	handler := NewHandler(db, sessionManager, nil)
+
+	body, _ := json.Marshal(SignUpRequest{Email: "atomic@example.com", Password: "secure-password-123"})
+	w := httptest.NewRecorder()
+	handler.SignUp(w, jsonRequest("/auth/signup", bytes.NewReader(body)))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+	for _, table := range []string{"users", "accounts", "sessions"} {
+		if count, _ := db.Count(ctx, &core.Query{Model: table}); count != 0 {
+			t.Errorf("Expected %s to be rolled back, got %d rows", table, count)
+		}
+	}
+}
+
 func TestSignUp_ValidationErrors(t *testing.T) {
 	handler, _ := setupTestHandler(t)
 
@@ -303,6 +451,122 @@ func TestSignIn_Success(t *testing.T) {
 	}
 }
 
+func TestSignIn_RememberMe(t *testing.T) {
+	handler, manager := setupTestHandler(t)
+	manager.Config().ShortExpiresIn = time.Hour
+
+	body, _ := json.Marshal(SignUpRequest{Email: "remember@example.com", Password: "secure-password-123"})
+	w := httptest.NewRecorder()
+	handler.SignUp(w, jsonRequest("/auth/signup", bytes.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Signup failed: %d", w.Code)
+	}
+
+	for _, tt := range []struct {
+		body       string
+		lifetime   time.Duration
+		persistent bool
+	}{
+		{`{"email":"remember@example.com","password":"secure-password-123"}`, 24 * time.Hour, true},
+		{`{"email":"remember@example.com","password":"secure-password-123","rememberMe":true}`, 24 * time.Hour, true},
+		{`{"email":"remember@example.com","password":"secure-password-123","rememberMe":false}`, time.Hour, false},
+	} {
+		w := httptest.NewRecorder()
+		handler.SignIn(w, jsonRequest("/auth/signin", strings.NewReader(tt.body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", tt.body, w.Code, w.Body)
+		}
+		var resp AuthResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if got := time.Until(resp.Session.ExpiresAt); got > tt.lifetime || got < tt.lifetime-time.Minute {
+			t.Errorf("%s: session expires in %v, want %v", tt.body, got, tt.lifetime)
+		}
+
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 {
+			t.Fatalf("%s: got %d cookies, want the session cookie", tt.body, len(cookies))
+		}
+		if persistent := !cookies[0].Expires.IsZero(); persistent != tt.persistent {
+			t.Errorf("%s: persistent cookie = %v, want %v", tt.body, persistent, tt.persistent)
+		}
+	}
+}
+
+func TestSignIn_CallbackURL(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	handler.config.RedirectOrigins = []string{"https://app.example.com"}
+
+	form := url.Values{"email": {"form@example.com"}, "password": {"secure-password-123"}, "callbackURL": {"/welcome"}}
+	req := httptest.NewRequest(http.MethodPost, "http://auth.example.com/auth/signup", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Origin", "http://auth.example.com")
+	w := httptest.NewRecorder()
+	handler.SignUp(w, req)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/welcome" {
+		t.Fatalf("form sign-up: status %d, location %q, want 302 to /welcome", w.Code, w.Header().Get("Location"))
+	}
+	if len(w.Result().Cookies()) == 0 {
+		t.Error("form sign-up set no session cookie")
+	}
+
+	// API clients get the URL in the response
+	w = httptest.NewRecorder()
+	handler.SignIn(w, jsonRequest("/auth/signin",
+		strings.NewReader(`{"email":"form@example.com","password":"secure-password-123","callbackURL":"https://app.example.com/home"}`)))
+	var resp AuthResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || resp.URL != "https://app.example.com/home" || resp.Token == "" {
+		t.Errorf("JSON sign-in: status %d, %+v, want the URL and the token", w.Code, resp)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		origin string
+		url    string
+		status int
+	}{
+		{"allowed origin", "https://app.example.com", "https://app.example.com/home", http.StatusFound},
+		{"cross-site form", "https://evil.example", "/welcome", http.StatusForbidden},
+		{"disallowed callback", "http://auth.example.com", "https://evil.example/", http.StatusBadRequest},
+	} {
+		form := url.Values{"email": {"form@example.com"}, "password": {"secure-password-123"}, "callbackURL": {tt.url}}
+		req := httptest.NewRequest(http.MethodPost, "http://auth.example.com/auth/signin", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Origin", tt.origin)
+		w := httptest.NewRecorder()
+		handler.SignIn(w, req)
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, w.Code, tt.status, w.Body)
+		}
+		if tt.status != http.StatusFound && len(w.Result().Cookies()) != 0 {
+			t.Errorf("%s: session cookie set on a rejected sign-in", tt.name)
+		}
+	}
+}
+
+// Bodies browsers send cross-site without a preflight are not read as JSON
+func TestSignUp_RejectsSimpleContentTypes(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	body := `{"email":"csrf@example.com","password":"secure-password-123"}`
+
+	for _, contentType := range []string{"text/plain", ""} {
+		req := httptest.NewRequest(http.MethodPost, "/auth/signup", strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		req.Header.Set("Origin", "https://evil.example")
+		w := httptest.NewRecorder()
+		handler.SignUp(w, req)
+		if w.Code != http.StatusUnsupportedMediaType || len(w.Result().Cookies()) != 0 {
+			t.Errorf("Content-Type %q: status %d, cookies %v, want 415 and no session", contentType, w.Code, w.Result().Cookies())
+		}
+	}
+}
+
 func TestSignIn_InvalidCredentials(t *testing.T) {
 	handler, _ := setupTestHandler(t)
 
@@ -440,6 +704,184 @@ func TestSignIn_RequireVerification(t *testing.T) {
 	}
 }
 
+type captureMailer struct {
+	mu     sync.Mutex
+	bodies []string
+}
+
+func (m *captureMailer) Send(_ context.Context, _, _, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bodies = append(m.bodies, body)
+	return nil
+}
+
+// lastToken returns the token of the last link emailed
+func (m *captureMailer) lastToken(t *testing.T) string {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.bodies) == 0 {
+		t.Fatal("No email sent")
+	}
+	match := regexp.MustCompile(`https://app\.example\.com/verify\?token=(\S+)`).FindStringSubmatch(m.bodies[len(m.bodies)-1])
+	if match == nil {
+		t.Fatalf("Email has no link:\n%s", m.bodies[len(m.bodies)-1])
+	}
+	return match[1]
+}
+
+func TestSignUp_DoubleOptIn(t *testing.T) {
+	handler, sessionManager := setupTestHandler(t)
+	mailer := &captureMailer{}
+	handler.config.DoubleOptIn = true
+	handler.config.Mailer = mailer
+	handler.config.Localizer = i18n.New(i18n.Config{})
+	handler.config.VerifyEmailURL = "https://app.example.com/verify"
+
+	post := func(path, body string, serve http.HandlerFunc) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		serve(w, jsonRequest(path, strings.NewReader(body)))
+		return w
+	}
+	credentials := `{"email":"ana@example.com","password":"secure-password-123"}`
+
+	// Sign-up creates the user without a session
+	w := post("/auth/signup", credentials, handler.SignUp)
+	if w.Code != http.StatusAccepted || !strings.Contains(w.Body.String(), `"confirmationRequired":true`) {
+		t.Fatalf("SignUp = %d: %s", w.Code, w.Body)
+	}
+	if len(w.Result().Cookies()) > 0 {
+		t.Error("SignUp set a session cookie before confirmation")
+	}
+	user, err := handler.internal.FindUserByEmail(context.Background(), "ana@example.com")
+	if err != nil || user.EmailVerified {
+		t.Fatalf("FindUserByEmail() = %+v, %v; want an unverified user", user, err)
+	}
+	if sessions, _ := sessionManager.ListByUserID(context.Background(), user.ID); len(sessions) != 0 {
+		t.Errorf("SignUp created %d sessions, want none", len(sessions))
+	}
+	token := mailer.lastToken(t)
+
+	// The password is refused until the email is confirmed, with a new link
+	if w := post("/auth/signin", credentials, handler.SignIn); w.Code != http.StatusForbidden {
+		t.Fatalf("SignIn before confirmation = %d, want 403", w.Code)
+	}
+	if len(mailer.bodies) != 2 {
+		t.Errorf("Expected sign-in to email a new link, %d emails sent", len(mailer.bodies))
+	}
+
+	if w := post("/auth/verify-email", `{"token":"`+token+`"}`, handler.VerifyEmail); w.Code != http.StatusOK {
+		t.Fatalf("VerifyEmail = %d: %s", w.Code, w.Body)
+	}
+	if w := post("/auth/verify-email", `{"token":"`+token+`"}`, handler.VerifyEmail); w.Code != http.StatusBadRequest {
+		t.Errorf("VerifyEmail with a used token = %d, want 400", w.Code)
+	}
+	if w := post("/auth/signin", credentials, handler.SignIn); w.Code != http.StatusOK {
+		t.Fatalf("SignIn after confirmation = %d: %s", w.Code, w.Body)
+	}
+
+	var found bool
+	for _, endpoint := range handler.Endpoints() {
+		found = found || endpoint.Path == "/auth/verify-email"
+	}
+	if !found {
+		t.Error("Expected the verify-email endpoint with double opt-in")
+	}
+}
+
+func TestSignUp_DoubleOptInNotConfigured(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	handler.config.DoubleOptIn = true
+
+	w := httptest.NewRecorder()
+	handler.SignUp(w, jsonRequest("/auth/signup", strings.NewReader(`{"email":"ana@example.com","password":"secure-password-123"}`)))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("SignUp without a mailer = %d, want 500", w.Code)
+	}
+	if user, _ := handler.internal.FindUserByEmail(context.Background(), "ana@example.com"); user != nil {
+		t.Error("SignUp created a user it cannot confirm")
+	}
+}
+
+func TestSignIn_BannedUser(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+
+	body, _ := json.Marshal(SignUpRequest{Email: "banned@example.com", Password: "secure-password-123"})
+	req := jsonRequest("/auth/signup", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.SignUp(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Signup failed: %d", w.Code)
+	}
+	user, _ := handler.internal.FindUserByEmail(context.Background(), "banned@example.com")
+	if _, err := handler.internal.UpdateUser(context.Background(), user.ID, map[string]interface{}{
+		"banned": true, "ban_reason": "spam",
+	}); err != nil {
+		t.Fatalf("Failed to ban user: %v", err)
+	}
+
+	body, _ = json.Marshal(SignInRequest{Email: "banned@example.com", Password: "secure-password-123"})
+	req = jsonRequest("/auth/signin", bytes.NewReader(body))
+	w = httptest.NewRecorder()
+	handler.SignIn(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+	var errResp ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&errResp); err != nil {
+		t.Fatalf("Failed to decode error response: %v", err)
+	}
+	if errResp.Error != "account_banned" || errResp.Meta["reason"] != "spam" {
+		t.Errorf("Expected account_banned with the reason, got %+v", errResp)
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Error("Expected no session cookie for a banned user")
+	}
+}
+
+func TestSignIn_TwoFactorRequired(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	ctx := context.Background()
+
+	body, _ := json.Marshal(SignUpRequest{Email: "2fa@example.com", Password: "secure-password-123"})
+	req := httptest.NewRequest(http.MethodPost, "/auth/signup", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.SignUp(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Signup failed: %d", w.Code)
+	}
+	user, _ := handler.internal.FindUserByEmail(ctx, "2fa@example.com")
+	if _, err := handler.internal.UpdateUser(ctx, user.ID, map[string]interface{}{"two_factor_enabled": true}); err != nil {
+		t.Fatalf("Failed to enable 2FA: %v", err)
+	}
+
+	body, _ = json.Marshal(SignInRequest{Email: "2fa@example.com", Password: "secure-password-123"})
+	req = httptest.NewRequest(http.MethodPost, "/auth/signin", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	handler.SignIn(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Error("A password alone set a session cookie for a user with 2FA")
+	}
+	var resp TwoFactorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !resp.TwoFactorRequired || resp.TwoFactorToken == "" {
+		t.Fatalf("Expected a two-factor token, got %+v", resp)
+	}
+	if userID, err := handler.internal.Tokens().PendingTwoFactor(ctx, resp.TwoFactorToken); err != nil || userID != user.ID {
+		t.Errorf("PendingTwoFactor() = %q, %v, want the user", userID, err)
+	}
+}
+
 func TestSignOut_Success(t *testing.T) {
 	handler, sessionManager := setupTestHandler(t)
 
@@ -521,6 +963,67 @@ func TestSignOut_NoCookie(t *testing.T) {
 	}
 }
 
+func TestGetSession_NotModified(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+
+	session := &core.Session{ID: "session-1", UserID: "user-1", ExpiresAt: time.Now().Add(time.Hour)}
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/auth/session", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		ctx := core.WithSession(req.Context(), session)
+		ctx = core.WithUser(ctx, &core.User{ID: "user-1", Email: "poll@example.com"})
+		w := httptest.NewRecorder()
+		handler.GetSession(w, req.WithContext(ctx))
+		return w
+	}
+
+	first := get("")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Expected 200 with an ETag, got %d %q", first.Code, etag)
+	}
+
+	if w := get(etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("Expected 304 without body for a matching ETag, got %d with %d bytes", w.Code, w.Body.Len())
+	}
+	if w := get("W/" + etag); w.Code != http.StatusNotModified {
+		t.Errorf("Expected weak ETag to match, got %d", w.Code)
+	}
+
+	session.ExpiresAt = session.ExpiresAt.Add(time.Hour)
+	if w := get(etag); w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("Expected a new body and ETag once the session changed, got %d", w.Code)
+	}
+}
+
+func TestClientConfig(t *testing.T) {
+	handler := NewHandler(memory.New(), nil, &Config{
+		MinPasswordLength: 10,
+		AllowSignup:       true,
+		Providers:         []string{"google", "github"},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/client-config", nil)
+	w := httptest.NewRecorder()
+	handler.ClientConfig(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var cfg ClientConfig
+	if err := json.NewDecoder(w.Body).Decode(&cfg); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !cfg.SignupEnabled || cfg.EmailVerificationRequired || cfg.PasswordPolicy.MinLength != 10 {
+		t.Errorf("Unexpected client config: %+v", cfg)
+	}
+	if len(cfg.Providers) != 2 || cfg.Providers[0] != "google" {
+		t.Errorf("Expected providers google and github, got %v", cfg.Providers)
+	}
+}
+
 func TestGetSession_Success(t *testing.T) {
 	handler, _ := setupTestHandler(t)
 
@@ -629,6 +1132,56 @@ func TestPasswordHashing(t *testing.T) {
 	}
 }
 
+func TestSignIn_RehashesLegacyPassword(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	ctx := context.Background()
+
+	password := "legacy-password-123"
+	signupReq := SignUpRequest{
+		Email:    "legacy@example.com",
+		Password: password,
+		Name:     "Legacy User",
+	}
+
+	body, _ := json.Marshal(signupReq)
+	req := jsonRequest("/auth/signup", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.SignUp(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Signup failed: %d", w.Code)
+	}
+
+	user, err := handler.internal.FindUserByEmail(ctx, signupReq.Email)
+	if err != nil || user == nil {
+		t.Fatalf("Failed to find user: %v", err)
+	}
+
+	// Simulate a hash imported from a bcrypt-based system
+	legacyHash, err := crypto.NewBcryptHasher(4).Hash(password)
+	if err != nil {
+		t.Fatalf("Failed to create bcrypt hash: %v", err)
+	}
+	if err := handler.internal.UpdateCredentialPassword(ctx, user.ID, legacyHash); err != nil {
+		t.Fatalf("Failed to store legacy hash: %v", err)
+	}
+
+	body, _ = json.Marshal(SignInRequest{Email: signupReq.Email, Password: password})
+	req = jsonRequest("/auth/signin", bytes.NewReader(body))
+	w = httptest.NewRecorder()
+	handler.SignIn(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	newHash, err := handler.getUserPasswordHash(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get password hash: %v", err)
+	}
+	if crypto.DetectAlgorithm(newHash) != crypto.AlgorithmArgon2id {
+		t.Errorf("Expected hash to be upgraded to argon2id, got %s", newHash)
+	}
+}
+
 func TestHelperFunctions(t *testing.T) {
 	t.Run("isValidEmail", func(t *testing.T) {
 		tests := []struct {
@@ -651,7 +1204,16 @@ func TestHelperFunctions(t *testing.T) {
 		}
 	})
 
-	t.Run("getIPAddress", func(t *testing.T) {
+	t.Run("clientInfo", func(t *testing.T) {
+		// httptest requests come from 192.0.2.1
+		sessionManager, err := session.NewManager(&session.Config{
+			TrustedProxies: []string{"192.0.2.0/24", "10.0.0.0/8"},
+		}, nil)
+		if err != nil {
+			t.Fatalf("Failed to create session manager: %v", err)
+		}
+		h := &Handler{sessionManager: sessionManager}
+
 		tests := []struct {
 			name       string
 			setupReq   func() *http.Request
@@ -666,6 +1228,15 @@ func TestHelperFunctions(t *testing.T) {
 				},
 				expectedIP: "1.2.3.4",
 			},
+			{
+				name: "right-most untrusted X-Forwarded-For hop",
+				setupReq: func() *http.Request {
+					req := httptest.NewRequest(http.MethodGet, "/", nil)
+					req.Header.Set("X-Forwarded-For", "6.6.6.6, 1.2.3.4, 10.0.0.2")
+					return req
+				},
+				expectedIP: "1.2.3.4",
+			},
 			{
 				name: "X-Real-IP header",
 				setupReq: func() *http.Request {
@@ -676,22 +1247,24 @@ func TestHelperFunctions(t *testing.T) {
 				expectedIP: "5.6.7.8",
 			},
 			{
-				name: "RemoteAddr fallback",
+				name: "untrusted peer",
 				setupReq: func() *http.Request {
 					req := httptest.NewRequest(http.MethodGet, "/", nil)
 					req.RemoteAddr = "9.10.11.12:12345"
+					req.Header.Set("X-Forwarded-For", "1.2.3.4")
+					req.Header.Set("X-Real-IP", "5.6.7.8")
 					return req
 				},
-				expectedIP: "9.10.11.12:12345",
+				expectedIP: "9.10.11.12",
 			},
 		}
 
 		for _, tt := range tests {
 			t.Run(tt.name, func(t *testing.T) {
 				req := tt.setupReq()
-				ip := getIPAddress(req)
+				ip := h.clientInfo(req).IPAddress
 				if ip != tt.expectedIP {
-					t.Errorf("getIPAddress() = %s, expected %s", ip, tt.expectedIP)
+					t.Errorf("clientInfo().IPAddress = %s, expected %s", ip, tt.expectedIP)
 				}
 			})
 		}
@@ -738,3 +1311,232 @@ func TestIDGeneration(t *testing.T) {
 		t.Error("Expected non-empty ID")
 	}
 }
+
+func TestEndpoints(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+
+	seen := make(map[string]bool)
+	for _, endpoint := range handler.Endpoints() {
+		if endpoint.Name == "" || endpoint.Method == "" || endpoint.Handler == nil {
+			t.Errorf("Incomplete endpoint descriptor: %+v", endpoint)
+		}
+		if !strings.HasPrefix(endpoint.Path, "/auth/") {
+			t.Errorf("Endpoint %s has unexpected path %q", endpoint.Name, endpoint.Path)
+		}
+
+		route := endpoint.Method + " " + endpoint.Path
+		if seen[route] || seen[endpoint.Name] {
+			t.Errorf("Duplicate endpoint %s (%s)", endpoint.Name, route)
+		}
+		seen[route] = true
+		seen[endpoint.Name] = true
+	}
+
+	if len(seen) == 0 {
+		t.Fatal("Expected endpoints")
+	}
+}
+
+type eventRecorder struct {
+	events []*core.SecurityEvent
+}
+
+func (r *eventRecorder) Emit(ctx context.Context, event *core.SecurityEvent) error {
+	r.events = append(r.events, event)
+	return nil
+}
+
+func TestSignIn_EmitsSecurityEvent(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	events := &eventRecorder{}
+	handler.config.SecurityEvents = events
+
+	body, _ := json.Marshal(SignInRequest{Email: "nobody@example.com", Password: "any-password-123"})
+	req := jsonRequest("/auth/signin", bytes.NewReader(body))
+	req.RemoteAddr = "203.0.113.7:5123"
+	w := httptest.NewRecorder()
+
+	handler.SignIn(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401, got %d", w.Code)
+	}
+	if len(events.events) != 1 {
+		t.Fatalf("Expected 1 security event, got %d", len(events.events))
+	}
+	event := events.events[0]
+	if event.Type != core.EventLoginFailed || event.Email != "nobody@example.com" || event.IPAddress != "203.0.113.7" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+	if event.Severity != core.SeverityLow || event.Time.IsZero() {
+		t.Errorf("Expected default severity and time, got %+v", event)
+	}
+}
+
+func TestSignIn_RevokesPreviousSession(t *testing.T) {
+	handler, sessionManager := setupTestHandler(t)
+
+	body, _ := json.Marshal(SignUpRequest{Email: "fixation@example.com", Password: "secure-password-123"})
+	w := httptest.NewRecorder()
+	handler.SignUp(w, jsonRequest("/auth/signup", bytes.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Signup failed: %d", w.Code)
+	}
+	var signup AuthResponse
+	_ = json.NewDecoder(w.Body).Decode(&signup)
+
+	// Sign in again while presenting the existing session cookie
+	body, _ = json.Marshal(SignInRequest{Email: "fixation@example.com", Password: "secure-password-123"})
+	req := jsonRequest("/auth/signin", bytes.NewReader(body))
+	req.AddCookie(&http.Cookie{Name: "test_session", Value: signup.Token})
+	w = httptest.NewRecorder()
+	handler.SignIn(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Signin failed: %d", w.Code)
+	}
+	var signin AuthResponse
+	_ = json.NewDecoder(w.Body).Decode(&signin)
+
+	ctx := context.Background()
+	if session, _, _ := sessionManager.Get(ctx, signup.Token); session != nil {
+		t.Error("Expected the session presented at sign-in to be revoked")
+	}
+	if session, _, err := sessionManager.Get(ctx, signin.Token); err != nil || session == nil {
+		t.Errorf("Expected the new session to be valid, got %v", err)
+	}
+}
+
+func TestSignUp_RunsLifecycleHooks(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	var created []*core.UserCreatedEvent
+	var signIns []*core.SignInEvent
+	handler.config.Lifecycle = &core.LifecycleHooks{
+		OnUserCreated: []func(context.Context, *core.UserCreatedEvent) error{
+			func(ctx context.Context, event *core.UserCreatedEvent) error {
+				created = append(created, event)
+				return nil
+			},
+		},
+		OnSignIn: []func(context.Context, *core.SignInEvent) error{
+			func(ctx context.Context, event *core.SignInEvent) error {
+				signIns = append(signIns, event)
+				return nil
+			},
+		},
+	}
+
+	body, _ := json.Marshal(SignUpRequest{Email: "hooks@example.com", Password: "secure-password-123"})
+	w := httptest.NewRecorder()
+	handler.SignUp(w, jsonRequest("/auth/signup", bytes.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", w.Code)
+	}
+
+	body, _ = json.Marshal(SignInRequest{Email: "hooks@example.com", Password: "secure-password-123"})
+	w = httptest.NewRecorder()
+	handler.SignIn(w, jsonRequest("/auth/signin", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	if len(created) != 1 || created[0].User.Email != "hooks@example.com" || created[0].Method != core.MethodPassword {
+		t.Errorf("Expected one OnUserCreated for the new user, got %+v", created)
+	}
+	if len(signIns) != 2 {
+		t.Fatalf("Expected OnSignIn after sign-up and sign-in, got %d", len(signIns))
+	}
+	if signIns[1].Session == nil || signIns[1].Session.UserID != created[0].User.ID {
+		t.Errorf("Expected the sign-in session of the new user, got %+v", signIns[1].Session)
+	}
+}
+
+// slowHasher takes a fixed time to verify, like a real password hash
+type slowHasher struct {
+	mu       sync.Mutex
+	verifies int
+}
+
+func (h *slowHasher) Hash(password string) (string, error) { return "slow:" + password, nil }
+
+func (h *slowHasher) Verify(password, hash string) (bool, error) {
+	h.mu.Lock()
+	h.verifies++
+	h.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	return hash == "slow:"+password, nil
+}
+
+func TestSignIn_UnknownUserTiming(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	hasher := &slowHasher{}
+	handler.hasher = hasher
+	handler.dummy = crypto.NewDummyVerifier(hasher)
+
+	body, _ := json.Marshal(SignUpRequest{Email: "known@example.com", Password: "correct-password-123"})
+	w := httptest.NewRecorder()
+	handler.SignUp(w, jsonRequest("/auth/signup", bytes.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Signup failed: %d", w.Code)
+	}
+
+	signIn := func(email string) time.Duration {
+		body, _ := json.Marshal(SignInRequest{Email: email, Password: "wrong-password-123"})
+		w := httptest.NewRecorder()
+		start := time.Now()
+		handler.SignIn(w, jsonRequest("/auth/signin", bytes.NewReader(body)))
+		elapsed := time.Since(start)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected 401 for %s, got %d", email, w.Code)
+		}
+		return elapsed
+	}
+
+	signIn("unknown@example.com") // creates the dummy hash
+	hasher.verifies = 0
+
+	known := signIn("known@example.com")
+	unknown := signIn("unknown@example.com")
+	if hasher.verifies != 2 {
+		t.Errorf("Expected a password verification on both paths, got %d", hasher.verifies)
+	}
+	if unknown < known/2 {
+		t.Errorf("Expected comparable latency, unknown user took %v and wrong password %v", unknown, known)
+	}
+}
+
+// busyHasher rejects every call like a saturated crypto.LimitedHasher
+type busyHasher struct{}
+
+func (busyHasher) Hash(string) (string, error)         { return "", crypto.ErrHasherBusy }
+func (busyHasher) Verify(string, string) (bool, error) { return false, crypto.ErrHasherBusy }
+
+func TestSignIn_HasherBusy(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+
+	body, _ := json.Marshal(SignUpRequest{Email: "known@example.com", Password: "correct-password-123"})
+	w := httptest.NewRecorder()
+	handler.SignUp(w, jsonRequest("/auth/signup", bytes.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Signup failed: %d", w.Code)
+	}
+
+	handler.hasher = busyHasher{}
+	handler.dummy = crypto.NewDummyVerifier(busyHasher{})
+
+	// Known and unknown accounts fail alike, with a retryable error
+	for _, email := range []string{"known@example.com", "unknown@example.com"} {
+		body, _ := json.Marshal(SignInRequest{Email: email, Password: "correct-password-123"})
+		w := httptest.NewRecorder()
+		handler.SignIn(w, jsonRequest("/auth/signin", bytes.NewReader(body)))
+		if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: expected 503 with Retry-After, got %d", email, w.Code)
+		}
+	}
+
+	body, _ = json.Marshal(SignUpRequest{Email: "new@example.com", Password: "secure-password-123"})
+	w = httptest.NewRecorder()
+	handler.SignUp(w, jsonRequest("/auth/signup", bytes.NewReader(body)))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 for sign-up, got %d", w.Code)
+	}
+}
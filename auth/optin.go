@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/i18n"
+	"github.com/marshallshelly/beacon-auth/tokens"
+)
+
+// ConfirmationResponse answers a double opt-in sign-up. The user is
+// created without a session and signs in once they confirm their email.
+type ConfirmationResponse struct {
+	ConfirmationRequired bool `json:"confirmationRequired"`
+}
+
+// VerifyEmailRequest represents an email confirmation request
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// VerifyEmail confirms the email of a double opt-in user with the token of
+// their confirmation link, or of the link sent when they tried to sign in
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req VerifyEmailRequest
+	if !h.decodeRequest(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+	svc := h.internal.Tokens()
+	v, err := svc.Consume(ctx, tokens.EmailVerification, req.Token)
+	if errors.Is(err, tokens.ErrInvalidToken) {
+		v, err = svc.Consume(ctx, tokens.SignupConfirmation, req.Token)
+	}
+	if errors.Is(err, tokens.ErrInvalidToken) {
+		h.writeError(w, r, http.StatusBadRequest, core.CodeInvalidToken, "Invalid or expired token")
+		return
+	}
+	if err != nil {
+		h.writeError(w, r, http.StatusInternalServerError, core.CodeDatabaseError, "Failed to check token")
+		return
+	}
+
+	user, err := h.internal.FindUserByEmail(ctx, v.Identifier)
+	if err != nil || user == nil {
+		h.writeError(w, r, http.StatusBadRequest, core.CodeInvalidToken, "Invalid or expired token")
+		return
+	}
+	if _, err := h.internal.UpdateUser(ctx, user.ID, map[string]interface{}{"email_verified": true}); err != nil {
+		h.writeError(w, r, http.StatusInternalServerError, core.CodeDatabaseError, "Failed to verify email")
+		return
+	}
+
+	// The account is confirmed, whichever link was used (best effort)
+	_, _ = svc.Revoke(ctx, tokens.SignupConfirmation, v.Identifier)
+
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// confirmationConfigured reports whether double opt-in links can be sent
+func (h *Handler) confirmationConfigured() bool {
+	return h.config.Mailer != nil && h.config.Localizer != nil && h.config.VerifyEmailURL != ""
+}
+
+// sendLink issues a token of purpose for email and emails the verification
+// template with a link to VerifyEmailURL carrying the token
+func (h *Handler) sendLink(r *http.Request, email string, purpose tokens.Purpose) error {
+	if !h.confirmationConfigured() {
+		return errors.New("double opt-in needs a mailer, localizer and verify email URL")
+	}
+	link, err := url.Parse(h.config.VerifyEmailURL)
+	if err != nil {
+		return err
+	}
+
+	token, record, err := h.internal.Tokens().Create(r.Context(), purpose, email, 0)
+	if err != nil {
+		return err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	locale := h.config.Localizer.Locale(r)
+	subject, body, err := h.config.Localizer.Email(locale, core.EmailVerifyEmail, i18n.EmailData{
+		AppName:   h.config.AppName,
+		URL:       link.String(),
+		ExpiresIn: time.Until(record.ExpiresAt),
+	})
+	if err != nil {
+		return err
+	}
+	return h.config.Mailer.Send(r.Context(), email, subject, body)
+}
@@ -2,10 +2,13 @@
 package beaconauth
 
 import (
+	"fmt"
+
 	"github.com/marshallshelly/beacon-auth/adapter"
 	"github.com/marshallshelly/beacon-auth/core"
 	"github.com/marshallshelly/beacon-auth/crypto"
 	"github.com/marshallshelly/beacon-auth/session"
+	goredis "github.com/redis/go-redis/v9"
 )
 
 // Auth is the main authentication interface
@@ -26,20 +29,137 @@ type Config = core.Config
 // Option is a functional option for configuring BeaconAuth
 type Option = core.Option
 
+// SessionBinding pins sessions to attributes of the client that created them
+type SessionBinding = core.SessionBinding
+
+// BanError is returned when a banned user signs in or uses a session
+type BanError = core.BanError
+
+// TenancyConfig scopes users, sessions and accounts to the tenant of each
+// request
+type TenancyConfig = core.TenancyConfig
+
+// UserStore keeps users outside the database (see WithUserStore)
+type UserStore = core.UserStore
+
+// RequestHook runs before or after plugin endpoints (see WithBeforeHook)
+type RequestHook = core.RequestHook
+
+// HookRequest is the request passed to Before hooks
+type HookRequest = core.HookRequest
+
+// HookResponse answers a request from a Before hook
+type HookResponse = core.HookResponse
+
+// NewHookResponse returns a Before hook response with a JSON body
+var NewHookResponse = core.NewHookResponse
+
+// EventBus publishes user, session and auth events to in-process subscribers
+type EventBus = core.EventBus
+
+// Event is published on the event bus
+type Event = core.Event
+
+// EventHandler handles events of a subscription
+type EventHandler = core.EventHandler
+
+// NewEventBus creates an event bus to share with WithEventBus
+var NewEventBus = core.NewEventBus
+
+// Async handles an event subscription off the request path
+var Async = core.Async
+
+// Event bus topics
+const (
+	TopicUserCreated    = core.TopicUserCreated
+	TopicSignIn         = core.TopicSignIn
+	TopicSessionCreated = core.TopicSessionCreated
+	TopicSessionRevoked = core.TopicSessionRevoked
+	TopicSecurityPrefix = core.TopicSecurityPrefix
+)
+
+// ErrorCode is a stable, machine-readable error code of error responses
+type ErrorCode = core.ErrorCode
+
+// ErrorResponse is the JSON body of error responses
+type ErrorResponse = core.ErrorResponse
+
+// FieldError describes why a request field is invalid
+type FieldError = core.FieldError
+
+// WriteError writes an error response, as JSON or RFC 7807 problem
+// details depending on the Accept header
+var WriteError = core.WriteError
+
+// ErrorCatalog lists the error codes of error responses
+var ErrorCatalog = core.ErrorCatalog
+
 // Configuration options
 var (
-	WithSecret         = core.WithSecret
-	WithBaseURL        = core.WithBaseURL
-	WithBasePath       = core.WithBasePath
-	WithAdapter        = core.WithAdapter
-	WithPlugins        = core.WithPlugins
-	WithMailer         = core.WithMailer
-	WithOAuthProviders = core.WithOAuthProviders
-	WithRateLimit      = core.WithRateLimit
-	WithSessionConfig  = core.WithSessionConfig
-	WithEmailPassword  = core.WithEmailPassword
-	WithLogger         = core.WithLogger
-	WithTrustedOrigins = core.WithTrustedOrigins
+	WithSecret              = core.WithSecret
+	WithSecretKeys          = core.WithSecretKeys
+	WithSecretProvider      = core.WithSecretProvider
+	WithBaseURL             = core.WithBaseURL
+	WithBasePath            = core.WithBasePath
+	WithAdapter             = core.WithAdapter
+	WithTableNames          = core.WithTableNames
+	WithQueryTimeouts       = core.WithQueryTimeouts
+	WithHashLimit           = core.WithHashLimit
+	WithUserStore           = core.WithUserStore
+	WithTenancy             = core.WithTenancy
+	WithPlugins             = core.WithPlugins
+	WithMailer              = core.WithMailer
+	WithLocalizer           = core.WithLocalizer
+	WithOAuthProviders      = core.WithOAuthProviders
+	WithRateLimit           = core.WithRateLimit
+	WithRateLimitClass      = core.WithRateLimitClass
+	WithSessionConfig       = core.WithSessionConfig
+	WithEmailPassword       = core.WithEmailPassword
+	WithLogger              = core.WithLogger
+	WithPasswordHasher      = core.WithPasswordHasher
+	WithTrustedOrigins      = core.WithTrustedOrigins
+	WithRedirectOrigins     = core.WithRedirectOrigins
+	WithTrustedProxies      = core.WithTrustedProxies
+	WithMaxSessionsPerUser  = core.WithMaxSessionsPerUser
+	WithSessionPruning      = core.WithSessionPruning
+	WithIdleTimeout         = core.WithIdleTimeout
+	WithSessionBinding      = core.WithSessionBinding
+	WithBanAction           = core.WithBanAction
+	WithRememberMe          = core.WithRememberMe
+	WithEncryptedCookies    = core.WithEncryptedCookies
+	WithUserCache           = core.WithUserCache
+	WithSessionStores       = core.WithSessionStores
+	WithClaimsEnricher      = core.WithClaimsEnricher
+	WithHashedSessionTokens = core.WithHashedSessionTokens
+	WithSecurityEvents      = core.WithSecurityEvents
+	WithOnUserCreated       = core.WithOnUserCreated
+	WithOnSignIn            = core.WithOnSignIn
+	WithOnSessionCreated    = core.WithOnSessionCreated
+	WithBeforeHook          = core.WithBeforeHook
+	WithConfigFile          = core.WithConfigFile
+	WithEventBus            = core.WithEventBus
+	WithEventSubscriber     = core.WithEventSubscriber
+)
+
+// Session limit strategies
+const (
+	SessionLimitRejectNew   = core.SessionLimitRejectNew
+	SessionLimitEvictOldest = core.SessionLimitEvictOldest
+	SessionLimitEvictOthers = core.SessionLimitEvictOthers
+)
+
+// Session binding modes and mismatch actions
+const (
+	IPBindingSubnet       = core.IPBindingSubnet
+	IPBindingExact        = core.IPBindingExact
+	BindingRevoke         = core.BindingRevoke
+	BindingReauthenticate = core.BindingReauthenticate
+)
+
+// Actions on sessions of banned users
+const (
+	BanRevoke = core.BanRevoke
+	BanReject = core.BanReject
 )
 
 // Common errors
@@ -48,6 +168,10 @@ var (
 	ErrUserNotFound       = core.ErrUserNotFound
 	ErrSessionNotFound    = core.ErrSessionNotFound
 	ErrSessionExpired     = core.ErrSessionExpired
+	ErrSessionLimit       = core.ErrSessionLimit
+	ErrSessionBinding     = core.ErrSessionBinding
+	ErrUserBanned         = core.ErrUserBanned
+	ErrTenantRequired     = core.ErrTenantRequired
 	ErrEmailTaken         = core.ErrEmailTaken
 	ErrInvalidEmail       = core.ErrInvalidEmail
 	ErrInvalidPassword    = core.ErrInvalidPassword
@@ -63,31 +187,102 @@ var (
 func New(opts ...Option) (Auth, error) {
 	// Add default factory configuration
 	factoryOpt := func(c *core.Config) error {
+		if c.Adapter != nil && c.QueryTimeouts != nil && *c.QueryTimeouts != (core.QueryTimeouts{}) {
+			c.Adapter = adapter.WithTimeouts(c.Adapter, *c.QueryTimeouts)
+		}
+		if c.Adapter != nil && c.Tenancy != nil {
+			c.Adapter = adapter.WithTenancy(c.Adapter, *c.Tenancy, c.TableNames)
+		}
+
 		c.DataManagerFactory = func(adapterInstance core.Adapter) core.DataManager {
-			return adapter.NewInternalAdapter(adapterInstance, nil)
+			return adapter.NewInternalAdapter(adapterInstance, &adapter.InternalAdapterConfig{
+				TableNames: c.TableNames,
+				UserStore:  c.UserStore,
+				UserCache:  c.Session.UserCache,
+			})
 		}
 
-		c.PasswordHasherFactory = func() core.PasswordHasher {
-			return crypto.NewArgon2Hasher()
+		if c.PasswordHasherFactory == nil {
+			c.PasswordHasherFactory = func() core.PasswordHasher {
+				return crypto.NewDefaultHasher()
+			}
+		}
+		if c.HashLimit != nil {
+			hasherFactory := c.PasswordHasherFactory
+			limit := crypto.HashLimit{MaxConcurrent: c.HashLimit.MaxConcurrent, QueueTimeout: c.HashLimit.QueueTimeout}
+			c.PasswordHasherFactory = func() core.PasswordHasher {
+				return crypto.NewLimitedHasher(hasherFactory(), limit)
+			}
 		}
 
 		c.SessionManagerFactory = func(cfg *core.Config, adapterInstance core.Adapter) (core.SessionManager, error) {
 			// Map core config to session config
 			sessCfg := &session.Config{
-				Secret:            cfg.Secret,
-				Issuer:            cfg.AppName,
-				CookieName:        cfg.Session.CookieName,
-				CookieDomain:      cfg.Session.CookieDomain,
-				CookiePath:        cfg.Session.CookiePath,
-				CookieSecure:      cfg.Session.CookieSecure,
-				CookieHTTPOnly:    cfg.Session.CookieHTTPOnly,
-				CookieSameSite:    cfg.Session.CookieSameSite,
-				ExpiresIn:         cfg.Session.ExpiresIn,
-				UpdateAge:         cfg.Session.UpdateAge,
-				EnableCookieStore: true,
-				EnableDBStore:     true,
-				// Redis support requires advanced config parsing not implemented in this bridge yet
-				EnableRedisStore: false,
+				Secret:              cfg.Secret,
+				Issuer:              cfg.AppName,
+				CookieName:          cfg.Session.CookieName,
+				CookieDomain:        cfg.Session.CookieDomain,
+				CookiePath:          cfg.Session.CookiePath,
+				CookieSecure:        cfg.Session.CookieSecure,
+				CookieHTTPOnly:      cfg.Session.CookieHTTPOnly,
+				CookieSameSite:      cfg.Session.CookieSameSite,
+				CookieChunkSize:     cfg.Session.CookieChunkSize,
+				EncryptCookies:      cfg.Session.EncryptCookies,
+				CookieUserClaims:    cfg.Session.CookieUserClaims,
+				ClaimsEnricher:      cfg.Session.ClaimsEnricher,
+				MaxClaimsSize:       cfg.Session.MaxClaimsSize,
+				ExpiresIn:           cfg.Session.ExpiresIn,
+				ShortExpiresIn:      cfg.Session.ShortExpiresIn,
+				UpdateAge:           cfg.Session.UpdateAge,
+				AbsoluteExpiry:      cfg.Session.AbsoluteExpiry,
+				BatchUpdates:        cfg.Session.BatchUpdates,
+				UpdateBatchSize:     cfg.Session.UpdateBatchSize,
+				UpdateFlushInterval: cfg.Session.UpdateFlushInterval,
+				IdleTimeout:         cfg.Session.IdleTimeout,
+				Binding:             cfg.Session.Binding,
+				TrustedProxies:      cfg.Advanced.TrustedProxies,
+				OnBan:               cfg.Session.OnBan,
+				Tenancy:             cfg.Tenancy != nil,
+				EnableCookieStore:   true,
+				EnableDBStore:       true,
+				// Session.Stores selects other stores, below
+				TableNames:           cfg.TableNames,
+				Users:                cfg.UserStore,
+				UserCache:            cfg.Session.UserCache,
+				HashDBTokens:         cfg.Session.HashTokens,
+				AcceptPlainDBTokens:  cfg.Session.AcceptPlainTokens,
+				MaxSessionsPerUser:   cfg.Session.MaxSessionsPerUser,
+				SessionLimitStrategy: cfg.Session.SessionLimitStrategy,
+				KeepRecentSessions:   cfg.Session.KeepRecentSessions,
+				SecurityEvents:       cfg.SecurityEvents,
+			}
+
+			if stores := cfg.Session.Stores; stores != nil {
+				sessCfg.EnableCookieStore = stores.Cookie
+				sessCfg.EnableDBStore = stores.Database
+				if stores.Redis {
+					redisOpts, err := goredis.ParseURL(stores.RedisURL)
+					if err != nil {
+						return nil, fmt.Errorf("invalid Redis session store URL: %w", err)
+					}
+					sessCfg.EnableRedisStore = true
+					sessCfg.RedisPrefix = session.DefaultConfig().RedisPrefix
+					sessCfg.Redis = &session.RedisOptions{
+						Addrs:     []string{redisOpts.Addr},
+						Username:  redisOpts.Username,
+						Password:  redisOpts.Password,
+						DB:        redisOpts.DB,
+						TLSConfig: redisOpts.TLSConfig,
+					}
+				}
+			}
+
+			if cfg.SecretKeys != "" {
+				keyRing, err := session.ParseKeyRing(cfg.SecretKeys)
+				if err != nil {
+					return nil, fmt.Errorf("invalid secret keys: %w", err)
+				}
+				sessCfg.KeyRing = keyRing
 			}
 
 			return session.NewManager(sessCfg, adapterInstance)
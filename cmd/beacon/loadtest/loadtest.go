@@ -0,0 +1,310 @@
+// Package loadtest drives sign-up, sign-in and session traffic against a
+// running BeaconAuth instance and reports latency percentiles, so
+// performance regressions of the auth hot path can be measured.
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/cookiejar"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of Config
+const (
+	DefaultUsers             = 10
+	DefaultDuration          = 30 * time.Second
+	DefaultSessionsPerSignIn = 10
+	DefaultSignUpPath        = "/auth/signup"
+	DefaultSignInPath        = "/auth/signin"
+	DefaultSessionPath       = "/auth/session"
+	DefaultPassword          = "loadtest-password-1"
+)
+
+// Operations reported by Run
+const (
+	OpSignUp  = "signup"
+	OpSignIn  = "signin"
+	OpSession = "session"
+)
+
+// maxReportedErrors caps the errors kept per operation in a report
+const maxReportedErrors = 10
+
+// Config configures a load test
+type Config struct {
+	// BaseURL is the instance under test, e.g. "http://localhost:8080"
+	BaseURL string
+
+	// SignUpPath, SignInPath and SessionPath are the endpoints below
+	// BaseURL (defaults DefaultSignUpPath, DefaultSignInPath and
+	// DefaultSessionPath). The email/password plugin serves sign-up and
+	// sign-in at "/auth/register" and "/auth/login".
+	SignUpPath  string
+	SignInPath  string
+	SessionPath string
+
+	// Users is the number of virtual users running concurrently
+	// (default DefaultUsers)
+	Users int
+
+	// Duration is how long the virtual users keep signing in and reading
+	// their session after signing up (default DefaultDuration)
+	Duration time.Duration
+
+	// SessionsPerSignIn is the number of session reads each virtual user
+	// makes after every sign-in (default DefaultSessionsPerSignIn)
+	SessionsPerSignIn int
+
+	// Password is the password of the created users (default
+	// DefaultPassword). It must satisfy the instance's password policy.
+	Password string
+
+	// Client sends the requests (default a client with a 10s timeout).
+	// Each virtual user keeps its session in its own cookie jar.
+	Client *http.Client
+}
+
+// OperationReport summarizes the requests of one operation
+type OperationReport struct {
+	Operation string `json:"operation"`
+
+	// Requests counts requests sent, including failed ones
+	Requests int `json:"requests"`
+
+	// Errors counts transport errors and non-2xx responses
+	Errors int `json:"errors"`
+
+	// Latency percentiles of all requests
+	P50 time.Duration `json:"p50"`
+	P99 time.Duration `json:"p99"`
+	Max time.Duration `json:"max"`
+
+	// Throughput is requests per second over the whole run
+	Throughput float64 `json:"throughput"`
+
+	// ErrorSamples lists the first errors
+	ErrorSamples []string `json:"errorSamples,omitempty"`
+}
+
+// Report summarizes a load test
+type Report struct {
+	Users      int               `json:"users"`
+	Elapsed    time.Duration     `json:"elapsed"`
+	Operations []OperationReport `json:"operations"`
+}
+
+// Run signs up Config.Users users concurrently, then has each one repeat a
+// sign-in followed by SessionsPerSignIn session reads until Duration ends
+// or ctx is canceled. Failed requests are reported, not returned; Run only
+// fails when the configuration is invalid.
+//
+// Run creates real users on the instance. Point it at a disposable
+// deployment, and lift rate limits on the tested endpoints or expect
+// 429 responses among the errors.
+func Run(ctx context.Context, cfg *Config) (*Report, error) {
+	if cfg == nil || cfg.BaseURL == "" {
+		return nil, errors.New("a base URL is required")
+	}
+	if cfg.Users < 0 || cfg.Duration < 0 || cfg.SessionsPerSignIn < 0 {
+		return nil, errors.New("users, duration and sessions per sign-in cannot be negative")
+	}
+
+	r := &runner{
+		baseURL:     strings.TrimRight(cfg.BaseURL, "/"),
+		signUpPath:  withDefault(cfg.SignUpPath, DefaultSignUpPath),
+		signInPath:  withDefault(cfg.SignInPath, DefaultSignInPath),
+		sessionPath: withDefault(cfg.SessionPath, DefaultSessionPath),
+		password:    withDefault(cfg.Password, DefaultPassword),
+		sessions:    cfg.SessionsPerSignIn,
+		client:      cfg.Client,
+		stats: map[string]*stats{
+			OpSignUp:  {},
+			OpSignIn:  {},
+			OpSession: {},
+		},
+	}
+	if r.sessions == 0 {
+		r.sessions = DefaultSessionsPerSignIn
+	}
+	if r.client == nil {
+		r.client = &http.Client{Timeout: 10 * time.Second}
+	}
+	users := cfg.Users
+	if users == 0 {
+		users = DefaultUsers
+	}
+	duration := cfg.Duration
+	if duration == 0 {
+		duration = DefaultDuration
+	}
+
+	runID, err := randomHex(4)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < users; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r.virtualUser(ctx, fmt.Sprintf("loadtest-%s-%d@example.com", runID, i))
+		}(i)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	report := &Report{Users: users, Elapsed: elapsed}
+	for _, op := range []string{OpSignUp, OpSignIn, OpSession} {
+		report.Operations = append(report.Operations, r.stats[op].report(op, elapsed))
+	}
+	return report, nil
+}
+
+type runner struct {
+	baseURL     string
+	signUpPath  string
+	signInPath  string
+	sessionPath string
+	password    string
+	sessions    int
+	client      *http.Client
+	stats       map[string]*stats
+}
+
+// virtualUser signs up, then signs in and reads the session until ctx ends
+func (r *runner) virtualUser(ctx context.Context, email string) {
+	jar, _ := cookiejar.New(nil) // Never fails without options
+	client := *r.client
+	client.Jar = jar
+
+	credentials, _ := json.Marshal(map[string]string{"email": email, "password": r.password, "name": "Load Test"})
+	if !r.do(ctx, &client, OpSignUp, http.MethodPost, r.signUpPath, credentials) {
+		return // Signing in would only fail too
+	}
+
+	for ctx.Err() == nil {
+		r.do(ctx, &client, OpSignIn, http.MethodPost, r.signInPath, credentials)
+		for i := 0; i < r.sessions && ctx.Err() == nil; i++ {
+			r.do(ctx, &client, OpSession, http.MethodGet, r.sessionPath, nil)
+		}
+	}
+}
+
+// do sends one request and records its latency. Requests cut short by the
+// end of the run are not recorded.
+func (r *runner) do(ctx context.Context, client *http.Client, op, method, path string, body []byte) bool {
+	req, err := http.NewRequestWithContext(ctx, method, r.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		r.stats[op].record(0, err)
+		return false
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			err = fmt.Errorf("%s %s: %s", method, path, resp.Status)
+		}
+	}
+	latency := time.Since(start)
+
+	if err != nil && ctx.Err() != nil {
+		return false
+	}
+	r.stats[op].record(latency, err)
+	return err == nil
+}
+
+// stats collects the latencies and errors of one operation
+type stats struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	errors    int
+	samples   []string
+}
+
+func (s *stats) record(latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latencies = append(s.latencies, latency)
+	if err != nil {
+		s.errors++
+		if len(s.samples) < maxReportedErrors {
+			s.samples = append(s.samples, err.Error())
+		}
+	}
+}
+
+func (s *stats) report(op string, elapsed time.Duration) OperationReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sorted := append([]time.Duration(nil), s.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	report := OperationReport{
+		Operation:    op,
+		Requests:     len(sorted),
+		Errors:       s.errors,
+		P50:          percentile(sorted, 50),
+		P99:          percentile(sorted, 99),
+		ErrorSamples: s.samples,
+	}
+	if len(sorted) > 0 {
+		report.Max = sorted[len(sorted)-1]
+	}
+	if elapsed > 0 {
+		report.Throughput = float64(len(sorted)) / elapsed.Seconds()
+	}
+	return report
+}
+
+// percentile returns the nearest-rank percentile of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func withDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,122 @@
+package loadtest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAuth serves the three endpoints with cookie sessions
+func fakeAuth(t *testing.T, sessionStatus int) *httptest.Server {
+	t.Helper()
+	var mu sync.Mutex
+	users := make(map[string]string)
+
+	signIn := func(w http.ResponseWriter, email string) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: email, Path: "/"})
+		w.WriteHeader(http.StatusOK)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /auth/signup", func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ Email, Password string }
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		defer mu.Unlock()
+		if _, ok := users[req.Email]; ok || req.Email == "" {
+			http.Error(w, "exists", http.StatusConflict)
+			return
+		}
+		users[req.Email] = req.Password
+		signIn(w, req.Email)
+	})
+	mux.HandleFunc("POST /auth/signin", func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ Email, Password string }
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		defer mu.Unlock()
+		if users[req.Email] != req.Password {
+			http.Error(w, "invalid", http.StatusUnauthorized)
+			return
+		}
+		signIn(w, req.Email)
+	})
+	mux.HandleFunc("GET /auth/session", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("session"); err != nil {
+			http.Error(w, "no session", http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(sessionStatus)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRun(t *testing.T) {
+	server := fakeAuth(t, http.StatusOK)
+	report, err := Run(context.Background(), &Config{
+		BaseURL:           server.URL + "/",
+		Users:             4,
+		Duration:          200 * time.Millisecond,
+		SessionsPerSignIn: 3,
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if report.Users != 4 || len(report.Operations) != 3 {
+		t.Fatalf("report = %+v", report)
+	}
+	for _, op := range report.Operations {
+		if op.Errors != 0 {
+			t.Errorf("%s: %d errors: %v", op.Operation, op.Errors, op.ErrorSamples)
+		}
+		if op.P50 <= 0 || op.P50 > op.P99 || op.P99 > op.Max || op.Throughput <= 0 {
+			t.Errorf("%s: p50 %v, p99 %v, max %v, throughput %v", op.Operation, op.P50, op.P99, op.Max, op.Throughput)
+		}
+	}
+	signUps, signIns, sessions := report.Operations[0], report.Operations[1], report.Operations[2]
+	if signUps.Requests != 4 || signIns.Requests == 0 || sessions.Requests < signIns.Requests {
+		t.Errorf("requests: %d sign-ups, %d sign-ins, %d session reads", signUps.Requests, signIns.Requests, sessions.Requests)
+	}
+}
+
+func TestRun_Errors(t *testing.T) {
+	server := fakeAuth(t, http.StatusServiceUnavailable)
+	report, err := Run(context.Background(), &Config{
+		BaseURL:  server.URL,
+		Users:    1,
+		Duration: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	sessions := report.Operations[2]
+	if sessions.Errors == 0 || sessions.Errors != sessions.Requests || len(sessions.ErrorSamples) == 0 {
+		t.Errorf("session reads = %+v, want every one failed", sessions)
+	}
+
+	if _, err := Run(context.Background(), &Config{}); err == nil {
+		t.Error("Run() without a base URL succeeded")
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var latencies []time.Duration
+	for i := 1; i <= 100; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	if got := percentile(latencies, 50); got != 50*time.Millisecond {
+		t.Errorf("p50 = %v, want 50ms", got)
+	}
+	if got := percentile(latencies, 99); got != 99*time.Millisecond {
+		t.Errorf("p99 = %v, want 99ms", got)
+	}
+	if got := percentile(nil, 99); got != 0 {
+		t.Errorf("p99 of nothing = %v, want 0", got)
+	}
+}
@@ -1,12 +1,20 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/marshallshelly/beacon-auth/cmd/beacon/loadtest"
+	"github.com/marshallshelly/beacon-auth/cmd/beacon/migrate"
 	"github.com/marshallshelly/beacon-auth/cmd/beacon/schema"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/crypto"
 )
 
 func main() {
@@ -22,6 +30,12 @@ func main() {
 		handleInit()
 	case "generate":
 		handleGenerate(os.Args[2:])
+	case "doctor":
+		handleDoctor(os.Args[2:])
+	case "migrate":
+		handleMigrate(os.Args[2:])
+	case "loadtest":
+		handleLoadtest(os.Args[2:])
 	default:
 		fmt.Printf("Unknown command: %s\n", command)
 		printUsage()
@@ -38,16 +52,56 @@ Usage:
 Commands:
   init      Initialize BeaconAuth configuration
   generate  Generate SQL schema for your database
+  doctor    Show the security posture of the default configuration
+  migrate   Import users, accounts and sessions from another auth library
+  loadtest  Measure sign-up, sign-in and session latency of a running instance
 
 Generate Flags:
-  --adapter   Database adapter (postgres, mysql, sqlite, mssql) [required]
-  --plugins   Comma-separated list of plugins (e.g., twofa,oauth)
+  --adapter   Database adapter (postgres, cockroach, mysql, sqlite, mssql) [required]
+  --plugins   Comma-separated list of plugins (e.g., twofa,consent,oidcprovider);
+              plugins that store data of their own get their tables
   --id-type   ID generation strategy (string, uuid, serial) [default: string]
+  --schema    Database schema for tables (mssql only)
+  --tables    Comma-separated table renames (e.g., users=auth_users,sessions=auth_sessions)
+  --table-prefix  Prefix for every table not renamed by --tables (e.g., auth_)
+  --tenancy   Add tenant_id columns and make emails unique per tenant
   --output    Output file path (optional, defaults to stdout)
 
+Doctor Flags:
+  --json      Print the posture as JSON
+
+Migrate Flags:
+  --from        Source schema (nextauth, better-auth, devise, beacon-legacy) [required]
+  --source      Source database URL [required]
+  --target      Target database URL (defaults to --source)
+  --mapping     JSON file adjusting source tables and columns
+  --tables      Comma-separated BeaconAuth table renames
+  --table-prefix  Prefix for every BeaconAuth table not renamed by --tables
+  --dry-run     Convert rows and report without writing
+  --batch-size  Rows read per query [default: 500]
+  --json        Print the report as JSON
+
+Loadtest Flags:
+  --url           Base URL of the instance under test [required]
+  --users         Concurrent virtual users [default: 10]
+  --duration      How long to run [default: 30s]
+  --sessions      Session reads per sign-in [default: 10]
+  --signup-path   Sign-up endpoint [default: /auth/signup]
+  --signin-path   Sign-in endpoint [default: /auth/signin]
+  --session-path  Session endpoint [default: /auth/session]
+  --password      Password of the created users
+  --json          Print the report as JSON
+
 Examples:
   beacon generate --adapter postgres --plugins twofa --id-type uuid
   beacon generate --adapter sqlite --id-type string
+  beacon generate --adapter cockroach --id-type uuid
+  beacon generate --adapter mysql --tables users=auth_users,sessions=auth_sessions
+  beacon generate --adapter postgres --table-prefix auth_
+  beacon doctor --json
+  beacon migrate --from nextauth --source postgres://localhost/app --dry-run
+  beacon migrate --from beacon-legacy --source postgres://localhost/app
+  beacon loadtest --url http://localhost:8080 --users 50 --duration 1m
 `)
 }
 
@@ -59,10 +113,14 @@ func handleInit() {
 
 func handleGenerate(args []string) {
 	generateCmd := flag.NewFlagSet("generate", flag.ExitOnError)
-	adapter := generateCmd.String("adapter", "", "Database adapter (postgres, mysql, sqlite, mssql)")
-	plugins := generateCmd.String("plugins", "", "Comma-separated list of plugins")
+	adapter := generateCmd.String("adapter", "", "Database adapter (postgres, cockroach, mysql, sqlite, mssql)")
+	plugins := generateCmd.String("plugins", "", "Comma-separated list of plugins ("+strings.Join(schema.Registered(), ", ")+")")
 	idType := generateCmd.String("id-type", "string", "ID generation strategy (string, uuid, serial)")
 	output := generateCmd.String("output", "", "Output file path")
+	dbSchema := generateCmd.String("schema", "", "Database schema for tables (mssql only, e.g. auth)")
+	tables := generateCmd.String("tables", "", "Comma-separated table renames (e.g. users=auth_users)")
+	tablePrefix := generateCmd.String("table-prefix", "", "Prefix for every table not renamed by --tables (e.g. auth_)")
+	tenancy := generateCmd.Bool("tenancy", false, "Add tenant_id columns and per-tenant email uniqueness")
 
 	if err := generateCmd.Parse(args); err != nil {
 		fmt.Printf("Error parsing flags: %v\n", err)
@@ -75,9 +133,9 @@ func handleGenerate(args []string) {
 		os.Exit(1)
 	}
 
-	validAdapters := map[string]bool{"postgres": true, "mysql": true, "sqlite": true, "mssql": true}
+	validAdapters := map[string]bool{"postgres": true, "cockroach": true, "mysql": true, "sqlite": true, "mssql": true}
 	if !validAdapters[*adapter] {
-		fmt.Printf("Error: invalid adapter '%s'. Must be one of: postgres, mysql, sqlite, mssql\n", *adapter)
+		fmt.Printf("Error: invalid adapter '%s'. Must be one of: postgres, cockroach, mysql, sqlite, mssql\n", *adapter)
 		os.Exit(1)
 	}
 
@@ -95,10 +153,19 @@ func handleGenerate(args []string) {
 		}
 	}
 
+	tableNames, err := parseTableNames(*tables, *tablePrefix)
+	if err != nil {
+		fmt.Printf("Error: invalid --tables or --table-prefix: %v\n", err)
+		os.Exit(1)
+	}
+
 	cfg := &schema.Config{
-		Adapter: *adapter,
-		Plugins: pluginList,
-		IDType:  *idType,
+		Adapter:    *adapter,
+		Plugins:    pluginList,
+		IDType:     *idType,
+		Schema:     *dbSchema,
+		TableNames: tableNames,
+		Tenancy:    *tenancy,
 	}
 
 	sql, err := schema.GenerateSQL(cfg)
@@ -107,6 +174,11 @@ func handleGenerate(args []string) {
 		os.Exit(1)
 	}
 
+	if err := schema.Validate(sql, cfg.Adapter); err != nil {
+		fmt.Printf("Generated SQL failed validation: %v\n", err)
+		os.Exit(1)
+	}
+
 	if *output != "" {
 		if err := os.WriteFile(*output, []byte(sql), 0644); err != nil {
 			fmt.Printf("Error writing to file: %v\n", err)
@@ -117,3 +189,265 @@ func handleGenerate(args []string) {
 		fmt.Println(sql)
 	}
 }
+
+// handleDoctor prints the security posture of BeaconAuth's defaults.
+// Applications log their effective posture at startup.
+func handleDoctor(args []string) {
+	doctorCmd := flag.NewFlagSet("doctor", flag.ExitOnError)
+	asJSON := doctorCmd.Bool("json", false, "Print the posture as JSON")
+
+	if err := doctorCmd.Parse(args); err != nil {
+		fmt.Printf("Error parsing flags: %v\n", err)
+		os.Exit(1)
+	}
+
+	posture := core.DescribeSecurity(core.DefaultConfig(), crypto.NewDefaultHasher(), nil)
+
+	if *asJSON {
+		data, err := json.MarshalIndent(posture, "", "  ")
+		if err != nil {
+			fmt.Printf("Error encoding posture: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	fmt.Println("Security posture (default configuration):")
+	fields := posture.LogFields()
+	for i := 0; i+1 < len(fields); i += 2 {
+		fmt.Printf("  %s: %v\n", fields[i], fields[i+1])
+	}
+
+	if len(posture.Warnings) > 0 {
+		fmt.Println("\nWarnings:")
+		for _, w := range posture.Warnings {
+			fmt.Printf("  - %s\n", w)
+		}
+	}
+}
+
+// handleMigrate imports data from another auth library's schema
+func handleMigrate(args []string) {
+	migrateCmd := flag.NewFlagSet("migrate", flag.ExitOnError)
+	from := migrateCmd.String("from", "", "Source schema (nextauth, better-auth, devise, beacon-legacy)")
+	source := migrateCmd.String("source", "", "Source database URL")
+	target := migrateCmd.String("target", "", "Target database URL (defaults to --source)")
+	mappingFile := migrateCmd.String("mapping", "", "JSON file adjusting source tables and columns")
+	tables := migrateCmd.String("tables", "", "Comma-separated table renames (e.g. users=auth_users)")
+	tablePrefix := migrateCmd.String("table-prefix", "", "Prefix for every table not renamed by --tables (e.g. auth_)")
+	dryRun := migrateCmd.Bool("dry-run", false, "Convert rows and report without writing")
+	batchSize := migrateCmd.Int("batch-size", migrate.DefaultBatchSize, "Rows read per query")
+	asJSON := migrateCmd.Bool("json", false, "Print the report as JSON")
+
+	if err := migrateCmd.Parse(args); err != nil {
+		fmt.Printf("Error parsing flags: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *from == "" || *source == "" {
+		fmt.Println("Error: --from and --source are required")
+		migrateCmd.PrintDefaults()
+		os.Exit(1)
+	}
+
+	mapping, err := migrate.Preset(migrate.Source(*from))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *mappingFile != "" {
+		f, err := os.Open(*mappingFile)
+		if err != nil {
+			fmt.Printf("Error reading mapping: %v\n", err)
+			os.Exit(1)
+		}
+		overrides, err := migrate.ParseOverrides(f)
+		f.Close()
+		if err == nil {
+			err = mapping.ApplyOverrides(overrides)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	tableNames, err := parseTableNames(*tables, *tablePrefix)
+	if err != nil {
+		fmt.Printf("Error: invalid --tables or --table-prefix: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+
+	sourceAdapter, err := openAdapter(ctx, *source)
+	if err != nil {
+		fmt.Printf("Error connecting to source: %v\n", err)
+		os.Exit(1)
+	}
+	defer sourceAdapter.Close()
+
+	targetAdapter := sourceAdapter
+	if *target != "" {
+		targetAdapter, err = openAdapter(ctx, *target)
+		if err != nil {
+			fmt.Printf("Error connecting to target: %v\n", err)
+			os.Exit(1)
+		}
+		defer targetAdapter.Close()
+	}
+
+	report, err := migrate.Run(ctx, &migrate.Config{
+		Source:     sourceAdapter,
+		Target:     targetAdapter,
+		Mapping:    mapping,
+		TableNames: tableNames,
+		DryRun:     *dryRun,
+		BatchSize:  *batchSize,
+	})
+	if report != nil {
+		printMigrateReport(report, *asJSON)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// handleLoadtest drives auth traffic against a running instance and prints
+// latency percentiles
+func handleLoadtest(args []string) {
+	loadtestCmd := flag.NewFlagSet("loadtest", flag.ExitOnError)
+	baseURL := loadtestCmd.String("url", "", "Base URL of the instance under test (e.g. http://localhost:8080)")
+	users := loadtestCmd.Int("users", loadtest.DefaultUsers, "Concurrent virtual users")
+	duration := loadtestCmd.Duration("duration", loadtest.DefaultDuration, "How long to run")
+	sessions := loadtestCmd.Int("sessions", loadtest.DefaultSessionsPerSignIn, "Session reads per sign-in")
+	signUpPath := loadtestCmd.String("signup-path", loadtest.DefaultSignUpPath, "Sign-up endpoint")
+	signInPath := loadtestCmd.String("signin-path", loadtest.DefaultSignInPath, "Sign-in endpoint")
+	sessionPath := loadtestCmd.String("session-path", loadtest.DefaultSessionPath, "Session endpoint")
+	password := loadtestCmd.String("password", loadtest.DefaultPassword, "Password of the created users")
+	asJSON := loadtestCmd.Bool("json", false, "Print the report as JSON")
+
+	if err := loadtestCmd.Parse(args); err != nil {
+		fmt.Printf("Error parsing flags: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *baseURL == "" {
+		fmt.Println("Error: --url is required")
+		loadtestCmd.PrintDefaults()
+		os.Exit(1)
+	}
+
+	report, err := loadtest.Run(context.Background(), &loadtest.Config{
+		BaseURL:           *baseURL,
+		SignUpPath:        *signUpPath,
+		SignInPath:        *signInPath,
+		SessionPath:       *sessionPath,
+		Users:             *users,
+		Duration:          *duration,
+		SessionsPerSignIn: *sessions,
+		Password:          *password,
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *asJSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Printf("Error encoding report: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	fmt.Printf("%d users for %s\n", report.Users, report.Elapsed.Round(time.Millisecond))
+	for _, op := range report.Operations {
+		fmt.Printf("%-8s requests %d, errors %d, p50 %s, p99 %s, max %s, %.1f req/s\n",
+			op.Operation, op.Requests, op.Errors,
+			op.P50.Round(time.Microsecond), op.P99.Round(time.Microsecond), op.Max.Round(time.Microsecond), op.Throughput)
+		for _, e := range op.ErrorSamples {
+			fmt.Printf("  - %s\n", e)
+		}
+	}
+}
+
+func printMigrateReport(report *migrate.Report, asJSON bool) {
+	if asJSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Printf("Error encoding report: %v\n", err)
+			return
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	if report.DryRun {
+		fmt.Println("Dry run, nothing was written.")
+	}
+	for _, m := range report.Models {
+		fmt.Printf("%s (from %s): read %d, imported %d, existing %d, invalid %d, failed %d\n",
+			m.Model, m.SourceTable, m.Read, m.Imported, m.Existing, m.Invalid, m.Failed)
+
+		algorithms := make([]string, 0, len(m.PasswordHashes))
+		for algorithm := range m.PasswordHashes {
+			algorithms = append(algorithms, algorithm)
+		}
+		sort.Strings(algorithms)
+		for _, algorithm := range algorithms {
+			fmt.Printf("  password hashes (%s): %d\n", algorithm, m.PasswordHashes[algorithm])
+		}
+		if m.PasswordHashes[migrate.UnknownHashAlgorithm] > 0 {
+			fmt.Println("  users with unknown password hashes must reset their password")
+		}
+
+		for _, e := range m.Errors {
+			fmt.Printf("  - %s\n", e)
+		}
+	}
+}
+
+// parseTableNames parses "model=table" pairs such as
+// "users=auth_users,two_factors=auth_two_factors"; prefix applies to the
+// tables not renamed
+func parseTableNames(value, prefix string) (*core.TableNames, error) {
+	if value == "" && prefix == "" {
+		return nil, nil
+	}
+
+	names := &core.TableNames{Prefix: prefix}
+	if value == "" {
+		return names, names.Validate()
+	}
+	for _, pair := range strings.Split(value, ",") {
+		model, table, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("expected model=table, got %q", pair)
+		}
+		model, table = strings.TrimSpace(model), strings.TrimSpace(table)
+
+		switch model {
+		case core.ModelUsers:
+			names.Users = table
+		case core.ModelSessions:
+			names.Sessions = table
+		case core.ModelAccounts:
+			names.Accounts = table
+		case core.ModelVerifications:
+			names.Verifications = table
+		default:
+			if names.Plugins == nil {
+				names.Plugins = make(map[string]string)
+			}
+			names.Plugins[model] = table
+		}
+	}
+
+	return names, names.Validate()
+}
@@ -0,0 +1,514 @@
+package migrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// Transform converts a non-NULL source value
+type Transform func(value interface{}) (interface{}, error)
+
+// Field fills one BeaconAuth column
+type Field struct {
+	// Column is the source column to read
+	Column string
+
+	// Transform converts the source value (optional)
+	Transform Transform
+
+	// Value is used when Column is empty or the source value is NULL
+	Value interface{}
+}
+
+// TableMapping maps a source table onto a BeaconAuth table
+type TableMapping struct {
+	// Table is the source table name, quoted if the dialect needs it
+	// (e.g. `"user"` on PostgreSQL)
+	Table string
+
+	// Fields maps BeaconAuth columns to their source. Rows without a
+	// mapped id get a generated one.
+	Fields map[string]Field
+
+	// Required lists extra BeaconAuth columns that must be set, or the row
+	// is skipped (e.g. password for credential accounts)
+	Required []string
+}
+
+// Mapping describes how a source schema maps onto BeaconAuth. Models
+// without a mapping are not imported.
+type Mapping struct {
+	Users         *TableMapping
+	Accounts      *TableMapping
+	Sessions      *TableMapping
+	Verifications *TableMapping
+}
+
+// Source names a supported source schema
+type Source string
+
+const (
+	// SourceNextAuth is the NextAuth.js / Auth.js SQL adapter schema
+	SourceNextAuth Source = "nextauth"
+
+	// SourceBetterAuth is the Better-Auth schema
+	SourceBetterAuth Source = "better-auth"
+
+	// SourceDevise is the Ruby on Rails Devise users table
+	SourceDevise Source = "devise"
+
+	// SourceBeaconLegacy is the accounts table of BeaconAuth v0.6.1 and
+	// earlier, which kept the provider in "provider" and the password hash
+	// in "password_hash", renamed to accounts_legacy
+	SourceBeaconLegacy Source = "beacon-legacy"
+)
+
+// Sources lists the supported source schemas
+func Sources() []Source {
+	return []Source{SourceNextAuth, SourceBetterAuth, SourceDevise, SourceBeaconLegacy}
+}
+
+// Preset returns the default mapping for a source schema. Adjust table and
+// column names for customized schemas with ApplyOverrides.
+func Preset(source Source) (*Mapping, error) {
+	switch source {
+	case SourceNextAuth:
+		return nextAuthMapping(), nil
+	case SourceBetterAuth:
+		return betterAuthMapping(), nil
+	case SourceDevise:
+		return deviseMapping(), nil
+	case SourceBeaconLegacy:
+		return beaconLegacyMapping(), nil
+	default:
+		return nil, fmt.Errorf("unsupported source: %s", source)
+	}
+}
+
+// nextAuthMapping maps the Auth.js SQL adapter tables (users, accounts,
+// sessions, verification_token). The Prisma adapter uses the same columns
+// in User, Account, Session and VerificationToken tables.
+func nextAuthMapping() *Mapping {
+	return &Mapping{
+		Users: &TableMapping{
+			Table: "users",
+			Fields: map[string]Field{
+				"id":             {Column: "id", Transform: ToString},
+				"email":          {Column: "email"},
+				"email_verified": {Column: "emailVerified", Transform: NotNull, Value: false},
+				"name":           {Column: "name"},
+				"image":          {Column: "image"},
+			},
+		},
+		Accounts: &TableMapping{
+			Table: "accounts",
+			Fields: map[string]Field{
+				"id":                      {Column: "id", Transform: ToString},
+				"user_id":                 {Column: "userId", Transform: ToString},
+				"account_id":              {Column: "providerAccountId"},
+				"provider_id":             {Column: "provider"},
+				"provider_type":           {Column: "type", Transform: nextAuthProviderType},
+				"access_token":            {Column: "access_token"},
+				"refresh_token":           {Column: "refresh_token"},
+				"access_token_expires_at": {Column: "expires_at", Transform: UnixSeconds},
+				"scope":                   {Column: "scope"},
+				"id_token":                {Column: "id_token"},
+			},
+		},
+		Sessions: &TableMapping{
+			Table: "sessions",
+			Fields: map[string]Field{
+				"id":         {Column: "id", Transform: ToString},
+				"user_id":    {Column: "userId", Transform: ToString},
+				"token":      {Column: "sessionToken"},
+				"expires_at": {Column: "expires"},
+			},
+		},
+		Verifications: &TableMapping{
+			Table: "verification_token",
+			Fields: map[string]Field{
+				"identifier": {Column: "identifier"},
+				"token":      {Column: "token"},
+				"type":       {Value: "email"},
+				"expires_at": {Column: "expires"},
+			},
+		},
+	}
+}
+
+// nextAuthProviderType maps Auth.js account types onto BeaconAuth's
+// provider types. OIDC accounts are OAuth accounts.
+func nextAuthProviderType(v interface{}) (interface{}, error) {
+	switch s := fmt.Sprint(v); s {
+	case "oidc":
+		return "oauth", nil
+	case "credentials":
+		return "credential", nil
+	default:
+		return s, nil
+	}
+}
+
+// betterAuthMapping maps the Better-Auth core tables (user, account,
+// session, verification)
+func betterAuthMapping() *Mapping {
+	return &Mapping{
+		Users: &TableMapping{
+			Table: "user",
+			Fields: map[string]Field{
+				"id":             {Column: "id", Transform: ToString},
+				"email":          {Column: "email"},
+				"email_verified": {Column: "emailVerified", Value: false},
+				"name":           {Column: "name"},
+				"image":          {Column: "image"},
+				"role":           {Column: "role"},
+				"banned":         {Column: "banned"},
+				"ban_reason":     {Column: "banReason"},
+				"ban_expires":    {Column: "banExpires"},
+				"created_at":     {Column: "createdAt"},
+				"updated_at":     {Column: "updatedAt"},
+			},
+		},
+		Accounts: &TableMapping{
+			Table: "account",
+			Fields: map[string]Field{
+				"id":                       {Column: "id", Transform: ToString},
+				"user_id":                  {Column: "userId", Transform: ToString},
+				"account_id":               {Column: "accountId"},
+				"provider_id":              {Column: "providerId", Transform: betterAuthProviderID},
+				"provider_type":            {Column: "providerId", Transform: betterAuthProviderType},
+				"password":                 {Column: "password"},
+				"access_token":             {Column: "accessToken"},
+				"refresh_token":            {Column: "refreshToken"},
+				"access_token_expires_at":  {Column: "accessTokenExpiresAt"},
+				"refresh_token_expires_at": {Column: "refreshTokenExpiresAt"},
+				"scope":                    {Column: "scope"},
+				"id_token":                 {Column: "idToken"},
+				"created_at":               {Column: "createdAt"},
+				"updated_at":               {Column: "updatedAt"},
+			},
+		},
+		Sessions: &TableMapping{
+			Table: "session",
+			Fields: map[string]Field{
+				"id":              {Column: "id", Transform: ToString},
+				"user_id":         {Column: "userId", Transform: ToString},
+				"token":           {Column: "token"},
+				"expires_at":      {Column: "expiresAt"},
+				"ip_address":      {Column: "ipAddress"},
+				"user_agent":      {Column: "userAgent"},
+				"impersonated_by": {Column: "impersonatedBy"},
+				"created_at":      {Column: "createdAt"},
+				"updated_at":      {Column: "updatedAt"},
+			},
+		},
+		Verifications: &TableMapping{
+			Table: "verification",
+			Fields: map[string]Field{
+				"id":         {Column: "id", Transform: ToString},
+				"identifier": {Column: "identifier"},
+				"token":      {Column: "value"},
+				"type":       {Value: "email"},
+				"expires_at": {Column: "expiresAt"},
+				"created_at": {Column: "createdAt"},
+				"updated_at": {Column: "updatedAt"},
+			},
+		},
+	}
+}
+
+// betterAuthProviderID maps Better-Auth's email/password provider onto
+// BeaconAuth's "local" provider
+func betterAuthProviderID(v interface{}) (interface{}, error) {
+	if s := fmt.Sprint(v); s != "credential" {
+		return s, nil
+	}
+	return "local", nil
+}
+
+func betterAuthProviderType(v interface{}) (interface{}, error) {
+	if fmt.Sprint(v) == "credential" {
+		return "credential", nil
+	}
+	return "oauth", nil
+}
+
+// deviseMapping maps the Devise users table. Devise keeps the password
+// hash on the user, so each user with a password also becomes a
+// credential account. Devise sessions live in the Rails cookie store and
+// are not imported.
+func deviseMapping() *Mapping {
+	return &Mapping{
+		Users: &TableMapping{
+			Table: "users",
+			Fields: map[string]Field{
+				"id":             {Column: "id", Transform: ToString},
+				"email":          {Column: "email"},
+				"email_verified": {Column: "confirmed_at", Transform: NotNull, Value: false},
+				"created_at":     {Column: "created_at"},
+				"updated_at":     {Column: "updated_at"},
+			},
+		},
+		Accounts: &TableMapping{
+			Table: "users",
+			Fields: map[string]Field{
+				"id":            {Column: "id", Transform: ToString},
+				"user_id":       {Column: "id", Transform: ToString},
+				"account_id":    {Column: "email"},
+				"provider_id":   {Value: "local"},
+				"provider_type": {Value: "credential"},
+				"password":      {Column: "encrypted_password"},
+				"created_at":    {Column: "created_at"},
+				"updated_at":    {Column: "updated_at"},
+			},
+			Required: []string{"password"},
+		},
+	}
+}
+
+// beaconLegacyMapping moves accounts from the pre-v0.6.2 columns onto the
+// current ones. Users, sessions and verifications did not change. The old
+// table must be renamed to accounts_legacy and a current accounts table
+// created (`beacon generate`) before the import.
+func beaconLegacyMapping() *Mapping {
+	return &Mapping{
+		Accounts: &TableMapping{
+			Table: "accounts_legacy",
+			Fields: map[string]Field{
+				"id":            {Column: "id", Transform: ToString},
+				"user_id":       {Column: "user_id", Transform: ToString},
+				"account_id":    {Column: "account_id"},
+				"provider_id":   {Column: "provider", Transform: beaconLegacyProviderID},
+				"provider_type": {Column: "password_hash", Transform: beaconLegacyProviderType, Value: "oauth"},
+				"password":      {Column: "password_hash"},
+				"access_token":  {Column: "access_token"},
+				"refresh_token": {Column: "refresh_token"},
+				"created_at":    {Column: "created_at"},
+				"updated_at":    {Column: "updated_at"},
+			},
+		},
+	}
+}
+
+// beaconLegacyProviderID maps the names old versions used for email and
+// password accounts onto "local"
+func beaconLegacyProviderID(v interface{}) (interface{}, error) {
+	switch s := fmt.Sprint(v); s {
+	case "credential", "credentials", "email":
+		return "local", nil
+	default:
+		return s, nil
+	}
+}
+
+// beaconLegacyProviderType makes accounts with a password hash credential
+// accounts. The others fall back to "oauth".
+func beaconLegacyProviderType(v interface{}) (interface{}, error) {
+	if isEmpty(v) {
+		return nil, nil
+	}
+	return "credential", nil
+}
+
+// ToString converts IDs of any type to strings, e.g. integer primary keys
+func ToString(v interface{}) (interface{}, error) {
+	switch s := v.(type) {
+	case string:
+		return s, nil
+	case []byte:
+		return string(s), nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// NotNull converts a nullable timestamp (e.g. emailVerified) to true
+func NotNull(v interface{}) (interface{}, error) {
+	return v != nil, nil
+}
+
+// UnixSeconds converts a Unix timestamp in seconds to a time
+func UnixSeconds(v interface{}) (interface{}, error) {
+	switch n := v.(type) {
+	case int64:
+		return time.Unix(n, 0), nil
+	case int32:
+		return time.Unix(int64(n), 0), nil
+	case int:
+		return time.Unix(int64(n), 0), nil
+	case float64:
+		return time.Unix(int64(n), 0), nil
+	default:
+		i, err := strconv.ParseInt(strings.TrimSpace(fmt.Sprint(v)), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Unix timestamp %v", v)
+		}
+		return time.Unix(i, 0), nil
+	}
+}
+
+// timeLayouts are the text timestamp formats SQL drivers return
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+func toTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case *time.Time:
+		if t != nil {
+			return *t, nil
+		}
+	case []byte:
+		return toTime(string(t))
+	case string:
+		for _, layout := range timeLayouts {
+			if parsed, err := time.Parse(layout, t); err == nil {
+				return parsed, nil
+			}
+		}
+	case int64:
+		// Unix milliseconds, as stored by SQLite-backed JavaScript libraries
+		return time.UnixMilli(t), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %v", v)
+}
+
+func toBool(v interface{}) (bool, error) {
+	switch b := v.(type) {
+	case bool:
+		return b, nil
+	case int64:
+		return b != 0, nil
+	case int:
+		return b != 0, nil
+	case []byte:
+		return toBool(string(b))
+	case string:
+		parsed, err := strconv.ParseBool(b)
+		if err != nil {
+			return false, fmt.Errorf("invalid boolean %q", b)
+		}
+		return parsed, nil
+	}
+	return false, fmt.Errorf("invalid boolean %v", v)
+}
+
+// key returns the BeaconAuth column identifying rows for duplicate checks
+func (tm *TableMapping) key() string {
+	if f, ok := tm.Fields["id"]; ok && f.Column != "" {
+		return "id"
+	}
+	if f, ok := tm.Fields["token"]; ok && f.Column != "" {
+		return "token"
+	}
+	return ""
+}
+
+type mappedModel struct {
+	name  string
+	table *TableMapping
+}
+
+// models returns the mapped models in import order
+func (m *Mapping) models() []mappedModel {
+	var models []mappedModel
+	for _, model := range []mappedModel{
+		{core.ModelUsers, m.Users},
+		{core.ModelAccounts, m.Accounts},
+		{core.ModelSessions, m.Sessions},
+		{core.ModelVerifications, m.Verifications},
+	} {
+		if model.table != nil {
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+// TableOverride adjusts one model of a mapping. It is the JSON format
+// accepted by ApplyOverrides and `beacon migrate --mapping`.
+type TableOverride struct {
+	// Table renames the source table
+	Table string `json:"table,omitempty"`
+
+	// Fields maps BeaconAuth columns to source columns. The preset's
+	// conversion for the column is kept.
+	Fields map[string]string `json:"fields,omitempty"`
+
+	// Values sets BeaconAuth columns to constants
+	Values map[string]interface{} `json:"values,omitempty"`
+
+	// Skip drops the model from the import
+	Skip bool `json:"skip,omitempty"`
+}
+
+// Overrides adjusts a preset mapping, keyed by BeaconAuth model name
+// ("users", "accounts", "sessions", "verifications")
+type Overrides map[string]TableOverride
+
+// ParseOverrides reads overrides from JSON
+func ParseOverrides(r io.Reader) (Overrides, error) {
+	var o Overrides
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&o); err != nil {
+		return nil, fmt.Errorf("invalid mapping: %w", err)
+	}
+	return o, nil
+}
+
+// ApplyOverrides adjusts the mapping. Overrides for models the mapping
+// does not cover must name a source table.
+func (m *Mapping) ApplyOverrides(o Overrides) error {
+	targets := map[string]**TableMapping{
+		core.ModelUsers:         &m.Users,
+		core.ModelAccounts:      &m.Accounts,
+		core.ModelSessions:      &m.Sessions,
+		core.ModelVerifications: &m.Verifications,
+	}
+
+	for model, override := range o {
+		target, ok := targets[model]
+		if !ok {
+			return fmt.Errorf("unknown model in mapping: %s", model)
+		}
+		if override.Skip {
+			*target = nil
+			continue
+		}
+
+		tm := *target
+		if tm == nil {
+			if override.Table == "" {
+				return fmt.Errorf("mapping for %s needs a source table", model)
+			}
+			tm = &TableMapping{Fields: make(map[string]Field)}
+			*target = tm
+		}
+		if override.Table != "" {
+			tm.Table = override.Table
+		}
+		for column, source := range override.Fields {
+			field := tm.Fields[column]
+			field.Column = source
+			tm.Fields[column] = field
+		}
+		for column, value := range override.Values {
+			tm.Fields[column] = Field{Value: value}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,315 @@
+// Package migrate imports users, accounts, sessions and verification tokens
+// from other authentication libraries into BeaconAuth tables.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/crypto"
+)
+
+// DefaultBatchSize is the number of source rows read per query
+const DefaultBatchSize = 500
+
+// maxReportedErrors caps the row errors kept per model in a report
+const maxReportedErrors = 20
+
+// UnknownHashAlgorithm counts password hashes BeaconAuth cannot verify in
+// ModelReport.PasswordHashes
+const UnknownHashAlgorithm = "unknown"
+
+// Config configures an import
+type Config struct {
+	// Source reads the existing auth tables
+	Source core.Adapter
+
+	// Target writes the BeaconAuth tables. It may be the same adapter as
+	// Source when both schemas live in one database.
+	Target core.Adapter
+
+	// Mapping describes the source schema, usually a Preset with
+	// overrides applied
+	Mapping *Mapping
+
+	// TableNames overrides the BeaconAuth table names in the target
+	TableNames *core.TableNames
+
+	// DryRun reads and converts every row and reports what would be
+	// imported without writing anything
+	DryRun bool
+
+	// BatchSize is the number of rows read per query (default 500)
+	BatchSize int
+}
+
+// ModelReport summarizes the import of one BeaconAuth model
+type ModelReport struct {
+	Model       string `json:"model"`
+	SourceTable string `json:"sourceTable"`
+
+	// Read counts source rows
+	Read int `json:"read"`
+
+	// Imported counts rows written, or that would be written in a dry run
+	Imported int `json:"imported"`
+
+	// Existing counts rows skipped because they are already in the target
+	Existing int `json:"existing"`
+
+	// Invalid counts rows skipped because a required value is missing or
+	// could not be converted
+	Invalid int `json:"invalid"`
+
+	// Failed counts rows the target rejected
+	Failed int `json:"failed"`
+
+	// PasswordHashes counts credential password hashes by algorithm. Hashes
+	// BeaconAuth cannot verify are counted as UnknownHashAlgorithm; those
+	// users must reset their password.
+	PasswordHashes map[string]int `json:"passwordHashes,omitempty"`
+
+	// Errors lists the first row errors
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Report summarizes an import
+type Report struct {
+	DryRun bool          `json:"dryRun"`
+	Models []ModelReport `json:"models"`
+}
+
+// Run imports the mapped models in dependency order: users, accounts,
+// sessions, then verifications. Rows whose key (id, or token when no id is
+// mapped) already exists in the target are skipped, so an interrupted
+// import can be run again.
+func Run(ctx context.Context, cfg *Config) (*Report, error) {
+	if cfg == nil || cfg.Source == nil {
+		return nil, errors.New("a source adapter is required")
+	}
+	if cfg.Target == nil && !cfg.DryRun {
+		return nil, errors.New("a target adapter is required")
+	}
+	if cfg.Mapping == nil {
+		return nil, errors.New("a mapping is required")
+	}
+	if err := cfg.TableNames.Validate(); err != nil {
+		return nil, err
+	}
+
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	report := &Report{DryRun: cfg.DryRun}
+	for _, model := range cfg.Mapping.models() {
+		mr, err := importModel(ctx, cfg, model.name, model.table, batchSize)
+		if err != nil {
+			return report, fmt.Errorf("failed to import %s: %w", model.name, err)
+		}
+		report.Models = append(report.Models, *mr)
+	}
+
+	return report, nil
+}
+
+// importModel copies one source table into a BeaconAuth table
+func importModel(ctx context.Context, cfg *Config, model string, tm *TableMapping, batchSize int) (*ModelReport, error) {
+	mr := &ModelReport{Model: model, SourceTable: tm.Table}
+	target := cfg.TableNames.Table(model)
+	key := tm.key()
+
+	query := &core.Query{Model: tm.Table, Limit: batchSize}
+	if key != "" {
+		// A stable order keeps pages from overlapping
+		query.OrderBy = []core.OrderBy{{Field: tm.Fields[key].Column}}
+	}
+
+	for {
+		rows, err := cfg.Source.FindMany(ctx, query)
+		if err != nil {
+			return mr, fmt.Errorf("failed to read %s: %w", tm.Table, err)
+		}
+
+		for _, row := range rows {
+			mr.Read++
+
+			record, err := tm.convert(row, model)
+			if err != nil {
+				mr.Invalid++
+				mr.addError(mr.Read, err)
+				continue
+			}
+
+			if model == core.ModelAccounts {
+				mr.countPassword(record["password"])
+			}
+
+			if key != "" && cfg.Target != nil {
+				existing, err := cfg.Target.FindOne(ctx, &core.Query{
+					Model: target,
+					Where: []core.WhereClause{{Field: key, Operator: core.OpEqual, Value: record[key]}},
+				})
+				if err != nil {
+					return mr, fmt.Errorf("failed to check %s: %w", target, err)
+				}
+				if existing != nil {
+					mr.Existing++
+					continue
+				}
+			}
+
+			if cfg.DryRun {
+				mr.Imported++
+				continue
+			}
+
+			if _, ok := record["id"]; !ok {
+				id, err := crypto.GenerateID()
+				if err != nil {
+					return mr, err
+				}
+				record["id"] = id
+			}
+
+			if _, err := cfg.Target.Create(ctx, target, record); err != nil {
+				mr.Failed++
+				mr.addError(mr.Read, err)
+				continue
+			}
+			mr.Imported++
+		}
+
+		if len(rows) < batchSize {
+			return mr, nil
+		}
+		query.Offset += batchSize
+	}
+}
+
+func (mr *ModelReport) addError(row int, err error) {
+	if len(mr.Errors) < maxReportedErrors {
+		mr.Errors = append(mr.Errors, fmt.Sprintf("row %d: %v", row, err))
+	}
+}
+
+func (mr *ModelReport) countPassword(v interface{}) {
+	hash, _ := v.(string)
+	if hash == "" {
+		return
+	}
+	if mr.PasswordHashes == nil {
+		mr.PasswordHashes = make(map[string]int)
+	}
+	algorithm := string(crypto.DetectAlgorithm(hash))
+	if algorithm == "" {
+		algorithm = UnknownHashAlgorithm
+	}
+	mr.PasswordHashes[algorithm]++
+}
+
+// requiredColumns lists the BeaconAuth columns every imported row needs
+var requiredColumns = map[string][]string{
+	core.ModelUsers:         {"email"},
+	core.ModelAccounts:      {"user_id", "account_id", "provider_id", "provider_type"},
+	core.ModelSessions:      {"user_id", "token", "expires_at"},
+	core.ModelVerifications: {"identifier", "token", "type", "expires_at"},
+}
+
+// timeColumns lists the BeaconAuth timestamp columns, which are converted
+// from the representations SQL drivers return
+var timeColumns = map[string]bool{
+	"created_at":               true,
+	"updated_at":               true,
+	"expires_at":               true,
+	"ban_expires":              true,
+	"access_token_expires_at":  true,
+	"refresh_token_expires_at": true,
+}
+
+// boolColumns lists the BeaconAuth boolean columns
+var boolColumns = map[string]bool{
+	"email_verified":     true,
+	"two_factor_enabled": true,
+	"banned":             true,
+}
+
+// convert maps a source row onto BeaconAuth columns
+func (tm *TableMapping) convert(row map[string]interface{}, model string) (map[string]interface{}, error) {
+	record := make(map[string]interface{}, len(tm.Fields)+2)
+
+	// Sorted for deterministic error messages
+	columns := make([]string, 0, len(tm.Fields))
+	for column := range tm.Fields {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	for _, column := range columns {
+		field := tm.Fields[column]
+
+		var value interface{}
+		if field.Column != "" {
+			value = row[field.Column]
+		}
+		if field.Transform != nil && value != nil {
+			converted, err := field.Transform(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", column, err)
+			}
+			value = converted
+		}
+		if value == nil {
+			value = field.Value
+		}
+		if value == nil {
+			continue
+		}
+
+		switch {
+		case timeColumns[column]:
+			t, err := toTime(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", column, err)
+			}
+			value = t
+		case boolColumns[column]:
+			b, err := toBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", column, err)
+			}
+			value = b
+		}
+		record[column] = value
+	}
+
+	for _, column := range append(requiredColumns[model], tm.Required...) {
+		if isEmpty(record[column]) {
+			return nil, fmt.Errorf("missing %s", column)
+		}
+	}
+
+	now := time.Now()
+	if _, ok := record["created_at"]; !ok {
+		record["created_at"] = now
+	}
+	if _, ok := record["updated_at"]; !ok {
+		record["updated_at"] = now
+	}
+
+	return record, nil
+}
+
+func isEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	s, ok := v.(string)
+	return ok && strings.TrimSpace(s) == ""
+}
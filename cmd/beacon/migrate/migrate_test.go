@@ -0,0 +1,262 @@
+package migrate
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/adapters/memory"
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+func seed(t *testing.T, adapter core.Adapter, table string, rows ...map[string]interface{}) {
+	t.Helper()
+	for _, row := range rows {
+		if _, err := adapter.Create(context.Background(), table, row); err != nil {
+			t.Fatalf("Failed to seed %s: %v", table, err)
+		}
+	}
+}
+
+func modelReport(t *testing.T, report *Report, model string) ModelReport {
+	t.Helper()
+	for _, m := range report.Models {
+		if m.Model == model {
+			return m
+		}
+	}
+	t.Fatalf("No report for %s", model)
+	return ModelReport{}
+}
+
+func TestRun_NextAuth(t *testing.T) {
+	ctx := context.Background()
+	source := memory.New()
+	target := memory.New()
+
+	verified := time.Now().Add(-time.Hour)
+	expires := time.Now().Add(24 * time.Hour)
+
+	seed(t, source, "users",
+		map[string]interface{}{"id": "u1", "email": "ada@example.com", "name": "Ada", "emailVerified": verified},
+		map[string]interface{}{"id": "u2", "email": "bob@example.com", "emailVerified": nil},
+		map[string]interface{}{"id": "u3", "email": ""},
+	)
+	seed(t, source, "accounts", map[string]interface{}{
+		"id": "a1", "userId": "u1", "type": "oidc", "provider": "google", "providerAccountId": "g-1",
+		"access_token": "at", "expires_at": expires.Unix(),
+	})
+	seed(t, source, "sessions", map[string]interface{}{
+		"id": "s1", "userId": "u1", "sessionToken": "tok-1", "expires": expires,
+	})
+	seed(t, source, "verification_token", map[string]interface{}{
+		"identifier": "bob@example.com", "token": "vt-1", "expires": expires,
+	})
+
+	mapping, err := Preset(SourceNextAuth)
+	if err != nil {
+		t.Fatalf("Preset() error = %v", err)
+	}
+
+	// Dry run converts everything but writes nothing
+	report, err := Run(ctx, &Config{Source: source, Target: target, Mapping: mapping, DryRun: true})
+	if err != nil {
+		t.Fatalf("Run() dry run error = %v", err)
+	}
+	if users := modelReport(t, report, core.ModelUsers); users.Read != 3 || users.Imported != 2 || users.Invalid != 1 {
+		t.Errorf("Dry run users = %+v, want 3 read, 2 imported, 1 invalid", users)
+	}
+	if count, _ := target.Count(ctx, &core.Query{Model: "users"}); count != 0 {
+		t.Fatalf("Dry run wrote %d users", count)
+	}
+
+	report, err = Run(ctx, &Config{Source: source, Target: target, Mapping: mapping, BatchSize: 2})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	for _, model := range []string{core.ModelAccounts, core.ModelSessions, core.ModelVerifications} {
+		if m := modelReport(t, report, model); m.Imported != 1 {
+			t.Errorf("%s imported = %d, want 1 (%v)", model, m.Imported, m.Errors)
+		}
+	}
+
+	user, _ := target.FindOne(ctx, &core.Query{Model: "users", Where: []core.WhereClause{{Field: "id", Operator: core.OpEqual, Value: "u1"}}})
+	if user == nil || user["email_verified"] != true || user["name"] != "Ada" {
+		t.Errorf("Imported user = %v, want verified Ada", user)
+	}
+	unverified, _ := target.FindOne(ctx, &core.Query{Model: "users", Where: []core.WhereClause{{Field: "id", Operator: core.OpEqual, Value: "u2"}}})
+	if unverified == nil || unverified["email_verified"] != false {
+		t.Errorf("Imported user = %v, want unverified", unverified)
+	}
+
+	account, _ := target.FindOne(ctx, &core.Query{Model: "accounts"})
+	if account["provider_type"] != "oauth" || account["account_id"] != "g-1" {
+		t.Errorf("Imported account = %v, want oauth account g-1", account)
+	}
+	if at, ok := account["access_token_expires_at"].(time.Time); !ok || at.Unix() != expires.Unix() {
+		t.Errorf("access_token_expires_at = %v, want %v", account["access_token_expires_at"], expires)
+	}
+
+	verification, _ := target.FindOne(ctx, &core.Query{Model: "verifications"})
+	if verification["id"] == nil || verification["type"] != "email" {
+		t.Errorf("Imported verification = %v, want generated id and email type", verification)
+	}
+
+	// Running again skips rows that were already imported
+	report, err = Run(ctx, &Config{Source: source, Target: target, Mapping: mapping})
+	if err != nil {
+		t.Fatalf("Run() rerun error = %v", err)
+	}
+	if users := modelReport(t, report, core.ModelUsers); users.Imported != 0 || users.Existing != 2 {
+		t.Errorf("Rerun users = %+v, want 2 existing", users)
+	}
+	if v := modelReport(t, report, core.ModelVerifications); v.Existing != 1 {
+		t.Errorf("Rerun verifications = %+v, want 1 existing", v)
+	}
+}
+
+func TestRun_Devise(t *testing.T) {
+	ctx := context.Background()
+	source := memory.New()
+	target := memory.New()
+
+	seed(t, source, "users",
+		map[string]interface{}{
+			"id": int64(1), "email": "ada@example.com", "confirmed_at": time.Now(),
+			"encrypted_password": "$2a$12$R9h/cIPz0gi.URNNX3kh2OPST9/PgBkqquzi.Ss7KIUgO2t0jWMUW",
+		},
+		map[string]interface{}{"id": int64(2), "email": "sso@example.com", "encrypted_password": ""},
+	)
+
+	mapping, _ := Preset(SourceDevise)
+	report, err := Run(ctx, &Config{
+		Source:     source,
+		Target:     target,
+		Mapping:    mapping,
+		TableNames: &core.TableNames{Users: "auth_users"},
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if users := modelReport(t, report, core.ModelUsers); users.Imported != 2 {
+		t.Errorf("Users imported = %d, want 2", users.Imported)
+	}
+	accounts := modelReport(t, report, core.ModelAccounts)
+	if accounts.Imported != 1 || accounts.Invalid != 1 {
+		t.Errorf("Accounts = %+v, want 1 imported and 1 without password", accounts)
+	}
+	if accounts.PasswordHashes["bcrypt"] != 1 {
+		t.Errorf("PasswordHashes = %v, want 1 bcrypt", accounts.PasswordHashes)
+	}
+
+	user, _ := target.FindOne(ctx, &core.Query{Model: "auth_users", Where: []core.WhereClause{{Field: "id", Operator: core.OpEqual, Value: "1"}}})
+	if user == nil {
+		t.Fatal("Expected integer ID to be imported as a string into the renamed table")
+	}
+	account, _ := target.FindOne(ctx, &core.Query{Model: "accounts"})
+	if account["user_id"] != "1" || account["provider_id"] != "local" || account["provider_type"] != "credential" {
+		t.Errorf("Imported account = %v, want local credential account for user 1", account)
+	}
+}
+
+func TestRun_BetterAuthPasswords(t *testing.T) {
+	ctx := context.Background()
+	source := memory.New()
+
+	seed(t, source, "account",
+		map[string]interface{}{"id": "a1", "userId": "u1", "accountId": "u1", "providerId": "credential", "password": "c2FsdA:aGFzaA"},
+		map[string]interface{}{"id": "a2", "userId": "u1", "accountId": "123", "providerId": "github"},
+	)
+
+	mapping, _ := Preset(SourceBetterAuth)
+	mapping.Users, mapping.Sessions, mapping.Verifications = nil, nil, nil
+
+	// A dry run does not need a target
+	report, err := Run(ctx, &Config{Source: source, Mapping: mapping, DryRun: true})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	accounts := modelReport(t, report, core.ModelAccounts)
+	if accounts.Imported != 2 {
+		t.Errorf("Accounts imported = %d, want 2 (%v)", accounts.Imported, accounts.Errors)
+	}
+	if accounts.PasswordHashes[UnknownHashAlgorithm] != 1 {
+		t.Errorf("PasswordHashes = %v, want 1 unknown", accounts.PasswordHashes)
+	}
+
+	record, err := mapping.Accounts.convert(map[string]interface{}{"userId": "u1", "accountId": "u1", "providerId": "credential"}, core.ModelAccounts)
+	if err != nil {
+		t.Fatalf("convert() error = %v", err)
+	}
+	if record["provider_id"] != "local" || record["provider_type"] != "credential" {
+		t.Errorf("Credential account = %v, want local credential", record)
+	}
+}
+
+func TestRun_BeaconLegacy(t *testing.T) {
+	ctx := context.Background()
+	db := memory.New()
+
+	seed(t, db, "accounts_legacy",
+		map[string]interface{}{"id": "a1", "user_id": "u1", "account_id": "ada@example.com", "provider": "credentials", "password_hash": "$argon2id$v=19$m=65536,t=3,p=2$c2FsdA$aGFzaA"},
+		map[string]interface{}{"id": "a2", "user_id": "u1", "account_id": "123", "provider": "github"},
+	)
+
+	mapping, _ := Preset(SourceBeaconLegacy)
+	report, err := Run(ctx, &Config{Source: db, Target: db, Mapping: mapping})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if accounts := modelReport(t, report, core.ModelAccounts); accounts.Imported != 2 {
+		t.Errorf("Accounts imported = %d, want 2 (%v)", accounts.Imported, accounts.Errors)
+	}
+
+	credential, _ := db.FindOne(ctx, &core.Query{Model: "accounts", Where: []core.WhereClause{{Field: "id", Operator: core.OpEqual, Value: "a1"}}})
+	if credential["provider_id"] != "local" || credential["provider_type"] != "credential" || credential["password"] == nil {
+		t.Errorf("Credential account = %v, want local credential account with password", credential)
+	}
+	oauth, _ := db.FindOne(ctx, &core.Query{Model: "accounts", Where: []core.WhereClause{{Field: "id", Operator: core.OpEqual, Value: "a2"}}})
+	if oauth["provider_id"] != "github" || oauth["provider_type"] != "oauth" {
+		t.Errorf("OAuth account = %v, want github oauth account", oauth)
+	}
+}
+
+func TestMapping_ApplyOverrides(t *testing.T) {
+	overrides, err := ParseOverrides(strings.NewReader(`{
+		"users": {"table": "\"User\"", "fields": {"email": "email_address"}, "values": {"role": "member"}},
+		"sessions": {"skip": true}
+	}`))
+	if err != nil {
+		t.Fatalf("ParseOverrides() error = %v", err)
+	}
+
+	mapping, _ := Preset(SourceNextAuth)
+	if err := mapping.ApplyOverrides(overrides); err != nil {
+		t.Fatalf("ApplyOverrides() error = %v", err)
+	}
+
+	if mapping.Users.Table != `"User"` {
+		t.Errorf("Users table = %s", mapping.Users.Table)
+	}
+	if mapping.Users.Fields["email"].Column != "email_address" {
+		t.Errorf("email column = %s, want email_address", mapping.Users.Fields["email"].Column)
+	}
+	if mapping.Users.Fields["email_verified"].Transform == nil {
+		t.Error("Expected preset conversions to be kept")
+	}
+	if mapping.Users.Fields["role"].Value != "member" {
+		t.Error("Expected constant value for role")
+	}
+	if mapping.Sessions != nil {
+		t.Error("Expected sessions to be skipped")
+	}
+
+	if err := mapping.ApplyOverrides(Overrides{"tokens": {}}); err == nil {
+		t.Error("Expected error for unknown model")
+	}
+	if _, err := ParseOverrides(strings.NewReader(`{"users": {"colums": {}}}`)); err == nil {
+		t.Error("Expected error for unknown mapping key")
+	}
+}
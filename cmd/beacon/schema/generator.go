@@ -3,6 +3,8 @@ package schema
 import (
 	"fmt"
 	"strings"
+
+	"github.com/marshallshelly/beacon-auth/core"
 )
 
 // Config holds generation configuration
@@ -10,6 +12,19 @@ type Config struct {
 	Adapter string
 	Plugins []string
 	IDType  string // "string", "uuid", "serial"
+
+	// Schema places tables in a non-default database schema (mssql only),
+	// e.g. "auth" creates auth.users, auth.sessions, ...
+	Schema string
+
+	// TableNames overrides the default table names. It should match the
+	// TableNames passed to beaconauth.WithTableNames.
+	TableNames *core.TableNames
+
+	// Tenancy adds a tenant_id column to users, sessions and accounts and
+	// makes emails and provider accounts unique per tenant. Use it with
+	// beaconauth.WithTenancy.
+	Tenancy bool
 }
 
 // GenerateSQL generates the SQL schema based on config
@@ -42,44 +57,64 @@ func GenerateSQL(cfg *Config) (string, error) {
 }
 
 func generateCore(cfg *Config) (string, error) {
+	if cfg.Schema != "" {
+		if cfg.Adapter != "mssql" {
+			return "", fmt.Errorf("schema is only supported for the mssql adapter")
+		}
+		if !isIdentifier(cfg.Schema) {
+			return "", fmt.Errorf("invalid schema name: %s", cfg.Schema)
+		}
+	}
+	if err := cfg.TableNames.Validate(); err != nil {
+		return "", err
+	}
+
 	switch cfg.Adapter {
-	case "postgres":
-		return generatePostgresCore(cfg.IDType), nil
+	case "postgres", "cockroach":
+		return generatePostgresCore(cfg.Adapter, cfg.IDType, cfg.TableNames, tenantColumns(cfg.Tenancy, "VARCHAR(64)")), nil
 	case "mysql":
-		return generateMySQLCore(cfg.IDType), nil
+		return generateMySQLCore(cfg.IDType, cfg.TableNames, tenantColumns(cfg.Tenancy, "VARCHAR(64)")), nil
 	case "sqlite":
-		return generateSQLiteCore(cfg.IDType), nil
+		return generateSQLiteCore(cfg.IDType, cfg.TableNames, tenantColumns(cfg.Tenancy, "TEXT")), nil
 	case "mssql":
-		return generateMSSQLCore(cfg.IDType), nil
+		return generateMSSQLCore(cfg.IDType, cfg.Schema, cfg.TableNames, tenantColumns(cfg.Tenancy, "NVARCHAR(64)")), nil
 	default:
 		return "", fmt.Errorf("unsupported adapter: %s", cfg.Adapter)
 	}
 }
 
-func generatePlugin(plugin string, cfg *Config) (string, error) {
-	switch plugin {
-	case "twofa":
-		switch cfg.Adapter {
-		case "postgres":
-			return generatePostgresTwoFA(cfg.IDType), nil
-		case "mysql":
-			return generateMySQLTwoFA(cfg.IDType), nil
-		case "sqlite":
-			return generateSQLiteTwoFA(cfg.IDType), nil
-		case "mssql":
-			return generateMSSQLTwoFA(cfg.IDType), nil
-		}
-	case "emailpassword", "oauth":
-		return "", nil // No extra tables needed, uses 'accounts'
+// tenantDDL holds the core table fragments that differ with tenancy
+type tenantDDL struct {
+	column      string // tenant_id column, placed after id
+	emailUnique string // inline uniqueness of users.email
+	usersUnique string // table constraint making email unique per tenant
+	accountKey  string // columns identifying a provider account
+}
+
+// tenantColumns returns the core table fragments for a tenant_id column of
+// type colType, or the single-tenant fragments when tenancy is false
+func tenantColumns(tenancy bool, colType string) tenantDDL {
+	if !tenancy {
+		return tenantDDL{emailUnique: " UNIQUE", accountKey: "provider_id, account_id"}
+	}
+	return tenantDDL{
+		column:      fmt.Sprintf("\n    tenant_id %s NOT NULL DEFAULT '',", colType),
+		usersUnique: ",\n    UNIQUE (tenant_id, email)",
+		accountKey:  "tenant_id, provider_id, account_id",
 	}
-	return "", nil
 }
 
 // --- Postgres ---
 
-func generatePostgresCore(idType string) string {
-	idDef := "VARCHAR(255) PRIMARY KEY"
-	fkDef := "VARCHAR(255)"
+// postgresTypes returns the ID, foreign key and timestamp column types for
+// the postgres and cockroach adapters. CockroachDB gets unique_rowid() for
+// serial IDs, since sequences serialize inserts across nodes, and
+// TIMESTAMPTZ as it recommends.
+func postgresTypes(adapter, idType string) (idDef, fkDef, tsDef string) {
+	idDef, fkDef, tsDef = "VARCHAR(255) PRIMARY KEY", "VARCHAR(255)", "TIMESTAMP"
+	if adapter == "cockroach" {
+		tsDef = "TIMESTAMPTZ"
+	}
 
 	switch idType {
 	case "uuid":
@@ -88,11 +123,25 @@ func generatePostgresCore(idType string) string {
 	case "serial":
 		idDef = "SERIAL PRIMARY KEY"
 		fkDef = "INTEGER"
+		if adapter == "cockroach" {
+			idDef = "INT8 PRIMARY KEY DEFAULT unique_rowid()"
+			fkDef = "INT8"
+		}
 	}
+	return idDef, fkDef, tsDef
+}
+
+func generatePostgresCore(adapter, idType string, t *core.TableNames, tenant tenantDDL) string {
+	idDef, fkDef, tsDef := postgresTypes(adapter, idType)
 
-	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS users (
-    id %s,
-    email VARCHAR(255) NOT NULL UNIQUE,
+	users := t.Table(core.ModelUsers)
+	sessions := t.Table(core.ModelSessions)
+	accounts := t.Table(core.ModelAccounts)
+	verifications := t.Table(core.ModelVerifications)
+
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %[3]s (
+    id %[1]s,%[8]s
+    email VARCHAR(255) NOT NULL%[9]s,
     email_verified BOOLEAN DEFAULT FALSE,
     name VARCHAR(255),
     image TEXT,
@@ -100,101 +149,80 @@ func generatePostgresCore(idType string) string {
     role VARCHAR(50),
     banned BOOLEAN DEFAULT FALSE,
     ban_reason TEXT,
-    ban_expires TIMESTAMP,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    ban_expires %[7]s,
+    created_at %[7]s DEFAULT CURRENT_TIMESTAMP,
+    updated_at %[7]s DEFAULT CURRENT_TIMESTAMP%[10]s
 );
 
-CREATE TABLE IF NOT EXISTS sessions (
-    id %s,
-    user_id %s NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+CREATE TABLE IF NOT EXISTS %[4]s (
+    id %[1]s,%[8]s
+    user_id %[2]s NOT NULL REFERENCES %[3]s(id) ON DELETE CASCADE,
     token VARCHAR(255) NOT NULL UNIQUE,
-    expires_at TIMESTAMP NOT NULL,
+    expires_at %[7]s NOT NULL,
     ip_address VARCHAR(45),
     user_agent TEXT,
     impersonated_by VARCHAR(255),
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    fingerprint VARCHAR(64),
+    metadata TEXT,
+    created_at %[7]s DEFAULT CURRENT_TIMESTAMP,
+    updated_at %[7]s DEFAULT CURRENT_TIMESTAMP
 );
 
-CREATE TABLE IF NOT EXISTS accounts (
-    id %s,
-    user_id %s NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+CREATE TABLE IF NOT EXISTS %[5]s (
+    id %[1]s,%[8]s
+    user_id %[2]s NOT NULL REFERENCES %[3]s(id) ON DELETE CASCADE,
     account_id VARCHAR(255) NOT NULL,
     provider_id VARCHAR(255) NOT NULL,
     provider_type VARCHAR(50) NOT NULL,
     password TEXT,
     access_token TEXT,
     refresh_token TEXT,
-    access_token_expires_at TIMESTAMP,
-    refresh_token_expires_at TIMESTAMP,
+    access_token_expires_at %[7]s,
+    refresh_token_expires_at %[7]s,
     scope TEXT,
     id_token TEXT,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    UNIQUE(provider_id, account_id)
+    created_at %[7]s DEFAULT CURRENT_TIMESTAMP,
+    updated_at %[7]s DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(%[11]s)
 );
 
-CREATE TABLE IF NOT EXISTS verifications (
-    id %s,
+CREATE TABLE IF NOT EXISTS %[6]s (
+    id %[1]s,
     identifier VARCHAR(255) NOT NULL,
     token VARCHAR(255) NOT NULL UNIQUE,
     type VARCHAR(50) NOT NULL,
-    expires_at TIMESTAMP NOT NULL,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    expires_at %[7]s NOT NULL,
+    created_at %[7]s DEFAULT CURRENT_TIMESTAMP,
+    updated_at %[7]s DEFAULT CURRENT_TIMESTAMP
 );
-`, idDef, idDef, fkDef, idDef, fkDef, idDef)
+`, idDef, fkDef, users, sessions, accounts, verifications, tsDef,
+		tenant.column, tenant.emailUnique, tenant.usersUnique, tenant.accountKey)
 }
 
-func generatePostgresTwoFA(idType string) string {
-	idDef := "VARCHAR(255) PRIMARY KEY"
-	fkDef := "VARCHAR(255)"
+// --- MySQL ---
 
+// mysqlTypes returns the ID and foreign key column types for MySQL
+func mysqlTypes(idType string) (idDef, fkDef string) {
 	switch idType {
 	case "uuid":
-		idDef = "UUID PRIMARY KEY DEFAULT gen_random_uuid()"
-		fkDef = "UUID"
+		return "CHAR(36) PRIMARY KEY", "CHAR(36)"
 	case "serial":
-		idDef = "SERIAL PRIMARY KEY"
-		fkDef = "INTEGER"
+		return "INT AUTO_INCREMENT PRIMARY KEY", "INT"
 	}
-
-	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS two_factors (
-    id %s,
-    user_id %s NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-    secret TEXT NOT NULL,
-    uri TEXT NOT NULL,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-
-CREATE TABLE IF NOT EXISTS two_factor_backup_codes (
-    id %s,
-    user_id %s NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-    code VARCHAR(255) NOT NULL,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-`, idDef, fkDef, idDef, fkDef)
+	return "VARCHAR(255) PRIMARY KEY", "VARCHAR(255)"
 }
 
-// --- MySQL ---
-
-func generateMySQLCore(idType string) string {
-	idDef := "VARCHAR(255) PRIMARY KEY"
-	fkDef := "VARCHAR(255)"
+func generateMySQLCore(idType string, t *core.TableNames, tenant tenantDDL) string {
+	idDef, fkDef := mysqlTypes(idType)
 
-	switch idType {
-	case "uuid":
-		idDef = "CHAR(36) PRIMARY KEY"
-		fkDef = "CHAR(36)"
-	case "serial":
-		idDef = "INT AUTO_INCREMENT PRIMARY KEY"
-		fkDef = "INT"
-	}
+	users := t.Table(core.ModelUsers)
+	sessions := t.Table(core.ModelSessions)
+	accounts := t.Table(core.ModelAccounts)
+	verifications := t.Table(core.ModelVerifications)
 
-	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS users (
-    id %s,
-    email VARCHAR(255) NOT NULL UNIQUE,
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %[3]s (
+    id %[1]s,%[7]s
+    email VARCHAR(255) NOT NULL%[8]s,
     email_verified BOOLEAN DEFAULT FALSE,
     name VARCHAR(255),
     image TEXT,
@@ -204,25 +232,27 @@ func generateMySQLCore(idType string) string {
     ban_reason TEXT,
     ban_expires TIMESTAMP NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP%[9]s
 );
 
-CREATE TABLE IF NOT EXISTS sessions (
-    id %s,
-    user_id %s NOT NULL,
+CREATE TABLE IF NOT EXISTS %[4]s (
+    id %[1]s,%[7]s
+    user_id %[2]s NOT NULL,
     token VARCHAR(255) NOT NULL UNIQUE,
     expires_at TIMESTAMP NOT NULL,
     ip_address VARCHAR(45),
     user_agent TEXT,
     impersonated_by VARCHAR(255),
+    fingerprint VARCHAR(64),
+    metadata TEXT,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+    FOREIGN KEY (user_id) REFERENCES %[3]s(id) ON DELETE CASCADE
 );
 
-CREATE TABLE IF NOT EXISTS accounts (
-    id %s,
-    user_id %s NOT NULL,
+CREATE TABLE IF NOT EXISTS %[5]s (
+    id %[1]s,%[7]s
+    user_id %[2]s NOT NULL,
     account_id VARCHAR(255) NOT NULL,
     provider_id VARCHAR(255) NOT NULL,
     provider_type VARCHAR(50) NOT NULL,
@@ -235,12 +265,12 @@ CREATE TABLE IF NOT EXISTS accounts (
     id_token TEXT,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-    UNIQUE KEY provider_account (provider_id, account_id),
-    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+    UNIQUE KEY provider_account (%[10]s),
+    FOREIGN KEY (user_id) REFERENCES %[3]s(id) ON DELETE CASCADE
 );
 
-CREATE TABLE IF NOT EXISTS verifications (
-    id %s,
+CREATE TABLE IF NOT EXISTS %[6]s (
+    id %[1]s,
     identifier VARCHAR(255) NOT NULL,
     token VARCHAR(255) NOT NULL UNIQUE,
     type VARCHAR(50) NOT NULL,
@@ -248,56 +278,32 @@ CREATE TABLE IF NOT EXISTS verifications (
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
 );
-`, idDef, idDef, fkDef, idDef, fkDef, idDef)
+`, idDef, fkDef, users, sessions, accounts, verifications,
+		tenant.column, tenant.emailUnique, tenant.usersUnique, tenant.accountKey)
 }
 
-func generateMySQLTwoFA(idType string) string {
-	idDef := "VARCHAR(255) PRIMARY KEY"
-	fkDef := "VARCHAR(255)"
+// --- SQLite ---
 
-	switch idType {
-	case "uuid":
-		idDef = "CHAR(36) PRIMARY KEY"
-		fkDef = "CHAR(36)"
-	case "serial":
-		idDef = "INT AUTO_INCREMENT PRIMARY KEY"
-		fkDef = "INT"
+// sqliteTypes returns the ID and foreign key column types for SQLite,
+// where UUIDs are stored as text
+func sqliteTypes(idType string) (idDef, fkDef string) {
+	if idType == "serial" {
+		return "INTEGER PRIMARY KEY AUTOINCREMENT", "INTEGER"
 	}
-
-	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS two_factors (
-    id %s,
-    user_id %s NOT NULL,
-    secret TEXT NOT NULL,
-    uri TEXT NOT NULL,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-);
-
-CREATE TABLE IF NOT EXISTS two_factor_backup_codes (
-    id %s,
-    user_id %s NOT NULL,
-    code VARCHAR(255) NOT NULL,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-);
-`, idDef, fkDef, idDef, fkDef)
+	return "TEXT PRIMARY KEY", "TEXT"
 }
 
-// --- SQLite ---
+func generateSQLiteCore(idType string, t *core.TableNames, tenant tenantDDL) string {
+	idDef, fkDef := sqliteTypes(idType)
 
-func generateSQLiteCore(idType string) string {
-	// SQLite is simpler, usually INTEGER PRIMARY KEY implies AUTOINCREMENT
-	idDef := "TEXT PRIMARY KEY"
-	fkDef := "TEXT"
+	users := t.Table(core.ModelUsers)
+	sessions := t.Table(core.ModelSessions)
+	accounts := t.Table(core.ModelAccounts)
+	verifications := t.Table(core.ModelVerifications)
 
-	if idType == "serial" {
-		idDef = "INTEGER PRIMARY KEY AUTOINCREMENT"
-		fkDef = "INTEGER"
-	}
-
-	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS users (
-    id %s,
-    email TEXT NOT NULL UNIQUE,
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %[3]s (
+    id %[1]s,%[7]s
+    email TEXT NOT NULL%[8]s,
     email_verified BOOLEAN DEFAULT 0,
     name TEXT,
     image TEXT,
@@ -307,25 +313,27 @@ func generateSQLiteCore(idType string) string {
     ban_reason TEXT,
     ban_expires DATETIME,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP%[9]s
 );
 
-CREATE TABLE IF NOT EXISTS sessions (
-    id %s,
-    user_id %s NOT NULL,
+CREATE TABLE IF NOT EXISTS %[4]s (
+    id %[1]s,%[7]s
+    user_id %[2]s NOT NULL,
     token TEXT NOT NULL UNIQUE,
     expires_at DATETIME NOT NULL,
     ip_address TEXT,
     user_agent TEXT,
     impersonated_by TEXT,
+    fingerprint TEXT,
+    metadata TEXT,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+    FOREIGN KEY(user_id) REFERENCES %[3]s(id) ON DELETE CASCADE
 );
 
-CREATE TABLE IF NOT EXISTS accounts (
-    id %s,
-    user_id %s NOT NULL,
+CREATE TABLE IF NOT EXISTS %[5]s (
+    id %[1]s,%[7]s
+    user_id %[2]s NOT NULL,
     account_id TEXT NOT NULL,
     provider_id TEXT NOT NULL,
     provider_type TEXT NOT NULL,
@@ -338,12 +346,12 @@ CREATE TABLE IF NOT EXISTS accounts (
     id_token TEXT,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    UNIQUE(provider_id, account_id),
-    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+    UNIQUE(%[10]s),
+    FOREIGN KEY(user_id) REFERENCES %[3]s(id) ON DELETE CASCADE
 );
 
-CREATE TABLE IF NOT EXISTS verifications (
-    id %s,
+CREATE TABLE IF NOT EXISTS %[6]s (
+    id %[1]s,
     identifier TEXT NOT NULL,
     token TEXT NOT NULL UNIQUE,
     type TEXT NOT NULL,
@@ -351,56 +359,58 @@ CREATE TABLE IF NOT EXISTS verifications (
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
-`, idDef, idDef, fkDef, idDef, fkDef, idDef)
+`, idDef, fkDef, users, sessions, accounts, verifications,
+		tenant.column, tenant.emailUnique, tenant.usersUnique, tenant.accountKey)
 }
 
-func generateSQLiteTwoFA(idType string) string {
-	idDef := "TEXT PRIMARY KEY"
-	fkDef := "TEXT"
-
-	if idType == "serial" {
-		idDef = "INTEGER PRIMARY KEY AUTOINCREMENT"
-		fkDef = "INTEGER"
-	}
+// --- MSSQL ---
 
-	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS two_factors (
-    id %s,
-    user_id %s NOT NULL,
-    secret TEXT NOT NULL,
-    uri TEXT NOT NULL,
-    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
-);
+// mssqlBatch wraps a statement in its own batch. Tools such as sqlcmd and
+// SSMS send the script to the server one batch at a time, split on GO.
+func mssqlBatch(stmt string) string {
+	return stmt + "\nGO\n"
+}
 
-CREATE TABLE IF NOT EXISTS two_factor_backup_codes (
-    id %s,
-    user_id %s NOT NULL,
-    code TEXT NOT NULL,
-    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
-);
-`, idDef, fkDef, idDef, fkDef)
+// mssqlCreateTable creates a table only if it does not already exist.
+// OBJECT_ID resolves schema-qualified names, unlike a lookup in sysobjects.
+func mssqlCreateTable(table, body string) string {
+	return mssqlBatch(fmt.Sprintf("IF OBJECT_ID(N'%s', N'U') IS NULL\nCREATE TABLE %s (\n%s\n);", table, table, body))
 }
 
-// --- MSSQL ---
+// mssqlTable qualifies a table name with the configured schema
+func mssqlTable(schema, table string) string {
+	if schema == "" {
+		return table
+	}
+	return schema + "." + table
+}
 
-func generateMSSQLCore(idType string) string {
-	idDef := "NVARCHAR(255) PRIMARY KEY"
-	fkDef := "NVARCHAR(255)"
+func generateMSSQLSchema(schema string) string {
+	if schema == "" {
+		return ""
+	}
+	return mssqlBatch(fmt.Sprintf("IF SCHEMA_ID(N'%s') IS NULL\nEXEC('CREATE SCHEMA %s');", schema, schema)) + "\n"
+}
 
+// mssqlTypes returns the ID and foreign key column types for MSSQL
+func mssqlTypes(idType string) (idDef, fkDef string) {
 	switch idType {
 	case "uuid":
-		idDef = "UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID()"
-		fkDef = "UNIQUEIDENTIFIER"
+		return "UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID()", "UNIQUEIDENTIFIER"
 	case "serial":
-		idDef = "INT IDENTITY(1,1) PRIMARY KEY"
-		fkDef = "INT"
+		return "INT IDENTITY(1,1) PRIMARY KEY", "INT"
 	}
+	return "NVARCHAR(255) PRIMARY KEY", "NVARCHAR(255)"
+}
 
-	return fmt.Sprintf(`IF NOT EXISTS (SELECT * FROM sysobjects WHERE name='users' AND xtype='U')
-CREATE TABLE users (
-    id %s,
-    email NVARCHAR(255) NOT NULL UNIQUE,
+func generateMSSQLCore(idType, schema string, t *core.TableNames, tenant tenantDDL) string {
+	idDef, fkDef := mssqlTypes(idType)
+
+	users := mssqlTable(schema, t.Table(core.ModelUsers))
+
+	return generateMSSQLSchema(schema) + strings.Join([]string{
+		mssqlCreateTable(users, fmt.Sprintf(`    id %s,%s
+    email NVARCHAR(255) NOT NULL%s,
     email_verified BIT DEFAULT 0,
     name NVARCHAR(255),
     image NVARCHAR(MAX),
@@ -410,26 +420,20 @@ CREATE TABLE users (
     ban_reason NVARCHAR(MAX),
     ban_expires DATETIME2,
     created_at DATETIME2 DEFAULT GETDATE(),
-    updated_at DATETIME2 DEFAULT GETDATE()
-);
-
-IF NOT EXISTS (SELECT * FROM sysobjects WHERE name='sessions' AND xtype='U')
-CREATE TABLE sessions (
-    id %s,
+    updated_at DATETIME2 DEFAULT GETDATE()%s`, idDef, tenant.column, tenant.emailUnique, tenant.usersUnique)),
+		mssqlCreateTable(mssqlTable(schema, t.Table(core.ModelSessions)), fmt.Sprintf(`    id %s,%s
     user_id %s NOT NULL,
     token NVARCHAR(255) NOT NULL UNIQUE,
     expires_at DATETIME2 NOT NULL,
     ip_address NVARCHAR(45),
     user_agent NVARCHAR(MAX),
     impersonated_by NVARCHAR(255),
+    fingerprint NVARCHAR(64),
+    metadata NVARCHAR(MAX),
     created_at DATETIME2 DEFAULT GETDATE(),
     updated_at DATETIME2 DEFAULT GETDATE(),
-    CONSTRAINT FK_Session_User FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-);
-
-IF NOT EXISTS (SELECT * FROM sysobjects WHERE name='accounts' AND xtype='U')
-CREATE TABLE accounts (
-    id %s,
+    CONSTRAINT FK_Session_User FOREIGN KEY (user_id) REFERENCES %s(id) ON DELETE CASCADE`, idDef, tenant.column, fkDef, users)),
+		mssqlCreateTable(mssqlTable(schema, t.Table(core.ModelAccounts)), fmt.Sprintf(`    id %s,%s
     user_id %s NOT NULL,
     account_id NVARCHAR(255) NOT NULL,
     provider_id NVARCHAR(255) NOT NULL,
@@ -443,53 +447,43 @@ CREATE TABLE accounts (
     id_token NVARCHAR(MAX),
     created_at DATETIME2 DEFAULT GETDATE(),
     updated_at DATETIME2 DEFAULT GETDATE(),
-    CONSTRAINT UQ_Provider_Account UNIQUE (provider_id, account_id),
-    CONSTRAINT FK_Account_User FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-);
-
-IF NOT EXISTS (SELECT * FROM sysobjects WHERE name='verifications' AND xtype='U')
-CREATE TABLE verifications (
-    id %s,
+    CONSTRAINT UQ_Provider_Account UNIQUE (%s),
+    CONSTRAINT FK_Account_User FOREIGN KEY (user_id) REFERENCES %s(id) ON DELETE CASCADE`, idDef, tenant.column, fkDef, tenant.accountKey, users)),
+		mssqlCreateTable(mssqlTable(schema, t.Table(core.ModelVerifications)), fmt.Sprintf(`    id %s,
     identifier NVARCHAR(255) NOT NULL,
     token NVARCHAR(255) NOT NULL UNIQUE,
     type NVARCHAR(50) NOT NULL,
     expires_at DATETIME2 NOT NULL,
     created_at DATETIME2 DEFAULT GETDATE(),
-    updated_at DATETIME2 DEFAULT GETDATE()
-);
-`, idDef, idDef, fkDef, idDef, fkDef, idDef)
+    updated_at DATETIME2 DEFAULT GETDATE()`, idDef)),
+	}, "\n")
 }
 
-func generateMSSQLTwoFA(idType string) string {
-	idDef := "NVARCHAR(255) PRIMARY KEY"
-	fkDef := "NVARCHAR(255)"
-
-	switch idType {
-	case "uuid":
-		idDef = "UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID()"
-		fkDef = "UNIQUEIDENTIFIER"
-	case "serial":
-		idDef = "INT IDENTITY(1,1) PRIMARY KEY"
-		fkDef = "INT"
+// idTypes returns the ID and foreign key column types for an adapter
+func idTypes(adapter, idType string) (idDef, fkDef string) {
+	switch adapter {
+	case "mysql":
+		return mysqlTypes(idType)
+	case "sqlite":
+		return sqliteTypes(idType)
+	case "mssql":
+		return mssqlTypes(idType)
 	}
+	idDef, fkDef, _ = postgresTypes(adapter, idType)
+	return idDef, fkDef
+}
 
-	return fmt.Sprintf(`IF NOT EXISTS (SELECT * FROM sysobjects WHERE name='two_factors' AND xtype='U')
-CREATE TABLE two_factors (
-    id %s,
-    user_id %s NOT NULL,
-    secret NVARCHAR(MAX) NOT NULL,
-    uri NVARCHAR(MAX) NOT NULL,
-    created_at DATETIME2 DEFAULT GETDATE(),
-    CONSTRAINT FK_TwoFactor_User FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-);
-
-IF NOT EXISTS (SELECT * FROM sysobjects WHERE name='two_factor_backup_codes' AND xtype='U')
-CREATE TABLE two_factor_backup_codes (
-    id %s,
-    user_id %s NOT NULL,
-    code NVARCHAR(255) NOT NULL,
-    created_at DATETIME2 DEFAULT GETDATE(),
-    CONSTRAINT FK_BackupCode_User FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-);
-`, idDef, fkDef, idDef, fkDef)
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,370 @@
+package schema
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/marshallshelly/beacon-auth/core"
+	_ "modernc.org/sqlite"
+)
+
+// Run with -update to regenerate the golden files after an intentional
+// schema change:
+//
+//	go test ./cmd/beacon/schema -update
+var update = flag.Bool("update", false, "update golden files")
+
+var (
+	goldenAdapters = []string{"postgres", "cockroach", "mysql", "sqlite", "mssql"}
+	goldenIDTypes  = []string{"string", "uuid", "serial"}
+)
+
+func TestGenerateSQL_Golden(t *testing.T) {
+	for _, adapter := range goldenAdapters {
+		for _, idType := range goldenIDTypes {
+			name := fmt.Sprintf("%s_%s", adapter, idType)
+
+			t.Run(name, func(t *testing.T) {
+				cfg := &Config{
+					Adapter: adapter,
+					Plugins: []string{"emailpassword", "oauth", "twofa", "consent", "oidcprovider"},
+					IDType:  idType,
+				}
+
+				got, err := GenerateSQL(cfg)
+				if err != nil {
+					t.Fatalf("GenerateSQL failed: %v", err)
+				}
+
+				if err := Validate(got, adapter); err != nil {
+					t.Errorf("Generated SQL is invalid: %v", err)
+				}
+
+				path := filepath.Join("testdata", name+".sql")
+				if *update {
+					if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+						t.Fatalf("Failed to update golden file: %v", err)
+					}
+					return
+				}
+
+				want, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatalf("Failed to read golden file (run with -update to create it): %v", err)
+				}
+
+				if got != string(want) {
+					t.Errorf("Generated SQL does not match %s (run with -update if the change is intended)\n--- got ---\n%s", path, got)
+				}
+			})
+		}
+	}
+}
+
+func TestGenerateSQL_MSSQLSchema(t *testing.T) {
+	got, err := GenerateSQL(&Config{
+		Adapter: "mssql",
+		Plugins: []string{"twofa"},
+		IDType:  "string",
+		Schema:  "auth",
+	})
+	if err != nil {
+		t.Fatalf("GenerateSQL failed: %v", err)
+	}
+
+	if err := Validate(got, "mssql"); err != nil {
+		t.Errorf("Generated SQL is invalid: %v", err)
+	}
+
+	path := filepath.Join("testdata", "mssql_schema.sql")
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatalf("Failed to update golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read golden file (run with -update to create it): %v", err)
+	}
+	if got != string(want) {
+		t.Errorf("Generated SQL does not match %s (run with -update if the change is intended)\n--- got ---\n%s", path, got)
+	}
+
+	// Every table lives in its own batch, after the schema is created
+	batches := SplitStatements(got, "mssql")
+	if len(batches) != 8 {
+		t.Fatalf("Expected 8 batches, got %d", len(batches))
+	}
+	if !strings.Contains(batches[0], "CREATE SCHEMA auth") {
+		t.Errorf("Expected first batch to create the schema, got:\n%s", batches[0])
+	}
+	for _, batch := range batches[1:] {
+		if !strings.Contains(batch, "CREATE TABLE auth.") {
+			t.Errorf("Expected schema-qualified table, got:\n%s", batch)
+		}
+	}
+}
+
+func TestGenerateSQL_SchemaValidation(t *testing.T) {
+	if _, err := GenerateSQL(&Config{Adapter: "postgres", Schema: "auth"}); err == nil {
+		t.Error("Expected error for schema with a non-mssql adapter")
+	}
+	if _, err := GenerateSQL(&Config{Adapter: "mssql", Schema: "auth; DROP"}); err == nil {
+		t.Error("Expected error for invalid schema name")
+	}
+}
+
+func TestGenerateSQL_TableNames(t *testing.T) {
+	tables := &core.TableNames{
+		Users:         "auth_users",
+		Sessions:      "auth_sessions",
+		Accounts:      "auth_accounts",
+		Verifications: "auth_verifications",
+		Plugins: map[string]string{
+			"two_factors":             "auth_two_factors",
+			"two_factor_backup_codes": "auth_backup_codes",
+		},
+	}
+	defaultName := regexp.MustCompile(`\b(users|sessions|accounts|verifications|two_factors|two_factor_backup_codes)\b`)
+
+	for _, adapter := range goldenAdapters {
+		t.Run(adapter, func(t *testing.T) {
+			got, err := GenerateSQL(&Config{
+				Adapter:    adapter,
+				Plugins:    []string{"twofa"},
+				IDType:     "string",
+				TableNames: tables,
+			})
+			if err != nil {
+				t.Fatalf("GenerateSQL failed: %v", err)
+			}
+			if err := Validate(got, adapter); err != nil {
+				t.Errorf("Generated SQL is invalid: %v", err)
+			}
+			if name := defaultName.FindString(got); name != "" {
+				t.Errorf("Generated SQL still references default table %q:\n%s", name, got)
+			}
+			if !strings.Contains(got, "REFERENCES auth_users(id)") {
+				t.Errorf("Expected foreign keys to reference auth_users:\n%s", got)
+			}
+		})
+	}
+
+	t.Run("coexists with legacy tables", func(t *testing.T) {
+		script, err := GenerateSQL(&Config{Adapter: "sqlite", Plugins: []string{"twofa"}, TableNames: tables})
+		if err != nil {
+			t.Fatalf("GenerateSQL failed: %v", err)
+		}
+
+		db, err := sql.Open("sqlite", ":memory:")
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+
+		// A legacy users table with an unrelated shape
+		if _, err := db.Exec("CREATE TABLE users (username TEXT PRIMARY KEY)"); err != nil {
+			t.Fatalf("Failed to create legacy table: %v", err)
+		}
+		if _, err := db.Exec(script); err != nil {
+			t.Fatalf("Failed to apply schema: %v", err)
+		}
+		if _, err := db.Exec("INSERT INTO auth_users (id, email) VALUES ('u1', 'a@example.com')"); err != nil {
+			t.Fatalf("Failed to insert into renamed table: %v", err)
+		}
+	})
+
+	t.Run("prefix", func(t *testing.T) {
+		got, err := GenerateSQL(&Config{
+			Adapter:    "postgres",
+			Plugins:    []string{"twofa"},
+			TableNames: &core.TableNames{Prefix: "auth_"},
+		})
+		if err != nil {
+			t.Fatalf("GenerateSQL failed: %v", err)
+		}
+		if name := defaultName.FindString(got); name != "" {
+			t.Errorf("Generated SQL still references default table %q:\n%s", name, got)
+		}
+		if !strings.Contains(got, "auth_two_factor_backup_codes") {
+			t.Errorf("Expected prefixed plugin tables:\n%s", got)
+		}
+	})
+
+	if _, err := GenerateSQL(&Config{Adapter: "postgres", TableNames: &core.TableNames{Users: "bad name"}}); err == nil {
+		t.Error("Expected error for invalid table name")
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := "-- header\nCREATE TABLE a (x TEXT DEFAULT 'a;b');\n\nCREATE TABLE b (y TEXT);\n"
+	got := SplitStatements(script, "postgres")
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 statements, got %d: %q", len(got), got)
+	}
+	if !strings.HasSuffix(got[0], "DEFAULT 'a;b');") {
+		t.Errorf("Expected semicolon in string literal to be preserved, got %q", got[0])
+	}
+
+	batches := SplitStatements("CREATE TABLE a (x INT);\nGO\ngo\nCREATE TABLE b (y INT);\nGO\n", "mssql")
+	if len(batches) != 2 {
+		t.Fatalf("Expected 2 batches, got %d: %q", len(batches), batches)
+	}
+}
+
+func TestGenerateSQL_Deterministic(t *testing.T) {
+	cfg := &Config{Adapter: "postgres", Plugins: []string{"twofa"}, IDType: "uuid"}
+
+	first, err := GenerateSQL(cfg)
+	if err != nil {
+		t.Fatalf("GenerateSQL failed: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		next, err := GenerateSQL(cfg)
+		if err != nil {
+			t.Fatalf("GenerateSQL failed: %v", err)
+		}
+		if next != first {
+			t.Fatal("Expected GenerateSQL output to be deterministic")
+		}
+	}
+}
+
+func TestGenerateSQL_UnsupportedAdapter(t *testing.T) {
+	if _, err := GenerateSQL(&Config{Adapter: "oracle"}); err == nil {
+		t.Error("Expected error for unsupported adapter")
+	}
+}
+
+// TestGenerateSQL_SQLiteExecutes applies the SQLite schema to a real
+// in-memory database, since SQLite is available without a server.
+func TestGenerateSQL_SQLiteExecutes(t *testing.T) {
+	for _, idType := range goldenIDTypes {
+		t.Run(idType, func(t *testing.T) {
+			script, err := GenerateSQL(&Config{
+				Adapter: "sqlite",
+				Plugins: []string{"twofa", "consent", "oidcprovider"},
+				IDType:  idType,
+			})
+			if err != nil {
+				t.Fatalf("GenerateSQL failed: %v", err)
+			}
+
+			db, err := sql.Open("sqlite", ":memory:")
+			if err != nil {
+				t.Fatalf("Failed to open database: %v", err)
+			}
+			defer db.Close()
+
+			if _, err := db.Exec(script); err != nil {
+				t.Fatalf("Failed to apply schema: %v", err)
+			}
+		})
+	}
+}
+
+func TestGenerateSQL_Tenancy(t *testing.T) {
+	for _, adapter := range goldenAdapters {
+		t.Run(adapter, func(t *testing.T) {
+			got, err := GenerateSQL(&Config{Adapter: adapter, IDType: "string", Tenancy: true})
+			if err != nil {
+				t.Fatalf("GenerateSQL failed: %v", err)
+			}
+			if err := Validate(got, adapter); err != nil {
+				t.Errorf("Generated SQL is invalid: %v", err)
+			}
+			if n := strings.Count(got, "tenant_id "); n != 3 {
+				t.Errorf("Expected tenant_id on users, sessions and accounts, found %d columns:\n%s", n, got)
+			}
+			if !strings.Contains(got, "UNIQUE (tenant_id, email)") {
+				t.Errorf("Expected emails to be unique per tenant:\n%s", got)
+			}
+		})
+	}
+
+	t.Run("emails are unique per tenant", func(t *testing.T) {
+		script, err := GenerateSQL(&Config{Adapter: "sqlite", Tenancy: true})
+		if err != nil {
+			t.Fatalf("GenerateSQL failed: %v", err)
+		}
+
+		db, err := sql.Open("sqlite", ":memory:")
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+
+		if _, err := db.Exec(script); err != nil {
+			t.Fatalf("Failed to apply schema: %v", err)
+		}
+		insert := "INSERT INTO users (id, tenant_id, email) VALUES (?, ?, 'a@example.com')"
+		if _, err := db.Exec(insert, "u1", "acme"); err != nil {
+			t.Fatalf("Failed to insert user: %v", err)
+		}
+		if _, err := db.Exec(insert, "u2", "globex"); err != nil {
+			t.Errorf("Expected the email to be available in another tenant: %v", err)
+		}
+		if _, err := db.Exec(insert, "u3", "acme"); err == nil {
+			t.Error("Expected a duplicate email within a tenant to be rejected")
+		}
+	})
+}
+
+// auditPlugin is a third-party plugin with a table of its own
+type auditPlugin struct{}
+
+func (auditPlugin) ID() string                          { return "audit" }
+func (auditPlugin) Init(ctx *core.AuthContext) error    { return nil }
+func (auditPlugin) Endpoints() map[string]core.Endpoint { return nil }
+func (auditPlugin) Schema() []core.TableDef {
+	return []core.TableDef{{
+		Model: "audit_logs",
+		Columns: []core.ColumnDef{
+			{Name: "id", Type: core.ColumnID},
+			{Name: "user_id", Type: core.ColumnForeignID},
+			{Name: "action", Type: core.ColumnString, Size: 64, NotNull: true},
+			{Name: "success", Type: core.ColumnBool, Default: "true"},
+			{Name: "created_at", Type: core.ColumnTimestamp, Default: core.DefaultNow},
+		},
+		ForeignKeys: []core.ForeignKeyDef{{Name: "FK_Audit_User", Column: "user_id", Model: core.ModelUsers}},
+	}}
+}
+
+func TestGenerateSQL_RegisteredPlugin(t *testing.T) {
+	Register("audit", auditPlugin{})
+	t.Cleanup(func() { delete(plugins, "audit") })
+
+	tests := map[string]string{
+		"postgres": "    user_id VARCHAR(255) REFERENCES users(id) ON DELETE CASCADE,\n    action VARCHAR(64) NOT NULL,\n    success BOOLEAN DEFAULT TRUE,",
+		"sqlite":   "    success BOOLEAN DEFAULT 1,\n    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,\n    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE\n);",
+		"mssql":    "    action NVARCHAR(64) NOT NULL,\n    success BIT DEFAULT 1,\n    created_at DATETIME2 DEFAULT GETDATE(),\n    CONSTRAINT FK_Audit_User FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE",
+	}
+	for adapter, want := range tests {
+		got, err := GenerateSQL(&Config{Adapter: adapter, Plugins: []string{"audit"}})
+		if err != nil {
+			t.Fatalf("GenerateSQL(%s) failed: %v", adapter, err)
+		}
+		if !strings.Contains(got, "-- Plugin: audit\n") || !strings.Contains(got, want) {
+			t.Errorf("Expected %s to contain\n%s\n--- got ---\n%s", adapter, want, got)
+		}
+		if err := Validate(got, adapter); err != nil {
+			t.Errorf("Generated %s SQL is invalid: %v", adapter, err)
+		}
+	}
+}
+
+func TestGenerateSQL_UnknownPlugin(t *testing.T) {
+	_, err := GenerateSQL(&Config{Adapter: "postgres", Plugins: []string{"twofactor"}})
+	if err == nil || !strings.Contains(err.Error(), `unknown plugin "twofactor"`) || !strings.Contains(err.Error(), "twofa") {
+		t.Errorf("Expected an unknown plugin error listing the registered plugins, got %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package schema
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/plugins/admin"
+	"github.com/marshallshelly/beacon-auth/plugins/consent"
+	"github.com/marshallshelly/beacon-auth/plugins/device"
+	"github.com/marshallshelly/beacon-auth/plugins/emailpassword"
+	"github.com/marshallshelly/beacon-auth/plugins/oauth"
+	"github.com/marshallshelly/beacon-auth/plugins/oidcprovider"
+	"github.com/marshallshelly/beacon-auth/plugins/saml"
+	"github.com/marshallshelly/beacon-auth/plugins/twofa"
+)
+
+// plugins maps the names accepted in Config.Plugins to plugins
+var plugins = map[string]core.Plugin{}
+
+func init() {
+	Register("emailpassword", emailpassword.New())
+	Register("oauth", oauth.New())
+	Register("twofa", twofa.New())
+	Register("consent", consent.New())
+	Register("device", device.New(nil))
+	Register("oidcprovider", oidcprovider.New(nil))
+	Register("saml", saml.New(nil))
+	Register("admin", admin.New(nil))
+}
+
+// Register makes a plugin available to Config.Plugins under name. Plugins
+// implementing core.SchemaProvider get their tables generated; others use
+// the core tables only. Registering a name again replaces its plugin.
+func Register(name string, plugin core.Plugin) {
+	plugins[name] = plugin
+}
+
+// Registered returns the names of the registered plugins, sorted
+func Registered() []string {
+	names := make([]string, 0, len(plugins))
+	for name := range plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func generatePlugin(name string, cfg *Config) (string, error) {
+	plugin, ok := plugins[name]
+	if !ok {
+		return "", fmt.Errorf("unknown plugin %q (registered: %s)", name, strings.Join(Registered(), ", "))
+	}
+	provider, ok := plugin.(core.SchemaProvider)
+	if !ok {
+		return "", nil
+	}
+
+	tables := make([]string, 0)
+	for _, def := range provider.Schema() {
+		table, err := renderTable(cfg, def)
+		if err != nil {
+			return "", fmt.Errorf("plugin %s: %w", name, err)
+		}
+		tables = append(tables, table)
+	}
+	return strings.Join(tables, "\n"), nil
+}
+
+// renderTable renders a CREATE TABLE statement for the configured adapter
+func renderTable(cfg *Config, def core.TableDef) (string, error) {
+	t := cfg.TableNames
+	table := t.Table(def.Model)
+	ref := func(model string) string { return t.Table(model) }
+	if cfg.Adapter == "mssql" {
+		table = mssqlTable(cfg.Schema, table)
+		ref = func(model string) string { return mssqlTable(cfg.Schema, t.Table(model)) }
+	}
+
+	idDef, fkDef := idTypes(cfg.Adapter, cfg.IDType)
+	inlineFK := cfg.Adapter == "postgres" || cfg.Adapter == "cockroach"
+	foreignKeys := make(map[string]core.ForeignKeyDef, len(def.ForeignKeys))
+	for _, fk := range def.ForeignKeys {
+		foreignKeys[fk.Column] = fk
+	}
+
+	var lines []string
+	for _, col := range def.Columns {
+		line, err := renderColumn(cfg.Adapter, col, idDef, fkDef)
+		if err != nil {
+			return "", fmt.Errorf("table %s: %w", def.Model, err)
+		}
+		if fk, ok := foreignKeys[col.Name]; ok && inlineFK {
+			line += fmt.Sprintf(" REFERENCES %s(id) ON DELETE CASCADE", ref(fk.Model))
+		}
+		lines = append(lines, "    "+line)
+	}
+
+	for _, unique := range def.Unique {
+		columns := strings.Join(unique.Columns, ", ")
+		switch cfg.Adapter {
+		case "sqlite":
+			lines = append(lines, fmt.Sprintf("    UNIQUE(%s)", columns))
+		case "mssql":
+			lines = append(lines, fmt.Sprintf("    %sUNIQUE (%s)", mssqlConstraint(unique.Name), columns))
+		default:
+			lines = append(lines, fmt.Sprintf("    UNIQUE (%s)", columns))
+		}
+	}
+
+	if !inlineFK {
+		for _, fk := range def.ForeignKeys {
+			switch cfg.Adapter {
+			case "sqlite":
+				lines = append(lines, fmt.Sprintf("    FOREIGN KEY(%s) REFERENCES %s(id) ON DELETE CASCADE", fk.Column, ref(fk.Model)))
+			case "mssql":
+				lines = append(lines, fmt.Sprintf("    %sFOREIGN KEY (%s) REFERENCES %s(id) ON DELETE CASCADE", mssqlConstraint(fk.Name), fk.Column, ref(fk.Model)))
+			default:
+				lines = append(lines, fmt.Sprintf("    FOREIGN KEY (%s) REFERENCES %s(id) ON DELETE CASCADE", fk.Column, ref(fk.Model)))
+			}
+		}
+	}
+
+	body := strings.Join(lines, ",\n")
+	if cfg.Adapter == "mssql" {
+		return mssqlCreateTable(table, body), nil
+	}
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n%s\n);\n", table, body), nil
+}
+
+// renderColumn renders a column definition, without its name's indent
+func renderColumn(adapter string, col core.ColumnDef, idDef, fkDef string) (string, error) {
+	if !isIdentifier(col.Name) {
+		return "", fmt.Errorf("invalid column name %q", col.Name)
+	}
+	if col.Type == core.ColumnID {
+		return col.Name + " " + idDef, nil
+	}
+
+	colType, err := columnType(adapter, col, fkDef)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString(col.Name + " " + colType)
+	if col.NotNull {
+		b.WriteString(" NOT NULL")
+	} else if adapter == "mysql" && col.Type == core.ColumnTimestamp && col.Default == "" {
+		// MySQL would otherwise default the first TIMESTAMP column to now
+		b.WriteString(" NULL")
+	}
+	if col.Unique {
+		b.WriteString(" UNIQUE")
+	}
+	if col.Default != "" {
+		b.WriteString(" DEFAULT " + columnDefault(adapter, col.Default))
+	}
+	if col.AutoUpdate && adapter == "mysql" {
+		b.WriteString(" ON UPDATE CURRENT_TIMESTAMP")
+	}
+	return b.String(), nil
+}
+
+// columnType maps a portable column type to the adapter's type
+func columnType(adapter string, col core.ColumnDef, fkDef string) (string, error) {
+	size := col.Size
+	if size <= 0 {
+		size = 255
+	}
+
+	switch col.Type {
+	case core.ColumnForeignID:
+		return fkDef, nil
+	case core.ColumnString:
+		switch adapter {
+		case "sqlite":
+			return "TEXT", nil
+		case "mssql":
+			return fmt.Sprintf("NVARCHAR(%d)", size), nil
+		}
+		return fmt.Sprintf("VARCHAR(%d)", size), nil
+	case core.ColumnText:
+		if adapter == "mssql" {
+			return "NVARCHAR(MAX)", nil
+		}
+		return "TEXT", nil
+	case core.ColumnBool:
+		if adapter == "mssql" {
+			return "BIT", nil
+		}
+		return "BOOLEAN", nil
+	case core.ColumnBigInt:
+		if adapter == "sqlite" {
+			return "INTEGER", nil
+		}
+		return "BIGINT", nil
+	case core.ColumnTimestamp:
+		switch adapter {
+		case "cockroach":
+			return "TIMESTAMPTZ", nil
+		case "sqlite":
+			return "DATETIME", nil
+		case "mssql":
+			return "DATETIME2", nil
+		}
+		return "TIMESTAMP", nil
+	}
+	return "", fmt.Errorf("column %s has unsupported type %q", col.Name, col.Type)
+}
+
+// columnDefault renders a default value for the adapter
+func columnDefault(adapter, value string) string {
+	switch value {
+	case core.DefaultNow:
+		if adapter == "mssql" {
+			return "GETDATE()"
+		}
+		return "CURRENT_TIMESTAMP"
+	case "true", "false":
+		if adapter == "sqlite" || adapter == "mssql" {
+			if value == "true" {
+				return "1"
+			}
+			return "0"
+		}
+		return strings.ToUpper(value)
+	}
+	return value
+}
+
+// mssqlConstraint names a constraint, when it has a name
+func mssqlConstraint(name string) string {
+	if name == "" {
+		return ""
+	}
+	return "CONSTRAINT " + name + " "
+}
@@ -0,0 +1,95 @@
+package schema
+
+import "strings"
+
+// SplitStatements splits a generated script into the units a database
+// driver can execute one at a time. For mssql the script is split into
+// batches on GO lines; for other dialects it is split into statements on
+// semicolons outside of string literals and comments. Empty units are
+// dropped.
+func SplitStatements(sql, dialect string) []string {
+	if dialect == "mssql" {
+		return splitBatches(sql)
+	}
+	return splitOnSemicolons(sql)
+}
+
+func splitBatches(sql string) []string {
+	var batches []string
+	var current strings.Builder
+
+	flush := func() {
+		if stmt := strings.TrimSpace(current.String()); stmt != "" && !isCommentOnly(stmt) {
+			batches = append(batches, stmt)
+		}
+		current.Reset()
+	}
+
+	for _, line := range strings.SplitAfter(sql, "\n") {
+		if strings.EqualFold(strings.TrimSpace(line), "GO") {
+			flush()
+			continue
+		}
+		current.WriteString(line)
+	}
+	flush()
+
+	return batches
+}
+
+func splitOnSemicolons(sql string) []string {
+	var statements []string
+	var current strings.Builder
+	runes := []rune(sql)
+
+	flush := func() {
+		if stmt := strings.TrimSpace(current.String()); stmt != "" && !isCommentOnly(stmt) {
+			statements = append(statements, stmt)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end, _, ok := scanQuoted(runes, i, c, c, 0)
+			if !ok {
+				end = len(runes)
+			}
+			current.WriteString(string(runes[i:end]))
+			i = end - 1
+
+		case c == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				current.WriteRune(runes[i])
+				i++
+			}
+			if i < len(runes) {
+				current.WriteRune(runes[i])
+			}
+
+		case c == ';':
+			current.WriteRune(c)
+			flush()
+
+		default:
+			current.WriteRune(c)
+		}
+	}
+	flush()
+
+	return statements
+}
+
+// isCommentOnly reports whether a chunk contains nothing but line comments
+func isCommentOnly(chunk string) bool {
+	for _, line := range strings.Split(chunk, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,174 @@
+-- Core Schema
+IF OBJECT_ID(N'users', N'U') IS NULL
+CREATE TABLE users (
+    id UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID(),
+    email NVARCHAR(255) NOT NULL UNIQUE,
+    email_verified BIT DEFAULT 0,
+    name NVARCHAR(255),
+    image NVARCHAR(MAX),
+    two_factor_enabled BIT DEFAULT 0,
+    role NVARCHAR(50),
+    banned BIT DEFAULT 0,
+    ban_reason NVARCHAR(MAX),
+    ban_expires DATETIME2,
+    created_at DATETIME2 DEFAULT GETDATE(),
+    updated_at DATETIME2 DEFAULT GETDATE()
+);
+GO
+
+IF OBJECT_ID(N'sessions', N'U') IS NULL
+CREATE TABLE sessions (
+    id UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID(),
+    user_id UNIQUEIDENTIFIER NOT NULL,
+    token NVARCHAR(255) NOT NULL UNIQUE,
+    expires_at DATETIME2 NOT NULL,
+    ip_address NVARCHAR(45),
+    user_agent NVARCHAR(MAX),
+    impersonated_by NVARCHAR(255),
+    fingerprint NVARCHAR(64),
+    metadata NVARCHAR(MAX),
+    created_at DATETIME2 DEFAULT GETDATE(),
+    updated_at DATETIME2 DEFAULT GETDATE(),
+    CONSTRAINT FK_Session_User FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+GO
+
+IF OBJECT_ID(N'accounts', N'U') IS NULL
+CREATE TABLE accounts (
+    id UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID(),
+    user_id UNIQUEIDENTIFIER NOT NULL,
+    account_id NVARCHAR(255) NOT NULL,
+    provider_id NVARCHAR(255) NOT NULL,
+    provider_type NVARCHAR(50) NOT NULL,
+    password NVARCHAR(MAX),
+    access_token NVARCHAR(MAX),
+    refresh_token NVARCHAR(MAX),
+    access_token_expires_at DATETIME2,
+    refresh_token_expires_at DATETIME2,
+    scope NVARCHAR(MAX),
+    id_token NVARCHAR(MAX),
+    created_at DATETIME2 DEFAULT GETDATE(),
+    updated_at DATETIME2 DEFAULT GETDATE(),
+    CONSTRAINT UQ_Provider_Account UNIQUE (provider_id, account_id),
+    CONSTRAINT FK_Account_User FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+GO
+
+IF OBJECT_ID(N'verifications', N'U') IS NULL
+CREATE TABLE verifications (
+    id UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID(),
+    identifier NVARCHAR(255) NOT NULL,
+    token NVARCHAR(255) NOT NULL UNIQUE,
+    type NVARCHAR(50) NOT NULL,
+    expires_at DATETIME2 NOT NULL,
+    created_at DATETIME2 DEFAULT GETDATE(),
+    updated_at DATETIME2 DEFAULT GETDATE()
+);
+GO
+
+-- Plugin: oauth
+IF OBJECT_ID(N'oauth_states', N'U') IS NULL
+CREATE TABLE oauth_states (
+    id UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID(),
+    state_hash NVARCHAR(64) NOT NULL UNIQUE,
+    payload NVARCHAR(MAX) NOT NULL,
+    expires_at DATETIME2 NOT NULL,
+    created_at DATETIME2 DEFAULT GETDATE()
+);
+GO
+
+-- Plugin: twofa
+IF OBJECT_ID(N'two_factors', N'U') IS NULL
+CREATE TABLE two_factors (
+    id UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID(),
+    user_id UNIQUEIDENTIFIER NOT NULL,
+    secret NVARCHAR(MAX) NOT NULL,
+    uri NVARCHAR(MAX) NOT NULL,
+    created_at DATETIME2 DEFAULT GETDATE(),
+    CONSTRAINT FK_TwoFactor_User FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+GO
+
+IF OBJECT_ID(N'two_factor_backup_codes', N'U') IS NULL
+CREATE TABLE two_factor_backup_codes (
+    id UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID(),
+    user_id UNIQUEIDENTIFIER NOT NULL,
+    code NVARCHAR(255) NOT NULL,
+    created_at DATETIME2 DEFAULT GETDATE(),
+    CONSTRAINT FK_BackupCode_User FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+GO
+
+IF OBJECT_ID(N'two_factor_security_keys', N'U') IS NULL
+CREATE TABLE two_factor_security_keys (
+    id UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID(),
+    user_id UNIQUEIDENTIFIER NOT NULL,
+    credential_id NVARCHAR(512) NOT NULL UNIQUE,
+    public_key NVARCHAR(MAX) NOT NULL,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    name NVARCHAR(255) NOT NULL,
+    created_at DATETIME2 DEFAULT GETDATE(),
+    last_used_at DATETIME2,
+    CONSTRAINT FK_SecurityKey_User FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+GO
+
+-- Plugin: consent
+IF OBJECT_ID(N'consents', N'U') IS NULL
+CREATE TABLE consents (
+    id UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID(),
+    user_id UNIQUEIDENTIFIER NOT NULL,
+    app_id NVARCHAR(255) NOT NULL,
+    scopes NVARCHAR(MAX) NOT NULL,
+    created_at DATETIME2 DEFAULT GETDATE(),
+    updated_at DATETIME2 DEFAULT GETDATE(),
+    CONSTRAINT UQ_Consent_User_App UNIQUE (user_id, app_id),
+    CONSTRAINT FK_Consent_User FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+GO
+
+-- Plugin: oidcprovider
+IF OBJECT_ID(N'oauth_clients', N'U') IS NULL
+CREATE TABLE oauth_clients (
+    id UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID(),
+    client_id NVARCHAR(255) NOT NULL UNIQUE,
+    secret_hash NVARCHAR(255),
+    name NVARCHAR(255) NOT NULL,
+    redirect_uris NVARCHAR(MAX) NOT NULL,
+    scopes NVARCHAR(MAX) NOT NULL,
+    is_public BIT DEFAULT 0,
+    skip_consent BIT DEFAULT 0,
+    created_at DATETIME2 DEFAULT GETDATE(),
+    updated_at DATETIME2 DEFAULT GETDATE()
+);
+GO
+
+IF OBJECT_ID(N'oauth_authorization_codes', N'U') IS NULL
+CREATE TABLE oauth_authorization_codes (
+    id UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID(),
+    code_hash NVARCHAR(255) NOT NULL UNIQUE,
+    client_id NVARCHAR(255) NOT NULL,
+    user_id UNIQUEIDENTIFIER NOT NULL,
+    redirect_uri NVARCHAR(MAX) NOT NULL,
+    scope NVARCHAR(MAX) NOT NULL,
+    nonce NVARCHAR(MAX),
+    code_challenge NVARCHAR(255),
+    expires_at DATETIME2 NOT NULL,
+    created_at DATETIME2 DEFAULT GETDATE(),
+    CONSTRAINT FK_OAuthCode_User FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+GO
+
+IF OBJECT_ID(N'oauth_refresh_tokens', N'U') IS NULL
+CREATE TABLE oauth_refresh_tokens (
+    id UNIQUEIDENTIFIER PRIMARY KEY DEFAULT NEWID(),
+    token_hash NVARCHAR(255) NOT NULL UNIQUE,
+    client_id NVARCHAR(255) NOT NULL,
+    user_id UNIQUEIDENTIFIER NOT NULL,
+    scope NVARCHAR(MAX) NOT NULL,
+    expires_at DATETIME2 NOT NULL,
+    created_at DATETIME2 DEFAULT GETDATE(),
+    CONSTRAINT FK_OAuthRefreshToken_User FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+GO
+
@@ -0,0 +1,369 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ValidationError describes a problem found in generated SQL
+type ValidationError struct {
+	Dialect string
+	Line    int
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: line %d: %s", e.Dialect, e.Line, e.Message)
+}
+
+// dialectKeywords lists keywords that are only valid in some dialects
+var dialectKeywords = map[string][]string{
+	"AUTO_INCREMENT":   {"mysql"},
+	"AUTOINCREMENT":    {"sqlite"},
+	"IDENTITY":         {"mssql"},
+	"GETDATE":          {"mssql"},
+	"NEWID":            {"mssql"},
+	"UNIQUEIDENTIFIER": {"mssql"},
+	"DATETIME2":        {"mssql"},
+	"GEN_RANDOM_UUID":  {"postgres", "cockroach"},
+	"UNIQUE_ROWID":     {"cockroach"},
+	"SERIAL":           {"postgres", "cockroach", "mysql"},
+	"BIGSERIAL":        {"postgres", "cockroach", "mysql"},
+}
+
+// statementStarters lists the keywords a statement may begin with
+var statementStarters = map[string][]string{
+	"CREATE": nil,
+	"ALTER":  nil,
+	"DROP":   nil,
+	"INSERT": nil,
+	"UPDATE": nil,
+	"DELETE": nil,
+	"BEGIN":  nil,
+	"COMMIT": nil,
+	"SET":    {"postgres", "cockroach", "mysql", "mssql"},
+	"USE":    {"mysql", "mssql"},
+	"IF":     {"mssql"},
+	"PRAGMA": {"sqlite"},
+	"EXEC":   {"mssql"},
+}
+
+// batchOnlyStatements must be the first statement of an MSSQL batch
+var batchOnlyStatements = map[string]bool{
+	"VIEW":      true,
+	"PROCEDURE": true,
+	"PROC":      true,
+	"FUNCTION":  true,
+	"TRIGGER":   true,
+	"SCHEMA":    true,
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenIdent
+	tokenSymbol
+	tokenBatch // MSSQL "GO" batch separator
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	line int
+}
+
+// Validate checks generated SQL for syntax errors that would make it fail
+// against the given dialect ("postgres", "cockroach", "mysql", "sqlite" or
+// "mssql").
+//
+// It is not a full SQL parser. It tokenizes the script with the dialect's
+// quoting rules and checks statement structure, balanced parentheses,
+// trailing commas, batch separators and dialect-specific keywords, which
+// covers the mistakes a schema template is likely to contain.
+func Validate(sql, dialect string) error {
+	switch dialect {
+	case "postgres", "cockroach", "mysql", "sqlite", "mssql":
+	default:
+		return fmt.Errorf("unsupported dialect: %s", dialect)
+	}
+
+	tokens, err := tokenize(sql, dialect)
+	if err != nil {
+		return err
+	}
+
+	v := &validator{dialect: dialect, tokens: tokens}
+	return v.run()
+}
+
+func tokenize(sql, dialect string) ([]token, error) {
+	var tokens []token
+	runes := []rune(sql)
+	line := 1
+	lineStart := true
+
+	fail := func(l int, format string, args ...interface{}) error {
+		return &ValidationError{Dialect: dialect, Line: l, Message: fmt.Sprintf(format, args...)}
+	}
+
+	for i := 0; i < len(runes); {
+		c := runes[i]
+
+		switch {
+		case c == '\n':
+			line++
+			lineStart = true
+			i++
+			continue
+
+		case unicode.IsSpace(c):
+			i++
+			continue
+
+		case c == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			continue
+
+		case c == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			start := line
+			i += 2
+			for ; i < len(runes); i++ {
+				if runes[i] == '\n' {
+					line++
+				}
+				if runes[i] == '*' && i+1 < len(runes) && runes[i+1] == '/' {
+					break
+				}
+			}
+			if i >= len(runes) {
+				return nil, fail(start, "unterminated block comment")
+			}
+			i += 2
+			continue
+		}
+
+		atLineStart := lineStart
+		lineStart = false
+
+		switch {
+		case c == '\'' || (c == '"' && dialect == "mysql"):
+			end, l, ok := scanQuoted(runes, i, c, c, line)
+			if !ok {
+				return nil, fail(line, "unterminated string literal")
+			}
+			tokens = append(tokens, token{kind: tokenString, text: string(runes[i:end]), line: line})
+			line = l
+			i = end
+
+		case c == '"' || (c == '`' && dialect == "mysql") || (c == '[' && dialect == "mssql"):
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			end, l, ok := scanQuoted(runes, i, c, closing, line)
+			if !ok {
+				return nil, fail(line, "unterminated quoted identifier")
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(runes[i:end]), line: line})
+			line = l
+			i = end
+
+		case c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c):
+			start := i
+			for i < len(runes) && (runes[i] == '_' || runes[i] == '$' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			word := string(runes[start:i])
+
+			if strings.EqualFold(word, "GO") && atLineStart && restOfLineIsBlank(runes, i) {
+				tokens = append(tokens, token{kind: tokenBatch, text: word, line: line})
+				continue
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: strings.ToUpper(word), line: line})
+
+		default:
+			tokens = append(tokens, token{kind: tokenSymbol, text: string(c), line: line})
+			i++
+		}
+	}
+
+	return tokens, nil
+}
+
+// scanQuoted scans a quoted string or identifier starting at runes[i].
+// A doubled closing character is treated as an escape.
+func scanQuoted(runes []rune, i int, open, closing rune, line int) (int, int, bool) {
+	for j := i + 1; j < len(runes); j++ {
+		switch runes[j] {
+		case '\n':
+			line++
+		case closing:
+			if open == closing && j+1 < len(runes) && runes[j+1] == closing {
+				j++
+				continue
+			}
+			return j + 1, line, true
+		}
+	}
+	return 0, line, false
+}
+
+func restOfLineIsBlank(runes []rune, i int) bool {
+	for ; i < len(runes) && runes[i] != '\n'; i++ {
+		if !unicode.IsSpace(runes[i]) {
+			// GO may be followed by a repeat count
+			if !unicode.IsDigit(runes[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+type validator struct {
+	dialect string
+	tokens  []token
+}
+
+func (v *validator) fail(line int, format string, args ...interface{}) error {
+	return &ValidationError{Dialect: v.dialect, Line: line, Message: fmt.Sprintf(format, args...)}
+}
+
+func (v *validator) run() error {
+	var stmt []token
+	statementsInBatch := 0
+
+	flush := func() error {
+		if len(stmt) == 0 {
+			return nil
+		}
+		err := v.checkStatement(stmt, statementsInBatch)
+		statementsInBatch++
+		stmt = stmt[:0]
+		return err
+	}
+
+	for _, tok := range v.tokens {
+		switch {
+		case tok.kind == tokenBatch:
+			if v.dialect != "mssql" {
+				return v.fail(tok.line, "batch separator GO is only supported by mssql")
+			}
+			if err := flush(); err != nil {
+				return err
+			}
+			statementsInBatch = 0
+
+		case tok.kind == tokenSymbol && tok.text == ";":
+			if err := flush(); err != nil {
+				return err
+			}
+
+		default:
+			// MSSQL allows statements without a terminating semicolon,
+			// so "IF ... CREATE TABLE" counts as one statement there.
+			stmt = append(stmt, tok)
+		}
+	}
+
+	if len(stmt) > 0 && v.dialect != "mssql" {
+		return v.fail(stmt[len(stmt)-1].line, "statement is not terminated with ';'")
+	}
+
+	return flush()
+}
+
+func (v *validator) checkStatement(stmt []token, indexInBatch int) error {
+	first := stmt[0]
+	if first.kind != tokenWord {
+		return v.fail(first.line, "unexpected %q at start of statement", first.text)
+	}
+
+	dialects, ok := statementStarters[first.text]
+	if !ok || (dialects != nil && !contains(dialects, v.dialect)) {
+		return v.fail(first.line, "unexpected %s at start of statement", first.text)
+	}
+
+	depth := 0
+	for i, tok := range stmt {
+		switch {
+		case tok.kind == tokenSymbol && tok.text == "(":
+			depth++
+
+		case tok.kind == tokenSymbol && tok.text == ")":
+			depth--
+			if depth < 0 {
+				return v.fail(tok.line, "unbalanced ')'")
+			}
+
+		case tok.kind == tokenSymbol && tok.text == ",":
+			if i+1 == len(stmt) || stmt[i+1].text == ")" {
+				return v.fail(tok.line, "trailing comma")
+			}
+
+		case tok.kind == tokenWord:
+			if allowed, ok := dialectKeywords[tok.text]; ok && !contains(allowed, v.dialect) {
+				return v.fail(tok.line, "%s is not supported by %s", tok.text, v.dialect)
+			}
+
+			if err := v.checkSequence(stmt, i, indexInBatch); err != nil {
+				return err
+			}
+		}
+	}
+
+	if depth != 0 {
+		return v.fail(stmt[len(stmt)-1].line, "unbalanced '('")
+	}
+
+	return nil
+}
+
+// checkSequence checks multi-keyword constructs starting at stmt[i]
+func (v *validator) checkSequence(stmt []token, i, indexInBatch int) error {
+	tok := stmt[i]
+
+	switch tok.text {
+	case "CREATE":
+		if next := wordAt(stmt, i+1); next != "" {
+			if next == "OR" && wordAt(stmt, i+2) == "ALTER" {
+				next = wordAt(stmt, i+3)
+			}
+			if batchOnlyStatements[next] && v.dialect == "mssql" && (i > 0 || indexInBatch > 0) {
+				return v.fail(tok.line, "CREATE %s must be the first statement in a batch; separate it with GO", next)
+			}
+		}
+
+		if wordAt(stmt, i+1) == "TABLE" && wordAt(stmt, i+2) == "IF" && v.dialect == "mssql" {
+			return v.fail(tok.line, "CREATE TABLE IF NOT EXISTS is not supported by mssql")
+		}
+
+	case "ON":
+		if wordAt(stmt, i+1) == "UPDATE" && wordAt(stmt, i+2) == "CURRENT_TIMESTAMP" && v.dialect != "mysql" {
+			return v.fail(tok.line, "ON UPDATE CURRENT_TIMESTAMP is only supported by mysql")
+		}
+	}
+
+	return nil
+}
+
+func wordAt(stmt []token, i int) string {
+	if i < len(stmt) && stmt[i].kind == tokenWord {
+		return stmt[i].text
+	}
+	return ""
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
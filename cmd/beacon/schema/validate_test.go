@@ -0,0 +1,135 @@
+package schema
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect string
+		sql     string
+		wantErr bool
+		line    int
+	}{
+		{
+			name:    "valid postgres",
+			dialect: "postgres",
+			sql:     "CREATE TABLE IF NOT EXISTS t (\n    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),\n    name TEXT\n);\n",
+		},
+		{
+			name:    "valid mssql batches",
+			dialect: "mssql",
+			sql:     "CREATE TABLE t (id INT IDENTITY(1,1) PRIMARY KEY);\nGO\nCREATE VIEW v AS SELECT id FROM t;\nGO\n",
+		},
+		{
+			name:    "strings and comments are ignored",
+			dialect: "sqlite",
+			sql:     "-- GO ( AUTO_INCREMENT\nINSERT INTO t (name) VALUES ('it''s ( GO');\n/* ) */\n",
+		},
+		{
+			name:    "missing closing paren",
+			dialect: "postgres",
+			sql:     "CREATE TABLE t (\n    id TEXT\n;\n",
+			wantErr: true,
+			line:    2,
+		},
+		{
+			name:    "extra closing paren",
+			dialect: "mysql",
+			sql:     "CREATE TABLE t (id TEXT));\n",
+			wantErr: true,
+			line:    1,
+		},
+		{
+			name:    "trailing comma",
+			dialect: "sqlite",
+			sql:     "CREATE TABLE t (\n    id TEXT,\n);\n",
+			wantErr: true,
+			line:    2,
+		},
+		{
+			name:    "missing semicolon",
+			dialect: "postgres",
+			sql:     "CREATE TABLE t (id TEXT)\n",
+			wantErr: true,
+			line:    1,
+		},
+		{
+			name:    "unterminated string",
+			dialect: "postgres",
+			sql:     "INSERT INTO t VALUES ('abc);\n",
+			wantErr: true,
+			line:    1,
+		},
+		{
+			name:    "GO outside mssql",
+			dialect: "postgres",
+			sql:     "CREATE TABLE t (id TEXT);\nGO\n",
+			wantErr: true,
+			line:    2,
+		},
+		{
+			name:    "mssql view without batch separator",
+			dialect: "mssql",
+			sql:     "CREATE TABLE t (id INT);\nCREATE VIEW v AS SELECT id FROM t;\n",
+			wantErr: true,
+			line:    2,
+		},
+		{
+			name:    "mssql create table if not exists",
+			dialect: "mssql",
+			sql:     "CREATE TABLE IF NOT EXISTS t (id INT);\n",
+			wantErr: true,
+			line:    1,
+		},
+		{
+			name:    "mysql keyword in postgres",
+			dialect: "postgres",
+			sql:     "CREATE TABLE t (id INT AUTO_INCREMENT PRIMARY KEY);\n",
+			wantErr: true,
+			line:    1,
+		},
+		{
+			name:    "on update current_timestamp outside mysql",
+			dialect: "sqlite",
+			sql:     "CREATE TABLE t (\n    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP\n);\n",
+			wantErr: true,
+			line:    2,
+		},
+		{
+			name:    "unknown statement",
+			dialect: "mysql",
+			sql:     "CREAT TABLE t (id INT);\n",
+			wantErr: true,
+			line:    1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.sql, tt.dialect)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Expected valid SQL, got: %v", err)
+				}
+				return
+			}
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Expected ValidationError, got: %v", err)
+			}
+			if verr.Line != tt.line {
+				t.Errorf("Expected error on line %d, got %d (%v)", tt.line, verr.Line, verr)
+			}
+		})
+	}
+}
+
+func TestValidate_UnsupportedDialect(t *testing.T) {
+	if err := Validate("CREATE TABLE t (id INT);", "oracle"); err == nil {
+		t.Error("Expected error for unsupported dialect")
+	}
+}
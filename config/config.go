@@ -0,0 +1,323 @@
+// Package config builds a BeaconAuth configuration from files, BEACON_*
+// environment variables and programmatic overrides, and validates it
+// before anything is opened:
+//
+//	cfg, err := config.Load("beacon.yaml")
+//	if err != nil {
+//		log.Fatal(err) // Lists every problem, with its key and variable
+//	}
+//	db, err := adapters.Open(ctx, cfg.DatabaseURL)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	auth, err := beaconauth.New(append(cfg.Options(), beaconauth.WithAdapter(db))...)
+//
+// Files are YAML (.yaml, .yml) or TOML (.toml). Each key has a variable
+// named after its path: session.expires_in is BEACON_SESSION_EXPIRES_IN
+// and oauth.github.client_id is BEACON_OAUTH_GITHUB_CLIENT_ID. Lists are
+// comma-separated and durations use Go syntax, e.g. "168h".
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/plugins/emailpassword"
+	"github.com/marshallshelly/beacon-auth/plugins/oauth"
+	"github.com/marshallshelly/beacon-auth/plugins/oauth/providers"
+)
+
+// MinSecretLength is the shortest secret Validate accepts
+const MinSecretLength = 32
+
+// Session stores, as listed in SessionConfig.Stores
+const (
+	StoreCookie   = "cookie"
+	StoreDatabase = "database"
+	StoreRedis    = "redis"
+)
+
+// Config is the configuration read by Load, which starts from Default
+type Config struct {
+	AppName string `yaml:"app_name"`
+
+	// Secret signs session tokens and cookies, at least MinSecretLength
+	// characters. SecretKeys, a rotating key ring, can replace it.
+	Secret     string `yaml:"secret"`
+	SecretKeys string `yaml:"secret_keys"`
+
+	BaseURL  string `yaml:"base_url"`
+	BasePath string `yaml:"base_path"`
+
+	// DatabaseURL is the connection URL for adapters.Open
+	DatabaseURL string `yaml:"database_url"`
+
+	TrustedOrigins  []string `yaml:"trusted_origins"`
+	RedirectOrigins []string `yaml:"redirect_origins"`
+
+	// TrustedProxies lists the reverse proxies, as CIDR ranges or IPs,
+	// whose X-Forwarded-For headers are believed
+	TrustedProxies []string `yaml:"trusted_proxies"`
+
+	EmailPassword EmailPasswordConfig `yaml:"email_password"`
+	Session       SessionConfig       `yaml:"session"`
+
+	// OAuth configures providers by ID, e.g. "github" or "google" (see
+	// ProviderIDs). Options registers the oauth plugin with them.
+	OAuth map[string]OAuthProviderConfig `yaml:"oauth"`
+
+	RateLimit     RateLimitConfig     `yaml:"rate_limit"`
+	HashLimit     HashLimitConfig     `yaml:"hash_limit"`
+	QueryTimeouts QueryTimeoutsConfig `yaml:"query_timeouts"`
+
+	// Plugins holds plugin settings by plugin ID, as in the plugins
+	// section read by beaconauth.WithConfigFile. They have no variables.
+	Plugins map[string]map[string]interface{} `yaml:"plugins"`
+
+	// secrets resolved the secretRefs, by key, for Options
+	secrets    core.SecretProvider
+	secretRefs map[string]string
+}
+
+// EmailPasswordConfig configures email and password sign-in
+type EmailPasswordConfig struct {
+	Enabled             bool          `yaml:"enabled"`
+	MinPasswordLength   int           `yaml:"min_password_length"`
+	RequireVerification bool          `yaml:"require_verification"`
+	ResetPasswordExpiry time.Duration `yaml:"reset_password_expiry"`
+}
+
+// SessionConfig configures sessions
+type SessionConfig struct {
+	ExpiresIn      time.Duration `yaml:"expires_in"`
+	UpdateAge      time.Duration `yaml:"update_age"`
+	ShortExpiresIn time.Duration `yaml:"short_expires_in"`
+	IdleTimeout    time.Duration `yaml:"idle_timeout"`
+
+	CookieName     string `yaml:"cookie_name"`
+	CookieDomain   string `yaml:"cookie_domain"`
+	CookieSecure   bool   `yaml:"cookie_secure"`
+	CookieSameSite string `yaml:"cookie_same_site"`
+	EncryptCookies bool   `yaml:"encrypt_cookies"`
+
+	// Stores lists where sessions are kept: StoreCookie, StoreDatabase
+	// and StoreRedis. StoreRedis needs RedisURL.
+	Stores   []string `yaml:"stores"`
+	RedisURL string   `yaml:"redis_url"`
+
+	HashTokens         bool `yaml:"hash_tokens"`
+	AcceptPlainTokens  bool `yaml:"accept_plain_tokens"`
+	MaxSessionsPerUser int  `yaml:"max_sessions_per_user"`
+
+	BatchUpdates        bool          `yaml:"batch_updates"`
+	UpdateBatchSize     int           `yaml:"update_batch_size"`
+	UpdateFlushInterval time.Duration `yaml:"update_flush_interval"`
+}
+
+// OAuthProviderConfig configures an OAuth provider. Only the fields of the
+// provider's options are used.
+type OAuthProviderConfig struct {
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	Scopes       []string `yaml:"scopes"`
+
+	// TenantID restricts Microsoft sign-in to a tenant
+	TenantID string `yaml:"tenant_id"`
+
+	// TeamID is the Apple team, or the Slack workspace to sign in to
+	TeamID string `yaml:"team_id"`
+
+	// KeyID and PrivateKey (PEM) sign Apple client secrets
+	KeyID      string `yaml:"key_id"`
+	PrivateKey string `yaml:"private_key"`
+
+	// BaseURL is a self-managed GitLab instance
+	BaseURL string `yaml:"base_url"`
+}
+
+// RateLimitConfig limits the rate-limit classes of endpoints per client
+// (see beaconauth.WithRateLimitClass)
+type RateLimitConfig struct {
+	Credentials RateLimitClassConfig `yaml:"credentials"`
+	Tokens      RateLimitClassConfig `yaml:"tokens"`
+}
+
+// RateLimitClassConfig allows Limit requests per Window (0 = unlimited)
+type RateLimitClassConfig struct {
+	Limit  int           `yaml:"limit"`
+	Window time.Duration `yaml:"window"`
+}
+
+// HashLimitConfig bounds concurrent password hashing (0 = the defaults of
+// beaconauth.WithHashLimit)
+type HashLimitConfig struct {
+	MaxConcurrent int           `yaml:"max_concurrent"`
+	QueueTimeout  time.Duration `yaml:"queue_timeout"`
+}
+
+// QueryTimeoutsConfig bounds database calls (see
+// beaconauth.WithQueryTimeouts)
+type QueryTimeoutsConfig struct {
+	Read  time.Duration `yaml:"read"`
+	Write time.Duration `yaml:"write"`
+}
+
+// Default returns the BeaconAuth defaults, with sessions in the cookie and
+// the database
+func Default() *Config {
+	defaults := core.DefaultConfig()
+	return &Config{
+		AppName:  defaults.AppName,
+		BasePath: defaults.BasePath,
+		EmailPassword: EmailPasswordConfig{
+			Enabled:             defaults.EmailPassword.Enabled,
+			MinPasswordLength:   defaults.EmailPassword.MinPasswordLength,
+			RequireVerification: defaults.EmailPassword.RequireVerification,
+			ResetPasswordExpiry: defaults.EmailPassword.ResetPasswordExpiry,
+		},
+		Session: SessionConfig{
+			ExpiresIn:      defaults.Session.ExpiresIn,
+			UpdateAge:      defaults.Session.UpdateAge,
+			CookieName:     defaults.Session.CookieName,
+			CookieSecure:   defaults.Session.CookieSecure,
+			CookieSameSite: defaults.Session.CookieSameSite,
+			Stores:         []string{StoreCookie, StoreDatabase},
+		},
+		QueryTimeouts: QueryTimeoutsConfig{
+			Read:  defaults.QueryTimeouts.Read,
+			Write: defaults.QueryTimeouts.Write,
+		},
+	}
+}
+
+// Options returns the beaconauth.New options of a validated configuration.
+// Add the adapter, opened from DatabaseURL, and any other plugins. The
+// options register the emailpassword plugin when EmailPassword is enabled
+// and the oauth plugin with the OAuth providers; do not register them
+// again. With Loader.Secrets, session keys and OAuth client secrets read
+// from it rotate with the secret manager.
+func (c *Config) Options() []core.Option {
+	defaults := core.DefaultConfig()
+	session := *defaults.Session
+	session.ExpiresIn = c.Session.ExpiresIn
+	session.UpdateAge = c.Session.UpdateAge
+	session.ShortExpiresIn = c.Session.ShortExpiresIn
+	session.IdleTimeout = c.Session.IdleTimeout
+	session.CookieName = c.Session.CookieName
+	session.CookieDomain = c.Session.CookieDomain
+	session.CookieSecure = c.Session.CookieSecure
+	session.CookieSameSite = c.Session.CookieSameSite
+	session.EncryptCookies = c.Session.EncryptCookies
+	session.HashTokens = c.Session.HashTokens
+	session.AcceptPlainTokens = c.Session.AcceptPlainTokens
+	session.MaxSessionsPerUser = c.Session.MaxSessionsPerUser
+	session.BatchUpdates = c.Session.BatchUpdates
+	session.UpdateBatchSize = c.Session.UpdateBatchSize
+	session.UpdateFlushInterval = c.Session.UpdateFlushInterval
+	session.Stores = &core.SessionStores{
+		Cookie:   hasStore(c.Session.Stores, StoreCookie),
+		Database: hasStore(c.Session.Stores, StoreDatabase),
+		Redis:    hasStore(c.Session.Stores, StoreRedis),
+		RedisURL: c.Session.RedisURL,
+	}
+
+	opts := []core.Option{
+		func(cfg *core.Config) error {
+			cfg.AppName = c.AppName
+			return nil
+		},
+		core.WithBaseURL(c.BaseURL),
+		core.WithBasePath(c.BasePath),
+		core.WithEmailPassword(&core.EmailPasswordConfig{
+			Enabled:             c.EmailPassword.Enabled,
+			MinPasswordLength:   c.EmailPassword.MinPasswordLength,
+			RequireVerification: c.EmailPassword.RequireVerification,
+			PasswordHashCost:    defaults.EmailPassword.PasswordHashCost,
+			ResetPasswordExpiry: c.EmailPassword.ResetPasswordExpiry,
+		}),
+		core.WithSessionConfig(&session),
+		core.WithHashLimit(c.HashLimit.MaxConcurrent, c.HashLimit.QueueTimeout),
+		core.WithQueryTimeouts(c.QueryTimeouts.Read, c.QueryTimeouts.Write),
+	}
+	if c.Secret != "" {
+		opts = append(opts, core.WithSecret(c.Secret))
+	}
+	if _, rotating := c.secretRefs["secret_keys"]; c.SecretKeys != "" && !rotating {
+		opts = append(opts, core.WithSecretKeys(c.SecretKeys))
+	}
+	if c.secrets != nil {
+		// Session keys read from the secret manager rotate with it
+		opts = append(opts, core.WithSecretProvider(c.secrets, c.secretRefs["secret_keys"]))
+	}
+	if len(c.TrustedOrigins) > 0 {
+		opts = append(opts, core.WithTrustedOrigins(c.TrustedOrigins...))
+	}
+	if len(c.RedirectOrigins) > 0 {
+		opts = append(opts, core.WithRedirectOrigins(c.RedirectOrigins...))
+	}
+	if len(c.TrustedProxies) > 0 {
+		opts = append(opts, core.WithTrustedProxies(c.TrustedProxies...))
+	}
+	if class := c.RateLimit.Credentials; class.Limit > 0 {
+		opts = append(opts, core.WithRateLimitClass(core.RateLimitCredentials, class.Limit, class.Window))
+	}
+	if class := c.RateLimit.Tokens; class.Limit > 0 {
+		opts = append(opts, core.WithRateLimitClass(core.RateLimitTokens, class.Limit, class.Window))
+	}
+	if c.EmailPassword.Enabled {
+		opts = append(opts, core.WithPlugins(emailpassword.New()))
+	}
+	if len(c.OAuth) > 0 {
+		plugin := oauth.New()
+		for _, id := range sortedKeys(c.OAuth) {
+			id, p := id, c.OAuth[id]
+			if name, ok := c.secretRefs["oauth."+id+".client_secret"]; ok {
+				plugin.WithRotatingProvider(name, func(clientSecret string) providers.OAuthProvider {
+					p.ClientSecret = clientSecret
+					return newProvider(id, p)
+				})
+				continue
+			}
+			_ = plugin.RegisterProvider(newProvider(id, p)) // IDs are unique and valid
+		}
+		opts = append(opts, core.WithPlugins(plugin))
+	}
+	if len(c.Plugins) > 0 {
+		opts = append(opts, c.pluginSettings())
+	}
+	return opts
+}
+
+// pluginSettings passes the plugins section to the plugins, like
+// core.WithConfigFile
+func (c *Config) pluginSettings() core.Option {
+	return func(cfg *core.Config) error {
+		if cfg.PluginSettings == nil {
+			cfg.PluginSettings = make(map[string]core.PluginSettings)
+		}
+		for id, section := range c.Plugins {
+			data, err := yaml.Marshal(section)
+			if err != nil {
+				return fmt.Errorf("plugins.%s: %w", id, err)
+			}
+			cfg.PluginSettings[id] = func(target interface{}) error {
+				if err := yaml.UnmarshalWithOptions(data, target, yaml.DisallowUnknownField()); err != nil {
+					return fmt.Errorf("plugins.%s: %s", id, yaml.FormatError(err, false, false))
+				}
+				return nil
+			}
+		}
+		return nil
+	}
+}
+
+func hasStore(stores []string, store string) bool {
+	for _, s := range stores {
+		if s == store {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,314 @@
+package config
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	beaconauth "github.com/marshallshelly/beacon-auth"
+	"github.com/marshallshelly/beacon-auth/adapters/memory"
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// problemKeys returns the keys of the problems in err, an *Error
+func problemKeys(t *testing.T, err error) []string {
+	t.Helper()
+	var cfgErr *Error
+	if !errors.As(err, &cfgErr) {
+		t.Fatalf("error = %v, want *Error", err)
+	}
+	var keys []string
+	for _, p := range cfgErr.Problems {
+		keys = append(keys, p.Key)
+	}
+	return keys
+}
+
+func TestLoad_YAML(t *testing.T) {
+	path := writeFile(t, "beacon.yaml", `
+secret: `+testSecret+`
+base_url: https://example.com
+database_url: sqlite://app.db
+session:
+  expires_in: 24h
+  cookie_secure: true
+oauth:
+  github:
+    client_id: gh-id
+    client_secret: gh-secret
+plugins:
+  twofa:
+    issuer: Example
+`)
+	cfg, err := (&Loader{Files: []string{path}, Environ: []string{}}).Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Session.ExpiresIn != 24*time.Hour || !cfg.Session.CookieSecure {
+		t.Errorf("session = %+v", cfg.Session)
+	}
+	if cfg.Session.UpdateAge != Default().Session.UpdateAge {
+		t.Errorf("update_age = %v, want the default", cfg.Session.UpdateAge)
+	}
+	if cfg.OAuth["github"].ClientID != "gh-id" || cfg.Plugins["twofa"]["issuer"] != "Example" {
+		t.Errorf("oauth = %+v, plugins = %+v", cfg.OAuth, cfg.Plugins)
+	}
+}
+
+func TestLoad_TOMLEnvAndOverrides(t *testing.T) {
+	path := writeFile(t, "beacon.toml", `
+secret = "`+testSecret+`"
+base_url = "https://example.com"
+database_url = "sqlite://app.db"
+
+[session]
+expires_in = "24h"
+stores = ["cookie", "database"]
+`)
+	l := &Loader{
+		Files: []string{path},
+		Environ: []string{
+			"BEACON_SESSION_EXPIRES_IN=48h",
+			"BEACON_TRUSTED_ORIGINS=https://a.example.com, https://b.example.com",
+			"BEACON_OAUTH_GOOGLE_CLIENT_ID=g-id",
+			"BEACON_OAUTH_GOOGLE_CLIENT_SECRET=g-secret",
+			"OTHER_VARIABLE=ignored",
+		},
+		Overrides: []func(*Config){func(c *Config) { c.AppName = "Example" }},
+	}
+	cfg, err := l.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Session.ExpiresIn != 48*time.Hour {
+		t.Errorf("expires_in = %v, want the variable's 48h", cfg.Session.ExpiresIn)
+	}
+	if len(cfg.TrustedOrigins) != 2 || cfg.TrustedOrigins[1] != "https://b.example.com" {
+		t.Errorf("trusted_origins = %q", cfg.TrustedOrigins)
+	}
+	if cfg.OAuth["google"].ClientSecret != "g-secret" || cfg.AppName != "Example" {
+		t.Errorf("oauth = %+v, app_name = %q", cfg.OAuth, cfg.AppName)
+	}
+}
+
+func TestLoad_ReportsEveryProblem(t *testing.T) {
+	path := writeFile(t, "beacon.yaml", `
+secret: short
+base_url: example.com
+database_url: sqlite://app.db
+email_password:
+  enabled: false
+sesion:
+  expires_in: 24h
+`)
+	_, err := (&Loader{
+		Files:   []string{path},
+		Environ: []string{"BEACON_SESSION_IDLE_TIMEOUT=soon", "BEACON_SECRETS=x"},
+	}).Load()
+	got := strings.Join(problemKeys(t, err), ",")
+	want := "base_url,oauth,secret,secrets,sesion,session.idle_timeout"
+	if got != want {
+		t.Errorf("problems = %s, want %s", got, want)
+	}
+	for _, fragment := range []string{
+		`did you mean "session"?`,
+		"at least 32 characters",
+		"(BEACON_SECRET)",
+		"unknown variable (BEACON_SECRETS)",
+		`session.idle_timeout: must be a duration such as "10m" or "168h", got "soon" (BEACON_SESSION_IDLE_TIMEOUT)`,
+	} {
+		if !strings.Contains(err.Error(), fragment) {
+			t.Errorf("error does not mention %q:\n%v", fragment, err)
+		}
+	}
+}
+
+func TestLoad_NumericDuration(t *testing.T) {
+	path := writeFile(t, "beacon.yaml", "session:\n  expires_in: 3600\n")
+	_, err := (&Loader{Files: []string{path}, Environ: []string{}}).Load()
+	if err == nil || !strings.Contains(err.Error(), `session.expires_in: must be a duration such as "10m"`) {
+		t.Errorf("Load() error = %v, want a duration problem", err)
+	}
+}
+
+func TestValidate_Stores(t *testing.T) {
+	tests := []struct {
+		name  string
+		set   func(*SessionConfig)
+		wants string
+	}{
+		{"no store", func(s *SessionConfig) { s.Stores = nil }, "session.stores"},
+		{"unknown store", func(s *SessionConfig) { s.Stores = []string{"memcached"} }, "session.stores"},
+		{"redis without url", func(s *SessionConfig) { s.Stores = []string{StoreRedis} }, "session.redis_url"},
+		{"url without redis", func(s *SessionConfig) { s.RedisURL = "redis://localhost:6379" }, "session.redis_url"},
+		{"hashing without database", func(s *SessionConfig) {
+			s.Stores = []string{StoreCookie}
+			s.HashTokens = true
+		}, "session.hash_tokens"},
+		{"limit without server-side store", func(s *SessionConfig) {
+			s.Stores = []string{StoreCookie}
+			s.MaxSessionsPerUser = 5
+		}, "session.max_sessions_per_user"},
+		{"insecure none", func(s *SessionConfig) {
+			s.CookieSameSite = "none"
+			s.CookieSecure = false
+		}, "session.cookie_secure"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.set(&cfg.Session)
+			if got := strings.Join(problemKeys(t, cfg.Validate()), ","); got != tt.wants {
+				t.Errorf("problems = %s, want %s", got, tt.wants)
+			}
+		})
+	}
+
+	cfg := validConfig()
+	cfg.Session.Stores = []string{StoreCookie, StoreRedis}
+	cfg.Session.RedisURL = "redis://localhost:6379/0"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() with Redis = %v", err)
+	}
+}
+
+func TestValidate_OAuth(t *testing.T) {
+	cfg := validConfig()
+	cfg.EmailPassword.Enabled = false
+	cfg.OAuth = map[string]OAuthProviderConfig{
+		"githb": {ClientID: "id", ClientSecret: "secret"},
+		"apple": {ClientID: "id", TeamID: "team", KeyID: "key", PrivateKey: "pem"},
+		"slack": {ClientID: "id"},
+	}
+	err := cfg.Validate()
+	if got := strings.Join(problemKeys(t, err), ","); got != "oauth.githb,oauth.slack.client_secret" {
+		t.Errorf("problems = %s", got)
+	}
+	if !strings.Contains(err.Error(), `did you mean "github"?`) {
+		t.Errorf("error = %v, want a suggestion", err)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	cfg := validConfig()
+	cfg.OAuth = map[string]OAuthProviderConfig{"github": {ClientID: "id", ClientSecret: "secret"}}
+	cfg.RateLimit.Credentials = RateLimitClassConfig{Limit: 5, Window: time.Minute}
+	cfg.Session.ExpiresIn = 12 * time.Hour
+
+	var built *core.Config
+	opts := append(cfg.Options(), beaconauth.WithAdapter(memory.New()), func(c *core.Config) error {
+		built = c
+		return nil
+	})
+	auth, err := beaconauth.New(opts...)
+	if err != nil {
+		t.Fatalf("beaconauth.New() error = %v", err)
+	}
+	defer auth.Close()
+
+	if built.Session.ExpiresIn != 12*time.Hour || !built.Session.Stores.Database || built.Session.Stores.Redis {
+		t.Errorf("session = %+v, stores = %+v", built.Session, built.Session.Stores)
+	}
+	var ids []string
+	for _, p := range built.Plugins {
+		ids = append(ids, p.ID())
+	}
+	if got := strings.Join(ids, ","); got != "email_password,oauth" {
+		t.Errorf("plugins = %s, want email_password,oauth", got)
+	}
+}
+
+func validConfig() *Config {
+	cfg := Default()
+	cfg.Secret = testSecret
+	cfg.BaseURL = "https://example.com"
+	cfg.DatabaseURL = "sqlite://app.db"
+	return cfg
+}
+
+// mapSecrets serves secrets from a map
+type mapSecrets map[string]string
+
+func (m mapSecrets) GetSecret(ctx context.Context, name string) (string, error) {
+	value, ok := m[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", core.ErrSecretNotFound, name)
+	}
+	return value, nil
+}
+
+func TestLoad_SecretReferences(t *testing.T) {
+	keys := "v1:" + base64.StdEncoding.EncodeToString([]byte(testSecret))
+	provider := mapSecrets{
+		"beacon/session#keys":  keys,
+		"beacon/oauth#github":  "gh-secret",
+		"beacon/smtp#password": "hunter2",
+	}
+	path := writeFile(t, "beacon.yaml", `
+secret_keys: secret:beacon/session#keys
+base_url: https://example.com
+database_url: sqlite://app.db
+oauth:
+  github:
+    client_id: gh-id
+    client_secret: secret:beacon/oauth#github
+plugins:
+  mailer:
+    smtp:
+      password: secret:beacon/smtp#password
+`)
+	cfg, err := (&Loader{Files: []string{path}, Environ: []string{}, Secrets: provider}).Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.SecretKeys != keys || cfg.OAuth["github"].ClientSecret != "gh-secret" {
+		t.Errorf("secret_keys = %q, oauth = %+v", cfg.SecretKeys, cfg.OAuth)
+	}
+	if smtp := cfg.Plugins["mailer"]["smtp"].(map[string]interface{}); smtp["password"] != "hunter2" {
+		t.Errorf("plugins.mailer.smtp = %+v", smtp)
+	}
+
+	// The session keys and the client secret rotate with the provider. No
+	// mailer plugin is registered here.
+	cfg.Plugins = nil
+	var built *core.Config
+	opts := append(cfg.Options(), beaconauth.WithAdapter(memory.New()), func(c *core.Config) error {
+		built = c
+		return nil
+	})
+	auth, err := beaconauth.New(opts...)
+	if err != nil {
+		t.Fatalf("beaconauth.New() error = %v", err)
+	}
+	defer auth.Close()
+	if built.Secrets == nil || built.Secrets.SessionKeys != "beacon/session#keys" || auth.Context().Secrets == nil {
+		t.Errorf("secrets = %+v, want the session keys secret", built.Secrets)
+	}
+
+	// References need a provider, and a secret that exists
+	_, err = (&Loader{Files: []string{path}, Environ: []string{}, Secrets: mapSecrets{}}).Load()
+	if got := strings.Join(problemKeys(t, err), ","); got != "oauth.github.client_secret,plugins.mailer.smtp.password,secret_keys" {
+		t.Errorf("problems = %s", got)
+	}
+	_, err = (&Loader{Files: []string{path}, Environ: []string{}}).Load()
+	if err == nil || !strings.Contains(err.Error(), "no secret provider is set") {
+		t.Errorf("Load() without Secrets error = %v", err)
+	}
+}
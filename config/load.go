@@ -0,0 +1,363 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// DefaultEnvPrefix prefixes the environment variables read by Load
+const DefaultEnvPrefix = "BEACON_"
+
+// Loader reads a configuration from files, then the environment, then
+// overrides, each overriding the previous ones, and validates the result
+type Loader struct {
+	// Files are read in order. Their format follows the extension: .yaml
+	// or .yml for YAML, .toml for TOML.
+	Files []string
+
+	// EnvPrefix prefixes the variables (default DefaultEnvPrefix)
+	EnvPrefix string
+
+	// Environ lists the variables as "KEY=value" (nil = os.Environ())
+	Environ []string
+
+	// Overrides change the configuration last, before validation
+	Overrides []func(*Config)
+
+	// Secrets resolves values of the form "secret:NAME" (see
+	// SecretPrefix), such as a client secret kept in Vault. Nil rejects
+	// them.
+	Secrets core.SecretProvider
+}
+
+// Load reads files and BEACON_* variables over the defaults and validates
+// the configuration
+func Load(files ...string) (*Config, error) {
+	return (&Loader{Files: files}).Load()
+}
+
+// Load reads and validates the configuration. Unknown keys and variables,
+// malformed values and invalid settings are reported together in an
+// *Error; unreadable or unparsable files fail at once.
+func (l *Loader) Load() (*Config, error) {
+	prefix := l.EnvPrefix
+	if prefix == "" {
+		prefix = DefaultEnvPrefix
+	}
+	environ := l.Environ
+	if environ == nil {
+		environ = os.Environ()
+	}
+
+	cfg := Default()
+	var problems []Problem
+	for _, path := range l.Files {
+		fileProblems, err := readFile(path, cfg)
+		if err != nil {
+			return nil, err
+		}
+		problems = append(problems, fileProblems...)
+	}
+	problems = append(problems, applyEnv(cfg, prefix, environ)...)
+	for _, override := range l.Overrides {
+		override(cfg)
+	}
+	problems = append(problems, resolveSecrets(cfg, l.Secrets)...)
+	cfg.secrets = l.Secrets
+
+	// Settings already reported are not validated again
+	reported := make(map[string]bool, len(problems))
+	for _, p := range problems {
+		reported[p.Key] = true
+	}
+	for _, p := range withEnv(prefix, cfg.validate()) {
+		if !reported[p.Key] {
+			problems = append(problems, p)
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, newError(problems)
+	}
+	return cfg, nil
+}
+
+// readFile decodes a YAML or TOML file over cfg
+func readFile(path string, cfg *Config) ([]Problem, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var raw map[string]interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, yaml.FormatError(err, false, true))
+		}
+	case ".toml":
+		if err := toml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		// Decoded like YAML from here, for durations such as "10m"
+		if data, err = yaml.Marshal(raw); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s: unsupported config file extension %q (use .yaml, .yml or .toml)", path, ext)
+	}
+
+	// Decoding would fail on the first problem, so the other settings
+	// are decoded without the reported keys
+	problems := checkKeys(path, "", raw, reflect.TypeOf(Config{}))
+	if len(problems) > 0 {
+		if data, err = yaml.Marshal(raw); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, yaml.FormatError(err, false, false))
+	}
+	return problems, nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// checkKeys reports and removes the keys of raw that t has no field for,
+// and durations given as numbers, which would be read as nanoseconds
+func checkKeys(path, parent string, raw map[string]interface{}, t reflect.Type) []Problem {
+	fields := yamlFields(t)
+	var problems []Problem
+	for _, key := range sortedKeys(raw) {
+		value := raw[key]
+		field, ok := fields[key]
+		if !ok {
+			problems = append(problems, Problem{
+				Key:     parent + key,
+				Message: "unknown key in " + path + suggest(key, sortedKeys(fields)),
+			})
+			delete(raw, key)
+			continue
+		}
+		switch {
+		case field.Type == durationType:
+			if _, ok := value.(string); !ok && value != nil {
+				problems = append(problems, Problem{
+					Key:     parent + key,
+					Message: fmt.Sprintf("must be a duration such as \"10m\" or \"168h\", got %v in %s", value, path),
+				})
+				delete(raw, key)
+			}
+		case field.Type.Kind() == reflect.Struct:
+			if m, ok := value.(map[string]interface{}); ok {
+				problems = append(problems, checkKeys(path, parent+key+".", m, field.Type)...)
+			}
+		case field.Type.Kind() == reflect.Map && field.Type.Elem().Kind() == reflect.Struct:
+			if m, ok := value.(map[string]interface{}); ok {
+				for _, name := range sortedKeys(m) {
+					if entry, ok := m[name].(map[string]interface{}); ok {
+						problems = append(problems, checkKeys(path, parent+key+"."+name+".", entry, field.Type.Elem())...)
+					}
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// yamlFields maps the yaml keys of struct t to its fields
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if key, _, _ := strings.Cut(f.Tag.Get("yaml"), ","); key != "" && key != "-" {
+			fields[key] = f
+		}
+	}
+	return fields
+}
+
+// suggest names the candidate closest to a misspelt key
+func suggest(key string, candidates []string) string {
+	best, bestDistance := "", 3 // Only close matches help
+	for _, known := range candidates {
+		if d := editDistance(key, known); d < bestDistance {
+			best, bestDistance = known, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean %q?)", best)
+}
+
+// editDistance is the Levenshtein distance of a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// envName returns the variable of a key, e.g. BEACON_SESSION_EXPIRES_IN
+// for session.expires_in
+func envName(prefix, key string) string {
+	return prefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// hasVariable reports whether a key can be set by a variable: a leaf
+// setting outside plugins, or a field of a known OAuth provider
+func hasVariable(key string) bool {
+	t := reflect.TypeOf(Config{})
+	parts := strings.Split(key, ".")
+	for i := 0; i < len(parts); i++ {
+		field, ok := yamlFields(t)[parts[i]]
+		switch {
+		case !ok:
+			return false
+		case field.Type != durationType && field.Type.Kind() == reflect.Struct:
+			t = field.Type
+		case field.Type.Kind() == reflect.Map:
+			if field.Type.Elem().Kind() != reflect.Struct || i+1 >= len(parts) || !knownProvider(parts[i+1]) {
+				return false
+			}
+			t = field.Type.Elem()
+			i++
+		default:
+			return i == len(parts)-1
+		}
+	}
+	return false
+}
+
+// applyEnv sets the fields whose variables are set in environ. Variables
+// with the prefix that name no key are reported.
+func applyEnv(cfg *Config, prefix string, environ []string) []Problem {
+	vars := make(map[string]string)
+	for _, kv := range environ {
+		if name, value, ok := strings.Cut(kv, "="); ok && strings.HasPrefix(name, prefix) {
+			vars[name] = value
+		}
+	}
+	if len(vars) == 0 {
+		return nil
+	}
+
+	used := make(map[string]bool)
+	var problems []Problem
+	set := func(key string, field reflect.Value) {
+		name := envName(prefix, key)
+		value, ok := vars[name]
+		if !ok {
+			return
+		}
+		used[name] = true
+		if err := setFromEnv(field, value); err != nil {
+			problems = append(problems, Problem{Key: key, Env: name, Message: err.Error()})
+		}
+	}
+
+	root := reflect.ValueOf(cfg).Elem()
+	var walk func(parent string, v reflect.Value)
+	walk = func(parent string, v reflect.Value) {
+		for i := 0; i < v.NumField(); i++ {
+			key, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+			field := v.Field(i)
+			switch {
+			case field.Type() != durationType && field.Kind() == reflect.Struct:
+				walk(parent+key+".", field)
+			case field.Kind() == reflect.Map:
+				// Only oauth has variables, below
+			default:
+				set(parent+key, field)
+			}
+		}
+	}
+	walk("", root)
+
+	// oauth.<provider>.<field>, for each known provider
+	for _, id := range ProviderIDs {
+		provider := reflect.New(reflect.TypeOf(OAuthProviderConfig{})).Elem()
+		if existing, ok := cfg.OAuth[id]; ok {
+			provider.Set(reflect.ValueOf(existing))
+		}
+		before := len(used)
+		walk("oauth."+id+".", provider)
+		if len(used) > before {
+			if cfg.OAuth == nil {
+				cfg.OAuth = make(map[string]OAuthProviderConfig)
+			}
+			cfg.OAuth[id] = provider.Interface().(OAuthProviderConfig)
+		}
+	}
+
+	for _, name := range sortedKeys(vars) {
+		if !used[name] {
+			problems = append(problems, Problem{
+				Key:     strings.ToLower(strings.TrimPrefix(name, prefix)),
+				Env:     name,
+				Message: "unknown variable",
+			})
+		}
+	}
+	return problems
+}
+
+// setFromEnv parses a variable into a field
+func setFromEnv(field reflect.Value, value string) error {
+	switch {
+	case field.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("must be a duration such as \"10m\" or \"168h\", got %q", value)
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("must be true or false, got %q", value)
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("must be a whole number, got %q", value)
+		}
+		field.SetInt(int64(n))
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("cannot be set from the environment")
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"sort"
+
+	"github.com/marshallshelly/beacon-auth/plugins/oauth/providers"
+)
+
+// ProviderIDs lists the OAuth providers the oauth section configures
+var ProviderIDs = []string{
+	"apple", "bitbucket", "discord", "facebook", "github", "gitlab", "google",
+	"linkedin", "microsoft", "slack", "spotify", "twitch", "x",
+}
+
+// newProvider creates the provider with ID id, one of ProviderIDs
+func newProvider(id string, p OAuthProviderConfig) providers.OAuthProvider {
+	switch id {
+	case "apple":
+		return providers.NewApple(&providers.AppleOptions{
+			ClientID:     p.ClientID,
+			TeamID:       p.TeamID,
+			KeyID:        p.KeyID,
+			PrivateKey:   p.PrivateKey,
+			Scopes:       p.Scopes,
+			ClientSecret: p.ClientSecret,
+		})
+	case "bitbucket":
+		return providers.NewBitbucket(&providers.BitbucketOptions{ClientID: p.ClientID, ClientSecret: p.ClientSecret, Scopes: p.Scopes})
+	case "discord":
+		return providers.NewDiscord(&providers.DiscordOptions{ClientID: p.ClientID, ClientSecret: p.ClientSecret, Scopes: p.Scopes})
+	case "facebook":
+		return providers.NewFacebook(&providers.FacebookOptions{ClientID: p.ClientID, ClientSecret: p.ClientSecret, Scopes: p.Scopes})
+	case "github":
+		return providers.NewGitHub(p.ClientID, p.ClientSecret, p.Scopes)
+	case "gitlab":
+		return providers.NewGitLab(&providers.GitLabOptions{ClientID: p.ClientID, ClientSecret: p.ClientSecret, BaseURL: p.BaseURL, Scopes: p.Scopes})
+	case "google":
+		return providers.NewGoogle(&providers.GoogleOptions{ClientID: p.ClientID, ClientSecret: p.ClientSecret, Scopes: p.Scopes})
+	case "linkedin":
+		return providers.NewLinkedIn(&providers.LinkedInOptions{ClientID: p.ClientID, ClientSecret: p.ClientSecret, Scopes: p.Scopes})
+	case "microsoft":
+		return providers.NewMicrosoft(&providers.MicrosoftOptions{ClientID: p.ClientID, ClientSecret: p.ClientSecret, TenantID: p.TenantID, Scopes: p.Scopes})
+	case "slack":
+		return providers.NewSlack(&providers.SlackOptions{ClientID: p.ClientID, ClientSecret: p.ClientSecret, TeamID: p.TeamID, Scopes: p.Scopes})
+	case "spotify":
+		return providers.NewSpotify(&providers.SpotifyOptions{ClientID: p.ClientID, ClientSecret: p.ClientSecret, Scopes: p.Scopes})
+	case "twitch":
+		return providers.NewTwitch(&providers.TwitchOptions{ClientID: p.ClientID, ClientSecret: p.ClientSecret, Scopes: p.Scopes})
+	case "x":
+		return providers.NewX(&providers.XOptions{ClientID: p.ClientID, ClientSecret: p.ClientSecret, Scopes: p.Scopes})
+	}
+	return nil
+}
+
+// knownProvider reports whether id is one of ProviderIDs
+func knownProvider(id string) bool {
+	for _, known := range ProviderIDs {
+		if id == known {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
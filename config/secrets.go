@@ -0,0 +1,94 @@
+package config
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// SecretPrefix marks a value read from Loader.Secrets: "secret:NAME" is
+// replaced by the secret NAME, e.g. "secret:beacon/oauth#github"
+const SecretPrefix = "secret:"
+
+// resolveSecrets replaces the secret references of cfg with their values
+// and remembers them, so Options can rotate the session keys and OAuth
+// client secrets
+func resolveSecrets(cfg *Config, provider core.SecretProvider) []Problem {
+	var cache *core.Secrets
+	if provider != nil {
+		cache = core.NewSecrets(provider, -1, nil)
+	}
+	var problems []Problem
+	resolve := func(key, value string) (string, bool) {
+		name, ok := strings.CutPrefix(value, SecretPrefix)
+		if !ok {
+			return value, false
+		}
+		if cache == nil {
+			problems = append(problems, Problem{Key: key, Message: "is a secret reference, but no secret provider is set (Loader.Secrets)"})
+			return "", false
+		}
+		secret, err := cache.Get(context.Background(), name)
+		if err != nil {
+			problems = append(problems, Problem{Key: key, Message: err.Error()})
+			return "", false
+		}
+		if cfg.secretRefs == nil {
+			cfg.secretRefs = make(map[string]string)
+		}
+		cfg.secretRefs[key] = name
+		return secret, true
+	}
+
+	var walk func(parent string, v reflect.Value)
+	walk = func(parent string, v reflect.Value) {
+		for i := 0; i < v.NumField(); i++ {
+			key, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+			if key == "" || key == "-" {
+				continue
+			}
+			field := v.Field(i)
+			switch {
+			case field.Kind() == reflect.String:
+				if value, ok := resolve(parent+key, field.String()); ok {
+					field.SetString(value)
+				}
+			case field.Type() != durationType && field.Kind() == reflect.Struct:
+				walk(parent+key+".", field)
+			}
+		}
+	}
+	walk("", reflect.ValueOf(cfg).Elem())
+
+	for _, id := range sortedKeys(cfg.OAuth) {
+		provider := reflect.New(reflect.TypeOf(OAuthProviderConfig{})).Elem()
+		provider.Set(reflect.ValueOf(cfg.OAuth[id]))
+		walk("oauth."+id+".", provider)
+		cfg.OAuth[id] = provider.Interface().(OAuthProviderConfig)
+	}
+
+	var walkSettings func(key string, value interface{}) interface{}
+	walkSettings = func(key string, value interface{}) interface{} {
+		switch v := value.(type) {
+		case string:
+			if secret, ok := resolve(key, v); ok {
+				return secret
+			}
+		case map[string]interface{}:
+			for k, item := range v {
+				v[k] = walkSettings(key+"."+k, item)
+			}
+		case []interface{}:
+			for i, item := range v {
+				v[i] = walkSettings(key, item)
+			}
+		}
+		return value
+	}
+	for _, id := range sortedKeys(cfg.Plugins) {
+		walkSettings("plugins."+id, cfg.Plugins[id])
+	}
+	return problems
+}
@@ -0,0 +1,289 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrorFormatVersion is the version of the error response format. It is
+// sent in every error response and changes only when existing fields
+// change meaning; new fields and codes are added without a new version.
+const ErrorFormatVersion = 1
+
+// ProblemContentType is the media type of RFC 7807 problem details
+const ProblemContentType = "application/problem+json"
+
+// ProblemTypePrefix prefixes the error code in the type of problem details
+const ProblemTypePrefix = "urn:beacon-auth:error:"
+
+// ErrorCode is a stable, machine-readable error identifier. Clients should
+// branch on codes, never on messages, which may change or be translated.
+type ErrorCode string
+
+// Error codes of the catalog
+const (
+	CodeInvalidRequest      ErrorCode = "invalid_request"
+	CodeValidation          ErrorCode = "validation_error"
+	CodeUnauthorized        ErrorCode = "unauthorized"
+	CodeNoSession           ErrorCode = "no_session"
+	CodeInvalidCredentials  ErrorCode = "invalid_credentials"
+	CodeInvalidCode         ErrorCode = "invalid_code"
+	CodeInvalidToken        ErrorCode = "invalid_token"
+	CodeForbidden           ErrorCode = "forbidden"
+	CodeSignupDisabled      ErrorCode = "signup_disabled"
+	CodeEmailNotVerified    ErrorCode = "email_not_verified"
+	CodeSessionLimitReached ErrorCode = "session_limit_reached"
+	CodeNotFound            ErrorCode = "not_found"
+	CodeMethodNotAllowed    ErrorCode = "method_not_allowed"
+	CodeConflict            ErrorCode = "conflict"
+	CodeUserExists          ErrorCode = "user_exists"
+	CodeAccountLinkRequired ErrorCode = "account_link_required"
+	CodeRateLimited         ErrorCode = "rate_limited"
+	CodeInternal            ErrorCode = "internal_error"
+	CodeHashError           ErrorCode = "hash_error"
+	CodeSessionError        ErrorCode = "session_error"
+	CodeCreateError         ErrorCode = "create_error"
+	CodeDatabaseError       ErrorCode = "database_error"
+	CodeInvalidTenant       ErrorCode = "invalid_tenant"
+	CodeTenantRequired      ErrorCode = "tenant_required"
+	CodeAccountBanned       ErrorCode = "account_banned"
+	CodeServerBusy          ErrorCode = "server_busy"
+)
+
+// ErrorDefinition describes a code of the catalog
+type ErrorDefinition struct {
+	Code ErrorCode `json:"code"`
+
+	// Status is the HTTP status the code is usually sent with
+	Status int `json:"status"`
+
+	// Title is a short, fixed summary of the problem
+	Title string `json:"title"`
+}
+
+var errorCatalogMu sync.RWMutex
+
+var errorCatalog = map[ErrorCode]ErrorDefinition{
+	CodeInvalidRequest:      {CodeInvalidRequest, http.StatusBadRequest, "Invalid request"},
+	CodeValidation:          {CodeValidation, http.StatusBadRequest, "Validation failed"},
+	CodeUnauthorized:        {CodeUnauthorized, http.StatusUnauthorized, "Authentication required"},
+	CodeNoSession:           {CodeNoSession, http.StatusUnauthorized, "No active session"},
+	CodeInvalidCredentials:  {CodeInvalidCredentials, http.StatusUnauthorized, "Invalid credentials"},
+	CodeInvalidCode:         {CodeInvalidCode, http.StatusUnauthorized, "Invalid verification code"},
+	CodeInvalidToken:        {CodeInvalidToken, http.StatusUnauthorized, "Invalid or expired token"},
+	CodeForbidden:           {CodeForbidden, http.StatusForbidden, "Forbidden"},
+	CodeSignupDisabled:      {CodeSignupDisabled, http.StatusForbidden, "Sign up is disabled"},
+	CodeEmailNotVerified:    {CodeEmailNotVerified, http.StatusForbidden, "Email not verified"},
+	CodeSessionLimitReached: {CodeSessionLimitReached, http.StatusForbidden, "Session limit reached"},
+	CodeNotFound:            {CodeNotFound, http.StatusNotFound, "Not found"},
+	CodeMethodNotAllowed:    {CodeMethodNotAllowed, http.StatusMethodNotAllowed, "Method not allowed"},
+	CodeConflict:            {CodeConflict, http.StatusConflict, "Conflict"},
+	CodeUserExists:          {CodeUserExists, http.StatusConflict, "User already exists"},
+	CodeAccountLinkRequired: {CodeAccountLinkRequired, http.StatusConflict, "Account link required"},
+	CodeRateLimited:         {CodeRateLimited, http.StatusTooManyRequests, "Too many requests"},
+	CodeInternal:            {CodeInternal, http.StatusInternalServerError, "Internal server error"},
+	CodeHashError:           {CodeHashError, http.StatusInternalServerError, "Password hashing failed"},
+	CodeSessionError:        {CodeSessionError, http.StatusInternalServerError, "Session creation failed"},
+	CodeCreateError:         {CodeCreateError, http.StatusInternalServerError, "Record creation failed"},
+	CodeDatabaseError:       {CodeDatabaseError, http.StatusInternalServerError, "Database error"},
+	CodeInvalidTenant:       {CodeInvalidTenant, http.StatusBadRequest, "Invalid tenant"},
+	CodeTenantRequired:      {CodeTenantRequired, http.StatusBadRequest, "Tenant required"},
+	CodeAccountBanned:       {CodeAccountBanned, http.StatusForbidden, "Account banned"},
+	CodeServerBusy:          {CodeServerBusy, http.StatusServiceUnavailable, "Server busy"},
+}
+
+// statusCodes are the codes used for a status when no code is given
+var statusCodes = map[int]ErrorCode{
+	http.StatusBadRequest:          CodeInvalidRequest,
+	http.StatusUnauthorized:        CodeUnauthorized,
+	http.StatusForbidden:           CodeForbidden,
+	http.StatusNotFound:            CodeNotFound,
+	http.StatusMethodNotAllowed:    CodeMethodNotAllowed,
+	http.StatusConflict:            CodeConflict,
+	http.StatusTooManyRequests:     CodeRateLimited,
+	http.StatusInternalServerError: CodeInternal,
+}
+
+// ErrorCatalog returns the definitions of all error codes, sorted by code
+func ErrorCatalog() []ErrorDefinition {
+	errorCatalogMu.RLock()
+	defer errorCatalogMu.RUnlock()
+	defs := make([]ErrorDefinition, 0, len(errorCatalog))
+	for _, def := range errorCatalog {
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Code < defs[j].Code })
+	return defs
+}
+
+// LookupError returns the definition of code
+func LookupError(code ErrorCode) (ErrorDefinition, bool) {
+	errorCatalogMu.RLock()
+	defer errorCatalogMu.RUnlock()
+	def, ok := errorCatalog[code]
+	return def, ok
+}
+
+// RegisterErrorCode adds a plugin's code to the catalog. Codes of the
+// catalog cannot be redefined. Call it from init or Plugin.Init.
+func RegisterErrorCode(def ErrorDefinition) bool {
+	errorCatalogMu.Lock()
+	defer errorCatalogMu.Unlock()
+	if _, exists := errorCatalog[def.Code]; exists || def.Code == "" {
+		return false
+	}
+	errorCatalog[def.Code] = def
+	return true
+}
+
+// StatusErrorCode returns the generic code of an HTTP status
+func StatusErrorCode(status int) ErrorCode {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeInvalidRequest
+}
+
+// FieldError describes why a request field is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *FieldError) Error() string {
+	return e.Message
+}
+
+// ErrorResponse is the JSON body of error responses
+type ErrorResponse struct {
+	// Error is the error code
+	Error   string       `json:"error"`
+	Message string       `json:"message"`
+	Details []FieldError `json:"details,omitempty"`
+
+	// Meta holds code-specific data, such as the expiry of a ban
+	Meta    map[string]interface{} `json:"meta,omitempty"`
+	TraceID string                 `json:"trace_id,omitempty"`
+	Version int                    `json:"version"`
+}
+
+// Problem is the RFC 7807 form of an error response, sent to clients that
+// accept application/problem+json
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code"`
+	Errors   []FieldError `json:"errors,omitempty"`
+
+	// Meta holds code-specific data, such as the expiry of a ban
+	Meta    map[string]interface{} `json:"meta,omitempty"`
+	TraceID string                 `json:"trace_id,omitempty"`
+	Version int                    `json:"version"`
+}
+
+// WithTraceID sets the trace ID reported in error responses
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceIDContextKey, traceID)
+}
+
+// TraceID returns the trace ID of a request: the one set with WithTraceID,
+// the X-Request-Id header, or the trace ID of a W3C traceparent header
+func TraceID(r *http.Request) string {
+	if id, ok := r.Context().Value(traceIDContextKey).(string); ok && id != "" {
+		return id
+	}
+	if id := r.Header.Get("X-Request-Id"); id != "" {
+		return id
+	}
+	// traceparent is version-traceid-parentid-flags
+	if parts := strings.Split(r.Header.Get("traceparent"), "-"); len(parts) == 4 && len(parts[1]) == 32 {
+		return parts[1]
+	}
+	return ""
+}
+
+// WantsProblem reports whether the client prefers RFC 7807 problem details
+// to the JSON error format
+func WantsProblem(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err == nil && mediaType == ProblemContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteError writes an error response with code, negotiating the format
+// from the Accept header. An empty code uses the generic code of status.
+// With a Localizer in the request context, the message and field errors
+// are translated into the request's locale.
+func WriteError(w http.ResponseWriter, r *http.Request, status int, code ErrorCode, message string, details ...FieldError) {
+	writeError(w, r, status, code, message, details, nil)
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, code ErrorCode, message string, details []FieldError, meta map[string]interface{}) {
+	if code == "" {
+		code = StatusErrorCode(status)
+	}
+	traceID := TraceID(r)
+	message, details, locale := localizeError(r, code, message, details)
+	if locale != "" {
+		w.Header().Set("Content-Language", locale)
+	}
+
+	if WantsProblem(r) {
+		title := http.StatusText(status)
+		if def, ok := LookupError(code); ok {
+			title = def.Title
+		}
+		writeErrorBody(w, ProblemContentType, status, &Problem{
+			Type:     ProblemTypePrefix + string(code),
+			Title:    title,
+			Status:   status,
+			Detail:   message,
+			Instance: r.URL.Path,
+			Code:     string(code),
+			Errors:   details,
+			Meta:     meta,
+			TraceID:  traceID,
+			Version:  ErrorFormatVersion,
+		})
+		return
+	}
+
+	writeErrorBody(w, "application/json", status, &ErrorResponse{
+		Error:   string(code),
+		Message: message,
+		Details: details,
+		Meta:    meta,
+		TraceID: traceID,
+		Version: ErrorFormatVersion,
+	})
+}
+
+// WriteStatusError writes an error response with the generic code of
+// status. It replaces http.Error in endpoint handlers.
+func WriteStatusError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	WriteError(w, r, status, "", message)
+}
+
+func writeErrorBody(w http.ResponseWriter, contentType string, status int, body interface{}) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	// The status is sent; an encoding error cannot be reported
+	_ = json.NewEncoder(w).Encode(body)
+}
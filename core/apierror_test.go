@@ -0,0 +1,105 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteError_JSON(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/auth/signup", nil)
+	req.Header.Set("X-Request-Id", "req-123")
+	w := httptest.NewRecorder()
+
+	WriteError(w, req, http.StatusBadRequest, CodeValidation, "email is required",
+		FieldError{Field: "email", Code: "required", Message: "email is required"})
+
+	if w.Code != http.StatusBadRequest || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("Expected a 400 JSON response, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	var resp ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error != string(CodeValidation) || resp.Message != "email is required" ||
+		resp.TraceID != "req-123" || resp.Version != ErrorFormatVersion {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+	if len(resp.Details) != 1 || resp.Details[0].Field != "email" {
+		t.Errorf("Expected the field error in details, got %+v", resp.Details)
+	}
+}
+
+func TestWriteError_Problem(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/auth/signin", nil)
+	req.Header.Set("Accept", "application/problem+json, application/json;q=0.9")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+
+	WriteError(w, req, http.StatusUnauthorized, CodeInvalidCredentials, "Invalid email or password")
+
+	if w.Header().Get("Content-Type") != ProblemContentType {
+		t.Fatalf("Expected %s, got %q", ProblemContentType, w.Header().Get("Content-Type"))
+	}
+	var problem Problem
+	if err := json.NewDecoder(w.Body).Decode(&problem); err != nil {
+		t.Fatal(err)
+	}
+	want := Problem{
+		Type:     ProblemTypePrefix + "invalid_credentials",
+		Title:    "Invalid credentials",
+		Status:   http.StatusUnauthorized,
+		Detail:   "Invalid email or password",
+		Instance: "/auth/signin",
+		Code:     "invalid_credentials",
+		TraceID:  "4bf92f3577b34da6a3ce929d0e0e4736",
+		Version:  ErrorFormatVersion,
+	}
+	if problem.Type != want.Type || problem.Title != want.Title || problem.Status != want.Status ||
+		problem.Detail != want.Detail || problem.Instance != want.Instance || problem.Code != want.Code ||
+		problem.TraceID != want.TraceID || problem.Version != want.Version {
+		t.Errorf("Expected %+v, got %+v", want, problem)
+	}
+}
+
+func TestWriteStatusError(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/x", nil)
+	req = req.WithContext(WithTraceID(req.Context(), "trace-1"))
+	w := httptest.NewRecorder()
+
+	WriteStatusError(w, req, http.StatusTooManyRequests, "Too many requests")
+
+	var resp ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error != string(CodeRateLimited) || resp.TraceID != "trace-1" {
+		t.Errorf("Expected the generic code and context trace ID, got %+v", resp)
+	}
+	if code := StatusErrorCode(http.StatusBadGateway); code != CodeInternal {
+		t.Errorf("Expected 5xx statuses to map to %s, got %s", CodeInternal, code)
+	}
+}
+
+func TestErrorCatalog(t *testing.T) {
+	defs := ErrorCatalog()
+	for i, def := range defs {
+		if def.Status == 0 || def.Title == "" {
+			t.Errorf("Code %s has no status or title", def.Code)
+		}
+		if i > 0 && defs[i-1].Code >= def.Code {
+			t.Errorf("Expected the catalog sorted by code, got %s before %s", defs[i-1].Code, def.Code)
+		}
+	}
+
+	if RegisterErrorCode(ErrorDefinition{Code: CodeNotFound, Status: http.StatusGone, Title: "Gone"}) {
+		t.Error("Expected a built-in code not to be redefined")
+	}
+	if !RegisterErrorCode(ErrorDefinition{Code: "test_quota_exceeded", Status: http.StatusTooManyRequests, Title: "Quota exceeded"}) {
+		t.Fatal("Expected a new code to be registered")
+	}
+	if def, ok := LookupError("test_quota_exceeded"); !ok || def.Title != "Quota exceeded" {
+		t.Errorf("Expected the registered code in the catalog, got %+v", def)
+	}
+}
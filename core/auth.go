@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
+	"sync/atomic"
 )
 
 // Auth is the main authentication interface
@@ -28,7 +30,18 @@ type Auth interface {
 	// RevokeSession revokes a session
 	RevokeSession(ctx context.Context, token string) error
 
-	// Close cleans up resources
+	// Ready checks the database and the other dependencies, as served by
+	// /readyz (see HealthChecker)
+	Ready(ctx context.Context) *HealthReport
+
+	// Shutdown stops background work, flushes batched writes within ctx
+	// and closes plugins, the session stores and the adapter, in that
+	// order. /readyz fails from the moment it is called. Call it after the
+	// HTTP server has stopped serving requests.
+	Shutdown(ctx context.Context) error
+
+	// Close cleans up resources, including plugins that implement
+	// io.Closer. It is Shutdown without a deadline.
 	Close() error
 }
 
@@ -38,6 +51,10 @@ type beaconAuth struct {
 	ctx           *AuthContext
 	pluginManager *PluginManager
 	router        http.Handler
+	proxies       TrustedProxies
+
+	// shuttingDown fails readiness checks once Shutdown has started
+	shuttingDown atomic.Bool
 }
 
 // PluginManager manages plugins
@@ -54,21 +71,52 @@ func New(opts ...Option) (Auth, error) {
 		}
 	}
 
+	// Set default logger if not provided
+	if cfg.Advanced.Logger == nil {
+		cfg.Advanced.Logger = NewDefaultLogger()
+	}
+
+	// Fetch the session keys first, so they are validated like SecretKeys
+	var secrets *Secrets
+	if cfg.Secrets != nil && cfg.Secrets.Provider != nil {
+		secrets = NewSecrets(cfg.Secrets.Provider, cfg.Secrets.RefreshInterval, cfg.Advanced.Logger)
+		if name := cfg.Secrets.SessionKeys; name != "" {
+			keys, err := secrets.Get(context.Background(), name)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load session keys: %w", err)
+			}
+			cfg.SecretKeys = keys
+		}
+	}
+
 	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
 
+	proxies, err := ParseTrustedProxies(cfg.Advanced.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
 	a := &beaconAuth{
-		config: cfg,
+		config:  cfg,
+		proxies: proxies,
 	}
 
-	// Set default logger if not provided
-	if cfg.Advanced.Logger == nil {
-		cfg.Advanced.Logger = NewDefaultLogger()
+	// Set up the event bus; security events are published on it too
+	if cfg.Events == nil {
+		cfg.Events = NewEventBus(cfg.Advanced.Logger)
+	} else if cfg.Events.logger == nil {
+		cfg.Events.logger = cfg.Advanced.Logger
+	}
+	for _, sub := range cfg.EventSubscriptions {
+		cfg.Events.Subscribe(sub.Pattern, sub.Handler, sub.Options...)
 	}
+	cfg.SecurityEvents = &busSecuritySink{bus: cfg.Events, next: cfg.SecurityEvents}
 
 	// Initialize context
 	a.ctx = NewAuthContext(cfg)
+	a.ctx.Secrets = secrets
 
 	// Initialize managers
 	if cfg.DataManagerFactory == nil {
@@ -90,12 +138,35 @@ func New(opts ...Option) (Auth, error) {
 	}
 	a.ctx.SessionManager = sm
 
+	// Rotate the session keys with their secret
+	if secrets != nil && cfg.Secrets.SessionKeys != "" {
+		setter, ok := sm.(SessionKeySetter)
+		if !ok {
+			return nil, errors.New("session manager cannot replace its keys, required by the session keys secret")
+		}
+		_, err := secrets.Watch(context.Background(), cfg.Secrets.SessionKeys, func(keys string) {
+			if err := setter.SetSessionKeys(keys); err != nil {
+				cfg.Advanced.Logger.Error("Rotated session keys rejected; keeping the previous keys", "error", err)
+				return
+			}
+			cfg.Advanced.Logger.Info("Session keys rotated")
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load session keys: %w", err)
+		}
+	}
+
 	// Initialize plugin manager
 	pm := &PluginManager{
 		plugins: cfg.Plugins,
 	}
 	a.pluginManager = pm
 
+	// Configure plugins, so misconfiguration fails before any plugin starts
+	if err := ConfigurePlugins(pm.plugins, cfg.PluginSettings); err != nil {
+		return nil, err
+	}
+
 	// Initialize plugins
 	for _, plugin := range pm.plugins {
 		if err := plugin.Init(a.ctx); err != nil {
@@ -103,6 +174,20 @@ func New(opts ...Option) (Auth, error) {
 		}
 	}
 
+	// Collect hooks: the application's Before hooks first, then each
+	// plugin's in registration order, sorted by priority
+	hooks := &HookConfig{Before: append([]RequestHook(nil), cfg.BeforeHooks...)}
+	for _, p := range pm.plugins {
+		if hp, ok := p.(HookProvider); ok {
+			if h := hp.Hooks(); h != nil {
+				hooks.Before = append(hooks.Before, h.Before...)
+				hooks.After = append(hooks.After, h.After...)
+			}
+		}
+	}
+	SortHooks(hooks.Before)
+	SortHooks(hooks.After)
+
 	// Build router (placeholder for now)
 	// Build router
 	mux := http.NewServeMux()
@@ -124,29 +209,34 @@ func New(opts ...Option) (Auth, error) {
 		_, _ = w.Write([]byte("BeaconAuth"))
 	})
 
+	if cfg.RateLimit != nil && cfg.RateLimit.Enabled && cfg.RateLimit.Storage == nil {
+		cfg.RateLimit.Storage = NewMemoryRateLimitStorage()
+	}
+
 	// Register plugin routes
 	for _, p := range pm.plugins {
 		for path, endpoint := range p.Endpoints() {
 			if !strings.HasPrefix(path, "/") {
 				path = "/" + path
 			}
-			fullPath := basePath + path
-
-			// Capture closure variable
-			handler := endpoint.Handler
-			method := endpoint.Method
-
-			mux.HandleFunc(fullPath, func(w http.ResponseWriter, r *http.Request) {
-				if method != "" && r.Method != method {
-					http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-					return
-				}
-				handler(w, r)
-			})
+			mux.Handle(basePath+path, EndpointHandler(a.ctx, path, endpoint, hooks))
 		}
 	}
 
 	a.router = mux
+	if cfg.RateLimit != nil && cfg.RateLimit.Enabled {
+		a.router = rateLimitHandler(cfg.RateLimit, basePath, cfg.Advanced.Logger, mux)
+	}
+	a.router = a.healthHandler(basePath, a.router)
+	a.router = a.proxyHandler(a.router)
+
+	if !cfg.Advanced.DisableSecurityBanner {
+		a.ctx.SecurityPosture().Log(cfg.Advanced.Logger)
+	}
+
+	if secrets != nil {
+		secrets.Start()
+	}
 
 	cfg.Advanced.Logger.Info("BeaconAuth initialized successfully")
 
@@ -161,18 +251,31 @@ func (a *beaconAuth) Context() *AuthContext {
 	return a.ctx
 }
 
+// proxyHandler adds the trusted proxies to the request context, so the
+// client IP is resolved with them
+func (a *beaconAuth) proxyHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(ContextWithTrustedProxies(r.Context(), a.proxies)))
+	})
+}
+
 func (a *beaconAuth) Middleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			session, _ := a.GetSession(r.Context())
+		return a.proxyHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session, err := a.GetSession(r.Context())
+			var ban *BanError
+			if errors.As(err, &ban) {
+				WriteBanError(w, r, ban)
+				return
+			}
 			if session == nil {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				WriteStatusError(w, r, http.StatusUnauthorized, "Unauthorized")
 				return
 			}
 
 			ctx := WithSession(r.Context(), session)
 			next.ServeHTTP(w, r.WithContext(ctx))
-		})
+		}))
 	}
 }
 
@@ -185,8 +288,8 @@ func (a *beaconAuth) GetSession(ctx context.Context) (*Session, error) {
 	req := GetRequest(ctx)
 	if req != nil {
 		cookieName := a.ctx.Config.Session.CookieName
-		if cookie, err := req.Cookie(cookieName); err == nil {
-			session, _, err := a.ctx.SessionManager.Get(ctx, cookie.Value)
+		if token, err := ReadChunkedCookie(req, cookieName); err == nil {
+			session, _, err := a.ctx.SessionManager.Get(ctx, token)
 			return session, err
 		}
 	}
@@ -206,20 +309,72 @@ func (a *beaconAuth) CreateSession(ctx context.Context, userID string, opts *Ses
 	if a.ctx.SessionManager == nil {
 		return nil, errors.New("session manager not initialized")
 	}
-	session, _, _, err := a.ctx.SessionManager.Create(ctx, userID, opts)
-	return session, err
+	session, user, _, err := a.ctx.SessionManager.Create(ctx, userID, opts)
+	if err != nil {
+		return nil, err
+	}
+	a.ctx.EmitSessionCreated(ctx, user, session)
+	return session, nil
 }
 
 func (a *beaconAuth) RevokeSession(ctx context.Context, token string) error {
 	if a.ctx.SessionManager == nil {
 		return errors.New("session manager not initialized")
 	}
-	return a.ctx.SessionManager.Delete(ctx, token)
+	if err := a.ctx.SessionManager.Delete(ctx, token); err != nil {
+		return err
+	}
+	a.ctx.Events.Publish(ctx, TopicSessionRevoked, &SessionRevokedEvent{Token: token})
+	return nil
 }
 
 func (a *beaconAuth) Close() error {
+	return a.Shutdown(context.Background())
+}
+
+func (a *beaconAuth) Shutdown(ctx context.Context) error {
+	a.shuttingDown.Store(true)
+	var errs []error
+
+	// Stop refreshing secrets before their consumers close
+	if a.ctx.Secrets != nil {
+		_ = a.ctx.Secrets.Close()
+	}
+
+	// Plugins first, stopping their cleanup goroutines
+	for _, p := range a.config.Plugins {
+		if closer, ok := p.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("plugin %s: %w", p.ID(), err))
+			}
+		}
+	}
+
+	// Then sessions, flushing batched updates and activity before their
+	// stores close. The adapter stays open until the end.
+	if sm, ok := a.ctx.SessionManager.(interface{ Shutdown(context.Context) error }); ok {
+		if err := sm.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("session manager: %w", err))
+		}
+	}
+
+	_ = a.ctx.Events.Close()
+	if a.config.Session != nil {
+		if closer, ok := a.config.Session.UserCache.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("user cache: %w", err))
+			}
+		}
+	}
+	if closer, ok := a.ctx.SecurityEvents.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("security event sink: %w", err))
+		}
+	}
 	if a.ctx.Adapter != nil {
-		return a.ctx.Adapter.Close()
+		if err := a.ctx.Adapter.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("adapter: %w", err))
+		}
 	}
-	return nil
+	return errors.Join(errs...)
 }
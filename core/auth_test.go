@@ -41,6 +41,14 @@ func (m *mockAdapter) Count(ctx context.Context, query *Query) (int64, error) {
 	return 0, nil
 }
 
+func (m *mockAdapter) CreateMany(ctx context.Context, model string, data []map[string]interface{}) (int64, error) {
+	return int64(len(data)), nil
+}
+
+func (m *mockAdapter) Upsert(ctx context.Context, model string, conflictFields []string, data map[string]interface{}) (map[string]interface{}, error) {
+	return data, nil
+}
+
 func (m *mockAdapter) Transaction(ctx context.Context, fn func(Adapter) error) error {
 	return fn(m)
 }
@@ -91,6 +99,14 @@ func (m *mockDataManager) CreateCredentialAccount(ctx context.Context, userID, i
 	return &Account{}, nil
 }
 
+func (m *mockDataManager) UpdateCredentialPassword(ctx context.Context, userID, passwordHash string) error {
+	return nil
+}
+
+func (m *mockDataManager) Transaction(ctx context.Context, fn func(DataManager) error) error {
+	return fn(m)
+}
+
 type mockPasswordHasher struct{}
 
 func (m *mockPasswordHasher) Hash(password string) (string, error) {
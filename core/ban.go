@@ -0,0 +1,67 @@
+package core
+
+import (
+	"net/http"
+	"time"
+)
+
+// BanAction decides what happens when a banned user's session is used
+type BanAction string
+
+const (
+	// BanRevoke revokes the session, so the user must sign in again once
+	// the ban ends
+	BanRevoke BanAction = "revoke"
+
+	// BanReject rejects the request but keeps the session, so it works
+	// again when a temporary ban ends
+	BanReject BanAction = "reject"
+)
+
+// BanError is returned when a banned user signs in or uses a session.
+// errors.Is(err, ErrUserBanned) reports true for it.
+type BanError struct {
+	Reason string
+
+	// Expires is when a temporary ban ends, nil for permanent bans
+	Expires *time.Time
+}
+
+func (e *BanError) Error() string {
+	if e.Reason == "" {
+		return ErrUserBanned.Error()
+	}
+	return ErrUserBanned.Error() + ": " + e.Reason
+}
+
+func (e *BanError) Unwrap() error {
+	return ErrUserBanned
+}
+
+// ActiveBan returns the ban of user at now, or nil when the user is not
+// banned or a temporary ban has ended
+func ActiveBan(user *User, now time.Time) *BanError {
+	if user == nil || !user.Banned || BanEnded(user, now) {
+		return nil
+	}
+	return &BanError{Reason: user.BanReason, Expires: user.BanExpires}
+}
+
+// BanEnded reports whether user has a temporary ban that ended by now and
+// has not been lifted yet
+func BanEnded(user *User, now time.Time) bool {
+	return user != nil && user.Banned && user.BanExpires != nil && !user.BanExpires.After(now)
+}
+
+// WriteBanError answers 403 Forbidden with CodeAccountBanned, reporting
+// the ban's reason and expiry in the error's meta
+func WriteBanError(w http.ResponseWriter, r *http.Request, ban *BanError) {
+	meta := map[string]interface{}{}
+	if ban.Reason != "" {
+		meta["reason"] = ban.Reason
+	}
+	if ban.Expires != nil {
+		meta["expiresAt"] = ban.Expires.UTC().Format(time.RFC3339)
+	}
+	writeError(w, r, http.StatusForbidden, CodeAccountBanned, "Your account is banned", nil, meta)
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestActiveBan(t *testing.T) {
+	now := time.Now()
+	later, earlier := now.Add(time.Hour), now.Add(-time.Hour)
+
+	tests := []struct {
+		name   string
+		user   *User
+		banned bool
+		ended  bool
+	}{
+		{"no user", nil, false, false},
+		{"not banned", &User{}, false, false},
+		{"permanent ban", &User{Banned: true, BanReason: "spam"}, true, false},
+		{"temporary ban", &User{Banned: true, BanExpires: &later}, true, false},
+		{"ended ban", &User{Banned: true, BanExpires: &earlier}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ban := ActiveBan(tt.user, now)
+			if (ban != nil) != tt.banned {
+				t.Fatalf("ActiveBan() = %v, want banned %v", ban, tt.banned)
+			}
+			if ban != nil && (ban.Reason != tt.user.BanReason || ban.Expires != tt.user.BanExpires) {
+				t.Errorf("ActiveBan() = %+v, want the user's reason and expiry", ban)
+			}
+			if got := BanEnded(tt.user, now); got != tt.ended {
+				t.Errorf("BanEnded() = %v, want %v", got, tt.ended)
+			}
+		})
+	}
+
+	if err := error(&BanError{Reason: "spam"}); !errors.Is(err, ErrUserBanned) || err.Error() != "user is banned: spam" {
+		t.Errorf("BanError = %q, want it to match ErrUserBanned", err)
+	}
+}
+
+func TestWriteBanError(t *testing.T) {
+	expires := time.Date(2026, 11, 1, 12, 0, 0, 0, time.UTC)
+	req := httptest.NewRequest(http.MethodPost, "/auth/signin", nil)
+	w := httptest.NewRecorder()
+
+	WriteBanError(w, req, &BanError{Reason: "spam", Expires: &expires})
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected 403, got %d", w.Code)
+	}
+	var resp ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error != string(CodeAccountBanned) || resp.Meta["reason"] != "spam" || resp.Meta["expiresAt"] != "2026-11-01T12:00:00Z" {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+}
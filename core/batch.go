@@ -0,0 +1,64 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// BatchColumns validates the records of Adapter.CreateMany for adapter
+// implementations and returns their fields in a stable order. A multi-row
+// INSERT needs every record to have the same fields.
+func BatchColumns(data []map[string]interface{}) ([]string, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if len(data[0]) == 0 {
+		return nil, errors.New("no data provided")
+	}
+
+	columns := make([]string, 0, len(data[0]))
+	for col := range data[0] {
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+
+	for i, record := range data[1:] {
+		if len(record) != len(columns) {
+			return nil, fmt.Errorf("record %d has different fields than record 0", i+1)
+		}
+		for _, col := range columns {
+			if _, ok := record[col]; !ok {
+				return nil, fmt.Errorf("record %d has different fields than record 0", i+1)
+			}
+		}
+	}
+	return columns, nil
+}
+
+// BatchSize returns how many records of width columns fit in one statement
+// with at most maxParams bind parameters
+func BatchSize(columns, maxParams int) int {
+	if columns <= 0 {
+		return 1
+	}
+	if n := maxParams / columns; n > 0 {
+		return n
+	}
+	return 1
+}
+
+// CreateEach creates the records one at a time. Adapters that cannot insert
+// several records in one statement implement CreateMany with it; run it in
+// a transaction to make the batch atomic.
+func CreateEach(ctx context.Context, adapter Adapter, model string, data []map[string]interface{}) (int64, error) {
+	var created int64
+	for _, record := range data {
+		if _, err := adapter.Create(ctx, model, record); err != nil {
+			return created, err
+		}
+		created++
+	}
+	return created, nil
+}
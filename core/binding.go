@@ -0,0 +1,151 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// IPBindingMode controls how strictly a session is pinned to the client IP
+type IPBindingMode string
+
+const (
+	// IPBindingOff ignores the client IP
+	IPBindingOff IPBindingMode = ""
+
+	// IPBindingSubnet allows the IP to change within the same subnet
+	// (see SessionBinding.IPv4Prefix and IPv6Prefix)
+	IPBindingSubnet IPBindingMode = "subnet"
+
+	// IPBindingExact requires the exact IP the session was created from
+	IPBindingExact IPBindingMode = "exact"
+)
+
+// BindingAction decides what happens when a session is used by a client
+// that does not match its binding
+type BindingAction string
+
+const (
+	// BindingRevoke revokes the session, assuming the token was stolen
+	BindingRevoke BindingAction = "revoke"
+
+	// BindingReauthenticate rejects the request but keeps the session, so
+	// the original client can continue and the new one must sign in again
+	BindingReauthenticate BindingAction = "reauthenticate"
+)
+
+// Default subnet sizes for IPBindingSubnet
+const (
+	DefaultIPv4BindingPrefix = 24
+	DefaultIPv6BindingPrefix = 64
+)
+
+// SessionBinding pins sessions to attributes of the client that created
+// them to mitigate token theft. A hash of the attributes is stored with
+// the session and compared on every lookup.
+//
+// Changing the binding settings changes the fingerprint, so existing bound
+// sessions stop matching.
+type SessionBinding struct {
+	// IP controls IP pinning
+	IP IPBindingMode
+
+	// IPv4Prefix and IPv6Prefix set the subnet size for IPBindingSubnet.
+	// Default to 24 and 64.
+	IPv4Prefix int
+	IPv6Prefix int
+
+	// UserAgent requires the exact User-Agent the session was created with
+	UserAgent bool
+
+	// OnMismatch defaults to BindingRevoke
+	OnMismatch BindingAction
+}
+
+// Enabled reports whether any client attribute is bound. It is safe to
+// call on a nil SessionBinding.
+func (b *SessionBinding) Enabled() bool {
+	return b != nil && (b.IP != IPBindingOff || b.UserAgent)
+}
+
+// Validate checks the binding settings
+func (b *SessionBinding) Validate() error {
+	if b == nil {
+		return nil
+	}
+
+	switch b.IP {
+	case IPBindingOff, IPBindingSubnet, IPBindingExact:
+	default:
+		return fmt.Errorf("unknown IP binding mode: %s", b.IP)
+	}
+
+	switch b.OnMismatch {
+	case "", BindingRevoke, BindingReauthenticate:
+	default:
+		return fmt.Errorf("unknown binding mismatch action: %s", b.OnMismatch)
+	}
+
+	if b.IPv4Prefix < 0 || b.IPv4Prefix > 32 {
+		return fmt.Errorf("invalid IPv4 binding prefix: %d", b.IPv4Prefix)
+	}
+	if b.IPv6Prefix < 0 || b.IPv6Prefix > 128 {
+		return fmt.Errorf("invalid IPv6 binding prefix: %d", b.IPv6Prefix)
+	}
+
+	return nil
+}
+
+// Fingerprint hashes the bound client attributes. Sessions created and
+// used by clients with the same fingerprint match.
+func (b *SessionBinding) Fingerprint(ipAddress, userAgent string) string {
+	var ip, ua string
+	if b != nil {
+		switch b.IP {
+		case IPBindingExact:
+			ip = normalizeIP(ipAddress, 32, 128)
+		case IPBindingSubnet:
+			ip = normalizeIP(ipAddress, b.ipv4Prefix(), b.ipv6Prefix())
+		}
+		if b.UserAgent {
+			ua = userAgent
+		}
+	}
+
+	sum := sha256.Sum256([]byte("v1|" + ip + "|" + ua))
+	return hex.EncodeToString(sum[:])
+}
+
+func (b *SessionBinding) ipv4Prefix() int {
+	if b.IPv4Prefix == 0 {
+		return DefaultIPv4BindingPrefix
+	}
+	return b.IPv4Prefix
+}
+
+func (b *SessionBinding) ipv6Prefix() int {
+	if b.IPv6Prefix == 0 {
+		return DefaultIPv6BindingPrefix
+	}
+	return b.IPv6Prefix
+}
+
+// normalizeIP masks a client IP to the given prefix. Unparseable values
+// are returned unchanged so they still only match themselves.
+func normalizeIP(address string, v4Prefix, v6Prefix int) string {
+	address = strings.TrimSpace(address)
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return address
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(v4Prefix, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(v6Prefix, 128)).String()
+}
@@ -0,0 +1,63 @@
+package core
+
+import "testing"
+
+func TestSessionBindingFingerprint(t *testing.T) {
+	const ua = "Mozilla/5.0"
+
+	tests := []struct {
+		name    string
+		binding *SessionBinding
+		ip, ua  string
+		match   bool
+	}{
+		{"subnet allows IPv4 change in /24", &SessionBinding{IP: IPBindingSubnet}, "203.0.113.99:4321", ua, true},
+		{"subnet rejects IPv4 change across /24", &SessionBinding{IP: IPBindingSubnet}, "203.0.114.10", ua, false},
+		{"forwarded list is not parsed", &SessionBinding{IP: IPBindingSubnet}, "203.0.113.7, 10.0.0.1", ua, false},
+		{"exact rejects any IP change", &SessionBinding{IP: IPBindingExact}, "203.0.113.11", ua, false},
+		{"exact ignores port", &SessionBinding{IP: IPBindingExact}, "203.0.113.10:9999", ua, true},
+		{"custom IPv4 prefix", &SessionBinding{IP: IPBindingSubnet, IPv4Prefix: 16}, "203.0.200.1", ua, true},
+		{"IP ignored when off", &SessionBinding{UserAgent: true}, "198.51.100.1", ua, true},
+		{"user agent change rejected", &SessionBinding{IP: IPBindingSubnet, UserAgent: true}, "203.0.113.10", "curl/8.0", false},
+		{"user agent ignored when not bound", &SessionBinding{IP: IPBindingSubnet}, "203.0.113.10", "curl/8.0", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created := tt.binding.Fingerprint("203.0.113.10", ua)
+			if got := tt.binding.Fingerprint(tt.ip, tt.ua) == created; got != tt.match {
+				t.Errorf("fingerprint match = %v, want %v", got, tt.match)
+			}
+		})
+	}
+
+	v6 := &SessionBinding{IP: IPBindingSubnet}
+	if v6.Fingerprint("[2001:db8:1:2::1]:443", ua) != v6.Fingerprint("2001:db8:1:2:ffff::5", ua) {
+		t.Error("expected IPv6 addresses in the same /64 to match")
+	}
+	if v6.Fingerprint("2001:db8:1:2::1", ua) == v6.Fingerprint("2001:db8:1:3::1", ua) {
+		t.Error("expected IPv6 addresses in different /64s not to match")
+	}
+}
+
+func TestSessionBindingValidate(t *testing.T) {
+	var binding *SessionBinding
+	if binding.Enabled() || binding.Validate() != nil {
+		t.Error("nil binding should be disabled and valid")
+	}
+	if (&SessionBinding{OnMismatch: BindingRevoke}).Enabled() {
+		t.Error("binding without attributes should be disabled")
+	}
+
+	invalid := []*SessionBinding{
+		{IP: "fuzzy"},
+		{IP: IPBindingSubnet, OnMismatch: "ignore"},
+		{IP: IPBindingSubnet, IPv4Prefix: 33},
+		{IP: IPBindingSubnet, IPv6Prefix: -1},
+	}
+	for _, b := range invalid {
+		if err := b.Validate(); err == nil {
+			t.Errorf("Validate(%+v) = nil, want error", b)
+		}
+	}
+}
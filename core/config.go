@@ -1,7 +1,9 @@
 package core
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"time"
 )
 
@@ -13,9 +15,41 @@ type Config struct {
 	BasePath string
 	Secret   string
 
+	// SecretKeys is an optional session signing key ring in the format
+	// "id:base64secret,id:base64secret", newest key first.
+	// See session.ParseKeyRing.
+	SecretKeys string
+
+	// Secrets fetches secrets from a secret manager, such as the session
+	// keys, and re-fetches them for rotation. Nil disables it.
+	Secrets *SecretsConfig
+
 	// Database
 	Adapter Adapter
 
+	// TableNames overrides the default table names (nil keeps the defaults)
+	TableNames *TableNames
+
+	// UserStore keeps users outside the database, e.g. in an existing
+	// user service. Sessions, accounts and verifications stay in Adapter.
+	// Nil keeps users in the users table.
+	UserStore UserStore
+
+	// QueryTimeouts bounds database calls whose context has no deadline.
+	// beaconauth.New applies them with adapter.WithTimeouts. Nil disables
+	// the timeouts.
+	QueryTimeouts *QueryTimeouts
+
+	// HashLimit bounds how many password hashes run at once, so a burst of
+	// sign-ins queues instead of exhausting memory. beaconauth.New wraps
+	// the password hasher with crypto.NewLimitedHasher. Nil disables the
+	// limit.
+	HashLimit *HashLimit
+
+	// Tenancy scopes users, sessions and accounts to the tenant of each
+	// request. Nil serves a single tenant.
+	Tenancy *TenancyConfig
+
 	// Email & Password
 	EmailPassword *EmailPasswordConfig
 
@@ -28,15 +62,41 @@ type Config struct {
 	// Plugins
 	Plugins []Plugin
 
+	// PluginSettings holds plugin settings by plugin ID (see
+	// WithConfigFile)
+	PluginSettings map[string]PluginSettings
+
 	// Mailer
 	Mailer Mailer
 
+	// Localizer translates error responses into the locale of each request
+	// and renders emails (nil = English messages only). See package i18n.
+	Localizer Localizer
+
 	// Rate limiting
 	RateLimit *RateLimitConfig
 
 	// Hooks
 	Hooks *HooksConfig
 
+	// Lifecycle hooks run after users and sessions are created
+	Lifecycle *LifecycleHooks
+
+	// BeforeHooks run before plugin endpoints, together with the Before
+	// hooks of plugins
+	BeforeHooks []RequestHook
+
+	// SecurityEvents receives security-relevant events (failed sign-ins,
+	// session binding violations, ...) for SIEM export. See package siem.
+	SecurityEvents SecurityEventSink
+
+	// Events publishes user, session and auth events to in-process
+	// subscribers. New creates a bus when it is nil.
+	Events *EventBus
+
+	// EventSubscriptions are subscribed to Events by New
+	EventSubscriptions []EventSubscription
+
 	// Advanced settings
 	Advanced *AdvancedConfig
 
@@ -46,13 +106,75 @@ type Config struct {
 	PasswordHasherFactory func() PasswordHasher
 }
 
+// Default query timeouts
+const (
+	DefaultReadTimeout  = 3 * time.Second
+	DefaultWriteTimeout = 5 * time.Second
+)
+
+// QueryTimeouts bounds how long a database call may take when the caller's
+// context has no deadline, so a slow database cannot hang auth endpoints.
+// Reads are FindOne, FindMany and Count; every other call is a write. Zero
+// leaves that kind of call unbounded.
+type QueryTimeouts struct {
+	Read  time.Duration
+	Write time.Duration
+}
+
+// HashLimit bounds concurrent password hashing. Calls beyond MaxConcurrent
+// wait up to QueueTimeout for a free slot and then fail with a 503
+// server_busy error.
+type HashLimit struct {
+	// MaxConcurrent is how many hashes and verifications run at once
+	// (0 = the number of CPUs)
+	MaxConcurrent int
+
+	// QueueTimeout is how long a call waits for a free slot (0 = 5s)
+	QueueTimeout time.Duration
+}
+
+// SecretsConfig configures the secret manager behind AuthContext.Secrets
+type SecretsConfig struct {
+	Provider SecretProvider
+
+	// SessionKeys names the secret holding the session key ring, in the
+	// SecretKeys format. It replaces SecretKeys and is re-fetched, so
+	// keys rotated in the secret manager take effect without a restart.
+	SessionKeys string
+
+	// RefreshInterval is how often fetched secrets are fetched again
+	// (0 = DefaultSecretRefreshInterval, negative disables)
+	RefreshInterval time.Duration
+}
+
 // EmailPasswordConfig holds email/password authentication settings
 type EmailPasswordConfig struct {
-	Enabled             bool
-	MinPasswordLength   int
+	Enabled           bool
+	MinPasswordLength int
+
+	// RequireVerification refuses password sign-in until the user's email
+	// is verified
 	RequireVerification bool
+
 	PasswordHashCost    int
 	ResetPasswordExpiry time.Duration
+
+	// ResetPasswordURL and VerifyEmailURL are the pages opened by the links
+	// of password reset and verification emails, which get the token in
+	// their token query parameter. The hosted UI (plugins/ui) sets them to
+	// its own pages when they are empty.
+	ResetPasswordURL string
+	VerifyEmailURL   string
+
+	// DoubleOptIn makes sign-up create the user unverified and without a
+	// session. The user is activated by the link of the confirmation email
+	// and cannot sign in with their password until then.
+	DoubleOptIn bool
+
+	// UnconfirmedSignupTTL is how long a double opt-in confirmation link
+	// stays valid. Users who have not confirmed by then are deleted (0 =
+	// 48 hours).
+	UnconfirmedSignupTTL time.Duration
 }
 
 // OAuthConfig holds OAuth configuration
@@ -71,13 +193,149 @@ type SessionConfig struct {
 	CookieDomain     string
 	CookiePath       string
 	SecondaryStorage SecondaryStorage // Redis, etc.
+
+	// ShortExpiresIn is the lifetime of sessions signed in without
+	// remember me, whose cookie ends with the browser session. Zero gives
+	// them ExpiresIn.
+	ShortExpiresIn time.Duration
+
+	// CookieChunkSize is the largest cookie value written before the
+	// session cookie is split across numbered cookies. Zero uses
+	// DefaultCookieChunkSize.
+	CookieChunkSize int
+
+	// EncryptCookies encrypts stateless session tokens so session and
+	// user data cannot be read client-side
+	EncryptCookies bool
+
+	// CookieUserClaims limits the user fields embedded in stateless
+	// session tokens to these JSON field names. Empty embeds the whole
+	// user.
+	CookieUserClaims []string
+
+	// ClaimsEnricher adds custom claims to stateless session tokens when
+	// they are issued. Nil adds none.
+	ClaimsEnricher ClaimsEnricher
+
+	// MaxClaimsSize caps the JSON size of the custom claims in bytes.
+	// Zero uses DefaultMaxClaimsSize.
+	MaxClaimsSize int
+
+	// MaxSessionsPerUser limits how many active sessions a user may have.
+	// Zero means unlimited.
+	MaxSessionsPerUser int
+
+	// SessionLimitStrategy decides what happens when a user at the limit
+	// signs in again. Defaults to SessionLimitEvictOldest.
+	SessionLimitStrategy SessionLimitStrategy
+
+	// KeepRecentSessions prunes each user's sessions down to the N most
+	// recently active when a new session is created. Zero disables pruning.
+	KeepRecentSessions int
+
+	// AbsoluteExpiry keeps ExpiresAt fixed at creation instead of sliding it
+	// forward on activity
+	AbsoluteExpiry bool
+
+	// BatchUpdates writes sliding-expiration updates behind in batches
+	// instead of on the request that triggers them. Updates buffered when
+	// the process crashes are lost, and those sessions expire earlier.
+	BatchUpdates bool
+
+	// UpdateBatchSize and UpdateFlushInterval bound how many updates and
+	// for how long they are buffered. Zero uses the session package
+	// defaults.
+	UpdateBatchSize     int
+	UpdateFlushInterval time.Duration
+
+	// IdleTimeout expires sessions after this long without a request, even
+	// before ExpiresIn is reached. Zero disables the idle timeout.
+	IdleTimeout time.Duration
+
+	// Binding pins sessions to the client that created them. Nil disables
+	// binding.
+	Binding *SessionBinding
+
+	// OnBan decides what happens when a banned user's session is used.
+	// Defaults to BanRevoke.
+	OnBan BanAction
+
+	// HashTokens stores SHA-256 hashes of session tokens in the sessions
+	// table instead of the tokens
+	HashTokens bool
+
+	// AcceptPlainTokens keeps sessions stored before HashTokens was
+	// enabled valid, rehashing each when it is next used
+	AcceptPlainTokens bool
+
+	// UserCache keeps the users of database sessions in memory, so
+	// validating a session does not look its user up every time. Nil
+	// disables caching.
+	UserCache UserCache
+
+	// Stores selects where sessions are kept (nil = the cookie and the
+	// database)
+	Stores *SessionStores
+}
+
+// SessionStores selects the session storage layers of beaconauth.New.
+// Lookups try the cookie, then Redis, then the database.
+type SessionStores struct {
+	Cookie   bool
+	Database bool
+
+	// Redis caches sessions in the Redis server at RedisURL, e.g.
+	// "redis://:password@localhost:6379/0" or "rediss://" for TLS
+	Redis    bool
+	RedisURL string
 }
 
+// ClaimsEnricher returns custom claims, such as a plan, tenant or
+// permissions, to embed in a stateless session token issued for user and
+// session. It runs whenever a token is issued, so claims are refreshed
+// when the session is rotated. Returning an error fails the issuance.
+type ClaimsEnricher func(ctx context.Context, user *User, session *Session) (map[string]any, error)
+
+// TokenClaimsReader is implemented by session managers that embed custom
+// claims in the tokens they issue (see session.Manager.Claims)
+type TokenClaimsReader interface {
+	Claims(token string) (map[string]any, error)
+}
+
+// DefaultMaxClaimsSize is the default limit on the JSON size of custom
+// token claims, which keeps enriched tokens within a single cookie
+const DefaultMaxClaimsSize = 1024
+
+// SessionLimitStrategy defines how MaxSessionsPerUser is enforced
+type SessionLimitStrategy string
+
+const (
+	// SessionLimitRejectNew refuses to create the session and returns ErrSessionLimit
+	SessionLimitRejectNew SessionLimitStrategy = "reject_new"
+
+	// SessionLimitEvictOldest revokes the oldest sessions to make room
+	SessionLimitEvictOldest SessionLimitStrategy = "evict_oldest"
+
+	// SessionLimitEvictOthers revokes all of the user's other sessions
+	SessionLimitEvictOthers SessionLimitStrategy = "evict_others"
+)
+
 // RateLimitConfig holds rate limiting configuration
 type RateLimitConfig struct {
 	Enabled bool
 	Storage RateLimitStorage
 	Rules   []RateLimitRule
+
+	// Classes limit endpoints by their Endpoint.RateLimit class. Endpoints
+	// of a class without a limit are not limited by class.
+	Classes map[string]RateLimitClass
+}
+
+// RateLimitClass limits the requests of each client to the endpoints of a
+// rate-limit class, counted together
+type RateLimitClass struct {
+	Limit  int
+	Window time.Duration
 }
 
 // RateLimitRule defines a rate limit rule
@@ -98,15 +356,43 @@ type HooksConfig struct {
 // AdvancedConfig holds advanced configuration options
 type AdvancedConfig struct {
 	UseSecureCookies bool
+
+	// Deprecated: DisableCSRFCheck has no effect. The origin check of form
+	// posts and the JSON content type required of other bodies cannot be
+	// turned off.
 	DisableCSRFCheck bool
-	TrustedOrigins   []string
-	GenerateID       func() string
-	Logger           Logger
+
+	TrustedOrigins []string
+	GenerateID     func() string
+	Logger         Logger
+
+	// RedirectOrigins lists the origins, besides BaseURL's, that users may
+	// be sent to after signing in (see SafeRedirect)
+	RedirectOrigins []string
+
+	// TrustedProxies lists the reverse proxies, as CIDR ranges or IP
+	// addresses, whose X-Forwarded-For and X-Real-IP headers are believed.
+	// Without any, the client IP is the connection's peer address.
+	TrustedProxies []string
+
+	// DisableSecurityBanner stops New from logging the security posture
+	// summary at startup
+	DisableSecurityBanner bool
+
+	// HealthCheckTimeout bounds each check of /readyz
+	// (0 = DefaultHealthCheckTimeout)
+	HealthCheckTimeout time.Duration
 }
 
 // Option is a functional option for configuring BeaconAuth
 type Option func(*Config) error
 
+// DefaultConfig returns the configuration used before any options are
+// applied
+func DefaultConfig() *Config {
+	return defaultConfig()
+}
+
 // defaultConfig returns the default configuration
 func defaultConfig() *Config {
 	return &Config{
@@ -128,6 +414,11 @@ func defaultConfig() *Config {
 			CookieSameSite: "lax",
 			CookiePath:     "/",
 		},
+		QueryTimeouts: &QueryTimeouts{
+			Read:  DefaultReadTimeout,
+			Write: DefaultWriteTimeout,
+		},
+		HashLimit: &HashLimit{},
 		Advanced: &AdvancedConfig{
 			UseSecureCookies: true,
 			GenerateID:       defaultIDGenerator,
@@ -137,8 +428,8 @@ func defaultConfig() *Config {
 
 // Validate validates the configuration
 func (c *Config) Validate() error {
-	if c.Secret == "" {
-		return errors.New("secret is required")
+	if c.Secret == "" && c.SecretKeys == "" {
+		return errors.New("secret is required (or session keys from WithSecretProvider)")
 	}
 	if c.Adapter == nil {
 		return errors.New("adapter is required")
@@ -146,6 +437,9 @@ func (c *Config) Validate() error {
 	if c.BaseURL == "" {
 		return errors.New("base URL is required")
 	}
+	if err := c.TableNames.Validate(); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -159,6 +453,79 @@ func WithSecret(secret string) Option {
 	}
 }
 
+// WithSecretKeys sets a rotating key ring for signing session tokens.
+// The first key signs new tokens; the rest are accepted for verification.
+func WithSecretKeys(keyRing string) Option {
+	return func(c *Config) error {
+		c.SecretKeys = keyRing
+		return nil
+	}
+}
+
+// WithSecretProvider fetches secrets from provider, such as a Vault or AWS
+// Secrets Manager provider of package secrets. When sessionKeys is not
+// empty, it names the secret holding the session key ring, which replaces
+// WithSecretKeys and rotates with the secret. Fetched secrets are fetched
+// again every DefaultSecretRefreshInterval.
+func WithSecretProvider(provider SecretProvider, sessionKeys string) Option {
+	return func(c *Config) error {
+		if provider == nil {
+			return errors.New("secret provider is required")
+		}
+		c.Secrets = &SecretsConfig{Provider: provider, SessionKeys: sessionKeys}
+		return nil
+	}
+}
+
+// WithTableNames sets custom table names for BeaconAuth's models
+func WithTableNames(names *TableNames) Option {
+	return func(c *Config) error {
+		if err := names.Validate(); err != nil {
+			return err
+		}
+		c.TableNames = names
+		return nil
+	}
+}
+
+// WithQueryTimeouts sets how long database calls made without a context
+// deadline may take. Zero leaves that kind of call unbounded; pass zero for
+// both to disable the timeouts.
+func WithQueryTimeouts(read, write time.Duration) Option {
+	return func(c *Config) error {
+		if read < 0 || write < 0 {
+			return errors.New("query timeouts must not be negative")
+		}
+		c.QueryTimeouts = &QueryTimeouts{Read: read, Write: write}
+		return nil
+	}
+}
+
+// WithHashLimit sets how many password hashes run at once and how long a
+// call waits for a free slot before failing with server_busy. Zero keeps
+// the defaults: the number of CPUs and 5 seconds.
+func WithHashLimit(maxConcurrent int, queueTimeout time.Duration) Option {
+	return func(c *Config) error {
+		if maxConcurrent < 0 || queueTimeout < 0 {
+			return errors.New("hash limit must not be negative")
+		}
+		c.HashLimit = &HashLimit{MaxConcurrent: maxConcurrent, QueueTimeout: queueTimeout}
+		return nil
+	}
+}
+
+// WithTenancy enables multi-tenancy (see TenancyConfig). A nil config
+// uses the defaults.
+func WithTenancy(tenancy *TenancyConfig) Option {
+	return func(c *Config) error {
+		if tenancy == nil {
+			tenancy = &TenancyConfig{}
+		}
+		c.Tenancy = tenancy
+		return nil
+	}
+}
+
 // WithBaseURL sets the base URL
 func WithBaseURL(url string) Option {
 	return func(c *Config) error {
@@ -183,6 +550,18 @@ func WithAdapter(adapter Adapter) Option {
 	}
 }
 
+// WithUserStore reads and writes users through store instead of the users
+// table, for apps whose users live in another service
+func WithUserStore(store UserStore) Option {
+	return func(c *Config) error {
+		if store == nil {
+			return errors.New("user store must not be nil")
+		}
+		c.UserStore = store
+		return nil
+	}
+}
+
 // WithPlugins adds plugins
 func WithPlugins(plugins ...Plugin) Option {
 	return func(c *Config) error {
@@ -199,6 +578,15 @@ func WithMailer(mailer Mailer) Option {
 	}
 }
 
+// WithLocalizer translates error responses and renders emails, e.g. with
+// i18n.New
+func WithLocalizer(l Localizer) Option {
+	return func(c *Config) error {
+		c.Localizer = l
+		return nil
+	}
+}
+
 // WithOAuthProviders adds OAuth providers
 func WithOAuthProviders(providers ...OAuthProvider) Option {
 	return func(c *Config) error {
@@ -210,14 +598,43 @@ func WithOAuthProviders(providers ...OAuthProvider) Option {
 	}
 }
 
-// WithRateLimit sets rate limiting configuration
+// WithRateLimit sets rate limiting configuration. Rule paths are relative
+// to the base path. A nil storage uses an in-memory store.
 func WithRateLimit(storage RateLimitStorage, rules ...RateLimitRule) Option {
 	return func(c *Config) error {
+		if storage == nil {
+			storage = NewMemoryRateLimitStorage()
+		}
+		var classes map[string]RateLimitClass
+		if c.RateLimit != nil {
+			classes = c.RateLimit.Classes
+		}
 		c.RateLimit = &RateLimitConfig{
 			Enabled: true,
 			Storage: storage,
 			Rules:   rules,
+			Classes: classes,
+		}
+		return nil
+	}
+}
+
+// WithRateLimitClass limits each client to limit requests per window to
+// the endpoints of a rate-limit class, such as RateLimitCredentials. It
+// enables rate limiting with in-memory storage unless WithRateLimit sets
+// the storage.
+func WithRateLimitClass(class string, limit int, window time.Duration) Option {
+	return func(c *Config) error {
+		if limit <= 0 || window <= 0 {
+			return errors.New("rate limit class needs a positive limit and window")
 		}
+		if c.RateLimit == nil {
+			c.RateLimit = &RateLimitConfig{Enabled: true}
+		}
+		if c.RateLimit.Classes == nil {
+			c.RateLimit.Classes = make(map[string]RateLimitClass)
+		}
+		c.RateLimit.Classes[class] = RateLimitClass{Limit: limit, Window: window}
 		return nil
 	}
 }
@@ -230,6 +647,282 @@ func WithSessionConfig(session *SessionConfig) Option {
 	}
 }
 
+// WithMaxSessionsPerUser limits the number of active sessions per user.
+// Use SessionLimitEvictOthers with a limit of 1 to enforce a single session.
+func WithMaxSessionsPerUser(max int, strategy SessionLimitStrategy) Option {
+	return func(c *Config) error {
+		if max < 0 {
+			return errors.New("max sessions per user cannot be negative")
+		}
+		switch strategy {
+		case "", SessionLimitRejectNew, SessionLimitEvictOldest, SessionLimitEvictOthers:
+		default:
+			return fmt.Errorf("unknown session limit strategy: %s", strategy)
+		}
+		if c.Session == nil {
+			c.Session = &SessionConfig{}
+		}
+		c.Session.MaxSessionsPerUser = max
+		c.Session.SessionLimitStrategy = strategy
+		return nil
+	}
+}
+
+// WithSessionPruning keeps only the keep most recently active sessions per
+// user, pruning older ones whenever the user signs in. Unlike
+// WithMaxSessionsPerUser it never blocks sign-in.
+func WithSessionPruning(keep int) Option {
+	return func(c *Config) error {
+		if keep < 0 {
+			return errors.New("kept sessions per user cannot be negative")
+		}
+		if c.Session == nil {
+			c.Session = &SessionConfig{}
+		}
+		c.Session.KeepRecentSessions = keep
+		return nil
+	}
+}
+
+// WithIdleTimeout expires sessions that have been inactive for longer than
+// timeout, independently of the absolute session lifetime (ExpiresIn)
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(c *Config) error {
+		if timeout < 0 {
+			return errors.New("idle timeout cannot be negative")
+		}
+		if c.Session == nil {
+			c.Session = &SessionConfig{}
+		}
+		c.Session.IdleTimeout = timeout
+		return nil
+	}
+}
+
+// WithSessionBinding pins sessions to client attributes such as the IP
+// subnet and User-Agent, so a stolen session token is rejected when used
+// from a different client
+func WithSessionBinding(binding *SessionBinding) Option {
+	return func(c *Config) error {
+		if err := binding.Validate(); err != nil {
+			return err
+		}
+		if c.Session == nil {
+			c.Session = &SessionConfig{}
+		}
+		c.Session.Binding = binding
+		return nil
+	}
+}
+
+// WithBanAction sets what happens when a banned user's session is used:
+// BanRevoke (the default) revokes it, BanReject keeps it for when a
+// temporary ban ends
+func WithBanAction(action BanAction) Option {
+	return func(c *Config) error {
+		if action != BanRevoke && action != BanReject {
+			return fmt.Errorf("invalid ban action %q", action)
+		}
+		if c.Session == nil {
+			c.Session = &SessionConfig{}
+		}
+		c.Session.OnBan = action
+		return nil
+	}
+}
+
+// WithRememberMe sets the session lifetimes a sign-in chooses between with
+// its rememberMe flag: short for sessions that end with the browser
+// session, long for persistent ones
+func WithRememberMe(short, long time.Duration) Option {
+	return func(c *Config) error {
+		if short <= 0 || long < short {
+			return fmt.Errorf("invalid session lifetimes %v and %v: need 0 < short <= long", short, long)
+		}
+		if c.Session == nil {
+			c.Session = &SessionConfig{}
+		}
+		c.Session.ShortExpiresIn = short
+		c.Session.ExpiresIn = long
+		return nil
+	}
+}
+
+// WithEncryptedCookies encrypts stateless session tokens with AES-GCM. When
+// claims are given, only those user fields (JSON names such as "email" or
+// "role") and the user ID are embedded, keeping the cookie small.
+func WithEncryptedCookies(claims ...string) Option {
+	return func(c *Config) error {
+		if c.Session == nil {
+			c.Session = &SessionConfig{}
+		}
+		c.Session.EncryptCookies = true
+		c.Session.CookieUserClaims = claims
+		return nil
+	}
+}
+
+// WithClaimsEnricher adds the claims returned by enricher to stateless
+// session tokens. Claims named like the token's own fields (session, user,
+// iss, iat) or JWT registered claims are rejected, as are claims over
+// DefaultMaxClaimsSize bytes.
+func WithClaimsEnricher(enricher ClaimsEnricher) Option {
+	return func(c *Config) error {
+		if enricher == nil {
+			return errors.New("claims enricher cannot be nil")
+		}
+		if c.Session == nil {
+			c.Session = &SessionConfig{}
+		}
+		c.Session.ClaimsEnricher = enricher
+		return nil
+	}
+}
+
+// WithSessionStores selects where sessions are kept. At least one store is
+// required, and the Redis store needs its URL.
+func WithSessionStores(stores SessionStores) Option {
+	return func(c *Config) error {
+		if !stores.Cookie && !stores.Database && !stores.Redis {
+			return errors.New("at least one session store must be enabled")
+		}
+		if stores.Redis && stores.RedisURL == "" {
+			return errors.New("the Redis session store needs a Redis URL")
+		}
+		if c.Session == nil {
+			c.Session = &SessionConfig{}
+		}
+		c.Session.Stores = &stores
+		return nil
+	}
+}
+
+// WithUserCache caches the users of database sessions in cache (see
+// session.NewUserCache). Users updated through BeaconAuth are dropped from
+// it; changes made elsewhere show once the cached entry expires.
+func WithUserCache(cache UserCache) Option {
+	return func(c *Config) error {
+		if cache == nil {
+			return errors.New("user cache cannot be nil")
+		}
+		if c.Session == nil {
+			c.Session = &SessionConfig{}
+		}
+		c.Session.UserCache = cache
+		return nil
+	}
+}
+
+// WithHashedSessionTokens stores only SHA-256 hashes of session tokens in
+// the database, so a leaked sessions table cannot be used to sign in. Set
+// acceptPlain while migrating a database with existing sessions: their
+// plaintext tokens stay valid and are rehashed when next used.
+func WithHashedSessionTokens(acceptPlain bool) Option {
+	return func(c *Config) error {
+		if c.Session == nil {
+			c.Session = &SessionConfig{}
+		}
+		c.Session.HashTokens = true
+		c.Session.AcceptPlainTokens = acceptPlain
+		return nil
+	}
+}
+
+// WithBeforeHook adds a hook run before matching plugin endpoints. It runs
+// before plugin hooks of the same priority.
+func WithBeforeHook(hook RequestHook) Option {
+	return func(c *Config) error {
+		if hook.Handler == nil {
+			return errors.New("hook handler cannot be nil")
+		}
+		c.BeforeHooks = append(c.BeforeHooks, hook)
+		return nil
+	}
+}
+
+// WithOnUserCreated adds a hook called after a user signs up
+func WithOnUserCreated(hook func(ctx context.Context, event *UserCreatedEvent) error) Option {
+	return func(c *Config) error {
+		if hook == nil {
+			return errors.New("hook cannot be nil")
+		}
+		if c.Lifecycle == nil {
+			c.Lifecycle = &LifecycleHooks{}
+		}
+		c.Lifecycle.OnUserCreated = append(c.Lifecycle.OnUserCreated, hook)
+		return nil
+	}
+}
+
+// WithOnSignIn adds a hook called after a user signs in
+func WithOnSignIn(hook func(ctx context.Context, event *SignInEvent) error) Option {
+	return func(c *Config) error {
+		if hook == nil {
+			return errors.New("hook cannot be nil")
+		}
+		if c.Lifecycle == nil {
+			c.Lifecycle = &LifecycleHooks{}
+		}
+		c.Lifecycle.OnSignIn = append(c.Lifecycle.OnSignIn, hook)
+		return nil
+	}
+}
+
+// WithOnSessionCreated adds a hook called after a session is created
+func WithOnSessionCreated(hook func(ctx context.Context, event *SessionCreatedEvent) error) Option {
+	return func(c *Config) error {
+		if hook == nil {
+			return errors.New("hook cannot be nil")
+		}
+		if c.Lifecycle == nil {
+			c.Lifecycle = &LifecycleHooks{}
+		}
+		c.Lifecycle.OnSessionCreated = append(c.Lifecycle.OnSessionCreated, hook)
+		return nil
+	}
+}
+
+// WithSecurityEvents streams security-relevant events to sink, typically a
+// siem.Dispatcher. Sinks that implement io.Closer are closed with Auth.
+func WithSecurityEvents(sink SecurityEventSink) Option {
+	return func(c *Config) error {
+		if sink == nil {
+			return errors.New("security event sink cannot be nil")
+		}
+		c.SecurityEvents = sink
+		return nil
+	}
+}
+
+// WithEventBus publishes events on bus, e.g. to share it with other
+// components of the application
+func WithEventBus(bus *EventBus) Option {
+	return func(c *Config) error {
+		if bus == nil {
+			return errors.New("event bus cannot be nil")
+		}
+		c.Events = bus
+		return nil
+	}
+}
+
+// WithEventSubscriber subscribes handler to events matching pattern, such
+// as "user.created", "session.*" or "*". Pass Async to handle events off
+// the request path.
+func WithEventSubscriber(pattern string, handler EventHandler, opts ...SubscribeOption) Option {
+	return func(c *Config) error {
+		if handler == nil {
+			return errors.New("event handler cannot be nil")
+		}
+		c.EventSubscriptions = append(c.EventSubscriptions, EventSubscription{
+			Pattern: pattern,
+			Handler: handler,
+			Options: opts,
+		})
+		return nil
+	}
+}
+
 // WithEmailPassword configures email/password authentication
 func WithEmailPassword(config *EmailPasswordConfig) Option {
 	return func(c *Config) error {
@@ -238,6 +931,16 @@ func WithEmailPassword(config *EmailPasswordConfig) Option {
 	}
 }
 
+// WithPasswordHasher sets the password hasher used for new and existing credentials
+func WithPasswordHasher(hasher PasswordHasher) Option {
+	return func(c *Config) error {
+		c.PasswordHasherFactory = func() PasswordHasher {
+			return hasher
+		}
+		return nil
+	}
+}
+
 // WithLogger sets a custom logger
 func WithLogger(logger Logger) Option {
 	return func(c *Config) error {
@@ -260,6 +963,40 @@ func WithTrustedOrigins(origins ...string) Option {
 	}
 }
 
+// WithRedirectOrigins allows callbackURL redirects after authentication to
+// these origins (e.g. "https://app.example.com"), besides BaseURL's origin
+// and local paths
+func WithRedirectOrigins(origins ...string) Option {
+	return func(c *Config) error {
+		for _, origin := range origins {
+			if Origin(origin) == "" {
+				return fmt.Errorf("invalid redirect origin %q", origin)
+			}
+		}
+		if c.Advanced == nil {
+			c.Advanced = &AdvancedConfig{}
+		}
+		c.Advanced.RedirectOrigins = origins
+		return nil
+	}
+}
+
+// WithTrustedProxies sets the reverse proxies (CIDR ranges or IP
+// addresses) whose forwarding headers are believed when the client IP is
+// resolved for rate limiting, session binding and audit records
+func WithTrustedProxies(proxies ...string) Option {
+	return func(c *Config) error {
+		if _, err := ParseTrustedProxies(proxies); err != nil {
+			return err
+		}
+		if c.Advanced == nil {
+			c.Advanced = &AdvancedConfig{}
+		}
+		c.Advanced.TrustedProxies = proxies
+		return nil
+	}
+}
+
 // defaultIDGenerator generates a default ID
 func defaultIDGenerator() string {
 	// Will be implemented with proper ID generation
@@ -12,6 +12,11 @@ const (
 	sessionContextKey
 	userContextKey
 	requestContextKey
+	clientInfoContextKey
+	tenantContextKey
+	traceIDContextKey
+	localizerContextKey
+	trustedProxiesContextKey
 )
 
 // AuthContext holds the authentication context
@@ -22,14 +27,24 @@ type AuthContext struct {
 	SessionManager SessionManager
 	DataManager    DataManager
 	PasswordHasher PasswordHasher
+	SecurityEvents SecurityEventSink
+	Lifecycle      *LifecycleHooks
+	Events         *EventBus
+
+	// Secrets holds the secrets of Config.Secrets (nil without a
+	// SecretProvider)
+	Secrets *Secrets
 }
 
 // NewAuthContext creates a new auth context
 func NewAuthContext(cfg *Config) *AuthContext {
 	return &AuthContext{
-		Config:  cfg,
-		Adapter: cfg.Adapter,
-		Logger:  cfg.Advanced.Logger,
+		Config:         cfg,
+		Adapter:        cfg.Adapter,
+		Logger:         cfg.Advanced.Logger,
+		SecurityEvents: cfg.SecurityEvents,
+		Lifecycle:      cfg.Lifecycle,
+		Events:         cfg.Events,
 	}
 }
 
@@ -84,3 +99,28 @@ func GetRequest(ctx context.Context) *http.Request {
 	}
 	return nil
 }
+
+// ClientInfo identifies the client making a request. Session binding
+// compares it against the client that created the session.
+type ClientInfo struct {
+	IPAddress string
+	UserAgent string
+}
+
+// ClientInfoFromRequest extracts client information from an HTTP request.
+// Forwarding headers are only believed from the trusted proxies in the
+// request context; see TrustedProxies.ClientIP.
+func ClientInfoFromRequest(r *http.Request) ClientInfo {
+	return GetTrustedProxies(r.Context()).ClientInfo(r)
+}
+
+// WithClientInfo adds client information to the context
+func WithClientInfo(ctx context.Context, info ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoContextKey, info)
+}
+
+// GetClientInfo retrieves client information from the context
+func GetClientInfo(ctx context.Context) (ClientInfo, bool) {
+	info, ok := ctx.Value(clientInfoContextKey).(ClientInfo)
+	return info, ok
+}
@@ -0,0 +1,116 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultCookieChunkSize is the largest cookie value written before a
+// session cookie is split into chunks. Browsers limit each cookie to about
+// 4KB including its name and attributes.
+const DefaultCookieChunkSize = 3800
+
+// maxCookieChunks bounds the number of chunks read back from a request
+const maxCookieChunks = 16
+
+// cookieChunkPrefix marks a cookie whose value is stored in numbered chunks
+const cookieChunkPrefix = "chunks:"
+
+// SetChunkedCookie writes cookie, splitting values longer than chunkSize
+// (DefaultCookieChunkSize when zero or negative) across cookies named
+// name.0, name.1, ... The cookie itself then records the chunk count.
+// Chunks sent with r that are no longer needed are expired; r may be nil.
+// To clear a chunked cookie, pass a cookie with an empty value and MaxAge -1.
+func SetChunkedCookie(w http.ResponseWriter, r *http.Request, cookie *http.Cookie, chunkSize int) {
+	if chunkSize <= 0 {
+		chunkSize = DefaultCookieChunkSize
+	}
+
+	var chunks []string
+	value := cookie.Value
+	for len(value) > chunkSize {
+		chunks = append(chunks, value[:chunkSize])
+		value = value[chunkSize:]
+	}
+	if chunks != nil {
+		chunks = append(chunks, value)
+	}
+
+	head := *cookie
+	if chunks != nil {
+		head.Value = cookieChunkPrefix + strconv.Itoa(len(chunks))
+	}
+	http.SetCookie(w, &head)
+
+	for i, chunk := range chunks {
+		c := *cookie
+		c.Name = cookieChunkName(cookie.Name, i)
+		c.Value = chunk
+		http.SetCookie(w, &c)
+	}
+
+	if r == nil {
+		return
+	}
+	for i := len(chunks); i < maxCookieChunks; i++ {
+		if _, err := r.Cookie(cookieChunkName(cookie.Name, i)); err != nil {
+			break
+		}
+		c := *cookie
+		c.Name = cookieChunkName(cookie.Name, i)
+		c.Value = ""
+		c.MaxAge = -1
+		http.SetCookie(w, &c)
+	}
+}
+
+// JoinChunkedCookie returns the value of the named cookie, reassembling it
+// from its chunks when it was written by SetChunkedCookie. lookup returns
+// the value of a request cookie, or "" when it is missing.
+func JoinChunkedCookie(name string, lookup func(name string) string) (string, error) {
+	value := lookup(name)
+	if !strings.HasPrefix(value, cookieChunkPrefix) {
+		return value, nil
+	}
+
+	count, err := strconv.Atoi(strings.TrimPrefix(value, cookieChunkPrefix))
+	if err != nil || count < 1 || count > maxCookieChunks {
+		return "", fmt.Errorf("invalid cookie chunk count: %q", value)
+	}
+
+	var b strings.Builder
+	for i := 0; i < count; i++ {
+		chunk := lookup(cookieChunkName(name, i))
+		if chunk == "" {
+			return "", fmt.Errorf("missing cookie chunk %d of %d", i+1, count)
+		}
+		b.WriteString(chunk)
+	}
+	return b.String(), nil
+}
+
+// ReadChunkedCookie returns the value of the named request cookie,
+// reassembling chunks. It returns http.ErrNoCookie when the cookie is
+// missing.
+func ReadChunkedCookie(r *http.Request, name string) (string, error) {
+	value, err := JoinChunkedCookie(name, func(name string) string {
+		c, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return c.Value
+	})
+	if err != nil {
+		return "", err
+	}
+	if value == "" {
+		return "", http.ErrNoCookie
+	}
+	return value, nil
+}
+
+func cookieChunkName(name string, i int) string {
+	return name + "." + strconv.Itoa(i)
+}
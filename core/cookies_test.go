@@ -0,0 +1,76 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func requestWith(cookies []*http.Cookie) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range cookies {
+		if c.MaxAge >= 0 {
+			r.AddCookie(c)
+		}
+	}
+	return r
+}
+
+func TestSetChunkedCookie(t *testing.T) {
+	value := strings.Repeat("a", 25) + strings.Repeat("b", 5)
+
+	rec := httptest.NewRecorder()
+	SetChunkedCookie(rec, nil, &http.Cookie{Name: "sess", Value: value, Path: "/", HttpOnly: true}, 10)
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 4 {
+		t.Fatalf("Expected head and 3 chunks, got %d cookies", len(cookies))
+	}
+	if cookies[0].Name != "sess" || cookies[0].Value != "chunks:3" {
+		t.Errorf("Unexpected head cookie %s=%s", cookies[0].Name, cookies[0].Value)
+	}
+	for _, c := range cookies[1:] {
+		if !c.HttpOnly || c.Path != "/" {
+			t.Errorf("Expected chunk %s to keep cookie attributes", c.Name)
+		}
+	}
+
+	got, err := ReadChunkedCookie(requestWith(cookies), "sess")
+	if err != nil || got != value {
+		t.Errorf("ReadChunkedCookie() = %q, %v, want original value", got, err)
+	}
+
+	// A shorter value expires the chunks that are no longer needed
+	rec = httptest.NewRecorder()
+	SetChunkedCookie(rec, requestWith(cookies), &http.Cookie{Name: "sess", Value: "short"}, 10)
+	cookies = rec.Result().Cookies()
+	if cookies[0].Value != "short" {
+		t.Errorf("Expected unchunked value, got %q", cookies[0].Value)
+	}
+	expired := 0
+	for _, c := range cookies[1:] {
+		if c.MaxAge < 0 {
+			expired++
+		}
+	}
+	if expired != 3 {
+		t.Errorf("Expected 3 stale chunks to be expired, got %d", expired)
+	}
+}
+
+func TestReadChunkedCookie_Errors(t *testing.T) {
+	if _, err := ReadChunkedCookie(requestWith(nil), "sess"); err != http.ErrNoCookie {
+		t.Errorf("Expected http.ErrNoCookie, got %v", err)
+	}
+
+	missing := requestWith([]*http.Cookie{{Name: "sess", Value: "chunks:2"}, {Name: "sess.0", Value: "abc"}})
+	if _, err := ReadChunkedCookie(missing, "sess"); err == nil {
+		t.Error("Expected error for missing chunk")
+	}
+
+	invalid := requestWith([]*http.Cookie{{Name: "sess", Value: "chunks:100"}})
+	if _, err := ReadChunkedCookie(invalid, "sess"); err == nil {
+		t.Error("Expected error for invalid chunk count")
+	}
+}
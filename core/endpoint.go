@@ -0,0 +1,193 @@
+package core
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// AuthRequirement is the authentication an endpoint requires
+type AuthRequirement int
+
+const (
+	// AuthPublic endpoints serve every request; their handlers authorize
+	// requests themselves, e.g. with a pending sign-in token
+	AuthPublic AuthRequirement = iota
+
+	// AuthSession endpoints require a valid session, and respond 401
+	// Unauthorized without one
+	AuthSession
+
+	// AuthAdmin endpoints require the session of a user with RoleAdmin,
+	// and respond 403 Forbidden to other users
+	AuthAdmin
+)
+
+// RoleAdmin is the user role required by AuthAdmin endpoints
+const RoleAdmin = "admin"
+
+// Rate-limit classes of the built-in endpoints
+const (
+	// RateLimitCredentials covers endpoints that check passwords or codes,
+	// such as sign-in and two-factor verification
+	RateLimitCredentials = "credentials"
+
+	// RateLimitTokens covers endpoints that issue tokens to clients, such
+	// as the OIDC token and device code endpoints
+	RateLimitTokens = "tokens"
+)
+
+// RequestSession returns the session and user of the request. It uses the
+// session the router put in the request context for authenticated
+// endpoints, and otherwise reads the session cookie. Both are nil when the
+// request has no valid session.
+func (c *AuthContext) RequestSession(r *http.Request) (*Session, *User) {
+	session, user, _ := c.requestSession(r)
+	return session, user
+}
+
+// requestSession is RequestSession, also returning why the session cookie
+// was rejected
+func (c *AuthContext) requestSession(r *http.Request) (*Session, *User, error) {
+	if session := GetSession(r.Context()); session != nil {
+		return session, GetUser(r.Context()), nil
+	}
+	if c == nil || c.SessionManager == nil {
+		return nil, nil, nil
+	}
+	token, err := ReadChunkedCookie(r, c.Config.Session.CookieName)
+	if err != nil {
+		return nil, nil, nil
+	}
+	session, user, err := c.SessionManager.Get(WithClientInfo(r.Context(), ClientInfoFromRequest(r)), token)
+	if err != nil || session == nil {
+		return nil, nil, err
+	}
+	return session, user, nil
+}
+
+// EndpointHandler serves endpoint at path, relative to the base path. It
+// checks the method, rate-limit class and authentication, then runs the
+// endpoint's middleware around the Before hooks, the handler and the After
+// hooks. Hooks must be sorted (see SortHooks) and may be nil. Errors are
+// localized with the configured Localizer.
+func EndpointHandler(c *AuthContext, path string, endpoint Endpoint, hooks *HookConfig) http.Handler {
+	if hooks == nil {
+		hooks = &HookConfig{}
+	}
+	before, after := hooks.Before, hooks.After
+	var next http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !runBeforeHooks(w, r, path, before, c.Logger) {
+			return
+		}
+		if len(after) == 0 {
+			endpoint.Handler(w, r)
+			return
+		}
+		rec := &statusRecorder{ResponseWriter: w}
+		endpoint.Handler(rec, r)
+		runAfterHooks(r, path, rec.status(), after, c.Logger)
+	})
+	for i := len(endpoint.Middleware) - 1; i >= 0; i-- {
+		next = endpoint.Middleware[i](next)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.Config.Localizer != nil && RequestLocalizer(r.Context()) == nil {
+			r = r.WithContext(WithRequestLocalizer(r.Context(), c.Config.Localizer))
+		}
+		if endpoint.Method != "" && r.Method != endpoint.Method {
+			WriteStatusError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		if !c.allowRateLimitClass(w, r, endpoint.RateLimit) {
+			return
+		}
+
+		if endpoint.Auth != AuthPublic {
+			session, user, err := c.requestSession(r)
+			var ban *BanError
+			if errors.As(err, &ban) {
+				WriteBanError(w, r, ban)
+				return
+			}
+			if session == nil {
+				WriteStatusError(w, r, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+			if endpoint.Auth == AuthAdmin && (user == nil || !user.HasRole(RoleAdmin)) {
+				WriteStatusError(w, r, http.StatusForbidden, "Forbidden")
+				return
+			}
+			ctx := WithSession(r.Context(), session)
+			if user != nil {
+				ctx = WithUser(ctx, user)
+			}
+			r = r.WithContext(ctx)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowRateLimitClass counts the request against its rate-limit class and
+// reports whether it may proceed, answering 429 Too Many Requests when it
+// may not. Storage errors let the request through.
+func (c *AuthContext) allowRateLimitClass(w http.ResponseWriter, r *http.Request, class string) bool {
+	cfg := c.Config.RateLimit
+	if class == "" || cfg == nil || !cfg.Enabled || cfg.Storage == nil {
+		return true
+	}
+	limit, ok := cfg.Classes[class]
+	if !ok || limit.Limit <= 0 {
+		return true
+	}
+
+	key := "ratelimit:class:" + class + ":" + rateLimitClient(r)
+	allowed, err := cfg.Storage.Allow(r.Context(), key, limit.Limit, limit.Window)
+	if err != nil {
+		if c.Logger != nil {
+			c.Logger.Warn("Rate limit check failed", "class", class, "error", err)
+		}
+		return true
+	}
+	if !allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(limit.Window.Round(time.Second).Seconds())))
+		WriteStatusError(w, r, http.StatusTooManyRequests, "Too many requests")
+		return false
+	}
+	return true
+}
+
+// statusRecorder records the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (r *statusRecorder) status() int {
+	if r.code == 0 {
+		return http.StatusOK
+	}
+	return r.code
+}
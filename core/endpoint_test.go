@@ -0,0 +1,136 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roleSessionManager has a session for the tokens "user" and "admin"
+type roleSessionManager struct{ mockSessionManager }
+
+func (m *roleSessionManager) Get(ctx context.Context, token string) (*Session, *User, error) {
+	switch token {
+	case "user":
+		return &Session{ID: "s1", UserID: "u1"}, &User{ID: "u1"}, nil
+	case "admin":
+		return &Session{ID: "s2", UserID: "u2"}, &User{ID: "u2", Role: RoleAdmin}, nil
+	}
+	return nil, nil, ErrSessionNotFound
+}
+
+func newEndpointContext() *AuthContext {
+	cfg := defaultConfig()
+	return &AuthContext{Config: cfg, SessionManager: &roleSessionManager{}}
+}
+
+func TestEndpointHandler_Auth(t *testing.T) {
+	c := newEndpointContext()
+	var seen *User
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		seen = GetUser(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	tests := []struct {
+		name   string
+		auth   AuthRequirement
+		token  string
+		status int
+	}{
+		{"public without session", AuthPublic, "", http.StatusNoContent},
+		{"session required", AuthSession, "", http.StatusUnauthorized},
+		{"invalid session", AuthSession, "expired", http.StatusUnauthorized},
+		{"session", AuthSession, "user", http.StatusNoContent},
+		{"admin required", AuthAdmin, "user", http.StatusForbidden},
+		{"admin", AuthAdmin, "admin", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen = nil
+			h := EndpointHandler(c, "/x", Endpoint{Method: http.MethodGet, Handler: handler, Auth: tt.auth}, nil)
+			req := httptest.NewRequest(http.MethodGet, "/x", nil)
+			if tt.token != "" {
+				req.AddCookie(&http.Cookie{Name: c.Config.Session.CookieName, Value: tt.token})
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("Expected %d, got %d", tt.status, w.Code)
+			}
+			if tt.auth != AuthPublic && tt.status == http.StatusNoContent && seen == nil {
+				t.Error("Expected the user in the request context")
+			}
+		})
+	}
+}
+
+func TestEndpointHandler_MiddlewareOrder(t *testing.T) {
+	c := newEndpointContext()
+	var order []string
+	mw := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	hook := RequestHook{Handler: func(ctx context.Context, data interface{}) error {
+		order = append(order, "hook")
+		return nil
+	}}
+
+	h := EndpointHandler(c, "/x", Endpoint{
+		Method:     http.MethodPost,
+		Handler:    func(w http.ResponseWriter, r *http.Request) { order = append(order, "handler") },
+		Middleware: []func(http.Handler) http.Handler{mw("outer"), mw("inner")},
+	}, &HookConfig{Before: []RequestHook{hook}})
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/x", nil))
+	if got := strings.Join(order, ","); got != "outer,inner,hook,handler" {
+		t.Errorf("Expected outer,inner,hook,handler, got %s", got)
+	}
+
+	order = nil
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/x", nil))
+	if w.Code != http.StatusMethodNotAllowed || len(order) != 0 {
+		t.Errorf("Expected 405 before any middleware, got %d and %v", w.Code, order)
+	}
+}
+
+func TestEndpointHandler_RateLimitClass(t *testing.T) {
+	c := newEndpointContext()
+	if err := WithRateLimitClass(RateLimitCredentials, 2, time.Minute)(c.Config); err != nil {
+		t.Fatal(err)
+	}
+	c.Config.RateLimit.Storage = NewMemoryRateLimitStorage()
+
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	login := EndpointHandler(c, "/login", Endpoint{Handler: ok, RateLimit: RateLimitCredentials}, nil)
+	verify := EndpointHandler(c, "/2fa/verify", Endpoint{Handler: ok, RateLimit: RateLimitCredentials}, nil)
+	other := EndpointHandler(c, "/other", Endpoint{Handler: ok, RateLimit: RateLimitTokens}, nil)
+
+	serve := func(h http.Handler) int {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.RemoteAddr = "203.0.113.9:1234"
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if serve(login) != http.StatusOK || serve(verify) != http.StatusOK {
+		t.Fatal("Expected the first two requests of the class to pass")
+	}
+	if code := serve(login); code != http.StatusTooManyRequests {
+		t.Errorf("Expected endpoints of a class to share the limit, got %d", code)
+	}
+	if code := serve(other); code != http.StatusOK {
+		t.Errorf("Expected a class without a limit to pass, got %d", code)
+	}
+}
@@ -7,19 +7,42 @@ import (
 
 // Common errors
 var (
-	ErrInvalidCredentials = errors.New("invalid credentials")
-	ErrUserNotFound       = errors.New("user not found")
-	ErrSessionNotFound    = errors.New("session not found")
-	ErrSessionExpired     = errors.New("session expired")
-	ErrEmailTaken         = errors.New("email already taken")
-	ErrInvalidEmail       = errors.New("invalid email address")
-	ErrInvalidPassword    = errors.New("invalid password")
-	ErrEmailNotVerified   = errors.New("email not verified")
-	ErrUnauthorized       = errors.New("unauthorized")
-	ErrForbidden          = errors.New("forbidden")
-	ErrNotFound           = errors.New("not found")
-	ErrBadRequest         = errors.New("bad request")
-	ErrInternalServer     = errors.New("internal server error")
+	ErrInvalidCredentials   = errors.New("invalid credentials")
+	ErrUserNotFound         = errors.New("user not found")
+	ErrSessionNotFound      = errors.New("session not found")
+	ErrSessionExpired       = errors.New("session expired")
+	ErrSessionLimit         = errors.New("session limit reached")
+	ErrSessionBinding       = errors.New("session used by a different client")
+	ErrEmailTaken           = errors.New("email already taken")
+	ErrInvalidEmail         = errors.New("invalid email address")
+	ErrInvalidPassword      = errors.New("invalid password")
+	ErrEmailNotVerified     = errors.New("email not verified")
+	ErrUserBanned           = errors.New("user is banned")
+	ErrUnauthorized         = errors.New("unauthorized")
+	ErrForbidden            = errors.New("forbidden")
+	ErrNotFound             = errors.New("not found")
+	ErrBadRequest           = errors.New("bad request")
+	ErrInternalServer       = errors.New("internal server error")
+	ErrInvalidIdentifier    = errors.New("invalid SQL identifier")
+	ErrTxOptionsUnsupported = errors.New("transaction options not supported")
+)
+
+// Adapter errors. Adapters wrap the errors of their database driver with
+// these, so callers can check errors.Is(err, core.ErrDuplicate) whatever
+// the database. The driver's error stays in the chain for errors.As.
+var (
+	// ErrDuplicate reports a write that broke a unique or primary key
+	// constraint
+	ErrDuplicate = errors.New("duplicate record")
+
+	// ErrConstraint reports a write that broke another constraint, such as
+	// a foreign key, NOT NULL or CHECK constraint
+	ErrConstraint = errors.New("constraint violation")
+
+	// ErrTxConflict reports a transaction or statement that lost to a
+	// concurrent one, e.g. a serialization failure or deadlock. Running it
+	// again may succeed.
+	ErrTxConflict = errors.New("transaction conflict")
 )
 
 // AuthError represents an authentication error with additional context
@@ -63,6 +86,8 @@ const (
 	ErrCodeUserNotFound       = "USER_NOT_FOUND"
 	ErrCodeSessionNotFound    = "SESSION_NOT_FOUND"
 	ErrCodeSessionExpired     = "SESSION_EXPIRED"
+	ErrCodeSessionLimit       = "SESSION_LIMIT_REACHED"
+	ErrCodeSessionBinding     = "SESSION_BINDING_MISMATCH"
 	ErrCodeEmailTaken         = "EMAIL_TAKEN"
 	ErrCodeInvalidEmail       = "INVALID_EMAIL"
 	ErrCodeInvalidPassword    = "INVALID_PASSWORD"
@@ -0,0 +1,281 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Topics published on the event bus
+const (
+	// TopicUserCreated carries a *UserCreatedEvent
+	TopicUserCreated = "user.created"
+
+	// TopicSignIn carries a *SignInEvent
+	TopicSignIn = "auth.signed_in"
+
+	// TopicSessionCreated carries a *SessionCreatedEvent
+	TopicSessionCreated = "session.created"
+
+	// TopicSessionRevoked carries a *SessionRevokedEvent
+	TopicSessionRevoked = "session.revoked"
+
+	// TopicSecurityPrefix prefixes the type of security events, which
+	// carry a *SecurityEvent, e.g. "security.login_failed"
+	TopicSecurityPrefix = "security."
+)
+
+// DefaultEventBuffer is the queue size of async subscribers
+const DefaultEventBuffer = 256
+
+// Event is published on the event bus. Subscribers share the event and
+// must not modify it.
+type Event struct {
+	Topic string
+	Time  time.Time
+
+	// Data is the typed payload of the topic, such as *UserCreatedEvent
+	Data interface{}
+}
+
+// SessionRevokedEvent is published when a session is revoked through
+// Auth.RevokeSession
+type SessionRevokedEvent struct {
+	Token string
+}
+
+// EventHandler handles events of a subscription. Errors are logged.
+type EventHandler func(ctx context.Context, event *Event) error
+
+// EventSubscription is a subscription made by New (see
+// WithEventSubscriber)
+type EventSubscription struct {
+	Pattern string
+	Handler EventHandler
+	Options []SubscribeOption
+}
+
+// SubscribeOption configures a subscription
+type SubscribeOption func(*subscriber)
+
+// Async delivers events to the subscriber from its own goroutine through a
+// queue of buffer events (DefaultEventBuffer if buffer <= 0). Publish does
+// not wait for async subscribers; events are dropped when the queue is
+// full.
+func Async(buffer int) SubscribeOption {
+	return func(s *subscriber) {
+		if buffer <= 0 {
+			buffer = DefaultEventBuffer
+		}
+		s.buffer = buffer
+	}
+}
+
+type subscriber struct {
+	pattern string
+	handler EventHandler
+	buffer  int
+	queue   chan delivery
+}
+
+type delivery struct {
+	ctx   context.Context
+	event *Event
+}
+
+// matches reports whether the subscriber receives topic. Patterns are a
+// topic, "*" for every topic, or a prefix ending in ".*" such as "user.*".
+func (s *subscriber) matches(topic string) bool {
+	if s.pattern == "*" || s.pattern == topic {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(s.pattern, "*")
+	return ok && strings.HasSuffix(prefix, ".") && strings.HasPrefix(topic, prefix)
+}
+
+// EventBus publishes user, session and auth events to in-process
+// subscribers. Sync subscribers run on the publisher's goroutine, in
+// subscription order; async subscribers each have a queue and a worker. A
+// panicking handler is recovered and logged, and does not affect other
+// subscribers or the request that published the event.
+type EventBus struct {
+	logger  Logger
+	dropped atomic.Uint64
+
+	mu     sync.RWMutex
+	subs   []*subscriber
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// NewEventBus creates an event bus. Logger reports handler errors and
+// panics (nil = silent).
+func NewEventBus(logger Logger) *EventBus {
+	return &EventBus{logger: logger}
+}
+
+// Subscribe registers handler for topics matching pattern and returns a
+// function that cancels the subscription. Subscribing to a closed bus is a
+// no-op.
+func (b *EventBus) Subscribe(pattern string, handler EventHandler, opts ...SubscribeOption) (unsubscribe func()) {
+	s := &subscriber{pattern: pattern, handler: handler}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return func() {}
+	}
+	if s.buffer > 0 {
+		s.queue = make(chan delivery, s.buffer)
+		b.wg.Add(1)
+		go b.run(s)
+	}
+	b.subs = append(b.subs, s)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { b.unsubscribe(s) })
+	}
+}
+
+func (b *EventBus) unsubscribe(s *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, sub := range b.subs {
+		if sub == s {
+			b.subs = append(b.subs[:i:i], b.subs[i+1:]...)
+			if s.queue != nil {
+				close(s.queue)
+			}
+			return
+		}
+	}
+}
+
+// Publish delivers data under topic to the matching subscribers. A nil bus
+// is a no-op, so callers do not need to check whether one is configured.
+// Async subscribers receive ctx without its cancellation, so they can
+// finish after the request ends.
+func (b *EventBus) Publish(ctx context.Context, topic string, data interface{}) {
+	if b == nil {
+		return
+	}
+	event := &Event{Topic: topic, Time: time.Now().UTC(), Data: data}
+
+	var inline []*subscriber
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return
+	}
+	for _, s := range b.subs {
+		if !s.matches(topic) {
+			continue
+		}
+		if s.queue == nil {
+			inline = append(inline, s)
+			continue
+		}
+		select {
+		case s.queue <- delivery{ctx: context.WithoutCancel(ctx), event: event}:
+		default:
+			b.dropped.Add(1)
+			if b.logger != nil {
+				b.logger.Warn("Event subscriber queue is full, dropping event", "topic", topic, "pattern", s.pattern)
+			}
+		}
+	}
+	b.mu.RUnlock()
+
+	// Run sync handlers unlocked, so they may publish or subscribe
+	for _, s := range inline {
+		b.deliver(ctx, s, event)
+	}
+}
+
+func (b *EventBus) run(s *subscriber) {
+	defer b.wg.Done()
+	for d := range s.queue {
+		b.deliver(d.ctx, s, d.event)
+	}
+}
+
+// deliver calls the handler, recovering a panic
+func (b *EventBus) deliver(ctx context.Context, s *subscriber, event *Event) {
+	defer func() {
+		if r := recover(); r != nil && b.logger != nil {
+			b.logger.Error("Event subscriber panicked", "topic", event.Topic, "pattern", s.pattern, "panic", fmt.Sprint(r))
+		}
+	}()
+	if err := s.handler(ctx, event); err != nil && b.logger != nil {
+		b.logger.Warn("Event subscriber failed", "topic", event.Topic, "pattern", s.pattern, "error", err)
+	}
+}
+
+// Dropped returns the number of events dropped because an async queue was
+// full
+func (b *EventBus) Dropped() uint64 {
+	return b.dropped.Load()
+}
+
+// Close stops accepting events and waits for async subscribers to handle
+// the queued ones. Auth.Close closes the bus of Config.Events.
+func (b *EventBus) Close() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	for _, s := range b.subs {
+		if s.queue != nil {
+			close(s.queue)
+		}
+	}
+	b.subs = nil
+	b.mu.Unlock()
+
+	b.wg.Wait()
+	return nil
+}
+
+// busSecuritySink publishes security events on the bus before passing
+// them to the configured sink
+type busSecuritySink struct {
+	bus  *EventBus
+	next SecurityEventSink
+}
+
+func (s *busSecuritySink) Emit(ctx context.Context, event *SecurityEvent) error {
+	s.bus.Publish(ctx, TopicSecurityPrefix+string(event.Type), event)
+	if s.next == nil {
+		return nil
+	}
+	return s.next.Emit(ctx, event)
+}
+
+// DescribeSecurity describes the configured sink
+func (s *busSecuritySink) DescribeSecurity() map[string]interface{} {
+	if d, ok := s.next.(SecurityDescriber); ok {
+		return d.DescribeSecurity()
+	}
+	return nil
+}
+
+// Close closes the configured sink
+func (s *busSecuritySink) Close() error {
+	if closer, ok := s.next.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
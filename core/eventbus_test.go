@@ -0,0 +1,173 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestEventBus_NilIsNoop(t *testing.T) {
+	var bus *EventBus
+	bus.Publish(context.Background(), TopicUserCreated, nil)
+	if err := bus.Close(); err != nil {
+		t.Errorf("Expected nil bus Close to succeed, got %v", err)
+	}
+}
+
+func TestEventBus_PatternsAndOrder(t *testing.T) {
+	bus := NewEventBus(nil)
+	var calls []string
+	record := func(name string) EventHandler {
+		return func(ctx context.Context, event *Event) error {
+			calls = append(calls, name+":"+event.Topic)
+			return nil
+		}
+	}
+	bus.Subscribe(TopicUserCreated, record("exact"))
+	bus.Subscribe("session.*", record("prefix"))
+	bus.Subscribe("*", record("all"))
+	bus.Subscribe("user*", record("partial"))
+
+	bus.Publish(context.Background(), TopicUserCreated, nil)
+	bus.Publish(context.Background(), TopicSessionCreated, nil)
+
+	want := "exact:user.created,all:user.created,prefix:session.created,all:session.created"
+	if got := strings.Join(calls, ","); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestEventBus_PanicIsolation(t *testing.T) {
+	bus := NewEventBus(nil)
+	var called bool
+	bus.Subscribe("*", func(ctx context.Context, event *Event) error {
+		panic("boom")
+	})
+	bus.Subscribe("*", func(ctx context.Context, event *Event) error {
+		return errors.New("ignored")
+	})
+	bus.Subscribe("*", func(ctx context.Context, event *Event) error {
+		called = true
+		return nil
+	})
+
+	bus.Publish(context.Background(), TopicSignIn, nil)
+	if !called {
+		t.Error("Expected subscribers after a panicking one to run")
+	}
+}
+
+func TestEventBus_Async(t *testing.T) {
+	bus := NewEventBus(nil)
+	var mu sync.Mutex
+	var topics []string
+	bus.Subscribe("*", func(ctx context.Context, event *Event) error {
+		if ctx.Err() != nil {
+			t.Errorf("Expected a context without cancellation, got %v", ctx.Err())
+		}
+		mu.Lock()
+		topics = append(topics, event.Topic)
+		mu.Unlock()
+		return nil
+	}, Async(8))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bus.Publish(ctx, TopicUserCreated, nil)
+	bus.Publish(ctx, TopicSignIn, nil)
+	cancel()
+
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(topics, ","); got != "user.created,auth.signed_in" {
+		t.Errorf("Expected queued events to be handled before Close returns, got %s", got)
+	}
+
+	bus.Publish(context.Background(), TopicUserCreated, nil)
+	if len(topics) != 2 {
+		t.Error("Expected no events after Close")
+	}
+}
+
+func TestEventBus_AsyncQueueFull(t *testing.T) {
+	bus := NewEventBus(nil)
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	bus.Subscribe("*", func(ctx context.Context, event *Event) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}, Async(1))
+
+	bus.Publish(context.Background(), TopicUserCreated, nil)
+	<-started // the worker holds the first event
+	bus.Publish(context.Background(), TopicUserCreated, nil)
+	bus.Publish(context.Background(), TopicUserCreated, nil)
+
+	if got := bus.Dropped(); got != 1 {
+		t.Errorf("Expected 1 dropped event, got %d", got)
+	}
+	close(release)
+	_ = bus.Close()
+}
+
+func TestEventBus_Unsubscribe(t *testing.T) {
+	bus := NewEventBus(nil)
+	var count int
+	unsubscribe := bus.Subscribe("*", func(ctx context.Context, event *Event) error {
+		count++
+		return nil
+	})
+
+	bus.Publish(context.Background(), TopicSignIn, nil)
+	unsubscribe()
+	unsubscribe()
+	bus.Publish(context.Background(), TopicSignIn, nil)
+
+	if count != 1 {
+		t.Errorf("Expected 1 delivery, got %d", count)
+	}
+}
+
+func TestEmitSignIn_PublishesEvents(t *testing.T) {
+	c := &AuthContext{Events: NewEventBus(nil)}
+	var topics []string
+	var signIn *SignInEvent
+	c.Events.Subscribe("*", func(ctx context.Context, event *Event) error {
+		topics = append(topics, event.Topic)
+		if e, ok := event.Data.(*SignInEvent); ok {
+			signIn = e
+		}
+		return nil
+	})
+
+	req := httptest.NewRequest("POST", "/sign-in", nil)
+	c.EmitSignIn(req, &User{ID: "user-1"}, &Session{ID: "session-1"}, MethodPassword, "")
+
+	if got := strings.Join(topics, ","); got != "session.created,auth.signed_in" {
+		t.Errorf("Expected session.created then auth.signed_in, got %s", got)
+	}
+	if signIn == nil || signIn.User.ID != "user-1" || signIn.Method != MethodPassword {
+		t.Errorf("Unexpected sign-in event %+v", signIn)
+	}
+}
+
+func TestBusSecuritySink(t *testing.T) {
+	bus := NewEventBus(nil)
+	var topic string
+	bus.Subscribe("security.*", func(ctx context.Context, event *Event) error {
+		topic = event.Topic
+		return nil
+	})
+
+	sink := &busSecuritySink{bus: bus}
+	if err := EmitSecurityEvent(context.Background(), sink, &SecurityEvent{Type: EventLoginFailed}); err != nil {
+		t.Fatal(err)
+	}
+	if topic != "security.login_failed" {
+		t.Errorf("Expected security.login_failed, got %q", topic)
+	}
+}
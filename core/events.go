@@ -0,0 +1,149 @@
+package core
+
+import (
+	"context"
+	"time"
+)
+
+// SecurityEventType identifies a security-relevant event
+type SecurityEventType string
+
+const (
+	// EventLoginFailed is emitted when a sign-in attempt is rejected
+	EventLoginFailed SecurityEventType = "login_failed"
+
+	// EventLoginFailureSpike is emitted when failed sign-ins for one IP
+	// address or account exceed a threshold within a time window
+	EventLoginFailureSpike SecurityEventType = "login_failure_spike"
+
+	// EventTwoFactorFailed is emitted when a two-factor code is rejected
+	EventTwoFactorFailed SecurityEventType = "two_factor_failed"
+
+	// EventSessionBindingViolation is emitted when a session is used from a
+	// client that does not match the one that created it
+	EventSessionBindingViolation SecurityEventType = "session_binding_violation"
+
+	// EventUserBanned is emitted when a user is banned
+	EventUserBanned SecurityEventType = "user_banned"
+
+	// EventBannedUserRejected is emitted when a banned user signs in or
+	// uses a session
+	EventBannedUserRejected SecurityEventType = "banned_user_rejected"
+
+	// EventUserUnbanned is emitted when a temporary ban that has ended is
+	// lifted
+	EventUserUnbanned SecurityEventType = "user_unbanned"
+
+	// EventImpersonationStarted is emitted when an admin starts
+	// impersonating a user
+	EventImpersonationStarted SecurityEventType = "impersonation_started"
+
+	// EventRefreshTokenReuse is emitted when a rotated refresh token is
+	// presented again, which indicates it was stolen
+	EventRefreshTokenReuse SecurityEventType = "refresh_token_reuse"
+
+	// EventUserDataExported is emitted when a user's data is exported, by
+	// the user or, with ActorID set, by an admin
+	EventUserDataExported SecurityEventType = "user_data_exported"
+)
+
+// SecuritySeverity ranks security events for alerting
+type SecuritySeverity string
+
+const (
+	SeverityLow      SecuritySeverity = "low"
+	SeverityMedium   SecuritySeverity = "medium"
+	SeverityHigh     SecuritySeverity = "high"
+	SeverityCritical SecuritySeverity = "critical"
+)
+
+// defaultSeverities are used when an event is emitted without a severity
+var defaultSeverities = map[SecurityEventType]SecuritySeverity{
+	EventLoginFailed:             SeverityLow,
+	EventLoginFailureSpike:       SeverityHigh,
+	EventTwoFactorFailed:         SeverityMedium,
+	EventSessionBindingViolation: SeverityHigh,
+	EventUserBanned:              SeverityMedium,
+	EventBannedUserRejected:      SeverityMedium,
+	EventUserUnbanned:            SeverityLow,
+	EventImpersonationStarted:    SeverityMedium,
+	EventRefreshTokenReuse:       SeverityCritical,
+	EventUserDataExported:        SeverityLow,
+}
+
+// SecurityEvent describes a security-relevant occurrence for SIEM export
+type SecurityEvent struct {
+	Type     SecurityEventType `json:"type"`
+	Severity SecuritySeverity  `json:"severity"`
+	Time     time.Time         `json:"time"`
+
+	// Subject of the event, when known
+	UserID    string `json:"userId,omitempty"`
+	Email     string `json:"email,omitempty"`
+	SessionID string `json:"sessionId,omitempty"`
+
+	// ActorID is the user who performed the action, such as the admin
+	// starting an impersonation
+	ActorID string `json:"actorId,omitempty"`
+
+	// Client that triggered the event
+	IPAddress string `json:"ipAddress,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+
+	// Reason is a short human-readable explanation
+	Reason string `json:"reason,omitempty"`
+
+	// Metadata carries event-specific fields
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// SecurityEventSink receives security events. Emit is called on the request
+// path, so implementations should queue events rather than deliver them
+// synchronously.
+type SecurityEventSink interface {
+	Emit(ctx context.Context, event *SecurityEvent) error
+}
+
+// EmitSecurityEvent fills in the time, default severity and client
+// information from ctx, then passes the event to sink. A nil sink is a
+// no-op, so callers do not need to check whether events are configured.
+func EmitSecurityEvent(ctx context.Context, sink SecurityEventSink, event *SecurityEvent) error {
+	if sink == nil || event == nil {
+		return nil
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if event.Severity == "" {
+		event.Severity = defaultSeverities[event.Type]
+		if event.Severity == "" {
+			event.Severity = SeverityLow
+		}
+	}
+	if event.IPAddress == "" && event.UserAgent == "" {
+		info, ok := GetClientInfo(ctx)
+		if !ok {
+			if req := GetRequest(ctx); req != nil {
+				info, ok = ClientInfoFromRequest(req), true
+			}
+		}
+		if ok {
+			event.IPAddress = info.IPAddress
+			event.UserAgent = info.UserAgent
+		}
+	}
+
+	return sink.Emit(ctx, event)
+}
+
+// EmitSecurityEvent reports a security event to the configured sink and
+// logs delivery errors
+func (c *AuthContext) EmitSecurityEvent(ctx context.Context, event *SecurityEvent) {
+	if c == nil || c.SecurityEvents == nil {
+		return
+	}
+	if err := EmitSecurityEvent(ctx, c.SecurityEvents, event); err != nil && c.Logger != nil {
+		c.Logger.Warn("Failed to emit security event", "type", event.Type, "error", err)
+	}
+}
@@ -0,0 +1,43 @@
+package core
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+)
+
+type eventRecorder struct {
+	events []*SecurityEvent
+}
+
+func (r *eventRecorder) Emit(ctx context.Context, event *SecurityEvent) error {
+	r.events = append(r.events, event)
+	return nil
+}
+
+func TestEmitSecurityEvent(t *testing.T) {
+	if err := EmitSecurityEvent(context.Background(), nil, &SecurityEvent{Type: EventLoginFailed}); err != nil {
+		t.Errorf("Expected nil sink to be a no-op, got %v", err)
+	}
+
+	sink := &eventRecorder{}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "203.0.113.7:5123"
+	req.Header.Set("User-Agent", "test-agent")
+	ctx := WithRequest(context.Background(), req)
+
+	if err := EmitSecurityEvent(ctx, sink, &SecurityEvent{Type: EventRefreshTokenReuse}); err != nil {
+		t.Fatalf("EmitSecurityEvent() error = %v", err)
+	}
+
+	event := sink.events[0]
+	if event.Severity != SeverityCritical {
+		t.Errorf("Expected default severity critical, got %s", event.Severity)
+	}
+	if event.Time.IsZero() {
+		t.Error("Expected time to be set")
+	}
+	if event.IPAddress != "203.0.113.7" || event.UserAgent != "test-agent" {
+		t.Errorf("Expected client info from the request, got %q %q", event.IPAddress, event.UserAgent)
+	}
+}
@@ -0,0 +1,12 @@
+package core
+
+import "context"
+
+// PluginDataExporter is implemented by plugins that store data about
+// users, so user data exports include it (see the export plugin)
+type PluginDataExporter interface {
+	// ExportUserData returns the plugin's data about a user, encodable as
+	// JSON, or nil when it has none. Secrets such as password hashes and
+	// tokens must be left out.
+	ExportUserData(ctx context.Context, userID string) (interface{}, error)
+}
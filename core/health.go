@@ -0,0 +1,128 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Health check endpoints, below the base path
+const (
+	HealthzPath = "/healthz"
+	ReadyzPath  = "/readyz"
+)
+
+// DefaultHealthCheckTimeout bounds each readiness check when
+// AdvancedConfig.HealthCheckTimeout is not set
+const DefaultHealthCheckTimeout = 2 * time.Second
+
+// HealthChecker is implemented by session managers, user caches and
+// plugins whose connections /readyz checks, such as a Redis client
+type HealthChecker interface {
+	Ping(ctx context.Context) error
+}
+
+// HealthReport is the response of /healthz and /readyz. Checks maps each
+// checked dependency to "ok" or "unavailable"; errors are logged, not
+// returned.
+type HealthReport struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Health statuses
+const (
+	HealthOK           = "ok"
+	HealthUnavailable  = "unavailable"
+	HealthShuttingDown = "shutting_down"
+)
+
+// Ready checks the adapter, the session manager, the user cache and the
+// plugins that implement HealthChecker, each within the health check
+// timeout, and reports which are unavailable. Once Shutdown has started,
+// the report is HealthShuttingDown.
+func (a *beaconAuth) Ready(ctx context.Context) *HealthReport {
+	if a.shuttingDown.Load() {
+		return &HealthReport{Status: HealthShuttingDown}
+	}
+
+	checks := make(map[string]HealthChecker)
+	if a.ctx.Adapter != nil {
+		checks["database"] = a.ctx.Adapter
+	}
+	if hc, ok := a.ctx.SessionManager.(HealthChecker); ok {
+		checks["sessions"] = hc
+	}
+	if a.config.Session != nil {
+		if hc, ok := a.config.Session.UserCache.(HealthChecker); ok {
+			checks["userCache"] = hc
+		}
+	}
+	for _, p := range a.config.Plugins {
+		if hc, ok := p.(HealthChecker); ok {
+			checks[p.ID()] = hc
+		}
+	}
+
+	timeout := a.config.Advanced.HealthCheckTimeout
+	if timeout <= 0 {
+		timeout = DefaultHealthCheckTimeout
+	}
+
+	report := &HealthReport{Status: HealthOK, Checks: make(map[string]string, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, hc := range checks {
+		wg.Add(1)
+		go func(name string, hc HealthChecker) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			err := hc.Ping(checkCtx)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				a.ctx.Logger.Warn("Readiness check failed", "check", name, "error", err)
+				report.Checks[name] = HealthUnavailable
+				report.Status = HealthUnavailable
+				return
+			}
+			report.Checks[name] = HealthOK
+		}(name, hc)
+	}
+	wg.Wait()
+	return report
+}
+
+// healthHandler serves /healthz and /readyz ahead of rate limiting, so
+// frequent probes are never throttled
+func (a *beaconAuth) healthHandler(basePath string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != basePath+HealthzPath && r.URL.Path != basePath+ReadyzPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			WriteError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		// Liveness only needs the process to serve requests
+		report := &HealthReport{Status: HealthOK}
+		if r.URL.Path == basePath+ReadyzPath {
+			report = a.Ready(r.Context())
+		}
+
+		status := http.StatusOK
+		if report.Status != HealthOK {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
@@ -0,0 +1,133 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// pingAdapter fails Ping with err and records Close
+type pingAdapter struct {
+	mockAdapter
+	err    error
+	closed bool
+}
+
+func (a *pingAdapter) Ping(ctx context.Context) error { return a.err }
+
+func (a *pingAdapter) Close() error {
+	a.closed = true
+	return nil
+}
+
+// shutdownSessionManager records Shutdown and whether the adapter was
+// still open then
+type shutdownSessionManager struct {
+	mockSessionManager
+	adapter      *pingAdapter
+	shutdown     bool
+	adapterOpen  bool
+	pingDuration time.Duration
+}
+
+func (m *shutdownSessionManager) Shutdown(ctx context.Context) error {
+	m.shutdown = true
+	m.adapterOpen = !m.adapter.closed
+	return nil
+}
+
+func (m *shutdownSessionManager) Ping(ctx context.Context) error {
+	select {
+	case <-time.After(m.pingDuration):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func newHealthTestAuth(t *testing.T, adapter *pingAdapter, sm *shutdownSessionManager) Auth {
+	t.Helper()
+	auth, err := New(
+		WithSecret("test-secret"),
+		WithBaseURL("http://localhost:3000"),
+		WithAdapter(adapter),
+		withMockFactories(),
+		func(c *Config) error {
+			c.SessionManagerFactory = func(*Config, Adapter) (SessionManager, error) { return sm, nil }
+			c.Advanced.HealthCheckTimeout = 50 * time.Millisecond
+			c.Advanced.DisableSecurityBanner = true
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return auth
+}
+
+func getHealth(t *testing.T, auth Auth, method, path string) (int, HealthReport) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	auth.Handler().ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	var report HealthReport
+	if w.Code != http.StatusMethodNotAllowed {
+		if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+			t.Fatalf("%s: decoding response: %v", path, err)
+		}
+	}
+	return w.Code, report
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	adapter := &pingAdapter{}
+	sm := &shutdownSessionManager{adapter: adapter}
+	auth := newHealthTestAuth(t, adapter, sm)
+
+	if code, report := getHealth(t, auth, http.MethodGet, "/auth/healthz"); code != http.StatusOK || report.Status != HealthOK {
+		t.Errorf("/healthz = %d %+v", code, report)
+	}
+	code, report := getHealth(t, auth, http.MethodGet, "/auth/readyz")
+	if code != http.StatusOK || report.Status != HealthOK || report.Checks["database"] != HealthOK || report.Checks["sessions"] != HealthOK {
+		t.Errorf("/readyz = %d %+v", code, report)
+	}
+	if code, _ := getHealth(t, auth, http.MethodPost, "/auth/readyz"); code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /readyz = %d, want 405", code)
+	}
+
+	// A failing database and a hanging session store are reported
+	// separately, within the check timeout
+	adapter.err = errors.New("connection refused")
+	sm.pingDuration = time.Second
+	start := time.Now()
+	code, report = getHealth(t, auth, http.MethodGet, "/auth/readyz")
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("/readyz took %v, want the check timeout", elapsed)
+	}
+	if code != http.StatusServiceUnavailable || report.Status != HealthUnavailable ||
+		report.Checks["database"] != HealthUnavailable || report.Checks["sessions"] != HealthUnavailable {
+		t.Errorf("/readyz = %d %+v", code, report)
+	}
+	if code, _ := getHealth(t, auth, http.MethodGet, "/auth/healthz"); code != http.StatusOK {
+		t.Errorf("/healthz = %d with failing dependencies, want 200", code)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	adapter := &pingAdapter{}
+	sm := &shutdownSessionManager{adapter: adapter}
+	auth := newHealthTestAuth(t, adapter, sm)
+
+	if err := auth.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if !sm.shutdown || !sm.adapterOpen || !adapter.closed {
+		t.Errorf("session manager shut down = %v, adapter open then = %v, adapter closed = %v", sm.shutdown, sm.adapterOpen, adapter.closed)
+	}
+	if code, report := getHealth(t, auth, http.MethodGet, "/auth/readyz"); code != http.StatusServiceUnavailable || report.Status != HealthShuttingDown {
+		t.Errorf("/readyz after Shutdown = %d %+v", code, report)
+	}
+}
@@ -0,0 +1,218 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// RequestHook runs before or after the handler of matching endpoints
+type RequestHook struct {
+	// Matcher selects endpoints by their path, relative to the base path,
+	// and method. A nil Matcher matches every endpoint.
+	Matcher func(path string, method string) bool
+
+	// Handler runs the hook. Before hooks receive a *HookRequest and After
+	// hooks a *HookResult as data.
+	Handler func(ctx context.Context, data interface{}) error
+
+	// Priority orders hooks across plugins: lower numbers run first, and
+	// hooks of equal priority run in registration order
+	Priority int
+}
+
+// HookConfig defines the request hooks of a plugin
+type HookConfig struct {
+	Before []RequestHook
+	After  []RequestHook
+}
+
+// HookProvider is implemented by plugins with request hooks
+type HookProvider interface {
+	Hooks() *HookConfig
+}
+
+// HookRequest is passed to Before hooks. Hooks may change Body, and the
+// endpoint's handler decodes the changed body.
+type HookRequest struct {
+	// Request is the incoming request. Its body has been read into Body.
+	Request *http.Request
+
+	// Path is the endpoint path relative to the base path, e.g. "/register"
+	Path   string
+	Method string
+
+	// Body is the decoded JSON object of the request, or nil when the
+	// request has no JSON object body. Numbers decode to json.Number.
+	Body map[string]interface{}
+}
+
+// HookResult is passed to After hooks once the endpoint has answered
+type HookResult struct {
+	Request *http.Request
+
+	// Path is the endpoint path relative to the base path
+	Path   string
+	Method string
+
+	// Status is the status code of the response
+	Status int
+}
+
+// HookResponse answers a request in place of the endpoint. A Before hook
+// returns it as its error to skip the handler and any later hooks.
+type HookResponse struct {
+	Status int
+	Header http.Header
+
+	// Body is written as JSON, unless it is nil
+	Body interface{}
+}
+
+// NewHookResponse returns a response with the status and JSON body
+func NewHookResponse(status int, body interface{}) *HookResponse {
+	return &HookResponse{Status: status, Header: make(http.Header), Body: body}
+}
+
+func (r *HookResponse) Error() string {
+	return "request answered by hook with status " + strconv.Itoa(r.Status)
+}
+
+// write sends the response
+func (r *HookResponse) write(w http.ResponseWriter) {
+	for key, values := range r.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	status := r.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if r.Body == nil {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(r.Body)
+}
+
+// SortHooks orders hooks by priority, keeping the registration order of
+// hooks with equal priority
+func SortHooks(hooks []RequestHook) {
+	sort.SliceStable(hooks, func(i, j int) bool {
+		return hooks[i].Priority < hooks[j].Priority
+	})
+}
+
+// matches reports whether the hook runs for the endpoint
+func (h RequestHook) matches(path, method string) bool {
+	return h.Matcher == nil || h.Matcher(path, method)
+}
+
+// runBeforeHooks runs the matching hooks, in order, before the handler of
+// the endpoint at path. It reports whether the handler should run: false
+// once a hook has answered the request or failed.
+func runBeforeHooks(w http.ResponseWriter, r *http.Request, path string, hooks []RequestHook, logger Logger) bool {
+	var matched []RequestHook
+	for _, hook := range hooks {
+		if hook.matches(path, r.Method) {
+			matched = append(matched, hook)
+		}
+	}
+	if len(matched) == 0 {
+		return true
+	}
+
+	req := &HookRequest{Request: r, Path: path, Method: r.Method}
+	raw, err := readJSONBody(r, req)
+	if err != nil {
+		WriteStatusError(w, r, http.StatusBadRequest, "Invalid request body")
+		return false
+	}
+
+	for _, hook := range matched {
+		err := hook.Handler(r.Context(), req)
+		var resp *HookResponse
+		if errors.As(err, &resp) {
+			resp.write(w)
+			return false
+		}
+		if err != nil {
+			if logger != nil {
+				logger.Error("Before hook failed: %v", err)
+			}
+			WriteStatusError(w, r, http.StatusInternalServerError, "Internal server error")
+			return false
+		}
+	}
+
+	// Hand the handler the body as the hooks left it
+	if req.Body != nil {
+		if raw, err = json.Marshal(req.Body); err != nil {
+			if logger != nil {
+				logger.Error("Failed to encode hooked request body: %v", err)
+			}
+			WriteStatusError(w, r, http.StatusInternalServerError, "Internal server error")
+			return false
+		}
+	}
+	if raw != nil {
+		r.Body = io.NopCloser(bytes.NewReader(raw))
+		r.ContentLength = int64(len(raw))
+	}
+	return true
+}
+
+// runAfterHooks runs the matching hooks, in order, after the handler of the
+// endpoint at path has answered with status. The response is sent, so
+// errors are logged and stop the remaining hooks.
+func runAfterHooks(r *http.Request, path string, status int, hooks []RequestHook, logger Logger) {
+	result := &HookResult{Request: r, Path: path, Method: r.Method, Status: status}
+	for _, hook := range hooks {
+		if !hook.matches(path, r.Method) {
+			continue
+		}
+		if err := hook.Handler(r.Context(), result); err != nil {
+			if logger != nil {
+				logger.Error("After hook failed: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// readJSONBody reads the body of r, decoding a JSON object into req.Body,
+// and returns the raw body so it can be restored. Bodies that are not a
+// JSON object are left for the handler to reject.
+func readJSONBody(r *http.Request, req *HookRequest) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType != "application/json" {
+			return nil, nil
+		}
+	}
+
+	raw, err := io.ReadAll(r.Body)
+	_ = r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var body map[string]interface{}
+	if err := decoder.Decode(&body); err == nil && body != nil {
+		req.Body = body
+	}
+	return raw, nil
+}
@@ -0,0 +1,172 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// hookedPlugin records the body its endpoint receives
+type hookedPlugin struct {
+	id       string
+	hooks    *HookConfig
+	received map[string]interface{}
+	called   bool
+}
+
+func (p *hookedPlugin) ID() string                  { return p.id }
+func (p *hookedPlugin) Init(ctx *AuthContext) error { return nil }
+func (p *hookedPlugin) Hooks() *HookConfig          { return p.hooks }
+
+func (p *hookedPlugin) Endpoints() map[string]Endpoint {
+	if p.id != "register" {
+		return nil
+	}
+	return map[string]Endpoint{
+		"/register": {Method: http.MethodPost, Handler: func(w http.ResponseWriter, r *http.Request) {
+			p.called = true
+			_ = json.NewDecoder(r.Body).Decode(&p.received)
+			w.WriteHeader(http.StatusCreated)
+		}},
+	}
+}
+
+func newHookedAuth(t *testing.T, opts ...Option) Auth {
+	t.Helper()
+	auth, err := New(append([]Option{
+		WithSecret("test-secret"),
+		WithBaseURL("http://localhost:3000"),
+		WithBasePath("/auth"),
+		WithAdapter(&mockAdapter{}),
+		withMockFactories(),
+	}, opts...)...)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = auth.Close() })
+	return auth
+}
+
+func TestBeforeHooks_MutateBodyInOrder(t *testing.T) {
+	var order []string
+	record := func(name string) func(ctx context.Context, data interface{}) error {
+		return func(ctx context.Context, data interface{}) error {
+			order = append(order, name)
+			return nil
+		}
+	}
+
+	register := &hookedPlugin{id: "register"}
+	roles := &hookedPlugin{id: "roles", hooks: &HookConfig{Before: []RequestHook{
+		{Matcher: func(path, method string) bool { return path == "/register" }, Handler: func(ctx context.Context, data interface{}) error {
+			order = append(order, "roles")
+			req := data.(*HookRequest)
+			if _, ok := req.Body["role"]; !ok {
+				req.Body["role"] = "member"
+			}
+			return nil
+		}},
+		{Priority: -1, Handler: record("roles-early")},
+	}}}
+	normalize := &hookedPlugin{id: "normalize", hooks: &HookConfig{Before: []RequestHook{
+		{Handler: func(ctx context.Context, data interface{}) error {
+			order = append(order, "normalize")
+			req := data.(*HookRequest)
+			if email, ok := req.Body["email"].(string); ok {
+				req.Body["email"] = strings.ToLower(strings.TrimSpace(email))
+			}
+			return nil
+		}},
+	}}}
+
+	auth := newHookedAuth(t,
+		WithPlugins(register, roles, normalize),
+		WithBeforeHook(RequestHook{Handler: record("app")}),
+	)
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/register", strings.NewReader(`{"email":" Ada@Example.COM ","age":36}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	auth.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := strings.Join(order, ","); got != "roles-early,app,roles,normalize" {
+		t.Errorf("Unexpected hook order %s", got)
+	}
+	if register.received["email"] != "ada@example.com" || register.received["role"] != "member" {
+		t.Errorf("Expected the hooked body, handler got %v", register.received)
+	}
+	if age, _ := register.received["age"].(float64); age != 36 {
+		t.Errorf("Expected numbers to survive re-encoding, got %v", register.received["age"])
+	}
+}
+
+func TestBeforeHooks_ShortCircuit(t *testing.T) {
+	register := &hookedPlugin{id: "register"}
+	later := false
+	blocklist := &hookedPlugin{id: "blocklist", hooks: &HookConfig{Before: []RequestHook{
+		{Handler: func(ctx context.Context, data interface{}) error {
+			email, _ := data.(*HookRequest).Body["email"].(string)
+			if strings.HasSuffix(email, "@mailinator.com") {
+				resp := NewHookResponse(http.StatusForbidden, map[string]string{"error": "disposable_email"})
+				resp.Header.Set("X-Blocked-By", "blocklist")
+				return resp
+			}
+			return nil
+		}},
+		{Priority: 1, Handler: func(ctx context.Context, data interface{}) error {
+			later = true
+			return nil
+		}},
+	}}}
+	auth := newHookedAuth(t, WithPlugins(register, blocklist))
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/register", strings.NewReader(`{"email":"x@mailinator.com"}`))
+	w := httptest.NewRecorder()
+	auth.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "disposable_email") {
+		t.Fatalf("Expected the hook's 403, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("X-Blocked-By") != "blocklist" {
+		t.Error("Expected the hook's headers")
+	}
+	if register.called || later {
+		t.Error("Expected the handler and later hooks to be skipped")
+	}
+}
+
+func TestBeforeHooks_NonJSONBodyUntouched(t *testing.T) {
+	register := &hookedPlugin{id: "register"}
+	var body map[string]interface{}
+	inspect := &hookedPlugin{id: "inspect", hooks: &HookConfig{Before: []RequestHook{
+		{Handler: func(ctx context.Context, data interface{}) error {
+			body = data.(*HookRequest).Body
+			return nil
+		}},
+	}}}
+	auth := newHookedAuth(t, WithPlugins(register, inspect))
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/register", strings.NewReader(`email=a%40example.com`))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	auth.Handler().ServeHTTP(w, req)
+
+	if body != nil {
+		t.Errorf("Expected no decoded body for a form, got %v", body)
+	}
+	if !register.called {
+		t.Error("Expected the handler to run")
+	}
+}
+
+func TestWithBeforeHook_RejectsNilHandler(t *testing.T) {
+	if err := WithBeforeHook(RequestHook{})(defaultConfig()); err == nil {
+		t.Error("Expected an error for a hook without a handler")
+	}
+}
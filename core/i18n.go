@@ -0,0 +1,95 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// DefaultLocale is the locale of the messages written by handlers. Error
+// responses in this locale keep the handler's message.
+const DefaultLocale = "en"
+
+// Email template names of the default templates
+const (
+	EmailVerifyEmail   = "verify_email"
+	EmailResetPassword = "reset_password"
+	EmailMagicLink     = "magic_link"
+)
+
+// ErrNoLocalizer is returned by SendEmail without a Localizer
+var ErrNoLocalizer = errors.New("no localizer configured")
+
+// Localizer translates user-facing messages and renders emails in the
+// locale of a request. See package i18n.
+type Localizer interface {
+	// Locale returns the locale of r, e.g. from its Accept-Language header
+	Locale(r *http.Request) string
+
+	// Message returns the message for key in locale, with {name}
+	// placeholders replaced from data. It reports false when no message
+	// exists for key.
+	Message(locale, key string, data map[string]string) (string, bool)
+
+	// Email renders the email template name in locale
+	Email(locale, name string, data interface{}) (subject, body string, err error)
+}
+
+// WithRequestLocalizer sets the Localizer used for error responses to the
+// request
+func WithRequestLocalizer(ctx context.Context, l Localizer) context.Context {
+	return context.WithValue(ctx, localizerContextKey, l)
+}
+
+// RequestLocalizer returns the Localizer set with WithRequestLocalizer, or
+// nil
+func RequestLocalizer(ctx context.Context) Localizer {
+	l, _ := ctx.Value(localizerContextKey).(Localizer)
+	return l
+}
+
+// localizeError translates the message and field errors of an error
+// response into the request's locale. Messages are looked up as
+// "error.<code>" and field errors as "field.<code>" with a {field}
+// placeholder; untranslated ones are kept.
+func localizeError(r *http.Request, code ErrorCode, message string, details []FieldError) (string, []FieldError, string) {
+	l := RequestLocalizer(r.Context())
+	if l == nil {
+		return message, details, ""
+	}
+	locale := l.Locale(r)
+	if locale == "" || locale == DefaultLocale {
+		return message, details, ""
+	}
+
+	if translated, ok := l.Message(locale, "error."+string(code), nil); ok {
+		message = translated
+	}
+	if len(details) > 0 {
+		localized := make([]FieldError, len(details))
+		for i, detail := range details {
+			if translated, ok := l.Message(locale, "field."+detail.Code, map[string]string{"field": detail.Field}); ok {
+				detail.Message = translated
+			}
+			localized[i] = detail
+		}
+		details = localized
+	}
+	return message, details, locale
+}
+
+// SendEmail renders the email template name in locale with the configured
+// Localizer and sends it with the Mailer
+func (c *AuthContext) SendEmail(ctx context.Context, to, locale, name string, data interface{}) error {
+	if c.Config.Mailer == nil {
+		return errors.New("no mailer configured")
+	}
+	if c.Config.Localizer == nil {
+		return ErrNoLocalizer
+	}
+	subject, body, err := c.Config.Localizer.Email(locale, name, data)
+	if err != nil {
+		return err
+	}
+	return c.Config.Mailer.Send(ctx, to, subject, body)
+}
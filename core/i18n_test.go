@@ -0,0 +1,63 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// stubLocalizer answers every request in "xx" with the key as message
+type stubLocalizer struct{}
+
+func (stubLocalizer) Locale(r *http.Request) string { return "xx" }
+
+func (stubLocalizer) Message(locale, key string, data map[string]string) (string, bool) {
+	return locale + ":" + key, true
+}
+
+func (stubLocalizer) Email(locale, name string, data interface{}) (string, string, error) {
+	return locale + " " + name, "body", nil
+}
+
+type recordingMailer struct{ to, subject string }
+
+func (m *recordingMailer) Send(ctx context.Context, to, subject, body string) error {
+	m.to, m.subject = to, subject
+	return nil
+}
+
+func TestAuthContext_SendEmail(t *testing.T) {
+	mailer := &recordingMailer{}
+	c := &AuthContext{Config: &Config{Mailer: mailer}}
+	if err := c.SendEmail(context.Background(), "ada@example.com", "xx", EmailVerifyEmail, nil); !errors.Is(err, ErrNoLocalizer) {
+		t.Errorf("Expected ErrNoLocalizer, got %v", err)
+	}
+
+	c.Config.Localizer = stubLocalizer{}
+	if err := c.SendEmail(context.Background(), "ada@example.com", "xx", EmailVerifyEmail, nil); err != nil {
+		t.Fatal(err)
+	}
+	if mailer.to != "ada@example.com" || mailer.subject != "xx verify_email" {
+		t.Errorf("Unexpected email to %q with subject %q", mailer.to, mailer.subject)
+	}
+}
+
+func TestEndpointHandler_Localizer(t *testing.T) {
+	c := newEndpointContext()
+	c.Config.Localizer = stubLocalizer{}
+	h := EndpointHandler(c, "/x", Endpoint{Method: http.MethodGet, Auth: AuthSession}, nil)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/x", nil))
+
+	var resp ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Message != "xx:error.unauthorized" || w.Header().Get("Content-Language") != "xx" {
+		t.Errorf("Expected the localized message, got %q", resp.Message)
+	}
+}
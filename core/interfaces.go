@@ -6,10 +6,25 @@ import (
 	"time"
 )
 
-// Endpoint defines an API endpoint
+// Endpoint defines an API endpoint. The router enforces Auth and
+// RateLimit and applies Middleware, so plugins declare their policies
+// instead of checking cookies in every handler.
 type Endpoint struct {
 	Method  string
 	Handler http.HandlerFunc
+
+	// Auth is the authentication the endpoint requires (default
+	// AuthPublic). Authenticated requests reach Handler with the session
+	// and user in their context (see AuthContext.RequestSession).
+	Auth AuthRequirement
+
+	// Middleware wraps Handler and the Before hooks, the first entry
+	// outermost. It runs after the Auth and RateLimit checks.
+	Middleware []func(http.Handler) http.Handler
+
+	// RateLimit is the rate-limit class of the endpoint, such as
+	// RateLimitCredentials, limited by RateLimitConfig.Classes
+	RateLimit string
 }
 
 // Adapter defines the interface for database adapters
@@ -24,6 +39,17 @@ type Adapter interface {
 	DeleteMany(ctx context.Context, query *Query) (int64, error)
 	Count(ctx context.Context, query *Query) (int64, error)
 
+	// CreateMany creates several records of the same shape, in as few
+	// statements as the database allows, and returns how many were created
+	CreateMany(ctx context.Context, model string, data []map[string]interface{}) (int64, error)
+
+	// Upsert inserts data, or updates the existing record whose
+	// conflictFields match data, in one atomic operation and returns the
+	// stored record. Fields other than the conflict fields are overwritten.
+	// SQL databases need a primary key or unique constraint on the conflict
+	// fields.
+	Upsert(ctx context.Context, model string, conflictFields []string, data map[string]interface{}) (map[string]interface{}, error)
+
 	// Transaction support
 	Transaction(ctx context.Context, fn func(Adapter) error) error
 
@@ -35,6 +61,49 @@ type Adapter interface {
 	ID() string
 }
 
+// Capabilities describes optional features an adapter supports, so higher
+// layers can choose a query strategy instead of assuming the lowest common
+// denominator
+type Capabilities struct {
+	// ReturningSupported means Create and Update return the row as stored by
+	// the database (including defaults) without a separate read
+	ReturningSupported bool
+
+	// JoinSupported means the adapter honors Query.Joins
+	JoinSupported bool
+
+	// JSONSupported means map and slice values can be stored natively
+	JSONSupported bool
+
+	// TransactionsSupported means Transaction is atomic and rolls back on error
+	TransactionsSupported bool
+
+	// CaseInsensitiveLike means OpLike matches without regard to case
+	CaseInsensitiveLike bool
+}
+
+// CapabilityProvider is implemented by adapters that report their capabilities
+type CapabilityProvider interface {
+	Capabilities() Capabilities
+}
+
+// AdapterCapabilities returns the capabilities of an adapter. Adapters that
+// do not implement CapabilityProvider report no optional capabilities.
+func AdapterCapabilities(adapter Adapter) Capabilities {
+	if provider, ok := adapter.(CapabilityProvider); ok {
+		return provider.Capabilities()
+	}
+	return Capabilities{}
+}
+
+// SessionUserFinder is implemented by adapters that load a session and its
+// user in one round trip. It returns the unexpired session with the token
+// (nil if none) and its user (nil if the user no longer exists).
+// InternalAdapter uses it when available and falls back to two queries.
+type SessionUserFinder interface {
+	FindSessionWithUser(ctx context.Context, sessionModel, userModel, token string, now time.Time) (session, user map[string]interface{}, err error)
+}
+
 // Operator type
 type Operator string
 
@@ -63,7 +132,10 @@ const (
 
 // Query represents a database query
 type Query struct {
-	Model   string
+	Model string
+	// Select lists the fields FindOne and FindMany return; empty returns
+	// every field
+	Select  []string
 	Where   []WhereClause
 	Joins   []Join
 	Limit   int
@@ -163,6 +235,33 @@ type PasswordHasher interface {
 	Verify(password, hash string) (bool, error)
 }
 
+// PasswordRehasher is implemented by password hashers that can report
+// when a stored hash should be upgraded after a successful login
+type PasswordRehasher interface {
+	NeedsRehash(hash string) bool
+}
+
+// UserStore keeps the users of an app whose users live outside
+// beacon-auth's database, such as in an HTTP or gRPC user service. Lookups
+// of unknown users return ErrUserNotFound, and creating a user whose email
+// is taken returns ErrDuplicate. UpdateUser gets column names, e.g.
+// "email_verified" or "banned", and returns the updated user.
+type UserStore interface {
+	CreateUser(ctx context.Context, email, name string) (*User, error)
+	FindUserByID(ctx context.Context, id string) (*User, error)
+	FindUserByEmail(ctx context.Context, email string) (*User, error)
+	UpdateUser(ctx context.Context, userID string, data map[string]interface{}) (*User, error)
+}
+
+// UserCache keeps users looked up during session validation. It returns
+// copies, so callers may modify the users they get. InvalidateUser drops a
+// user that changed, on every instance sharing the cache.
+type UserCache interface {
+	GetUser(ctx context.Context, userID string) (*User, bool)
+	SetUser(ctx context.Context, user *User)
+	InvalidateUser(ctx context.Context, userID string)
+}
+
 // DataManager defines high-level database operations
 type DataManager interface {
 	FindAccountByProvider(ctx context.Context, provider, accountID string) (*Account, error)
@@ -171,4 +270,9 @@ type DataManager interface {
 	UpdateUser(ctx context.Context, userID string, data map[string]interface{}) (*User, error)
 	CreateOAuthAccount(ctx context.Context, userID, provider, accountID, accessToken, refreshToken string, expiresAt *time.Time) (*Account, error)
 	CreateCredentialAccount(ctx context.Context, userID, identifier, passwordHash string) (*Account, error)
+	UpdateCredentialPassword(ctx context.Context, userID, passwordHash string) error
+
+	// Transaction runs fn with a DataManager whose writes share one
+	// transaction, when the adapter supports them
+	Transaction(ctx context.Context, fn func(DataManager) error) error
 }
@@ -0,0 +1,203 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Sign-in methods reported in lifecycle events
+const (
+	MethodPassword  = "password"
+	MethodTwoFactor = "two_factor"
+	MethodOAuth     = "oauth"
+	MethodSAML      = "saml"
+	MethodDevice    = "device"
+)
+
+// UserCreatedEvent is passed to OnUserCreated hooks once a new user is
+// stored
+type UserCreatedEvent struct {
+	User *User
+
+	// Method is how the user signed up, such as MethodPassword or
+	// MethodOAuth
+	Method string
+
+	// Provider is the OAuth provider or SAML identity provider, if any
+	Provider string
+
+	// Client that made the request
+	Client ClientInfo
+}
+
+// SignInEvent is passed to OnSignIn hooks when a user is given a session
+// after authenticating, including right after signing up
+type SignInEvent struct {
+	User    *User
+	Session *Session
+
+	// Method is how the user authenticated. Users with two-factor
+	// authentication sign in with MethodTwoFactor once their second factor
+	// is verified.
+	Method string
+
+	// Provider is the OAuth provider or SAML identity provider, if any
+	Provider string
+
+	// Client that made the request
+	Client ClientInfo
+}
+
+// SessionCreatedEvent is passed to OnSessionCreated hooks for every new
+// session: on sign-in and for sessions created with Auth.CreateSession.
+// Rotating a session replaces its token and does not create a session.
+type SessionCreatedEvent struct {
+	Session *Session
+
+	// User is the session's user, or nil when it was not loaded
+	User *User
+
+	// Client that made the request, empty outside a request
+	Client ClientInfo
+}
+
+// LifecycleHooks are called after users and sessions are created. Hooks
+// run in order on the request path, after the change is stored; an error
+// is logged and does not fail the request. Register hooks with the
+// beaconauth.WithOn* options or, from plugins, in Init.
+type LifecycleHooks struct {
+	OnUserCreated    []func(ctx context.Context, event *UserCreatedEvent) error
+	OnSignIn         []func(ctx context.Context, event *SignInEvent) error
+	OnSessionCreated []func(ctx context.Context, event *SessionCreatedEvent) error
+}
+
+// UserCreated runs the OnUserCreated hooks and returns their errors
+func (h *LifecycleHooks) UserCreated(ctx context.Context, event *UserCreatedEvent) error {
+	if h == nil {
+		return nil
+	}
+	var errs []error
+	for _, hook := range h.OnUserCreated {
+		errs = append(errs, hook(ctx, event))
+	}
+	return errors.Join(errs...)
+}
+
+// SignIn runs the OnSignIn hooks and returns their errors
+func (h *LifecycleHooks) SignIn(ctx context.Context, event *SignInEvent) error {
+	if h == nil {
+		return nil
+	}
+	var errs []error
+	for _, hook := range h.OnSignIn {
+		errs = append(errs, hook(ctx, event))
+	}
+	return errors.Join(errs...)
+}
+
+// SessionCreated runs the OnSessionCreated hooks and returns their errors
+func (h *LifecycleHooks) SessionCreated(ctx context.Context, event *SessionCreatedEvent) error {
+	if h == nil {
+		return nil
+	}
+	var errs []error
+	for _, hook := range h.OnSessionCreated {
+		errs = append(errs, hook(ctx, event))
+	}
+	return errors.Join(errs...)
+}
+
+// OnUserCreated registers a hook for new users. Plugins call it from Init;
+// hooks cannot be added once requests are served.
+func (c *AuthContext) OnUserCreated(hook func(ctx context.Context, event *UserCreatedEvent) error) {
+	c.lifecycle().OnUserCreated = append(c.lifecycle().OnUserCreated, hook)
+}
+
+// OnSignIn registers a hook for sign-ins. Plugins call it from Init.
+func (c *AuthContext) OnSignIn(hook func(ctx context.Context, event *SignInEvent) error) {
+	c.lifecycle().OnSignIn = append(c.lifecycle().OnSignIn, hook)
+}
+
+// OnSessionCreated registers a hook for new sessions. Plugins call it from
+// Init.
+func (c *AuthContext) OnSessionCreated(hook func(ctx context.Context, event *SessionCreatedEvent) error) {
+	c.lifecycle().OnSessionCreated = append(c.lifecycle().OnSessionCreated, hook)
+}
+
+func (c *AuthContext) lifecycle() *LifecycleHooks {
+	if c.Lifecycle == nil {
+		c.Lifecycle = &LifecycleHooks{}
+	}
+	return c.Lifecycle
+}
+
+// EmitUserCreated runs the OnUserCreated hooks for a user created during r,
+// logs their errors and publishes the event
+func (c *AuthContext) EmitUserCreated(r *http.Request, user *User, method, provider string) {
+	if c == nil {
+		return
+	}
+	event := &UserCreatedEvent{
+		User:     user,
+		Method:   method,
+		Provider: provider,
+		Client:   ClientInfoFromRequest(r),
+	}
+	c.logHookError("OnUserCreated", c.Lifecycle.UserCreated(r.Context(), event))
+	c.Events.Publish(r.Context(), TopicUserCreated, event)
+}
+
+// EmitSignIn runs the OnSessionCreated and then the OnSignIn hooks for a
+// session created by signing in during r, logs their errors and publishes
+// the events
+func (c *AuthContext) EmitSignIn(r *http.Request, user *User, session *Session, method, provider string) {
+	if c == nil {
+		return
+	}
+	client := ClientInfoFromRequest(r)
+	created := &SessionCreatedEvent{
+		Session: session,
+		User:    user,
+		Client:  client,
+	}
+	c.logHookError("OnSessionCreated", c.Lifecycle.SessionCreated(r.Context(), created))
+	c.Events.Publish(r.Context(), TopicSessionCreated, created)
+
+	signIn := &SignInEvent{
+		User:     user,
+		Session:  session,
+		Method:   method,
+		Provider: provider,
+		Client:   client,
+	}
+	c.logHookError("OnSignIn", c.Lifecycle.SignIn(r.Context(), signIn))
+	c.Events.Publish(r.Context(), TopicSignIn, signIn)
+}
+
+// EmitSessionCreated runs the OnSessionCreated hooks for a session created
+// outside of a sign-in, logs their errors and publishes the event
+func (c *AuthContext) EmitSessionCreated(ctx context.Context, user *User, session *Session) {
+	if c == nil {
+		return
+	}
+	var client ClientInfo
+	if info, ok := GetClientInfo(ctx); ok {
+		client = info
+	} else if req := GetRequest(ctx); req != nil {
+		client = ClientInfoFromRequest(req)
+	}
+	event := &SessionCreatedEvent{
+		Session: session,
+		User:    user,
+		Client:  client,
+	}
+	c.logHookError("OnSessionCreated", c.Lifecycle.SessionCreated(ctx, event))
+	c.Events.Publish(ctx, TopicSessionCreated, event)
+}
+
+func (c *AuthContext) logHookError(hook string, err error) {
+	if err != nil && c.Logger != nil {
+		c.Logger.Warn("Lifecycle hook failed", "hook", hook, "error", err)
+	}
+}
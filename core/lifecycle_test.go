@@ -0,0 +1,94 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLifecycleHooks_NilIsNoop(t *testing.T) {
+	var hooks *LifecycleHooks
+	if err := hooks.SignIn(context.Background(), &SignInEvent{}); err != nil {
+		t.Errorf("Expected nil hooks to be a no-op, got %v", err)
+	}
+
+	var c *AuthContext
+	c.EmitSessionCreated(context.Background(), nil, &Session{})
+}
+
+func TestLifecycleHooks_RunsAllAndJoinsErrors(t *testing.T) {
+	hooks := &LifecycleHooks{}
+	var calls []string
+	hooks.OnUserCreated = append(hooks.OnUserCreated,
+		func(ctx context.Context, event *UserCreatedEvent) error {
+			calls = append(calls, "first")
+			return errors.New("crm unavailable")
+		},
+		func(ctx context.Context, event *UserCreatedEvent) error {
+			calls = append(calls, "second")
+			return nil
+		},
+	)
+
+	err := hooks.UserCreated(context.Background(), &UserCreatedEvent{User: &User{ID: "user-1"}})
+	if err == nil || !strings.Contains(err.Error(), "crm unavailable") {
+		t.Errorf("Expected the hook error, got %v", err)
+	}
+	if strings.Join(calls, ",") != "first,second" {
+		t.Errorf("Expected every hook to run in order, got %v", calls)
+	}
+}
+
+func TestEmitSignIn(t *testing.T) {
+	c := &AuthContext{}
+	var order []string
+	var signIn *SignInEvent
+	c.OnSessionCreated(func(ctx context.Context, event *SessionCreatedEvent) error {
+		order = append(order, "session")
+		return nil
+	})
+	c.OnSignIn(func(ctx context.Context, event *SignInEvent) error {
+		order = append(order, "signin")
+		signIn = event
+		return errors.New("ignored")
+	})
+
+	req := httptest.NewRequest("POST", "/sign-in", nil)
+	req.RemoteAddr = "203.0.113.7:5123"
+	req.Header.Set("User-Agent", "test-agent")
+	user := &User{ID: "user-1"}
+	session := &Session{ID: "session-1", UserID: "user-1"}
+
+	c.EmitSignIn(req, user, session, MethodOAuth, "github")
+
+	if strings.Join(order, ",") != "session,signin" {
+		t.Errorf("Expected OnSessionCreated before OnSignIn, got %v", order)
+	}
+	if signIn == nil || signIn.User != user || signIn.Session != session {
+		t.Fatalf("Unexpected sign-in event %+v", signIn)
+	}
+	if signIn.Method != MethodOAuth || signIn.Provider != "github" {
+		t.Errorf("Expected oauth via github, got %q %q", signIn.Method, signIn.Provider)
+	}
+	if signIn.Client.IPAddress != "203.0.113.7" || signIn.Client.UserAgent != "test-agent" {
+		t.Errorf("Expected client info from the request, got %+v", signIn.Client)
+	}
+}
+
+func TestEmitSessionCreated_ClientFromContext(t *testing.T) {
+	c := &AuthContext{}
+	var got *SessionCreatedEvent
+	c.OnSessionCreated(func(ctx context.Context, event *SessionCreatedEvent) error {
+		got = event
+		return nil
+	})
+
+	ctx := WithClientInfo(context.Background(), ClientInfo{IPAddress: "198.51.100.2", UserAgent: "worker"})
+	c.EmitSessionCreated(ctx, nil, &Session{ID: "session-1"})
+
+	if got == nil || got.Session.ID != "session-1" || got.Client.IPAddress != "198.51.100.2" {
+		t.Errorf("Unexpected session event %+v", got)
+	}
+}
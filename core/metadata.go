@@ -0,0 +1,19 @@
+package core
+
+import (
+	"context"
+	"errors"
+)
+
+// SessionMetadataManager is implemented by session managers that can keep
+// metadata on a session, such as the active organization or a step-up
+// flag (see session.Manager.SetMetadata)
+type SessionMetadataManager interface {
+	SetMetadata(ctx context.Context, token, key string, value interface{}) error
+	GetMetadata(ctx context.Context, token, key string) (interface{}, error)
+}
+
+// ErrMetadataUnsupported is returned when session metadata cannot be
+// stored, because the session manager does not implement
+// SessionMetadataManager or sessions are only kept in cookies
+var ErrMetadataUnsupported = errors.New("session metadata is not supported")
@@ -0,0 +1,161 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+)
+
+// ConfigurablePlugin is implemented by plugins with settings. New fills
+// the struct returned by Config from the plugin's section of the config
+// file, then calls ValidateConfig, before any plugin is initialized.
+type ConfigurablePlugin interface {
+	// Config returns a pointer to the plugin's settings struct, or nil
+	// when the plugin has no settings
+	Config() interface{}
+
+	// ValidateConfig checks the settings
+	ValidateConfig() error
+}
+
+// PluginSettings decodes a plugin's section of the config file into its
+// settings struct
+type PluginSettings func(target interface{}) error
+
+// WithConfigFile loads plugin settings from a YAML file, usually
+// beacon.yaml. Each plugin's settings are under its ID:
+//
+//	plugins:
+//	  device:
+//	    expires_in: 10m
+//	    interval: 5s
+//
+// Unknown keys, and settings of plugins that are not registered, fail New.
+func WithConfigFile(path string) Option {
+	return func(c *Config) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read config file: %w", err)
+		}
+		settings, err := parsePluginSettings(path, data)
+		if err != nil {
+			return err
+		}
+		if c.PluginSettings == nil {
+			c.PluginSettings = make(map[string]PluginSettings)
+		}
+		for id, s := range settings {
+			c.PluginSettings[id] = s
+		}
+		return nil
+	}
+}
+
+// parsePluginSettings reads the plugins section of a config file
+func parsePluginSettings(path string, data []byte) (map[string]PluginSettings, error) {
+	file, err := parser.ParseBytes(data, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, yaml.FormatError(err, false, true))
+	}
+
+	settings := make(map[string]PluginSettings)
+	for _, doc := range file.Docs {
+		if doc.Body == nil || doc.Body.Type() == ast.NullType {
+			continue
+		}
+		top, ok := mappingValues(doc.Body)
+		if !ok {
+			return nil, fmt.Errorf("%s: expected a mapping with a plugins key", path)
+		}
+		for _, entry := range top {
+			if key := entry.Key.GetToken().Value; key != "plugins" {
+				return nil, fmt.Errorf("%s: line %d: unknown key %q (supported: plugins)", path, entry.Key.GetToken().Position.Line, key)
+			}
+			if entry.Value.Type() == ast.NullType {
+				continue
+			}
+			plugins, ok := mappingValues(entry.Value)
+			if !ok {
+				return nil, fmt.Errorf("%s: plugins must map plugin IDs to their settings", path)
+			}
+			for _, p := range plugins {
+				id, node := p.Key.GetToken().Value, p.Value
+				settings[id] = func(target interface{}) error {
+					if err := yaml.NodeToValue(node, target, yaml.DisallowUnknownField()); err != nil {
+						return fmt.Errorf("%s: plugins.%s: %s", path, id, yaml.FormatError(err, false, true))
+					}
+					return nil
+				}
+			}
+		}
+	}
+	return settings, nil
+}
+
+// mappingValues returns the entries of a mapping node
+func mappingValues(node ast.Node) ([]*ast.MappingValueNode, bool) {
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		return n.Values, true
+	case *ast.MappingValueNode:
+		return []*ast.MappingValueNode{n}, true
+	}
+	return nil, false
+}
+
+// ConfigurePlugins applies settings, keyed by plugin ID, to the plugins and
+// validates the configuration of every ConfigurablePlugin. Settings for a
+// plugin that is not in plugins, or that has no settings, are an error.
+func ConfigurePlugins(plugins []Plugin, settings map[string]PluginSettings) error {
+	known := make(map[string]bool, len(plugins))
+	for _, p := range plugins {
+		known[p.ID()] = true
+	}
+	var unknown []string
+	for id := range settings {
+		if !known[id] {
+			unknown = append(unknown, id)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		ids := make([]string, 0, len(known))
+		for id := range known {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		return fmt.Errorf("settings for unregistered plugins %s (registered: %s)", strings.Join(unknown, ", "), strings.Join(ids, ", "))
+	}
+
+	var errs []error
+	for _, p := range plugins {
+		configurable, ok := p.(ConfigurablePlugin)
+		if !ok {
+			if settings[p.ID()] != nil {
+				errs = append(errs, fmt.Errorf("plugin %s has no settings", p.ID()))
+			}
+			continue
+		}
+		if s := settings[p.ID()]; s != nil {
+			target := configurable.Config()
+			if target == nil {
+				errs = append(errs, fmt.Errorf("plugin %s has no settings", p.ID()))
+				continue
+			}
+			if err := s(target); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		if err := configurable.ValidateConfig(); err != nil {
+			errs = append(errs, fmt.Errorf("plugin %s: invalid configuration: %w", p.ID(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
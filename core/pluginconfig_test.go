@@ -0,0 +1,146 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type rateSettings struct {
+	Limit  int           `yaml:"limit"`
+	Window time.Duration `yaml:"window"`
+}
+
+// settingsPlugin is a plugin with settings
+type settingsPlugin struct {
+	id       string
+	settings rateSettings
+}
+
+func (p *settingsPlugin) ID() string                     { return p.id }
+func (p *settingsPlugin) Init(ctx *AuthContext) error    { return nil }
+func (p *settingsPlugin) Endpoints() map[string]Endpoint { return nil }
+func (p *settingsPlugin) Config() interface{}            { return &p.settings }
+
+func (p *settingsPlugin) ValidateConfig() error {
+	if p.settings.Limit <= 0 {
+		return errors.New("limit must be positive")
+	}
+	return nil
+}
+
+// plainPlugin has no settings
+type plainPlugin struct{}
+
+func (plainPlugin) ID() string                     { return "plain" }
+func (plainPlugin) Init(ctx *AuthContext) error    { return nil }
+func (plainPlugin) Endpoints() map[string]Endpoint { return nil }
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "beacon.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestWithConfigFile_LoadsPluginSettings(t *testing.T) {
+	path := writeConfigFile(t, `
+plugins:
+  ratelimit:
+    limit: 10
+    window: 1m
+`)
+	p := &settingsPlugin{id: "ratelimit"}
+	_, err := New(
+		WithSecret("test-secret"),
+		WithBaseURL("http://localhost:3000"),
+		WithAdapter(&mockAdapter{}),
+		withMockFactories(),
+		WithPlugins(p, plainPlugin{}),
+		WithConfigFile(path),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if p.settings.Limit != 10 || p.settings.Window != time.Minute {
+		t.Errorf("Expected settings from the file, got %+v", p.settings)
+	}
+}
+
+func TestConfigurePlugins_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		plugins []Plugin
+		want    string
+	}{
+		{
+			name:    "invalid settings",
+			file:    "plugins:\n  ratelimit:\n    limit: 0\n",
+			plugins: []Plugin{&settingsPlugin{id: "ratelimit"}},
+			want:    "plugin ratelimit: invalid configuration: limit must be positive",
+		},
+		{
+			name:    "validated without a file",
+			plugins: []Plugin{&settingsPlugin{id: "ratelimit"}},
+			want:    "limit must be positive",
+		},
+		{
+			name:    "unknown field",
+			file:    "plugins:\n  ratelimit:\n    limt: 5\n",
+			plugins: []Plugin{&settingsPlugin{id: "ratelimit"}},
+			want:    `plugins.ratelimit: [3:5] unknown field "limt"`,
+		},
+		{
+			name:    "wrong type",
+			file:    "plugins:\n  ratelimit:\n    limit: 5\n    window: soon\n",
+			plugins: []Plugin{&settingsPlugin{id: "ratelimit"}},
+			want:    "plugins.ratelimit:",
+		},
+		{
+			name:    "unregistered plugin",
+			file:    "plugins:\n  ratelimt:\n    limit: 5\n",
+			plugins: []Plugin{&settingsPlugin{id: "ratelimit", settings: rateSettings{Limit: 1}}},
+			want:    "settings for unregistered plugins ratelimt (registered: ratelimit)",
+		},
+		{
+			name:    "plugin without settings",
+			file:    "plugins:\n  plain:\n    enabled: true\n",
+			plugins: []Plugin{plainPlugin{}},
+			want:    "plugin plain has no settings",
+		},
+		{
+			name: "unknown top-level key",
+			file: "plugin:\n  ratelimit:\n    limit: 5\n",
+			want: `line 1: unknown key "plugin" (supported: plugins)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var settings map[string]PluginSettings
+			var err error
+			if tt.file != "" {
+				settings, err = parsePluginSettings("beacon.yaml", []byte(tt.file))
+			}
+			if err == nil {
+				err = ConfigurePlugins(tt.plugins, settings)
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestWithConfigFile_MissingFile(t *testing.T) {
+	err := WithConfigFile(filepath.Join(t.TempDir(), "missing.yaml"))(defaultConfig())
+	if err == nil || !strings.Contains(err.Error(), "failed to read config file") {
+		t.Errorf("Expected a read error, got %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// minSecretLength is the shortest secret that does not trigger a warning
+const minSecretLength = 32
+
+// SecurityDescriber is implemented by components that can describe their
+// security settings, e.g. password hashers, session managers and plugins.
+// The description is included in the security posture summary.
+type SecurityDescriber interface {
+	DescribeSecurity() map[string]interface{}
+}
+
+// SecurityPosture summarizes the effective security configuration. It is
+// logged when Auth is constructed so misconfigurations are visible at boot.
+type SecurityPosture struct {
+	PasswordHashing   map[string]interface{}            `json:"passwordHashing,omitempty"`
+	Session           map[string]interface{}            `json:"session"`
+	Cookie            CookiePosture                     `json:"cookie"`
+	RateLimiting      bool                              `json:"rateLimiting"`
+	EmailVerification bool                              `json:"emailVerification"`
+	MinPasswordLength int                               `json:"minPasswordLength,omitempty"`
+	Plugins           map[string]map[string]interface{} `json:"plugins,omitempty"`
+	SecurityEvents    map[string]interface{}            `json:"securityEvents,omitempty"`
+	Warnings          []string                          `json:"warnings,omitempty"`
+}
+
+// CookiePosture describes the session cookie flags
+type CookiePosture struct {
+	Name     string `json:"name"`
+	Secure   bool   `json:"secure"`
+	HTTPOnly bool   `json:"httpOnly"`
+	SameSite string `json:"sameSite"`
+	Domain   string `json:"domain,omitempty"`
+	Path     string `json:"path,omitempty"`
+}
+
+// DescribeSecurity builds the security posture of a configuration. The
+// hasher and session manager are optional; when they implement
+// SecurityDescriber their descriptions are included.
+func DescribeSecurity(cfg *Config, hasher PasswordHasher, sessions SessionManager) SecurityPosture {
+	p := SecurityPosture{
+		Session:      map[string]interface{}{},
+		RateLimiting: cfg.RateLimit != nil && cfg.RateLimit.Enabled,
+	}
+
+	if d, ok := hasher.(SecurityDescriber); ok {
+		p.PasswordHashing = d.DescribeSecurity()
+	}
+
+	if s := cfg.Session; s != nil {
+		p.Cookie = CookiePosture{
+			Name:     s.CookieName,
+			Secure:   s.CookieSecure,
+			HTTPOnly: s.CookieHTTPOnly,
+			SameSite: s.CookieSameSite,
+			Domain:   s.CookieDomain,
+			Path:     s.CookiePath,
+		}
+		p.Session["expiresIn"] = s.ExpiresIn.String()
+		p.Session["absoluteExpiry"] = s.AbsoluteExpiry
+		if s.IdleTimeout > 0 {
+			p.Session["idleTimeout"] = s.IdleTimeout.String()
+		}
+		if s.MaxSessionsPerUser > 0 {
+			p.Session["maxSessionsPerUser"] = s.MaxSessionsPerUser
+		}
+		if s.KeepRecentSessions > 0 {
+			p.Session["keepRecentSessions"] = s.KeepRecentSessions
+		}
+		p.Session["binding"] = s.Binding.Enabled()
+	}
+	p.Session["keyRotation"] = cfg.SecretKeys != ""
+	if d, ok := sessions.(SecurityDescriber); ok {
+		for k, v := range d.DescribeSecurity() {
+			p.Session[k] = v
+		}
+	}
+
+	if ep := cfg.EmailPassword; ep != nil && ep.Enabled {
+		p.EmailVerification = ep.RequireVerification || ep.DoubleOptIn
+		p.MinPasswordLength = ep.MinPasswordLength
+	}
+
+	for _, plugin := range cfg.Plugins {
+		if d, ok := plugin.(SecurityDescriber); ok {
+			if p.Plugins == nil {
+				p.Plugins = make(map[string]map[string]interface{})
+			}
+			p.Plugins[plugin.ID()] = d.DescribeSecurity()
+		}
+	}
+
+	if d, ok := cfg.SecurityEvents.(SecurityDescriber); ok {
+		p.SecurityEvents = d.DescribeSecurity()
+	}
+
+	p.Warnings = securityWarnings(cfg, p)
+	return p
+}
+
+// securityWarnings lists settings that are likely misconfigurations
+func securityWarnings(cfg *Config, p SecurityPosture) []string {
+	var warnings []string
+
+	if cfg.SecretKeys == "" && len(cfg.Secret) < minSecretLength {
+		warnings = append(warnings, fmt.Sprintf("secret is shorter than %d bytes", minSecretLength))
+	}
+	if !p.Cookie.Secure {
+		warnings = append(warnings, "session cookie is sent over plain HTTP (CookieSecure is false)")
+	}
+	if !p.Cookie.HTTPOnly {
+		warnings = append(warnings, "session cookie is readable by JavaScript (CookieHTTPOnly is false)")
+	}
+	if strings.EqualFold(p.Cookie.SameSite, "none") && !p.Cookie.Secure {
+		warnings = append(warnings, "SameSite=None cookies are rejected by browsers unless Secure is set")
+	}
+	if !p.RateLimiting {
+		warnings = append(warnings, "rate limiting is disabled")
+	}
+	if p.MinPasswordLength > 0 && p.MinPasswordLength < 8 {
+		warnings = append(warnings, fmt.Sprintf("minimum password length is %d", p.MinPasswordLength))
+	}
+
+	return warnings
+}
+
+// LogFields flattens the posture into sorted key/value pairs for
+// structured loggers, e.g. "cookie.secure", true. Warnings are omitted;
+// see Log.
+func (p SecurityPosture) LogFields() []interface{} {
+	p.Warnings = nil
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil
+	}
+	// Keep numbers as written instead of converting them to float64
+	var tree map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&tree); err != nil {
+		return nil
+	}
+
+	flat := make(map[string]interface{})
+	flattenFields("", tree, flat)
+
+	keys := make([]string, 0, len(flat))
+	for k := range flat {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fields := make([]interface{}, 0, 2*len(keys))
+	for _, k := range keys {
+		fields = append(fields, k, flat[k])
+	}
+	return fields
+}
+
+func flattenFields(prefix string, value interface{}, out map[string]interface{}) {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		out[prefix] = value
+		return
+	}
+	for k, v := range m {
+		if prefix != "" {
+			k = prefix + "." + k
+		}
+		flattenFields(k, v, out)
+	}
+}
+
+// Log writes the posture as one Info entry and each warning as a Warn entry
+func (p SecurityPosture) Log(logger Logger) {
+	logger.Info("Security posture", p.LogFields()...)
+	for _, w := range p.Warnings {
+		logger.Warn("Security warning: " + w)
+	}
+}
+
+// SecurityPosture describes the effective security configuration of this
+// auth context
+func (a *AuthContext) SecurityPosture() SecurityPosture {
+	return DescribeSecurity(a.Config, a.PasswordHasher, a.SessionManager)
+}
@@ -0,0 +1,135 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type describedHasher struct{ mockPasswordHasher }
+
+func (h *describedHasher) DescribeSecurity() map[string]interface{} {
+	return map[string]interface{}{"algorithm": "argon2id", "memoryKiB": 65536}
+}
+
+type recordingLogger struct {
+	NoopLogger
+	infos    map[string][]interface{}
+	warnings []string
+}
+
+func (l *recordingLogger) Info(msg string, fields ...interface{}) {
+	if l.infos == nil {
+		l.infos = make(map[string][]interface{})
+	}
+	l.infos[msg] = fields
+}
+
+func (l *recordingLogger) Warn(msg string, fields ...interface{}) {
+	l.warnings = append(l.warnings, msg)
+}
+
+func TestDescribeSecurity(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Secret = strings.Repeat("s", 32)
+	cfg.RateLimit = &RateLimitConfig{Enabled: true}
+
+	p := DescribeSecurity(cfg, &describedHasher{}, nil)
+	if len(p.Warnings) != 0 {
+		t.Errorf("default config with strong secret and rate limiting has warnings: %v", p.Warnings)
+	}
+	if p.PasswordHashing["algorithm"] != "argon2id" {
+		t.Errorf("password hashing = %v, want hasher description", p.PasswordHashing)
+	}
+	if !p.Cookie.Secure || !p.Cookie.HTTPOnly {
+		t.Errorf("unexpected posture for defaults: %+v", p)
+	}
+
+	cfg.Secret = "short"
+	cfg.Session.CookieSecure = false
+	cfg.Session.CookieSameSite = "none"
+	cfg.RateLimit = nil
+
+	p = DescribeSecurity(cfg, &mockPasswordHasher{}, nil)
+	want := []string{"secret", "plain HTTP", "SameSite=None", "rate limiting"}
+	all := strings.Join(p.Warnings, "\n")
+	for _, w := range want {
+		if !strings.Contains(all, w) {
+			t.Errorf("expected a warning mentioning %q, got %v", w, p.Warnings)
+		}
+	}
+	if p.PasswordHashing != nil {
+		t.Errorf("hasher without SecurityDescriber described as %v", p.PasswordHashing)
+	}
+}
+
+func TestSecurityPostureLogFields(t *testing.T) {
+	p := DescribeSecurity(defaultConfig(), &describedHasher{}, nil)
+	fields := p.LogFields()
+
+	values := make(map[string]string)
+	for i := 0; i+1 < len(fields); i += 2 {
+		key, ok := fields[i].(string)
+		if !ok {
+			t.Fatalf("field key %v is not a string", fields[i])
+		}
+		if i > 0 && key < fields[i-2].(string) {
+			t.Errorf("fields not sorted: %s after %s", key, fields[i-2])
+		}
+		values[key] = fmt.Sprint(fields[i+1])
+	}
+
+	tests := map[string]string{
+		"cookie.secure":             "true",
+		"passwordHashing.memoryKiB": "65536",
+		"session.expiresIn":         "168h0m0s",
+	}
+	for key, want := range tests {
+		if got := values[key]; got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	if _, ok := values["warnings"]; ok {
+		t.Error("warnings should be logged separately, not as a field")
+	}
+}
+
+func TestNewLogsSecurityPosture(t *testing.T) {
+	logger := &recordingLogger{}
+	_, err := New(
+		WithSecret("short"),
+		WithBaseURL("http://localhost:3000"),
+		WithAdapter(&mockAdapter{}),
+		WithLogger(logger),
+		withMockFactories(),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if _, ok := logger.infos["Security posture"]; !ok {
+		t.Error("expected security posture to be logged at startup")
+	}
+	if len(logger.warnings) == 0 {
+		t.Error("expected a warning for the short secret")
+	}
+
+	logger = &recordingLogger{}
+	_, err = New(
+		WithSecret("short"),
+		WithBaseURL("http://localhost:3000"),
+		WithAdapter(&mockAdapter{}),
+		WithLogger(logger),
+		withMockFactories(),
+		func(c *Config) error {
+			c.Advanced.DisableSecurityBanner = true
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, ok := logger.infos["Security posture"]; ok {
+		t.Error("expected no security posture when the banner is disabled")
+	}
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// TrustedProxies are the reverse proxies whose X-Forwarded-For and
+// X-Real-IP headers are believed. Without any, the client IP is the peer
+// address of the connection and forwarding headers are ignored.
+type TrustedProxies []netip.Prefix
+
+// ParseTrustedProxies parses CIDR ranges and single IP addresses
+func ParseTrustedProxies(proxies []string) (TrustedProxies, error) {
+	trusted := make(TrustedProxies, 0, len(proxies))
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if prefix, err := netip.ParsePrefix(proxy); err == nil {
+			trusted = append(trusted, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+		}
+		addr = addr.Unmap()
+		trusted = append(trusted, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return trusted, nil
+}
+
+// Contains reports whether the address is a trusted proxy
+func (p TrustedProxies) Contains(address string) bool {
+	addr, err := netip.ParseAddr(address)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range p {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP resolves the client IP from the peer address of a connection
+// and its forwarding headers. The peer is the client unless it is a
+// trusted proxy; then X-Forwarded-For is walked from the right and the
+// first hop that is not a trusted proxy is the client. Hops further left
+// were added by the client itself and are never believed.
+func (p TrustedProxies) ClientIP(remoteAddr string, forwardedFor []string, realIP string) string {
+	ip := strings.TrimSpace(remoteAddr)
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	if !p.Contains(ip) {
+		return ip
+	}
+
+	var hops []string
+	for _, header := range forwardedFor {
+		for _, hop := range strings.Split(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	if len(hops) == 0 {
+		if _, err := netip.ParseAddr(strings.TrimSpace(realIP)); err == nil {
+			return strings.TrimSpace(realIP)
+		}
+		return ip
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		if _, err := netip.ParseAddr(hops[i]); err != nil {
+			// A malformed hop cannot be traced any further
+			return ip
+		}
+		ip = hops[i]
+		if !p.Contains(ip) {
+			return ip
+		}
+	}
+	return ip
+}
+
+// ClientInfo extracts client information from an HTTP request
+func (p TrustedProxies) ClientInfo(r *http.Request) ClientInfo {
+	return ClientInfo{
+		IPAddress: p.ClientIP(r.RemoteAddr, r.Header.Values("X-Forwarded-For"), r.Header.Get("X-Real-IP")),
+		UserAgent: r.UserAgent(),
+	}
+}
+
+// ContextWithTrustedProxies adds the trusted proxies to the context, for
+// ClientInfoFromRequest
+func ContextWithTrustedProxies(ctx context.Context, proxies TrustedProxies) context.Context {
+	return context.WithValue(ctx, trustedProxiesContextKey, proxies)
+}
+
+// GetTrustedProxies retrieves the trusted proxies from the context
+func GetTrustedProxies(ctx context.Context) TrustedProxies {
+	proxies, _ := ctx.Value(trustedProxiesContextKey).(TrustedProxies)
+	return proxies
+}
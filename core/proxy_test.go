@@ -0,0 +1,82 @@
+package core
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies() error = %v", err)
+	}
+	for _, ip := range []string{"10.1.2.3", "192.0.2.1", "::ffff:10.0.0.1", "2001:db8::1"} {
+		if !proxies.Contains(ip) {
+			t.Errorf("Expected %s to be trusted", ip)
+		}
+	}
+	for _, ip := range []string{"192.0.2.2", "203.0.113.7", "not-an-ip", ""} {
+		if proxies.Contains(ip) {
+			t.Errorf("Expected %s not to be trusted", ip)
+		}
+	}
+
+	if _, err := ParseTrustedProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("Expected an invalid CIDR to be rejected")
+	}
+	if _, err := ParseTrustedProxies([]string{"proxy.internal"}); err == nil {
+		t.Error("Expected a host name to be rejected")
+	}
+}
+
+func TestTrustedProxiesClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies() error = %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		proxies      TrustedProxies
+		remoteAddr   string
+		forwardedFor []string
+		realIP       string
+		want         string
+	}{
+		{"no proxies ignores headers", nil, "203.0.113.7:1234", []string{"198.51.100.1"}, "198.51.100.2", "203.0.113.7"},
+		{"untrusted peer ignores headers", proxies, "203.0.113.7:1234", []string{"198.51.100.1"}, "198.51.100.2", "203.0.113.7"},
+		{"trusted peer", proxies, "10.0.0.1:1234", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"right-most untrusted hop", proxies, "10.0.0.1:1234", []string{"6.6.6.6, 198.51.100.1, 10.0.0.2"}, "", "198.51.100.1"},
+		{"hops across headers", proxies, "10.0.0.1:1234", []string{"6.6.6.6", "198.51.100.1, 10.0.0.2"}, "", "198.51.100.1"},
+		{"malformed hop stops the walk", proxies, "10.0.0.1:1234", []string{"198.51.100.1, garbage, 10.0.0.2"}, "", "10.0.0.2"},
+		{"all hops trusted", proxies, "10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, "", "10.0.0.3"},
+		{"X-Real-IP without X-Forwarded-For", proxies, "10.0.0.1:1234", nil, "198.51.100.2", "198.51.100.2"},
+		{"invalid X-Real-IP", proxies, "10.0.0.1:1234", nil, "garbage", "10.0.0.1"},
+		{"peer without port", nil, "203.0.113.7", nil, "", "203.0.113.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.proxies.ClientIP(tt.remoteAddr, tt.forwardedFor, tt.realIP); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientInfoFromRequest(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	req.Header.Set("User-Agent", "test-agent")
+
+	if info := ClientInfoFromRequest(req); info.IPAddress != "10.0.0.1" || info.UserAgent != "test-agent" {
+		t.Errorf("Expected the peer without trusted proxies, got %+v", info)
+	}
+
+	proxies, _ := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	req = req.WithContext(ContextWithTrustedProxies(req.Context(), proxies))
+	if info := ClientInfoFromRequest(req); info.IPAddress != "198.51.100.1" {
+		t.Errorf("Expected the forwarded client behind a trusted proxy, got %+v", info)
+	}
+}
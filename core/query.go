@@ -0,0 +1,79 @@
+package core
+
+// QueryBuilder builds a Query with chained calls:
+//
+//	query := core.NewQuery(core.ModelSessions).
+//		Where("user_id", core.OpEqual, userID).
+//		Where("expires_at", core.OpGreaterThan, time.Now()).
+//		OrderBy("created_at", true).
+//		Limit(10).
+//		Build()
+//
+// Conditions added with Where are combined with AND, and OrWhere combines a
+// condition with the one before it using OR, as WhereClause.Or does.
+type QueryBuilder struct {
+	query Query
+}
+
+// NewQuery starts a query on model
+func NewQuery(model string) *QueryBuilder {
+	return &QueryBuilder{query: Query{Model: model}}
+}
+
+// Select limits the fields the query returns
+func (b *QueryBuilder) Select(fields ...string) *QueryBuilder {
+	b.query.Select = append(b.query.Select, fields...)
+	return b
+}
+
+// Where adds a condition combined with the previous ones using AND
+func (b *QueryBuilder) Where(field string, op Operator, value interface{}) *QueryBuilder {
+	b.query.Where = append(b.query.Where, WhereClause{Field: field, Operator: op, Value: value})
+	return b
+}
+
+// OrWhere adds a condition combined with the previous one using OR
+func (b *QueryBuilder) OrWhere(field string, op Operator, value interface{}) *QueryBuilder {
+	b.query.Where = append(b.query.Where, WhereClause{Field: field, Operator: op, Value: value, Or: true})
+	return b
+}
+
+// Join joins model on left = right
+func (b *QueryBuilder) Join(joinType JoinType, model, left, right string) *QueryBuilder {
+	b.query.Joins = append(b.query.Joins, Join{
+		Model: model,
+		Type:  joinType,
+		On:    JoinCondition{Left: left, Right: right},
+	})
+	return b
+}
+
+// OrderBy sorts the results by field, in descending order when desc is true.
+// Later calls break ties left by earlier ones.
+func (b *QueryBuilder) OrderBy(field string, desc bool) *QueryBuilder {
+	b.query.OrderBy = append(b.query.OrderBy, OrderBy{Field: field, Desc: desc})
+	return b
+}
+
+// Limit returns at most n records (0 = no limit)
+func (b *QueryBuilder) Limit(n int) *QueryBuilder {
+	b.query.Limit = n
+	return b
+}
+
+// Offset skips the first n records
+func (b *QueryBuilder) Offset(n int) *QueryBuilder {
+	b.query.Offset = n
+	return b
+}
+
+// Build returns the query. The builder can keep being used; later calls do
+// not change queries already built.
+func (b *QueryBuilder) Build() *Query {
+	query := b.query
+	query.Select = append([]string(nil), b.query.Select...)
+	query.Where = append([]WhereClause(nil), b.query.Where...)
+	query.Joins = append([]Join(nil), b.query.Joins...)
+	query.OrderBy = append([]OrderBy(nil), b.query.OrderBy...)
+	return &query
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQueryBuilder(t *testing.T) {
+	builder := NewQuery(ModelSessions).
+		Select("id", "token").
+		Where("user_id", OpEqual, "u1").
+		OrWhere("user_id", OpEqual, "u2").
+		Join(InnerJoin, ModelUsers, "sessions.user_id", "users.id").
+		OrderBy("created_at", true).
+		OrderBy("id", false).
+		Limit(10).
+		Offset(20)
+
+	want := &Query{
+		Model:  ModelSessions,
+		Select: []string{"id", "token"},
+		Where: []WhereClause{
+			{Field: "user_id", Operator: OpEqual, Value: "u1"},
+			{Field: "user_id", Operator: OpEqual, Value: "u2", Or: true},
+		},
+		Joins: []Join{
+			{Model: ModelUsers, Type: InnerJoin, On: JoinCondition{Left: "sessions.user_id", Right: "users.id"}},
+		},
+		OrderBy: []OrderBy{{Field: "created_at", Desc: true}, {Field: "id"}},
+		Limit:   10,
+		Offset:  20,
+	}
+	query := builder.Build()
+	if !reflect.DeepEqual(query, want) {
+		t.Errorf("Build() =\n%+v\nwant\n%+v", query, want)
+	}
+
+	// Queries already built do not change when the builder is reused
+	builder.Where("token", OpEqual, "t")
+	if len(query.Where) != 2 {
+		t.Errorf("Build() query changed after reuse: %+v", query.Where)
+	}
+	if got := builder.Build(); len(got.Where) != 3 {
+		t.Errorf("Build() after reuse has %d conditions, want 3", len(got.Where))
+	}
+}
+
+func TestQueryBuilderEmpty(t *testing.T) {
+	if got := NewQuery(ModelUsers).Build(); !reflect.DeepEqual(got, &Query{Model: ModelUsers}) {
+		t.Errorf("Build() = %+v, want only the model", got)
+	}
+}
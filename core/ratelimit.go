@@ -0,0 +1,128 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryRateLimitStorage is an in-process fixed-window RateLimitStorage.
+// Counters are not shared between instances; use a shared store when
+// running several replicas.
+type MemoryRateLimitStorage struct {
+	mu      sync.Mutex
+	windows map[string]*rateWindow
+	calls   int
+}
+
+type rateWindow struct {
+	count   int
+	resetAt time.Time
+}
+
+// NewMemoryRateLimitStorage creates an in-memory rate limit storage
+func NewMemoryRateLimitStorage() *MemoryRateLimitStorage {
+	return &MemoryRateLimitStorage{windows: make(map[string]*rateWindow)}
+}
+
+// Allow counts a request for key and reports whether it is within limit
+// for the current window
+func (s *MemoryRateLimitStorage) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls++
+	if s.calls%1000 == 0 {
+		s.sweep(now)
+	}
+
+	w, ok := s.windows[key]
+	if !ok || !now.Before(w.resetAt) {
+		w = &rateWindow{resetAt: now.Add(window)}
+		s.windows[key] = w
+	}
+	w.count++
+	return w.count <= limit, nil
+}
+
+// Reset clears the counter for key
+func (s *MemoryRateLimitStorage) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.windows, key)
+	return nil
+}
+
+// sweep drops expired windows
+func (s *MemoryRateLimitStorage) sweep(now time.Time) {
+	for key, w := range s.windows {
+		if !now.Before(w.resetAt) {
+			delete(s.windows, key)
+		}
+	}
+}
+
+// matches reports whether the rule applies to a request for path (relative
+// to the base path) and method. A trailing "*" matches any suffix; an empty
+// path or "*" matches every route.
+func (r RateLimitRule) matches(path, method string) bool {
+	if len(r.Methods) > 0 {
+		allowed := false
+		for _, m := range r.Methods {
+			if strings.EqualFold(m, method) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+
+	if prefix, ok := strings.CutSuffix(r.Path, "*"); ok {
+		return strings.HasPrefix(path, prefix)
+	}
+	return r.Path == "" || r.Path == path
+}
+
+// rateLimitHandler enforces the rules on requests to next. Every matching
+// rule is counted per client IP address; a request over any limit receives
+// 429 Too Many Requests. Storage errors let the request through.
+func rateLimitHandler(cfg *RateLimitConfig, basePath string, logger Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, basePath)
+		client := rateLimitClient(r)
+
+		for _, rule := range cfg.Rules {
+			if rule.Limit <= 0 || !rule.matches(path, r.Method) {
+				continue
+			}
+
+			key := "ratelimit:" + rule.Path + ":" + client
+			allowed, err := cfg.Storage.Allow(r.Context(), key, rule.Limit, rule.Window)
+			if err != nil {
+				if logger != nil {
+					logger.Warn("Rate limit check failed", "path", path, "error", err)
+				}
+				continue
+			}
+			if !allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(rule.Window.Round(time.Second).Seconds())))
+				WriteStatusError(w, r, http.StatusTooManyRequests, "Too many requests")
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitClient returns the client IP address a request is counted against
+func rateLimitClient(r *http.Request) string {
+	return ClientInfoFromRequest(r).IPAddress
+}
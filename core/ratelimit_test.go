@@ -0,0 +1,95 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimitStorage(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryRateLimitStorage()
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := s.Allow(ctx, "k", 2, time.Minute); !ok {
+			t.Fatalf("request %d: expected allowed", i+1)
+		}
+	}
+	if ok, _ := s.Allow(ctx, "k", 2, time.Minute); ok {
+		t.Fatal("expected third request to be limited")
+	}
+	if ok, _ := s.Allow(ctx, "other", 2, time.Minute); !ok {
+		t.Error("expected keys to be counted separately")
+	}
+
+	_ = s.Reset(ctx, "k")
+	if ok, _ := s.Allow(ctx, "k", 2, time.Minute); !ok {
+		t.Error("expected Reset to clear the counter")
+	}
+
+	if ok, _ := s.Allow(ctx, "short", 1, time.Millisecond); !ok {
+		t.Fatal("expected first request to be allowed")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if ok, _ := s.Allow(ctx, "short", 1, time.Millisecond); !ok {
+		t.Error("expected a new window after expiry")
+	}
+}
+
+func TestRateLimitRule_Matches(t *testing.T) {
+	tests := []struct {
+		rule   RateLimitRule
+		path   string
+		method string
+		want   bool
+	}{
+		{RateLimitRule{Path: "/login"}, "/login", "POST", true},
+		{RateLimitRule{Path: "/login"}, "/logout", "POST", false},
+		{RateLimitRule{Path: "/login", Methods: []string{"POST"}}, "/login", "GET", false},
+		{RateLimitRule{Path: "/login", Methods: []string{"post"}}, "/login", "POST", true},
+		{RateLimitRule{Path: "/oauth/*"}, "/oauth/google/callback", "GET", true},
+		{RateLimitRule{Path: "*"}, "/anything", "GET", true},
+		{RateLimitRule{}, "/anything", "GET", true},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.matches(tt.path, tt.method); got != tt.want {
+			t.Errorf("%+v.matches(%q, %q) = %v, want %v", tt.rule, tt.path, tt.method, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	cfg := &RateLimitConfig{
+		Enabled: true,
+		Storage: NewMemoryRateLimitStorage(),
+		Rules:   []RateLimitRule{{Path: "/login", Methods: []string{"POST"}, Limit: 1, Window: time.Minute}},
+	}
+	h := rateLimitHandler(cfg, "/auth", nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	do := func(method, path, addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = addr
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do("POST", "/auth/login", "10.0.0.1:1234"); rec.Code != http.StatusOK {
+		t.Fatalf("first request: status %d", rec.Code)
+	}
+	rec := do("POST", "/auth/login", "10.0.0.1:5678")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request: status %d, want 429", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "60" {
+		t.Errorf("Retry-After = %q, want 60", rec.Header().Get("Retry-After"))
+	}
+	if rec := do("POST", "/auth/login", "10.0.0.2:1234"); rec.Code != http.StatusOK {
+		t.Errorf("other client: status %d", rec.Code)
+	}
+	if rec := do("GET", "/auth/session", "10.0.0.1:1234"); rec.Code != http.StatusOK {
+		t.Errorf("unmatched route: status %d", rec.Code)
+	}
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// MaxRedirectLength bounds the length of redirect targets taken from
+// requests
+const MaxRedirectLength = 2048
+
+// SafeRedirect returns target when it is safe to redirect to after
+// authentication: a local path, or an absolute http(s) URL on the origin of
+// baseURL or one of origins. Anything else, including protocol-relative
+// URLs, returns "".
+func SafeRedirect(target, baseURL string, origins []string) string {
+	if target == "" || len(target) > MaxRedirectLength || strings.ContainsAny(target, "\\\r\n\t") {
+		return ""
+	}
+	if strings.HasPrefix(target, "/") {
+		if strings.HasPrefix(target, "//") {
+			return ""
+		}
+		return target
+	}
+
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return ""
+	}
+	origin := u.Scheme + "://" + strings.ToLower(u.Host)
+	if baseURL != "" && origin == Origin(baseURL) {
+		return target
+	}
+	for _, allowed := range origins {
+		if origin == Origin(allowed) {
+			return target
+		}
+	}
+	return ""
+}
+
+// Origin returns the scheme and host of rawURL, lowercased, or "" when it
+// is not an absolute URL
+func Origin(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	return strings.ToLower(u.Scheme) + "://" + strings.ToLower(u.Host)
+}
+
+// IsFormPost reports whether r submits an HTML form rather than JSON
+func IsFormPost(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/x-www-form-urlencoded" || mediaType == "multipart/form-data"
+}
+
+// FormOriginAllowed reports whether a form post comes from a page of the
+// app: its Origin header, or its Referer when there is none, must be on
+// the request's host or one of origins. Forms can be posted cross-site
+// without a preflight, so form posts without either header are refused.
+func FormOriginAllowed(r *http.Request, origins []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == "null" {
+		origin = Origin(r.Header.Get("Referer"))
+	}
+	if origin == "" || origin == "null" {
+		return false
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	origin = Origin(origin)
+	for _, allowed := range origins {
+		if origin == Origin(allowed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSafeRedirect(t *testing.T) {
+	origins := []string{"https://app.example.com", "http://localhost:3000/"}
+	tests := map[string]string{
+		"/dashboard?tab=1":                           "/dashboard?tab=1",
+		"https://auth.example.com/account":           "https://auth.example.com/account",
+		"https://APP.example.com/welcome":            "https://APP.example.com/welcome",
+		"http://localhost:3000/done":                 "http://localhost:3000/done",
+		"":                                           "",
+		"//evil.example":                             "",
+		"/\\evil.example":                            "",
+		"https://evil.example/":                      "",
+		"https://app.example.com.evil.example":       "",
+		"http://app.example.com/":                    "",
+		"https://user@app.example.com/":              "",
+		"javascript:alert(1)":                        "",
+		"dashboard":                                  "",
+		"/" + strings.Repeat("a", MaxRedirectLength): "",
+	}
+	for target, want := range tests {
+		if got := SafeRedirect(target, "https://auth.example.com", origins); got != want {
+			t.Errorf("SafeRedirect(%q) = %q, want %q", target, got, want)
+		}
+	}
+}
+
+func TestFormOriginAllowed(t *testing.T) {
+	origins := []string{"https://app.example.com"}
+	tests := []struct {
+		name    string
+		headers map[string]string
+		allowed bool
+	}{
+		{"same host", map[string]string{"Origin": "https://auth.example.com"}, true},
+		{"allowed origin", map[string]string{"Origin": "https://app.example.com"}, true},
+		{"referer fallback", map[string]string{"Referer": "https://auth.example.com/signin"}, true},
+		{"other site", map[string]string{"Origin": "https://evil.example"}, false},
+		{"opaque origin", map[string]string{"Origin": "null"}, false},
+		{"no headers", nil, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "https://auth.example.com/auth/signin", nil)
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+		if got := FormOriginAllowed(r, origins); got != tt.allowed {
+			t.Errorf("%s: FormOriginAllowed() = %v, want %v", tt.name, got, tt.allowed)
+		}
+	}
+}
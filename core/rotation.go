@@ -0,0 +1,102 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SessionRotator is implemented by session managers that can replace a
+// session token with a fresh one (see session.Manager.Rotate)
+type SessionRotator interface {
+	Rotate(ctx context.Context, token string) (*Session, *User, string, error)
+}
+
+// ErrRotationUnsupported is returned when the session manager does not
+// implement SessionRotator
+var ErrRotationUnsupported = errors.New("session manager does not support token rotation")
+
+// SessionCookie builds the session cookie for token with the configured
+// attributes
+func (s *SessionConfig) SessionCookie(token string, expiresAt time.Time) *http.Cookie {
+	sameSite := http.SameSiteLaxMode
+	switch strings.ToLower(s.CookieSameSite) {
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	}
+
+	return &http.Cookie{
+		Name:     s.CookieName,
+		Value:    token,
+		Path:     s.CookiePath,
+		Domain:   s.CookieDomain,
+		Expires:  expiresAt,
+		Secure:   s.CookieSecure,
+		HttpOnly: s.CookieHTTPOnly,
+		SameSite: sameSite,
+	}
+}
+
+// RotateSession rotates the session presented by the request and writes
+// the new session cookie. It returns ErrSessionNotFound when the request
+// has no valid session.
+func (c *AuthContext) RotateSession(w http.ResponseWriter, r *http.Request) (*Session, error) {
+	rotator, ok := c.SessionManager.(SessionRotator)
+	if !ok {
+		return nil, ErrRotationUnsupported
+	}
+
+	token, err := ReadChunkedCookie(r, c.Config.Session.CookieName)
+	if err != nil {
+		return nil, ErrSessionNotFound
+	}
+
+	session, _, newToken, err := rotator.Rotate(WithClientInfo(r.Context(), ClientInfoFromRequest(r)), token)
+	if err != nil {
+		return nil, err
+	}
+
+	SetChunkedCookie(w, r, c.Config.Session.SessionCookie(newToken, session.ExpiresAt), c.Config.Session.CookieChunkSize)
+	return session, nil
+}
+
+// RevokeRequestSession revokes the session the request arrived with, if
+// any. Sign-in handlers call it before issuing a new session so a token
+// planted before authentication (session fixation) does not stay valid.
+func (c *AuthContext) RevokeRequestSession(r *http.Request) {
+	token, err := ReadChunkedCookie(r, c.Config.Session.CookieName)
+	if err != nil {
+		return
+	}
+	if err := c.SessionManager.Delete(r.Context(), token); err != nil && c.Logger != nil {
+		c.Logger.Warn("Failed to revoke previous session", "error", err)
+	}
+}
+
+// UpdateUserRole changes a user's role. When the request carries a
+// session of that user, the session is rotated so the elevated privileges
+// are bound to a fresh token.
+func (c *AuthContext) UpdateUserRole(w http.ResponseWriter, r *http.Request, userID, role string) (*User, error) {
+	user, err := c.DataManager.UpdateUser(r.Context(), userID, map[string]interface{}{"role": role})
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := ReadChunkedCookie(r, c.Config.Session.CookieName)
+	if err != nil {
+		return user, nil
+	}
+	session, _, err := c.SessionManager.Get(WithClientInfo(r.Context(), ClientInfoFromRequest(r)), token)
+	if err != nil || session == nil || session.UserID != userID {
+		return user, nil
+	}
+
+	if _, err := c.RotateSession(w, r); err != nil && !errors.Is(err, ErrRotationUnsupported) {
+		return user, err
+	}
+	return user, nil
+}
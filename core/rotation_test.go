@@ -0,0 +1,87 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// rotatingSessionManager is a SessionManager that tracks sessions by token
+type rotatingSessionManager struct {
+	mockSessionManager
+	sessions map[string]*Session
+}
+
+func (m *rotatingSessionManager) Get(ctx context.Context, token string) (*Session, *User, error) {
+	if s, ok := m.sessions[token]; ok {
+		return s, &User{ID: s.UserID}, nil
+	}
+	return nil, nil, ErrSessionNotFound
+}
+
+func (m *rotatingSessionManager) Delete(ctx context.Context, token string) error {
+	delete(m.sessions, token)
+	return nil
+}
+
+func (m *rotatingSessionManager) Rotate(ctx context.Context, token string) (*Session, *User, string, error) {
+	s, ok := m.sessions[token]
+	if !ok {
+		return nil, nil, "", ErrSessionNotFound
+	}
+	delete(m.sessions, token)
+	rotated := *s
+	rotated.Token = token + "-rotated"
+	m.sessions[rotated.Token] = &rotated
+	return &rotated, &User{ID: s.UserID}, rotated.Token, nil
+}
+
+func TestAuthContext_UpdateUserRole(t *testing.T) {
+	sessions := &rotatingSessionManager{sessions: map[string]*Session{
+		"tok": {UserID: "user1", Token: "tok", ExpiresAt: time.Now().Add(time.Hour)},
+	}}
+	cfg := defaultConfig()
+	ctx := &AuthContext{Config: cfg, SessionManager: sessions, DataManager: &mockDataManager{}}
+
+	// Another user's session is left alone
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.AddCookie(&http.Cookie{Name: cfg.Session.CookieName, Value: "tok"})
+	w := httptest.NewRecorder()
+	if _, err := ctx.UpdateUserRole(w, req, "user2", "admin"); err != nil {
+		t.Fatalf("UpdateUserRole() error = %v", err)
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Error("Expected no cookie when the session belongs to another user")
+	}
+
+	// The user's own session is rotated and the new cookie is set
+	w = httptest.NewRecorder()
+	if _, err := ctx.UpdateUserRole(w, req, "user1", "admin"); err != nil {
+		t.Fatalf("UpdateUserRole() error = %v", err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != "tok-rotated" || !cookies[0].HttpOnly {
+		t.Fatalf("Expected rotated session cookie, got %v", cookies)
+	}
+	if _, ok := sessions.sessions["tok"]; ok {
+		t.Error("Expected old token to be revoked")
+	}
+
+	// Sign-in revokes the session the request arrived with
+	req = httptest.NewRequest(http.MethodPost, "/", nil)
+	req.AddCookie(&http.Cookie{Name: cfg.Session.CookieName, Value: "tok-rotated"})
+	ctx.RevokeRequestSession(req)
+	if len(sessions.sessions) != 0 {
+		t.Error("Expected request session to be revoked")
+	}
+}
+
+func TestAuthContext_RotateSessionUnsupported(t *testing.T) {
+	ctx := &AuthContext{Config: defaultConfig(), SessionManager: &mockSessionManager{}}
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	if _, err := ctx.RotateSession(httptest.NewRecorder(), req); err != ErrRotationUnsupported {
+		t.Errorf("Expected ErrRotationUnsupported, got %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package core
+
+// SchemaProvider is implemented by plugins that store data in tables of
+// their own. beacon generate creates the tables for every registered
+// plugin that implements it.
+type SchemaProvider interface {
+	// Schema returns the plugin's tables, in creation order
+	Schema() []TableDef
+}
+
+// ColumnType is a portable column type, mapped to a type of each database
+type ColumnType string
+
+// Column types
+const (
+	// ColumnID is the primary key, typed by the configured ID type
+	ColumnID ColumnType = "id"
+
+	// ColumnForeignID holds the ID of a row of another table
+	ColumnForeignID ColumnType = "foreign_id"
+
+	// ColumnString is text of at most Size characters (default 255)
+	ColumnString ColumnType = "string"
+
+	// ColumnText is text of any length
+	ColumnText ColumnType = "text"
+
+	ColumnBool      ColumnType = "bool"
+	ColumnBigInt    ColumnType = "bigint"
+	ColumnTimestamp ColumnType = "timestamp"
+)
+
+// DefaultNow is a column default of the current time
+const DefaultNow = "now"
+
+// TableDef describes a table
+type TableDef struct {
+	// Model is the default table name, renamed through TableNames
+	Model string
+
+	Columns     []ColumnDef
+	Unique      []UniqueDef
+	ForeignKeys []ForeignKeyDef
+}
+
+// ColumnDef describes a column
+type ColumnDef struct {
+	Name    string
+	Type    ColumnType
+	Size    int // ColumnString only
+	NotNull bool
+	Unique  bool
+
+	// Default is a number, true, false or DefaultNow
+	Default string
+
+	// AutoUpdate sets the column to the current time on every update,
+	// where the database supports it (MySQL)
+	AutoUpdate bool
+}
+
+// UniqueDef makes a set of columns unique
+type UniqueDef struct {
+	Name    string // constraint name, where the database names constraints
+	Columns []string
+}
+
+// ForeignKeyDef references another table's id. Rows are deleted with the
+// row they reference.
+type ForeignKeyDef struct {
+	Name   string // constraint name, where the database names constraints
+	Column string
+	Model  string // the referenced table's default name, e.g. ModelUsers
+}
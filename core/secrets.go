@@ -0,0 +1,193 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultSecretRefreshInterval is how often Secrets fetches secrets again
+// when SecretsConfig.RefreshInterval is not set
+const DefaultSecretRefreshInterval = 5 * time.Minute
+
+// secretFetchTimeout bounds each fetch from the secret manager
+const secretFetchTimeout = 10 * time.Second
+
+// ErrSecretNotFound is returned by a SecretProvider that has no secret
+// with the requested name
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretProvider fetches secrets from a secret manager. Package secrets
+// has providers for HashiCorp Vault, AWS Secrets Manager, Google Secret
+// Manager and environment variables.
+type SecretProvider interface {
+	// GetSecret returns the current value of the secret name, or an
+	// error wrapping ErrSecretNotFound
+	GetSecret(ctx context.Context, name string) (string, error)
+}
+
+// Secrets caches the secrets of a SecretProvider and fetches them again
+// periodically, so values rotated in the secret manager reach the
+// application without a restart. A failed refresh keeps the last value.
+// Plugins and mailers read OAuth client secrets, SMTP credentials and
+// other keys from AuthContext.Secrets.
+type Secrets struct {
+	provider SecretProvider
+	interval time.Duration
+	logger   Logger
+
+	mu       sync.Mutex
+	values   map[string]string
+	watchers map[string][]func(value string)
+
+	stop     chan struct{}
+	done     chan struct{} // Set by Start
+	stopOnce sync.Once
+}
+
+// NewSecrets creates a cache of provider's secrets, refreshed every
+// interval (0 = DefaultSecretRefreshInterval, negative disables). Call
+// Start to begin refreshing and Close to stop.
+func NewSecrets(provider SecretProvider, interval time.Duration, logger Logger) *Secrets {
+	if interval == 0 {
+		interval = DefaultSecretRefreshInterval
+	}
+	return &Secrets{
+		provider: provider,
+		interval: interval,
+		logger:   logger,
+		values:   make(map[string]string),
+		watchers: make(map[string][]func(string)),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Get returns the secret name, fetching it on first use. Later calls
+// return the cached value, kept current by the refresh.
+func (s *Secrets) Get(ctx context.Context, name string) (string, error) {
+	s.mu.Lock()
+	value, ok := s.values[name]
+	s.mu.Unlock()
+	if ok {
+		return value, nil
+	}
+
+	value, err := s.fetch(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cached, ok := s.values[name]; ok {
+		return cached, nil // Fetched concurrently
+	}
+	s.values[name] = value
+	return value, nil
+}
+
+// Watch returns the secret name like Get and calls onChange with each
+// new value found by a refresh
+func (s *Secrets) Watch(ctx context.Context, name string, onChange func(value string)) (string, error) {
+	value, err := s.Get(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	s.watchers[name] = append(s.watchers[name], onChange)
+	s.mu.Unlock()
+	return value, nil
+}
+
+// Refresh fetches every cached secret again and notifies the watchers of
+// those that changed. It returns the errors of failed fetches, whose
+// secrets keep their last value.
+func (s *Secrets) Refresh(ctx context.Context) error {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.values))
+	for name := range s.values {
+		names = append(names, name)
+	}
+	s.mu.Unlock()
+
+	var errs []error
+	for _, name := range names {
+		value, err := s.fetch(ctx, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		s.mu.Lock()
+		changed := s.values[name] != value
+		s.values[name] = value
+		watchers := append([]func(string){}, s.watchers[name]...)
+		s.mu.Unlock()
+
+		if changed {
+			for _, onChange := range watchers {
+				onChange(value)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Secrets) fetch(ctx context.Context, name string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, secretFetchTimeout)
+	defer cancel()
+	value, err := s.provider.GetSecret(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch secret %q: %w", name, err)
+	}
+	return value, nil
+}
+
+// Start refreshes the secrets in the background until Close
+func (s *Secrets) Start() {
+	if s.interval < 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done != nil {
+		return
+	}
+	s.done = make(chan struct{})
+	go func(done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Refresh(context.Background()); err != nil && s.logger != nil {
+					s.logger.Warn("Secret refresh failed; keeping the last values", "error", err)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}(s.done)
+}
+
+// Close stops the refresh started by Start
+func (s *Secrets) Close() error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	s.mu.Lock()
+	done := s.done
+	s.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+	return nil
+}
+
+// SessionKeySetter is implemented by session managers whose signing keys
+// can be replaced at runtime, when the session keys secret rotates
+type SessionKeySetter interface {
+	// SetSessionKeys replaces the signing keys with a key ring in the
+	// Config.SecretKeys format
+	SetSessionKeys(keys string) error
+}
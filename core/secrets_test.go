@@ -0,0 +1,145 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// mapSecrets serves secrets from a map and counts fetches
+type mapSecrets struct {
+	mu      sync.Mutex
+	values  map[string]string
+	fetches int
+	err     error
+}
+
+func (m *mapSecrets) GetSecret(ctx context.Context, name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fetches++
+	if m.err != nil {
+		return "", m.err
+	}
+	value, ok := m.values[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+	return value, nil
+}
+
+func (m *mapSecrets) set(name, value string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[name] = value
+}
+
+func TestSecrets_CacheAndRefresh(t *testing.T) {
+	ctx := context.Background()
+	provider := &mapSecrets{values: map[string]string{"smtp": "v1"}}
+	secrets := NewSecrets(provider, -1, nil)
+
+	var changes []string
+	if value, err := secrets.Watch(ctx, "smtp", func(v string) { changes = append(changes, v) }); err != nil || value != "v1" {
+		t.Fatalf("Watch() = %q, %v", value, err)
+	}
+	if value, _ := secrets.Get(ctx, "smtp"); value != "v1" || provider.fetches != 1 {
+		t.Errorf("Get() = %q after %d fetches, want the cached v1", value, provider.fetches)
+	}
+	if _, err := secrets.Get(ctx, "missing"); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("Get(missing) error = %v, want ErrSecretNotFound", err)
+	}
+
+	// Unchanged values notify nobody
+	if err := secrets.Refresh(ctx); err != nil || len(changes) != 0 {
+		t.Fatalf("Refresh() = %v, changes = %q", err, changes)
+	}
+	provider.set("smtp", "v2")
+	if err := secrets.Refresh(ctx); err != nil || len(changes) != 1 || changes[0] != "v2" {
+		t.Fatalf("Refresh() = %v, changes = %q", err, changes)
+	}
+
+	// A failed refresh keeps the last value
+	provider.err = errors.New("vault sealed")
+	if err := secrets.Refresh(ctx); err == nil {
+		t.Error("Refresh() error = nil, want the fetch error")
+	}
+	if value, _ := secrets.Get(ctx, "smtp"); value != "v2" {
+		t.Errorf("Get() = %q after a failed refresh, want v2", value)
+	}
+	if err := secrets.Close(); err != nil {
+		t.Errorf("Close() without Start = %v", err)
+	}
+}
+
+// keySessionManager records the keys set by SetSessionKeys
+type keySessionManager struct {
+	mockSessionManager
+	mu   sync.Mutex
+	keys string
+}
+
+func (m *keySessionManager) SetSessionKeys(keys string) error {
+	if keys == "invalid" {
+		return errors.New("invalid key ring")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys = keys
+	return nil
+}
+
+func TestWithSecretProvider_RotatesSessionKeys(t *testing.T) {
+	provider := &mapSecrets{values: map[string]string{"session-keys": "v1:c2VjcmV0"}}
+	sm := &keySessionManager{}
+	var factoryKeys string
+	auth, err := New(
+		WithBaseURL("http://localhost:3000"),
+		WithAdapter(&mockAdapter{}),
+		withMockFactories(),
+		WithSecretProvider(provider, "session-keys"),
+		func(c *Config) error {
+			c.SessionManagerFactory = func(cfg *Config, a Adapter) (SessionManager, error) {
+				factoryKeys = cfg.SecretKeys
+				return sm, nil
+			}
+			c.Advanced.DisableSecurityBanner = true
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer auth.Close()
+
+	if factoryKeys != "v1:c2VjcmV0" {
+		t.Errorf("SecretKeys = %q, want the fetched key ring", factoryKeys)
+	}
+
+	secrets := auth.(*beaconAuth).ctx.Secrets
+	provider.set("session-keys", "v2:bmV3,v1:c2VjcmV0")
+	_ = secrets.Refresh(context.Background())
+	if sm.keys != "v2:bmV3,v1:c2VjcmV0" {
+		t.Errorf("session keys = %q, want the rotated key ring", sm.keys)
+	}
+
+	// A rejected key ring leaves the keys alone
+	provider.set("session-keys", "invalid")
+	_ = secrets.Refresh(context.Background())
+	if sm.keys != "v2:bmV3,v1:c2VjcmV0" {
+		t.Errorf("session keys = %q after an invalid key ring", sm.keys)
+	}
+
+	// Without the secret, New fails before anything starts
+	_, err = New(
+		WithBaseURL("http://localhost:3000"),
+		WithAdapter(&mockAdapter{}),
+		withMockFactories(),
+		WithSecretProvider(provider, "other-keys"),
+	)
+	if !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("New() error = %v, want ErrSecretNotFound", err)
+	}
+}
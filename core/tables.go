@@ -0,0 +1,102 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Default model names. These are also the default table names.
+const (
+	ModelUsers         = "users"
+	ModelSessions      = "sessions"
+	ModelAccounts      = "accounts"
+	ModelVerifications = "verifications"
+)
+
+// TableNames maps BeaconAuth models to the table names used in a
+// deployment, so BeaconAuth can share a database with existing tables of
+// the same names. Empty fields keep the default name, with Prefix applied.
+type TableNames struct {
+	// Prefix is prepended to every default table name, including plugin
+	// tables (e.g. "auth_" gives "auth_users"). Names set explicitly below
+	// are used as given.
+	Prefix string
+
+	Users         string
+	Sessions      string
+	Accounts      string
+	Verifications string
+
+	// Plugins renames plugin tables, keyed by their default name
+	// (e.g. "two_factors": "auth_two_factors")
+	Plugins map[string]string
+}
+
+// Table returns the table name for a model. It is safe to call on a nil
+// TableNames, which keeps every default.
+func (t *TableNames) Table(model string) string {
+	if t == nil {
+		return model
+	}
+
+	var name string
+	switch model {
+	case ModelUsers:
+		name = t.Users
+	case ModelSessions:
+		name = t.Sessions
+	case ModelAccounts:
+		name = t.Accounts
+	case ModelVerifications:
+		name = t.Verifications
+	default:
+		name = t.Plugins[model]
+	}
+
+	if name == "" {
+		return t.Prefix + model
+	}
+	return name
+}
+
+// Validate checks that every configured name is a plain identifier and
+// that no two models share a table
+func (t *TableNames) Validate() error {
+	if t == nil {
+		return nil
+	}
+
+	models := []string{ModelUsers, ModelSessions, ModelAccounts, ModelVerifications}
+	for model := range t.Plugins {
+		models = append(models, model)
+	}
+
+	used := make(map[string]string, len(models))
+	for _, model := range models {
+		name := t.Table(model)
+		if !isTableIdentifier(name) {
+			return fmt.Errorf("invalid table name for %s: %q", model, name)
+		}
+		if other, ok := used[strings.ToLower(name)]; ok {
+			return fmt.Errorf("table %q is used by both %s and %s", name, other, model)
+		}
+		used[strings.ToLower(name)] = model
+	}
+
+	return nil
+}
+
+func isTableIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+package core
+
+import "testing"
+
+func TestTableNames(t *testing.T) {
+	var defaults *TableNames
+	if got := defaults.Table(ModelUsers); got != "users" {
+		t.Errorf("nil TableNames Table(users) = %q, want users", got)
+	}
+
+	names := &TableNames{
+		Users:   "auth_users",
+		Plugins: map[string]string{"two_factors": "auth_two_factors"},
+	}
+	tests := map[string]string{
+		ModelUsers:                "auth_users",
+		ModelSessions:             "sessions",
+		"two_factors":             "auth_two_factors",
+		"two_factor_backup_codes": "two_factor_backup_codes",
+	}
+	for model, want := range tests {
+		if got := names.Table(model); got != want {
+			t.Errorf("Table(%s) = %q, want %q", model, got, want)
+		}
+	}
+	if err := names.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
+
+func TestTableNamesPrefix(t *testing.T) {
+	names := &TableNames{
+		Prefix:   "auth_",
+		Sessions: "login_sessions",
+	}
+	tests := map[string]string{
+		ModelUsers:    "auth_users",
+		ModelSessions: "login_sessions",
+		"two_factors": "auth_two_factors",
+	}
+	for model, want := range tests {
+		if got := names.Table(model); got != want {
+			t.Errorf("Table(%s) = %q, want %q", model, got, want)
+		}
+	}
+	if err := names.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
+
+func TestTableNamesValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		names *TableNames
+	}{
+		{"invalid identifier", &TableNames{Users: "users; DROP TABLE x"}},
+		{"leading digit", &TableNames{Sessions: "1sessions"}},
+		{"duplicate", &TableNames{Users: "auth", Sessions: "AUTH"}},
+		{"collides with default", &TableNames{Users: "sessions"}},
+		{"plugin collides", &TableNames{Plugins: map[string]string{"two_factors": "accounts"}}},
+		{"invalid prefix", &TableNames{Prefix: "auth-"}},
+		{"prefix collides", &TableNames{Prefix: "auth_", Accounts: "auth_users"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.names.Validate(); err == nil {
+				t.Error("Expected validation error")
+			}
+		})
+	}
+}
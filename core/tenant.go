@@ -0,0 +1,76 @@
+package core
+
+import (
+	"context"
+	"errors"
+)
+
+// TenantColumn is the column holding the tenant of tenant-scoped records
+const TenantColumn = "tenant_id"
+
+// MaxTenantIDLength is the longest tenant ID accepted, the size of the
+// tenant_id column in generated schemas
+const MaxTenantIDLength = 64
+
+// TenantModels are the models whose records belong to a tenant when
+// tenancy is enabled. Records of other models, such as plugin tables keyed
+// by user ID, are reached through a tenant's users.
+var TenantModels = []string{ModelUsers, ModelSessions, ModelAccounts}
+
+// ErrTenantRequired is returned for queries on tenant-scoped models made
+// without a tenant when TenancyConfig.RequireTenant is set
+var ErrTenantRequired = errors.New("tenant required")
+
+// TenancyConfig enables multi-tenancy: users, sessions and accounts get a
+// tenant_id, and every query on them is limited to the tenant of the
+// request (see WithTenant). The same email can then sign up once per
+// tenant, and a session is only valid for the tenant it was created in.
+//
+// beaconauth.New applies tenancy with adapter.WithTenancy. The tables need
+// the tenant_id column; generate them with `beacon generate --tenancy`.
+type TenancyConfig struct {
+	// RequireTenant rejects queries made without a tenant with
+	// ErrTenantRequired. Otherwise they use the default tenant, "".
+	RequireTenant bool
+}
+
+// WithTenant sets the tenant that queries made with ctx are scoped to.
+// Tenant middleware calls it for each request.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantContextKey, tenantID)
+}
+
+// TenantFromContext returns the tenant set with WithTenant and whether one
+// was set
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenantID, ok := ctx.Value(tenantContextKey).(string)
+	return tenantID, ok
+}
+
+// ValidTenantID reports whether id can be used as a tenant ID: 1 to
+// MaxTenantIDLength ASCII letters, digits, '-', '_' and '.'
+func ValidTenantID(id string) bool {
+	if id == "" || len(id) > MaxTenantIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// IsTenantModel reports whether model is one of TenantModels
+func IsTenantModel(model string) bool {
+	for _, m := range TenantModels {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"context"
+	"fmt"
+)
+
+// IsolationLevel is the transaction isolation level requested in TxOptions
+type IsolationLevel int
+
+const (
+	IsolationDefault IsolationLevel = iota // the database's default level
+	IsolationReadUncommitted
+	IsolationReadCommitted
+	IsolationRepeatableRead
+	IsolationSerializable
+)
+
+// String returns the SQL name of the level
+func (l IsolationLevel) String() string {
+	switch l {
+	case IsolationDefault:
+		return "DEFAULT"
+	case IsolationReadUncommitted:
+		return "READ UNCOMMITTED"
+	case IsolationReadCommitted:
+		return "READ COMMITTED"
+	case IsolationRepeatableRead:
+		return "REPEATABLE READ"
+	case IsolationSerializable:
+		return "SERIALIZABLE"
+	default:
+		return fmt.Sprintf("IsolationLevel(%d)", int(l))
+	}
+}
+
+// TxOptions configures a transaction started with TransactionWithOptions.
+// The zero value starts a read-write transaction at the database's default
+// isolation level, like Adapter.Transaction.
+type TxOptions struct {
+	// Isolation is the isolation level of the transaction
+	Isolation IsolationLevel
+
+	// ReadOnly rejects writes made inside the transaction
+	ReadOnly bool
+}
+
+// TxOptionsAdapter is implemented by adapters that can start a transaction
+// with an isolation level or in read-only mode. Calling Transaction on the
+// adapter passed to fn starts a nested transaction backed by a savepoint:
+// an error rolls back only the nested work.
+type TxOptionsAdapter interface {
+	TransactionWithOptions(ctx context.Context, opts TxOptions, fn func(Adapter) error) error
+}
+
+// TransactionWithOptions runs fn in a transaction started with opts. Adapters
+// that do not implement TxOptionsAdapter run fn with Transaction when opts is
+// the zero value and return ErrTxOptionsUnsupported otherwise, rather than
+// silently ignoring the options.
+func TransactionWithOptions(ctx context.Context, adapter Adapter, opts TxOptions, fn func(Adapter) error) error {
+	if txAdapter, ok := adapter.(TxOptionsAdapter); ok {
+		return txAdapter.TransactionWithOptions(ctx, opts, fn)
+	}
+	if opts != (TxOptions{}) {
+		return fmt.Errorf("%w: adapter %s", ErrTxOptionsUnsupported, adapter.ID())
+	}
+	return adapter.Transaction(ctx, fn)
+}
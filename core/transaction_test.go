@@ -0,0 +1,57 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// optionsAdapter records the options it was asked to start a transaction with
+type optionsAdapter struct {
+	mockAdapter
+	opts TxOptions
+}
+
+func (a *optionsAdapter) TransactionWithOptions(ctx context.Context, opts TxOptions, fn func(Adapter) error) error {
+	a.opts = opts
+	return fn(a)
+}
+
+func TestTransactionWithOptions(t *testing.T) {
+	ctx := context.Background()
+	opts := TxOptions{Isolation: IsolationSerializable, ReadOnly: true}
+	ran := false
+	fn := func(Adapter) error {
+		ran = true
+		return nil
+	}
+
+	adapter := &optionsAdapter{}
+	if err := TransactionWithOptions(ctx, adapter, opts, fn); err != nil {
+		t.Fatalf("TransactionWithOptions() error = %v", err)
+	}
+	if !ran || adapter.opts != opts {
+		t.Errorf("TransactionWithOptions() ran = %v, opts = %+v, want %+v", ran, adapter.opts, opts)
+	}
+
+	// Adapters without option support run plain transactions only
+	ran = false
+	if err := TransactionWithOptions(ctx, &mockAdapter{}, TxOptions{}, fn); err != nil || !ran {
+		t.Errorf("TransactionWithOptions() zero options = %v, ran = %v", err, ran)
+	}
+
+	ran = false
+	err := TransactionWithOptions(ctx, &mockAdapter{}, opts, fn)
+	if !errors.Is(err, ErrTxOptionsUnsupported) || ran {
+		t.Errorf("TransactionWithOptions() error = %v, ran = %v, want ErrTxOptionsUnsupported", err, ran)
+	}
+}
+
+func TestIsolationLevelString(t *testing.T) {
+	if got := IsolationRepeatableRead.String(); got != "REPEATABLE READ" {
+		t.Errorf("String() = %q", got)
+	}
+	if got := IsolationLevel(42).String(); got != "IsolationLevel(42)" {
+		t.Errorf("String() = %q", got)
+	}
+}
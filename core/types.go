@@ -6,19 +6,20 @@ import (
 
 // User represents an authenticated user
 type User struct {
-	ID               string                 `json:"id"`
-	Email            string                 `json:"email"`
-	EmailVerified    bool                   `json:"emailVerified"`
-	Name             string                 `json:"name,omitempty"`
-	Image            string                 `json:"image,omitempty"`
-	TwoFactorEnabled bool                   `json:"twoFactorEnabled"`
-	CreatedAt        time.Time              `json:"createdAt"`
-	UpdatedAt        time.Time              `json:"updatedAt"`
-	Role             string                 `json:"role,omitempty"`
-	Banned           bool                   `json:"banned"`
-	BanReason        string                 `json:"banReason,omitempty"`
-	BanExpires       *time.Time             `json:"banExpires,omitempty"`
-	Metadata         map[string]interface{} `json:"metadata,omitempty"` // Custom fields from plugins
+	ID               string                 `json:"id" db:"id"`
+	Email            string                 `json:"email" db:"email"`
+	EmailVerified    bool                   `json:"emailVerified" db:"email_verified"`
+	Name             string                 `json:"name,omitempty" db:"name"`
+	Image            string                 `json:"image,omitempty" db:"image"`
+	TwoFactorEnabled bool                   `json:"twoFactorEnabled" db:"two_factor_enabled"`
+	CreatedAt        time.Time              `json:"createdAt" db:"created_at"`
+	UpdatedAt        time.Time              `json:"updatedAt" db:"updated_at"`
+	Role             string                 `json:"role,omitempty" db:"role"`
+	Banned           bool                   `json:"banned" db:"banned"`
+	BanReason        string                 `json:"banReason,omitempty" db:"ban_reason"`
+	BanExpires       *time.Time             `json:"banExpires,omitempty" db:"ban_expires"`
+	TenantID         string                 `json:"tenantId,omitempty" db:"tenant_id,omitempty"` // Set when tenancy is enabled (see TenancyConfig)
+	Metadata         map[string]interface{} `json:"metadata,omitempty" db:"*"`                   // Custom fields from plugins
 }
 
 // HasRole checks if the user has the specified role
@@ -28,52 +29,73 @@ func (u *User) HasRole(role string) bool {
 
 // Session represents a user session
 type Session struct {
-	ID             string                 `json:"id"`
-	UserID         string                 `json:"userId"`
-	Token          string                 `json:"token"`
-	ExpiresAt      time.Time              `json:"expiresAt"`
-	IPAddress      string                 `json:"ipAddress,omitempty"`
-	UserAgent      string                 `json:"userAgent,omitempty"`
-	CreatedAt      time.Time              `json:"createdAt"`
-	UpdatedAt      time.Time              `json:"updatedAt"`
-	ImpersonatedBy string                 `json:"impersonatedBy,omitempty"` // ID of the admin impersonating this session
-	Metadata       map[string]interface{} `json:"metadata,omitempty"`       // Custom fields from plugins
+	ID             string                 `json:"id" db:"id"`
+	UserID         string                 `json:"userId" db:"user_id"`
+	Token          string                 `json:"token" db:"token"`
+	ExpiresAt      time.Time              `json:"expiresAt" db:"expires_at"`
+	IPAddress      string                 `json:"ipAddress,omitempty" db:"ip_address"`
+	UserAgent      string                 `json:"userAgent,omitempty" db:"user_agent"`
+	CreatedAt      time.Time              `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time              `json:"updatedAt" db:"updated_at"`
+	ImpersonatedBy string                 `json:"impersonatedBy,omitempty" db:"impersonated_by"` // ID of the admin impersonating this session
+	Fingerprint    string                 `json:"fingerprint,omitempty" db:"fingerprint"`        // Hash of bound client attributes (see SessionBinding)
+	TenantID       string                 `json:"tenantId,omitempty" db:"tenant_id,omitempty"`   // Tenant the session is valid for (see TenancyConfig)
+	Metadata       map[string]interface{} `json:"metadata,omitempty" db:"*"`                     // Custom fields from plugins
 }
 
 // Account represents an authentication account (email, OAuth, etc.)
 type Account struct {
-	ID                    string                 `json:"id"`
-	UserID                string                 `json:"userId"`
-	AccountID             string                 `json:"accountId"`
-	ProviderID            string                 `json:"providerId"`
-	ProviderType          string                 `json:"providerType,omitempty"` // "oauth", "email", "credential"
-	Password              string                 `json:"-"`
-	AccessToken           string                 `json:"-"`
-	RefreshToken          string                 `json:"-"`
-	AccessTokenExpiresAt  *time.Time             `json:"accessTokenExpiresAt,omitempty"`
-	RefreshTokenExpiresAt *time.Time             `json:"refreshTokenExpiresAt,omitempty"`
-	Scope                 string                 `json:"scope,omitempty"`
-	IDToken               string                 `json:"idToken,omitempty"`
-	CreatedAt             time.Time              `json:"createdAt"`
-	UpdatedAt             time.Time              `json:"updatedAt"`
-	Metadata              map[string]interface{} `json:"metadata,omitempty"` // Provider-specific fields
+	ID                    string                 `json:"id" db:"id"`
+	UserID                string                 `json:"userId" db:"user_id"`
+	AccountID             string                 `json:"accountId" db:"account_id"`
+	ProviderID            string                 `json:"providerId" db:"provider_id"`
+	ProviderType          string                 `json:"providerType,omitempty" db:"provider_type"` // "oauth", "email", "credential"
+	Password              string                 `json:"-" db:"password"`
+	AccessToken           string                 `json:"-" db:"access_token"`
+	RefreshToken          string                 `json:"-" db:"refresh_token"`
+	AccessTokenExpiresAt  *time.Time             `json:"accessTokenExpiresAt,omitempty" db:"access_token_expires_at"`
+	RefreshTokenExpiresAt *time.Time             `json:"refreshTokenExpiresAt,omitempty" db:"refresh_token_expires_at"`
+	Scope                 string                 `json:"scope,omitempty" db:"scope"`
+	IDToken               string                 `json:"idToken,omitempty" db:"id_token"`
+	TenantID              string                 `json:"tenantId,omitempty" db:"tenant_id,omitempty"` // Set when tenancy is enabled (see TenancyConfig)
+	CreatedAt             time.Time              `json:"createdAt" db:"created_at"`
+	UpdatedAt             time.Time              `json:"updatedAt" db:"updated_at"`
+	Metadata              map[string]interface{} `json:"metadata,omitempty" db:"*"` // Provider-specific fields
 }
 
-// Verification represents an email/phone verification token
+// Verification is a record of the verifications table: a verification
+// token, OAuth state or other short-lived value of a flow
 type Verification struct {
-	ID         string    `json:"id"`
-	Identifier string    `json:"identifier"` // email or phone
-	Value      string    `json:"value"`      // The value to be verified (token/otp)
-	ExpiresAt  time.Time `json:"expiresAt"`
-	CreatedAt  time.Time `json:"createdAt"`
-	UpdatedAt  time.Time `json:"updatedAt"`
+	ID         string    `json:"id" db:"id,omitempty"`
+	Identifier string    `json:"identifier" db:"identifier"` // user ID, email or phone
+	Token      string    `json:"-" db:"token"`               // The stored token, usually its hash
+	Type       string    `json:"type" db:"type"`             // The purpose of the record
+	ExpiresAt  time.Time `json:"expiresAt" db:"expires_at"`
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt  time.Time `json:"updatedAt" db:"updated_at"`
 }
 
+// MetadataRememberMe is the session metadata key set to false for
+// transient sessions (see SessionOptions.Transient)
+const MetadataRememberMe = "rememberMe"
+
 // SessionOptions holds options for session creation
 type SessionOptions struct {
-	User       *User          // Pre-fetched user to avoid redundant lookup
+	User       *User // Pre-fetched user to avoid redundant lookup
 	IPAddress  string
 	UserAgent  string
 	RememberMe bool
 	ExpiresIn  *time.Duration
+
+	// Transient creates the session of a sign-in without remember me. It
+	// lasts the short session lifetime (see SessionConfig.ShortExpiresIn)
+	// unless ExpiresIn is set, keeps that lifetime when renewed, and its
+	// cookie should end with the browser session. The session's metadata
+	// records it under MetadataRememberMe.
+	Transient bool
+
+	// Tx is a transaction adapter the database session store writes the
+	// session with, so it commits or rolls back together with the other
+	// writes of the transaction (nil = the store's own adapter)
+	Tx Adapter
 }
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// UpsertColumns validates the arguments of Adapter.Upsert for adapter
+// implementations. It returns the fields of data in a stable order and the
+// fields to overwrite when a record already exists (all but the conflict
+// fields).
+func UpsertColumns(conflictFields []string, data map[string]interface{}) (columns, updates []string, err error) {
+	if len(data) == 0 {
+		return nil, nil, errors.New("no data provided")
+	}
+	if len(conflictFields) == 0 {
+		return nil, nil, errors.New("upsert requires at least one conflict field")
+	}
+	for _, field := range conflictFields {
+		if _, ok := data[field]; !ok {
+			return nil, nil, fmt.Errorf("upsert conflict field %q is missing from data", field)
+		}
+	}
+
+	columns = make([]string, 0, len(data))
+	for col := range data {
+		columns = append(columns, col)
+		if !slices.Contains(conflictFields, col) {
+			updates = append(updates, col)
+		}
+	}
+	sort.Strings(columns)
+	sort.Strings(updates)
+	return columns, updates, nil
+}
+
+// ConflictQuery returns a query matching the record identified by the
+// conflict fields of an upsert
+func ConflictQuery(model string, conflictFields []string, data map[string]interface{}) *Query {
+	where := make([]WhereClause, len(conflictFields))
+	for i, field := range conflictFields {
+		where[i] = WhereClause{Field: field, Operator: OpEqual, Value: data[field]}
+	}
+	return &Query{Model: model, Where: where}
+}
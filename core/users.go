@@ -0,0 +1,21 @@
+package core
+
+import (
+	"context"
+	"errors"
+)
+
+// ExternalUser looks a user up in Config.UserStore, for plugins that read
+// the users table directly. It reports false when users are kept in the
+// users table, and returns a nil user for unknown IDs.
+func (c *AuthContext) ExternalUser(ctx context.Context, userID string) (*User, bool, error) {
+	store := c.Config.UserStore
+	if store == nil {
+		return nil, false, nil
+	}
+	user, err := store.FindUserByID(ctx, userID)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, true, nil
+	}
+	return user, true, err
+}
@@ -0,0 +1,268 @@
+// Package cors lets browser applications on other origins call the auth
+// endpoints. A Policy is built once from a Config and applied by the
+// router, by Handler for net/http, and by the CORS middleware of the
+// Fiber, Echo and Gin integrations, so every integration answers
+// cross-origin and preflight requests the same way.
+//
+//	policy, err := cors.New(cors.Config{
+//		AllowedOrigins:   []string{"https://app.example.com", "https://*.example.dev"},
+//		AllowCredentials: true,
+//		MaxAge:           10 * time.Minute,
+//	})
+//	mux.Handle("/auth/", policy.Handler(authHandler))
+package cors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMethods are the methods allowed when Config.AllowedMethods is
+// empty
+var DefaultMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+// DefaultHeaders are the request headers allowed when
+// Config.AllowedHeaders is empty
+var DefaultHeaders = []string{"Content-Type", "Authorization"}
+
+// Config configures which cross-origin requests are allowed
+type Config struct {
+	// AllowedOrigins lists the allowed origins: exact origins such as
+	// "https://app.example.com", patterns with a single wildcard for
+	// subdomains such as "https://*.example.com", or "*" for any origin
+	AllowedOrigins []string
+
+	// AllowOriginFunc allows origins not matched by AllowedOrigins (optional)
+	AllowOriginFunc func(origin string) bool
+
+	// AllowCredentials lets browsers send the session cookie with
+	// cross-origin requests. It cannot be combined with "*".
+	AllowCredentials bool
+
+	// AllowedMethods are the methods allowed in preflight requests
+	// (default DefaultMethods)
+	AllowedMethods []string
+
+	// AllowedHeaders are the request headers allowed in preflight requests
+	// (default DefaultHeaders). "*" allows the headers the browser asks for.
+	AllowedHeaders []string
+
+	// ExposedHeaders are the response headers readable by the browser
+	// application
+	ExposedHeaders []string
+
+	// MaxAge is how long browsers may cache preflight responses (0 = the
+	// browser's default)
+	MaxAge time.Duration
+}
+
+// Policy applies a validated Config to requests
+type Policy struct {
+	anyOrigin   bool
+	origins     map[string]bool
+	patterns    []originPattern
+	originFunc  func(string) bool
+	credentials bool
+	methods     string
+	headers     string
+	anyHeader   bool
+	exposed     string
+	maxAge      string
+}
+
+// originPattern matches origins of the form prefix + subdomains + suffix
+type originPattern struct {
+	prefix, suffix string
+}
+
+// New validates cfg and builds its policy
+func New(cfg Config) (*Policy, error) {
+	p := &Policy{
+		origins:     make(map[string]bool),
+		originFunc:  cfg.AllowOriginFunc,
+		credentials: cfg.AllowCredentials,
+		methods:     strings.Join(orDefault(cfg.AllowedMethods, DefaultMethods), ", "),
+		exposed:     strings.Join(cfg.ExposedHeaders, ", "),
+	}
+
+	for _, origin := range cfg.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		if origin == "*" {
+			if cfg.AllowCredentials {
+				return nil, errors.New("cors: credentials cannot be allowed from any origin")
+			}
+			p.anyOrigin = true
+			continue
+		}
+		if err := validateOrigin(origin); err != nil {
+			return nil, err
+		}
+		if prefix, suffix, ok := strings.Cut(origin, "*"); ok {
+			p.patterns = append(p.patterns, originPattern{prefix: prefix, suffix: suffix})
+			continue
+		}
+		p.origins[origin] = true
+	}
+
+	headers := orDefault(cfg.AllowedHeaders, DefaultHeaders)
+	for _, header := range headers {
+		if header == "*" {
+			p.anyHeader = true
+		}
+	}
+	p.headers = strings.Join(headers, ", ")
+
+	if cfg.MaxAge < 0 {
+		return nil, errors.New("cors: MaxAge cannot be negative")
+	}
+	if cfg.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(cfg.MaxAge.Round(time.Second).Seconds()))
+	}
+	return p, nil
+}
+
+// validateOrigin rejects entries that can never match an Origin header,
+// such as origins with a path or patterns with several wildcards
+func validateOrigin(origin string) error {
+	if origin == "null" {
+		return nil
+	}
+	scheme, host, ok := strings.Cut(origin, "://")
+	if !ok || scheme == "" || host == "" {
+		return fmt.Errorf("cors: origin %q must be scheme://host", origin)
+	}
+	if strings.Contains(host, "/") {
+		return fmt.Errorf("cors: origin %q must not have a path", origin)
+	}
+	if strings.Count(origin, "*") > 1 {
+		return fmt.Errorf("cors: origin %q has more than one wildcard", origin)
+	}
+	if strings.Contains(origin, "*") && !strings.HasPrefix(host, "*.") {
+		return fmt.Errorf("cors: origin %q may only use a wildcard for subdomains, as in https://*.example.com", origin)
+	}
+	return nil
+}
+
+func orDefault(values, defaults []string) []string {
+	if len(values) == 0 {
+		return defaults
+	}
+	return values
+}
+
+// AllowOrigin reports whether requests from origin are allowed
+func (p *Policy) AllowOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if p.anyOrigin {
+		return true
+	}
+	lower := strings.ToLower(origin)
+	if p.origins[lower] {
+		return true
+	}
+	for _, pattern := range p.patterns {
+		if pattern.match(lower) {
+			return true
+		}
+	}
+	return p.originFunc != nil && p.originFunc(origin)
+}
+
+// match requires at least one subdomain label in place of the wildcard
+func (o originPattern) match(origin string) bool {
+	if len(origin) <= len(o.prefix)+len(o.suffix) ||
+		!strings.HasPrefix(origin, o.prefix) || !strings.HasSuffix(origin, o.suffix) {
+		return false
+	}
+	labels := origin[len(o.prefix) : len(origin)-len(o.suffix)]
+	return !strings.ContainsAny(labels, "/:@") && !strings.HasPrefix(labels, ".") && !strings.HasSuffix(labels, ".")
+}
+
+// Headers returns the response headers for a request with the given method
+// and request headers, and reports whether the request is a preflight
+// request, which the caller answers with 204 No Content without running
+// the endpoint. Requests from origins that are not allowed get no CORS
+// headers, so browsers reject their responses.
+func (p *Policy) Headers(method string, req http.Header) (http.Header, bool) {
+	origin := req.Get("Origin")
+	if origin == "" {
+		return nil, false
+	}
+	preflight := method == http.MethodOptions && req.Get("Access-Control-Request-Method") != ""
+
+	h := http.Header{}
+	h.Add("Vary", "Origin")
+	if preflight {
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+	}
+	if !p.AllowOrigin(origin) {
+		return h, false
+	}
+
+	if p.anyOrigin && !p.credentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if !preflight {
+		if p.exposed != "" {
+			h.Set("Access-Control-Expose-Headers", p.exposed)
+		}
+		return h, false
+	}
+
+	h.Set("Access-Control-Allow-Methods", p.methods)
+	if requested := req.Get("Access-Control-Request-Headers"); p.anyHeader && requested != "" {
+		h.Set("Access-Control-Allow-Headers", requested)
+	} else {
+		h.Set("Access-Control-Allow-Headers", p.headers)
+	}
+	if p.maxAge != "" {
+		h.Set("Access-Control-Max-Age", p.maxAge)
+	}
+	return h, true
+}
+
+// Handler applies the policy to requests for next and answers preflight
+// requests
+func (p *Policy) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p.Write(w, r) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Write adds the CORS headers for r to w and answers preflight requests
+// with 204 No Content. It reports whether the request was answered.
+func (p *Policy) Write(w http.ResponseWriter, r *http.Request) bool {
+	h, preflight := p.Headers(r.Method, r.Header)
+	for key, values := range h {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	if preflight {
+		w.WriteHeader(http.StatusNoContent)
+	}
+	return preflight
+}
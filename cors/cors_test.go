@@ -0,0 +1,157 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNew_Validation(t *testing.T) {
+	invalid := []Config{
+		{AllowedOrigins: []string{"*"}, AllowCredentials: true},
+		{AllowedOrigins: []string{"app.example.com"}},
+		{AllowedOrigins: []string{"https://app.example.com/"}},
+		{AllowedOrigins: []string{"https://*.*.example.com"}},
+		{AllowedOrigins: []string{"https://app-*.example.com"}},
+		{MaxAge: -time.Second},
+	}
+	for _, cfg := range invalid {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("Expected %+v to be rejected", cfg)
+		}
+	}
+
+	if _, err := New(Config{AllowedOrigins: []string{"https://*.example.com"}, AllowCredentials: true}); err != nil {
+		t.Errorf("Expected credentials with a pattern to be allowed: %v", err)
+	}
+}
+
+func TestPolicy_AllowOrigin(t *testing.T) {
+	p, err := New(Config{
+		AllowedOrigins:  []string{"https://app.example.com", "https://*.example.dev", "http://localhost:3000"},
+		AllowOriginFunc: func(origin string) bool { return origin == "https://partner.test" },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.example.com", true},
+		{"HTTPS://APP.EXAMPLE.COM", true},
+		{"http://app.example.com", false},
+		{"https://app.example.com.evil.com", false},
+		{"https://preview.example.dev", true},
+		{"https://a.b.example.dev", true},
+		{"https://example.dev", false},
+		{"https://evil.com/.example.dev", false},
+		{"https://evilexample.dev", false},
+		{"http://localhost:3000", true},
+		{"http://localhost:4000", false},
+		{"https://partner.test", true},
+		{"null", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := p.AllowOrigin(tt.origin); got != tt.want {
+			t.Errorf("AllowOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestPolicy_Headers(t *testing.T) {
+	p, err := New(Config{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowCredentials: true,
+		AllowedMethods:   []string{http.MethodGet, http.MethodPost},
+		ExposedHeaders:   []string{"X-Request-Id"},
+		MaxAge:           10 * time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, preflight := p.Headers(http.MethodOptions, http.Header{
+		"Origin":                        {"https://app.example.com"},
+		"Access-Control-Request-Method": {"POST"},
+	})
+	if !preflight {
+		t.Fatal("Expected a preflight request")
+	}
+	want := map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, POST",
+		"Access-Control-Allow-Headers":     "Content-Type, Authorization",
+		"Access-Control-Max-Age":           "600",
+	}
+	for key, value := range want {
+		if got := h.Get(key); got != value {
+			t.Errorf("Expected %s %q, got %q", key, value, got)
+		}
+	}
+	if len(h.Values("Vary")) != 3 {
+		t.Errorf("Expected the preflight response to vary on the origin and request headers, got %v", h.Values("Vary"))
+	}
+
+	h, preflight = p.Headers(http.MethodPost, http.Header{"Origin": {"https://app.example.com"}})
+	if preflight || h.Get("Access-Control-Expose-Headers") != "X-Request-Id" || h.Get("Access-Control-Max-Age") != "" {
+		t.Errorf("Unexpected headers for a simple request %v", h)
+	}
+
+	h, preflight = p.Headers(http.MethodOptions, http.Header{
+		"Origin":                        {"https://evil.example.com"},
+		"Access-Control-Request-Method": {"POST"},
+	})
+	if preflight || h.Get("Access-Control-Allow-Origin") != "" || h.Get("Vary") != "Origin" {
+		t.Errorf("Expected only Vary for a disallowed origin, got %v", h)
+	}
+
+	if h, _ := p.Headers(http.MethodGet, http.Header{}); h != nil {
+		t.Errorf("Expected no headers for a same-origin request, got %v", h)
+	}
+}
+
+func TestPolicy_AnyOriginAndHeader(t *testing.T) {
+	p, err := New(Config{AllowedOrigins: []string{"*"}, AllowedHeaders: []string{"*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, _ := p.Headers(http.MethodOptions, http.Header{
+		"Origin":                         {"https://anywhere.test"},
+		"Access-Control-Request-Method":  {"PUT"},
+		"Access-Control-Request-Headers": {"X-Custom"},
+	})
+	if h.Get("Access-Control-Allow-Origin") != "*" || h.Get("Access-Control-Allow-Headers") != "X-Custom" {
+		t.Errorf("Unexpected headers %v", h)
+	}
+}
+
+func TestPolicy_Handler(t *testing.T) {
+	p, err := New(Config{AllowedOrigins: []string{"https://app.example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	called := false
+	h := p.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+
+	req := httptest.NewRequest(http.MethodOptions, "/auth/signin", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent || called {
+		t.Errorf("Expected the preflight to be answered with 204, got %d (handler called: %v)", w.Code, called)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/auth/signin", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if !called || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Errorf("Expected the handler to run with CORS headers, got %v", w.Header())
+	}
+}
@@ -0,0 +1,67 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BcryptHasher implements PasswordHasher using bcrypt.
+// It is mainly intended for verifying hashes created by other systems
+// so they can be migrated to Argon2id over time.
+type BcryptHasher struct {
+	cost int
+}
+
+// NewBcryptHasher creates a new bcrypt password hasher.
+// A cost of zero uses bcrypt.DefaultCost.
+func NewBcryptHasher(cost int) *BcryptHasher {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	return &BcryptHasher{cost: cost}
+}
+
+// Algorithm returns the algorithm produced by this hasher
+func (h *BcryptHasher) Algorithm() Algorithm {
+	return AlgorithmBcrypt
+}
+
+// Hash hashes a password using bcrypt
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// Verify verifies a password against a bcrypt hash
+func (h *BcryptHasher) Verify(password, encodedHash string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encodedHash), []byte(password))
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid bcrypt hash: %w", err)
+}
+
+// DescribeSecurity reports the algorithm and cost
+func (h *BcryptHasher) DescribeSecurity() map[string]interface{} {
+	return map[string]interface{}{
+		"algorithm": string(AlgorithmBcrypt),
+		"cost":      h.cost,
+	}
+}
+
+// NeedsRehash reports whether the hash was created with a different cost
+func (h *BcryptHasher) NeedsRehash(encodedHash string) bool {
+	cost, err := bcrypt.Cost([]byte(encodedHash))
+	if err != nil {
+		return true
+	}
+	return cost != h.cost
+}
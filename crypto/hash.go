@@ -1,7 +1,9 @@
 package crypto
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
 	"fmt"
@@ -10,6 +12,13 @@ import (
 	"golang.org/x/crypto/argon2"
 )
 
+// Minimum Argon2id parameters accepted by NewArgon2Hasher
+const (
+	MinArgon2Memory     = 8 * 1024 // KiB
+	MinArgon2SaltLength = 16       // bytes
+	MinArgon2KeyLength  = 16       // bytes
+)
+
 // PasswordHasher defines the interface for password hashing
 type PasswordHasher interface {
 	Hash(password string) (string, error)
@@ -23,21 +32,144 @@ type Argon2Hasher struct {
 	parallelism uint8
 	saltLength  uint32
 	keyLength   uint32
+
+	// Pepper configuration. pepperID identifies the secret used for new
+	// hashes; peppers holds every secret that is still accepted.
+	pepperID string
+	peppers  map[string][]byte
+}
+
+// Argon2Option configures an Argon2Hasher
+type Argon2Option func(*Argon2Hasher)
+
+// WithArgon2Memory sets the memory cost in KiB
+func WithArgon2Memory(memory uint32) Argon2Option {
+	return func(h *Argon2Hasher) {
+		h.memory = memory
+	}
+}
+
+// WithArgon2Iterations sets the number of passes over memory
+func WithArgon2Iterations(iterations uint32) Argon2Option {
+	return func(h *Argon2Hasher) {
+		h.iterations = iterations
+	}
+}
+
+// WithArgon2Parallelism sets the number of threads
+func WithArgon2Parallelism(parallelism uint8) Argon2Option {
+	return func(h *Argon2Hasher) {
+		h.parallelism = parallelism
+	}
+}
+
+// WithArgon2SaltLength sets the salt length in bytes
+func WithArgon2SaltLength(length uint32) Argon2Option {
+	return func(h *Argon2Hasher) {
+		h.saltLength = length
+	}
+}
+
+// WithArgon2KeyLength sets the derived key length in bytes
+func WithArgon2KeyLength(length uint32) Argon2Option {
+	return func(h *Argon2Hasher) {
+		h.keyLength = length
+	}
+}
+
+// WithArgon2Pepper sets the pepper used for new hashes. The password is
+// HMAC-SHA256'd with secret before hashing, and keyID is stored in the
+// encoded hash so the pepper can be rotated later. keyID must only
+// contain letters, digits, '-' and '_'.
+func WithArgon2Pepper(keyID string, secret []byte) Argon2Option {
+	return func(h *Argon2Hasher) {
+		h.addPepper(keyID, secret)
+		h.pepperID = keyID
+	}
+}
+
+// WithArgon2LegacyPepper registers a retired pepper that is still accepted
+// when verifying existing hashes. Hashes using it are reported by NeedsRehash.
+func WithArgon2LegacyPepper(keyID string, secret []byte) Argon2Option {
+	return func(h *Argon2Hasher) {
+		h.addPepper(keyID, secret)
+	}
 }
 
-// NewArgon2Hasher creates a new Argon2 password hasher with recommended parameters
-func NewArgon2Hasher() *Argon2Hasher {
-	return &Argon2Hasher{
+// NewArgon2Hasher creates a new Argon2 password hasher with recommended
+// parameters. Options below the minimum parameters, or with an invalid
+// pepper key ID, are an error.
+func NewArgon2Hasher(opts ...Argon2Option) (*Argon2Hasher, error) {
+	h := &Argon2Hasher{
 		memory:      64 * 1024, // 64 MB
 		iterations:  3,
 		parallelism: 2,
 		saltLength:  16,
 		keyLength:   32,
 	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	if err := h.validate(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *Argon2Hasher) validate() error {
+	switch {
+	case h.memory < MinArgon2Memory:
+		return fmt.Errorf("argon2 memory must be at least %d KiB", MinArgon2Memory)
+	case h.iterations < 1:
+		return fmt.Errorf("argon2 iterations must be at least 1")
+	case h.parallelism < 1:
+		return fmt.Errorf("argon2 parallelism must be at least 1")
+	case h.saltLength < MinArgon2SaltLength:
+		return fmt.Errorf("argon2 salt length must be at least %d bytes", MinArgon2SaltLength)
+	case h.keyLength < MinArgon2KeyLength:
+		return fmt.Errorf("argon2 key length must be at least %d bytes", MinArgon2KeyLength)
+	}
+	for keyID := range h.peppers {
+		if !validPepperID(keyID) {
+			return fmt.Errorf("invalid pepper key ID: %q", keyID)
+		}
+	}
+	return nil
+}
+
+func (h *Argon2Hasher) addPepper(keyID string, secret []byte) {
+	if h.peppers == nil {
+		h.peppers = make(map[string][]byte)
+	}
+	h.peppers[keyID] = secret
+}
+
+// pepper applies the pepper identified by keyID to the password.
+// An empty keyID means the hash was created without a pepper.
+func (h *Argon2Hasher) pepper(password, keyID string) ([]byte, error) {
+	if keyID == "" {
+		return []byte(password), nil
+	}
+
+	secret, ok := h.peppers[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown pepper key: %s", keyID)
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(password))
+	return mac.Sum(nil), nil
 }
 
 // Hash hashes a password using Argon2id
 func (h *Argon2Hasher) Hash(password string) (string, error) {
+	input, err := h.pepper(password, h.pepperID)
+	if err != nil {
+		return "", err
+	}
+
 	// Generate a random salt
 	salt := make([]byte, h.saltLength)
 	if _, err := rand.Read(salt); err != nil {
@@ -46,7 +178,7 @@ func (h *Argon2Hasher) Hash(password string) (string, error) {
 
 	// Hash the password
 	hash := argon2.IDKey(
-		[]byte(password),
+		input,
 		salt,
 		h.iterations,
 		h.memory,
@@ -56,15 +188,19 @@ func (h *Argon2Hasher) Hash(password string) (string, error) {
 
 	// Encode the hash with parameters
 	// Format: $argon2id$v=19$m=65536,t=3,p=2$salt$hash
+	// With a pepper: $argon2id$v=19$m=65536,t=3,p=2,k=<keyID>$salt$hash
 	b64Salt := base64.RawStdEncoding.EncodeToString(salt)
 	b64Hash := base64.RawStdEncoding.EncodeToString(hash)
 
+	params := fmt.Sprintf("m=%d,t=%d,p=%d", h.memory, h.iterations, h.parallelism)
+	if h.pepperID != "" {
+		params += ",k=" + h.pepperID
+	}
+
 	encoded := fmt.Sprintf(
-		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		"$argon2id$v=%d$%s$%s$%s",
 		argon2.Version,
-		h.memory,
-		h.iterations,
-		h.parallelism,
+		params,
 		b64Salt,
 		b64Hash,
 	)
@@ -72,49 +208,127 @@ func (h *Argon2Hasher) Hash(password string) (string, error) {
 	return encoded, nil
 }
 
-// Verify verifies a password against a hash
-func (h *Argon2Hasher) Verify(password, encodedHash string) (bool, error) {
-	// Parse the encoded hash
+// argon2Params holds the parameters parsed from an encoded Argon2id hash
+type argon2Params struct {
+	version     int
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	pepperID    string
+	salt        []byte
+	hash        []byte
+}
+
+func parseArgon2Hash(encodedHash string) (*argon2Params, error) {
 	parts := strings.Split(encodedHash, "$")
 	if len(parts) != 6 {
-		return false, fmt.Errorf("invalid hash format")
+		return nil, fmt.Errorf("invalid hash format")
 	}
 
 	if parts[1] != "argon2id" {
-		return false, fmt.Errorf("unsupported algorithm: %s", parts[1])
+		return nil, fmt.Errorf("unsupported algorithm: %s", parts[1])
 	}
 
-	var version int
-	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
-		return false, fmt.Errorf("invalid version: %w", err)
+	params := &argon2Params{}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &params.version); err != nil {
+		return nil, fmt.Errorf("invalid version: %w", err)
 	}
 
-	var memory, iterations uint32
-	var parallelism uint8
-	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &parallelism); err != nil {
-		return false, fmt.Errorf("invalid parameters: %w", err)
+	// An optional trailing k=<keyID> identifies the pepper
+	costs := parts[3]
+	if idx := strings.Index(costs, ",k="); idx != -1 {
+		params.pepperID = costs[idx+3:]
+		costs = costs[:idx]
+	}
+	if _, err := fmt.Sscanf(costs, "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+	if params.iterations < 1 || params.parallelism < 1 {
+		return nil, fmt.Errorf("invalid parameters: t=%d, p=%d", params.iterations, params.parallelism)
 	}
 
 	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
 	if err != nil {
-		return false, fmt.Errorf("invalid salt: %w", err)
+		return nil, fmt.Errorf("invalid salt: %w", err)
 	}
+	params.salt = salt
 
 	hash, err := base64.RawStdEncoding.DecodeString(parts[5])
 	if err != nil {
-		return false, fmt.Errorf("invalid hash: %w", err)
+		return nil, fmt.Errorf("invalid hash: %w", err)
+	}
+	params.hash = hash
+
+	return params, nil
+}
+
+// Verify verifies a password against a hash
+func (h *Argon2Hasher) Verify(password, encodedHash string) (bool, error) {
+	params, err := parseArgon2Hash(encodedHash)
+	if err != nil {
+		return false, err
+	}
+
+	input, err := h.pepper(password, params.pepperID)
+	if err != nil {
+		return false, err
 	}
 
 	// Hash the password with the same parameters
 	newHash := argon2.IDKey(
-		[]byte(password),
-		salt,
-		iterations,
-		memory,
-		parallelism,
-		uint32(len(hash)),
+		input,
+		params.salt,
+		params.iterations,
+		params.memory,
+		params.parallelism,
+		uint32(len(params.hash)),
 	)
 
 	// Compare hashes using constant-time comparison
-	return subtle.ConstantTimeCompare(hash, newHash) == 1, nil
+	return subtle.ConstantTimeCompare(params.hash, newHash) == 1, nil
+}
+
+// Algorithm returns the algorithm produced by this hasher
+func (h *Argon2Hasher) Algorithm() Algorithm {
+	return AlgorithmArgon2id
+}
+
+// DescribeSecurity reports the Argon2id parameters and whether a pepper is
+// applied to new hashes
+func (h *Argon2Hasher) DescribeSecurity() map[string]interface{} {
+	return map[string]interface{}{
+		"algorithm":   string(AlgorithmArgon2id),
+		"memoryKiB":   h.memory,
+		"iterations":  h.iterations,
+		"parallelism": h.parallelism,
+		"keyLength":   h.keyLength,
+		"pepper":      h.pepperID != "",
+	}
+}
+
+// NeedsRehash reports whether the hash was created with different
+// parameters or a different pepper
+func (h *Argon2Hasher) NeedsRehash(encodedHash string) bool {
+	params, err := parseArgon2Hash(encodedHash)
+	if err != nil {
+		return true
+	}
+
+	return params.version != argon2.Version ||
+		params.memory != h.memory ||
+		params.iterations != h.iterations ||
+		params.parallelism != h.parallelism ||
+		uint32(len(params.hash)) != h.keyLength ||
+		params.pepperID != h.pepperID
+}
+
+func validPepperID(keyID string) bool {
+	for _, c := range keyID {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
 }
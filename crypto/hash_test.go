@@ -5,8 +5,17 @@ import (
 	"testing"
 )
 
+func newArgon2Hasher(tb testing.TB, opts ...Argon2Option) *Argon2Hasher {
+	tb.Helper()
+	h, err := NewArgon2Hasher(opts...)
+	if err != nil {
+		tb.Fatalf("NewArgon2Hasher() error = %v", err)
+	}
+	return h
+}
+
 func TestArgon2Hasher_Hash(t *testing.T) {
-	hasher := NewArgon2Hasher()
+	hasher := newArgon2Hasher(t)
 
 	password := "my-secure-password-123"
 	hash, err := hasher.Hash(password)
@@ -35,7 +44,7 @@ func TestArgon2Hasher_Hash(t *testing.T) {
 }
 
 func TestArgon2Hasher_Verify(t *testing.T) {
-	hasher := NewArgon2Hasher()
+	hasher := newArgon2Hasher(t)
 
 	password := "my-secure-password-123"
 	hash, err := hasher.Hash(password)
@@ -65,7 +74,7 @@ func TestArgon2Hasher_Verify(t *testing.T) {
 }
 
 func TestArgon2Hasher_VerifyInvalidFormat(t *testing.T) {
-	hasher := NewArgon2Hasher()
+	hasher := newArgon2Hasher(t)
 
 	tests := []struct {
 		name string
@@ -96,7 +105,7 @@ func TestArgon2Hasher_VerifyInvalidFormat(t *testing.T) {
 }
 
 func TestArgon2Hasher_ConstantTime(t *testing.T) {
-	hasher := NewArgon2Hasher()
+	hasher := newArgon2Hasher(t)
 
 	password := "my-secure-password-123"
 	hash, _ := hasher.Hash(password)
@@ -109,7 +118,7 @@ func TestArgon2Hasher_ConstantTime(t *testing.T) {
 }
 
 func BenchmarkArgon2Hasher_Hash(b *testing.B) {
-	hasher := NewArgon2Hasher()
+	hasher := newArgon2Hasher(b)
 	password := "benchmark-password"
 
 	b.ResetTimer()
@@ -119,7 +128,7 @@ func BenchmarkArgon2Hasher_Hash(b *testing.B) {
 }
 
 func BenchmarkArgon2Hasher_Verify(b *testing.B) {
-	hasher := NewArgon2Hasher()
+	hasher := newArgon2Hasher(b)
 	password := "benchmark-password"
 	hash, _ := hasher.Hash(password)
 
@@ -128,3 +137,186 @@ func BenchmarkArgon2Hasher_Verify(b *testing.B) {
 		hasher.Verify(password, hash)
 	}
 }
+
+// BenchmarkArgon2Hasher_Settings compares the cost of parameter choices, to
+// size Argon2 for the sign-in latency a deployment can afford
+func BenchmarkArgon2Hasher_Settings(b *testing.B) {
+	for _, bc := range []struct {
+		name        string
+		memory      uint32
+		iterations  uint32
+		parallelism uint8
+	}{
+		{"Default", 64 * 1024, 3, 2},
+		{"OWASP-19MiB-t2", 19 * 1024, 2, 1},
+		{"OWASP-46MiB-t1", 46 * 1024, 1, 1},
+		{"Light-8MiB-t1", 8 * 1024, 1, 1},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			hasher := newArgon2Hasher(b,
+				WithArgon2Memory(bc.memory),
+				WithArgon2Iterations(bc.iterations),
+				WithArgon2Parallelism(bc.parallelism),
+			)
+			hash, err := hasher.Hash("benchmark-password")
+			if err != nil {
+				b.Fatalf("Hash() error = %v", err)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := hasher.Verify("benchmark-password", hash); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestArgon2Hasher_Options(t *testing.T) {
+	hasher := newArgon2Hasher(t,
+		WithArgon2Memory(8*1024),
+		WithArgon2Iterations(1),
+		WithArgon2Parallelism(1),
+		WithArgon2SaltLength(16),
+		WithArgon2KeyLength(16),
+	)
+
+	password := "my-secure-password-123"
+	hash, err := hasher.Hash(password)
+	if err != nil {
+		t.Fatalf("Hash failed: %v", err)
+	}
+
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=8192,t=1,p=1$") {
+		t.Errorf("Expected custom parameters in hash, got %s", hash)
+	}
+
+	// Hashes created with other parameters still verify
+	valid, err := newArgon2Hasher(t).Verify(password, hash)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if !valid {
+		t.Error("Expected password to be valid")
+	}
+
+	if hasher.NeedsRehash(hash) {
+		t.Error("Expected hash with current parameters not to need rehash")
+	}
+	if !newArgon2Hasher(t).NeedsRehash(hash) {
+		t.Error("Expected hash with different parameters to need rehash")
+	}
+}
+
+func TestNewArgon2Hasher_Validation(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opt  Argon2Option
+	}{
+		{"memory", WithArgon2Memory(MinArgon2Memory - 1)},
+		{"iterations", WithArgon2Iterations(0)},
+		{"parallelism", WithArgon2Parallelism(0)},
+		{"salt length", WithArgon2SaltLength(MinArgon2SaltLength - 1)},
+		{"key length", WithArgon2KeyLength(MinArgon2KeyLength - 1)},
+		{"legacy pepper key ID", WithArgon2LegacyPepper("bad id", []byte("secret"))},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewArgon2Hasher(tt.opt); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+
+	// Stored hashes with zero costs are rejected instead of panicking
+	hasher := newArgon2Hasher(t, WithArgon2Memory(MinArgon2Memory), WithArgon2Iterations(1))
+	for _, hash := range []string{
+		"$argon2id$v=19$m=8192,t=0,p=1$c2FsdHNhbHRzYWx0c2FsdA$aGFzaGhhc2hoYXNoaGFzaA",
+		"$argon2id$v=19$m=8192,t=1,p=0$c2FsdHNhbHRzYWx0c2FsdA$aGFzaGhhc2hoYXNoaGFzaA",
+	} {
+		if _, err := hasher.Verify("password", hash); err == nil {
+			t.Errorf("Expected an error for %s", hash)
+		}
+	}
+}
+
+func TestArgon2Hasher_Pepper(t *testing.T) {
+	password := "my-secure-password-123"
+	lowCost := []Argon2Option{WithArgon2Memory(8 * 1024), WithArgon2Iterations(1)}
+
+	v1 := newArgon2Hasher(t, append(lowCost, WithArgon2Pepper("v1", []byte("pepper-one")))...)
+	hash, err := v1.Hash(password)
+	if err != nil {
+		t.Fatalf("Hash failed: %v", err)
+	}
+
+	if !strings.Contains(hash, ",k=v1$") {
+		t.Errorf("Expected pepper key ID in hash, got %s", hash)
+	}
+
+	valid, err := v1.Verify(password, hash)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if !valid {
+		t.Error("Expected password to be valid")
+	}
+
+	// Without the pepper the hash cannot be verified
+	if _, err := newArgon2Hasher(t, lowCost...).Verify(password, hash); err == nil {
+		t.Error("Expected error for unknown pepper key")
+	}
+
+	// Same key ID with a different secret rejects the password
+	wrong := newArgon2Hasher(t, append(lowCost, WithArgon2Pepper("v1", []byte("other")))...)
+	valid, err = wrong.Verify(password, hash)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if valid {
+		t.Error("Expected password to be invalid with wrong pepper")
+	}
+
+	// Rotation: v2 is current, v1 is still accepted but needs rehash
+	v2 := newArgon2Hasher(t, append(lowCost,
+		WithArgon2Pepper("v2", []byte("pepper-two")),
+		WithArgon2LegacyPepper("v1", []byte("pepper-one")),
+	)...)
+
+	valid, err = v2.Verify(password, hash)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if !valid {
+		t.Error("Expected password to be valid with legacy pepper")
+	}
+	if !v2.NeedsRehash(hash) {
+		t.Error("Expected hash with legacy pepper to need rehash")
+	}
+
+	rehashed, err := v2.Hash(password)
+	if err != nil {
+		t.Fatalf("Hash failed: %v", err)
+	}
+	if v2.NeedsRehash(rehashed) {
+		t.Error("Expected hash with current pepper not to need rehash")
+	}
+
+	// Unpeppered hashes verify and are upgraded
+	plain, err := newArgon2Hasher(t, lowCost...).Hash(password)
+	if err != nil {
+		t.Fatalf("Hash failed: %v", err)
+	}
+	valid, err = v2.Verify(password, plain)
+	if err != nil || !valid {
+		t.Errorf("Expected unpeppered hash to verify, got valid=%v err=%v", valid, err)
+	}
+	if !v2.NeedsRehash(plain) {
+		t.Error("Expected unpeppered hash to need rehash")
+	}
+
+	if _, err := NewArgon2Hasher(WithArgon2Pepper("bad$id", []byte("secret"))); err == nil {
+		t.Error("Expected error for invalid pepper key ID")
+	}
+}
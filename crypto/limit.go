@@ -0,0 +1,162 @@
+package crypto
+
+import (
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultHashQueueTimeout is how long a hash waits for a free slot when
+// HashLimit.QueueTimeout is not set
+const DefaultHashQueueTimeout = 5 * time.Second
+
+// ErrHasherBusy is returned by a LimitedHasher when no slot freed up
+// within the queue timeout. Callers should answer 503 and let the client
+// retry.
+var ErrHasherBusy = errors.New("password hasher is busy")
+
+// HashLimit configures a LimitedHasher
+type HashLimit struct {
+	// MaxConcurrent is how many hashes and verifications run at once
+	// (0 = runtime.NumCPU()). With Argon2 each one holds its memory cost,
+	// so peak hashing memory is about MaxConcurrent times that cost.
+	MaxConcurrent int
+
+	// QueueTimeout is how long a call waits for a free slot before it
+	// fails with ErrHasherBusy (0 = DefaultHashQueueTimeout)
+	QueueTimeout time.Duration
+}
+
+// HashStats reports the load of a LimitedHasher. InFlight and Queued are
+// current values; the other counters only grow.
+type HashStats struct {
+	MaxConcurrent int   `json:"maxConcurrent"`
+	InFlight      int64 `json:"inFlight"`
+	Queued        int64 `json:"queued"`
+
+	// Saturated counts calls that found every slot taken and had to wait
+	Saturated uint64 `json:"saturated"`
+
+	// Rejected counts calls that failed with ErrHasherBusy
+	Rejected uint64 `json:"rejected"`
+}
+
+// LimitedHasher bounds how many password hashes and verifications run at
+// once, so a burst of sign-ins queues instead of exhausting memory. Calls
+// beyond the limit wait for a free slot, in no particular order, and fail
+// with ErrHasherBusy after the queue timeout.
+type LimitedHasher struct {
+	hasher  PasswordHasher
+	slots   chan struct{}
+	timeout time.Duration
+
+	inFlight  atomic.Int64
+	queued    atomic.Int64
+	saturated atomic.Uint64
+	rejected  atomic.Uint64
+}
+
+// NewLimitedHasher wraps hasher with a concurrency limit
+func NewLimitedHasher(hasher PasswordHasher, limit HashLimit) *LimitedHasher {
+	size := limit.MaxConcurrent
+	if size <= 0 {
+		size = runtime.NumCPU()
+	}
+	timeout := limit.QueueTimeout
+	if timeout <= 0 {
+		timeout = DefaultHashQueueTimeout
+	}
+	return &LimitedHasher{
+		hasher:  hasher,
+		slots:   make(chan struct{}, size),
+		timeout: timeout,
+	}
+}
+
+// Hash hashes a password once a slot is free
+func (h *LimitedHasher) Hash(password string) (string, error) {
+	if err := h.acquire(); err != nil {
+		return "", err
+	}
+	defer h.release()
+	return h.hasher.Hash(password)
+}
+
+// Verify verifies a password once a slot is free
+func (h *LimitedHasher) Verify(password, encodedHash string) (bool, error) {
+	if err := h.acquire(); err != nil {
+		return false, err
+	}
+	defer h.release()
+	return h.hasher.Verify(password, encodedHash)
+}
+
+// Algorithm returns the algorithm of the wrapped hasher, if it reports one
+func (h *LimitedHasher) Algorithm() Algorithm {
+	if a, ok := h.hasher.(AlgorithmHasher); ok {
+		return a.Algorithm()
+	}
+	return AlgorithmUnknown
+}
+
+// NeedsRehash reports whether the wrapped hasher wants the hash replaced.
+// It does not hash and takes no slot.
+func (h *LimitedHasher) NeedsRehash(encodedHash string) bool {
+	if rehasher, ok := h.hasher.(interface{ NeedsRehash(string) bool }); ok {
+		return rehasher.NeedsRehash(encodedHash)
+	}
+	return false
+}
+
+// DescribeSecurity describes the wrapped hasher and the limit
+func (h *LimitedHasher) DescribeSecurity() map[string]interface{} {
+	desc := map[string]interface{}{}
+	if d, ok := h.hasher.(interface{ DescribeSecurity() map[string]interface{} }); ok {
+		desc = d.DescribeSecurity()
+	}
+	desc["maxConcurrent"] = cap(h.slots)
+	desc["queueTimeout"] = h.timeout.String()
+	return desc
+}
+
+// Stats returns the current load. A growing Saturated count means sign-ins
+// queue for the hasher; a growing Rejected count means they fail.
+func (h *LimitedHasher) Stats() HashStats {
+	return HashStats{
+		MaxConcurrent: cap(h.slots),
+		InFlight:      h.inFlight.Load(),
+		Queued:        h.queued.Load(),
+		Saturated:     h.saturated.Load(),
+		Rejected:      h.rejected.Load(),
+	}
+}
+
+func (h *LimitedHasher) acquire() error {
+	select {
+	case h.slots <- struct{}{}:
+		h.inFlight.Add(1)
+		return nil
+	default:
+	}
+
+	h.saturated.Add(1)
+	h.queued.Add(1)
+	defer h.queued.Add(-1)
+
+	timer := time.NewTimer(h.timeout)
+	defer timer.Stop()
+	select {
+	case h.slots <- struct{}{}:
+		h.inFlight.Add(1)
+		return nil
+	case <-timer.C:
+		h.rejected.Add(1)
+		return ErrHasherBusy
+	}
+}
+
+func (h *LimitedHasher) release() {
+	h.inFlight.Add(-1)
+	<-h.slots
+}
@@ -0,0 +1,123 @@
+package crypto
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingHasher holds every call until release is closed
+type blockingHasher struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (h *blockingHasher) Hash(password string) (string, error) {
+	h.started <- struct{}{}
+	<-h.release
+	return "hash:" + password, nil
+}
+
+func (h *blockingHasher) Verify(password, hash string) (bool, error) {
+	h.started <- struct{}{}
+	<-h.release
+	return hash == "hash:"+password, nil
+}
+
+// fillSlots starts n hashes that hold their slot until inner is released
+func fillSlots(t *testing.T, hasher *LimitedHasher, inner *blockingHasher, n int) *sync.WaitGroup {
+	t.Helper()
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := hasher.Hash("password"); err != nil {
+				t.Errorf("Hash() error = %v", err)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		<-inner.started
+	}
+	return &wg
+}
+
+func TestLimitedHasher_Rejects(t *testing.T) {
+	inner := &blockingHasher{started: make(chan struct{}, 2), release: make(chan struct{})}
+	hasher := NewLimitedHasher(inner, HashLimit{MaxConcurrent: 2, QueueTimeout: 20 * time.Millisecond})
+	wg := fillSlots(t, hasher, inner, 2)
+
+	if _, err := hasher.Verify("password", "hash:password"); !errors.Is(err, ErrHasherBusy) {
+		t.Fatalf("Verify() error = %v, want ErrHasherBusy", err)
+	}
+	stats := hasher.Stats()
+	if stats.MaxConcurrent != 2 || stats.InFlight != 2 || stats.Queued != 0 || stats.Saturated != 1 || stats.Rejected != 1 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+
+	close(inner.release)
+	wg.Wait()
+	if stats := hasher.Stats(); stats.InFlight != 0 {
+		t.Errorf("Stats() after release = %+v", stats)
+	}
+}
+
+func TestLimitedHasher_Queues(t *testing.T) {
+	inner := &blockingHasher{started: make(chan struct{}, 2), release: make(chan struct{})}
+	hasher := NewLimitedHasher(inner, HashLimit{MaxConcurrent: 1, QueueTimeout: 5 * time.Second})
+	wg := fillSlots(t, hasher, inner, 1)
+
+	done := make(chan error)
+	go func() {
+		_, err := hasher.Verify("password", "hash:password")
+		done <- err
+	}()
+	deadline := time.Now().Add(time.Second)
+	for hasher.Stats().Queued != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("Verify() did not queue")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The queued call runs as soon as the slot frees up
+	close(inner.release)
+	if err := <-done; err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	wg.Wait()
+	if stats := hasher.Stats(); stats.InFlight != 0 || stats.Queued != 0 || stats.Saturated != 1 || stats.Rejected != 0 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+func TestLimitedHasher_Passthrough(t *testing.T) {
+	argon := newArgon2Hasher(t, WithArgon2Memory(MinArgon2Memory), WithArgon2Iterations(1), WithArgon2Parallelism(1))
+	hasher := NewLimitedHasher(argon, HashLimit{})
+
+	if got := cap(hasher.slots); got < 1 {
+		t.Errorf("default MaxConcurrent = %d", got)
+	}
+	if hasher.timeout != DefaultHashQueueTimeout {
+		t.Errorf("default QueueTimeout = %v", hasher.timeout)
+	}
+
+	hash, err := hasher.Hash("password")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	if ok, err := hasher.Verify("password", hash); err != nil || !ok {
+		t.Errorf("Verify() = %v, %v", ok, err)
+	}
+	if hasher.NeedsRehash(hash) {
+		t.Error("NeedsRehash() = true for a current hash")
+	}
+	if hasher.Algorithm() != argon.Algorithm() {
+		t.Errorf("Algorithm() = %q", hasher.Algorithm())
+	}
+	if desc := hasher.DescribeSecurity(); desc["maxConcurrent"] != cap(hasher.slots) || desc["algorithm"] == nil {
+		t.Errorf("DescribeSecurity() = %v", desc)
+	}
+}
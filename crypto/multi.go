@@ -0,0 +1,125 @@
+package crypto
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Algorithm identifies the algorithm used to produce a password hash
+type Algorithm string
+
+const (
+	AlgorithmUnknown  Algorithm = ""
+	AlgorithmArgon2id Algorithm = "argon2id"
+	AlgorithmBcrypt   Algorithm = "bcrypt"
+	AlgorithmScrypt   Algorithm = "scrypt"
+)
+
+// AlgorithmHasher is a PasswordHasher that reports the algorithm it produces
+type AlgorithmHasher interface {
+	PasswordHasher
+	Algorithm() Algorithm
+}
+
+// DetectAlgorithm returns the algorithm of an encoded password hash
+func DetectAlgorithm(encodedHash string) Algorithm {
+	switch {
+	case strings.HasPrefix(encodedHash, "$argon2id$"):
+		return AlgorithmArgon2id
+	case strings.HasPrefix(encodedHash, "$scrypt$"):
+		return AlgorithmScrypt
+	case strings.HasPrefix(encodedHash, "$2a$"),
+		strings.HasPrefix(encodedHash, "$2b$"),
+		strings.HasPrefix(encodedHash, "$2y$"):
+		return AlgorithmBcrypt
+	default:
+		return AlgorithmUnknown
+	}
+}
+
+// MultiHasher hashes new passwords with a primary hasher and verifies
+// hashes produced by any registered algorithm. Hashes that were not
+// produced by the primary hasher are reported by NeedsRehash so callers
+// can upgrade them after a successful login.
+type MultiHasher struct {
+	primary AlgorithmHasher
+	hashers map[Algorithm]AlgorithmHasher
+}
+
+// NewMultiHasher creates a hasher that uses primary for new hashes and
+// additionally accepts hashes produced by the legacy hashers
+func NewMultiHasher(primary AlgorithmHasher, legacy ...AlgorithmHasher) *MultiHasher {
+	hashers := make(map[Algorithm]AlgorithmHasher, len(legacy)+1)
+	for _, h := range legacy {
+		hashers[h.Algorithm()] = h
+	}
+	hashers[primary.Algorithm()] = primary
+
+	return &MultiHasher{
+		primary: primary,
+		hashers: hashers,
+	}
+}
+
+// NewDefaultHasher creates the default password hasher: Argon2id for new
+// hashes, with bcrypt and scrypt accepted for migration
+func NewDefaultHasher() *MultiHasher {
+	// The default parameters are valid
+	argon, _ := NewArgon2Hasher()
+	return NewMultiHasher(argon, NewBcryptHasher(0), NewScryptHasher())
+}
+
+// Algorithm returns the algorithm used for new hashes
+func (h *MultiHasher) Algorithm() Algorithm {
+	return h.primary.Algorithm()
+}
+
+// DescribeSecurity describes the primary hasher and lists the legacy
+// algorithms that are still accepted
+func (h *MultiHasher) DescribeSecurity() map[string]interface{} {
+	desc := map[string]interface{}{"algorithm": string(h.primary.Algorithm())}
+	if d, ok := h.primary.(interface{ DescribeSecurity() map[string]interface{} }); ok {
+		desc = d.DescribeSecurity()
+	}
+
+	var legacy []string
+	for algorithm := range h.hashers {
+		if algorithm != h.primary.Algorithm() {
+			legacy = append(legacy, string(algorithm))
+		}
+	}
+	if len(legacy) > 0 {
+		sort.Strings(legacy)
+		desc["legacyAlgorithms"] = legacy
+	}
+
+	return desc
+}
+
+// Hash hashes a password using the primary hasher
+func (h *MultiHasher) Hash(password string) (string, error) {
+	return h.primary.Hash(password)
+}
+
+// Verify verifies a password against a hash produced by any registered algorithm
+func (h *MultiHasher) Verify(password, encodedHash string) (bool, error) {
+	algorithm := DetectAlgorithm(encodedHash)
+	hasher, ok := h.hashers[algorithm]
+	if !ok {
+		return false, fmt.Errorf("unsupported hash algorithm")
+	}
+	return hasher.Verify(password, encodedHash)
+}
+
+// NeedsRehash reports whether the hash should be replaced with a new hash
+// from the primary hasher
+func (h *MultiHasher) NeedsRehash(encodedHash string) bool {
+	if DetectAlgorithm(encodedHash) != h.primary.Algorithm() {
+		return true
+	}
+	if rehasher, ok := h.primary.(interface{ NeedsRehash(string) bool }); ok {
+		return rehasher.NeedsRehash(encodedHash)
+	}
+	return false
+}
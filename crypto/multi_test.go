@@ -0,0 +1,192 @@
+package crypto
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBcryptHasher_Verify(t *testing.T) {
+	hasher := NewBcryptHasher(4)
+
+	password := "my-secure-password-123"
+	hash, err := hasher.Hash(password)
+	if err != nil {
+		t.Fatalf("Hash failed: %v", err)
+	}
+
+	if !strings.HasPrefix(hash, "$2a$04$") {
+		t.Errorf("Expected bcrypt hash with cost 4, got %s", hash)
+	}
+
+	valid, err := hasher.Verify(password, hash)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if !valid {
+		t.Error("Expected password to be valid")
+	}
+
+	valid, err = hasher.Verify("wrong-password", hash)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if valid {
+		t.Error("Expected password to be invalid")
+	}
+
+	if _, err := hasher.Verify(password, "not-a-bcrypt-hash"); err == nil {
+		t.Error("Expected error for invalid hash")
+	}
+
+	if hasher.NeedsRehash(hash) {
+		t.Error("Expected hash with current cost not to need rehash")
+	}
+	if !NewBcryptHasher(5).NeedsRehash(hash) {
+		t.Error("Expected hash with different cost to need rehash")
+	}
+}
+
+func TestScryptHasher_Verify(t *testing.T) {
+	hasher := NewScryptHasher()
+
+	password := "my-secure-password-123"
+	hash, err := hasher.Hash(password)
+	if err != nil {
+		t.Fatalf("Hash failed: %v", err)
+	}
+
+	if !strings.HasPrefix(hash, "$scrypt$ln=15,r=8,p=1$") {
+		t.Errorf("Unexpected scrypt hash format: %s", hash)
+	}
+
+	valid, err := hasher.Verify(password, hash)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if !valid {
+		t.Error("Expected password to be valid")
+	}
+
+	valid, err = hasher.Verify("wrong-password", hash)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if valid {
+		t.Error("Expected password to be invalid")
+	}
+
+	invalidHashes := []string{
+		"invalid",
+		"$argon2id$v=19$m=65536,t=3,p=2$salt$hash",
+		"$scrypt$ln=abc,r=8,p=1$c2FsdA$aGFzaA",
+		"$scrypt$ln=0,r=8,p=1$c2FsdA$aGFzaA",
+	}
+	for _, invalidHash := range invalidHashes {
+		if _, err := hasher.Verify(password, invalidHash); err == nil {
+			t.Errorf("Expected error for invalid hash: %s", invalidHash)
+		}
+	}
+
+	if hasher.NeedsRehash(hash) {
+		t.Error("Expected hash with current parameters not to need rehash")
+	}
+}
+
+func TestDetectAlgorithm(t *testing.T) {
+	tests := []struct {
+		hash     string
+		expected Algorithm
+	}{
+		{"$argon2id$v=19$m=65536,t=3,p=2$salt$hash", AlgorithmArgon2id},
+		{"$2a$10$abcdefghijklmnopqrstuv", AlgorithmBcrypt},
+		{"$2b$10$abcdefghijklmnopqrstuv", AlgorithmBcrypt},
+		{"$2y$10$abcdefghijklmnopqrstuv", AlgorithmBcrypt},
+		{"$scrypt$ln=15,r=8,p=1$salt$hash", AlgorithmScrypt},
+		{"$argon2i$v=19$m=65536,t=3,p=2$salt$hash", AlgorithmUnknown},
+		{"plaintext", AlgorithmUnknown},
+		{"", AlgorithmUnknown},
+	}
+
+	for _, tt := range tests {
+		if got := DetectAlgorithm(tt.hash); got != tt.expected {
+			t.Errorf("DetectAlgorithm(%q) = %q, expected %q", tt.hash, got, tt.expected)
+		}
+	}
+}
+
+func TestMultiHasher(t *testing.T) {
+	hasher := NewDefaultHasher()
+	password := "my-secure-password-123"
+
+	hash, err := hasher.Hash(password)
+	if err != nil {
+		t.Fatalf("Hash failed: %v", err)
+	}
+	if DetectAlgorithm(hash) != AlgorithmArgon2id {
+		t.Errorf("Expected new hashes to use argon2id, got %s", hash)
+	}
+	if hasher.NeedsRehash(hash) {
+		t.Error("Expected argon2id hash not to need rehash")
+	}
+
+	legacyHashers := []AlgorithmHasher{NewBcryptHasher(4), NewScryptHasher()}
+	for _, legacy := range legacyHashers {
+		t.Run(string(legacy.Algorithm()), func(t *testing.T) {
+			legacyHash, err := legacy.Hash(password)
+			if err != nil {
+				t.Fatalf("Hash failed: %v", err)
+			}
+
+			valid, err := hasher.Verify(password, legacyHash)
+			if err != nil {
+				t.Fatalf("Verify failed: %v", err)
+			}
+			if !valid {
+				t.Error("Expected legacy hash to verify")
+			}
+
+			valid, err = hasher.Verify("wrong-password", legacyHash)
+			if err != nil {
+				t.Fatalf("Verify failed: %v", err)
+			}
+			if valid {
+				t.Error("Expected wrong password to be rejected")
+			}
+
+			if !hasher.NeedsRehash(legacyHash) {
+				t.Error("Expected legacy hash to need rehash")
+			}
+		})
+	}
+
+	if _, err := hasher.Verify(password, "plaintext"); err == nil {
+		t.Error("Expected error for unknown hash format")
+	}
+}
+
+func TestArgon2Hasher_NeedsRehash(t *testing.T) {
+	hasher := newArgon2Hasher(t)
+
+	if !hasher.NeedsRehash("$argon2id$v=19$m=4096,t=1,p=1$c2FsdA$aGFzaA") {
+		t.Error("Expected hash with weaker parameters to need rehash")
+	}
+
+	if !hasher.NeedsRehash("$2a$10$abcdefghijklmnopqrstuv") {
+		t.Error("Expected non-argon2id hash to need rehash")
+	}
+}
+
+func TestMultiHasher_DescribeSecurity(t *testing.T) {
+	desc := NewDefaultHasher().DescribeSecurity()
+
+	if desc["algorithm"] != string(AlgorithmArgon2id) {
+		t.Errorf("algorithm = %v, want %s", desc["algorithm"], AlgorithmArgon2id)
+	}
+	if _, ok := desc["memoryKiB"]; !ok {
+		t.Error("expected Argon2id parameters in description")
+	}
+	legacy, _ := desc["legacyAlgorithms"].([]string)
+	if len(legacy) != 2 || legacy[0] != string(AlgorithmBcrypt) || legacy[1] != string(AlgorithmScrypt) {
+		t.Errorf("legacyAlgorithms = %v, want [bcrypt scrypt]", desc["legacyAlgorithms"])
+	}
+}
@@ -0,0 +1,124 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// ScryptHasher implements PasswordHasher using scrypt
+type ScryptHasher struct {
+	logN       uint8
+	r          int
+	p          int
+	saltLength uint32
+	keyLength  uint32
+}
+
+// NewScryptHasher creates a new scrypt password hasher with recommended parameters
+func NewScryptHasher() *ScryptHasher {
+	return &ScryptHasher{
+		logN:       15, // N = 32768
+		r:          8,
+		p:          1,
+		saltLength: 16,
+		keyLength:  32,
+	}
+}
+
+// Algorithm returns the algorithm produced by this hasher
+func (h *ScryptHasher) Algorithm() Algorithm {
+	return AlgorithmScrypt
+}
+
+// DescribeSecurity reports the scrypt cost parameters
+func (h *ScryptHasher) DescribeSecurity() map[string]interface{} {
+	return map[string]interface{}{
+		"algorithm": string(AlgorithmScrypt),
+		"N":         1 << h.logN,
+		"r":         h.r,
+		"p":         h.p,
+	}
+}
+
+// Hash hashes a password using scrypt
+func (h *ScryptHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	hash, err := scrypt.Key([]byte(password), salt, 1<<h.logN, h.r, h.p, int(h.keyLength))
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	// Format: $scrypt$ln=15,r=8,p=1$salt$hash
+	return fmt.Sprintf(
+		"$scrypt$ln=%d,r=%d,p=%d$%s$%s",
+		h.logN,
+		h.r,
+		h.p,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(hash),
+	), nil
+}
+
+// Verify verifies a password against a scrypt hash
+func (h *ScryptHasher) Verify(password, encodedHash string) (bool, error) {
+	params, salt, hash, err := parseScryptHash(encodedHash)
+	if err != nil {
+		return false, err
+	}
+
+	newHash, err := scrypt.Key([]byte(password), salt, 1<<params.logN, params.r, params.p, len(hash))
+	if err != nil {
+		return false, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	return subtle.ConstantTimeCompare(hash, newHash) == 1, nil
+}
+
+// NeedsRehash reports whether the hash was created with different parameters
+func (h *ScryptHasher) NeedsRehash(encodedHash string) bool {
+	params, _, hash, err := parseScryptHash(encodedHash)
+	if err != nil {
+		return true
+	}
+	return params.logN != h.logN || params.r != h.r || params.p != h.p || uint32(len(hash)) != h.keyLength
+}
+
+func parseScryptHash(encodedHash string) (*ScryptHasher, []byte, []byte, error) {
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 5 {
+		return nil, nil, nil, fmt.Errorf("invalid hash format")
+	}
+
+	if parts[1] != "scrypt" {
+		return nil, nil, nil, fmt.Errorf("unsupported algorithm: %s", parts[1])
+	}
+
+	params := &ScryptHasher{}
+	if _, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &params.logN, &params.r, &params.p); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+	if params.logN == 0 || params.logN > 31 {
+		return nil, nil, nil, fmt.Errorf("invalid parameters: ln=%d", params.logN)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid salt: %w", err)
+	}
+
+	hash, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid hash: %w", err)
+	}
+
+	return params, salt, hash, nil
+}
@@ -0,0 +1,68 @@
+package crypto
+
+import (
+	"crypto/subtle"
+	"sync"
+)
+
+// ConstantTimeEqual reports whether a and b are equal, taking the same
+// time whatever their contents. Use it to compare tokens, codes and other
+// secrets.
+func ConstantTimeEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// DummyVerifier spends the time of a password verification when there is
+// no hash to verify against, so sign-in takes as long for unknown
+// accounts as for known ones and response times do not reveal which
+// email addresses are registered.
+type DummyVerifier struct {
+	hasher PasswordHasher
+	mu     sync.Mutex
+	hash   string
+}
+
+// NewDummyVerifier creates a verifier for hashes of hasher
+func NewDummyVerifier(hasher PasswordHasher) *DummyVerifier {
+	return &DummyVerifier{hasher: hasher}
+}
+
+// Verify verifies password against the hash of a random password. It
+// always fails; only the time it takes matters. The hash is created on
+// first use, with the hasher's current parameters. The error is the
+// hasher's, such as ErrHasherBusy, so callers can fail the same way as
+// for a real verification.
+func (d *DummyVerifier) Verify(password string) error {
+	hash, err := d.dummyHash()
+	if err != nil {
+		return err
+	}
+	_, err = d.hasher.Verify(password, hash)
+	return err
+}
+
+// dummyHash returns the hash to verify against, creating it until that
+// succeeds once
+func (d *DummyVerifier) dummyHash() (string, error) {
+	d.mu.Lock()
+	hash := d.hash
+	d.mu.Unlock()
+	if hash != "" {
+		return hash, nil
+	}
+
+	secret, err := GenerateVerificationToken()
+	if err != nil {
+		return "", err
+	}
+	hash, err = d.hasher.Hash(secret)
+	if err != nil {
+		return "", err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.hash == "" {
+		d.hash = hash
+	}
+	return d.hash, nil
+}
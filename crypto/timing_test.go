@@ -0,0 +1,36 @@
+package crypto
+
+import "testing"
+
+type countingHasher struct {
+	hashes, verifies int
+}
+
+func (h *countingHasher) Hash(password string) (string, error) {
+	h.hashes++
+	return "hash:" + password, nil
+}
+
+func (h *countingHasher) Verify(password, hash string) (bool, error) {
+	h.verifies++
+	return hash == "hash:"+password, nil
+}
+
+func TestDummyVerifier(t *testing.T) {
+	hasher := &countingHasher{}
+	dummy := NewDummyVerifier(hasher)
+
+	if err := dummy.Verify("password"); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	_ = dummy.Verify("hash:")
+	if hasher.hashes != 1 || hasher.verifies != 2 {
+		t.Errorf("Expected one hash and a verification per call, got %d and %d", hasher.hashes, hasher.verifies)
+	}
+}
+
+func TestConstantTimeEqual(t *testing.T) {
+	if !ConstantTimeEqual("abc", "abc") || ConstantTimeEqual("abc", "abd") || ConstantTimeEqual("abc", "ab") {
+		t.Error("Unexpected comparison result")
+	}
+}
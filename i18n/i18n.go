@@ -0,0 +1,362 @@
+// Package i18n translates BeaconAuth's user-facing messages and renders
+// its emails in the locale of each request. A Bundle holds messages keyed
+// by error code ("error.invalid_credentials") and email templates by name
+// ("verify_email"), with English, Spanish, German and French built in.
+// Applications add or override translations with AddMessages, AddEmail or
+// LoadFS, and configure the bundle with beaconauth.WithLocalizer.
+//
+//	bundle := i18n.New(i18n.Config{DefaultLocale: "en"})
+//	if err := bundle.LoadFS(os.DirFS("translations"), "*.json"); err != nil {
+//		log.Fatal(err)
+//	}
+//	auth, err := beaconauth.New(beaconauth.WithLocalizer(bundle), ...)
+package i18n
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+//go:embed locales/*.json
+var builtin embed.FS
+
+// Config configures a Bundle
+type Config struct {
+	// DefaultLocale is used when a request asks for no supported locale
+	// (default core.DefaultLocale)
+	DefaultLocale string
+
+	// Locales restricts the locales served to requests (empty = every
+	// locale of the bundle)
+	Locales []string
+
+	// LocaleFunc returns the locale of a request, e.g. from the user's
+	// saved preference or a cookie. An empty or unsupported result falls
+	// back to the Accept-Language header.
+	LocaleFunc func(r *http.Request) string
+
+	// NoBuiltin leaves out the built-in translations
+	NoBuiltin bool
+}
+
+// EmailTemplate is a text/template for the subject and body of an email
+type EmailTemplate struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// EmailData is the data of the built-in email templates
+type EmailData struct {
+	AppName string
+	Name    string
+
+	// URL is the verification, reset or sign-in link
+	URL string
+
+	// Code is an optional one-time code (magic_link)
+	Code string
+
+	ExpiresIn time.Duration
+}
+
+// ExpiresInMinutes returns ExpiresIn in whole minutes, for templates
+func (d EmailData) ExpiresInMinutes() int {
+	return int(d.ExpiresIn.Round(time.Minute) / time.Minute)
+}
+
+// file is the format of translation files
+type file struct {
+	Messages map[string]string        `json:"messages"`
+	Emails   map[string]EmailTemplate `json:"emails"`
+}
+
+type emailTemplate struct {
+	subject, body *template.Template
+}
+
+// Bundle holds translations and implements core.Localizer
+type Bundle struct {
+	defaultLocale string
+	allowed       map[string]bool
+	localeFunc    func(r *http.Request) string
+
+	mu       sync.RWMutex
+	messages map[string]map[string]string
+	emails   map[string]map[string]*emailTemplate
+}
+
+var _ core.Localizer = (*Bundle)(nil)
+
+// New creates a bundle with the built-in translations
+func New(cfg Config) *Bundle {
+	b := &Bundle{
+		defaultLocale: normalize(cfg.DefaultLocale),
+		localeFunc:    cfg.LocaleFunc,
+		messages:      make(map[string]map[string]string),
+		emails:        make(map[string]map[string]*emailTemplate),
+	}
+	if b.defaultLocale == "" {
+		b.defaultLocale = core.DefaultLocale
+	}
+	if len(cfg.Locales) > 0 {
+		b.allowed = make(map[string]bool, len(cfg.Locales))
+		for _, locale := range cfg.Locales {
+			b.allowed[normalize(locale)] = true
+		}
+		b.allowed[b.defaultLocale] = true
+	}
+	if !cfg.NoBuiltin {
+		if err := b.LoadFS(builtin, "locales/*.json"); err != nil {
+			panic("i18n: invalid built-in translations: " + err.Error())
+		}
+	}
+	return b
+}
+
+// normalize lowercases a locale and uses "-" as the separator, so "pt_BR"
+// and "pt-br" name the same locale
+func normalize(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+// base returns the language of a locale, e.g. "pt" for "pt-br"
+func base(locale string) string {
+	lang, _, _ := strings.Cut(locale, "-")
+	return lang
+}
+
+// AddMessages adds or replaces messages of locale
+func (b *Bundle) AddMessages(locale string, messages map[string]string) {
+	locale = normalize(locale)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.messages[locale] == nil {
+		b.messages[locale] = make(map[string]string, len(messages))
+	}
+	for key, message := range messages {
+		b.messages[locale][key] = message
+	}
+}
+
+// AddEmail adds or replaces the email template name of locale
+func (b *Bundle) AddEmail(locale, name string, tmpl EmailTemplate) error {
+	subject, err := template.New(name + ".subject").Parse(tmpl.Subject)
+	if err != nil {
+		return fmt.Errorf("i18n: email %s (%s): %w", name, locale, err)
+	}
+	body, err := template.New(name + ".body").Parse(tmpl.Body)
+	if err != nil {
+		return fmt.Errorf("i18n: email %s (%s): %w", name, locale, err)
+	}
+
+	locale = normalize(locale)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.emails[locale] == nil {
+		b.emails[locale] = make(map[string]*emailTemplate)
+	}
+	b.emails[locale][name] = &emailTemplate{subject: subject, body: body}
+	return nil
+}
+
+// LoadFS loads the translation files of fsys matching pattern. Each file
+// is named after its locale, e.g. "pt-BR.json", and holds "messages" and
+// "emails" objects in the format of the built-in files.
+func (b *Bundle) LoadFS(fsys fs.FS, pattern string) error {
+	names, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return fmt.Errorf("i18n: %w", err)
+	}
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return fmt.Errorf("i18n: %w", err)
+		}
+		var f file
+		if err := json.Unmarshal(data, &f); err != nil {
+			return fmt.Errorf("i18n: %s: %w", name, err)
+		}
+
+		locale := strings.TrimSuffix(path.Base(name), path.Ext(name))
+		b.AddMessages(locale, f.Messages)
+		for email, tmpl := range f.Emails {
+			if err := b.AddEmail(locale, email, tmpl); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Locales returns the locales served to requests, sorted
+func (b *Bundle) Locales() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	seen := map[string]bool{b.defaultLocale: true}
+	for locale := range b.messages {
+		seen[locale] = true
+	}
+	for locale := range b.emails {
+		seen[locale] = true
+	}
+
+	locales := make([]string, 0, len(seen))
+	for locale := range seen {
+		if b.allowed == nil || b.allowed[locale] {
+			locales = append(locales, locale)
+		}
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// supported returns the served locale matching locale exactly or by
+// language, or ""
+func (b *Bundle) supported(locale string) string {
+	locale = normalize(locale)
+	if locale == "" {
+		return ""
+	}
+	locales := b.Locales()
+	for _, candidate := range locales {
+		if candidate == locale {
+			return candidate
+		}
+	}
+	for _, candidate := range locales {
+		if candidate == base(locale) {
+			return candidate
+		}
+	}
+	for _, candidate := range locales {
+		if base(candidate) == base(locale) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// Locale returns the locale of r: the one from LocaleFunc, else the best
+// match for its Accept-Language header, else the default locale
+func (b *Bundle) Locale(r *http.Request) string {
+	if b.localeFunc != nil {
+		if locale := b.supported(b.localeFunc(r)); locale != "" {
+			return locale
+		}
+	}
+	return b.Match(r.Header.Get("Accept-Language"))
+}
+
+// Match returns the served locale best matching an Accept-Language header,
+// or the default locale
+func (b *Bundle) Match(acceptLanguage string) string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag, q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	for _, t := range tags {
+		if t.tag == "*" {
+			break
+		}
+		if locale := b.supported(t.tag); locale != "" {
+			return locale
+		}
+	}
+	return b.defaultLocale
+}
+
+// Message returns the message for key in locale, or in its language, with
+// {name} placeholders replaced from data. It does not fall back to the
+// default locale, so callers keep their own message when a translation is
+// missing.
+func (b *Bundle) Message(locale, key string, data map[string]string) (string, bool) {
+	locale = normalize(locale)
+	b.mu.RLock()
+	message, ok := b.messages[locale][key]
+	if !ok {
+		message, ok = b.messages[base(locale)][key]
+	}
+	b.mu.RUnlock()
+	if !ok {
+		return "", false
+	}
+
+	if len(data) > 0 {
+		pairs := make([]string, 0, 2*len(data))
+		for name, value := range data {
+			pairs = append(pairs, "{"+name+"}", value)
+		}
+		message = strings.NewReplacer(pairs...).Replace(message)
+	}
+	return message, true
+}
+
+// Email renders the email template name in locale, falling back to its
+// language and then to the default locale
+func (b *Bundle) Email(locale, name string, data interface{}) (string, string, error) {
+	locale = normalize(locale)
+	b.mu.RLock()
+	tmpl := b.emails[locale][name]
+	if tmpl == nil {
+		tmpl = b.emails[base(locale)][name]
+	}
+	if tmpl == nil {
+		tmpl = b.emails[b.defaultLocale][name]
+	}
+	b.mu.RUnlock()
+	if tmpl == nil {
+		return "", "", fmt.Errorf("i18n: no email template %q", name)
+	}
+
+	var subject, body bytes.Buffer
+	if err := tmpl.subject.Execute(&subject, data); err != nil {
+		return "", "", fmt.Errorf("i18n: email %s: %w", name, err)
+	}
+	if err := tmpl.body.Execute(&body, data); err != nil {
+		return "", "", fmt.Errorf("i18n: email %s: %w", name, err)
+	}
+	return strings.TrimSpace(subject.String()), body.String(), nil
+}
+
+// Middleware puts l in the context of requests, so error responses of the
+// auth endpoints are localized when they are mounted without the router
+func Middleware(l core.Localizer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(core.WithRequestLocalizer(r.Context(), l)))
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package i18n
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+func TestBundle_Match(t *testing.T) {
+	b := New(Config{})
+	b.AddMessages("pt-BR", map[string]string{"error.not_found": "Não encontrado."})
+
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", "en"},
+		{"de", "de"},
+		{"de-AT,de;q=0.9", "de"},
+		{"ja, fr;q=0.8, es;q=0.9", "es"},
+		{"pt-br", "pt-br"},
+		{"pt", "pt-br"},
+		{"fr;q=0, es;q=0.1", "es"},
+		{"ja, *", "en"},
+	}
+	for _, tt := range tests {
+		if got := b.Match(tt.header); got != tt.want {
+			t.Errorf("Match(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+
+	restricted := New(Config{DefaultLocale: "fr", Locales: []string{"de"}})
+	if got := restricted.Match("es, de;q=0.5"); got != "de" {
+		t.Errorf("Expected locales outside Locales to be skipped, got %q", got)
+	}
+	if got := restricted.Match("es"); got != "fr" {
+		t.Errorf("Expected the default locale, got %q", got)
+	}
+}
+
+func TestBundle_LocaleFunc(t *testing.T) {
+	b := New(Config{LocaleFunc: func(r *http.Request) string { return r.URL.Query().Get("lang") }})
+
+	req := httptest.NewRequest(http.MethodGet, "/?lang=fr", nil)
+	req.Header.Set("Accept-Language", "de")
+	if got := b.Locale(req); got != "fr" {
+		t.Errorf("Expected the locale from LocaleFunc, got %q", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/?lang=xx", nil)
+	req.Header.Set("Accept-Language", "de")
+	if got := b.Locale(req); got != "de" {
+		t.Errorf("Expected Accept-Language for an unsupported locale, got %q", got)
+	}
+}
+
+func TestBundle_Message(t *testing.T) {
+	b := New(Config{})
+
+	if msg, ok := b.Message("de-CH", "field.required", map[string]string{"field": "email"}); !ok || msg != "email ist erforderlich." {
+		t.Errorf("Expected the German message by language, got %q %v", msg, ok)
+	}
+	if _, ok := b.Message("ja", "error.not_found", nil); ok {
+		t.Error("Expected no fallback to the default locale")
+	}
+
+	b.AddMessages("es", map[string]string{"error.not_found": "Nada por aquí."})
+	if msg, _ := b.Message("es", "error.not_found", nil); msg != "Nada por aquí." {
+		t.Errorf("Expected the override, got %q", msg)
+	}
+}
+
+func TestBundle_BuiltinsComplete(t *testing.T) {
+	b := New(Config{})
+	for _, locale := range []string{"es", "de", "fr"} {
+		for _, def := range core.ErrorCatalog() {
+			if _, ok := b.Message(locale, "error."+string(def.Code), nil); !ok {
+				t.Errorf("Locale %s has no message for %s", locale, def.Code)
+			}
+		}
+	}
+}
+
+func TestBundle_Email(t *testing.T) {
+	b := New(Config{})
+	data := EmailData{AppName: "Acme", Name: "Ada", URL: "https://acme.test/verify?t=1", ExpiresIn: time.Hour}
+
+	subject, body, err := b.Email("fr-CA", core.EmailVerifyEmail, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "Vérifiez votre adresse e-mail pour Acme" {
+		t.Errorf("Unexpected subject %q", subject)
+	}
+	if !strings.Contains(body, "Bonjour Ada") || !strings.Contains(body, data.URL) || !strings.Contains(body, "60 minutes") {
+		t.Errorf("Unexpected body %q", body)
+	}
+
+	if subject, _, _ := b.Email("ja", core.EmailMagicLink, data); subject != "Sign in to Acme" {
+		t.Errorf("Expected the default locale's template, got %q", subject)
+	}
+	if _, _, err := b.Email("en", "missing", data); err == nil {
+		t.Error("Expected an error for an unknown template")
+	}
+}
+
+func TestBundle_LoadFS(t *testing.T) {
+	b := New(Config{NoBuiltin: true})
+	fsys := fstest.MapFS{
+		"translations/it.json": {Data: []byte(`{
+			"messages": {"error.invalid_credentials": "Email o password non validi."},
+			"emails": {"verify_email": {"subject": "Verifica {{.AppName}}", "body": "{{.URL}}"}}
+		}`)},
+	}
+	if err := b.LoadFS(fsys, "translations/*.json"); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(b.Locales(), ","); got != "en,it" {
+		t.Errorf("Expected en,it, got %s", got)
+	}
+	if subject, _, err := b.Email("it", core.EmailVerifyEmail, EmailData{AppName: "Acme"}); err != nil || subject != "Verifica Acme" {
+		t.Errorf("Unexpected email %q %v", subject, err)
+	}
+
+	bad := fstest.MapFS{"x/de.json": {Data: []byte(`{"emails": {"e": {"subject": "{{.Broken"}}}`)}}
+	if err := b.LoadFS(bad, "x/*.json"); err == nil {
+		t.Error("Expected an invalid template to be rejected")
+	}
+}
+
+func TestMiddleware_LocalizesErrors(t *testing.T) {
+	h := Middleware(New(Config{}))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		core.WriteError(w, r, http.StatusBadRequest, core.CodeValidation, "email is required",
+			core.FieldError{Field: "email", Code: "required", Message: "email is required"})
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/signup", nil)
+	req.Header.Set("Accept-Language", "es-MX")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	var resp core.ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error != "validation_error" || resp.Message != "Algunos campos no son válidos." {
+		t.Errorf("Expected the Spanish message with the same code, got %+v", resp)
+	}
+	if len(resp.Details) != 1 || resp.Details[0].Message != "email es obligatorio." {
+		t.Errorf("Expected the field error translated, got %+v", resp.Details)
+	}
+	if w.Header().Get("Content-Language") != "es" {
+		t.Errorf("Expected Content-Language es, got %q", w.Header().Get("Content-Language"))
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/auth/signup", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Message != "email is required" {
+		t.Errorf("Expected the handler's message in the default locale, got %q", resp.Message)
+	}
+}
@@ -15,15 +15,15 @@ func SessionMiddleware(manager *session.Manager) func(http.Handler) http.Handler
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Extract token from cookie
-			cookie, err := r.Cookie(manager.Config().CookieName)
-			if err != nil || cookie.Value == "" {
+			token, err := core.ReadChunkedCookie(r, manager.Config().CookieName)
+			if err != nil {
 				next.ServeHTTP(w, r)
 				return
 			}
 
 			// Get session from manager
-			ctx := r.Context()
-			session, user, err := manager.Get(ctx, cookie.Value)
+			ctx := core.WithClientInfo(r.Context(), manager.ClientInfo(r))
+			session, user, err := manager.Get(ctx, token)
 			if err != nil {
 				next.ServeHTTP(w, r)
 				return
@@ -60,12 +60,7 @@ func RequireAuthJSON(manager *session.Manager) func(http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			session := core.GetSession(r.Context())
 			if session == nil {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusUnauthorized)
-				_ = json.NewEncoder(w).Encode(map[string]string{
-					"error":   "unauthorized",
-					"message": "Authentication required",
-				})
+				core.WriteError(w, r, http.StatusUnauthorized, core.CodeUnauthorized, "Authentication required")
 				return
 			}
 			next.ServeHTTP(w, r)
@@ -87,10 +82,9 @@ func NewHandler(dbAdapter core.Adapter, sessionManager *session.Manager, config
 
 // RegisterRoutes registers the authentication routes on a Chi router
 func (h *Handler) RegisterRoutes(r chi.Router) {
-	r.Post("/auth/signup", h.SignUp)
-	r.Post("/auth/signin", h.SignIn)
-	r.Post("/auth/signout", h.SignOut)
-	r.Get("/auth/session", h.GetSession)
+	for _, endpoint := range h.handler.Endpoints() {
+		r.Method(endpoint.Method, endpoint.Path, endpoint.Handler)
+	}
 }
 
 // SignUp handler
@@ -115,12 +109,7 @@ func (h *Handler) GetSession(w http.ResponseWriter, r *http.Request) {
 	user := core.GetUser(ctx)
 
 	if session == nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		_ = json.NewEncoder(w).Encode(map[string]string{
-			"error":   "no_session",
-			"message": "No active session",
-		})
+		core.WriteError(w, r, http.StatusUnauthorized, core.CodeNoSession, "No active session")
 		return
 	}
 
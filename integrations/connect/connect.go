@@ -0,0 +1,257 @@
+// Package connect authenticates Connect and gRPC services, including those
+// behind grpc-gateway, with BeaconAuth sessions.
+//
+// The interceptor of NewAuthInterceptor reads the session from the
+// Authorization bearer token or the session cookie and puts the session
+// and user in the handler's context. RequireRoles restricts procedures to
+// roles, and NewForwardInterceptor passes the caller's session on to the
+// services a handler calls.
+//
+//	interceptors := connect.WithInterceptors(
+//		beaconconnect.NewAuthInterceptor(sessionManager, &beaconconnect.Config{Required: true}),
+//		beaconconnect.RequireRoles(map[string][]string{
+//			"/admin.v1.AdminService/DeleteUser": {"admin"},
+//		}),
+//	)
+//	mux.Handle(adminv1connect.NewAdminServiceHandler(server, interceptors))
+package connect
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"connectrpc.com/connect"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/session"
+)
+
+// GatewayCookieHeader is the header grpc-gateway forwards the Cookie header
+// of HTTP requests in
+const GatewayCookieHeader = "Grpcgateway-Cookie"
+
+var (
+	errUnauthenticated = errors.New("authentication required")
+	errForbidden       = errors.New("forbidden")
+)
+
+// Config configures the auth interceptor
+type Config struct {
+	// Required rejects calls without a valid session with
+	// CodeUnauthenticated. Without it such calls run without a user.
+	Required bool
+
+	// Public lists procedures callable without a session when Required is
+	// set, e.g. "/greet.v1.GreetService/Greet"
+	Public []string
+}
+
+// tokenKey stores the session token of a call for NewForwardInterceptor
+type tokenKey struct{}
+
+// WithToken returns ctx carrying a session token, which the interceptor of
+// NewForwardInterceptor sends with outgoing calls
+func WithToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+// GetToken returns the session token of ctx, or ""
+func GetToken(ctx context.Context) string {
+	token, _ := ctx.Value(tokenKey{}).(string)
+	return token
+}
+
+// GetSession returns the session of the call, or nil
+func GetSession(ctx context.Context) *core.Session {
+	return core.GetSession(ctx)
+}
+
+// GetUser returns the user of the call, or nil
+func GetUser(ctx context.Context) *core.User {
+	return core.GetUser(ctx)
+}
+
+// authInterceptor loads the sessions of incoming calls
+type authInterceptor struct {
+	manager  *session.Manager
+	required bool
+	public   map[string]bool
+}
+
+// NewAuthInterceptor creates an interceptor that loads the session of
+// incoming calls from their bearer token or session cookie into the
+// context. The token is kept for NewForwardInterceptor. Calls made with
+// the interceptor are passed through.
+func NewAuthInterceptor(manager *session.Manager, cfg *Config) connect.Interceptor {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	i := &authInterceptor{
+		manager:  manager,
+		required: cfg.Required,
+		public:   make(map[string]bool, len(cfg.Public)),
+	}
+	for _, procedure := range cfg.Public {
+		i.public[procedure] = true
+	}
+	return i
+}
+
+func (i *authInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		ctx, err := i.authenticate(ctx, req.Spec().Procedure, req.Header(), req.Peer())
+		if err != nil {
+			return nil, err
+		}
+		return next(ctx, req)
+	}
+}
+
+func (i *authInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (i *authInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		ctx, err := i.authenticate(ctx, conn.Spec().Procedure, conn.RequestHeader(), conn.Peer())
+		if err != nil {
+			return err
+		}
+		return next(ctx, conn)
+	}
+}
+
+// authenticate returns ctx with the session and user of a call
+func (i *authInterceptor) authenticate(ctx context.Context, procedure string, header http.Header, peer connect.Peer) (context.Context, error) {
+	r := &http.Request{Header: header, RemoteAddr: peer.Addr}
+	ctx = core.WithClientInfo(ctx, i.manager.ClientInfo(r))
+
+	token := i.token(header)
+	if token != "" {
+		if s, user, err := i.manager.Get(ctx, token); err == nil {
+			ctx = core.WithSession(WithToken(ctx, token), s)
+			if user != nil {
+				ctx = core.WithUser(ctx, user)
+			}
+			return ctx, nil
+		}
+	}
+
+	if i.required && !i.public[procedure] {
+		return nil, connect.NewError(connect.CodeUnauthenticated, errUnauthenticated)
+	}
+	return ctx, nil
+}
+
+// token returns the session token of the Authorization header, the session
+// cookie or the cookie forwarded by grpc-gateway, in that order
+func (i *authInterceptor) token(header http.Header) string {
+	if scheme, token, ok := strings.Cut(header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+
+	name := i.manager.Config().CookieName
+	for _, h := range []string{"Cookie", GatewayCookieHeader} {
+		if values := header.Values(h); len(values) > 0 {
+			r := &http.Request{Header: http.Header{"Cookie": values}}
+			if token, err := core.ReadChunkedCookie(r, name); err == nil {
+				return token
+			}
+		}
+	}
+	return ""
+}
+
+// rolesInterceptor restricts procedures to roles
+type rolesInterceptor struct {
+	roles map[string][]string
+}
+
+// RequireRoles creates an interceptor that lets a user call the procedures
+// of roles only with one of the procedure's roles. Other procedures are
+// not restricted. Calls without a user get CodeUnauthenticated and users
+// without a role CodePermissionDenied. Add it after the interceptor of
+// NewAuthInterceptor.
+func RequireRoles(roles map[string][]string) connect.Interceptor {
+	return &rolesInterceptor{roles: roles}
+}
+
+func (i *rolesInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		if err := i.authorize(ctx, req.Spec().Procedure); err != nil {
+			return nil, err
+		}
+		return next(ctx, req)
+	}
+}
+
+func (i *rolesInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (i *rolesInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		if err := i.authorize(ctx, conn.Spec().Procedure); err != nil {
+			return err
+		}
+		return next(ctx, conn)
+	}
+}
+
+func (i *rolesInterceptor) authorize(ctx context.Context, procedure string) error {
+	roles, ok := i.roles[procedure]
+	if !ok {
+		return nil
+	}
+	user := core.GetUser(ctx)
+	if user == nil {
+		return connect.NewError(connect.CodeUnauthenticated, errUnauthenticated)
+	}
+	for _, role := range roles {
+		if user.HasRole(role) {
+			return nil
+		}
+	}
+	return connect.NewError(connect.CodePermissionDenied, errForbidden)
+}
+
+// forwardInterceptor sends the session token of the context with calls
+type forwardInterceptor struct{}
+
+// NewForwardInterceptor creates a client interceptor that sends the session
+// token of the call's context, as set by NewAuthInterceptor or WithToken,
+// as a bearer token. Use it on clients of services that authenticate with
+// NewAuthInterceptor, so they act as the same user.
+func NewForwardInterceptor() connect.Interceptor {
+	return forwardInterceptor{}
+}
+
+func (forwardInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if token := GetToken(ctx); req.Spec().IsClient && token != "" {
+			req.Header().Set("Authorization", "Bearer "+token)
+		}
+		return next(ctx, req)
+	}
+}
+
+func (forwardInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		conn := next(ctx, spec)
+		if token := GetToken(ctx); token != "" {
+			conn.RequestHeader().Set("Authorization", "Bearer "+token)
+		}
+		return conn
+	}
+}
+
+func (forwardInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return next
+}
@@ -0,0 +1,136 @@
+package connect
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/marshallshelly/beacon-auth/adapters/memory"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/session"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const (
+	whoamiProcedure = "/test.v1.TestService/Whoami"
+	adminProcedure  = "/test.v1.TestService/Admin"
+	healthProcedure = "/test.v1.TestService/Health"
+)
+
+// whoami answers with the email of the calling user
+func whoami(ctx context.Context, _ *connect.Request[wrapperspb.StringValue]) (*connect.Response[wrapperspb.StringValue], error) {
+	email := ""
+	if user := GetUser(ctx); user != nil {
+		email = user.Email
+	}
+	return connect.NewResponse(wrapperspb.String(email)), nil
+}
+
+func setupTestServer(t *testing.T) (*httptest.Server, map[string]string) {
+	t.Helper()
+	db := memory.New()
+	manager, err := session.NewManager(&session.Config{
+		CookieName:    "test_session",
+		ExpiresIn:     time.Hour,
+		EnableDBStore: true,
+		Secret:        "test-secret-key-at-least-32-bytes-long",
+	}, db)
+	if err != nil {
+		t.Fatalf("Failed to create session manager: %v", err)
+	}
+	t.Cleanup(func() { manager.Close() })
+
+	tokens := make(map[string]string)
+	for _, u := range []struct{ id, role string }{{"member1", "member"}, {"admin1", core.RoleAdmin}} {
+		if _, err := db.Create(context.Background(), "users", map[string]interface{}{
+			"id":    u.id,
+			"email": u.id + "@example.com",
+			"role":  u.role,
+		}); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		_, _, token, err := manager.Create(context.Background(), u.id, nil)
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		tokens[u.id] = token
+	}
+
+	interceptors := connect.WithInterceptors(
+		NewAuthInterceptor(manager, &Config{Required: true, Public: []string{healthProcedure}}),
+		RequireRoles(map[string][]string{adminProcedure: {core.RoleAdmin}}),
+	)
+	mux := http.NewServeMux()
+	for _, procedure := range []string{whoamiProcedure, adminProcedure, healthProcedure} {
+		mux.Handle(procedure, connect.NewUnaryHandler(procedure, whoami, interceptors))
+	}
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, tokens
+}
+
+func call(ctx context.Context, server *httptest.Server, procedure string, header http.Header) (string, error) {
+	client := connect.NewClient[wrapperspb.StringValue, wrapperspb.StringValue](
+		server.Client(), server.URL+procedure, connect.WithInterceptors(NewForwardInterceptor()),
+	)
+	req := connect.NewRequest(wrapperspb.String(""))
+	for key, values := range header {
+		req.Header()[key] = values
+	}
+	resp, err := client.CallUnary(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	return resp.Msg.GetValue(), nil
+}
+
+func TestAuthInterceptor(t *testing.T) {
+	server, tokens := setupTestServer(t)
+	ctx := context.Background()
+
+	if _, err := call(ctx, server, whoamiProcedure, nil); connect.CodeOf(err) != connect.CodeUnauthenticated {
+		t.Errorf("Expected CodeUnauthenticated without a session, got %v", err)
+	}
+	if email, err := call(ctx, server, healthProcedure, nil); err != nil || email != "" {
+		t.Errorf("Expected the public procedure to run without a user, got %q, %v", email, err)
+	}
+
+	tests := []struct {
+		name   string
+		header http.Header
+	}{
+		{"bearer", http.Header{"Authorization": {"Bearer " + tokens["member1"]}}},
+		{"cookie", http.Header{"Cookie": {"test_session=" + tokens["member1"]}}},
+		{"gateway cookie", http.Header{GatewayCookieHeader: {"test_session=" + tokens["member1"]}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email, err := call(ctx, server, whoamiProcedure, tt.header)
+			if err != nil || email != "member1@example.com" {
+				t.Errorf("Expected the session's user, got %q, %v", email, err)
+			}
+		})
+	}
+
+	bad := http.Header{"Authorization": {"Bearer invalid"}}
+	if _, err := call(ctx, server, whoamiProcedure, bad); connect.CodeOf(err) != connect.CodeUnauthenticated {
+		t.Errorf("Expected CodeUnauthenticated with an invalid token, got %v", err)
+	}
+}
+
+func TestRequireRoles(t *testing.T) {
+	server, tokens := setupTestServer(t)
+
+	_, err := call(WithToken(context.Background(), tokens["member1"]), server, adminProcedure, nil)
+	if connect.CodeOf(err) != connect.CodePermissionDenied {
+		t.Errorf("Expected CodePermissionDenied for a member, got %v", err)
+	}
+
+	email, err := call(WithToken(context.Background(), tokens["admin1"]), server, adminProcedure, nil)
+	if err != nil || email != "admin1@example.com" {
+		t.Errorf("Expected an admin to be let through, got %q, %v", email, err)
+	}
+}
@@ -0,0 +1,20 @@
+package echo
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/marshallshelly/beacon-auth/cors"
+)
+
+// CORS creates Echo middleware that applies a CORS policy and answers
+// preflight requests. Register it with e.Pre so preflight requests are
+// answered before routing.
+func CORS(policy *cors.Policy) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if policy.Write(c.Response(), c.Request()) {
+				return nil
+			}
+			return next(c)
+		}
+	}
+}
@@ -14,14 +14,14 @@ func SessionMiddleware(manager *session.Manager) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			// Extract token from cookie
-			cookie, err := c.Cookie(manager.Config().CookieName)
-			if err != nil || cookie.Value == "" {
+			token, err := core.ReadChunkedCookie(c.Request(), manager.Config().CookieName)
+			if err != nil {
 				return next(c)
 			}
 
 			// Get session from manager
-			ctx := c.Request().Context()
-			session, user, err := manager.Get(ctx, cookie.Value)
+			ctx := core.WithClientInfo(c.Request().Context(), manager.ClientInfo(c.Request()))
+			session, user, err := manager.Get(ctx, token)
 			if err != nil {
 				return next(c)
 			}
@@ -63,10 +63,8 @@ func RequireAuthJSON(manager *session.Manager) echo.MiddlewareFunc {
 		return func(c echo.Context) error {
 			session := GetSession(c)
 			if session == nil {
-				return c.JSON(http.StatusUnauthorized, map[string]string{
-					"error":   "unauthorized",
-					"message": "Authentication required",
-				})
+				core.WriteError(c.Response(), c.Request(), http.StatusUnauthorized, core.CodeUnauthorized, "Authentication required")
+				return nil
 			}
 			return next(c)
 		}
@@ -112,10 +110,9 @@ func NewHandler(dbAdapter core.Adapter, sessionManager *session.Manager, config
 // Actually echo.Router is for low level.
 // Let's use `*echo.Group` usually used. If user has `*echo.Echo`, they can pass `e.Group("")`.
 func (h *Handler) RegisterRoutes(g *echo.Group) {
-	g.POST("/auth/signup", h.SignUp)
-	g.POST("/auth/signin", h.SignIn)
-	g.POST("/auth/signout", h.SignOut)
-	g.GET("/auth/session", h.GetSession)
+	for _, endpoint := range h.handler.Endpoints() {
+		g.Add(endpoint.Method, endpoint.Path, echo.WrapHandler(endpoint.Handler))
+	}
 }
 
 // SignUp handler
@@ -142,10 +139,8 @@ func (h *Handler) GetSession(c echo.Context) error {
 	user := GetUser(c)
 
 	if session == nil {
-		return c.JSON(http.StatusUnauthorized, map[string]string{
-			"error":   "no_session",
-			"message": "No active session",
-		})
+		core.WriteError(c.Response(), c.Request(), http.StatusUnauthorized, core.CodeNoSession, "No active session")
+		return nil
 	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/labstack/echo/v4"
+	"github.com/marshallshelly/beacon-auth/core"
 )
 
 // TenantConfig configuration
@@ -13,6 +14,13 @@ type TenantConfig struct {
 	TenantHeader  string
 	DefaultTenant string
 	TenantKey     string
+
+	// FromPath reads the tenant from the first path segment when neither
+	// the header nor the subdomain names one, and removes the segment from
+	// the request passed on: /acme/auth/sign-in is served as /auth/sign-in
+	// for tenant acme. Add the middleware with Echo.Pre, or register the
+	// routes below a tenant parameter, e.g. /:tenant/auth/*.
+	FromPath bool
 }
 
 // DefaultTenantConfig defaults
@@ -42,11 +50,24 @@ func TenantMiddleware(config *TenantConfig) echo.MiddlewareFunc {
 				tenant = extractTenantFromHost(c.Request().Host, config.BaseDomain)
 			}
 
+			if tenant == "" && config.FromPath {
+				var r *http.Request
+				tenant, r = splitTenantPath(c.Request())
+				c.SetRequest(r)
+			}
+
 			if tenant == "" {
 				tenant = config.DefaultTenant
 			}
 
+			if tenant != "" && !core.ValidTenantID(tenant) {
+				core.WriteError(c.Response(), c.Request(), http.StatusBadRequest, core.CodeInvalidTenant, "Tenant identifier is invalid")
+				return nil
+			}
+
 			c.Set(config.TenantKey, tenant)
+			// Scope BeaconAuth's queries and sessions to the tenant
+			c.SetRequest(c.Request().WithContext(core.WithTenant(c.Request().Context(), tenant)))
 			return next(c)
 		}
 	}
@@ -78,6 +99,20 @@ func extractTenantFromHost(hostname, baseDomain string) string {
 	return subdomain
 }
 
+// splitTenantPath removes the first segment from the request path and
+// returns it with the request for the rest of the path
+func splitTenantPath(r *http.Request) (string, *http.Request) {
+	tenant, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if tenant == "" {
+		return "", r
+	}
+
+	r = r.Clone(r.Context())
+	r.URL.Path = "/" + rest
+	r.URL.RawPath = ""
+	return tenant, r
+}
+
 // GetTenant helper
 func GetTenant(c echo.Context) string {
 	if v := c.Get("tenant"); v != nil {
@@ -94,10 +129,8 @@ func RequireTenant() echo.MiddlewareFunc {
 		return func(c echo.Context) error {
 			tenant := GetTenant(c)
 			if tenant == "" {
-				return c.JSON(http.StatusBadRequest, map[string]string{
-					"error":   "tenant_required",
-					"message": "Tenant identifier is required",
-				})
+				core.WriteError(c.Response(), c.Request(), http.StatusBadRequest, core.CodeTenantRequired, "Tenant identifier is required")
+				return nil
 			}
 			return next(c)
 		}
@@ -57,6 +57,20 @@ func (w *responseAdapter) flush() error {
 	return w.c.Send(w.body.Bytes())
 }
 
+// clientInfo identifies the client the same way session.Manager.ClientInfo
+// does for the converted request, so session binding sees the same values
+// when a session is created and when it is used
+func clientInfo(c *fiber.Ctx, proxies core.TrustedProxies) core.ClientInfo {
+	var forwardedFor []string
+	for _, value := range c.Request().Header.PeekAll("X-Forwarded-For") {
+		forwardedFor = append(forwardedFor, string(value))
+	}
+	return core.ClientInfo{
+		IPAddress: proxies.ClientIP(c.IP(), forwardedFor, c.Get("X-Real-IP")),
+		UserAgent: c.Get("User-Agent"),
+	}
+}
+
 // requestAdapter adapts Fiber context to http.Request
 type requestAdapter struct {
 	*http.Request
@@ -88,8 +102,8 @@ func newRequestAdapter(c *fiber.Ctx) *requestAdapter {
 	// Set RemoteAddr
 	req.RemoteAddr = c.IP()
 
-	// Add session and user to context if present
-	ctx := req.Context()
+	// Add tenant, session and user to context if present
+	ctx := tenantContext(c, req.Context())
 	if session := GetSession(c); session != nil {
 		ctx = core.WithSession(ctx, session)
 	}
@@ -116,3 +130,10 @@ func (r *requestAdapter) Cookie(name string) (*http.Cookie, error) {
 		Value: value,
 	}, nil
 }
+
+// writeError writes an error response in the format of core.WriteError
+func writeError(c *fiber.Ctx, status int, code core.ErrorCode, message string) error {
+	w := newResponseAdapter(c)
+	core.WriteError(w, newRequestAdapter(c).Request, status, code, message)
+	return w.flush()
+}
@@ -0,0 +1,34 @@
+package fiber
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/marshallshelly/beacon-auth/cors"
+)
+
+// CORS creates Fiber middleware that applies a CORS policy and answers
+// preflight requests. Register it before the auth routes.
+func CORS(policy *cors.Policy) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		req := http.Header{}
+		for _, key := range []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"} {
+			if value := c.Get(key); value != "" {
+				req.Set(key, value)
+			}
+		}
+
+		h, preflight := policy.Headers(c.Method(), req)
+		for key, values := range h {
+			if key == "Vary" {
+				c.Vary(values...)
+				continue
+			}
+			c.Set(key, values[0])
+		}
+		if preflight {
+			return c.SendStatus(http.StatusNoContent)
+		}
+		return c.Next()
+	}
+}
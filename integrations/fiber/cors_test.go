@@ -0,0 +1,56 @@
+package fiber
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/marshallshelly/beacon-auth/cors"
+)
+
+func TestCORS(t *testing.T) {
+	policy, err := cors.New(cors.Config{
+		AllowedOrigins:   []string{"https://*.example.com"},
+		AllowCredentials: true,
+		MaxAge:           time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Use(CORS(policy))
+	app.Post("/auth/signin", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	req := httptest.NewRequest("OPTIONS", "/auth/signin", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusNoContent {
+		t.Fatalf("Expected status %d for a preflight request, got %d", fiber.StatusNoContent, resp.StatusCode)
+	}
+	if resp.Header.Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		resp.Header.Get("Access-Control-Allow-Credentials") != "true" ||
+		resp.Header.Get("Access-Control-Max-Age") != "3600" {
+		t.Errorf("Unexpected preflight headers %v", resp.Header)
+	}
+
+	req = httptest.NewRequest("POST", "/auth/signin", nil)
+	req.Header.Set("Origin", "https://evil.test")
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK || resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected the request to run without CORS headers, got %d %v", resp.StatusCode, resp.Header)
+	}
+	if resp.Header.Get("Vary") != "Origin" {
+		t.Errorf("Expected Vary: Origin, got %q", resp.Header.Get("Vary"))
+	}
+}
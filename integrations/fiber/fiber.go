@@ -1,6 +1,8 @@
 package fiber
 
 import (
+	"net/http"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/marshallshelly/beacon-auth/auth"
 	"github.com/marshallshelly/beacon-auth/core"
@@ -11,13 +13,15 @@ import (
 func SessionMiddleware(manager *session.Manager) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Extract token from cookie
-		token := c.Cookies(manager.Config().CookieName)
-		if token == "" {
+		token, err := core.JoinChunkedCookie(manager.Config().CookieName, func(name string) string {
+			return c.Cookies(name)
+		})
+		if err != nil || token == "" {
 			return c.Next()
 		}
 
 		// Get session from manager
-		ctx := c.Context()
+		ctx := core.WithClientInfo(tenantContext(c, c.Context()), clientInfo(c, manager.TrustedProxies()))
 		session, user, err := manager.Get(ctx, token)
 		if err != nil {
 			return c.Next()
@@ -50,10 +54,7 @@ func RequireAuthJSON(manager *session.Manager) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		session := GetSession(c)
 		if session == nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "unauthorized",
-				"message": "Authentication required",
-			})
+			return writeError(c, fiber.StatusUnauthorized, core.CodeUnauthorized, "Authentication required")
 		}
 
 		return c.Next()
@@ -89,13 +90,33 @@ func GetUserID(c *fiber.Ctx) string {
 
 // Handler wraps the auth.Handler for use with Fiber
 type Handler struct {
-	handler *auth.Handler
+	handler  *auth.Handler
+	sessions *session.Manager
 }
 
 // NewHandler creates a new Fiber auth handler
 func NewHandler(dbAdapter core.Adapter, sessionManager *session.Manager, config *auth.Config) *Handler {
 	return &Handler{
-		handler: auth.NewHandler(dbAdapter, sessionManager, config),
+		handler:  auth.NewHandler(dbAdapter, sessionManager, config),
+		sessions: sessionManager,
+	}
+}
+
+// RegisterRoutes registers the authentication routes on a Fiber app or group.
+// Register SessionMiddleware first so the session endpoint can see the
+// current session.
+func (h *Handler) RegisterRoutes(r fiber.Router) {
+	for _, endpoint := range h.handler.Endpoints() {
+		r.Add(endpoint.Method, endpoint.Path, h.wrap(endpoint.Handler))
+	}
+}
+
+// wrap adapts a net/http handler to a Fiber handler
+func (h *Handler) wrap(handler http.HandlerFunc) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return h.convertAndHandle(c, func(w *responseAdapter, r *requestAdapter) {
+			handler(w, r.Request)
+		})
 	}
 }
 
@@ -103,10 +124,7 @@ func NewHandler(dbAdapter core.Adapter, sessionManager *session.Manager, config
 func (h *Handler) SignUp(c *fiber.Ctx) error {
 	var req auth.SignUpRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "invalid_request",
-			"message": "Invalid request body",
-		})
+		return writeError(c, fiber.StatusBadRequest, core.CodeInvalidRequest, "Invalid request body")
 	}
 
 	// Convert to standard HTTP request/response for the handler
@@ -119,10 +137,7 @@ func (h *Handler) SignUp(c *fiber.Ctx) error {
 func (h *Handler) SignIn(c *fiber.Ctx) error {
 	var req auth.SignInRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "invalid_request",
-			"message": "Invalid request body",
-		})
+		return writeError(c, fiber.StatusBadRequest, core.CodeInvalidRequest, "Invalid request body")
 	}
 
 	return h.convertAndHandle(c, func(w *responseAdapter, r *requestAdapter) {
@@ -143,10 +158,7 @@ func (h *Handler) GetSession(c *fiber.Ctx) error {
 	user := GetUser(c)
 
 	if session == nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error":   "no_session",
-			"message": "No active session",
-		})
+		return writeError(c, fiber.StatusUnauthorized, core.CodeNoSession, "No active session")
 	}
 
 	return c.JSON(fiber.Map{
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"io"
+	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
@@ -384,3 +385,55 @@ func TestFiberIntegration_GetUserID(t *testing.T) {
 		t.Fatalf("Request failed: %v", err)
 	}
 }
+
+func TestFiberIntegration_RegisterRoutes(t *testing.T) {
+	app, _, authHandler := setupTestApp(t)
+	authHandler.RegisterRoutes(app)
+
+	send := func(method, path string, payload interface{}, cookie string) *http.Response {
+		t.Helper()
+		var body io.Reader
+		if payload != nil {
+			data, _ := json.Marshal(payload)
+			body = bytes.NewReader(data)
+		}
+		req := httptest.NewRequest(method, path, body)
+		req.Header.Set("Content-Type", "application/json")
+		if cookie != "" {
+			req.Header.Set("Cookie", "test_session="+cookie)
+		}
+		resp, err := app.Test(req, 10000)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		return resp
+	}
+
+	resp := send("POST", "/auth/signup", auth.SignUpRequest{
+		Email:    "routes@example.com",
+		Password: "secure-password-123",
+	}, "")
+	if resp.StatusCode != fiber.StatusCreated {
+		t.Fatalf("Expected signup status %d, got %d", fiber.StatusCreated, resp.StatusCode)
+	}
+
+	var token string
+	for _, c := range resp.Cookies() {
+		if c.Name == "test_session" {
+			token = c.Value
+		}
+	}
+	if token == "" {
+		t.Fatal("Expected session cookie after signup")
+	}
+
+	if resp := send("GET", "/auth/session", nil, token); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("Expected session status %d, got %d", fiber.StatusOK, resp.StatusCode)
+	}
+	if resp := send("POST", "/auth/signout", nil, token); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("Expected signout status %d, got %d", fiber.StatusOK, resp.StatusCode)
+	}
+	if resp := send("GET", "/auth/session", nil, token); resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("Expected status %d after signout, got %d", fiber.StatusUnauthorized, resp.StatusCode)
+	}
+}
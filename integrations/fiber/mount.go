@@ -0,0 +1,53 @@
+package fiber
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/plugin"
+	"github.com/marshallshelly/beacon-auth/router"
+)
+
+// MountAuth registers every route of h and of the initialized plugins on
+// app below /auth, served by a router.Router: methods are matched, plugin
+// endpoint policies are enforced with authCtx and hooks run around every
+// route. h or plugins may be nil; authCtx is required with plugins.
+//
+//	if err := beaconfiber.MountAuth(app, authHandler, plugins, authCtx); err != nil {
+//		log.Fatal(err)
+//	}
+func MountAuth(app fiber.Router, h *Handler, plugins *plugin.Manager, authCtx *core.AuthContext) (*router.Router, error) {
+	cfg := router.Config{
+		BasePath: router.DefaultBasePath,
+		Plugins:  plugins,
+		Context:  authCtx,
+	}
+	if h != nil {
+		cfg.Handler = h.handler
+		cfg.Sessions = h.sessions
+	}
+	rt, err := router.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, route := range rt.Routes() {
+		method, path, _ := strings.Cut(route, " ")
+		app.Add(method, path, mountedRoute(rt, path))
+	}
+	return rt, nil
+}
+
+// mountedRoute serves a route of rt. The router sees the route's own path,
+// so routes can be mounted on a group with a prefix.
+func mountedRoute(rt *router.Router, path string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		w := newResponseAdapter(c)
+		r := newRequestAdapter(c)
+		r.URL.Path = path
+		r.URL.RawPath = ""
+		rt.ServeHTTP(w, r.Request)
+		return w.flush()
+	}
+}
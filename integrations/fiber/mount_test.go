@@ -0,0 +1,82 @@
+package fiber
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/marshallshelly/beacon-auth/auth"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/plugin"
+)
+
+// notesPlugin serves an endpoint that requires a session
+type notesPlugin struct {
+	*plugin.BasePlugin
+}
+
+func (p *notesPlugin) Endpoints() map[string]plugin.Endpoint {
+	return map[string]plugin.Endpoint{
+		"/notes": {Method: http.MethodGet, Auth: core.AuthSession, Handler: func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(core.GetUser(r.Context()).Email))
+		}},
+	}
+}
+
+func TestMountAuth(t *testing.T) {
+	app, sessionManager, authHandler := setupTestApp(t)
+
+	ctx := core.NewAuthContext(&core.Config{
+		Session:  &core.SessionConfig{CookieName: "test_session"},
+		Advanced: &core.AdvancedConfig{},
+	})
+	ctx.SessionManager = sessionManager
+	plugins := plugin.NewManager([]plugin.Plugin{&notesPlugin{BasePlugin: plugin.NewBasePlugin("notes")}})
+	if err := plugins.Initialize(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	rt, err := MountAuth(app.Group("/api"), authHandler, plugins, ctx)
+	if err != nil {
+		t.Fatalf("MountAuth failed: %v", err)
+	}
+	if routes := rt.Routes(); len(routes) != 6 {
+		t.Errorf("Expected 6 routes, got %v", routes)
+	}
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/auth/notes", nil))
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("Expected status %d without a session, got %d", fiber.StatusUnauthorized, resp.StatusCode)
+	}
+
+	body, _ := json.Marshal(auth.SignUpRequest{Email: "mount@example.com", Password: "secure-password-123"})
+	req := httptest.NewRequest("POST", "/api/auth/signup", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = app.Test(req, 10000)
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusCreated {
+		t.Fatalf("Expected status %d, got %d", fiber.StatusCreated, resp.StatusCode)
+	}
+
+	req = httptest.NewRequest("GET", "/api/auth/notes", nil)
+	for _, cookie := range resp.Cookies() {
+		req.AddCookie(cookie)
+	}
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	var buf bytes.Buffer
+	_, _ = buf.ReadFrom(resp.Body)
+	if resp.StatusCode != fiber.StatusOK || buf.String() != "mount@example.com" {
+		t.Errorf("Expected the signed-in user's notes, got %d: %s", resp.StatusCode, buf.String())
+	}
+}
@@ -0,0 +1,60 @@
+package fiber
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// PermissionChecker reports whether user holds permission
+type PermissionChecker func(user *core.User, permission string) bool
+
+// RolePermissions returns a PermissionChecker that grants each role the
+// listed permissions, e.g. {"admin": {"users:delete"}, "member": {"posts:read"}}
+func RolePermissions(permissions map[string][]string) PermissionChecker {
+	granted := make(map[string]map[string]bool, len(permissions))
+	for role, perms := range permissions {
+		granted[role] = make(map[string]bool, len(perms))
+		for _, perm := range perms {
+			granted[role][perm] = true
+		}
+	}
+	return func(user *core.User, permission string) bool {
+		return granted[user.Role][permission]
+	}
+}
+
+// RequireRole creates middleware that lets through users with one of
+// roles. Requests without a user get 401 and other users 403. Register
+// SessionMiddleware first.
+func RequireRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user := GetUser(c)
+		if user == nil {
+			return writeError(c, fiber.StatusUnauthorized, core.CodeUnauthorized, "Authentication required")
+		}
+		for _, role := range roles {
+			if user.HasRole(role) {
+				return c.Next()
+			}
+		}
+		return writeError(c, fiber.StatusForbidden, core.CodeForbidden, "Forbidden")
+	}
+}
+
+// RequirePermission creates middleware that lets through users holding
+// every one of permissions, as reported by check. Requests without a user
+// get 401 and other users 403. Register SessionMiddleware first.
+func RequirePermission(check PermissionChecker, permissions ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user := GetUser(c)
+		if user == nil {
+			return writeError(c, fiber.StatusUnauthorized, core.CodeUnauthorized, "Authentication required")
+		}
+		for _, permission := range permissions {
+			if !check(user, permission) {
+				return writeError(c, fiber.StatusForbidden, core.CodeForbidden, "Forbidden")
+			}
+		}
+		return c.Next()
+	}
+}
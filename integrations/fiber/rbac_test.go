@@ -0,0 +1,81 @@
+package fiber
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// appWithUser serves GET /protected behind middleware as user
+func appWithUser(user *core.User, middleware fiber.Handler) *fiber.App {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if user != nil {
+			c.Locals("user", user)
+		}
+		return c.Next()
+	})
+	app.Get("/protected", middleware, func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	return app
+}
+
+func TestRequireRole(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     *core.User
+		expected int
+	}{
+		{"no user", nil, fiber.StatusUnauthorized},
+		{"matching role", &core.User{ID: "u1", Role: "editor"}, fiber.StatusOK},
+		{"admin", &core.User{ID: "u2", Role: core.RoleAdmin}, fiber.StatusOK},
+		{"other role", &core.User{ID: "u3", Role: "member"}, fiber.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := appWithUser(tt.user, RequireRole("editor", core.RoleAdmin))
+			resp, err := app.Test(httptest.NewRequest("GET", "/protected", nil))
+			if err != nil {
+				t.Fatalf("Failed to send request: %v", err)
+			}
+			if resp.StatusCode != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	check := RolePermissions(map[string][]string{
+		"editor": {"posts:read", "posts:write"},
+		"member": {"posts:read"},
+	})
+
+	tests := []struct {
+		name     string
+		user     *core.User
+		expected int
+	}{
+		{"no user", nil, fiber.StatusUnauthorized},
+		{"all permissions", &core.User{ID: "u1", Role: "editor"}, fiber.StatusOK},
+		{"some permissions", &core.User{ID: "u2", Role: "member"}, fiber.StatusForbidden},
+		{"unknown role", &core.User{ID: "u3", Role: "guest"}, fiber.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := appWithUser(tt.user, RequirePermission(check, "posts:read", "posts:write"))
+			resp, err := app.Test(httptest.NewRequest("GET", "/protected", nil))
+			if err != nil {
+				t.Fatalf("Failed to send request: %v", err)
+			}
+			if resp.StatusCode != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, resp.StatusCode)
+			}
+		})
+	}
+}
@@ -1,9 +1,11 @@
 package fiber
 
 import (
+	"context"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/marshallshelly/beacon-auth/core"
 )
 
 // TenantConfig holds tenant extraction configuration
@@ -19,8 +21,17 @@ type TenantConfig struct {
 
 	// TenantKey is the key used to store tenant in Fiber locals
 	TenantKey string
+
+	// FromPath reads the tenant from the first path segment when neither
+	// the header nor the subdomain names one, and removes the segment
+	// before routing continues: /acme/auth/sign-in is routed as
+	// /auth/sign-in for tenant acme
+	FromPath bool
 }
 
+// tenantLocalsKey stores the tenant for tenantContext
+type tenantLocalsKey struct{}
+
 // DefaultTenantConfig returns default tenant configuration
 func DefaultTenantConfig() *TenantConfig {
 	return &TenantConfig{
@@ -49,14 +60,32 @@ func TenantMiddleware(config *TenantConfig) fiber.Handler {
 			tenant = ExtractTenantFromHost(c.Hostname(), config.BaseDomain)
 		}
 
+		// Fall back to the first path segment
+		if tenant == "" && config.FromPath {
+			// Copy the path, Fiber reuses its buffer when it is overridden
+			var rest string
+			tenant, rest, _ = strings.Cut(strings.TrimPrefix(strings.Clone(c.Path()), "/"), "/")
+			if tenant != "" {
+				c.Path("/" + rest)
+			}
+		}
+
 		// Use default if still empty
 		if tenant == "" {
 			tenant = config.DefaultTenant
 		}
 
+		if tenant != "" && !core.ValidTenantID(tenant) {
+			return writeError(c, fiber.StatusBadRequest, core.CodeInvalidTenant, "Tenant identifier is invalid")
+		}
+
 		// Store tenant in locals
 		c.Locals(config.TenantKey, tenant)
 
+		// Scope BeaconAuth's queries and sessions to the tenant
+		c.Locals(tenantLocalsKey{}, tenant)
+		c.SetUserContext(core.WithTenant(c.UserContext(), tenant))
+
 		return c.Next()
 	}
 }
@@ -94,6 +123,15 @@ func ExtractTenantFromHost(hostname, baseDomain string) string {
 	return subdomain
 }
 
+// tenantContext returns ctx scoped to the tenant set by TenantMiddleware,
+// for the requests and lookups the integration makes
+func tenantContext(c *fiber.Ctx, ctx context.Context) context.Context {
+	if tenant, ok := c.Locals(tenantLocalsKey{}).(string); ok {
+		return core.WithTenant(ctx, tenant)
+	}
+	return ctx
+}
+
 // GetTenant retrieves the tenant from Fiber context
 func GetTenant(c *fiber.Ctx) string {
 	tenant, ok := c.Locals("tenant").(string)
@@ -103,15 +141,19 @@ func GetTenant(c *fiber.Ctx) string {
 	return tenant
 }
 
+// GetActiveTenant returns the tenant TenantMiddleware scoped the request
+// to, whatever its TenantKey, or "" without one
+func GetActiveTenant(c *fiber.Ctx) string {
+	tenant, _ := c.Locals(tenantLocalsKey{}).(string)
+	return tenant
+}
+
 // RequireTenant creates middleware that requires a tenant to be present
 func RequireTenant() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		tenant := GetTenant(c)
 		if tenant == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "tenant_required",
-				"message": "Tenant identifier is required",
-			})
+			return writeError(c, fiber.StatusBadRequest, core.CodeTenantRequired, "Tenant identifier is required")
 		}
 
 		return c.Next()
@@ -124,19 +166,13 @@ func TenantIsolationMiddleware(getTenantAdapter func(tenantID string) (interface
 	return func(c *fiber.Ctx) error {
 		tenant := GetTenant(c)
 		if tenant == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "tenant_required",
-				"message": "Tenant identifier is required",
-			})
+			return writeError(c, fiber.StatusBadRequest, core.CodeTenantRequired, "Tenant identifier is required")
 		}
 
 		// Get tenant-specific adapter
 		adapter, err := getTenantAdapter(tenant)
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error":   "tenant_error",
-				"message": "Failed to load tenant configuration",
-			})
+			return writeError(c, fiber.StatusInternalServerError, core.CodeInternal, "Failed to load tenant configuration")
 		}
 
 		// Store adapter in locals for use by handlers
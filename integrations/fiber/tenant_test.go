@@ -1,10 +1,12 @@
 package fiber
 
 import (
+	"io"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/marshallshelly/beacon-auth/core"
 )
 
 func TestExtractTenantFromHost(t *testing.T) {
@@ -140,6 +142,33 @@ func TestTenantMiddleware(t *testing.T) {
 	}
 }
 
+func TestTenantMiddleware_FromPath(t *testing.T) {
+	app := fiber.New()
+	app.Use(TenantMiddleware(&TenantConfig{TenantKey: "tenant", FromPath: true}))
+
+	app.Get("/auth/session", func(c *fiber.Ctx) error {
+		tenant, _ := core.TenantFromContext(c.UserContext())
+		return c.SendString(GetTenant(c) + "," + tenant)
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/acme/auth/session", nil))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != fiber.StatusOK || string(body) != "acme,acme" {
+		t.Errorf("Got %d %q, want 200 \"acme,acme\"", resp.StatusCode, body)
+	}
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/bad%20tenant/auth/session", nil))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid tenant, got %d", fiber.StatusBadRequest, resp.StatusCode)
+	}
+}
+
 func TestRequireTenant(t *testing.T) {
 	app := fiber.New()
 
@@ -250,6 +279,26 @@ func TestGetTenant(t *testing.T) {
 	app.Test(req)
 }
 
+func TestGetActiveTenant(t *testing.T) {
+	app := fiber.New()
+	app.Use(TenantMiddleware(&TenantConfig{TenantHeader: "X-Tenant-ID", TenantKey: "org"}))
+
+	var tenant string
+	app.Get("/test", func(c *fiber.Ctx) error {
+		tenant = GetActiveTenant(c)
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	if _, err := app.Test(req); err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	if tenant != "acme" {
+		t.Errorf("Expected active tenant 'acme', got '%s'", tenant)
+	}
+}
+
 func TestDefaultTenantConfig(t *testing.T) {
 	config := DefaultTenantConfig()
 
@@ -0,0 +1,139 @@
+package fiberv3
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// responseAdapter adapts Fiber context to http.ResponseWriter
+type responseAdapter struct {
+	c          fiber.Ctx
+	statusCode int
+	headers    http.Header
+	body       *bytes.Buffer
+}
+
+// newResponseAdapter creates a new response adapter
+func newResponseAdapter(c fiber.Ctx) *responseAdapter {
+	return &responseAdapter{
+		c:          c,
+		statusCode: http.StatusOK,
+		headers:    make(http.Header),
+		body:       &bytes.Buffer{},
+	}
+}
+
+// Header implements http.ResponseWriter
+func (w *responseAdapter) Header() http.Header {
+	return w.headers
+}
+
+// Write implements http.ResponseWriter
+func (w *responseAdapter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+// WriteHeader implements http.ResponseWriter
+func (w *responseAdapter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+}
+
+// flush writes the buffered response to Fiber context
+func (w *responseAdapter) flush() error {
+	// Set headers
+	for key, values := range w.headers {
+		for _, value := range values {
+			w.c.Set(key, value)
+		}
+	}
+
+	// Set status and body
+	w.c.Status(w.statusCode)
+	return w.c.Send(w.body.Bytes())
+}
+
+// clientInfo identifies the client the same way session.Manager.ClientInfo
+// does for the converted request, so session binding sees the same values
+// when a session is created and when it is used
+func clientInfo(c fiber.Ctx, proxies core.TrustedProxies) core.ClientInfo {
+	var forwardedFor []string
+	for _, value := range c.Request().Header.PeekAll("X-Forwarded-For") {
+		forwardedFor = append(forwardedFor, string(value))
+	}
+	return core.ClientInfo{
+		IPAddress: proxies.ClientIP(c.IP(), forwardedFor, c.Get("X-Real-IP")),
+		UserAgent: c.Get("User-Agent"),
+	}
+}
+
+// requestAdapter adapts Fiber context to http.Request
+type requestAdapter struct {
+	*http.Request
+	c fiber.Ctx
+}
+
+// newRequestAdapter creates a new request adapter
+func newRequestAdapter(c fiber.Ctx) *requestAdapter {
+	// Parse URL from Fiber context
+	parsedURL, _ := url.Parse(c.OriginalURL())
+	if parsedURL == nil {
+		parsedURL = &url.URL{Path: c.Path()}
+	}
+
+	// Create standard http.Request from Fiber request
+	req := &http.Request{
+		Method: c.Method(),
+		URL:    parsedURL,
+		Header: make(http.Header),
+		Body:   io.NopCloser(bytes.NewReader(c.Body())),
+		Host:   string(c.Request().Host()),
+	}
+
+	// Copy headers
+	for key, value := range c.Request().Header.All() {
+		req.Header.Add(string(key), string(value))
+	}
+
+	// Set RemoteAddr
+	req.RemoteAddr = c.IP()
+
+	// Add tenant, session and user to context if present
+	ctx := tenantContext(c, req.Context())
+	if session := GetSession(c); session != nil {
+		ctx = core.WithSession(ctx, session)
+	}
+	if user := GetUser(c); user != nil {
+		ctx = core.WithUser(ctx, user)
+	}
+	req = req.WithContext(ctx)
+
+	return &requestAdapter{
+		Request: req,
+		c:       c,
+	}
+}
+
+// Cookie retrieves a cookie from Fiber context
+func (r *requestAdapter) Cookie(name string) (*http.Cookie, error) {
+	value := r.c.Cookies(name)
+	if value == "" {
+		return nil, http.ErrNoCookie
+	}
+
+	return &http.Cookie{
+		Name:  name,
+		Value: value,
+	}, nil
+}
+
+// writeError writes an error response in the format of core.WriteError
+func writeError(c fiber.Ctx, status int, code core.ErrorCode, message string) error {
+	w := newResponseAdapter(c)
+	core.WriteError(w, newRequestAdapter(c).Request, status, code, message)
+	return w.flush()
+}
@@ -0,0 +1,163 @@
+// Package fiberv3 integrates BeaconAuth with Fiber v3.
+//
+// It mirrors the Fiber v2 integration in integrations/fiber. It is a separate
+// module because Fiber v3 requires a newer Go release than BeaconAuth.
+package fiberv3
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/marshallshelly/beacon-auth/auth"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/session"
+)
+
+// SessionMiddleware creates Fiber middleware that loads session from request
+func SessionMiddleware(manager *session.Manager) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		// Extract token from cookie
+		token, err := core.JoinChunkedCookie(manager.Config().CookieName, func(name string) string {
+			return c.Cookies(name)
+		})
+		if err != nil || token == "" {
+			return c.Next()
+		}
+
+		// Get session from manager
+		ctx := core.WithClientInfo(tenantContext(c, c.Context()), clientInfo(c, manager.TrustedProxies()))
+		session, user, err := manager.Get(ctx, token)
+		if err != nil {
+			return c.Next()
+		}
+
+		// Store session and user in Fiber locals
+		c.Locals("session", session)
+		if user != nil {
+			c.Locals("user", user)
+		}
+
+		return c.Next()
+	}
+}
+
+// RequireAuth creates Fiber middleware that requires a valid session
+func RequireAuth(manager *session.Manager) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		session := GetSession(c)
+		if session == nil {
+			return c.Redirect().Status(fiber.StatusFound).To("/auth/signin")
+		}
+
+		return c.Next()
+	}
+}
+
+// RequireAuthJSON creates Fiber middleware that requires authentication and returns JSON errors
+func RequireAuthJSON(manager *session.Manager) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		session := GetSession(c)
+		if session == nil {
+			return writeError(c, fiber.StatusUnauthorized, core.CodeUnauthorized, "Authentication required")
+		}
+
+		return c.Next()
+	}
+}
+
+// GetSession retrieves the session from Fiber context
+func GetSession(c fiber.Ctx) *core.Session {
+	session, ok := c.Locals("session").(*core.Session)
+	if !ok {
+		return nil
+	}
+	return session
+}
+
+// GetUser retrieves the user from Fiber context
+func GetUser(c fiber.Ctx) *core.User {
+	user, ok := c.Locals("user").(*core.User)
+	if !ok {
+		return nil
+	}
+	return user
+}
+
+// GetUserID retrieves the user ID from Fiber context
+func GetUserID(c fiber.Ctx) string {
+	user := GetUser(c)
+	if user == nil {
+		return ""
+	}
+	return user.ID
+}
+
+// Handler wraps the auth.Handler for use with Fiber
+type Handler struct {
+	handler *auth.Handler
+}
+
+// NewHandler creates a new Fiber auth handler
+func NewHandler(dbAdapter core.Adapter, sessionManager *session.Manager, config *auth.Config) *Handler {
+	return &Handler{
+		handler: auth.NewHandler(dbAdapter, sessionManager, config),
+	}
+}
+
+// RegisterRoutes registers the authentication routes on a Fiber app or group.
+// Register SessionMiddleware first so the session endpoint can see the
+// current session.
+func (h *Handler) RegisterRoutes(r fiber.Router) {
+	for _, endpoint := range h.handler.Endpoints() {
+		r.Add([]string{endpoint.Method}, endpoint.Path, h.wrap(endpoint.Handler))
+	}
+}
+
+// wrap adapts a net/http handler to a Fiber handler
+func (h *Handler) wrap(handler http.HandlerFunc) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		return h.convertAndHandle(c, func(w *responseAdapter, r *requestAdapter) {
+			handler(w, r.Request)
+		})
+	}
+}
+
+// SignUp handles user registration in Fiber
+func (h *Handler) SignUp(c fiber.Ctx) error {
+	return h.wrap(h.handler.SignUp)(c)
+}
+
+// SignIn handles user authentication in Fiber
+func (h *Handler) SignIn(c fiber.Ctx) error {
+	return h.wrap(h.handler.SignIn)(c)
+}
+
+// SignOut handles user logout in Fiber
+func (h *Handler) SignOut(c fiber.Ctx) error {
+	return h.wrap(h.handler.SignOut)(c)
+}
+
+// GetSession retrieves the current session in Fiber
+func (h *Handler) GetSession(c fiber.Ctx) error {
+	session := GetSession(c)
+	user := GetUser(c)
+
+	if session == nil {
+		return writeError(c, fiber.StatusUnauthorized, core.CodeNoSession, "No active session")
+	}
+
+	return c.JSON(fiber.Map{
+		"user":    user,
+		"session": session,
+	})
+}
+
+// convertAndHandle converts Fiber context to standard HTTP and calls the handler
+func (h *Handler) convertAndHandle(c fiber.Ctx, handlerFunc func(*responseAdapter, *requestAdapter)) error {
+	w := newResponseAdapter(c)
+	r := newRequestAdapter(c)
+
+	handlerFunc(w, r)
+
+	return w.flush()
+}
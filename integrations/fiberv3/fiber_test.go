@@ -0,0 +1,155 @@
+package fiberv3
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/marshallshelly/beacon-auth/adapters/memory"
+	"github.com/marshallshelly/beacon-auth/auth"
+	"github.com/marshallshelly/beacon-auth/session"
+)
+
+func setupTestApp(t *testing.T) (*fiber.App, *Handler) {
+	app := fiber.New()
+	dbAdapter := memory.New()
+
+	sessionManager, err := session.NewManager(&session.Config{
+		CookieName:     "test_session",
+		CookieHTTPOnly: true,
+		CookieSameSite: "lax",
+		ExpiresIn:      24 * time.Hour,
+		EnableDBStore:  true,
+		Secret:         "test-secret-key-at-least-32-bytes-long",
+		Issuer:         "test",
+	}, dbAdapter)
+	if err != nil {
+		t.Fatalf("Failed to create session manager: %v", err)
+	}
+
+	authHandler := NewHandler(dbAdapter, sessionManager, &auth.Config{
+		MinPasswordLength: 8,
+		AllowSignup:       true,
+	})
+
+	app.Use(SessionMiddleware(sessionManager))
+
+	return app, authHandler
+}
+
+func send(t *testing.T, app *fiber.App, method, path string, payload interface{}, token string) *http.Response {
+	t.Helper()
+
+	var body io.Reader
+	if payload != nil {
+		data, _ := json.Marshal(payload)
+		body = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, body)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Cookie", "test_session="+token)
+	}
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	return resp
+}
+
+func sessionCookie(resp *http.Response) string {
+	for _, c := range resp.Cookies() {
+		if c.Name == "test_session" {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+func TestFiberV3_RegisterRoutes(t *testing.T) {
+	app, authHandler := setupTestApp(t)
+	authHandler.RegisterRoutes(app)
+
+	resp := send(t, app, "POST", "/auth/signup", auth.SignUpRequest{
+		Email:    "v3@example.com",
+		Password: "secure-password-123",
+		Name:     "Fiber V3",
+	}, "")
+	if resp.StatusCode != fiber.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("Expected signup status %d, got %d: %s", fiber.StatusCreated, resp.StatusCode, body)
+	}
+
+	resp = send(t, app, "POST", "/auth/signin", auth.SignInRequest{
+		Email:    "v3@example.com",
+		Password: "secure-password-123",
+	}, "")
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("Expected signin status %d, got %d", fiber.StatusOK, resp.StatusCode)
+	}
+
+	token := sessionCookie(resp)
+	if token == "" {
+		t.Fatal("Expected session cookie after signin")
+	}
+
+	resp = send(t, app, "GET", "/auth/session", nil, token)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("Expected session status %d, got %d", fiber.StatusOK, resp.StatusCode)
+	}
+
+	var authResp auth.AuthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
+		t.Fatalf("Failed to decode session response: %v", err)
+	}
+	if authResp.User == nil || authResp.User.Email != "v3@example.com" {
+		t.Errorf("Expected signed-in user in session response, got %+v", authResp.User)
+	}
+
+	if resp := send(t, app, "POST", "/auth/signout", nil, token); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("Expected signout status %d, got %d", fiber.StatusOK, resp.StatusCode)
+	}
+	if resp := send(t, app, "GET", "/auth/session", nil, token); resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("Expected status %d after signout, got %d", fiber.StatusUnauthorized, resp.StatusCode)
+	}
+}
+
+func TestFiberV3_RequireAuth(t *testing.T) {
+	app, authHandler := setupTestApp(t)
+	authHandler.RegisterRoutes(app)
+
+	app.Get("/protected", RequireAuthJSON(nil), func(c fiber.Ctx) error {
+		return c.SendString("user " + GetUserID(c))
+	})
+	app.Get("/page", RequireAuth(nil), func(c fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	if resp := send(t, app, "GET", "/protected", nil, ""); resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("Expected status %d without session, got %d", fiber.StatusUnauthorized, resp.StatusCode)
+	}
+	if resp := send(t, app, "GET", "/page", nil, ""); resp.StatusCode != fiber.StatusFound {
+		t.Errorf("Expected redirect status %d without session, got %d", fiber.StatusFound, resp.StatusCode)
+	}
+
+	resp := send(t, app, "POST", "/auth/signup", auth.SignUpRequest{
+		Email:    "protected@example.com",
+		Password: "secure-password-123",
+	}, "")
+	token := sessionCookie(resp)
+
+	resp = send(t, app, "GET", "/protected", nil, token)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("Expected status %d with session, got %d", fiber.StatusOK, resp.StatusCode)
+	}
+	if body, _ := io.ReadAll(resp.Body); !bytes.HasPrefix(body, []byte("user ")) || len(body) == len("user ") {
+		t.Errorf("Expected user ID in response, got %q", body)
+	}
+}
@@ -0,0 +1,19 @@
+package gin
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/marshallshelly/beacon-auth/cors"
+)
+
+// CORS creates Gin middleware that applies a CORS policy and answers
+// preflight requests. Register it on the engine with Use so preflight
+// requests reach it.
+func CORS(policy *cors.Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if policy.Write(c.Writer, c.Request) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
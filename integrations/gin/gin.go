@@ -13,14 +13,14 @@ import (
 func SessionMiddleware(manager *session.Manager) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Extract token from cookie
-		token, err := c.Cookie(manager.Config().CookieName)
-		if err != nil || token == "" {
+		token, err := core.ReadChunkedCookie(c.Request, manager.Config().CookieName)
+		if err != nil {
 			c.Next()
 			return
 		}
 
 		// Get session from manager
-		ctx := c.Request.Context()
+		ctx := core.WithClientInfo(c.Request.Context(), manager.ClientInfo(c.Request))
 		session, user, err := manager.Get(ctx, token)
 		if err != nil {
 			c.Next()
@@ -62,10 +62,7 @@ func RequireAuthJSON(manager *session.Manager) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		session := GetSession(c)
 		if session == nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error":   "unauthorized",
-				"message": "Authentication required",
-			})
+			core.WriteError(c.Writer, c.Request, http.StatusUnauthorized, core.CodeUnauthorized, "Authentication required")
 			c.Abort()
 			return
 		}
@@ -107,10 +104,9 @@ func NewHandler(dbAdapter core.Adapter, sessionManager *session.Manager, config
 
 // RegisterRoutes registers routes on a Gin router group or engine
 func (h *Handler) RegisterRoutes(r gin.IRouter) {
-	r.POST("/auth/signup", h.SignUp)
-	r.POST("/auth/signin", h.SignIn)
-	r.POST("/auth/signout", h.SignOut)
-	r.GET("/auth/session", h.GetSession)
+	for _, endpoint := range h.handler.Endpoints() {
+		r.Handle(endpoint.Method, endpoint.Path, gin.WrapF(endpoint.Handler))
+	}
 }
 
 // SignUp handler
@@ -134,10 +130,7 @@ func (h *Handler) GetSession(c *gin.Context) {
 	user := GetUser(c)
 
 	if session == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error":   "no_session",
-			"message": "No active session",
-		})
+		core.WriteError(c.Writer, c.Request, http.StatusUnauthorized, core.CodeNoSession, "No active session")
 		return
 	}
 
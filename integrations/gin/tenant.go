@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/marshallshelly/beacon-auth/core"
 )
 
 // TenantConfig holds tenant extraction configuration
@@ -13,6 +14,13 @@ type TenantConfig struct {
 	TenantHeader  string
 	DefaultTenant string
 	TenantKey     string
+
+	// FromPath reads the tenant from the first path segment when neither
+	// the header nor the subdomain names one, and removes the segment from
+	// the request passed on: /acme/auth/sign-in is served as /auth/sign-in
+	// for tenant acme. Register the routes below a tenant parameter, e.g.
+	// /:tenant/auth/*path.
+	FromPath bool
 }
 
 // DefaultTenantConfig returns default tenant configuration
@@ -41,11 +49,23 @@ func TenantMiddleware(config *TenantConfig) gin.HandlerFunc {
 			tenant = extractTenantFromHost(c.Request.Host, config.BaseDomain)
 		}
 
+		if tenant == "" && config.FromPath {
+			tenant, c.Request = splitTenantPath(c.Request)
+		}
+
 		if tenant == "" {
 			tenant = config.DefaultTenant
 		}
 
+		if tenant != "" && !core.ValidTenantID(tenant) {
+			core.WriteError(c.Writer, c.Request, http.StatusBadRequest, core.CodeInvalidTenant, "Tenant identifier is invalid")
+			c.Abort()
+			return
+		}
+
 		c.Set(config.TenantKey, tenant)
+		// Scope BeaconAuth's queries and sessions to the tenant
+		c.Request = c.Request.WithContext(core.WithTenant(c.Request.Context(), tenant))
 		c.Next()
 	}
 }
@@ -76,6 +96,20 @@ func extractTenantFromHost(hostname, baseDomain string) string {
 	return subdomain
 }
 
+// splitTenantPath removes the first segment from the request path and
+// returns it with the request for the rest of the path
+func splitTenantPath(r *http.Request) (string, *http.Request) {
+	tenant, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if tenant == "" {
+		return "", r
+	}
+
+	r = r.Clone(r.Context())
+	r.URL.Path = "/" + rest
+	r.URL.RawPath = ""
+	return tenant, r
+}
+
 // GetTenant retrieves tenant from context
 func GetTenant(c *gin.Context) string {
 	if v, exists := c.Get("tenant"); exists {
@@ -91,10 +125,7 @@ func RequireTenant() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tenant := GetTenant(c)
 		if tenant == "" {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":   "tenant_required",
-				"message": "Tenant identifier is required",
-			})
+			core.WriteError(c.Writer, c.Request, http.StatusBadRequest, core.CodeTenantRequired, "Tenant identifier is required")
 			c.Abort()
 			return
 		}
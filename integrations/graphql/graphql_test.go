@@ -0,0 +1,115 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/adapters/memory"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/session"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func resolved(ctx context.Context) (interface{}, error) {
+	return "secret", nil
+}
+
+// errorCode returns the extension code of a GraphQL error
+func errorCode(t *testing.T, err error) string {
+	t.Helper()
+	var gqlErr *gqlerror.Error
+	if !errors.As(err, &gqlErr) {
+		t.Fatalf("Expected a GraphQL error, got %v", err)
+	}
+	code, _ := gqlErr.Extensions["code"].(string)
+	return code
+}
+
+func TestAuth(t *testing.T) {
+	if _, err := Auth(context.Background(), nil, resolved); errorCode(t, err) != "unauthorized" {
+		t.Errorf("Expected unauthorized, got %v", err)
+	}
+
+	ctx := core.WithUser(context.Background(), &core.User{ID: "u1"})
+	res, err := Auth(ctx, nil, resolved)
+	if err != nil || res != "secret" {
+		t.Errorf("Expected the field to resolve, got %v, %v", res, err)
+	}
+}
+
+func TestHasRole(t *testing.T) {
+	tests := []struct {
+		name string
+		user *core.User
+		code string
+	}{
+		{"no user", nil, "unauthorized"},
+		{"other role", &core.User{ID: "u1", Role: "member"}, "forbidden"},
+		{"matching role", &core.User{ID: "u2", Role: "editor"}, ""},
+		{"admin", &core.User{ID: "u3", Role: core.RoleAdmin}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.user != nil {
+				ctx = core.WithUser(ctx, tt.user)
+			}
+			res, err := HasRole(ctx, nil, resolved, []string{"editor", core.RoleAdmin})
+			if tt.code == "" {
+				if err != nil || res != "secret" {
+					t.Errorf("Expected the field to resolve, got %v, %v", res, err)
+				}
+				return
+			}
+			if code := errorCode(t, err); code != tt.code {
+				t.Errorf("Expected %s, got %s", tt.code, code)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	db := memory.New()
+	manager, err := session.NewManager(&session.Config{
+		CookieName:    "test_session",
+		ExpiresIn:     time.Hour,
+		EnableDBStore: true,
+		Secret:        "test-secret-key-at-least-32-bytes-long",
+	}, db)
+	if err != nil {
+		t.Fatalf("Failed to create session manager: %v", err)
+	}
+	defer manager.Close()
+	if _, err := db.Create(context.Background(), "users", map[string]interface{}{
+		"id":    "user1",
+		"email": "gql@example.com",
+	}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	_, _, token, err := manager.Create(context.Background(), "user1", nil)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	var got *core.User
+	handler := Middleware(manager)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = GetUser(r.Context())
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/query", nil))
+	if got != nil {
+		t.Errorf("Expected no user without a cookie, got %v", got)
+	}
+
+	req := httptest.NewRequest("POST", "/query", nil)
+	req.AddCookie(&http.Cookie{Name: "test_session", Value: token})
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if got == nil || got.Email != "gql@example.com" {
+		t.Errorf("Expected the session's user, got %v", got)
+	}
+}
@@ -14,15 +14,15 @@ func SessionMiddleware(manager *session.Manager) func(http.Handler) http.Handler
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Extract token from cookie
-			cookie, err := r.Cookie(manager.Config().CookieName)
-			if err != nil || cookie.Value == "" {
+			token, err := core.ReadChunkedCookie(r, manager.Config().CookieName)
+			if err != nil {
 				next.ServeHTTP(w, r)
 				return
 			}
 
 			// Get session from manager
-			ctx := r.Context()
-			session, user, err := manager.Get(ctx, cookie.Value)
+			ctx := core.WithClientInfo(r.Context(), manager.ClientInfo(r))
+			session, user, err := manager.Get(ctx, token)
 			if err != nil {
 				next.ServeHTTP(w, r)
 				return
@@ -59,12 +59,7 @@ func RequireAuthJSON(manager *session.Manager) func(http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			session := core.GetSession(r.Context())
 			if session == nil {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusUnauthorized)
-				_ = json.NewEncoder(w).Encode(map[string]string{
-					"error":   "unauthorized",
-					"message": "Authentication required",
-				})
+				core.WriteError(w, r, http.StatusUnauthorized, core.CodeUnauthorized, "Authentication required")
 				return
 			}
 			next.ServeHTTP(w, r)
@@ -84,6 +79,15 @@ func NewHandler(dbAdapter core.Adapter, sessionManager *session.Manager, config
 	}
 }
 
+// RegisterRoutes registers the authentication routes on a ServeMux.
+// Wrap the mux with SessionMiddleware so the session endpoint can see
+// the current session.
+func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
+	for _, endpoint := range h.handler.Endpoints() {
+		mux.HandleFunc(endpoint.Method+" "+endpoint.Path, endpoint.Handler)
+	}
+}
+
 // SignUp handles user registration
 func (h *Handler) SignUp(w http.ResponseWriter, r *http.Request) {
 	h.handler.SignUp(w, r)
@@ -106,12 +110,7 @@ func (h *Handler) GetSession(w http.ResponseWriter, r *http.Request) {
 	user := core.GetUser(ctx)
 
 	if session == nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		_ = json.NewEncoder(w).Encode(map[string]string{
-			"error":   "no_session",
-			"message": "No active session",
-		})
+		core.WriteError(w, r, http.StatusUnauthorized, core.CodeNoSession, "No active session")
 		return
 	}
 
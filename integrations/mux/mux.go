@@ -14,14 +14,14 @@ import (
 func SessionMiddleware(manager *session.Manager) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			cookie, err := r.Cookie(manager.Config().CookieName)
-			if err != nil || cookie.Value == "" {
+			token, err := core.ReadChunkedCookie(r, manager.Config().CookieName)
+			if err != nil {
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			ctx := r.Context()
-			session, user, err := manager.Get(ctx, cookie.Value)
+			ctx := core.WithClientInfo(r.Context(), manager.ClientInfo(r))
+			session, user, err := manager.Get(ctx, token)
 			if err != nil {
 				next.ServeHTTP(w, r)
 				return
@@ -57,12 +57,7 @@ func RequireAuthJSON(manager *session.Manager) func(http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			session := core.GetSession(r.Context())
 			if session == nil {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusUnauthorized)
-				_ = json.NewEncoder(w).Encode(map[string]string{
-					"error":   "unauthorized",
-					"message": "Authentication required",
-				})
+				core.WriteError(w, r, http.StatusUnauthorized, core.CodeUnauthorized, "Authentication required")
 				return
 			}
 			next.ServeHTTP(w, r)
@@ -84,10 +79,9 @@ func NewHandler(dbAdapter core.Adapter, sessionManager *session.Manager, config
 
 // RegisterRoutes registers routes on a Gorilla Mux router
 func (h *Handler) RegisterRoutes(r *mux.Router) {
-	r.HandleFunc("/auth/signup", h.SignUp).Methods("POST")
-	r.HandleFunc("/auth/signin", h.SignIn).Methods("POST")
-	r.HandleFunc("/auth/signout", h.SignOut).Methods("POST")
-	r.HandleFunc("/auth/session", h.GetSession).Methods("GET")
+	for _, endpoint := range h.handler.Endpoints() {
+		r.HandleFunc(endpoint.Path, endpoint.Handler).Methods(endpoint.Method)
+	}
 }
 
 // SignUp handler
@@ -112,12 +106,7 @@ func (h *Handler) GetSession(w http.ResponseWriter, r *http.Request) {
 	user := core.GetUser(ctx)
 
 	if session == nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		_ = json.NewEncoder(w).Encode(map[string]string{
-			"error":   "no_session",
-			"message": "No active session",
-		})
+		core.WriteError(w, r, http.StatusUnauthorized, core.CodeNoSession, "No active session")
 		return
 	}
 
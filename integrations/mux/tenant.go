@@ -2,9 +2,10 @@ package mux
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
 	"strings"
+
+	"github.com/marshallshelly/beacon-auth/core"
 )
 
 type tenantKey struct{}
@@ -14,6 +15,11 @@ type TenantConfig struct {
 	BaseDomain    string
 	TenantHeader  string
 	DefaultTenant string
+
+	// FromPath reads the tenant from the first path segment when neither
+	// the header nor the subdomain names one, and removes the segment:
+	// /acme/auth/sign-in is served as /auth/sign-in for tenant acme
+	FromPath bool
 }
 
 // DefaultTenantConfig defaults
@@ -42,11 +48,23 @@ func TenantMiddleware(config *TenantConfig) func(http.Handler) http.Handler {
 				tenant = extractTenantFromHost(r.Host, config.BaseDomain)
 			}
 
+			// Fall back to the first path segment
+			if tenant == "" && config.FromPath {
+				tenant, r = splitTenantPath(r)
+			}
+
 			if tenant == "" {
 				tenant = config.DefaultTenant
 			}
 
+			if tenant != "" && !core.ValidTenantID(tenant) {
+				core.WriteError(w, r, http.StatusBadRequest, core.CodeInvalidTenant, "Tenant identifier is invalid")
+				return
+			}
+
 			ctx := context.WithValue(r.Context(), tenantKey{}, tenant)
+			// Scope BeaconAuth's queries and sessions to the tenant
+			ctx = core.WithTenant(ctx, tenant)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -78,6 +96,20 @@ func extractTenantFromHost(hostname, baseDomain string) string {
 	return subdomain
 }
 
+// splitTenantPath removes the first segment from the request path and
+// returns it with the request for the rest of the path
+func splitTenantPath(r *http.Request) (string, *http.Request) {
+	tenant, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if tenant == "" {
+		return "", r
+	}
+
+	r = r.Clone(r.Context())
+	r.URL.Path = "/" + rest
+	r.URL.RawPath = ""
+	return tenant, r
+}
+
 // GetTenant helper
 func GetTenant(ctx context.Context) string {
 	tenant, ok := ctx.Value(tenantKey{}).(string)
@@ -93,12 +125,7 @@ func RequireTenant() func(http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			tenant := GetTenant(r.Context())
 			if tenant == "" {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusBadRequest)
-				_ = json.NewEncoder(w).Encode(map[string]string{
-					"error":   "tenant_required",
-					"message": "Tenant identifier is required",
-				})
+				core.WriteError(w, r, http.StatusBadRequest, core.CodeTenantRequired, "Tenant identifier is required")
 				return
 			}
 			next.ServeHTTP(w, r)
@@ -12,7 +12,7 @@ func SessionMiddleware(manager *session.Manager) func(http.Handler) http.Handler
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Extract token from cookie
-			cookie, err := r.Cookie(manager.Config().CookieName)
+			token, err := core.ReadChunkedCookie(r, manager.Config().CookieName)
 			if err != nil {
 				// No session cookie, continue without session
 				next.ServeHTTP(w, r)
@@ -20,8 +20,8 @@ func SessionMiddleware(manager *session.Manager) func(http.Handler) http.Handler
 			}
 
 			// Get session from manager
-			ctx := r.Context()
-			session, user, err := manager.Get(ctx, cookie.Value)
+			ctx := core.WithClientInfo(r.Context(), manager.ClientInfo(r))
+			session, user, err := manager.Get(ctx, token)
 			if err != nil {
 				// Invalid or expired session, continue without session
 				next.ServeHTTP(w, r)
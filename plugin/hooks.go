@@ -3,12 +3,15 @@ package plugin
 import (
 	"context"
 	"fmt"
+	"slices"
+	"sort"
 )
 
 // HookRegistry manages lifecycle hooks from plugins
 type HookRegistry struct {
 	beforeHooks map[string][]Hook // plugin ID -> hooks
 	afterHooks  map[string][]Hook // plugin ID -> hooks
+	order       []string          // plugin IDs in registration order
 }
 
 // NewHookRegistry creates a new hook registry
@@ -25,6 +28,10 @@ func (r *HookRegistry) Register(pluginID string, config *HookConfig) {
 		return
 	}
 
+	if !slices.Contains(r.order, pluginID) {
+		r.order = append(r.order, pluginID)
+	}
+
 	if len(config.Before) > 0 {
 		r.beforeHooks[pluginID] = append(r.beforeHooks[pluginID], config.Before...)
 	}
@@ -34,32 +41,60 @@ func (r *HookRegistry) Register(pluginID string, config *HookConfig) {
 	}
 }
 
-// ExecuteBefore executes all matching before hooks
+// ExecuteBefore executes all matching before hooks, by priority and then
+// in registration order
 func (r *HookRegistry) ExecuteBefore(ctx context.Context, path, method string, data interface{}) error {
-	for pluginID, hooks := range r.beforeHooks {
-		for i, hook := range hooks {
-			if hook.Matcher(path, method) {
-				if err := hook.Handler(ctx, data); err != nil {
-					return fmt.Errorf("before hook %s[%d] failed: %w", pluginID, i, err)
-				}
+	return r.execute(ctx, "before", r.beforeHooks, path, method, data)
+}
+
+// ExecuteAfter executes all matching after hooks, by priority and then in
+// registration order
+func (r *HookRegistry) ExecuteAfter(ctx context.Context, path, method string, data interface{}) error {
+	return r.execute(ctx, "after", r.afterHooks, path, method, data)
+}
+
+type registeredHook struct {
+	pluginID string
+	index    int
+	hook     Hook
+}
+
+func (r *HookRegistry) execute(ctx context.Context, kind string, byPlugin map[string][]Hook, path, method string, data interface{}) error {
+	for _, h := range r.sorted(byPlugin) {
+		if h.hook.Matcher == nil || h.hook.Matcher(path, method) {
+			if err := h.hook.Handler(ctx, data); err != nil {
+				return fmt.Errorf("%s hook %s[%d] failed: %w", kind, h.pluginID, h.index, err)
 			}
 		}
 	}
 	return nil
 }
 
-// ExecuteAfter executes all matching after hooks
-func (r *HookRegistry) ExecuteAfter(ctx context.Context, path, method string, data interface{}) error {
-	for pluginID, hooks := range r.afterHooks {
-		for i, hook := range hooks {
-			if hook.Matcher(path, method) {
-				if err := hook.Handler(ctx, data); err != nil {
-					return fmt.Errorf("after hook %s[%d] failed: %w", pluginID, i, err)
-				}
-			}
+// sorted returns the hooks by priority and then in registration order
+func (r *HookRegistry) sorted(byPlugin map[string][]Hook) []registeredHook {
+	var hooks []registeredHook
+	for _, pluginID := range r.order {
+		for i, hook := range byPlugin[pluginID] {
+			hooks = append(hooks, registeredHook{pluginID: pluginID, index: i, hook: hook})
 		}
 	}
-	return nil
+	sort.SliceStable(hooks, func(i, j int) bool {
+		return hooks[i].hook.Priority < hooks[j].hook.Priority
+	})
+	return hooks
+}
+
+// Config returns the before and after hooks of all plugins, in the order
+// they are executed
+func (r *HookRegistry) Config() *HookConfig {
+	config := &HookConfig{}
+	for _, h := range r.sorted(r.beforeHooks) {
+		config.Before = append(config.Before, h.hook)
+	}
+	for _, h := range r.sorted(r.afterHooks) {
+		config.After = append(config.After, h.hook)
+	}
+	return config
 }
 
 // GetBeforeHooks returns all before hooks for a plugin
@@ -27,6 +27,18 @@ func NewManager(plugins []Plugin) *Manager {
 
 // Initialize initializes all plugins
 func (m *Manager) Initialize(ctx *core.AuthContext) error {
+	plugins := make([]core.Plugin, len(m.plugins))
+	for i, p := range m.plugins {
+		plugins[i] = p
+	}
+	var settings map[string]core.PluginSettings
+	if ctx.Config != nil {
+		settings = ctx.Config.PluginSettings
+	}
+	if err := core.ConfigurePlugins(plugins, settings); err != nil {
+		return err
+	}
+
 	for _, p := range m.plugins {
 		if err := p.Init(ctx); err != nil {
 			return fmt.Errorf("failed to initialize plugin %s: %w", p.ID(), err)
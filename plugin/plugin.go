@@ -1,7 +1,6 @@
 package plugin
 
 import (
-	"context"
 	"net/http"
 
 	"github.com/marshallshelly/beacon-auth/core"
@@ -23,28 +22,33 @@ type Plugin interface {
 
 	// Middleware returns middleware to be injected
 	Middleware() []MiddlewareConfig
+
+	// Config returns a pointer to the plugin's settings struct, filled
+	// from its section of the config file, or nil without settings
+	Config() interface{}
+
+	// ValidateConfig checks the plugin's settings before Init
+	ValidateConfig() error
 }
 
 // Endpoint represents an HTTP endpoint
 type Endpoint = core.Endpoint
 
 // EndpointOptions holds endpoint configuration
+//
+// Deprecated: set Auth and Middleware on the Endpoint instead.
 type EndpointOptions struct {
 	RequireAuth bool
 	Middleware  []func(http.Handler) http.Handler
 }
 
 // HookConfig defines lifecycle hooks
-type HookConfig struct {
-	Before []Hook
-	After  []Hook
-}
+type HookConfig = core.HookConfig
 
-// Hook is a function that runs before or after a request
-type Hook struct {
-	Matcher func(path string, method string) bool
-	Handler func(ctx context.Context, data interface{}) error
-}
+// Hook is a function that runs before or after a request. Before hooks
+// receive a *core.HookRequest, may change its Body and may answer the
+// request by returning a *core.HookResponse.
+type Hook = core.RequestHook
 
 // MiddlewareConfig defines middleware to inject
 type MiddlewareConfig struct {
@@ -87,3 +91,13 @@ func (p *BasePlugin) Hooks() *HookConfig {
 func (p *BasePlugin) Middleware() []MiddlewareConfig {
 	return nil
 }
+
+// Config returns no settings by default
+func (p *BasePlugin) Config() interface{} {
+	return nil
+}
+
+// ValidateConfig accepts the configuration by default
+func (p *BasePlugin) ValidateConfig() error {
+	return nil
+}
@@ -3,6 +3,7 @@ package plugin
 import (
 	"context"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/marshallshelly/beacon-auth/core"
@@ -406,3 +407,34 @@ func TestHookRegistry_HasHooks(t *testing.T) {
 		t.Error("Expected no after hooks")
 	}
 }
+
+func TestHookRegistry_DeterministicOrder(t *testing.T) {
+	registry := NewHookRegistry()
+
+	var order []string
+	record := func(name string) func(ctx context.Context, data interface{}) error {
+		return func(ctx context.Context, data interface{}) error {
+			order = append(order, name)
+			return nil
+		}
+	}
+
+	registry.Register("zeta", &HookConfig{Before: []Hook{
+		{Matcher: MatchAll(), Handler: record("zeta-0")},
+		{Matcher: MatchAll(), Handler: record("zeta-1")},
+	}})
+	registry.Register("alpha", &HookConfig{Before: []Hook{
+		{Matcher: MatchAll(), Handler: record("alpha-0")},
+		{Handler: record("alpha-first"), Priority: -10},
+	}})
+
+	for run := 0; run < 5; run++ {
+		order = nil
+		if err := registry.ExecuteBefore(context.Background(), "/test", "POST", nil); err != nil {
+			t.Fatalf("ExecuteBefore failed: %v", err)
+		}
+		if got := strings.Join(order, ","); got != "alpha-first,zeta-0,zeta-1,alpha-0" {
+			t.Fatalf("Unexpected hook order %s", got)
+		}
+	}
+}
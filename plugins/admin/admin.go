@@ -0,0 +1,109 @@
+// Package admin serves a JSON API for internal dashboards: paginated,
+// filterable and sortable lists of users, active sessions and audit logs.
+// Every endpoint requires the session of an admin (core.RoleAdmin).
+//
+//	auth, err := beaconauth.New(
+//		beaconauth.WithPlugins(emailpassword.New(), admin.New(nil)),
+//	)
+//	// GET /auth/admin/users?query=@example.com&role=admin&sort=-created_at
+//
+// The plugin records the events of the event bus (sign-ups, sign-ins,
+// sessions and security events) in its audit_logs table, which GET
+// /admin/audit-logs lists.
+package admin
+
+import (
+	"fmt"
+
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/plugin"
+)
+
+// Default plugin table names. Use them as keys in core.TableNames.Plugins
+// to rename the tables.
+const (
+	TableAuditLogs = "audit_logs"
+)
+
+// Options configures the admin API
+type Options struct {
+	// DefaultLimit is the page size of lists without a limit parameter
+	// (default 50)
+	DefaultLimit int `yaml:"default_limit"`
+
+	// MaxLimit caps the limit parameter (default 200)
+	MaxLimit int `yaml:"max_limit"`
+
+	// DisableAuditLog stops recording events in the audit_logs table. The
+	// audit-logs endpoint then lists what was recorded before.
+	DisableAuditLog bool `yaml:"disable_audit_log"`
+}
+
+// AdminPlugin serves the admin API
+type AdminPlugin struct {
+	*plugin.BasePlugin
+	ctx  *core.AuthContext
+	opts Options
+}
+
+// New creates the admin plugin
+func New(opts *Options) *AdminPlugin {
+	o := Options{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.DefaultLimit == 0 {
+		o.DefaultLimit = 50
+	}
+	if o.MaxLimit == 0 {
+		o.MaxLimit = 200
+	}
+
+	return &AdminPlugin{
+		BasePlugin: plugin.NewBasePlugin("admin"),
+		opts:       o,
+	}
+}
+
+// Config returns the plugin's options, which the admin section of the
+// config file sets
+func (p *AdminPlugin) Config() interface{} {
+	return &p.opts
+}
+
+// ValidateConfig checks the options
+func (p *AdminPlugin) ValidateConfig() error {
+	if p.opts.DefaultLimit < 1 || p.opts.MaxLimit < p.opts.DefaultLimit {
+		return fmt.Errorf("admin: limits must satisfy 1 <= default_limit <= max_limit, got %d and %d", p.opts.DefaultLimit, p.opts.MaxLimit)
+	}
+	return nil
+}
+
+// Init subscribes the audit log to the event bus
+func (p *AdminPlugin) Init(ctx *core.AuthContext) error {
+	p.ctx = ctx
+	if !p.opts.DisableAuditLog && ctx.Events != nil {
+		ctx.Events.Subscribe("*", p.recordEvent, core.Async(0))
+	}
+	return nil
+}
+
+// DescribeSecurity reports whether events are audited
+func (p *AdminPlugin) DescribeSecurity() map[string]interface{} {
+	return map[string]interface{}{
+		"auditLog": !p.opts.DisableAuditLog,
+	}
+}
+
+// Endpoints returns the admin endpoints
+func (p *AdminPlugin) Endpoints() map[string]plugin.Endpoint {
+	return map[string]plugin.Endpoint{
+		"/admin/users":      {Method: "GET", Handler: p.handleListUsers, Auth: core.AuthAdmin},
+		"/admin/sessions":   {Method: "GET", Handler: p.handleListSessions, Auth: core.AuthAdmin},
+		"/admin/audit-logs": {Method: "GET", Handler: p.handleListAuditLogs, Auth: core.AuthAdmin},
+	}
+}
+
+func (p *AdminPlugin) table(name string) string {
+	return p.ctx.Config.TableNames.Table(name)
+}
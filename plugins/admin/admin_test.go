@@ -0,0 +1,231 @@
+package admin_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	beaconauth "github.com/marshallshelly/beacon-auth"
+	"github.com/marshallshelly/beacon-auth/adapters/sqlite"
+	"github.com/marshallshelly/beacon-auth/cmd/beacon/schema"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/plugins/admin"
+	"github.com/marshallshelly/beacon-auth/plugins/emailpassword"
+)
+
+type silentLogger struct{}
+
+func (silentLogger) Debug(string, ...interface{}) {}
+func (silentLogger) Info(string, ...interface{})  {}
+func (silentLogger) Warn(string, ...interface{})  {}
+func (silentLogger) Error(string, ...interface{}) {}
+
+type testServer struct {
+	t       *testing.T
+	handler http.Handler
+	db      core.Adapter
+	cookies []*http.Cookie
+}
+
+func newTestServer(t *testing.T, opts *admin.Options) *testServer {
+	t.Helper()
+	ctx := context.Background()
+	db, err := sqlite.New(ctx, &sqlite.Config{InMemory: true})
+	if err != nil {
+		t.Fatalf("sqlite.New() error = %v", err)
+	}
+	script, err := schema.GenerateSQL(&schema.Config{Adapter: "sqlite", Plugins: []string{"admin"}})
+	if err != nil {
+		t.Fatalf("GenerateSQL() error = %v", err)
+	}
+	for _, stmt := range schema.SplitStatements(script, "sqlite") {
+		if err := db.Exec(ctx, stmt); err != nil {
+			t.Fatalf("Exec() error = %v", err)
+		}
+	}
+
+	auth, err := beaconauth.New(
+		beaconauth.WithAdapter(db),
+		beaconauth.WithSecret("test-secret-key-that-is-long-enough"),
+		beaconauth.WithBaseURL("http://localhost:8080"),
+		beaconauth.WithPlugins(emailpassword.New(), admin.New(opts)),
+		beaconauth.WithLogger(silentLogger{}),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { auth.Close() })
+	return &testServer{t: t, handler: auth.Handler(), db: db}
+}
+
+func (s *testServer) do(method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for _, c := range s.cookies {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// register signs up a user with role and returns the user's ID
+func (s *testServer) register(email, role string) string {
+	s.t.Helper()
+	rec := s.do("POST", "/auth/register", `{"email":"`+email+`","password":"secret-password"}`)
+	if rec.Code != http.StatusOK {
+		s.t.Fatalf("register: status %d: %s", rec.Code, rec.Body)
+	}
+	var user core.User
+	_ = json.Unmarshal(rec.Body.Bytes(), &user)
+	if role != "" {
+		query := core.NewQuery(core.ModelUsers).Where("id", core.OpEqual, user.ID).Build()
+		if _, err := s.db.Update(context.Background(), query, map[string]interface{}{"role": role}); err != nil {
+			s.t.Fatalf("Update() error = %v", err)
+		}
+	}
+	return user.ID
+}
+
+func (s *testServer) signIn(email string) {
+	s.t.Helper()
+	rec := s.do("POST", "/auth/login", `{"email":"`+email+`","password":"secret-password"}`)
+	if rec.Code != http.StatusOK {
+		s.t.Fatalf("login: status %d: %s", rec.Code, rec.Body)
+	}
+	s.cookies = rec.Result().Cookies()
+}
+
+func (s *testServer) list(path string, dst interface{}) admin.Pagination {
+	s.t.Helper()
+	rec := s.do("GET", path, "")
+	if rec.Code != http.StatusOK {
+		s.t.Fatalf("%s: status %d: %s", path, rec.Code, rec.Body)
+	}
+	var page struct {
+		Data       json.RawMessage  `json:"data"`
+		Pagination admin.Pagination `json:"pagination"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		s.t.Fatalf("%s: %v", path, err)
+	}
+	if err := json.Unmarshal(page.Data, dst); err != nil {
+		s.t.Fatalf("%s: %v", path, err)
+	}
+	return page.Pagination
+}
+
+// eventually lists the audit logs of path until there are some, as events
+// are recorded asynchronously
+func (s *testServer) eventually(path string, logs *[]*admin.AuditLog) {
+	s.t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		s.list(path, logs)
+		if len(*logs) > 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			s.t.Fatalf("%s: no audit logs", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAdminPlugin_RequiresAdmin(t *testing.T) {
+	s := newTestServer(t, nil)
+	if rec := s.do("GET", "/auth/admin/users", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("no session: status %d, want 401", rec.Code)
+	}
+	s.register("member@example.com", "")
+	s.signIn("member@example.com")
+	if rec := s.do("GET", "/auth/admin/users", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("member: status %d, want 403", rec.Code)
+	}
+}
+
+func TestAdminPlugin_ListUsers(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.register("root@example.com", core.RoleAdmin)
+	for _, email := range []string{"ana@example.com", "ben@example.com", "cho@other.com"} {
+		s.register(email, "")
+	}
+	s.signIn("root@example.com")
+
+	var users []*core.User
+	page := s.list("/auth/admin/users?query=example.com&sort=email&limit=2", &users)
+	if page.Total != 3 || len(users) != 2 || users[0].Email != "ana@example.com" || users[1].Email != "ben@example.com" {
+		t.Fatalf("first page: %+v, %d users", page, len(users))
+	}
+	if page.NextCursor == "" {
+		t.Fatal("first page has no next cursor")
+	}
+
+	page = s.list("/auth/admin/users?query=example.com&sort=email&limit=2&cursor="+page.NextCursor, &users)
+	if len(users) != 1 || users[0].Email != "root@example.com" || page.NextCursor != "" {
+		t.Errorf("last page: %+v, users %v", page, users)
+	}
+
+	s.list("/auth/admin/users?role=admin", &users)
+	if len(users) != 1 || users[0].Email != "root@example.com" {
+		t.Errorf("role filter returned %v", users)
+	}
+
+	for _, bad := range []string{"sort=password", "limit=0", "cursor=!!", "banned=maybe"} {
+		if rec := s.do("GET", "/auth/admin/users?"+bad, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", bad, rec.Code)
+		}
+	}
+}
+
+func TestAdminPlugin_ListSessions(t *testing.T) {
+	s := newTestServer(t, nil)
+	adminID := s.register("root@example.com", core.RoleAdmin)
+	s.register("ana@example.com", "")
+	s.signIn("root@example.com")
+
+	var sessions []*core.Session
+	page := s.list("/auth/admin/sessions?user_id="+adminID, &sessions)
+	if page.Total != 2 || len(sessions) != 2 {
+		t.Fatalf("sessions of the admin: %+v, %d sessions", page, len(sessions))
+	}
+	for _, session := range sessions {
+		if session.UserID != adminID || session.Token != "" {
+			t.Errorf("unexpected session %+v", session)
+		}
+	}
+}
+
+func TestAdminPlugin_AuditLogs(t *testing.T) {
+	s := newTestServer(t, nil)
+	adminID := s.register("root@example.com", core.RoleAdmin)
+	s.signIn("root@example.com")
+	if rec := s.do("POST", "/auth/login", `{"email":"root@example.com","password":"wrong"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong password: status %d", rec.Code)
+	}
+
+	var logs []*admin.AuditLog
+	s.eventually("/auth/admin/audit-logs?user_id="+adminID+"&event="+core.TopicSignIn, &logs)
+	if logs[0].SessionID == "" || logs[0].Details["method"] != core.MethodPassword {
+		t.Errorf("sign-in audited as %+v", logs[0])
+	}
+
+	s.eventually("/auth/admin/audit-logs?event=security.*", &logs)
+	if logs[0].Event != "security.login_failed" || logs[0].UserID != adminID || logs[0].Details["reason"] != "invalid password" {
+		t.Errorf("failed sign-in audited as %+v", logs[0])
+	}
+
+	if rec := s.do("GET", "/auth/admin/audit-logs?since=yesterday", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid since: status %d, want 400", rec.Code)
+	}
+}
+
+func TestAdminPlugin_ValidateConfig(t *testing.T) {
+	if err := admin.New(&admin.Options{DefaultLimit: 100, MaxLimit: 10}).ValidateConfig(); err == nil {
+		t.Error("accepted a default limit above the maximum")
+	}
+}
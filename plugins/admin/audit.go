@@ -0,0 +1,222 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/crypto"
+	"github.com/marshallshelly/beacon-auth/repo"
+)
+
+// AuditLog is an event recorded in the audit log
+type AuditLog struct {
+	ID string `json:"id"`
+
+	// Event is the topic the event was published under, such as
+	// core.TopicSignIn or "security.login_failed"
+	Event string `json:"event"`
+
+	UserID    string `json:"userId,omitempty"`
+	ActorID   string `json:"actorId,omitempty"`
+	SessionID string `json:"sessionId,omitempty"`
+	IPAddress string `json:"ipAddress,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+
+	// Details holds event-specific fields, such as the sign-in method
+	Details map[string]interface{} `json:"details,omitempty"`
+
+	// Anonymized reports whether the entry's personal data was removed,
+	// see AnonymizeAuditLogs
+	Anonymized bool `json:"anonymized,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// auditRecord is a row of the audit_logs table
+type auditRecord struct {
+	ID         string    `db:"id"`
+	Event      string    `db:"event"`
+	UserID     string    `db:"user_id"`
+	ActorID    string    `db:"actor_id"`
+	SessionID  string    `db:"session_id"`
+	IPAddress  string    `db:"ip_address"`
+	UserAgent  string    `db:"user_agent"`
+	Details    string    `db:"details"` // JSON object, or empty
+	Anonymized bool      `db:"anonymized"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+func (r *auditRecord) auditLog() *AuditLog {
+	log := &AuditLog{
+		ID:         r.ID,
+		Event:      r.Event,
+		UserID:     r.UserID,
+		ActorID:    r.ActorID,
+		SessionID:  r.SessionID,
+		IPAddress:  r.IPAddress,
+		UserAgent:  r.UserAgent,
+		Anonymized: r.Anonymized,
+		CreatedAt:  r.CreatedAt,
+	}
+	if r.Details != "" {
+		_ = json.Unmarshal([]byte(r.Details), &log.Details)
+	}
+	return log
+}
+
+// recordEvent stores an event of the bus in the audit log. Session tokens
+// are never recorded.
+func (p *AdminPlugin) recordEvent(ctx context.Context, event *core.Event) error {
+	record := &auditRecord{Event: event.Topic, CreatedAt: event.Time}
+	details := map[string]interface{}{}
+
+	setClient := func(client core.ClientInfo) {
+		record.IPAddress = client.IPAddress
+		record.UserAgent = client.UserAgent
+	}
+	switch data := event.Data.(type) {
+	case *core.UserCreatedEvent:
+		record.UserID = data.User.ID
+		setClient(data.Client)
+		details["email"] = data.User.Email
+		details["method"] = data.Method
+		details["provider"] = data.Provider
+	case *core.SignInEvent:
+		record.UserID = data.User.ID
+		if data.Session != nil {
+			record.SessionID = data.Session.ID
+		}
+		setClient(data.Client)
+		details["method"] = data.Method
+		details["provider"] = data.Provider
+	case *core.SessionCreatedEvent:
+		record.UserID = data.Session.UserID
+		record.SessionID = data.Session.ID
+		setClient(data.Client)
+	case *core.SecurityEvent:
+		record.UserID = data.UserID
+		record.ActorID = data.ActorID
+		record.SessionID = data.SessionID
+		record.IPAddress = data.IPAddress
+		record.UserAgent = data.UserAgent
+		details["severity"] = string(data.Severity)
+		details["email"] = data.Email
+		details["reason"] = data.Reason
+		for key, value := range data.Metadata {
+			details[key] = value
+		}
+	}
+
+	for key, value := range details {
+		if value == "" || value == nil {
+			delete(details, key)
+		}
+	}
+	if len(details) > 0 {
+		encoded, err := json.Marshal(details)
+		if err != nil {
+			return err
+		}
+		record.Details = string(encoded)
+	}
+
+	id, err := crypto.GenerateID()
+	if err != nil {
+		return err
+	}
+	record.ID = id
+	_, err = repo.Create(ctx, p.ctx.Adapter, p.table(TableAuditLogs), record)
+	return err
+}
+
+// handleListAuditLogs lists audit log entries, newest first by default.
+// Filters: user_id, event (a topic, or a prefix ending in ".*" such as
+// "security.*"), since and until (RFC 3339).
+func (p *AdminPlugin) handleListAuditLogs(w http.ResponseWriter, r *http.Request) {
+	params, ok := p.listParams(w, r, map[string]string{"created_at": "created_at", "event": "event"}, "-created_at")
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	q := core.NewQuery(p.table(TableAuditLogs))
+	if userID := query.Get("user_id"); userID != "" {
+		q.Where("user_id", core.OpEqual, userID)
+	}
+	if event := query.Get("event"); event != "" {
+		if prefix, ok := strings.CutSuffix(event, "*"); ok {
+			q.Where("event", core.OpLike, prefix+"%")
+		} else {
+			q.Where("event", core.OpEqual, event)
+		}
+	}
+	for _, bound := range []struct {
+		param string
+		op    core.Operator
+	}{{"since", core.OpGreaterOrEqual}, {"until", core.OpLessThan}} {
+		value := query.Get(bound.param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			core.WriteError(w, r, http.StatusBadRequest, core.CodeValidation, bound.param+" must be an RFC 3339 time")
+			return
+		}
+		q.Where("created_at", bound.op, t)
+	}
+
+	records, page, err := listPage[auditRecord](r.Context(), p.ctx.Adapter, q, params)
+	if err != nil {
+		p.ctx.Logger.Error("Failed to list audit logs: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	logs := make([]*AuditLog, len(records))
+	for i, record := range records {
+		logs[i] = record.auditLog()
+	}
+	writePage(w, logs, page)
+}
+
+// ExportUserData returns the audit log entries about the user for data
+// exports, oldest first
+func (p *AdminPlugin) ExportUserData(ctx context.Context, userID string) (interface{}, error) {
+	query := core.NewQuery(p.table(TableAuditLogs)).
+		Where("user_id", core.OpEqual, userID).
+		OrderBy("created_at", false).
+		Build()
+	records, err := repo.FindMany[auditRecord](ctx, p.ctx.Adapter, query)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	logs := make([]*AuditLog, len(records))
+	for i, record := range records {
+		logs[i] = record.auditLog()
+	}
+	return logs, nil
+}
+
+// AnonymizeAuditLogs removes the personal data of audit log entries
+// created before cutoff: the user, actor and session IDs, the client's IP
+// address and user agent, and the details. The event and its time are
+// kept. It returns how many entries were anonymized.
+func (p *AdminPlugin) AnonymizeAuditLogs(ctx context.Context, cutoff time.Time) (int64, error) {
+	query := core.NewQuery(p.table(TableAuditLogs)).
+		Where("created_at", core.OpLessThan, cutoff).
+		Where("anonymized", core.OpEqual, false).
+		Build()
+	return p.ctx.Adapter.UpdateMany(ctx, query, map[string]interface{}{
+		"user_id":    nil,
+		"actor_id":   nil,
+		"session_id": nil,
+		"ip_address": nil,
+		"user_agent": nil,
+		"details":    nil,
+		"anonymized": true,
+	})
+}
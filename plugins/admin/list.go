@@ -0,0 +1,197 @@
+package admin
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/repo"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// Page is the envelope of list responses
+type Page[T any] struct {
+	Data       []T        `json:"data"`
+	Pagination Pagination `json:"pagination"`
+}
+
+// Pagination describes the page of a list response. Pass NextCursor as
+// the cursor parameter to get the next page; it is empty on the last one.
+type Pagination struct {
+	Limit      int    `json:"limit"`
+	Total      int64  `json:"total"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// listParams are the limit, cursor and sort parameters of a list
+type listParams struct {
+	limit  int
+	offset int
+	sort   string
+	desc   bool
+}
+
+// listParams reads the limit, cursor and sort parameters. sort names a
+// key of sortable, optionally prefixed with "-" for descending order.
+// Invalid parameters are answered with 400 Bad Request.
+func (p *AdminPlugin) listParams(w http.ResponseWriter, r *http.Request, sortable map[string]string, defaultSort string) (listParams, bool) {
+	query := r.URL.Query()
+	params := listParams{limit: p.opts.DefaultLimit}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			core.WriteError(w, r, http.StatusBadRequest, core.CodeValidation, "limit must be a positive number")
+			return params, false
+		}
+		params.limit = min(n, p.opts.MaxLimit)
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		offset, err := decodeCursor(cursor)
+		if err != nil {
+			core.WriteError(w, r, http.StatusBadRequest, core.CodeValidation, "Invalid cursor")
+			return params, false
+		}
+		params.offset = offset
+	}
+
+	sort := query.Get("sort")
+	if sort == "" {
+		sort = defaultSort
+	}
+	sort, params.desc = strings.CutPrefix(sort, "-")
+	column, ok := sortable[sort]
+	if !ok {
+		core.WriteError(w, r, http.StatusBadRequest, core.CodeValidation, "Unsupported sort field: "+sort)
+		return params, false
+	}
+	params.sort = column
+	return params, true
+}
+
+// listPage returns a page of the records matching q. Records are ordered
+// by the sort column, then by id so pages do not overlap.
+func listPage[T any](ctx context.Context, adapter core.Adapter, q *core.QueryBuilder, params listParams) ([]*T, Pagination, error) {
+	page := Pagination{Limit: params.limit}
+
+	total, err := adapter.Count(ctx, q.Build())
+	if err != nil {
+		return nil, page, err
+	}
+	page.Total = total
+
+	query := q.OrderBy(params.sort, params.desc).
+		OrderBy("id", params.desc).
+		Limit(params.limit + 1).
+		Offset(params.offset).
+		Build()
+	records, err := repo.FindMany[T](ctx, adapter, query)
+	if err != nil {
+		return nil, page, err
+	}
+	if len(records) > params.limit {
+		records = records[:params.limit]
+		page.NextCursor = encodeCursor(params.offset + params.limit)
+	}
+	return records, page, nil
+}
+
+// encodeCursor returns the cursor of the page starting at offset. Cursors
+// are opaque to clients, so their format can change.
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("o:" + strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	offset, err := strconv.Atoi(strings.TrimPrefix(string(raw), "o:"))
+	if err != nil || offset < 0 || !strings.HasPrefix(string(raw), "o:") {
+		return 0, errInvalidCursor
+	}
+	return offset, nil
+}
+
+func writePage[T any](w http.ResponseWriter, data []T, page Pagination) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(&Page[T]{Data: data, Pagination: page})
+}
+
+// handleListUsers lists users, newest first by default. Filters: query
+// (part of the email), role and banned (true or false).
+func (p *AdminPlugin) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	params, ok := p.listParams(w, r, map[string]string{
+		"created_at": "created_at",
+		"updated_at": "updated_at",
+		"email":      "email",
+		"name":       "name",
+	}, "-created_at")
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	q := core.NewQuery(p.table(core.ModelUsers))
+	if search := query.Get("query"); search != "" {
+		q.Where("email", core.OpLike, "%"+search+"%")
+	}
+	if role := query.Get("role"); role != "" {
+		q.Where("role", core.OpEqual, role)
+	}
+	if banned := query.Get("banned"); banned != "" {
+		b, err := strconv.ParseBool(banned)
+		if err != nil {
+			core.WriteError(w, r, http.StatusBadRequest, core.CodeValidation, "banned must be true or false")
+			return
+		}
+		q.Where("banned", core.OpEqual, b)
+	}
+
+	users, page, err := listPage[core.User](r.Context(), p.ctx.Adapter, q, params)
+	if err != nil {
+		p.ctx.Logger.Error("Failed to list users: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	writePage(w, users, page)
+}
+
+// handleListSessions lists unexpired sessions, newest first by default.
+// Filters: user_id. Session tokens are left out.
+func (p *AdminPlugin) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	params, ok := p.listParams(w, r, map[string]string{
+		"created_at": "created_at",
+		"updated_at": "updated_at",
+		"expires_at": "expires_at",
+	}, "-created_at")
+	if !ok {
+		return
+	}
+
+	q := core.NewQuery(p.table(core.ModelSessions)).
+		Where("expires_at", core.OpGreaterThan, time.Now())
+	if userID := r.URL.Query().Get("user_id"); userID != "" {
+		q.Where("user_id", core.OpEqual, userID)
+	}
+
+	sessions, page, err := listPage[core.Session](r.Context(), p.ctx.Adapter, q, params)
+	if err != nil {
+		p.ctx.Logger.Error("Failed to list sessions: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	for _, s := range sessions {
+		s.Token = ""
+	}
+	writePage(w, sessions, page)
+}
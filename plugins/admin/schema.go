@@ -0,0 +1,25 @@
+package admin
+
+import "github.com/marshallshelly/beacon-auth/core"
+
+// Schema returns the audit log table. Entries outlive the users and
+// sessions they mention, so they have no foreign keys.
+func (p *AdminPlugin) Schema() []core.TableDef {
+	return []core.TableDef{
+		{
+			Model: TableAuditLogs,
+			Columns: []core.ColumnDef{
+				{Name: "id", Type: core.ColumnID},
+				{Name: "event", Type: core.ColumnString, Size: 100, NotNull: true},
+				{Name: "user_id", Type: core.ColumnString},
+				{Name: "actor_id", Type: core.ColumnString},
+				{Name: "session_id", Type: core.ColumnString},
+				{Name: "ip_address", Type: core.ColumnString},
+				{Name: "user_agent", Type: core.ColumnText},
+				{Name: "details", Type: core.ColumnText},
+				{Name: "anonymized", Type: core.ColumnBool, Default: "false"},
+				{Name: "created_at", Type: core.ColumnTimestamp, Default: core.DefaultNow},
+			},
+		},
+	}
+}
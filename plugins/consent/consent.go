@@ -0,0 +1,400 @@
+package consent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/crypto"
+	"github.com/marshallshelly/beacon-auth/plugin"
+	"github.com/marshallshelly/beacon-auth/repo"
+)
+
+// Default plugin table names. Use them as keys in core.TableNames.Plugins
+// to rename the tables.
+const (
+	TableConsents = "consents"
+)
+
+var (
+	// ErrUnknownApp is returned for applications that are not registered
+	ErrUnknownApp = errors.New("unknown application")
+
+	// ErrScopeNotAllowed is returned when a scope is not allowed for the
+	// application
+	ErrScopeNotAllowed = errors.New("scope not allowed for application")
+
+	// ErrRedirectNotAllowed is returned when a redirect URI is not
+	// registered for the application
+	ErrRedirectNotAllowed = errors.New("redirect URI not allowed for application")
+)
+
+// App is a first-party application that shares BeaconAuth
+type App struct {
+	// ID identifies the application in consent records and requests
+	ID string
+
+	// Name is shown to users when they review their consents
+	Name string
+
+	// Scopes lists the scopes the application may request
+	Scopes []string
+
+	// RedirectURIs lists the URIs users may be sent back to after granting
+	// consent. They are compared exactly.
+	RedirectURIs []string
+}
+
+// Consent records the scopes a user granted to an application
+type Consent struct {
+	AppID     string    `json:"appId"`
+	AppName   string    `json:"appName"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// consentRecord is a row of the consents table
+type consentRecord struct {
+	ID        string    `db:"id"`
+	UserID    string    `db:"user_id"`
+	AppID     string    `db:"app_id"`
+	Scopes    string    `db:"scopes"` // space-separated
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// ConsentPlugin records per-user consent for first-party applications
+type ConsentPlugin struct {
+	*plugin.BasePlugin
+	ctx  *core.AuthContext
+	apps map[string]App
+}
+
+// New creates a new consent plugin for the given applications
+func New(apps ...App) *ConsentPlugin {
+	p := &ConsentPlugin{
+		BasePlugin: plugin.NewBasePlugin("consent"),
+		apps:       make(map[string]App, len(apps)),
+	}
+	for _, app := range apps {
+		p.apps[app.ID] = app
+	}
+	return p
+}
+
+// Init initializes the plugin
+func (p *ConsentPlugin) Init(ctx *core.AuthContext) error {
+	for id, app := range p.apps {
+		if id == "" {
+			return errors.New("consent: application ID is required")
+		}
+		if len(app.Scopes) == 0 {
+			return fmt.Errorf("consent: application %s has no scopes", id)
+		}
+	}
+	p.ctx = ctx
+	return nil
+}
+
+// DescribeSecurity reports the registered applications
+func (p *ConsentPlugin) DescribeSecurity() map[string]interface{} {
+	return map[string]interface{}{
+		"apps": len(p.apps),
+	}
+}
+
+// Endpoints returns the plugin endpoints
+func (p *ConsentPlugin) Endpoints() map[string]plugin.Endpoint {
+	return map[string]plugin.Endpoint{
+		"/consent/grant":  {Method: "POST", Handler: p.handleGrant, Auth: core.AuthSession},
+		"/consent/list":   {Method: "GET", Handler: p.handleList, Auth: core.AuthSession},
+		"/consent/revoke": {Method: "POST", Handler: p.handleRevoke, Auth: core.AuthSession},
+	}
+}
+
+// App returns a registered application
+func (p *ConsentPlugin) App(id string) (App, bool) {
+	app, ok := p.apps[id]
+	return app, ok
+}
+
+// ValidateRedirect checks that a redirect URI is registered for an
+// application
+func (p *ConsentPlugin) ValidateRedirect(appID, redirectURI string) error {
+	app, ok := p.apps[appID]
+	if !ok {
+		return ErrUnknownApp
+	}
+	for _, uri := range app.RedirectURIs {
+		if uri == redirectURI {
+			return nil
+		}
+	}
+	return ErrRedirectNotAllowed
+}
+
+// Grant records that a user consented to scopes for an application.
+// Scopes are added to any previously granted ones.
+func (p *ConsentPlugin) Grant(ctx context.Context, userID, appID string, scopes []string) (*Consent, error) {
+	app, ok := p.apps[appID]
+	if !ok {
+		return nil, ErrUnknownApp
+	}
+	for _, scope := range scopes {
+		if !contains(app.Scopes, scope) {
+			return nil, fmt.Errorf("%w: %s", ErrScopeNotAllowed, scope)
+		}
+	}
+
+	query := p.consentQuery(userID, appID)
+	existing, err := repo.FindOne[consentRecord](ctx, p.ctx.Adapter, query)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if existing != nil {
+		granted := mergeScopes(strings.Fields(existing.Scopes), scopes)
+		data := map[string]interface{}{
+			"scopes":     strings.Join(granted, " "),
+			"updated_at": now,
+		}
+		if _, err := p.ctx.Adapter.Update(ctx, query, data); err != nil {
+			return nil, err
+		}
+		return &Consent{
+			AppID:     appID,
+			AppName:   app.Name,
+			Scopes:    granted,
+			CreatedAt: existing.CreatedAt,
+			UpdatedAt: now,
+		}, nil
+	}
+
+	id, err := crypto.GenerateID()
+	if err != nil {
+		return nil, err
+	}
+	granted := mergeScopes(nil, scopes)
+	_, err = repo.Create(ctx, p.ctx.Adapter, p.table(TableConsents), &consentRecord{
+		ID:        id,
+		UserID:    userID,
+		AppID:     appID,
+		Scopes:    strings.Join(granted, " "),
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Consent{
+		AppID:     appID,
+		AppName:   app.Name,
+		Scopes:    granted,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
+
+// HasConsent reports whether a user granted all of the given scopes to an
+// application
+func (p *ConsentPlugin) HasConsent(ctx context.Context, userID, appID string, scopes ...string) (bool, error) {
+	record, err := repo.FindOne[consentRecord](ctx, p.ctx.Adapter, p.consentQuery(userID, appID))
+	if err != nil || record == nil {
+		return false, err
+	}
+
+	granted := strings.Fields(record.Scopes)
+	for _, scope := range scopes {
+		if !contains(granted, scope) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Consents lists the applications a user granted access to, ordered by
+// application ID. Consents for applications that are no longer registered
+// are skipped.
+func (p *ConsentPlugin) Consents(ctx context.Context, userID string) ([]*Consent, error) {
+	query := core.NewQuery(p.table(TableConsents)).
+		Where("user_id", core.OpEqual, userID).
+		Build()
+	records, err := repo.FindMany[consentRecord](ctx, p.ctx.Adapter, query)
+	if err != nil {
+		return nil, err
+	}
+
+	consents := make([]*Consent, 0, len(records))
+	for _, record := range records {
+		app, ok := p.apps[record.AppID]
+		if !ok {
+			continue
+		}
+		consents = append(consents, &Consent{
+			AppID:     record.AppID,
+			AppName:   app.Name,
+			Scopes:    strings.Fields(record.Scopes),
+			CreatedAt: record.CreatedAt,
+			UpdatedAt: record.UpdatedAt,
+		})
+	}
+
+	sort.Slice(consents, func(i, j int) bool {
+		return consents[i].AppID < consents[j].AppID
+	})
+	return consents, nil
+}
+
+// ExportUserData returns the user's consents for data exports
+func (p *ConsentPlugin) ExportUserData(ctx context.Context, userID string) (interface{}, error) {
+	consents, err := p.Consents(ctx, userID)
+	if err != nil || len(consents) == 0 {
+		return nil, err
+	}
+	return consents, nil
+}
+
+// Revoke removes a user's consent for an application
+func (p *ConsentPlugin) Revoke(ctx context.Context, userID, appID string) error {
+	return p.ctx.Adapter.Delete(ctx, p.consentQuery(userID, appID))
+}
+
+type grantRequest struct {
+	AppID       string   `json:"appId"`
+	Scopes      []string `json:"scopes"`
+	RedirectURI string   `json:"redirectUri,omitempty"`
+}
+
+type grantResponse struct {
+	Consent     *Consent `json:"consent"`
+	RedirectURI string   `json:"redirectUri,omitempty"`
+}
+
+type revokeRequest struct {
+	AppID string `json:"appId"`
+}
+
+func (p *ConsentPlugin) handleGrant(w http.ResponseWriter, r *http.Request) {
+	user := p.getUser(r)
+	if user == nil {
+		core.WriteStatusError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req grantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	if req.RedirectURI != "" {
+		if err := p.ValidateRedirect(req.AppID, req.RedirectURI); err != nil {
+			core.WriteStatusError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	consent, err := p.Grant(r.Context(), user.ID, req.AppID, req.Scopes)
+	if err != nil {
+		if errors.Is(err, ErrUnknownApp) || errors.Is(err, ErrScopeNotAllowed) {
+			core.WriteStatusError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Failed to record consent")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(grantResponse{
+		Consent:     consent,
+		RedirectURI: req.RedirectURI,
+	})
+}
+
+func (p *ConsentPlugin) handleList(w http.ResponseWriter, r *http.Request) {
+	user := p.getUser(r)
+	if user == nil {
+		core.WriteStatusError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	consents, err := p.Consents(r.Context(), user.ID)
+	if err != nil {
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Failed to list consents")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"consents": consents})
+}
+
+func (p *ConsentPlugin) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	user := p.getUser(r)
+	if user == nil {
+		core.WriteStatusError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req revokeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.AppID == "" {
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	if err := p.Revoke(r.Context(), user.ID, req.AppID); err != nil {
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Failed to revoke consent")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"success":true}`))
+}
+
+func (p *ConsentPlugin) getUser(r *http.Request) *core.User {
+	_, user := p.ctx.RequestSession(r)
+	return user
+}
+
+// DB Helpers
+
+// table returns the configured name of a plugin table
+func (p *ConsentPlugin) table(name string) string {
+	return p.ctx.Config.TableNames.Table(name)
+}
+
+func (p *ConsentPlugin) consentQuery(userID, appID string) *core.Query {
+	return core.NewQuery(p.table(TableConsents)).
+		Where("user_id", core.OpEqual, userID).
+		Where("app_id", core.OpEqual, appID).
+		Build()
+}
+
+// mergeScopes adds scopes to a granted list, keeping it sorted and unique
+func mergeScopes(granted, scopes []string) []string {
+	merged := append([]string{}, granted...)
+	for _, scope := range scopes {
+		if scope != "" && !contains(merged, scope) {
+			merged = append(merged, scope)
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
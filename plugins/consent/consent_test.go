@@ -0,0 +1,103 @@
+package consent
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/marshallshelly/beacon-auth/adapters/memory"
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+func newTestPlugin(t *testing.T) *ConsentPlugin {
+	t.Helper()
+
+	p := New(
+		App{
+			ID:           "dashboard",
+			Name:         "Dashboard",
+			Scopes:       []string{"profile", "billing"},
+			RedirectURIs: []string{"https://dashboard.example.com/callback"},
+		},
+		App{ID: "mobile", Name: "Mobile", Scopes: []string{"profile"}},
+	)
+	if err := p.Init(&core.AuthContext{Config: &core.Config{}, Adapter: memory.New()}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	return p
+}
+
+func TestConsentPlugin_GrantAndRevoke(t *testing.T) {
+	p := newTestPlugin(t)
+	ctx := context.Background()
+
+	if _, err := p.Grant(ctx, "user-1", "dashboard", []string{"profile"}); err != nil {
+		t.Fatalf("Grant failed: %v", err)
+	}
+	consent, err := p.Grant(ctx, "user-1", "dashboard", []string{"billing", "profile"})
+	if err != nil {
+		t.Fatalf("Grant failed: %v", err)
+	}
+	if want := []string{"billing", "profile"}; !reflect.DeepEqual(consent.Scopes, want) {
+		t.Errorf("Scopes = %v, want %v", consent.Scopes, want)
+	}
+
+	if _, err := p.Grant(ctx, "user-1", "mobile", []string{"profile"}); err != nil {
+		t.Fatalf("Grant failed: %v", err)
+	}
+
+	if ok, _ := p.HasConsent(ctx, "user-1", "dashboard", "profile", "billing"); !ok {
+		t.Error("Expected consent for granted scopes")
+	}
+	if ok, _ := p.HasConsent(ctx, "user-1", "mobile", "billing"); ok {
+		t.Error("Expected no consent for scope that was not granted")
+	}
+	if ok, _ := p.HasConsent(ctx, "user-2", "dashboard"); ok {
+		t.Error("Expected no consent for another user")
+	}
+
+	consents, err := p.Consents(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("Consents failed: %v", err)
+	}
+	if len(consents) != 2 || consents[0].AppID != "dashboard" || consents[1].AppID != "mobile" {
+		t.Fatalf("Consents = %+v, want dashboard and mobile", consents)
+	}
+	if consents[0].AppName != "Dashboard" {
+		t.Errorf("AppName = %q, want Dashboard", consents[0].AppName)
+	}
+
+	if err := p.Revoke(ctx, "user-1", "dashboard"); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if ok, _ := p.HasConsent(ctx, "user-1", "dashboard"); ok {
+		t.Error("Expected consent to be revoked")
+	}
+	if ok, _ := p.HasConsent(ctx, "user-1", "mobile"); !ok {
+		t.Error("Expected other consents to be kept")
+	}
+}
+
+func TestConsentPlugin_Validation(t *testing.T) {
+	p := newTestPlugin(t)
+	ctx := context.Background()
+
+	if _, err := p.Grant(ctx, "user-1", "unknown", []string{"profile"}); !errors.Is(err, ErrUnknownApp) {
+		t.Errorf("Grant unknown app error = %v, want ErrUnknownApp", err)
+	}
+	if _, err := p.Grant(ctx, "user-1", "mobile", []string{"billing"}); !errors.Is(err, ErrScopeNotAllowed) {
+		t.Errorf("Grant disallowed scope error = %v, want ErrScopeNotAllowed", err)
+	}
+
+	if err := p.ValidateRedirect("dashboard", "https://dashboard.example.com/callback"); err != nil {
+		t.Errorf("ValidateRedirect failed for registered URI: %v", err)
+	}
+	if err := p.ValidateRedirect("dashboard", "https://evil.example.com/callback"); !errors.Is(err, ErrRedirectNotAllowed) {
+		t.Errorf("ValidateRedirect error = %v, want ErrRedirectNotAllowed", err)
+	}
+
+	if err := New(App{ID: "empty"}).Init(&core.AuthContext{Config: &core.Config{}}); err == nil {
+		t.Error("Expected error for application without scopes")
+	}
+}
@@ -0,0 +1,22 @@
+package consent
+
+import "github.com/marshallshelly/beacon-auth/core"
+
+// Schema returns the table of granted consents
+func (p *ConsentPlugin) Schema() []core.TableDef {
+	return []core.TableDef{
+		{
+			Model: TableConsents,
+			Columns: []core.ColumnDef{
+				{Name: "id", Type: core.ColumnID},
+				{Name: "user_id", Type: core.ColumnForeignID, NotNull: true},
+				{Name: "app_id", Type: core.ColumnString, NotNull: true},
+				{Name: "scopes", Type: core.ColumnText, NotNull: true},
+				{Name: "created_at", Type: core.ColumnTimestamp, Default: core.DefaultNow},
+				{Name: "updated_at", Type: core.ColumnTimestamp, Default: core.DefaultNow, AutoUpdate: true},
+			},
+			Unique:      []core.UniqueDef{{Name: "UQ_Consent_User_App", Columns: []string{"user_id", "app_id"}}},
+			ForeignKeys: []core.ForeignKeyDef{{Name: "FK_Consent_User", Column: "user_id", Model: core.ModelUsers}},
+		},
+	}
+}
@@ -0,0 +1,701 @@
+package device
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/crypto"
+	"github.com/marshallshelly/beacon-auth/plugin"
+	"github.com/marshallshelly/beacon-auth/repo"
+)
+
+// GrantType is the grant_type of device access token requests
+const GrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// verificationType marks device codes in the verifications table
+const verificationType = "device_code"
+
+// maxIdentifierLength is the size of the verifications identifier column
+const maxIdentifierLength = 255
+
+// Limits on what a device may send, so its record fits the identifier
+// column
+const (
+	maxClientIDLength = 64
+	maxScopeLength    = 64
+)
+
+// userCodeAlphabet has no vowels, so codes do not spell words, and no
+// characters that are easily confused
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// userCodeLength is the number of characters in a user code, shown as
+// two groups of four
+const userCodeLength = 8
+
+// slowDownStep is added to the polling interval each time a device polls
+// too fast (RFC 8628 section 3.5)
+const slowDownStep = 5 * time.Second
+
+// Device authorization statuses
+const (
+	statusPending  = "p"
+	statusApproved = "a"
+	statusDenied   = "d"
+)
+
+// ErrInvalidUserCode is returned for user codes that are unknown, expired
+// or already approved or denied
+var ErrInvalidUserCode = errors.New("invalid or expired user code")
+
+// Options configures the device authorization grant
+type Options struct {
+	// VerificationURI is the page where users enter their code, shown by
+	// the device. It is the app's own approval page. Defaults to
+	// BaseURL + "/device".
+	VerificationURI string `yaml:"verification_uri"`
+
+	// ExpiresIn is how long a device code can be used. Defaults to 15
+	// minutes.
+	ExpiresIn time.Duration `yaml:"expires_in"`
+
+	// Interval is the minimum time between polls. Defaults to 5 seconds.
+	Interval time.Duration `yaml:"interval"`
+
+	// ClientIDs restricts which clients may request device codes. Any
+	// client_id is accepted when empty.
+	ClientIDs []string `yaml:"client_ids"`
+}
+
+// Authorization is a pending device authorization, as shown on the
+// approval page
+type Authorization struct {
+	UserCode  string    `json:"userCode"`
+	ClientID  string    `json:"clientId,omitempty"`
+	Scope     string    `json:"scope,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// deviceState is stored as JSON in the identifier of a device code's
+// verification. Keys are one letter to fit the column.
+type deviceState struct {
+	SecretHash string `json:"h"`
+	Status     string `json:"s"`
+	UserID     string `json:"u,omitempty"`
+	ClientID   string `json:"c,omitempty"`
+	Scope      string `json:"o,omitempty"`
+	Interval   int64  `json:"i"`           // seconds
+	LastPoll   int64  `json:"l,omitempty"` // unix seconds
+}
+
+// verificationRecord is a row of the verifications table. The token is
+// the normalized user code.
+type verificationRecord struct {
+	ID         string    `db:"id"`
+	Identifier string    `db:"identifier"`
+	Token      string    `db:"token"`
+	Type       string    `db:"type"`
+	ExpiresAt  time.Time `db:"expires_at"`
+	CreatedAt  time.Time `db:"created_at"`
+	UpdatedAt  time.Time `db:"updated_at"`
+}
+
+// DevicePlugin implements the OAuth 2.0 device authorization grant
+// (RFC 8628) for CLIs, TVs and other devices without a browser
+type DevicePlugin struct {
+	*plugin.BasePlugin
+	ctx  *core.AuthContext
+	opts Options
+}
+
+// New creates a new device authorization plugin
+func New(opts *Options) *DevicePlugin {
+	o := Options{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.ExpiresIn <= 0 {
+		o.ExpiresIn = 15 * time.Minute
+	}
+	if o.Interval <= 0 {
+		o.Interval = 5 * time.Second
+	}
+
+	return &DevicePlugin{
+		BasePlugin: plugin.NewBasePlugin("device"),
+		opts:       o,
+	}
+}
+
+// Init initializes the plugin
+func (p *DevicePlugin) Init(ctx *core.AuthContext) error {
+	if p.opts.VerificationURI == "" {
+		p.opts.VerificationURI = strings.TrimSuffix(ctx.Config.BaseURL, "/") + "/device"
+	}
+	p.ctx = ctx
+	return nil
+}
+
+// Config returns the plugin's options, which the device section of the
+// config file sets
+func (p *DevicePlugin) Config() interface{} {
+	return &p.opts
+}
+
+// ValidateConfig checks the options
+func (p *DevicePlugin) ValidateConfig() error {
+	if p.opts.VerificationURI != "" {
+		u, err := url.Parse(p.opts.VerificationURI)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("device: verification_uri must be absolute: %q", p.opts.VerificationURI)
+		}
+	}
+	if p.opts.ExpiresIn <= 0 {
+		return fmt.Errorf("device: expires_in must be positive, got %s", p.opts.ExpiresIn)
+	}
+	if p.opts.Interval <= 0 || p.opts.Interval >= p.opts.ExpiresIn {
+		return fmt.Errorf("device: interval must be positive and shorter than expires_in (%s), got %s", p.opts.ExpiresIn, p.opts.Interval)
+	}
+	for _, id := range p.opts.ClientIDs {
+		if id == "" || len(id) > maxClientIDLength {
+			return fmt.Errorf("device: client_ids must be 1 to %d characters: %q", maxClientIDLength, id)
+		}
+	}
+	return nil
+}
+
+// DescribeSecurity reports the device code lifetime and polling interval
+func (p *DevicePlugin) DescribeSecurity() map[string]interface{} {
+	return map[string]interface{}{
+		"expiresInSeconds":  int(p.opts.ExpiresIn / time.Second),
+		"intervalSeconds":   int(p.opts.Interval / time.Second),
+		"restrictedClients": len(p.opts.ClientIDs) > 0,
+	}
+}
+
+// Endpoints returns the plugin endpoints
+func (p *DevicePlugin) Endpoints() map[string]plugin.Endpoint {
+	return map[string]plugin.Endpoint{
+		"/device/code":    {Method: "POST", Handler: p.handleCode, RateLimit: core.RateLimitTokens},
+		"/device/token":   {Method: "POST", Handler: p.handleToken},
+		"/device/verify":  {Method: "GET", Handler: p.handleVerify, Auth: core.AuthSession},
+		"/device/approve": {Method: "POST", Handler: p.handleApprove, Auth: core.AuthSession},
+		"/device/deny":    {Method: "POST", Handler: p.handleDeny, Auth: core.AuthSession},
+	}
+}
+
+// Lookup returns the pending authorization for a user code, for the
+// approval page to show which client is asking
+func (p *DevicePlugin) Lookup(ctx context.Context, userCode string) (*Authorization, error) {
+	record, state, err := p.findPending(ctx, userCode)
+	if err != nil {
+		return nil, err
+	}
+	return &Authorization{
+		UserCode:  formatUserCode(record.Token),
+		ClientID:  state.ClientID,
+		Scope:     state.Scope,
+		ExpiresAt: record.ExpiresAt,
+	}, nil
+}
+
+// Approve lets the device that was given userCode sign in as userID
+func (p *DevicePlugin) Approve(ctx context.Context, userCode, userID string) error {
+	return p.decide(ctx, userCode, func(state *deviceState) {
+		state.Status = statusApproved
+		state.UserID = userID
+	})
+}
+
+// Deny refuses the device that was given userCode
+func (p *DevicePlugin) Deny(ctx context.Context, userCode string) error {
+	return p.decide(ctx, userCode, func(state *deviceState) {
+		state.Status = statusDenied
+	})
+}
+
+// Cleanup deletes expired device codes
+func (p *DevicePlugin) Cleanup(ctx context.Context) error {
+	query := core.NewQuery(p.table()).
+		Where("type", core.OpEqual, verificationType).
+		Where("expires_at", core.OpLessThan, time.Now()).
+		Build()
+
+	_, err := p.ctx.Adapter.DeleteMany(ctx, query)
+	return err
+}
+
+// decide applies an approval or denial to a pending code. The update only
+// matches the state that was read, so of concurrent decisions one wins. A
+// poll that changed the record in between is retried.
+func (p *DevicePlugin) decide(ctx context.Context, userCode string, apply func(*deviceState)) error {
+	for attempt := 0; attempt < 3; attempt++ {
+		record, state, err := p.findPending(ctx, userCode)
+		if err != nil {
+			return err
+		}
+		apply(state)
+
+		updated, err := p.updateState(ctx, record, state)
+		if err != nil || updated {
+			return err
+		}
+	}
+	return ErrInvalidUserCode
+}
+
+// findPending returns the unexpired, undecided record for a user code
+func (p *DevicePlugin) findPending(ctx context.Context, userCode string) (*verificationRecord, *deviceState, error) {
+	code := normalizeUserCode(userCode)
+	if len(code) != userCodeLength {
+		return nil, nil, ErrInvalidUserCode
+	}
+
+	record, state, err := p.find(ctx, code)
+	if err != nil {
+		return nil, nil, err
+	}
+	if record == nil || state.Status != statusPending || time.Now().After(record.ExpiresAt) {
+		return nil, nil, ErrInvalidUserCode
+	}
+	return record, state, nil
+}
+
+func (p *DevicePlugin) find(ctx context.Context, userCode string) (*verificationRecord, *deviceState, error) {
+	record, err := repo.FindOne[verificationRecord](ctx, p.ctx.Adapter, p.codeQuery(userCode))
+	if err != nil || record == nil {
+		return nil, nil, err
+	}
+
+	var state deviceState
+	if err := json.Unmarshal([]byte(record.Identifier), &state); err != nil {
+		return nil, nil, fmt.Errorf("invalid device code record: %w", err)
+	}
+	return record, &state, nil
+}
+
+// updateState replaces the state of a record if it has not changed since
+// it was read. It reports whether it did.
+func (p *DevicePlugin) updateState(ctx context.Context, record *verificationRecord, state *deviceState) (bool, error) {
+	data, err := encodeState(state)
+	if err != nil {
+		return false, err
+	}
+
+	query := core.NewQuery(p.table()).
+		Where("token", core.OpEqual, record.Token).
+		Where("type", core.OpEqual, verificationType).
+		Where("identifier", core.OpEqual, record.Identifier).
+		Build()
+	updated, err := p.ctx.Adapter.UpdateMany(ctx, query, map[string]interface{}{
+		"identifier": data,
+		"updated_at": time.Now(),
+	})
+	if err != nil {
+		return false, err
+	}
+	if updated == 1 {
+		record.Identifier = data
+	}
+	return updated == 1, nil
+}
+
+// take deletes a record if it has not changed since it was read. It
+// reports whether it did, so a code is exchanged at most once.
+func (p *DevicePlugin) take(ctx context.Context, record *verificationRecord) (bool, error) {
+	query := core.NewQuery(p.table()).
+		Where("token", core.OpEqual, record.Token).
+		Where("type", core.OpEqual, verificationType).
+		Where("identifier", core.OpEqual, record.Identifier).
+		Build()
+	deleted, err := p.ctx.Adapter.DeleteMany(ctx, query)
+	return deleted == 1, err
+}
+
+func encodeState(state *deviceState) (string, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxIdentifierLength {
+		return "", fmt.Errorf("device code record is %d bytes, longer than %d", len(data), maxIdentifierLength)
+	}
+	return string(data), nil
+}
+
+// Handlers
+
+type codeResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in,omitempty"`
+}
+
+type userCodeRequest struct {
+	UserCode string `json:"userCode"`
+}
+
+// handleCode issues a device code and user code (RFC 8628 section 3.2).
+// The request is form encoded.
+func (p *DevicePlugin) handleCode(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+	clientID := r.PostForm.Get("client_id")
+	scope := r.PostForm.Get("scope")
+
+	if len(p.opts.ClientIDs) > 0 && !contains(p.opts.ClientIDs, clientID) {
+		writeError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	if len(clientID) > maxClientIDLength || len(scope) > maxScopeLength {
+		writeError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	deviceCode, userCode, err := p.create(r.Context(), clientID, scope)
+	if err != nil {
+		p.ctx.Logger.Error("Failed to create device code: %v", err)
+		writeError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	complete, _ := url.Parse(p.opts.VerificationURI)
+	q := complete.Query()
+	q.Set("user_code", formatUserCode(userCode))
+	complete.RawQuery = q.Encode()
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, codeResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                formatUserCode(userCode),
+		VerificationURI:         p.opts.VerificationURI,
+		VerificationURIComplete: complete.String(),
+		ExpiresIn:               int(p.opts.ExpiresIn / time.Second),
+		Interval:                int(p.opts.Interval / time.Second),
+	})
+}
+
+// create stores a new device code. The device code is a secret followed
+// by the user code, so polls find the record by the user code and then
+// check the secret against its hash. A user code that is already in use
+// is replaced by a new one.
+func (p *DevicePlugin) create(ctx context.Context, clientID, scope string) (string, string, error) {
+	for attempt := 0; ; attempt++ {
+		secret, err := randomSecret()
+		if err != nil {
+			return "", "", err
+		}
+		userCode, err := generateUserCode()
+		if err != nil {
+			return "", "", err
+		}
+
+		data, err := encodeState(&deviceState{
+			SecretHash: hashSecret(secret),
+			Status:     statusPending,
+			ClientID:   clientID,
+			Scope:      scope,
+			Interval:   int64(p.opts.Interval / time.Second),
+		})
+		if err != nil {
+			return "", "", err
+		}
+		id, err := crypto.GenerateID()
+		if err != nil {
+			return "", "", err
+		}
+
+		now := time.Now()
+		_, err = repo.Create(ctx, p.ctx.Adapter, p.table(), &verificationRecord{
+			ID:         id,
+			Identifier: data,
+			Token:      userCode,
+			Type:       verificationType,
+			ExpiresAt:  now.Add(p.opts.ExpiresIn),
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		})
+		if errors.Is(err, core.ErrDuplicate) && attempt < 3 {
+			continue
+		}
+		if err != nil {
+			return "", "", err
+		}
+		return secret + "." + userCode, userCode, nil
+	}
+}
+
+// handleToken answers a device's poll (RFC 8628 section 3.4). Until the
+// user decides it returns authorization_pending, or slow_down when the
+// device polls faster than its interval; each slow_down adds five seconds
+// to the interval.
+func (p *DevicePlugin) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+	if r.PostForm.Get("grant_type") != GrantType {
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	secret, userCode, ok := strings.Cut(r.PostForm.Get("device_code"), ".")
+	if !ok || len(userCode) != userCodeLength {
+		writeError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	ctx := r.Context()
+	record, state, err := p.find(ctx, userCode)
+	if err != nil {
+		p.ctx.Logger.Error("Failed to load device code: %v", err)
+		writeError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+	if record == nil || subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(state.SecretHash)) != 1 {
+		writeError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+	if state.ClientID != r.PostForm.Get("client_id") {
+		writeError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	if now.After(record.ExpiresAt) {
+		_, _ = p.take(ctx, record)
+		writeError(w, http.StatusBadRequest, "expired_token")
+		return
+	}
+
+	switch state.Status {
+	case statusDenied:
+		_, _ = p.take(ctx, record)
+		writeError(w, http.StatusBadRequest, "access_denied")
+
+	case statusApproved:
+		taken, err := p.take(ctx, record)
+		if err != nil {
+			p.ctx.Logger.Error("Failed to use device code: %v", err)
+			writeError(w, http.StatusInternalServerError, "server_error")
+			return
+		}
+		if !taken {
+			writeError(w, http.StatusBadRequest, "invalid_grant")
+			return
+		}
+
+		session, user, token, err := p.ctx.SessionManager.Create(ctx, state.UserID, nil)
+		if errors.Is(err, core.ErrUserBanned) {
+			writeError(w, http.StatusBadRequest, "access_denied")
+			return
+		}
+		if err != nil {
+			p.ctx.Logger.Error("Failed to create session: %v", err)
+			writeError(w, http.StatusInternalServerError, "server_error")
+			return
+		}
+		p.ctx.EmitSignIn(r, user, session, core.MethodDevice, "")
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, http.StatusOK, tokenResponse{
+			AccessToken: token,
+			TokenType:   "Bearer",
+			ExpiresIn:   int(time.Until(session.ExpiresAt) / time.Second),
+		})
+
+	default:
+		errCode := "authorization_pending"
+		if state.LastPoll != 0 && now.Unix()-state.LastPoll < state.Interval {
+			errCode = "slow_down"
+			state.Interval += int64(slowDownStep / time.Second)
+		}
+		state.LastPoll = now.Unix()
+
+		// If a decision or another poll changed the record first, the
+		// device learns the outcome on its next poll
+		if _, err := p.updateState(ctx, record, state); err != nil {
+			p.ctx.Logger.Error("Failed to update device code: %v", err)
+			writeError(w, http.StatusInternalServerError, "server_error")
+			return
+		}
+		writeError(w, http.StatusBadRequest, errCode)
+	}
+}
+
+func (p *DevicePlugin) handleVerify(w http.ResponseWriter, r *http.Request) {
+	if p.getUser(r) == nil {
+		core.WriteStatusError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	authorization, err := p.Lookup(r.Context(), r.URL.Query().Get("user_code"))
+	if errors.Is(err, ErrInvalidUserCode) {
+		core.WriteStatusError(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Failed to look up code")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, authorization)
+}
+
+func (p *DevicePlugin) handleApprove(w http.ResponseWriter, r *http.Request) {
+	user := p.getUser(r)
+	if user == nil {
+		core.WriteStatusError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req userCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserCode == "" {
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	p.writeDecision(w, r, p.Approve(r.Context(), req.UserCode, user.ID))
+}
+
+func (p *DevicePlugin) handleDeny(w http.ResponseWriter, r *http.Request) {
+	if p.getUser(r) == nil {
+		core.WriteStatusError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req userCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserCode == "" {
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	p.writeDecision(w, r, p.Deny(r.Context(), req.UserCode))
+}
+
+func (p *DevicePlugin) writeDecision(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrInvalidUserCode) {
+		core.WriteStatusError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		p.ctx.Logger.Error("Failed to record device decision: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Failed to record decision")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"success":true}`))
+}
+
+func (p *DevicePlugin) getUser(r *http.Request) *core.User {
+	_, user := p.ctx.RequestSession(r)
+	return user
+}
+
+// writeError writes an OAuth error response
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// DB Helpers
+
+func (p *DevicePlugin) table() string {
+	return p.ctx.Config.TableNames.Table(core.ModelVerifications)
+}
+
+func (p *DevicePlugin) codeQuery(userCode string) *core.Query {
+	return core.NewQuery(p.table()).
+		Where("token", core.OpEqual, userCode).
+		Where("type", core.OpEqual, verificationType).
+		Build()
+}
+
+// Codes
+
+// generateUserCode returns a random user code in its stored form
+func generateUserCode() (string, error) {
+	b := make([]byte, userCodeLength)
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate user code: %w", err)
+		}
+		b[i] = userCodeAlphabet[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// normalizeUserCode turns what a user typed into the stored form:
+// upper case, without the dash or spaces
+func normalizeUserCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
+
+// formatUserCode shows a stored user code as XXXX-XXXX
+func formatUserCode(code string) string {
+	if len(code) != userCodeLength {
+		return code
+	}
+	return code[:4] + "-" + code[4:]
+}
+
+func randomSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate device code: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashSecret returns the stored form of a device code secret. A 128-bit
+// truncated SHA-256 keeps the record small.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
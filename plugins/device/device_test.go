@@ -0,0 +1,263 @@
+package device
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/adapter"
+	"github.com/marshallshelly/beacon-auth/adapters/memory"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/session"
+)
+
+func newTestPlugin(t *testing.T, opts *Options) (*DevicePlugin, string) {
+	t.Helper()
+
+	db := memory.New()
+	sessions, err := session.NewManager(&session.Config{
+		CookieName:    "test_session",
+		ExpiresIn:     time.Hour,
+		EnableDBStore: true,
+	}, db)
+	if err != nil {
+		t.Fatalf("Failed to create session manager: %v", err)
+	}
+
+	user, err := adapter.NewInternalAdapter(db, nil).CreateUser(context.Background(), "user@example.com", "User")
+	if err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+
+	p := New(opts)
+	err = p.Init(&core.AuthContext{
+		Config: &core.Config{
+			BaseURL: "https://app.example.com",
+			Session: &core.SessionConfig{CookieName: "test_session"},
+		},
+		Adapter:        db,
+		Logger:         core.NewDefaultLogger(),
+		SessionManager: sessions,
+	})
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	return p, user.ID
+}
+
+func requestCode(t *testing.T, p *DevicePlugin, form url.Values) codeResponse {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	p.handleCode(rec, formRequest("/device/code", form))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/device/code status = %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp codeResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// poll returns the status and OAuth error code or access token
+func poll(p *DevicePlugin, deviceCode, clientID string) (int, map[string]interface{}) {
+	rec := httptest.NewRecorder()
+	p.handleToken(rec, formRequest("/device/token", url.Values{
+		"grant_type":  {GrantType},
+		"device_code": {deviceCode},
+		"client_id":   {clientID},
+	}))
+	var body map[string]interface{}
+	_ = json.NewDecoder(rec.Body).Decode(&body)
+	return rec.Code, body
+}
+
+func formRequest(path string, form url.Values) *http.Request {
+	req := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+func TestDeviceFlow_Approve(t *testing.T) {
+	p, userID := newTestPlugin(t, nil)
+	ctx := context.Background()
+
+	code := requestCode(t, p, url.Values{"client_id": {"cli"}, "scope": {"profile"}})
+	if code.VerificationURI != "https://app.example.com/device" || code.Interval != 5 || code.ExpiresIn != 900 {
+		t.Errorf("code response = %+v", code)
+	}
+	if want := "https://app.example.com/device?user_code=" + code.UserCode; code.VerificationURIComplete != want {
+		t.Errorf("verification_uri_complete = %q, want %q", code.VerificationURIComplete, want)
+	}
+
+	if status, body := poll(p, code.DeviceCode, "cli"); status != http.StatusBadRequest || body["error"] != "authorization_pending" {
+		t.Errorf("first poll = %d %v, want authorization_pending", status, body)
+	}
+	if _, body := poll(p, code.DeviceCode, "cli"); body["error"] != "slow_down" {
+		t.Errorf("fast poll = %v, want slow_down", body)
+	}
+
+	// Users may type the code in lower case and without the dash
+	typed := strings.ToLower(strings.ReplaceAll(code.UserCode, "-", ""))
+	authorization, err := p.Lookup(ctx, typed)
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	if authorization.ClientID != "cli" || authorization.Scope != "profile" || authorization.UserCode != code.UserCode {
+		t.Errorf("Lookup() = %+v", authorization)
+	}
+
+	if err := p.Approve(ctx, typed, userID); err != nil {
+		t.Fatalf("Approve failed: %v", err)
+	}
+	if err := p.Deny(ctx, code.UserCode); !errors.Is(err, ErrInvalidUserCode) {
+		t.Errorf("Deny() after Approve() error = %v, want ErrInvalidUserCode", err)
+	}
+
+	// Another client cannot use the code
+	if _, body := poll(p, code.DeviceCode, "other"); body["error"] != "invalid_grant" {
+		t.Errorf("poll by another client = %v, want invalid_grant", body)
+	}
+
+	status, body := poll(p, code.DeviceCode, "cli")
+	if status != http.StatusOK || body["token_type"] != "Bearer" {
+		t.Fatalf("poll after approval = %d %v", status, body)
+	}
+	token, _ := body["access_token"].(string)
+	_, user, err := p.ctx.SessionManager.Get(ctx, token)
+	if err != nil || user == nil || user.ID != userID {
+		t.Errorf("session for access token = %v, %v, want user %s", user, err, userID)
+	}
+
+	// A device code is exchanged once
+	if _, body := poll(p, code.DeviceCode, "cli"); body["error"] != "invalid_grant" {
+		t.Errorf("second exchange = %v, want invalid_grant", body)
+	}
+}
+
+func TestDeviceFlow_SlowDownRaisesInterval(t *testing.T) {
+	p, _ := newTestPlugin(t, nil)
+
+	code := requestCode(t, p, nil)
+	poll(p, code.DeviceCode, "")
+	poll(p, code.DeviceCode, "")
+
+	_, state, err := p.find(context.Background(), normalizeUserCode(code.UserCode))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Interval != 10 {
+		t.Errorf("Interval after slow_down = %d, want 10", state.Interval)
+	}
+}
+
+func TestDeviceFlow_Deny(t *testing.T) {
+	p, _ := newTestPlugin(t, nil)
+
+	code := requestCode(t, p, nil)
+	if err := p.Deny(context.Background(), code.UserCode); err != nil {
+		t.Fatalf("Deny failed: %v", err)
+	}
+	if _, body := poll(p, code.DeviceCode, ""); body["error"] != "access_denied" {
+		t.Errorf("poll after denial = %v, want access_denied", body)
+	}
+}
+
+func TestDeviceFlow_Expired(t *testing.T) {
+	p, userID := newTestPlugin(t, &Options{ExpiresIn: time.Millisecond})
+
+	code := requestCode(t, p, nil)
+	time.Sleep(5 * time.Millisecond)
+
+	if err := p.Approve(context.Background(), code.UserCode, userID); !errors.Is(err, ErrInvalidUserCode) {
+		t.Errorf("Approve() of an expired code error = %v, want ErrInvalidUserCode", err)
+	}
+	if _, body := poll(p, code.DeviceCode, ""); body["error"] != "expired_token" {
+		t.Errorf("poll of an expired code = %v, want expired_token", body)
+	}
+}
+
+func TestDeviceFlow_InvalidRequests(t *testing.T) {
+	p, _ := newTestPlugin(t, &Options{ClientIDs: []string{"cli"}})
+
+	rec := httptest.NewRecorder()
+	p.handleCode(rec, formRequest("/device/code", url.Values{"client_id": {"other"}}))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("unknown client status = %d, want 401", rec.Code)
+	}
+
+	code := requestCode(t, p, url.Values{"client_id": {"cli"}})
+	secret, userCode, _ := strings.Cut(code.DeviceCode, ".")
+
+	if _, body := poll(p, secret+"x."+userCode, "cli"); body["error"] != "invalid_grant" {
+		t.Errorf("poll with a wrong secret = %v, want invalid_grant", body)
+	}
+
+	rec = httptest.NewRecorder()
+	p.handleToken(rec, formRequest("/device/token", url.Values{
+		"grant_type":  {"authorization_code"},
+		"device_code": {code.DeviceCode},
+	}))
+	if !strings.Contains(rec.Body.String(), "unsupported_grant_type") {
+		t.Errorf("wrong grant type response = %s", rec.Body.String())
+	}
+}
+
+func TestDeviceFlow_ApproveEndpointRequiresSession(t *testing.T) {
+	p, _ := newTestPlugin(t, nil)
+
+	code := requestCode(t, p, nil)
+	req := httptest.NewRequest("POST", "/device/approve", strings.NewReader(`{"userCode":"`+code.UserCode+`"}`))
+	rec := httptest.NewRecorder()
+	p.handleApprove(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("approve without a session status = %d, want 401", rec.Code)
+	}
+}
+
+func TestGenerateUserCode(t *testing.T) {
+	code, err := generateUserCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code) != userCodeLength || strings.Trim(code, userCodeAlphabet) != "" {
+		t.Errorf("generateUserCode() = %q", code)
+	}
+	if got := formatUserCode(code); got != code[:4]+"-"+code[4:] {
+		t.Errorf("formatUserCode(%q) = %q", code, got)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		opts *Options
+		want string
+	}{
+		{name: "defaults", opts: nil},
+		{name: "relative verification URI", opts: &Options{VerificationURI: "/device"}, want: "verification_uri must be absolute"},
+		{name: "interval not shorter than expiry", opts: &Options{ExpiresIn: time.Minute, Interval: 2 * time.Minute}, want: "interval must be positive and shorter than expires_in (1m0s)"},
+		{name: "empty client ID", opts: &Options{ClientIDs: []string{""}}, want: "client_ids must be 1 to"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := New(tt.opts).ValidateConfig()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("ValidateConfig() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ValidateConfig() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -2,18 +2,27 @@ package emailpassword
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/crypto"
 	"github.com/marshallshelly/beacon-auth/plugin"
 )
 
 // EmailPasswordPlugin implements email/password authentication
 type EmailPasswordPlugin struct {
 	*plugin.BasePlugin
-	ctx *core.AuthContext
+	ctx   *core.AuthContext
+	dummy *crypto.DummyVerifier
+
+	// stop and done run the purge of unconfirmed double opt-in sign-ups
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 // New creates a new EmailPassword plugin
@@ -26,6 +35,30 @@ func New() *EmailPasswordPlugin {
 // Init initializes the plugin
 func (p *EmailPasswordPlugin) Init(ctx *core.AuthContext) error {
 	p.ctx = ctx
+	p.dummy = crypto.NewDummyVerifier(ctx.PasswordHasher)
+
+	if cfg := ctx.Config.EmailPassword; cfg != nil && cfg.DoubleOptIn {
+		if ctx.Config.UserStore != nil {
+			return errors.New("email_password: DoubleOptIn cannot purge users kept in a UserStore")
+		}
+		if cfg.UnconfirmedSignupTTL < 0 {
+			return errors.New("email_password: UnconfirmedSignupTTL must not be negative")
+		}
+		p.stop = make(chan struct{})
+		p.done = make(chan struct{})
+		go p.runPurge(purgeInterval)
+	}
+	return nil
+}
+
+// Close stops the purge of unconfirmed sign-ups
+func (p *EmailPasswordPlugin) Close() error {
+	if p.stop != nil {
+		p.closeOnce.Do(func() {
+			close(p.stop)
+			<-p.done
+		})
+	}
 	return nil
 }
 
@@ -33,12 +66,35 @@ func (p *EmailPasswordPlugin) Init(ctx *core.AuthContext) error {
 func (p *EmailPasswordPlugin) Endpoints() map[string]plugin.Endpoint {
 	return map[string]plugin.Endpoint{
 		"/register": {
-			Method:  "POST",
-			Handler: p.handleRegister,
+			Method:    "POST",
+			Handler:   p.handleRegister,
+			RateLimit: core.RateLimitCredentials,
 		},
 		"/login": {
-			Method:  "POST",
-			Handler: p.handleLogin,
+			Method:    "POST",
+			Handler:   p.handleLogin,
+			RateLimit: core.RateLimitCredentials,
+		},
+		"/forgot-password": {
+			Method:    "POST",
+			Handler:   p.handleForgotPassword,
+			RateLimit: core.RateLimitCredentials,
+		},
+		"/reset-password": {
+			Method:    "POST",
+			Handler:   p.handleResetPassword,
+			RateLimit: core.RateLimitCredentials,
+		},
+		"/send-verification-email": {
+			Method:    "POST",
+			Handler:   p.handleSendVerificationEmail,
+			Auth:      core.AuthSession,
+			RateLimit: core.RateLimitCredentials,
+		},
+		"/verify-email": {
+			Method:    "POST",
+			Handler:   p.handleVerifyEmail,
+			RateLimit: core.RateLimitCredentials,
 		},
 	}
 }
@@ -54,52 +110,92 @@ type loginRequest struct {
 	Password string `json:"password"`
 }
 
+// twoFactorResponse answers a correct password of a user with two-factor
+// authentication enabled
+type twoFactorResponse struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	TwoFactorToken    string `json:"twoFactorToken"`
+}
+
+// confirmationResponse answers a double opt-in sign-up, which has no
+// session until the email is confirmed
+type confirmationResponse struct {
+	ConfirmationRequired bool `json:"confirmationRequired"`
+}
+
 func (p *EmailPasswordPlugin) handleRegister(w http.ResponseWriter, r *http.Request) {
 	var req registerRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	if req.Email == "" || req.Password == "" {
-		http.Error(w, "Email and password are required", http.StatusBadRequest)
+		core.WriteError(w, r, http.StatusBadRequest, core.CodeValidation, "Email and password are required")
 		return
 	}
 
 	if len(req.Password) < p.ctx.Config.EmailPassword.MinPasswordLength {
-		http.Error(w, "Password too short", http.StatusBadRequest)
+		core.WriteError(w, r, http.StatusBadRequest, core.CodeValidation, "Password too short")
 		return
 	}
 
-	// Check if user exists (optional, CreateUser might fail later)
-	// But giving distinct error is nice.
-	existingUser, _ := p.ctx.DataManager.FindUserByEmail(r.Context(), req.Email)
+	// Reject known emails before hashing the password
+	existingUser, err := p.ctx.DataManager.FindUserByEmail(r.Context(), req.Email)
+	if err != nil && !errors.Is(err, core.ErrUserNotFound) {
+		p.ctx.Logger.Error("Failed to check existing user: %v", err)
+		core.WriteError(w, r, http.StatusInternalServerError, core.CodeDatabaseError, "Failed to check existing user")
+		return
+	}
 	if existingUser != nil {
-		http.Error(w, "Email already exists", http.StatusConflict)
+		core.WriteError(w, r, http.StatusConflict, core.CodeUserExists, "Email already exists")
 		return
 	}
 
 	// Hash password
 	hash, err := p.ctx.PasswordHasher.Hash(req.Password)
+	if errors.Is(err, crypto.ErrHasherBusy) {
+		writeBusyError(w, r)
+		return
+	}
 	if err != nil {
 		p.ctx.Logger.Error("Failed to hash password: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
-	// Create User
-	user, err := p.ctx.DataManager.CreateUser(r.Context(), req.Email, req.Name)
+	// Create User and Credential Account. A taken email fails the insert,
+	// even when a concurrent request registered it since the check above.
+	var user *core.User
+	err = p.ctx.DataManager.Transaction(r.Context(), func(dm core.DataManager) error {
+		var err error
+		user, err = dm.CreateUser(r.Context(), req.Email, req.Name)
+		if err != nil {
+			return err
+		}
+		_, err = dm.CreateCredentialAccount(r.Context(), user.ID, req.Email, hash)
+		return err
+	})
+	if errors.Is(err, core.ErrDuplicate) {
+		core.WriteError(w, r, http.StatusConflict, core.CodeUserExists, "Email already exists")
+		return
+	}
 	if err != nil {
 		p.ctx.Logger.Error("Failed to create user: %v", err)
-		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		core.WriteError(w, r, http.StatusInternalServerError, core.CodeCreateError, "Failed to create user")
 		return
 	}
+	p.ctx.EmitUserCreated(r, user, core.MethodPassword, "")
 
-	// Create Credential Account
-	_, err = p.ctx.DataManager.CreateCredentialAccount(r.Context(), user.ID, req.Email, hash)
-	if err != nil {
-		p.ctx.Logger.Error("Failed to create account: %v", err)
-		http.Error(w, "Failed to create account", http.StatusInternalServerError)
+	// Double opt-in users get a session once they confirm their email
+	if p.doubleOptIn() {
+		if err := p.sendConfirmation(r, user); err != nil {
+			// They get a new link when they try to sign in
+			p.ctx.Logger.Error("Failed to send signup confirmation email: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(confirmationResponse{ConfirmationRequired: true})
 		return
 	}
 
@@ -110,7 +206,7 @@ func (p *EmailPasswordPlugin) handleRegister(w http.ResponseWriter, r *http.Requ
 func (p *EmailPasswordPlugin) handleLogin(w http.ResponseWriter, r *http.Request) {
 	var req loginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
@@ -119,48 +215,118 @@ func (p *EmailPasswordPlugin) handleLogin(w http.ResponseWriter, r *http.Request
 	account, err := p.ctx.DataManager.FindAccountByProvider(r.Context(), "local", req.Email)
 	if err != nil {
 		p.ctx.Logger.Error("Database error finding account: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
+	// Unknown accounts take as long to reject as a wrong password, so
+	// timing does not reveal which emails are registered
 	if account == nil {
-		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		if err := p.dummy.Verify(req.Password); errors.Is(err, crypto.ErrHasherBusy) {
+			writeBusyError(w, r)
+			return
+		}
+		p.loginFailed(r, req.Email, "", "unknown account")
+		core.WriteError(w, r, http.StatusUnauthorized, core.CodeInvalidCredentials, "Invalid email or password")
 		return
 	}
 
 	// Verify password
 	valid, err := p.ctx.PasswordHasher.Verify(req.Password, account.Password)
+	if errors.Is(err, crypto.ErrHasherBusy) {
+		writeBusyError(w, r)
+		return
+	}
 	if err != nil {
 		p.ctx.Logger.Error("Error verifying password: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal server error")
 		return
 	}
 
 	if !valid {
-		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		p.loginFailed(r, req.Email, account.UserID, "invalid password")
+		core.WriteError(w, r, http.StatusUnauthorized, core.CodeInvalidCredentials, "Invalid email or password")
 		return
 	}
 
-	// Get user (for response)
+	// Upgrade legacy or outdated hashes now that we know the plaintext
+	if rehasher, ok := p.ctx.PasswordHasher.(core.PasswordRehasher); ok && rehasher.NeedsRehash(account.Password) {
+		if newHash, err := p.ctx.PasswordHasher.Hash(req.Password); err != nil {
+			p.ctx.Logger.Warn("Failed to rehash password: %v", err)
+		} else if err := p.ctx.DataManager.UpdateCredentialPassword(r.Context(), account.UserID, newHash); err != nil {
+			p.ctx.Logger.Warn("Failed to store rehashed password: %v", err)
+		}
+	}
+
+	// Get user, for the response and to check for two-factor
+	// authentication, which an unknown user could not be checked for
 	user, err := p.ctx.DataManager.FindUserByEmail(r.Context(), req.Email)
-	if err != nil {
-		p.ctx.Logger.Warn("Could not find user details for valid account: %v", err)
+	if err != nil || user == nil {
+		p.ctx.Logger.Error("Could not find user details for valid account: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	if p.requireVerification() && !user.EmailVerified {
+		p.loginUnconfirmed(w, r, user)
+		return
+	}
+
+	// Users with two-factor authentication get a session only after
+	// POST /2fa/verify with this token and their code
+	if user.TwoFactorEnabled {
+		token, err := p.tokens().BeginTwoFactor(r.Context(), user.ID)
+		if err != nil {
+			p.ctx.Logger.Error("Failed to start two-factor sign-in: %v", err)
+			core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(twoFactorResponse{TwoFactorRequired: true, TwoFactorToken: token})
+		return
 	}
 
 	p.createSessionAndResponse(w, r, account.UserID, user)
 }
 
+// loginFailed reports a rejected sign-in as a security event
+func (p *EmailPasswordPlugin) loginFailed(r *http.Request, email, userID, reason string) {
+	p.ctx.EmitSecurityEvent(core.WithClientInfo(r.Context(), core.ClientInfoFromRequest(r)), &core.SecurityEvent{
+		Type:   core.EventLoginFailed,
+		UserID: userID,
+		Email:  email,
+		Reason: reason,
+	})
+}
+
 func (p *EmailPasswordPlugin) createSessionAndResponse(w http.ResponseWriter, r *http.Request, userID string, user *core.User) {
-	_, _, token, err := p.ctx.SessionManager.Create(r.Context(), userID, nil)
+	// Never carry a session from before authentication over to the new one
+	p.ctx.RevokeRequestSession(r)
+
+	session, sessionUser, token, err := p.ctx.SessionManager.Create(r.Context(), userID, nil)
+	if errors.Is(err, core.ErrSessionLimit) {
+		core.WriteError(w, r, http.StatusForbidden, core.CodeSessionLimitReached, "Maximum number of active sessions reached")
+		return
+	}
+	var ban *core.BanError
+	if errors.As(err, &ban) {
+		core.WriteBanError(w, r, ban)
+		return
+	}
 	if err != nil {
 		p.ctx.Logger.Error("Failed to create session: %v", err)
-		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		core.WriteError(w, r, http.StatusInternalServerError, core.CodeSessionError, "Failed to create session")
 		return
 	}
+	if user == nil {
+		user = sessionUser
+	}
+	p.ctx.EmitSignIn(r, user, session, core.MethodPassword, "")
 
 	// Set Session Cookie
 	sessionConfig := p.ctx.Config.Session
-	http.SetCookie(w, &http.Cookie{
+	core.SetChunkedCookie(w, r, &http.Cookie{
 		Name:     sessionConfig.CookieName,
 		Value:    token,
 		Path:     sessionConfig.CookiePath,
@@ -169,7 +335,7 @@ func (p *EmailPasswordPlugin) createSessionAndResponse(w http.ResponseWriter, r
 		Secure:   sessionConfig.CookieSecure,
 		HttpOnly: sessionConfig.CookieHTTPOnly,
 		SameSite: parseSameSite(sessionConfig.CookieSameSite),
-	})
+	}, sessionConfig.CookieChunkSize)
 
 	w.Header().Set("Content-Type", "application/json")
 	if user != nil {
@@ -192,3 +358,10 @@ func parseSameSite(s string) http.SameSite {
 		return http.SameSiteLaxMode
 	}
 }
+
+// writeBusyError answers a request the saturated password hasher could not
+// take. Unknown and known accounts fail alike.
+func writeBusyError(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", "1")
+	core.WriteError(w, r, http.StatusServiceUnavailable, core.CodeServerBusy, "Server busy, try again")
+}
@@ -0,0 +1,156 @@
+package emailpassword
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/repo"
+	"github.com/marshallshelly/beacon-auth/tokens"
+)
+
+// purgeInterval is how often unconfirmed double opt-in sign-ups are
+// purged
+const purgeInterval = time.Hour
+
+// doubleOptIn reports whether sign-ups must confirm their email before
+// they get a session
+func (p *EmailPasswordPlugin) doubleOptIn() bool {
+	cfg := p.ctx.Config.EmailPassword
+	return cfg != nil && cfg.DoubleOptIn
+}
+
+// requireVerification reports whether sign-in needs a verified email:
+// with RequireVerification, and for double opt-in sign-ups
+func (p *EmailPasswordPlugin) requireVerification() bool {
+	cfg := p.ctx.Config.EmailPassword
+	return cfg != nil && (cfg.RequireVerification || cfg.DoubleOptIn)
+}
+
+// sendConfirmation emails a new double opt-in user the link that
+// activates their account. The link opens VerifyEmailURL like a
+// verification link.
+func (p *EmailPasswordPlugin) sendConfirmation(r *http.Request, user *core.User) error {
+	cfg := p.ctx.Config.EmailPassword
+	return p.sendLink(r, user.Email, tokens.SignupConfirmation, cfg.UnconfirmedSignupTTL, cfg.VerifyEmailURL, core.EmailVerifyEmail)
+}
+
+// loginUnconfirmed refuses the correct password of a user who has not
+// confirmed their email, and emails them a new link in case the first
+// one was lost
+func (p *EmailPasswordPlugin) loginUnconfirmed(w http.ResponseWriter, r *http.Request, user *core.User) {
+	if err := p.SendVerificationEmail(r, user); err != nil {
+		p.ctx.Logger.Error("Failed to send verification email: %v", err)
+	}
+	p.loginFailed(r, user.Email, user.ID, "email not verified")
+	core.WriteError(w, r, http.StatusForbidden, core.CodeEmailNotVerified, "Confirm your email address to sign in")
+}
+
+// PurgeUnconfirmedSignups deletes the users whose double opt-in
+// confirmation link expired before they used it, and returns how many it
+// deleted. It runs every hour while DoubleOptIn is on. Users who verified
+// their email another way, signed in with another provider, or still have
+// a valid verification link are kept.
+func (p *EmailPasswordPlugin) PurgeUnconfirmedSignups(ctx context.Context) (int64, error) {
+	svc := p.tokens()
+	expired, err := svc.Expired(ctx, tokens.SignupConfirmation)
+	if err != nil {
+		return 0, err
+	}
+
+	var deleted int64
+	for _, record := range expired {
+		// Decided again once the user's new link expires
+		pending, err := svc.Pending(ctx, tokens.EmailVerification, record.Identifier)
+		if err != nil {
+			return deleted, err
+		}
+		if pending {
+			continue
+		}
+
+		user, err := p.unconfirmed(ctx, svc, record.Identifier)
+		if err != nil {
+			return deleted, err
+		}
+		if user != nil {
+			if err := p.deleteUser(ctx, user.ID); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+		if err := svc.Delete(ctx, record); err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// unconfirmed returns the user of an expired confirmation link when they
+// are to be deleted, or nil when they are kept
+func (p *EmailPasswordPlugin) unconfirmed(ctx context.Context, svc *tokens.Service, email string) (*core.User, error) {
+	user, err := p.ctx.DataManager.FindUserByEmail(ctx, email)
+	if errors.Is(err, core.ErrUserNotFound) {
+		return nil, nil
+	}
+	if err != nil || user == nil || user.EmailVerified {
+		return nil, err
+	}
+
+	// A newer confirmation link is still valid
+	if pending, err := svc.Pending(ctx, tokens.SignupConfirmation, email); err != nil || pending {
+		return nil, err
+	}
+
+	accounts, err := repo.FindMany[core.Account](ctx, p.ctx.Adapter, core.NewQuery(p.table(core.ModelAccounts)).
+		Where("user_id", core.OpEqual, user.ID).
+		Build())
+	if err != nil {
+		return nil, err
+	}
+	for _, account := range accounts {
+		if account.ProviderID != "local" {
+			return nil, nil
+		}
+	}
+	return user, nil
+}
+
+// deleteUser deletes an unconfirmed user and their password
+func (p *EmailPasswordPlugin) deleteUser(ctx context.Context, userID string) error {
+	if _, err := p.ctx.Adapter.DeleteMany(ctx, core.NewQuery(p.table(core.ModelAccounts)).
+		Where("user_id", core.OpEqual, userID).
+		Build()); err != nil {
+		return err
+	}
+	_, err := p.ctx.Adapter.DeleteMany(ctx, core.NewQuery(p.table(core.ModelUsers)).
+		Where("id", core.OpEqual, userID).
+		Build())
+	return err
+}
+
+func (p *EmailPasswordPlugin) runPurge(interval time.Duration) {
+	defer close(p.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if n, err := p.PurgeUnconfirmedSignups(context.Background()); err != nil {
+				p.ctx.Logger.Error("Failed to purge unconfirmed sign-ups: %v", err) // Retried next tick
+			} else if n > 0 {
+				p.ctx.Logger.Info("Purged %d unconfirmed sign-ups", n)
+			}
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+func (p *EmailPasswordPlugin) table(name string) string {
+	return p.ctx.Config.TableNames.Table(name)
+}
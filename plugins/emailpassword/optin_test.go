@@ -0,0 +1,197 @@
+package emailpassword_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	beaconauth "github.com/marshallshelly/beacon-auth"
+	"github.com/marshallshelly/beacon-auth/adapters/sqlite"
+	"github.com/marshallshelly/beacon-auth/cmd/beacon/schema"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/i18n"
+	"github.com/marshallshelly/beacon-auth/plugins/emailpassword"
+	"github.com/marshallshelly/beacon-auth/tokens"
+)
+
+type silentLogger struct{}
+
+func (silentLogger) Debug(string, ...interface{}) {}
+func (silentLogger) Info(string, ...interface{})  {}
+func (silentLogger) Warn(string, ...interface{})  {}
+func (silentLogger) Error(string, ...interface{}) {}
+
+type captureMailer struct {
+	to, body string
+}
+
+func (m *captureMailer) Send(_ context.Context, to, _, body string) error {
+	m.to, m.body = to, body
+	return nil
+}
+
+var verifyLink = regexp.MustCompile(`http://localhost:8080/verify\?token=(\S+)`)
+
+// newOptInAuth returns an Auth on an in-memory SQLite database with the
+// emailpassword plugin configured by cfg
+func newOptInAuth(t *testing.T, cfg *core.EmailPasswordConfig, mailer core.Mailer) (core.Adapter, *emailpassword.EmailPasswordPlugin, beaconauth.Auth) {
+	t.Helper()
+	ctx := context.Background()
+	db, err := sqlite.New(ctx, &sqlite.Config{InMemory: true})
+	if err != nil {
+		t.Fatalf("sqlite.New() error = %v", err)
+	}
+	script, err := schema.GenerateSQL(&schema.Config{Adapter: "sqlite"})
+	if err != nil {
+		t.Fatalf("GenerateSQL() error = %v", err)
+	}
+	for _, stmt := range schema.SplitStatements(script, "sqlite") {
+		if err := db.Exec(ctx, stmt); err != nil {
+			t.Fatalf("Exec() error = %v", err)
+		}
+	}
+
+	p := emailpassword.New()
+	auth, err := beaconauth.New(
+		beaconauth.WithAdapter(db),
+		beaconauth.WithSecret("test-secret-key-that-is-long-enough"),
+		beaconauth.WithBaseURL("http://localhost:8080"),
+		beaconauth.WithPlugins(p),
+		beaconauth.WithEmailPassword(cfg),
+		beaconauth.WithMailer(mailer),
+		beaconauth.WithLocalizer(i18n.New(i18n.Config{})),
+		beaconauth.WithLogger(silentLogger{}),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { auth.Close() })
+	return db, p, auth
+}
+
+// poster returns a function posting JSON to auth
+func poster(auth beaconauth.Auth) func(path, body string) *httptest.ResponseRecorder {
+	return func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		auth.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+}
+
+func TestDoubleOptIn(t *testing.T) {
+	ctx := context.Background()
+	mailer := &captureMailer{}
+	db, p, auth := newOptInAuth(t, &core.EmailPasswordConfig{
+		Enabled:           true,
+		MinPasswordLength: 8,
+		VerifyEmailURL:    "http://localhost:8080/verify",
+		DoubleOptIn:       true,
+	}, mailer)
+	post := poster(auth)
+	register := func(email string) string {
+		t.Helper()
+		mailer.body = ""
+		rec := post("/auth/register", `{"email":"`+email+`","password":"password123"}`)
+		if rec.Code != http.StatusAccepted || !strings.Contains(rec.Body.String(), `"confirmationRequired":true`) {
+			t.Fatalf("register: status %d: %s", rec.Code, rec.Body)
+		}
+		if len(rec.Result().Cookies()) > 0 {
+			t.Fatal("register set a session cookie before confirmation")
+		}
+		link := verifyLink.FindStringSubmatch(mailer.body)
+		if mailer.to != email || link == nil {
+			t.Fatalf("confirmation email to %q has no link:\n%s", mailer.to, mailer.body)
+		}
+		return link[1]
+	}
+	login := func(email string) int {
+		return post("/auth/login", `{"email":"`+email+`","password":"password123"}`).Code
+	}
+
+	// Confirming activates the account
+	token := register("ana@example.com")
+	if code := login("ana@example.com"); code != http.StatusForbidden {
+		t.Fatalf("login before confirmation: status %d, want 403", code)
+	}
+	if rec := post("/auth/verify-email", `{"token":"`+token+`"}`); rec.Code != http.StatusOK {
+		t.Fatalf("verify-email: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := post("/auth/login", `{"email":"ana@example.com","password":"password123"}`); rec.Code != http.StatusOK {
+		t.Fatalf("login after confirmation: status %d: %s", rec.Code, rec.Body)
+	}
+
+	// Never-confirmed sign-ups are purged once their link expires
+	register("bob@example.com")
+	register("cy@example.com")
+	if code := login("cy@example.com"); code != http.StatusForbidden || verifyLink.FindStringSubmatch(mailer.body) == nil {
+		t.Fatalf("login before confirmation: status %d, want 403 and a new link", code)
+	}
+	expire := func(email string) {
+		t.Helper()
+		if _, err := db.Update(ctx, core.NewQuery(core.ModelVerifications).
+			Where("identifier", core.OpEqual, email).
+			Where("type", core.OpEqual, string(tokens.SignupConfirmation)).
+			Build(), map[string]interface{}{"expires_at": time.Now().Add(-time.Minute)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expire("bob@example.com")
+	expire("cy@example.com")
+
+	n, err := p.PurgeUnconfirmedSignups(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("PurgeUnconfirmedSignups() = %d, %v, want 1", n, err)
+	}
+	dm := auth.Context().DataManager
+	for email, kept := range map[string]bool{
+		"ana@example.com": true,
+		"bob@example.com": false,
+		"cy@example.com":  true, // has a valid link from signing in
+	} {
+		user, _ := dm.FindUserByEmail(ctx, email)
+		if (user != nil) != kept {
+			t.Errorf("%s: user = %v, kept = %v", email, user, kept)
+		}
+	}
+
+	// A purged email can sign up again
+	register("bob@example.com")
+}
+
+func TestRequireVerification(t *testing.T) {
+	mailer := &captureMailer{}
+	_, _, auth := newOptInAuth(t, &core.EmailPasswordConfig{
+		Enabled:             true,
+		MinPasswordLength:   8,
+		VerifyEmailURL:      "http://localhost:8080/verify",
+		RequireVerification: true,
+	}, mailer)
+	post := poster(auth)
+
+	if rec := post("/auth/register", `{"email":"ana@example.com","password":"password123"}`); rec.Code >= 300 {
+		t.Fatalf("register: status %d: %s", rec.Code, rec.Body)
+	}
+
+	// The password is right, but the email is not verified yet
+	mailer.body = ""
+	if rec := post("/auth/login", `{"email":"ana@example.com","password":"password123"}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("login before verification: status %d, want 403", rec.Code)
+	}
+	link := verifyLink.FindStringSubmatch(mailer.body)
+	if link == nil {
+		t.Fatalf("login before verification sent no verification link:\n%s", mailer.body)
+	}
+
+	if rec := post("/auth/verify-email", `{"token":"`+link[1]+`"}`); rec.Code != http.StatusOK {
+		t.Fatalf("verify-email: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := post("/auth/login", `{"email":"ana@example.com","password":"password123"}`); rec.Code != http.StatusOK {
+		t.Fatalf("login after verification: status %d: %s", rec.Code, rec.Body)
+	}
+}
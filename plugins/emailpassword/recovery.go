@@ -0,0 +1,224 @@
+package emailpassword
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/crypto"
+	"github.com/marshallshelly/beacon-auth/i18n"
+	"github.com/marshallshelly/beacon-auth/tokens"
+)
+
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type verifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// tokens returns the token service of the verifications table. Reset and
+// verification tokens are issued for the user's email address.
+func (p *EmailPasswordPlugin) tokens() *tokens.Service {
+	return tokens.For(p.ctx)
+}
+
+// handleForgotPassword emails a password reset link. It answers the same
+// whether or not the email is registered, so it does not reveal accounts.
+func (p *EmailPasswordPlugin) handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req forgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		core.WriteError(w, r, http.StatusBadRequest, core.CodeValidation, "Email is required")
+		return
+	}
+
+	account, err := p.ctx.DataManager.FindAccountByProvider(r.Context(), "local", req.Email)
+	if err != nil {
+		p.ctx.Logger.Error("Database error finding account: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if account != nil {
+		ttl := p.ctx.Config.EmailPassword.ResetPasswordExpiry
+		if err := p.sendLink(r, req.Email, tokens.PasswordReset, ttl, p.ctx.Config.EmailPassword.ResetPasswordURL, core.EmailResetPassword); err != nil {
+			p.ctx.Logger.Error("Failed to send password reset email: %v", err)
+		}
+	}
+
+	writeSuccess(w)
+}
+
+// handleResetPassword sets a new password with a reset token and signs the
+// user out everywhere
+func (p *EmailPasswordPlugin) handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req resetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(req.Password) < p.ctx.Config.EmailPassword.MinPasswordLength {
+		core.WriteError(w, r, http.StatusBadRequest, core.CodeValidation, "Password too short")
+		return
+	}
+
+	svc := p.tokens()
+	v, err := svc.Consume(r.Context(), tokens.PasswordReset, req.Token)
+	if errors.Is(err, tokens.ErrInvalidToken) {
+		core.WriteError(w, r, http.StatusBadRequest, core.CodeInvalidToken, "Invalid or expired token")
+		return
+	}
+	if err != nil {
+		p.ctx.Logger.Error("Failed to consume reset token: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	account, err := p.ctx.DataManager.FindAccountByProvider(r.Context(), "local", v.Identifier)
+	if err != nil || account == nil {
+		p.ctx.Logger.Error("Could not find account for reset token: %v", err)
+		core.WriteError(w, r, http.StatusBadRequest, core.CodeInvalidToken, "Invalid or expired token")
+		return
+	}
+
+	hash, err := p.ctx.PasswordHasher.Hash(req.Password)
+	if errors.Is(err, crypto.ErrHasherBusy) {
+		writeBusyError(w, r)
+		return
+	}
+	if err != nil {
+		p.ctx.Logger.Error("Failed to hash password: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if err := p.ctx.DataManager.UpdateCredentialPassword(r.Context(), account.UserID, hash); err != nil {
+		p.ctx.Logger.Error("Failed to update password: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	// Sessions and reset links issued for the old password are void
+	if _, err := svc.Revoke(r.Context(), tokens.PasswordReset, v.Identifier); err != nil {
+		p.ctx.Logger.Warn("Failed to revoke reset tokens: %v", err)
+	}
+	if err := p.ctx.SessionManager.DeleteByUserID(r.Context(), account.UserID); err != nil {
+		p.ctx.Logger.Warn("Failed to revoke sessions after password reset: %v", err)
+	}
+
+	writeSuccess(w)
+}
+
+// handleSendVerificationEmail emails a verification link to the signed-in
+// user
+func (p *EmailPasswordPlugin) handleSendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	user := core.GetUser(r.Context())
+	if user == nil {
+		core.WriteStatusError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if !user.EmailVerified {
+		if err := p.SendVerificationEmail(r, user); err != nil {
+			p.ctx.Logger.Error("Failed to send verification email: %v", err)
+			core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+	}
+
+	writeSuccess(w)
+}
+
+// handleVerifyEmail marks the email of a verification token as verified.
+// Double opt-in confirmation links are verification links that also
+// activate the account.
+func (p *EmailPasswordPlugin) handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req verifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	svc := p.tokens()
+	v, err := svc.Consume(r.Context(), tokens.EmailVerification, req.Token)
+	if errors.Is(err, tokens.ErrInvalidToken) {
+		v, err = svc.Consume(r.Context(), tokens.SignupConfirmation, req.Token)
+	}
+	if errors.Is(err, tokens.ErrInvalidToken) {
+		core.WriteError(w, r, http.StatusBadRequest, core.CodeInvalidToken, "Invalid or expired token")
+		return
+	}
+	if err != nil {
+		p.ctx.Logger.Error("Failed to consume verification token: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	user, err := p.ctx.DataManager.FindUserByEmail(r.Context(), v.Identifier)
+	if err != nil || user == nil {
+		p.ctx.Logger.Error("Could not find user for verification token: %v", err)
+		core.WriteError(w, r, http.StatusBadRequest, core.CodeInvalidToken, "Invalid or expired token")
+		return
+	}
+	if _, err := p.ctx.DataManager.UpdateUser(r.Context(), user.ID, map[string]interface{}{"email_verified": true}); err != nil {
+		p.ctx.Logger.Error("Failed to verify email: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	// The account is confirmed, whichever link was used
+	if _, err := svc.Revoke(r.Context(), tokens.SignupConfirmation, v.Identifier); err != nil {
+		p.ctx.Logger.Warn("Failed to revoke confirmation tokens: %v", err)
+	}
+
+	writeSuccess(w)
+}
+
+// SendVerificationEmail emails user a link to verify their email address,
+// e.g. after they sign up. The link opens EmailPasswordConfig.VerifyEmailURL
+// with the token in its token query parameter.
+func (p *EmailPasswordPlugin) SendVerificationEmail(r *http.Request, user *core.User) error {
+	return p.sendLink(r, user.Email, tokens.EmailVerification, 0, p.ctx.Config.EmailPassword.VerifyEmailURL, core.EmailVerifyEmail)
+}
+
+// sendLink issues a token of purpose for email and emails the template
+// name with a link to page carrying the token
+func (p *EmailPasswordPlugin) sendLink(r *http.Request, email string, purpose tokens.Purpose, ttl time.Duration, page, name string) error {
+	if page == "" {
+		return errors.New("no link URL configured for " + name)
+	}
+	link, err := url.Parse(page)
+	if err != nil {
+		return err
+	}
+
+	svc := p.tokens()
+	token, record, err := svc.Create(r.Context(), purpose, email, ttl)
+	if err != nil {
+		return err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	locale := core.DefaultLocale
+	if l := p.ctx.Config.Localizer; l != nil {
+		locale = l.Locale(r)
+	}
+	return p.ctx.SendEmail(r.Context(), email, locale, name, i18n.EmailData{
+		AppName:   p.ctx.Config.AppName,
+		URL:       link.String(),
+		ExpiresIn: time.Until(record.ExpiresAt),
+	})
+}
+
+func writeSuccess(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"success":true}`))
+}
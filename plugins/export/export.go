@@ -0,0 +1,180 @@
+// Package export serves user data exports for right-to-access and data
+// portability requests. An export is a JSON archive of everything
+// BeaconAuth stores about a user: the profile, accounts and sessions, plus
+// the data of every plugin implementing core.PluginDataExporter, such as
+// the admin plugin's audit log.
+//
+//	auth, err := beaconauth.New(
+//		beaconauth.WithPlugins(emailpassword.New(), export.New()),
+//	)
+//	// GET /auth/export downloads the signed-in user's data
+//	// GET /auth/admin/export?user_id=... downloads any user's data (admins)
+//
+// Secrets are left out: password hashes, OAuth tokens and session tokens
+// never appear in an export.
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/plugin"
+	"github.com/marshallshelly/beacon-auth/repo"
+)
+
+// ErrUserNotFound is returned when exporting an unknown user
+var ErrUserNotFound = errors.New("user not found")
+
+// UserData is the export of a user's data
+type UserData struct {
+	ExportedAt time.Time       `json:"exportedAt"`
+	User       *core.User      `json:"user"`
+	Accounts   []*core.Account `json:"accounts"`
+	Sessions   []*core.Session `json:"sessions"`
+
+	// Plugins holds the data of plugins implementing
+	// core.PluginDataExporter, by plugin ID
+	Plugins map[string]interface{} `json:"plugins,omitempty"`
+}
+
+// ExportPlugin serves user data exports
+type ExportPlugin struct {
+	*plugin.BasePlugin
+	ctx *core.AuthContext
+}
+
+// New creates the export plugin
+func New() *ExportPlugin {
+	return &ExportPlugin{
+		BasePlugin: plugin.NewBasePlugin("export"),
+	}
+}
+
+// Init initializes the plugin
+func (p *ExportPlugin) Init(ctx *core.AuthContext) error {
+	p.ctx = ctx
+	return nil
+}
+
+// Endpoints returns the self-service and admin export endpoints
+func (p *ExportPlugin) Endpoints() map[string]plugin.Endpoint {
+	return map[string]plugin.Endpoint{
+		"/export":       {Method: "GET", Handler: p.handleExport, Auth: core.AuthSession},
+		"/admin/export": {Method: "GET", Handler: p.handleAdminExport, Auth: core.AuthAdmin},
+	}
+}
+
+// Export assembles the data of a user. It returns ErrUserNotFound for
+// unknown users.
+func (p *ExportPlugin) Export(ctx context.Context, userID string) (*UserData, error) {
+	user, external, err := p.ctx.ExternalUser(ctx, userID)
+	if !external {
+		user, err = repo.FindOne[core.User](ctx, p.ctx.Adapter, p.byID(core.ModelUsers, "id", userID))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	accounts, err := repo.FindMany[core.Account](ctx, p.ctx.Adapter, p.byID(core.ModelAccounts, "user_id", userID))
+	if err != nil {
+		return nil, err
+	}
+	for _, account := range accounts {
+		account.IDToken = ""
+	}
+
+	sessions, err := repo.FindMany[core.Session](ctx, p.ctx.Adapter, p.byID(core.ModelSessions, "user_id", userID))
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		session.Token = ""
+	}
+
+	data := &UserData{
+		ExportedAt: time.Now().UTC(),
+		User:       user,
+		Accounts:   accounts,
+		Sessions:   sessions,
+	}
+	for _, pl := range p.ctx.Config.Plugins {
+		exporter, ok := pl.(core.PluginDataExporter)
+		if !ok {
+			continue
+		}
+		pluginData, err := exporter.ExportUserData(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if pluginData == nil {
+			continue
+		}
+		if data.Plugins == nil {
+			data.Plugins = make(map[string]interface{})
+		}
+		data.Plugins[pl.ID()] = pluginData
+	}
+	return data, nil
+}
+
+// handleExport downloads the signed-in user's data
+func (p *ExportPlugin) handleExport(w http.ResponseWriter, r *http.Request) {
+	user := core.GetUser(r.Context())
+	if user == nil {
+		core.WriteStatusError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	p.export(w, r, user.ID, "")
+}
+
+// handleAdminExport downloads the data of the user_id query parameter
+func (p *ExportPlugin) handleAdminExport(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		core.WriteError(w, r, http.StatusBadRequest, core.CodeValidation, "user_id is required")
+		return
+	}
+	p.export(w, r, userID, core.GetUser(r.Context()).ID)
+}
+
+// export writes the data of userID as a JSON attachment and reports the
+// export as a security event, naming the admin who made it, if any
+func (p *ExportPlugin) export(w http.ResponseWriter, r *http.Request, userID, actorID string) {
+	data, err := p.Export(r.Context(), userID)
+	if errors.Is(err, ErrUserNotFound) {
+		core.WriteError(w, r, http.StatusNotFound, core.CodeNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		p.ctx.Logger.Error("Failed to export user data: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	p.ctx.EmitSecurityEvent(core.WithClientInfo(r.Context(), core.ClientInfoFromRequest(r)), &core.SecurityEvent{
+		Type:    core.EventUserDataExported,
+		UserID:  userID,
+		Email:   data.User.Email,
+		ActorID: actorID,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="user-data-`+userID+`.json"`)
+	w.Header().Set("Cache-Control", "no-store")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(data)
+}
+
+func (p *ExportPlugin) byID(model, field, id string) *core.Query {
+	return core.NewQuery(p.ctx.Config.TableNames.Table(model)).
+		Where(field, core.OpEqual, id).
+		Build()
+}
@@ -0,0 +1,136 @@
+package export_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	beaconauth "github.com/marshallshelly/beacon-auth"
+	"github.com/marshallshelly/beacon-auth/adapters/sqlite"
+	"github.com/marshallshelly/beacon-auth/cmd/beacon/schema"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/plugins/admin"
+	"github.com/marshallshelly/beacon-auth/plugins/emailpassword"
+	"github.com/marshallshelly/beacon-auth/plugins/export"
+)
+
+type silentLogger struct{}
+
+func (silentLogger) Debug(string, ...interface{}) {}
+func (silentLogger) Info(string, ...interface{})  {}
+func (silentLogger) Warn(string, ...interface{})  {}
+func (silentLogger) Error(string, ...interface{}) {}
+
+func TestExportPlugin(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlite.New(ctx, &sqlite.Config{InMemory: true})
+	if err != nil {
+		t.Fatalf("sqlite.New() error = %v", err)
+	}
+	script, err := schema.GenerateSQL(&schema.Config{Adapter: "sqlite", Plugins: []string{"admin"}})
+	if err != nil {
+		t.Fatalf("GenerateSQL() error = %v", err)
+	}
+	for _, stmt := range schema.SplitStatements(script, "sqlite") {
+		if err := db.Exec(ctx, stmt); err != nil {
+			t.Fatalf("Exec() error = %v", err)
+		}
+	}
+
+	exporter := export.New()
+	auth, err := beaconauth.New(
+		beaconauth.WithAdapter(db),
+		beaconauth.WithSecret("test-secret-key-that-is-long-enough"),
+		beaconauth.WithBaseURL("http://localhost:8080"),
+		beaconauth.WithPlugins(emailpassword.New(), admin.New(nil), exporter),
+		beaconauth.WithLogger(silentLogger{}),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer auth.Close()
+
+	do := func(method, path, body string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		auth.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	signUp := func(email string) (string, []*http.Cookie) {
+		rec := do("POST", "/auth/register", `{"email":"`+email+`","password":"secret-password"}`, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("register: status %d: %s", rec.Code, rec.Body)
+		}
+		var user core.User
+		_ = json.Unmarshal(rec.Body.Bytes(), &user)
+		rec = do("POST", "/auth/login", `{"email":"`+email+`","password":"secret-password"}`, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("login: status %d: %s", rec.Code, rec.Body)
+		}
+		return user.ID, rec.Result().Cookies()
+	}
+
+	// Signing up and then in gives each user two sessions
+	anaID, anaCookies := signUp("ana@example.com")
+	rootID, rootCookies := signUp("root@example.com")
+	query := core.NewQuery(core.ModelUsers).Where("id", core.OpEqual, rootID).Build()
+	if _, err := db.Update(ctx, query, map[string]interface{}{"role": core.RoleAdmin}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	rec := do("GET", "/auth/export", "", anaCookies)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export: status %d: %s", rec.Code, rec.Body)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment") {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	body := rec.Body.String()
+	for _, secret := range []string{"$argon2", anaCookies[0].Value} {
+		if strings.Contains(body, secret) {
+			t.Errorf("export contains a secret:\n%s", body)
+		}
+	}
+	var data export.UserData
+	if err := json.Unmarshal(rec.Body.Bytes(), &data); err != nil {
+		t.Fatalf("decode export: %v", err)
+	}
+	if data.User.Email != "ana@example.com" || len(data.Accounts) != 1 || len(data.Sessions) != 2 {
+		t.Errorf("export has user %+v, %d accounts, %d sessions", data.User, len(data.Accounts), len(data.Sessions))
+	}
+
+	// The admin plugin records sign-ins in the background
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		exported, err := exporter.Export(ctx, anaID)
+		if err != nil {
+			t.Fatalf("Export() error = %v", err)
+		}
+		if exported.Plugins["admin"] != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("export has no audit log entries")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if rec := do("GET", "/auth/admin/export?user_id="+rootID, "", anaCookies); rec.Code != http.StatusForbidden {
+		t.Errorf("member exporting another user: status %d, want 403", rec.Code)
+	}
+	rec = do("GET", "/auth/admin/export?user_id="+anaID, "", rootCookies)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "ana@example.com") {
+		t.Errorf("admin export: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do("GET", "/auth/admin/export?user_id=unknown", "", rootCookies); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown user: status %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,70 @@
+package oauth
+
+import (
+	"errors"
+	"net/url"
+
+	"github.com/marshallshelly/beacon-auth/plugins/oauth/providers"
+)
+
+// EmailCollisionPolicy decides what happens when a provider returns the
+// email of an existing user who has not linked that provider yet.
+// Linking hands the existing account to whoever controls the provider
+// account, so it should only happen when the provider vouches for the
+// email.
+type EmailCollisionPolicy int
+
+const (
+	// LinkVerifiedEmail links the provider to the existing user when the
+	// provider reports the email as verified, and otherwise rejects the
+	// sign-in. This is the default.
+	LinkVerifiedEmail EmailCollisionPolicy = iota
+
+	// PromptToLink never links automatically. The callback redirects with
+	// error=account_link_required so the app can ask the user to sign in
+	// first and link the provider from their account.
+	PromptToLink
+
+	// RejectCollision rejects the sign-in with 409 Conflict
+	RejectCollision
+)
+
+var (
+	// ErrAccountLinkRequired is returned when the user must sign in to
+	// the existing account to link the provider
+	ErrAccountLinkRequired = errors.New("oauth: account link required")
+
+	// ErrAccountExists is returned when the email belongs to an existing
+	// user and the provider may not be linked to it
+	ErrAccountExists = errors.New("oauth: account with this email already exists")
+)
+
+// check returns nil when the provider account may be linked to the
+// existing user with the same email
+func (policy EmailCollisionPolicy) check(userInfo *providers.OAuthUserInfo) error {
+	switch policy {
+	case LinkVerifiedEmail:
+		if userInfo.EmailVerified {
+			return nil
+		}
+		return ErrAccountExists
+	case PromptToLink:
+		return ErrAccountLinkRequired
+	default:
+		return ErrAccountExists
+	}
+}
+
+// linkRequiredRedirect returns the flow's redirect target, or "/", with
+// the account_link_required error and the provider ID added
+func linkRequiredRedirect(redirectTo, providerID string) string {
+	target, err := url.Parse(redirectTo)
+	if err != nil || redirectTo == "" {
+		target = &url.URL{Path: "/"}
+	}
+	q := target.Query()
+	q.Set("error", "account_link_required")
+	q.Set("provider", providerID)
+	target.RawQuery = q.Encode()
+	return target.String()
+}
@@ -0,0 +1,97 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/marshallshelly/beacon-auth/adapter"
+	"github.com/marshallshelly/beacon-auth/adapters/memory"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/plugins/oauth/providers"
+)
+
+// newCollisionPlugin returns a plugin whose store holds a credential user
+// with the email jane@example.com
+func newCollisionPlugin(t *testing.T, policy EmailCollisionPolicy) (*OAuthPlugin, *core.User) {
+	t.Helper()
+
+	dm := adapter.NewInternalAdapter(memory.New(), nil)
+	user, err := dm.CreateUser(context.Background(), "jane@example.com", "Jane")
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	p := New().WithEmailCollisionPolicy(policy)
+	p.ctx = &core.AuthContext{DataManager: dm}
+	return p, user
+}
+
+func TestLinkAccount_EmailCollision(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        EmailCollisionPolicy
+		emailVerified bool
+		wantErr       error
+	}{
+		{"link verified email", LinkVerifiedEmail, true, nil},
+		{"reject unverified email", LinkVerifiedEmail, false, ErrAccountExists},
+		{"prompt even when verified", PromptToLink, true, ErrAccountLinkRequired},
+		{"reject even when verified", RejectCollision, true, ErrAccountExists},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, user := newCollisionPlugin(t, tt.policy)
+			r := httptest.NewRequest("GET", "/oauth/google/callback", nil)
+			info := &providers.OAuthUserInfo{ID: "g-1", Email: "jane@example.com", EmailVerified: tt.emailVerified}
+
+			userID, err := p.linkAccount(r, "google", info, &providers.OAuthTokens{AccessToken: "access"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("linkAccount() error = %v, want %v", err, tt.wantErr)
+			}
+
+			account, findErr := p.ctx.DataManager.FindAccountByProvider(r.Context(), "google", "g-1")
+			if findErr != nil {
+				t.Fatalf("FindAccountByProvider() error = %v", findErr)
+			}
+			if tt.wantErr == nil {
+				if userID != user.ID || account == nil || account.UserID != user.ID {
+					t.Errorf("linkAccount() = %q, account %+v, want a link to %q", userID, account, user.ID)
+				}
+			} else if account != nil {
+				t.Errorf("linkAccount() linked %+v despite %v", account, err)
+			}
+		})
+	}
+}
+
+func TestLinkAccount_NoCollision(t *testing.T) {
+	// Policies only apply to existing users; new emails and linked
+	// accounts sign in under every policy
+	p, user := newCollisionPlugin(t, RejectCollision)
+	r := httptest.NewRequest("GET", "/oauth/google/callback", nil)
+	tokens := &providers.OAuthTokens{AccessToken: "access"}
+
+	newUserID, err := p.linkAccount(r, "google", &providers.OAuthUserInfo{ID: "g-2", Email: "new@example.com"}, tokens)
+	if err != nil || newUserID == "" || newUserID == user.ID {
+		t.Fatalf("linkAccount() for a new email = %q, %v", newUserID, err)
+	}
+
+	again, err := p.linkAccount(r, "google", &providers.OAuthUserInfo{ID: "g-2", Email: "new@example.com"}, tokens)
+	if err != nil || again != newUserID {
+		t.Errorf("linkAccount() for a linked account = %q, %v, want %q", again, err, newUserID)
+	}
+}
+
+func TestLinkRequiredRedirect(t *testing.T) {
+	tests := map[string]string{
+		"":                    "/?error=account_link_required&provider=google",
+		"/settings?tab=2#top": "/settings?error=account_link_required&provider=google&tab=2#top",
+	}
+	for redirectTo, want := range tests {
+		if got := linkRequiredRedirect(redirectTo, "google"); got != want {
+			t.Errorf("linkRequiredRedirect(%q) = %q, want %q", redirectTo, got, want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/plugins/oauth/providers"
+)
+
+// idTokenRequest is the body of the ID token sign-in endpoint
+type idTokenRequest struct {
+	// Provider is the ID of the provider that issued the token
+	Provider string `json:"provider"`
+	IDToken  string `json:"idToken"`
+
+	// Nonce is the nonce the client requested the token with, if any
+	Nonce string `json:"nonce"`
+}
+
+// sessionResponse is the body of endpoints that answer with a session
+// token, shaped like the sign-in response
+type sessionResponse struct {
+	User    *core.User    `json:"user"`
+	Session *core.Session `json:"session"`
+	Token   string        `json:"token"`
+}
+
+// idTokenProviders returns the providers whose ID tokens can be posted to
+// /signin/id-token by ID: the registered providers, and the native
+// clients' providers for IDs without a registered provider
+func (p *OAuthPlugin) idTokenProviders() map[string]providers.IDTokenProvider {
+	verifiers := make(map[string]providers.IDTokenProvider)
+	for id, client := range p.nativeClients {
+		if idp, ok := client.Provider.(providers.IDTokenProvider); ok {
+			verifiers[id] = idp
+		}
+	}
+	p.providersMu.RLock()
+	defer p.providersMu.RUnlock()
+	for id, prov := range p.providers {
+		if idp, ok := prov.(providers.IDTokenProvider); ok {
+			verifiers[id] = idp
+		}
+	}
+	return verifiers
+}
+
+// handleIDToken signs the user in with an ID token the client obtained
+// without a redirect, such as a Google One Tap credential or the token of
+// Sign in with Apple on iOS
+func (p *OAuthPlugin) handleIDToken(w http.ResponseWriter, r *http.Request) {
+	var req idTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		core.WriteError(w, r, http.StatusBadRequest, core.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	if req.IDToken == "" {
+		core.WriteError(w, r, http.StatusBadRequest, core.CodeValidation, "idToken is required")
+		return
+	}
+	verifier, ok := p.idTokenProviders()[req.Provider]
+	if !ok {
+		core.WriteError(w, r, http.StatusBadRequest, core.CodeValidation, "provider does not support ID token sign-in")
+		return
+	}
+
+	userInfo, err := verifier.GetUserInfoFromIDToken(r.Context(), req.IDToken, req.Nonce)
+	if errors.Is(err, providers.ErrJWKSUnavailable) {
+		p.ctx.Logger.Error("Failed to fetch signing keys: %v", err)
+		core.WriteStatusError(w, r, http.StatusServiceUnavailable, "Failed to verify ID token")
+		return
+	}
+	if err != nil {
+		p.ctx.Logger.Warn("Rejected ID token: %v", err)
+		core.WriteError(w, r, http.StatusUnauthorized, core.CodeInvalidToken, "Invalid ID token")
+		return
+	}
+	if userInfo.ID == "" {
+		core.WriteError(w, r, http.StatusUnauthorized, core.CodeInvalidToken, "Invalid ID token")
+		return
+	}
+
+	// The token is the only credential; no provider tokens are stored
+	session, user, token, ok := p.signIn(w, r, req.Provider, userInfo, &providers.OAuthTokens{})
+	if !ok {
+		return
+	}
+
+	p.setSessionCookie(w, r, token)
+	writeSession(w, session, user, token)
+}
+
+// signIn links the provider account and creates a session for its user.
+// It writes the error response and returns false when that fails.
+func (p *OAuthPlugin) signIn(w http.ResponseWriter, r *http.Request, providerID string, userInfo *providers.OAuthUserInfo, tokens *providers.OAuthTokens) (*core.Session, *core.User, string, bool) {
+	userID, err := p.linkAccount(r, providerID, userInfo, tokens)
+	if errors.Is(err, ErrAccountLinkRequired) {
+		// The client asks the user to sign in and link the provider
+		core.WriteError(w, r, http.StatusConflict, core.CodeAccountLinkRequired, "Sign in to the existing account to link this provider")
+		return nil, nil, "", false
+	}
+	if errors.Is(err, ErrAccountExists) {
+		core.WriteError(w, r, http.StatusConflict, core.CodeUserExists, "An account with this email already exists")
+		return nil, nil, "", false
+	}
+	if err != nil {
+		p.ctx.Logger.Error("Failed to link account: %v", err)
+		core.WriteError(w, r, http.StatusInternalServerError, core.CodeCreateError, "Failed to create account")
+		return nil, nil, "", false
+	}
+
+	// Never carry a session from before authentication over to the new one
+	p.ctx.RevokeRequestSession(r)
+
+	session, user, token, err := p.ctx.SessionManager.Create(r.Context(), userID, nil)
+	var ban *core.BanError
+	if errors.As(err, &ban) {
+		core.WriteBanError(w, r, ban)
+		return nil, nil, "", false
+	}
+	if errors.Is(err, core.ErrSessionLimit) {
+		core.WriteError(w, r, http.StatusForbidden, core.CodeSessionLimitReached, "Maximum number of active sessions reached")
+		return nil, nil, "", false
+	}
+	if err != nil {
+		p.ctx.Logger.Error("Failed to create session: %v", err)
+		core.WriteError(w, r, http.StatusInternalServerError, core.CodeSessionError, "Failed to create session")
+		return nil, nil, "", false
+	}
+	p.ctx.EmitSignIn(r, user, session, core.MethodOAuth, providerID)
+	return session, user, token, true
+}
+
+// writeSession answers with the session and its token. The response must
+// not be cached.
+func writeSession(w http.ResponseWriter, session *core.Session, user *core.User, token string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(&sessionResponse{User: user, Session: session, Token: token})
+}
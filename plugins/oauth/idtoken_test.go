@@ -0,0 +1,100 @@
+package oauth_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/plugins/oauth"
+	"github.com/marshallshelly/beacon-auth/plugins/oauth/providers"
+)
+
+// oneTapProvider accepts the ID token "valid-token" issued with nonce
+// "nonce-1"
+type oneTapProvider struct {
+	providers.OAuthProvider
+}
+
+func (oneTapProvider) ID() string  { return "onetap" }
+func (oneTapProvider) Init() error { return nil }
+
+func (oneTapProvider) GetUserInfoFromIDToken(_ context.Context, idToken, nonce string) (*providers.OAuthUserInfo, error) {
+	if idToken != "valid-token" {
+		return nil, providers.ErrIDTokenSignature
+	}
+	if nonce != "" && nonce != "nonce-1" {
+		return nil, providers.ErrIDTokenNonce
+	}
+	return &providers.OAuthUserInfo{ID: "g-1", Email: "ana@example.com", EmailVerified: true, Name: "Ana"}, nil
+}
+
+func signInWithIDToken(auth core.Auth, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/auth/signin/id-token", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	auth.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestSignInWithIDToken(t *testing.T) {
+	auth, err := newTestAuth(t, oauth.New(oneTapProvider{}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	rec := signInWithIDToken(auth, `{"provider":"onetap","idToken":"valid-token","nonce":"nonce-1"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("sign in: status %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		User  *core.User `json:"user"`
+		Token string     `json:"token"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.User == nil || resp.User.Email != "ana@example.com" || resp.Token == "" {
+		t.Fatalf("sign in response = %s", rec.Body)
+	}
+	if cookies := rec.Result().Cookies(); len(cookies) != 1 || cookies[0].Name != "beaconauth_session" || cookies[0].Value != resp.Token {
+		t.Errorf("session cookie not set: %v", cookies)
+	}
+
+	// Signing in again reaches the linked user
+	rec = signInWithIDToken(auth, `{"provider":"onetap","idToken":"valid-token"}`)
+	var again struct {
+		User *core.User `json:"user"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &again)
+	if rec.Code != http.StatusOK || again.User == nil || again.User.ID != resp.User.ID {
+		t.Errorf("second sign in: status %d: %s", rec.Code, rec.Body)
+	}
+
+	for name, tt := range map[string]struct {
+		body   string
+		status int
+	}{
+		"missing token":    {`{"provider":"onetap"}`, http.StatusBadRequest},
+		"unknown provider": {`{"provider":"github","idToken":"valid-token"}`, http.StatusBadRequest},
+		"forged token":     {`{"provider":"onetap","idToken":"forged"}`, http.StatusUnauthorized},
+		"wrong nonce":      {`{"provider":"onetap","idToken":"valid-token","nonce":"replayed"}`, http.StatusUnauthorized},
+	} {
+		if rec := signInWithIDToken(auth, tt.body); rec.Code != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", name, rec.Code, tt.status, rec.Body)
+		}
+	}
+}
+
+func TestSignInWithIDToken_NotOffered(t *testing.T) {
+	auth, err := newTestAuth(t, oauth.New(providers.NewGitHub("id", "secret", nil)))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if rec := signInWithIDToken(auth, `{"provider":"github","idToken":"token"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("status %d, want 404 without ID token providers", rec.Code)
+	}
+}
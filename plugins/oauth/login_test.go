@@ -0,0 +1,85 @@
+package oauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	beaconauth "github.com/marshallshelly/beacon-auth"
+	"github.com/marshallshelly/beacon-auth/plugins/oauth"
+)
+
+func TestLogin_CallbackURL(t *testing.T) {
+	server := nativeIdP(t)
+	auth, err := newTestAuth(t, oauth.New(newNativeProvider(server)),
+		beaconauth.WithRedirectOrigins("https://app.example.com"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	for _, tt := range []struct {
+		query  string
+		status int
+	}{
+		{"callbackURL=" + url.QueryEscape("/dashboard"), http.StatusTemporaryRedirect},
+		{"callbackURL=" + url.QueryEscape("https://app.example.com/welcome"), http.StatusTemporaryRedirect},
+		{"callbackURL=" + url.QueryEscape("http://localhost:8080/home"), http.StatusTemporaryRedirect},
+		{"callbackURL=" + url.QueryEscape("https://evil.example/phish"), http.StatusBadRequest},
+		{"callbackURL=" + url.QueryEscape("//evil.example"), http.StatusBadRequest},
+		// redirect_to is only ever a local path and dropped otherwise
+		{"redirect_to=" + url.QueryEscape("https://evil.example/phish"), http.StatusTemporaryRedirect},
+	} {
+		rec := httptest.NewRecorder()
+		auth.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/auth/oauth/corp/login?"+tt.query, nil))
+		if rec.Code != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.query, rec.Code, tt.status, rec.Body)
+		}
+	}
+}
+
+// recordingStateStore keeps the last saved state
+type recordingStateStore struct {
+	saved *oauth.State
+}
+
+func (s *recordingStateStore) Save(_ context.Context, state *oauth.State) error {
+	s.saved = state
+	return nil
+}
+
+func (s *recordingStateStore) Take(context.Context, string) (*oauth.State, error) {
+	return nil, nil
+}
+
+func TestLogin_RedirectTo(t *testing.T) {
+	server := nativeIdP(t)
+	store := &recordingStateStore{}
+	auth, err := newTestAuth(t, oauth.New(newNativeProvider(server)).WithStateStore(store))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	long := "/" + strings.Repeat("a&<", 600)
+	for target, want := range map[string]string{
+		"/dashboard?tab=1":     "/dashboard?tab=1",
+		long:                   long,
+		"https://evil.example": "",
+		"//evil.example":       "",
+		"/\\evil.example":      "",
+		"/\t/evil.example":     "",
+		"javascript:alert(1)":  "",
+	} {
+		store.saved = nil
+		rec := httptest.NewRecorder()
+		auth.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/auth/oauth/corp/login?redirect_to="+url.QueryEscape(target), nil))
+		if rec.Code != http.StatusTemporaryRedirect || store.saved == nil {
+			t.Fatalf("%q: status %d: %s", target, rec.Code, rec.Body)
+		}
+		if store.saved.RedirectTo != want {
+			t.Errorf("redirect_to %q saved as %q, want %q", target, store.saved.RedirectTo, want)
+		}
+	}
+}
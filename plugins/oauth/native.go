@@ -0,0 +1,183 @@
+package oauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/plugins/oauth/providers"
+)
+
+// NativeClient is a mobile or desktop app that runs the authorization flow
+// itself, as described in RFC 8252, and redeems the code it receives at
+// /oauth/{id}/token
+type NativeClient struct {
+	// Provider redeems the app's codes. Configure it with the app's client
+	// ID, usually without a client secret. Accounts are linked under its
+	// ID, so a user signing in on the web and in the app with the same
+	// provider account is the same user.
+	Provider providers.OAuthProvider
+
+	// RedirectURIs are the app's registered redirect URIs: a private-use
+	// scheme such as com.example.app:/oauth, an https app link or universal
+	// link, or a loopback address such as http://127.0.0.1/callback, whose
+	// port may vary
+	RedirectURIs []string
+}
+
+// WithNativeClient lets the app sign users in with provider. The app
+// starts the authorization flow with PKCE and one of redirectURIs, then
+// posts the code and its verifier to /oauth/{id}/token for a session.
+// Native clients must be added before the plugin is initialized.
+func (p *OAuthPlugin) WithNativeClient(provider providers.OAuthProvider, redirectURIs ...string) *OAuthPlugin {
+	if p.nativeClients == nil {
+		p.nativeClients = make(map[string]*NativeClient)
+	}
+	p.nativeClients[provider.ID()] = &NativeClient{Provider: provider, RedirectURIs: redirectURIs}
+	return p
+}
+
+// initNativeClients validates the native clients' redirect URIs and
+// initializes their providers
+func (p *OAuthPlugin) initNativeClients() error {
+	for id, client := range p.nativeClients {
+		if !providerIDPattern.MatchString(id) {
+			return fmt.Errorf("oauth: invalid provider ID %q: use up to 32 lowercase letters, digits, '-' and '_'", id)
+		}
+		if len(client.RedirectURIs) == 0 {
+			return fmt.Errorf("oauth: native client %q has no redirect URIs", id)
+		}
+		for _, uri := range client.RedirectURIs {
+			if err := validateNativeRedirectURI(uri); err != nil {
+				return fmt.Errorf("oauth: native client %q: %w", id, err)
+			}
+		}
+		if client.Provider != p.providers[id] {
+			if err := client.Provider.Init(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateNativeRedirectURI accepts the redirect URIs RFC 8252 allows for
+// native apps
+func validateNativeRedirectURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme == "" {
+		return fmt.Errorf("invalid redirect URI %q", uri)
+	}
+	if u.Fragment != "" {
+		return fmt.Errorf("redirect URI %q must not have a fragment", uri)
+	}
+
+	switch u.Scheme {
+	case "https":
+		if u.Host == "" {
+			return fmt.Errorf("redirect URI %q has no host", uri)
+		}
+	case "http":
+		// Only loopback IP literals; localhost may resolve elsewhere
+		if ip := net.ParseIP(u.Hostname()); ip == nil || !ip.IsLoopback() {
+			return fmt.Errorf("http redirect URI %q must use a loopback IP address", uri)
+		}
+	default:
+		// Private-use schemes must be reverse domain names the app owns,
+		// so they cannot collide with another app's scheme
+		if !strings.Contains(u.Scheme, ".") {
+			return fmt.Errorf("redirect URI %q must use a reverse domain name scheme, such as com.example.app", uri)
+		}
+	}
+	return nil
+}
+
+// allowsRedirect reports whether uri is one of the client's redirect URIs.
+// Loopback URIs match on any port, since apps listen on whichever port is
+// free.
+func (c *NativeClient) allowsRedirect(uri string) bool {
+	for _, allowed := range c.RedirectURIs {
+		if uri == allowed {
+			return true
+		}
+		a, err := url.Parse(allowed)
+		if err != nil || a.Scheme != "http" {
+			continue
+		}
+		u, err := url.Parse(uri)
+		if err != nil || u.Scheme != "http" || u.User != nil {
+			continue
+		}
+		if u.Hostname() == a.Hostname() && u.Path == a.Path && u.RawQuery == a.RawQuery && u.Fragment == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// nativeTokenRequest is the body of the token endpoint
+type nativeTokenRequest struct {
+	Code         string `json:"code"`
+	CodeVerifier string `json:"codeVerifier"`
+	RedirectURI  string `json:"redirectUri"`
+
+	// Nonce is the nonce the app sent with the authorization request, if
+	// any. It is checked against the ID token.
+	Nonce string `json:"nonce"`
+}
+
+// handleToken redeems a code the app obtained natively and answers with a
+// session token
+func (p *OAuthPlugin) handleToken(w http.ResponseWriter, r *http.Request, client *NativeClient) {
+	var req nativeTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		core.WriteError(w, r, http.StatusBadRequest, core.CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	if req.Code == "" || req.CodeVerifier == "" {
+		// Public clients prove they started the flow with PKCE
+		core.WriteError(w, r, http.StatusBadRequest, core.CodeValidation, "code and codeVerifier are required")
+		return
+	}
+	if !client.allowsRedirect(req.RedirectURI) {
+		core.WriteError(w, r, http.StatusBadRequest, core.CodeValidation, "redirectUri is not registered for this app")
+		return
+	}
+
+	provider := client.Provider
+	tokens, err := provider.ExchangeCode(r.Context(), req.Code, req.CodeVerifier, req.RedirectURI)
+	if err != nil {
+		p.ctx.Logger.Warn("Failed to exchange native code: %v", err)
+		core.WriteError(w, r, http.StatusUnauthorized, core.CodeInvalidCode, "Invalid or expired code")
+		return
+	}
+
+	var userInfo *providers.OAuthUserInfo
+	if idp, ok := provider.(providers.IDTokenProvider); ok && tokens.IDToken != "" {
+		userInfo, err = idp.GetUserInfoFromIDToken(r.Context(), tokens.IDToken, req.Nonce)
+		if err != nil {
+			p.ctx.Logger.Error("Failed to verify ID token: %v", err)
+			core.WriteError(w, r, http.StatusUnauthorized, core.CodeInvalidToken, "Invalid ID token")
+			return
+		}
+	} else {
+		userInfo, err = provider.GetUserInfo(r.Context(), tokens.AccessToken)
+		if err != nil {
+			p.ctx.Logger.Error("Failed to get user info: %v", err)
+			core.WriteStatusError(w, r, http.StatusInternalServerError, "Failed to get user info")
+			return
+		}
+	}
+
+	session, user, token, ok := p.signIn(w, r, provider.ID(), userInfo, tokens)
+	if !ok {
+		return
+	}
+
+	// Apps keep the token and send it in the session cookie
+	writeSession(w, session, user, token)
+}
@@ -0,0 +1,169 @@
+package oauth_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	beaconauth "github.com/marshallshelly/beacon-auth"
+	"github.com/marshallshelly/beacon-auth/adapters/sqlite"
+	"github.com/marshallshelly/beacon-auth/cmd/beacon/schema"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/plugins/oauth"
+	"github.com/marshallshelly/beacon-auth/plugins/oauth/providers"
+)
+
+type silentLogger struct{}
+
+func (silentLogger) Debug(string, ...interface{}) {}
+func (silentLogger) Info(string, ...interface{})  {}
+func (silentLogger) Warn(string, ...interface{})  {}
+func (silentLogger) Error(string, ...interface{}) {}
+
+// nativeIdP is a provider that issues codes to a public client with PKCE
+func nativeIdP(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if _, _, ok := r.BasicAuth(); ok || r.PostForm.Has("client_secret") {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		if r.PostForm.Get("client_id") != "mobile-app" || r.PostForm.Get("code") != "good-code" ||
+			r.PostForm.Get("code_verifier") != "verifier" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"access","token_type":"Bearer","expires_in":3600}`))
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"sub":"u-1","email":"ana@example.com","email_verified":true,"name":"Ana"}`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newNativeProvider(server *httptest.Server) *providers.GenericOAuth2Provider {
+	return providers.NewGenericOAuth2(&providers.GenericOAuth2Options{
+		ID:               "corp",
+		ClientID:         "mobile-app",
+		AuthorizationURL: server.URL + "/authorize",
+		TokenURL:         server.URL + "/token",
+		UserInfoURL:      server.URL + "/userinfo",
+		UsePKCE:          true,
+		AuthStyle:        providers.AuthStyleInHeader,
+	})
+}
+
+func newTestAuth(t *testing.T, p *oauth.OAuthPlugin, opts ...beaconauth.Option) (core.Auth, error) {
+	t.Helper()
+	ctx := context.Background()
+	db, err := sqlite.New(ctx, &sqlite.Config{InMemory: true})
+	if err != nil {
+		t.Fatalf("sqlite.New() error = %v", err)
+	}
+	script, err := schema.GenerateSQL(&schema.Config{Adapter: "sqlite", Plugins: []string{"oauth"}})
+	if err != nil {
+		t.Fatalf("GenerateSQL() error = %v", err)
+	}
+	for _, stmt := range schema.SplitStatements(script, "sqlite") {
+		if err := db.Exec(ctx, stmt); err != nil {
+			t.Fatalf("Exec() error = %v", err)
+		}
+	}
+	auth, err := beaconauth.New(append([]beaconauth.Option{
+		beaconauth.WithAdapter(db),
+		beaconauth.WithSecret("test-secret-key-that-is-long-enough"),
+		beaconauth.WithBaseURL("http://localhost:8080"),
+		beaconauth.WithPlugins(p),
+		beaconauth.WithLogger(silentLogger{}),
+	}, opts...)...)
+	if err == nil {
+		t.Cleanup(func() { auth.Close() })
+	}
+	return auth, err
+}
+
+func redeem(auth core.Auth, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/auth/oauth/corp/token", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	auth.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestNativeClient_Token(t *testing.T) {
+	server := nativeIdP(t)
+	p := oauth.New().WithNativeClient(newNativeProvider(server),
+		"com.example.app:/oauth", "https://app.example.com/oauth", "http://127.0.0.1/callback")
+	auth, err := newTestAuth(t, p)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	rec := redeem(auth, `{"code":"good-code","codeVerifier":"verifier","redirectUri":"http://127.0.0.1:51234/callback"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("token: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("Cache-Control") != "no-store" {
+		t.Error("token response may be cached")
+	}
+	var resp struct {
+		Token string     `json:"token"`
+		User  *core.User `json:"user"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Token == "" || resp.User == nil || resp.User.Email != "ana@example.com" {
+		t.Fatalf("token response = %s", rec.Body)
+	}
+
+	// The token is a session like any other
+	session, user, err := auth.Context().SessionManager.Get(context.Background(), resp.Token)
+	if err != nil || session == nil || user.ID != resp.User.ID {
+		t.Errorf("Get() = %v, %v, %v, want the user's session", session, user, err)
+	}
+
+	for name, tt := range map[string]struct {
+		body   string
+		status int
+	}{
+		"missing verifier":         {`{"code":"good-code","redirectUri":"com.example.app:/oauth"}`, http.StatusBadRequest},
+		"unregistered redirect":    {`{"code":"good-code","codeVerifier":"verifier","redirectUri":"com.evil.app:/oauth"}`, http.StatusBadRequest},
+		"loopback with other path": {`{"code":"good-code","codeVerifier":"verifier","redirectUri":"http://127.0.0.1:8000/other"}`, http.StatusBadRequest},
+		"wrong verifier":           {`{"code":"good-code","codeVerifier":"guess","redirectUri":"com.example.app:/oauth"}`, http.StatusUnauthorized},
+	} {
+		if rec := redeem(auth, tt.body); rec.Code != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", name, rec.Code, tt.status, rec.Body)
+		}
+	}
+}
+
+func TestNativeClient_RedirectURIs(t *testing.T) {
+	server := nativeIdP(t)
+	for _, uri := range []string{
+		"myapp:/oauth",                   // not a reverse domain name
+		"http://localhost/callback",      // loopback must be an IP literal
+		"http://192.0.2.1/callback",      // not loopback
+		"https:///oauth",                 // no host
+		"com.example.app:/oauth#section", // fragment
+		"/oauth/callback",
+	} {
+		p := oauth.New().WithNativeClient(newNativeProvider(server), uri)
+		if _, err := newTestAuth(t, p); err == nil {
+			t.Errorf("redirect URI %q accepted", uri)
+		}
+	}
+
+	if _, err := newTestAuth(t, oauth.New().WithNativeClient(newNativeProvider(server))); err == nil {
+		t.Error("native client without redirect URIs accepted")
+	}
+}
@@ -3,9 +3,12 @@ package oauth
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/marshallshelly/beacon-auth/core"
@@ -16,8 +19,13 @@ import (
 // OAuthPlugin implements the OAuth 2.0 plugin
 type OAuthPlugin struct {
 	*plugin.BasePlugin
-	providers map[string]providers.OAuthProvider
-	ctx       *core.AuthContext
+	providers       map[string]providers.OAuthProvider
+	providersMu     sync.RWMutex // Rotating providers are replaced at runtime
+	rotating        []rotatingProvider
+	stateStore      StateStore
+	collisionPolicy EmailCollisionPolicy
+	nativeClients   map[string]*NativeClient
+	ctx             *core.AuthContext
 }
 
 // New creates a new OAuth plugin with the given providers
@@ -34,76 +42,169 @@ func New(provs ...providers.OAuthProvider) *OAuthPlugin {
 	return p
 }
 
+// providerIDPattern restricts provider IDs to one URL path segment of at
+// most 32 characters
+var providerIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// RegisterProvider adds a provider, such as a providers.GenericOAuth2Provider
+// for an in-house identity provider. Its endpoints are
+// /oauth/{id}/login and /oauth/{id}/callback. Providers must be
+// registered before the plugin is initialized.
+func (p *OAuthPlugin) RegisterProvider(prov providers.OAuthProvider) error {
+	if p.ctx != nil {
+		return errors.New("oauth: providers must be registered before the plugin is initialized")
+	}
+	id := prov.ID()
+	if !providerIDPattern.MatchString(id) {
+		return fmt.Errorf("oauth: invalid provider ID %q: use up to 32 lowercase letters, digits, '-' and '_'", id)
+	}
+	if _, exists := p.providers[id]; exists {
+		return fmt.Errorf("oauth: provider %q already registered", id)
+	}
+	p.providers[id] = prov
+	return nil
+}
+
+// WithEmailCollisionPolicy sets what happens when a provider returns the
+// email of an existing user who has not linked that provider. The default
+// is LinkVerifiedEmail.
+func (p *OAuthPlugin) WithEmailCollisionPolicy(policy EmailCollisionPolicy) *OAuthPlugin {
+	p.collisionPolicy = policy
+	return p
+}
+
+// WithStateStore sets where states are kept between the login endpoint
+// and the callback. The default is the oauth_states table.
+func (p *OAuthPlugin) WithStateStore(store StateStore) *OAuthPlugin {
+	p.stateStore = store
+	return p
+}
+
 // Init initializes the plugin
 func (p *OAuthPlugin) Init(ctx *core.AuthContext) error {
 	p.ctx = ctx
+	if p.stateStore == nil {
+		p.stateStore = NewDatabaseStateStore(ctx.Adapter, ctx.Config.TableNames)
+	}
+	if err := p.initRotatingProviders(); err != nil {
+		return err
+	}
 	for _, prov := range p.providers {
 		if err := prov.Init(); err != nil {
 			return err
 		}
 	}
-	return nil
+	return p.initNativeClients()
 }
 
 // Endpoints returns the OAuth endpoints
 func (p *OAuthPlugin) Endpoints() map[string]plugin.Endpoint {
 	endpoints := make(map[string]plugin.Endpoint)
 
-	for id, prov := range p.providers {
-		// Capture closure variables
+	for id := range p.providers {
+		// Capture closure variables; the provider is looked up per
+		// request, as rotating providers are replaced
 		providerID := id
-		provider := prov
 
 		endpoints["/oauth/"+providerID+"/login"] = plugin.Endpoint{
 			Method: "GET",
 			Handler: func(w http.ResponseWriter, r *http.Request) {
-				p.handleLogin(w, r, provider)
+				p.handleLogin(w, r, p.provider(providerID))
 			},
 		}
 		endpoints["/oauth/"+providerID+"/callback"] = plugin.Endpoint{
 			Method: "GET",
 			Handler: func(w http.ResponseWriter, r *http.Request) {
-				p.handleCallback(w, r, provider)
+				p.handleCallback(w, r, p.provider(providerID))
 			},
 		}
 	}
 
+	for id, c := range p.nativeClients {
+		client := c
+		endpoints["/oauth/"+id+"/token"] = plugin.Endpoint{
+			Method: "POST",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				p.handleToken(w, r, client)
+			},
+			RateLimit: core.RateLimitTokens,
+		}
+	}
+
+	if len(p.idTokenProviders()) > 0 {
+		endpoints["/signin/id-token"] = plugin.Endpoint{
+			Method:    "POST",
+			Handler:   p.handleIDToken,
+			RateLimit: core.RateLimitCredentials,
+		}
+	}
+
 	return endpoints
 }
 
 func (p *OAuthPlugin) handleLogin(w http.ResponseWriter, r *http.Request, provider providers.OAuthProvider) {
+	// callbackURL may be on an allowed origin and is checked strictly;
+	// redirect_to is only kept when it is a local path
+	redirectTo := core.SafeRedirect(r.URL.Query().Get("redirect_to"), "", nil)
+	if callbackURL := r.URL.Query().Get("callbackURL"); callbackURL != "" {
+		if redirectTo = p.safeRedirect(callbackURL); redirectTo == "" {
+			core.WriteError(w, r, http.StatusBadRequest, core.CodeValidation, "callbackURL is not allowed",
+				core.FieldError{Field: "callbackURL", Code: "not_allowed", Message: "callbackURL must be a local path or on an allowed origin"})
+			return
+		}
+	}
+
 	state, err := generateRandomString(32)
 	if err != nil {
 		p.ctx.Logger.Error("Failed to generate state: %v", err)
-		http.Error(w, "Failed to generate state", http.StatusInternalServerError)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Failed to generate state")
 		return
 	}
-
-	// Determine redirect URI
-	baseURL := p.ctx.Config.BaseURL
-	basePath := p.ctx.Config.BasePath
-	// Ensure basePath starts with / if not empty, and doesn't end with /
-	if basePath != "" && !strings.HasPrefix(basePath, "/") {
-		basePath = "/" + basePath
+	nonce, err := generateRandomString(32)
+	if err != nil {
+		p.ctx.Logger.Error("Failed to generate nonce: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Failed to generate state")
+		return
+	}
+	codeVerifier, err := providers.GenerateCodeVerifier()
+	if err != nil {
+		p.ctx.Logger.Error("Failed to generate code verifier: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Failed to generate state")
+		return
 	}
-	basePath = strings.TrimRight(basePath, "/")
 
-	redirectURI := fmt.Sprintf("%s%s/oauth/%s/callback", baseURL, basePath, provider.ID())
+	// Remember the flow for the callback
+	err = p.stateStore.Save(r.Context(), &State{
+		State:        state,
+		ProviderID:   provider.ID(),
+		CodeVerifier: codeVerifier,
+		RedirectTo:   redirectTo,
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(StateTTL),
+	})
+	if err != nil {
+		p.ctx.Logger.Error("Failed to save state: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Failed to generate state")
+		return
+	}
 
-	// Set state cookie
+	// Bind the state to this browser
 	http.SetCookie(w, &http.Cookie{
 		Name:     "oauth_state",
 		Value:    state,
 		Path:     "/",
 		HttpOnly: true,
 		Secure:   p.ctx.Config.Advanced.UseSecureCookies,
-		MaxAge:   300, // 5 minutes
+		MaxAge:   int(StateTTL / time.Second),
 	})
 
-	authURL, err := provider.CreateAuthorizationURL(state, redirectURI, nil)
+	authURL, err := provider.CreateAuthorizationURL(state, p.redirectURI(provider), &providers.AuthOptions{
+		CodeVerifier: codeVerifier,
+		Nonce:        nonce,
+	})
 	if err != nil {
 		p.ctx.Logger.Error("Failed to create authorization URL: %v", err)
-		http.Error(w, "Failed to create authorization URL", http.StatusInternalServerError)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Failed to create authorization URL")
 		return
 	}
 
@@ -114,8 +215,8 @@ func (p *OAuthPlugin) handleCallback(w http.ResponseWriter, r *http.Request, pro
 	// Verify state
 	state := r.URL.Query().Get("state")
 	cookie, err := r.Cookie("oauth_state")
-	if err != nil || cookie.Value != state {
-		http.Error(w, "Invalid state param", http.StatusBadRequest)
+	if err != nil || state == "" || cookie.Value != state {
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Invalid state param")
 		return
 	}
 
@@ -129,96 +230,99 @@ func (p *OAuthPlugin) handleCallback(w http.ResponseWriter, r *http.Request, pro
 		MaxAge:   -1,
 	})
 
-	code := r.URL.Query().Get("code")
-	if code == "" {
-		http.Error(w, "Missing code param", http.StatusBadRequest)
+	// Each state completes one flow, for the provider it was issued for
+	flow, err := p.stateStore.Take(r.Context(), state)
+	if err != nil {
+		p.ctx.Logger.Error("Failed to load state: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Failed to load state")
 		return
 	}
-
-	baseURL := p.ctx.Config.BaseURL
-	basePath := p.ctx.Config.BasePath
-	if basePath != "" && !strings.HasPrefix(basePath, "/") {
-		basePath = "/" + basePath
-	}
-	basePath = strings.TrimRight(basePath, "/")
-
-	redirectURI := fmt.Sprintf("%s%s/oauth/%s/callback", baseURL, basePath, provider.ID())
-
-	tokens, err := provider.ExchangeCode(r.Context(), code, "", redirectURI)
-	if err != nil {
-		p.ctx.Logger.Error("Failed to exchange code: %v", err)
-		http.Error(w, "Failed to exchange code", http.StatusInternalServerError)
+	if flow == nil || flow.ProviderID != provider.ID() {
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Invalid state param")
 		return
 	}
 
-	userInfo, err := provider.GetUserInfo(r.Context(), tokens.AccessToken)
-	if err != nil {
-		p.ctx.Logger.Error("Failed to get user info: %v", err)
-		http.Error(w, "Failed to get user info", http.StatusInternalServerError)
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Missing code param")
 		return
 	}
 
-	// Check if account exists
-	account, err := p.ctx.DataManager.FindAccountByProvider(r.Context(), provider.ID(), userInfo.ID)
+	redirectURI := p.redirectURI(provider)
+
+	tokens, err := provider.ExchangeCode(r.Context(), code, flow.CodeVerifier, redirectURI)
 	if err != nil {
-		p.ctx.Logger.Error("Database error finding account: %v", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		p.ctx.Logger.Error("Failed to exchange code: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Failed to exchange code")
 		return
 	}
 
-	var userID string
-	if account != nil {
-		userID = account.UserID
-	} else {
-		// Link or create user
-		var user *core.User
-		if userInfo.Email != "" {
-			user, err = p.ctx.DataManager.FindUserByEmail(r.Context(), userInfo.Email)
-			if err != nil && err != core.ErrUserNotFound {
-				p.ctx.Logger.Error("Database error finding user: %v", err)
-				http.Error(w, "Database error", http.StatusInternalServerError)
-				return
-			}
-		}
-
-		if user == nil {
-			// Create new user
-			user, err = p.ctx.DataManager.CreateUser(r.Context(), userInfo.Email, userInfo.Name)
-			if err != nil {
-				p.ctx.Logger.Error("Failed to create user: %v", err)
-				http.Error(w, "Failed to create user", http.StatusInternalServerError)
-				return
-			}
-			// Update image if available
-			if userInfo.Picture != "" {
-				// Note: UpdateUser expects map of updates.
-				// For MVP we just create. We can add update logic later if needed.
-				p.ctx.Logger.Debug("User has picture (%s), skipping update for now", userInfo.Picture)
-			}
+	var userInfo *providers.OAuthUserInfo
+	if idp, ok := provider.(providers.IDTokenProvider); ok && tokens.IDToken != "" {
+		// The profile comes from the ID token, bound to this flow by its nonce
+		userInfo, err = idp.GetUserInfoFromIDToken(r.Context(), tokens.IDToken, flow.Nonce)
+		if err != nil {
+			p.ctx.Logger.Error("Failed to verify ID token: %v", err)
+			core.WriteStatusError(w, r, http.StatusUnauthorized, "Invalid ID token")
+			return
 		}
-		userID = user.ID
-
-		// Create account
-		_, err = p.ctx.DataManager.CreateOAuthAccount(r.Context(), userID, provider.ID(), userInfo.ID, tokens.AccessToken, tokens.RefreshToken, tokens.ExpiresAt)
+	} else {
+		userInfo, err = provider.GetUserInfo(r.Context(), tokens.AccessToken)
 		if err != nil {
-			p.ctx.Logger.Error("Failed to create account: %v", err)
-			http.Error(w, "Failed to create account", http.StatusInternalServerError)
+			p.ctx.Logger.Error("Failed to get user info: %v", err)
+			core.WriteStatusError(w, r, http.StatusInternalServerError, "Failed to get user info")
 			return
 		}
 	}
 
+	userID, err := p.linkAccount(r, provider.ID(), userInfo, tokens)
+	if errors.Is(err, ErrAccountLinkRequired) {
+		// Let the app ask the user to sign in and link the provider
+		http.Redirect(w, r, linkRequiredRedirect(flow.RedirectTo, provider.ID()), http.StatusTemporaryRedirect)
+		return
+	}
+	if errors.Is(err, ErrAccountExists) {
+		core.WriteError(w, r, http.StatusConflict, core.CodeUserExists, "An account with this email already exists")
+		return
+	}
+	if err != nil {
+		p.ctx.Logger.Error("Failed to link account: %v", err)
+		core.WriteError(w, r, http.StatusInternalServerError, core.CodeCreateError, "Failed to create account")
+		return
+	}
+
+	// Never carry a session from before authentication over to the new one
+	p.ctx.RevokeRequestSession(r)
+
 	// Create Session
 	// Note: CreateSession takes SessionOptions.
-	_, _, token, err := p.ctx.SessionManager.Create(r.Context(), userID, nil)
+	session, user, token, err := p.ctx.SessionManager.Create(r.Context(), userID, nil)
+	var ban *core.BanError
+	if errors.As(err, &ban) {
+		core.WriteBanError(w, r, ban)
+		return
+	}
 	if err != nil {
 		p.ctx.Logger.Error("Failed to create session: %v", err)
-		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		core.WriteError(w, r, http.StatusInternalServerError, core.CodeSessionError, "Failed to create session")
 		return
 	}
+	p.ctx.EmitSignIn(r, user, session, core.MethodOAuth, provider.ID())
 
-	// Set Session Cookie
+	p.setSessionCookie(w, r, token)
+
+	// Redirect to the page the flow was started from, or home
+	redirectTo := flow.RedirectTo
+	if redirectTo == "" {
+		redirectTo = "/"
+	}
+	http.Redirect(w, r, redirectTo, http.StatusTemporaryRedirect)
+}
+
+// setSessionCookie sets the session cookie to token
+func (p *OAuthPlugin) setSessionCookie(w http.ResponseWriter, r *http.Request, token string) {
 	sessionConfig := p.ctx.Config.Session
-	http.SetCookie(w, &http.Cookie{
+	core.SetChunkedCookie(w, r, &http.Cookie{
 		Name:     sessionConfig.CookieName,
 		Value:    token,
 		Path:     sessionConfig.CookiePath,
@@ -227,10 +331,92 @@ func (p *OAuthPlugin) handleCallback(w http.ResponseWriter, r *http.Request, pro
 		Secure:   sessionConfig.CookieSecure,
 		HttpOnly: sessionConfig.CookieHTTPOnly,
 		SameSite: parseSameSite(sessionConfig.CookieSameSite),
-	})
+	}, sessionConfig.CookieChunkSize)
+}
+
+// redirectURI returns the callback URL registered with the provider
+func (p *OAuthPlugin) redirectURI(provider providers.OAuthProvider) string {
+	baseURL := p.ctx.Config.BaseURL
+	basePath := p.ctx.Config.BasePath
+	// Ensure basePath starts with / if not empty, and doesn't end with /
+	if basePath != "" && !strings.HasPrefix(basePath, "/") {
+		basePath = "/" + basePath
+	}
+	basePath = strings.TrimRight(basePath, "/")
+
+	return fmt.Sprintf("%s%s/oauth/%s/callback", baseURL, basePath, provider.ID())
+}
+
+// safeRedirect returns target if it is a local path or a URL on BaseURL's
+// origin or an allowed redirect origin, and "" otherwise
+func (p *OAuthPlugin) safeRedirect(target string) string {
+	var origins []string
+	if p.ctx.Config.Advanced != nil {
+		origins = p.ctx.Config.Advanced.RedirectOrigins
+	}
+	return core.SafeRedirect(target, p.ctx.Config.BaseURL, origins)
+}
 
-	// Redirect to home
-	http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+// linkAccount returns the user of the provider account, creating the
+// account, and the user when no user has its email, in one transaction.
+// A concurrent callback for the same account or email makes the inserts
+// fail with core.ErrDuplicate; the second attempt then finds its rows.
+func (p *OAuthPlugin) linkAccount(r *http.Request, providerID string, userInfo *providers.OAuthUserInfo, tokens *providers.OAuthTokens) (string, error) {
+	ctx := r.Context()
+	for attempt := 0; ; attempt++ {
+		account, err := p.ctx.DataManager.FindAccountByProvider(ctx, providerID, userInfo.ID)
+		if err != nil {
+			return "", err
+		}
+		if account != nil {
+			return account.UserID, nil
+		}
+
+		var userID string
+		var created *core.User
+		err = p.ctx.DataManager.Transaction(ctx, func(dm core.DataManager) error {
+			var user *core.User
+			var err error
+			if userInfo.Email != "" {
+				user, err = dm.FindUserByEmail(ctx, userInfo.Email)
+				if err != nil && err != core.ErrUserNotFound {
+					return err
+				}
+			}
+
+			if user != nil {
+				if err := p.collisionPolicy.check(userInfo); err != nil {
+					return err
+				}
+			}
+
+			if user == nil {
+				// Create new user
+				user, err = dm.CreateUser(ctx, userInfo.Email, userInfo.Name)
+				if err != nil {
+					return err
+				}
+				created = user
+				// Update image if available
+				if userInfo.Picture != "" {
+					// Note: UpdateUser expects map of updates.
+					// For MVP we just create. We can add update logic later if needed.
+					p.ctx.Logger.Debug("User has picture (%s), skipping update for now", userInfo.Picture)
+				}
+			}
+			userID = user.ID
+
+			_, err = dm.CreateOAuthAccount(ctx, userID, providerID, userInfo.ID, tokens.AccessToken, tokens.RefreshToken, tokens.ExpiresAt)
+			return err
+		})
+		if errors.Is(err, core.ErrDuplicate) && attempt == 0 {
+			continue
+		}
+		if err == nil && created != nil {
+			p.ctx.EmitUserCreated(r, created, core.MethodOAuth, providerID)
+		}
+		return userID, err
+	}
 }
 
 func generateRandomString(length int) (string, error) {
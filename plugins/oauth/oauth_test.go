@@ -0,0 +1,28 @@
+package oauth
+
+import (
+	"testing"
+
+	"github.com/marshallshelly/beacon-auth/plugins/oauth/providers"
+)
+
+func TestRegisterProvider(t *testing.T) {
+	p := New(providers.NewGitHub("id", "secret", nil))
+
+	corp := providers.NewGenericOAuth2(&providers.GenericOAuth2Options{ID: "corp-sso"})
+	if err := p.RegisterProvider(corp); err != nil {
+		t.Fatalf("RegisterProvider() error = %v", err)
+	}
+	if _, ok := p.Endpoints()["/oauth/corp-sso/login"]; !ok {
+		t.Error("no login endpoint for the registered provider")
+	}
+
+	if err := p.RegisterProvider(providers.NewGenericOAuth2(&providers.GenericOAuth2Options{ID: "github"})); err == nil {
+		t.Error("RegisterProvider() with a duplicate ID succeeded, want error")
+	}
+	for _, id := range []string{"", "Corp", "corp/sso", "../corp"} {
+		if err := p.RegisterProvider(providers.NewGenericOAuth2(&providers.GenericOAuth2Options{ID: id})); err == nil {
+			t.Errorf("RegisterProvider() with ID %q succeeded, want error", id)
+		}
+	}
+}
@@ -3,11 +3,11 @@ package providers
 import (
 	"context"
 	"crypto/rsa"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
-	"math/big"
 	"net/http"
 	"net/url"
 	"strings"
@@ -16,6 +16,14 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+const (
+	appleIssuer  = "https://appleid.apple.com"
+	appleKeysURL = "https://appleid.apple.com/auth/keys"
+
+	// appleKeysTTL is how long Apple's signing keys are cached
+	appleKeysTTL = 24 * time.Hour
+)
+
 type AppleProvider struct {
 	clientID     string
 	clientSecret string // For Apple, this is actually a JWT we generate
@@ -23,7 +31,10 @@ type AppleProvider struct {
 	keyID        string
 	privateKey   string
 	scopes       []string
+	audiences    []string
+	clockSkew    time.Duration
 	httpClient   *http.Client
+	keys         *jwksCache
 }
 
 type AppleOptions struct {
@@ -33,6 +44,15 @@ type AppleOptions struct {
 	PrivateKey   string   // Private key content (PEM format)
 	Scopes       []string // Optional scopes
 	ClientSecret string   // Pre-generated client secret (optional, will generate if not provided)
+
+	// Audiences are further client IDs accepted in ID tokens, such as the
+	// bundle ID of an iOS app signing in natively. ClientID is always
+	// accepted.
+	Audiences []string
+
+	// ClockSkew is the tolerance for the ID token's exp and iat claims.
+	// Defaults to DefaultClockSkew.
+	ClockSkew time.Duration
 }
 
 // AppleProfile represents the user data from Apple ID token
@@ -60,6 +80,13 @@ func NewApple(opts *AppleOptions) *AppleProvider {
 	// Use provided client secret or we'll generate it on-demand
 	clientSecret := opts.ClientSecret
 
+	clockSkew := opts.ClockSkew
+	if clockSkew == 0 {
+		clockSkew = DefaultClockSkew
+	}
+
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+
 	return &AppleProvider{
 		clientID:     opts.ClientID,
 		clientSecret: clientSecret,
@@ -67,7 +94,10 @@ func NewApple(opts *AppleOptions) *AppleProvider {
 		keyID:        opts.KeyID,
 		privateKey:   opts.PrivateKey,
 		scopes:       scopes,
-		httpClient:   &http.Client{Timeout: 10 * time.Second},
+		audiences:    append([]string{opts.ClientID}, opts.Audiences...),
+		clockSkew:    clockSkew,
+		httpClient:   httpClient,
+		keys:         newJWKSCache(appleKeysURL, httpClient, appleKeysTTL),
 	}
 }
 
@@ -108,6 +138,10 @@ func (p *AppleProvider) CreateAuthorizationURL(state, redirectURI string, option
 	}
 	q.Set("scope", strings.Join(scopes, " "))
 
+	if options != nil && options.Nonce != "" {
+		q.Set("nonce", options.Nonce)
+	}
+
 	if options != nil && len(options.ExtraParams) > 0 {
 		for k, v := range options.ExtraParams {
 			q.Set(k, v)
@@ -190,18 +224,33 @@ func (p *AppleProvider) GetUserInfo(ctx context.Context, accessToken string) (*O
 	return nil, fmt.Errorf("apple provider requires ID token for user info")
 }
 
-// GetUserInfoFromIDToken extracts user info from Apple's ID token
-func (p *AppleProvider) GetUserInfoFromIDToken(idToken string) (*OAuthUserInfo, error) {
-	// Parse the JWT without verification for now (verification should be done separately)
-	// In production, you should verify the signature against Apple's public keys
-	token, _, err := new(jwt.Parser).ParseUnverified(idToken, jwt.MapClaims{})
+// GetUserInfoFromIDToken verifies Apple's ID token and extracts the user
+// info. The signature is checked against Apple's published keys, and the
+// token must be issued by Apple for one of the provider's audiences,
+// unexpired and, when nonce is set, carry that nonce. Errors wrap the
+// ErrIDToken* errors.
+func (p *AppleProvider) GetUserInfoFromIDToken(ctx context.Context, idToken, nonce string) (*OAuthUserInfo, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims,
+		func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			return p.keys.key(ctx, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(appleIssuer),
+		jwt.WithAudience(p.audiences...),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(p.clockSkew),
+	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse ID token: %w", err)
+		return nil, idTokenError(err)
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return nil, fmt.Errorf("invalid token claims")
+	if nonce != "" {
+		if got, _ := claims["nonce"].(string); subtle.ConstantTimeCompare([]byte(got), []byte(nonce)) != 1 {
+			return nil, ErrIDTokenNonce
+		}
 	}
 
 	profile := &AppleProfile{}
@@ -363,52 +412,13 @@ func (p *AppleProvider) generateClientSecret() (string, error) {
 	return signedToken, nil
 }
 
-// VerifyApplePublicKey fetches and verifies Apple's public key
-func VerifyApplePublicKey(kid string) (*rsa.PublicKey, error) {
-	resp, err := http.Get("https://appleid.apple.com/auth/keys")
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch Apple public keys: %w", err)
-	}
-	defer func() { _ = resp.Body.Close() }()
+// defaultAppleKeys backs VerifyApplePublicKey
+var defaultAppleKeys = newJWKSCache(appleKeysURL, &http.Client{Timeout: 10 * time.Second}, appleKeysTTL)
 
-	var jwks struct {
-		Keys []struct {
-			Kid string `json:"kid"`
-			Alg string `json:"alg"`
-			Kty string `json:"kty"`
-			Use string `json:"use"`
-			N   string `json:"n"`
-			E   string `json:"e"`
-		} `json:"keys"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
-		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
-	}
-
-	// Find the key with matching kid
-	for _, key := range jwks.Keys {
-		if key.Kid == kid {
-			// Decode N and E
-			nBytes, err := base64.RawURLEncoding.DecodeString(key.N)
-			if err != nil {
-				return nil, fmt.Errorf("failed to decode N: %w", err)
-			}
-			eBytes, err := base64.RawURLEncoding.DecodeString(key.E)
-			if err != nil {
-				return nil, fmt.Errorf("failed to decode E: %w", err)
-			}
-
-			// Convert to big.Int
-			n := new(big.Int).SetBytes(nBytes)
-			e := new(big.Int).SetBytes(eBytes)
-
-			return &rsa.PublicKey{
-				N: n,
-				E: int(e.Int64()),
-			}, nil
-		}
-	}
-
-	return nil, fmt.Errorf("key with kid %s not found", kid)
+// VerifyApplePublicKey fetches Apple's public key with the given key ID.
+//
+// Deprecated: GetUserInfoFromIDToken verifies ID tokens against Apple's
+// keys itself.
+func VerifyApplePublicKey(kid string) (*rsa.PublicKey, error) {
+	return defaultAppleKeys.key(context.Background(), kid)
 }
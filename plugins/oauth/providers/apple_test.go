@@ -0,0 +1,156 @@
+package providers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testJWKSServer serves a JWKS publishing key under kid "test"
+func testJWKSServer(t *testing.T, key *rsa.PrivateKey) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": "test",
+				"kty": "RSA",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// testAppleProvider returns a provider whose keys are served by
+// testJWKSServer
+func testAppleProvider(t *testing.T, key *rsa.PrivateKey) *AppleProvider {
+	t.Helper()
+
+	server := testJWKSServer(t, key)
+	p := NewApple(&AppleOptions{ClientID: "com.example.web", Audiences: []string{"com.example.ios"}})
+	p.keys = newJWKSCache(server.URL, server.Client(), time.Hour)
+	return p
+}
+
+func signIDToken(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("SignedString() error = %v", err)
+	}
+	return signed
+}
+
+func appleClaims(overrides jwt.MapClaims) jwt.MapClaims {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            appleIssuer,
+		"aud":            "com.example.web",
+		"sub":            "001234.abcd",
+		"email":          "user@privaterelay.appleid.com",
+		"email_verified": "true",
+		"nonce":          "nonce-1",
+		"iat":            now.Unix(),
+		"exp":            now.Add(10 * time.Minute).Unix(),
+	}
+	for k, v := range overrides {
+		if v == nil {
+			delete(claims, k)
+			continue
+		}
+		claims[k] = v
+	}
+	return claims
+}
+
+func TestAppleGetUserInfoFromIDToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	p := testAppleProvider(t, key)
+	ctx := context.Background()
+
+	info, err := p.GetUserInfoFromIDToken(ctx, signIDToken(t, key, "test", appleClaims(nil)), "nonce-1")
+	if err != nil {
+		t.Fatalf("GetUserInfoFromIDToken() error = %v", err)
+	}
+	if info.ID != "001234.abcd" || info.Email != "user@privaterelay.appleid.com" || !info.EmailVerified {
+		t.Errorf("GetUserInfoFromIDToken() = %+v", info)
+	}
+
+	// Native sign-in from the iOS app uses the bundle ID as audience
+	ios := signIDToken(t, key, "test", appleClaims(jwt.MapClaims{"aud": "com.example.ios"}))
+	if _, err := p.GetUserInfoFromIDToken(ctx, ios, "nonce-1"); err != nil {
+		t.Errorf("GetUserInfoFromIDToken() with extra audience error = %v", err)
+	}
+
+	// Within the clock skew
+	skewed := signIDToken(t, key, "test", appleClaims(jwt.MapClaims{"exp": time.Now().Add(-30 * time.Second).Unix()}))
+	if _, err := p.GetUserInfoFromIDToken(ctx, skewed, "nonce-1"); err != nil {
+		t.Errorf("GetUserInfoFromIDToken() within clock skew error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"malformed", "not-a-jwt", ErrIDTokenMalformed},
+		{"wrong key", signIDToken(t, otherKey, "test", appleClaims(nil)), ErrIDTokenSignature},
+		{"unknown kid", signIDToken(t, key, "rotated", appleClaims(nil)), ErrIDTokenUnknownKey},
+		{"issuer", signIDToken(t, key, "test", appleClaims(jwt.MapClaims{"iss": "https://evil.example"})), ErrIDTokenIssuer},
+		{"audience", signIDToken(t, key, "test", appleClaims(jwt.MapClaims{"aud": "com.other.app"})), ErrIDTokenAudience},
+		{"expired", signIDToken(t, key, "test", appleClaims(jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()})), ErrIDTokenExpired},
+		{"missing exp", signIDToken(t, key, "test", appleClaims(jwt.MapClaims{"exp": nil})), ErrIDTokenExpired},
+		{"nonce", signIDToken(t, key, "test", appleClaims(jwt.MapClaims{"nonce": "replayed"})), ErrIDTokenNonce},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := p.GetUserInfoFromIDToken(ctx, tt.token, "nonce-1")
+			if !errors.Is(err, tt.want) {
+				t.Errorf("GetUserInfoFromIDToken() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppleGetUserInfoFromIDToken_KeysUnavailable(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	p := NewApple(&AppleOptions{ClientID: "com.example.web"})
+	p.keys = newJWKSCache(server.URL, server.Client(), time.Hour)
+
+	_, err = p.GetUserInfoFromIDToken(context.Background(), signIDToken(t, key, "test", appleClaims(nil)), "")
+	if !errors.Is(err, ErrJWKSUnavailable) {
+		t.Errorf("GetUserInfoFromIDToken() error = %v, want %v", err, ErrJWKSUnavailable)
+	}
+}
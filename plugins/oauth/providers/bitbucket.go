@@ -0,0 +1,222 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type BitbucketProvider struct {
+	clientID     string
+	clientSecret string
+	scopes       []string
+	httpClient   *http.Client
+}
+
+type BitbucketOptions struct {
+	ClientID     string // OAuth consumer key
+	ClientSecret string // OAuth consumer secret
+	Scopes       []string
+}
+
+func NewBitbucket(opts *BitbucketOptions) *BitbucketProvider {
+	if opts == nil {
+		opts = &BitbucketOptions{}
+	}
+
+	scopes := opts.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"account", "email"}
+	}
+
+	return &BitbucketProvider{
+		clientID:     opts.ClientID,
+		clientSecret: opts.ClientSecret,
+		scopes:       scopes,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *BitbucketProvider) ID() string {
+	return "bitbucket"
+}
+
+func (p *BitbucketProvider) Name() string {
+	return "Bitbucket"
+}
+
+func (p *BitbucketProvider) Init() error {
+	if p.clientID == "" || p.clientSecret == "" {
+		return fmt.Errorf("bitbucket consumer key and secret are required")
+	}
+	return nil
+}
+
+func (p *BitbucketProvider) CreateAuthorizationURL(state, redirectURI string, options *AuthOptions) (*url.URL, error) {
+	authURL, _ := url.Parse("https://bitbucket.org/site/oauth2/authorize")
+
+	q := authURL.Query()
+	q.Set("client_id", p.clientID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("response_type", "code")
+	q.Set("state", state)
+
+	scopes := p.scopes
+	if options != nil && len(options.Scopes) > 0 {
+		scopes = options.Scopes
+	}
+	q.Set("scope", strings.Join(scopes, " "))
+
+	if options != nil && len(options.ExtraParams) > 0 {
+		for k, v := range options.ExtraParams {
+			q.Set(k, v)
+		}
+	}
+
+	authURL.RawQuery = q.Encode()
+	return authURL, nil
+}
+
+func (p *BitbucketProvider) ExchangeCode(ctx context.Context, code, codeVerifier, redirectURI string) (*OAuthTokens, error) {
+	data := url.Values{}
+	data.Set("code", code)
+	data.Set("redirect_uri", redirectURI)
+	data.Set("grant_type", "authorization_code")
+
+	return p.requestTokens(ctx, data, "exchange")
+}
+
+func (p *BitbucketProvider) RefreshToken(ctx context.Context, refreshToken string) (*OAuthTokens, error) {
+	data := url.Values{}
+	data.Set("refresh_token", refreshToken)
+	data.Set("grant_type", "refresh_token")
+
+	return p.requestTokens(ctx, data, "refresh")
+}
+
+// requestTokens posts to Bitbucket's token endpoint, authenticating with
+// HTTP Basic auth
+func (p *BitbucketProvider) requestTokens(ctx context.Context, data url.Values, action string) (*OAuthTokens, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://bitbucket.org/site/oauth2/access_token", strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(p.clientID, p.clientSecret)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to %s token (status %d): %s", action, resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	if result.AccessToken == "" {
+		return nil, fmt.Errorf("empty access token received")
+	}
+
+	var expiresAt *time.Time
+	if result.ExpiresIn > 0 {
+		t := time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+		expiresAt = &t
+	}
+
+	return &OAuthTokens{
+		AccessToken:  result.AccessToken,
+		RefreshToken: result.RefreshToken,
+		TokenType:    result.TokenType,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+func (p *BitbucketProvider) GetUserInfo(ctx context.Context, accessToken string) (*OAuthUserInfo, error) {
+	var userMap map[string]interface{}
+	if err := p.get(ctx, accessToken, "https://api.bitbucket.org/2.0/user", &userMap); err != nil {
+		return nil, fmt.Errorf("failed to get user info: %w", err)
+	}
+
+	uuid, _ := userMap["uuid"].(string)
+	name, _ := userMap["display_name"].(string)
+	username, _ := userMap["username"].(string)
+	if name == "" {
+		name = username
+	}
+
+	// links.avatar.href
+	var picture string
+	if links, ok := userMap["links"].(map[string]interface{}); ok {
+		if avatar, ok := links["avatar"].(map[string]interface{}); ok {
+			picture, _ = avatar["href"].(string)
+		}
+	}
+
+	// The email needs a second call, and the email scope
+	var emails struct {
+		Values []struct {
+			Email       string `json:"email"`
+			IsPrimary   bool   `json:"is_primary"`
+			IsConfirmed bool   `json:"is_confirmed"`
+		} `json:"values"`
+	}
+	var email string
+	var emailVerified bool
+	if err := p.get(ctx, accessToken, "https://api.bitbucket.org/2.0/user/emails", &emails); err == nil {
+		for _, e := range emails.Values {
+			if e.IsPrimary {
+				email = e.Email
+				emailVerified = e.IsConfirmed
+				break
+			}
+		}
+	}
+
+	return &OAuthUserInfo{
+		ID:            uuid,
+		Email:         email,
+		EmailVerified: emailVerified,
+		Name:          name,
+		Picture:       picture,
+		RawData:       userMap,
+	}, nil
+}
+
+// get decodes a Bitbucket API response into v
+func (p *BitbucketProvider) get(ctx context.Context, accessToken, endpoint string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,238 @@
+package providers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type FacebookProvider struct {
+	clientID     string
+	clientSecret string
+	scopes       []string
+	fields       []string
+	apiVersion   string
+	httpClient   *http.Client
+}
+
+type FacebookOptions struct {
+	ClientID     string // App ID
+	ClientSecret string // App secret
+	Scopes       []string
+	Fields       []string // Graph API user fields
+	APIVersion   string   // Graph API version, e.g. "v21.0"
+}
+
+func NewFacebook(opts *FacebookOptions) *FacebookProvider {
+	if opts == nil {
+		opts = &FacebookOptions{}
+	}
+
+	scopes := opts.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"email", "public_profile"}
+	}
+
+	fields := opts.Fields
+	if len(fields) == 0 {
+		fields = []string{"id", "name", "email", "first_name", "last_name", "picture"}
+	}
+
+	apiVersion := opts.APIVersion
+	if apiVersion == "" {
+		apiVersion = "v21.0"
+	}
+
+	return &FacebookProvider{
+		clientID:     opts.ClientID,
+		clientSecret: opts.ClientSecret,
+		scopes:       scopes,
+		fields:       fields,
+		apiVersion:   apiVersion,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *FacebookProvider) ID() string {
+	return "facebook"
+}
+
+func (p *FacebookProvider) Name() string {
+	return "Facebook"
+}
+
+func (p *FacebookProvider) Init() error {
+	if p.clientID == "" || p.clientSecret == "" {
+		return fmt.Errorf("facebook app ID and secret are required")
+	}
+	return nil
+}
+
+func (p *FacebookProvider) CreateAuthorizationURL(state, redirectURI string, options *AuthOptions) (*url.URL, error) {
+	authURL, _ := url.Parse("https://www.facebook.com/" + p.apiVersion + "/dialog/oauth")
+
+	q := authURL.Query()
+	q.Set("client_id", p.clientID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("response_type", "code")
+	q.Set("state", state)
+
+	scopes := p.scopes
+	if options != nil && len(options.Scopes) > 0 {
+		scopes = options.Scopes
+	}
+	q.Set("scope", strings.Join(scopes, ","))
+
+	// PKCE
+	if options != nil && options.CodeVerifier != "" {
+		q.Set("code_challenge", CodeChallenge(options.CodeVerifier))
+		q.Set("code_challenge_method", "S256")
+	}
+
+	if options != nil && len(options.ExtraParams) > 0 {
+		for k, v := range options.ExtraParams {
+			q.Set(k, v)
+		}
+	}
+
+	authURL.RawQuery = q.Encode()
+	return authURL, nil
+}
+
+func (p *FacebookProvider) ExchangeCode(ctx context.Context, code, codeVerifier, redirectURI string) (*OAuthTokens, error) {
+	tokenURL, _ := url.Parse(p.graphURL("/oauth/access_token"))
+
+	q := tokenURL.Query()
+	q.Set("client_id", p.clientID)
+	q.Set("client_secret", p.clientSecret)
+	q.Set("code", code)
+	q.Set("redirect_uri", redirectURI)
+
+	if codeVerifier != "" {
+		q.Set("code_verifier", codeVerifier)
+	}
+	tokenURL.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", tokenURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to exchange token (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	if result.AccessToken == "" {
+		return nil, fmt.Errorf("empty access token received")
+	}
+
+	var expiresAt *time.Time
+	if result.ExpiresIn > 0 {
+		t := time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+		expiresAt = &t
+	}
+
+	return &OAuthTokens{
+		AccessToken: result.AccessToken,
+		TokenType:   result.TokenType,
+		ExpiresAt:   expiresAt,
+	}, nil
+}
+
+func (p *FacebookProvider) GetUserInfo(ctx context.Context, accessToken string) (*OAuthUserInfo, error) {
+	meURL, _ := url.Parse(p.graphURL("/me"))
+
+	q := meURL.Query()
+	q.Set("fields", strings.Join(p.fields, ","))
+	// Proves the call comes from the app's server, so a leaked token
+	// cannot be used without the app secret
+	q.Set("appsecret_proof", p.appSecretProof(accessToken))
+	meURL.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", meURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get user info: status %d", resp.StatusCode)
+	}
+
+	var userMap map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&userMap); err != nil {
+		return nil, err
+	}
+
+	id, _ := userMap["id"].(string)
+	email, _ := userMap["email"].(string)
+	name, _ := userMap["name"].(string)
+	firstName, _ := userMap["first_name"].(string)
+	lastName, _ := userMap["last_name"].(string)
+
+	// picture is {"data": {"url": ...}}
+	var picture string
+	if pic, ok := userMap["picture"].(map[string]interface{}); ok {
+		if data, ok := pic["data"].(map[string]interface{}); ok {
+			picture, _ = data["url"].(string)
+		}
+	}
+
+	return &OAuthUserInfo{
+		ID:        id,
+		Email:     email,
+		Name:      name,
+		FirstName: firstName,
+		LastName:  lastName,
+		Picture:   picture,
+		RawData:   userMap,
+	}, nil
+}
+
+func (p *FacebookProvider) RefreshToken(ctx context.Context, refreshToken string) (*OAuthTokens, error) {
+	return nil, fmt.Errorf("refresh token not supported by Facebook")
+}
+
+// graphURL returns a Graph API URL for the configured version
+func (p *FacebookProvider) graphURL(path string) string {
+	return "https://graph.facebook.com/" + p.apiVersion + path
+}
+
+// appSecretProof is the hex HMAC-SHA256 of the access token keyed by the
+// app secret
+func (p *FacebookProvider) appSecretProof(accessToken string) string {
+	mac := hmac.New(sha256.New, []byte(p.clientSecret))
+	mac.Write([]byte(accessToken))
+	return hex.EncodeToString(mac.Sum(nil))
+}
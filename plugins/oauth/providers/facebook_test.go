@@ -0,0 +1,36 @@
+package providers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestFacebookAppSecretProof(t *testing.T) {
+	p := NewFacebook(&FacebookOptions{ClientID: "app", ClientSecret: "secret"})
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("token"))
+	want := hex.EncodeToString(mac.Sum(nil))
+
+	if got := p.appSecretProof("token"); got != want {
+		t.Errorf("appSecretProof() = %q, want %q", got, want)
+	}
+}
+
+func TestFacebookCreateAuthorizationURL(t *testing.T) {
+	p := NewFacebook(&FacebookOptions{ClientID: "app", ClientSecret: "secret"})
+
+	authURL, err := p.CreateAuthorizationURL("state", "https://app.example/callback", nil)
+	if err != nil {
+		t.Fatalf("CreateAuthorizationURL() error = %v", err)
+	}
+	if authURL.Path != "/v21.0/dialog/oauth" {
+		t.Errorf("path = %q", authURL.Path)
+	}
+	// Facebook separates scopes with commas
+	if got := authURL.Query().Get("scope"); got != "email,public_profile" {
+		t.Errorf("scope = %q", got)
+	}
+}
@@ -0,0 +1,362 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TokenAuthStyle is how a client authenticates to a token endpoint
+type TokenAuthStyle int
+
+const (
+	// AuthStyleInParams sends client_id and client_secret in the form body
+	AuthStyleInParams TokenAuthStyle = iota
+
+	// AuthStyleInHeader sends them with HTTP Basic auth
+	AuthStyleInHeader
+)
+
+// UserInfoMapper turns a userinfo response into the user's info
+type UserInfoMapper func(raw map[string]interface{}) (*OAuthUserInfo, error)
+
+// GenericOAuth2Provider signs users in with any OAuth 2.0 or OpenID
+// Connect server described by its endpoints, such as an in-house IdP
+type GenericOAuth2Provider struct {
+	opts       GenericOAuth2Options
+	httpClient *http.Client
+}
+
+type GenericOAuth2Options struct {
+	// ID is used in the endpoint paths (/oauth/{ID}/login) and stored
+	// with linked accounts. It must not change once users signed in.
+	ID   string
+	Name string
+
+	ClientID     string
+	ClientSecret string
+
+	AuthorizationURL string
+	TokenURL         string
+	UserInfoURL      string
+
+	Scopes         []string
+	ScopeSeparator string // Defaults to a space
+
+	// UsePKCE sends an S256 code challenge and the verifier
+	UsePKCE bool
+
+	// AuthStyle is how the client authenticates to TokenURL
+	AuthStyle TokenAuthStyle
+
+	// MapUserInfo maps the UserInfoURL response. Defaults to
+	// MapOIDCUserInfo.
+	MapUserInfo UserInfoMapper
+
+	// ExtraAuthParams are added to every authorization URL
+	ExtraAuthParams map[string]string
+}
+
+func NewGenericOAuth2(opts *GenericOAuth2Options) *GenericOAuth2Provider {
+	if opts == nil {
+		opts = &GenericOAuth2Options{}
+	}
+
+	o := *opts
+	if o.Name == "" {
+		o.Name = o.ID
+	}
+	if o.ScopeSeparator == "" {
+		o.ScopeSeparator = " "
+	}
+	if o.MapUserInfo == nil {
+		o.MapUserInfo = MapOIDCUserInfo
+	}
+
+	return &GenericOAuth2Provider{
+		opts:       o,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *GenericOAuth2Provider) ID() string {
+	return p.opts.ID
+}
+
+func (p *GenericOAuth2Provider) Name() string {
+	return p.opts.Name
+}
+
+func (p *GenericOAuth2Provider) Init() error {
+	if p.opts.ID == "" {
+		return fmt.Errorf("generic OAuth2 provider ID is required")
+	}
+	if p.opts.ClientID == "" {
+		return fmt.Errorf("%s client ID is required", p.opts.ID)
+	}
+	for name, endpoint := range map[string]string{
+		"authorization": p.opts.AuthorizationURL,
+		"token":         p.opts.TokenURL,
+		"userinfo":      p.opts.UserInfoURL,
+	} {
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("%s %s URL is invalid: %q", p.opts.ID, name, endpoint)
+		}
+	}
+	return nil
+}
+
+func (p *GenericOAuth2Provider) CreateAuthorizationURL(state, redirectURI string, options *AuthOptions) (*url.URL, error) {
+	authURL, err := url.Parse(p.opts.AuthorizationURL)
+	if err != nil {
+		return nil, err
+	}
+
+	q := authURL.Query()
+	q.Set("client_id", p.opts.ClientID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("response_type", "code")
+	q.Set("state", state)
+
+	scopes := p.opts.Scopes
+	if options != nil && len(options.Scopes) > 0 {
+		scopes = options.Scopes
+	}
+	if len(scopes) > 0 {
+		q.Set("scope", strings.Join(scopes, p.opts.ScopeSeparator))
+	}
+
+	// PKCE
+	if p.opts.UsePKCE && options != nil && options.CodeVerifier != "" {
+		q.Set("code_challenge", CodeChallenge(options.CodeVerifier))
+		q.Set("code_challenge_method", "S256")
+	}
+	if options != nil && options.Nonce != "" && slices.Contains(scopes, "openid") {
+		q.Set("nonce", options.Nonce)
+	}
+
+	for k, v := range p.opts.ExtraAuthParams {
+		q.Set(k, v)
+	}
+	if options != nil && len(options.ExtraParams) > 0 {
+		for k, v := range options.ExtraParams {
+			q.Set(k, v)
+		}
+	}
+
+	authURL.RawQuery = q.Encode()
+	return authURL, nil
+}
+
+func (p *GenericOAuth2Provider) ExchangeCode(ctx context.Context, code, codeVerifier, redirectURI string) (*OAuthTokens, error) {
+	data := url.Values{}
+	data.Set("code", code)
+	data.Set("redirect_uri", redirectURI)
+	data.Set("grant_type", "authorization_code")
+
+	if p.opts.UsePKCE && codeVerifier != "" {
+		data.Set("code_verifier", codeVerifier)
+	}
+
+	return p.requestTokens(ctx, data, "exchange")
+}
+
+func (p *GenericOAuth2Provider) RefreshToken(ctx context.Context, refreshToken string) (*OAuthTokens, error) {
+	data := url.Values{}
+	data.Set("refresh_token", refreshToken)
+	data.Set("grant_type", "refresh_token")
+
+	tokens, err := p.requestTokens(ctx, data, "refresh")
+	if err != nil {
+		return nil, err
+	}
+	// Servers that do not rotate refresh tokens omit them
+	if tokens.RefreshToken == "" {
+		tokens.RefreshToken = refreshToken
+	}
+	return tokens, nil
+}
+
+// requestTokens posts to the token endpoint. Responses may be JSON or,
+// like some older servers send, form encoded.
+func (p *GenericOAuth2Provider) requestTokens(ctx context.Context, data url.Values, action string) (*OAuthTokens, error) {
+	// Public clients have no secret to authenticate with and only
+	// identify themselves
+	inHeader := p.opts.AuthStyle == AuthStyleInHeader && p.opts.ClientSecret != ""
+	if !inHeader {
+		data.Set("client_id", p.opts.ClientID)
+		if p.opts.ClientSecret != "" {
+			data.Set("client_secret", p.opts.ClientSecret)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.opts.TokenURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if inHeader {
+		req.SetBasicAuth(url.QueryEscape(p.opts.ClientID), url.QueryEscape(p.opts.ClientSecret))
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to %s token (status %d): %s", action, resp.StatusCode, string(body))
+	}
+
+	result := make(map[string]interface{})
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "application/x-www-form-urlencoded" || mediaType == "text/plain" {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, err
+		}
+		for k := range values {
+			result[k] = values.Get(k)
+		}
+	} else if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	if errCode, _ := result["error"].(string); errCode != "" {
+		return nil, fmt.Errorf("failed to %s token: %s", action, errCode)
+	}
+
+	accessToken, _ := result["access_token"].(string)
+	if accessToken == "" {
+		return nil, fmt.Errorf("empty access token received")
+	}
+	refreshToken, _ := result["refresh_token"].(string)
+	tokenType, _ := result["token_type"].(string)
+	idToken, _ := result["id_token"].(string)
+
+	// expires_in is a number, or a string in form-encoded responses
+	var expiresIn int64
+	switch v := result["expires_in"].(type) {
+	case float64:
+		expiresIn = int64(v)
+	case string:
+		expiresIn, _ = strconv.ParseInt(v, 10, 64)
+	}
+
+	var expiresAt *time.Time
+	if expiresIn > 0 {
+		t := time.Now().Add(time.Duration(expiresIn) * time.Second)
+		expiresAt = &t
+	}
+
+	return &OAuthTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    tokenType,
+		ExpiresAt:    expiresAt,
+		IDToken:      idToken,
+	}, nil
+}
+
+func (p *GenericOAuth2Provider) GetUserInfo(ctx context.Context, accessToken string) (*OAuthUserInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.opts.UserInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get user info: status %d", resp.StatusCode)
+	}
+
+	var raw map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	info, err := p.opts.MapUserInfo(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map user info: %w", err)
+	}
+	if info.ID == "" {
+		return nil, fmt.Errorf("failed to map user info: no user ID")
+	}
+	if info.RawData == nil {
+		info.RawData = raw
+	}
+	return info, nil
+}
+
+// MapOIDCUserInfo maps the standard OpenID Connect claims: sub (or id),
+// email, email_verified, name, given_name, family_name and picture
+func MapOIDCUserInfo(raw map[string]interface{}) (*OAuthUserInfo, error) {
+	id := stringClaim(raw, "sub")
+	if id == "" {
+		id = stringClaim(raw, "id")
+	}
+
+	email := stringClaim(raw, "email")
+	givenName := stringClaim(raw, "given_name")
+	familyName := stringClaim(raw, "family_name")
+
+	name := stringClaim(raw, "name")
+	if name == "" {
+		name = strings.TrimSpace(givenName + " " + familyName)
+	}
+	if name == "" {
+		name = stringClaim(raw, "preferred_username")
+	}
+
+	// email_verified can be string or bool
+	var emailVerified bool
+	switch v := raw["email_verified"].(type) {
+	case bool:
+		emailVerified = v
+	case string:
+		emailVerified = v == "true"
+	}
+
+	return &OAuthUserInfo{
+		ID:            id,
+		Email:         email,
+		EmailVerified: emailVerified,
+		Name:          name,
+		FirstName:     givenName,
+		LastName:      familyName,
+		Picture:       stringClaim(raw, "picture"),
+		RawData:       raw,
+	}, nil
+}
+
+// stringClaim returns a string or numeric claim as a string
+func stringClaim(raw map[string]interface{}, key string) string {
+	switch v := raw[key].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
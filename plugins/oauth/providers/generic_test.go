@@ -0,0 +1,148 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// testIdP serves a token and a userinfo endpoint. Tokens are form encoded
+// when formTokens is set.
+func testIdP(t *testing.T, formTokens bool) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "client" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.FormValue("code") != "code-1" || r.FormValue("code_verifier") != "verifier" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if formTokens {
+			w.Header().Set("Content-Type", "application/x-www-form-urlencoded")
+			_, _ = w.Write([]byte("access_token=access&token_type=bearer&expires_in=3600"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token": "access", "refresh_token": "refresh", "token_type": "Bearer", "expires_in": 3600}`))
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"employee_id": 42, "mail": "jane@corp.example", "display": "Jane Doe", "sub": "s-1", "email": "jane@corp.example", "email_verified": "true", "name": "Jane"}`))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestGeneric(server *httptest.Server, mapper UserInfoMapper) *GenericOAuth2Provider {
+	return NewGenericOAuth2(&GenericOAuth2Options{
+		ID:               "corp",
+		ClientID:         "client",
+		ClientSecret:     "secret",
+		AuthorizationURL: server.URL + "/authorize",
+		TokenURL:         server.URL + "/token",
+		UserInfoURL:      server.URL + "/userinfo",
+		Scopes:           []string{"openid", "profile"},
+		UsePKCE:          true,
+		AuthStyle:        AuthStyleInHeader,
+		MapUserInfo:      mapper,
+	})
+}
+
+func TestGenericOAuth2Flow(t *testing.T) {
+	ctx := context.Background()
+
+	for _, formTokens := range []bool{false, true} {
+		server := testIdP(t, formTokens)
+		p := newTestGeneric(server, nil)
+		if err := p.Init(); err != nil {
+			t.Fatalf("Init() error = %v", err)
+		}
+
+		tokens, err := p.ExchangeCode(ctx, "code-1", "verifier", "https://app.example/callback")
+		if err != nil {
+			t.Fatalf("ExchangeCode() (form tokens %v) error = %v", formTokens, err)
+		}
+		if tokens.AccessToken != "access" || tokens.ExpiresAt == nil {
+			t.Errorf("ExchangeCode() (form tokens %v) = %+v", formTokens, tokens)
+		}
+
+		info, err := p.GetUserInfo(ctx, tokens.AccessToken)
+		if err != nil {
+			t.Fatalf("GetUserInfo() error = %v", err)
+		}
+		if info.ID != "s-1" || info.Email != "jane@corp.example" || !info.EmailVerified || info.Name != "Jane" {
+			t.Errorf("GetUserInfo() = %+v", info)
+		}
+	}
+}
+
+func TestGenericOAuth2CustomMapper(t *testing.T) {
+	server := testIdP(t, false)
+	p := newTestGeneric(server, func(raw map[string]interface{}) (*OAuthUserInfo, error) {
+		id, ok := raw["employee_id"].(float64)
+		if !ok {
+			return nil, errors.New("missing employee_id")
+		}
+		mail, _ := raw["mail"].(string)
+		display, _ := raw["display"].(string)
+		return &OAuthUserInfo{ID: strconv.Itoa(int(id)), Email: mail, Name: display}, nil
+	})
+
+	info, err := p.GetUserInfo(context.Background(), "access")
+	if err != nil {
+		t.Fatalf("GetUserInfo() error = %v", err)
+	}
+	if info.ID != "42" || info.Name != "Jane Doe" || info.RawData["mail"] != "jane@corp.example" {
+		t.Errorf("GetUserInfo() = %+v", info)
+	}
+}
+
+func TestGenericOAuth2CreateAuthorizationURL(t *testing.T) {
+	p := NewGenericOAuth2(&GenericOAuth2Options{
+		ID:               "corp",
+		ClientID:         "client",
+		AuthorizationURL: "https://idp.example/authorize?tenant=a",
+		TokenURL:         "https://idp.example/token",
+		UserInfoURL:      "https://idp.example/userinfo",
+		Scopes:           []string{"openid", "email"},
+		UsePKCE:          true,
+		ExtraAuthParams:  map[string]string{"prompt": "login"},
+	})
+
+	authURL, err := p.CreateAuthorizationURL("state", "https://app.example/callback", &AuthOptions{CodeVerifier: "verifier", Nonce: "nonce"})
+	if err != nil {
+		t.Fatalf("CreateAuthorizationURL() error = %v", err)
+	}
+	q := authURL.Query()
+	for key, want := range map[string]string{
+		"tenant":         "a",
+		"scope":          "openid email",
+		"code_challenge": CodeChallenge("verifier"),
+		"nonce":          "nonce",
+		"prompt":         "login",
+	} {
+		if got := q.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestGenericOAuth2Init(t *testing.T) {
+	p := NewGenericOAuth2(&GenericOAuth2Options{ID: "corp", ClientID: "client", AuthorizationURL: "https://idp.example/authorize", TokenURL: "/token", UserInfoURL: "https://idp.example/userinfo"})
+	if err := p.Init(); err == nil {
+		t.Error("Init() with a relative token URL succeeded, want error")
+	}
+}
@@ -0,0 +1,224 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type GitLabProvider struct {
+	clientID     string
+	clientSecret string
+	baseURL      string
+	scopes       []string
+	httpClient   *http.Client
+}
+
+type GitLabOptions struct {
+	ClientID     string // Application ID
+	ClientSecret string
+	BaseURL      string // Self-managed instance URL, defaults to https://gitlab.com
+	Scopes       []string
+}
+
+func NewGitLab(opts *GitLabOptions) *GitLabProvider {
+	if opts == nil {
+		opts = &GitLabOptions{}
+	}
+
+	baseURL := strings.TrimSuffix(opts.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = "https://gitlab.com"
+	}
+
+	scopes := opts.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"read_user"}
+	}
+
+	return &GitLabProvider{
+		clientID:     opts.ClientID,
+		clientSecret: opts.ClientSecret,
+		baseURL:      baseURL,
+		scopes:       scopes,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *GitLabProvider) ID() string {
+	return "gitlab"
+}
+
+func (p *GitLabProvider) Name() string {
+	return "GitLab"
+}
+
+func (p *GitLabProvider) Init() error {
+	if p.clientID == "" || p.clientSecret == "" {
+		return fmt.Errorf("gitlab application ID and secret are required")
+	}
+	return nil
+}
+
+func (p *GitLabProvider) CreateAuthorizationURL(state, redirectURI string, options *AuthOptions) (*url.URL, error) {
+	authURL, err := url.Parse(p.baseURL + "/oauth/authorize")
+	if err != nil {
+		return nil, fmt.Errorf("invalid gitlab base URL: %w", err)
+	}
+
+	q := authURL.Query()
+	q.Set("client_id", p.clientID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("response_type", "code")
+	q.Set("state", state)
+
+	scopes := p.scopes
+	if options != nil && len(options.Scopes) > 0 {
+		scopes = options.Scopes
+	}
+	q.Set("scope", strings.Join(scopes, " "))
+
+	// PKCE
+	if options != nil && options.CodeVerifier != "" {
+		q.Set("code_challenge", CodeChallenge(options.CodeVerifier))
+		q.Set("code_challenge_method", "S256")
+	}
+
+	if options != nil && len(options.ExtraParams) > 0 {
+		for k, v := range options.ExtraParams {
+			q.Set(k, v)
+		}
+	}
+
+	authURL.RawQuery = q.Encode()
+	return authURL, nil
+}
+
+func (p *GitLabProvider) ExchangeCode(ctx context.Context, code, codeVerifier, redirectURI string) (*OAuthTokens, error) {
+	data := url.Values{}
+	data.Set("client_id", p.clientID)
+	data.Set("client_secret", p.clientSecret)
+	data.Set("code", code)
+	data.Set("redirect_uri", redirectURI)
+	data.Set("grant_type", "authorization_code")
+
+	if codeVerifier != "" {
+		data.Set("code_verifier", codeVerifier)
+	}
+
+	return p.requestTokens(ctx, data, "exchange")
+}
+
+func (p *GitLabProvider) RefreshToken(ctx context.Context, refreshToken string) (*OAuthTokens, error) {
+	data := url.Values{}
+	data.Set("client_id", p.clientID)
+	data.Set("client_secret", p.clientSecret)
+	data.Set("refresh_token", refreshToken)
+	data.Set("grant_type", "refresh_token")
+
+	return p.requestTokens(ctx, data, "refresh")
+}
+
+// requestTokens posts to the instance's token endpoint
+func (p *GitLabProvider) requestTokens(ctx context.Context, data url.Values, action string) (*OAuthTokens, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/oauth/token", strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to %s token (status %d): %s", action, resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		IDToken      string `json:"id_token"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	if result.AccessToken == "" {
+		return nil, fmt.Errorf("empty access token received")
+	}
+
+	var expiresAt *time.Time
+	if result.ExpiresIn > 0 {
+		t := time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+		expiresAt = &t
+	}
+
+	return &OAuthTokens{
+		AccessToken:  result.AccessToken,
+		RefreshToken: result.RefreshToken,
+		TokenType:    result.TokenType,
+		ExpiresAt:    expiresAt,
+		IDToken:      result.IDToken,
+	}, nil
+}
+
+func (p *GitLabProvider) GetUserInfo(ctx context.Context, accessToken string) (*OAuthUserInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/api/v4/user", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get user info: status %d", resp.StatusCode)
+	}
+
+	var userMap map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&userMap); err != nil {
+		return nil, err
+	}
+
+	// id is a JSON number
+	var id string
+	if idFloat, ok := userMap["id"].(float64); ok {
+		id = strconv.FormatInt(int64(idFloat), 10)
+	}
+
+	email, _ := userMap["email"].(string)
+	confirmedAt, _ := userMap["confirmed_at"].(string)
+	name, _ := userMap["name"].(string)
+	username, _ := userMap["username"].(string)
+	picture, _ := userMap["avatar_url"].(string)
+
+	if name == "" {
+		name = username
+	}
+
+	return &OAuthUserInfo{
+		ID:            id,
+		Email:         email,
+		EmailVerified: email != "" && confirmedAt != "",
+		Name:          name,
+		Picture:       picture,
+		RawData:       userMap,
+	}, nil
+}
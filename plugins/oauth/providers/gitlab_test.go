@@ -0,0 +1,18 @@
+package providers
+
+import "testing"
+
+func TestGitLabSelfManagedURL(t *testing.T) {
+	p := NewGitLab(&GitLabOptions{ClientID: "app", ClientSecret: "secret", BaseURL: "https://gitlab.example.com/"})
+
+	authURL, err := p.CreateAuthorizationURL("state", "https://app.example/callback", &AuthOptions{CodeVerifier: "verifier"})
+	if err != nil {
+		t.Fatalf("CreateAuthorizationURL() error = %v", err)
+	}
+	if got := authURL.Scheme + "://" + authURL.Host + authURL.Path; got != "https://gitlab.example.com/oauth/authorize" {
+		t.Errorf("authorization URL = %q", got)
+	}
+	if q := authURL.Query(); q.Get("scope") != "read_user" || q.Get("code_challenge") != CodeChallenge("verifier") {
+		t.Errorf("query = %v", q)
+	}
+}
@@ -2,23 +2,39 @@ package providers
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/base64"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
 	"time"
+
+	"github.com/golang-jwt/jwt/v5"
 )
 
+const (
+	googleKeysURL = "https://www.googleapis.com/oauth2/v3/certs"
+
+	// googleKeysTTL is how long Google's signing keys are cached
+	googleKeysTTL = 6 * time.Hour
+)
+
+// googleIssuers are the issuers Google's ID tokens may carry
+var googleIssuers = []string{"https://accounts.google.com", "accounts.google.com"}
+
 type GoogleProvider struct {
 	clientID     string
 	clientSecret string
 	scopes       []string
 	accessType   string // "offline" or "online"
+	publicClient bool
+	audiences    []string
+	clockSkew    time.Duration
 	httpClient   *http.Client
+	keys         *jwksCache
 }
 
 type GoogleOptions struct {
@@ -26,6 +42,19 @@ type GoogleOptions struct {
 	ClientSecret string
 	Scopes       []string
 	AccessType   string // "offline" for refresh token, "online" otherwise
+
+	// PublicClient marks the client ID of an iOS, Android or desktop app,
+	// which has no secret. Its codes are redeemed with PKCE alone.
+	PublicClient bool
+
+	// Audiences are further client IDs accepted in ID tokens, such as the
+	// client ID of an Android app signing in with Credential Manager.
+	// ClientID is always accepted.
+	Audiences []string
+
+	// ClockSkew is the tolerance for the ID token's exp and iat claims.
+	// Defaults to DefaultClockSkew.
+	ClockSkew time.Duration
 }
 
 func NewGoogle(opts *GoogleOptions) *GoogleProvider {
@@ -43,12 +72,23 @@ func NewGoogle(opts *GoogleOptions) *GoogleProvider {
 		accessType = "online"
 	}
 
+	clockSkew := opts.ClockSkew
+	if clockSkew == 0 {
+		clockSkew = DefaultClockSkew
+	}
+
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+
 	return &GoogleProvider{
 		clientID:     opts.ClientID,
 		clientSecret: opts.ClientSecret,
 		scopes:       scopes,
 		accessType:   accessType,
-		httpClient:   &http.Client{Timeout: 10 * time.Second},
+		publicClient: opts.PublicClient,
+		audiences:    append([]string{opts.ClientID}, opts.Audiences...),
+		clockSkew:    clockSkew,
+		httpClient:   httpClient,
+		keys:         newJWKSCache(googleKeysURL, httpClient, googleKeysTTL),
 	}
 }
 
@@ -61,7 +101,7 @@ func (p *GoogleProvider) Name() string {
 }
 
 func (p *GoogleProvider) Init() error {
-	if p.clientID == "" || p.clientSecret == "" {
+	if p.clientID == "" || (p.clientSecret == "" && !p.publicClient) {
 		return fmt.Errorf("google client ID and secret are required")
 	}
 	return nil
@@ -70,10 +110,6 @@ func (p *GoogleProvider) Init() error {
 func (p *GoogleProvider) CreateAuthorizationURL(state, redirectURI string, options *AuthOptions) (*url.URL, error) {
 	authURL, _ := url.Parse("https://accounts.google.com/o/oauth2/v2/auth")
 
-	// Generate PKCE code challenge
-	codeVerifier := generateCodeVerifier()
-	codeChallenge := generateCodeChallenge(codeVerifier)
-
 	q := authURL.Query()
 	q.Set("client_id", p.clientID)
 	q.Set("redirect_uri", redirectURI)
@@ -88,8 +124,13 @@ func (p *GoogleProvider) CreateAuthorizationURL(state, redirectURI string, optio
 	q.Set("scope", strings.Join(scopes, " "))
 
 	// PKCE
-	q.Set("code_challenge", codeChallenge)
-	q.Set("code_challenge_method", "S256")
+	if options != nil && options.CodeVerifier != "" {
+		q.Set("code_challenge", CodeChallenge(options.CodeVerifier))
+		q.Set("code_challenge_method", "S256")
+	}
+	if options != nil && options.Nonce != "" {
+		q.Set("nonce", options.Nonce)
+	}
 
 	// Include granted scopes
 	q.Set("include_granted_scopes", "true")
@@ -101,18 +142,15 @@ func (p *GoogleProvider) CreateAuthorizationURL(state, redirectURI string, optio
 	}
 
 	authURL.RawQuery = q.Encode()
-
-	// Store code_verifier in state or session for later use
-	// For now, we'll return it in a special way or store it externally
-	// In production, you'd want to store this in a secure session
-
 	return authURL, nil
 }
 
 func (p *GoogleProvider) ExchangeCode(ctx context.Context, code, codeVerifier, redirectURI string) (*OAuthTokens, error) {
 	data := url.Values{}
 	data.Set("client_id", p.clientID)
-	data.Set("client_secret", p.clientSecret)
+	if p.clientSecret != "" {
+		data.Set("client_secret", p.clientSecret)
+	}
 	data.Set("code", code)
 	data.Set("redirect_uri", redirectURI)
 	data.Set("grant_type", "authorization_code")
@@ -226,6 +264,65 @@ func (p *GoogleProvider) GetUserInfo(ctx context.Context, accessToken string) (*
 	}, nil
 }
 
+// GetUserInfoFromIDToken verifies Google's ID token, such as a One Tap
+// credential, and extracts the user info. The signature is checked against
+// Google's published keys, and the token must be issued by Google for one
+// of the provider's audiences, unexpired and, when nonce is set, carry
+// that nonce. Errors wrap the ErrIDToken* errors.
+func (p *GoogleProvider) GetUserInfoFromIDToken(ctx context.Context, idToken, nonce string) (*OAuthUserInfo, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims,
+		func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			return p.keys.key(ctx, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithAudience(p.audiences...),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(p.clockSkew),
+	)
+	if err != nil {
+		return nil, idTokenError(err)
+	}
+
+	// Google issues tokens with and without the URL scheme
+	iss, _ := claims["iss"].(string)
+	if !slices.Contains(googleIssuers, iss) {
+		return nil, fmt.Errorf("%w: %q", ErrIDTokenIssuer, iss)
+	}
+
+	if nonce != "" {
+		if got, _ := claims["nonce"].(string); subtle.ConstantTimeCompare([]byte(got), []byte(nonce)) != 1 {
+			return nil, ErrIDTokenNonce
+		}
+	}
+
+	sub, _ := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+	emailVerified, _ := claims["email_verified"].(bool)
+	name, _ := claims["name"].(string)
+	givenName, _ := claims["given_name"].(string)
+	familyName, _ := claims["family_name"].(string)
+	picture, _ := claims["picture"].(string)
+
+	rawData := make(map[string]interface{}, len(claims))
+	for k, v := range claims {
+		rawData[k] = v
+	}
+
+	return &OAuthUserInfo{
+		ID:            sub,
+		Email:         email,
+		EmailVerified: emailVerified,
+		Name:          name,
+		FirstName:     givenName,
+		LastName:      familyName,
+		Picture:       picture,
+		RawData:       rawData,
+	}, nil
+}
+
 func (p *GoogleProvider) RefreshToken(ctx context.Context, refreshToken string) (*OAuthTokens, error) {
 	data := url.Values{}
 	data.Set("client_id", p.clientID)
@@ -273,18 +370,3 @@ func (p *GoogleProvider) RefreshToken(ctx context.Context, refreshToken string)
 		ExpiresAt:   expiresAt,
 	}, nil
 }
-
-// PKCE helpers
-func generateCodeVerifier() string {
-	// Generate 32 random bytes (256 bits)
-	b := make([]byte, 32)
-	// In production, use crypto/rand
-	// For now, we'll use a simple implementation
-	return base64.RawURLEncoding.EncodeToString(b)
-}
-
-func generateCodeChallenge(verifier string) string {
-	h := sha256.New()
-	h.Write([]byte(verifier))
-	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
-}
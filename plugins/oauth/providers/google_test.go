@@ -0,0 +1,95 @@
+package providers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func googleClaims(overrides jwt.MapClaims) jwt.MapClaims {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            "https://accounts.google.com",
+		"aud":            "web.apps.googleusercontent.com",
+		"sub":            "110169484474386276334",
+		"email":          "ana@example.com",
+		"email_verified": true,
+		"name":           "Ana Lima",
+		"given_name":     "Ana",
+		"family_name":    "Lima",
+		"picture":        "https://lh3.googleusercontent.com/a/photo",
+		"nonce":          "nonce-1",
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+	for k, v := range overrides {
+		if v == nil {
+			delete(claims, k)
+			continue
+		}
+		claims[k] = v
+	}
+	return claims
+}
+
+func TestGoogleGetUserInfoFromIDToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	server := testJWKSServer(t, key)
+	p := NewGoogle(&GoogleOptions{
+		ClientID:     "web.apps.googleusercontent.com",
+		ClientSecret: "secret",
+		Audiences:    []string{"android.apps.googleusercontent.com"},
+	})
+	p.keys = newJWKSCache(server.URL, server.Client(), time.Hour)
+	ctx := context.Background()
+
+	info, err := p.GetUserInfoFromIDToken(ctx, signIDToken(t, key, "test", googleClaims(nil)), "nonce-1")
+	if err != nil {
+		t.Fatalf("GetUserInfoFromIDToken() error = %v", err)
+	}
+	if info.ID != "110169484474386276334" || info.Email != "ana@example.com" || !info.EmailVerified ||
+		info.FirstName != "Ana" || info.Picture == "" {
+		t.Errorf("GetUserInfoFromIDToken() = %+v", info)
+	}
+
+	for name, claims := range map[string]jwt.MapClaims{
+		"issuer without scheme": {"iss": "accounts.google.com"},
+		"android audience":      {"aud": "android.apps.googleusercontent.com"},
+		"no nonce requested":    {"nonce": nil},
+	} {
+		nonce := "nonce-1"
+		if _, ok := claims["nonce"]; ok {
+			nonce = ""
+		}
+		if _, err := p.GetUserInfoFromIDToken(ctx, signIDToken(t, key, "test", googleClaims(claims)), nonce); err != nil {
+			t.Errorf("%s: GetUserInfoFromIDToken() error = %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"issuer", signIDToken(t, key, "test", googleClaims(jwt.MapClaims{"iss": "https://evil.example"})), ErrIDTokenIssuer},
+		{"audience", signIDToken(t, key, "test", googleClaims(jwt.MapClaims{"aud": "other.apps.googleusercontent.com"})), ErrIDTokenAudience},
+		{"expired", signIDToken(t, key, "test", googleClaims(jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()})), ErrIDTokenExpired},
+		{"nonce", signIDToken(t, key, "test", googleClaims(jwt.MapClaims{"nonce": "replayed"})), ErrIDTokenNonce},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := p.GetUserInfoFromIDToken(ctx, tt.token, "nonce-1")
+			if !errors.Is(err, tt.want) {
+				t.Errorf("GetUserInfoFromIDToken() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
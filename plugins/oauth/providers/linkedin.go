@@ -0,0 +1,207 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type LinkedInProvider struct {
+	clientID     string
+	clientSecret string
+	scopes       []string
+	httpClient   *http.Client
+}
+
+type LinkedInOptions struct {
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+func NewLinkedIn(opts *LinkedInOptions) *LinkedInProvider {
+	if opts == nil {
+		opts = &LinkedInOptions{}
+	}
+
+	scopes := opts.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "profile", "email"}
+	}
+
+	return &LinkedInProvider{
+		clientID:     opts.ClientID,
+		clientSecret: opts.ClientSecret,
+		scopes:       scopes,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *LinkedInProvider) ID() string {
+	return "linkedin"
+}
+
+func (p *LinkedInProvider) Name() string {
+	return "LinkedIn"
+}
+
+func (p *LinkedInProvider) Init() error {
+	if p.clientID == "" || p.clientSecret == "" {
+		return fmt.Errorf("linkedin client ID and secret are required")
+	}
+	return nil
+}
+
+func (p *LinkedInProvider) CreateAuthorizationURL(state, redirectURI string, options *AuthOptions) (*url.URL, error) {
+	authURL, _ := url.Parse("https://www.linkedin.com/oauth/v2/authorization")
+
+	q := authURL.Query()
+	q.Set("client_id", p.clientID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("response_type", "code")
+	q.Set("state", state)
+
+	scopes := p.scopes
+	if options != nil && len(options.Scopes) > 0 {
+		scopes = options.Scopes
+	}
+	q.Set("scope", strings.Join(scopes, " "))
+
+	if options != nil && options.Nonce != "" {
+		q.Set("nonce", options.Nonce)
+	}
+
+	if options != nil && len(options.ExtraParams) > 0 {
+		for k, v := range options.ExtraParams {
+			q.Set(k, v)
+		}
+	}
+
+	authURL.RawQuery = q.Encode()
+	return authURL, nil
+}
+
+func (p *LinkedInProvider) ExchangeCode(ctx context.Context, code, codeVerifier, redirectURI string) (*OAuthTokens, error) {
+	data := url.Values{}
+	data.Set("client_id", p.clientID)
+	data.Set("client_secret", p.clientSecret)
+	data.Set("code", code)
+	data.Set("redirect_uri", redirectURI)
+	data.Set("grant_type", "authorization_code")
+
+	return p.requestTokens(ctx, data, "exchange")
+}
+
+// RefreshToken works for apps LinkedIn has enabled refresh tokens for
+func (p *LinkedInProvider) RefreshToken(ctx context.Context, refreshToken string) (*OAuthTokens, error) {
+	data := url.Values{}
+	data.Set("client_id", p.clientID)
+	data.Set("client_secret", p.clientSecret)
+	data.Set("refresh_token", refreshToken)
+	data.Set("grant_type", "refresh_token")
+
+	return p.requestTokens(ctx, data, "refresh")
+}
+
+// requestTokens posts to LinkedIn's token endpoint
+func (p *LinkedInProvider) requestTokens(ctx context.Context, data url.Values, action string) (*OAuthTokens, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://www.linkedin.com/oauth/v2/accessToken", strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to %s token (status %d): %s", action, resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+		IDToken      string `json:"id_token"`
+		Scope        string `json:"scope"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	if result.AccessToken == "" {
+		return nil, fmt.Errorf("empty access token received")
+	}
+
+	var expiresAt *time.Time
+	if result.ExpiresIn > 0 {
+		t := time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+		expiresAt = &t
+	}
+
+	return &OAuthTokens{
+		AccessToken:  result.AccessToken,
+		RefreshToken: result.RefreshToken,
+		TokenType:    "Bearer",
+		ExpiresAt:    expiresAt,
+		IDToken:      result.IDToken,
+	}, nil
+}
+
+// GetUserInfo reads the OpenID Connect userinfo endpoint. It needs the
+// openid, profile and email scopes.
+func (p *LinkedInProvider) GetUserInfo(ctx context.Context, accessToken string) (*OAuthUserInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://api.linkedin.com/v2/userinfo", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get user info: status %d", resp.StatusCode)
+	}
+
+	var userMap map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&userMap); err != nil {
+		return nil, err
+	}
+
+	sub, _ := userMap["sub"].(string)
+	email, _ := userMap["email"].(string)
+	emailVerified, _ := userMap["email_verified"].(bool)
+	name, _ := userMap["name"].(string)
+	givenName, _ := userMap["given_name"].(string)
+	familyName, _ := userMap["family_name"].(string)
+	picture, _ := userMap["picture"].(string)
+
+	if name == "" {
+		name = strings.TrimSpace(givenName + " " + familyName)
+	}
+
+	return &OAuthUserInfo{
+		ID:            sub,
+		Email:         email,
+		EmailVerified: emailVerified,
+		Name:          name,
+		FirstName:     givenName,
+		LastName:      familyName,
+		Picture:       picture,
+		RawData:       userMap,
+	}, nil
+}
@@ -0,0 +1,397 @@
+package providers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Microsoft tenants that accept accounts from more than one directory
+const (
+	// MicrosoftTenantCommon accepts work, school and personal accounts
+	MicrosoftTenantCommon = "common"
+
+	// MicrosoftTenantOrganizations accepts work and school accounts
+	MicrosoftTenantOrganizations = "organizations"
+
+	// MicrosoftTenantConsumers accepts personal Microsoft accounts
+	MicrosoftTenantConsumers = "consumers"
+)
+
+const (
+	microsoftAuthority = "https://login.microsoftonline.com"
+
+	// microsoftConsumersTenantID is the directory of personal accounts
+	microsoftConsumersTenantID = "9188040d-6c67-4c5b-b112-36a304b66dad"
+
+	// microsoftKeysTTL is how long the tenant's signing keys are cached
+	microsoftKeysTTL = 24 * time.Hour
+)
+
+var tenantIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+type MicrosoftProvider struct {
+	clientID     string
+	clientSecret string
+	tenantID     string
+	scopes       []string
+	prompt       string
+	clockSkew    time.Duration
+	httpClient   *http.Client
+	keys         *jwksCache
+}
+
+type MicrosoftOptions struct {
+	ClientID     string
+	ClientSecret string
+
+	// TenantID is the directory users sign in to: a tenant ID or domain,
+	// or MicrosoftTenantCommon (default), MicrosoftTenantOrganizations or
+	// MicrosoftTenantConsumers
+	TenantID string
+
+	Scopes []string
+	Prompt string // "login", "consent", "select_account" or "none"
+
+	// ClockSkew is the tolerance for the ID token's exp, nbf and iat
+	// claims. Defaults to DefaultClockSkew.
+	ClockSkew time.Duration
+}
+
+func NewMicrosoft(opts *MicrosoftOptions) *MicrosoftProvider {
+	if opts == nil {
+		opts = &MicrosoftOptions{}
+	}
+
+	tenantID := opts.TenantID
+	if tenantID == "" {
+		tenantID = MicrosoftTenantCommon
+	}
+
+	scopes := opts.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile", "User.Read"}
+	}
+
+	clockSkew := opts.ClockSkew
+	if clockSkew == 0 {
+		clockSkew = DefaultClockSkew
+	}
+
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+
+	return &MicrosoftProvider{
+		clientID:     opts.ClientID,
+		clientSecret: opts.ClientSecret,
+		tenantID:     tenantID,
+		scopes:       scopes,
+		prompt:       opts.Prompt,
+		clockSkew:    clockSkew,
+		httpClient:   httpClient,
+		keys:         newJWKSCache(microsoftAuthority+"/"+tenantID+"/discovery/v2.0/keys", httpClient, microsoftKeysTTL),
+	}
+}
+
+func (p *MicrosoftProvider) ID() string {
+	return "microsoft"
+}
+
+func (p *MicrosoftProvider) Name() string {
+	return "Microsoft"
+}
+
+func (p *MicrosoftProvider) Init() error {
+	if p.clientID == "" || p.clientSecret == "" {
+		return fmt.Errorf("microsoft client ID and secret are required")
+	}
+	return nil
+}
+
+// endpoint returns a URL of the tenant's v2.0 OAuth endpoints
+func (p *MicrosoftProvider) endpoint(name string) string {
+	return microsoftAuthority + "/" + p.tenantID + "/oauth2/v2.0/" + name
+}
+
+func (p *MicrosoftProvider) CreateAuthorizationURL(state, redirectURI string, options *AuthOptions) (*url.URL, error) {
+	authURL, _ := url.Parse(p.endpoint("authorize"))
+
+	q := authURL.Query()
+	q.Set("client_id", p.clientID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("response_type", "code")
+	q.Set("response_mode", "query")
+	q.Set("state", state)
+
+	scopes := p.scopes
+	if options != nil && len(options.Scopes) > 0 {
+		scopes = options.Scopes
+	}
+	q.Set("scope", strings.Join(scopes, " "))
+
+	if p.prompt != "" {
+		q.Set("prompt", p.prompt)
+	}
+
+	// PKCE
+	if options != nil && options.CodeVerifier != "" {
+		q.Set("code_challenge", CodeChallenge(options.CodeVerifier))
+		q.Set("code_challenge_method", "S256")
+	}
+	if options != nil && options.Nonce != "" {
+		q.Set("nonce", options.Nonce)
+	}
+
+	if options != nil && len(options.ExtraParams) > 0 {
+		for k, v := range options.ExtraParams {
+			q.Set(k, v)
+		}
+	}
+
+	authURL.RawQuery = q.Encode()
+	return authURL, nil
+}
+
+func (p *MicrosoftProvider) ExchangeCode(ctx context.Context, code, codeVerifier, redirectURI string) (*OAuthTokens, error) {
+	data := url.Values{}
+	data.Set("client_id", p.clientID)
+	data.Set("client_secret", p.clientSecret)
+	data.Set("code", code)
+	data.Set("redirect_uri", redirectURI)
+	data.Set("grant_type", "authorization_code")
+
+	if codeVerifier != "" {
+		data.Set("code_verifier", codeVerifier)
+	}
+
+	return p.requestTokens(ctx, data, "exchange")
+}
+
+func (p *MicrosoftProvider) RefreshToken(ctx context.Context, refreshToken string) (*OAuthTokens, error) {
+	data := url.Values{}
+	data.Set("client_id", p.clientID)
+	data.Set("client_secret", p.clientSecret)
+	data.Set("refresh_token", refreshToken)
+	data.Set("grant_type", "refresh_token")
+
+	return p.requestTokens(ctx, data, "refresh")
+}
+
+// requestTokens posts to the tenant's token endpoint
+func (p *MicrosoftProvider) requestTokens(ctx context.Context, data url.Values, action string) (*OAuthTokens, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", p.endpoint("token"), strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to %s token (status %d): %s", action, resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		IDToken      string `json:"id_token"`
+		Scope        string `json:"scope"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	if result.AccessToken == "" {
+		return nil, fmt.Errorf("empty access token received")
+	}
+
+	var expiresAt *time.Time
+	if result.ExpiresIn > 0 {
+		t := time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+		expiresAt = &t
+	}
+
+	return &OAuthTokens{
+		AccessToken:  result.AccessToken,
+		RefreshToken: result.RefreshToken,
+		TokenType:    result.TokenType,
+		ExpiresAt:    expiresAt,
+		IDToken:      result.IDToken,
+	}, nil
+}
+
+// GetUserInfo reads the user's profile from Microsoft Graph. It needs the
+// User.Read scope. Directory administrators can set mail to any address,
+// so EmailVerified is always false.
+func (p *MicrosoftProvider) GetUserInfo(ctx context.Context, accessToken string) (*OAuthUserInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://graph.microsoft.com/v1.0/me", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get user info: status %d", resp.StatusCode)
+	}
+
+	var profile struct {
+		ID                string `json:"id"`
+		DisplayName       string `json:"displayName"`
+		GivenName         string `json:"givenName"`
+		Surname           string `json:"surname"`
+		Mail              string `json:"mail"`
+		UserPrincipalName string `json:"userPrincipalName"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
+		return nil, err
+	}
+
+	// Accounts without a mailbox only have their sign-in name
+	email := profile.Mail
+	if email == "" && strings.Contains(profile.UserPrincipalName, "@") {
+		email = profile.UserPrincipalName
+	}
+
+	rawData := map[string]interface{}{
+		"id":                profile.ID,
+		"displayName":       profile.DisplayName,
+		"givenName":         profile.GivenName,
+		"surname":           profile.Surname,
+		"mail":              profile.Mail,
+		"userPrincipalName": profile.UserPrincipalName,
+	}
+
+	return &OAuthUserInfo{
+		ID:        profile.ID,
+		Email:     email,
+		Name:      profile.DisplayName,
+		FirstName: profile.GivenName,
+		LastName:  profile.Surname,
+		RawData:   rawData,
+	}, nil
+}
+
+// GetUserInfoFromIDToken verifies a Microsoft ID token and extracts the
+// user info. The signature is checked against the tenant's published
+// keys, and the token must be issued for the client by a directory the
+// tenant accepts, unexpired and, when nonce is set, carry that nonce.
+// Errors wrap the ErrIDToken* errors.
+//
+// The user's ID is their object ID (oid), the same ID Graph returns.
+// The email is only marked verified for personal accounts and when
+// Microsoft reports the domain owner verified it (xms_edov).
+func (p *MicrosoftProvider) GetUserInfoFromIDToken(ctx context.Context, idToken, nonce string) (*OAuthUserInfo, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims,
+		func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			return p.keys.key(ctx, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithAudience(p.clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(p.clockSkew),
+	)
+	if err != nil {
+		return nil, idTokenError(err)
+	}
+
+	tid, _ := claims["tid"].(string)
+	if err := p.checkIssuer(tid, claims["iss"]); err != nil {
+		return nil, err
+	}
+
+	if nonce != "" {
+		if got, _ := claims["nonce"].(string); subtle.ConstantTimeCompare([]byte(got), []byte(nonce)) != 1 {
+			return nil, ErrIDTokenNonce
+		}
+	}
+
+	id, _ := claims["oid"].(string)
+	if id == "" {
+		id, _ = claims["sub"].(string)
+	}
+
+	email, _ := claims["email"].(string)
+	if email == "" {
+		if upn, _ := claims["preferred_username"].(string); strings.Contains(upn, "@") {
+			email = upn
+		}
+	}
+	edov, _ := claims["xms_edov"].(bool)
+
+	name, _ := claims["name"].(string)
+	givenName, _ := claims["given_name"].(string)
+	familyName, _ := claims["family_name"].(string)
+	if name == "" {
+		name = email
+	}
+
+	rawData := make(map[string]interface{}, len(claims))
+	for k, v := range claims {
+		rawData[k] = v
+	}
+
+	return &OAuthUserInfo{
+		ID:            id,
+		Email:         email,
+		EmailVerified: email != "" && (tid == microsoftConsumersTenantID || edov),
+		Name:          name,
+		FirstName:     givenName,
+		LastName:      familyName,
+		RawData:       rawData,
+	}, nil
+}
+
+// checkIssuer checks the token was issued by the directory in its tid
+// claim, and that the configured tenant accepts that directory
+func (p *MicrosoftProvider) checkIssuer(tid string, iss interface{}) error {
+	issuer, _ := iss.(string)
+	if tid == "" || issuer != microsoftAuthority+"/"+tid+"/v2.0" {
+		return fmt.Errorf("%w: %q", ErrIDTokenIssuer, issuer)
+	}
+
+	switch {
+	case strings.EqualFold(p.tenantID, MicrosoftTenantCommon):
+		return nil
+	case strings.EqualFold(p.tenantID, MicrosoftTenantOrganizations):
+		if tid == microsoftConsumersTenantID {
+			return fmt.Errorf("%w: personal accounts are not accepted", ErrIDTokenIssuer)
+		}
+	case strings.EqualFold(p.tenantID, MicrosoftTenantConsumers):
+		if tid != microsoftConsumersTenantID {
+			return fmt.Errorf("%w: only personal accounts are accepted", ErrIDTokenIssuer)
+		}
+	case tenantIDPattern.MatchString(p.tenantID):
+		if !strings.EqualFold(tid, p.tenantID) {
+			return fmt.Errorf("%w: tenant %q", ErrIDTokenIssuer, tid)
+		}
+	}
+	// A tenant configured by its domain name cannot be compared with tid;
+	// configure the tenant ID to pin the directory
+	return nil
+}
@@ -0,0 +1,127 @@
+package providers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testTenantID = "72f988bf-86f1-41af-91ab-2d7cd011db47"
+
+func microsoftClaims(tid string, overrides jwt.MapClaims) jwt.MapClaims {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":                microsoftAuthority + "/" + tid + "/v2.0",
+		"aud":                "client-id",
+		"tid":                tid,
+		"oid":                "00000000-0000-0000-0000-000000000001",
+		"sub":                "pairwise-subject",
+		"email":              "user@example.com",
+		"preferred_username": "user@example.com",
+		"name":               "Test User",
+		"nonce":              "nonce-1",
+		"iat":                now.Unix(),
+		"nbf":                now.Unix(),
+		"exp":                now.Add(time.Hour).Unix(),
+	}
+	for k, v := range overrides {
+		if v == nil {
+			delete(claims, k)
+			continue
+		}
+		claims[k] = v
+	}
+	return claims
+}
+
+func TestMicrosoftGetUserInfoFromIDToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	server := testJWKSServer(t, key)
+	ctx := context.Background()
+
+	newProvider := func(tenant string) *MicrosoftProvider {
+		p := NewMicrosoft(&MicrosoftOptions{ClientID: "client-id", ClientSecret: "secret", TenantID: tenant})
+		p.keys = newJWKSCache(server.URL, server.Client(), time.Hour)
+		return p
+	}
+
+	info, err := newProvider("").GetUserInfoFromIDToken(ctx, signIDToken(t, key, "test", microsoftClaims(testTenantID, nil)), "nonce-1")
+	if err != nil {
+		t.Fatalf("GetUserInfoFromIDToken() error = %v", err)
+	}
+	if info.ID != "00000000-0000-0000-0000-000000000001" || info.Email != "user@example.com" || info.Name != "Test User" {
+		t.Errorf("GetUserInfoFromIDToken() = %+v", info)
+	}
+	// Work accounts' email addresses are set by the directory's admins
+	if info.EmailVerified {
+		t.Error("EmailVerified = true for an unverified directory email")
+	}
+
+	personal, err := newProvider("").GetUserInfoFromIDToken(ctx, signIDToken(t, key, "test", microsoftClaims(microsoftConsumersTenantID, nil)), "nonce-1")
+	if err != nil {
+		t.Fatalf("GetUserInfoFromIDToken() error = %v", err)
+	}
+	if !personal.EmailVerified {
+		t.Error("EmailVerified = false for a personal account")
+	}
+
+	tests := []struct {
+		name   string
+		tenant string
+		claims jwt.MapClaims
+		want   error
+	}{
+		{"common accepts work accounts", MicrosoftTenantCommon, microsoftClaims(testTenantID, nil), nil},
+		{"common accepts personal accounts", MicrosoftTenantCommon, microsoftClaims(microsoftConsumersTenantID, nil), nil},
+		{"organizations accepts work accounts", MicrosoftTenantOrganizations, microsoftClaims(testTenantID, nil), nil},
+		{"organizations rejects personal accounts", MicrosoftTenantOrganizations, microsoftClaims(microsoftConsumersTenantID, nil), ErrIDTokenIssuer},
+		{"consumers accepts personal accounts", MicrosoftTenantConsumers, microsoftClaims(microsoftConsumersTenantID, nil), nil},
+		{"consumers rejects work accounts", MicrosoftTenantConsumers, microsoftClaims(testTenantID, nil), ErrIDTokenIssuer},
+		{"tenant accepts its directory", testTenantID, microsoftClaims(testTenantID, nil), nil},
+		{"tenant rejects other directories", testTenantID, microsoftClaims("11111111-2222-3333-4444-555555555555", nil), ErrIDTokenIssuer},
+		{"issuer must match tid", MicrosoftTenantCommon, microsoftClaims(testTenantID, jwt.MapClaims{"iss": microsoftAuthority + "/11111111-2222-3333-4444-555555555555/v2.0"}), ErrIDTokenIssuer},
+		{"missing tid", MicrosoftTenantCommon, microsoftClaims(testTenantID, jwt.MapClaims{"tid": nil}), ErrIDTokenIssuer},
+		{"audience", MicrosoftTenantCommon, microsoftClaims(testTenantID, jwt.MapClaims{"aud": "other-client"}), ErrIDTokenAudience},
+		{"expired", MicrosoftTenantCommon, microsoftClaims(testTenantID, jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}), ErrIDTokenExpired},
+		{"not yet valid", MicrosoftTenantCommon, microsoftClaims(testTenantID, jwt.MapClaims{"nbf": time.Now().Add(time.Hour).Unix()}), ErrIDTokenExpired},
+		{"nonce", MicrosoftTenantCommon, microsoftClaims(testTenantID, jwt.MapClaims{"nonce": "replayed"}), ErrIDTokenNonce},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newProvider(tt.tenant).GetUserInfoFromIDToken(ctx, signIDToken(t, key, "test", tt.claims), "nonce-1")
+			if tt.want == nil && err != nil {
+				t.Errorf("GetUserInfoFromIDToken() error = %v", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("GetUserInfoFromIDToken() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMicrosoftCreateAuthorizationURL(t *testing.T) {
+	p := NewMicrosoft(&MicrosoftOptions{ClientID: "client-id", ClientSecret: "secret", TenantID: MicrosoftTenantOrganizations})
+
+	authURL, err := p.CreateAuthorizationURL("state", "https://app.example/callback", &AuthOptions{CodeVerifier: "verifier", Nonce: "nonce"})
+	if err != nil {
+		t.Fatalf("CreateAuthorizationURL() error = %v", err)
+	}
+	if authURL.Path != "/organizations/oauth2/v2.0/authorize" {
+		t.Errorf("path = %q, want the organizations tenant", authURL.Path)
+	}
+	q := authURL.Query()
+	if q.Get("code_challenge") != CodeChallenge("verifier") || q.Get("code_challenge_method") != "S256" {
+		t.Errorf("PKCE params = %q, %q", q.Get("code_challenge"), q.Get("code_challenge_method"))
+	}
+	if q.Get("nonce") != "nonce" || q.Get("scope") != "openid email profile User.Read" {
+		t.Errorf("query = %v", q)
+	}
+}
@@ -30,8 +30,13 @@ type OAuthProvider interface {
 
 // AuthOptions holds options for authorization URL
 type AuthOptions struct {
-	Scopes      []string
-	UsePKCE     bool
+	Scopes  []string
+	UsePKCE bool
+
+	// CodeVerifier is the PKCE verifier of the flow. Providers that support
+	// PKCE send its S256 challenge; pass the same verifier to ExchangeCode.
+	CodeVerifier string
+
 	Nonce       string
 	ExtraParams map[string]string
 }
@@ -0,0 +1,221 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SlackProvider implements "Sign in with Slack", Slack's OpenID Connect
+// flow
+type SlackProvider struct {
+	clientID     string
+	clientSecret string
+	teamID       string
+	scopes       []string
+	httpClient   *http.Client
+}
+
+type SlackOptions struct {
+	ClientID     string
+	ClientSecret string
+	TeamID       string // Optional workspace to sign in to, skipping the workspace picker
+	Scopes       []string
+}
+
+func NewSlack(opts *SlackOptions) *SlackProvider {
+	if opts == nil {
+		opts = &SlackOptions{}
+	}
+
+	scopes := opts.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+
+	return &SlackProvider{
+		clientID:     opts.ClientID,
+		clientSecret: opts.ClientSecret,
+		teamID:       opts.TeamID,
+		scopes:       scopes,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *SlackProvider) ID() string {
+	return "slack"
+}
+
+func (p *SlackProvider) Name() string {
+	return "Slack"
+}
+
+func (p *SlackProvider) Init() error {
+	if p.clientID == "" || p.clientSecret == "" {
+		return fmt.Errorf("slack client ID and secret are required")
+	}
+	return nil
+}
+
+func (p *SlackProvider) CreateAuthorizationURL(state, redirectURI string, options *AuthOptions) (*url.URL, error) {
+	authURL, _ := url.Parse("https://slack.com/openid/connect/authorize")
+
+	q := authURL.Query()
+	q.Set("client_id", p.clientID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("response_type", "code")
+	q.Set("state", state)
+
+	scopes := p.scopes
+	if options != nil && len(options.Scopes) > 0 {
+		scopes = options.Scopes
+	}
+	q.Set("scope", strings.Join(scopes, " "))
+
+	if p.teamID != "" {
+		q.Set("team", p.teamID)
+	}
+	if options != nil && options.Nonce != "" {
+		q.Set("nonce", options.Nonce)
+	}
+
+	if options != nil && len(options.ExtraParams) > 0 {
+		for k, v := range options.ExtraParams {
+			q.Set(k, v)
+		}
+	}
+
+	authURL.RawQuery = q.Encode()
+	return authURL, nil
+}
+
+func (p *SlackProvider) ExchangeCode(ctx context.Context, code, codeVerifier, redirectURI string) (*OAuthTokens, error) {
+	data := url.Values{}
+	data.Set("client_id", p.clientID)
+	data.Set("client_secret", p.clientSecret)
+	data.Set("code", code)
+	data.Set("redirect_uri", redirectURI)
+	data.Set("grant_type", "authorization_code")
+
+	return p.requestTokens(ctx, data, "exchange")
+}
+
+// RefreshToken works for apps with token rotation enabled
+func (p *SlackProvider) RefreshToken(ctx context.Context, refreshToken string) (*OAuthTokens, error) {
+	data := url.Values{}
+	data.Set("client_id", p.clientID)
+	data.Set("client_secret", p.clientSecret)
+	data.Set("refresh_token", refreshToken)
+	data.Set("grant_type", "refresh_token")
+
+	return p.requestTokens(ctx, data, "refresh")
+}
+
+// requestTokens posts to Slack's OpenID Connect token method
+func (p *SlackProvider) requestTokens(ctx context.Context, data url.Values, action string) (*OAuthTokens, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://slack.com/api/openid.connect.token", strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var result struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		IDToken      string `json:"id_token"`
+	}
+	if err := p.do(req, &result); err != nil {
+		return nil, fmt.Errorf("failed to %s token: %w", action, err)
+	}
+
+	if result.AccessToken == "" {
+		return nil, fmt.Errorf("empty access token received")
+	}
+
+	var expiresAt *time.Time
+	if result.ExpiresIn > 0 {
+		t := time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+		expiresAt = &t
+	}
+
+	return &OAuthTokens{
+		AccessToken:  result.AccessToken,
+		RefreshToken: result.RefreshToken,
+		TokenType:    result.TokenType,
+		ExpiresAt:    expiresAt,
+		IDToken:      result.IDToken,
+	}, nil
+}
+
+func (p *SlackProvider) GetUserInfo(ctx context.Context, accessToken string) (*OAuthUserInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://slack.com/api/openid.connect.userInfo", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	var userMap map[string]interface{}
+	if err := p.do(req, &userMap); err != nil {
+		return nil, fmt.Errorf("failed to get user info: %w", err)
+	}
+
+	sub, _ := userMap["sub"].(string)
+	email, _ := userMap["email"].(string)
+	emailVerified, _ := userMap["email_verified"].(bool)
+	name, _ := userMap["name"].(string)
+	givenName, _ := userMap["given_name"].(string)
+	familyName, _ := userMap["family_name"].(string)
+	picture, _ := userMap["picture"].(string)
+
+	return &OAuthUserInfo{
+		ID:            sub,
+		Email:         email,
+		EmailVerified: emailVerified,
+		Name:          name,
+		FirstName:     givenName,
+		LastName:      familyName,
+		Picture:       picture,
+		RawData:       userMap,
+	}, nil
+}
+
+// slackResponse is the envelope of Slack Web API responses
+type slackResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+// do sends a Slack Web API request. Slack answers failed calls with
+// status 200 and "ok": false, so the envelope is checked as well.
+func (p *SlackProvider) do(req *http.Request, v interface{}) error {
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return err
+	}
+
+	var envelope slackResponse
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return err
+	}
+	if !envelope.OK {
+		return fmt.Errorf("slack error: %s", envelope.Error)
+	}
+
+	return json.Unmarshal(raw, v)
+}
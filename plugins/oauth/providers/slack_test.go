@@ -0,0 +1,37 @@
+package providers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSlackDo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Slack reports failures with status 200
+		if r.URL.Path == "/fail" {
+			_, _ = w.Write([]byte(`{"ok": false, "error": "invalid_code"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok": true, "sub": "U123", "email": "user@example.com"}`))
+	}))
+	defer server.Close()
+
+	p := NewSlack(&SlackOptions{ClientID: "client", ClientSecret: "secret"})
+
+	req, _ := http.NewRequest("GET", server.URL+"/fail", nil)
+	var failed map[string]interface{}
+	if err := p.do(req, &failed); err == nil || !strings.Contains(err.Error(), "invalid_code") {
+		t.Errorf("do() error = %v, want the Slack error", err)
+	}
+
+	req, _ = http.NewRequest("GET", server.URL+"/ok", nil)
+	var user map[string]interface{}
+	if err := p.do(req, &user); err != nil {
+		t.Fatalf("do() error = %v", err)
+	}
+	if user["sub"] != "U123" {
+		t.Errorf("do() decoded %v", user)
+	}
+}
@@ -0,0 +1,216 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type SpotifyProvider struct {
+	clientID     string
+	clientSecret string
+	scopes       []string
+	httpClient   *http.Client
+}
+
+type SpotifyOptions struct {
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+func NewSpotify(opts *SpotifyOptions) *SpotifyProvider {
+	if opts == nil {
+		opts = &SpotifyOptions{}
+	}
+
+	scopes := opts.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"user-read-email"}
+	}
+
+	return &SpotifyProvider{
+		clientID:     opts.ClientID,
+		clientSecret: opts.ClientSecret,
+		scopes:       scopes,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *SpotifyProvider) ID() string {
+	return "spotify"
+}
+
+func (p *SpotifyProvider) Name() string {
+	return "Spotify"
+}
+
+func (p *SpotifyProvider) Init() error {
+	if p.clientID == "" || p.clientSecret == "" {
+		return fmt.Errorf("spotify client ID and secret are required")
+	}
+	return nil
+}
+
+func (p *SpotifyProvider) CreateAuthorizationURL(state, redirectURI string, options *AuthOptions) (*url.URL, error) {
+	authURL, _ := url.Parse("https://accounts.spotify.com/authorize")
+
+	q := authURL.Query()
+	q.Set("client_id", p.clientID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("response_type", "code")
+	q.Set("state", state)
+
+	scopes := p.scopes
+	if options != nil && len(options.Scopes) > 0 {
+		scopes = options.Scopes
+	}
+	q.Set("scope", strings.Join(scopes, " "))
+
+	// PKCE
+	if options != nil && options.CodeVerifier != "" {
+		q.Set("code_challenge", CodeChallenge(options.CodeVerifier))
+		q.Set("code_challenge_method", "S256")
+	}
+
+	if options != nil && len(options.ExtraParams) > 0 {
+		for k, v := range options.ExtraParams {
+			q.Set(k, v)
+		}
+	}
+
+	authURL.RawQuery = q.Encode()
+	return authURL, nil
+}
+
+func (p *SpotifyProvider) ExchangeCode(ctx context.Context, code, codeVerifier, redirectURI string) (*OAuthTokens, error) {
+	data := url.Values{}
+	data.Set("code", code)
+	data.Set("redirect_uri", redirectURI)
+	data.Set("grant_type", "authorization_code")
+
+	if codeVerifier != "" {
+		data.Set("code_verifier", codeVerifier)
+	}
+
+	return p.requestTokens(ctx, data, "exchange")
+}
+
+func (p *SpotifyProvider) RefreshToken(ctx context.Context, refreshToken string) (*OAuthTokens, error) {
+	data := url.Values{}
+	data.Set("refresh_token", refreshToken)
+	data.Set("grant_type", "refresh_token")
+
+	tokens, err := p.requestTokens(ctx, data, "refresh")
+	if err != nil {
+		return nil, err
+	}
+	// Spotify only returns a refresh token when it rotates it
+	if tokens.RefreshToken == "" {
+		tokens.RefreshToken = refreshToken
+	}
+	return tokens, nil
+}
+
+// requestTokens posts to Spotify's token endpoint, authenticating with
+// HTTP Basic auth
+func (p *SpotifyProvider) requestTokens(ctx context.Context, data url.Values, action string) (*OAuthTokens, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://accounts.spotify.com/api/token", strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(p.clientID, p.clientSecret)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to %s token (status %d): %s", action, resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	if result.AccessToken == "" {
+		return nil, fmt.Errorf("empty access token received")
+	}
+
+	var expiresAt *time.Time
+	if result.ExpiresIn > 0 {
+		t := time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+		expiresAt = &t
+	}
+
+	return &OAuthTokens{
+		AccessToken:  result.AccessToken,
+		RefreshToken: result.RefreshToken,
+		TokenType:    result.TokenType,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+// GetUserInfo reads the user's profile. Spotify does not verify email
+// addresses, so EmailVerified is always false.
+func (p *SpotifyProvider) GetUserInfo(ctx context.Context, accessToken string) (*OAuthUserInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://api.spotify.com/v1/me", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get user info: status %d", resp.StatusCode)
+	}
+
+	var userMap map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&userMap); err != nil {
+		return nil, err
+	}
+
+	id, _ := userMap["id"].(string)
+	email, _ := userMap["email"].(string)
+	name, _ := userMap["display_name"].(string)
+	if name == "" {
+		name = id
+	}
+
+	// images are listed largest first
+	var picture string
+	if images, ok := userMap["images"].([]interface{}); ok && len(images) > 0 {
+		if image, ok := images[0].(map[string]interface{}); ok {
+			picture, _ = image["url"].(string)
+		}
+	}
+
+	return &OAuthUserInfo{
+		ID:      id,
+		Email:   email,
+		Name:    name,
+		Picture: picture,
+		RawData: userMap,
+	}, nil
+}
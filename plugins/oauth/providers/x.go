@@ -0,0 +1,214 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// XProvider signs users in with X (formerly Twitter) using OAuth 2.0
+// with PKCE
+type XProvider struct {
+	clientID     string
+	clientSecret string
+	scopes       []string
+	httpClient   *http.Client
+}
+
+type XOptions struct {
+	ClientID     string
+	ClientSecret string
+	Scopes       []string // Add "users.email" to receive the confirmed email
+}
+
+func NewX(opts *XOptions) *XProvider {
+	if opts == nil {
+		opts = &XOptions{}
+	}
+
+	scopes := opts.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"users.read", "tweet.read", "offline.access"}
+	}
+
+	return &XProvider{
+		clientID:     opts.ClientID,
+		clientSecret: opts.ClientSecret,
+		scopes:       scopes,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *XProvider) ID() string {
+	return "x"
+}
+
+func (p *XProvider) Name() string {
+	return "X"
+}
+
+func (p *XProvider) Init() error {
+	if p.clientID == "" || p.clientSecret == "" {
+		return fmt.Errorf("x client ID and secret are required")
+	}
+	return nil
+}
+
+func (p *XProvider) CreateAuthorizationURL(state, redirectURI string, options *AuthOptions) (*url.URL, error) {
+	// X rejects authorization requests without PKCE
+	if options == nil || options.CodeVerifier == "" {
+		return nil, fmt.Errorf("x requires a PKCE code verifier")
+	}
+
+	authURL, _ := url.Parse("https://x.com/i/oauth2/authorize")
+
+	q := authURL.Query()
+	q.Set("client_id", p.clientID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("response_type", "code")
+	q.Set("state", state)
+	q.Set("code_challenge", CodeChallenge(options.CodeVerifier))
+	q.Set("code_challenge_method", "S256")
+
+	scopes := p.scopes
+	if len(options.Scopes) > 0 {
+		scopes = options.Scopes
+	}
+	q.Set("scope", strings.Join(scopes, " "))
+
+	if len(options.ExtraParams) > 0 {
+		for k, v := range options.ExtraParams {
+			q.Set(k, v)
+		}
+	}
+
+	authURL.RawQuery = q.Encode()
+	return authURL, nil
+}
+
+func (p *XProvider) ExchangeCode(ctx context.Context, code, codeVerifier, redirectURI string) (*OAuthTokens, error) {
+	data := url.Values{}
+	data.Set("code", code)
+	data.Set("redirect_uri", redirectURI)
+	data.Set("grant_type", "authorization_code")
+	data.Set("code_verifier", codeVerifier)
+
+	return p.requestTokens(ctx, data, "exchange")
+}
+
+func (p *XProvider) RefreshToken(ctx context.Context, refreshToken string) (*OAuthTokens, error) {
+	data := url.Values{}
+	data.Set("refresh_token", refreshToken)
+	data.Set("grant_type", "refresh_token")
+
+	return p.requestTokens(ctx, data, "refresh")
+}
+
+// requestTokens posts to X's token endpoint, authenticating as a
+// confidential client with HTTP Basic auth
+func (p *XProvider) requestTokens(ctx context.Context, data url.Values, action string) (*OAuthTokens, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.x.com/2/oauth2/token", strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to %s token (status %d): %s", action, resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		Scope        string `json:"scope"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	if result.AccessToken == "" {
+		return nil, fmt.Errorf("empty access token received")
+	}
+
+	var expiresAt *time.Time
+	if result.ExpiresIn > 0 {
+		t := time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+		expiresAt = &t
+	}
+
+	return &OAuthTokens{
+		AccessToken:  result.AccessToken,
+		RefreshToken: result.RefreshToken,
+		TokenType:    result.TokenType,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+// GetUserInfo reads the user from the X API. The email is only returned
+// when the users.email scope was granted.
+func (p *XProvider) GetUserInfo(ctx context.Context, accessToken string) (*OAuthUserInfo, error) {
+	fields := "id,name,username,profile_image_url"
+	if slices.Contains(p.scopes, "users.email") {
+		fields += ",confirmed_email"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://api.x.com/2/users/me?user.fields="+fields, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get user info: status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	userMap := result.Data
+
+	id, _ := userMap["id"].(string)
+	name, _ := userMap["name"].(string)
+	username, _ := userMap["username"].(string)
+	picture, _ := userMap["profile_image_url"].(string)
+	email, _ := userMap["confirmed_email"].(string)
+
+	if name == "" {
+		name = username
+	}
+
+	return &OAuthUserInfo{
+		ID:            id,
+		Email:         email,
+		EmailVerified: email != "",
+		Name:          name,
+		Picture:       picture,
+		RawData:       userMap,
+	}, nil
+}
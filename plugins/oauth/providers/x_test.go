@@ -0,0 +1,23 @@
+package providers
+
+import "testing"
+
+func TestXCreateAuthorizationURL(t *testing.T) {
+	p := NewX(&XOptions{ClientID: "client", ClientSecret: "secret"})
+
+	if _, err := p.CreateAuthorizationURL("state", "https://app.example/callback", nil); err == nil {
+		t.Error("CreateAuthorizationURL() without a code verifier succeeded, want error")
+	}
+
+	authURL, err := p.CreateAuthorizationURL("state", "https://app.example/callback", &AuthOptions{CodeVerifier: "verifier"})
+	if err != nil {
+		t.Fatalf("CreateAuthorizationURL() error = %v", err)
+	}
+	q := authURL.Query()
+	if q.Get("code_challenge") != CodeChallenge("verifier") || q.Get("code_challenge_method") != "S256" {
+		t.Errorf("PKCE params = %q, %q", q.Get("code_challenge"), q.Get("code_challenge_method"))
+	}
+	if q.Get("scope") != "users.read tweet.read offline.access" {
+		t.Errorf("scope = %q", q.Get("scope"))
+	}
+}
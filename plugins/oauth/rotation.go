@@ -0,0 +1,87 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/marshallshelly/beacon-auth/plugins/oauth/providers"
+)
+
+// rotatingProvider is built from a client secret in AuthContext.Secrets
+type rotatingProvider struct {
+	secret string
+	build  func(clientSecret string) providers.OAuthProvider
+}
+
+// WithRotatingProvider registers a provider whose client secret is kept in
+// a secret manager (see beaconauth.WithSecretProvider). At Init, build
+// creates the provider with the secret named secret; whenever the secret
+// rotates, build creates it again and the new provider replaces the old
+// one. Flows started before the rotation finish with the new secret.
+//
+//	oauth.New().WithRotatingProvider("beacon/oauth#github", func(secret string) providers.OAuthProvider {
+//		return providers.NewGitHub(clientID, secret, nil)
+//	})
+func (p *OAuthPlugin) WithRotatingProvider(secret string, build func(clientSecret string) providers.OAuthProvider) *OAuthPlugin {
+	p.rotating = append(p.rotating, rotatingProvider{secret: secret, build: build})
+	return p
+}
+
+// initRotatingProviders fetches the client secrets of the rotating
+// providers, registers the providers and watches the secrets
+func (p *OAuthPlugin) initRotatingProviders() error {
+	if len(p.rotating) == 0 {
+		return nil
+	}
+	if p.ctx.Secrets == nil {
+		return errors.New("oauth: rotating providers need a secret provider (use WithSecretProvider)")
+	}
+
+	for _, rp := range p.rotating {
+		rp := rp
+		var id string
+		clientSecret, err := p.ctx.Secrets.Watch(context.Background(), rp.secret, func(clientSecret string) {
+			p.replaceProvider(id, rp.build(clientSecret))
+		})
+		if err != nil {
+			return fmt.Errorf("oauth: %w", err)
+		}
+
+		prov := rp.build(clientSecret)
+		id = prov.ID()
+		if !providerIDPattern.MatchString(id) {
+			return fmt.Errorf("oauth: invalid provider ID %q: use up to 32 lowercase letters, digits, '-' and '_'", id)
+		}
+		if _, exists := p.providers[id]; exists {
+			return fmt.Errorf("oauth: provider %q already registered", id)
+		}
+		p.providers[id] = prov
+	}
+	return nil
+}
+
+// replaceProvider swaps in a provider built with a rotated client secret.
+// A provider that fails to initialize is logged and the previous one kept.
+func (p *OAuthPlugin) replaceProvider(id string, prov providers.OAuthProvider) {
+	if prov.ID() != id {
+		p.ctx.Logger.Error("Rotated OAuth provider %q changed its ID to %q; keeping the previous provider", id, prov.ID())
+		return
+	}
+	if err := prov.Init(); err != nil {
+		p.ctx.Logger.Error("Failed to initialize rotated OAuth provider %q; keeping the previous provider: %v", id, err)
+		return
+	}
+
+	p.providersMu.Lock()
+	p.providers[id] = prov
+	p.providersMu.Unlock()
+	p.ctx.Logger.Info("OAuth provider %q client secret rotated", id)
+}
+
+// provider returns the current provider with ID id
+func (p *OAuthPlugin) provider(id string) providers.OAuthProvider {
+	p.providersMu.RLock()
+	defer p.providersMu.RUnlock()
+	return p.providers[id]
+}
@@ -0,0 +1,71 @@
+package oauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	beaconauth "github.com/marshallshelly/beacon-auth"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/plugins/oauth"
+	"github.com/marshallshelly/beacon-auth/plugins/oauth/providers"
+)
+
+// rotatingSecrets serves one client secret that the test rotates
+type rotatingSecrets struct {
+	mu     sync.Mutex
+	secret string
+}
+
+func (s *rotatingSecrets) GetSecret(ctx context.Context, name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if name != "oauth#github" {
+		return "", core.ErrSecretNotFound
+	}
+	return s.secret, nil
+}
+
+func TestRotatingProvider(t *testing.T) {
+	secrets := &rotatingSecrets{secret: "first"}
+	var built []string
+	p := oauth.New().WithRotatingProvider("oauth#github", func(clientSecret string) providers.OAuthProvider {
+		built = append(built, clientSecret)
+		return providers.NewGitHub("client-id", clientSecret, nil)
+	})
+
+	// Rotating providers need a secret provider
+	if _, err := newTestAuth(t, oauth.New().WithRotatingProvider("oauth#github", func(string) providers.OAuthProvider {
+		return providers.NewGitHub("client-id", "unused", nil)
+	})); err == nil {
+		t.Fatal("New() without a secret provider succeeded")
+	}
+
+	auth, err := newTestAuth(t, p, beaconauth.WithSecretProvider(secrets, ""))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	login := func() int {
+		rec := httptest.NewRecorder()
+		auth.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/oauth/github/login", nil))
+		return rec.Code
+	}
+	if code := login(); code != http.StatusTemporaryRedirect {
+		t.Fatalf("login = %d, want 307", code)
+	}
+
+	secrets.mu.Lock()
+	secrets.secret = "second"
+	secrets.mu.Unlock()
+	if err := auth.Context().Secrets.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if len(built) != 2 || built[1] != "second" {
+		t.Errorf("providers built with %q, want a rebuild with the rotated secret", built)
+	}
+	if code := login(); code != http.StatusTemporaryRedirect {
+		t.Errorf("login after rotation = %d, want 307", code)
+	}
+}
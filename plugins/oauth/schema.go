@@ -0,0 +1,19 @@
+package oauth
+
+import "github.com/marshallshelly/beacon-auth/core"
+
+// Schema returns the table of OAuth states
+func (p *OAuthPlugin) Schema() []core.TableDef {
+	return []core.TableDef{
+		{
+			Model: TableOAuthStates,
+			Columns: []core.ColumnDef{
+				{Name: "id", Type: core.ColumnID},
+				{Name: "state_hash", Type: core.ColumnString, Size: 64, NotNull: true, Unique: true},
+				{Name: "payload", Type: core.ColumnText, NotNull: true},
+				{Name: "expires_at", Type: core.ColumnTimestamp, NotNull: true},
+				{Name: "created_at", Type: core.ColumnTimestamp, Default: core.DefaultNow},
+			},
+		},
+	}
+}
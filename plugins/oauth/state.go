@@ -0,0 +1,235 @@
+package oauth
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/crypto"
+	"github.com/marshallshelly/beacon-auth/repo"
+	"github.com/marshallshelly/beacon-auth/tokens"
+	"github.com/redis/go-redis/v9"
+)
+
+// StateTTL is how long a user has to complete the provider's consent screen
+const StateTTL = 10 * time.Minute
+
+// TableOAuthStates is the default name of the table of OAuth states
+const TableOAuthStates = "oauth_states"
+
+// State is what the login endpoint remembers for the callback
+type State struct {
+	// State is the value of the state parameter. It identifies the flow.
+	State string `json:"-"`
+
+	// ProviderID is the provider the flow was started for
+	ProviderID string `json:"providerId"`
+
+	// CodeVerifier is the PKCE verifier sent with the code exchange
+	CodeVerifier string `json:"codeVerifier,omitempty"`
+
+	// RedirectTo is where the callback sends the user after signing in
+	RedirectTo string `json:"redirectTo,omitempty"`
+
+	// Nonce is the nonce requested for the ID token
+	Nonce string `json:"nonce,omitempty"`
+
+	// ExpiresAt is when the flow can no longer be completed
+	ExpiresAt time.Time `json:"-"`
+}
+
+// StateStore keeps OAuth states between the login endpoint and the
+// callback
+type StateStore interface {
+	// Save stores a state until its ExpiresAt
+	Save(ctx context.Context, state *State) error
+
+	// Take returns the state and removes it, so each state completes at
+	// most one flow. It returns nil for unknown, used or expired states.
+	Take(ctx context.Context, state string) (*State, error)
+}
+
+// The built-in stores never keep the state parameter itself. A state is
+// looked up by its SHA-256 hash, and its fields are sealed with AES-GCM
+// under a key derived from the state, so the PKCE verifier and nonce of a
+// flow cannot be read from the store without the state of that flow.
+
+// stateKeyContext separates the sealing key of a state from its lookup
+// hash
+const stateKeyContext = "beacon-auth oauth state key\x00"
+
+// stateAEAD returns the cipher sealing the fields of state
+func stateAEAD(state string) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte(stateKeyContext + state))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealState returns the stored form of a state's fields
+func sealState(state *State) (string, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	aead, err := stateAEAD(state.State)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, data, nil)), nil
+}
+
+// openState returns the state whose fields were sealed into payload
+func openState(state, payload string, expiresAt time.Time) (*State, error) {
+	aead, err := stateAEAD(state)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, errors.New("invalid oauth state: malformed payload")
+	}
+	data, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid oauth state: %w", err)
+	}
+
+	opened := &State{State: state, ExpiresAt: expiresAt}
+	if err := json.Unmarshal(data, opened); err != nil {
+		return nil, fmt.Errorf("invalid oauth state: %w", err)
+	}
+	return opened, nil
+}
+
+// DatabaseStateStore keeps states in the oauth_states table. It is the
+// default store.
+type DatabaseStateStore struct {
+	adapter core.Adapter
+	table   string
+}
+
+// stateRecord is a row of the oauth_states table
+type stateRecord struct {
+	ID        string    `db:"id"`
+	StateHash string    `db:"state_hash"`
+	Payload   string    `db:"payload"`
+	ExpiresAt time.Time `db:"expires_at"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// NewDatabaseStateStore creates a state store on the oauth_states table.
+// tables may be nil for the default table names.
+func NewDatabaseStateStore(adapter core.Adapter, tables *core.TableNames) *DatabaseStateStore {
+	return &DatabaseStateStore{
+		adapter: adapter,
+		table:   tables.Table(TableOAuthStates),
+	}
+}
+
+// Save stores a state
+func (s *DatabaseStateStore) Save(ctx context.Context, state *State) error {
+	payload, err := sealState(state)
+	if err != nil {
+		return err
+	}
+	id, err := crypto.GenerateID()
+	if err != nil {
+		return err
+	}
+
+	_, err = repo.Create(ctx, s.adapter, s.table, &stateRecord{
+		ID:        id,
+		StateHash: tokens.Hash(state.State),
+		Payload:   payload,
+		ExpiresAt: state.ExpiresAt,
+		CreatedAt: time.Now(),
+	})
+	return err
+}
+
+// Take returns and deletes a state. Of concurrent calls for the same
+// state, only the one whose delete removes the row gets it.
+func (s *DatabaseStateStore) Take(ctx context.Context, state string) (*State, error) {
+	query := core.NewQuery(s.table).
+		Where("state_hash", core.OpEqual, tokens.Hash(state)).
+		Build()
+
+	record, err := repo.FindOne[stateRecord](ctx, s.adapter, query)
+	if err != nil || record == nil {
+		return nil, err
+	}
+
+	deleted, err := s.adapter.DeleteMany(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if deleted == 0 || time.Now().After(record.ExpiresAt) {
+		return nil, nil
+	}
+	return openState(state, record.Payload, record.ExpiresAt)
+}
+
+// Cleanup deletes expired states
+func (s *DatabaseStateStore) Cleanup(ctx context.Context) error {
+	query := core.NewQuery(s.table).
+		Where("expires_at", core.OpLessThan, time.Now()).
+		Build()
+
+	_, err := s.adapter.DeleteMany(ctx, query)
+	return err
+}
+
+// RedisStateStore keeps states in Redis, which expires them on its own
+type RedisStateStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisStateStore creates a state store on a Redis client. Keys are
+// prefix + the state's SHA-256 hash; the prefix defaults to
+// "beacon:oauth_state:".
+func NewRedisStateStore(client redis.UniversalClient, prefix string) *RedisStateStore {
+	if prefix == "" {
+		prefix = "beacon:oauth_state:"
+	}
+	return &RedisStateStore{client: client, prefix: prefix}
+}
+
+// Save stores a state with its remaining lifetime as TTL
+func (s *RedisStateStore) Save(ctx context.Context, state *State) error {
+	ttl := time.Until(state.ExpiresAt)
+	if ttl <= 0 {
+		return errors.New("oauth state already expired")
+	}
+	payload, err := sealState(state)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.prefix+tokens.Hash(state.State), payload, ttl).Err()
+}
+
+// Take returns and deletes a state with a single GETDEL
+func (s *RedisStateStore) Take(ctx context.Context, state string) (*State, error) {
+	payload, err := s.client.GetDel(ctx, s.prefix+tokens.Hash(state)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return openState(state, payload, time.Time{})
+}
@@ -0,0 +1,117 @@
+package oauth
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/marshallshelly/beacon-auth/adapters/memory"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/tokens"
+	"github.com/redis/go-redis/v9"
+)
+
+func testStateStore(t *testing.T, store StateStore) {
+	t.Helper()
+	ctx := context.Background()
+
+	saved := &State{
+		State:        "state-1",
+		ProviderID:   "google",
+		CodeVerifier: "verifier",
+		RedirectTo:   "/dashboard",
+		Nonce:        "nonce",
+		ExpiresAt:    time.Now().Add(StateTTL),
+	}
+	if err := store.Save(ctx, saved); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	got, err := store.Take(ctx, "state-1")
+	if err != nil {
+		t.Fatalf("Take() error = %v", err)
+	}
+	if got == nil || got.ProviderID != "google" || got.CodeVerifier != "verifier" || got.RedirectTo != "/dashboard" || got.Nonce != "nonce" {
+		t.Fatalf("Take() = %+v, want the saved state", got)
+	}
+
+	// A state completes at most one flow
+	if again, err := store.Take(ctx, "state-1"); err != nil || again != nil {
+		t.Errorf("second Take() = %+v, %v, want nil", again, err)
+	}
+	if unknown, err := store.Take(ctx, "unknown"); err != nil || unknown != nil {
+		t.Errorf("Take() of an unknown state = %+v, %v, want nil", unknown, err)
+	}
+}
+
+func TestDatabaseStateStore(t *testing.T) {
+	mem := memory.New()
+	store := NewDatabaseStateStore(mem, nil)
+	testStateStore(t, store)
+
+	ctx := context.Background()
+	expired := &State{State: "expired", ProviderID: "google", ExpiresAt: time.Now().Add(-time.Minute)}
+	if err := store.Save(ctx, expired); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if got, err := store.Take(ctx, "expired"); err != nil || got != nil {
+		t.Errorf("Take() of an expired state = %+v, %v, want nil", got, err)
+	}
+}
+
+// The stored row holds neither the state nor the flow's secrets, and a
+// long redirect full of characters JSON escapes is kept intact
+func TestDatabaseStateStoreSealsState(t *testing.T) {
+	mem := memory.New()
+	store := NewDatabaseStateStore(mem, nil)
+	ctx := context.Background()
+
+	redirect := "/" + strings.Repeat("&<>", (core.MaxRedirectLength-1)/3)
+	saved := &State{
+		State:        "state-1",
+		ProviderID:   "google",
+		CodeVerifier: "verifier-secret",
+		RedirectTo:   redirect,
+		Nonce:        "nonce-secret",
+		ExpiresAt:    time.Now().Add(StateTTL),
+	}
+	if err := store.Save(ctx, saved); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	rows, err := mem.FindMany(ctx, core.NewQuery(TableOAuthStates).Build())
+	if err != nil || len(rows) != 1 {
+		t.Fatalf("FindMany() = %v, %v, want one row", rows, err)
+	}
+	for column, value := range rows[0] {
+		text, _ := value.(string)
+		for _, secret := range []string{"state-1", "verifier-secret", "nonce-secret", "google"} {
+			if strings.Contains(text, secret) {
+				t.Errorf("column %s contains %q", column, secret)
+			}
+		}
+	}
+	if rows[0]["state_hash"] != tokens.Hash("state-1") {
+		t.Errorf("state_hash = %v, want the state's hash", rows[0]["state_hash"])
+	}
+
+	// A row cannot be opened with another state
+	if _, err := openState("state-2", rows[0]["payload"].(string), time.Time{}); err == nil {
+		t.Error("openState() with another state succeeded")
+	}
+
+	got, err := store.Take(ctx, "state-1")
+	if err != nil || got == nil || got.RedirectTo != redirect {
+		t.Errorf("Take() = %+v, %v, want the long redirect", got, err)
+	}
+}
+
+func TestRedisStateStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	testStateStore(t, NewRedisStateStore(client, ""))
+}
@@ -0,0 +1,218 @@
+package oidcprovider
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/crypto"
+	"github.com/marshallshelly/beacon-auth/repo"
+)
+
+var (
+	// ErrUnknownClient is returned for client IDs that are not registered
+	ErrUnknownClient = errors.New("unknown client")
+
+	// ErrInvalidClientSecret is returned when a confidential client sends
+	// a wrong or no secret
+	ErrInvalidClientSecret = errors.New("invalid client secret")
+
+	// ErrRedirectNotAllowed is returned when a redirect URI is not
+	// registered for the client
+	ErrRedirectNotAllowed = errors.New("redirect URI not allowed for client")
+)
+
+// Client is a third-party application allowed to sign users in
+type Client struct {
+	// ID is the client_id. It is generated when empty.
+	ID string `json:"clientId"`
+
+	// Name is shown to users on the consent page
+	Name string `json:"name"`
+
+	// RedirectURIs lists where authorization responses may be sent. They
+	// are compared exactly.
+	RedirectURIs []string `json:"redirectUris"`
+
+	// Scopes lists the scopes the client may request
+	Scopes []string `json:"scopes"`
+
+	// Public clients, such as mobile and single-page apps, cannot keep a
+	// secret. They have none and must use PKCE.
+	Public bool `json:"public"`
+
+	// SkipConsent signs users in without the consent page, for trusted
+	// first-party clients
+	SkipConsent bool `json:"skipConsent"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// clientRecord is a row of the oauth_clients table
+type clientRecord struct {
+	ID           string    `db:"id"`
+	ClientID     string    `db:"client_id"`
+	SecretHash   string    `db:"secret_hash,omitempty"`
+	Name         string    `db:"name"`
+	RedirectURIs string    `db:"redirect_uris"` // space-separated
+	Scopes       string    `db:"scopes"`        // space-separated
+	IsPublic     bool      `db:"is_public"`
+	SkipConsent  bool      `db:"skip_consent"`
+	CreatedAt    time.Time `db:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at"`
+}
+
+func (r *clientRecord) client() *Client {
+	return &Client{
+		ID:           r.ClientID,
+		Name:         r.Name,
+		RedirectURIs: strings.Fields(r.RedirectURIs),
+		Scopes:       strings.Fields(r.Scopes),
+		Public:       r.IsPublic,
+		SkipConsent:  r.SkipConsent,
+		CreatedAt:    r.CreatedAt,
+	}
+}
+
+// RegisterClient stores a new client and returns its secret, or "" for
+// public clients. Only a hash of the secret is stored, so it cannot be
+// shown again.
+func (p *OIDCProviderPlugin) RegisterClient(ctx context.Context, client *Client) (string, error) {
+	if client.Name == "" {
+		return "", errors.New("oidcprovider: client name is required")
+	}
+	if len(client.RedirectURIs) == 0 {
+		return "", errors.New("oidcprovider: at least one redirect URI is required")
+	}
+	for _, uri := range client.RedirectURIs {
+		u, err := url.Parse(uri)
+		if err != nil || u.Scheme == "" || u.Host == "" || u.Fragment != "" || strings.ContainsAny(uri, " \t\n") {
+			return "", fmt.Errorf("oidcprovider: invalid redirect URI %q", uri)
+		}
+	}
+	if len(client.Scopes) == 0 {
+		return "", errors.New("oidcprovider: at least one scope is required")
+	}
+
+	if client.ID == "" {
+		id, err := crypto.GenerateID()
+		if err != nil {
+			return "", err
+		}
+		client.ID = id
+	}
+
+	var secret, secretHash string
+	if !client.Public {
+		var err error
+		secret, err = crypto.GenerateVerificationToken()
+		if err != nil {
+			return "", err
+		}
+		secretHash = hashToken(secret)
+	}
+
+	id, err := crypto.GenerateID()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	_, err = repo.Create(ctx, p.ctx.Adapter, p.table(TableClients), &clientRecord{
+		ID:           id,
+		ClientID:     client.ID,
+		SecretHash:   secretHash,
+		Name:         client.Name,
+		RedirectURIs: strings.Join(client.RedirectURIs, " "),
+		Scopes:       strings.Join(client.Scopes, " "),
+		IsPublic:     client.Public,
+		SkipConsent:  client.SkipConsent,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	client.CreatedAt = now
+	return secret, nil
+}
+
+// Client returns a registered client
+func (p *OIDCProviderPlugin) Client(ctx context.Context, clientID string) (*Client, error) {
+	record, err := p.findClient(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	return record.client(), nil
+}
+
+// DeleteClient removes a client and revokes its refresh tokens
+func (p *OIDCProviderPlugin) DeleteClient(ctx context.Context, clientID string) error {
+	tokens := core.NewQuery(p.table(TableRefreshTokens)).
+		Where("client_id", core.OpEqual, clientID).
+		Build()
+	if _, err := p.ctx.Adapter.DeleteMany(ctx, tokens); err != nil {
+		return err
+	}
+
+	return p.ctx.Adapter.Delete(ctx, core.NewQuery(p.table(TableClients)).
+		Where("client_id", core.OpEqual, clientID).
+		Build())
+}
+
+func (p *OIDCProviderPlugin) findClient(ctx context.Context, clientID string) (*clientRecord, error) {
+	if clientID == "" {
+		return nil, ErrUnknownClient
+	}
+	query := core.NewQuery(p.table(TableClients)).
+		Where("client_id", core.OpEqual, clientID).
+		Build()
+
+	record, err := repo.FindOne[clientRecord](ctx, p.ctx.Adapter, query)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, ErrUnknownClient
+	}
+	return record, nil
+}
+
+// authenticateClient identifies the client of a token endpoint request by
+// HTTP Basic auth (client_secret_basic) or form fields
+// (client_secret_post). Public clients send only client_id.
+func (p *OIDCProviderPlugin) authenticateClient(r *http.Request) (*Client, error) {
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		// Basic credentials are form-encoded (RFC 6749 section 2.3.1)
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	record, err := p.findClient(r.Context(), clientID)
+	if err != nil {
+		return nil, err
+	}
+	if !record.IsPublic && subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(record.SecretHash)) != 1 {
+		return nil, ErrInvalidClientSecret
+	}
+	return record.client(), nil
+}
+
+// hashToken returns the stored form of a client secret, authorization
+// code or refresh token. They are random, so a plain SHA-256 suffices.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,725 @@
+// Package oidcprovider lets an app built on BeaconAuth act as an OAuth 2.0
+// authorization server and OpenID Connect provider, so third-party clients
+// can sign their users in with it.
+package oidcprovider
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/plugin"
+	"github.com/marshallshelly/beacon-auth/repo"
+)
+
+// Default plugin table names. Use them as keys in core.TableNames.Plugins
+// to rename the tables.
+const (
+	TableClients            = "oauth_clients"
+	TableAuthorizationCodes = "oauth_authorization_codes"
+	TableRefreshTokens      = "oauth_refresh_tokens"
+)
+
+// Standard OpenID Connect scopes
+const (
+	ScopeOpenID        = "openid"
+	ScopeProfile       = "profile"
+	ScopeEmail         = "email"
+	ScopeOfflineAccess = "offline_access"
+)
+
+// maxNonceLength bounds the nonce stored with an authorization code
+const maxNonceLength = 255
+
+// ConsentChecker reports whether a user already granted scopes to a
+// client, so the consent page can be skipped
+type ConsentChecker func(ctx context.Context, userID string, client *Client, scopes []string) (bool, error)
+
+// ConsentRecorder is called when a user approves a client on the consent
+// page, to remember the grant
+type ConsentRecorder func(ctx context.Context, userID string, client *Client, scopes []string) error
+
+// Options configures the provider
+type Options struct {
+	// Issuer identifies the provider in tokens and discovery. It must be
+	// the URL the plugin's endpoints are served under. Defaults to
+	// BaseURL + BasePath.
+	Issuer string `yaml:"issuer"`
+
+	// SigningKey signs access and ID tokens with RS256. Without one, a
+	// temporary key is generated and tokens stop verifying on restart.
+	SigningKey *rsa.PrivateKey `yaml:"-"`
+
+	// KeyID is the kid of SigningKey. Defaults to its RFC 7638 thumbprint.
+	KeyID string `yaml:"key_id"`
+
+	// LoginURL is where users without a session are sent, with the
+	// authorization request in redirect_to. Defaults to BaseURL + "/login".
+	LoginURL string `yaml:"login_url"`
+
+	// ConsentURL is the app's consent page. It receives the authorization
+	// request's query string. Defaults to BaseURL + "/consent".
+	ConsentURL string `yaml:"consent_url"`
+
+	// CheckConsent skips the consent page for grants the user made before
+	CheckConsent ConsentChecker `yaml:"-"`
+
+	// OnConsent records grants made on the consent page
+	OnConsent ConsentRecorder `yaml:"-"`
+
+	AccessTokenTTL       time.Duration `yaml:"access_token_ttl"`       // Defaults to 1 hour
+	IDTokenTTL           time.Duration `yaml:"id_token_ttl"`           // Defaults to 1 hour
+	RefreshTokenTTL      time.Duration `yaml:"refresh_token_ttl"`      // Defaults to 30 days
+	AuthorizationCodeTTL time.Duration `yaml:"authorization_code_ttl"` // Defaults to 1 minute
+}
+
+// OIDCProviderPlugin is an OAuth 2.0 authorization server and OpenID
+// Connect provider supporting the authorization code flow with PKCE and
+// refresh tokens
+type OIDCProviderPlugin struct {
+	*plugin.BasePlugin
+	ctx  *core.AuthContext
+	opts Options
+
+	signingKey   *rsa.PrivateKey
+	keyID        string
+	ephemeralKey bool
+}
+
+// New creates a new OpenID Connect provider plugin
+func New(opts *Options) *OIDCProviderPlugin {
+	o := Options{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.AccessTokenTTL <= 0 {
+		o.AccessTokenTTL = time.Hour
+	}
+	if o.IDTokenTTL <= 0 {
+		o.IDTokenTTL = time.Hour
+	}
+	if o.RefreshTokenTTL <= 0 {
+		o.RefreshTokenTTL = 30 * 24 * time.Hour
+	}
+	if o.AuthorizationCodeTTL <= 0 {
+		o.AuthorizationCodeTTL = time.Minute
+	}
+
+	return &OIDCProviderPlugin{
+		BasePlugin: plugin.NewBasePlugin("oidcprovider"),
+		opts:       o,
+	}
+}
+
+// Init initializes the plugin
+func (p *OIDCProviderPlugin) Init(ctx *core.AuthContext) error {
+	baseURL := strings.TrimSuffix(ctx.Config.BaseURL, "/")
+	if p.opts.Issuer == "" {
+		p.opts.Issuer = baseURL + ctx.Config.BasePath
+	}
+	p.opts.Issuer = strings.TrimSuffix(p.opts.Issuer, "/")
+	if p.opts.LoginURL == "" {
+		p.opts.LoginURL = baseURL + "/login"
+	}
+	if p.opts.ConsentURL == "" {
+		p.opts.ConsentURL = baseURL + "/consent"
+	}
+
+	if err := validateIssuer(p.opts.Issuer); err != nil {
+		return err
+	}
+
+	p.signingKey = p.opts.SigningKey
+	if p.signingKey == nil {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return fmt.Errorf("oidcprovider: failed to generate signing key: %w", err)
+		}
+		p.signingKey = key
+		p.ephemeralKey = true
+		ctx.Logger.Warn("oidcprovider: no signing key configured; tokens are signed with a temporary key and stop verifying on restart")
+	}
+	p.keyID = p.opts.KeyID
+	if p.keyID == "" {
+		p.keyID = keyThumbprint(&p.signingKey.PublicKey)
+	}
+
+	p.ctx = ctx
+	return nil
+}
+
+// Config returns the plugin's options, which the oidcprovider section of
+// the config file sets. The signing key and consent callbacks can only be
+// set in code.
+func (p *OIDCProviderPlugin) Config() interface{} {
+	return &p.opts
+}
+
+// ValidateConfig checks the options
+func (p *OIDCProviderPlugin) ValidateConfig() error {
+	if p.opts.Issuer != "" {
+		if err := validateIssuer(p.opts.Issuer); err != nil {
+			return err
+		}
+	}
+	if p.opts.SigningKey != nil && p.opts.SigningKey.N.BitLen() < 2048 {
+		return fmt.Errorf("oidcprovider: signing key must be at least 2048 bits, got %d", p.opts.SigningKey.N.BitLen())
+	}
+	if p.opts.KeyID != "" && p.opts.SigningKey == nil {
+		return errors.New("oidcprovider: key_id is set without a signing key; the temporary key gets its own ID")
+	}
+	ttls := []struct {
+		name string
+		ttl  time.Duration
+	}{
+		{"access_token_ttl", p.opts.AccessTokenTTL},
+		{"id_token_ttl", p.opts.IDTokenTTL},
+		{"refresh_token_ttl", p.opts.RefreshTokenTTL},
+		{"authorization_code_ttl", p.opts.AuthorizationCodeTTL},
+	}
+	for _, t := range ttls {
+		if t.ttl <= 0 {
+			return fmt.Errorf("oidcprovider: %s must be positive, got %s", t.name, t.ttl)
+		}
+	}
+	return nil
+}
+
+// validateIssuer checks that the issuer is an absolute URL
+func validateIssuer(issuer string) error {
+	u, err := url.Parse(issuer)
+	if err != nil || u.Scheme == "" || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("oidcprovider: issuer must be an absolute URL without query or fragment: %q", issuer)
+	}
+	return nil
+}
+
+// DescribeSecurity reports token lifetimes and whether the signing key is
+// temporary
+func (p *OIDCProviderPlugin) DescribeSecurity() map[string]interface{} {
+	return map[string]interface{}{
+		"issuer":                 p.opts.Issuer,
+		"ephemeralSigningKey":    p.ephemeralKey,
+		"accessTokenTTLSeconds":  int(p.opts.AccessTokenTTL / time.Second),
+		"refreshTokenTTLSeconds": int(p.opts.RefreshTokenTTL / time.Second),
+	}
+}
+
+// Endpoints returns the plugin endpoints
+func (p *OIDCProviderPlugin) Endpoints() map[string]plugin.Endpoint {
+	return map[string]plugin.Endpoint{
+		"/.well-known/openid-configuration": {Method: "GET", Handler: p.handleDiscovery},
+		"/oauth2/jwks":                      {Method: "GET", Handler: p.handleJWKS},
+		"/oauth2/authorize":                 {Method: "GET", Handler: p.handleAuthorize},
+		"/oauth2/consent/info":              {Method: "GET", Handler: p.handleConsentInfo, Auth: core.AuthSession},
+		"/oauth2/consent":                   {Method: "POST", Handler: p.handleConsent, Auth: core.AuthSession},
+		"/oauth2/token":                     {Method: "POST", Handler: p.handleToken, RateLimit: core.RateLimitTokens},
+		"/oauth2/userinfo":                  {Method: "GET", Handler: p.handleUserInfo},
+		"/oauth2/revoke":                    {Method: "POST", Handler: p.handleRevoke},
+	}
+}
+
+// authorizeRequest is a validated authorization request
+type authorizeRequest struct {
+	Client        *Client
+	RedirectURI   string
+	Scopes        []string
+	State         string
+	Nonce         string
+	CodeChallenge string
+	Prompt        string
+}
+
+// authorizeError is an error returned to the client's redirect URI
+// (RFC 6749 section 4.1.2.1)
+type authorizeError struct {
+	Code        string
+	Description string
+}
+
+func (e *authorizeError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// parseAuthorizeRequest validates an authorization request. Errors about
+// the client or redirect URI are returned as plain errors, since the
+// redirect URI cannot be trusted; the rest as *authorizeError along with
+// the request, so they can be sent to the client.
+func (p *OIDCProviderPlugin) parseAuthorizeRequest(ctx context.Context, q url.Values) (*authorizeRequest, error) {
+	client, err := p.Client(ctx, q.Get("client_id"))
+	if err != nil {
+		return nil, err
+	}
+
+	redirectURI := q.Get("redirect_uri")
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !slices.Contains(client.RedirectURIs, redirectURI) {
+		return nil, ErrRedirectNotAllowed
+	}
+
+	req := &authorizeRequest{
+		Client:      client,
+		RedirectURI: redirectURI,
+		Scopes:      strings.Fields(q.Get("scope")),
+		State:       q.Get("state"),
+		Nonce:       q.Get("nonce"),
+		Prompt:      q.Get("prompt"),
+	}
+
+	if q.Get("response_type") != "code" {
+		return req, &authorizeError{"unsupported_response_type", "only the code response type is supported"}
+	}
+	if len(req.Scopes) == 0 {
+		return req, &authorizeError{"invalid_scope", "scope is required"}
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(client.Scopes, scope) {
+			return req, &authorizeError{"invalid_scope", "scope not allowed for client: " + scope}
+		}
+	}
+	if len(req.Nonce) > maxNonceLength {
+		return req, &authorizeError{"invalid_request", "nonce is too long"}
+	}
+
+	// PKCE, required for public clients
+	req.CodeChallenge = q.Get("code_challenge")
+	if req.CodeChallenge != "" && q.Get("code_challenge_method") != "S256" {
+		return req, &authorizeError{"invalid_request", "code_challenge_method must be S256"}
+	}
+	if req.CodeChallenge == "" && client.Public {
+		return req, &authorizeError{"invalid_request", "PKCE is required for public clients"}
+	}
+
+	switch req.Prompt {
+	case "", "none", "login", "consent":
+		// login is accepted, but an existing session is reused
+	default:
+		return req, &authorizeError{"invalid_request", "unsupported prompt: " + req.Prompt}
+	}
+	return req, nil
+}
+
+// handleAuthorize starts the authorization code flow. Users without a
+// session are sent to LoginURL, and users who have not granted the scopes
+// to ConsentURL; both come back to this endpoint.
+func (p *OIDCProviderPlugin) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	req, err := p.parseAuthorizeRequest(r.Context(), q)
+	if !p.checkAuthorizeRequest(w, r, req, err) {
+		return
+	}
+
+	user := p.getUser(r)
+	if user == nil {
+		if req.Prompt == "none" {
+			p.redirectError(w, r, req, &authorizeError{"login_required", "the user is not signed in"})
+			return
+		}
+		p.redirectWith(w, r, p.opts.LoginURL, url.Values{"redirect_to": {r.URL.RequestURI()}})
+		return
+	}
+
+	granted := req.Client.SkipConsent
+	if !granted && req.Prompt != "consent" && p.opts.CheckConsent != nil {
+		granted, err = p.opts.CheckConsent(r.Context(), user.ID, req.Client, req.Scopes)
+		if err != nil {
+			p.ctx.Logger.Error("Failed to check consent: %v", err)
+			p.redirectError(w, r, req, &authorizeError{"server_error", "failed to check consent"})
+			return
+		}
+	}
+	if !granted {
+		if req.Prompt == "none" {
+			p.redirectError(w, r, req, &authorizeError{"consent_required", "the user has not granted the requested scopes"})
+			return
+		}
+		p.redirectWith(w, r, p.opts.ConsentURL, q)
+		return
+	}
+
+	p.redirectCode(w, r, req, user.ID)
+}
+
+// checkAuthorizeRequest writes the response for an invalid authorization
+// request and reports whether the request is valid
+func (p *OIDCProviderPlugin) checkAuthorizeRequest(w http.ResponseWriter, r *http.Request, req *authorizeRequest, err error) bool {
+	var authErr *authorizeError
+	switch {
+	case err == nil:
+		return true
+	case errors.As(err, &authErr):
+		p.redirectError(w, r, req, authErr)
+	case errors.Is(err, ErrUnknownClient):
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Unknown client")
+	case errors.Is(err, ErrRedirectNotAllowed):
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Invalid redirect URI")
+	default:
+		p.ctx.Logger.Error("Failed to load client: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Failed to load client")
+	}
+	return false
+}
+
+type consentInfoResponse struct {
+	Client struct {
+		ID   string `json:"clientId"`
+		Name string `json:"name"`
+	} `json:"client"`
+	Scopes []string `json:"scopes"`
+}
+
+// handleConsentInfo describes an authorization request for the consent
+// page, which passes on the query string it received
+func (p *OIDCProviderPlugin) handleConsentInfo(w http.ResponseWriter, r *http.Request) {
+	if p.getUser(r) == nil {
+		core.WriteStatusError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	req, err := p.parseAuthorizeRequest(r.Context(), r.URL.Query())
+	if err != nil {
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Invalid authorization request")
+		return
+	}
+
+	var resp consentInfoResponse
+	resp.Client.ID = req.Client.ID
+	resp.Client.Name = req.Client.Name
+	resp.Scopes = req.Scopes
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type consentRequest struct {
+	// Query is the authorization request's query string, as received by
+	// the consent page
+	Query   string `json:"query"`
+	Approve bool   `json:"approve"`
+}
+
+type consentResponse struct {
+	RedirectURI string `json:"redirectUri"`
+}
+
+// handleConsent records the user's decision and returns where to send
+// the browser: the client's redirect URI with a code, or with
+// access_denied
+func (p *OIDCProviderPlugin) handleConsent(w http.ResponseWriter, r *http.Request) {
+	user := p.getUser(r)
+	if user == nil {
+		core.WriteStatusError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var body consentRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	q, err := url.ParseQuery(body.Query)
+	if err != nil {
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	req, err := p.parseAuthorizeRequest(r.Context(), q)
+	if err != nil {
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Invalid authorization request")
+		return
+	}
+
+	if !body.Approve {
+		writeJSON(w, http.StatusOK, consentResponse{
+			RedirectURI: errorRedirectURI(req, &authorizeError{"access_denied", "the user denied the request"}),
+		})
+		return
+	}
+
+	if p.opts.OnConsent != nil {
+		if err := p.opts.OnConsent(r.Context(), user.ID, req.Client, req.Scopes); err != nil {
+			p.ctx.Logger.Error("Failed to record consent: %v", err)
+			core.WriteStatusError(w, r, http.StatusInternalServerError, "Failed to record consent")
+			return
+		}
+	}
+
+	redirectURI, err := p.codeRedirectURI(r.Context(), req, user.ID)
+	if err != nil {
+		p.ctx.Logger.Error("Failed to create authorization code: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Failed to create authorization code")
+		return
+	}
+	writeJSON(w, http.StatusOK, consentResponse{RedirectURI: redirectURI})
+}
+
+// handleToken exchanges authorization codes and refresh tokens
+// (RFC 6749 sections 4.1.3 and 6)
+func (p *OIDCProviderPlugin) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return
+	}
+
+	client, err := p.authenticateClient(r)
+	if errors.Is(err, ErrUnknownClient) || errors.Is(err, ErrInvalidClientSecret) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth2"`)
+		writeError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+	if err != nil {
+		p.ctx.Logger.Error("Failed to authenticate client: %v", err)
+		writeError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	ctx := r.Context()
+	var userID, scope, nonce string
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		code, err := p.redeemAuthorizationCode(ctx, client, r.PostForm.Get("code"), r.PostForm.Get("redirect_uri"), r.PostForm.Get("code_verifier"))
+		if !p.checkGrant(w, err) {
+			return
+		}
+		userID, scope, nonce = code.UserID, code.Scope, code.Nonce
+
+	case "refresh_token":
+		token, err := p.redeemRefreshToken(ctx, client, r.PostForm.Get("refresh_token"))
+		if !p.checkGrant(w, err) {
+			return
+		}
+		userID, scope = token.UserID, token.Scope
+
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+
+	user, err := p.findUser(ctx, userID)
+	if err != nil {
+		p.ctx.Logger.Error("Failed to load user: %v", err)
+		writeError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	if user == nil || core.ActiveBan(user, time.Now()) != nil {
+		writeError(w, http.StatusBadRequest, "invalid_grant", "the user can no longer sign in")
+		return
+	}
+
+	resp, err := p.issueTokens(ctx, client, user, scope, nonce)
+	if err != nil {
+		p.ctx.Logger.Error("Failed to issue tokens: %v", err)
+		writeError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (p *OIDCProviderPlugin) checkGrant(w http.ResponseWriter, err error) bool {
+	if errors.Is(err, ErrInvalidGrant) {
+		writeError(w, http.StatusBadRequest, "invalid_grant", "")
+		return false
+	}
+	if err != nil {
+		p.ctx.Logger.Error("Failed to redeem grant: %v", err)
+		writeError(w, http.StatusInternalServerError, "server_error", "")
+		return false
+	}
+	return true
+}
+
+// handleUserInfo returns the claims of the access token's user allowed by
+// its scopes
+func (p *OIDCProviderPlugin) handleUserInfo(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer`)
+		writeError(w, http.StatusUnauthorized, "invalid_token", "")
+		return
+	}
+
+	claims, err := p.VerifyAccessToken(token)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeError(w, http.StatusUnauthorized, "invalid_token", "")
+		return
+	}
+	if !slices.Contains(claims.Scopes(), ScopeOpenID) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+		writeError(w, http.StatusForbidden, "insufficient_scope", "")
+		return
+	}
+
+	user, err := p.findUser(r.Context(), claims.Subject)
+	if err != nil {
+		p.ctx.Logger.Error("Failed to load user: %v", err)
+		writeError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "invalid_token", "")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, userClaims(user, claims.Scopes()))
+}
+
+// handleRevoke revokes a refresh token (RFC 7009). Unknown tokens are not
+// an error.
+func (p *OIDCProviderPlugin) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return
+	}
+
+	client, err := p.authenticateClient(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+
+	query := core.NewQuery(p.table(TableRefreshTokens)).
+		Where("token_hash", core.OpEqual, hashToken(r.PostForm.Get("token"))).
+		Where("client_id", core.OpEqual, client.ID).
+		Build()
+	if _, err := p.ctx.Adapter.DeleteMany(r.Context(), query); err != nil {
+		p.ctx.Logger.Error("Failed to revoke token: %v", err)
+		writeError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (p *OIDCProviderPlugin) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	issuer := p.opts.Issuer
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/oauth2/authorize",
+		"token_endpoint":                        issuer + "/oauth2/token",
+		"userinfo_endpoint":                     issuer + "/oauth2/userinfo",
+		"revocation_endpoint":                   issuer + "/oauth2/revoke",
+		"jwks_uri":                              issuer + "/oauth2/jwks",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      []string{ScopeOpenID, ScopeProfile, ScopeEmail, ScopeOfflineAccess},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"prompt_values_supported":               []string{"none", "consent"},
+		"claims_supported":                      []string{"sub", "iss", "aud", "exp", "iat", "nonce", "email", "email_verified", "name", "picture", "updated_at"},
+	})
+}
+
+func (p *OIDCProviderPlugin) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []jwk{publicJWK(&p.signingKey.PublicKey, p.keyID)},
+	})
+}
+
+// Redirects
+
+// redirectCode sends the browser back to the client with a new code
+func (p *OIDCProviderPlugin) redirectCode(w http.ResponseWriter, r *http.Request, req *authorizeRequest, userID string) {
+	redirectURI, err := p.codeRedirectURI(r.Context(), req, userID)
+	if err != nil {
+		p.ctx.Logger.Error("Failed to create authorization code: %v", err)
+		p.redirectError(w, r, req, &authorizeError{"server_error", "failed to create authorization code"})
+		return
+	}
+	http.Redirect(w, r, redirectURI, http.StatusFound)
+}
+
+func (p *OIDCProviderPlugin) codeRedirectURI(ctx context.Context, req *authorizeRequest, userID string) (string, error) {
+	code, err := p.createAuthorizationCode(ctx, req, userID)
+	if err != nil {
+		return "", err
+	}
+	params := url.Values{"code": {code}, "iss": {p.opts.Issuer}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	return withQuery(req.RedirectURI, params), nil
+}
+
+func (p *OIDCProviderPlugin) redirectError(w http.ResponseWriter, r *http.Request, req *authorizeRequest, authErr *authorizeError) {
+	http.Redirect(w, r, errorRedirectURI(req, authErr), http.StatusFound)
+}
+
+func (p *OIDCProviderPlugin) redirectWith(w http.ResponseWriter, r *http.Request, target string, params url.Values) {
+	http.Redirect(w, r, withQuery(target, params), http.StatusFound)
+}
+
+func errorRedirectURI(req *authorizeRequest, authErr *authorizeError) string {
+	params := url.Values{"error": {authErr.Code}}
+	if authErr.Description != "" {
+		params.Set("error_description", authErr.Description)
+	}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	return withQuery(req.RedirectURI, params)
+}
+
+// withQuery adds params to a URL's query, keeping its existing parameters
+func withQuery(target string, params url.Values) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// Helpers
+
+func (p *OIDCProviderPlugin) getUser(r *http.Request) *core.User {
+	_, user := p.ctx.RequestSession(r)
+	return user
+}
+
+func (p *OIDCProviderPlugin) findUser(ctx context.Context, userID string) (*core.User, error) {
+	if user, ok, err := p.ctx.ExternalUser(ctx, userID); ok {
+		return user, err
+	}
+	query := core.NewQuery(p.table(core.ModelUsers)).
+		Where("id", core.OpEqual, userID).
+		Build()
+	return repo.FindOne[core.User](ctx, p.ctx.Adapter, query)
+}
+
+// table returns the configured name of a table
+func (p *OIDCProviderPlugin) table(name string) string {
+	return p.ctx.Config.TableNames.Table(name)
+}
+
+// writeError writes an OAuth error response
+func writeError(w http.ResponseWriter, status int, code, description string) {
+	body := map[string]string{"error": code}
+	if description != "" {
+		body["error_description"] = description
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
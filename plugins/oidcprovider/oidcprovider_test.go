@@ -0,0 +1,454 @@
+package oidcprovider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/marshallshelly/beacon-auth/adapter"
+	"github.com/marshallshelly/beacon-auth/adapters/memory"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/session"
+)
+
+const testRedirectURI = "https://client.example.com/callback"
+
+type testEnv struct {
+	p      *OIDCProviderPlugin
+	user   *core.User
+	cookie *http.Cookie
+}
+
+func newTestEnv(t *testing.T, opts *Options) *testEnv {
+	t.Helper()
+	ctx := context.Background()
+
+	db := memory.New()
+	sessions, err := session.NewManager(&session.Config{
+		CookieName:    "test_session",
+		ExpiresIn:     time.Hour,
+		EnableDBStore: true,
+	}, db)
+	if err != nil {
+		t.Fatalf("Failed to create session manager: %v", err)
+	}
+
+	user, err := adapter.NewInternalAdapter(db, nil).CreateUser(ctx, "user@example.com", "User")
+	if err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	_, _, token, err := sessions.Create(ctx, user.ID, nil)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	p := New(opts)
+	err = p.Init(&core.AuthContext{
+		Config: &core.Config{
+			BaseURL:  "https://id.example.com",
+			BasePath: "/auth",
+			Session:  &core.SessionConfig{CookieName: "test_session"},
+		},
+		Adapter:        db,
+		Logger:         core.NewNoopLogger(),
+		SessionManager: sessions,
+	})
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	return &testEnv{
+		p:      p,
+		user:   user,
+		cookie: &http.Cookie{Name: "test_session", Value: token},
+	}
+}
+
+func (e *testEnv) registerClient(t *testing.T, client *Client) string {
+	t.Helper()
+	if client.Name == "" {
+		client.Name = "Client"
+	}
+	if client.RedirectURIs == nil {
+		client.RedirectURIs = []string{testRedirectURI}
+	}
+	if client.Scopes == nil {
+		client.Scopes = []string{ScopeOpenID, ScopeEmail, ScopeProfile, ScopeOfflineAccess}
+	}
+	secret, err := e.p.RegisterClient(context.Background(), client)
+	if err != nil {
+		t.Fatalf("RegisterClient failed: %v", err)
+	}
+	return secret
+}
+
+// authorize calls the authorization endpoint and returns the redirect
+func (e *testEnv) authorize(t *testing.T, q url.Values, signedIn bool) *url.URL {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/auth/oauth2/authorize?"+q.Encode(), nil)
+	if signedIn {
+		req.AddCookie(e.cookie)
+	}
+	rec := httptest.NewRecorder()
+	e.p.handleAuthorize(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("authorize status = %d: %s", rec.Code, rec.Body.String())
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location
+}
+
+// token calls the token endpoint
+func (e *testEnv) token(clientID, secret string, form url.Values) (int, map[string]interface{}) {
+	req := httptest.NewRequest("POST", "/auth/oauth2/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if secret != "" {
+		req.SetBasicAuth(clientID, secret)
+	}
+	rec := httptest.NewRecorder()
+	e.p.handleToken(rec, req)
+
+	var body map[string]interface{}
+	_ = json.NewDecoder(rec.Body).Decode(&body)
+	return rec.Code, body
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	env := newTestEnv(t, nil)
+	client := &Client{}
+	secret := env.registerClient(t, client)
+
+	verifier := "a-code-verifier-that-is-long-enough-for-pkce-0123456789"
+	q := url.Values{
+		"client_id":             {client.ID},
+		"redirect_uri":          {testRedirectURI},
+		"response_type":         {"code"},
+		"scope":                 {"openid email offline_access"},
+		"state":                 {"xyz"},
+		"nonce":                 {"n-0S6"},
+		"code_challenge":        {codeChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	// Signed out users are sent to the login page, and back
+	location := env.authorize(t, q, false)
+	if got := location.Scheme + "://" + location.Host + location.Path; got != "https://id.example.com/login" {
+		t.Errorf("login redirect = %s", location)
+	}
+	if !strings.HasPrefix(location.Query().Get("redirect_to"), "/auth/oauth2/authorize?") {
+		t.Errorf("redirect_to = %q", location.Query().Get("redirect_to"))
+	}
+
+	// Then to the consent page, with the request
+	location = env.authorize(t, q, true)
+	if location.Path != "/consent" || location.Query().Get("client_id") != client.ID {
+		t.Fatalf("consent redirect = %s", location)
+	}
+
+	req := httptest.NewRequest("GET", "/auth/oauth2/consent/info?"+location.RawQuery, nil)
+	req.AddCookie(env.cookie)
+	rec := httptest.NewRecorder()
+	env.p.handleConsentInfo(rec, req)
+	var info consentInfoResponse
+	_ = json.NewDecoder(rec.Body).Decode(&info)
+	if info.Client.ID != client.ID || !slices.Equal(info.Scopes, []string{"openid", "email", "offline_access"}) {
+		t.Errorf("consent info = %+v", info)
+	}
+
+	body, _ := json.Marshal(consentRequest{Query: location.RawQuery, Approve: true})
+	req = httptest.NewRequest("POST", "/auth/oauth2/consent", strings.NewReader(string(body)))
+	req.AddCookie(env.cookie)
+	rec = httptest.NewRecorder()
+	env.p.handleConsent(rec, req)
+	var consent consentResponse
+	_ = json.NewDecoder(rec.Body).Decode(&consent)
+
+	callback, err := url.Parse(consent.RedirectURI)
+	if err != nil || !strings.HasPrefix(consent.RedirectURI, testRedirectURI+"?") {
+		t.Fatalf("consent redirect = %q", consent.RedirectURI)
+	}
+	if callback.Query().Get("state") != "xyz" || callback.Query().Get("iss") != "https://id.example.com/auth" {
+		t.Errorf("callback query = %v", callback.Query())
+	}
+	code := callback.Query().Get("code")
+
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {verifier},
+	}
+
+	// The verifier must match the challenge
+	wrong := url.Values{}
+	for k, v := range exchange {
+		wrong[k] = v
+	}
+	wrong.Set("code_verifier", "wrong")
+	if status, resp := env.token(client.ID, secret, wrong); status != http.StatusBadRequest || resp["error"] != "invalid_grant" {
+		t.Errorf("exchange with a wrong verifier = %d %v", status, resp)
+	}
+
+	// A failed exchange uses up the code, so start again
+	location = env.authorize(t, url.Values{
+		"client_id":             {client.ID},
+		"response_type":         {"code"},
+		"scope":                 {"openid email offline_access"},
+		"nonce":                 {"n-0S6"},
+		"code_challenge":        {codeChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}, true)
+	body, _ = json.Marshal(consentRequest{Query: location.RawQuery, Approve: true})
+	req = httptest.NewRequest("POST", "/auth/oauth2/consent", strings.NewReader(string(body)))
+	req.AddCookie(env.cookie)
+	rec = httptest.NewRecorder()
+	env.p.handleConsent(rec, req)
+	_ = json.NewDecoder(rec.Body).Decode(&consent)
+	callback, _ = url.Parse(consent.RedirectURI)
+	exchange.Set("code", callback.Query().Get("code"))
+
+	status, tokens := env.token(client.ID, secret, exchange)
+	if status != http.StatusOK {
+		t.Fatalf("exchange = %d %v", status, tokens)
+	}
+	if tokens["token_type"] != "Bearer" || tokens["refresh_token"] == nil || tokens["id_token"] == nil {
+		t.Errorf("tokens = %v", tokens)
+	}
+
+	// Codes are single use
+	if status, resp := env.token(client.ID, secret, exchange); status != http.StatusBadRequest || resp["error"] != "invalid_grant" {
+		t.Errorf("second exchange = %d %v", status, resp)
+	}
+
+	// The ID token verifies with the published key
+	idClaims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(tokens["id_token"].(string), idClaims, func(t *jwt.Token) (interface{}, error) {
+		if t.Header["kid"] != env.p.keyID {
+			return nil, errors.New("unexpected kid")
+		}
+		return &env.p.signingKey.PublicKey, nil
+	}, jwt.WithIssuer("https://id.example.com/auth"), jwt.WithAudience(client.ID))
+	if err != nil {
+		t.Fatalf("ID token does not verify: %v", err)
+	}
+	if idClaims["sub"] != env.user.ID || idClaims["nonce"] != "n-0S6" || idClaims["email"] != "user@example.com" {
+		t.Errorf("ID token claims = %v", idClaims)
+	}
+	if _, ok := idClaims["name"]; ok {
+		t.Error("ID token has profile claims without the profile scope")
+	}
+
+	// Userinfo accepts the access token but not the ID token
+	if status, claims := userInfo(env, tokens["access_token"].(string)); status != http.StatusOK || claims["email"] != "user@example.com" {
+		t.Errorf("userinfo = %d %v", status, claims)
+	}
+	if status, _ := userInfo(env, tokens["id_token"].(string)); status != http.StatusUnauthorized {
+		t.Errorf("userinfo with an ID token status = %d, want 401", status)
+	}
+
+	// Refresh tokens rotate
+	refresh := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens["refresh_token"].(string)}}
+	status, refreshed := env.token(client.ID, secret, refresh)
+	if status != http.StatusOK || refreshed["refresh_token"] == tokens["refresh_token"] {
+		t.Fatalf("refresh = %d %v", status, refreshed)
+	}
+	if status, _ := env.token(client.ID, secret, refresh); status != http.StatusBadRequest {
+		t.Errorf("reused refresh token status = %d, want 400", status)
+	}
+}
+
+func userInfo(env *testEnv, token string) (int, map[string]interface{}) {
+	req := httptest.NewRequest("GET", "/auth/oauth2/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	env.p.handleUserInfo(rec, req)
+
+	var body map[string]interface{}
+	_ = json.NewDecoder(rec.Body).Decode(&body)
+	return rec.Code, body
+}
+
+func TestToken_BannedUser(t *testing.T) {
+	env := newTestEnv(t, nil)
+	client := &Client{}
+	secret := env.registerClient(t, client)
+	ctx := context.Background()
+	internal := adapter.NewInternalAdapter(env.p.ctx.Adapter, nil)
+
+	refresh := func() int {
+		t.Helper()
+		issued, err := env.p.issueTokens(ctx, client, env.user, "openid offline_access", "")
+		if err != nil {
+			t.Fatalf("issueTokens failed: %v", err)
+		}
+		status, _ := env.token(client.ID, secret, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {issued.RefreshToken}})
+		return status
+	}
+	ban := func(expires time.Time) {
+		t.Helper()
+		if _, err := internal.UpdateUser(ctx, env.user.ID, map[string]interface{}{"banned": true, "ban_expires": expires}); err != nil {
+			t.Fatalf("UpdateUser failed: %v", err)
+		}
+	}
+
+	// A temporary ban that ended but was not lifted yet no longer applies
+	ban(time.Now().Add(-time.Minute))
+	if status := refresh(); status != http.StatusOK {
+		t.Errorf("refresh after the ban ended = %d, want 200", status)
+	}
+
+	ban(time.Now().Add(time.Hour))
+	if status := refresh(); status != http.StatusBadRequest {
+		t.Errorf("refresh while banned = %d, want 400", status)
+	}
+}
+
+func TestAuthorize_SkipsConsent(t *testing.T) {
+	var checked bool
+	env := newTestEnv(t, &Options{
+		CheckConsent: func(ctx context.Context, userID string, client *Client, scopes []string) (bool, error) {
+			checked = true
+			return client.Name == "Granted", nil
+		},
+	})
+
+	trusted := &Client{SkipConsent: true}
+	env.registerClient(t, trusted)
+	granted := &Client{Name: "Granted"}
+	env.registerClient(t, granted)
+
+	for _, client := range []*Client{trusted, granted} {
+		location := env.authorize(t, url.Values{
+			"client_id":     {client.ID},
+			"response_type": {"code"},
+			"scope":         {"openid"},
+		}, true)
+		if !strings.HasPrefix(location.String(), testRedirectURI) || location.Query().Get("code") == "" {
+			t.Errorf("%s: redirect = %s, want a code", client.Name, location)
+		}
+	}
+	if !checked {
+		t.Error("CheckConsent was not called")
+	}
+}
+
+func TestAuthorize_Errors(t *testing.T) {
+	env := newTestEnv(t, nil)
+	confidential := &Client{}
+	env.registerClient(t, confidential)
+	public := &Client{Public: true}
+	env.registerClient(t, public)
+
+	// Errors before the redirect URI is trusted are not redirected
+	for name, q := range map[string]url.Values{
+		"unknown client": {"client_id": {"unknown"}, "response_type": {"code"}, "scope": {"openid"}},
+		"wrong redirect": {"client_id": {confidential.ID}, "redirect_uri": {"https://evil.example/cb"}, "response_type": {"code"}, "scope": {"openid"}},
+	} {
+		rec := httptest.NewRecorder()
+		env.p.handleAuthorize(rec, httptest.NewRequest("GET", "/auth/oauth2/authorize?"+q.Encode(), nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", name, rec.Code)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		q        url.Values
+		signedIn bool
+		want     string
+	}{
+		{"scope not allowed", url.Values{"client_id": {confidential.ID}, "response_type": {"code"}, "scope": {"openid admin"}}, true, "invalid_scope"},
+		{"token response type", url.Values{"client_id": {confidential.ID}, "response_type": {"token"}, "scope": {"openid"}}, true, "unsupported_response_type"},
+		{"public client without PKCE", url.Values{"client_id": {public.ID}, "response_type": {"code"}, "scope": {"openid"}}, true, "invalid_request"},
+		{"plain PKCE", url.Values{"client_id": {public.ID}, "response_type": {"code"}, "scope": {"openid"}, "code_challenge": {"abc"}, "code_challenge_method": {"plain"}}, true, "invalid_request"},
+		{"prompt=none signed out", url.Values{"client_id": {confidential.ID}, "response_type": {"code"}, "scope": {"openid"}, "prompt": {"none"}}, false, "login_required"},
+		{"prompt=none without consent", url.Values{"client_id": {confidential.ID}, "response_type": {"code"}, "scope": {"openid"}, "prompt": {"none"}}, true, "consent_required"},
+	}
+	for _, tt := range tests {
+		tt.q.Set("state", "s1")
+		location := env.authorize(t, tt.q, tt.signedIn)
+		if !strings.HasPrefix(location.String(), testRedirectURI) || location.Query().Get("error") != tt.want || location.Query().Get("state") != "s1" {
+			t.Errorf("%s: redirect = %s, want error %s", tt.name, location, tt.want)
+		}
+	}
+}
+
+func TestToken_ClientAuthentication(t *testing.T) {
+	env := newTestEnv(t, nil)
+	client := &Client{SkipConsent: true}
+	env.registerClient(t, client)
+
+	status, resp := env.token(client.ID, "wrong-secret", url.Values{"grant_type": {"authorization_code"}, "code": {"x"}})
+	if status != http.StatusUnauthorized || resp["error"] != "invalid_client" {
+		t.Errorf("wrong secret = %d %v", status, resp)
+	}
+
+	// Confidential clients cannot authenticate as public ones
+	status, _ = env.token("", "", url.Values{"grant_type": {"authorization_code"}, "client_id": {client.ID}})
+	if status != http.StatusUnauthorized {
+		t.Errorf("missing secret status = %d, want 401", status)
+	}
+}
+
+func TestDiscoveryAndJWKS(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	rec := httptest.NewRecorder()
+	env.p.handleDiscovery(rec, httptest.NewRequest("GET", "/auth/.well-known/openid-configuration", nil))
+	var discovery map[string]interface{}
+	_ = json.NewDecoder(rec.Body).Decode(&discovery)
+	if discovery["issuer"] != "https://id.example.com/auth" || discovery["jwks_uri"] != "https://id.example.com/auth/oauth2/jwks" {
+		t.Errorf("discovery = %v", discovery)
+	}
+
+	rec = httptest.NewRecorder()
+	env.p.handleJWKS(rec, httptest.NewRequest("GET", "/auth/oauth2/jwks", nil))
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	_ = json.NewDecoder(rec.Body).Decode(&jwks)
+	if len(jwks.Keys) != 1 || jwks.Keys[0].Kid != env.p.keyID || jwks.Keys[0].E != "AQAB" {
+		t.Errorf("jwks = %+v", jwks)
+	}
+}
+
+func TestRegisterClient_Validation(t *testing.T) {
+	env := newTestEnv(t, nil)
+	ctx := context.Background()
+
+	for name, client := range map[string]*Client{
+		"no name":          {RedirectURIs: []string{testRedirectURI}, Scopes: []string{"openid"}},
+		"relative URI":     {Name: "c", RedirectURIs: []string{"/callback"}, Scopes: []string{"openid"}},
+		"fragment":         {Name: "c", RedirectURIs: []string{testRedirectURI + "#x"}, Scopes: []string{"openid"}},
+		"no scopes":        {Name: "c", RedirectURIs: []string{testRedirectURI}},
+		"no redirect URIs": {Name: "c", Scopes: []string{"openid"}},
+	} {
+		if _, err := env.p.RegisterClient(ctx, client); err == nil {
+			t.Errorf("%s: RegisterClient() succeeded", name)
+		}
+	}
+
+	public := &Client{Name: "SPA", RedirectURIs: []string{testRedirectURI}, Scopes: []string{"openid"}, Public: true}
+	secret, err := env.p.RegisterClient(ctx, public)
+	if err != nil || secret != "" {
+		t.Errorf("RegisterClient() of a public client = %q, %v", secret, err)
+	}
+
+	if err := env.p.DeleteClient(ctx, public.ID); err != nil {
+		t.Fatalf("DeleteClient failed: %v", err)
+	}
+	if _, err := env.p.Client(ctx, public.ID); !errors.Is(err, ErrUnknownClient) {
+		t.Errorf("Client() after delete error = %v, want ErrUnknownClient", err)
+	}
+}
@@ -0,0 +1,54 @@
+package oidcprovider
+
+import "github.com/marshallshelly/beacon-auth/core"
+
+// Schema returns the tables of clients, authorization codes and refresh
+// tokens
+func (p *OIDCProviderPlugin) Schema() []core.TableDef {
+	return []core.TableDef{
+		{
+			Model: TableClients,
+			Columns: []core.ColumnDef{
+				{Name: "id", Type: core.ColumnID},
+				{Name: "client_id", Type: core.ColumnString, NotNull: true, Unique: true},
+				{Name: "secret_hash", Type: core.ColumnString},
+				{Name: "name", Type: core.ColumnString, NotNull: true},
+				{Name: "redirect_uris", Type: core.ColumnText, NotNull: true},
+				{Name: "scopes", Type: core.ColumnText, NotNull: true},
+				{Name: "is_public", Type: core.ColumnBool, Default: "false"},
+				{Name: "skip_consent", Type: core.ColumnBool, Default: "false"},
+				{Name: "created_at", Type: core.ColumnTimestamp, Default: core.DefaultNow},
+				{Name: "updated_at", Type: core.ColumnTimestamp, Default: core.DefaultNow, AutoUpdate: true},
+			},
+		},
+		{
+			Model: TableAuthorizationCodes,
+			Columns: []core.ColumnDef{
+				{Name: "id", Type: core.ColumnID},
+				{Name: "code_hash", Type: core.ColumnString, NotNull: true, Unique: true},
+				{Name: "client_id", Type: core.ColumnString, NotNull: true},
+				{Name: "user_id", Type: core.ColumnForeignID, NotNull: true},
+				{Name: "redirect_uri", Type: core.ColumnText, NotNull: true},
+				{Name: "scope", Type: core.ColumnText, NotNull: true},
+				{Name: "nonce", Type: core.ColumnText},
+				{Name: "code_challenge", Type: core.ColumnString},
+				{Name: "expires_at", Type: core.ColumnTimestamp, NotNull: true},
+				{Name: "created_at", Type: core.ColumnTimestamp, Default: core.DefaultNow},
+			},
+			ForeignKeys: []core.ForeignKeyDef{{Name: "FK_OAuthCode_User", Column: "user_id", Model: core.ModelUsers}},
+		},
+		{
+			Model: TableRefreshTokens,
+			Columns: []core.ColumnDef{
+				{Name: "id", Type: core.ColumnID},
+				{Name: "token_hash", Type: core.ColumnString, NotNull: true, Unique: true},
+				{Name: "client_id", Type: core.ColumnString, NotNull: true},
+				{Name: "user_id", Type: core.ColumnForeignID, NotNull: true},
+				{Name: "scope", Type: core.ColumnText, NotNull: true},
+				{Name: "expires_at", Type: core.ColumnTimestamp, NotNull: true},
+				{Name: "created_at", Type: core.ColumnTimestamp, Default: core.DefaultNow},
+			},
+			ForeignKeys: []core.ForeignKeyDef{{Name: "FK_OAuthRefreshToken_User", Column: "user_id", Model: core.ModelUsers}},
+		},
+	}
+}
@@ -0,0 +1,348 @@
+package oidcprovider
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/crypto"
+	"github.com/marshallshelly/beacon-auth/repo"
+)
+
+// accessTokenType is the typ header of access tokens (RFC 9068), so ID
+// tokens cannot be used as access tokens
+const accessTokenType = "at+jwt"
+
+var (
+	// ErrInvalidGrant is returned for authorization codes and refresh
+	// tokens that are unknown, expired, used or issued to another client
+	ErrInvalidGrant = errors.New("invalid grant")
+
+	// ErrInvalidToken is returned for access tokens that fail verification
+	ErrInvalidToken = errors.New("invalid access token")
+)
+
+// authorizationCodeRecord is a row of the oauth_authorization_codes table
+type authorizationCodeRecord struct {
+	ID            string    `db:"id"`
+	CodeHash      string    `db:"code_hash"`
+	ClientID      string    `db:"client_id"`
+	UserID        string    `db:"user_id"`
+	RedirectURI   string    `db:"redirect_uri"`
+	Scope         string    `db:"scope"`
+	Nonce         string    `db:"nonce,omitempty"`
+	CodeChallenge string    `db:"code_challenge,omitempty"`
+	ExpiresAt     time.Time `db:"expires_at"`
+	CreatedAt     time.Time `db:"created_at"`
+}
+
+// refreshTokenRecord is a row of the oauth_refresh_tokens table
+type refreshTokenRecord struct {
+	ID        string    `db:"id"`
+	TokenHash string    `db:"token_hash"`
+	ClientID  string    `db:"client_id"`
+	UserID    string    `db:"user_id"`
+	Scope     string    `db:"scope"`
+	ExpiresAt time.Time `db:"expires_at"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// tokenResponse is the token endpoint's response (RFC 6749 section 5.1)
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+// AccessTokenClaims are the claims of access tokens issued by the plugin
+type AccessTokenClaims struct {
+	ClientID string `json:"client_id"`
+	Scope    string `json:"scope"`
+	jwt.RegisteredClaims
+}
+
+// Scopes returns the granted scopes
+func (c *AccessTokenClaims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// createAuthorizationCode stores a code for the token endpoint
+func (p *OIDCProviderPlugin) createAuthorizationCode(ctx context.Context, req *authorizeRequest, userID string) (string, error) {
+	code, err := crypto.GenerateVerificationToken()
+	if err != nil {
+		return "", err
+	}
+	id, err := crypto.GenerateID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	_, err = repo.Create(ctx, p.ctx.Adapter, p.table(TableAuthorizationCodes), &authorizationCodeRecord{
+		ID:            id,
+		CodeHash:      hashToken(code),
+		ClientID:      req.Client.ID,
+		UserID:        userID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         strings.Join(req.Scopes, " "),
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     now.Add(p.opts.AuthorizationCodeTTL),
+		CreatedAt:     now,
+	})
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// redeemAuthorizationCode deletes a code and returns it. Of concurrent
+// requests for the same code, only the one whose delete removes the row
+// gets it.
+func (p *OIDCProviderPlugin) redeemAuthorizationCode(ctx context.Context, client *Client, code, redirectURI, codeVerifier string) (*authorizationCodeRecord, error) {
+	query := core.NewQuery(p.table(TableAuthorizationCodes)).
+		Where("code_hash", core.OpEqual, hashToken(code)).
+		Build()
+
+	record, err := repo.FindOne[authorizationCodeRecord](ctx, p.ctx.Adapter, query)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, ErrInvalidGrant
+	}
+	deleted, err := p.ctx.Adapter.DeleteMany(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if deleted == 0 || time.Now().After(record.ExpiresAt) {
+		return nil, ErrInvalidGrant
+	}
+
+	if record.ClientID != client.ID || record.RedirectURI != redirectURI {
+		return nil, ErrInvalidGrant
+	}
+	if record.CodeChallenge != "" && !crypto.ConstantTimeEqual(codeChallenge(codeVerifier), record.CodeChallenge) {
+		return nil, ErrInvalidGrant
+	}
+	return record, nil
+}
+
+// createRefreshToken stores a refresh token
+func (p *OIDCProviderPlugin) createRefreshToken(ctx context.Context, clientID, userID, scope string) (string, error) {
+	token, err := crypto.GenerateVerificationToken()
+	if err != nil {
+		return "", err
+	}
+	id, err := crypto.GenerateID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	_, err = repo.Create(ctx, p.ctx.Adapter, p.table(TableRefreshTokens), &refreshTokenRecord{
+		ID:        id,
+		TokenHash: hashToken(token),
+		ClientID:  clientID,
+		UserID:    userID,
+		Scope:     scope,
+		ExpiresAt: now.Add(p.opts.RefreshTokenTTL),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// redeemRefreshToken deletes a refresh token and returns it. Refresh
+// tokens are rotated, so each is used once.
+func (p *OIDCProviderPlugin) redeemRefreshToken(ctx context.Context, client *Client, token string) (*refreshTokenRecord, error) {
+	query := core.NewQuery(p.table(TableRefreshTokens)).
+		Where("token_hash", core.OpEqual, hashToken(token)).
+		Where("client_id", core.OpEqual, client.ID).
+		Build()
+
+	record, err := repo.FindOne[refreshTokenRecord](ctx, p.ctx.Adapter, query)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, ErrInvalidGrant
+	}
+	deleted, err := p.ctx.Adapter.DeleteMany(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if deleted == 0 || time.Now().After(record.ExpiresAt) {
+		return nil, ErrInvalidGrant
+	}
+	return record, nil
+}
+
+// RevokeUserTokens deletes every refresh token issued to a user, e.g.
+// when they sign out everywhere. Access tokens stay valid until they
+// expire.
+func (p *OIDCProviderPlugin) RevokeUserTokens(ctx context.Context, userID string) error {
+	_, err := p.ctx.Adapter.DeleteMany(ctx, core.NewQuery(p.table(TableRefreshTokens)).
+		Where("user_id", core.OpEqual, userID).
+		Build())
+	return err
+}
+
+// issueTokens returns an access token, an ID token when openid was
+// granted, and a refresh token when offline_access was granted
+func (p *OIDCProviderPlugin) issueTokens(ctx context.Context, client *Client, user *core.User, scope, nonce string) (*tokenResponse, error) {
+	now := time.Now()
+	scopes := strings.Fields(scope)
+
+	jti, err := crypto.GenerateID()
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := p.sign(accessTokenType, &AccessTokenClaims{
+		ClientID: client.ID,
+		Scope:    scope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    p.opts.Issuer,
+			Subject:   user.ID,
+			Audience:  jwt.ClaimStrings{client.ID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(p.opts.AccessTokenTTL)),
+			ID:        jti,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &tokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(p.opts.AccessTokenTTL / time.Second),
+		Scope:       scope,
+	}
+
+	if slices.Contains(scopes, ScopeOpenID) {
+		claims := userClaims(user, scopes)
+		claims["iss"] = p.opts.Issuer
+		claims["aud"] = client.ID
+		claims["iat"] = now.Unix()
+		claims["exp"] = now.Add(p.opts.IDTokenTTL).Unix()
+		if nonce != "" {
+			claims["nonce"] = nonce
+		}
+		resp.IDToken, err = p.sign("JWT", claims)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if slices.Contains(scopes, ScopeOfflineAccess) {
+		resp.RefreshToken, err = p.createRefreshToken(ctx, client.ID, user.ID, scope)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+// VerifyAccessToken checks an access token's signature, issuer, type and
+// expiry, for resource servers that share the plugin
+func (p *OIDCProviderPlugin) VerifyAccessToken(token string) (*AccessTokenClaims, error) {
+	claims := &AccessTokenClaims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if typ, _ := t.Header["typ"].(string); typ != accessTokenType {
+			return nil, ErrInvalidToken
+		}
+		return &p.signingKey.PublicKey, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(p.opts.Issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || !parsed.Valid {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func (p *OIDCProviderPlugin) sign(typ string, claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["typ"] = typ
+	token.Header["kid"] = p.keyID
+	return token.SignedString(p.signingKey)
+}
+
+// userClaims returns the standard claims of a user allowed by scopes
+func userClaims(user *core.User, scopes []string) jwt.MapClaims {
+	claims := jwt.MapClaims{"sub": user.ID}
+	if slices.Contains(scopes, ScopeEmail) {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.EmailVerified
+	}
+	if slices.Contains(scopes, ScopeProfile) {
+		if user.Name != "" {
+			claims["name"] = user.Name
+		}
+		if user.Image != "" {
+			claims["picture"] = user.Image
+		}
+		claims["updated_at"] = user.UpdatedAt.Unix()
+	}
+	return claims
+}
+
+// jwk is an RSA public key in JWK form
+type jwk struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func publicJWK(key *rsa.PublicKey, kid string) jwk {
+	return jwk{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: jwt.SigningMethodRS256.Alg(),
+		Kid: kid,
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// keyThumbprint returns the RFC 7638 thumbprint of a key, the default key
+// ID
+func keyThumbprint(key *rsa.PublicKey) string {
+	k := publicJWK(key, "")
+	// Members in lexicographic order, without whitespace
+	data, _ := json.Marshal(struct {
+		E   string `json:"e"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+	}{k.E, k.Kty, k.N})
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// codeChallenge returns the S256 PKCE challenge of a verifier
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
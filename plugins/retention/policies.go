@@ -0,0 +1,127 @@
+package retention
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// orphanBatchSize is how many sessions deleteOrphanedSessions reads at a
+// time
+const orphanBatchSize = 500
+
+// purgeVerifications deletes verification tokens that expired more than
+// PurgeVerificationsAfter ago, whatever their purpose
+func (p *RetentionPlugin) purgeVerifications(ctx context.Context) (int64, error) {
+	query := core.NewQuery(p.table(core.ModelVerifications)).
+		Where("expires_at", core.OpLessThan, time.Now().Add(-p.opts.PurgeVerificationsAfter)).
+		Build()
+	return p.ctx.Adapter.DeleteMany(ctx, query)
+}
+
+// deleteOrphanedSessions deletes the sessions of users that no longer
+// exist. It walks the sessions table in user ID order, so sessions created
+// during the walk are checked on the next run. IDs are queried as the
+// database returns them, so integer IDs are compared as integers.
+func (p *RetentionPlugin) deleteOrphanedSessions(ctx context.Context) (int64, error) {
+	sessions := p.table(core.ModelSessions)
+	users := p.table(core.ModelUsers)
+
+	var deleted int64
+	var after interface{}
+	for {
+		q := core.NewQuery(sessions).Select("user_id")
+		if after != nil {
+			q.Where("user_id", core.OpGreaterThan, after)
+		}
+		rows, err := p.ctx.Adapter.FindMany(ctx, q.OrderBy("user_id", false).Limit(orphanBatchSize).Build())
+		if err != nil {
+			return deleted, err
+		}
+		if len(rows) == 0 {
+			return deleted, nil
+		}
+
+		// The rows are ordered by user ID, so the last one is the cursor
+		after = rows[len(rows)-1]["user_id"]
+		if after == nil {
+			return deleted, nil
+		}
+
+		// Orphans by normalized ID, with the ID as stored
+		var userIDs []interface{}
+		orphans := make(map[string]interface{})
+		for _, row := range rows {
+			userID := idString(row["user_id"])
+			if _, ok := orphans[userID]; userID != "" && !ok {
+				orphans[userID] = row["user_id"]
+				userIDs = append(userIDs, row["user_id"])
+			}
+		}
+
+		if len(userIDs) == 0 {
+			return deleted, nil
+		}
+
+		existing, err := p.ctx.Adapter.FindMany(ctx, core.NewQuery(users).
+			Select("id").
+			Where("id", core.OpIn, userIDs).
+			Build())
+		if err != nil {
+			return deleted, err
+		}
+		for _, row := range existing {
+			delete(orphans, idString(row["id"]))
+		}
+
+		for userID, stored := range orphans {
+			n, err := p.ctx.Adapter.DeleteMany(ctx, core.NewQuery(sessions).
+				Where("user_id", core.OpEqual, stored).
+				Build())
+			if err != nil {
+				return deleted, err
+			}
+			deleted += n
+
+			// Drop the sessions from cache layers too
+			if p.ctx.SessionManager != nil {
+				if err := p.ctx.SessionManager.DeleteByUserID(ctx, userID); err != nil {
+					p.ctx.Logger.Warn("Failed to delete cached sessions", "user_id", userID, "error", err)
+				}
+			}
+		}
+
+		if len(rows) < orphanBatchSize {
+			return deleted, nil
+		}
+	}
+}
+
+// idString normalizes an ID read from the database: string IDs as they
+// are, and the integers of database-generated IDs in decimal
+func idString(v interface{}) string {
+	switch id := v.(type) {
+	case string:
+		return id
+	case []byte:
+		return string(id)
+	case int:
+		return strconv.Itoa(id)
+	case int32:
+		return strconv.FormatInt(int64(id), 10)
+	case int64:
+		return strconv.FormatInt(id, 10)
+	case uint64:
+		return strconv.FormatUint(id, 10)
+	case float64:
+		return strconv.FormatFloat(id, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
+
+func (p *RetentionPlugin) table(name string) string {
+	return p.ctx.Config.TableNames.Table(name)
+}
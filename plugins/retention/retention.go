@@ -0,0 +1,337 @@
+// Package retention deletes and anonymizes data once it is no longer
+// needed, to meet data retention requirements. Retention policies run on a
+// schedule and each keeps metrics of its runs.
+//
+//	auth, err := beaconauth.New(
+//		beaconauth.WithPlugins(
+//			emailpassword.New(),
+//			admin.New(nil),
+//			retention.New(&retention.Options{
+//				PurgeVerificationsAfter: 7 * 24 * time.Hour,
+//				AnonymizeAuditLogsAfter: 90 * 24 * time.Hour,
+//				DeleteOrphanedSessions:  true,
+//			}),
+//		),
+//	)
+//	// GET /auth/admin/retention reports the metrics of every policy
+//
+// Policies are idempotent, so every instance of an application can run
+// them.
+package retention
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/plugin"
+)
+
+// Names of the built-in policies
+const (
+	PolicyPurgeVerifications     = "purge_verifications"
+	PolicyAnonymizeAuditLogs     = "anonymize_audit_logs"
+	PolicyDeleteOrphanedSessions = "delete_orphaned_sessions"
+)
+
+// Policy is a retention rule
+type Policy struct {
+	// Name identifies the policy in metrics and logs
+	Name string
+
+	// Apply deletes or anonymizes the data the policy covers and returns
+	// how many records it changed
+	Apply func(ctx context.Context) (int64, error)
+}
+
+// AuditLogAnonymizer is implemented by plugins with an audit log, such as
+// the admin plugin. AnonymizeAuditLogs removes the personal data of
+// entries created before cutoff and returns how many it changed.
+type AuditLogAnonymizer interface {
+	AnonymizeAuditLogs(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// Options configures the retention policies. Durations of zero disable
+// their policy.
+type Options struct {
+	// Interval is how often the policies run (default 1 hour)
+	Interval time.Duration `yaml:"interval"`
+
+	// PurgeVerificationsAfter deletes verification tokens (email
+	// verification, password reset, magic link and invite tokens) this
+	// long after they expire
+	PurgeVerificationsAfter time.Duration `yaml:"purge_verifications_after"`
+
+	// AnonymizeAuditLogsAfter anonymizes audit log entries this long after
+	// they are recorded. It needs a plugin implementing
+	// AuditLogAnonymizer, such as the admin plugin.
+	AnonymizeAuditLogsAfter time.Duration `yaml:"anonymize_audit_logs_after"`
+
+	// DeleteOrphanedSessions deletes the sessions of users that no longer
+	// exist from the sessions table
+	DeleteOrphanedSessions bool `yaml:"delete_orphaned_sessions"`
+
+	// Policies are run after the built-in policies
+	Policies []Policy `yaml:"-"`
+
+	// OnRun is called after every policy run, e.g. to export metrics
+	OnRun func(run Run) `yaml:"-"`
+}
+
+// Run is the result of running a policy once
+type Run struct {
+	Policy   string
+	Affected int64
+	Duration time.Duration
+	Err      error
+}
+
+// Metrics are the counters of a policy's runs
+type Metrics struct {
+	Runs     int64 `json:"runs"`
+	Failures int64 `json:"failures"`
+
+	// Affected is the total number of records the policy changed
+	Affected int64 `json:"affected"`
+
+	LastRun      time.Time     `json:"lastRun,omitempty"`
+	LastDuration time.Duration `json:"lastDuration"`
+	LastAffected int64         `json:"lastAffected"`
+	LastError    string        `json:"lastError,omitempty"`
+}
+
+// RetentionPlugin runs the retention policies
+type RetentionPlugin struct {
+	*plugin.BasePlugin
+	ctx      *core.AuthContext
+	opts     Options
+	policies []Policy
+
+	// runMu keeps runs from overlapping
+	runMu sync.Mutex
+
+	mu      sync.Mutex
+	metrics map[string]*Metrics
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New creates the retention plugin
+func New(opts *Options) *RetentionPlugin {
+	o := Options{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Interval == 0 {
+		o.Interval = time.Hour
+	}
+
+	return &RetentionPlugin{
+		BasePlugin: plugin.NewBasePlugin("retention"),
+		opts:       o,
+	}
+}
+
+// Config returns the plugin's options, which the retention section of the
+// config file sets
+func (p *RetentionPlugin) Config() interface{} {
+	return &p.opts
+}
+
+// ValidateConfig checks the options
+func (p *RetentionPlugin) ValidateConfig() error {
+	if p.opts.Interval < 0 || p.opts.PurgeVerificationsAfter < 0 || p.opts.AnonymizeAuditLogsAfter < 0 {
+		return errors.New("retention: durations must not be negative")
+	}
+	seen := make(map[string]bool)
+	for _, policy := range p.opts.Policies {
+		if policy.Name == "" || policy.Apply == nil {
+			return errors.New("retention: policies need a name and an Apply function")
+		}
+		if seen[policy.Name] {
+			return fmt.Errorf("retention: duplicate policy %q", policy.Name)
+		}
+		seen[policy.Name] = true
+	}
+	return nil
+}
+
+// Init builds the configured policies and starts running them every
+// Interval
+func (p *RetentionPlugin) Init(ctx *core.AuthContext) error {
+	p.ctx = ctx
+
+	var policies []Policy
+	if p.opts.PurgeVerificationsAfter > 0 {
+		policies = append(policies, Policy{Name: PolicyPurgeVerifications, Apply: p.purgeVerifications})
+	}
+	if p.opts.AnonymizeAuditLogsAfter > 0 {
+		anonymizer := p.auditLogAnonymizer()
+		if anonymizer == nil {
+			return errors.New("retention: anonymize_audit_logs_after needs a plugin with an audit log, such as admin")
+		}
+		after := p.opts.AnonymizeAuditLogsAfter
+		policies = append(policies, Policy{Name: PolicyAnonymizeAuditLogs, Apply: func(ctx context.Context) (int64, error) {
+			return anonymizer.AnonymizeAuditLogs(ctx, time.Now().Add(-after))
+		}})
+	}
+	if p.opts.DeleteOrphanedSessions {
+		if ctx.Config.UserStore != nil {
+			// Every session would look orphaned
+			return errors.New("retention: delete_orphaned_sessions needs users in the users table, not a UserStore")
+		}
+		policies = append(policies, Policy{Name: PolicyDeleteOrphanedSessions, Apply: p.deleteOrphanedSessions})
+	}
+	p.policies = append(policies, p.opts.Policies...)
+
+	p.metrics = make(map[string]*Metrics, len(p.policies))
+	for _, policy := range p.policies {
+		if _, ok := p.metrics[policy.Name]; ok {
+			return fmt.Errorf("retention: duplicate policy %q", policy.Name)
+		}
+		p.metrics[policy.Name] = &Metrics{}
+	}
+
+	if len(p.policies) > 0 {
+		p.stop = make(chan struct{})
+		p.done = make(chan struct{})
+		go p.runScheduler(p.opts.Interval)
+	}
+	return nil
+}
+
+// DescribeSecurity reports the enabled policies
+func (p *RetentionPlugin) DescribeSecurity() map[string]interface{} {
+	names := make([]string, len(p.policies))
+	for i, policy := range p.policies {
+		names[i] = policy.Name
+	}
+	return map[string]interface{}{
+		"policies": names,
+		"interval": p.opts.Interval.String(),
+	}
+}
+
+// Endpoints returns the metrics endpoint
+func (p *RetentionPlugin) Endpoints() map[string]plugin.Endpoint {
+	return map[string]plugin.Endpoint{
+		"/admin/retention": {Method: "GET", Handler: p.handleMetrics, Auth: core.AuthAdmin},
+	}
+}
+
+// Close stops the scheduler, waiting for a running policy to finish
+func (p *RetentionPlugin) Close() error {
+	if p.stop != nil {
+		p.closeOnce.Do(func() {
+			close(p.stop)
+			<-p.done
+		})
+	}
+	return nil
+}
+
+// RunOnce runs every policy now. A failing policy does not stop the
+// others; their errors are returned together.
+func (p *RetentionPlugin) RunOnce(ctx context.Context) error {
+	p.runMu.Lock()
+	defer p.runMu.Unlock()
+
+	var errs []error
+	for _, policy := range p.policies {
+		if err := p.apply(ctx, policy); err != nil {
+			errs = append(errs, fmt.Errorf("retention: %s: %w", policy.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Metrics returns the metrics of every policy by name
+func (p *RetentionPlugin) Metrics() map[string]Metrics {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	metrics := make(map[string]Metrics, len(p.metrics))
+	for name, m := range p.metrics {
+		metrics[name] = *m
+	}
+	return metrics
+}
+
+// apply runs a policy and records its metrics
+func (p *RetentionPlugin) apply(ctx context.Context, policy Policy) error {
+	start := time.Now()
+	affected, err := policy.Apply(ctx)
+	run := Run{Policy: policy.Name, Affected: affected, Duration: time.Since(start), Err: err}
+
+	p.mu.Lock()
+	m := p.metrics[policy.Name]
+	m.Runs++
+	m.Affected += affected
+	m.LastRun = start
+	m.LastDuration = run.Duration
+	m.LastAffected = affected
+	m.LastError = ""
+	if err != nil {
+		m.Failures++
+		m.LastError = err.Error()
+	}
+	p.mu.Unlock()
+
+	if p.opts.OnRun != nil {
+		p.opts.OnRun(run)
+	}
+	return err
+}
+
+func (p *RetentionPlugin) runScheduler(interval time.Duration) {
+	defer close(p.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := p.RunOnce(context.Background()); err != nil {
+				p.ctx.Logger.Error("Retention policies failed", "error", err) // Retried next tick
+			}
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// auditLogAnonymizer returns the first registered plugin with an audit log
+func (p *RetentionPlugin) auditLogAnonymizer() AuditLogAnonymizer {
+	for _, registered := range p.ctx.Config.Plugins {
+		if anonymizer, ok := registered.(AuditLogAnonymizer); ok {
+			return anonymizer
+		}
+	}
+	return nil
+}
+
+// handleMetrics lists the metrics of every policy, sorted by name
+func (p *RetentionPlugin) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	type policyMetrics struct {
+		Policy string `json:"policy"`
+		Metrics
+	}
+	metrics := p.Metrics()
+	data := make([]policyMetrics, 0, len(metrics))
+	for name, m := range metrics {
+		data = append(data, policyMetrics{Policy: name, Metrics: m})
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].Policy < data[j].Policy })
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"policies": data})
+}
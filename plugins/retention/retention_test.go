@@ -0,0 +1,256 @@
+package retention_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	beaconauth "github.com/marshallshelly/beacon-auth"
+	"github.com/marshallshelly/beacon-auth/adapters/sqlite"
+	"github.com/marshallshelly/beacon-auth/cmd/beacon/schema"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/plugins/admin"
+	"github.com/marshallshelly/beacon-auth/plugins/emailpassword"
+	"github.com/marshallshelly/beacon-auth/plugins/retention"
+	"github.com/marshallshelly/beacon-auth/repo"
+)
+
+type silentLogger struct{}
+
+func (silentLogger) Debug(string, ...interface{}) {}
+func (silentLogger) Info(string, ...interface{})  {}
+func (silentLogger) Warn(string, ...interface{})  {}
+func (silentLogger) Error(string, ...interface{}) {}
+
+func newTestAuth(t *testing.T, opts *retention.Options) (core.Auth, core.Adapter, *retention.RetentionPlugin) {
+	return newTestAuthWithIDs(t, opts, "")
+}
+
+// newTestAuthWithIDs is newTestAuth on a schema with idType IDs, e.g.
+// "serial"
+func newTestAuthWithIDs(t *testing.T, opts *retention.Options, idType string) (core.Auth, core.Adapter, *retention.RetentionPlugin) {
+	t.Helper()
+	ctx := context.Background()
+	db, err := sqlite.New(ctx, &sqlite.Config{InMemory: true})
+	if err != nil {
+		t.Fatalf("sqlite.New() error = %v", err)
+	}
+	script, err := schema.GenerateSQL(&schema.Config{Adapter: "sqlite", IDType: idType, Plugins: []string{"admin"}})
+	if err != nil {
+		t.Fatalf("GenerateSQL() error = %v", err)
+	}
+	for _, stmt := range schema.SplitStatements(script, "sqlite") {
+		if err := db.Exec(ctx, stmt); err != nil {
+			t.Fatalf("Exec() error = %v", err)
+		}
+	}
+
+	p := retention.New(opts)
+	auth, err := beaconauth.New(
+		beaconauth.WithAdapter(db),
+		beaconauth.WithSecret("test-secret-key-that-is-long-enough"),
+		beaconauth.WithBaseURL("http://localhost:8080"),
+		beaconauth.WithPlugins(emailpassword.New(), admin.New(&admin.Options{DisableAuditLog: true}), p),
+		beaconauth.WithLogger(silentLogger{}),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { auth.Close() })
+	return auth, db, p
+}
+
+func register(t *testing.T, auth core.Auth, email string) string {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/auth/register", strings.NewReader(`{"email":"`+email+`","password":"secret-password"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	auth.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("register: status %d: %s", rec.Code, rec.Body)
+	}
+	var user core.User
+	_ = json.Unmarshal(rec.Body.Bytes(), &user)
+	return user.ID
+}
+
+func count(t *testing.T, db core.Adapter, q *core.QueryBuilder) int64 {
+	t.Helper()
+	n, err := db.Count(context.Background(), q.Build())
+	if err != nil {
+		t.Fatalf("Count() error = %v", err)
+	}
+	return n
+}
+
+func TestRetention_Policies(t *testing.T) {
+	auth, db, p := newTestAuth(t, &retention.Options{
+		PurgeVerificationsAfter: 7 * 24 * time.Hour,
+		AnonymizeAuditLogsAfter: 30 * 24 * time.Hour,
+		DeleteOrphanedSessions:  true,
+	})
+	ctx := context.Background()
+	now := time.Now()
+
+	for i, expires := range []time.Time{now.Add(-8 * 24 * time.Hour), now.Add(-time.Hour), now.Add(time.Hour)} {
+		_, err := repo.Create(ctx, db, core.ModelVerifications, &core.Verification{
+			ID: string(rune('a' + i)), Identifier: "ana@example.com", Token: string(rune('a' + i)),
+			Type: "email_verification", ExpiresAt: expires, CreatedAt: now, UpdatedAt: now,
+		})
+		if err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	for i, created := range []time.Time{now.Add(-31 * 24 * time.Hour), now} {
+		_, err := db.Create(ctx, admin.TableAuditLogs, map[string]interface{}{
+			"id": string(rune('a' + i)), "event": core.TopicSignIn, "user_id": "user-1",
+			"ip_address": "203.0.113.7", "user_agent": "curl", "details": `{"method":"password"}`,
+			"anonymized": false, "created_at": created,
+		})
+		if err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	ana := register(t, auth, "ana@example.com")
+	ben := register(t, auth, "ben@example.com")
+	if err := db.Delete(ctx, core.NewQuery(core.ModelUsers).Where("id", core.OpEqual, ben).Build()); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	if err := p.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+
+	if n := count(t, db, core.NewQuery(core.ModelVerifications)); n != 2 {
+		t.Errorf("%d verifications left, want 2", n)
+	}
+	if n := count(t, db, core.NewQuery(core.ModelSessions).Where("user_id", core.OpEqual, ben)); n != 0 {
+		t.Errorf("%d sessions of the deleted user left", n)
+	}
+	if n := count(t, db, core.NewQuery(core.ModelSessions).Where("user_id", core.OpEqual, ana)); n != 1 {
+		t.Errorf("%d sessions of an existing user left, want 1", n)
+	}
+
+	logs, err := db.FindMany(ctx, core.NewQuery(admin.TableAuditLogs).OrderBy("created_at", false).Build())
+	if err != nil {
+		t.Fatalf("FindMany() error = %v", err)
+	}
+	if old := logs[0]; old["user_id"] != nil || old["ip_address"] != nil || old["details"] != nil || old["event"] != core.TopicSignIn {
+		t.Errorf("old entry not anonymized: %v", old)
+	}
+	if recent := logs[1]; recent["user_id"] != "user-1" || recent["ip_address"] != "203.0.113.7" {
+		t.Errorf("recent entry anonymized: %v", recent)
+	}
+
+	metrics := p.Metrics()
+	for name, affected := range map[string]int64{
+		retention.PolicyPurgeVerifications:     1,
+		retention.PolicyAnonymizeAuditLogs:     1,
+		retention.PolicyDeleteOrphanedSessions: 1,
+	} {
+		if m := metrics[name]; m.Runs != 1 || m.Affected != affected || m.LastRun.IsZero() {
+			t.Errorf("%s metrics = %+v, want 1 run affecting %d", name, m, affected)
+		}
+	}
+
+	// Policies are idempotent
+	if err := p.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+	if m := p.Metrics()[retention.PolicyAnonymizeAuditLogs]; m.Runs != 2 || m.Affected != 1 || m.LastAffected != 0 {
+		t.Errorf("second run metrics = %+v", m)
+	}
+}
+
+func TestRetention_OrphanedSessionsSerialIDs(t *testing.T) {
+	_, db, p := newTestAuthWithIDs(t, &retention.Options{DeleteOrphanedSessions: true}, "serial")
+	ctx := context.Background()
+	now := time.Now()
+
+	// Users 1 to 12, so string order (1, 10, 11, 12, 2, ...) differs from
+	// the database's; even users are deleted
+	for i := 1; i <= 12; i++ {
+		if _, err := db.Create(ctx, core.ModelUsers, map[string]interface{}{
+			"email": fmt.Sprintf("user%d@example.com", i), "created_at": now, "updated_at": now,
+		}); err != nil {
+			t.Fatalf("Create() user error = %v", err)
+		}
+		if _, err := db.Create(ctx, core.ModelSessions, map[string]interface{}{
+			"user_id": i, "token": fmt.Sprintf("token-%d", i), "expires_at": now.Add(time.Hour),
+			"created_at": now, "updated_at": now,
+		}); err != nil {
+			t.Fatalf("Create() session error = %v", err)
+		}
+	}
+	for i := 2; i <= 12; i += 2 {
+		if err := db.Delete(ctx, core.NewQuery(core.ModelUsers).Where("id", core.OpEqual, i).Build()); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+	}
+
+	if err := p.RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+	if m := p.Metrics()[retention.PolicyDeleteOrphanedSessions]; m.Affected != 6 {
+		t.Errorf("deleted %d orphaned sessions, want 6", m.Affected)
+	}
+	for i := 1; i <= 12; i++ {
+		want := int64(i % 2) // Odd users still exist
+		if n := count(t, db, core.NewQuery(core.ModelSessions).Where("user_id", core.OpEqual, i)); n != want {
+			t.Errorf("user %d has %d sessions, want %d", i, n, want)
+		}
+	}
+}
+
+func TestRetention_CustomPolicyFailure(t *testing.T) {
+	var runs []retention.Run
+	failure := errors.New("storage unavailable")
+	_, _, p := newTestAuth(t, &retention.Options{
+		Policies: []retention.Policy{
+			{Name: "failing", Apply: func(context.Context) (int64, error) { return 0, failure }},
+			{Name: "working", Apply: func(context.Context) (int64, error) { return 3, nil }},
+		},
+		OnRun: func(run retention.Run) { runs = append(runs, run) },
+	})
+
+	if err := p.RunOnce(context.Background()); !errors.Is(err, failure) {
+		t.Fatalf("RunOnce() error = %v, want the policy's error", err)
+	}
+	if len(runs) != 2 || runs[0].Err == nil || runs[1].Affected != 3 {
+		t.Errorf("OnRun got %+v", runs)
+	}
+	metrics := p.Metrics()
+	if m := metrics["failing"]; m.Failures != 1 || m.LastError != failure.Error() {
+		t.Errorf("failing metrics = %+v", m)
+	}
+	if m := metrics["working"]; m.Failures != 0 || m.Affected != 3 {
+		t.Errorf("working metrics = %+v", m)
+	}
+}
+
+func TestRetention_Config(t *testing.T) {
+	noop := func(context.Context) (int64, error) { return 0, nil }
+	for name, opts := range map[string]*retention.Options{
+		"negative duration": {PurgeVerificationsAfter: -time.Hour},
+		"unnamed policy":    {Policies: []retention.Policy{{Apply: noop}}},
+		"duplicate policy":  {Policies: []retention.Policy{{Name: "a", Apply: noop}, {Name: "a", Apply: noop}}},
+	} {
+		if err := retention.New(opts).ValidateConfig(); err == nil {
+			t.Errorf("%s: ValidateConfig accepted %+v", name, opts)
+		}
+	}
+
+	p := retention.New(&retention.Options{AnonymizeAuditLogsAfter: time.Hour})
+	ctx := &core.AuthContext{Config: &core.Config{}, Logger: silentLogger{}}
+	if err := p.Init(ctx); err == nil {
+		t.Error("Init accepted audit log anonymization without an audit log")
+	}
+}
@@ -0,0 +1,163 @@
+package saml
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const (
+	nsMetadata = "urn:oasis:names:tc:SAML:2.0:metadata"
+
+	bindingHTTPRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	bindingHTTPPOST     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+)
+
+// maxMetadataSize limits how much of a metadata document FetchMetadata reads
+const maxMetadataSize = 1 << 20
+
+// entityDescriptor is the part of an IdP metadata document the plugin uses
+type entityDescriptor struct {
+	XMLName           xml.Name           `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID          string             `xml:"entityID,attr"`
+	IDPSSODescriptors []idpSSODescriptor `xml:"urn:oasis:names:tc:SAML:2.0:metadata IDPSSODescriptor"`
+}
+
+type idpSSODescriptor struct {
+	KeyDescriptors       []keyDescriptor   `xml:"urn:oasis:names:tc:SAML:2.0:metadata KeyDescriptor"`
+	SingleSignOnServices []metadataService `xml:"urn:oasis:names:tc:SAML:2.0:metadata SingleSignOnService"`
+}
+
+type keyDescriptor struct {
+	Use          string   `xml:"use,attr"`
+	Certificates []string `xml:"http://www.w3.org/2000/09/xmldsig# KeyInfo>X509Data>X509Certificate"`
+}
+
+type metadataService struct {
+	Binding  string `xml:"Binding,attr"`
+	Location string `xml:"Location,attr"`
+}
+
+// ParseMetadata reads an identity provider's entity ID, HTTP-Redirect
+// single sign-on URL and signing certificates from its metadata. The
+// returned provider still needs an ID. Metadata is trusted as given, so
+// load it from the IdP over HTTPS or from a file its admin provided.
+func ParseMetadata(data []byte) (*IdentityProvider, error) {
+	var desc entityDescriptor
+	if err := xml.Unmarshal(data, &desc); err != nil {
+		return nil, fmt.Errorf("saml: invalid metadata: %w", err)
+	}
+	if desc.EntityID == "" {
+		return nil, errors.New("saml: metadata has no entityID")
+	}
+	if len(desc.IDPSSODescriptors) == 0 {
+		return nil, errors.New("saml: metadata has no IDPSSODescriptor")
+	}
+
+	idp := &IdentityProvider{EntityID: desc.EntityID}
+	for _, sso := range desc.IDPSSODescriptors {
+		for _, service := range sso.SingleSignOnServices {
+			if service.Binding == bindingHTTPRedirect && idp.SSOURL == "" {
+				idp.SSOURL = service.Location
+			}
+		}
+		for _, key := range sso.KeyDescriptors {
+			if key.Use != "" && key.Use != "signing" {
+				continue
+			}
+			for _, encoded := range key.Certificates {
+				der, err := decodeBase64(encoded)
+				if err != nil {
+					return nil, fmt.Errorf("saml: invalid certificate in metadata: %w", err)
+				}
+				cert, err := x509.ParseCertificate(der)
+				if err != nil {
+					return nil, fmt.Errorf("saml: invalid certificate in metadata: %w", err)
+				}
+				idp.Certificates = append(idp.Certificates, cert)
+			}
+		}
+	}
+
+	if idp.SSOURL == "" {
+		return nil, errors.New("saml: metadata has no HTTP-Redirect SingleSignOnService")
+	}
+	if len(idp.Certificates) == 0 {
+		return nil, errors.New("saml: metadata has no signing certificate")
+	}
+	return idp, nil
+}
+
+// FetchMetadata downloads and parses an identity provider's metadata.
+// client may be nil for http.DefaultClient.
+func FetchMetadata(ctx context.Context, client *http.Client, metadataURL string) (*IdentityProvider, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("saml: fetching metadata: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxMetadataSize))
+	if err != nil {
+		return nil, err
+	}
+	return ParseMetadata(data)
+}
+
+// spMetadata is the service provider metadata served to identity
+// providers
+type spMetadata struct {
+	XMLName         xml.Name        `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID        string          `xml:"entityID,attr"`
+	SPSSODescriptor spSSODescriptor `xml:"SPSSODescriptor"`
+}
+
+type spSSODescriptor struct {
+	AuthnRequestsSigned        bool                     `xml:"AuthnRequestsSigned,attr"`
+	WantAssertionsSigned       bool                     `xml:"WantAssertionsSigned,attr"`
+	ProtocolSupportEnumeration string                   `xml:"protocolSupportEnumeration,attr"`
+	NameIDFormat               string                   `xml:"NameIDFormat,omitempty"`
+	AssertionConsumerService   assertionConsumerService `xml:"AssertionConsumerService"`
+}
+
+type assertionConsumerService struct {
+	Binding   string `xml:"Binding,attr"`
+	Location  string `xml:"Location,attr"`
+	Index     int    `xml:"index,attr"`
+	IsDefault bool   `xml:"isDefault,attr"`
+}
+
+// metadata returns the service provider metadata for an identity provider
+func (p *SAMLPlugin) metadata(idp *IdentityProvider) ([]byte, error) {
+	data, err := xml.MarshalIndent(&spMetadata{
+		EntityID: p.entityID(idp),
+		SPSSODescriptor: spSSODescriptor{
+			WantAssertionsSigned:       true,
+			ProtocolSupportEnumeration: nsProtocol,
+			NameIDFormat:               idp.NameIDFormat,
+			AssertionConsumerService: assertionConsumerService{
+				Binding:   bindingHTTPPOST,
+				Location:  p.acsURL(idp),
+				IsDefault: true,
+			},
+		},
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
@@ -0,0 +1,188 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/crypto"
+	"github.com/marshallshelly/beacon-auth/repo"
+)
+
+// verificationType marks pending AuthnRequests in the verifications table
+const verificationType = "saml_request"
+
+// maxIdentifierLength is the size of the verifications identifier column
+const maxIdentifierLength = 255
+
+// authnRequest is a SAML AuthnRequest, sent with the HTTP-Redirect binding
+type authnRequest struct {
+	XMLName                     xml.Name      `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID                          string        `xml:"ID,attr"`
+	Version                     string        `xml:"Version,attr"`
+	IssueInstant                string        `xml:"IssueInstant,attr"`
+	Destination                 string        `xml:"Destination,attr"`
+	AssertionConsumerServiceURL string        `xml:"AssertionConsumerServiceURL,attr"`
+	ProtocolBinding             string        `xml:"ProtocolBinding,attr"`
+	Issuer                      issuer        `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	NameIDPolicy                *nameIDPolicy `xml:"NameIDPolicy,omitempty"`
+}
+
+type issuer struct {
+	Value string `xml:",chardata"`
+}
+
+type nameIDPolicy struct {
+	Format      string `xml:"Format,attr,omitempty"`
+	AllowCreate bool   `xml:"AllowCreate,attr"`
+}
+
+// pendingRequest is what the login endpoint remembers for the assertion
+// consumer service. It is stored as JSON with one-letter keys to fit the
+// verifications identifier column.
+type pendingRequest struct {
+	ProviderID string `json:"p"`
+	RedirectTo string `json:"r,omitempty"`
+}
+
+// verificationRecord is a row of the verifications table
+type verificationRecord struct {
+	ID         string    `db:"id"`
+	Identifier string    `db:"identifier"`
+	Token      string    `db:"token"`
+	Type       string    `db:"type"`
+	ExpiresAt  time.Time `db:"expires_at"`
+	CreatedAt  time.Time `db:"created_at"`
+	UpdatedAt  time.Time `db:"updated_at"`
+}
+
+// newRequestID returns an AuthnRequest ID. IDs must be XML names, which
+// cannot start with a digit.
+func newRequestID() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "_" + hex.EncodeToString(b), nil
+}
+
+// authnRequestURL returns the identity provider URL that starts sign-in
+// for the request ID
+func (p *SAMLPlugin) authnRequestURL(idp *IdentityProvider, requestID string) (string, error) {
+	req := &authnRequest{
+		ID:                          requestID,
+		Version:                     "2.0",
+		IssueInstant:                time.Now().UTC().Format(timeFormat),
+		Destination:                 idp.SSOURL,
+		AssertionConsumerServiceURL: p.acsURL(idp),
+		ProtocolBinding:             bindingHTTPPOST,
+		Issuer:                      issuer{Value: p.entityID(idp)},
+		NameIDPolicy:                &nameIDPolicy{Format: idp.NameIDFormat, AllowCreate: true},
+	}
+	data, err := xml.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+
+	// The HTTP-Redirect binding deflates and base64-encodes the request
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(data); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(idp.SSOURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("SAMLRequest", base64.StdEncoding.EncodeToString(buf.Bytes()))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// saveRequest remembers an AuthnRequest until RequestTTL passes. A
+// RedirectTo too long for the identifier column is dropped, so the user
+// lands on "/" instead of the sign-in failing.
+func (p *SAMLPlugin) saveRequest(ctx context.Context, requestID string, pending *pendingRequest) error {
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return err
+	}
+	if len(data) > maxIdentifierLength {
+		if data, err = json.Marshal(&pendingRequest{ProviderID: pending.ProviderID}); err != nil {
+			return err
+		}
+	}
+	id, err := crypto.GenerateID()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	_, err = repo.Create(ctx, p.ctx.Adapter, p.table(core.ModelVerifications), &verificationRecord{
+		ID:         id,
+		Identifier: string(data),
+		Token:      requestID,
+		Type:       verificationType,
+		ExpiresAt:  now.Add(p.opts.RequestTTL),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	})
+	return err
+}
+
+// takeRequest returns and deletes a pending AuthnRequest, so each request
+// accepts at most one response. It returns nil for unknown, used or
+// expired requests.
+func (p *SAMLPlugin) takeRequest(ctx context.Context, requestID string) (*pendingRequest, error) {
+	query := core.NewQuery(p.table(core.ModelVerifications)).
+		Where("token", core.OpEqual, requestID).
+		Where("type", core.OpEqual, verificationType).
+		Build()
+
+	record, err := repo.FindOne[verificationRecord](ctx, p.ctx.Adapter, query)
+	if err != nil || record == nil {
+		return nil, err
+	}
+
+	deleted, err := p.ctx.Adapter.DeleteMany(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if deleted == 0 || time.Now().After(record.ExpiresAt) {
+		return nil, nil
+	}
+
+	pending := &pendingRequest{}
+	if err := json.Unmarshal([]byte(record.Identifier), pending); err != nil {
+		return nil, fmt.Errorf("invalid saml request: %w", err)
+	}
+	return pending, nil
+}
+
+// Cleanup deletes expired AuthnRequests
+func (p *SAMLPlugin) Cleanup(ctx context.Context) error {
+	query := core.NewQuery(p.table(core.ModelVerifications)).
+		Where("type", core.OpEqual, verificationType).
+		Where("expires_at", core.OpLessThan, time.Now()).
+		Build()
+
+	_, err := p.ctx.Adapter.DeleteMany(ctx, query)
+	return err
+}
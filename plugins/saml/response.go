@@ -0,0 +1,283 @@
+package saml
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	nsProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+
+	statusSuccess = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	methodBearer  = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+
+	// NameIDFormatEmail asks for the user's email as NameID
+	NameIDFormatEmail = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+
+	// NameIDFormatPersistent asks for a stable, opaque NameID
+	NameIDFormatPersistent = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+
+	nameIDFormatTransient = "urn:oasis:names:tc:SAML:2.0:nameid-format:transient"
+
+	timeFormat = "2006-01-02T15:04:05Z"
+)
+
+var (
+	// ErrInvalidResponse is returned for SAML responses that fail
+	// validation. The error text says why.
+	ErrInvalidResponse = errors.New("invalid SAML response")
+
+	// ErrEncryptedAssertion is returned for responses with an encrypted
+	// assertion, which the plugin does not support
+	ErrEncryptedAssertion = errors.New("encrypted assertions are not supported")
+)
+
+// Assertion is the validated content of a SAML assertion
+type Assertion struct {
+	// ID is the assertion's ID
+	ID string
+
+	// NameID identifies the user at the identity provider
+	NameID string
+
+	// NameIDFormat is the format of NameID
+	NameIDFormat string
+
+	// SessionIndex identifies the user's session at the identity provider
+	SessionIndex string
+
+	// Attributes maps attribute names to their values
+	Attributes map[string][]string
+}
+
+// Attribute returns the first value of the first of names the assertion
+// has, or ""
+func (a *Assertion) Attribute(names ...string) string {
+	for _, name := range names {
+		if values := a.Attributes[name]; len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// responseValidator holds what a response must match
+type responseValidator struct {
+	idp       *IdentityProvider
+	entityID  string // the service provider's entity ID, the audience
+	acsURL    string
+	requestID string
+	now       time.Time
+	skew      time.Duration
+}
+
+func invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidResponse, fmt.Sprintf(format, args...))
+}
+
+// validate checks a decoded SAMLResponse and returns its assertion. The
+// response or the assertion must be signed by the identity provider, and
+// only the elements the signatures cover are read.
+func (v *responseValidator) validate(data []byte) (*Assertion, error) {
+	root, err := parseXML(data)
+	if err != nil {
+		return nil, invalid("%v", err)
+	}
+	if root.Space != nsProtocol || root.Local != "Response" {
+		return nil, invalid("expected a Response, got %s", root.Local)
+	}
+	if err := collectIDs(root, map[string]bool{}); err != nil {
+		return nil, invalid("%v", err)
+	}
+
+	signed := false
+	if sig := root.Child(nsDSig, "Signature"); sig != nil {
+		if err := verifySignature(sig, root, v.idp.Certificates); err != nil {
+			return nil, err
+		}
+		signed = true
+	}
+
+	if root.Attr("Version") != "2.0" {
+		return nil, invalid("unsupported version %q", root.Attr("Version"))
+	}
+	if dest := root.Attr("Destination"); dest != "" && dest != v.acsURL {
+		return nil, invalid("destination %q is not this service provider", dest)
+	}
+	if root.Attr("InResponseTo") != v.requestID {
+		return nil, invalid("response is not for this request")
+	}
+	if iss := root.Child(nsAssertion, "Issuer"); iss != nil && iss.Text() != v.idp.EntityID {
+		return nil, invalid("unexpected issuer %q", iss.Text())
+	}
+	if err := checkStatus(root); err != nil {
+		return nil, err
+	}
+
+	if root.Child(nsAssertion, "EncryptedAssertion") != nil {
+		return nil, ErrEncryptedAssertion
+	}
+	assertions := root.ChildElements(nsAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return nil, invalid("expected one assertion, found %d", len(assertions))
+	}
+	assertion := assertions[0]
+
+	if sig := assertion.Child(nsDSig, "Signature"); sig != nil {
+		if err := verifySignature(sig, assertion, v.idp.Certificates); err != nil {
+			return nil, err
+		}
+		signed = true
+	}
+	if !signed {
+		return nil, fmt.Errorf("%w: neither the response nor the assertion is signed", ErrInvalidSignature)
+	}
+
+	return v.validateAssertion(assertion)
+}
+
+// checkStatus returns an error unless the response reports success
+func checkStatus(root *element) error {
+	status := root.Child(nsProtocol, "Status")
+	if status == nil {
+		return invalid("missing status")
+	}
+	code := status.Child(nsProtocol, "StatusCode")
+	if code == nil {
+		return invalid("missing status code")
+	}
+	if value := code.Attr("Value"); value != statusSuccess {
+		if sub := code.Child(nsProtocol, "StatusCode"); sub != nil {
+			return invalid("identity provider returned %s (%s)", value, sub.Attr("Value"))
+		}
+		return invalid("identity provider returned %s", value)
+	}
+	return nil
+}
+
+func (v *responseValidator) validateAssertion(a *element) (*Assertion, error) {
+	if a.Attr("Version") != "2.0" {
+		return nil, invalid("unsupported assertion version %q", a.Attr("Version"))
+	}
+	if iss := a.Child(nsAssertion, "Issuer"); iss == nil || iss.Text() != v.idp.EntityID {
+		return nil, invalid("assertion is not issued by %s", v.idp.EntityID)
+	}
+
+	subject := a.Child(nsAssertion, "Subject")
+	if subject == nil {
+		return nil, invalid("missing subject")
+	}
+	nameID := subject.Child(nsAssertion, "NameID")
+	if nameID == nil || nameID.Text() == "" {
+		return nil, invalid("missing NameID")
+	}
+	if err := v.checkSubjectConfirmation(subject); err != nil {
+		return nil, err
+	}
+
+	conditions := a.Child(nsAssertion, "Conditions")
+	if conditions == nil {
+		return nil, invalid("missing conditions")
+	}
+	if err := v.checkConditions(conditions); err != nil {
+		return nil, err
+	}
+
+	authn := a.Child(nsAssertion, "AuthnStatement")
+	if authn == nil {
+		return nil, invalid("missing authentication statement")
+	}
+
+	result := &Assertion{
+		ID:           a.Attr("ID"),
+		NameID:       nameID.Text(),
+		NameIDFormat: nameID.Attr("Format"),
+		SessionIndex: authn.Attr("SessionIndex"),
+		Attributes:   make(map[string][]string),
+	}
+	for _, statement := range a.ChildElements(nsAssertion, "AttributeStatement") {
+		for _, attr := range statement.ChildElements(nsAssertion, "Attribute") {
+			name := attr.Attr("Name")
+			for _, value := range attr.ChildElements(nsAssertion, "AttributeValue") {
+				result.Attributes[name] = append(result.Attributes[name], value.Text())
+			}
+		}
+	}
+	return result, nil
+}
+
+// checkSubjectConfirmation requires a bearer confirmation for this
+// request, sent to this service provider and not expired
+func (v *responseValidator) checkSubjectConfirmation(subject *element) error {
+	for _, confirmation := range subject.ChildElements(nsAssertion, "SubjectConfirmation") {
+		if confirmation.Attr("Method") != methodBearer {
+			continue
+		}
+		data := confirmation.Child(nsAssertion, "SubjectConfirmationData")
+		if data == nil {
+			continue
+		}
+		if data.Attr("Recipient") != v.acsURL || data.Attr("InResponseTo") != v.requestID {
+			continue
+		}
+		notOnOrAfter, err := parseTime(data.Attr("NotOnOrAfter"))
+		if err != nil || !v.now.Before(notOnOrAfter.Add(v.skew)) {
+			continue
+		}
+		if nb := data.Attr("NotBefore"); nb != "" {
+			notBefore, err := parseTime(nb)
+			if err != nil || v.now.Add(v.skew).Before(notBefore) {
+				continue
+			}
+		}
+		return nil
+	}
+	return invalid("no valid bearer subject confirmation")
+}
+
+// checkConditions checks the validity window and requires every audience
+// restriction to name this service provider
+func (v *responseValidator) checkConditions(conditions *element) error {
+	if nb := conditions.Attr("NotBefore"); nb != "" {
+		notBefore, err := parseTime(nb)
+		if err != nil {
+			return invalid("malformed NotBefore")
+		}
+		if v.now.Add(v.skew).Before(notBefore) {
+			return invalid("assertion is not yet valid")
+		}
+	}
+	if noa := conditions.Attr("NotOnOrAfter"); noa != "" {
+		notOnOrAfter, err := parseTime(noa)
+		if err != nil {
+			return invalid("malformed NotOnOrAfter")
+		}
+		if !v.now.Before(notOnOrAfter.Add(v.skew)) {
+			return invalid("assertion has expired")
+		}
+	}
+
+	restrictions := conditions.ChildElements(nsAssertion, "AudienceRestriction")
+	if len(restrictions) == 0 {
+		return invalid("missing audience restriction")
+	}
+	for _, restriction := range restrictions {
+		found := false
+		for _, audience := range restriction.ChildElements(nsAssertion, "Audience") {
+			if audience.Text() == v.entityID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return invalid("assertion is not intended for %s", v.entityID)
+		}
+	}
+	return nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, s)
+}
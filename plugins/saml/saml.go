@@ -0,0 +1,530 @@
+package saml
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/plugin"
+)
+
+// requestCookieName binds a pending AuthnRequest to the browser that
+// started it
+const requestCookieName = "saml_request"
+
+// maxResponseSize limits the size of a posted SAMLResponse form
+const maxResponseSize = 1 << 20
+
+// providerIDPattern restricts identity provider IDs to one URL path
+// segment of at most 32 characters
+var providerIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+var (
+	// ErrSignUpDisabled is returned when an assertion names a user who
+	// does not exist and DisableSignUp is set
+	ErrSignUpDisabled = errors.New("saml: sign-up is disabled")
+
+	// ErrAccountExists is returned when the asserted email belongs to an
+	// existing user and the identity provider is not trusted for its
+	// domain
+	ErrAccountExists = errors.New("saml: account with this email already exists")
+
+	// ErrDomainNotAllowed is returned when the asserted email is outside
+	// the identity provider's Domains
+	ErrDomainNotAllowed = errors.New("saml: email domain not allowed for this identity provider")
+)
+
+// AttributeMapping lists, for each user field, the assertion attributes
+// to read it from, in order of preference
+type AttributeMapping struct {
+	Email      []string
+	Name       []string
+	GivenName  []string
+	FamilyName []string
+}
+
+// DefaultAttributeMapping covers the attribute names of common identity
+// providers: plain names, OIDs (Shibboleth and others) and WS-Federation
+// claim URIs (Azure AD and AD FS)
+var DefaultAttributeMapping = AttributeMapping{
+	Email: []string{
+		"email",
+		"mail",
+		"emailAddress",
+		"urn:oid:0.9.2342.19200300.100.1.3",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+	},
+	Name: []string{
+		"name",
+		"displayName",
+		"urn:oid:2.16.840.1.113730.3.1.241",
+		"http://schemas.microsoft.com/identity/claims/displayname",
+	},
+	GivenName: []string{
+		"firstName",
+		"givenName",
+		"urn:oid:2.5.4.42",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/givenname",
+	},
+	FamilyName: []string{
+		"lastName",
+		"surname",
+		"sn",
+		"urn:oid:2.5.4.4",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/surname",
+	},
+}
+
+// IdentityProvider is a SAML identity provider users can sign in with.
+// ParseMetadata and FetchMetadata fill EntityID, SSOURL and Certificates
+// from its metadata.
+type IdentityProvider struct {
+	// ID names the provider in endpoint paths: /saml/{id}/login. Use up
+	// to 32 lowercase letters, digits, '-' and '_'.
+	ID string
+
+	// EntityID is the provider's entity ID, the Issuer of its assertions
+	EntityID string
+
+	// SSOURL is the provider's single sign-on URL for the HTTP-Redirect
+	// binding
+	SSOURL string
+
+	// Certificates verify the provider's signatures. List the next
+	// certificate as well while the provider rotates keys.
+	Certificates []*x509.Certificate
+
+	// NameIDFormat is requested from the provider, e.g.
+	// NameIDFormatPersistent. The provider chooses when empty.
+	NameIDFormat string
+
+	// Attributes maps assertion attributes to user fields. Defaults to
+	// DefaultAttributeMapping.
+	Attributes *AttributeMapping
+
+	// Domains are the email domains the provider is trusted for. When
+	// set, users from other domains are rejected, existing users in
+	// these domains are linked to the provider on first sign-in, and new
+	// users have their email marked verified. When empty, an email that
+	// belongs to an existing user rejects the sign-in.
+	Domains []string
+}
+
+// Options configures the SAML service provider
+type Options struct {
+	// IdentityProviders are the identity providers users can sign in with
+	IdentityProviders []*IdentityProvider
+
+	// EntityID identifies this service provider to identity providers and
+	// is the audience of their assertions. Defaults to each identity
+	// provider's metadata URL, /saml/{id}/metadata.
+	EntityID string
+
+	// DisableSignUp rejects assertions for users who do not exist, instead
+	// of creating them
+	DisableSignUp bool
+
+	// ClockSkew is the tolerance for the validity times of assertions.
+	// Defaults to 2 minutes.
+	ClockSkew time.Duration
+
+	// RequestTTL is how long a user has to sign in at the identity
+	// provider. Defaults to 10 minutes.
+	RequestTTL time.Duration
+}
+
+// SAMLPlugin is a SAML 2.0 service provider. Users sign in at an identity
+// provider, which posts a signed assertion back to the plugin.
+type SAMLPlugin struct {
+	*plugin.BasePlugin
+	ctx       *core.AuthContext
+	opts      Options
+	providers map[string]*IdentityProvider
+}
+
+// New creates a new SAML plugin
+func New(opts *Options) *SAMLPlugin {
+	o := Options{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.ClockSkew <= 0 {
+		o.ClockSkew = 2 * time.Minute
+	}
+	if o.RequestTTL <= 0 {
+		o.RequestTTL = 10 * time.Minute
+	}
+
+	return &SAMLPlugin{
+		BasePlugin: plugin.NewBasePlugin("saml"),
+		opts:       o,
+		providers:  make(map[string]*IdentityProvider),
+	}
+}
+
+// Init initializes the plugin
+func (p *SAMLPlugin) Init(ctx *core.AuthContext) error {
+	for _, idp := range p.opts.IdentityProviders {
+		if !providerIDPattern.MatchString(idp.ID) {
+			return fmt.Errorf("saml: invalid identity provider ID %q: use up to 32 lowercase letters, digits, '-' and '_'", idp.ID)
+		}
+		if _, exists := p.providers[idp.ID]; exists {
+			return fmt.Errorf("saml: identity provider %q already registered", idp.ID)
+		}
+		if idp.EntityID == "" {
+			return fmt.Errorf("saml: identity provider %q has no entity ID", idp.ID)
+		}
+		u, err := url.Parse(idp.SSOURL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("saml: identity provider %q has an invalid SSO URL: %q", idp.ID, idp.SSOURL)
+		}
+		if len(idp.Certificates) == 0 {
+			return fmt.Errorf("saml: identity provider %q has no certificates", idp.ID)
+		}
+		p.providers[idp.ID] = idp
+	}
+	p.ctx = ctx
+	return nil
+}
+
+// DescribeSecurity reports the configured identity providers and whether
+// assertions may create users
+func (p *SAMLPlugin) DescribeSecurity() map[string]interface{} {
+	ids := make([]string, 0, len(p.providers))
+	for id := range p.providers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return map[string]interface{}{
+		"identityProviders": ids,
+		"signUp":            !p.opts.DisableSignUp,
+		"clockSkewSeconds":  int(p.opts.ClockSkew / time.Second),
+	}
+}
+
+// Endpoints returns the plugin endpoints
+func (p *SAMLPlugin) Endpoints() map[string]plugin.Endpoint {
+	endpoints := make(map[string]plugin.Endpoint)
+
+	for _, provider := range p.opts.IdentityProviders {
+		// Capture closure variable
+		idp := provider
+
+		endpoints["/saml/"+idp.ID+"/login"] = plugin.Endpoint{
+			Method: "GET",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				p.handleLogin(w, r, idp)
+			},
+		}
+		endpoints["/saml/"+idp.ID+"/acs"] = plugin.Endpoint{
+			Method: "POST",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				p.handleACS(w, r, idp)
+			},
+		}
+		endpoints["/saml/"+idp.ID+"/metadata"] = plugin.Endpoint{
+			Method: "GET",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				p.handleMetadata(w, r, idp)
+			},
+		}
+	}
+
+	return endpoints
+}
+
+func (p *SAMLPlugin) handleLogin(w http.ResponseWriter, r *http.Request, idp *IdentityProvider) {
+	requestID, err := newRequestID()
+	if err != nil {
+		p.ctx.Logger.Error("Failed to generate SAML request ID: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Failed to start sign-in")
+		return
+	}
+
+	err = p.saveRequest(r.Context(), requestID, &pendingRequest{
+		ProviderID: idp.ID,
+		RedirectTo: core.SafeRedirect(r.URL.Query().Get("redirect_to"), "", nil),
+	})
+	if err != nil {
+		p.ctx.Logger.Error("Failed to save SAML request: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Failed to start sign-in")
+		return
+	}
+
+	authURL, err := p.authnRequestURL(idp, requestID)
+	if err != nil {
+		p.ctx.Logger.Error("Failed to create SAML request: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Failed to start sign-in")
+		return
+	}
+
+	http.SetCookie(w, p.requestCookie(requestID, int(p.opts.RequestTTL/time.Second)))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (p *SAMLPlugin) handleACS(w http.ResponseWriter, r *http.Request, idp *IdentityProvider) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxResponseSize)
+	if err := r.ParseForm(); err != nil {
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Invalid form")
+		return
+	}
+
+	// Responses are only accepted for requests this browser started, so
+	// a response cannot be replayed into someone else's browser
+	cookie, err := r.Cookie(requestCookieName)
+	if err != nil || cookie.Value == "" {
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Missing SAML request")
+		return
+	}
+	http.SetCookie(w, p.requestCookie("", -1))
+
+	pending, err := p.takeRequest(r.Context(), cookie.Value)
+	if err != nil {
+		p.ctx.Logger.Error("Failed to load SAML request: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Failed to load SAML request")
+		return
+	}
+	if pending == nil || pending.ProviderID != idp.ID {
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Unknown or expired SAML request")
+		return
+	}
+
+	data, err := decodeBase64(r.PostForm.Get("SAMLResponse"))
+	if err != nil || len(data) == 0 {
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Invalid SAMLResponse")
+		return
+	}
+
+	v := &responseValidator{
+		idp:       idp,
+		entityID:  p.entityID(idp),
+		acsURL:    p.acsURL(idp),
+		requestID: cookie.Value,
+		now:       time.Now(),
+		skew:      p.opts.ClockSkew,
+	}
+	assertion, err := v.validate(data)
+	if err != nil {
+		p.ctx.Logger.Warn("Rejected SAML response from %s: %v", idp.ID, err)
+		core.WriteStatusError(w, r, http.StatusUnauthorized, "Invalid SAML response")
+		return
+	}
+
+	userID, err := p.linkAccount(r, idp, assertion)
+	switch {
+	case errors.Is(err, ErrSignUpDisabled), errors.Is(err, ErrDomainNotAllowed):
+		core.WriteStatusError(w, r, http.StatusForbidden, "Sign-in not allowed")
+		return
+	case errors.Is(err, ErrAccountExists):
+		core.WriteError(w, r, http.StatusConflict, core.CodeUserExists, "An account with this email already exists")
+		return
+	case errors.Is(err, ErrInvalidResponse):
+		p.ctx.Logger.Warn("Rejected SAML response from %s: %v", idp.ID, err)
+		core.WriteStatusError(w, r, http.StatusUnauthorized, "Invalid SAML response")
+		return
+	case err != nil:
+		p.ctx.Logger.Error("Failed to link SAML account: %v", err)
+		core.WriteError(w, r, http.StatusInternalServerError, core.CodeCreateError, "Failed to create account")
+		return
+	}
+
+	// Never carry a session from before authentication over to the new one
+	p.ctx.RevokeRequestSession(r)
+
+	session, user, token, err := p.ctx.SessionManager.Create(r.Context(), userID, nil)
+	var ban *core.BanError
+	if errors.As(err, &ban) {
+		core.WriteBanError(w, r, ban)
+		return
+	}
+	if err != nil {
+		p.ctx.Logger.Error("Failed to create session: %v", err)
+		core.WriteError(w, r, http.StatusInternalServerError, core.CodeSessionError, "Failed to create session")
+		return
+	}
+	p.ctx.EmitSignIn(r, user, session, core.MethodSAML, idp.ID)
+	sessionConfig := p.ctx.Config.Session
+	core.SetChunkedCookie(w, r, sessionConfig.SessionCookie(token, session.ExpiresAt), sessionConfig.CookieChunkSize)
+
+	redirectTo := pending.RedirectTo
+	if redirectTo == "" {
+		redirectTo = "/"
+	}
+	// 303 so the browser follows with a GET instead of reposting the form
+	http.Redirect(w, r, redirectTo, http.StatusSeeOther)
+}
+
+func (p *SAMLPlugin) handleMetadata(w http.ResponseWriter, r *http.Request, idp *IdentityProvider) {
+	data, err := p.metadata(idp)
+	if err != nil {
+		p.ctx.Logger.Error("Failed to build SAML metadata: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Failed to build metadata")
+		return
+	}
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	_, _ = w.Write(data)
+}
+
+// requestCookie returns the cookie that binds an AuthnRequest to the
+// browser. Identity providers post the response from their own site, so
+// over HTTPS the cookie is SameSite=None to be sent with that post.
+func (p *SAMLPlugin) requestCookie(requestID string, maxAge int) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     requestCookieName,
+		Value:    requestID,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   maxAge,
+	}
+	if p.ctx.Config.Advanced != nil && p.ctx.Config.Advanced.UseSecureCookies {
+		cookie.Secure = true
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+	return cookie
+}
+
+// linkAccount returns the user of the asserted NameID, creating the
+// account, and the user when no user has the asserted email, in one
+// transaction. A concurrent sign-in for the same account or email makes
+// the inserts fail with core.ErrDuplicate; the second attempt then finds
+// its rows.
+func (p *SAMLPlugin) linkAccount(r *http.Request, idp *IdentityProvider, assertion *Assertion) (string, error) {
+	ctx := r.Context()
+	if assertion.NameIDFormat == nameIDFormatTransient {
+		return "", invalid("transient NameIDs cannot identify returning users")
+	}
+	providerID := "saml:" + idp.ID
+
+	for attempt := 0; ; attempt++ {
+		account, err := p.ctx.DataManager.FindAccountByProvider(ctx, providerID, assertion.NameID)
+		if err != nil {
+			return "", err
+		}
+		if account != nil {
+			return account.UserID, nil
+		}
+
+		email, name := idp.mapping().user(assertion)
+		if email == "" {
+			return "", invalid("assertion has no email")
+		}
+		trusted := idp.trustsEmail(email)
+		if len(idp.Domains) > 0 && !trusted {
+			return "", ErrDomainNotAllowed
+		}
+
+		var userID string
+		var created *core.User
+		err = p.ctx.DataManager.Transaction(ctx, func(dm core.DataManager) error {
+			user, err := dm.FindUserByEmail(ctx, email)
+			if err != nil && err != core.ErrUserNotFound {
+				return err
+			}
+
+			if user != nil && !trusted {
+				return ErrAccountExists
+			}
+			if user == nil {
+				if p.opts.DisableSignUp {
+					return ErrSignUpDisabled
+				}
+				user, err = dm.CreateUser(ctx, email, name)
+				if err != nil {
+					return err
+				}
+				if trusted {
+					if _, err := dm.UpdateUser(ctx, user.ID, map[string]interface{}{"email_verified": true}); err != nil {
+						return err
+					}
+					user.EmailVerified = true
+				}
+				created = user
+			}
+			userID = user.ID
+
+			_, err = dm.CreateOAuthAccount(ctx, userID, providerID, assertion.NameID, "", "", nil)
+			return err
+		})
+		if errors.Is(err, core.ErrDuplicate) && attempt == 0 {
+			continue
+		}
+		if err == nil && created != nil {
+			p.ctx.EmitUserCreated(r, created, core.MethodSAML, idp.ID)
+		}
+		return userID, err
+	}
+}
+
+// mapping returns the provider's attribute mapping
+func (idp *IdentityProvider) mapping() *AttributeMapping {
+	if idp.Attributes != nil {
+		return idp.Attributes
+	}
+	return &DefaultAttributeMapping
+}
+
+// trustsEmail reports whether the email is in one of the provider's
+// Domains
+func (idp *IdentityProvider) trustsEmail(email string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := email[at+1:]
+	for _, d := range idp.Domains {
+		if strings.EqualFold(domain, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// user returns the email and name of the asserted user. The email falls
+// back to an email-format NameID.
+func (m *AttributeMapping) user(assertion *Assertion) (email, name string) {
+	email = assertion.Attribute(m.Email...)
+	if email == "" && assertion.NameIDFormat == NameIDFormatEmail {
+		email = assertion.NameID
+	}
+
+	name = assertion.Attribute(m.Name...)
+	if name == "" {
+		name = strings.TrimSpace(assertion.Attribute(m.GivenName...) + " " + assertion.Attribute(m.FamilyName...))
+	}
+	return email, name
+}
+
+// entityID returns the service provider entity ID used with idp
+func (p *SAMLPlugin) entityID(idp *IdentityProvider) string {
+	if p.opts.EntityID != "" {
+		return p.opts.EntityID
+	}
+	return p.endpointURL(idp, "metadata")
+}
+
+// acsURL returns the assertion consumer service URL for idp
+func (p *SAMLPlugin) acsURL(idp *IdentityProvider) string {
+	return p.endpointURL(idp, "acs")
+}
+
+func (p *SAMLPlugin) endpointURL(idp *IdentityProvider, endpoint string) string {
+	basePath := p.ctx.Config.BasePath
+	// Ensure basePath starts with / if not empty, and doesn't end with /
+	if basePath != "" && !strings.HasPrefix(basePath, "/") {
+		basePath = "/" + basePath
+	}
+	basePath = strings.TrimRight(basePath, "/")
+
+	return fmt.Sprintf("%s%s/saml/%s/%s", strings.TrimRight(p.ctx.Config.BaseURL, "/"), basePath, idp.ID, endpoint)
+}
+
+func (p *SAMLPlugin) table(name string) string {
+	return p.ctx.Config.TableNames.Table(name)
+}
@@ -0,0 +1,721 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/adapter"
+	"github.com/marshallshelly/beacon-auth/adapters/memory"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/session"
+)
+
+const (
+	testIdPEntityID = "https://idp.example.com/metadata"
+	testACSURL      = "https://app.example.com/auth/saml/acme/acs"
+	testSPEntityID  = "https://app.example.com/auth/saml/acme/metadata"
+)
+
+// testIdP signs responses like an identity provider
+type testIdP struct {
+	key         *rsa.PrivateKey
+	certificate *x509.Certificate
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testIdP{key: key, certificate: cert}
+}
+
+func (idp *testIdP) cert() []*x509.Certificate {
+	return []*x509.Certificate{idp.certificate}
+}
+
+// sign adds an enveloped signature to the element with the ID, inserted
+// after the first occurrence of after that follows the ID
+func (idp *testIdP) sign(t *testing.T, doc, id, after string) string {
+	t.Helper()
+
+	root, err := parseXML([]byte(doc))
+	if err != nil {
+		t.Fatalf("parseXML failed: %v", err)
+	}
+	target := findID(root, id)
+	if target == nil {
+		t.Fatalf("no element with ID %q", id)
+	}
+	digest := sha256.Sum256((&canonicalizer{}).canonicalize(target))
+
+	signedInfo := `<ds:SignedInfo xmlns:ds="` + nsDSig + `">` +
+		`<ds:CanonicalizationMethod Algorithm="` + algExcC14N + `"/>` +
+		`<ds:SignatureMethod Algorithm="` + algRSASHA256 + `"/>` +
+		`<ds:Reference URI="#` + id + `"><ds:Transforms>` +
+		`<ds:Transform Algorithm="` + algEnvelopedSignature + `"/>` +
+		`<ds:Transform Algorithm="` + algExcC14N + `"/>` +
+		`</ds:Transforms><ds:DigestMethod Algorithm="` + algSHA256 + `"/>` +
+		`<ds:DigestValue>` + base64.StdEncoding.EncodeToString(digest[:]) + `</ds:DigestValue>` +
+		`</ds:Reference></ds:SignedInfo>`
+	si, err := parseXML([]byte(signedInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashed := sha256.Sum256((&canonicalizer{}).canonicalize(si))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig := `<ds:Signature xmlns:ds="` + nsDSig + `">` +
+		strings.Replace(signedInfo, ` xmlns:ds="`+nsDSig+`"`, "", 1) +
+		`<ds:SignatureValue>` + base64.StdEncoding.EncodeToString(signature) + `</ds:SignatureValue>` +
+		`</ds:Signature>`
+
+	start := strings.Index(doc, `ID="`+id+`"`)
+	at := strings.Index(doc[start:], after)
+	if start < 0 || at < 0 {
+		t.Fatalf("cannot place signature after %q", after)
+	}
+	at += start + len(after)
+	return doc[:at] + sig + doc[at:]
+}
+
+func findID(e *element, id string) *element {
+	if e.Attr("ID") == id {
+		return e
+	}
+	for _, c := range e.Children {
+		if c.Kind == elementNode {
+			if found := findID(c.Elem, id); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+func replaceOnce(t *testing.T, s, old, new string) string {
+	t.Helper()
+	if !strings.Contains(s, old) {
+		t.Fatalf("%q not found", old)
+	}
+	return strings.Replace(s, old, new, 1)
+}
+
+func regexpReplace(s, pattern, repl string) string {
+	return regexp.MustCompile(pattern).ReplaceAllString(s, repl)
+}
+
+// testResponse returns an unsigned response to requestID. Placeholders
+// can be replaced before signing.
+func testResponse(requestID, nameID string) string {
+	now := time.Now().UTC()
+	return strings.NewReplacer(
+		"{request}", requestID,
+		"{nameID}", nameID,
+		"{now}", now.Format(timeFormat),
+		"{before}", now.Add(-time.Minute).Format(timeFormat),
+		"{after}", now.Add(5*time.Minute).Format(timeFormat),
+	).Replace(`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_resp" Version="2.0" IssueInstant="{now}" Destination="` + testACSURL + `" InResponseTo="{request}">` +
+		`<saml:Issuer>` + testIdPEntityID + `</saml:Issuer>` +
+		`<samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>` +
+		`<saml:Assertion ID="_assertion" Version="2.0" IssueInstant="{now}">` +
+		`<saml:Issuer>` + testIdPEntityID + `</saml:Issuer>` +
+		`<saml:Subject><saml:NameID Format="` + NameIDFormatPersistent + `">{nameID}</saml:NameID>` +
+		`<saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">` +
+		`<saml:SubjectConfirmationData InResponseTo="{request}" NotOnOrAfter="{after}" Recipient="` + testACSURL + `"/>` +
+		`</saml:SubjectConfirmation></saml:Subject>` +
+		`<saml:Conditions NotBefore="{before}" NotOnOrAfter="{after}">` +
+		`<saml:AudienceRestriction><saml:Audience>` + testSPEntityID + `</saml:Audience></saml:AudienceRestriction>` +
+		`</saml:Conditions>` +
+		`<saml:AuthnStatement AuthnInstant="{now}" SessionIndex="_session"/>` +
+		`<saml:AttributeStatement>` +
+		`<saml:Attribute Name="email"><saml:AttributeValue>alice@acme.com</saml:AttributeValue></saml:Attribute>` +
+		`<saml:Attribute Name="firstName"><saml:AttributeValue>Alice</saml:AttributeValue></saml:Attribute>` +
+		`<saml:Attribute Name="lastName"><saml:AttributeValue>Smith</saml:AttributeValue></saml:Attribute>` +
+		`</saml:AttributeStatement>` +
+		`</saml:Assertion></samlp:Response>`)
+}
+
+// signAssertion signs the assertion of a test response
+func (idp *testIdP) signAssertion(t *testing.T, doc string) string {
+	return idp.sign(t, doc, "_assertion", "</saml:Issuer>")
+}
+
+func newTestPlugin(t *testing.T, idp *testIdP, configure func(*IdentityProvider, *Options)) (*SAMLPlugin, core.Adapter) {
+	t.Helper()
+
+	db := memory.New()
+	sessions, err := session.NewManager(&session.Config{
+		CookieName:    "test_session",
+		ExpiresIn:     time.Hour,
+		EnableDBStore: true,
+	}, db)
+	if err != nil {
+		t.Fatalf("Failed to create session manager: %v", err)
+	}
+
+	provider := &IdentityProvider{
+		ID:           "acme",
+		EntityID:     testIdPEntityID,
+		SSOURL:       "https://idp.example.com/sso?tenant=acme",
+		Certificates: idp.cert(),
+	}
+	opts := &Options{IdentityProviders: []*IdentityProvider{provider}}
+	if configure != nil {
+		configure(provider, opts)
+	}
+
+	p := New(opts)
+	err = p.Init(&core.AuthContext{
+		Config: &core.Config{
+			BaseURL:  "https://app.example.com",
+			BasePath: "/auth",
+			Session:  &core.SessionConfig{CookieName: "test_session", ExpiresIn: time.Hour},
+		},
+		Adapter:        db,
+		DataManager:    adapter.NewInternalAdapter(db, nil),
+		Logger:         core.NewNoopLogger(),
+		SessionManager: sessions,
+	})
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	return p, db
+}
+
+// login starts sign-in and returns the AuthnRequest ID
+func login(t *testing.T, p *SAMLPlugin, redirectTo string) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	p.handleLogin(rec, httptest.NewRequest(http.MethodGet, "/auth/saml/acme/login?redirect_to="+url.QueryEscape(redirectTo), nil), p.providers["acme"])
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login status = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var requestID string
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == requestCookieName {
+			requestID = c.Value
+		}
+	}
+	if requestID == "" {
+		t.Fatal("login set no request cookie")
+	}
+	return requestID
+}
+
+// post sends a response to the assertion consumer service
+func post(p *SAMLPlugin, requestID, response string) *httptest.ResponseRecorder {
+	form := url.Values{"SAMLResponse": {base64.StdEncoding.EncodeToString([]byte(response))}}
+	req := httptest.NewRequest(http.MethodPost, "/auth/saml/acme/acs", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if requestID != "" {
+		req.AddCookie(&http.Cookie{Name: requestCookieName, Value: requestID})
+	}
+	rec := httptest.NewRecorder()
+	p.handleACS(rec, req, p.providers["acme"])
+	return rec
+}
+
+func TestLoginRedirectsWithAuthnRequest(t *testing.T) {
+	p, _ := newTestPlugin(t, newTestIdP(t), nil)
+
+	rec := httptest.NewRecorder()
+	p.handleLogin(rec, httptest.NewRequest(http.MethodGet, "/auth/saml/acme/login", nil), p.providers["acme"])
+
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Host != "idp.example.com" || location.Query().Get("tenant") != "acme" {
+		t.Errorf("Location = %s, want the SSO URL with its query", location)
+	}
+
+	deflated, err := base64.StdEncoding.DecodeString(location.Query().Get("SAMLRequest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	xmlData, err := io.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := parseXML(xmlData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Local != "AuthnRequest" || req.Space != nsProtocol {
+		t.Fatalf("request is %s", req.Local)
+	}
+	if req.Attr("AssertionConsumerServiceURL") != testACSURL {
+		t.Errorf("AssertionConsumerServiceURL = %q", req.Attr("AssertionConsumerServiceURL"))
+	}
+	if iss := req.Child(nsAssertion, "Issuer"); iss == nil || iss.Text() != testSPEntityID {
+		t.Errorf("Issuer = %v, want %s", iss, testSPEntityID)
+	}
+
+	cookie := rec.Result().Cookies()[0]
+	if cookie.Name != requestCookieName || cookie.Value != req.Attr("ID") {
+		t.Errorf("cookie %s=%s does not carry request ID %s", cookie.Name, cookie.Value, req.Attr("ID"))
+	}
+}
+
+func TestSignIn(t *testing.T) {
+	idp := newTestIdP(t)
+	p, db := newTestPlugin(t, idp, nil)
+
+	requestID := login(t, p, "/dashboard")
+	rec := post(p, requestID, idp.signAssertion(t, testResponse(requestID, "alice-123")))
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("acs status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if loc := rec.Header().Get("Location"); loc != "/dashboard" {
+		t.Errorf("Location = %q, want /dashboard", loc)
+	}
+	var token string
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "test_session" {
+			token = c.Value
+		}
+	}
+	if token == "" {
+		t.Fatal("no session cookie")
+	}
+
+	_, user, err := p.ctx.SessionManager.Get(context.Background(), token)
+	if err != nil {
+		t.Fatalf("session lookup failed: %v", err)
+	}
+	if user.Email != "alice@acme.com" || user.Name != "Alice Smith" {
+		t.Errorf("user = %s %q, want alice@acme.com \"Alice Smith\"", user.Email, user.Name)
+	}
+	if user.EmailVerified {
+		t.Error("email verified without trusted domains")
+	}
+
+	account, err := adapter.NewInternalAdapter(db, nil).FindAccountByProvider(context.Background(), "saml:acme", "alice-123")
+	if err != nil || account == nil || account.UserID != user.ID {
+		t.Fatalf("account = %v, %v", account, err)
+	}
+
+	// Signing in again finds the same user
+	requestID = login(t, p, "")
+	rec = post(p, requestID, idp.signAssertion(t, testResponse(requestID, "alice-123")))
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/" {
+		t.Fatalf("second sign-in status = %d, Location = %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+// redirect_to only leads to paths on this site, and one too long to be
+// stored is dropped rather than failing the sign-in
+func TestSignInRedirectTo(t *testing.T) {
+	idp := newTestIdP(t)
+	p, _ := newTestPlugin(t, idp, nil)
+
+	for redirectTo, want := range map[string]string{
+		"/settings?tab=1":               "/settings?tab=1",
+		"https://evil.example":          "/",
+		"//evil.example":                "/",
+		"/\\evil.example":               "/",
+		"/\t/evil.example":              "/",
+		"/" + strings.Repeat("<&", 100): "/",
+	} {
+		requestID := login(t, p, redirectTo)
+		rec := post(p, requestID, idp.signAssertion(t, testResponse(requestID, "alice-123")))
+		if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != want {
+			t.Errorf("redirect_to %q: status = %d, Location = %q, want %q", redirectTo, rec.Code, rec.Header().Get("Location"), want)
+		}
+	}
+}
+
+func TestSignInRejectsReplay(t *testing.T) {
+	idp := newTestIdP(t)
+	p, _ := newTestPlugin(t, idp, nil)
+
+	requestID := login(t, p, "")
+	response := idp.signAssertion(t, testResponse(requestID, "alice-123"))
+	if rec := post(p, requestID, response); rec.Code != http.StatusSeeOther {
+		t.Fatalf("acs status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := post(p, requestID, response); rec.Code != http.StatusBadRequest {
+		t.Errorf("replayed response status = %d, want 400", rec.Code)
+	}
+}
+
+func TestSignInRequiresRequestCookie(t *testing.T) {
+	idp := newTestIdP(t)
+	p, _ := newTestPlugin(t, idp, nil)
+
+	requestID := login(t, p, "")
+	if rec := post(p, "", idp.signAssertion(t, testResponse(requestID, "alice-123"))); rec.Code != http.StatusBadRequest {
+		t.Errorf("status without cookie = %d, want 400", rec.Code)
+	}
+
+	// A response to another browser's request is rejected
+	other := login(t, p, "")
+	if rec := post(p, other, idp.signAssertion(t, testResponse(requestID, "alice-123"))); rec.Code != http.StatusUnauthorized {
+		t.Errorf("status for another request = %d, want 401", rec.Code)
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	idp := newTestIdP(t)
+	other := newTestIdP(t)
+	past := time.Now().Add(-time.Hour).UTC().Format(timeFormat)
+	future := time.Now().Add(time.Hour).UTC().Format(timeFormat)
+
+	tests := []struct {
+		name    string
+		build   func(t *testing.T) string
+		wantErr error
+	}{
+		{
+			name: "signed assertion",
+			build: func(t *testing.T) string {
+				return idp.signAssertion(t, testResponse("_req", "alice"))
+			},
+		},
+		{
+			name: "signed response",
+			build: func(t *testing.T) string {
+				return idp.sign(t, testResponse("_req", "alice"), "_resp", "</saml:Issuer>")
+			},
+		},
+		{
+			name: "signed response and assertion",
+			build: func(t *testing.T) string {
+				return idp.sign(t, idp.signAssertion(t, testResponse("_req", "alice")), "_resp", "</saml:Issuer>")
+			},
+		},
+		{
+			name: "unsigned",
+			build: func(t *testing.T) string {
+				return testResponse("_req", "alice")
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "signed by another key",
+			build: func(t *testing.T) string {
+				return other.signAssertion(t, testResponse("_req", "alice"))
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "modified after signing",
+			build: func(t *testing.T) string {
+				return replaceOnce(t, idp.signAssertion(t, testResponse("_req", "alice")), ">alice<", ">admin<")
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "wrapped assertion",
+			build: func(t *testing.T) string {
+				// A signed assertion moved into an extension, with an
+				// unsigned forged one in its place
+				signed := idp.signAssertion(t, testResponse("_req", "alice"))
+				start := strings.Index(signed, "<saml:Assertion")
+				end := strings.Index(signed, "</saml:Assertion>") + len("</saml:Assertion>")
+				assertion := signed[start:end]
+				forged := strings.Replace(testResponse("_req", "admin"), `ID="_assertion"`, `ID="_forged"`, 1)
+				return replaceOnce(t, forged, "<samlp:Status>", "<samlp:Extensions>"+assertion+"</samlp:Extensions><samlp:Status>")
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "duplicate IDs",
+			build: func(t *testing.T) string {
+				signed := idp.signAssertion(t, testResponse("_req", "alice"))
+				return replaceOnce(t, signed, "<samlp:Status>", `<samlp:Extensions><x ID="_assertion"/></samlp:Extensions><samlp:Status>`)
+			},
+			wantErr: ErrInvalidResponse,
+		},
+		{
+			name: "other request",
+			build: func(t *testing.T) string {
+				return idp.signAssertion(t, testResponse("_other", "alice"))
+			},
+			wantErr: ErrInvalidResponse,
+		},
+		{
+			name: "wrong audience",
+			build: func(t *testing.T) string {
+				return idp.signAssertion(t, strings.Replace(testResponse("_req", "alice"), "<saml:Audience>"+testSPEntityID, "<saml:Audience>https://other.example.com", 1))
+			},
+			wantErr: ErrInvalidResponse,
+		},
+		{
+			name: "wrong recipient",
+			build: func(t *testing.T) string {
+				return idp.signAssertion(t, strings.Replace(testResponse("_req", "alice"), `Recipient="`+testACSURL, `Recipient="https://other.example.com/acs`, 1))
+			},
+			wantErr: ErrInvalidResponse,
+		},
+		{
+			name: "wrong issuer",
+			build: func(t *testing.T) string {
+				return idp.signAssertion(t, strings.ReplaceAll(testResponse("_req", "alice"), testIdPEntityID, "https://evil.example.com"))
+			},
+			wantErr: ErrInvalidResponse,
+		},
+		{
+			name: "expired",
+			build: func(t *testing.T) string {
+				doc := testResponse("_req", "alice")
+				doc = regexpReplace(doc, `NotOnOrAfter="[^"]*"`, `NotOnOrAfter="`+past+`"`)
+				return idp.signAssertion(t, doc)
+			},
+			wantErr: ErrInvalidResponse,
+		},
+		{
+			name: "not yet valid",
+			build: func(t *testing.T) string {
+				doc := regexpReplace(testResponse("_req", "alice"), `NotBefore="[^"]*"`, `NotBefore="`+future+`"`)
+				return idp.signAssertion(t, doc)
+			},
+			wantErr: ErrInvalidResponse,
+		},
+		{
+			name: "failed status",
+			build: func(t *testing.T) string {
+				doc := strings.Replace(testResponse("_req", "alice"), "status:Success", "status:Responder", 1)
+				return idp.signAssertion(t, doc)
+			},
+			wantErr: ErrInvalidResponse,
+		},
+		{
+			name: "encrypted assertion",
+			build: func(t *testing.T) string {
+				doc := testResponse("_req", "alice")
+				start := strings.Index(doc, "<saml:Assertion")
+				return idp.sign(t, doc[:start]+"<saml:EncryptedAssertion/></samlp:Response>", "_resp", "</saml:Issuer>")
+			},
+			wantErr: ErrEncryptedAssertion,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &responseValidator{
+				idp:       &IdentityProvider{EntityID: testIdPEntityID, Certificates: idp.cert()},
+				entityID:  testSPEntityID,
+				acsURL:    testACSURL,
+				requestID: "_req",
+				now:       time.Now(),
+				skew:      2 * time.Minute,
+			}
+			assertion, err := v.validate([]byte(tt.build(t)))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validate failed: %v", err)
+			}
+			if assertion.NameID != "alice" || assertion.SessionIndex != "_session" || assertion.Attribute("email") != "alice@acme.com" {
+				t.Errorf("assertion = %+v", assertion)
+			}
+		})
+	}
+}
+
+func TestValidateResponseJoinsCommentSplitText(t *testing.T) {
+	idp := newTestIdP(t)
+	signed := idp.signAssertion(t, testResponse("_req", "alice@acme.com.evil.com"))
+	// Comments are not signed; they must not shorten the NameID
+	doc := replaceOnce(t, signed, "alice@acme.com.evil.com", "alice@acme.com<!---->.evil.com")
+
+	v := &responseValidator{
+		idp:       &IdentityProvider{EntityID: testIdPEntityID, Certificates: idp.cert()},
+		entityID:  testSPEntityID,
+		acsURL:    testACSURL,
+		requestID: "_req",
+		now:       time.Now(),
+		skew:      time.Minute,
+	}
+	assertion, err := v.validate([]byte(doc))
+	if err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+	if assertion.NameID != "alice@acme.com.evil.com" {
+		t.Errorf("NameID = %q, want the full signed value", assertion.NameID)
+	}
+}
+
+func TestEmailCollision(t *testing.T) {
+	idp := newTestIdP(t)
+
+	t.Run("untrusted provider", func(t *testing.T) {
+		p, db := newTestPlugin(t, idp, nil)
+		if _, err := adapter.NewInternalAdapter(db, nil).CreateUser(context.Background(), "alice@acme.com", "Alice"); err != nil {
+			t.Fatal(err)
+		}
+		requestID := login(t, p, "")
+		if rec := post(p, requestID, idp.signAssertion(t, testResponse(requestID, "alice-123"))); rec.Code != http.StatusConflict {
+			t.Errorf("status = %d, want 409", rec.Code)
+		}
+	})
+
+	t.Run("trusted domain links", func(t *testing.T) {
+		p, db := newTestPlugin(t, idp, func(provider *IdentityProvider, _ *Options) {
+			provider.Domains = []string{"ACME.com"}
+		})
+		existing, err := adapter.NewInternalAdapter(db, nil).CreateUser(context.Background(), "alice@acme.com", "Alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		requestID := login(t, p, "")
+		if rec := post(p, requestID, idp.signAssertion(t, testResponse(requestID, "alice-123"))); rec.Code != http.StatusSeeOther {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+		}
+		account, err := adapter.NewInternalAdapter(db, nil).FindAccountByProvider(context.Background(), "saml:acme", "alice-123")
+		if err != nil || account == nil || account.UserID != existing.ID {
+			t.Errorf("account = %v, %v; want linked to %s", account, err, existing.ID)
+		}
+	})
+
+	t.Run("other domain", func(t *testing.T) {
+		p, _ := newTestPlugin(t, idp, func(provider *IdentityProvider, _ *Options) {
+			provider.Domains = []string{"other.com"}
+		})
+		requestID := login(t, p, "")
+		if rec := post(p, requestID, idp.signAssertion(t, testResponse(requestID, "alice-123"))); rec.Code != http.StatusForbidden {
+			t.Errorf("status = %d, want 403", rec.Code)
+		}
+	})
+
+	t.Run("sign-up disabled", func(t *testing.T) {
+		p, _ := newTestPlugin(t, idp, func(_ *IdentityProvider, opts *Options) {
+			opts.DisableSignUp = true
+		})
+		requestID := login(t, p, "")
+		if rec := post(p, requestID, idp.signAssertion(t, testResponse(requestID, "alice-123"))); rec.Code != http.StatusForbidden {
+			t.Errorf("status = %d, want 403", rec.Code)
+		}
+	})
+}
+
+func TestAttributeMapping(t *testing.T) {
+	assertion := &Assertion{
+		NameID:       "bob@example.com",
+		NameIDFormat: NameIDFormatEmail,
+		Attributes: map[string][]string{
+			"http://schemas.microsoft.com/identity/claims/displayname": {"Bob B."},
+			"department": {"Sales"},
+		},
+	}
+
+	email, name := DefaultAttributeMapping.user(assertion)
+	if email != "bob@example.com" || name != "Bob B." {
+		t.Errorf("default mapping = %q, %q", email, name)
+	}
+
+	custom := &AttributeMapping{Name: []string{"department"}}
+	if _, name := custom.user(assertion); name != "Sales" {
+		t.Errorf("custom name = %q, want Sales", name)
+	}
+}
+
+func TestParseMetadata(t *testing.T) {
+	idp := newTestIdP(t)
+	cert := base64.StdEncoding.EncodeToString(idp.certificate.Raw)
+	metadata := `<?xml version="1.0"?>
+<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" xmlns:ds="http://www.w3.org/2000/09/xmldsig#" entityID="` + testIdPEntityID + `">
+  <md:IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <md:KeyDescriptor use="encryption"><ds:KeyInfo><ds:X509Data><ds:X509Certificate>invalid</ds:X509Certificate></ds:X509Data></ds:KeyInfo></md:KeyDescriptor>
+    <md:KeyDescriptor use="signing"><ds:KeyInfo><ds:X509Data><ds:X509Certificate>
+` + cert + `
+    </ds:X509Certificate></ds:X509Data></ds:KeyInfo></md:KeyDescriptor>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST" Location="https://idp.example.com/sso/post"/>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="https://idp.example.com/sso/redirect"/>
+  </md:IDPSSODescriptor>
+</md:EntityDescriptor>`
+
+	parsed, err := ParseMetadata([]byte(metadata))
+	if err != nil {
+		t.Fatalf("ParseMetadata failed: %v", err)
+	}
+	if parsed.EntityID != testIdPEntityID || parsed.SSOURL != "https://idp.example.com/sso/redirect" {
+		t.Errorf("parsed = %s %s", parsed.EntityID, parsed.SSOURL)
+	}
+	if len(parsed.Certificates) != 1 || !parsed.Certificates[0].Equal(idp.certificate) {
+		t.Errorf("certificates = %v", parsed.Certificates)
+	}
+
+	if _, err := ParseMetadata([]byte(strings.Replace(metadata, "HTTP-Redirect", "SOAP", 1))); err == nil {
+		t.Error("ParseMetadata accepted metadata without an HTTP-Redirect endpoint")
+	}
+}
+
+func TestMetadataEndpoint(t *testing.T) {
+	p, _ := newTestPlugin(t, newTestIdP(t), nil)
+
+	rec := httptest.NewRecorder()
+	p.handleMetadata(rec, httptest.NewRequest(http.MethodGet, "/auth/saml/acme/metadata", nil), p.providers["acme"])
+	root, err := parseXML(rec.Body.Bytes())
+	if err != nil {
+		t.Fatalf("metadata is not XML: %v", err)
+	}
+	if root.Attr("entityID") != testSPEntityID {
+		t.Errorf("entityID = %q", root.Attr("entityID"))
+	}
+	acs := root.Child(nsMetadata, "SPSSODescriptor").Child(nsMetadata, "AssertionConsumerService")
+	if acs == nil || acs.Attr("Location") != testACSURL || acs.Attr("Binding") != bindingHTTPPOST {
+		t.Errorf("AssertionConsumerService = %+v", acs)
+	}
+}
+
+func TestInitValidatesProviders(t *testing.T) {
+	idp := newTestIdP(t)
+	bad := []*IdentityProvider{
+		{ID: "Acme", EntityID: "x", SSOURL: "https://idp.example.com", Certificates: idp.cert()},
+		{ID: "acme", SSOURL: "https://idp.example.com", Certificates: idp.cert()},
+		{ID: "acme", EntityID: "x", SSOURL: "/sso", Certificates: idp.cert()},
+		{ID: "acme", EntityID: "x", SSOURL: "https://idp.example.com"},
+	}
+	for _, provider := range bad {
+		p := New(&Options{IdentityProviders: []*IdentityProvider{provider}})
+		if err := p.Init(&core.AuthContext{Config: &core.Config{}}); err == nil {
+			t.Errorf("Init accepted %+v", provider)
+		}
+	}
+}
@@ -0,0 +1,610 @@
+package saml
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+
+	// Register the digests used by signatures
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// XML Signature (XMLDSig) verification, limited to what SAML identity
+// providers use: one enveloped signature over an element referenced by
+// its ID, exclusive canonicalization, RSA or ECDSA, and SHA-256 or
+// SHA-512. SHA-1 is rejected.
+
+const (
+	nsXML  = "http://www.w3.org/XML/1998/namespace"
+	nsDSig = "http://www.w3.org/2000/09/xmldsig#"
+
+	algExcC14N             = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algExcC14NWithComments = "http://www.w3.org/2001/10/xml-exc-c14n#WithComments"
+	algEnvelopedSignature  = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+
+	algRSASHA256   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algRSASHA512   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	algECDSASHA256 = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256"
+	algECDSASHA512 = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha512"
+
+	algSHA256 = "http://www.w3.org/2001/04/xmlenc#sha256"
+	algSHA512 = "http://www.w3.org/2001/04/xmlenc#sha512"
+)
+
+// ErrInvalidSignature is returned when a signature is missing, malformed,
+// uses an unsupported algorithm or does not verify with the identity
+// provider's certificates
+var ErrInvalidSignature = errors.New("invalid XML signature")
+
+// element is an XML element. Unlike encoding/xml, it keeps namespace
+// prefixes and declarations, which canonicalization needs.
+type element struct {
+	Prefix string
+	Local  string
+	Space  string // namespace URI
+
+	Attrs []attribute
+	Decls []namespaceDecl // xmlns attributes of this element
+
+	Children []node
+	Parent   *element
+
+	scope map[string]string // in-scope prefixes, "" for the default namespace
+}
+
+type attribute struct {
+	Prefix string
+	Local  string
+	Space  string
+	Value  string
+}
+
+type namespaceDecl struct {
+	Prefix string
+	URI    string
+}
+
+type nodeKind int
+
+const (
+	textNode nodeKind = iota
+	elementNode
+	commentNode
+	procInstNode
+)
+
+type node struct {
+	Kind   nodeKind
+	Text   string // text, comment or processing instruction data
+	Target string // processing instruction target
+	Elem   *element
+}
+
+// parseXML parses a document into elements. Documents with a DTD are
+// rejected, so no entities beyond the predefined ones are expanded.
+func parseXML(data []byte) (*element, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+
+	var root, cur *element
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if cur == nil && root != nil {
+				return nil, errors.New("xml: more than one root element")
+			}
+			e, err := newElement(t, cur)
+			if err != nil {
+				return nil, err
+			}
+			if cur == nil {
+				root = e
+			} else {
+				cur.Children = append(cur.Children, node{Kind: elementNode, Elem: e})
+			}
+			cur = e
+
+		case xml.EndElement:
+			if cur == nil || t.Name.Space != cur.Prefix || t.Name.Local != cur.Local {
+				return nil, fmt.Errorf("xml: unexpected end element </%s>", t.Name.Local)
+			}
+			cur = cur.Parent
+
+		case xml.CharData:
+			if cur == nil {
+				if len(bytes.TrimSpace(t)) != 0 {
+					return nil, errors.New("xml: text outside the root element")
+				}
+				continue
+			}
+			if n := len(cur.Children); n > 0 && cur.Children[n-1].Kind == textNode {
+				cur.Children[n-1].Text += string(t)
+			} else {
+				cur.Children = append(cur.Children, node{Kind: textNode, Text: string(t)})
+			}
+
+		case xml.Comment:
+			if cur != nil {
+				cur.Children = append(cur.Children, node{Kind: commentNode, Text: string(t)})
+			}
+
+		case xml.ProcInst:
+			if cur != nil {
+				cur.Children = append(cur.Children, node{Kind: procInstNode, Target: t.Target, Text: string(t.Inst)})
+			}
+
+		case xml.Directive:
+			return nil, errors.New("xml: DTDs are not allowed")
+		}
+	}
+
+	if root == nil || cur != nil {
+		return nil, errors.New("xml: incomplete document")
+	}
+	return root, nil
+}
+
+func newElement(t xml.StartElement, parent *element) (*element, error) {
+	e := &element{Prefix: t.Name.Space, Local: t.Name.Local, Parent: parent}
+
+	for _, a := range t.Attr {
+		switch {
+		case a.Name.Space == "" && a.Name.Local == "xmlns":
+			e.Decls = append(e.Decls, namespaceDecl{URI: a.Value})
+		case a.Name.Space == "xmlns":
+			if a.Value == "" {
+				return nil, fmt.Errorf("xml: empty namespace for prefix %q", a.Name.Local)
+			}
+			e.Decls = append(e.Decls, namespaceDecl{Prefix: a.Name.Local, URI: a.Value})
+		default:
+			e.Attrs = append(e.Attrs, attribute{Prefix: a.Name.Space, Local: a.Name.Local, Value: a.Value})
+		}
+	}
+
+	if parent == nil {
+		e.scope = map[string]string{"xml": nsXML}
+	} else {
+		e.scope = parent.scope
+	}
+	if len(e.Decls) > 0 {
+		scope := make(map[string]string, len(e.scope)+len(e.Decls))
+		for p, uri := range e.scope {
+			scope[p] = uri
+		}
+		for _, decl := range e.Decls {
+			scope[decl.Prefix] = decl.URI
+		}
+		e.scope = scope
+	}
+
+	space, ok := e.scope[e.Prefix]
+	if !ok && e.Prefix != "" {
+		return nil, fmt.Errorf("xml: undeclared prefix %q", e.Prefix)
+	}
+	e.Space = space
+
+	seen := make(map[string]bool, len(e.Attrs))
+	for i := range e.Attrs {
+		a := &e.Attrs[i]
+		if a.Prefix != "" {
+			space, ok := e.scope[a.Prefix]
+			if !ok {
+				return nil, fmt.Errorf("xml: undeclared prefix %q", a.Prefix)
+			}
+			a.Space = space
+		}
+		key := a.Space + " " + a.Local
+		if seen[key] {
+			return nil, fmt.Errorf("xml: duplicate attribute %q", a.Local)
+		}
+		seen[key] = true
+	}
+
+	return e, nil
+}
+
+// Attr returns the value of an attribute without a namespace
+func (e *element) Attr(local string) string {
+	for _, a := range e.Attrs {
+		if a.Space == "" && a.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// Child returns the first child element with the given name, or nil
+func (e *element) Child(space, local string) *element {
+	for _, c := range e.Children {
+		if c.Kind == elementNode && c.Elem.Space == space && c.Elem.Local == local {
+			return c.Elem
+		}
+	}
+	return nil
+}
+
+// ChildElements returns the child elements with the given name
+func (e *element) ChildElements(space, local string) []*element {
+	var found []*element
+	for _, c := range e.Children {
+		if c.Kind == elementNode && c.Elem.Space == space && c.Elem.Local == local {
+			found = append(found, c.Elem)
+		}
+	}
+	return found
+}
+
+// Text returns the element's text. Text split by comments is joined, so
+// a comment cannot truncate a signed value.
+func (e *element) Text() string {
+	var b strings.Builder
+	for _, c := range e.Children {
+		if c.Kind == textNode {
+			b.WriteString(c.Text)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// collectIDs returns an error when two elements share an ID attribute,
+// which signature wrapping attacks rely on
+func collectIDs(e *element, ids map[string]bool) error {
+	if id := e.Attr("ID"); id != "" {
+		if ids[id] {
+			return fmt.Errorf("xml: duplicate ID %q", id)
+		}
+		ids[id] = true
+	}
+	for _, c := range e.Children {
+		if c.Kind == elementNode {
+			if err := collectIDs(c.Elem, ids); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// canonicalizer writes Exclusive XML Canonicalization
+// (https://www.w3.org/TR/xml-exc-c14n/) of a subtree
+type canonicalizer struct {
+	comments  bool
+	inclusive []string // InclusiveNamespaces PrefixList, "" for #default
+	omit      *element // the enveloped signature
+}
+
+func (c *canonicalizer) canonicalize(e *element) []byte {
+	var buf bytes.Buffer
+	c.writeElement(&buf, e, map[string]string{})
+	return buf.Bytes()
+}
+
+func (c *canonicalizer) writeElement(buf *bytes.Buffer, e *element, rendered map[string]string) {
+	// Render the namespaces the element and its attributes use, and those
+	// in the inclusive list, unless an output ancestor already did
+	used := map[string]bool{e.Prefix: true}
+	for _, a := range e.Attrs {
+		if a.Prefix != "" {
+			used[a.Prefix] = true
+		}
+	}
+	for _, p := range c.inclusive {
+		if _, ok := e.scope[p]; ok {
+			used[p] = true
+		}
+	}
+
+	var decls []namespaceDecl
+	for p := range used {
+		if p == "xml" {
+			continue
+		}
+		uri := e.scope[p]
+		prev, ok := rendered[p]
+		if !ok && p == "" {
+			// The default namespace starts out empty
+			prev, ok = "", true
+		}
+		if ok && prev == uri {
+			continue
+		}
+		decls = append(decls, namespaceDecl{Prefix: p, URI: uri})
+	}
+	sort.Slice(decls, func(i, j int) bool { return decls[i].Prefix < decls[j].Prefix })
+
+	if len(decls) > 0 {
+		next := make(map[string]string, len(rendered)+len(decls))
+		for p, uri := range rendered {
+			next[p] = uri
+		}
+		for _, decl := range decls {
+			next[decl.Prefix] = decl.URI
+		}
+		rendered = next
+	}
+
+	attrs := append([]attribute(nil), e.Attrs...)
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].Space != attrs[j].Space {
+			return attrs[i].Space < attrs[j].Space
+		}
+		return attrs[i].Local < attrs[j].Local
+	})
+
+	buf.WriteByte('<')
+	writeQName(buf, e.Prefix, e.Local)
+	for _, decl := range decls {
+		if decl.Prefix == "" {
+			buf.WriteString(` xmlns="`)
+		} else {
+			buf.WriteString(` xmlns:` + decl.Prefix + `="`)
+		}
+		escapeAttr(buf, decl.URI)
+		buf.WriteByte('"')
+	}
+	for _, a := range attrs {
+		buf.WriteByte(' ')
+		writeQName(buf, a.Prefix, a.Local)
+		buf.WriteString(`="`)
+		escapeAttr(buf, a.Value)
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('>')
+
+	for _, child := range e.Children {
+		switch child.Kind {
+		case textNode:
+			escapeText(buf, child.Text)
+		case elementNode:
+			if child.Elem != c.omit {
+				c.writeElement(buf, child.Elem, rendered)
+			}
+		case commentNode:
+			if c.comments {
+				buf.WriteString("<!--" + child.Text + "-->")
+			}
+		case procInstNode:
+			buf.WriteString("<?" + child.Target)
+			if child.Text != "" {
+				buf.WriteString(" " + child.Text)
+			}
+			buf.WriteString("?>")
+		}
+	}
+
+	buf.WriteString("</")
+	writeQName(buf, e.Prefix, e.Local)
+	buf.WriteByte('>')
+}
+
+func writeQName(buf *bytes.Buffer, prefix, local string) {
+	if prefix != "" {
+		buf.WriteString(prefix + ":")
+	}
+	buf.WriteString(local)
+}
+
+func escapeText(buf *bytes.Buffer, s string) {
+	for _, r := range s {
+		switch r {
+		case '&':
+			buf.WriteString("&amp;")
+		case '<':
+			buf.WriteString("&lt;")
+		case '>':
+			buf.WriteString("&gt;")
+		case '\r':
+			buf.WriteString("&#xD;")
+		default:
+			buf.WriteRune(r)
+		}
+	}
+}
+
+func escapeAttr(buf *bytes.Buffer, s string) {
+	for _, r := range s {
+		switch r {
+		case '&':
+			buf.WriteString("&amp;")
+		case '<':
+			buf.WriteString("&lt;")
+		case '"':
+			buf.WriteString("&quot;")
+		case '\t':
+			buf.WriteString("&#x9;")
+		case '\n':
+			buf.WriteString("&#xA;")
+		case '\r':
+			buf.WriteString("&#xD;")
+		default:
+			buf.WriteRune(r)
+		}
+	}
+}
+
+// verifySignature checks sig, a Signature child of signed, against the
+// certificates. The signature must reference signed by its ID, so what
+// is verified is what the caller reads.
+func verifySignature(sig, signed *element, certs []*x509.Certificate) error {
+	if sig.Parent != signed {
+		return fmt.Errorf("%w: signature is not enveloped", ErrInvalidSignature)
+	}
+	signedInfo := sig.Child(nsDSig, "SignedInfo")
+	if signedInfo == nil {
+		return fmt.Errorf("%w: missing SignedInfo", ErrInvalidSignature)
+	}
+
+	c14nMethod := signedInfo.Child(nsDSig, "CanonicalizationMethod")
+	if c14nMethod == nil {
+		return fmt.Errorf("%w: missing CanonicalizationMethod", ErrInvalidSignature)
+	}
+	signedInfoC14N, err := newCanonicalizer(c14nMethod)
+	if err != nil {
+		return err
+	}
+
+	refs := signedInfo.ChildElements(nsDSig, "Reference")
+	if len(refs) != 1 {
+		return fmt.Errorf("%w: expected one Reference, found %d", ErrInvalidSignature, len(refs))
+	}
+	ref := refs[0]
+	id := signed.Attr("ID")
+	if id == "" || ref.Attr("URI") != "#"+id {
+		return fmt.Errorf("%w: reference does not match the signed element", ErrInvalidSignature)
+	}
+
+	// A bare-name reference drops comments whatever the transform says
+	refC14N := &canonicalizer{omit: sig}
+	enveloped, canonical := false, false
+	if transforms := ref.Child(nsDSig, "Transforms"); transforms != nil {
+		for _, t := range transforms.ChildElements(nsDSig, "Transform") {
+			switch alg := t.Attr("Algorithm"); alg {
+			case algEnvelopedSignature:
+				enveloped = true
+			case algExcC14N, algExcC14NWithComments:
+				canonical = true
+				refC14N.inclusive = inclusivePrefixes(t)
+			default:
+				return fmt.Errorf("%w: unsupported transform %q", ErrInvalidSignature, alg)
+			}
+		}
+	}
+	if !enveloped || !canonical {
+		return fmt.Errorf("%w: expected enveloped-signature and exclusive canonicalization transforms", ErrInvalidSignature)
+	}
+
+	digestMethod := ref.Child(nsDSig, "DigestMethod")
+	digestValue := ref.Child(nsDSig, "DigestValue")
+	if digestMethod == nil || digestValue == nil {
+		return fmt.Errorf("%w: missing digest", ErrInvalidSignature)
+	}
+	digestHash, err := digestAlgorithm(digestMethod.Attr("Algorithm"))
+	if err != nil {
+		return err
+	}
+	want, err := decodeBase64(digestValue.Text())
+	if err != nil {
+		return fmt.Errorf("%w: malformed DigestValue", ErrInvalidSignature)
+	}
+	h := digestHash.New()
+	h.Write(refC14N.canonicalize(signed))
+	if subtle.ConstantTimeCompare(h.Sum(nil), want) != 1 {
+		return fmt.Errorf("%w: digest mismatch", ErrInvalidSignature)
+	}
+
+	signatureMethod := signedInfo.Child(nsDSig, "SignatureMethod")
+	signatureValue := sig.Child(nsDSig, "SignatureValue")
+	if signatureMethod == nil || signatureValue == nil {
+		return fmt.Errorf("%w: missing SignatureValue", ErrInvalidSignature)
+	}
+	signature, err := decodeBase64(signatureValue.Text())
+	if err != nil {
+		return fmt.Errorf("%w: malformed SignatureValue", ErrInvalidSignature)
+	}
+
+	alg := signatureMethod.Attr("Algorithm")
+	var signatureHash crypto.Hash
+	switch alg {
+	case algRSASHA256, algECDSASHA256:
+		signatureHash = crypto.SHA256
+	case algRSASHA512, algECDSASHA512:
+		signatureHash = crypto.SHA512
+	default:
+		return fmt.Errorf("%w: unsupported signature method %q", ErrInvalidSignature, alg)
+	}
+	h = signatureHash.New()
+	h.Write(signedInfoC14N.canonicalize(signedInfo))
+	hashed := h.Sum(nil)
+
+	for _, cert := range certs {
+		switch key := cert.PublicKey.(type) {
+		case *rsa.PublicKey:
+			if (alg == algRSASHA256 || alg == algRSASHA512) && rsa.VerifyPKCS1v15(key, signatureHash, hashed, signature) == nil {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			// XMLDSig ECDSA signatures are r and s concatenated
+			if (alg == algECDSASHA256 || alg == algECDSASHA512) && len(signature)%2 == 0 {
+				half := len(signature) / 2
+				r := new(big.Int).SetBytes(signature[:half])
+				s := new(big.Int).SetBytes(signature[half:])
+				if ecdsa.Verify(key, hashed, r, s) {
+					return nil
+				}
+			}
+		}
+	}
+	return fmt.Errorf("%w: signature does not match any certificate", ErrInvalidSignature)
+}
+
+// newCanonicalizer returns the canonicalizer of a CanonicalizationMethod
+func newCanonicalizer(method *element) (*canonicalizer, error) {
+	switch alg := method.Attr("Algorithm"); alg {
+	case algExcC14N:
+		return &canonicalizer{inclusive: inclusivePrefixes(method)}, nil
+	case algExcC14NWithComments:
+		return &canonicalizer{comments: true, inclusive: inclusivePrefixes(method)}, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported canonicalization %q", ErrInvalidSignature, alg)
+	}
+}
+
+// inclusivePrefixes returns the PrefixList of an InclusiveNamespaces
+// child of a transform
+func inclusivePrefixes(transform *element) []string {
+	for _, c := range transform.Children {
+		if c.Kind != elementNode || c.Elem.Local != "InclusiveNamespaces" || c.Elem.Space != algExcC14N {
+			continue
+		}
+		var prefixes []string
+		for _, p := range strings.Fields(c.Elem.Attr("PrefixList")) {
+			if p == "#default" {
+				p = ""
+			}
+			prefixes = append(prefixes, p)
+		}
+		return prefixes
+	}
+	return nil
+}
+
+func digestAlgorithm(alg string) (crypto.Hash, error) {
+	switch alg {
+	case algSHA256:
+		return crypto.SHA256, nil
+	case algSHA512:
+		return crypto.SHA512, nil
+	default:
+		return 0, fmt.Errorf("%w: unsupported digest method %q", ErrInvalidSignature, alg)
+	}
+}
+
+// decodeBase64 decodes base64 that may be wrapped across lines
+func decodeBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n':
+			return -1
+		}
+		return r
+	}, s))
+}
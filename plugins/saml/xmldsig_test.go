@@ -0,0 +1,149 @@
+package saml
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		name      string
+		doc       string
+		path      []string // child element locals from the root to the subtree
+		inclusive []string
+		want      string
+	}{
+		{
+			name: "orders namespaces and attributes and escapes",
+			doc: `<a:root xmlns:a="urn:a" xmlns:b="urn:b" xmlns="urn:d" z="1" b:y="2" a="3">` +
+				`<child attr="x &amp; &lt; &quot;">text &amp; &gt; <![CDATA[<cdata>]]><!-- c --></child><b:x/></a:root>`,
+			want: `<a:root xmlns:a="urn:a" xmlns:b="urn:b" a="3" z="1" b:y="2">` +
+				`<child xmlns="urn:d" attr="x &amp; &lt; &quot;">text &amp; &gt; &lt;cdata&gt;</child><b:x></b:x></a:root>`,
+		},
+		{
+			name: "renders inherited namespaces on the subtree",
+			doc:  `<r xmlns="urn:d" xmlns:p="urn:p" xmlns:unused="urn:u"><p:s><t xmlns=""/></p:s></r>`,
+			path: []string{"s"},
+			want: `<p:s xmlns:p="urn:p"><t></t></p:s>`,
+		},
+		{
+			name: "undeclares the default namespace",
+			doc:  `<r xmlns="urn:d" xmlns:p="urn:p"><p:s><t xmlns=""/></p:s></r>`,
+			want: `<r xmlns="urn:d"><p:s xmlns:p="urn:p"><t xmlns=""></t></p:s></r>`,
+		},
+		{
+			name:      "renders inclusive namespaces",
+			doc:       `<r xmlns:q="urn:q" xmlns:z="urn:z"><s/></r>`,
+			path:      []string{"s"},
+			inclusive: []string{"q", "missing"},
+			want:      `<s xmlns:q="urn:q"></s>`,
+		},
+		{
+			name: "keeps whitespace and drops xml declaration",
+			doc:  "<?xml version=\"1.0\"?>\n<r>\n  <s a=\"1\"\tb=\"2\" />\r\n</r>",
+			want: "<r>\n  <s a=\"1\" b=\"2\"></s>\n</r>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := parseXML([]byte(tt.doc))
+			if err != nil {
+				t.Fatalf("parseXML failed: %v", err)
+			}
+			e := root
+			for _, local := range tt.path {
+				var next *element
+				for _, c := range e.Children {
+					if c.Kind == elementNode && c.Elem.Local == local {
+						next = c.Elem
+					}
+				}
+				if next == nil {
+					t.Fatalf("no element %q", local)
+				}
+				e = next
+			}
+
+			got := string((&canonicalizer{inclusive: tt.inclusive}).canonicalize(e))
+			if got != tt.want {
+				t.Errorf("canonicalize =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseXMLRejectsMalformed(t *testing.T) {
+	docs := map[string]string{
+		"DTD":              `<!DOCTYPE r [<!ENTITY x "y">]><r>&x;</r>`,
+		"undeclared":       `<p:r/>`,
+		"mismatched":       `<a></b>`,
+		"two roots":        `<a/><b/>`,
+		"duplicate attr":   `<r xmlns:p="urn:x" xmlns:q="urn:x" p:a="1" q:a="2"/>`,
+		"unterminated":     `<r>`,
+		"text outside":     `<r/>text`,
+		"empty prefix uri": `<r xmlns:p=""/>`,
+	}
+	for name, doc := range docs {
+		if _, err := parseXML([]byte(doc)); err == nil {
+			t.Errorf("%s: parseXML accepted %q", name, doc)
+		}
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	idp := newTestIdP(t)
+	doc := `<r xmlns="urn:r" ID="_r"><Issuer>idp</Issuer><v>value</v></r>`
+
+	verify := func(doc string) error {
+		root, err := parseXML([]byte(doc))
+		if err != nil {
+			t.Fatalf("parseXML failed: %v", err)
+		}
+		sig := root.Child(nsDSig, "Signature")
+		if sig == nil {
+			t.Fatal("no signature")
+		}
+		return verifySignature(sig, root, idp.cert())
+	}
+
+	signed := idp.sign(t, doc, "_r", "</Issuer>")
+	if err := verify(signed); err != nil {
+		t.Fatalf("verifySignature failed: %v", err)
+	}
+
+	t.Run("tampered", func(t *testing.T) {
+		err := verify(replaceOnce(t, signed, "<v>value</v>", "<v>other</v>"))
+		if !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("err = %v, want ErrInvalidSignature", err)
+		}
+	})
+
+	t.Run("comments do not change the digest", func(t *testing.T) {
+		if err := verify(replaceOnce(t, signed, "<v>value</v>", "<v>val<!-- x -->ue</v>")); err != nil {
+			t.Errorf("verifySignature failed: %v", err)
+		}
+	})
+
+	t.Run("other key", func(t *testing.T) {
+		other := newTestIdP(t)
+		err := verify(other.sign(t, doc, "_r", "</Issuer>"))
+		if !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("err = %v, want ErrInvalidSignature", err)
+		}
+	})
+
+	t.Run("reference to another element", func(t *testing.T) {
+		err := verify(replaceOnce(t, signed, `URI="#_r"`, `URI="#_other"`))
+		if !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("err = %v, want ErrInvalidSignature", err)
+		}
+	})
+
+	t.Run("SHA-1", func(t *testing.T) {
+		err := verify(replaceOnce(t, signed, algSHA256, "http://www.w3.org/2000/09/xmldsig#sha1"))
+		if !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("err = %v, want ErrInvalidSignature", err)
+		}
+	})
+}
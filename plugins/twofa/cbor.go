@@ -0,0 +1,127 @@
+package twofa
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// errCBOR is returned for CBOR that cannot be decoded
+var errCBOR = errors.New("twofa: malformed CBOR")
+
+// maxCBORDepth limits nesting, so hostile input cannot exhaust the stack
+const maxCBORDepth = 16
+
+// decodeCBOR decodes the first CBOR item of data, as used by WebAuthn
+// attestation objects and COSE keys, and returns it with the number of
+// bytes it took. Integers decode to int64, byte strings to []byte, text to
+// string, arrays to []interface{} and maps to map[interface{}]interface{}
+// keyed by int64 or string. Floats, tags and indefinite lengths are not
+// used by WebAuthn and are rejected.
+func decodeCBOR(data []byte) (interface{}, int, error) {
+	return decodeCBORItem(data, 0)
+}
+
+func decodeCBORItem(data []byte, depth int) (interface{}, int, error) {
+	if depth > maxCBORDepth || len(data) == 0 {
+		return nil, 0, errCBOR
+	}
+
+	major := data[0] >> 5
+	arg, n, err := cborArgument(data)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch major {
+	case 0: // unsigned integer
+		if arg > 1<<63-1 {
+			return nil, 0, errCBOR
+		}
+		return int64(arg), n, nil
+	case 1: // negative integer
+		if arg > 1<<63-1 {
+			return nil, 0, errCBOR
+		}
+		return -1 - int64(arg), n, nil
+	case 2, 3: // byte and text strings
+		if arg > uint64(len(data)-n) {
+			return nil, 0, errCBOR
+		}
+		end := n + int(arg)
+		if major == 2 {
+			return append([]byte(nil), data[n:end]...), end, nil
+		}
+		return string(data[n:end]), end, nil
+	case 4: // array
+		if arg > uint64(len(data)) {
+			return nil, 0, errCBOR
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			item, size, err := decodeCBORItem(data[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			items = append(items, item)
+			n += size
+		}
+		return items, n, nil
+	case 5: // map
+		if arg > uint64(len(data)) {
+			return nil, 0, errCBOR
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, size, err := decodeCBORItem(data[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			n += size
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, 0, fmt.Errorf("%w: unsupported map key", errCBOR)
+			}
+			value, size, err := decodeCBORItem(data[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			n += size
+			if _, dup := m[key]; dup {
+				return nil, 0, fmt.Errorf("%w: duplicate map key", errCBOR)
+			}
+			m[key] = value
+		}
+		return m, n, nil
+	case 7: // simple values
+		switch data[0] & 0x1f {
+		case 20:
+			return false, 1, nil
+		case 21:
+			return true, 1, nil
+		case 22:
+			return nil, 1, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("%w: unsupported item 0x%02x", errCBOR, data[0])
+}
+
+// cborArgument returns the argument of the item starting data and the
+// size of its head
+func cborArgument(data []byte) (uint64, int, error) {
+	info := data[0] & 0x1f
+	switch {
+	case info < 24:
+		return uint64(info), 1, nil
+	case info == 24 && len(data) >= 2:
+		return uint64(data[1]), 2, nil
+	case info == 25 && len(data) >= 3:
+		return uint64(binary.BigEndian.Uint16(data[1:])), 3, nil
+	case info == 26 && len(data) >= 5:
+		return uint64(binary.BigEndian.Uint32(data[1:])), 5, nil
+	case info == 27 && len(data) >= 9:
+		return binary.BigEndian.Uint64(data[1:]), 9, nil
+	}
+	return 0, 0, errCBOR
+}
@@ -0,0 +1,103 @@
+package twofa
+
+import (
+	stdcrypto "crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithms of security keys (RFC 9053)
+const (
+	coseES256 int64 = -7
+	coseEdDSA int64 = -8
+	coseRS256 int64 = -257
+)
+
+// supportedAlgorithms are offered to authenticators in order of preference
+var supportedAlgorithms = []int64{coseES256, coseEdDSA, coseRS256}
+
+// cosePublicKey is a credential public key
+type cosePublicKey struct {
+	alg int64
+	key interface{} // *ecdsa.PublicKey, ed25519.PublicKey or *rsa.PublicKey
+}
+
+// parseCOSEKey parses a COSE_Key (RFC 9052) of a supported algorithm
+func parseCOSEKey(data []byte) (*cosePublicKey, error) {
+	item, n, err := decodeCBOR(data)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := item.(map[interface{}]interface{})
+	if !ok || n != len(data) {
+		return nil, errors.New("public key is not a COSE key")
+	}
+
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+	switch {
+	case kty == 2 && alg == coseES256:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("invalid P-256 public key")
+		}
+		// ecdh validates that the point is on the curve
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, fmt.Errorf("invalid P-256 public key: %w", err)
+		}
+		return &cosePublicKey{alg: alg, key: &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}}, nil
+
+	case kty == 1 && alg == coseEdDSA:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		if crv != 6 || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 public key")
+		}
+		return &cosePublicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+
+	case kty == 3 && alg == coseRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA public key")
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if exponent.Int64() < 3 || exponent.Bit(0) == 0 {
+			return nil, errors.New("invalid RSA public key exponent")
+		}
+		return &cosePublicKey{alg: alg, key: &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(exponent.Int64()),
+		}}, nil
+	}
+	return nil, fmt.Errorf("unsupported public key type %d with algorithm %d", kty, alg)
+}
+
+// verify checks the signature of data
+func (k *cosePublicKey) verify(data, sig []byte) bool {
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, digest[:], sig)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, sig)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, stdcrypto.SHA256, digest[:], sig) == nil
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package twofa
+
+import "github.com/marshallshelly/beacon-auth/core"
+
+// Schema returns the tables of TOTP secrets, backup codes and security
+// keys
+func (p *TwoFAPlugin) Schema() []core.TableDef {
+	return []core.TableDef{
+		{
+			Model: TableTwoFactors,
+			Columns: []core.ColumnDef{
+				{Name: "id", Type: core.ColumnID},
+				{Name: "user_id", Type: core.ColumnForeignID, NotNull: true},
+				{Name: "secret", Type: core.ColumnText, NotNull: true},
+				{Name: "uri", Type: core.ColumnText, NotNull: true},
+				{Name: "created_at", Type: core.ColumnTimestamp, Default: core.DefaultNow},
+			},
+			ForeignKeys: []core.ForeignKeyDef{{Name: "FK_TwoFactor_User", Column: "user_id", Model: core.ModelUsers}},
+		},
+		{
+			Model: TableBackupCodes,
+			Columns: []core.ColumnDef{
+				{Name: "id", Type: core.ColumnID},
+				{Name: "user_id", Type: core.ColumnForeignID, NotNull: true},
+				{Name: "code", Type: core.ColumnString, NotNull: true},
+				{Name: "created_at", Type: core.ColumnTimestamp, Default: core.DefaultNow},
+			},
+			ForeignKeys: []core.ForeignKeyDef{{Name: "FK_BackupCode_User", Column: "user_id", Model: core.ModelUsers}},
+		},
+		{
+			Model: TableSecurityKeys,
+			Columns: []core.ColumnDef{
+				{Name: "id", Type: core.ColumnID},
+				{Name: "user_id", Type: core.ColumnForeignID, NotNull: true},
+				{Name: "credential_id", Type: core.ColumnString, Size: 512, NotNull: true, Unique: true},
+				{Name: "public_key", Type: core.ColumnText, NotNull: true},
+				{Name: "sign_count", Type: core.ColumnBigInt, NotNull: true, Default: "0"},
+				{Name: "name", Type: core.ColumnString, NotNull: true},
+				{Name: "created_at", Type: core.ColumnTimestamp, Default: core.DefaultNow},
+				{Name: "last_used_at", Type: core.ColumnTimestamp},
+			},
+			ForeignKeys: []core.ForeignKeyDef{{Name: "FK_SecurityKey_User", Column: "user_id", Model: core.ModelUsers}},
+		},
+	}
+}
@@ -0,0 +1,344 @@
+package twofa
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/crypto"
+)
+
+// encryptedPrefix starts TOTP secrets sealed with an EncryptionKey:
+// "enc:{key id}:{base64 nonce and ciphertext}". Base32 TOTP secrets never
+// contain ':', so secrets stored before encryption are told apart.
+const encryptedPrefix = "enc:"
+
+// EncryptionKey is a data-encryption key for TOTP secrets
+type EncryptionKey struct {
+	// ID names the key in encrypted secrets so it can be rotated. It may
+	// only contain letters, digits, '-' and '_'.
+	ID string
+
+	// Key is the AES key: 16, 24 or 32 bytes. Use 32 for AES-256.
+	Key []byte
+}
+
+// ErrUnknownEncryptionKey is returned for secrets encrypted with a key that
+// is not configured
+var ErrUnknownEncryptionKey = errors.New("twofa: secret encrypted with an unknown key")
+
+// ParseEncryptionKeys parses keys from a comma separated list of
+// "id:key" entries, newest (active) key first, where key is base64
+// encoded. For example:
+//
+//	2025-06:q8Ylq6m3...,2025-01:Zk1c9Hsa...
+func ParseEncryptionKeys(config string) ([]EncryptionKey, error) {
+	var keys []EncryptionKey
+	for _, entry := range strings.Split(config, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid encryption key entry %q: expected id:key", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			if key, err = base64.RawURLEncoding.DecodeString(encoded); err != nil {
+				return nil, fmt.Errorf("invalid encryption key %q: not valid base64", id)
+			}
+		}
+		keys = append(keys, EncryptionKey{ID: id, Key: key})
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no encryption keys configured")
+	}
+	return keys, nil
+}
+
+// WithEncryptionKeys encrypts TOTP secrets with AES-GCM. The first key
+// encrypts new secrets; the others only decrypt secrets stored before a
+// rotation, which are re-encrypted with the first key when next used or by
+// MigrateSecrets. Without keys, secrets are stored in plaintext.
+func (p *TwoFAPlugin) WithEncryptionKeys(keys ...EncryptionKey) *TwoFAPlugin {
+	p.keys = keys
+	return p
+}
+
+// WithEncryptionKeysSecret reads the encryption keys from the secret named
+// name, in the ParseEncryptionKeys format, from the secret manager (see
+// beaconauth.WithSecretProvider). When the secret rotates, the new keys
+// replace the old ones without a restart. It replaces WithEncryptionKeys.
+func (p *TwoFAPlugin) WithEncryptionKeysSecret(name string) *TwoFAPlugin {
+	p.keysSecret = name
+	return p
+}
+
+// keyRing holds the encryption keys and their ciphers. It is replaced as a
+// whole when the keys secret rotates.
+type keyRing struct {
+	keys    []EncryptionKey
+	ciphers map[string]cipher.AEAD
+}
+
+// newKeyRing validates the encryption keys and prepares their ciphers
+func newKeyRing(keys []EncryptionKey) (*keyRing, error) {
+	ring := &keyRing{keys: keys, ciphers: make(map[string]cipher.AEAD, len(keys))}
+	for _, key := range keys {
+		if !validKeyID(key.ID) {
+			return nil, fmt.Errorf("twofa: invalid encryption key ID: %q", key.ID)
+		}
+		if _, ok := ring.ciphers[key.ID]; ok {
+			return nil, fmt.Errorf("twofa: duplicate encryption key ID: %q", key.ID)
+		}
+		block, err := aes.NewCipher(key.Key)
+		if err != nil {
+			return nil, fmt.Errorf("twofa: encryption key %q: %w", key.ID, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		ring.ciphers[key.ID] = aead
+	}
+	return ring, nil
+}
+
+// initCiphers validates the encryption keys and prepares their ciphers
+func (p *TwoFAPlugin) initCiphers() error {
+	ring, err := newKeyRing(p.keys)
+	if err != nil {
+		return err
+	}
+	p.ring.Store(ring)
+	return nil
+}
+
+// initKeysSecret fetches the keys of WithEncryptionKeysSecret and watches
+// the secret for rotations
+func (p *TwoFAPlugin) initKeysSecret() error {
+	if p.keysSecret == "" {
+		return nil
+	}
+	if len(p.keys) > 0 {
+		return errors.New("twofa: use either WithEncryptionKeys or WithEncryptionKeysSecret")
+	}
+	if p.ctx.Secrets == nil {
+		return errors.New("twofa: the encryption keys secret needs a secret provider (use WithSecretProvider)")
+	}
+
+	value, err := p.ctx.Secrets.Watch(context.Background(), p.keysSecret, func(value string) {
+		keys, err := ParseEncryptionKeys(value)
+		if err != nil {
+			p.ctx.Logger.Error("Rotated 2FA encryption keys rejected; keeping the previous keys: %v", err)
+			return
+		}
+		ring, err := newKeyRing(keys)
+		if err != nil {
+			p.ctx.Logger.Error("Rotated 2FA encryption keys rejected; keeping the previous keys: %v", err)
+			return
+		}
+		p.ring.Store(ring)
+		p.ctx.Logger.Info("2FA encryption keys rotated")
+	})
+	if err != nil {
+		return fmt.Errorf("twofa: failed to load encryption keys: %w", err)
+	}
+	keys, err := ParseEncryptionKeys(value)
+	if err != nil {
+		return fmt.Errorf("twofa: %w", err)
+	}
+	p.keys = keys
+	return nil
+}
+
+// encryptionKeys returns the current encryption keys
+func (p *TwoFAPlugin) encryptionKeys() *keyRing {
+	if ring := p.ring.Load(); ring != nil {
+		return ring
+	}
+	return &keyRing{}
+}
+
+// sealSecret returns the stored form of a user's TOTP secret. The
+// ciphertext is bound to the user, so it cannot be copied to another row.
+func (p *TwoFAPlugin) sealSecret(userID, secret string) (string, error) {
+	ring := p.encryptionKeys()
+	if len(ring.keys) == 0 {
+		return secret, nil
+	}
+
+	keyID := ring.keys[0].ID
+	aead := ring.ciphers[keyID]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(secret), []byte(userID))
+	return encryptedPrefix + keyID + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// openSecret returns the TOTP secret of a stored secret
+func (p *TwoFAPlugin) openSecret(userID, stored string) (string, error) {
+	rest, ok := strings.CutPrefix(stored, encryptedPrefix)
+	if !ok {
+		return stored, nil
+	}
+
+	keyID, encoded, _ := strings.Cut(rest, ":")
+	aead, ok := p.encryptionKeys().ciphers[keyID]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownEncryptionKey, keyID)
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("twofa: malformed encrypted secret")
+	}
+	secret, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(userID))
+	if err != nil {
+		return "", fmt.Errorf("twofa: decrypting secret: %w", err)
+	}
+	return string(secret), nil
+}
+
+// needsReseal reports whether a stored secret is not encrypted with the
+// active key
+func (p *TwoFAPlugin) needsReseal(stored string) bool {
+	ring := p.encryptionKeys()
+	if len(ring.keys) == 0 {
+		return false
+	}
+	return !strings.HasPrefix(stored, encryptedPrefix+ring.keys[0].ID+":")
+}
+
+// backupCodeHasher hashes backup codes. The parameters are lighter than
+// for passwords since a code is checked against each of the user's unused
+// codes.
+var backupCodeHasher = newBackupCodeHasher()
+
+func newBackupCodeHasher() *crypto.Argon2Hasher {
+	h, err := crypto.NewArgon2Hasher(
+		crypto.WithArgon2Memory(19*1024),
+		crypto.WithArgon2Iterations(2),
+		crypto.WithArgon2Parallelism(1),
+	)
+	if err != nil {
+		// The parameters are constants above the crypto minimums
+		panic(err)
+	}
+	return h
+}
+
+// hashedBackupCode reports whether a stored backup code is a hash. Codes
+// stored before hashing are plaintext hex.
+func hashedBackupCode(stored string) bool {
+	return strings.HasPrefix(stored, "$argon2id$")
+}
+
+// matchBackupCode reports whether code matches a stored backup code
+func matchBackupCode(stored, code string) bool {
+	if !hashedBackupCode(stored) {
+		return subtle.ConstantTimeCompare([]byte(stored), []byte(code)) == 1
+	}
+	ok, err := backupCodeHasher.Verify(code, stored)
+	return err == nil && ok
+}
+
+// MigrateSecrets rewrites rows stored before encryption, hashing or a key
+// rotation: TOTP secrets not encrypted with the active key are
+// re-encrypted, and plaintext backup codes are hashed. It returns the
+// number of rows rewritten and can be run again after an interruption.
+// Run it after the last rotation before retiring old keys.
+func (p *TwoFAPlugin) MigrateSecrets(ctx context.Context) (int, error) {
+	migrated := 0
+
+	records, err := p.ctx.Adapter.FindMany(ctx, core.NewQuery(p.table(TableTwoFactors)).Build())
+	if err != nil {
+		return migrated, err
+	}
+	for _, record := range records {
+		userID, _ := record["user_id"].(string)
+		stored, _ := record["secret"].(string)
+		if !p.needsReseal(stored) {
+			continue
+		}
+		secret, err := p.openSecret(userID, stored)
+		if err != nil {
+			return migrated, err
+		}
+		sealed, err := p.sealSecret(userID, secret)
+		if err != nil {
+			return migrated, err
+		}
+		query := core.NewQuery(p.table(TableTwoFactors)).
+			Where("user_id", core.OpEqual, userID).
+			Where("secret", core.OpEqual, stored).
+			Build()
+		if _, err := p.ctx.Adapter.UpdateMany(ctx, query, map[string]interface{}{"secret": sealed, "updated_at": time.Now()}); err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+
+	codes, err := p.ctx.Adapter.FindMany(ctx, core.NewQuery(p.table(TableBackupCodes)).Build())
+	if err != nil {
+		return migrated, err
+	}
+	for _, record := range codes {
+		stored, _ := record["code"].(string)
+		if hashedBackupCode(stored) {
+			continue
+		}
+		hash, err := backupCodeHasher.Hash(stored)
+		if err != nil {
+			return migrated, err
+		}
+		id, err := crypto.GenerateID()
+		if err != nil {
+			return migrated, err
+		}
+
+		// Earlier record IDs contain the code, so the row is replaced
+		hashed := make(map[string]interface{}, len(record))
+		for field, value := range record {
+			hashed[field] = value
+		}
+		hashed["id"] = id
+		hashed["code"] = hash
+		err = p.ctx.Adapter.Transaction(ctx, func(tx core.Adapter) error {
+			if _, err := tx.Create(ctx, p.table(TableBackupCodes), hashed); err != nil {
+				return err
+			}
+			return tx.Delete(ctx, core.NewQuery(p.table(TableBackupCodes)).Where("id", core.OpEqual, record["id"]).Build())
+		})
+		if err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, nil
+}
+
+func validKeyID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
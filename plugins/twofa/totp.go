@@ -0,0 +1,173 @@
+package twofa
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/crypto"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+	"github.com/pquerna/otp/totp"
+)
+
+// usedCodeType marks accepted TOTP time steps in the verifications table
+const usedCodeType = "totp_used"
+
+// Algorithm is the HMAC hash of TOTP codes
+type Algorithm string
+
+// TOTP algorithms. Most authenticator apps only support SHA1.
+const (
+	AlgorithmSHA1   Algorithm = "SHA1"
+	AlgorithmSHA256 Algorithm = "SHA256"
+	AlgorithmSHA512 Algorithm = "SHA512"
+)
+
+// TOTPOptions configures the codes users' authenticator apps generate.
+// Digits, Period and Algorithm are part of each enrollment, so changing
+// them requires users to set up 2FA again.
+type TOTPOptions struct {
+	// Digits is the code length: 6 or 8
+	Digits int
+
+	// Period is how long each code is valid, in whole seconds
+	Period time.Duration
+
+	// Algorithm is the HMAC hash
+	Algorithm Algorithm
+
+	// Skew is the number of periods before and after the current one whose
+	// codes are accepted, to allow for clock drift. 0 accepts only the
+	// current code.
+	Skew uint
+}
+
+// DefaultTOTPOptions returns the options of common authenticator apps:
+// six digits every 30 seconds with SHA1, accepting one period of drift
+func DefaultTOTPOptions() TOTPOptions {
+	return TOTPOptions{
+		Digits:    6,
+		Period:    30 * time.Second,
+		Algorithm: AlgorithmSHA1,
+		Skew:      1,
+	}
+}
+
+// Errors of checkCode
+var (
+	errInvalidCode = errors.New("twofa: invalid code")
+	errCodeReused  = errors.New("twofa: code already used")
+)
+
+// WithTOTP sets the TOTP parameters. Zero Digits, Period and Algorithm keep
+// their defaults; Skew is used as given.
+func (p *TwoFAPlugin) WithTOTP(opts TOTPOptions) *TwoFAPlugin {
+	defaults := DefaultTOTPOptions()
+	if opts.Digits == 0 {
+		opts.Digits = defaults.Digits
+	}
+	if opts.Period == 0 {
+		opts.Period = defaults.Period
+	}
+	if opts.Algorithm == "" {
+		opts.Algorithm = defaults.Algorithm
+	}
+	p.totpOpts = opts
+	return p
+}
+
+// validate checks the options
+func (o TOTPOptions) validate() error {
+	if o.Digits != 6 && o.Digits != 8 {
+		return fmt.Errorf("twofa: TOTP digits must be 6 or 8, got %d", o.Digits)
+	}
+	if o.Period < time.Second || o.Period%time.Second != 0 {
+		return fmt.Errorf("twofa: TOTP period must be whole seconds, got %s", o.Period)
+	}
+	if _, ok := otpAlgorithms[o.Algorithm]; !ok {
+		return fmt.Errorf("twofa: unsupported TOTP algorithm %q", o.Algorithm)
+	}
+	return nil
+}
+
+var otpAlgorithms = map[Algorithm]otp.Algorithm{
+	AlgorithmSHA1:   otp.AlgorithmSHA1,
+	AlgorithmSHA256: otp.AlgorithmSHA256,
+	AlgorithmSHA512: otp.AlgorithmSHA512,
+}
+
+// generateKey creates a TOTP key for the user with the configured options
+func (p *TwoFAPlugin) generateKey(accountName string) (*otp.Key, error) {
+	return totp.Generate(totp.GenerateOpts{
+		Issuer:      p.ctx.Config.AppName,
+		AccountName: accountName,
+		Period:      uint(p.totpOpts.Period / time.Second),
+		Digits:      otp.Digits(p.totpOpts.Digits),
+		Algorithm:   otpAlgorithms[p.totpOpts.Algorithm],
+	})
+}
+
+// matchStep returns the time step whose code is code, within Skew periods
+// of now
+func (p *TwoFAPlugin) matchStep(secret, code string, now time.Time) (uint64, bool) {
+	if len(code) != p.totpOpts.Digits {
+		return 0, false
+	}
+
+	period := int64(p.totpOpts.Period / time.Second)
+	current := now.Unix() / period
+	opts := hotp.ValidateOpts{
+		Digits:    otp.Digits(p.totpOpts.Digits),
+		Algorithm: otpAlgorithms[p.totpOpts.Algorithm],
+	}
+	for i := -int64(p.totpOpts.Skew); i <= int64(p.totpOpts.Skew); i++ {
+		step := current + i
+		if step < 0 {
+			continue
+		}
+		if ok, err := hotp.ValidateCustom(code, uint64(step), secret, opts); err == nil && ok {
+			return uint64(step), true
+		}
+	}
+	return 0, false
+}
+
+// checkCode verifies a TOTP code and records its time step, so the same
+// code cannot be used again while it is valid. It returns errInvalidCode
+// for a wrong code and errCodeReused for one that was already accepted.
+func (p *TwoFAPlugin) checkCode(ctx context.Context, userID, secret, code string) error {
+	now := time.Now()
+	step, ok := p.matchStep(secret, code, now)
+	if !ok {
+		return errInvalidCode
+	}
+
+	// Codes stay valid for Skew periods after their own
+	period := int64(p.totpOpts.Period / time.Second)
+	expiresAt := time.Unix((int64(step)+int64(p.totpOpts.Skew)+1)*period, 0)
+	sum := sha256.Sum256([]byte(userID + ":" + strconv.FormatUint(step, 10)))
+
+	id, err := crypto.GenerateID()
+	if err != nil {
+		return err
+	}
+	_, err = p.ctx.Adapter.Create(ctx, p.table(core.ModelVerifications), map[string]interface{}{
+		"id":         id,
+		"identifier": userID,
+		"token":      usedCodeType + ":" + hex.EncodeToString(sum[:]),
+		"type":       usedCodeType,
+		"expires_at": expiresAt,
+		"created_at": now,
+		"updated_at": now,
+	})
+	if errors.Is(err, core.ErrDuplicate) {
+		return errCodeReused
+	}
+	return err
+}
@@ -5,41 +5,96 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/crypto"
 	"github.com/marshallshelly/beacon-auth/plugin"
-	"github.com/pquerna/otp/totp"
+	"github.com/marshallshelly/beacon-auth/repo"
+	"github.com/marshallshelly/beacon-auth/tokens"
+)
+
+// Default plugin table names. Use them as keys in core.TableNames.Plugins
+// to rename the tables.
+const (
+	TableTwoFactors   = "two_factors"
+	TableBackupCodes  = "two_factor_backup_codes"
+	TableSecurityKeys = "two_factor_security_keys"
+)
+
+// Factor types in factor listings
+const (
+	FactorTOTP        = "totp"
+	FactorSecurityKey = "security_key"
 )
 
 // TwoFAPlugin implements Two-Factor Authentication
 type TwoFAPlugin struct {
 	*plugin.BasePlugin
-	ctx *core.AuthContext
+	ctx        *core.AuthContext
+	keys       []EncryptionKey
+	keysSecret string                  // see WithEncryptionKeysSecret
+	ring       atomic.Pointer[keyRing] // keys in use, swapped on rotation
+	totpOpts   TOTPOptions
+	keyOpts    SecurityKeyOptions
 }
 
 // New creates a new TwoFA plugin
 func New() *TwoFAPlugin {
 	return &TwoFAPlugin{
 		BasePlugin: plugin.NewBasePlugin("two_factor"),
+		totpOpts:   DefaultTOTPOptions(),
 	}
 }
 
 // Init initializes the plugin
 func (p *TwoFAPlugin) Init(ctx *core.AuthContext) error {
 	p.ctx = ctx
-	return nil
+	if err := p.totpOpts.validate(); err != nil {
+		return err
+	}
+	if err := p.initKeysSecret(); err != nil {
+		return err
+	}
+	if len(p.keys) == 0 {
+		ctx.Logger.Warn("twofa: TOTP secrets are stored unencrypted; configure WithEncryptionKeys")
+	}
+	p.initSecurityKeys()
+	return p.initCiphers()
+}
+
+// DescribeSecurity reports that two-factor authentication is available and
+// whether TOTP secrets are encrypted. Enrollment is optional for users; the
+// plugin does not enforce it.
+func (p *TwoFAPlugin) DescribeSecurity() map[string]interface{} {
+	return map[string]interface{}{
+		"enabled":          true,
+		"enforced":         false,
+		"secretsEncrypted": len(p.encryptionKeys().keys) > 0,
+		"securityKeys":     p.keyOpts.RPID != "",
+	}
 }
 
 // Endpoints returns the plugin endpoints
 func (p *TwoFAPlugin) Endpoints() map[string]plugin.Endpoint {
 	return map[string]plugin.Endpoint{
-		"/2fa/generate": {Method: "POST", Handler: p.auth(p.handleGenerate)},
-		"/2fa/enable":   {Method: "POST", Handler: p.auth(p.handleEnable)},
-		"/2fa/verify":   {Method: "POST", Handler: p.handleVerify}, // No auth check as it might be used during login process
-		"/2fa/disable":  {Method: "POST", Handler: p.auth(p.handleDisable)},
+		"/2fa/generate": {Method: "POST", Handler: p.handleGenerate, Auth: core.AuthSession},
+		"/2fa/enable":   {Method: "POST", Handler: p.handleEnable, Auth: core.AuthSession},
+		"/2fa/verify":   {Method: "POST", Handler: p.handleVerify, RateLimit: core.RateLimitCredentials}, // Authorized by the pending sign-in token
+		"/2fa/disable":  {Method: "POST", Handler: p.handleDisable, Auth: core.AuthSession},
+		"/2fa/status":   {Method: "GET", Handler: p.handleStatus, Auth: core.AuthSession},
+		"/2fa/factors":  {Method: "GET", Handler: p.handleFactors, Auth: core.AuthSession},
+
+		"/2fa/factors/remove":          {Method: "POST", Handler: p.handleRemoveFactor, Auth: core.AuthSession},
+		"/2fa/backup-codes/regenerate": {Method: "POST", Handler: p.handleRegenerateBackupCodes, Auth: core.AuthSession},
+
+		"/2fa/security-keys/register/options": {Method: "POST", Handler: p.handleSecurityKeyRegisterOptions, Auth: core.AuthSession},
+		"/2fa/security-keys/register":         {Method: "POST", Handler: p.handleSecurityKeyRegister, Auth: core.AuthSession},
+		"/2fa/security-keys/challenge":        {Method: "POST", Handler: p.handleSecurityKeyChallenge, RateLimit: core.RateLimitCredentials}, // Authorized by the pending sign-in token
 	}
 }
 
@@ -49,54 +104,56 @@ type generateResponse struct {
 	BackupCodes []string `json:"backupCodes,omitempty"`
 }
 
+// statusResponse describes the user's 2FA setup for settings pages
+type statusResponse struct {
+	Enabled              bool  `json:"enabled"`
+	Confirmed            bool  `json:"confirmed"`
+	BackupCodesRemaining int64 `json:"backupCodesRemaining"`
+	SecurityKeys         int   `json:"securityKeys"`
+}
+
+// factorResponse describes one of the user's second factors. Backup codes
+// are not listed; they come with the first factor.
+type factorResponse struct {
+	ID         string     `json:"id"`
+	Type       string     `json:"type"`
+	Name       string     `json:"name,omitempty"`
+	CreatedAt  *time.Time `json:"createdAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+type removeFactorRequest struct {
+	ID string `json:"id"`
+}
+
 type enableRequest struct {
 	Secret string `json:"secret"` // user confirms secret
 	Code   string `json:"code"`
 }
 
-// Helper middleware for plugin routes
-func (p *TwoFAPlugin) auth(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		cookieName := p.ctx.Config.Session.CookieName
-		c, err := r.Cookie(cookieName)
-		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-
-		session, _, err := p.ctx.SessionManager.Get(r.Context(), c.Value)
-		if err != nil || session == nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-
-		next(w, r)
-	}
+// verifyRequest completes a sign-in started with a password. Token is the
+// twoFactorToken returned by the login endpoint. Either Code, a TOTP or
+// backup code, or Credential, a security key response, is set.
+type verifyRequest struct {
+	Token      string      `json:"token"`
+	Code       string      `json:"code"`
+	Credential *credential `json:"credential"`
 }
 
 func (p *TwoFAPlugin) getSession(r *http.Request) (*core.Session, *core.User) {
-	cookieName := p.ctx.Config.Session.CookieName
-	c, err := r.Cookie(cookieName)
-	if err != nil {
-		return nil, nil
-	}
-	session, user, _ := p.ctx.SessionManager.Get(r.Context(), c.Value)
-	return session, user
+	return p.ctx.RequestSession(r)
 }
 
 func (p *TwoFAPlugin) handleGenerate(w http.ResponseWriter, r *http.Request) {
 	_, user := p.getSession(r)
 	if user == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		core.WriteStatusError(w, r, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	key, err := totp.Generate(totp.GenerateOpts{
-		Issuer:      p.ctx.Config.AppName,
-		AccountName: user.Email,
-	})
+	key, err := p.generateKey(user.Email)
 	if err != nil {
-		http.Error(w, "Failed to generate TOTP", http.StatusInternalServerError)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Failed to generate TOTP")
 		return
 	}
 
@@ -112,7 +169,7 @@ func (p *TwoFAPlugin) handleGenerate(w http.ResponseWriter, r *http.Request) {
 	// Upsert secret
 	err = p.saveSecret(r.Context(), user.ID, secret, false)
 	if err != nil {
-		http.Error(w, "Failed to save secret", http.StatusInternalServerError)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Failed to save secret")
 		return
 	}
 
@@ -127,34 +184,46 @@ func (p *TwoFAPlugin) handleGenerate(w http.ResponseWriter, r *http.Request) {
 func (p *TwoFAPlugin) handleEnable(w http.ResponseWriter, r *http.Request) {
 	var req enableRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Invalid request")
 		return
 	}
 
 	_, user := p.getSession(r)
 	if user == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		core.WriteStatusError(w, r, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	// Retrieve stored secret
 	record, err := p.getSecret(r.Context(), user.ID)
 	if err != nil || record == nil {
-		http.Error(w, "No pending 2FA setup found", http.StatusBadRequest)
+		core.WriteStatusError(w, r, http.StatusBadRequest, "No pending 2FA setup found")
+		return
+	}
+
+	stored, _ := record["secret"].(string)
+	secret, err := p.openSecret(user.ID, stored)
+	if err != nil {
+		p.ctx.Logger.Error("Failed to decrypt 2FA secret: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal error")
 		return
 	}
 
 	// Verify code
-	valid := totp.Validate(req.Code, record["secret"].(string))
-	if !valid {
-		http.Error(w, "Invalid code", http.StatusUnauthorized)
+	if err := p.checkCode(r.Context(), user.ID, secret, req.Code); err != nil {
+		if !errors.Is(err, errInvalidCode) && !errors.Is(err, errCodeReused) {
+			p.ctx.Logger.Error("Failed to check 2FA code: %v", err)
+			core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal error")
+			return
+		}
+		core.WriteError(w, r, http.StatusUnauthorized, core.CodeInvalidCode, "Invalid code")
 		return
 	}
 
 	// Mark confirmed
-	err = p.saveSecret(r.Context(), user.ID, record["secret"].(string), true)
+	err = p.saveSecret(r.Context(), user.ID, secret, true)
 	if err != nil {
-		http.Error(w, "Internal error", http.StatusInternalServerError)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal error")
 		return
 	}
 
@@ -166,30 +235,39 @@ func (p *TwoFAPlugin) handleEnable(w http.ResponseWriter, r *http.Request) {
 		p.ctx.Logger.Error("Failed to update user 2fa status: %v", err)
 	}
 
+	// The session's security level changed; bind it to a fresh token
+	if _, err := p.ctx.RotateSession(w, r); err != nil {
+		p.ctx.Logger.Warn("Failed to rotate session after enabling 2fa: %v", err)
+	}
+
 	_, _ = w.Write([]byte(`{"success":true}`))
 }
 
 func (p *TwoFAPlugin) handleDisable(w http.ResponseWriter, r *http.Request) {
 	_, user := p.getSession(r)
 	if user == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		core.WriteStatusError(w, r, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	// Delete secret
-	query := &core.Query{
-		Model: "two_factors",
-		Where: []core.WhereClause{{Field: "user_id", Operator: core.OpEqual, Value: user.ID}},
-	}
+	query := core.NewQuery(p.table(TableTwoFactors)).
+		Where("user_id", core.OpEqual, user.ID).
+		Build()
 	_ = p.ctx.Adapter.Delete(r.Context(), query)
 
 	// Delete backup codes
-	backupQuery := &core.Query{
-		Model: "two_factor_backup_codes",
-		Where: []core.WhereClause{{Field: "user_id", Operator: core.OpEqual, Value: user.ID}},
-	}
+	backupQuery := core.NewQuery(p.table(TableBackupCodes)).
+		Where("user_id", core.OpEqual, user.ID).
+		Build()
 	_, _ = p.ctx.Adapter.DeleteMany(r.Context(), backupQuery)
 
+	// Delete security keys
+	keysQuery := core.NewQuery(p.table(TableSecurityKeys)).
+		Where("user_id", core.OpEqual, user.ID).
+		Build()
+	_, _ = p.ctx.Adapter.DeleteMany(r.Context(), keysQuery)
+
 	// Update user
 	_, err := p.ctx.DataManager.UpdateUser(r.Context(), user.ID, map[string]interface{}{
 		"two_factor_enabled": false,
@@ -198,82 +276,271 @@ func (p *TwoFAPlugin) handleDisable(w http.ResponseWriter, r *http.Request) {
 		p.ctx.Logger.Error("Failed to disable 2fa: %v", err)
 	}
 
+	if _, err := p.ctx.RotateSession(w, r); err != nil {
+		p.ctx.Logger.Warn("Failed to rotate session after disabling 2fa: %v", err)
+	}
+
 	_, _ = w.Write([]byte(`{"success":true}`))
 }
 
-func (p *TwoFAPlugin) handleVerify(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Email string `json:"email"`
-		Code  string `json:"code"`
+func (p *TwoFAPlugin) handleStatus(w http.ResponseWriter, r *http.Request) {
+	_, user := p.getSession(r)
+	if user == nil {
+		core.WriteStatusError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+
+	status := statusResponse{Enabled: user.TwoFactorEnabled}
+
+	record, err := p.getSecret(r.Context(), user.ID)
+	if err != nil {
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal error")
 		return
 	}
+	if record != nil {
+		status.Confirmed, _ = record["confirmed"].(bool)
+	}
 
-	if req.Email == "" || req.Code == "" {
-		http.Error(w, "Email and code are required", http.StatusBadRequest)
+	query := core.NewQuery(p.table(TableBackupCodes)).
+		Where("user_id", core.OpEqual, user.ID).
+		Where("used", core.OpEqual, false).
+		Build()
+	status.BackupCodesRemaining, err = p.ctx.Adapter.Count(r.Context(), query)
+	if err != nil {
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal error")
 		return
 	}
 
-	// Find user
-	user, err := p.ctx.DataManager.FindUserByEmail(r.Context(), req.Email)
-	if err != nil || user == nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+	keys, err := p.securityKeys(r.Context(), user.ID)
+	if err != nil {
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal error")
 		return
 	}
+	status.SecurityKeys = len(keys)
 
-	// Check if 2FA is enabled
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+func (p *TwoFAPlugin) handleFactors(w http.ResponseWriter, r *http.Request) {
+	_, user := p.getSession(r)
+	if user == nil {
+		core.WriteStatusError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	factors, err := p.factors(r.Context(), user.ID)
+	if err != nil {
+		p.ctx.Logger.Error("Failed to list 2FA factors: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"factors": factors,
+	})
+}
+
+// handleRemoveFactor removes one of the user's second factors. Removing
+// the last one turns 2FA off and deletes the backup codes.
+func (p *TwoFAPlugin) handleRemoveFactor(w http.ResponseWriter, r *http.Request) {
+	var req removeFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == "" {
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	_, user := p.getSession(r)
+	if user == nil {
+		core.WriteStatusError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var query *core.Query
+	if req.ID == FactorTOTP {
+		query = core.NewQuery(p.table(TableTwoFactors)).
+			Where("user_id", core.OpEqual, user.ID).
+			Build()
+	} else {
+		query = core.NewQuery(p.table(TableSecurityKeys)).
+			Where("id", core.OpEqual, req.ID).
+			Where("user_id", core.OpEqual, user.ID).
+			Build()
+	}
+	deleted, err := p.ctx.Adapter.DeleteMany(r.Context(), query)
+	if err != nil {
+		p.ctx.Logger.Error("Failed to remove 2FA factor: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	if deleted == 0 {
+		core.WriteStatusError(w, r, http.StatusNotFound, "Factor not found")
+		return
+	}
+
+	remaining, err := p.factors(r.Context(), user.ID)
+	if err != nil {
+		p.ctx.Logger.Error("Failed to list 2FA factors: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	if len(remaining) == 0 {
+		backupQuery := core.NewQuery(p.table(TableBackupCodes)).
+			Where("user_id", core.OpEqual, user.ID).
+			Build()
+		_, _ = p.ctx.Adapter.DeleteMany(r.Context(), backupQuery)
+
+		_, err := p.ctx.DataManager.UpdateUser(r.Context(), user.ID, map[string]interface{}{
+			"two_factor_enabled": false,
+		})
+		if err != nil {
+			p.ctx.Logger.Error("Failed to disable 2fa: %v", err)
+		}
+	}
+
+	if _, err := p.ctx.RotateSession(w, r); err != nil {
+		p.ctx.Logger.Warn("Failed to rotate session after removing a 2fa factor: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"enabled": len(remaining) > 0,
+	})
+}
+
+// handleRegenerateBackupCodes replaces the user's backup codes, e.g. after
+// they ran out or were exposed
+func (p *TwoFAPlugin) handleRegenerateBackupCodes(w http.ResponseWriter, r *http.Request) {
+	_, user := p.getSession(r)
+	if user == nil {
+		core.WriteStatusError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
 	if !user.TwoFactorEnabled {
-		http.Error(w, "2FA not enabled for this user", http.StatusBadRequest)
+		core.WriteStatusError(w, r, http.StatusBadRequest, "2FA not enabled for this user")
 		return
 	}
 
-	// Get stored secret
-	record, err := p.getSecret(r.Context(), user.ID)
-	if err != nil || record == nil {
-		p.ctx.Logger.Error("Failed to get 2FA secret: %v", err)
-		http.Error(w, "2FA not configured", http.StatusBadRequest)
+	codes, err := p.generateBackupCodes(r.Context(), user.ID, 10)
+	if err != nil {
+		p.ctx.Logger.Error("Failed to regenerate backup codes: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Failed to generate backup codes")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"backupCodes": codes,
+	})
+}
+
+func (p *TwoFAPlugin) handleVerify(w http.ResponseWriter, r *http.Request) {
+	var req verifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	if req.Token == "" || (req.Code == "" && req.Credential == nil) {
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Token and a code or security key are required")
+		return
+	}
+
+	// The token proves the user passed their first factor. The attempt is
+	// reserved before the factor is checked, so parallel guesses count too.
+	userID, err := tokens.For(p.ctx).BeginTwoFactorAttempt(r.Context(), req.Token)
+	if errors.Is(err, tokens.ErrTooManyAttempts) {
+		core.WriteError(w, r, http.StatusUnauthorized, core.CodeInvalidToken, "Too many attempts, sign in again")
+		return
+	}
+	if errors.Is(err, tokens.ErrInvalidToken) {
+		core.WriteError(w, r, http.StatusUnauthorized, core.CodeInvalidToken, "Invalid or expired token")
+		return
+	}
+	if err != nil {
+		p.ctx.Logger.Error("Failed to find pending 2FA sign-in: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal error")
 		return
 	}
 
-	// Check if confirmed
-	confirmed, ok := record["confirmed"].(bool)
-	if !ok || !confirmed {
-		http.Error(w, "2FA not confirmed", http.StatusBadRequest)
+	user, err := p.findUser(r.Context(), userID)
+	if err != nil || user == nil {
+		core.WriteError(w, r, http.StatusUnauthorized, core.CodeInvalidToken, "Invalid or expired token")
 		return
 	}
 
-	// Verify TOTP code
-	secret, ok := record["secret"].(string)
-	if !ok {
-		http.Error(w, "Invalid 2FA configuration", http.StatusInternalServerError)
+	// Check if 2FA is enabled
+	if !user.TwoFactorEnabled {
+		core.WriteStatusError(w, r, http.StatusBadRequest, "2FA not enabled for this user")
 		return
 	}
 
-	valid := totp.Validate(req.Code, secret)
-	if !valid {
-		// Check backup codes if TOTP fails
-		if p.checkBackupCode(r.Context(), user.ID, req.Code) {
-			// Backup code is valid, consume it
-			_ = p.consumeBackupCode(r.Context(), user.ID, req.Code)
-		} else {
-			http.Error(w, "Invalid code", http.StatusUnauthorized)
+	// A security key response, or a TOTP code falling back to backup codes
+	var reason string
+	if req.Credential != nil {
+		err = p.verifyAssertion(r.Context(), user.ID, req.Credential)
+		if errors.Is(err, errInvalidCredential) {
+			p.ctx.Logger.Warn("Rejected security key sign-in: %v", err)
+			reason, err = "invalid security key", nil
+		}
+	} else {
+		reason, err = p.verifyCode(r.Context(), user.ID, req.Code)
+	}
+	if err != nil {
+		p.ctx.Logger.Error("Failed to check 2FA: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	if reason != "" {
+		p.ctx.EmitSecurityEvent(core.WithClientInfo(r.Context(), core.ClientInfoFromRequest(r)), &core.SecurityEvent{
+			Type:   core.EventTwoFactorFailed,
+			UserID: user.ID,
+			Email:  user.Email,
+			Reason: reason,
+		})
+		if err := tokens.For(p.ctx).FailTwoFactor(r.Context(), req.Token); errors.Is(err, tokens.ErrTooManyAttempts) {
+			core.WriteError(w, r, http.StatusUnauthorized, core.CodeInvalidToken, "Too many attempts, sign in again")
+			return
+		} else if err != nil && !errors.Is(err, tokens.ErrInvalidToken) {
+			p.ctx.Logger.Error("Failed to record 2FA failure: %v", err)
+		}
+		if req.Credential != nil {
+			core.WriteError(w, r, http.StatusUnauthorized, core.CodeInvalidCode, "Invalid security key")
 			return
 		}
+		core.WriteError(w, r, http.StatusUnauthorized, core.CodeInvalidCode, "Invalid code")
+		return
 	}
 
+	// Each token signs in once
+	if err := tokens.For(p.ctx).CompleteTwoFactor(r.Context(), req.Token); err != nil {
+		core.WriteError(w, r, http.StatusUnauthorized, core.CodeInvalidToken, "Invalid or expired token")
+		return
+	}
+
+	// Never carry a session from before authentication over to the new one
+	p.ctx.RevokeRequestSession(r)
+
 	// Create full session
-	_, _, token, err := p.ctx.SessionManager.Create(r.Context(), user.ID, nil)
+	session, _, token, err := p.ctx.SessionManager.Create(r.Context(), user.ID, nil)
+	var ban *core.BanError
+	if errors.As(err, &ban) {
+		core.WriteBanError(w, r, ban)
+		return
+	}
 	if err != nil {
 		p.ctx.Logger.Error("Failed to create session: %v", err)
-		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		core.WriteError(w, r, http.StatusInternalServerError, core.CodeSessionError, "Failed to create session")
 		return
 	}
+	p.ctx.EmitSignIn(r, user, session, core.MethodTwoFactor, "")
 
 	// Set session cookie
 	sessionConfig := p.ctx.Config.Session
-	http.SetCookie(w, &http.Cookie{
+	core.SetChunkedCookie(w, r, &http.Cookie{
 		Name:     sessionConfig.CookieName,
 		Value:    token,
 		Path:     sessionConfig.CookiePath,
@@ -282,7 +549,7 @@ func (p *TwoFAPlugin) handleVerify(w http.ResponseWriter, r *http.Request) {
 		Secure:   sessionConfig.CookieSecure,
 		HttpOnly: sessionConfig.CookieHTTPOnly,
 		SameSite: parseSameSite(sessionConfig.CookieSameSite),
-	})
+	}, sessionConfig.CookieChunkSize)
 
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]interface{}{
@@ -291,6 +558,48 @@ func (p *TwoFAPlugin) handleVerify(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// verifyCode checks a TOTP code, then the user's backup codes; a valid
+// backup code is consumed. It returns why the code was rejected, or "" if it
+// was accepted.
+func (p *TwoFAPlugin) verifyCode(ctx context.Context, userID, code string) (string, error) {
+	reason := "invalid code"
+
+	record, err := p.getSecret(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	// Users with only security keys have no confirmed secret
+	if confirmed, _ := record["confirmed"].(bool); confirmed {
+		stored, _ := record["secret"].(string)
+		secret, err := p.openSecret(userID, stored)
+		if err != nil {
+			return "", err
+		}
+
+		err = p.checkCode(ctx, userID, secret, code)
+		if err == nil {
+			// Secrets stored before encryption or a key rotation are
+			// re-encrypted with the active key
+			if p.needsReseal(stored) {
+				if err := p.saveSecret(ctx, userID, secret, true); err != nil {
+					p.ctx.Logger.Warn("Failed to re-encrypt 2FA secret: %v", err)
+				}
+			}
+			return "", nil
+		}
+		if errors.Is(err, errCodeReused) {
+			reason = "reused code"
+		} else if !errors.Is(err, errInvalidCode) {
+			return "", err
+		}
+	}
+
+	if p.useBackupCode(ctx, userID, code) {
+		return "", nil
+	}
+	return reason, nil
+}
+
 func parseSameSite(s string) http.SameSite {
 	switch strings.ToLower(s) {
 	case "lax":
@@ -305,43 +614,105 @@ func parseSameSite(s string) http.SameSite {
 }
 
 // DB Helpers
+
+// table returns the configured name of a plugin table
+func (p *TwoFAPlugin) table(name string) string {
+	return p.ctx.Config.TableNames.Table(name)
+}
+
+// saveSecret stores the user's secret, encrypted when keys are configured,
+// in a single upsert so concurrent enrollments cannot create duplicate
+// records. The record ID is derived from the user ID; created_at is left to
+// the column default.
 func (p *TwoFAPlugin) saveSecret(ctx context.Context, userID, secret string, confirmed bool) error {
-	query := &core.Query{
-		Model: "two_factors",
-		Where: []core.WhereClause{{Field: "user_id", Operator: core.OpEqual, Value: userID}},
+	sealed, err := p.sealSecret(userID, secret)
+	if err != nil {
+		return err
 	}
-	existing, _ := p.ctx.Adapter.FindOne(ctx, query)
-
 	data := map[string]interface{}{
+		"id":         "2fa_" + userID,
 		"user_id":    userID,
-		"secret":     secret,
+		"secret":     sealed,
 		"confirmed":  confirmed,
 		"updated_at": time.Now(),
 	}
+	_, err = p.ctx.Adapter.Upsert(ctx, p.table(TableTwoFactors), []string{"id"}, data)
+	return err
+}
 
-	if existing != nil {
-		_, err := p.ctx.Adapter.Update(ctx, query, data)
-		return err
+func (p *TwoFAPlugin) findUser(ctx context.Context, userID string) (*core.User, error) {
+	if user, ok, err := p.ctx.ExternalUser(ctx, userID); ok {
+		return user, err
 	}
-
-	// Create
-	data["id"] = "2fa_" + userID
-	data["created_at"] = time.Now()
-	_, err := p.ctx.Adapter.Create(ctx, "two_factors", data)
-	return err
+	query := core.NewQuery(p.table(core.ModelUsers)).
+		Where("id", core.OpEqual, userID).
+		Build()
+	return repo.FindOne[core.User](ctx, p.ctx.Adapter, query)
 }
 
 func (p *TwoFAPlugin) getSecret(ctx context.Context, userID string) (map[string]interface{}, error) {
-	query := &core.Query{
-		Model: "two_factors",
-		Where: []core.WhereClause{{Field: "user_id", Operator: core.OpEqual, Value: userID}},
-	}
+	query := core.NewQuery(p.table(TableTwoFactors)).
+		Where("user_id", core.OpEqual, userID).
+		Build()
 	return p.ctx.Adapter.FindOne(ctx, query)
 }
 
+// factors lists the user's confirmed TOTP setup and security keys
+func (p *TwoFAPlugin) factors(ctx context.Context, userID string) ([]factorResponse, error) {
+	factors := []factorResponse{}
+
+	record, err := p.getSecret(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if confirmed, _ := record["confirmed"].(bool); confirmed {
+		factors = append(factors, factorResponse{ID: FactorTOTP, Type: FactorTOTP})
+	}
+
+	keys, err := p.securityKeys(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		factors = append(factors, securityKeyFactor(key))
+	}
+	return factors, nil
+}
+
+func securityKeyFactor(key *securityKeyRecord) factorResponse {
+	return factorResponse{
+		ID:         key.ID,
+		Type:       FactorSecurityKey,
+		Name:       key.Name,
+		CreatedAt:  &key.CreatedAt,
+		LastUsedAt: key.LastUsedAt,
+	}
+}
+
+// Cleanup deletes expired pending sign-ins and their failed attempts,
+// records of used codes and security key challenges
+func (p *TwoFAPlugin) Cleanup(ctx context.Context) error {
+	for _, verificationType := range []string{string(tokens.TwoFactorPending), string(tokens.TwoFactorFailure), usedCodeType, registerChallengeType, assertChallengeType} {
+		query := core.NewQuery(p.table(core.ModelVerifications)).
+			Where("type", core.OpEqual, verificationType).
+			Where("expires_at", core.OpLessThan, time.Now()).
+			Build()
+
+		if _, err := p.ctx.Adapter.DeleteMany(ctx, query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Backup code helpers
+
+// generateBackupCodes replaces the user's backup codes with count new ones.
+// Only their hashes are stored.
 func (p *TwoFAPlugin) generateBackupCodes(ctx context.Context, userID string, count int) ([]string, error) {
 	codes := make([]string, count)
+	records := make([]map[string]interface{}, count)
+	now := time.Now()
 
 	for i := 0; i < count; i++ {
 		// Generate a random 8-character hex code
@@ -351,50 +722,71 @@ func (p *TwoFAPlugin) generateBackupCodes(ctx context.Context, userID string, co
 		}
 		codes[i] = hex.EncodeToString(b)
 
-		// Store in database
-		data := map[string]interface{}{
-			"id":         "backup_" + userID + "_" + codes[i],
+		hash, err := backupCodeHasher.Hash(codes[i])
+		if err != nil {
+			return nil, err
+		}
+		id, err := crypto.GenerateID()
+		if err != nil {
+			return nil, err
+		}
+		records[i] = map[string]interface{}{
+			"id":         id,
 			"user_id":    userID,
-			"code":       codes[i],
+			"code":       hash,
 			"used":       false,
-			"created_at": time.Now(),
+			"created_at": now,
 		}
-
-		_, _ = p.ctx.Adapter.Create(ctx, "two_factor_backup_codes", data)
 	}
 
-	return codes, nil
-}
+	// Codes of an earlier setup stop working
+	query := core.NewQuery(p.table(TableBackupCodes)).
+		Where("user_id", core.OpEqual, userID).
+		Build()
+	if _, err := p.ctx.Adapter.DeleteMany(ctx, query); err != nil {
+		return nil, err
+	}
 
-func (p *TwoFAPlugin) checkBackupCode(ctx context.Context, userID, code string) bool {
-	query := &core.Query{
-		Model: "two_factor_backup_codes",
-		Where: []core.WhereClause{
-			{Field: "user_id", Operator: core.OpEqual, Value: userID},
-			{Field: "code", Operator: core.OpEqual, Value: code},
-			{Field: "used", Operator: core.OpEqual, Value: false},
-		},
+	// Store all codes in one batch
+	if _, err := p.ctx.Adapter.CreateMany(ctx, p.table(TableBackupCodes), records); err != nil {
+		return nil, err
 	}
 
-	result, err := p.ctx.Adapter.FindOne(ctx, query)
-	return err == nil && result != nil
+	return codes, nil
 }
 
-func (p *TwoFAPlugin) consumeBackupCode(ctx context.Context, userID, code string) error {
-	query := &core.Query{
-		Model: "two_factor_backup_codes",
-		Where: []core.WhereClause{
-			{Field: "user_id", Operator: core.OpEqual, Value: userID},
-			{Field: "code", Operator: core.OpEqual, Value: code},
-		},
+// useBackupCode consumes the user's unused backup code matching code and
+// reports whether there was one. Of concurrent uses of a code, only one
+// succeeds.
+func (p *TwoFAPlugin) useBackupCode(ctx context.Context, userID, code string) bool {
+	query := core.NewQuery(p.table(TableBackupCodes)).
+		Select("id", "code").
+		Where("user_id", core.OpEqual, userID).
+		Where("used", core.OpEqual, false).
+		Build()
+
+	records, err := p.ctx.Adapter.FindMany(ctx, query)
+	if err != nil {
+		return false
 	}
 
-	data := map[string]interface{}{
-		"used":       true,
-		"used_at":    time.Now(),
-		"updated_at": time.Now(),
-	}
+	for _, record := range records {
+		stored, _ := record["code"].(string)
+		if !matchBackupCode(stored, code) {
+			continue
+		}
 
-	_, err := p.ctx.Adapter.Update(ctx, query, data)
-	return err
+		consume := core.NewQuery(p.table(TableBackupCodes)).
+			Where("id", core.OpEqual, record["id"]).
+			Where("used", core.OpEqual, false).
+			Build()
+		now := time.Now()
+		updated, err := p.ctx.Adapter.UpdateMany(ctx, consume, map[string]interface{}{
+			"used":       true,
+			"used_at":    now,
+			"updated_at": now,
+		})
+		return err == nil && updated == 1
+	}
+	return false
 }
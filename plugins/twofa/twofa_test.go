@@ -0,0 +1,566 @@
+package twofa
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/adapter"
+	"github.com/marshallshelly/beacon-auth/adapters/memory"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/session"
+	"github.com/marshallshelly/beacon-auth/tokens"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+// newTestPlugin returns the plugin and a user with confirmed 2FA and the
+// user's TOTP secret
+func newTestPlugin(t *testing.T, keys ...EncryptionKey) (*TwoFAPlugin, *core.User, string) {
+	t.Helper()
+
+	db := memory.New(memory.WithUnique(TableSecurityKeys, "credential_id"))
+	sessions, err := session.NewManager(&session.Config{
+		CookieName:    "test_session",
+		ExpiresIn:     time.Hour,
+		EnableDBStore: true,
+	}, db)
+	if err != nil {
+		t.Fatalf("Failed to create session manager: %v", err)
+	}
+
+	ctx := context.Background()
+	internal := adapter.NewInternalAdapter(db, nil)
+	user, err := internal.CreateUser(ctx, "user@example.com", "User")
+	if err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	if user, err = internal.UpdateUser(ctx, user.ID, map[string]interface{}{"two_factor_enabled": true}); err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+
+	p := New().WithEncryptionKeys(keys...)
+	err = p.Init(&core.AuthContext{
+		Config:         &core.Config{AppName: "Test", BaseURL: "https://example.com", Session: &core.SessionConfig{CookieName: "test_session"}},
+		Adapter:        db,
+		DataManager:    internal,
+		Logger:         core.NewDefaultLogger(),
+		SessionManager: sessions,
+	})
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: "Test", AccountName: user.Email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.saveSecret(ctx, user.ID, key.Secret(), true); err != nil {
+		t.Fatalf("saveSecret failed: %v", err)
+	}
+	return p, user, key.Secret()
+}
+
+func verify(p *TwoFAPlugin, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	p.handleVerify(rec, httptest.NewRequest("POST", "/2fa/verify", strings.NewReader(body)))
+	return rec
+}
+
+func TestVerify_RequiresPendingSignIn(t *testing.T) {
+	p, user, secret := newTestPlugin(t)
+	code, err := totp.GenerateCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A valid code alone is not enough without a verified password
+	if rec := verify(p, `{"email":"`+user.Email+`","code":"`+code+`"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("verify without token = %d, want 400", rec.Code)
+	}
+	if rec := verify(p, `{"token":"forged","code":"`+code+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("verify with unknown token = %d, want 401", rec.Code)
+	}
+
+	token, err := tokens.For(p.ctx).BeginTwoFactor(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("BeginTwoFactor failed: %v", err)
+	}
+
+	// A wrong code leaves the sign-in pending
+	if rec := verify(p, `{"token":"`+token+`","code":"000000x"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("verify with wrong code = %d, want 401", rec.Code)
+	}
+
+	rec := verify(p, `{"token":"`+token+`","code":"`+code+`"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("verify = %d: %s", rec.Code, rec.Body.String())
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) == 0 || cookies[0].Name != "test_session" || cookies[0].Value == "" {
+		t.Errorf("verify did not set the session cookie: %v", cookies)
+	}
+
+	// Each token signs in once
+	if rec := verify(p, `{"token":"`+token+`","code":"`+code+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("reused token = %d, want 401", rec.Code)
+	}
+}
+
+func TestVerify_TooManyAttempts(t *testing.T) {
+	p, user, secret := newTestPlugin(t)
+
+	token, err := tokens.For(p.ctx).BeginTwoFactor(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("BeginTwoFactor failed: %v", err)
+	}
+	for i := 0; i < tokens.MaxTwoFactorAttempts; i++ {
+		if rec := verify(p, `{"token":"`+token+`","code":"000000x"}`); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("verify with wrong code = %d, want 401", rec.Code)
+		}
+	}
+
+	// The token is revoked, so even the right code is refused
+	code, _ := totp.GenerateCode(secret, time.Now())
+	if rec := verify(p, `{"token":"`+token+`","code":"`+code+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("verify after too many attempts = %d, want 401", rec.Code)
+	}
+}
+
+// countingSink counts the security events of a type
+type countingSink struct {
+	eventType core.SecurityEventType
+	count     atomic.Int32
+}
+
+func (s *countingSink) Emit(_ context.Context, event *core.SecurityEvent) error {
+	if event.Type == s.eventType {
+		s.count.Add(1)
+	}
+	return nil
+}
+
+func TestVerify_ConcurrentAttempts(t *testing.T) {
+	p, user, _ := newTestPlugin(t)
+	sink := &countingSink{eventType: core.EventTwoFactorFailed}
+	p.ctx.SecurityEvents = sink
+
+	token, err := tokens.For(p.ctx).BeginTwoFactor(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("BeginTwoFactor failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3*tokens.MaxTwoFactorAttempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if rec := verify(p, `{"token":"`+token+`","code":"000000x"}`); rec.Code != http.StatusUnauthorized {
+				t.Errorf("verify with wrong code = %d, want 401", rec.Code)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Each wrong code that was checked emits one event
+	if n := sink.count.Load(); n > tokens.MaxTwoFactorAttempts {
+		t.Errorf("%d codes checked, want at most %d", n, tokens.MaxTwoFactorAttempts)
+	}
+}
+
+func TestVerify_ExpiredToken(t *testing.T) {
+	p, user, secret := newTestPlugin(t)
+	ctx := context.Background()
+
+	token, err := tokens.For(p.ctx).BeginTwoFactor(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("BeginTwoFactor failed: %v", err)
+	}
+	query := core.NewQuery(core.ModelVerifications).
+		Where("type", core.OpEqual, string(tokens.TwoFactorPending)).
+		Build()
+	if _, err := p.ctx.Adapter.UpdateMany(ctx, query, map[string]interface{}{"expires_at": time.Now().Add(-time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+
+	code, _ := totp.GenerateCode(secret, time.Now())
+	if rec := verify(p, `{"token":"`+token+`","code":"`+code+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("verify with expired token = %d, want 401", rec.Code)
+	}
+
+	if err := p.Cleanup(ctx); err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+	if n, _ := p.ctx.Adapter.Count(ctx, query); n != 0 {
+		t.Errorf("Cleanup left %d pending sign-ins", n)
+	}
+}
+
+func testKey(id string) EncryptionKey {
+	return EncryptionKey{ID: id, Key: []byte(strings.Repeat(id, 32)[:32])}
+}
+
+// storedSecret returns the user's secret as stored
+func storedSecret(t *testing.T, p *TwoFAPlugin, userID string) string {
+	t.Helper()
+	record, err := p.getSecret(context.Background(), userID)
+	if err != nil || record == nil {
+		t.Fatalf("getSecret = %v, %v", record, err)
+	}
+	return record["secret"].(string)
+}
+
+func TestSecrets_Encrypted(t *testing.T) {
+	p, user, secret := newTestPlugin(t, testKey("k1"))
+
+	stored := storedSecret(t, p, user.ID)
+	if !strings.HasPrefix(stored, "enc:k1:") || strings.Contains(stored, secret) {
+		t.Errorf("stored secret = %q, want it encrypted with k1", stored)
+	}
+	if got, err := p.openSecret(user.ID, stored); err != nil || got != secret {
+		t.Errorf("openSecret = %q, %v", got, err)
+	}
+	if _, err := p.openSecret("other-user", stored); err == nil {
+		t.Error("secret opened for another user")
+	}
+
+	token, _ := tokens.For(p.ctx).BeginTwoFactor(context.Background(), user.ID)
+	code, _ := totp.GenerateCode(secret, time.Now())
+	if rec := verify(p, `{"token":"`+token+`","code":"`+code+`"}`); rec.Code != http.StatusOK {
+		t.Errorf("verify = %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestBackupCodes_Hashed(t *testing.T) {
+	p, user, _ := newTestPlugin(t)
+	ctx := context.Background()
+
+	codes, err := p.generateBackupCodes(ctx, user.ID, 3)
+	if err != nil {
+		t.Fatalf("generateBackupCodes failed: %v", err)
+	}
+	records, _ := p.ctx.Adapter.FindMany(ctx, core.NewQuery(TableBackupCodes).Build())
+	if len(records) != 3 {
+		t.Fatalf("stored %d backup codes, want 3", len(records))
+	}
+	for _, record := range records {
+		stored := record["code"].(string)
+		if !hashedBackupCode(stored) || strings.Contains(record["id"].(string), codes[0]) {
+			t.Errorf("backup code stored as %v", record)
+		}
+	}
+
+	token, _ := tokens.For(p.ctx).BeginTwoFactor(ctx, user.ID)
+	if rec := verify(p, `{"token":"`+token+`","code":"`+codes[1]+`"}`); rec.Code != http.StatusOK {
+		t.Fatalf("verify with backup code = %d: %s", rec.Code, rec.Body.String())
+	}
+	token, _ = tokens.For(p.ctx).BeginTwoFactor(ctx, user.ID)
+	if rec := verify(p, `{"token":"`+token+`","code":"`+codes[1]+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("reused backup code = %d, want 401", rec.Code)
+	}
+
+	// Generating new codes replaces the old ones
+	if _, err := p.generateBackupCodes(ctx, user.ID, 3); err != nil {
+		t.Fatal(err)
+	}
+	if p.useBackupCode(ctx, user.ID, codes[2]) {
+		t.Error("backup code of an earlier setup was accepted")
+	}
+}
+
+func TestMigrateSecrets(t *testing.T) {
+	p, user, secret := newTestPlugin(t)
+	ctx := context.Background()
+
+	// Rows written before encryption and hashing
+	if _, err := p.ctx.Adapter.Create(ctx, TableBackupCodes, map[string]interface{}{
+		"id": "backup_" + user.ID + "_0a1b2c3d", "user_id": user.ID, "code": "0a1b2c3d", "used": false,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if stored := storedSecret(t, p, user.ID); stored != secret {
+		t.Fatalf("stored secret = %q, want plaintext", stored)
+	}
+
+	// Plaintext codes keep working until migrated
+	if !p.useBackupCode(ctx, user.ID, "0a1b2c3d") {
+		t.Error("plaintext backup code was rejected")
+	}
+	if _, err := p.ctx.Adapter.UpdateMany(ctx, core.NewQuery(TableBackupCodes).Build(), map[string]interface{}{"used": false}); err != nil {
+		t.Fatal(err)
+	}
+
+	p.WithEncryptionKeys(testKey("k1"))
+	if err := p.initCiphers(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := p.MigrateSecrets(ctx); err != nil || n != 2 {
+		t.Fatalf("MigrateSecrets = %d, %v; want 2", n, err)
+	}
+	if stored := storedSecret(t, p, user.ID); !strings.HasPrefix(stored, "enc:k1:") {
+		t.Errorf("stored secret = %q after migration", stored)
+	}
+	records, _ := p.ctx.Adapter.FindMany(ctx, core.NewQuery(TableBackupCodes).Build())
+	if len(records) != 1 || !hashedBackupCode(records[0]["code"].(string)) || strings.Contains(records[0]["id"].(string), "0a1b2c3d") {
+		t.Errorf("backup codes = %v after migration", records)
+	}
+	if !p.useBackupCode(ctx, user.ID, "0a1b2c3d") {
+		t.Error("migrated backup code was rejected")
+	}
+
+	// Rotation: k2 encrypts, k1 still decrypts until migrated
+	p.WithEncryptionKeys(testKey("k2"), testKey("k1"))
+	if err := p.initCiphers(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := p.MigrateSecrets(ctx); err != nil || n != 1 {
+		t.Fatalf("MigrateSecrets after rotation = %d, %v; want 1", n, err)
+	}
+	stored := storedSecret(t, p, user.ID)
+	if got, err := p.openSecret(user.ID, stored); !strings.HasPrefix(stored, "enc:k2:") || err != nil || got != secret {
+		t.Errorf("rotated secret = %q (%q, %v)", stored, got, err)
+	}
+	if n, _ := p.MigrateSecrets(ctx); n != 0 {
+		t.Errorf("second MigrateSecrets rewrote %d rows", n)
+	}
+
+	// Secrets of a retired key cannot be read
+	p.WithEncryptionKeys(testKey("k3"))
+	_ = p.initCiphers()
+	if _, err := p.openSecret(user.ID, stored); !errors.Is(err, ErrUnknownEncryptionKey) {
+		t.Errorf("openSecret with retired key = %v, want ErrUnknownEncryptionKey", err)
+	}
+}
+
+// keysProvider serves the encryption keys secret, which the test rotates
+type keysProvider struct {
+	mu   sync.Mutex
+	keys string
+}
+
+func (s *keysProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if name != "twofa#keys" {
+		return "", core.ErrSecretNotFound
+	}
+	return s.keys, nil
+}
+
+func (s *keysProvider) set(keys ...EncryptionKey) {
+	entries := make([]string, len(keys))
+	for i, key := range keys {
+		entries[i] = key.ID + ":" + base64.StdEncoding.EncodeToString(key.Key)
+	}
+	s.mu.Lock()
+	s.keys = strings.Join(entries, ",")
+	s.mu.Unlock()
+}
+
+func TestEncryptionKeysSecret(t *testing.T) {
+	provider := &keysProvider{}
+	provider.set(testKey("k1"))
+	authCtx := &core.AuthContext{
+		Config:  &core.Config{AppName: "Test", BaseURL: "https://example.com"},
+		Adapter: memory.New(),
+		Logger:  core.NewDefaultLogger(),
+	}
+
+	// The secret needs a secret provider
+	if err := New().WithEncryptionKeysSecret("twofa#keys").Init(authCtx); err == nil {
+		t.Fatal("Init() without a secret provider succeeded")
+	}
+
+	authCtx.Secrets = core.NewSecrets(provider, -1, authCtx.Logger)
+	p := New().WithEncryptionKeysSecret("twofa#keys")
+	if err := p.Init(authCtx); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	sealed, err := p.sealSecret("user-1", "SECRET")
+	if err != nil || !strings.HasPrefix(sealed, "enc:k1:") {
+		t.Fatalf("sealSecret() = %q, %v; want it encrypted with k1", sealed, err)
+	}
+
+	// Rotation: k2 encrypts, k1 still decrypts
+	provider.set(testKey("k2"), testKey("k1"))
+	if err := authCtx.Secrets.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if got, err := p.openSecret("user-1", sealed); err != nil || got != "SECRET" {
+		t.Errorf("openSecret() after rotation = %q, %v", got, err)
+	}
+	if !p.needsReseal(sealed) {
+		t.Error("Expected a k1 secret to need resealing after rotation")
+	}
+	if resealed, _ := p.sealSecret("user-1", "SECRET"); !strings.HasPrefix(resealed, "enc:k2:") {
+		t.Errorf("sealSecret() after rotation = %q, want it encrypted with k2", resealed)
+	}
+
+	// Invalid keys are rejected and the previous ones kept
+	provider.mu.Lock()
+	provider.keys = "k3:not-base64!"
+	provider.mu.Unlock()
+	if err := authCtx.Secrets.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if resealed, _ := p.sealSecret("user-1", "SECRET"); !strings.HasPrefix(resealed, "enc:k2:") {
+		t.Errorf("sealSecret() after invalid rotation = %q, want k2 kept", resealed)
+	}
+}
+
+func TestParseEncryptionKeys(t *testing.T) {
+	keys, err := ParseEncryptionKeys("new:" + base64.StdEncoding.EncodeToString(make([]byte, 32)) + ", old:" + base64.RawURLEncoding.EncodeToString(make([]byte, 16)))
+	if err != nil {
+		t.Fatalf("ParseEncryptionKeys failed: %v", err)
+	}
+	if len(keys) != 2 || keys[0].ID != "new" || len(keys[0].Key) != 32 || keys[1].ID != "old" || len(keys[1].Key) != 16 {
+		t.Errorf("keys = %+v", keys)
+	}
+
+	for _, config := range []string{"", "nokey", "k:not base64!"} {
+		if _, err := ParseEncryptionKeys(config); err == nil {
+			t.Errorf("ParseEncryptionKeys(%q) succeeded", config)
+		}
+	}
+
+	for _, keys := range [][]EncryptionKey{
+		{{ID: "k", Key: make([]byte, 10)}},
+		{{ID: "bad:id", Key: make([]byte, 32)}},
+		{testKey("k"), testKey("k")},
+	} {
+		p := New().WithEncryptionKeys(keys...)
+		if err := p.initCiphers(); err == nil {
+			t.Errorf("initCiphers accepted %+v", keys)
+		}
+	}
+}
+
+func TestVerify_RejectsReplayedCode(t *testing.T) {
+	p, user, secret := newTestPlugin(t)
+	ctx := context.Background()
+	code, _ := totp.GenerateCode(secret, time.Now())
+
+	token, _ := tokens.For(p.ctx).BeginTwoFactor(ctx, user.ID)
+	if rec := verify(p, `{"token":"`+token+`","code":"`+code+`"}`); rec.Code != http.StatusOK {
+		t.Fatalf("verify = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// A second sign-in cannot reuse the code, even with a fresh token
+	token, _ = tokens.For(p.ctx).BeginTwoFactor(ctx, user.ID)
+	if rec := verify(p, `{"token":"`+token+`","code":"`+code+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("replayed code = %d, want 401", rec.Code)
+	}
+}
+
+func TestTOTPOptions(t *testing.T) {
+	p, _, _ := newTestPlugin(t)
+	p.WithTOTP(TOTPOptions{Digits: 8, Period: time.Minute, Algorithm: AlgorithmSHA256})
+
+	key, err := p.generateKey("user@example.com")
+	if err != nil {
+		t.Fatalf("generateKey failed: %v", err)
+	}
+	if key.Digits() != otp.DigitsEight || key.Period() != 60 || key.Algorithm() != otp.AlgorithmSHA256 {
+		t.Errorf("key = %s", key.String())
+	}
+
+	now := time.Now()
+	opts := totp.ValidateOpts{Period: 60, Digits: otp.DigitsEight, Algorithm: otp.AlgorithmSHA256}
+	current, _ := totp.GenerateCodeCustom(key.Secret(), now, opts)
+	previous, _ := totp.GenerateCodeCustom(key.Secret(), now.Add(-time.Minute), opts)
+
+	if _, ok := p.matchStep(key.Secret(), current, now); !ok {
+		t.Error("current code rejected")
+	}
+	if _, ok := p.matchStep(key.Secret(), previous, now); ok {
+		t.Error("previous code accepted with Skew 0")
+	}
+	p.totpOpts.Skew = 1
+	if _, ok := p.matchStep(key.Secret(), previous, now); !ok {
+		t.Error("previous code rejected with Skew 1")
+	}
+	if _, ok := p.matchStep(key.Secret(), current[:6], now); ok {
+		t.Error("truncated code accepted")
+	}
+
+	for _, opts := range []TOTPOptions{
+		{Digits: 7},
+		{Period: 1500 * time.Millisecond},
+		{Algorithm: "MD5"},
+	} {
+		if err := New().WithTOTP(opts).totpOpts.validate(); err == nil {
+			t.Errorf("validate accepted %+v", opts)
+		}
+	}
+}
+
+func TestStatusAndRegenerateBackupCodes(t *testing.T) {
+	p, user, _ := newTestPlugin(t)
+	ctx := context.Background()
+
+	_, _, sessionToken, err := p.ctx.SessionManager.Create(ctx, user.ID, nil)
+	if err != nil {
+		t.Fatalf("Create session failed: %v", err)
+	}
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.AddCookie(&http.Cookie{Name: "test_session", Value: sessionToken})
+		rec := httptest.NewRecorder()
+		p.Endpoints()[path].Handler(rec, req)
+		return rec
+	}
+	status := func() statusResponse {
+		t.Helper()
+		rec := serve("GET", "/2fa/status")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("/2fa/status = %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp statusResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if got := status(); got != (statusResponse{Enabled: true, Confirmed: true}) {
+		t.Errorf("status = %+v", got)
+	}
+
+	old, _ := p.generateBackupCodes(ctx, user.ID, 10)
+	rec := serve("POST", "/2fa/backup-codes/regenerate")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("regenerate = %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		BackupCodes []string `json:"backupCodes"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || len(resp.BackupCodes) != 10 {
+		t.Fatalf("regenerate response = %+v, %v", resp, err)
+	}
+	if p.useBackupCode(ctx, user.ID, old[0]) {
+		t.Error("backup code from before regeneration was accepted")
+	}
+	if !p.useBackupCode(ctx, user.ID, resp.BackupCodes[0]) {
+		t.Error("regenerated backup code was rejected")
+	}
+	if got := status(); got.BackupCodesRemaining != 9 {
+		t.Errorf("backupCodesRemaining = %d, want 9", got.BackupCodesRemaining)
+	}
+
+	// Both endpoints need a session
+	for path, method := range map[string]string{"/2fa/status": "GET", "/2fa/backup-codes/regenerate": "POST"} {
+		rec := httptest.NewRecorder()
+		p.Endpoints()[path].Handler(rec, httptest.NewRequest(method, path, nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s without session = %d, want 401", path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,656 @@
+package twofa
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/crypto"
+	"github.com/marshallshelly/beacon-auth/repo"
+	"github.com/marshallshelly/beacon-auth/tokens"
+)
+
+// WebAuthn challenge types in the verifications table
+const (
+	registerChallengeType = "webauthn_register"
+	assertChallengeType   = "webauthn_assert"
+)
+
+// maxCredentialIDLength bounds credential IDs so their base64 form fits the
+// indexed credential_id column
+const maxCredentialIDLength = 384
+
+// maxSecurityKeyNameLength bounds the names users give their keys
+const maxSecurityKeyNameLength = 64
+
+// Authenticator data flags
+const (
+	flagUserPresent   = 0x01
+	flagAttestedData  = 0x40
+	flagExtensionData = 0x80
+)
+
+// errInvalidCredential is returned for WebAuthn responses that fail
+// verification
+var errInvalidCredential = errors.New("twofa: invalid security key response")
+
+// SecurityKeyOptions configures WebAuthn security keys as a second factor.
+// They complement a password; they are not passkeys and do not sign users
+// in on their own.
+type SecurityKeyOptions struct {
+	// RPID is the WebAuthn relying party ID: the domain credentials are
+	// scoped to, such as "example.com". It must be the host of the pages
+	// calling the WebAuthn API or a parent domain of it, and cannot change
+	// once keys are registered. Defaults to the host of Config.BaseURL.
+	RPID string
+
+	// RPName is shown by browsers when registering a key. Defaults to
+	// Config.AppName.
+	RPName string
+
+	// Origins are the origins of the pages allowed to use security keys,
+	// such as "https://app.example.com". Defaults to the origin of
+	// Config.BaseURL and the trusted origins.
+	Origins []string
+
+	// Timeout is how long users have to touch their key. Defaults to two
+	// minutes.
+	Timeout time.Duration
+}
+
+// WithSecurityKeys sets the WebAuthn relying party of security keys. It is
+// only needed when the defaults derived from Config.BaseURL do not match
+// the pages using the plugin.
+func (p *TwoFAPlugin) WithSecurityKeys(opts SecurityKeyOptions) *TwoFAPlugin {
+	p.keyOpts = opts
+	return p
+}
+
+// initSecurityKeys fills the security key defaults from the configuration
+func (p *TwoFAPlugin) initSecurityKeys() {
+	if p.keyOpts.Timeout == 0 {
+		p.keyOpts.Timeout = 2 * time.Minute
+	}
+	if p.keyOpts.RPName == "" {
+		p.keyOpts.RPName = p.ctx.Config.AppName
+	}
+
+	base, err := url.Parse(p.ctx.Config.BaseURL)
+	if err == nil && base.Host != "" {
+		if p.keyOpts.RPID == "" {
+			p.keyOpts.RPID = base.Hostname()
+		}
+		if len(p.keyOpts.Origins) == 0 {
+			p.keyOpts.Origins = append(p.keyOpts.Origins, base.Scheme+"://"+base.Host)
+			if p.ctx.Config.Advanced != nil {
+				p.keyOpts.Origins = append(p.keyOpts.Origins, p.ctx.Config.Advanced.TrustedOrigins...)
+			}
+		}
+	}
+	for i, origin := range p.keyOpts.Origins {
+		p.keyOpts.Origins[i] = strings.TrimSuffix(origin, "/")
+	}
+}
+
+// securityKeyRecord is a row of the security keys table
+type securityKeyRecord struct {
+	ID           string     `db:"id"`
+	UserID       string     `db:"user_id"`
+	CredentialID string     `db:"credential_id"` // base64url
+	PublicKey    string     `db:"public_key"`    // base64url COSE key
+	SignCount    int64      `db:"sign_count"`
+	Name         string     `db:"name"`
+	CreatedAt    time.Time  `db:"created_at"`
+	LastUsedAt   *time.Time `db:"last_used_at,omitempty"`
+}
+
+// credential is a PublicKeyCredential serialized with toJSON(): binary
+// fields are base64url encoded
+type credential struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AttestationObject string `json:"attestationObject"` // registration
+		AuthenticatorData string `json:"authenticatorData"` // assertion
+		Signature         string `json:"signature"`         // assertion
+	} `json:"response"`
+}
+
+// credentialDescriptor identifies a registered key to the browser
+type credentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// creationOptions are the PublicKeyCredentialCreationOptions of a
+// registration, in the form accepted by
+// PublicKeyCredential.parseCreationOptionsFromJSON
+type creationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams       []credentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []credentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+	Attestation string `json:"attestation"`
+}
+
+type credentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// requestOptions are the PublicKeyCredentialRequestOptions of a sign-in,
+// in the form accepted by PublicKeyCredential.parseRequestOptionsFromJSON
+type requestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []credentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+type registerSecurityKeyRequest struct {
+	Name       string      `json:"name"`
+	Credential *credential `json:"credential"`
+}
+
+type securityKeyChallengeRequest struct {
+	Token string `json:"token"`
+}
+
+// handleSecurityKeyRegisterOptions starts registering a security key for
+// the signed-in user
+func (p *TwoFAPlugin) handleSecurityKeyRegisterOptions(w http.ResponseWriter, r *http.Request) {
+	_, user := p.getSession(r)
+	if user == nil {
+		core.WriteStatusError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if p.keyOpts.RPID == "" {
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Security keys are not configured")
+		return
+	}
+
+	keys, err := p.securityKeys(r.Context(), user.ID)
+	if err != nil {
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	challenge, err := p.newChallenge(r.Context(), user.ID, registerChallengeType)
+	if err != nil {
+		p.ctx.Logger.Error("Failed to create security key challenge: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	opts := creationOptions{
+		Challenge:          challenge,
+		Timeout:            p.keyOpts.Timeout.Milliseconds(),
+		ExcludeCredentials: descriptors(keys),
+		Attestation:        "none",
+	}
+	opts.RP.ID = p.keyOpts.RPID
+	opts.RP.Name = p.keyOpts.RPName
+	opts.User.ID = base64.RawURLEncoding.EncodeToString([]byte(user.ID))
+	opts.User.Name = user.Email
+	opts.User.DisplayName = user.Name
+	if opts.User.DisplayName == "" {
+		opts.User.DisplayName = user.Email
+	}
+	for _, alg := range supportedAlgorithms {
+		opts.PubKeyCredParams = append(opts.PubKeyCredParams, credentialParameter{Type: "public-key", Alg: alg})
+	}
+	// The password is the first factor, so the key only needs a touch
+	opts.AuthenticatorSelection.ResidentKey = "discouraged"
+	opts.AuthenticatorSelection.UserVerification = "discouraged"
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(opts)
+}
+
+// handleSecurityKeyRegister finishes registering a security key and turns
+// on 2FA for the user if it was off
+func (p *TwoFAPlugin) handleSecurityKeyRegister(w http.ResponseWriter, r *http.Request) {
+	var req registerSecurityKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Credential == nil {
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		req.Name = "Security key"
+	}
+	if len(req.Name) > maxSecurityKeyNameLength {
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Name is too long")
+		return
+	}
+
+	_, user := p.getSession(r)
+	if user == nil {
+		core.WriteStatusError(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if p.keyOpts.RPID == "" {
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Security keys are not configured")
+		return
+	}
+
+	record, err := p.verifyRegistration(r.Context(), user.ID, req.Credential)
+	if errors.Is(err, errInvalidCredential) {
+		p.ctx.Logger.Warn("Rejected security key registration: %v", err)
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Invalid security key response")
+		return
+	}
+	if err != nil {
+		p.ctx.Logger.Error("Failed to verify security key registration: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	record.Name = req.Name
+
+	if _, err := repo.Create(r.Context(), p.ctx.Adapter, p.table(TableSecurityKeys), record); err != nil {
+		if errors.Is(err, core.ErrDuplicate) {
+			core.WriteStatusError(w, r, http.StatusConflict, "Security key already registered")
+			return
+		}
+		p.ctx.Logger.Error("Failed to save security key: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	// The first factor comes with backup codes, in case the key is lost
+	response := map[string]interface{}{
+		"success":     true,
+		"securityKey": securityKeyFactor(record),
+	}
+	if !user.TwoFactorEnabled {
+		codes, err := p.generateBackupCodes(r.Context(), user.ID, 10)
+		if err != nil {
+			p.ctx.Logger.Warn("Failed to generate backup codes: %v", err)
+		} else {
+			response["backupCodes"] = codes
+		}
+
+		_, err = p.ctx.DataManager.UpdateUser(r.Context(), user.ID, map[string]interface{}{
+			"two_factor_enabled": true,
+		})
+		if err != nil {
+			p.ctx.Logger.Error("Failed to update user 2fa status: %v", err)
+		}
+	}
+
+	if _, err := p.ctx.RotateSession(w, r); err != nil {
+		p.ctx.Logger.Warn("Failed to rotate session after adding a security key: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// handleSecurityKeyChallenge returns the options for signing in with a
+// security key. Like /2fa/verify, it is authorized by the pending sign-in
+// token.
+func (p *TwoFAPlugin) handleSecurityKeyChallenge(w http.ResponseWriter, r *http.Request) {
+	var req securityKeyChallengeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		core.WriteStatusError(w, r, http.StatusBadRequest, "Token is required")
+		return
+	}
+
+	userID, err := tokens.For(p.ctx).PendingTwoFactor(r.Context(), req.Token)
+	if errors.Is(err, tokens.ErrInvalidToken) {
+		core.WriteError(w, r, http.StatusUnauthorized, core.CodeInvalidToken, "Invalid or expired token")
+		return
+	}
+	if err != nil {
+		p.ctx.Logger.Error("Failed to find pending 2FA sign-in: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	keys, err := p.securityKeys(r.Context(), userID)
+	if err != nil {
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal error")
+		return
+	}
+	if len(keys) == 0 {
+		core.WriteStatusError(w, r, http.StatusBadRequest, "No security keys registered")
+		return
+	}
+
+	challenge, err := p.newChallenge(r.Context(), userID, assertChallengeType)
+	if err != nil {
+		p.ctx.Logger.Error("Failed to create security key challenge: %v", err)
+		core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(requestOptions{
+		Challenge:        challenge,
+		Timeout:          p.keyOpts.Timeout.Milliseconds(),
+		RPID:             p.keyOpts.RPID,
+		AllowCredentials: descriptors(keys),
+		UserVerification: "discouraged",
+	})
+}
+
+// verifyRegistration checks a registration response to a challenge of the
+// user and returns the key to store. Attestation is not requested, so the
+// authenticator's make and model are not verified.
+func (p *TwoFAPlugin) verifyRegistration(ctx context.Context, userID string, cred *credential) (*securityKeyRecord, error) {
+	if _, err := p.checkClientData(ctx, userID, cred, "webauthn.create", registerChallengeType); err != nil {
+		return nil, err
+	}
+
+	raw, err := decodeBase64URL(cred.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: attestation object is not base64url", errInvalidCredential)
+	}
+	item, _, err := decodeCBOR(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidCredential, err)
+	}
+	attestation, _ := item.(map[interface{}]interface{})
+	authData, _ := attestation["authData"].([]byte)
+
+	data, err := p.parseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if data.flags&flagAttestedData == 0 {
+		return nil, fmt.Errorf("%w: no attested credential", errInvalidCredential)
+	}
+	if len(data.credentialID) > maxCredentialIDLength {
+		return nil, fmt.Errorf("%w: credential ID is too long", errInvalidCredential)
+	}
+	if rawID, err := decodeBase64URL(cred.RawID); err != nil || !bytes.Equal(rawID, data.credentialID) {
+		return nil, fmt.Errorf("%w: credential ID mismatch", errInvalidCredential)
+	}
+	if _, err := parseCOSEKey(data.publicKey); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidCredential, err)
+	}
+
+	id, err := crypto.GenerateID()
+	if err != nil {
+		return nil, err
+	}
+	return &securityKeyRecord{
+		ID:           id,
+		UserID:       userID,
+		CredentialID: base64.RawURLEncoding.EncodeToString(data.credentialID),
+		PublicKey:    base64.RawURLEncoding.EncodeToString(data.publicKey),
+		SignCount:    int64(data.signCount),
+		CreatedAt:    time.Now(),
+	}, nil
+}
+
+// verifyAssertion checks a security key sign-in response to a challenge of
+// the user and records the key's use
+func (p *TwoFAPlugin) verifyAssertion(ctx context.Context, userID string, cred *credential) error {
+	rawID, err := decodeBase64URL(cred.RawID)
+	if err != nil || len(rawID) == 0 {
+		return fmt.Errorf("%w: missing credential ID", errInvalidCredential)
+	}
+	query := core.NewQuery(p.table(TableSecurityKeys)).
+		Where("user_id", core.OpEqual, userID).
+		Where("credential_id", core.OpEqual, base64.RawURLEncoding.EncodeToString(rawID)).
+		Build()
+	key, err := repo.FindOne[securityKeyRecord](ctx, p.ctx.Adapter, query)
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		return fmt.Errorf("%w: unknown credential", errInvalidCredential)
+	}
+
+	clientDataJSON, err := p.checkClientData(ctx, userID, cred, "webauthn.get", assertChallengeType)
+	if err != nil {
+		return err
+	}
+	authData, err := decodeBase64URL(cred.Response.AuthenticatorData)
+	if err != nil {
+		return fmt.Errorf("%w: authenticator data is not base64url", errInvalidCredential)
+	}
+	data, err := p.parseAuthenticatorData(authData)
+	if err != nil {
+		return err
+	}
+
+	coseKey, err := decodeBase64URL(key.PublicKey)
+	if err != nil {
+		return fmt.Errorf("stored public key: %w", err)
+	}
+	publicKey, err := parseCOSEKey(coseKey)
+	if err != nil {
+		return fmt.Errorf("stored public key: %w", err)
+	}
+	signature, err := decodeBase64URL(cred.Response.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: signature is not base64url", errInvalidCredential)
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	if !publicKey.verify(slices.Concat(authData, clientDataHash[:]), signature) {
+		return fmt.Errorf("%w: bad signature", errInvalidCredential)
+	}
+
+	// A counter that does not move forward suggests a cloned key. Keys
+	// without a counter always report zero.
+	signCount := int64(data.signCount)
+	if (signCount != 0 || key.SignCount != 0) && signCount <= key.SignCount {
+		return fmt.Errorf("%w: sign count did not increase", errInvalidCredential)
+	}
+
+	update := core.NewQuery(p.table(TableSecurityKeys)).
+		Where("id", core.OpEqual, key.ID).
+		Where("sign_count", core.OpEqual, key.SignCount).
+		Build()
+	updated, err := p.ctx.Adapter.UpdateMany(ctx, update, map[string]interface{}{
+		"sign_count":   signCount,
+		"last_used_at": time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return fmt.Errorf("%w: key used concurrently", errInvalidCredential)
+	}
+	return nil
+}
+
+// clientData is the part of CollectedClientData that is verified
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// checkClientData verifies the client data of a response and consumes its
+// challenge. It returns the raw client data, whose hash is signed.
+func (p *TwoFAPlugin) checkClientData(ctx context.Context, userID string, cred *credential, ceremony, challengeType string) ([]byte, error) {
+	if cred.Type != "public-key" {
+		return nil, fmt.Errorf("%w: unexpected credential type %q", errInvalidCredential, cred.Type)
+	}
+	raw, err := decodeBase64URL(cred.Response.ClientDataJSON)
+	if err != nil {
+		return nil, fmt.Errorf("%w: client data is not base64url", errInvalidCredential)
+	}
+	var data clientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("%w: malformed client data", errInvalidCredential)
+	}
+	if data.Type != ceremony {
+		return nil, fmt.Errorf("%w: unexpected ceremony %q", errInvalidCredential, data.Type)
+	}
+	if !slices.Contains(p.keyOpts.Origins, data.Origin) {
+		return nil, fmt.Errorf("%w: origin %q is not allowed", errInvalidCredential, data.Origin)
+	}
+
+	ok, err := p.takeChallenge(ctx, userID, challengeType, data.Challenge)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown or expired challenge", errInvalidCredential)
+	}
+	return raw, nil
+}
+
+// authenticatorData is the parsed authenticator data of a response
+type authenticatorData struct {
+	flags        byte
+	signCount    uint32
+	credentialID []byte // registration only
+	publicKey    []byte // registration only, COSE encoded
+}
+
+// parseAuthenticatorData parses authenticator data and checks that it is
+// for the relying party and that the user touched the key
+func (p *TwoFAPlugin) parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data is too short", errInvalidCredential)
+	}
+	rpIDHash := sha256.Sum256([]byte(p.keyOpts.RPID))
+	if subtle.ConstantTimeCompare(raw[:32], rpIDHash[:]) != 1 {
+		return nil, fmt.Errorf("%w: wrong relying party", errInvalidCredential)
+	}
+
+	data := &authenticatorData{
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	if data.flags&flagUserPresent == 0 {
+		return nil, fmt.Errorf("%w: user not present", errInvalidCredential)
+	}
+
+	rest := raw[37:]
+	if data.flags&flagAttestedData != 0 {
+		// AAGUID, credential ID length and credential ID
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("%w: truncated attested credential", errInvalidCredential)
+		}
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < idLength {
+			return nil, fmt.Errorf("%w: truncated credential ID", errInvalidCredential)
+		}
+		data.credentialID = rest[:idLength]
+		rest = rest[idLength:]
+
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidCredential, err)
+		}
+		data.publicKey = rest[:n]
+		rest = rest[n:]
+	}
+	// Extensions are not requested, so their output is ignored
+	if len(rest) > 0 && data.flags&flagExtensionData == 0 {
+		return nil, fmt.Errorf("%w: trailing authenticator data", errInvalidCredential)
+	}
+	return data, nil
+}
+
+// newChallenge returns a WebAuthn challenge for the user that expires with
+// the timeout. Only its hash is stored.
+func (p *TwoFAPlugin) newChallenge(ctx context.Context, userID, challengeType string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	challenge := base64.RawURLEncoding.EncodeToString(b)
+
+	id, err := crypto.GenerateID()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	_, err = p.ctx.Adapter.Create(ctx, p.table(core.ModelVerifications), map[string]interface{}{
+		"id":         id,
+		"identifier": userID,
+		"token":      challengeToken(challengeType, challenge),
+		"type":       challengeType,
+		"expires_at": now.Add(p.keyOpts.Timeout),
+		"created_at": now,
+		"updated_at": now,
+	})
+	if err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+// takeChallenge deletes the user's challenge, so each is answered once, and
+// reports whether it was valid
+func (p *TwoFAPlugin) takeChallenge(ctx context.Context, userID, challengeType, challenge string) (bool, error) {
+	if challenge == "" {
+		return false, nil
+	}
+	query := core.NewQuery(p.table(core.ModelVerifications)).
+		Where("token", core.OpEqual, challengeToken(challengeType, challenge)).
+		Where("type", core.OpEqual, challengeType).
+		Where("identifier", core.OpEqual, userID).
+		Where("expires_at", core.OpGreaterThan, time.Now()).
+		Build()
+	deleted, err := p.ctx.Adapter.DeleteMany(ctx, query)
+	return deleted == 1, err
+}
+
+// challengeToken returns the stored form of a challenge
+func challengeToken(challengeType, challenge string) string {
+	sum := sha256.Sum256([]byte(challenge))
+	return challengeType + ":" + hex.EncodeToString(sum[:])
+}
+
+// securityKeys returns the user's security keys, oldest first
+func (p *TwoFAPlugin) securityKeys(ctx context.Context, userID string) ([]*securityKeyRecord, error) {
+	query := core.NewQuery(p.table(TableSecurityKeys)).
+		Where("user_id", core.OpEqual, userID).
+		OrderBy("created_at", false).
+		Build()
+	return repo.FindMany[securityKeyRecord](ctx, p.ctx.Adapter, query)
+}
+
+func descriptors(keys []*securityKeyRecord) []credentialDescriptor {
+	list := make([]credentialDescriptor, 0, len(keys))
+	for _, key := range keys {
+		list = append(list, credentialDescriptor{Type: "public-key", ID: key.CredentialID})
+	}
+	return list
+}
+
+// decodeBase64URL decodes base64url with or without padding
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
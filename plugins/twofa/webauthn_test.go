@@ -0,0 +1,346 @@
+package twofa
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/marshallshelly/beacon-auth/tokens"
+)
+
+// testAuthenticator is a software security key with a P-256 credential
+type testAuthenticator struct {
+	key       *ecdsa.PrivateKey
+	id        []byte
+	signCount uint32
+}
+
+func newTestAuthenticator(t *testing.T) *testAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 32)
+	_, _ = rand.Read(id)
+	return &testAuthenticator{key: key, id: id}
+}
+
+func cborHead(major byte, n int) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 256:
+		return []byte{major<<5 | 24, byte(n)}
+	}
+	return []byte{major<<5 | 25, byte(n >> 8), byte(n)}
+}
+
+func cborInt(n int64) []byte {
+	if n < 0 {
+		return cborHead(1, int(-1-n))
+	}
+	return cborHead(0, int(n))
+}
+
+func cborBytes(b []byte) []byte { return append(cborHead(2, len(b)), b...) }
+func cborText(s string) []byte  { return append(cborHead(3, len(s)), s...) }
+
+func (a *testAuthenticator) coseKey() []byte {
+	x := a.key.X.FillBytes(make([]byte, 32))
+	y := a.key.Y.FillBytes(make([]byte, 32))
+	key := cborHead(5, 5)
+	for _, part := range [][]byte{
+		cborInt(1), cborInt(2),
+		cborInt(3), cborInt(coseES256),
+		cborInt(-1), cborInt(1),
+		cborInt(-2), cborBytes(x),
+		cborInt(-3), cborBytes(y),
+	} {
+		key = append(key, part...)
+	}
+	return key
+}
+
+func (a *testAuthenticator) authData(rpID string, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append([]byte(nil), rpIDHash[:]...)
+	flags := byte(flagUserPresent)
+	if attested {
+		flags |= flagAttestedData
+	}
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if attested {
+		data = append(data, make([]byte, 16)...) // AAGUID
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.id)))
+		data = append(data, a.id...)
+		data = append(data, a.coseKey()...)
+	}
+	return data
+}
+
+func clientDataJSON(ceremony, challenge, origin string) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":      ceremony,
+		"challenge": challenge,
+		"origin":    origin,
+	})
+	return data
+}
+
+func (a *testAuthenticator) register(rpID, origin, challenge string) *credential {
+	attestation := cborHead(5, 3)
+	attestation = append(attestation, cborText("fmt")...)
+	attestation = append(attestation, cborText("none")...)
+	attestation = append(attestation, cborText("attStmt")...)
+	attestation = append(attestation, cborHead(5, 0)...)
+	attestation = append(attestation, cborText("authData")...)
+	attestation = append(attestation, cborBytes(a.authData(rpID, true))...)
+
+	cred := &credential{
+		ID:    base64.RawURLEncoding.EncodeToString(a.id),
+		RawID: base64.RawURLEncoding.EncodeToString(a.id),
+		Type:  "public-key",
+	}
+	cred.Response.ClientDataJSON = base64.RawURLEncoding.EncodeToString(clientDataJSON("webauthn.create", challenge, origin))
+	cred.Response.AttestationObject = base64.RawURLEncoding.EncodeToString(attestation)
+	return cred
+}
+
+func (a *testAuthenticator) assert(t *testing.T, rpID, origin, challenge string) *credential {
+	t.Helper()
+	a.signCount++
+	authData := a.authData(rpID, false)
+	clientData := clientDataJSON("webauthn.get", challenge, origin)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cred := &credential{
+		ID:    base64.RawURLEncoding.EncodeToString(a.id),
+		RawID: base64.RawURLEncoding.EncodeToString(a.id),
+		Type:  "public-key",
+	}
+	cred.Response.ClientDataJSON = base64.RawURLEncoding.EncodeToString(clientData)
+	cred.Response.AuthenticatorData = base64.RawURLEncoding.EncodeToString(authData)
+	cred.Response.Signature = base64.RawURLEncoding.EncodeToString(sig)
+	return cred
+}
+
+// sessionClient calls the plugin's endpoints as the signed-in user,
+// following session rotations
+type sessionClient struct {
+	t     *testing.T
+	p     *TwoFAPlugin
+	token string
+}
+
+func newSessionClient(t *testing.T, p *TwoFAPlugin, userID string) *sessionClient {
+	t.Helper()
+	_, _, token, err := p.ctx.SessionManager.Create(context.Background(), userID, nil)
+	if err != nil {
+		t.Fatalf("Create session failed: %v", err)
+	}
+	return &sessionClient{t: t, p: p, token: token}
+}
+
+func (c *sessionClient) do(method, path string, body interface{}, out interface{}) int {
+	c.t.Helper()
+	var req *http.Request
+	if body != nil {
+		data, _ := json.Marshal(body)
+		req = httptest.NewRequest(method, path, strings.NewReader(string(data)))
+	} else {
+		req = httptest.NewRequest(method, path, nil)
+	}
+	req.AddCookie(&http.Cookie{Name: "test_session", Value: c.token})
+	rec := httptest.NewRecorder()
+	c.p.Endpoints()[path].Handler(rec, req)
+
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "test_session" && cookie.Value != "" {
+			c.token = cookie.Value
+		}
+	}
+	if out != nil && rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(out); err != nil {
+			c.t.Fatalf("%s: decoding response: %v", path, err)
+		}
+	}
+	return rec.Code
+}
+
+// registerKey registers the authenticator for the client's user
+func registerKey(t *testing.T, c *sessionClient, a *testAuthenticator, name string) {
+	t.Helper()
+	var opts creationOptions
+	if code := c.do("POST", "/2fa/security-keys/register/options", nil, &opts); code != http.StatusOK {
+		t.Fatalf("register options = %d", code)
+	}
+	body := registerSecurityKeyRequest{Name: name, Credential: a.register(opts.RP.ID, "https://example.com", opts.Challenge)}
+	if code := c.do("POST", "/2fa/security-keys/register", body, nil); code != http.StatusOK {
+		t.Fatalf("register = %d", code)
+	}
+}
+
+func TestSecurityKey_RegisterAndVerify(t *testing.T) {
+	p, user, _ := newTestPlugin(t)
+	c := newSessionClient(t, p, user.ID)
+	a := newTestAuthenticator(t)
+
+	var opts creationOptions
+	if code := c.do("POST", "/2fa/security-keys/register/options", nil, &opts); code != http.StatusOK {
+		t.Fatalf("register options = %d", code)
+	}
+	if opts.RP.ID != "example.com" || opts.Challenge == "" || len(opts.PubKeyCredParams) != 3 {
+		t.Errorf("unexpected creation options: %+v", opts)
+	}
+
+	// Responses for another relying party or origin are rejected, and
+	// consume the challenge
+	for _, cred := range []*credential{
+		a.register("evil.example", "https://example.com", opts.Challenge),
+		a.register("example.com", "https://evil.example", opts.Challenge),
+	} {
+		body := registerSecurityKeyRequest{Credential: cred}
+		if code := c.do("POST", "/2fa/security-keys/register", body, nil); code != http.StatusBadRequest {
+			t.Errorf("register with foreign response = %d, want 400", code)
+		}
+	}
+
+	registerKey(t, c, a, "YubiKey")
+
+	// The same key cannot be registered twice
+	if code := c.do("POST", "/2fa/security-keys/register/options", nil, &opts); code != http.StatusOK {
+		t.Fatalf("register options = %d", code)
+	}
+	if len(opts.ExcludeCredentials) != 1 {
+		t.Errorf("excludeCredentials = %+v, want the registered key", opts.ExcludeCredentials)
+	}
+	body := registerSecurityKeyRequest{Credential: a.register("example.com", "https://example.com", opts.Challenge)}
+	if code := c.do("POST", "/2fa/security-keys/register", body, nil); code != http.StatusConflict {
+		t.Errorf("duplicate registration = %d, want 409", code)
+	}
+
+	// Sign in with the key
+	token, err := tokens.For(p.ctx).BeginTwoFactor(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("BeginTwoFactor failed: %v", err)
+	}
+	challenge := func() string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		p.handleSecurityKeyChallenge(rec, httptest.NewRequest("POST", "/2fa/security-keys/challenge", strings.NewReader(`{"token":"`+token+`"}`)))
+		var opts requestOptions
+		if rec.Code != http.StatusOK || json.NewDecoder(rec.Body).Decode(&opts) != nil {
+			t.Fatalf("challenge = %d: %s", rec.Code, rec.Body.String())
+		}
+		if opts.RPID != "example.com" || len(opts.AllowCredentials) != 1 {
+			t.Errorf("unexpected request options: %+v", opts)
+		}
+		return opts.Challenge
+	}
+	verifyKey := func(cred *credential) int {
+		data, _ := json.Marshal(verifyRequest{Token: token, Credential: cred})
+		return verify(p, string(data)).Code
+	}
+
+	if code := verifyKey(a.assert(t, "example.com", "https://evil.example", challenge())); code != http.StatusUnauthorized {
+		t.Errorf("verify from foreign origin = %d, want 401", code)
+	}
+
+	first := a.assert(t, "example.com", "https://example.com", challenge())
+	second := challenge()
+	if code := verifyKey(first); code != http.StatusOK {
+		t.Fatalf("verify with security key = %d", code)
+	}
+
+	// A replayed response fails on its used challenge, and a cloned key
+	// whose counter fell behind is rejected
+	token, _ = tokens.For(p.ctx).BeginTwoFactor(context.Background(), user.ID)
+	if code := verifyKey(first); code != http.StatusUnauthorized {
+		t.Errorf("replayed response = %d, want 401", code)
+	}
+	a.signCount--
+	if code := verifyKey(a.assert(t, "example.com", "https://example.com", second)); code != http.StatusUnauthorized {
+		t.Errorf("stale sign count = %d, want 401", code)
+	}
+}
+
+func TestFactors_ListAndRemove(t *testing.T) {
+	p, user, _ := newTestPlugin(t)
+	c := newSessionClient(t, p, user.ID)
+	registerKey(t, c, newTestAuthenticator(t), "YubiKey")
+	if _, err := p.generateBackupCodes(context.Background(), user.ID, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	var list struct {
+		Factors []factorResponse `json:"factors"`
+	}
+	if code := c.do("GET", "/2fa/factors", nil, &list); code != http.StatusOK {
+		t.Fatalf("factors = %d", code)
+	}
+	if len(list.Factors) != 2 || list.Factors[0].Type != FactorTOTP ||
+		list.Factors[1].Type != FactorSecurityKey || list.Factors[1].Name != "YubiKey" {
+		t.Fatalf("factors = %+v", list.Factors)
+	}
+	keyID := list.Factors[1].ID
+
+	var removed struct {
+		Enabled bool `json:"enabled"`
+	}
+	if code := c.do("POST", "/2fa/factors/remove", removeFactorRequest{ID: "unknown"}, nil); code != http.StatusNotFound {
+		t.Errorf("remove unknown factor = %d, want 404", code)
+	}
+	if code := c.do("POST", "/2fa/factors/remove", removeFactorRequest{ID: FactorTOTP}, &removed); code != http.StatusOK || !removed.Enabled {
+		t.Errorf("remove totp = %d, enabled %v; want 200, true", code, removed.Enabled)
+	}
+	if code := c.do("POST", "/2fa/factors/remove", removeFactorRequest{ID: keyID}, &removed); code != http.StatusOK || removed.Enabled {
+		t.Errorf("remove last key = %d, enabled %v; want 200, false", code, removed.Enabled)
+	}
+
+	// Removing the last factor turns 2FA off
+	updated, err := p.findUser(context.Background(), user.ID)
+	if err != nil || updated.TwoFactorEnabled {
+		t.Errorf("user still has 2FA enabled: %+v, %v", updated, err)
+	}
+	var status statusResponse
+	c.do("GET", "/2fa/status", nil, &status)
+	if status != (statusResponse{}) {
+		t.Errorf("status after removing all factors = %+v", status)
+	}
+}
+
+func TestDecodeCBOR_Malformed(t *testing.T) {
+	deep := strings.Repeat("\x81", maxCBORDepth+2) + "\x00"
+	for name, data := range map[string]string{
+		"empty":           "",
+		"truncated bytes": "\x45ab",
+		"huge array":      "\x9b\xff\xff\xff\xff\xff\xff\xff\xff",
+		"duplicate key":   "\xa2\x01\x01\x01\x02",
+		"float":           "\xf9\x3c\x00",
+		"too deep":        deep,
+	} {
+		if _, _, err := decodeCBOR([]byte(data)); !errors.Is(err, errCBOR) {
+			t.Errorf("%s: err = %v, want errCBOR", name, err)
+		}
+	}
+	if _, err := parseCOSEKey([]byte("\xa1\x01\x02")); err == nil {
+		t.Error("incomplete COSE key was accepted")
+	}
+}
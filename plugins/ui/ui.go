@@ -0,0 +1,296 @@
+// Package ui serves ready-made, server-rendered pages for the auth flows:
+// sign in, sign up, forgot and reset password, email verification, the
+// two-factor challenge and application consent. The pages submit their
+// forms to the JSON endpoints of the emailpassword, twofa and consent
+// plugins, so small applications get a working UI without building a
+// frontend.
+//
+//	auth, err := beaconauth.New(
+//		beaconauth.WithPlugins(
+//			emailpassword.New(),
+//			twofa.New(),
+//			ui.New(&ui.Options{RedirectURL: "/dashboard"}),
+//		),
+//	)
+//	// GET /auth/ui/signin renders the sign-in page
+//
+// Every page is an html/template file and can be replaced by a file of the
+// same name in Options.Templates.
+package ui
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/plugin"
+)
+
+//go:embed templates/*.html
+var builtin embed.FS
+
+// Pages served by the plugin, below Options.Path. A template file is named
+// after its page, e.g. "signin.html".
+const (
+	PageSignIn         = "signin"
+	PageSignUp         = "signup"
+	PageForgotPassword = "forgot-password"
+	PageResetPassword  = "reset-password"
+	PageVerifyEmail    = "verify-email"
+	PageTwoFactor      = "2fa"
+	PageConsent        = "consent"
+)
+
+// Pages lists every page of the plugin
+var Pages = []string{
+	PageSignIn,
+	PageSignUp,
+	PageForgotPassword,
+	PageResetPassword,
+	PageVerifyEmail,
+	PageTwoFactor,
+	PageConsent,
+}
+
+// LayoutTemplate is the template file every page is rendered in. It
+// renders the page's "content" template.
+const LayoutTemplate = "layout.html"
+
+// Options configures the hosted pages
+type Options struct {
+	// Path is where the pages are served, relative to the base path
+	// (default "/ui", so sign-in is at /auth/ui/signin)
+	Path string `yaml:"path"`
+
+	// RedirectURL is where users go after signing in or up, unless the
+	// page was opened with a relative next query parameter (default "/")
+	RedirectURL string `yaml:"redirect_url"`
+
+	// DisableSignup stops serving the sign-up page
+	DisableSignup bool `yaml:"disable_signup"`
+
+	// Templates overrides built-in templates with files of the same name,
+	// such as "layout.html" or "signin.html" (nil = built-in only)
+	Templates fs.FS `yaml:"-"`
+}
+
+// PageData is the data pages are rendered with
+type PageData struct {
+	AppName string
+
+	// Page is the name of the rendered page, e.g. PageSignIn
+	Page string
+
+	// APIPath is the base path of the JSON endpoints the forms submit to
+	APIPath string
+
+	// UIPath is the path of the pages, e.g. "/auth/ui"
+	UIPath string
+
+	// Next is where to go once the page's form succeeds
+	Next string
+
+	// Token is the token query parameter of email links
+	Token string
+
+	// User is the signed-in user, if any
+	User *core.User
+
+	// Signup reports whether the sign-up page is served
+	Signup bool
+
+	// AppID, Scopes and RedirectURI are the consent request
+	AppID       string
+	Scopes      []string
+	RedirectURI string
+}
+
+// UIPlugin serves the hosted pages
+type UIPlugin struct {
+	*plugin.BasePlugin
+	ctx       *core.AuthContext
+	opts      Options
+	templates map[string]*template.Template
+}
+
+// New creates the hosted UI plugin
+func New(opts *Options) *UIPlugin {
+	o := Options{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Path == "" {
+		o.Path = "/ui"
+	}
+	if o.RedirectURL == "" {
+		o.RedirectURL = "/"
+	}
+
+	return &UIPlugin{
+		BasePlugin: plugin.NewBasePlugin("ui"),
+		opts:       o,
+	}
+}
+
+// Config returns the plugin's options, which the ui section of the config
+// file sets
+func (p *UIPlugin) Config() interface{} {
+	return &p.opts
+}
+
+// ValidateConfig checks the options
+func (p *UIPlugin) ValidateConfig() error {
+	if !strings.HasPrefix(p.opts.Path, "/") || p.opts.Path == "/" {
+		return fmt.Errorf("ui: path must start with / and name a directory: %q", p.opts.Path)
+	}
+	return nil
+}
+
+// Init parses the templates and points the links of password reset and
+// verification emails at the hosted pages, unless they are configured
+func (p *UIPlugin) Init(ctx *core.AuthContext) error {
+	p.opts.Path = strings.TrimRight(p.opts.Path, "/")
+	templates, err := parseTemplates(p.opts.Templates)
+	if err != nil {
+		return err
+	}
+	p.templates = templates
+	p.ctx = ctx
+
+	if ep := ctx.Config.EmailPassword; ep != nil {
+		if ep.ResetPasswordURL == "" {
+			ep.ResetPasswordURL = p.pageURL(PageResetPassword)
+		}
+		if ep.VerifyEmailURL == "" {
+			ep.VerifyEmailURL = p.pageURL(PageVerifyEmail)
+		}
+	}
+	return nil
+}
+
+// Endpoints returns a GET endpoint per page
+func (p *UIPlugin) Endpoints() map[string]plugin.Endpoint {
+	endpoints := make(map[string]plugin.Endpoint, len(Pages))
+	for _, page := range Pages {
+		if page == PageSignUp && p.opts.DisableSignup {
+			continue
+		}
+		endpoints[p.opts.Path+"/"+page] = plugin.Endpoint{Method: "GET", Handler: p.pageHandler(page)}
+	}
+	return endpoints
+}
+
+// parseTemplates parses the layout and page templates, preferring the
+// files of overrides
+func parseTemplates(overrides fs.FS) (map[string]*template.Template, error) {
+	read := func(name string) ([]byte, error) {
+		if overrides != nil {
+			data, err := fs.ReadFile(overrides, name)
+			if err == nil {
+				return data, nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return nil, fmt.Errorf("ui: read template %s: %w", name, err)
+			}
+		}
+		return builtin.ReadFile("templates/" + name)
+	}
+
+	layout, err := read(LayoutTemplate)
+	if err != nil {
+		return nil, err
+	}
+	templates := make(map[string]*template.Template, len(Pages))
+	for _, page := range Pages {
+		content, err := read(page + ".html")
+		if err != nil {
+			return nil, err
+		}
+		t, err := template.New(LayoutTemplate).Parse(string(layout))
+		if err != nil {
+			return nil, fmt.Errorf("ui: parse %s: %w", LayoutTemplate, err)
+		}
+		if _, err := t.New(page + ".html").Parse(string(content)); err != nil {
+			return nil, fmt.Errorf("ui: parse %s.html: %w", page, err)
+		}
+		templates[page] = t
+	}
+	return templates, nil
+}
+
+func (p *UIPlugin) pageHandler(page string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		_, user := p.ctx.RequestSession(r)
+
+		// Consent is given by a signed-in user; send others to sign in
+		// and back
+		if page == PageConsent && user == nil {
+			signin := p.uiPath() + "/" + PageSignIn + "?next=" + url.QueryEscape(r.URL.RequestURI())
+			http.Redirect(w, r, signin, http.StatusFound)
+			return
+		}
+
+		data := &PageData{
+			AppName:     p.ctx.Config.AppName,
+			Page:        page,
+			APIPath:     p.apiPath(),
+			UIPath:      p.uiPath(),
+			Next:        p.next(query.Get("next")),
+			Token:       query.Get("token"),
+			User:        user,
+			Signup:      !p.opts.DisableSignup,
+			AppID:       query.Get("app_id"),
+			Scopes:      strings.Fields(query.Get("scope")),
+			RedirectURI: query.Get("redirect_uri"),
+		}
+
+		var buf bytes.Buffer
+		if err := p.templates[page].ExecuteTemplate(&buf, LayoutTemplate, data); err != nil {
+			p.ctx.Logger.Error("Failed to render page", "page", page, "error", err)
+			core.WriteStatusError(w, r, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		_, _ = w.Write(buf.Bytes())
+	}
+}
+
+// next returns the page to go to after a form succeeds. Only paths on this
+// site are followed, so links cannot redirect users elsewhere.
+func (p *UIPlugin) next(next string) string {
+	if next = core.SafeRedirect(next, "", nil); next != "" {
+		return next
+	}
+	return p.opts.RedirectURL
+}
+
+// apiPath returns the base path of the auth endpoints
+func (p *UIPlugin) apiPath() string {
+	basePath := strings.TrimRight(p.ctx.Config.BasePath, "/")
+	if basePath != "" && !strings.HasPrefix(basePath, "/") {
+		basePath = "/" + basePath
+	}
+	return basePath
+}
+
+// uiPath returns the path of the pages, including the base path
+func (p *UIPlugin) uiPath() string {
+	return p.apiPath() + p.opts.Path
+}
+
+// pageURL returns the absolute URL of page
+func (p *UIPlugin) pageURL(page string) string {
+	return strings.TrimRight(p.ctx.Config.BaseURL, "/") + p.uiPath() + "/" + page
+}
@@ -0,0 +1,213 @@
+package ui
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	beaconauth "github.com/marshallshelly/beacon-auth"
+	"github.com/marshallshelly/beacon-auth/adapters/sqlite"
+	"github.com/marshallshelly/beacon-auth/cmd/beacon/schema"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/i18n"
+	"github.com/marshallshelly/beacon-auth/plugins/emailpassword"
+)
+
+type silentLogger struct{}
+
+func (silentLogger) Debug(string, ...interface{}) {}
+func (silentLogger) Info(string, ...interface{})  {}
+func (silentLogger) Warn(string, ...interface{})  {}
+func (silentLogger) Error(string, ...interface{}) {}
+
+func newTestPlugin(t *testing.T, opts *Options) *UIPlugin {
+	t.Helper()
+
+	p := New(opts)
+	if err := p.ValidateConfig(); err != nil {
+		t.Fatalf("ValidateConfig failed: %v", err)
+	}
+	ctx := &core.AuthContext{
+		Config: &core.Config{
+			AppName:       "Acme",
+			BaseURL:       "https://acme.example.com",
+			BasePath:      "/auth",
+			EmailPassword: &core.EmailPasswordConfig{},
+			Session:       &core.SessionConfig{CookieName: "session"},
+		},
+		Logger: silentLogger{},
+	}
+	if err := p.Init(ctx); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	return p
+}
+
+func get(p *UIPlugin, target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	u, _ := url.Parse(target)
+	rec := httptest.NewRecorder()
+	p.Endpoints()[strings.TrimPrefix(u.Path, "/auth")].Handler(rec, req)
+	return rec
+}
+
+func TestUIPlugin_Pages(t *testing.T) {
+	p := newTestPlugin(t, nil)
+
+	for _, page := range Pages {
+		if page == PageConsent {
+			continue
+		}
+		rec := get(p, "/auth/ui/"+page)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", page, rec.Code, rec.Body)
+		}
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+			t.Errorf("%s: Content-Type = %q", page, ct)
+		}
+		if rec.Header().Get("X-Frame-Options") != "DENY" {
+			t.Errorf("%s: pages must not be framed", page)
+		}
+	}
+
+	body := get(p, "/auth/ui/signin?next=/dashboard").Body.String()
+	if !strings.Contains(body, `data-endpoint="/auth/login"`) || !strings.Contains(body, `data-next="/dashboard"`) {
+		t.Errorf("sign-in form does not post to the login endpoint and return to next:\n%s", body)
+	}
+	if !strings.Contains(body, "Acme") {
+		t.Error("page does not show the app name")
+	}
+
+	if cfg := p.ctx.Config.EmailPassword; cfg.ResetPasswordURL != "https://acme.example.com/auth/ui/reset-password" {
+		t.Errorf("ResetPasswordURL = %q", cfg.ResetPasswordURL)
+	}
+}
+
+func TestUIPlugin_NextStaysOnSite(t *testing.T) {
+	p := newTestPlugin(t, &Options{RedirectURL: "/home"})
+
+	for _, next := range []string{"https://evil.example.com", "//evil.example.com", `/\evil.example.com`, "/\t/evil.example.com", ""} {
+		body := get(p, "/auth/ui/signin?next="+url.QueryEscape(next)).Body.String()
+		if !strings.Contains(body, `data-next="/home"`) {
+			t.Errorf("next %q was not replaced by RedirectURL", next)
+		}
+	}
+}
+
+func TestUIPlugin_TemplateOverride(t *testing.T) {
+	p := newTestPlugin(t, &Options{
+		Path:          "/pages",
+		DisableSignup: true,
+		Templates: fstest.MapFS{
+			"signin.html": {Data: []byte(`{{define "content"}}<h1>Custom {{.AppName}}</h1>{{end}}`)},
+		},
+	})
+
+	body := get(p, "/auth/pages/signin").Body.String()
+	if !strings.Contains(body, "<h1>Custom Acme</h1>") || !strings.Contains(body, "<html") {
+		t.Errorf("override was not rendered in the layout:\n%s", body)
+	}
+	if _, ok := p.Endpoints()["/pages/signup"]; ok {
+		t.Error("sign-up page is served with DisableSignup")
+	}
+
+	bad := New(&Options{Templates: fstest.MapFS{"2fa.html": {Data: []byte(`{{define "content"}}{{.Missing`)}}})
+	if err := bad.Init(p.ctx); err == nil {
+		t.Error("Init accepted an invalid template")
+	}
+}
+
+func TestUIPlugin_ConsentRequiresSignIn(t *testing.T) {
+	p := newTestPlugin(t, nil)
+
+	rec := get(p, "/auth/ui/consent?app_id=dashboard&scope=profile")
+	if rec.Code != http.StatusFound {
+		t.Fatalf("status %d, want redirect to sign in", rec.Code)
+	}
+	want := "/auth/ui/signin?next=" + url.QueryEscape("/auth/ui/consent?app_id=dashboard&scope=profile")
+	if loc := rec.Header().Get("Location"); loc != want {
+		t.Errorf("Location = %q, want %q", loc, want)
+	}
+}
+
+type captureMailer struct {
+	to, body string
+}
+
+func (m *captureMailer) Send(_ context.Context, to, _, body string) error {
+	m.to, m.body = to, body
+	return nil
+}
+
+func TestUIPlugin_PasswordReset(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlite.New(ctx, &sqlite.Config{InMemory: true})
+	if err != nil {
+		t.Fatalf("sqlite.New() error = %v", err)
+	}
+	script, err := schema.GenerateSQL(&schema.Config{Adapter: "sqlite"})
+	if err != nil {
+		t.Fatalf("GenerateSQL() error = %v", err)
+	}
+	for _, stmt := range schema.SplitStatements(script, "sqlite") {
+		if err := db.Exec(ctx, stmt); err != nil {
+			t.Fatalf("Exec() error = %v", err)
+		}
+	}
+
+	mailer := &captureMailer{}
+	auth, err := beaconauth.New(
+		beaconauth.WithAdapter(db),
+		beaconauth.WithSecret("test-secret-key-that-is-long-enough"),
+		beaconauth.WithBaseURL("http://localhost:8080"),
+		beaconauth.WithPlugins(emailpassword.New(), New(nil)),
+		beaconauth.WithMailer(mailer),
+		beaconauth.WithLocalizer(i18n.New(i18n.Config{})),
+		beaconauth.WithLogger(silentLogger{}),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer auth.Close()
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		auth.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := post("/auth/register", `{"email":"ana@example.com","password":"old-password"}`); rec.Code != http.StatusOK {
+		t.Fatalf("register: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := post("/auth/forgot-password", `{"email":"nobody@example.com"}`); rec.Code != http.StatusOK || mailer.to != "" {
+		t.Fatalf("forgot-password for an unknown email: status %d, mailed %q", rec.Code, mailer.to)
+	}
+	if rec := post("/auth/forgot-password", `{"email":"ana@example.com"}`); rec.Code != http.StatusOK {
+		t.Fatalf("forgot-password: status %d: %s", rec.Code, rec.Body)
+	}
+	link := regexp.MustCompile(`http://localhost:8080/auth/ui/reset-password\?token=(\S+)`).FindStringSubmatch(mailer.body)
+	if mailer.to != "ana@example.com" || link == nil {
+		t.Fatalf("reset email to %q has no reset link:\n%s", mailer.to, mailer.body)
+	}
+
+	reset := `{"token":"` + link[1] + `","password":"new-password"}`
+	if rec := post("/auth/reset-password", reset); rec.Code != http.StatusOK {
+		t.Fatalf("reset-password: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := post("/auth/reset-password", reset); rec.Code != http.StatusBadRequest {
+		t.Errorf("reused reset token: status %d, want 400", rec.Code)
+	}
+	if rec := post("/auth/login", `{"email":"ana@example.com","password":"old-password"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("old password: status %d, want 401", rec.Code)
+	}
+	if rec := post("/auth/login", `{"email":"ana@example.com","password":"new-password"}`); rec.Code != http.StatusOK {
+		t.Errorf("new password: status %d: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,226 @@
+package beaconauth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/adapters/sqlite"
+	"github.com/marshallshelly/beacon-auth/cmd/beacon/schema"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/middleware"
+	"github.com/marshallshelly/beacon-auth/plugins/emailpassword"
+	"github.com/marshallshelly/beacon-auth/session"
+)
+
+// Quickstart defaults
+const (
+	DefaultQuickstartDatabase   = "beaconauth.db"
+	DefaultQuickstartSecretFile = ".beaconauth-secret"
+	DefaultQuickstartBaseURL    = "http://localhost:8080"
+)
+
+// QuickstartConfig configures Quickstart. The zero value is a working
+// development setup.
+type QuickstartConfig struct {
+	// DatabasePath is the SQLite database file (default "beaconauth.db")
+	DatabasePath string
+
+	// InMemory uses a private in-memory database instead of a file. Users
+	// and sessions are lost when the process exits.
+	InMemory bool
+
+	// Secret signs session cookies. When empty, a random secret is
+	// generated and persisted to SecretFile so sessions survive restarts
+	// (in-memory setups use an ephemeral secret instead).
+	Secret string
+
+	// SecretFile stores the generated development secret (default
+	// ".beaconauth-secret", created with mode 0600)
+	SecretFile string
+
+	// BaseURL is the public URL of the app (default "http://localhost:8080").
+	// Session cookies are marked Secure only for https URLs.
+	BaseURL string
+
+	// App serves every request outside the auth base path. The current
+	// session and user, if any, are available via core.GetSession and
+	// core.GetUser. Defaults to http.NotFoundHandler.
+	App http.Handler
+
+	// Options are applied after the quickstart defaults, e.g. to add
+	// plugins or a logger
+	Options []Option
+}
+
+// Quickstart creates a ready-to-use BeaconAuth setup for prototypes: a
+// SQLite database with the schema applied, cookie sessions backed by the
+// database, email/password sign-up and sign-in, and in-memory rate limiting
+// of the auth routes. The returned handler serves the auth routes under
+// /auth and everything else with cfg.App. A nil cfg uses the defaults.
+//
+//	handler, auth, err := beaconauth.Quickstart(&beaconauth.QuickstartConfig{App: appMux})
+//	defer auth.Close()
+//	log.Fatal(http.ListenAndServe(":8080", handler))
+//
+// Quickstart is meant for development. Production deployments should
+// configure a secret from a secret manager and a production database with
+// New.
+func Quickstart(cfg *QuickstartConfig) (http.Handler, Auth, error) {
+	if cfg == nil {
+		cfg = &QuickstartConfig{}
+	}
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultQuickstartBaseURL
+	}
+
+	ctx := context.Background()
+	db, err := openQuickstartDB(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	secret, err := quickstartSecret(cfg)
+	if err != nil {
+		_ = db.Close()
+		return nil, nil, err
+	}
+
+	secure := strings.HasPrefix(baseURL, "https://")
+	opts := []Option{
+		WithAdapter(db),
+		WithSecret(secret),
+		WithBaseURL(baseURL),
+		WithPlugins(emailpassword.New()),
+		WithRateLimit(core.NewMemoryRateLimitStorage(),
+			core.RateLimitRule{Path: "/login", Methods: []string{http.MethodPost}, Limit: 10, Window: time.Minute},
+			core.RateLimitRule{Path: "/register", Methods: []string{http.MethodPost}, Limit: 5, Window: time.Minute},
+			core.RateLimitRule{Path: "*", Limit: 100, Window: time.Minute},
+		),
+		func(c *core.Config) error {
+			c.Session.CookieSecure = secure
+			c.Advanced.UseSecureCookies = secure
+			return nil
+		},
+	}
+	opts = append(opts, cfg.Options...)
+
+	auth, err := New(opts...)
+	if err != nil {
+		_ = db.Close()
+		return nil, nil, err
+	}
+
+	app := cfg.App
+	if app == nil {
+		app = http.NotFoundHandler()
+	}
+	if manager, ok := auth.Context().SessionManager.(*session.Manager); ok {
+		app = middleware.SessionMiddleware(manager)(app)
+	}
+
+	basePath := "/" + strings.Trim(auth.Context().Config.BasePath, "/")
+	mux := http.NewServeMux()
+	mux.Handle(basePath, auth.Handler())
+	mux.Handle(basePath+"/", auth.Handler())
+	mux.Handle("/", app)
+
+	return mux, auth, nil
+}
+
+// openQuickstartDB opens the SQLite database and applies the schema. The
+// generated schema only creates missing tables, so it is safe to apply on
+// every start.
+func openQuickstartDB(ctx context.Context, cfg *QuickstartConfig) (*sqlite.SQLiteAdapter, error) {
+	dbCfg := &sqlite.Config{InMemory: cfg.InMemory}
+	if !cfg.InMemory {
+		path := cfg.DatabasePath
+		if path == "" {
+			path = DefaultQuickstartDatabase
+		}
+		dbCfg.DataSourceName = "file:" + path + "?cache=shared&mode=rwc"
+	}
+
+	db, err := sqlite.New(ctx, dbCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	script, err := schema.GenerateSQL(&schema.Config{
+		Adapter: "sqlite",
+		IDType:  "string",
+		Plugins: []string{"emailpassword"},
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to generate schema: %w", err)
+	}
+	for _, stmt := range schema.SplitStatements(script, "sqlite") {
+		if err := db.Exec(ctx, stmt); err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf("failed to apply schema: %w", err)
+		}
+	}
+
+	return db, nil
+}
+
+// quickstartSecret returns the configured secret, or loads the development
+// secret from the secret file, generating it on first use
+func quickstartSecret(cfg *QuickstartConfig) (string, error) {
+	if cfg.Secret != "" {
+		return cfg.Secret, nil
+	}
+	if cfg.InMemory {
+		return randomSecret()
+	}
+
+	path := cfg.SecretFile
+	if path == "" {
+		path = DefaultQuickstartSecretFile
+	}
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if secret := strings.TrimSpace(string(data)); secret != "" {
+			return secret, nil
+		}
+		return "", fmt.Errorf("secret file %s is empty", path)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+
+	secret, err := randomSecret()
+	if err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", fmt.Errorf("failed to create secret file: %w", err)
+	}
+	if _, err := f.WriteString(secret + "\n"); err != nil {
+		_ = f.Close()
+		return "", fmt.Errorf("failed to write secret file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("failed to write secret file: %w", err)
+	}
+	return secret, nil
+}
+
+func randomSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
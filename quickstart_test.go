@@ -0,0 +1,106 @@
+package beaconauth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	beaconauth "github.com/marshallshelly/beacon-auth"
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+func TestQuickstart(t *testing.T) {
+	app := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := core.GetUser(r.Context())
+		if user == nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(user.Email))
+	})
+
+	handler, auth, err := beaconauth.Quickstart(&beaconauth.QuickstartConfig{
+		InMemory: true,
+		App:      app,
+		Options:  []beaconauth.Option{beaconauth.WithLogger(&SilentLogger{})},
+	})
+	if err != nil {
+		t.Fatalf("Quickstart() error = %v", err)
+	}
+	defer auth.Close()
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	creds := `{"email":"dev@example.com","password":"correct-horse-battery"}`
+	if rec := post("/auth/register", creds); rec.Code >= 300 {
+		t.Fatalf("register: status %d: %s", rec.Code, rec.Body)
+	}
+	rec := post("/auth/login", creds)
+	if rec.Code >= 300 {
+		t.Fatalf("login: status %d: %s", rec.Code, rec.Body)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+	for _, c := range rec.Result().Cookies() {
+		if c.Secure {
+			t.Errorf("cookie %s is Secure on an http base URL", c.Name)
+		}
+		req.AddCookie(c)
+	}
+	appRec := httptest.NewRecorder()
+	handler.ServeHTTP(appRec, req)
+	if appRec.Code != http.StatusOK || appRec.Body.String() != "dev@example.com" {
+		t.Fatalf("app: status %d body %q, want signed-in user", appRec.Code, appRec.Body)
+	}
+
+	limited := false
+	for i := 0; i < 20 && !limited; i++ {
+		limited = post("/auth/login", `{"email":"dev@example.com","password":"wrong"}`).Code == http.StatusTooManyRequests
+	}
+	if !limited {
+		t.Error("expected sign-in attempts to be rate limited")
+	}
+}
+
+func TestQuickstart_PersistsSecret(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &beaconauth.QuickstartConfig{
+		DatabasePath: filepath.Join(dir, "auth.db"),
+		SecretFile:   filepath.Join(dir, "secret"),
+		Options:      []beaconauth.Option{beaconauth.WithLogger(&SilentLogger{})},
+	}
+
+	_, auth, err := beaconauth.Quickstart(cfg)
+	if err != nil {
+		t.Fatalf("Quickstart() error = %v", err)
+	}
+	first := auth.Context().Config.Secret
+	_ = auth.Close()
+
+	info, err := os.Stat(cfg.SecretFile)
+	if err != nil {
+		t.Fatalf("secret file not written: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("secret file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	// A restart reuses the secret and the existing database
+	_, auth, err = beaconauth.Quickstart(cfg)
+	if err != nil {
+		t.Fatalf("second Quickstart() error = %v", err)
+	}
+	defer auth.Close()
+	if auth.Context().Config.Secret != first {
+		t.Error("expected the persisted secret to be reused")
+	}
+}
@@ -0,0 +1,419 @@
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// structInfo describes how a struct type maps to columns
+type structInfo struct {
+	fields  []fieldInfo
+	columns map[string]bool
+	extra   []int // index of the field collecting unmapped columns, nil when none
+}
+
+// fieldInfo maps one struct field to a column
+type fieldInfo struct {
+	index     []int
+	column    string
+	omitEmpty bool
+}
+
+var (
+	infoCache sync.Map // reflect.Type -> *structInfo
+
+	timeType  = reflect.TypeFor[time.Time]()
+	extraType = reflect.TypeFor[map[string]interface{}]()
+)
+
+// timeLayouts are the text forms databases return timestamps in
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+// Decode copies a record returned by an adapter into the struct pointed to
+// by dst. Columns without a matching field are stored in the field tagged
+// `db:"*"`, if any, and ignored otherwise.
+func Decode(data map[string]interface{}, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("decode target must be a non-nil struct pointer, got %T", dst)
+	}
+	v = v.Elem()
+
+	info, err := typeInfo(v.Type())
+	if err != nil {
+		return err
+	}
+
+	for _, f := range info.fields {
+		value, ok := data[f.column]
+		if !ok {
+			continue
+		}
+		if err := setValue(v.FieldByIndex(f.index), value); err != nil {
+			return fmt.Errorf("column %s: %w", f.column, err)
+		}
+	}
+
+	if info.extra != nil {
+		extra := make(map[string]interface{})
+		for column, value := range data {
+			if !info.columns[column] {
+				extra[column] = value
+			}
+		}
+		v.FieldByIndex(info.extra).Set(reflect.ValueOf(extra))
+	}
+
+	return nil
+}
+
+// Encode converts a struct, or a pointer to one, into the record passed to
+// an adapter. Fields tagged omitempty are left out when they hold their zero
+// value, and entries of the `db:"*"` field are added as extra columns.
+func Encode(src interface{}) (map[string]interface{}, error) {
+	v := reflect.ValueOf(src)
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil, errors.New("cannot encode a nil pointer")
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("encode source must be a struct, got %T", src)
+	}
+
+	info, err := typeInfo(v.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	data := make(map[string]interface{}, len(info.fields))
+	for _, f := range info.fields {
+		fv := v.FieldByIndex(f.index)
+		if f.omitEmpty && fv.IsZero() {
+			continue
+		}
+		if fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				data[f.column] = nil
+				continue
+			}
+			fv = fv.Elem()
+		}
+		data[f.column] = fv.Interface()
+	}
+
+	if info.extra != nil {
+		for column, value := range v.FieldByIndex(info.extra).Interface().(map[string]interface{}) {
+			if !info.columns[column] {
+				data[column] = value
+			}
+		}
+	}
+
+	return data, nil
+}
+
+// Columns returns the columns a struct type maps to, in field order, for
+// use in core.Query.Select
+func Columns[T any]() ([]string, error) {
+	info, err := typeInfo(reflect.TypeFor[T]())
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]string, len(info.fields))
+	for i, f := range info.fields {
+		columns[i] = f.column
+	}
+	return columns, nil
+}
+
+// typeInfo returns the column mapping of a struct type, caching it
+func typeInfo(t reflect.Type) (*structInfo, error) {
+	if cached, ok := infoCache.Load(t); ok {
+		return cached.(*structInfo), nil
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s is not a struct", t)
+	}
+
+	info := &structInfo{columns: make(map[string]bool)}
+	if err := collectFields(t, nil, info); err != nil {
+		return nil, fmt.Errorf("%s: %w", t, err)
+	}
+
+	cached, _ := infoCache.LoadOrStore(t, info)
+	return cached.(*structInfo), nil
+}
+
+// collectFields adds the fields of t to info. Untagged embedded structs are
+// flattened, as in encoding/json.
+func collectFields(t reflect.Type, index []int, info *structInfo) error {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag, tagged := f.Tag.Lookup("db")
+		if tag == "-" {
+			continue
+		}
+		fieldIndex := append(slices.Clone(index), i)
+
+		if f.Anonymous && !tagged && f.Type.Kind() == reflect.Struct {
+			if err := collectFields(f.Type, fieldIndex, info); err != nil {
+				return err
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+
+		column, opts, _ := strings.Cut(tag, ",")
+		if column == "*" {
+			if f.Type != extraType {
+				return fmt.Errorf("field %s tagged `db:\"*\"` must be a map[string]interface{}", f.Name)
+			}
+			if info.extra != nil {
+				return fmt.Errorf("more than one field tagged `db:\"*\"`")
+			}
+			info.extra = fieldIndex
+			continue
+		}
+		if column == "" {
+			column = snakeCase(f.Name)
+		}
+		if info.columns[column] {
+			return fmt.Errorf("column %s is mapped by more than one field", column)
+		}
+
+		info.columns[column] = true
+		info.fields = append(info.fields, fieldInfo{
+			index:     fieldIndex,
+			column:    column,
+			omitEmpty: opts == "omitempty",
+		})
+	}
+	return nil
+}
+
+// snakeCase converts a Go field name to the column naming used by the
+// schema, keeping initialisms together: UserID becomes user_id and
+// IPAddress becomes ip_address
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				prev := runes[i-1]
+				nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+				if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+					b.WriteByte('_')
+				}
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// setValue stores a value read from the database in dst, converting between
+// the representations drivers use for the same data: integers for booleans,
+// text for timestamps and JSON, byte slices for strings
+func setValue(dst reflect.Value, value interface{}) error {
+	if value == nil {
+		dst.SetZero()
+		return nil
+	}
+
+	src := reflect.ValueOf(value)
+	if src.Kind() == reflect.Pointer {
+		if src.IsNil() {
+			dst.SetZero()
+			return nil
+		}
+		src = src.Elem()
+	}
+
+	if dst.Kind() == reflect.Pointer {
+		elem := reflect.New(dst.Type().Elem())
+		if err := setValue(elem.Elem(), src.Interface()); err != nil {
+			return err
+		}
+		dst.Set(elem)
+		return nil
+	}
+
+	if src.Type().AssignableTo(dst.Type()) {
+		dst.Set(src)
+		return nil
+	}
+
+	text, isText := textValue(src)
+
+	switch {
+	case dst.Type() == timeType:
+		if isText {
+			for _, layout := range timeLayouts {
+				if t, err := time.Parse(layout, text); err == nil {
+					dst.Set(reflect.ValueOf(t))
+					return nil
+				}
+			}
+		}
+
+	case dst.Kind() == reflect.String:
+		switch {
+		case isText:
+			dst.SetString(text)
+			return nil
+		case src.CanInt():
+			dst.SetString(strconv.FormatInt(src.Int(), 10))
+			return nil
+		case src.CanUint():
+			dst.SetString(strconv.FormatUint(src.Uint(), 10))
+			return nil
+		}
+
+	case dst.Kind() == reflect.Bool:
+		switch {
+		case src.CanInt():
+			dst.SetBool(src.Int() != 0)
+			return nil
+		case src.CanUint():
+			dst.SetBool(src.Uint() != 0)
+			return nil
+		case isText:
+			if b, err := strconv.ParseBool(text); err == nil {
+				dst.SetBool(b)
+				return nil
+			}
+		}
+
+	case dst.CanInt():
+		var n int64
+		var ok bool
+		switch {
+		case src.CanInt():
+			n, ok = src.Int(), true
+		case src.CanUint():
+			n, ok = int64(src.Uint()), src.Uint() <= 1<<63-1
+		case src.CanFloat():
+			n = int64(src.Float())
+			ok = float64(n) == src.Float()
+		case isText:
+			parsed, err := strconv.ParseInt(text, 10, 64)
+			n, ok = parsed, err == nil
+		}
+		if ok && !dst.OverflowInt(n) {
+			dst.SetInt(n)
+			return nil
+		}
+
+	case dst.CanUint():
+		var n uint64
+		var ok bool
+		switch {
+		case src.CanInt():
+			n, ok = uint64(src.Int()), src.Int() >= 0
+		case src.CanUint():
+			n, ok = src.Uint(), true
+		case src.CanFloat():
+			n = uint64(src.Float())
+			ok = src.Float() >= 0 && float64(n) == src.Float()
+		case isText:
+			parsed, err := strconv.ParseUint(text, 10, 64)
+			n, ok = parsed, err == nil
+		}
+		if ok && !dst.OverflowUint(n) {
+			dst.SetUint(n)
+			return nil
+		}
+
+	case dst.CanFloat():
+		switch {
+		case src.CanInt():
+			dst.SetFloat(float64(src.Int()))
+			return nil
+		case src.CanUint():
+			dst.SetFloat(float64(src.Uint()))
+			return nil
+		case src.CanFloat():
+			dst.SetFloat(src.Float())
+			return nil
+		case isText:
+			if f, err := strconv.ParseFloat(text, 64); err == nil {
+				dst.SetFloat(f)
+				return nil
+			}
+		}
+
+	case dst.Type() == reflect.TypeFor[[]byte]():
+		if isText {
+			dst.SetBytes([]byte(text))
+			return nil
+		}
+
+	case dst.Kind() == reflect.Map, dst.Kind() == reflect.Slice, dst.Kind() == reflect.Struct:
+		// Adapters without native JSON support store these as JSON text
+		if isText {
+			target := reflect.New(dst.Type())
+			if err := json.Unmarshal([]byte(text), target.Interface()); err != nil {
+				return err
+			}
+			dst.Set(target.Elem())
+			return nil
+		}
+		if src.Kind() == dst.Kind() {
+			return convertJSON(dst, src)
+		}
+	}
+
+	if src.Kind() == dst.Kind() && src.Type().ConvertibleTo(dst.Type()) {
+		dst.Set(src.Convert(dst.Type()))
+		return nil
+	}
+
+	return fmt.Errorf("cannot convert %s to %s", src.Type(), dst.Type())
+}
+
+// textValue returns the text of a string or byte slice value
+func textValue(v reflect.Value) (string, bool) {
+	switch {
+	case v.Kind() == reflect.String:
+		return v.String(), true
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		return string(v.Bytes()), true
+	default:
+		return "", false
+	}
+}
+
+// convertJSON converts between composite types of the same shape, such as
+// a document decoded into map[string]interface{} and a struct, through JSON
+func convertJSON(dst, src reflect.Value) error {
+	data, err := json.Marshal(src.Interface())
+	if err != nil {
+		return err
+	}
+	target := reflect.New(dst.Type())
+	if err := json.Unmarshal(data, target.Interface()); err != nil {
+		return err
+	}
+	dst.Set(target.Elem())
+	return nil
+}
@@ -0,0 +1,159 @@
+package repo
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+type timestamps struct {
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type profile struct {
+	timestamps
+	ID       string                 `db:"id"`
+	UserID   string                 // user_id
+	Nickname string                 `db:"nickname,omitempty"`
+	Age      int                    `db:"age"`
+	Score    float64                `db:"score"`
+	Active   bool                   `db:"active"`
+	Tags     []string               `db:"tags"`
+	Deleted  *time.Time             `db:"deleted_at"`
+	Secret   string                 `db:"-"`
+	Extra    map[string]interface{} `db:"*"`
+}
+
+func TestDecode(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	data := map[string]interface{}{
+		"id":         int64(7),
+		"user_id":    []byte("u1"),
+		"nickname":   "neo",
+		"age":        int64(30),
+		"score":      "4.5",
+		"active":     int64(1),
+		"tags":       `["a","b"]`,
+		"deleted_at": "2026-01-02 03:04:05",
+		"created_at": now,
+		"updated_at": &now,
+		"plan":       "pro",
+	}
+
+	var p profile
+	if err := Decode(data, &p); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	want := profile{
+		timestamps: timestamps{CreatedAt: now, UpdatedAt: now},
+		ID:         "7",
+		UserID:     "u1",
+		Nickname:   "neo",
+		Age:        30,
+		Score:      4.5,
+		Active:     true,
+		Tags:       []string{"a", "b"},
+		Deleted:    &now,
+		Extra:      map[string]interface{}{"plan": "pro"},
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("Decode() =\n%+v\nwant\n%+v", p, want)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	var p profile
+	if err := Decode(map[string]interface{}{"age": "old"}, &p); err == nil {
+		t.Error("Decode() expected error for non-numeric age")
+	}
+	if err := Decode(map[string]interface{}{"age": int64(1 << 40)}, &struct {
+		Age int8 `db:"age"`
+	}{}); err == nil {
+		t.Error("Decode() expected overflow error")
+	}
+	if err := Decode(nil, p); err == nil {
+		t.Error("Decode() expected error for non-pointer target")
+	}
+	if err := Decode(nil, &struct {
+		A string `db:"x"`
+		B string `db:"x"`
+	}{}); err == nil {
+		t.Error("Decode() expected error for duplicate column")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	p := &profile{
+		ID:     "p1",
+		UserID: "u1",
+		Age:    30,
+		Secret: "hidden",
+		Extra:  map[string]interface{}{"plan": "pro", "id": "ignored"},
+	}
+
+	data, err := Encode(p)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	if _, ok := data["nickname"]; ok {
+		t.Error("Encode() kept an empty omitempty field")
+	}
+	if _, ok := data["secret"]; ok {
+		t.Error("Encode() wrote a field tagged db:\"-\"")
+	}
+	if v, ok := data["deleted_at"]; !ok || v != nil {
+		t.Errorf("Encode() deleted_at = %v, %v, want nil", v, ok)
+	}
+	if data["id"] != "p1" || data["user_id"] != "u1" || data["age"] != 30 || data["plan"] != "pro" {
+		t.Errorf("Encode() = %v", data)
+	}
+	if _, ok := data["created_at"].(time.Time); !ok {
+		t.Errorf("Encode() did not flatten the embedded struct: %v", data)
+	}
+}
+
+func TestCoreTypes(t *testing.T) {
+	columns, err := Columns[core.Account]()
+	if err != nil {
+		t.Fatalf("Columns() error = %v", err)
+	}
+	if !reflect.DeepEqual(columns[:4], []string{"id", "user_id", "account_id", "provider_id"}) {
+		t.Errorf("Columns() = %v", columns)
+	}
+
+	var user core.User
+	err = Decode(map[string]interface{}{
+		"id":             "u1",
+		"email":          "a@example.com",
+		"email_verified": int64(1),
+		"ban_expires":    nil,
+		"locale":         "en",
+	}, &user)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if user.ID != "u1" || !user.EmailVerified || user.BanExpires != nil || user.Metadata["locale"] != "en" {
+		t.Errorf("Decode() = %+v", user)
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	tests := map[string]string{
+		"ID":                   "id",
+		"UserID":               "user_id",
+		"IPAddress":            "ip_address",
+		"IDToken":              "id_token",
+		"AccessTokenExpiresAt": "access_token_expires_at",
+		"Totp2FA":              "totp2_fa",
+	}
+	for name, want := range tests {
+		if got := snakeCase(name); got != want {
+			t.Errorf("snakeCase(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Package repo reads and writes records as Go structs on top of
+// core.Adapter, so application code and plugins work with typed values
+// instead of map[string]interface{}:
+//
+//	user, err := repo.FindOne[core.User](ctx, adapter, &core.Query{
+//		Model: core.ModelUsers,
+//		Where: []core.WhereClause{{Field: "email", Operator: core.OpEqual, Value: email}},
+//	})
+//
+// Fields map to columns through the db struct tag:
+//
+//	ID        string                 `db:"id"`
+//	Nickname  string                 `db:"nickname,omitempty"` // left out of writes when empty
+//	Internal  string                 `db:"-"`                  // never read or written
+//	Extra     map[string]interface{} `db:"*"`                  // columns without a field
+//
+// Untagged exported fields use the snake_case of their name (UserID is
+// user_id), and untagged embedded structs are flattened. Values are
+// converted between the forms drivers return them in, e.g. integers into
+// bool fields and timestamp text into time.Time. Adapters stay generic.
+package repo
+
+import (
+	"context"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// FindOne returns the first record matching query, or nil when there is
+// none
+func FindOne[T any](ctx context.Context, adapter core.Adapter, query *core.Query) (*T, error) {
+	data, err := adapter.FindOne(ctx, query)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return decode[T](data)
+}
+
+// FindMany returns every record matching query
+func FindMany[T any](ctx context.Context, adapter core.Adapter, query *core.Query) ([]*T, error) {
+	records, err := adapter.FindMany(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*T, 0, len(records))
+	for _, data := range records {
+		record, err := decode[T](data)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, record)
+	}
+	return results, nil
+}
+
+// Create stores record in model and returns the record as stored
+func Create[T any](ctx context.Context, adapter core.Adapter, model string, record *T) (*T, error) {
+	data, err := Encode(record)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := adapter.Create(ctx, model, data)
+	if err != nil || created == nil {
+		return nil, err
+	}
+	return decode[T](created)
+}
+
+// Update applies data to the first record matching query and returns the
+// updated record. Partial updates take a map, since a struct cannot tell
+// unset fields from zero values.
+func Update[T any](ctx context.Context, adapter core.Adapter, query *core.Query, data map[string]interface{}) (*T, error) {
+	updated, err := adapter.Update(ctx, query, data)
+	if err != nil || updated == nil {
+		return nil, err
+	}
+	return decode[T](updated)
+}
+
+// Upsert inserts record, or overwrites the record whose conflictFields
+// match it, and returns the stored record (see core.Adapter.Upsert)
+func Upsert[T any](ctx context.Context, adapter core.Adapter, model string, conflictFields []string, record *T) (*T, error) {
+	data, err := Encode(record)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := adapter.Upsert(ctx, model, conflictFields, data)
+	if err != nil || stored == nil {
+		return nil, err
+	}
+	return decode[T](stored)
+}
+
+func decode[T any](data map[string]interface{}) (*T, error) {
+	record := new(T)
+	if err := Decode(data, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
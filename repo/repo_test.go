@@ -0,0 +1,77 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/adapters/memory"
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+func TestRepo(t *testing.T) {
+	ctx := context.Background()
+	db := memory.New()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	created, err := Create(ctx, db, core.ModelUsers, &core.User{
+		ID:        "u1",
+		Email:     "a@example.com",
+		CreatedAt: now,
+		UpdatedAt: now,
+		Metadata:  map[string]interface{}{"locale": "en"},
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if created.ID != "u1" || created.Metadata["locale"] != "en" {
+		t.Errorf("Create() = %+v", created)
+	}
+
+	byEmail := &core.Query{
+		Model: core.ModelUsers,
+		Where: []core.WhereClause{{Field: "email", Operator: core.OpEqual, Value: "a@example.com"}},
+	}
+	user, err := FindOne[core.User](ctx, db, byEmail)
+	if err != nil {
+		t.Fatalf("FindOne() error = %v", err)
+	}
+	if user == nil || user.ID != "u1" || !user.CreatedAt.Equal(now) {
+		t.Errorf("FindOne() = %+v", user)
+	}
+
+	updated, err := Update[core.User](ctx, db, byEmail, map[string]interface{}{"name": "Alice"})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if updated.Name != "Alice" {
+		t.Errorf("Update() name = %q, want Alice", updated.Name)
+	}
+
+	upserted, err := Upsert(ctx, db, core.ModelUsers, []string{"id"}, &core.User{ID: "u2", Email: "b@example.com"})
+	if err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+	if upserted.Email != "b@example.com" {
+		t.Errorf("Upsert() = %+v", upserted)
+	}
+
+	users, err := FindMany[core.User](ctx, db, &core.Query{
+		Model:   core.ModelUsers,
+		OrderBy: []core.OrderBy{{Field: "id"}},
+	})
+	if err != nil {
+		t.Fatalf("FindMany() error = %v", err)
+	}
+	if len(users) != 2 || users[0].ID != "u1" || users[1].ID != "u2" {
+		t.Errorf("FindMany() = %+v", users)
+	}
+
+	missing, err := FindOne[core.User](ctx, db, &core.Query{
+		Model: core.ModelUsers,
+		Where: []core.WhereClause{{Field: "id", Operator: core.OpEqual, Value: "none"}},
+	})
+	if err != nil || missing != nil {
+		t.Errorf("FindOne() missing = %+v, %v, want nil", missing, err)
+	}
+}
@@ -0,0 +1,7 @@
+package router
+
+import "github.com/marshallshelly/beacon-auth/cors"
+
+// CORSConfig lets browser applications on other origins call the
+// endpoints. See cors.Config.
+type CORSConfig = cors.Config
@@ -0,0 +1,287 @@
+// Package router serves the endpoints of auth.Handler and of initialized
+// plugins from a single http.Handler. It matches methods (answering 405
+// with an Allow header), mounts every route under a base path, answers
+// CORS requests and runs the Before and After hooks around every route, so
+// applications and framework integrations do not register routes one by
+// one.
+//
+//	h, err := router.New(router.Config{
+//		BasePath: "/api/auth",
+//		Handler:  authHandler,
+//		Sessions: sessionManager,
+//		Plugins:  plugins, // initialized with authCtx
+//		Context:  authCtx,
+//	})
+//	mux.Handle("/api/auth/", h)
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/marshallshelly/beacon-auth/auth"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/cors"
+	"github.com/marshallshelly/beacon-auth/plugin"
+	"github.com/marshallshelly/beacon-auth/session"
+)
+
+// DefaultBasePath is the base path used when Config.BasePath is empty
+const DefaultBasePath = "/auth"
+
+// Config configures a Router
+type Config struct {
+	// BasePath prefixes every route (default "/auth"). auth.Handler
+	// endpoints keep their path below /auth, so with "/api/auth" sign-in
+	// is served at /api/auth/signin. Plugin paths are appended as is.
+	BasePath string
+
+	// Handler serves the core endpoints (nil = none)
+	Handler *auth.Handler
+
+	// Sessions loads the session of requests to the Handler endpoints. It
+	// defaults to the session manager of Context.
+	Sessions *session.Manager
+
+	// Plugins serves the endpoints and runs the hooks of plugins
+	// initialized with Context (nil = none)
+	Plugins *plugin.Manager
+
+	// Context enforces the endpoint policies (authentication and rate-limit
+	// classes) and provides the application's Before hooks. Required with
+	// Plugins.
+	Context *core.AuthContext
+
+	// CORS answers cross-origin requests (nil = same-origin only)
+	CORS *CORSConfig
+}
+
+// Router serves auth and plugin endpoints
+type Router struct {
+	basePath string
+	cors     *cors.Policy
+	proxies  core.TrustedProxies
+
+	// routes maps paths, relative to the base path, to handlers by method
+	routes map[string]map[string]http.Handler
+}
+
+// New builds a router. Two endpoints with the same method and path are an
+// error.
+func New(cfg Config) (*Router, error) {
+	if cfg.Plugins != nil && cfg.Context == nil {
+		return nil, errors.New("router: Context is required to serve plugins")
+	}
+	if cfg.Context != nil && cfg.Context.Config == nil {
+		return nil, errors.New("router: Context has no Config")
+	}
+	if cfg.Handler != nil && cfg.Sessions == nil && (cfg.Context == nil || cfg.Context.SessionManager == nil) {
+		return nil, errors.New("router: Sessions or Context is required to serve the auth handler")
+	}
+
+	rt := &Router{
+		basePath: normalizeBasePath(cfg.BasePath),
+		routes:   make(map[string]map[string]http.Handler),
+	}
+	if cfg.CORS != nil {
+		policy, err := cors.New(*cfg.CORS)
+		if err != nil {
+			return nil, fmt.Errorf("router: %w", err)
+		}
+		rt.cors = policy
+	}
+
+	ctx := cfg.Context
+	if ctx == nil {
+		ctx = &core.AuthContext{}
+		if cfg.Sessions != nil {
+			// Endpoint policies read the cookie name from the config
+			ctx.Config = &core.Config{Session: &core.SessionConfig{CookieName: cfg.Sessions.Config().CookieName}}
+			ctx.SessionManager = cfg.Sessions
+		}
+	}
+
+	// Forwarding headers are believed from the proxies the sessions trust
+	sessions := cfg.Sessions
+	if sessions == nil {
+		sessions, _ = ctx.SessionManager.(*session.Manager)
+	}
+	if sessions != nil {
+		rt.proxies = sessions.TrustedProxies()
+	}
+
+	// The application's Before hooks run ahead of plugin hooks of the same
+	// priority, as in core.New
+	hooks := &core.HookConfig{}
+	if ctx.Config != nil {
+		hooks.Before = append(hooks.Before, ctx.Config.BeforeHooks...)
+	}
+	if cfg.Plugins != nil {
+		registered := cfg.Plugins.GetHooks().Config()
+		hooks.Before = append(hooks.Before, registered.Before...)
+		hooks.After = append(hooks.After, registered.After...)
+	}
+	core.SortHooks(hooks.Before)
+	core.SortHooks(hooks.After)
+
+	if cfg.Handler != nil {
+		loadSession := sessionLoader(ctx, cfg.Sessions)
+		for _, endpoint := range cfg.Handler.Endpoints() {
+			path := strings.TrimPrefix(endpoint.Path, DefaultBasePath)
+			err := rt.add(ctx, path, core.Endpoint{
+				Method:     endpoint.Method,
+				Handler:    endpoint.Handler,
+				Middleware: []func(http.Handler) http.Handler{loadSession},
+			}, hooks)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if cfg.Plugins != nil {
+		endpoints := cfg.Plugins.GetEndpoints()
+		paths := make([]string, 0, len(endpoints))
+		for path := range endpoints {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			if err := rt.add(ctx, path, endpoints[path], hooks); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return rt, nil
+}
+
+func (rt *Router) add(ctx *core.AuthContext, path string, endpoint core.Endpoint, hooks *core.HookConfig) error {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	method := endpoint.Method
+	if method == "" {
+		method = http.MethodGet
+		endpoint.Method = method
+	}
+
+	methods, ok := rt.routes[path]
+	if !ok {
+		methods = make(map[string]http.Handler)
+		rt.routes[path] = methods
+	}
+	if _, exists := methods[method]; exists {
+		return fmt.Errorf("router: endpoint conflict: %s %s already registered", method, rt.basePath+path)
+	}
+	methods[method] = core.EndpointHandler(ctx, path, endpoint, hooks)
+	return nil
+}
+
+// ServeHTTP serves the route of the request. Paths outside the base path,
+// or without a route, get 404; unsupported methods get 405 with an Allow
+// header.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r = r.WithContext(core.ContextWithTrustedProxies(r.Context(), rt.proxies))
+	path, ok := strings.CutPrefix(r.URL.Path, rt.basePath)
+	if !ok || (path != "" && !strings.HasPrefix(path, "/")) {
+		http.NotFound(w, r)
+		return
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	methods, ok := rt.routes[path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	allowed := allowedMethods(methods)
+
+	if rt.cors != nil && rt.cors.Write(w, r) {
+		return
+	}
+
+	handler, ok := methods[r.Method]
+	if !ok {
+		w.Header().Set("Allow", strings.Join(append(allowed, http.MethodOptions), ", "))
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
+
+// Routes returns the served routes as "METHOD /path", including the base
+// path, sorted by path
+func (rt *Router) Routes() []string {
+	paths := make([]string, 0, len(rt.routes))
+	for path := range rt.routes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var routes []string
+	for _, path := range paths {
+		for _, method := range allowedMethods(rt.routes[path]) {
+			routes = append(routes, method+" "+rt.basePath+path)
+		}
+	}
+	return routes
+}
+
+// allowedMethods returns the methods of a route, sorted
+func allowedMethods(methods map[string]http.Handler) []string {
+	allowed := make([]string, 0, len(methods))
+	for method := range methods {
+		allowed = append(allowed, method)
+	}
+	sort.Strings(allowed)
+	return allowed
+}
+
+// sessionLoader puts the session and user of the request in its context,
+// as auth.Handler expects
+func sessionLoader(ctx *core.AuthContext, sessions *session.Manager) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var s *core.Session
+			var user *core.User
+			if sessions != nil {
+				if token, err := core.ReadChunkedCookie(r, sessions.Config().CookieName); err == nil {
+					s, user, _ = sessions.Get(core.WithClientInfo(r.Context(), core.ClientInfoFromRequest(r)), token)
+				}
+			} else {
+				s, user = ctx.RequestSession(r)
+			}
+			if s == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			c := core.WithSession(r.Context(), s)
+			if user != nil {
+				c = core.WithUser(c, user)
+			}
+			next.ServeHTTP(w, r.WithContext(c))
+		})
+	}
+}
+
+// normalizeBasePath adds a leading and removes a trailing slash
+func normalizeBasePath(basePath string) string {
+	if basePath == "" {
+		basePath = DefaultBasePath
+	}
+	if !strings.HasPrefix(basePath, "/") {
+		basePath = "/" + basePath
+	}
+	return strings.TrimRight(basePath, "/")
+}
@@ -0,0 +1,196 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/adapters/memory"
+	"github.com/marshallshelly/beacon-auth/auth"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/plugin"
+	"github.com/marshallshelly/beacon-auth/session"
+)
+
+// notesPlugin serves a public and an authenticated endpoint and records
+// the hooks run around them
+type notesPlugin struct {
+	*plugin.BasePlugin
+	calls []string
+}
+
+func (p *notesPlugin) Endpoints() map[string]plugin.Endpoint {
+	return map[string]plugin.Endpoint{
+		"/notes": {Method: http.MethodGet, Auth: core.AuthSession, Handler: func(w http.ResponseWriter, r *http.Request) {
+			p.calls = append(p.calls, "handler")
+			w.WriteHeader(http.StatusOK)
+		}},
+		"/ping": {Method: http.MethodGet, Handler: func(w http.ResponseWriter, r *http.Request) {
+			p.calls = append(p.calls, "handler")
+			w.WriteHeader(http.StatusTeapot)
+		}},
+	}
+}
+
+func (p *notesPlugin) Hooks() *plugin.HookConfig {
+	return &plugin.HookConfig{
+		Before: []plugin.Hook{{Handler: func(ctx context.Context, data interface{}) error {
+			p.calls = append(p.calls, "before "+data.(*core.HookRequest).Path)
+			return nil
+		}}},
+		After: []plugin.Hook{{Handler: func(ctx context.Context, data interface{}) error {
+			p.calls = append(p.calls, "after "+http.StatusText(data.(*core.HookResult).Status))
+			return nil
+		}}},
+	}
+}
+
+func newTestRouter(t *testing.T, cors *CORSConfig) (*Router, *notesPlugin) {
+	t.Helper()
+	db := memory.New()
+	sessions, err := session.NewManager(&session.Config{
+		CookieName:    "test_session",
+		CookiePath:    "/",
+		ExpiresIn:     time.Hour,
+		EnableDBStore: true,
+		Secret:        "test-secret-key-at-least-32-bytes-long",
+	}, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := core.NewAuthContext(&core.Config{
+		Session:  &core.SessionConfig{CookieName: "test_session"},
+		Advanced: &core.AdvancedConfig{},
+	})
+	ctx.SessionManager = sessions
+
+	notes := &notesPlugin{BasePlugin: plugin.NewBasePlugin("notes")}
+	plugins := plugin.NewManager([]plugin.Plugin{notes})
+	if err := plugins.Initialize(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	rt, err := New(Config{
+		BasePath: "/api/auth/",
+		Handler:  auth.NewHandler(db, sessions, nil),
+		Sessions: sessions,
+		Plugins:  plugins,
+		Context:  ctx,
+		CORS:     cors,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rt, notes
+}
+
+func serve(rt http.Handler, method, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, req)
+	return w
+}
+
+func TestRouter_Routes(t *testing.T) {
+	rt, _ := newTestRouter(t, nil)
+	want := []string{
+		"GET /api/auth/client-config",
+		"GET /api/auth/notes",
+		"GET /api/auth/ping",
+		"GET /api/auth/session",
+		"POST /api/auth/signin",
+		"POST /api/auth/signout",
+		"POST /api/auth/signup",
+	}
+	if got := strings.Join(rt.Routes(), ","); got != strings.Join(want, ",") {
+		t.Errorf("Expected routes %v, got %v", want, rt.Routes())
+	}
+}
+
+func TestRouter_MethodAndPathMatching(t *testing.T) {
+	rt, _ := newTestRouter(t, nil)
+
+	w := serve(rt, http.MethodGet, "/api/auth/signin", nil)
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "POST, OPTIONS" {
+		t.Errorf("Expected 405 allowing POST, got %d %q", w.Code, w.Header().Get("Allow"))
+	}
+	if w := serve(rt, http.MethodGet, "/api/auth/missing", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown route, got %d", w.Code)
+	}
+	if w := serve(rt, http.MethodGet, "/auth/session", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 outside the base path, got %d", w.Code)
+	}
+	if w := serve(rt, http.MethodGet, "/api/authsession", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a path sharing the base path's prefix, got %d", w.Code)
+	}
+	if w := serve(rt, http.MethodGet, "/api/auth/session", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the core session endpoint to answer 401 without a session, got %d", w.Code)
+	}
+}
+
+func TestRouter_PluginPoliciesAndHooks(t *testing.T) {
+	rt, notes := newTestRouter(t, nil)
+
+	if w := serve(rt, http.MethodGet, "/api/auth/notes", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for an authenticated endpoint, got %d", w.Code)
+	}
+	if len(notes.calls) != 0 {
+		t.Errorf("Expected no hooks for a rejected request, got %v", notes.calls)
+	}
+
+	if w := serve(rt, http.MethodGet, "/api/auth/ping", nil); w.Code != http.StatusTeapot {
+		t.Fatalf("Expected the plugin's response, got %d", w.Code)
+	}
+	want := "before /ping,handler,after I'm a teapot"
+	if got := strings.Join(notes.calls, ","); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestRouter_CORS(t *testing.T) {
+	rt, _ := newTestRouter(t, &CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowCredentials: true,
+		AllowedMethods:   []string{http.MethodGet, http.MethodPost},
+	})
+
+	preflight := http.Header{
+		"Origin":                        {"https://app.example.com"},
+		"Access-Control-Request-Method": {"POST"},
+	}
+	w := serve(rt, http.MethodOptions, "/api/auth/signin", preflight)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 for a preflight request, got %d", w.Code)
+	}
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		w.Header().Get("Access-Control-Allow-Credentials") != "true" ||
+		w.Header().Get("Access-Control-Allow-Methods") != "GET, POST" {
+		t.Errorf("Unexpected preflight headers %v", w.Header())
+	}
+
+	w = serve(rt, http.MethodGet, "/api/auth/ping", http.Header{"Origin": {"https://evil.example.com"}})
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("Expected no CORS headers for a disallowed origin")
+	}
+
+	_, err := New(Config{CORS: &CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}})
+	if err == nil {
+		t.Error("Expected credentials with any origin to be rejected")
+	}
+}
+
+func TestNew_Validation(t *testing.T) {
+	if _, err := New(Config{Plugins: plugin.NewManager(nil)}); err == nil {
+		t.Error("Expected plugins without a context to be rejected")
+	}
+	if _, err := New(Config{Handler: &auth.Handler{}}); err == nil {
+		t.Error("Expected the auth handler without sessions to be rejected")
+	}
+}
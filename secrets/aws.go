@@ -0,0 +1,222 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AWSCredentials sign requests to AWS
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// SessionToken is set for temporary credentials
+	SessionToken string
+}
+
+// AWSOptions configures an AWSProvider
+type AWSOptions struct {
+	// Region of the secrets (default $AWS_REGION, then
+	// $AWS_DEFAULT_REGION)
+	Region string
+
+	// Credentials returns the credentials of each request. The default
+	// reads $AWS_ACCESS_KEY_ID, $AWS_SECRET_ACCESS_KEY and
+	// $AWS_SESSION_TOKEN. Adapt an AWS SDK credentials provider here to
+	// use instance or workload roles.
+	Credentials func(ctx context.Context) (AWSCredentials, error)
+
+	// VersionStage selects the version (default "AWSCURRENT")
+	VersionStage string
+
+	// Endpoint replaces the regional endpoint, e.g. for a VPC endpoint
+	Endpoint string
+
+	// Client replaces the default HTTP client
+	Client *http.Client
+
+	// Timeout bounds each request (default 10s). Ignored when Client is
+	// set.
+	Timeout time.Duration
+
+	// AllowInsecure permits an http:// Endpoint, e.g. a local emulator
+	AllowInsecure bool
+}
+
+// AWSProvider reads secrets from AWS Secrets Manager. The name
+// "prod/beacon#session_keys" is the key session_keys of the JSON secret
+// prod/beacon; without a key, it is the whole secret string. Names may
+// also be secret ARNs.
+type AWSProvider struct {
+	region       string
+	endpoint     string
+	versionStage string
+	credentials  func(ctx context.Context) (AWSCredentials, error)
+	client       *http.Client
+	now          func() time.Time
+}
+
+// NewAWS creates an AWS Secrets Manager provider
+func NewAWS(opts *AWSOptions) (*AWSProvider, error) {
+	if opts == nil {
+		opts = &AWSOptions{}
+	}
+	p := &AWSProvider{
+		region:       firstNonEmpty(opts.Region, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION")),
+		endpoint:     strings.TrimRight(opts.Endpoint, "/"),
+		versionStage: firstNonEmpty(opts.VersionStage, "AWSCURRENT"),
+		credentials:  opts.Credentials,
+		client:       httpClient(opts.Client, nil, opts.Timeout),
+		now:          time.Now,
+	}
+	if p.region == "" {
+		return nil, errors.New("AWS region is required (set AWSOptions.Region or AWS_REGION)")
+	}
+	if p.endpoint == "" {
+		p.endpoint = "https://secretsmanager." + p.region + ".amazonaws.com"
+	}
+	if err := checkEndpoint("AWS Secrets Manager", p.endpoint, opts.AllowInsecure); err != nil {
+		return nil, err
+	}
+	if p.credentials == nil {
+		p.credentials = envAWSCredentials
+	}
+	return p, nil
+}
+
+func envAWSCredentials(ctx context.Context) (AWSCredentials, error) {
+	creds := AWSCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return AWSCredentials{}, errors.New("AWS credentials are required (set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, or AWSOptions.Credentials)")
+	}
+	return creds, nil
+}
+
+// GetSecret reads the current version of a secret
+func (p *AWSProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	secretID, field := splitName(name)
+	if secretID == "" {
+		return "", fmt.Errorf("invalid AWS secret name: %q", name)
+	}
+	creds, err := p.credentials(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	body, err := json.Marshal(map[string]string{"SecretId": secretID, "VersionStage": p.versionStage})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signAWSRequest(req, body, creds, p.region, "secretsmanager", p.now())
+
+	var resp struct {
+		SecretString *string `json:"SecretString"`
+		SecretBinary []byte  `json:"SecretBinary"`
+	}
+	if err := do(p.client, req, &resp, awsNotFound); err != nil {
+		return "", fmt.Errorf("aws secret %s: %w", secretID, err)
+	}
+	value := string(resp.SecretBinary)
+	if resp.SecretString != nil {
+		value = *resp.SecretString
+	}
+	if value, err = jsonField(value, field); err != nil {
+		return "", fmt.Errorf("aws secret %s: %w", secretID, err)
+	}
+	return value, nil
+}
+
+// awsNotFound reports whether a response is ResourceNotFoundException
+func awsNotFound(status int, body []byte) bool {
+	var resp struct {
+		Type string `json:"__type"`
+	}
+	return status == http.StatusBadRequest && json.Unmarshal(body, &resp) == nil &&
+		strings.HasSuffix(resp.Type, "ResourceNotFoundException")
+}
+
+// signAWSRequest adds an AWS Signature Version 4 Authorization header
+func signAWSRequest(req *http.Request, body []byte, creds AWSCredentials, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	// Canonical headers: host and every header set on the request
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+creds.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,146 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gceTokenURL returns the access token of the default service account on
+// Google Cloud compute platforms
+const gceTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// GCPOptions configures a GCPProvider
+type GCPOptions struct {
+	// Project holding the secrets (default $GOOGLE_CLOUD_PROJECT)
+	Project string
+
+	// Token returns the OAuth access token of each request. The default
+	// asks the metadata server for the token of the default service
+	// account, as available on GCE, GKE, Cloud Run and App Engine.
+	Token func(ctx context.Context) (string, error)
+
+	// Endpoint replaces https://secretmanager.googleapis.com
+	Endpoint string
+
+	// Client replaces the default HTTP client
+	Client *http.Client
+
+	// Timeout bounds each request (default 10s). Ignored when Client is
+	// set.
+	Timeout time.Duration
+
+	// AllowInsecure permits an http:// Endpoint, e.g. a local emulator
+	AllowInsecure bool
+}
+
+// GCPProvider reads the latest version of secrets from Google Secret
+// Manager. The name "beacon-oauth#github" is the key github of the JSON
+// secret beacon-oauth; without a key, it is the whole payload.
+type GCPProvider struct {
+	project  string
+	endpoint string
+	token    func(ctx context.Context) (string, error)
+	client   *http.Client
+}
+
+// NewGCP creates a Google Secret Manager provider
+func NewGCP(opts *GCPOptions) (*GCPProvider, error) {
+	if opts == nil {
+		opts = &GCPOptions{}
+	}
+	p := &GCPProvider{
+		project:  firstNonEmpty(opts.Project, os.Getenv("GOOGLE_CLOUD_PROJECT")),
+		endpoint: strings.TrimRight(firstNonEmpty(opts.Endpoint, "https://secretmanager.googleapis.com"), "/"),
+		token:    opts.Token,
+		client:   httpClient(opts.Client, nil, opts.Timeout),
+	}
+	if p.project == "" {
+		return nil, errors.New("GCP project is required (set GCPOptions.Project or GOOGLE_CLOUD_PROJECT)")
+	}
+	if err := checkEndpoint("Secret Manager", p.endpoint, opts.AllowInsecure); err != nil {
+		return nil, err
+	}
+	if p.token == nil {
+		p.token = (&metadataToken{client: p.client}).get
+	}
+	return p, nil
+}
+
+// GetSecret reads the latest version of a secret
+func (p *GCPProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	secret, field := splitName(name)
+	if secret == "" || strings.Contains(secret, "/") {
+		return "", fmt.Errorf("invalid Secret Manager secret name: %q", name)
+	}
+	token, err := p.token(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get GCP access token: %w", err)
+	}
+
+	u := p.endpoint + "/v1/projects/" + url.PathEscape(p.project) + "/secrets/" + url.PathEscape(secret) + "/versions/latest:access"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	var resp struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := do(p.client, req, &resp, nil); err != nil {
+		return "", fmt.Errorf("gcp secret %s: %w", secret, err)
+	}
+	data, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("gcp secret %s: invalid payload: %w", secret, err)
+	}
+	value, err := jsonField(string(data), field)
+	if err != nil {
+		return "", fmt.Errorf("gcp secret %s: %w", secret, err)
+	}
+	return value, nil
+}
+
+// metadataToken caches the metadata server's access token until shortly
+// before it expires
+type metadataToken struct {
+	client *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func (m *metadataToken) get(ctx context.Context) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.token != "" && time.Now().Before(m.expires) {
+		return m.token, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gceTokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := do(m.client, req, &resp, nil); err != nil {
+		return "", err
+	}
+	m.token = resp.AccessToken
+	m.expires = time.Now().Add(time.Duration(resp.ExpiresIn)*time.Second - time.Minute)
+	return m.token, nil
+}
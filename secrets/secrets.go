@@ -0,0 +1,200 @@
+// Package secrets fetches BeaconAuth secrets, such as session keys, OAuth
+// client secrets and SMTP credentials, from HashiCorp Vault, AWS Secrets
+// Manager, Google Secret Manager or environment variables. Each provider
+// implements core.SecretProvider:
+//
+//	vault, err := secrets.NewVault(&secrets.VaultOptions{Address: "https://vault:8200"})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	provider := secrets.Chain(vault, secrets.NewEnv("")) // Environment fallback
+//	auth, err := beaconauth.New(beaconauth.WithSecretProvider(provider, "beacon/session#keys"), ...)
+//
+// A name selects a secret and, after '#', a field of it: a Vault key, or a
+// key of a JSON secret in AWS or Google Secret Manager.
+package secrets
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// DefaultTimeout bounds each request to a secret manager
+const DefaultTimeout = 10 * time.Second
+
+// maxResponseSize bounds the responses read from secret managers
+const maxResponseSize = 1 << 20
+
+// splitName splits a name into the secret and the field after '#'
+func splitName(name string) (secret, field string) {
+	secret, field, _ = strings.Cut(name, "#")
+	return secret, field
+}
+
+// jsonField returns the field of a secret holding a JSON object, or the
+// whole value when field is empty
+func jsonField(value, field string) (string, error) {
+	if field == "" {
+		return value, nil
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &object); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object, so it has no field %q", field)
+	}
+	return fieldValue(object, field)
+}
+
+// fieldValue returns a field of a secret's key/value data as a string
+func fieldValue(data map[string]interface{}, field string) (string, error) {
+	value, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("%w: no field %q", core.ErrSecretNotFound, field)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// EnvProvider reads secrets from environment variables
+type EnvProvider struct {
+	prefix string
+	lookup func(string) (string, bool)
+}
+
+// NewEnv creates a provider reading the variable named after each secret:
+// prefix followed by the name in upper case, with every character other
+// than a letter or digit replaced by '_'. "beacon/session#keys" is
+// BEACON_SESSION_KEYS without a prefix.
+func NewEnv(prefix string) *EnvProvider {
+	return &EnvProvider{prefix: prefix, lookup: os.LookupEnv}
+}
+
+// GetSecret returns the variable of name
+func (p *EnvProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	variable := p.Variable(name)
+	value, ok := p.lookup(variable)
+	if !ok {
+		return "", fmt.Errorf("%w: %s is not set", core.ErrSecretNotFound, variable)
+	}
+	return value, nil
+}
+
+// Variable returns the environment variable of name
+func (p *EnvProvider) Variable(name string) string {
+	var b strings.Builder
+	b.WriteString(p.prefix)
+	for _, c := range strings.ToUpper(name) {
+		if (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') {
+			b.WriteRune(c)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// ChainProvider tries providers in order (see Chain)
+type ChainProvider struct {
+	providers []core.SecretProvider
+}
+
+// Chain returns a provider that asks each provider in turn, moving on
+// when one does not have the secret. Other errors, such as an unreachable
+// Vault, are returned at once rather than falling back to a possibly
+// stale value.
+func Chain(providers ...core.SecretProvider) *ChainProvider {
+	return &ChainProvider{providers: providers}
+}
+
+// GetSecret returns the secret from the first provider that has it
+func (c *ChainProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	var errs []error
+	for _, p := range c.providers {
+		value, err := p.GetSecret(ctx, name)
+		if err == nil {
+			return value, nil
+		}
+		if !errors.Is(err, core.ErrSecretNotFound) {
+			return "", err
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return "", core.ErrSecretNotFound
+	}
+	return "", errors.Join(errs...)
+}
+
+// httpClient returns client, or a client with timeout and tlsConfig
+func httpClient(client *http.Client, tlsConfig *tls.Config, timeout time.Duration) *http.Client {
+	if client != nil {
+		return client
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// checkEndpoint requires an https URL, or http with allowInsecure
+func checkEndpoint(kind, endpoint string, allowInsecure bool) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid %s address: %q", kind, endpoint)
+	}
+	switch u.Scheme {
+	case "https":
+	case "http":
+		if !allowInsecure {
+			return fmt.Errorf("%s address must use https (set AllowInsecure to permit http)", kind)
+		}
+	default:
+		return fmt.Errorf("unsupported %s address scheme: %q", kind, u.Scheme)
+	}
+	return nil
+}
+
+// do sends req and decodes a 200 JSON response into v. A 404 response,
+// and any other status for which notFound returns true, wraps
+// core.ErrSecretNotFound.
+func do(client *http.Client, req *http.Request, v interface{}, notFound func(status int, body []byte) bool) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return json.Unmarshal(body, v)
+	case resp.StatusCode == http.StatusNotFound, notFound != nil && notFound(resp.StatusCode, body):
+		return core.ErrSecretNotFound
+	default:
+		// Error bodies describe the failure, never the secret
+		message := strings.TrimSpace(string(body))
+		if len(message) > 256 {
+			message = message[:256] + "..."
+		}
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, message)
+	}
+}
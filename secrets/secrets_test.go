@@ -0,0 +1,199 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+func TestEnvAndChain(t *testing.T) {
+	ctx := context.Background()
+	env := NewEnv("APP_")
+	env.lookup = func(name string) (string, bool) {
+		value, ok := map[string]string{"APP_BEACON_SESSION_KEYS": "from-env"}[name]
+		return value, ok
+	}
+	if got := env.Variable("beacon/session#keys"); got != "APP_BEACON_SESSION_KEYS" {
+		t.Errorf("Variable() = %q", got)
+	}
+	if value, err := env.GetSecret(ctx, "beacon/session#keys"); err != nil || value != "from-env" {
+		t.Errorf("GetSecret() = %q, %v", value, err)
+	}
+
+	missing := NewEnv("")
+	missing.lookup = func(string) (string, bool) { return "", false }
+	if value, err := Chain(missing, env).GetSecret(ctx, "beacon/session#keys"); err != nil || value != "from-env" {
+		t.Errorf("Chain().GetSecret() = %q, %v, want the fallback", value, err)
+	}
+	if _, err := Chain(missing).GetSecret(ctx, "other"); !errors.Is(err, core.ErrSecretNotFound) {
+		t.Errorf("Chain().GetSecret(other) error = %v, want ErrSecretNotFound", err)
+	}
+
+	// Failures other than a missing secret do not fall back
+	down := failingProvider{errors.New("connection refused")}
+	if _, err := Chain(down, env).GetSecret(ctx, "beacon/session#keys"); err == nil || errors.Is(err, core.ErrSecretNotFound) {
+		t.Errorf("Chain().GetSecret() error = %v, want the outage", err)
+	}
+}
+
+type failingProvider struct{ err error }
+
+func (p failingProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	return "", p.err
+}
+
+func TestVault(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" || r.Header.Get("X-Vault-Namespace") != "team" {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/kv/data/beacon/session":
+			_, _ = w.Write([]byte(`{"data":{"data":{"keys":"v1:c2VjcmV0","issuer":"beacon"},"metadata":{"version":3}}}`))
+		case "/v1/kv/data/beacon/smtp":
+			_, _ = w.Write([]byte(`{"data":{"data":{"password":"hunter2"}}}`))
+		default:
+			http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	if _, err := NewVault(&VaultOptions{Address: server.URL, Token: "root"}); err == nil {
+		t.Error("NewVault() accepted an http address without AllowInsecure")
+	}
+	vault, err := NewVault(&VaultOptions{Address: server.URL, Token: "root", Namespace: "team", Mount: "kv", AllowInsecure: true})
+	if err != nil {
+		t.Fatalf("NewVault() error = %v", err)
+	}
+
+	ctx := context.Background()
+	if value, err := vault.GetSecret(ctx, "beacon/session#keys"); err != nil || value != "v1:c2VjcmV0" {
+		t.Errorf("GetSecret(#keys) = %q, %v", value, err)
+	}
+	if value, err := vault.GetSecret(ctx, "beacon/smtp"); err != nil || value != "hunter2" {
+		t.Errorf("GetSecret() of a one-field secret = %q, %v", value, err)
+	}
+	if _, err := vault.GetSecret(ctx, "beacon/session"); err == nil || !strings.Contains(err.Error(), `"beacon/session#issuer"`) {
+		t.Errorf("GetSecret() without a field error = %v, want the fields listed", err)
+	}
+	if _, err := vault.GetSecret(ctx, "beacon/session#missing"); !errors.Is(err, core.ErrSecretNotFound) {
+		t.Errorf("GetSecret(#missing) error = %v, want ErrSecretNotFound", err)
+	}
+	if _, err := vault.GetSecret(ctx, "beacon/other#keys"); !errors.Is(err, core.ErrSecretNotFound) {
+		t.Errorf("GetSecret(other) error = %v, want ErrSecretNotFound", err)
+	}
+
+	denied, _ := NewVault(&VaultOptions{Address: server.URL, Token: "wrong", AllowInsecure: true})
+	if _, err := denied.GetSecret(ctx, "beacon/smtp"); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("GetSecret() with a bad token error = %v, want status 403", err)
+	}
+}
+
+// TestSignAWSRequest checks the get-vanilla case of the AWS Signature
+// Version 4 test suite
+func TestSignAWSRequest(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	creds := AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signAWSRequest(req, nil, creds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestAWS(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req struct{ SecretId, VersionStage string }
+		_ = json.Unmarshal(body, &req)
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" || req.VersionStage != "AWSCURRENT" ||
+			!strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") ||
+			r.Header.Get("X-Amz-Security-Token") != "session" {
+			http.Error(w, `{"__type":"AccessDeniedException"}`, http.StatusBadRequest)
+			return
+		}
+		switch req.SecretId {
+		case "prod/beacon":
+			_, _ = w.Write([]byte(`{"Name":"prod/beacon","SecretString":"{\"github\":\"gh-secret\",\"port\":587}"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"Secrets Manager can't find the specified secret."}`))
+		}
+	}))
+	defer server.Close()
+
+	aws, err := NewAWS(&AWSOptions{
+		Region:        "eu-west-1",
+		Endpoint:      server.URL,
+		AllowInsecure: true,
+		Credentials: func(ctx context.Context) (AWSCredentials, error) {
+			return AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "session"}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewAWS() error = %v", err)
+	}
+
+	ctx := context.Background()
+	if value, err := aws.GetSecret(ctx, "prod/beacon#github"); err != nil || value != "gh-secret" {
+		t.Errorf("GetSecret(#github) = %q, %v", value, err)
+	}
+	if value, err := aws.GetSecret(ctx, "prod/beacon#port"); err != nil || value != "587" {
+		t.Errorf("GetSecret(#port) = %q, %v", value, err)
+	}
+	if value, err := aws.GetSecret(ctx, "prod/beacon"); err != nil || !strings.HasPrefix(value, `{"github"`) {
+		t.Errorf("GetSecret() = %q, %v, want the whole secret", value, err)
+	}
+	if _, err := aws.GetSecret(ctx, "prod/other"); !errors.Is(err, core.ErrSecretNotFound) {
+		t.Errorf("GetSecret(other) error = %v, want ErrSecretNotFound", err)
+	}
+}
+
+func TestGCP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, `{"error":{"code":401}}`, http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/v1/projects/acme/secrets/beacon-oauth/versions/latest:access" {
+			http.Error(w, `{"error":{"code":404}}`, http.StatusNotFound)
+			return
+		}
+		payload := base64.StdEncoding.EncodeToString([]byte(`{"google":"g-secret"}`))
+		_, _ = w.Write([]byte(`{"name":"projects/acme/secrets/beacon-oauth/versions/2","payload":{"data":"` + payload + `"}}`))
+	}))
+	defer server.Close()
+
+	gcp, err := NewGCP(&GCPOptions{
+		Project:       "acme",
+		Endpoint:      server.URL,
+		AllowInsecure: true,
+		Token:         func(ctx context.Context) (string, error) { return "token", nil },
+	})
+	if err != nil {
+		t.Fatalf("NewGCP() error = %v", err)
+	}
+
+	ctx := context.Background()
+	if value, err := gcp.GetSecret(ctx, "beacon-oauth#google"); err != nil || value != "g-secret" {
+		t.Errorf("GetSecret(#google) = %q, %v", value, err)
+	}
+	if _, err := gcp.GetSecret(ctx, "other"); !errors.Is(err, core.ErrSecretNotFound) {
+		t.Errorf("GetSecret(other) error = %v, want ErrSecretNotFound", err)
+	}
+	if _, err := gcp.GetSecret(ctx, "projects/acme/secrets/x"); err == nil {
+		t.Error("GetSecret() accepted a resource path as a name")
+	}
+}
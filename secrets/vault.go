@@ -0,0 +1,149 @@
+package secrets
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// VaultOptions configures a VaultProvider
+type VaultOptions struct {
+	// Address of the Vault server (default $VAULT_ADDR)
+	Address string
+
+	// Token authenticates requests (default $VAULT_TOKEN)
+	Token string
+
+	// Namespace is the Vault Enterprise namespace (default
+	// $VAULT_NAMESPACE)
+	Namespace string
+
+	// Mount is the path of the KV version 2 secrets engine (default
+	// "secret")
+	Mount string
+
+	// TLSConfig customizes the TLS client, e.g. a private CA. Ignored when
+	// Client is set.
+	TLSConfig *tls.Config
+
+	// Client replaces the default HTTP client
+	Client *http.Client
+
+	// Timeout bounds each request (default 10s). Ignored when Client is
+	// set.
+	Timeout time.Duration
+
+	// AllowInsecure permits an http:// address, e.g. a dev server on
+	// localhost
+	AllowInsecure bool
+}
+
+// VaultProvider reads secrets from a HashiCorp Vault KV version 2 secrets
+// engine. The name "beacon/session#keys" is the field keys of the secret
+// at beacon/session; without a field, the secret must have one field.
+type VaultProvider struct {
+	address   string
+	token     string
+	namespace string
+	mount     string
+	client    *http.Client
+}
+
+// NewVault creates a Vault provider
+func NewVault(opts *VaultOptions) (*VaultProvider, error) {
+	if opts == nil {
+		opts = &VaultOptions{}
+	}
+	p := &VaultProvider{
+		address:   strings.TrimRight(firstNonEmpty(opts.Address, os.Getenv("VAULT_ADDR")), "/"),
+		token:     firstNonEmpty(opts.Token, os.Getenv("VAULT_TOKEN")),
+		namespace: firstNonEmpty(opts.Namespace, os.Getenv("VAULT_NAMESPACE")),
+		mount:     strings.Trim(firstNonEmpty(opts.Mount, "secret"), "/"),
+		client:    httpClient(opts.Client, opts.TLSConfig, opts.Timeout),
+	}
+	if err := checkEndpoint("Vault", p.address, opts.AllowInsecure); err != nil {
+		return nil, err
+	}
+	if p.token == "" {
+		return nil, errors.New("vault token is required (set VaultOptions.Token or VAULT_TOKEN)")
+	}
+	return p, nil
+}
+
+// GetSecret reads the latest version of a secret
+func (p *VaultProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	path, field := splitName(name)
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return "", fmt.Errorf("invalid Vault secret name: %q", name)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.address+"/v1/"+p.mount+"/data/"+escapePath(path), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+	if p.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.namespace)
+	}
+
+	var resp struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := do(p.client, req, &resp, nil); err != nil {
+		return "", fmt.Errorf("vault %s: %w", path, err)
+	}
+	data := resp.Data.Data
+	if len(data) == 0 {
+		// A deleted latest version has no data
+		return "", fmt.Errorf("vault %s: %w", path, core.ErrSecretNotFound)
+	}
+
+	if field == "" {
+		if len(data) != 1 {
+			fields := make([]string, 0, len(data))
+			for f := range data {
+				fields = append(fields, f)
+			}
+			sort.Strings(fields)
+			return "", fmt.Errorf("vault %s has fields %s; name one, e.g. %q", path, strings.Join(fields, ", "), path+"#"+fields[0])
+		}
+		for f := range data {
+			field = f
+		}
+	}
+	value, err := fieldValue(data, field)
+	if err != nil {
+		return "", fmt.Errorf("vault %s: %w", path, err)
+	}
+	return value, nil
+}
+
+// escapePath escapes each segment of a slash-separated path
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
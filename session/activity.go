@@ -0,0 +1,137 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// defaultActivityFlushInterval caps how long last-activity timestamps stay
+// buffered in memory when ActivityFlushInterval is not set
+const defaultActivityFlushInterval = time.Minute
+
+// activityTracker buffers session activity in memory so last-activity
+// timestamps are persisted in batches instead of on every request
+type activityTracker struct {
+	mu      sync.Mutex
+	pending map[string]time.Time // token -> last seen
+}
+
+func newActivityTracker() *activityTracker {
+	return &activityTracker{pending: make(map[string]time.Time)}
+}
+
+// touch records activity for a session, keeping the most recent time
+func (a *activityTracker) touch(token string, at time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if seen, ok := a.pending[token]; !ok || at.After(seen) {
+		a.pending[token] = at
+	}
+}
+
+// lastSeen returns buffered activity that has not been persisted yet
+func (a *activityTracker) lastSeen(token string) (time.Time, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	seen, ok := a.pending[token]
+	return seen, ok
+}
+
+// forget drops buffered activity for a session that no longer exists
+func (a *activityTracker) forget(token string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.pending, token)
+}
+
+// drain returns and clears all buffered activity
+func (a *activityTracker) drain() map[string]time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	pending := a.pending
+	a.pending = make(map[string]time.Time)
+	return pending
+}
+
+// activityFlushInterval returns the configured flush interval, defaulting
+// to a quarter of the idle timeout capped at one minute
+func (c *Config) activityFlushInterval() time.Duration {
+	if c.ActivityFlushInterval > 0 {
+		return c.ActivityFlushInterval
+	}
+	interval := c.IdleTimeout / 4
+	if interval <= 0 || interval > defaultActivityFlushInterval {
+		interval = defaultActivityFlushInterval
+	}
+	return interval
+}
+
+// isIdle reports whether a session has been inactive for longer than the
+// idle timeout. Buffered activity counts even if it is not persisted yet.
+func (m *Manager) isIdle(session *core.Session, now time.Time) bool {
+	return now.Sub(m.lastActivity(session)) > m.config.IdleTimeout
+}
+
+// lastActivity returns when a session was last used, including activity
+// that is still buffered
+func (m *Manager) lastActivity(session *core.Session) time.Time {
+	lastActivity := session.UpdatedAt
+	if m.activity == nil {
+		return lastActivity
+	}
+	if seen, ok := m.activity.lastSeen(session.Token); ok && seen.After(lastActivity) {
+		lastActivity = seen
+	}
+	return lastActivity
+}
+
+// FlushActivity persists buffered last-activity timestamps to the stores
+// that implement ActivityStore. It runs periodically when IdleTimeout is set and on
+// Close; call it directly to flush on demand. Entries that fail to persist
+// are kept for the next flush.
+func (m *Manager) FlushActivity(ctx context.Context) error {
+	if m.activity == nil {
+		return nil
+	}
+
+	var lastErr error
+	for token, at := range m.activity.drain() {
+		for _, l := range m.layers {
+			store, ok := l.store.(ActivityStore)
+			if !ok {
+				continue
+			}
+			if err := store.Touch(ctx, token, at); err != nil {
+				lastErr = err
+				m.activity.touch(token, at)
+				break
+			}
+		}
+	}
+
+	return lastErr
+}
+
+// runActivityFlusher flushes buffered activity until the manager is closed
+func (m *Manager) runActivityFlusher(interval time.Duration) {
+	defer close(m.activityDone)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_ = m.FlushActivity(context.Background()) // Best effort, retried next tick
+		case <-m.stopActivity:
+			return
+		}
+	}
+}
@@ -2,7 +2,10 @@ package session
 
 import (
 	"context"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
@@ -16,18 +19,80 @@ import (
 // CookieStore implements Store using signed JWT-like tokens
 // This is a stateless store that embeds session data in the cookie
 type CookieStore struct {
-	secret []byte
-	issuer string
+	keys    *KeyRing
+	issuer  string
+	encrypt bool
+	claims  []string
+
+	enricher      core.ClaimsEnricher
+	maxClaimsSize int
 }
 
+// CookieStoreOptions configures how session data is embedded in the cookie
+type CookieStoreOptions struct {
+	// Encrypt seals the payload with AES-GCM under a key derived from the
+	// signing key, so session and user data cannot be read client-side.
+	// Unencrypted tokens issued before it was enabled are still accepted.
+	Encrypt bool
+
+	// UserClaims limits the user fields embedded in the token to these
+	// JSON field names (e.g. "email", "name", "role"). The user ID is
+	// always kept. Empty embeds the whole user.
+	UserClaims []string
+
+	// ClaimsEnricher adds custom claims to each token, next to the session
+	// and user. Claims must not be named like the token's own fields or JWT
+	// registered claims (see ReservedClaims).
+	ClaimsEnricher core.ClaimsEnricher
+
+	// MaxClaimsSize caps the JSON size of the custom claims in bytes;
+	// larger claims fail token creation. Zero uses core.DefaultMaxClaimsSize.
+	MaxClaimsSize int
+}
+
+// ReservedClaims are the claim names a ClaimsEnricher cannot set: the
+// token's own fields and the JWT registered claims
+var ReservedClaims = []string{"session", "user", "iss", "iat", "sub", "aud", "exp", "nbf", "jti"}
+
+// encryptedMarker prefixes the payload segment of encrypted tokens
+const encryptedMarker = "~"
+
 // NewCookieStore creates a new cookie-based session store
 func NewCookieStore(secret, issuer string) *CookieStore {
 	return &CookieStore{
-		secret: []byte(secret),
+		keys:   &KeyRing{keys: []Key{{Secret: []byte(secret)}}},
+		issuer: issuer,
+	}
+}
+
+// NewCookieStoreWithKeyRing creates a cookie-based session store that signs
+// tokens with the key ring's active key and accepts tokens signed by any key
+// in the ring
+func NewCookieStoreWithKeyRing(keys *KeyRing, issuer string) *CookieStore {
+	return &CookieStore{
+		keys:   keys,
 		issuer: issuer,
 	}
 }
 
+// NewCookieStoreWithOptions creates a cookie-based session store using the
+// key ring with encryption and payload minimization options
+func NewCookieStoreWithOptions(keys *KeyRing, issuer string, opts *CookieStoreOptions) *CookieStore {
+	c := NewCookieStoreWithKeyRing(keys, issuer)
+	if opts != nil {
+		c.encrypt = opts.Encrypt
+		c.claims = opts.UserClaims
+		c.enricher = opts.ClaimsEnricher
+		c.maxClaimsSize = opts.MaxClaimsSize
+	}
+	return c
+}
+
+// KeyRing returns the key ring used to sign tokens
+func (c *CookieStore) KeyRing() *KeyRing {
+	return c.keys
+}
+
 // cookiePayload represents the data stored in the cookie
 type cookiePayload struct {
 	Session  *core.Session `json:"session"`
@@ -38,26 +103,54 @@ type cookiePayload struct {
 
 // Get retrieves a session from a signed cookie token
 func (c *CookieStore) Get(ctx context.Context, token string) (*core.Session, *core.User, error) {
-	// Token format: base64(payload).base64(signature)
-	parts := strings.Split(token, ".")
-	if len(parts) != 2 {
-		return nil, nil, fmt.Errorf("invalid token format")
+	payload, _, err := c.decode(token)
+	if err != nil || payload == nil {
+		return nil, nil, err
 	}
+	return payload.Session, payload.User, nil
+}
 
-	payloadB64 := parts[0]
-	signatureB64 := parts[1]
+// Claims returns the custom claims embedded in a signed cookie token by
+// the ClaimsEnricher. Expired tokens have none.
+func (c *CookieStore) Claims(token string) (map[string]any, error) {
+	payload, payloadBytes, err := c.decode(token)
+	if err != nil || payload == nil {
+		return nil, err
+	}
 
-	// Verify signature
-	expectedSig := c.sign(payloadB64)
-	if signatureB64 != expectedSig {
-		return nil, nil, fmt.Errorf("invalid token signature")
+	var claims map[string]any
+	if err := json.Unmarshal(payloadBytes, &claims); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal payload: %w", err)
+	}
+	for _, name := range ReservedClaims {
+		delete(claims, name)
+	}
+	if len(claims) == 0 {
+		return nil, nil
+	}
+	return claims, nil
+}
+
+// decode verifies a token and returns its payload, both parsed and as
+// JSON. The payload is nil when the session has expired.
+func (c *CookieStore) decode(token string) (*cookiePayload, []byte, error) {
+	// Token format: base64(payload).base64(signature)
+	// or, when signed with a named key: keyID.base64(payload).base64(signature)
+	payloadB64, key, err := c.verify(token)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// Decode payload
-	payloadBytes, err := base64.RawURLEncoding.DecodeString(payloadB64)
+	payloadBytes, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(payloadB64, encryptedMarker))
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to decode payload: %w", err)
 	}
+	if strings.HasPrefix(payloadB64, encryptedMarker) {
+		if payloadBytes, err = decryptPayload(key.Secret, payloadBytes); err != nil {
+			return nil, nil, err
+		}
+	}
 
 	var payload cookiePayload
 	if err := json.Unmarshal(payloadBytes, &payload); err != nil {
@@ -70,11 +163,11 @@ func (c *CookieStore) Get(ctx context.Context, token string) (*core.Session, *co
 	}
 
 	// Check expiration
-	if time.Now().After(payload.Session.ExpiresAt) {
+	if payload.Session == nil || time.Now().After(payload.Session.ExpiresAt) {
 		return nil, nil, nil // Session expired
 	}
 
-	return payload.Session, payload.User, nil
+	return &payload, payloadBytes, nil
 }
 
 // Set creates a signed cookie token
@@ -86,6 +179,22 @@ func (c *CookieStore) Set(ctx context.Context, session *core.Session) error {
 
 // CreateToken creates a signed token for a session
 func (c *CookieStore) CreateToken(session *core.Session, user *core.User) (string, error) {
+	return c.CreateTokenContext(context.Background(), session, user)
+}
+
+// CreateTokenContext creates a signed token for a session, passing ctx to
+// the ClaimsEnricher
+func (c *CookieStore) CreateTokenContext(ctx context.Context, session *core.Session, user *core.User) (string, error) {
+	claims, err := c.enrich(ctx, session, user)
+	if err != nil {
+		return "", err
+	}
+
+	user, err = c.minimizeUser(user)
+	if err != nil {
+		return "", err
+	}
+
 	payload := cookiePayload{
 		Session:  session,
 		User:     user,
@@ -98,20 +207,186 @@ func (c *CookieStore) CreateToken(session *core.Session, user *core.User) (strin
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal payload: %w", err)
 	}
+	if claims != nil {
+		// Custom claims sit next to the payload fields, as in a JWT
+		claims = append(claims[:len(claims)-1], ',')
+		payloadBytes = append(claims, payloadBytes[1:]...)
+	}
+
+	key := c.keys.Active()
+	if c.encrypt {
+		if payloadBytes, err = encryptPayload(key.Secret, payloadBytes); err != nil {
+			return "", err
+		}
+	}
 
 	// Base64 encode payload
 	payloadB64 := base64.RawURLEncoding.EncodeToString(payloadBytes)
+	if c.encrypt {
+		payloadB64 = encryptedMarker + payloadB64
+	}
 
-	// Sign payload
-	signature := c.sign(payloadB64)
+	// Sign payload with the active key
+	signature := sign(key.Secret, payloadB64)
 
 	// Return token
-	return payloadB64 + "." + signature, nil
+	if key.ID == "" {
+		return payloadB64 + "." + signature, nil
+	}
+	return key.ID + "." + payloadB64 + "." + signature, nil
+}
+
+// enrich returns the ClaimsEnricher's claims for the token as a JSON
+// object, or nil when there are none
+func (c *CookieStore) enrich(ctx context.Context, session *core.Session, user *core.User) ([]byte, error) {
+	if c.enricher == nil {
+		return nil, nil
+	}
+	claims, err := c.enricher(ctx, user, session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enrich claims: %w", err)
+	}
+	if len(claims) == 0 {
+		return nil, nil
+	}
+	for _, name := range ReservedClaims {
+		if _, ok := claims[name]; ok {
+			return nil, fmt.Errorf("claim %q is reserved", name)
+		}
+	}
+
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal claims: %w", err)
+	}
+	limit := c.maxClaimsSize
+	if limit <= 0 {
+		limit = core.DefaultMaxClaimsSize
+	}
+	if len(data) > limit {
+		return nil, fmt.Errorf("claims are %d bytes, over the %d byte limit", len(data), limit)
+	}
+	return data, nil
+}
+
+// verify checks the token signature and returns the encoded payload and the
+// key that signed it
+func (c *CookieStore) verify(token string) (string, Key, error) {
+	parts := strings.Split(token, ".")
+
+	var candidates []Key
+	switch len(parts) {
+	case 2:
+		// Unnamed key, e.g. a single configured Secret
+		if key, ok := c.keys.Lookup(""); ok {
+			candidates = []Key{key}
+		}
+	case 3:
+		if key, ok := c.keys.Lookup(parts[0]); ok {
+			candidates = []Key{key}
+		}
+		parts = parts[1:]
+	default:
+		return "", Key{}, fmt.Errorf("invalid token format")
+	}
+
+	payloadB64, signatureB64 := parts[0], parts[1]
+	for _, key := range candidates {
+		if hmac.Equal([]byte(signatureB64), []byte(sign(key.Secret, payloadB64))) {
+			return payloadB64, key, nil
+		}
+	}
+
+	return "", Key{}, fmt.Errorf("invalid token signature")
+}
+
+// minimizeUser returns a copy of user holding only the allowed claims
+func (c *CookieStore) minimizeUser(user *core.User) (*core.User, error) {
+	if user == nil || len(c.claims) == 0 {
+		return user, nil
+	}
+
+	data, err := json.Marshal(user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal user: %w", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal user: %w", err)
+	}
+
+	kept := map[string]json.RawMessage{"id": fields["id"]}
+	for _, claim := range c.claims {
+		if v, ok := fields[claim]; ok {
+			kept[claim] = v
+		}
+	}
+
+	if data, err = json.Marshal(kept); err != nil {
+		return nil, fmt.Errorf("failed to marshal user: %w", err)
+	}
+	minimized := &core.User{}
+	if err := json.Unmarshal(data, minimized); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal user: %w", err)
+	}
+	return minimized, nil
+}
+
+// payloadCipher returns an AES-256-GCM cipher keyed from the signing secret
+func payloadCipher(secret []byte) (cipher.AEAD, error) {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte("beacon-auth cookie encryption"))
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptPayload seals the payload, prefixing the random nonce
+func encryptPayload(secret, payload []byte) ([]byte, error) {
+	aead, err := payloadCipher(secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, payload, nil), nil
+}
+
+// decryptPayload opens a payload sealed by encryptPayload
+func decryptPayload(secret, sealed []byte) ([]byte, error) {
+	aead, err := payloadCipher(secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("invalid encrypted payload")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	payload, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt payload")
+	}
+	return payload, nil
+}
+
+// NeedsResign reports whether a valid token was signed with a key other
+// than the active key, so callers can reissue it after a rotation
+func (c *CookieStore) NeedsResign(token string) bool {
+	parts := strings.Split(token, ".")
+	keyID := ""
+	if len(parts) == 3 {
+		keyID = parts[0]
+	}
+	return keyID != c.keys.Active().ID
 }
 
 // sign creates an HMAC signature for the payload
-func (c *CookieStore) sign(data string) string {
-	h := hmac.New(sha256.New, c.secret)
+func sign(secret []byte, data string) string {
+	h := hmac.New(sha256.New, secret)
 	h.Write([]byte(data))
 	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
 }
@@ -0,0 +1,146 @@
+package session
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+func TestCookieStore_Encrypt(t *testing.T) {
+	keys := &KeyRing{keys: []Key{{Secret: []byte("test-secret")}}}
+	store := NewCookieStoreWithOptions(keys, "test", &CookieStoreOptions{Encrypt: true})
+	session, user := newTestCookieSession()
+
+	token, err := store.CreateToken(session, user)
+	if err != nil {
+		t.Fatalf("CreateToken() error = %v", err)
+	}
+
+	payload := strings.Split(token, ".")[0]
+	if !strings.HasPrefix(payload, encryptedMarker) {
+		t.Fatalf("Expected encrypted payload, got %q", payload)
+	}
+	raw, _ := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(payload, encryptedMarker))
+	if strings.Contains(string(raw), user.Email) {
+		t.Error("Expected user data to be unreadable")
+	}
+
+	got, gotUser, err := store.Get(context.Background(), token)
+	if err != nil || got == nil || gotUser.Email != user.Email {
+		t.Fatalf("Get() = %v, %v, %v, want decrypted session", got, gotUser, err)
+	}
+
+	// Tokens issued before encryption was enabled remain valid
+	plain, _ := NewCookieStoreWithKeyRing(keys, "test").CreateToken(session, user)
+	if got, _, err := store.Get(context.Background(), plain); err != nil || got == nil {
+		t.Errorf("Expected unencrypted token to be accepted, got %v", err)
+	}
+
+	// Another key cannot decrypt the payload, even with a valid signature
+	other := NewCookieStoreWithOptions(&KeyRing{keys: []Key{{Secret: []byte("other-secret")}}}, "test", &CookieStoreOptions{Encrypt: true})
+	forged := payload + "." + sign([]byte("other-secret"), payload)
+	if _, _, err := other.Get(context.Background(), forged); err == nil {
+		t.Error("Expected decryption with another key to fail")
+	}
+}
+
+func TestCookieStore_UserClaims(t *testing.T) {
+	keys := &KeyRing{keys: []Key{{Secret: []byte("test-secret")}}}
+	store := NewCookieStoreWithOptions(keys, "test", &CookieStoreOptions{UserClaims: []string{"email", "role"}})
+	session, _ := newTestCookieSession()
+	user := &core.User{
+		ID:       "user1",
+		Email:    "test@example.com",
+		Name:     "Test User",
+		Role:     "admin",
+		Metadata: map[string]interface{}{"preferences": strings.Repeat("x", 1000)},
+	}
+
+	token, err := store.CreateToken(session, user)
+	if err != nil {
+		t.Fatalf("CreateToken() error = %v", err)
+	}
+	if len(token) > 1000 {
+		t.Errorf("Expected metadata to be left out of the token, got %d bytes", len(token))
+	}
+
+	_, got, err := store.Get(context.Background(), token)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.ID != "user1" || got.Email != user.Email || got.Role != "admin" {
+		t.Errorf("Expected id, email and role to be kept, got %+v", got)
+	}
+	if got.Name != "" || got.Metadata != nil {
+		t.Errorf("Expected name and metadata to be dropped, got %+v", got)
+	}
+	if user.Name == "" || user.Metadata == nil {
+		t.Error("Expected the original user to be left unchanged")
+	}
+}
+
+func TestCookieStore_ClaimsEnricher(t *testing.T) {
+	keys := &KeyRing{keys: []Key{{Secret: []byte("test-secret")}}}
+	session, user := newTestCookieSession()
+	ctx := context.Background()
+
+	var enriched map[string]any
+	for _, encrypt := range []bool{false, true} {
+		store := NewCookieStoreWithOptions(keys, "test", &CookieStoreOptions{
+			Encrypt: encrypt,
+			ClaimsEnricher: func(ctx context.Context, u *core.User, s *core.Session) (map[string]any, error) {
+				if u.ID != user.ID || s.ID != session.ID {
+					t.Errorf("enricher got %v, %v, want the token's user and session", u, s)
+				}
+				return enriched, nil
+			},
+		})
+
+		enriched = map[string]any{"plan": "pro", "permissions": []string{"billing:read"}}
+		token, err := store.CreateTokenContext(ctx, session, user)
+		if err != nil {
+			t.Fatalf("CreateTokenContext() error = %v", err)
+		}
+		claims, err := store.Claims(token)
+		if err != nil {
+			t.Fatalf("Claims() error = %v", err)
+		}
+		if claims["plan"] != "pro" || len(claims["permissions"].([]any)) != 1 || len(claims) != 2 {
+			t.Errorf("Claims() = %v, want plan and permissions only", claims)
+		}
+		if got, gotUser, err := store.Get(ctx, token); err != nil || got == nil || gotUser.Email != user.Email {
+			t.Errorf("Get() = %v, %v, %v, want the session next to the claims", got, gotUser, err)
+		}
+
+		enriched = nil
+		token, _ = store.CreateToken(session, user)
+		if claims, err := store.Claims(token); err != nil || claims != nil {
+			t.Errorf("Claims() = %v, %v, want none", claims, err)
+		}
+	}
+
+	store := NewCookieStoreWithOptions(keys, "test", &CookieStoreOptions{
+		MaxClaimsSize: 64,
+		ClaimsEnricher: func(context.Context, *core.User, *core.Session) (map[string]any, error) {
+			return enriched, nil
+		},
+	})
+	for name, claims := range map[string]map[string]any{
+		"reserved":  {"sub": "someone-else"},
+		"payload":   {"session": nil},
+		"too large": {"permissions": strings.Repeat("x", 64)},
+		"invalid":   {"plan": func() {}},
+	} {
+		enriched = claims
+		if _, err := store.CreateToken(session, user); err == nil {
+			t.Errorf("%s: CreateToken() accepted %v", name, claims)
+		}
+	}
+
+	if _, err := store.Claims("invalid.token"); err == nil {
+		t.Error("Claims() accepted an invalid token")
+	}
+}
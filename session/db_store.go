@@ -2,45 +2,172 @@ package session
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/marshallshelly/beacon-auth/adapter"
 	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/tokens"
 )
 
+// HashedTokenPrefix marks session tokens stored as hashes, so hashed and
+// plaintext rows can be told apart while tokens are migrated
+const HashedTokenPrefix = "sha256:"
+
 // DBStore implements Store using the database adapter
 type DBStore struct {
-	internal *adapter.InternalAdapter
+	internal    *adapter.InternalAdapter
+	hashTokens  bool
+	acceptPlain bool
+}
+
+// DBStoreOptions configures how the database store keeps tokens
+type DBStoreOptions struct {
+	// TableNames overrides the default table names (nil keeps the defaults)
+	TableNames *core.TableNames
+
+	// Users is where session users kept outside the database are looked
+	// up (see core.UserStore; nil = the users table)
+	Users core.UserStore
+
+	// UserCache keeps session users in memory, so most lookups load only
+	// the session (nil = no caching)
+	UserCache core.UserCache
+
+	// HashTokens stores a SHA-256 hash of each session token instead of
+	// the token, so a leaked sessions table cannot be used to sign in.
+	// Sessions are looked up by the hash of the presented token.
+	HashTokens bool
+
+	// AcceptPlainTokens keeps sessions stored in plaintext before
+	// HashTokens was enabled valid. Each is rehashed when it is next
+	// used; HashExistingTokens converts the rest. Only used with
+	// HashTokens.
+	AcceptPlainTokens bool
 }
 
 // NewDBStore creates a new database session store
 func NewDBStore(coreAdapter core.Adapter) *DBStore {
+	return NewDBStoreWithTableNames(coreAdapter, nil)
+}
+
+// NewDBStoreWithTableNames creates a database session store that uses
+// custom table names
+func NewDBStoreWithTableNames(coreAdapter core.Adapter, tables *core.TableNames) *DBStore {
+	return NewDBStoreWithOptions(coreAdapter, &DBStoreOptions{TableNames: tables})
+}
+
+// NewDBStoreWithOptions creates a database session store
+func NewDBStoreWithOptions(coreAdapter core.Adapter, opts *DBStoreOptions) *DBStore {
+	if opts == nil {
+		opts = &DBStoreOptions{}
+	}
 	return &DBStore{
-		internal: adapter.NewInternalAdapter(coreAdapter, nil),
+		internal: adapter.NewInternalAdapter(coreAdapter, &adapter.InternalAdapterConfig{
+			TableNames: opts.TableNames,
+			UserStore:  opts.Users,
+			UserCache:  opts.UserCache,
+		}),
+		hashTokens:  opts.HashTokens,
+		acceptPlain: opts.HashTokens && opts.AcceptPlainTokens,
+	}
+}
+
+// withAdapter returns a store that writes with a, e.g. a transaction
+func (d *DBStore) withAdapter(a core.Adapter) *DBStore {
+	return &DBStore{internal: d.internal.WithAdapter(a), hashTokens: d.hashTokens, acceptPlain: d.acceptPlain}
+}
+
+// storedToken returns the form of token kept in the sessions table.
+// Presented tokens are always hashed, so a stored hash is not a token.
+func (d *DBStore) storedToken(token string) string {
+	if !d.hashTokens {
+		return token
+	}
+	return HashedTokenPrefix + tokens.Hash(token)
+}
+
+// isStoredForm reports whether token looks like a stored hash. Such
+// tokens are never issued, so they are rejected rather than looked up as
+// plaintext.
+func (d *DBStore) isStoredForm(token string) bool {
+	return d.hashTokens && strings.HasPrefix(token, HashedTokenPrefix)
+}
+
+// tokenQuery selects the session of token, in its stored form and, while
+// plaintext tokens are accepted, as issued
+func (d *DBStore) tokenQuery(token string) *core.Query {
+	builder := core.NewQuery(d.internal.Table(core.ModelSessions))
+	if d.acceptPlain && !d.isStoredForm(token) {
+		return builder.Where("token", core.OpIn, []interface{}{d.storedToken(token), token}).Build()
 	}
+	return builder.Where("token", core.OpEqual, d.storedToken(token)).Build()
+}
+
+// rehash replaces the plaintext token of a session stored before hashing
+// was enabled with its hash. It reports whether such a session exists.
+func (d *DBStore) rehash(ctx context.Context, token string) (bool, error) {
+	if !d.acceptPlain || d.isStoredForm(token) {
+		return false, nil
+	}
+	stored := d.storedToken(token)
+	query := core.NewQuery(d.internal.Table(core.ModelSessions)).
+		Where("token", core.OpEqual, token).
+		Build()
+
+	updated, err := d.internal.Adapter().UpdateMany(ctx, query, map[string]interface{}{
+		"token": stored,
+	})
+	return updated > 0, err
 }
 
 // Get retrieves a session by token from the database
 func (d *DBStore) Get(ctx context.Context, token string) (*core.Session, *core.User, error) {
-	return d.internal.FindSessionWithUser(ctx, token)
+	if d.isStoredForm(token) {
+		return nil, nil, core.ErrSessionNotFound
+	}
+	session, user, err := d.internal.FindSessionWithUser(ctx, d.storedToken(token))
+	if errors.Is(err, core.ErrSessionNotFound) {
+		found, rehashErr := d.rehash(ctx, token)
+		if rehashErr != nil {
+			return nil, nil, rehashErr
+		}
+		if found {
+			session, user, err = d.internal.FindSessionWithUser(ctx, d.storedToken(token))
+		}
+	}
+	// Callers key other stores and later calls by the token they hold
+	if session != nil && d.hashTokens {
+		session.Token = token
+	}
+	return session, user, err
 }
 
 // Set stores a session in the database
 func (d *DBStore) Set(ctx context.Context, session *core.Session) error {
+	if d.isStoredForm(session.Token) {
+		return fmt.Errorf("session token must not start with %q", HashedTokenPrefix)
+	}
+
 	// Check if session exists first
-	existing, _, err := d.internal.FindSessionWithUser(ctx, session.Token)
-	if err != nil && err != core.ErrSessionNotFound {
+	exists, err := d.internal.SessionExists(ctx, d.storedToken(session.Token))
+	if err != nil {
 		return err
 	}
+	if !exists {
+		if exists, err = d.rehash(ctx, session.Token); err != nil {
+			return err
+		}
+	}
 
-	if existing != nil {
+	if exists {
 		// Update existing session
-		query := &core.Query{
-			Model: "sessions",
-			Where: []core.WhereClause{
-				{Field: "token", Operator: core.OpEqual, Value: session.Token},
-			},
-		}
+		query := core.NewQuery(d.internal.Table(core.ModelSessions)).
+			Where("token", core.OpEqual, d.storedToken(session.Token)).
+			Build()
 
 		_, err := d.internal.Adapter().Update(ctx, query, map[string]interface{}{
 			"expires_at": session.ExpiresAt,
@@ -50,23 +177,73 @@ func (d *DBStore) Set(ctx context.Context, session *core.Session) error {
 	}
 
 	// Create new session
-	_, err = d.internal.Adapter().Create(ctx, "sessions", map[string]interface{}{
+	data := map[string]interface{}{
 		"id":         session.ID,
 		"user_id":    session.UserID,
-		"token":      session.Token,
+		"token":      d.storedToken(session.Token),
 		"expires_at": session.ExpiresAt,
 		"ip_address": session.IPAddress,
 		"user_agent": session.UserAgent,
 		"created_at": session.CreatedAt,
 		"updated_at": session.UpdatedAt,
+	}
+	// Only bound sessions need the fingerprint column
+	if session.Fingerprint != "" {
+		data["fingerprint"] = session.Fingerprint
+	}
+	// Only tenant sessions need the tenant_id column
+	if session.TenantID != "" {
+		data["tenant_id"] = session.TenantID
+	}
+	// Only sessions with metadata, such as rotated ones, need the metadata
+	// column
+	if len(session.Metadata) > 0 {
+		metadata, err := json.Marshal(session.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to marshal session metadata: %w", err)
+		}
+		data["metadata"] = string(metadata)
+	}
+
+	_, err = d.internal.Adapter().Create(ctx, d.internal.Table(core.ModelSessions), data)
+
+	return err
+}
+
+// Touch records the last activity time of a session in the database
+func (d *DBStore) Touch(ctx context.Context, token string, lastActivity time.Time) error {
+	_, err := d.internal.Adapter().UpdateMany(ctx, d.tokenQuery(token), map[string]interface{}{
+		"updated_at": lastActivity,
 	})
+	return err
+}
 
+// Extend sets the expiry and last update time of a session in the
+// database
+func (d *DBStore) Extend(ctx context.Context, token string, expiresAt, updatedAt time.Time) error {
+	_, err := d.internal.Adapter().UpdateMany(ctx, d.tokenQuery(token), map[string]interface{}{
+		"expires_at": expiresAt,
+		"updated_at": updatedAt,
+	})
+	return err
+}
+
+// SetMetadata replaces the metadata of a session in the database
+func (d *DBStore) SetMetadata(ctx context.Context, token string, metadata map[string]interface{}) error {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session metadata: %w", err)
+	}
+	_, err = d.internal.Adapter().UpdateMany(ctx, d.tokenQuery(token), map[string]interface{}{
+		"metadata": string(data),
+	})
 	return err
 }
 
 // Delete removes a session from the database
 func (d *DBStore) Delete(ctx context.Context, token string) error {
-	return d.internal.RevokeSession(ctx, token)
+	_, err := d.internal.Adapter().DeleteMany(ctx, d.tokenQuery(token))
+	return err
 }
 
 // DeleteByUserID removes all sessions for a user from the database
@@ -75,19 +252,78 @@ func (d *DBStore) DeleteByUserID(ctx context.Context, userID string) error {
 	return err
 }
 
+// ListByUserID returns a user's active sessions from the database. With
+// HashTokens, the Token of each session is its stored form, which no
+// method accepts as a token; the manager revokes such sessions with
+// deleteStored.
+func (d *DBStore) ListByUserID(ctx context.Context, userID string) ([]*core.Session, error) {
+	return d.internal.ListUserSessions(ctx, userID)
+}
+
+// deleteStored removes the session whose token is stored as stored, as
+// listed by ListByUserID
+func (d *DBStore) deleteStored(ctx context.Context, stored string) error {
+	query := core.NewQuery(d.internal.Table(core.ModelSessions)).
+		Where("token", core.OpEqual, stored).
+		Build()
+	_, err := d.internal.Adapter().DeleteMany(ctx, query)
+	return err
+}
+
 // Cleanup removes expired sessions from the database
 func (d *DBStore) Cleanup(ctx context.Context) error {
-	query := &core.Query{
-		Model: "sessions",
-		Where: []core.WhereClause{
-			{Field: "expires_at", Operator: core.OpLessThan, Value: time.Now()},
-		},
-	}
+	query := core.NewQuery(d.internal.Table(core.ModelSessions)).
+		Where("expires_at", core.OpLessThan, time.Now()).
+		Build()
 
 	_, err := d.internal.Adapter().DeleteMany(ctx, query)
 	return err
 }
 
+// HashExistingTokens replaces the plaintext tokens of sessions stored
+// before HashTokens was enabled with their hashes and returns how many it
+// converted. Once it has run, AcceptPlainTokens can be turned off.
+func (d *DBStore) HashExistingTokens(ctx context.Context) (int64, error) {
+	if !d.hashTokens {
+		return 0, errors.New("session token hashing is not enabled")
+	}
+
+	const batchSize = 500
+	var converted int64
+	for offset := 0; ; offset += batchSize {
+		query := core.NewQuery(d.internal.Table(core.ModelSessions)).
+			Select("id", "token").
+			OrderBy("id", false).
+			Limit(batchSize).
+			Offset(offset).
+			Build()
+
+		rows, err := d.internal.Adapter().FindMany(ctx, query)
+		if err != nil {
+			return converted, err
+		}
+		for _, row := range rows {
+			token, _ := row["token"].(string)
+			if token == "" || strings.HasPrefix(token, HashedTokenPrefix) {
+				continue
+			}
+			update := core.NewQuery(d.internal.Table(core.ModelSessions)).
+				Where("token", core.OpEqual, token).
+				Build()
+			updated, err := d.internal.Adapter().UpdateMany(ctx, update, map[string]interface{}{
+				"token": d.storedToken(token),
+			})
+			if err != nil {
+				return converted, err
+			}
+			converted += updated
+		}
+		if len(rows) < batchSize {
+			return converted, nil
+		}
+	}
+}
+
 // Close closes the database connection
 func (d *DBStore) Close() error {
 	return d.internal.Adapter().Close()
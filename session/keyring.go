@@ -0,0 +1,246 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Key is a secret used to sign session tokens
+type Key struct {
+	// ID identifies the key inside signed tokens.
+	// It may only contain letters, digits, '-' and '_'.
+	ID string
+
+	// Secret is the HMAC signing secret
+	Secret []byte
+}
+
+// KeyRing holds the keys used to sign and verify session tokens.
+// The first key is the active key used to sign new tokens; the
+// remaining keys are only used to verify tokens issued before a rotation.
+// A KeyRing is safe for concurrent use, so keys can be rotated at runtime.
+type KeyRing struct {
+	mu   sync.RWMutex
+	keys []Key
+}
+
+// NewKeyRing creates a key ring. The first key is the active signing key.
+func NewKeyRing(keys ...Key) (*KeyRing, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("key ring requires at least one key")
+	}
+
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if err := validateKey(key); err != nil {
+			return nil, err
+		}
+		if seen[key.ID] {
+			return nil, fmt.Errorf("duplicate key ID: %q", key.ID)
+		}
+		seen[key.ID] = true
+	}
+
+	return &KeyRing{keys: append([]Key(nil), keys...)}, nil
+}
+
+// ParseKeyRing parses a key ring from its configuration format: a comma
+// separated list of "id:secret" entries, newest (active) key first, where
+// secret is base64 encoded. For example:
+//
+//	2025-06:q8Ylq6m3...,2025-01:Zk1c9Hsa...
+//
+// KeyRing.String produces the same format.
+func ParseKeyRing(config string) (*KeyRing, error) {
+	var keys []Key
+
+	for _, entry := range strings.Split(config, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid key ring entry %q: expected id:secret", entry)
+		}
+
+		secret, err := decodeSecret(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret for key %q: %w", id, err)
+		}
+
+		keys = append(keys, Key{ID: id, Secret: secret})
+	}
+
+	return NewKeyRing(keys...)
+}
+
+// GenerateKey creates a key with a random 32-byte secret
+func GenerateKey(id string) (Key, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return Key{}, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	key := Key{ID: id, Secret: secret}
+	if err := validateKey(key); err != nil {
+		return Key{}, err
+	}
+
+	return key, nil
+}
+
+// Active returns the key used to sign new tokens
+func (k *KeyRing) Active() Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.keys[0]
+}
+
+// Lookup finds a key by ID
+func (k *KeyRing) Lookup(id string) (Key, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for _, key := range k.keys {
+		if key.ID == id {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
+
+// Keys returns all keys, active key first
+func (k *KeyRing) Keys() []Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return append([]Key(nil), k.keys...)
+}
+
+// Rotate makes key the active signing key. The previous keys are kept so
+// tokens they signed remain valid until they are retired.
+func (k *KeyRing) Rotate(key Key) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for _, existing := range k.keys {
+		if existing.ID == key.ID {
+			return fmt.Errorf("duplicate key ID: %q", key.ID)
+		}
+	}
+
+	k.keys = append([]Key{key}, k.keys...)
+	return nil
+}
+
+// Retire removes a key so tokens signed with it are no longer accepted.
+// The active key cannot be retired; rotate to a new key first.
+func (k *KeyRing) Retire(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for i, key := range k.keys {
+		if key.ID != id {
+			continue
+		}
+		if i == 0 {
+			return errors.New("cannot retire the active key")
+		}
+		k.keys = append(k.keys[:i:i], k.keys[i+1:]...)
+		return nil
+	}
+
+	return fmt.Errorf("key not found: %q", id)
+}
+
+// Prune retires every key except the newest keep keys
+func (k *KeyRing) Prune(keep int) {
+	if keep < 1 {
+		keep = 1
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if len(k.keys) > keep {
+		k.keys = k.keys[:keep:keep]
+	}
+}
+
+// Replace swaps all keys at once, e.g. for a key ring fetched again from a
+// secret manager. The first key becomes the active key; tokens signed with
+// keys no longer listed are rejected.
+func (k *KeyRing) Replace(keys ...Key) error {
+	replacement, err := NewKeyRing(keys...)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = replacement.keys
+	return nil
+}
+
+// appendKey adds a verification-only key unless its ID is already present
+func (k *KeyRing) appendKey(key Key) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for _, existing := range k.keys {
+		if existing.ID == key.ID {
+			return
+		}
+	}
+	k.keys = append(k.keys, key)
+}
+
+// String encodes the key ring in the format accepted by ParseKeyRing
+func (k *KeyRing) String() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	entries := make([]string, len(k.keys))
+	for i, key := range k.keys {
+		entries[i] = key.ID + ":" + base64.StdEncoding.EncodeToString(key.Secret)
+	}
+	return strings.Join(entries, ",")
+}
+
+func validateKey(key Key) error {
+	if len(key.Secret) == 0 {
+		return fmt.Errorf("key %q has an empty secret", key.ID)
+	}
+	for _, c := range key.ID {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+		default:
+			return fmt.Errorf("invalid key ID: %q", key.ID)
+		}
+	}
+	return nil
+}
+
+// decodeSecret accepts standard and URL-safe base64, with or without padding
+func decodeSecret(s string) ([]byte, error) {
+	for _, enc := range []*base64.Encoding{
+		base64.StdEncoding,
+		base64.RawStdEncoding,
+		base64.URLEncoding,
+		base64.RawURLEncoding,
+	} {
+		if secret, err := enc.DecodeString(s); err == nil {
+			return secret, nil
+		}
+	}
+	return nil, errors.New("secret is not valid base64")
+}
@@ -0,0 +1,237 @@
+package session
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+func newTestCookieSession() (*core.Session, *core.User) {
+	session := &core.Session{
+		ID:        "session1",
+		UserID:    "user1",
+		Token:     "token123",
+		ExpiresAt: time.Now().Add(1 * time.Hour),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	user := &core.User{ID: "user1", Email: "test@example.com"}
+	return session, user
+}
+
+func TestParseKeyRing(t *testing.T) {
+	ring, err := ParseKeyRing("v2:c2Vjb25kLXNlY3JldA==, v1:Zmlyc3Qtc2VjcmV0")
+	if err != nil {
+		t.Fatalf("Failed to parse key ring: %v", err)
+	}
+
+	if ring.Active().ID != "v2" {
+		t.Errorf("Expected active key v2, got %s", ring.Active().ID)
+	}
+
+	key, ok := ring.Lookup("v1")
+	if !ok {
+		t.Fatal("Expected to find key v1")
+	}
+	if string(key.Secret) != "first-secret" {
+		t.Errorf("Unexpected secret for v1: %q", key.Secret)
+	}
+
+	// String round-trips
+	parsed, err := ParseKeyRing(ring.String())
+	if err != nil {
+		t.Fatalf("Failed to parse encoded key ring: %v", err)
+	}
+	if len(parsed.Keys()) != 2 || parsed.Active().ID != "v2" {
+		t.Errorf("Expected round-tripped key ring, got %s", parsed.String())
+	}
+
+	invalid := []string{
+		"",
+		"v1",
+		"v1:not base64!",
+		"v1:Zmlyc3Q=,v1:c2Vjb25k",
+		"bad.id:Zmlyc3Q=",
+	}
+	for _, config := range invalid {
+		if _, err := ParseKeyRing(config); err == nil {
+			t.Errorf("Expected error parsing %q", config)
+		}
+	}
+}
+
+func TestKeyRing_RotateAndRetire(t *testing.T) {
+	v1, err := GenerateKey("v1")
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	ring, err := NewKeyRing(v1)
+	if err != nil {
+		t.Fatalf("Failed to create key ring: %v", err)
+	}
+
+	store := NewCookieStoreWithKeyRing(ring, "beaconauth")
+	session, user := newTestCookieSession()
+	ctx := context.Background()
+
+	oldToken, err := store.CreateToken(session, user)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	if !strings.HasPrefix(oldToken, "v1.") {
+		t.Errorf("Expected token to carry key ID, got %s", oldToken)
+	}
+
+	v2, err := GenerateKey("v2")
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	if err := ring.Rotate(v2); err != nil {
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+	if err := ring.Rotate(v2); err == nil {
+		t.Error("Expected error rotating to a duplicate key ID")
+	}
+
+	newToken, err := store.CreateToken(session, user)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	if !strings.HasPrefix(newToken, "v2.") {
+		t.Errorf("Expected new token to be signed with v2, got %s", newToken)
+	}
+
+	// Tokens signed before the rotation are still valid
+	if s, _, err := store.Get(ctx, oldToken); err != nil || s == nil {
+		t.Fatalf("Expected old token to remain valid, got session=%v err=%v", s, err)
+	}
+	if !store.NeedsResign(oldToken) {
+		t.Error("Expected old token to need re-signing")
+	}
+	if store.NeedsResign(newToken) {
+		t.Error("Expected new token not to need re-signing")
+	}
+
+	if err := ring.Retire("v2"); err == nil {
+		t.Error("Expected error retiring the active key")
+	}
+	if err := ring.Retire("v1"); err != nil {
+		t.Fatalf("Failed to retire key: %v", err)
+	}
+
+	if _, _, err := store.Get(ctx, oldToken); err == nil {
+		t.Error("Expected token signed by a retired key to be rejected")
+	}
+	if s, _, err := store.Get(ctx, newToken); err != nil || s == nil {
+		t.Errorf("Expected new token to remain valid, got session=%v err=%v", s, err)
+	}
+}
+
+func TestKeyRing_Prune(t *testing.T) {
+	ring, err := NewKeyRing(
+		Key{ID: "v3", Secret: []byte("three")},
+		Key{ID: "v2", Secret: []byte("two")},
+		Key{ID: "v1", Secret: []byte("one")},
+	)
+	if err != nil {
+		t.Fatalf("Failed to create key ring: %v", err)
+	}
+
+	ring.Prune(2)
+
+	if len(ring.Keys()) != 2 {
+		t.Fatalf("Expected 2 keys after prune, got %d", len(ring.Keys()))
+	}
+	if _, ok := ring.Lookup("v1"); ok {
+		t.Error("Expected oldest key to be pruned")
+	}
+}
+
+func TestManager_KeyRingAcceptsLegacySecret(t *testing.T) {
+	ctx := context.Background()
+	session, user := newTestCookieSession()
+
+	// Token issued before the key ring was adopted
+	legacyToken, err := NewCookieStore("legacy-secret", "beaconauth").CreateToken(session, user)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+
+	ring, err := NewKeyRing(Key{ID: "v1", Secret: []byte("new-secret")})
+	if err != nil {
+		t.Fatalf("Failed to create key ring: %v", err)
+	}
+
+	config := DefaultConfig()
+	config.EnableRedisStore = false
+	config.EnableDBStore = false
+	config.Secret = "legacy-secret"
+	config.KeyRing = ring
+
+	manager, err := NewManager(config, nil)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+
+	if s, _, err := manager.Get(ctx, legacyToken); err != nil || s == nil {
+		t.Fatalf("Expected legacy token to be accepted, got session=%v err=%v", s, err)
+	}
+
+	if manager.KeyRing().Active().ID != "v1" {
+		t.Errorf("Expected v1 to stay the active key, got %q", manager.KeyRing().Active().ID)
+	}
+}
+
+func TestManager_SetSessionKeys(t *testing.T) {
+	ctx := context.Background()
+	session, user := newTestCookieSession()
+
+	ring, err := ParseKeyRing("v1:" + base64.StdEncoding.EncodeToString([]byte("first-secret")))
+	if err != nil {
+		t.Fatalf("Failed to parse key ring: %v", err)
+	}
+	config := DefaultConfig()
+	config.EnableRedisStore = false
+	config.EnableDBStore = false
+	config.KeyRing = ring
+
+	manager, err := NewManager(config, nil)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	v1Token, err := manager.cookieStore.CreateToken(session, user)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+
+	// The secret manager now lists v2 first and keeps v1 for verification
+	v2 := "v2:" + base64.StdEncoding.EncodeToString([]byte("second-secret"))
+	if err := manager.SetSessionKeys(v2 + "," + ring.String()); err != nil {
+		t.Fatalf("SetSessionKeys() error = %v", err)
+	}
+	if manager.KeyRing().Active().ID != "v2" {
+		t.Errorf("Expected v2 to be the active key, got %q", manager.KeyRing().Active().ID)
+	}
+	if s, _, err := manager.Get(ctx, v1Token); err != nil || s == nil {
+		t.Errorf("Expected the v1 token to stay valid, got session=%v err=%v", s, err)
+	}
+
+	// Then v1 is retired
+	if err := manager.SetSessionKeys(v2); err != nil {
+		t.Fatalf("SetSessionKeys() error = %v", err)
+	}
+	if s, _, _ := manager.Get(ctx, v1Token); s != nil {
+		t.Error("Expected the v1 token to be rejected after v1 was removed")
+	}
+
+	if err := manager.SetSessionKeys("not a key ring"); err == nil {
+		t.Error("Expected an invalid key ring to be rejected")
+	}
+	if manager.KeyRing().Active().ID != "v2" {
+		t.Errorf("Expected the keys to be kept after a rejected update, got %q", manager.KeyRing().Active().ID)
+	}
+}
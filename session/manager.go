@@ -3,7 +3,12 @@ package session
 import (
 	"context"
 	"crypto/rand"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/marshallshelly/beacon-auth/core"
@@ -13,9 +18,31 @@ import (
 type Manager struct {
 	config      *Config
 	cookieStore *CookieStore
-	redisStore  *RedisStore
+	cacheStore  cacheStore
 	dbStore     *DBStore
 	strategy    Strategy
+	proxies     core.TrustedProxies
+
+	// Server-side stores in lookup order, including custom stores
+	layers []storeLayer
+
+	// Idle timeout tracking (nil/unused when IdleTimeout is disabled)
+	activity     *activityTracker
+	stopActivity chan struct{}
+	activityDone chan struct{}
+
+	// Batched updates (nil when Config.BatchUpdates is off)
+	updates     *updateBatcher
+	stopUpdates chan struct{}
+	updatesDone chan struct{}
+
+	closeOnce sync.Once
+
+	// Revocation broadcast (nil when disabled)
+	revocations *revocationBus
+
+	// rotateMu serializes Rotate so a token is rotated at most once
+	rotateMu sync.Mutex
 }
 
 // Config returns the session configuration
@@ -23,6 +50,36 @@ func (m *Manager) Config() *Config {
 	return m.config
 }
 
+// KeyRing returns the key ring used to sign cookie tokens, or nil when the
+// cookie store is disabled. Rotating or retiring keys on it takes effect
+// immediately.
+func (m *Manager) KeyRing() *KeyRing {
+	if m.cookieStore == nil {
+		return nil
+	}
+	return m.cookieStore.KeyRing()
+}
+
+// SetSessionKeys replaces the keys of KeyRing with a key ring in the
+// ParseKeyRing format, keeping Config.Secret for verification. It
+// implements core.SessionKeySetter.
+func (m *Manager) SetSessionKeys(keys string) error {
+	ring, err := ParseKeyRing(keys)
+	if err != nil {
+		return err
+	}
+	if m.cookieStore == nil {
+		return nil // Only cookie tokens are signed
+	}
+	replacement := ring.Keys()
+	if m.config.Secret != "" {
+		if _, ok := ring.Lookup(""); !ok {
+			replacement = append(replacement, Key{Secret: []byte(m.config.Secret)})
+		}
+	}
+	return m.cookieStore.KeyRing().Replace(replacement...)
+}
+
 // NewManager creates a new session manager
 func NewManager(config *Config, dbAdapter core.Adapter) (*Manager, error) {
 	if config == nil {
@@ -35,51 +92,193 @@ func NewManager(config *Config, dbAdapter core.Adapter) (*Manager, error) {
 
 	// Initialize cookie store if enabled
 	if config.EnableCookieStore {
-		m.cookieStore = NewCookieStore(config.Secret, config.Issuer)
+		keys := config.KeyRing
+		if keys != nil {
+			if config.Secret != "" {
+				keys.appendKey(Key{Secret: []byte(config.Secret)})
+			}
+		} else {
+			keys = &KeyRing{keys: []Key{{Secret: []byte(config.Secret)}}}
+		}
+		m.cookieStore = NewCookieStoreWithOptions(keys, config.Issuer, &CookieStoreOptions{
+			Encrypt:        config.EncryptCookies,
+			UserClaims:     config.CookieUserClaims,
+			ClaimsEnricher: config.ClaimsEnricher,
+			MaxClaimsSize:  config.MaxClaimsSize,
+		})
 	}
 
 	// Initialize Redis store if enabled
-	if config.EnableRedisStore && config.RedisAddr != "" {
-		redisStore, err := NewRedisStore(
-			config.RedisAddr,
-			config.RedisPassword,
-			config.RedisDB,
+	if config.EnableRedisStore && (config.RedisAddr != "" || config.Redis != nil) {
+		redisStore, err := NewRedisStoreWithOptions(
+			config.redisOptions(),
 			config.RedisPrefix,
 			config.ExpiresIn,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create Redis store: %w", err)
 		}
-		m.redisStore = redisStore
+		m.cacheStore = redisStore
+	}
+
+	// Initialize Memcached store if enabled
+	if config.EnableMemcachedStore && len(config.MemcachedServers) > 0 {
+		if m.cacheStore != nil {
+			return nil, fmt.Errorf("only one of the Redis and Memcached stores can be enabled")
+		}
+		memcachedStore, err := NewMemcachedStore(
+			config.MemcachedServers,
+			config.MemcachedPrefix,
+			config.ExpiresIn,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Memcached store: %w", err)
+		}
+		m.cacheStore = memcachedStore
 	}
 
 	// Initialize DB store if enabled
 	if config.EnableDBStore && dbAdapter != nil {
-		m.dbStore = NewDBStore(dbAdapter)
+		m.dbStore = NewDBStoreWithOptions(dbAdapter, &DBStoreOptions{
+			TableNames:        config.TableNames,
+			Users:             config.Users,
+			UserCache:         config.UserCache,
+			HashTokens:        config.HashDBTokens,
+			AcceptPlainTokens: config.AcceptPlainDBTokens,
+		})
+	}
+
+	layers, err := m.buildLayers()
+	if err != nil {
+		return nil, err
+	}
+	m.layers = layers
+
+	if config.MaxSessionsPerUser > 0 {
+		switch config.SessionLimitStrategy {
+		case "", core.SessionLimitRejectNew, core.SessionLimitEvictOldest, core.SessionLimitEvictOthers:
+		default:
+			return nil, fmt.Errorf("unknown session limit strategy: %s", config.SessionLimitStrategy)
+		}
+		if m.sessionLister() == nil {
+			return nil, fmt.Errorf("session limit requires a session store that can list sessions (Redis, Memcached, database or a custom SessionLister)")
+		}
+	}
+
+	if err := config.Binding.Validate(); err != nil {
+		return nil, err
+	}
+
+	proxies, err := core.ParseTrustedProxies(config.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	m.proxies = proxies
+
+	if config.KeepRecentSessions < 0 {
+		return nil, fmt.Errorf("kept sessions per user cannot be negative")
+	}
+	if config.KeepRecentSessions > 0 && m.sessionLister() == nil {
+		return nil, fmt.Errorf("session pruning requires a session store that can list sessions (Redis, Memcached, database or a custom SessionLister)")
+	}
+
+	if config.UpdateBatchSize < 0 || config.UpdateFlushInterval < 0 {
+		return nil, fmt.Errorf("update batch size and flush interval cannot be negative")
+	}
+
+	if config.IdleTimeout < 0 {
+		return nil, fmt.Errorf("idle timeout cannot be negative")
+	}
+	if config.IdleTimeout > 0 {
+		if !m.hasActivityStore() {
+			return nil, fmt.Errorf("idle timeout requires a session store that records activity (Redis, Memcached, database or a custom ActivityStore)")
+		}
+		interval := config.activityFlushInterval()
+		if interval >= config.IdleTimeout {
+			return nil, fmt.Errorf("activity flush interval (%s) must be shorter than idle timeout (%s)", interval, config.IdleTimeout)
+		}
+
+		m.activity = newActivityTracker()
+		m.stopActivity = make(chan struct{})
+		m.activityDone = make(chan struct{})
+		go m.runActivityFlusher(interval)
+	}
+
+	if config.BatchUpdates {
+		size := config.UpdateBatchSize
+		if size == 0 {
+			size = DefaultUpdateBatchSize
+		}
+		m.updates = newUpdateBatcher(size)
+		m.stopUpdates = make(chan struct{})
+		m.updatesDone = make(chan struct{})
+		go m.runUpdateFlusher(config.updateFlushInterval())
 	}
 
 	// Determine strategy
 	m.strategy = m.determineStrategy()
 
+	if err := m.startRevocations(); err != nil {
+		_ = m.Close()
+		return nil, err
+	}
+
 	return m, nil
 }
 
+// DescribeSecurity reports the storage strategy and session protections for
+// the security posture summary
+func (m *Manager) DescribeSecurity() map[string]interface{} {
+	desc := map[string]interface{}{
+		"strategy":       string(m.strategy),
+		"expiresIn":      m.config.ExpiresIn.String(),
+		"absoluteExpiry": m.config.AbsoluteExpiry,
+		"binding":        m.config.Binding.Enabled(),
+		"keyRotation":    m.config.KeyRing != nil,
+		// Only the database store hashes tokens; cache stores key by them
+		"tokenHashing": m.dbStore != nil && m.dbStore.hashTokens,
+	}
+	if m.dbStore != nil && m.dbStore.hashTokens {
+		desc["plainTokensAccepted"] = m.dbStore.acceptPlain
+	}
+	if m.cookieStore != nil {
+		desc["cookieEncryption"] = m.config.EncryptCookies
+	}
+	if m.config.IdleTimeout > 0 {
+		desc["idleTimeout"] = m.config.IdleTimeout.String()
+	}
+	if m.config.MaxSessionsPerUser > 0 {
+		desc["maxSessionsPerUser"] = m.config.MaxSessionsPerUser
+	}
+	if m.config.KeepRecentSessions > 0 {
+		desc["keepRecentSessions"] = m.config.KeepRecentSessions
+	}
+	return desc
+}
+
 // determineStrategy determines the storage strategy based on enabled stores
 func (m *Manager) determineStrategy() Strategy {
+	if len(m.config.Stores) > 0 {
+		return StrategyCustom
+	}
+
 	cookieEnabled := m.cookieStore != nil
-	redisEnabled := m.redisStore != nil
+	cacheEnabled := m.cacheStore != nil
 	dbEnabled := m.dbStore != nil
 
-	if cookieEnabled && !redisEnabled && !dbEnabled {
+	if cookieEnabled && !cacheEnabled && !dbEnabled {
 		return StrategyCookieOnly
 	}
-	if redisEnabled && !dbEnabled {
+	if cacheEnabled && !dbEnabled {
 		return StrategyRedisOnly
 	}
-	if dbEnabled && !redisEnabled {
+	if dbEnabled && !cacheEnabled {
 		return StrategyDBOnly
 	}
-	if redisEnabled && dbEnabled {
+	if cacheEnabled && dbEnabled {
+		if m.layers[0].name == StoreDB {
+			return StrategyDBFirst
+		}
 		return StrategyRedisFirst // Default when both are enabled
 	}
 
@@ -87,85 +286,284 @@ func (m *Manager) determineStrategy() Strategy {
 }
 
 // Get retrieves a session using the multi-layer strategy
-// Lookup order: Cookie → Redis → Database
+// Lookup order: Cookie → Cache (Redis or Memcached) → Database, or the
+// order set by Config.StoreOrder
+//
+// When Binding is set, sessions used by a client that does not match the
+// one that created them are rejected with core.ErrSessionBinding.
+//
+// When Tenancy is set, sessions of another tenant than the lookup
+// context's are reported as core.ErrSessionNotFound, whichever store holds
+// them.
+//
+// Sessions of banned users are rejected with a *core.BanError and revoked,
+// unless OnBan is core.BanReject.
+//
+// When IdleTimeout is set, sessions inactive for longer than the timeout are
+// revoked and reported as core.ErrSessionNotFound; otherwise the request is
+// recorded as activity.
 func (m *Manager) Get(ctx context.Context, token string) (*core.Session, *core.User, error) {
-	switch m.strategy {
-	case StrategyCookieOnly:
-		return m.getFromCookie(ctx, token)
+	session, user, err := m.get(ctx, token)
+	if err != nil || session == nil {
+		return session, user, err
+	}
 
-	case StrategyRedisOnly:
-		return m.getFromRedis(ctx, token)
+	if m.config.Tenancy {
+		if tenantID, _ := core.TenantFromContext(ctx); session.TenantID != tenantID {
+			return nil, nil, core.ErrSessionNotFound
+		}
+	}
 
-	case StrategyDBOnly:
-		return m.getFromDB(ctx, token)
+	if err := m.checkBinding(ctx, session); err != nil {
+		return nil, nil, err
+	}
 
-	case StrategyRedisFirst:
-		// Try Redis first
-		session, user, err := m.getFromRedis(ctx, token)
-		if err == nil && session != nil {
-			return session, user, nil
-		}
+	if err := m.checkBan(ctx, session, user); err != nil {
+		return nil, nil, err
+	}
 
-		// Fallback to database
-		session, user, err = m.getFromDB(ctx, token)
-		if err != nil || session == nil {
-			return nil, nil, err
+	if m.activity == nil {
+		return session, user, nil
+	}
+
+	now := time.Now()
+	if m.isIdle(session, now) {
+		_ = m.Delete(ctx, token) // Best effort, the session is rejected either way
+		return nil, nil, core.ErrSessionNotFound
+	}
+	m.activity.touch(token, now)
+
+	return session, user, nil
+}
+
+// checkBinding compares the requesting client with the session's
+// fingerprint. Sessions created before binding was enabled, and lookups
+// without client information, are not checked.
+func (m *Manager) checkBinding(ctx context.Context, session *core.Session) error {
+	if !m.config.Binding.Enabled() || session.Fingerprint == "" {
+		return nil
+	}
+
+	info, ok := m.clientInfo(ctx)
+	if !ok {
+		return nil
+	}
+
+	if m.config.Binding.Fingerprint(info.IPAddress, info.UserAgent) == session.Fingerprint {
+		return nil
+	}
+
+	_ = core.EmitSecurityEvent(ctx, m.config.SecurityEvents, &core.SecurityEvent{
+		Type:      core.EventSessionBindingViolation,
+		UserID:    session.UserID,
+		SessionID: session.ID,
+		IPAddress: info.IPAddress,
+		UserAgent: info.UserAgent,
+		Reason:    "client does not match the session fingerprint",
+		Metadata:  map[string]interface{}{"onMismatch": string(m.config.Binding.OnMismatch)},
+	})
+
+	if m.config.Binding.OnMismatch != core.BindingReauthenticate {
+		_ = m.Delete(ctx, session.Token) // Best effort, the session is rejected either way
+	}
+	return core.ErrSessionBinding
+}
+
+// TrustedProxies returns the proxies whose forwarding headers are believed
+func (m *Manager) TrustedProxies() core.TrustedProxies {
+	return m.proxies
+}
+
+// ClientInfo extracts the client of a request, believing forwarding
+// headers only from Config.TrustedProxies
+func (m *Manager) ClientInfo(r *http.Request) core.ClientInfo {
+	return m.proxies.ClientInfo(r)
+}
+
+// clientInfo returns the client of a lookup, from core.WithClientInfo or
+// the request in the context
+func (m *Manager) clientInfo(ctx context.Context) (core.ClientInfo, bool) {
+	if info, ok := core.GetClientInfo(ctx); ok {
+		return info, true
+	}
+	if req := core.GetRequest(ctx); req != nil {
+		return m.ClientInfo(req), true
+	}
+	return core.ClientInfo{}, false
+}
+
+// checkBan rejects users with an active ban, revoking their session unless
+// OnBan is core.BanReject, and lifts temporary bans that have ended.
+// session is nil when a session is being created. Users that are not known,
+// because no store holds them, are not checked.
+func (m *Manager) checkBan(ctx context.Context, session *core.Session, user *core.User) error {
+	now := time.Now()
+	if core.BanEnded(user, now) {
+		m.liftBan(ctx, user)
+		return nil
+	}
+	ban := core.ActiveBan(user, now)
+	if ban == nil {
+		return nil
+	}
+
+	event := &core.SecurityEvent{
+		Type:     core.EventBannedUserRejected,
+		UserID:   user.ID,
+		Email:    user.Email,
+		Reason:   "sign-in of a banned user",
+		Metadata: map[string]interface{}{},
+	}
+	if ban.Reason != "" {
+		event.Metadata["banReason"] = ban.Reason
+	}
+	if ban.Expires != nil {
+		event.Metadata["banExpires"] = ban.Expires.UTC().Format(time.RFC3339)
+	}
+	if info, ok := m.clientInfo(ctx); ok {
+		event.IPAddress = info.IPAddress
+		event.UserAgent = info.UserAgent
+	}
+	if session != nil {
+		event.Reason = "session of a banned user"
+		event.SessionID = session.ID
+		event.Metadata["onBan"] = string(m.config.OnBan)
+		if m.config.OnBan != core.BanReject {
+			_ = m.Delete(ctx, session.Token) // Best effort, the session is rejected either way
 		}
+	}
+	_ = core.EmitSecurityEvent(ctx, m.config.SecurityEvents, event)
 
-		// Cache in Redis if available (best effort - ignore errors)
-		if m.redisStore != nil {
-			_ = m.redisStore.SetWithUser(ctx, session, user)
+	return ban
+}
+
+// liftBan clears a temporary ban that has ended from the users table and
+// reports it once, whichever instance lifts it first
+func (m *Manager) liftBan(ctx context.Context, user *core.User) {
+	expired := user.BanExpires
+	user.Banned = false
+	user.BanReason = ""
+	user.BanExpires = nil
+
+	if m.dbStore == nil {
+		return
+	}
+	if cache := m.config.UserCache; cache != nil {
+		defer cache.InvalidateUser(ctx, user.ID)
+	}
+	internal := m.dbStore.internal
+	if users := internal.UserStore(); users != nil {
+		// The store cannot update conditionally, so every instance that
+		// sees the ended ban reports it
+		if _, err := users.UpdateUser(ctx, user.ID, map[string]interface{}{
+			"banned":      false,
+			"ban_reason":  nil,
+			"ban_expires": nil,
+		}); err != nil {
+			return // Retried on the next lookup
 		}
+		m.emitUnbanned(ctx, user, expired)
+		return
+	}
+	query := core.NewQuery(internal.Table(core.ModelUsers)).
+		Where("id", core.OpEqual, user.ID).
+		Where("banned", core.OpEqual, true).
+		Build()
+	lifted, err := internal.Adapter().UpdateMany(ctx, query, map[string]interface{}{
+		"banned":      false,
+		"ban_reason":  nil,
+		"ban_expires": nil,
+		"updated_at":  time.Now(),
+	})
+	if err != nil || lifted == 0 {
+		return // Retried on the next lookup
+	}
+	m.emitUnbanned(ctx, user, expired)
+}
 
-		return session, user, nil
+// emitUnbanned reports a temporary ban that ended
+func (m *Manager) emitUnbanned(ctx context.Context, user *core.User, expired *time.Time) {
+	_ = core.EmitSecurityEvent(ctx, m.config.SecurityEvents, &core.SecurityEvent{
+		Type:     core.EventUserUnbanned,
+		UserID:   user.ID,
+		Email:    user.Email,
+		Reason:   "temporary ban ended",
+		Metadata: map[string]interface{}{"banExpires": expired.UTC().Format(time.RFC3339)},
+	})
+}
 
-	case StrategyDBFirst:
-		// Try database first
-		session, user, err := m.getFromDB(ctx, token)
-		if err == nil && session != nil {
-			// Cache in Redis (best effort - ignore errors)
-			if m.redisStore != nil {
-				_ = m.redisStore.SetWithUser(ctx, session, user)
-			}
-			return session, user, nil
+// get looks a session up in the storage layers. A session found in a later
+// store is copied into earlier stores that implement UserStore. When no
+// store has the session, the last store's error is returned.
+func (m *Manager) get(ctx context.Context, token string) (*core.Session, *core.User, error) {
+	if len(m.layers) == 0 {
+		return m.getFromCookie(ctx, token)
+	}
+
+	token = m.serverToken(ctx, token)
+
+	var lastErr error
+	for i, l := range m.layers {
+		session, user, err := l.store.Get(ctx, token)
+		if err != nil || session == nil {
+			lastErr = err
+			continue
+		}
+		if m.updates != nil {
+			m.updates.apply(session)
 		}
 
-		// Fallback to Redis (shouldn't happen normally)
-		return m.getFromRedis(ctx, token)
+		// Cache the session in earlier stores (best effort - ignore errors)
+		for _, earlier := range m.layers[:i] {
+			if cache, ok := earlier.store.(UserStore); ok {
+				_ = cache.SetWithUser(ctx, session, user)
+			}
+		}
 
-	default:
-		return nil, nil, fmt.Errorf("unknown strategy: %v", m.strategy)
+		return session, user, nil
 	}
+
+	return nil, nil, lastErr
 }
 
-// getFromCookie retrieves session from cookie store
-func (m *Manager) getFromCookie(ctx context.Context, token string) (*core.Session, *core.User, error) {
+// serverToken maps a signed cookie token to the session token the server
+// layers are keyed by. Tokens that are not valid cookie tokens, such as raw
+// session tokens, are returned unchanged.
+func (m *Manager) serverToken(ctx context.Context, token string) string {
 	if m.cookieStore == nil {
-		return nil, nil, nil
+		return token
 	}
-	return m.cookieStore.Get(ctx, token)
+	session, _, err := m.cookieStore.Get(ctx, token)
+	if err != nil || session == nil || session.Token == "" {
+		return token
+	}
+	return session.Token
 }
 
-// getFromRedis retrieves session from Redis store
-func (m *Manager) getFromRedis(ctx context.Context, token string) (*core.Session, *core.User, error) {
-	if m.redisStore == nil {
-		return nil, nil, nil
+// Claims returns the custom claims the ClaimsEnricher embedded in a
+// cookie token. It only verifies the token; use Get to check the session
+// is still valid. Session tokens of server-side stores have no claims.
+func (m *Manager) Claims(token string) (map[string]any, error) {
+	if m.cookieStore == nil {
+		return nil, nil
 	}
-	return m.redisStore.Get(ctx, token)
+	return m.cookieStore.Claims(token)
 }
 
-// getFromDB retrieves session from database store
-func (m *Manager) getFromDB(ctx context.Context, token string) (*core.Session, *core.User, error) {
-	if m.dbStore == nil {
+// getFromCookie retrieves session from cookie store
+func (m *Manager) getFromCookie(ctx context.Context, token string) (*core.Session, *core.User, error) {
+	if m.cookieStore == nil {
 		return nil, nil, nil
 	}
-	return m.dbStore.Get(ctx, token)
+	return m.cookieStore.Get(ctx, token)
 }
 
-// Create creates a new session and stores it in all enabled layers
+// Create creates a new session and stores it in all enabled layers.
+// Banned users are refused with a *core.BanError.
 func (m *Manager) Create(ctx context.Context, userID string, opts *core.SessionOptions) (*core.Session, *core.User, string, error) {
 	// Calculate expiration
-	expiresAt := time.Now().Add(m.config.ExpiresIn)
+	transient := opts != nil && opts.Transient
+	expiresAt := time.Now().Add(m.lifetime(transient))
 	if opts != nil && opts.ExpiresIn != nil {
 		expiresAt = time.Now().Add(*opts.ExpiresIn)
 	}
@@ -196,6 +594,15 @@ func (m *Manager) Create(ctx context.Context, userID string, opts *core.SessionO
 		session.IPAddress = opts.IPAddress
 		session.UserAgent = opts.UserAgent
 	}
+	if transient {
+		session.Metadata = map[string]interface{}{core.MetadataRememberMe: false}
+	}
+	if m.config.Binding.Enabled() {
+		session.Fingerprint = m.config.Binding.Fingerprint(session.IPAddress, session.UserAgent)
+	}
+	if m.config.Tenancy {
+		session.TenantID, _ = core.TenantFromContext(ctx)
+	}
 
 	// Get user data - use pre-fetched user if provided, otherwise lookup
 	var user *core.User
@@ -210,30 +617,244 @@ func (m *Manager) Create(ctx context.Context, userID string, opts *core.SessionO
 		}
 	}
 
-	// Store in all enabled layers
-	if m.dbStore != nil {
-		if err := m.dbStore.Set(ctx, session); err != nil {
-			return nil, nil, "", fmt.Errorf("failed to store session in database: %w", err)
+	if err := m.checkBan(ctx, nil, user); err != nil {
+		return nil, nil, "", err
+	}
+
+	if err := m.enforceSessionLimit(ctx, userID); err != nil {
+		return nil, nil, "", err
+	}
+
+	// Issue the token first, so a failing claims enricher stores nothing
+	token, err = m.issueToken(ctx, session, user)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	var tx core.Adapter
+	if opts != nil {
+		tx = opts.Tx
+	}
+	if err := m.store(ctx, session, user, tx); err != nil {
+		return nil, nil, "", err
+	}
+
+	if m.config.KeepRecentSessions > 0 {
+		_ = m.PruneUserSessions(ctx, userID) // Best effort, retried on the next sign-in
+	}
+
+	return session, user, token, nil
+}
+
+// Rotate replaces the session identified by oldToken with a new session
+// carrying a fresh ID and token, then revokes the old one. The new session
+// keeps the user, expiry, client details and metadata. Call it whenever a
+// session gains privileges (sign-in over an existing session, 2FA, role
+// changes) so a token planted or captured earlier cannot ride the upgrade.
+//
+// If the old session cannot be revoked the new one is removed again and
+// the old token stays valid. Stateless cookie-only sessions cannot be
+// revoked server-side; the old token remains valid until it expires.
+func (m *Manager) Rotate(ctx context.Context, oldToken string) (*core.Session, *core.User, string, error) {
+	m.rotateMu.Lock()
+	defer m.rotateMu.Unlock()
+
+	old, user, err := m.Get(ctx, oldToken)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if old == nil {
+		return nil, nil, "", core.ErrSessionNotFound
+	}
+
+	sessionID, err := generateID()
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to generate session ID: %w", err)
+	}
+	token, err := generateToken()
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	rotated := *old
+	rotated.ID = sessionID
+	rotated.Token = token
+	rotated.UpdatedAt = time.Now()
+
+	issued, err := m.issueToken(ctx, &rotated, user)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	if err := m.store(ctx, &rotated, user, nil); err != nil {
+		return nil, nil, "", err
+	}
+
+	if err := m.Delete(ctx, old.Token); err != nil {
+		_ = m.Delete(ctx, rotated.Token) // Keep the old session as the only valid one
+		return nil, nil, "", fmt.Errorf("failed to revoke rotated session: %w", err)
+	}
+	if m.activity != nil {
+		m.activity.forget(oldToken)
+	}
+
+	return &rotated, user, issued, nil
+}
+
+// store writes a session to all layers, last first so earlier (cache)
+// layers never hold a session that later layers are missing. A non-nil tx
+// is used for the database store.
+func (m *Manager) store(ctx context.Context, session *core.Session, user *core.User, tx core.Adapter) error {
+	for i := len(m.layers) - 1; i >= 0; i-- {
+		l := m.layers[i]
+		var err error
+		if db, ok := l.store.(*DBStore); ok && tx != nil {
+			err = db.withAdapter(tx).Set(ctx, session)
+		} else if cache, ok := l.store.(UserStore); ok {
+			err = cache.SetWithUser(ctx, session, user)
+		} else {
+			err = l.store.Set(ctx, session)
 		}
+		if err != nil {
+			return fmt.Errorf("failed to store session in %s store: %w", l.name, err)
+		}
+	}
+	return nil
+}
+
+// issueToken returns the token handed to the client: a signed cookie token
+// when the cookie store is enabled, otherwise the session token
+func (m *Manager) issueToken(ctx context.Context, session *core.Session, user *core.User) (string, error) {
+	if m.cookieStore == nil {
+		return session.Token, nil
 	}
+	token, err := m.cookieStore.CreateTokenContext(ctx, session, user)
+	if err != nil {
+		return "", fmt.Errorf("failed to create cookie token: %w", err)
+	}
+	return token, nil
+}
 
-	if m.redisStore != nil {
-		if err := m.redisStore.SetWithUser(ctx, session, user); err != nil {
-			return nil, nil, "", fmt.Errorf("failed to store session in Redis: %w", err)
+// enforceSessionLimit makes room for a new session according to
+// MaxSessionsPerUser, or returns core.ErrSessionLimit when the
+// strategy is to reject new sessions
+func (m *Manager) enforceSessionLimit(ctx context.Context, userID string) error {
+	limit := m.config.MaxSessionsPerUser
+	if limit <= 0 {
+		return nil
+	}
+
+	sessions, err := m.ListByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to list user sessions: %w", err)
+	}
+	if len(sessions) < limit {
+		return nil
+	}
+
+	switch m.config.SessionLimitStrategy {
+	case core.SessionLimitRejectNew:
+		return core.ErrSessionLimit
+
+	case core.SessionLimitEvictOthers:
+		if err := m.DeleteByUserID(ctx, userID); err != nil {
+			return fmt.Errorf("failed to revoke user sessions: %w", err)
+		}
+
+	default:
+		// Evict the oldest sessions, leaving room for the new one
+		for _, session := range sessions[:len(sessions)-limit+1] {
+			if err := m.deleteListed(ctx, session); err != nil {
+				return fmt.Errorf("failed to revoke session: %w", err)
+			}
 		}
 	}
 
-	// Generate cookie token if cookie store is enabled
-	var cookieToken string
-	if m.cookieStore != nil {
-		cookieToken, err = m.cookieStore.CreateToken(session, user)
+	return nil
+}
+
+// PruneUserSessions revokes a user's sessions beyond the KeepRecentSessions
+// most recently active ones. It runs automatically when a session is
+// created and can also be called directly, e.g. from a maintenance job.
+func (m *Manager) PruneUserSessions(ctx context.Context, userID string) error {
+	keep := m.config.KeepRecentSessions
+	if keep <= 0 {
+		return nil
+	}
+
+	sessions, err := m.ListByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to list user sessions: %w", err)
+	}
+	if len(sessions) <= keep {
+		return nil
+	}
+
+	// Most recently active first
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return m.lastActivity(sessions[i]).After(m.lastActivity(sessions[j]))
+	})
+
+	var lastErr error
+	for _, session := range sessions[keep:] {
+		if err := m.deleteListed(ctx, session); err != nil {
+			lastErr = fmt.Errorf("failed to revoke session: %w", err)
+		}
+	}
+
+	return lastErr
+}
+
+// deleteListed revokes a session returned by ListByUserID. A database
+// store hashing tokens lists sessions by their stored token, which is not
+// a token: the session is revoked by its token in the other stores that
+// list it, or else deleted from the database by its stored token.
+func (m *Manager) deleteListed(ctx context.Context, session *core.Session) error {
+	if !strings.HasPrefix(session.Token, HashedTokenPrefix) {
+		return m.Delete(ctx, session.Token)
+	}
+
+	var hashed []*DBStore
+	for _, l := range m.layers {
+		if db, ok := l.store.(*DBStore); ok && db.hashTokens {
+			hashed = append(hashed, db)
+			continue
+		}
+		lister, ok := l.store.(SessionLister)
+		if !ok {
+			continue
+		}
+		listed, err := lister.ListByUserID(ctx, session.UserID)
 		if err != nil {
-			return nil, nil, "", fmt.Errorf("failed to create cookie token: %w", err)
+			return err
+		}
+		for _, s := range listed {
+			if s.ID == session.ID {
+				return m.Delete(ctx, s.Token)
+			}
 		}
-		token = cookieToken // Use cookie token as the primary token
 	}
 
-	return session, user, token, nil
+	// No other store holds the session
+	var lastErr error
+	for _, db := range hashed {
+		if err := db.deleteStored(ctx, session.Token); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// ListByUserID returns a user's active sessions, oldest first, from the
+// last store in lookup order that implements SessionLister. Cookie-only
+// sessions are stateless and cannot be listed, so nil is returned for them.
+// Sessions listed by a database store hashing tokens carry their stored
+// token (HashedTokenPrefix), which cannot be used to revoke them.
+func (m *Manager) ListByUserID(ctx context.Context, userID string) ([]*core.Session, error) {
+	if lister := m.sessionLister(); lister != nil {
+		return lister.ListByUserID(ctx, userID)
+	}
+	return nil, nil
 }
 
 // Update updates a session's expiration time
@@ -244,64 +865,157 @@ func (m *Manager) Update(ctx context.Context, session *core.Session) error {
 	}
 
 	// Update expiration time
+	expiresAt := session.ExpiresAt
 	if !m.config.AbsoluteExpiry {
-		session.ExpiresAt = time.Now().Add(m.config.ExpiresIn)
+		session.ExpiresAt = time.Now().Add(m.lifetime(isTransient(session)))
 	}
 	session.UpdatedAt = time.Now()
 
-	// Update in all enabled layers
-	if m.dbStore != nil {
-		if err := m.dbStore.Set(ctx, session); err != nil {
-			return fmt.Errorf("failed to update session in database: %w", err)
+	if m.batchUpdate(session, expiresAt) {
+		return nil
+	}
+
+	// Update in all layers, last first
+	for i := len(m.layers) - 1; i >= 0; i-- {
+		l := m.layers[i]
+		if err := l.store.Set(ctx, session); err != nil {
+			return fmt.Errorf("failed to update session in %s store: %w", l.name, err)
 		}
 	}
 
-	if m.redisStore != nil {
-		if err := m.redisStore.Set(ctx, session); err != nil {
-			return fmt.Errorf("failed to update session in Redis: %w", err)
+	return nil
+}
+
+// lifetime returns how long new and renewed sessions last
+func (m *Manager) lifetime(transient bool) time.Duration {
+	if transient && m.config.ShortExpiresIn > 0 {
+		return m.config.ShortExpiresIn
+	}
+	return m.config.ExpiresIn
+}
+
+// isTransient reports whether session was signed in without remember me
+func isTransient(session *core.Session) bool {
+	remember, ok := session.Metadata[core.MetadataRememberMe].(bool)
+	return ok && !remember
+}
+
+// SetMetadata sets key in the metadata of the session with token, such as
+// the active organization, a UI preference or a step-up flag, in every
+// server-side store. A nil value removes the key. Values must encode to
+// JSON and are read back decoded, so numbers become float64. Concurrent
+// updates of one session's metadata are last-write-wins.
+//
+// Stateless cookie-only sessions cannot be updated; SetMetadata returns
+// core.ErrMetadataUnsupported for them.
+func (m *Manager) SetMetadata(ctx context.Context, token, key string, value interface{}) error {
+	if key == "" {
+		return fmt.Errorf("session metadata key is required")
+	}
+	if len(m.layers) == 0 {
+		return core.ErrMetadataUnsupported
+	}
+	if value != nil {
+		if _, err := json.Marshal(value); err != nil {
+			return fmt.Errorf("session metadata %q: %w", key, err)
 		}
 	}
 
+	session, _, err := m.Get(ctx, token)
+	if err != nil {
+		return err
+	}
+	if session == nil {
+		return core.ErrSessionNotFound
+	}
+
+	metadata := make(map[string]interface{}, len(session.Metadata)+1)
+	for k, v := range session.Metadata {
+		metadata[k] = v
+	}
+	if value == nil {
+		delete(metadata, key)
+	} else {
+		metadata[key] = value
+	}
+	updated := *session
+	updated.Metadata = metadata
+
+	// Update in all layers, last first
+	for i := len(m.layers) - 1; i >= 0; i-- {
+		l := m.layers[i]
+		if store, ok := l.store.(MetadataStore); ok {
+			err = store.SetMetadata(ctx, updated.Token, metadata)
+		} else {
+			err = l.store.Set(ctx, &updated)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update session metadata in %s store: %w", l.name, err)
+		}
+	}
 	return nil
 }
 
-// Delete removes a session from all layers
+// GetMetadata returns the value of key in the metadata of the session with
+// token, or nil when it is not set
+func (m *Manager) GetMetadata(ctx context.Context, token, key string) (interface{}, error) {
+	session, _, err := m.Get(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, core.ErrSessionNotFound
+	}
+	return session.Metadata[key], nil
+}
+
+// Delete removes a session from all layers and broadcasts the revocation
+// to the other managers
 func (m *Manager) Delete(ctx context.Context, token string) error {
 	var lastErr error
 
-	if m.dbStore != nil {
-		if err := m.dbStore.Delete(ctx, token); err != nil {
-			lastErr = err
-		}
+	if m.activity != nil {
+		m.activity.forget(token)
 	}
 
-	if m.redisStore != nil {
-		if err := m.redisStore.Delete(ctx, token); err != nil {
+	serverToken := m.serverToken(ctx, token)
+	if m.updates != nil {
+		m.updates.forget(serverToken)
+	}
+	for _, l := range m.layers {
+		if err := l.store.Delete(ctx, serverToken); err != nil {
 			lastErr = err
 		}
 	}
 
 	// Cookie deletion happens client-side
 
+	if err := m.publishRevocation(ctx, revocation{Token: serverToken}); err != nil {
+		lastErr = err
+	}
+
 	return lastErr
 }
 
-// DeleteByUserID removes all sessions for a user from all layers
+// DeleteByUserID removes all sessions for a user from all layers and
+// broadcasts the revocation to the other managers
 func (m *Manager) DeleteByUserID(ctx context.Context, userID string) error {
 	var lastErr error
 
-	if m.dbStore != nil {
-		if err := m.dbStore.DeleteByUserID(ctx, userID); err != nil {
-			lastErr = err
-		}
+	if m.updates != nil {
+		m.updates.forgetUser(userID)
 	}
 
-	if m.redisStore != nil {
-		if err := m.redisStore.DeleteByUserID(ctx, userID); err != nil {
+	for _, l := range m.layers {
+		if err := l.store.DeleteByUserID(ctx, userID); err != nil {
 			lastErr = err
 		}
 	}
 
+	if err := m.publishRevocation(ctx, revocation{UserID: userID}); err != nil {
+		lastErr = err
+	}
+
 	return lastErr
 }
 
@@ -309,14 +1023,8 @@ func (m *Manager) DeleteByUserID(ctx context.Context, userID string) error {
 func (m *Manager) Cleanup(ctx context.Context) error {
 	var lastErr error
 
-	if m.dbStore != nil {
-		if err := m.dbStore.Cleanup(ctx); err != nil {
-			lastErr = err
-		}
-	}
-
-	if m.redisStore != nil {
-		if err := m.redisStore.Cleanup(ctx); err != nil {
+	for _, l := range m.layers {
+		if err := l.store.Cleanup(ctx); err != nil {
 			lastErr = err
 		}
 	}
@@ -324,18 +1032,48 @@ func (m *Manager) Cleanup(ctx context.Context) error {
 	return lastErr
 }
 
-// Close closes all store connections
+// Close flushes buffered session updates and activity and closes all stores, including
+// custom ones
 func (m *Manager) Close() error {
+	return m.shutdown(context.Background(), true)
+}
+
+// Shutdown stops the background work of the manager, flushes buffered
+// session updates and activity within ctx and closes the stores. Unlike
+// Close, it leaves the database adapter open for its owner to close last.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	return m.shutdown(ctx, false)
+}
+
+func (m *Manager) shutdown(ctx context.Context, closeDB bool) error {
 	var lastErr error
 
-	if m.dbStore != nil {
-		if err := m.dbStore.Close(); err != nil {
-			lastErr = err
+	if err := m.stopRevocations(); err != nil {
+		lastErr = err
+	}
+
+	m.closeOnce.Do(func() {
+		if m.activity != nil {
+			close(m.stopActivity)
+			<-m.activityDone
 		}
+		if m.updates != nil {
+			close(m.stopUpdates)
+			<-m.updatesDone
+		}
+	})
+	if err := m.FlushUpdates(ctx); err != nil {
+		lastErr = err
+	}
+	if err := m.FlushActivity(ctx); err != nil {
+		lastErr = err
 	}
 
-	if m.redisStore != nil {
-		if err := m.redisStore.Close(); err != nil {
+	for _, l := range m.layers {
+		if l.name == StoreDB && !closeDB {
+			continue
+		}
+		if err := l.store.Close(); err != nil {
 			lastErr = err
 		}
 	}
@@ -349,6 +1087,25 @@ func (m *Manager) Close() error {
 	return lastErr
 }
 
+// Ping checks the connections of the stores that support it, such as
+// Redis and Memcached, and of the revocation broadcast. The database is
+// not checked; ping its adapter.
+func (m *Manager) Ping(ctx context.Context) error {
+	for _, l := range m.layers {
+		if pinger, ok := l.store.(interface{ Ping(context.Context) error }); ok {
+			if err := pinger.Ping(ctx); err != nil {
+				return fmt.Errorf("%s store: %w", l.name, err)
+			}
+		}
+	}
+	if m.revocations != nil {
+		if err := m.revocations.client.Ping(ctx).Err(); err != nil {
+			return fmt.Errorf("revocation broadcast: %w", err)
+		}
+	}
+	return nil
+}
+
 // Helper functions
 
 func generateID() (string, error) {
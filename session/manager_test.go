@@ -2,9 +2,14 @@ package session
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
+	"github.com/marshallshelly/beacon-auth/adapter"
 	"github.com/marshallshelly/beacon-auth/adapters/memory"
 	"github.com/marshallshelly/beacon-auth/core"
 )
@@ -374,3 +379,1210 @@ func TestManager_StrategyDetermination(t *testing.T) {
 		})
 	}
 }
+
+func TestManager_SessionLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		strategy   core.SessionLimitStrategy
+		wantErr    error
+		wantActive []int // indexes of sessions still active after the third Create
+	}{
+		{
+			name:       "reject new",
+			strategy:   core.SessionLimitRejectNew,
+			wantErr:    core.ErrSessionLimit,
+			wantActive: []int{0, 1},
+		},
+		{
+			name:       "evict oldest",
+			strategy:   core.SessionLimitEvictOldest,
+			wantActive: []int{1, 2},
+		},
+		{
+			name:       "evict others",
+			strategy:   core.SessionLimitEvictOthers,
+			wantActive: []int{2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter := memory.New()
+			defer adapter.Close()
+
+			config := DefaultConfig()
+			config.EnableRedisStore = false
+			config.EnableCookieStore = false
+			config.MaxSessionsPerUser = 2
+			config.SessionLimitStrategy = tt.strategy
+
+			manager, err := NewManager(config, adapter)
+			if err != nil {
+				t.Fatalf("Failed to create manager: %v", err)
+			}
+			defer manager.Close()
+
+			ctx := context.Background()
+			adapter.Create(ctx, "users", map[string]interface{}{
+				"id":    "user1",
+				"email": "test@example.com",
+			})
+
+			var tokens []string
+			for i := 0; i < 3; i++ {
+				_, _, token, err := manager.Create(ctx, "user1", nil)
+				if i == 2 && tt.wantErr != nil {
+					if !errors.Is(err, tt.wantErr) {
+						t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("Failed to create session %d: %v", i, err)
+				}
+				tokens = append(tokens, token)
+			}
+
+			active := make(map[int]bool)
+			for _, i := range tt.wantActive {
+				active[i] = true
+			}
+
+			for i, token := range tokens {
+				session, _, _ := manager.Get(ctx, token)
+				if got := session != nil; got != active[i] {
+					t.Errorf("Session %d active = %v, want %v", i, got, active[i])
+				}
+			}
+
+			sessions, err := manager.ListByUserID(ctx, "user1")
+			if err != nil {
+				t.Fatalf("Failed to list sessions: %v", err)
+			}
+			if len(sessions) != len(tt.wantActive) {
+				t.Errorf("Expected %d active sessions, got %d", len(tt.wantActive), len(sessions))
+			}
+		})
+	}
+}
+
+func TestManager_SessionLimitRequiresServerStore(t *testing.T) {
+	config := DefaultConfig()
+	config.Secret = "test-secret"
+	config.EnableRedisStore = false
+	config.EnableDBStore = false
+	config.MaxSessionsPerUser = 1
+
+	if _, err := NewManager(config, nil); err == nil {
+		t.Fatal("Expected error when limiting cookie-only sessions")
+	}
+}
+
+func TestManager_TableNames(t *testing.T) {
+	adapter := memory.New()
+	defer adapter.Close()
+
+	config := DefaultConfig()
+	config.EnableRedisStore = false
+	config.EnableCookieStore = false
+	config.TableNames = &core.TableNames{Users: "auth_users", Sessions: "auth_sessions"}
+
+	manager, err := NewManager(config, adapter)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer manager.Close()
+
+	ctx := context.Background()
+	adapter.Create(ctx, "auth_users", map[string]interface{}{
+		"id":    "user1",
+		"email": "test@example.com",
+	})
+
+	_, user, token, err := manager.Create(ctx, "user1", nil)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if user == nil || user.ID != "user1" {
+		t.Fatalf("Expected user1 from auth_users, got %+v", user)
+	}
+
+	if count, _ := adapter.Count(ctx, &core.Query{Model: "auth_sessions"}); count != 1 {
+		t.Errorf("Expected 1 row in auth_sessions, got %d", count)
+	}
+	if count, _ := adapter.Count(ctx, &core.Query{Model: "sessions"}); count != 0 {
+		t.Errorf("Expected default sessions table to be unused, got %d rows", count)
+	}
+
+	if session, _, err := manager.Get(ctx, token); err != nil || session == nil {
+		t.Errorf("Failed to get session from renamed table: %v", err)
+	}
+}
+
+func TestManager_CreateInTransaction(t *testing.T) {
+	adapter := memory.New()
+	defer adapter.Close()
+	tx := memory.New() // Stands in for a transaction adapter
+
+	config := DefaultConfig()
+	config.EnableRedisStore = false
+	config.EnableCookieStore = false
+	config.TableNames = &core.TableNames{Sessions: "auth_sessions"}
+
+	manager, err := NewManager(config, adapter)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer manager.Close()
+
+	ctx := context.Background()
+	_, _, _, err = manager.Create(ctx, "user1", &core.SessionOptions{
+		User: &core.User{ID: "user1"},
+		Tx:   tx,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	if count, _ := tx.Count(ctx, &core.Query{Model: "auth_sessions"}); count != 1 {
+		t.Errorf("Expected the session to be written with the transaction, got %d rows", count)
+	}
+	if count, _ := adapter.Count(ctx, &core.Query{Model: "auth_sessions"}); count != 0 {
+		t.Errorf("Expected no session written outside the transaction, got %d rows", count)
+	}
+}
+
+func TestManager_IdleTimeout(t *testing.T) {
+	adapter := memory.New()
+	defer adapter.Close()
+
+	config := DefaultConfig()
+	config.EnableRedisStore = false
+	config.EnableCookieStore = false
+	config.IdleTimeout = time.Hour
+	config.ActivityFlushInterval = time.Minute
+
+	manager, err := NewManager(config, adapter)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer manager.Close()
+
+	ctx := context.Background()
+	adapter.Create(ctx, "users", map[string]interface{}{
+		"id":    "user1",
+		"email": "test@example.com",
+	})
+
+	setLastActivity := func(token string, at time.Time) {
+		t.Helper()
+		query := &core.Query{
+			Model: "sessions",
+			Where: []core.WhereClause{{Field: "token", Operator: core.OpEqual, Value: token}},
+		}
+		if _, err := adapter.Update(ctx, query, map[string]interface{}{"updated_at": at}); err != nil {
+			t.Fatalf("Failed to set last activity: %v", err)
+		}
+	}
+	lastActivity := func(token string) time.Time {
+		t.Helper()
+		row, err := adapter.FindOne(ctx, &core.Query{
+			Model: "sessions",
+			Where: []core.WhereClause{{Field: "token", Operator: core.OpEqual, Value: token}},
+		})
+		if err != nil || row == nil {
+			t.Fatalf("Failed to find session row: %v", err)
+		}
+		return row["updated_at"].(time.Time)
+	}
+
+	t.Run("activity is batched", func(t *testing.T) {
+		_, _, token, err := manager.Create(ctx, "user1", nil)
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+
+		past := time.Now().Add(-30 * time.Minute)
+		setLastActivity(token, past)
+
+		if _, _, err := manager.Get(ctx, token); err != nil {
+			t.Fatalf("Failed to get session: %v", err)
+		}
+		if got := lastActivity(token); !got.Equal(past) {
+			t.Errorf("Expected no write before flush, last activity changed to %v", got)
+		}
+
+		if err := manager.FlushActivity(ctx); err != nil {
+			t.Fatalf("FlushActivity() error = %v", err)
+		}
+		if got := lastActivity(token); !got.After(past) {
+			t.Errorf("Expected last activity to advance after flush, got %v", got)
+		}
+	})
+
+	t.Run("idle session expires before ExpiresIn", func(t *testing.T) {
+		_, _, token, err := manager.Create(ctx, "user1", nil)
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+
+		setLastActivity(token, time.Now().Add(-2*time.Hour))
+
+		if _, _, err := manager.Get(ctx, token); !errors.Is(err, core.ErrSessionNotFound) {
+			t.Fatalf("Expected ErrSessionNotFound for idle session, got %v", err)
+		}
+		if count, _ := adapter.Count(ctx, &core.Query{
+			Model: "sessions",
+			Where: []core.WhereClause{{Field: "token", Operator: core.OpEqual, Value: token}},
+		}); count != 0 {
+			t.Error("Expected idle session to be revoked")
+		}
+	})
+
+	t.Run("buffered activity counts before flush", func(t *testing.T) {
+		_, _, token, err := manager.Create(ctx, "user1", nil)
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+
+		if _, _, err := manager.Get(ctx, token); err != nil {
+			t.Fatalf("Failed to get session: %v", err)
+		}
+		setLastActivity(token, time.Now().Add(-2*time.Hour))
+
+		if session, _, err := manager.Get(ctx, token); err != nil || session == nil {
+			t.Errorf("Expected recently active session to remain valid, got %v", err)
+		}
+	})
+}
+
+func TestManager_IdleTimeoutValidation(t *testing.T) {
+	config := DefaultConfig()
+	config.Secret = "test-secret"
+	config.EnableRedisStore = false
+	config.EnableDBStore = false
+	config.IdleTimeout = time.Hour
+
+	if _, err := NewManager(config, nil); err == nil {
+		t.Error("Expected error when tracking idle cookie-only sessions")
+	}
+
+	config = DefaultConfig()
+	config.EnableRedisStore = false
+	config.IdleTimeout = time.Minute
+	config.ActivityFlushInterval = time.Minute
+
+	if _, err := NewManager(config, memory.New()); err == nil {
+		t.Error("Expected error when flush interval is not shorter than idle timeout")
+	}
+}
+
+func TestManager_SessionBinding(t *testing.T) {
+	ctx := context.Background()
+	office := core.ClientInfo{IPAddress: "203.0.113.10", UserAgent: "Mozilla/5.0"}
+
+	newManager := func(t *testing.T, action core.BindingAction) *Manager {
+		t.Helper()
+		adapter := memory.New()
+		adapter.Create(ctx, "users", map[string]interface{}{
+			"id":    "user1",
+			"email": "test@example.com",
+		})
+
+		config := DefaultConfig()
+		config.EnableRedisStore = false
+		config.EnableCookieStore = false
+		config.Binding = &core.SessionBinding{
+			IP:         core.IPBindingSubnet,
+			UserAgent:  true,
+			OnMismatch: action,
+		}
+
+		manager, err := NewManager(config, adapter)
+		if err != nil {
+			t.Fatalf("Failed to create manager: %v", err)
+		}
+		t.Cleanup(func() { manager.Close() })
+		return manager
+	}
+
+	create := func(t *testing.T, manager *Manager) string {
+		t.Helper()
+		session, _, token, err := manager.Create(ctx, "user1", &core.SessionOptions{
+			IPAddress: office.IPAddress,
+			UserAgent: office.UserAgent,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		if session.Fingerprint == "" {
+			t.Fatal("Expected bound session to have a fingerprint")
+		}
+		return token
+	}
+
+	t.Run("tolerates IP change within subnet", func(t *testing.T) {
+		manager := newManager(t, "")
+		token := create(t, manager)
+
+		roamed := core.WithClientInfo(ctx, core.ClientInfo{IPAddress: "203.0.113.77", UserAgent: office.UserAgent})
+		if session, _, err := manager.Get(roamed, token); err != nil || session == nil {
+			t.Errorf("Expected session to remain valid in the same subnet, got %v", err)
+		}
+	})
+
+	t.Run("revokes on user agent change", func(t *testing.T) {
+		manager := newManager(t, core.BindingRevoke)
+		token := create(t, manager)
+
+		stolen := core.WithClientInfo(ctx, core.ClientInfo{IPAddress: office.IPAddress, UserAgent: "curl/8.0"})
+		if _, _, err := manager.Get(stolen, token); !errors.Is(err, core.ErrSessionBinding) {
+			t.Fatalf("Expected ErrSessionBinding, got %v", err)
+		}
+
+		// The session is revoked for the original client too
+		if _, _, err := manager.Get(core.WithClientInfo(ctx, office), token); err == nil {
+			t.Error("Expected revoked session to be gone")
+		}
+	})
+
+	t.Run("reauthenticate keeps session for original client", func(t *testing.T) {
+		manager := newManager(t, core.BindingReauthenticate)
+		token := create(t, manager)
+
+		elsewhere := core.WithClientInfo(ctx, core.ClientInfo{IPAddress: "198.51.100.1", UserAgent: office.UserAgent})
+		if _, _, err := manager.Get(elsewhere, token); !errors.Is(err, core.ErrSessionBinding) {
+			t.Fatalf("Expected ErrSessionBinding, got %v", err)
+		}
+
+		if session, _, err := manager.Get(core.WithClientInfo(ctx, office), token); err != nil || session == nil {
+			t.Errorf("Expected session to remain valid for the original client, got %v", err)
+		}
+	})
+}
+
+type eventSink struct {
+	events []*core.SecurityEvent
+}
+
+func (s *eventSink) Emit(_ context.Context, event *core.SecurityEvent) error {
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *eventSink) types() []core.SecurityEventType {
+	types := make([]core.SecurityEventType, len(s.events))
+	for i, event := range s.events {
+		types[i] = event.Type
+	}
+	return types
+}
+
+func TestManager_Bans(t *testing.T) {
+	ctx := context.Background()
+
+	newManager := func(t *testing.T, action core.BanAction) (*Manager, *memory.MemoryAdapter, *eventSink) {
+		t.Helper()
+		adapter := memory.New()
+		adapter.Create(ctx, "users", map[string]interface{}{
+			"id":    "user1",
+			"email": "test@example.com",
+		})
+
+		sink := &eventSink{}
+		config := DefaultConfig()
+		config.EnableRedisStore = false
+		config.EnableCookieStore = false
+		config.OnBan = action
+		config.SecurityEvents = sink
+
+		manager, err := NewManager(config, adapter)
+		if err != nil {
+			t.Fatalf("Failed to create manager: %v", err)
+		}
+		t.Cleanup(func() { manager.Close() })
+		return manager, adapter, sink
+	}
+
+	ban := func(t *testing.T, adapter *memory.MemoryAdapter, expires interface{}) {
+		t.Helper()
+		query := core.NewQuery("users").Where("id", core.OpEqual, "user1").Build()
+		if _, err := adapter.Update(ctx, query, map[string]interface{}{
+			"banned": true, "ban_reason": "spam", "ban_expires": expires,
+		}); err != nil {
+			t.Fatalf("Failed to ban user: %v", err)
+		}
+	}
+
+	t.Run("refuses sign-in", func(t *testing.T) {
+		manager, adapter, sink := newManager(t, "")
+		ban(t, adapter, nil)
+
+		_, _, _, err := manager.Create(ctx, "user1", nil)
+		var banErr *core.BanError
+		if !errors.As(err, &banErr) || !errors.Is(err, core.ErrUserBanned) {
+			t.Fatalf("Expected a BanError, got %v", err)
+		}
+		if banErr.Reason != "spam" || banErr.Expires != nil {
+			t.Errorf("Unexpected ban %+v", banErr)
+		}
+		if got := sink.types(); len(got) != 1 || got[0] != core.EventBannedUserRejected {
+			t.Errorf("Expected a banned_user_rejected event, got %v", got)
+		}
+	})
+
+	t.Run("revokes sessions", func(t *testing.T) {
+		manager, adapter, _ := newManager(t, core.BanRevoke)
+		_, _, token, err := manager.Create(ctx, "user1", nil)
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		ban(t, adapter, time.Now().Add(time.Hour))
+
+		if _, _, err := manager.Get(ctx, token); !errors.Is(err, core.ErrUserBanned) {
+			t.Fatalf("Expected ErrUserBanned, got %v", err)
+		}
+		if n, _ := adapter.Count(ctx, core.NewQuery("sessions").Build()); n != 0 {
+			t.Errorf("Expected the session to be revoked, %d left", n)
+		}
+	})
+
+	t.Run("reject keeps sessions", func(t *testing.T) {
+		manager, adapter, _ := newManager(t, core.BanReject)
+		_, _, token, err := manager.Create(ctx, "user1", nil)
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		ban(t, adapter, time.Now().Add(time.Hour))
+
+		if _, _, err := manager.Get(ctx, token); !errors.Is(err, core.ErrUserBanned) {
+			t.Fatalf("Expected ErrUserBanned, got %v", err)
+		}
+		if n, _ := adapter.Count(ctx, core.NewQuery("sessions").Build()); n != 1 {
+			t.Errorf("Expected the session to be kept, %d left", n)
+		}
+	})
+
+	t.Run("lifts ended temporary bans", func(t *testing.T) {
+		manager, adapter, sink := newManager(t, "")
+		_, _, token, err := manager.Create(ctx, "user1", nil)
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		ban(t, adapter, time.Now().Add(-time.Minute))
+
+		session, user, err := manager.Get(ctx, token)
+		if err != nil || session == nil {
+			t.Fatalf("Expected the session to be valid once the ban ended, got %v", err)
+		}
+		if user.Banned || user.BanExpires != nil {
+			t.Errorf("Expected the ban to be lifted, got %+v", user)
+		}
+		stored, _ := adapter.FindOne(ctx, core.NewQuery("users").Where("id", core.OpEqual, "user1").Build())
+		if stored["banned"] != false {
+			t.Errorf("Expected the ban to be cleared in the users table, got %v", stored["banned"])
+		}
+		if _, _, _, err := manager.Create(ctx, "user1", nil); err != nil {
+			t.Errorf("Expected sign-in after the ban ended, got %v", err)
+		}
+		if got := sink.types(); len(got) != 1 || got[0] != core.EventUserUnbanned {
+			t.Errorf("Expected one user_unbanned event, got %v", got)
+		}
+	})
+}
+
+func TestManager_SessionPruning(t *testing.T) {
+	adapter := memory.New()
+	defer adapter.Close()
+
+	config := DefaultConfig()
+	config.EnableRedisStore = false
+	config.EnableCookieStore = false
+	config.KeepRecentSessions = 2
+
+	manager, err := NewManager(config, adapter)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer manager.Close()
+
+	ctx := context.Background()
+	adapter.Create(ctx, "users", map[string]interface{}{
+		"id":    "user1",
+		"email": "test@example.com",
+	})
+
+	create := func() string {
+		t.Helper()
+		_, _, token, err := manager.Create(ctx, "user1", nil)
+		if err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		return token
+	}
+	setLastActivity := func(token string, at time.Time) {
+		t.Helper()
+		query := &core.Query{
+			Model: "sessions",
+			Where: []core.WhereClause{{Field: "token", Operator: core.OpEqual, Value: token}},
+		}
+		if _, err := adapter.Update(ctx, query, map[string]interface{}{"updated_at": at}); err != nil {
+			t.Fatalf("Failed to set last activity: %v", err)
+		}
+	}
+
+	// The older session is still in use, the newer one was abandoned
+	active := create()
+	abandoned := create()
+	setLastActivity(active, time.Now().Add(-time.Minute))
+	setLastActivity(abandoned, time.Now().Add(-2*time.Hour))
+
+	latest := create()
+
+	if session, _, _ := manager.Get(ctx, abandoned); session != nil {
+		t.Error("Expected least recently active session to be pruned")
+	}
+	for _, token := range []string{active, latest} {
+		if session, _, err := manager.Get(ctx, token); err != nil || session == nil {
+			t.Errorf("Expected recently active session to be kept, got %v", err)
+		}
+	}
+
+	sessions, err := manager.ListByUserID(ctx, "user1")
+	if err != nil {
+		t.Fatalf("ListByUserID() error = %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Errorf("Expected 2 sessions after pruning, got %d", len(sessions))
+	}
+}
+
+func TestManager_Rotate(t *testing.T) {
+	adapter := memory.New()
+	defer adapter.Close()
+
+	config := DefaultConfig()
+	config.EnableRedisStore = false
+	config.EnableCookieStore = false
+	config.Binding = &core.SessionBinding{UserAgent: true}
+
+	manager, err := NewManager(config, adapter)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer manager.Close()
+
+	ctx := core.WithClientInfo(context.Background(), core.ClientInfo{UserAgent: "browser"})
+	adapter.Create(ctx, "users", map[string]interface{}{"id": "user1", "email": "test@example.com"})
+
+	old, _, oldToken, err := manager.Create(ctx, "user1", &core.SessionOptions{UserAgent: "browser"})
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	rotated, user, newToken, err := manager.Rotate(ctx, oldToken)
+	if err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	if newToken == oldToken || rotated.ID == old.ID {
+		t.Error("Expected a new session ID and token")
+	}
+	if rotated.UserID != "user1" || user == nil || user.ID != "user1" {
+		t.Errorf("Expected rotated session to keep the user, got %+v", rotated)
+	}
+	if !rotated.ExpiresAt.Equal(old.ExpiresAt) || rotated.Fingerprint != old.Fingerprint {
+		t.Error("Expected rotated session to keep expiry and fingerprint")
+	}
+
+	if session, _, _ := manager.Get(ctx, oldToken); session != nil {
+		t.Error("Expected old token to be revoked")
+	}
+	if session, _, err := manager.Get(ctx, newToken); err != nil || session == nil {
+		t.Errorf("Expected new token to be valid, got %v", err)
+	}
+
+	// A revoked token cannot be rotated again
+	if _, _, _, err := manager.Rotate(ctx, oldToken); err == nil {
+		t.Error("Expected error rotating a revoked token")
+	}
+
+	// Binding is enforced before rotating
+	other := core.WithClientInfo(context.Background(), core.ClientInfo{UserAgent: "attacker"})
+	if _, _, _, err := manager.Rotate(other, newToken); !errors.Is(err, core.ErrSessionBinding) {
+		t.Errorf("Expected ErrSessionBinding, got %v", err)
+	}
+}
+
+func TestManager_RotateRollsBack(t *testing.T) {
+	store := newMapStore()
+
+	config := DefaultConfig()
+	config.EnableCookieStore = false
+	config.EnableRedisStore = false
+	config.EnableDBStore = false
+	config.Stores = []StoreLayer{{Name: "map", Store: store}}
+
+	manager, err := NewManager(config, nil)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer manager.Close()
+
+	ctx := context.Background()
+	_, _, token, err := manager.Create(ctx, "user1", &core.SessionOptions{User: &core.User{ID: "user1"}})
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	store.failDelete = token
+	if _, _, _, err := manager.Rotate(ctx, token); err == nil {
+		t.Fatal("Expected error when the old session cannot be revoked")
+	}
+	if len(store.sessions) != 1 || !store.has(token) {
+		t.Errorf("Expected only the old session to remain, got %d sessions", len(store.sessions))
+	}
+}
+
+func TestManager_CookieAndDBLayers(t *testing.T) {
+	adapter := memory.New()
+	defer adapter.Close()
+
+	config := DefaultConfig()
+	config.EnableRedisStore = false
+	config.Secret = "test-secret"
+
+	manager, err := NewManager(config, adapter)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer manager.Close()
+
+	ctx := context.Background()
+	adapter.Create(ctx, "users", map[string]interface{}{"id": "user1", "email": "test@example.com"})
+
+	created, _, token, err := manager.Create(ctx, "user1", nil)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if token == created.Token {
+		t.Fatal("expected a signed cookie token")
+	}
+
+	session, _, err := manager.Get(ctx, token)
+	if err != nil || session == nil || session.ID != created.ID {
+		t.Fatalf("Get(cookie token) = %v, %v; want session %s", session, err, created.ID)
+	}
+
+	// Deleting by cookie token revokes the database session, so the
+	// still-valid signature no longer grants access
+	if err := manager.Delete(ctx, token); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if session, _, _ := manager.Get(ctx, token); session != nil {
+		t.Error("expected revoked session to be rejected")
+	}
+}
+
+func TestManager_Tenancy(t *testing.T) {
+	acme := core.WithTenant(context.Background(), "acme")
+	globex := core.WithTenant(context.Background(), "globex")
+
+	for _, cookieStore := range []bool{false, true} {
+		t.Run(fmt.Sprintf("cookie store %v", cookieStore), func(t *testing.T) {
+			db := adapter.WithTenancy(memory.New(memory.WithTenantUniques()), core.TenancyConfig{}, nil)
+			db.Create(acme, "users", map[string]interface{}{"id": "user1", "email": "test@example.com"})
+
+			config := DefaultConfig()
+			config.EnableRedisStore = false
+			config.EnableCookieStore = cookieStore
+			config.Tenancy = true
+
+			manager, err := NewManager(config, db)
+			if err != nil {
+				t.Fatalf("Failed to create manager: %v", err)
+			}
+			defer manager.Close()
+
+			session, _, token, err := manager.Create(acme, "user1", nil)
+			if err != nil {
+				t.Fatalf("Failed to create session: %v", err)
+			}
+			if session.TenantID != "acme" {
+				t.Errorf("TenantID = %q, want acme", session.TenantID)
+			}
+
+			if got, _, err := manager.Get(acme, token); err != nil || got == nil {
+				t.Fatalf("Get() in the session's tenant = %v, %v", got, err)
+			}
+			if _, _, err := manager.Get(globex, token); !errors.Is(err, core.ErrSessionNotFound) {
+				t.Errorf("Get() in another tenant error = %v, want ErrSessionNotFound", err)
+			}
+			if _, _, err := manager.Get(context.Background(), token); !errors.Is(err, core.ErrSessionNotFound) {
+				t.Errorf("Get() without a tenant error = %v, want ErrSessionNotFound", err)
+			}
+		})
+	}
+}
+
+func TestManager_DescribeSecurityTokenHashing(t *testing.T) {
+	adapter := memory.New()
+	defer adapter.Close()
+
+	for _, tt := range []struct {
+		name        string
+		hash        bool
+		acceptPlain bool
+	}{
+		{"plaintext", false, false},
+		{"hashed", true, false},
+		{"hashed accepting plaintext", true, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.EnableRedisStore = false
+			config.EnableCookieStore = false
+			config.HashDBTokens = tt.hash
+			config.AcceptPlainDBTokens = tt.acceptPlain
+			manager, err := NewManager(config, adapter)
+			if err != nil {
+				t.Fatalf("Failed to create manager: %v", err)
+			}
+			defer manager.Close()
+
+			posture := core.DescribeSecurity(&core.Config{}, nil, manager)
+			if got := posture.Session["tokenHashing"]; got != tt.hash {
+				t.Errorf("tokenHashing = %v, want %v", got, tt.hash)
+			}
+			got, ok := posture.Session["plainTokensAccepted"]
+			if ok != tt.hash || (ok && got != tt.acceptPlain) {
+				t.Errorf("plainTokensAccepted = %v (reported %v), want %v", got, ok, tt.acceptPlain)
+			}
+		})
+	}
+}
+
+func TestManager_HashedDBTokens(t *testing.T) {
+	adapter := memory.New()
+	defer adapter.Close()
+	ctx := context.Background()
+	adapter.Create(ctx, "users", map[string]interface{}{
+		"id":    "user1",
+		"email": "test@example.com",
+	})
+
+	// A session stored in plaintext before hashing was enabled
+	legacy := NewDBStore(adapter)
+	if err := legacy.Set(ctx, &core.Session{
+		ID: "legacy", UserID: "user1", Token: "legacy-token",
+		ExpiresAt: time.Now().Add(time.Hour), CreatedAt: time.Now(), UpdatedAt: time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultConfig()
+	config.EnableRedisStore = false
+	config.EnableCookieStore = false
+	config.HashDBTokens = true
+	config.AcceptPlainDBTokens = true
+	config.MaxSessionsPerUser = 2
+	manager, err := NewManager(config, adapter)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer manager.Close()
+
+	_, _, token, err := manager.Create(ctx, "user1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := adapter.FindOne(ctx, core.NewQuery("sessions").Where("user_id", core.OpEqual, "user1").Where("id", core.OpNotEqual, "legacy").Build())
+	if stored == nil || stored["token"] == token || !strings.HasPrefix(stored["token"].(string), HashedTokenPrefix) {
+		t.Fatalf("Expected the token to be stored hashed, got %v", stored)
+	}
+	if session, _, err := manager.Get(ctx, token); err != nil || session == nil || session.Token != token {
+		t.Fatalf("Expected the session by its token, got %+v, %v", session, err)
+	}
+
+	// The legacy session is accepted and rehashed on use
+	if session, _, err := manager.Get(ctx, "legacy-token"); err != nil || session == nil {
+		t.Fatalf("Expected the plaintext session to be accepted, got %v", err)
+	}
+	if found, _ := adapter.FindOne(ctx, core.NewQuery("sessions").Where("token", core.OpEqual, "legacy-token").Build()); found != nil {
+		t.Error("Expected the plaintext token to be rehashed")
+	}
+
+	// Listed sessions carry the stored form, which still revokes them
+	if _, _, _, err := manager.Create(ctx, "user1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if session, _, _ := manager.Get(ctx, "legacy-token"); session != nil {
+		t.Error("Expected the oldest session to be evicted")
+	}
+}
+
+// Stored hashes are not tokens, and sessions listed by them are revoked
+// in every store
+func TestManager_HashedTokensStoredForm(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	adapter := memory.New()
+	defer adapter.Close()
+	adapter.Create(ctx, "users", map[string]interface{}{"id": "user1", "email": "test@example.com"})
+
+	config := DefaultConfig()
+	config.EnableCookieStore = false
+	config.EnableRedisStore = true
+	config.RedisAddr = server.Addr()
+	config.HashDBTokens = true
+	config.AcceptPlainDBTokens = true
+	manager, err := NewManager(config, adapter)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer manager.Close()
+
+	_, _, token, err := manager.Create(ctx, "user1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed, err := manager.dbStore.ListByUserID(ctx, "user1")
+	if err != nil || len(listed) != 1 || !strings.HasPrefix(listed[0].Token, HashedTokenPrefix) {
+		t.Fatalf("ListByUserID() = %v, %v, want the stored form", listed, err)
+	}
+	stored := listed[0].Token
+	if session, _, _ := manager.dbStore.Get(ctx, stored); session != nil {
+		t.Error("The stored hash was accepted as a token")
+	}
+	if err := manager.dbStore.Set(ctx, &core.Session{ID: "forged", UserID: "user1", Token: stored}); err == nil {
+		t.Error("Set() accepted a token in stored form")
+	}
+
+	if err := manager.deleteListed(ctx, listed[0]); err != nil {
+		t.Fatalf("deleteListed() error = %v", err)
+	}
+	if session, _, _ := manager.cacheStore.Get(ctx, token); session != nil {
+		t.Error("The revoked session is still cached")
+	}
+	if session, _, _ := manager.dbStore.Get(ctx, token); session != nil {
+		t.Error("The revoked session is still in the database")
+	}
+}
+
+func TestDBStore_HashExistingTokens(t *testing.T) {
+	adapter := memory.New()
+	defer adapter.Close()
+	ctx := context.Background()
+
+	legacy := NewDBStore(adapter)
+	for i := 0; i < 3; i++ {
+		if err := legacy.Set(ctx, &core.Session{
+			ID: fmt.Sprintf("s%d", i), UserID: "user1", Token: fmt.Sprintf("token-%d", i),
+			ExpiresAt: time.Now().Add(time.Hour), CreatedAt: time.Now(), UpdatedAt: time.Now(),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := legacy.HashExistingTokens(ctx); err == nil {
+		t.Error("Expected an error without HashTokens")
+	}
+
+	store := NewDBStoreWithOptions(adapter, &DBStoreOptions{HashTokens: true})
+	if session, _, _ := store.Get(ctx, "token-1"); session != nil {
+		t.Error("Expected plaintext tokens to be rejected without AcceptPlainTokens")
+	}
+	if n, err := store.HashExistingTokens(ctx); err != nil || n != 3 {
+		t.Fatalf("HashExistingTokens() = %d, %v", n, err)
+	}
+	if n, _ := store.HashExistingTokens(ctx); n != 0 {
+		t.Errorf("Expected hashed tokens to be skipped, converted %d", n)
+	}
+	if session, _, err := store.Get(ctx, "token-1"); session == nil || session.ID != "s1" {
+		t.Errorf("Expected the converted session, got %+v, %v", session, err)
+	}
+}
+
+func TestManager_Metadata(t *testing.T) {
+	adapter := memory.New()
+	defer adapter.Close()
+
+	cache := newMapStore()
+
+	config := DefaultConfig()
+	config.EnableCookieStore = false
+	config.EnableRedisStore = false
+	config.Stores = []StoreLayer{{Name: "map", Store: cache}}
+	config.StoreOrder = []string{"map"}
+
+	manager, err := NewManager(config, adapter)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer manager.Close()
+
+	ctx := context.Background()
+	adapter.Create(ctx, "users", map[string]interface{}{"id": "user1", "email": "test@example.com"})
+
+	_, _, token, err := manager.Create(ctx, "user1", nil)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	if err := manager.SetMetadata(ctx, token, "activeOrganization", "org_1"); err != nil {
+		t.Fatalf("SetMetadata() error = %v", err)
+	}
+	if err := manager.SetMetadata(ctx, token, "stepUpAt", 1700000000); err != nil {
+		t.Fatalf("SetMetadata() error = %v", err)
+	}
+	if got, err := manager.GetMetadata(ctx, token, "activeOrganization"); err != nil || got != "org_1" {
+		t.Errorf("GetMetadata() = %v, %v, want org_1 from the custom store", got, err)
+	}
+
+	// The database keeps the metadata as JSON
+	_ = cache.Delete(ctx, token)
+	session, _, err := manager.Get(ctx, token)
+	if err != nil || session == nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if session.Metadata["activeOrganization"] != "org_1" || session.Metadata["stepUpAt"] != float64(1700000000) {
+		t.Errorf("Expected metadata from the database, got %v", session.Metadata)
+	}
+
+	// A nil value removes the key
+	if err := manager.SetMetadata(ctx, token, "stepUpAt", nil); err != nil {
+		t.Fatalf("SetMetadata() error = %v", err)
+	}
+	_ = cache.Delete(ctx, token)
+	if got, _ := manager.GetMetadata(ctx, token, "stepUpAt"); got != nil {
+		t.Errorf("Expected removed key, got %v", got)
+	}
+
+	// Rotation carries the metadata over
+	rotated, _, newToken, err := manager.Rotate(ctx, token)
+	if err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	_ = cache.Delete(ctx, rotated.Token)
+	if got, _ := manager.GetMetadata(ctx, newToken, "activeOrganization"); got != "org_1" {
+		t.Errorf("Expected metadata after rotation, got %v", got)
+	}
+
+	if err := manager.SetMetadata(ctx, newToken, "callback", func() {}); err == nil {
+		t.Error("Expected error for a value that does not encode to JSON")
+	}
+	if err := manager.SetMetadata(ctx, token, "activeOrganization", "org_2"); !errors.Is(err, core.ErrSessionNotFound) {
+		t.Errorf("Expected ErrSessionNotFound for a revoked token, got %v", err)
+	}
+
+	cookieOnly := DefaultConfig()
+	cookieOnly.EnableRedisStore = false
+	cookieOnly.EnableDBStore = false
+	cookieManager, err := NewManager(cookieOnly, nil)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer cookieManager.Close()
+	if err := cookieManager.SetMetadata(ctx, "token", "key", "value"); !errors.Is(err, core.ErrMetadataUnsupported) {
+		t.Errorf("Expected ErrMetadataUnsupported for cookie sessions, got %v", err)
+	}
+}
+
+func TestManager_ClaimsEnricher(t *testing.T) {
+	adapter := memory.New()
+	defer adapter.Close()
+
+	var fail error
+	plan := "free"
+	config := DefaultConfig()
+	config.Secret = "test-secret"
+	config.EnableRedisStore = false
+	config.ClaimsEnricher = func(ctx context.Context, user *core.User, session *core.Session) (map[string]any, error) {
+		return map[string]any{"plan": plan}, fail
+	}
+
+	manager, err := NewManager(config, adapter)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer manager.Close()
+
+	ctx := context.Background()
+	adapter.Create(ctx, "users", map[string]interface{}{"id": "user1", "email": "test@example.com"})
+
+	_, _, token, err := manager.Create(ctx, "user1", nil)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if claims, err := manager.Claims(token); err != nil || claims["plan"] != "free" {
+		t.Errorf("Claims() = %v, %v, want plan free", claims, err)
+	}
+
+	// Rotation reissues the token with fresh claims
+	plan = "pro"
+	_, _, token, err = manager.Rotate(ctx, token)
+	if err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	if claims, _ := manager.Claims(token); claims["plan"] != "pro" {
+		t.Errorf("Claims() = %v, want plan pro after rotation", claims)
+	}
+
+	// A failing enricher fails sign-in without leaving a session behind
+	fail = errors.New("billing unavailable")
+	if _, _, _, err := manager.Create(ctx, "user1", nil); !errors.Is(err, fail) {
+		t.Fatalf("Create() error = %v, want the enricher's error", err)
+	}
+	if sessions, _ := manager.ListByUserID(ctx, "user1"); len(sessions) != 1 {
+		t.Errorf("ListByUserID() = %d sessions, want only the rotated one", len(sessions))
+	}
+}
+
+func TestManager_TransientSession(t *testing.T) {
+	adapter := memory.New()
+	defer adapter.Close()
+
+	config := DefaultConfig()
+	config.EnableCookieStore = false
+	config.EnableRedisStore = false
+	config.ExpiresIn = 30 * 24 * time.Hour
+	config.ShortExpiresIn = 12 * time.Hour
+
+	manager, err := NewManager(config, adapter)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer manager.Close()
+
+	ctx := context.Background()
+	adapter.Create(ctx, "users", map[string]interface{}{"id": "user1", "email": "test@example.com"})
+
+	session, _, token, err := manager.Create(ctx, "user1", &core.SessionOptions{Transient: true})
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if got := time.Until(session.ExpiresAt); got > 12*time.Hour || got < 11*time.Hour {
+		t.Errorf("transient session expires in %v, want 12h", got)
+	}
+
+	// Renewing keeps the short lifetime, as the stored session records it
+	stored, _, err := manager.Get(ctx, token)
+	if err != nil || stored == nil {
+		t.Fatalf("Get() = %v, %v", stored, err)
+	}
+	if stored.Metadata[core.MetadataRememberMe] != false {
+		t.Errorf("metadata = %v, want rememberMe false", stored.Metadata)
+	}
+	stored.UpdatedAt = time.Now().Add(-48 * time.Hour)
+	if err := manager.Update(ctx, stored); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if got := time.Until(stored.ExpiresAt); got > 12*time.Hour || got < 11*time.Hour {
+		t.Errorf("renewed transient session expires in %v, want 12h", got)
+	}
+
+	session, _, _, err = manager.Create(ctx, "user1", nil)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if got := time.Until(session.ExpiresAt); got < 29*24*time.Hour || session.Metadata != nil {
+		t.Errorf("session expires in %v with metadata %v, want 30 days and none", got, session.Metadata)
+	}
+}
+
+// BenchmarkManager_Get measures session validation, the auth hot path, for
+// each storage strategy
+func BenchmarkManager_Get(b *testing.B) {
+	for _, bc := range []struct {
+		name   string
+		cookie bool
+		redis  bool
+		db     bool
+		order  []string
+	}{
+		{name: "CookieOnly", cookie: true},
+		{name: "DBOnly", db: true},
+		{name: "RedisOnly", redis: true},
+		{name: "RedisFirst", redis: true, db: true},
+		{name: "DBFirst", redis: true, db: true, order: []string{StoreDB}},
+		{name: "Hybrid", cookie: true, redis: true, db: true},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			ctx := context.Background()
+			adapter := memory.New()
+			defer adapter.Close()
+			adapter.Create(ctx, "users", map[string]interface{}{"id": "user1", "email": "test@example.com"})
+
+			config := DefaultConfig()
+			config.EnableCookieStore = bc.cookie
+			config.EnableRedisStore = bc.redis
+			config.EnableDBStore = bc.db
+			config.StoreOrder = bc.order
+			if bc.redis {
+				config.RedisAddr = miniredis.RunT(b).Addr()
+			}
+			manager, err := NewManager(config, adapter)
+			if err != nil {
+				b.Fatalf("NewManager() error = %v", err)
+			}
+			defer manager.Close()
+
+			_, _, token, err := manager.Create(ctx, "user1", nil)
+			if err != nil {
+				b.Fatalf("Create() error = %v", err)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if session, _, err := manager.Get(ctx, token); err != nil || session == nil {
+					b.Fatalf("Get() = %v, %v", session, err)
+				}
+			}
+		})
+	}
+}
+
+func TestManager_ShutdownAndPing(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	adapter := memory.New()
+	defer adapter.Close()
+	adapter.Create(ctx, "users", map[string]interface{}{"id": "user1", "email": "test@example.com"})
+
+	config := DefaultConfig()
+	config.EnableCookieStore = false
+	config.EnableRedisStore = true
+	config.RedisAddr = server.Addr()
+	config.UpdateAge = 0
+	config.BatchUpdates = true
+	config.UpdateFlushInterval = time.Hour
+	manager, err := NewManager(config, adapter)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+
+	if err := manager.Ping(ctx); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+
+	session, _, token, err := manager.Create(ctx, "user1", nil)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	session.ExpiresAt = session.ExpiresAt.Add(-time.Hour)
+	if err := manager.Update(ctx, session); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	// Shutdown flushes the batched update and leaves the adapter open
+	if err := manager.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	stored, _, err := manager.dbStore.Get(ctx, token)
+	if err != nil || stored == nil || !stored.ExpiresAt.Equal(session.ExpiresAt) {
+		t.Errorf("stored session = %v, %v, want the update flushed", stored, err)
+	}
+	if err := manager.Ping(ctx); err == nil {
+		t.Error("Ping() after Shutdown succeeded, want the closed Redis store to fail")
+	}
+}
@@ -0,0 +1,586 @@
+package session
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+const (
+	// memcachedMaxKeyLength is the longest key memcached accepts
+	memcachedMaxKeyLength = 250
+
+	// memcachedMaxRelativeExpiry is the longest expiration memcached
+	// treats as relative; larger values are read as Unix timestamps
+	memcachedMaxRelativeExpiry = 30 * 24 * time.Hour
+
+	// memcachedCASRetries bounds retries when the user index is updated
+	// concurrently
+	memcachedCASRetries = 5
+)
+
+// MemcachedStore implements Store using Memcached.
+//
+// Memcached cannot enumerate keys, so the store keeps a per-user index of
+// session tokens to support DeleteByUserID and ListByUserID. Stale index
+// entries (expired or evicted sessions) are dropped when the index is read.
+//
+// The index can be evicted, so revocation does not depend on it. Each
+// cached session carries the user's revocation generation, which
+// DeleteByUserID replaces. Sessions from an older generation, or whose
+// generation was evicted, are treated as cache misses, so lookups fall
+// through to the next store and the database stays authoritative.
+type MemcachedStore struct {
+	client memcachedClient
+	prefix string
+	ttl    time.Duration
+}
+
+// memcachedClient is the part of *memcache.Client the store uses
+type memcachedClient interface {
+	Get(key string) (*memcache.Item, error)
+	GetMulti(keys []string) (map[string]*memcache.Item, error)
+	Set(item *memcache.Item) error
+	Add(item *memcache.Item) error
+	CompareAndSwap(item *memcache.Item) error
+	Delete(key string) error
+	Ping() error
+	Close() error
+}
+
+// memcachedSession is a cached session with the revocation generation of
+// its user at the time it was stored
+type memcachedSession struct {
+	SessionData
+	Generation string `json:",omitempty"`
+}
+
+// NewMemcachedStore creates a new Memcached session store
+func NewMemcachedStore(servers []string, prefix string, ttl time.Duration) (*MemcachedStore, error) {
+	if len(servers) == 0 {
+		return nil, errors.New("at least one Memcached server is required")
+	}
+
+	client := memcache.New(servers...)
+
+	// Test connection
+	if err := client.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to connect to Memcached: %w", err)
+	}
+
+	return &MemcachedStore{
+		client: client,
+		prefix: prefix,
+		ttl:    ttl,
+	}, nil
+}
+
+// Get retrieves a session by token from Memcached
+func (m *MemcachedStore) Get(ctx context.Context, token string) (*core.Session, *core.User, error) {
+	item, err := m.client.Get(m.sessionKey(token))
+	if err != nil {
+		if errors.Is(err, memcache.ErrCacheMiss) {
+			return nil, nil, nil // Session not found
+		}
+		return nil, nil, fmt.Errorf("memcached get error: %w", err)
+	}
+
+	var sessionData memcachedSession
+	if err := json.Unmarshal(item.Value, &sessionData); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal session data: %w", err)
+	}
+
+	// Check if session is expired
+	if sessionData.Session == nil || time.Now().After(sessionData.Session.ExpiresAt) {
+		_ = m.Delete(ctx, token) // Clean up expired session (best effort)
+		return nil, nil, core.ErrSessionNotFound
+	}
+
+	// Revoked, or the generation was evicted: leave it to the next store
+	generation, err := m.generation(sessionData.Session.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if generation == "" || generation != sessionData.Generation {
+		_ = m.Delete(ctx, token) // Best effort
+		return nil, nil, nil
+	}
+
+	return sessionData.Session, sessionData.User, nil
+}
+
+// Set stores a session in Memcached. User data is fetched from the
+// database when needed.
+func (m *MemcachedStore) Set(ctx context.Context, session *core.Session) error {
+	return m.SetWithUser(ctx, session, nil)
+}
+
+// SetWithUser stores a session with user data in Memcached
+func (m *MemcachedStore) SetWithUser(ctx context.Context, session *core.Session, user *core.User) error {
+	generation, err := m.ensureGeneration(session.UserID)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(memcachedSession{
+		SessionData: SessionData{
+			Session: session,
+			User:    user,
+		},
+		Generation: generation,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal session data: %w", err)
+	}
+
+	expiration, err := m.expiration(session)
+	if err != nil {
+		return err
+	}
+
+	if err := m.client.Set(&memcache.Item{
+		Key:        m.sessionKey(session.Token),
+		Value:      data,
+		Expiration: expiration,
+	}); err != nil {
+		return fmt.Errorf("memcached set error: %w", err)
+	}
+
+	return m.updateIndex(session.UserID, func(tokens []string) []string {
+		for _, t := range tokens {
+			if t == session.Token {
+				return tokens
+			}
+		}
+		return append(tokens, session.Token)
+	})
+}
+
+// Touch records the last activity time of a session in Memcached. Missing
+// sessions are ignored.
+func (m *MemcachedStore) Touch(ctx context.Context, token string, lastActivity time.Time) error {
+	item, err := m.client.Get(m.sessionKey(token))
+	if err != nil {
+		if errors.Is(err, memcache.ErrCacheMiss) {
+			return nil
+		}
+		return fmt.Errorf("memcached get error: %w", err)
+	}
+
+	var sessionData memcachedSession
+	if err := json.Unmarshal(item.Value, &sessionData); err != nil {
+		return fmt.Errorf("failed to unmarshal session data: %w", err)
+	}
+	if sessionData.Session == nil {
+		return nil
+	}
+	sessionData.Session.UpdatedAt = lastActivity
+
+	// Memcached does not report the remaining TTL, so recompute it
+	expiration, err := m.expiration(sessionData.Session)
+	if err != nil {
+		return nil // Expired, nothing to record
+	}
+
+	item.Value, err = json.Marshal(sessionData)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session data: %w", err)
+	}
+	item.Expiration = expiration
+
+	// A concurrent write already replaced the session; keep it
+	if err := m.client.CompareAndSwap(item); err != nil &&
+		!errors.Is(err, memcache.ErrCASConflict) && !errors.Is(err, memcache.ErrNotStored) {
+		return fmt.Errorf("memcached set error: %w", err)
+	}
+
+	return nil
+}
+
+// Extend sets the expiry and last update time of a session in Memcached.
+// Missing sessions are ignored.
+func (m *MemcachedStore) Extend(ctx context.Context, token string, expiresAt, updatedAt time.Time) error {
+	item, err := m.client.Get(m.sessionKey(token))
+	if err != nil {
+		if errors.Is(err, memcache.ErrCacheMiss) {
+			return nil
+		}
+		return fmt.Errorf("memcached get error: %w", err)
+	}
+
+	var sessionData memcachedSession
+	if err := json.Unmarshal(item.Value, &sessionData); err != nil {
+		return fmt.Errorf("failed to unmarshal session data: %w", err)
+	}
+	if sessionData.Session == nil {
+		return nil
+	}
+	sessionData.Session.ExpiresAt = expiresAt
+	sessionData.Session.UpdatedAt = updatedAt
+
+	expiration, err := m.expiration(sessionData.Session)
+	if err != nil {
+		return nil // Expired, nothing to extend
+	}
+
+	item.Value, err = json.Marshal(sessionData)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session data: %w", err)
+	}
+	item.Expiration = expiration
+
+	// A concurrent write replaced or deleted the session; keep that
+	if err := m.client.CompareAndSwap(item); err != nil &&
+		!errors.Is(err, memcache.ErrCASConflict) && !errors.Is(err, memcache.ErrNotStored) {
+		return fmt.Errorf("memcached set error: %w", err)
+	}
+
+	return nil
+}
+
+// SetMetadata replaces the metadata of a session in Memcached. Missing
+// sessions are ignored.
+func (m *MemcachedStore) SetMetadata(ctx context.Context, token string, metadata map[string]interface{}) error {
+	item, err := m.client.Get(m.sessionKey(token))
+	if err != nil {
+		if errors.Is(err, memcache.ErrCacheMiss) {
+			return nil
+		}
+		return fmt.Errorf("memcached get error: %w", err)
+	}
+
+	var sessionData memcachedSession
+	if err := json.Unmarshal(item.Value, &sessionData); err != nil {
+		return fmt.Errorf("failed to unmarshal session data: %w", err)
+	}
+	if sessionData.Session == nil {
+		return nil
+	}
+	sessionData.Session.Metadata = metadata
+
+	expiration, err := m.expiration(sessionData.Session)
+	if err != nil {
+		return nil // Expired
+	}
+
+	item.Value, err = json.Marshal(sessionData)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session data: %w", err)
+	}
+	item.Expiration = expiration
+
+	// Unlike Touch, the update must not be lost to a concurrent write
+	if err := m.client.Set(item); err != nil {
+		return fmt.Errorf("memcached set error: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes a session from Memcached
+func (m *MemcachedStore) Delete(ctx context.Context, token string) error {
+	if err := m.client.Delete(m.sessionKey(token)); err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+		return fmt.Errorf("memcached delete error: %w", err)
+	}
+	return nil
+}
+
+// DeleteByUserID removes all sessions for a user from Memcached. A new
+// revocation generation is stored first, so sessions missing from the index
+// are revoked too.
+func (m *MemcachedStore) DeleteByUserID(ctx context.Context, userID string) error {
+	generation, err := newMemcachedGeneration()
+	if err != nil {
+		return err
+	}
+	if err := m.client.Set(&memcache.Item{Key: m.generationKey(userID), Value: []byte(generation)}); err != nil {
+		return fmt.Errorf("memcached set error: %w", err)
+	}
+
+	tokens, err := m.indexTokens(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, token := range tokens {
+		if err := m.Delete(ctx, token); err != nil {
+			return err
+		}
+	}
+
+	if err := m.client.Delete(m.userKey(userID)); err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+		return fmt.Errorf("memcached delete error: %w", err)
+	}
+
+	return nil
+}
+
+// ListByUserID returns a user's active sessions from Memcached, oldest first
+func (m *MemcachedStore) ListByUserID(ctx context.Context, userID string) ([]*core.Session, error) {
+	tokens, err := m.indexTokens(userID)
+	if err != nil || len(tokens) == 0 {
+		return nil, err
+	}
+
+	keys := make([]string, len(tokens))
+	for i, token := range tokens {
+		keys[i] = m.sessionKey(token)
+	}
+
+	items, err := m.client.GetMulti(keys)
+	if err != nil {
+		return nil, fmt.Errorf("memcached get error: %w", err)
+	}
+
+	generation, err := m.generation(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*core.Session
+	live := make(map[string]bool, len(items))
+	now := time.Now()
+
+	for _, item := range items {
+		var sessionData memcachedSession
+		if err := json.Unmarshal(item.Value, &sessionData); err != nil {
+			continue
+		}
+
+		session := sessionData.Session
+		if session != nil && session.UserID == userID && now.Before(session.ExpiresAt) &&
+			generation != "" && sessionData.Generation == generation {
+			sessions = append(sessions, session)
+			live[session.Token] = true
+		}
+	}
+
+	// Drop tokens of expired or evicted sessions (best effort). Only tokens
+	// seen dead are removed, so sessions added meanwhile are kept.
+	dead := make(map[string]bool)
+	for _, t := range tokens {
+		if !live[t] {
+			dead[t] = true
+		}
+	}
+	if len(dead) > 0 {
+		_ = m.updateIndex(userID, func(tokens []string) []string {
+			kept := tokens[:0]
+			for _, t := range tokens {
+				if !dead[t] {
+					kept = append(kept, t)
+				}
+			}
+			return kept
+		})
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+
+	return sessions, nil
+}
+
+// Cleanup removes expired sessions from Memcached
+// Note: Memcached expires items itself, so this is a no-op
+func (m *MemcachedStore) Cleanup(ctx context.Context) error {
+	return nil
+}
+
+// Close closes the Memcached connections
+func (m *MemcachedStore) Close() error {
+	return m.client.Close()
+}
+
+// Ping checks the Memcached connection
+func (m *MemcachedStore) Ping(ctx context.Context) error {
+	return m.client.Ping()
+}
+
+// indexTokens returns the session tokens recorded for a user
+func (m *MemcachedStore) indexTokens(userID string) ([]string, error) {
+	item, err := m.client.Get(m.userKey(userID))
+	if err != nil {
+		if errors.Is(err, memcache.ErrCacheMiss) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("memcached get error: %w", err)
+	}
+
+	var tokens []string
+	if err := json.Unmarshal(item.Value, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal session index: %w", err)
+	}
+	return tokens, nil
+}
+
+// updateIndex applies update to a user's token index using
+// compare-and-swap, so concurrent sign-ins do not lose tokens
+func (m *MemcachedStore) updateIndex(userID string, update func([]string) []string) error {
+	key := m.userKey(userID)
+
+	for i := 0; i < memcachedCASRetries; i++ {
+		item, err := m.client.Get(key)
+		if errors.Is(err, memcache.ErrCacheMiss) {
+			data, err := json.Marshal(update(nil))
+			if err != nil {
+				return fmt.Errorf("failed to marshal session index: %w", err)
+			}
+			err = m.client.Add(&memcache.Item{Key: key, Value: data, Expiration: m.indexExpiration()})
+			if errors.Is(err, memcache.ErrNotStored) {
+				continue // Created concurrently, retry as an update
+			}
+			if err != nil {
+				return fmt.Errorf("memcached add error: %w", err)
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("memcached get error: %w", err)
+		}
+
+		var tokens []string
+		if err := json.Unmarshal(item.Value, &tokens); err != nil {
+			tokens = nil // Rebuild a corrupt index
+		}
+
+		item.Value, err = json.Marshal(update(tokens))
+		if err != nil {
+			return fmt.Errorf("failed to marshal session index: %w", err)
+		}
+		item.Expiration = m.indexExpiration()
+
+		err = m.client.CompareAndSwap(item)
+		if errors.Is(err, memcache.ErrCASConflict) || errors.Is(err, memcache.ErrNotStored) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("memcached set error: %w", err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("memcached session index for user %s is under contention", userID)
+}
+
+// generation returns the user's current revocation generation, or "" if
+// none is stored
+func (m *MemcachedStore) generation(userID string) (string, error) {
+	item, err := m.client.Get(m.generationKey(userID))
+	if err != nil {
+		if errors.Is(err, memcache.ErrCacheMiss) {
+			return "", nil
+		}
+		return "", fmt.Errorf("memcached get error: %w", err)
+	}
+	return string(item.Value), nil
+}
+
+// ensureGeneration returns the user's revocation generation, starting a new
+// one if none is stored. Starting a new generation only makes the user's
+// other cached sessions miss; it never revives revoked ones.
+func (m *MemcachedStore) ensureGeneration(userID string) (string, error) {
+	for i := 0; i < memcachedCASRetries; i++ {
+		generation, err := m.generation(userID)
+		if err != nil || generation != "" {
+			return generation, err
+		}
+
+		generation, err = newMemcachedGeneration()
+		if err != nil {
+			return "", err
+		}
+		// Generations never expire; an evicted one fails closed
+		err = m.client.Add(&memcache.Item{Key: m.generationKey(userID), Value: []byte(generation)})
+		if errors.Is(err, memcache.ErrNotStored) {
+			continue // Created concurrently, read it back
+		}
+		if err != nil {
+			return "", fmt.Errorf("memcached add error: %w", err)
+		}
+		return generation, nil
+	}
+
+	return "", fmt.Errorf("memcached revocation generation for user %s is under contention", userID)
+}
+
+func newMemcachedGeneration() (string, error) {
+	generation, err := generateRandomString(16)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate revocation generation: %w", err)
+	}
+	return generation, nil
+}
+
+// expiration returns the Memcached expiration for a session: the shorter
+// of the configured TTL and the time until the session expires
+func (m *MemcachedStore) expiration(session *core.Session) (int32, error) {
+	ttl := time.Until(session.ExpiresAt)
+	if ttl <= 0 {
+		return 0, fmt.Errorf("session already expired")
+	}
+
+	// Use the shorter of configured TTL or time until expiration
+	if m.ttl > 0 && m.ttl < ttl {
+		ttl = m.ttl
+	}
+
+	return memcachedExpiration(ttl, time.Now()), nil
+}
+
+// indexExpiration keeps user indexes for the configured TTL, or until
+// evicted when no TTL is set
+func (m *MemcachedStore) indexExpiration() int32 {
+	if m.ttl <= 0 {
+		return 0
+	}
+	return memcachedExpiration(m.ttl, time.Now())
+}
+
+// memcachedExpiration converts a TTL to Memcached's expiration format:
+// relative seconds up to 30 days, an absolute Unix timestamp beyond that
+func memcachedExpiration(ttl time.Duration, now time.Time) int32 {
+	if ttl > memcachedMaxRelativeExpiry {
+		return int32(now.Add(ttl).Unix())
+	}
+	seconds := int32(ttl / time.Second)
+	if seconds < 1 {
+		seconds = 1 // 0 would mean "never expire"
+	}
+	return seconds
+}
+
+func (m *MemcachedStore) sessionKey(token string) string {
+	return memcachedKey(m.prefix + token)
+}
+
+func (m *MemcachedStore) userKey(userID string) string {
+	return memcachedKey(m.prefix + "user:" + userID)
+}
+
+func (m *MemcachedStore) generationKey(userID string) string {
+	return memcachedKey(m.prefix + "generation:" + userID)
+}
+
+// memcachedKey hashes keys that Memcached would reject: keys longer than
+// 250 bytes or containing whitespace or control characters
+func memcachedKey(key string) string {
+	valid := len(key) <= memcachedMaxKeyLength
+	for i := 0; valid && i < len(key); i++ {
+		valid = key[i] > ' ' && key[i] != 0x7f
+	}
+	if valid {
+		return key
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
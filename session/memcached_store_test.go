@@ -0,0 +1,220 @@
+package session
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+func TestMemcachedExpiration(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		want int32
+	}{
+		{"relative seconds", time.Hour, 3600},
+		{"rounds up sub-second TTL", 200 * time.Millisecond, 1},
+		{"30 days stays relative", 30 * 24 * time.Hour, 30 * 24 * 3600},
+		{"longer TTL becomes a timestamp", 31 * 24 * time.Hour, int32(now.Add(31 * 24 * time.Hour).Unix())},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := memcachedExpiration(tt.ttl, now); got != tt.want {
+				t.Errorf("memcachedExpiration(%s) = %d, want %d", tt.ttl, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemcachedKey(t *testing.T) {
+	if got := memcachedKey("beacon:session:abc"); got != "beacon:session:abc" {
+		t.Errorf("valid key changed to %q", got)
+	}
+
+	for _, key := range []string{
+		"beacon:session:" + strings.Repeat("a", 250),
+		"beacon:session:user:has space",
+		"beacon:session:user:line\nbreak",
+	} {
+		got := memcachedKey(key)
+		if len(got) > memcachedMaxKeyLength || strings.ContainsAny(got, " \n") {
+			t.Errorf("memcachedKey(%q) = %q is not a valid Memcached key", key, got)
+		}
+		if got != memcachedKey(key) {
+			t.Errorf("memcachedKey(%q) is not stable", key)
+		}
+	}
+}
+
+func TestNewMemcachedStore_RequiresServers(t *testing.T) {
+	if _, err := NewMemcachedStore(nil, "beacon:session:", time.Hour); err == nil {
+		t.Error("Expected error without Memcached servers")
+	}
+}
+
+// fakeMemcached is an in-memory memcachedClient. Items returned by Get
+// remember the version they were read at, for CompareAndSwap.
+type fakeMemcached struct {
+	mu       sync.Mutex
+	items    map[string][]byte
+	versions map[string]int
+	read     map[*memcache.Item]int
+}
+
+func newFakeMemcached() *fakeMemcached {
+	return &fakeMemcached{
+		items:    make(map[string][]byte),
+		versions: make(map[string]int),
+		read:     make(map[*memcache.Item]int),
+	}
+}
+
+func (f *fakeMemcached) Get(key string) (*memcache.Item, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	value, ok := f.items[key]
+	if !ok {
+		return nil, memcache.ErrCacheMiss
+	}
+	item := &memcache.Item{Key: key, Value: append([]byte(nil), value...)}
+	f.read[item] = f.versions[key]
+	return item, nil
+}
+
+func (f *fakeMemcached) GetMulti(keys []string) (map[string]*memcache.Item, error) {
+	items := make(map[string]*memcache.Item)
+	for _, key := range keys {
+		if item, err := f.Get(key); err == nil {
+			items[key] = item
+		}
+	}
+	return items, nil
+}
+
+func (f *fakeMemcached) Set(item *memcache.Item) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.store(item)
+	return nil
+}
+
+func (f *fakeMemcached) Add(item *memcache.Item) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.items[item.Key]; ok {
+		return memcache.ErrNotStored
+	}
+	f.store(item)
+	return nil
+}
+
+func (f *fakeMemcached) CompareAndSwap(item *memcache.Item) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.items[item.Key]; !ok {
+		return memcache.ErrNotStored
+	}
+	if version, ok := f.read[item]; !ok || version != f.versions[item.Key] {
+		return memcache.ErrCASConflict
+	}
+	f.store(item)
+	return nil
+}
+
+func (f *fakeMemcached) Delete(key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.items[key]; !ok {
+		return memcache.ErrCacheMiss
+	}
+	delete(f.items, key)
+	return nil
+}
+
+func (f *fakeMemcached) Ping() error  { return nil }
+func (f *fakeMemcached) Close() error { return nil }
+
+func (f *fakeMemcached) store(item *memcache.Item) {
+	f.items[item.Key] = append([]byte(nil), item.Value...)
+	f.versions[item.Key]++
+}
+
+func TestMemcachedStore_Revocation(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeMemcached()
+	store := &MemcachedStore{client: client, prefix: "beacon:session:", ttl: time.Hour}
+
+	newSession := func(token string) *core.Session {
+		return &core.Session{
+			ID:        "id-" + token,
+			UserID:    "user-1",
+			Token:     token,
+			ExpiresAt: time.Now().Add(time.Hour),
+			CreatedAt: time.Now(),
+		}
+	}
+	mustGet := func(token string, wantFound bool) {
+		t.Helper()
+		session, _, err := store.Get(ctx, token)
+		if err != nil {
+			t.Fatalf("Get(%s) error = %v", token, err)
+		}
+		if (session != nil) != wantFound {
+			t.Fatalf("Get(%s) found = %v, want %v", token, session != nil, wantFound)
+		}
+	}
+
+	for _, token := range []string{"token-a", "token-b"} {
+		if err := store.SetWithUser(ctx, newSession(token), &core.User{ID: "user-1"}); err != nil {
+			t.Fatalf("SetWithUser() error = %v", err)
+		}
+	}
+	if err := store.Touch(ctx, "token-a", time.Now()); err != nil {
+		t.Fatalf("Touch() error = %v", err)
+	}
+	mustGet("token-a", true)
+	mustGet("token-b", true)
+
+	t.Run("evicted index still revokes", func(t *testing.T) {
+		if err := client.Delete(store.userKey("user-1")); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+		if err := store.DeleteByUserID(ctx, "user-1"); err != nil {
+			t.Fatalf("DeleteByUserID() error = %v", err)
+		}
+		mustGet("token-a", false)
+		mustGet("token-b", false)
+
+		sessions, err := store.ListByUserID(ctx, "user-1")
+		if err != nil || len(sessions) != 0 {
+			t.Errorf("ListByUserID() = %d sessions, %v; want none", len(sessions), err)
+		}
+	})
+
+	t.Run("sessions stored after revocation are live", func(t *testing.T) {
+		if err := store.SetWithUser(ctx, newSession("token-c"), nil); err != nil {
+			t.Fatalf("SetWithUser() error = %v", err)
+		}
+		mustGet("token-c", true)
+
+		sessions, err := store.ListByUserID(ctx, "user-1")
+		if err != nil || len(sessions) != 1 {
+			t.Errorf("ListByUserID() = %d sessions, %v; want 1", len(sessions), err)
+		}
+	})
+
+	t.Run("evicted generation misses", func(t *testing.T) {
+		if err := client.Delete(store.generationKey("user-1")); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+		mustGet("token-c", false)
+	})
+}
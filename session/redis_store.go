@@ -2,34 +2,93 @@ package session
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/marshallshelly/beacon-auth/core"
 	"github.com/redis/go-redis/v9"
 )
 
-// RedisStore implements Store using Redis
+// RedisStore implements Store using Redis. It works with a standalone
+// server, a Sentinel-managed master or a Redis Cluster.
 type RedisStore struct {
-	client *redis.Client
+	client redis.UniversalClient
 	prefix string
 	ttl    time.Duration
 }
 
+// RedisOptions configures the Redis connection. The deployment mode is
+// chosen by MasterName (Sentinel) and Cluster; otherwise a single server
+// is used.
+type RedisOptions struct {
+	// Addrs lists the server address for a standalone server, the seed
+	// nodes for a cluster, or the sentinel addresses for Sentinel
+	Addrs []string
+
+	// MasterName is the Sentinel master name and enables Sentinel mode
+	MasterName string
+
+	// Cluster enables Redis Cluster mode. Set it even when Addrs holds a
+	// single configuration endpoint.
+	Cluster bool
+
+	// Username and Password authenticate with Redis (ACL auth when
+	// Username is set, the legacy AUTH password otherwise)
+	Username string
+	Password string
+
+	// SentinelUsername and SentinelPassword authenticate with the
+	// sentinels when they differ from the Redis credentials
+	SentinelUsername string
+	SentinelPassword string
+
+	// DB selects the database. Redis Cluster only supports database 0.
+	DB int
+
+	// TLSConfig enables TLS when set
+	TLSConfig *tls.Config
+
+	// Connection pool tuning. Zero values use the go-redis defaults.
+	PoolSize        int
+	MinIdleConns    int
+	MaxIdleConns    int
+	PoolTimeout     time.Duration
+	ConnMaxIdleTime time.Duration
+	ConnMaxLifetime time.Duration
+	DialTimeout     time.Duration
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	MaxRetries      int
+}
+
 // NewRedisStore creates a new Redis session store
 func NewRedisStore(addr, password string, db int, prefix string, ttl time.Duration) (*RedisStore, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:     addr,
+	return NewRedisStoreWithOptions(&RedisOptions{
+		Addrs:    []string{addr},
 		Password: password,
 		DB:       db,
-	})
+	}, prefix, ttl)
+}
+
+// NewRedisStoreWithOptions creates a new Redis session store for a
+// standalone server, Sentinel or Redis Cluster
+func NewRedisStoreWithOptions(opts *RedisOptions, prefix string, ttl time.Duration) (*RedisStore, error) {
+	client, err := newRedisClient(opts)
+	if err != nil {
+		return nil, err
+	}
 
 	// Test connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
@@ -40,6 +99,52 @@ func NewRedisStore(addr, password string, db int, prefix string, ttl time.Durati
 	}, nil
 }
 
+// newRedisClient creates the client for the configured deployment mode
+func newRedisClient(opts *RedisOptions) (redis.UniversalClient, error) {
+	if opts == nil || len(opts.Addrs) == 0 {
+		return nil, errors.New("at least one Redis address is required")
+	}
+	if opts.Cluster && opts.MasterName != "" {
+		return nil, errors.New("redis cluster and sentinel modes cannot be combined")
+	}
+	if opts.Cluster && opts.DB != 0 {
+		return nil, errors.New("redis cluster only supports database 0")
+	}
+	if !opts.Cluster && opts.MasterName == "" && len(opts.Addrs) > 1 {
+		return nil, errors.New("multiple Redis addresses require cluster or sentinel mode")
+	}
+
+	universal := &redis.UniversalOptions{
+		Addrs:            opts.Addrs,
+		MasterName:       opts.MasterName,
+		Username:         opts.Username,
+		Password:         opts.Password,
+		SentinelUsername: opts.SentinelUsername,
+		SentinelPassword: opts.SentinelPassword,
+		DB:               opts.DB,
+		TLSConfig:        opts.TLSConfig,
+		PoolSize:         opts.PoolSize,
+		MinIdleConns:     opts.MinIdleConns,
+		MaxIdleConns:     opts.MaxIdleConns,
+		PoolTimeout:      opts.PoolTimeout,
+		ConnMaxIdleTime:  opts.ConnMaxIdleTime,
+		ConnMaxLifetime:  opts.ConnMaxLifetime,
+		DialTimeout:      opts.DialTimeout,
+		ReadTimeout:      opts.ReadTimeout,
+		WriteTimeout:     opts.WriteTimeout,
+		MaxRetries:       opts.MaxRetries,
+	}
+
+	switch {
+	case opts.Cluster:
+		return redis.NewClusterClient(universal.Cluster()), nil
+	case opts.MasterName != "":
+		return redis.NewFailoverClient(universal.Failover()), nil
+	default:
+		return redis.NewClient(universal.Simple()), nil
+	}
+}
+
 // Get retrieves a session by token from Redis
 func (r *RedisStore) Get(ctx context.Context, token string) (*core.Session, *core.User, error) {
 	key := r.prefix + token
@@ -132,6 +237,118 @@ func (r *RedisStore) SetWithUser(ctx context.Context, session *core.Session, use
 	return nil
 }
 
+// Touch records the last activity time of a session in Redis, keeping the
+// key's remaining TTL. Missing sessions are ignored.
+func (r *RedisStore) Touch(ctx context.Context, token string, lastActivity time.Time) error {
+	key := r.prefix + token
+
+	data, err := r.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil
+		}
+		return fmt.Errorf("redis get error: %w", err)
+	}
+
+	var sessionData SessionData
+	if err := json.Unmarshal(data, &sessionData); err != nil {
+		return fmt.Errorf("failed to unmarshal session data: %w", err)
+	}
+	if sessionData.Session == nil {
+		return nil
+	}
+	sessionData.Session.UpdatedAt = lastActivity
+
+	data, err = json.Marshal(sessionData)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session data: %w", err)
+	}
+
+	if err := r.client.Set(ctx, key, data, redis.KeepTTL).Err(); err != nil {
+		return fmt.Errorf("redis set error: %w", err)
+	}
+
+	return nil
+}
+
+// Extend sets the expiry and last update time of a session in Redis and
+// renews the key's TTL. Missing sessions are ignored.
+func (r *RedisStore) Extend(ctx context.Context, token string, expiresAt, updatedAt time.Time) error {
+	key := r.prefix + token
+
+	data, err := r.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil
+		}
+		return fmt.Errorf("redis get error: %w", err)
+	}
+
+	var sessionData SessionData
+	if err := json.Unmarshal(data, &sessionData); err != nil {
+		return fmt.Errorf("failed to unmarshal session data: %w", err)
+	}
+	if sessionData.Session == nil {
+		return nil
+	}
+	sessionData.Session.ExpiresAt = expiresAt
+	sessionData.Session.UpdatedAt = updatedAt
+
+	data, err = json.Marshal(sessionData)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session data: %w", err)
+	}
+
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil // Expired, nothing to extend
+	}
+	if r.ttl > 0 && r.ttl < ttl {
+		ttl = r.ttl
+	}
+
+	// SET XX leaves a session deleted since the read deleted
+	if err := r.client.SetXX(ctx, key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("redis set error: %w", err)
+	}
+
+	return nil
+}
+
+// SetMetadata replaces the metadata of a session in Redis, keeping the
+// key's remaining TTL. Missing sessions are ignored.
+func (r *RedisStore) SetMetadata(ctx context.Context, token string, metadata map[string]interface{}) error {
+	key := r.prefix + token
+
+	data, err := r.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil
+		}
+		return fmt.Errorf("redis get error: %w", err)
+	}
+
+	var sessionData SessionData
+	if err := json.Unmarshal(data, &sessionData); err != nil {
+		return fmt.Errorf("failed to unmarshal session data: %w", err)
+	}
+	if sessionData.Session == nil {
+		return nil
+	}
+	sessionData.Session.Metadata = metadata
+
+	data, err = json.Marshal(sessionData)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session data: %w", err)
+	}
+
+	if err := r.client.Set(ctx, key, data, redis.KeepTTL).Err(); err != nil {
+		return fmt.Errorf("redis set error: %w", err)
+	}
+
+	return nil
+}
+
 // Delete removes a session from Redis
 func (r *RedisStore) Delete(ctx context.Context, token string) error {
 	key := r.prefix + token
@@ -145,29 +362,41 @@ func (r *RedisStore) Delete(ctx context.Context, token string) error {
 
 // DeleteByUserID removes all sessions for a user from Redis
 func (r *RedisStore) DeleteByUserID(ctx context.Context, userID string) error {
-	// Scan for all session keys
-	pattern := r.prefix + "*"
-
-	var cursor uint64
-	var keys []string
-
-	for {
-		var scanKeys []string
-		var err error
+	keys, err := r.scanKeys(ctx)
+	if err != nil {
+		return err
+	}
 
-		scanKeys, cursor, err = r.client.Scan(ctx, cursor, pattern, 100).Result()
+	// Check each key to see if it belongs to the user
+	for _, key := range keys {
+		data, err := r.client.Get(ctx, key).Bytes()
 		if err != nil {
-			return fmt.Errorf("redis scan error: %w", err)
+			continue
 		}
 
-		keys = append(keys, scanKeys...)
+		var sessionData SessionData
+		if err := json.Unmarshal(data, &sessionData); err != nil {
+			continue
+		}
 
-		if cursor == 0 {
-			break
+		if sessionData.Session.UserID == userID {
+			r.client.Del(ctx, key)
 		}
 	}
 
-	// Check each key to see if it belongs to the user
+	return nil
+}
+
+// ListByUserID returns a user's active sessions from Redis, oldest first
+func (r *RedisStore) ListByUserID(ctx context.Context, userID string) ([]*core.Session, error) {
+	keys, err := r.scanKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*core.Session
+	now := time.Now()
+
 	for _, key := range keys {
 		data, err := r.client.Get(ctx, key).Bytes()
 		if err != nil {
@@ -179,12 +408,71 @@ func (r *RedisStore) DeleteByUserID(ctx context.Context, userID string) error {
 			continue
 		}
 
-		if sessionData.Session.UserID == userID {
-			r.client.Del(ctx, key)
+		session := sessionData.Session
+		if session != nil && session.UserID == userID && now.Before(session.ExpiresAt) {
+			sessions = append(sessions, session)
 		}
 	}
 
-	return nil
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+
+	return sessions, nil
+}
+
+// scanKeys returns all session keys under the store prefix. In cluster
+// mode every master is scanned, as SCAN only covers a single node.
+func (r *RedisStore) scanKeys(ctx context.Context) ([]string, error) {
+	pattern := r.prefix + "*"
+
+	cluster, ok := r.client.(*redis.ClusterClient)
+	if !ok {
+		return scanNodeKeys(ctx, r.client, pattern)
+	}
+
+	var mu sync.Mutex
+	var keys []string
+
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		nodeKeys, err := scanNodeKeys(ctx, node, pattern)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		keys = append(keys, nodeKeys...)
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// scanNodeKeys returns the keys matching pattern on a single node
+func scanNodeKeys(ctx context.Context, client redis.Cmdable, pattern string) ([]string, error) {
+	var cursor uint64
+	var keys []string
+
+	for {
+		var scanKeys []string
+		var err error
+
+		scanKeys, cursor, err = client.Scan(ctx, cursor, pattern, 100).Result()
+		if err != nil {
+			return nil, fmt.Errorf("redis scan error: %w", err)
+		}
+
+		keys = append(keys, scanKeys...)
+
+		if cursor == 0 {
+			break
+		}
+	}
+
+	return keys, nil
 }
 
 // Cleanup removes expired sessions from Redis
@@ -202,3 +490,16 @@ func (r *RedisStore) Close() error {
 func (r *RedisStore) Ping(ctx context.Context) error {
 	return r.client.Ping(ctx).Err()
 }
+
+// redisOptions returns the Redis connection options, built from RedisAddr,
+// RedisPassword and RedisDB unless Redis is set
+func (c *Config) redisOptions() *RedisOptions {
+	if c.Redis != nil {
+		return c.Redis
+	}
+	return &RedisOptions{
+		Addrs:    []string{c.RedisAddr},
+		Password: c.RedisPassword,
+		DB:       c.RedisDB,
+	}
+}
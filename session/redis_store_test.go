@@ -0,0 +1,117 @@
+package session
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestNewRedisClient_Modes(t *testing.T) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	t.Run("standalone", func(t *testing.T) {
+		client, err := newRedisClient(&RedisOptions{
+			Addrs:     []string{"localhost:6379"},
+			Username:  "beacon",
+			Password:  "secret",
+			DB:        2,
+			TLSConfig: tlsConfig,
+			PoolSize:  20,
+		})
+		if err != nil {
+			t.Fatalf("newRedisClient() error = %v", err)
+		}
+		defer client.Close()
+
+		simple, ok := client.(*redis.Client)
+		if !ok {
+			t.Fatalf("Expected *redis.Client, got %T", client)
+		}
+		opts := simple.Options()
+		if opts.Username != "beacon" || opts.Password != "secret" || opts.DB != 2 {
+			t.Errorf("Expected credentials and DB to be set, got %+v", opts)
+		}
+		if opts.TLSConfig != tlsConfig {
+			t.Error("Expected TLS config to be passed through")
+		}
+		if opts.PoolSize != 20 {
+			t.Errorf("Expected pool size 20, got %d", opts.PoolSize)
+		}
+	})
+
+	t.Run("sentinel", func(t *testing.T) {
+		client, err := newRedisClient(&RedisOptions{
+			Addrs:      []string{"sentinel-1:26379", "sentinel-2:26379"},
+			MasterName: "mymaster",
+		})
+		if err != nil {
+			t.Fatalf("newRedisClient() error = %v", err)
+		}
+		defer client.Close()
+
+		// Failover clients are *redis.Client backed by sentinel discovery
+		if _, ok := client.(*redis.Client); !ok {
+			t.Fatalf("Expected *redis.Client, got %T", client)
+		}
+	})
+
+	t.Run("cluster", func(t *testing.T) {
+		client, err := newRedisClient(&RedisOptions{
+			Addrs:           []string{"cluster.example.com:6379"},
+			Cluster:         true,
+			ConnMaxIdleTime: time.Minute,
+		})
+		if err != nil {
+			t.Fatalf("newRedisClient() error = %v", err)
+		}
+		defer client.Close()
+
+		cluster, ok := client.(*redis.ClusterClient)
+		if !ok {
+			t.Fatalf("Expected *redis.ClusterClient, got %T", client)
+		}
+		if cluster.Options().ConnMaxIdleTime != time.Minute {
+			t.Error("Expected pool options to be passed through")
+		}
+	})
+}
+
+func TestNewRedisClient_Validation(t *testing.T) {
+	tests := []struct {
+		name string
+		opts *RedisOptions
+	}{
+		{"nil options", nil},
+		{"no address", &RedisOptions{}},
+		{"cluster and sentinel", &RedisOptions{Addrs: []string{"a:6379"}, Cluster: true, MasterName: "mymaster"}},
+		{"cluster database", &RedisOptions{Addrs: []string{"a:6379"}, Cluster: true, DB: 1}},
+		{"multiple standalone addresses", &RedisOptions{Addrs: []string{"a:6379", "b:6379"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newRedisClient(tt.opts); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func TestConfig_RedisOptions(t *testing.T) {
+	config := DefaultConfig()
+	config.RedisAddr = "localhost:6379"
+	config.RedisPassword = "secret"
+	config.RedisDB = 3
+
+	opts := config.redisOptions()
+	if len(opts.Addrs) != 1 || opts.Addrs[0] != "localhost:6379" || opts.Password != "secret" || opts.DB != 3 {
+		t.Errorf("Expected options from RedisAddr, RedisPassword and RedisDB, got %+v", opts)
+	}
+
+	config.Redis = &RedisOptions{Addrs: []string{"cluster:6379"}, Cluster: true}
+	if config.redisOptions() != config.Redis {
+		t.Error("Expected Redis options to take precedence")
+	}
+}
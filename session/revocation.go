@@ -0,0 +1,150 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultRevocationChannel is the Redis pub/sub channel session
+// revocations are broadcast on
+const DefaultRevocationChannel = "beaconauth:session-revocations"
+
+// revocation is a broadcast session revocation. Origin identifies the
+// publishing Manager, which already removed the sessions.
+type revocation struct {
+	Origin string `json:"origin"`
+	Token  string `json:"token,omitempty"`
+	UserID string `json:"userId,omitempty"`
+}
+
+// revocationBus publishes revocations and receives the other managers'
+type revocationBus struct {
+	client  redis.UniversalClient
+	channel string
+	origin  string
+	pubsub  *redis.PubSub
+	done    chan struct{}
+
+	closeOnce sync.Once
+}
+
+// revocationClient returns the Redis connection the revocation broadcast
+// runs on, or nil when it is disabled
+func (m *Manager) revocationClient() redis.UniversalClient {
+	if m.config.DisableRevocationBroadcast {
+		return nil
+	}
+	if m.config.RevocationRedis != nil {
+		return m.config.RevocationRedis
+	}
+	if store, ok := m.cacheStore.(*RedisStore); ok {
+		return store.client
+	}
+	return nil
+}
+
+// startRevocations subscribes to the revocation channel and applies the
+// other managers' revocations until Close
+func (m *Manager) startRevocations() error {
+	client := m.revocationClient()
+	if client == nil {
+		return nil
+	}
+
+	origin, err := generateID()
+	if err != nil {
+		return err
+	}
+	bus := &revocationBus{
+		client:  client,
+		channel: m.config.RevocationChannel,
+		origin:  origin,
+		done:    make(chan struct{}),
+	}
+	if bus.channel == "" {
+		bus.channel = DefaultRevocationChannel
+	}
+
+	bus.pubsub = client.Subscribe(context.Background(), bus.channel)
+	if _, err := bus.pubsub.Receive(context.Background()); err != nil {
+		_ = bus.pubsub.Close()
+		return fmt.Errorf("failed to subscribe to session revocations: %w", err)
+	}
+	m.revocations = bus
+	go m.listenRevocations()
+	return nil
+}
+
+// publishRevocation broadcasts a revocation to the other managers
+func (m *Manager) publishRevocation(ctx context.Context, rev revocation) error {
+	if m.revocations == nil {
+		return nil
+	}
+	rev.Origin = m.revocations.origin
+	data, err := json.Marshal(rev)
+	if err != nil {
+		return err
+	}
+	if err := m.revocations.client.Publish(ctx, m.revocations.channel, data).Err(); err != nil {
+		return fmt.Errorf("failed to broadcast session revocation: %w", err)
+	}
+	return nil
+}
+
+// listenRevocations applies received revocations until the subscription
+// is closed
+func (m *Manager) listenRevocations() {
+	defer close(m.revocations.done)
+	for msg := range m.revocations.pubsub.Channel() {
+		var rev revocation
+		if err := json.Unmarshal([]byte(msg.Payload), &rev); err != nil || rev.Origin == m.revocations.origin {
+			continue
+		}
+		m.applyRevocation(context.Background(), rev)
+	}
+}
+
+// applyRevocation drops another manager's revoked sessions from the
+// local stores. The database is skipped, the publisher already deleted
+// them there. Failures are ignored; the sessions were revoked at the
+// source and expire from caches with their TTL.
+func (m *Manager) applyRevocation(ctx context.Context, rev revocation) {
+	if rev.Token != "" && m.activity != nil {
+		m.activity.forget(rev.Token)
+	}
+	if m.updates != nil {
+		if rev.Token != "" {
+			m.updates.forget(rev.Token)
+		} else {
+			m.updates.forgetUser(rev.UserID)
+		}
+	}
+	for _, l := range m.layers {
+		if l.name == StoreDB {
+			continue
+		}
+		switch {
+		case rev.Token != "":
+			_ = l.store.Delete(ctx, rev.Token)
+		case rev.UserID != "":
+			_ = l.store.DeleteByUserID(ctx, rev.UserID)
+		}
+	}
+}
+
+// stopRevocations closes the subscription. The Redis client is left open.
+func (m *Manager) stopRevocations() error {
+	if m.revocations == nil {
+		return nil
+	}
+	var err error
+	m.revocations.closeOnce.Do(func() {
+		err = m.revocations.pubsub.Close()
+		<-m.revocations.done
+	})
+	return err
+}
@@ -0,0 +1,123 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/marshallshelly/beacon-auth/adapters/memory"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/redis/go-redis/v9"
+)
+
+// waitRevoked waits until the manager no longer finds the session
+func waitRevoked(t *testing.T, m *Manager, token string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		session, _, _ := m.Get(context.Background(), token)
+		if session == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("revocation did not reach the other manager")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestManager_RevocationBroadcast(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	adapter := memory.New()
+	defer adapter.Close()
+	adapter.Create(ctx, "users", map[string]interface{}{"id": "user1", "email": "test@example.com"})
+
+	// Two instances sharing the database, each with its own Redis copies
+	newManager := func(prefix string) *Manager {
+		config := DefaultConfig()
+		config.EnableCookieStore = false
+		config.EnableRedisStore = true
+		config.RedisAddr = server.Addr()
+		config.RedisPrefix = prefix
+		m, err := NewManager(config, adapter)
+		if err != nil {
+			t.Fatalf("NewManager() error = %v", err)
+		}
+		t.Cleanup(func() { _ = m.Close() })
+		return m
+	}
+	a, b := newManager("a:"), newManager("b:")
+	if a.strategy != StrategyRedisFirst {
+		t.Fatalf("strategy = %v, want StrategyRedisFirst", a.strategy)
+	}
+
+	// b caches the session in its Redis on first use
+	create := func() string {
+		t.Helper()
+		_, _, token, err := a.Create(ctx, "user1", nil)
+		if err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		if session, _, err := b.Get(ctx, token); err != nil || session == nil {
+			t.Fatalf("Get() = %v, %v, want the session", session, err)
+		}
+		if !server.Exists("b:" + token) {
+			t.Fatal("session not cached in b's Redis")
+		}
+		return token
+	}
+
+	token := create()
+	if err := a.Delete(ctx, token); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	waitRevoked(t, b, token)
+
+	first, second := create(), create()
+	if err := a.DeleteByUserID(ctx, "user1"); err != nil {
+		t.Fatalf("DeleteByUserID() error = %v", err)
+	}
+	waitRevoked(t, b, first)
+	waitRevoked(t, b, second)
+}
+
+func TestManager_RevocationBroadcastCustomStore(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+
+	newManager := func(store *mapStore, disable bool) *Manager {
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		t.Cleanup(func() { _ = client.Close() })
+		config := DefaultConfig()
+		config.EnableCookieStore = false
+		config.EnableRedisStore = false
+		config.EnableDBStore = false
+		config.Stores = []StoreLayer{{Name: "memory", Store: store}}
+		config.RevocationRedis = client
+		config.DisableRevocationBroadcast = disable
+		m, err := NewManager(config, nil)
+		if err != nil {
+			t.Fatalf("NewManager() error = %v", err)
+		}
+		t.Cleanup(func() { _ = m.Close() })
+		return m
+	}
+	storeA, storeB, storeC := newMapStore(), newMapStore(), newMapStore()
+	a, b := newManager(storeA, false), newManager(storeB, false)
+	newManager(storeC, true)
+
+	session := &core.Session{ID: "s1", UserID: "user1", Token: "token1", ExpiresAt: time.Now().Add(time.Hour)}
+	for _, store := range []*mapStore{storeA, storeB, storeC} {
+		_ = store.Set(ctx, session)
+	}
+
+	if err := a.Delete(ctx, "token1"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	waitRevoked(t, b, "token1")
+	if !storeC.has("token1") {
+		t.Error("manager with the broadcast disabled dropped the session")
+	}
+}
@@ -0,0 +1,119 @@
+package session
+
+import (
+	"fmt"
+)
+
+// storeLayer is a server-side session store, in lookup order
+type storeLayer struct {
+	name  string
+	store Store
+}
+
+// buildLayers collects the enabled built-in stores and the custom stores
+// and orders them according to Config.StoreOrder
+func (m *Manager) buildLayers() ([]storeLayer, error) {
+	var layers []storeLayer
+
+	if m.cacheStore != nil {
+		name := StoreRedis
+		if _, ok := m.cacheStore.(*MemcachedStore); ok {
+			name = StoreMemcached
+		}
+		layers = append(layers, storeLayer{name: name, store: m.cacheStore})
+	}
+	if m.dbStore != nil {
+		layers = append(layers, storeLayer{name: StoreDB, store: m.dbStore})
+	}
+
+	names := make(map[string]bool)
+	for _, s := range m.config.Stores {
+		switch {
+		case s.Name == "":
+			return nil, fmt.Errorf("custom session store name is required")
+		case isBuiltinStore(s.Name):
+			return nil, fmt.Errorf("custom session store name %q is reserved", s.Name)
+		case names[s.Name]:
+			return nil, fmt.Errorf("duplicate custom session store %q", s.Name)
+		case s.Store == nil:
+			return nil, fmt.Errorf("custom session store %q is nil", s.Name)
+		}
+		names[s.Name] = true
+		layers = append(layers, storeLayer{name: s.Name, store: s.Store})
+	}
+
+	return orderLayers(layers, m.config.StoreOrder)
+}
+
+// orderLayers moves the named layers to the front in the given order.
+// Unlisted layers keep their relative order after them.
+func orderLayers(layers []storeLayer, order []string) ([]storeLayer, error) {
+	if len(order) == 0 {
+		return layers, nil
+	}
+
+	byName := make(map[string]storeLayer, len(layers))
+	for _, l := range layers {
+		byName[l.name] = l
+	}
+
+	ordered := make([]storeLayer, 0, len(layers))
+	listed := make(map[string]bool, len(order))
+	for _, name := range order {
+		if listed[name] {
+			return nil, fmt.Errorf("session store %q is listed twice in store order", name)
+		}
+		listed[name] = true
+
+		l, ok := byName[name]
+		if !ok {
+			if isBuiltinStore(name) {
+				continue // Not enabled
+			}
+			return nil, fmt.Errorf("unknown session store %q in store order", name)
+		}
+		ordered = append(ordered, l)
+	}
+
+	for _, l := range layers {
+		if !listed[l.name] {
+			ordered = append(ordered, l)
+		}
+	}
+
+	return ordered, nil
+}
+
+func isBuiltinStore(name string) bool {
+	return name == StoreRedis || name == StoreMemcached || name == StoreDB
+}
+
+// sessionLister returns the store used to list sessions: the last one in
+// lookup order that supports it, as later stores are the most durable. A
+// database store hashing tokens is only used when no other store can list
+// sessions, as the hashes it lists cannot revoke sessions in other stores.
+func (m *Manager) sessionLister() SessionLister {
+	var hashed SessionLister
+	for i := len(m.layers) - 1; i >= 0; i-- {
+		lister, ok := m.layers[i].store.(SessionLister)
+		if !ok {
+			continue
+		}
+		if db, isDB := lister.(*DBStore); isDB && db.hashTokens {
+			hashed = lister
+			continue
+		}
+		return lister
+	}
+	return hashed
+}
+
+// hasActivityStore reports whether any store can record session activity
+func (m *Manager) hasActivityStore() bool {
+	for _, l := range m.layers {
+		if _, ok := l.store.(ActivityStore); ok {
+			return true
+		}
+	}
+	return false
+}
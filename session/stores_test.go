@@ -0,0 +1,236 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/marshallshelly/beacon-auth/adapters/memory"
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// mapStore is a minimal custom store that keeps sessions in memory
+type mapStore struct {
+	mu       sync.Mutex
+	sessions map[string]SessionData
+	closed   bool
+
+	// failDelete makes Delete fail for this token
+	failDelete string
+}
+
+func newMapStore() *mapStore {
+	return &mapStore{sessions: make(map[string]SessionData)}
+}
+
+func (s *mapStore) Get(ctx context.Context, token string) (*core.Session, *core.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.sessions[token]
+	if !ok {
+		return nil, nil, nil
+	}
+	return data.Session, data.User, nil
+}
+
+func (s *mapStore) Set(ctx context.Context, session *core.Session) error {
+	return s.SetWithUser(ctx, session, nil)
+}
+
+func (s *mapStore) SetWithUser(ctx context.Context, session *core.Session, user *core.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[session.Token] = SessionData{Session: session, User: user}
+	return nil
+}
+
+func (s *mapStore) Delete(ctx context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if token == s.failDelete {
+		return errors.New("delete failed")
+	}
+	delete(s.sessions, token)
+	return nil
+}
+
+func (s *mapStore) DeleteByUserID(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for token, data := range s.sessions {
+		if data.Session.UserID == userID {
+			delete(s.sessions, token)
+		}
+	}
+	return nil
+}
+
+func (s *mapStore) Cleanup(ctx context.Context) error { return nil }
+
+func (s *mapStore) Close() error {
+	s.closed = true
+	return nil
+}
+
+func (s *mapStore) has(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.sessions[token]
+	return ok
+}
+
+func TestManager_CustomStoreOnly(t *testing.T) {
+	store := newMapStore()
+
+	config := DefaultConfig()
+	config.EnableCookieStore = false
+	config.EnableRedisStore = false
+	config.EnableDBStore = false
+	config.Stores = []StoreLayer{{Name: "map", Store: store}}
+
+	manager, err := NewManager(config, nil)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	if manager.strategy != StrategyCustom {
+		t.Errorf("Expected strategy %v, got %v", StrategyCustom, manager.strategy)
+	}
+
+	ctx := context.Background()
+	user := &core.User{ID: "user1"}
+	_, _, token, err := manager.Create(ctx, "user1", &core.SessionOptions{User: user})
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	session, sessionUser, err := manager.Get(ctx, token)
+	if err != nil || session == nil {
+		t.Fatalf("Failed to get session from custom store: %v", err)
+	}
+	if sessionUser == nil || sessionUser.ID != "user1" {
+		t.Errorf("Expected user1 from custom store, got %+v", sessionUser)
+	}
+
+	if err := manager.Delete(ctx, token); err != nil {
+		t.Fatalf("Failed to delete session: %v", err)
+	}
+	if store.has(token) {
+		t.Error("Expected session to be deleted from custom store")
+	}
+
+	if err := manager.Close(); err != nil {
+		t.Fatalf("Failed to close manager: %v", err)
+	}
+	if !store.closed {
+		t.Error("Expected custom store to be closed")
+	}
+}
+
+func TestManager_CustomStoreOrder(t *testing.T) {
+	adapter := memory.New()
+	defer adapter.Close()
+
+	cache := newMapStore()
+
+	config := DefaultConfig()
+	config.EnableCookieStore = false
+	config.EnableRedisStore = false
+	config.Stores = []StoreLayer{{Name: "map", Store: cache}}
+	config.StoreOrder = []string{StoreRedis, "map"}
+
+	manager, err := NewManager(config, adapter)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer manager.Close()
+
+	if got := []string{manager.layers[0].name, manager.layers[1].name}; got[0] != "map" || got[1] != StoreDB {
+		t.Fatalf("Expected lookup order [map db], got %v", got)
+	}
+
+	ctx := context.Background()
+	adapter.Create(ctx, "users", map[string]interface{}{
+		"id":    "user1",
+		"email": "test@example.com",
+	})
+
+	_, _, token, err := manager.Create(ctx, "user1", nil)
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if !cache.has(token) {
+		t.Fatal("Expected session to be written to the custom store")
+	}
+
+	// A session missing from the first store is found in the database and
+	// cached again
+	_ = cache.Delete(ctx, token)
+	if session, _, err := manager.Get(ctx, token); err != nil || session == nil {
+		t.Fatalf("Expected fallback to the database, got %v", err)
+	}
+	if !cache.has(token) {
+		t.Error("Expected session to be copied back into the custom store")
+	}
+
+	// Listing uses the database, the last store that supports it
+	sessions, err := manager.ListByUserID(ctx, "user1")
+	if err != nil || len(sessions) != 1 {
+		t.Errorf("Expected 1 listed session, got %d (%v)", len(sessions), err)
+	}
+}
+
+func TestManager_CustomStoreValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(*Config)
+	}{
+		{
+			name:  "missing name",
+			setup: func(c *Config) { c.Stores = []StoreLayer{{Store: newMapStore()}} },
+		},
+		{
+			name:  "reserved name",
+			setup: func(c *Config) { c.Stores = []StoreLayer{{Name: StoreDB, Store: newMapStore()}} },
+		},
+		{
+			name: "duplicate name",
+			setup: func(c *Config) {
+				c.Stores = []StoreLayer{{Name: "map", Store: newMapStore()}, {Name: "map", Store: newMapStore()}}
+			},
+		},
+		{
+			name:  "nil store",
+			setup: func(c *Config) { c.Stores = []StoreLayer{{Name: "map"}} },
+		},
+		{
+			name:  "unknown store in order",
+			setup: func(c *Config) { c.StoreOrder = []string{"dynamodb"} },
+		},
+		{
+			name:  "store listed twice",
+			setup: func(c *Config) { c.StoreOrder = []string{StoreDB, StoreDB} },
+		},
+		{
+			name: "session limit without lister",
+			setup: func(c *Config) {
+				c.EnableDBStore = false
+				c.Stores = []StoreLayer{{Name: "map", Store: newMapStore()}}
+				c.MaxSessionsPerUser = 1
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.EnableCookieStore = false
+			config.EnableRedisStore = false
+			tt.setup(config)
+
+			if _, err := NewManager(config, memory.New()); err == nil {
+				t.Error("Expected configuration error")
+			}
+		})
+	}
+}
@@ -5,9 +5,13 @@ import (
 	"time"
 
 	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/redis/go-redis/v9"
 )
 
-// Store defines the interface for session storage backends
+// Store defines the interface for session storage backends. Implement it
+// to plug in a custom backend (e.g. DynamoDB or etcd) with Config.Stores.
+// Stores may also implement UserStore, SessionLister and ActivityStore to
+// support caching, session limits and idle timeouts.
 type Store interface {
 	// Get retrieves a session by token
 	Get(ctx context.Context, token string) (*core.Session, *core.User, error)
@@ -28,6 +32,73 @@ type Store interface {
 	Close() error
 }
 
+// UserStore is implemented by stores that keep the user alongside the
+// session, so lookups do not need the database. Sessions found in a later
+// store are copied into earlier stores that implement it.
+type UserStore interface {
+	// SetWithUser stores a session together with its user
+	SetWithUser(ctx context.Context, session *core.Session, user *core.User) error
+}
+
+// SessionLister is implemented by stores that can list a user's sessions.
+// Session limits and pruning need at least one.
+type SessionLister interface {
+	// ListByUserID returns a user's active sessions, oldest first
+	ListByUserID(ctx context.Context, userID string) ([]*core.Session, error)
+}
+
+// ActivityStore is implemented by stores that can record when a session
+// was last used. IdleTimeout needs at least one.
+type ActivityStore interface {
+	// Touch records the last activity time of a session
+	Touch(ctx context.Context, token string, lastActivity time.Time) error
+}
+
+// MetadataStore is implemented by stores that can replace the metadata of
+// a stored session. Manager.SetMetadata writes stores that do not
+// implement it with Set.
+type MetadataStore interface {
+	// SetMetadata replaces the metadata of the session with the token.
+	// Missing sessions are ignored.
+	SetMetadata(ctx context.Context, token string, metadata map[string]interface{}) error
+}
+
+// ExpiryStore is implemented by stores that can extend the expiry of a
+// stored session without rewriting it. Batched updates use it so a flush
+// never recreates a session that was deleted in the meantime.
+type ExpiryStore interface {
+	// Extend sets the expiry and last update time of the session with the
+	// token. Missing sessions are ignored.
+	Extend(ctx context.Context, token string, expiresAt, updatedAt time.Time) error
+}
+
+// cacheStore is a session cache layer in front of the database (Redis or
+// Memcached). The Redis* strategies apply to whichever cache is enabled.
+type cacheStore interface {
+	Store
+	UserStore
+	SessionLister
+	ActivityStore
+	MetadataStore
+	ExpiryStore
+}
+
+// StoreLayer registers a custom session store with the Manager
+type StoreLayer struct {
+	// Name identifies the store in Config.StoreOrder and error messages
+	Name string
+
+	// Store is the session backend. The Manager closes it on Close.
+	Store Store
+}
+
+// Names of the built-in stores for Config.StoreOrder
+const (
+	StoreRedis     = "redis"
+	StoreMemcached = "memcached"
+	StoreDB        = "db"
+)
+
 // Config holds session configuration
 type Config struct {
 	// Cookie settings
@@ -38,11 +109,80 @@ type Config struct {
 	CookieHTTPOnly bool
 	CookieSameSite string // "strict", "lax", "none"
 
+	// CookieChunkSize is the largest cookie value written before the
+	// session cookie is split across numbered cookies (default
+	// core.DefaultCookieChunkSize)
+	CookieChunkSize int
+
+	// EncryptCookies encrypts cookie store tokens with AES-GCM so session
+	// and user data cannot be read client-side
+	EncryptCookies bool
+
+	// CookieUserClaims limits the user fields embedded in cookie store
+	// tokens to these JSON field names; the user ID is always kept.
+	// Empty embeds the whole user.
+	CookieUserClaims []string
+
+	// ClaimsEnricher adds custom claims to cookie store tokens (see
+	// CookieStoreOptions.ClaimsEnricher)
+	ClaimsEnricher core.ClaimsEnricher
+
+	// MaxClaimsSize caps the JSON size of custom claims in bytes
+	// (default core.DefaultMaxClaimsSize)
+	MaxClaimsSize int
+
 	// Session settings
 	ExpiresIn      time.Duration
 	UpdateAge      time.Duration // Update session timestamp if older than this
 	AbsoluteExpiry bool          // If true, session expires regardless of activity
 
+	// ShortExpiresIn is the lifetime of transient sessions, signed in
+	// without remember me (see core.SessionOptions.Transient). Zero gives
+	// them ExpiresIn.
+	ShortExpiresIn time.Duration
+
+	// IdleTimeout expires a session after this long without a request, even
+	// if ExpiresIn has not been reached (0 = disabled). Enforcement needs
+	// the Redis or database store.
+	IdleTimeout time.Duration
+
+	// Binding pins sessions to the client that created them (nil = disabled).
+	// The client is read from the lookup context (see core.WithClientInfo).
+	Binding *core.SessionBinding
+
+	// TrustedProxies lists the reverse proxies, as CIDR ranges or IP
+	// addresses, whose X-Forwarded-For headers are believed when the client
+	// is read from a request (none = the connection's peer address)
+	TrustedProxies []string
+
+	// OnBan decides what happens when a banned user's session is used.
+	// Defaults to core.BanRevoke. Either way the lookup fails with a
+	// *core.BanError, and banned users cannot create sessions.
+	OnBan core.BanAction
+
+	// Tenancy binds sessions to the tenant they were created in (see
+	// core.WithTenant). Lookups from another tenant do not find them.
+	Tenancy bool
+
+	// ActivityFlushInterval controls how often buffered last-activity
+	// timestamps are written to the stores. Defaults to a quarter of
+	// IdleTimeout, capped at one minute; must be shorter than IdleTimeout.
+	ActivityFlushInterval time.Duration
+
+	// BatchUpdates buffers the sliding-expiration writes of Update in
+	// memory and writes them behind in batches, coalescing repeated updates
+	// of a session. Buffered updates are lost if the process crashes; those
+	// sessions then expire at their previous expiry, never later.
+	BatchUpdates bool
+
+	// UpdateBatchSize flushes buffered updates once this many sessions are
+	// pending (default DefaultUpdateBatchSize)
+	UpdateBatchSize int
+
+	// UpdateFlushInterval is how long updates stay buffered at most
+	// (default DefaultUpdateFlushInterval)
+	UpdateFlushInterval time.Duration
+
 	// Storage layers (in order of priority)
 	// Session lookup: Cookie → Redis → Database
 	// Session write: All layers
@@ -50,17 +190,100 @@ type Config struct {
 	EnableRedisStore  bool
 	EnableDBStore     bool
 
+	// Stores registers custom session stores, composed with the enabled
+	// built-in stores. By default they are looked up after them.
+	Stores []StoreLayer
+
+	// StoreOrder sets the lookup order of server-side stores by name:
+	// StoreRedis, StoreMemcached, StoreDB or a StoreLayer name. Stores that
+	// are not listed follow in the default order (cache, database, then
+	// custom stores as registered); listed built-in stores that are not
+	// enabled are skipped. Writes go to every store, last store first.
+	StoreOrder []string
+
 	// Redis configuration
 	RedisAddr     string
 	RedisPassword string
 	RedisDB       int
 	RedisPrefix   string // Key prefix for Redis keys
 
+	// Redis configures Redis Cluster, Sentinel, TLS, ACL auth and
+	// connection pooling. When set it replaces RedisAddr, RedisPassword
+	// and RedisDB.
+	Redis *RedisOptions
+
+	// RevocationChannel is the Redis pub/sub channel session revocations
+	// are broadcast on (default DefaultRevocationChannel). Delete and
+	// DeleteByUserID publish on it, and every other Manager subscribed to
+	// it drops its copies of the sessions from its cache and custom
+	// stores. The broadcast runs on the Redis store's connection, or on
+	// RevocationRedis when set.
+	RevocationChannel string
+
+	// RevocationRedis carries the revocation broadcast instead of the
+	// Redis store's connection, for instances that cache sessions in
+	// separate Redis servers but can reach a shared one
+	RevocationRedis redis.UniversalClient
+
+	// DisableRevocationBroadcast turns the revocation broadcast off
+	DisableRevocationBroadcast bool
+
+	// Memcached configuration, an alternative cache layer to Redis. Only
+	// one of the two can be enabled.
+	EnableMemcachedStore bool
+	MemcachedServers     []string
+	MemcachedPrefix      string // Key prefix for Memcached keys
+
 	// Secret for signing cookies/tokens
 	Secret string
 
+	// KeyRing enables signing key rotation for cookie tokens. New tokens
+	// are signed with the active key and tokens signed by older keys in
+	// the ring remain valid. When both KeyRing and Secret are set, Secret
+	// is still accepted for tokens issued before the key ring was adopted.
+	KeyRing *KeyRing
+
 	// Issuer for JWT tokens (if using cookie store)
 	Issuer string
+
+	// TableNames overrides the default table names used by the DB store
+	TableNames *core.TableNames
+
+	// Users is where the DB store looks up session users kept outside
+	// the database (see core.UserStore; nil = the users table)
+	Users core.UserStore
+
+	// UserCache keeps the DB store's session users in memory (see
+	// NewUserCache; nil = no caching)
+	UserCache core.UserCache
+
+	// HashDBTokens stores SHA-256 hashes of session tokens in the database
+	// instead of the tokens (see DBStoreOptions.HashTokens)
+	HashDBTokens bool
+
+	// AcceptPlainDBTokens keeps plaintext tokens stored before HashDBTokens
+	// was enabled valid while they are migrated (see
+	// DBStoreOptions.AcceptPlainTokens)
+	AcceptPlainDBTokens bool
+
+	// MaxSessionsPerUser limits active sessions per user (0 = unlimited).
+	// Enforcement needs the Redis or database store; stateless cookie
+	// sessions cannot be counted or revoked.
+	MaxSessionsPerUser int
+
+	// SessionLimitStrategy applies when a user reaches MaxSessionsPerUser.
+	// Defaults to core.SessionLimitEvictOldest.
+	SessionLimitStrategy core.SessionLimitStrategy
+
+	// SecurityEvents receives session binding violations and rejected
+	// banned users (nil = disabled)
+	SecurityEvents core.SecurityEventSink
+
+	// KeepRecentSessions prunes a user's sessions down to the N most
+	// recently active whenever a new session is created (0 = disabled).
+	// Unlike MaxSessionsPerUser this is housekeeping: sessions are ranked
+	// by last activity and pruning failures do not fail sign-in.
+	KeepRecentSessions int
 }
 
 // DefaultConfig returns default session configuration
@@ -78,6 +301,7 @@ func DefaultConfig() *Config {
 		EnableRedisStore:  true,
 		EnableDBStore:     true,
 		RedisPrefix:       "beacon:session:",
+		MemcachedPrefix:   "beacon:session:",
 		Issuer:            "beaconauth",
 	}
 }
@@ -106,4 +330,7 @@ const (
 
 	// StrategyDBOnly uses only database (no caching)
 	StrategyDBOnly Strategy = "db_only"
+
+	// StrategyCustom uses custom stores (see Config.Stores and StoreOrder)
+	StrategyCustom Strategy = "custom"
 )
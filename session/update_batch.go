@@ -0,0 +1,175 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// Defaults of batched updates (Config.BatchUpdates)
+const (
+	DefaultUpdateBatchSize     = 500
+	DefaultUpdateFlushInterval = 10 * time.Second
+)
+
+// updateBatcher buffers session updates in memory so they are written in
+// batches instead of on every request. Only the latest update of each
+// session is kept.
+type updateBatcher struct {
+	size int
+
+	mu      sync.Mutex
+	pending map[string]*core.Session // token -> latest update
+
+	// full wakes the flusher when size updates are pending
+	full chan struct{}
+}
+
+func newUpdateBatcher(size int) *updateBatcher {
+	return &updateBatcher{
+		size:    size,
+		pending: make(map[string]*core.Session),
+		full:    make(chan struct{}, 1),
+	}
+}
+
+// add buffers an update, replacing an older one of the same session
+func (b *updateBatcher) add(session *core.Session) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if queued, ok := b.pending[session.Token]; ok && queued.UpdatedAt.After(session.UpdatedAt) {
+		return
+	}
+	b.pending[session.Token] = session
+	if len(b.pending) >= b.size {
+		select {
+		case b.full <- struct{}{}:
+		default: // Already signalled
+		}
+	}
+}
+
+// requeue buffers an update that failed to write again, unless a newer one
+// arrived meanwhile
+func (b *updateBatcher) requeue(session *core.Session) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.pending[session.Token]; !ok {
+		b.pending[session.Token] = session
+	}
+}
+
+// apply copies a buffered update onto a session read from the stores
+func (b *updateBatcher) apply(session *core.Session) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if queued, ok := b.pending[session.Token]; ok && queued.UpdatedAt.After(session.UpdatedAt) {
+		session.ExpiresAt = queued.ExpiresAt
+		session.UpdatedAt = queued.UpdatedAt
+	}
+}
+
+// forget drops the buffered update of a deleted session
+func (b *updateBatcher) forget(token string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.pending, token)
+}
+
+// forgetUser drops the buffered updates of a user's deleted sessions
+func (b *updateBatcher) forgetUser(userID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for token, session := range b.pending {
+		if session.UserID == userID {
+			delete(b.pending, token)
+		}
+	}
+}
+
+// drain returns and clears all buffered updates
+func (b *updateBatcher) drain() map[string]*core.Session {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	pending := b.pending
+	b.pending = make(map[string]*core.Session)
+	return pending
+}
+
+// updateFlushInterval returns the configured flush interval or the default
+func (c *Config) updateFlushInterval() time.Duration {
+	if c.UpdateFlushInterval > 0 {
+		return c.UpdateFlushInterval
+	}
+	return DefaultUpdateFlushInterval
+}
+
+// batchUpdate buffers an update instead of writing it. Sessions that could
+// expire before the next flush are not buffered and false is returned.
+func (m *Manager) batchUpdate(session *core.Session, expiresAt time.Time) bool {
+	if m.updates == nil || time.Until(expiresAt) < 2*m.config.updateFlushInterval() {
+		return false
+	}
+	queued := *session
+	m.updates.add(&queued)
+	return true
+}
+
+// FlushUpdates writes buffered session updates to the stores. It runs
+// when enough updates are pending, periodically and on Close; call it
+// directly to flush on demand. Updates that fail to write are kept for the
+// next flush.
+//
+// Stores that implement ExpiryStore only extend sessions they still have.
+// Other stores are written with Set, which can recreate a session deleted
+// while its update was being written.
+func (m *Manager) FlushUpdates(ctx context.Context) error {
+	if m.updates == nil {
+		return nil
+	}
+
+	var lastErr error
+	for _, session := range m.updates.drain() {
+		for i := len(m.layers) - 1; i >= 0; i-- {
+			var err error
+			if store, ok := m.layers[i].store.(ExpiryStore); ok {
+				err = store.Extend(ctx, session.Token, session.ExpiresAt, session.UpdatedAt)
+			} else {
+				err = m.layers[i].store.Set(ctx, session)
+			}
+			if err != nil {
+				lastErr = err
+				m.updates.requeue(session)
+				break
+			}
+		}
+	}
+
+	return lastErr
+}
+
+// runUpdateFlusher flushes buffered updates until the manager is closed
+func (m *Manager) runUpdateFlusher(interval time.Duration) {
+	defer close(m.updatesDone)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-m.updates.full:
+		case <-m.stopUpdates:
+			return
+		}
+		_ = m.FlushUpdates(context.Background()) // Best effort, retried next tick
+	}
+}
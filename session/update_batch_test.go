@@ -0,0 +1,203 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/adapters/memory"
+)
+
+func TestManager_BatchUpdates(t *testing.T) {
+	ctx := context.Background()
+	adapter := memory.New()
+	defer adapter.Close()
+	adapter.Create(ctx, "users", map[string]interface{}{"id": "user1", "email": "test@example.com"})
+
+	config := DefaultConfig()
+	config.EnableCookieStore = false
+	config.EnableRedisStore = false
+	config.UpdateAge = 0
+	config.BatchUpdates = true
+	config.UpdateFlushInterval = time.Hour // Flushed by hand
+	manager, err := NewManager(config, adapter)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer manager.Close()
+
+	stored := func(token string) time.Time {
+		t.Helper()
+		session, _, err := manager.dbStore.Get(ctx, token)
+		if err != nil || session == nil {
+			t.Fatalf("dbStore.Get() = %v, %v", session, err)
+		}
+		return session.ExpiresAt
+	}
+
+	// Updates are buffered and coalesced, but lookups see them
+	session, _, token, err := manager.Create(ctx, "user1", nil)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	before := stored(token)
+	session.ExpiresAt = before.Add(-time.Hour) // Renewing visibly moves it
+	for i := 0; i < 3; i++ {
+		if err := manager.Update(ctx, session); err != nil {
+			t.Fatalf("Update() error = %v", err)
+		}
+	}
+	if !stored(token).Equal(before) {
+		t.Fatal("Update() wrote through with batching on")
+	}
+	if got, _, _ := manager.Get(ctx, token); got == nil || !got.ExpiresAt.Equal(session.ExpiresAt) {
+		t.Fatalf("Get() = %v, want the buffered expiry %v", got, session.ExpiresAt)
+	}
+
+	if err := manager.FlushUpdates(ctx); err != nil {
+		t.Fatalf("FlushUpdates() error = %v", err)
+	}
+	if !stored(token).Equal(session.ExpiresAt) {
+		t.Errorf("stored expiry = %v, want %v", stored(token), session.ExpiresAt)
+	}
+
+	// A flush does not recreate a session deleted after its update
+	session.UpdatedAt = time.Time{}
+	if err := manager.Update(ctx, session); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	buffered := *session
+	if err := manager.Delete(ctx, token); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	manager.updates.add(&buffered) // As if the flush had already drained it
+	if err := manager.FlushUpdates(ctx); err != nil {
+		t.Fatalf("FlushUpdates() error = %v", err)
+	}
+	if got, _, _ := manager.dbStore.Get(ctx, token); got != nil {
+		t.Error("flush recreated a deleted session")
+	}
+
+}
+
+func TestManager_BatchUpdatesFlushOnClose(t *testing.T) {
+	ctx := context.Background()
+	store := newMapStore()
+
+	config := DefaultConfig()
+	config.EnableCookieStore = false
+	config.EnableRedisStore = false
+	config.EnableDBStore = false
+	config.Stores = []StoreLayer{{Name: "memory", Store: store}}
+	config.UpdateAge = 0
+	config.BatchUpdates = true
+	config.UpdateFlushInterval = time.Hour
+	manager, err := NewManager(config, nil)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+
+	session, _, token, err := manager.Create(ctx, "user1", nil)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	update := *session // The store holds the created session itself
+	update.ExpiresAt = session.ExpiresAt.Add(-time.Hour)
+	if err := manager.Update(ctx, &update); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if stored, _, _ := store.Get(ctx, token); stored.ExpiresAt.Equal(update.ExpiresAt) {
+		t.Fatal("Update() wrote through with batching on")
+	}
+	if err := manager.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if stored, _, _ := store.Get(ctx, token); stored == nil || !stored.ExpiresAt.Equal(update.ExpiresAt) {
+		t.Errorf("stored session = %v, want the buffered update flushed on Close", stored)
+	}
+}
+
+func TestManager_BatchUpdatesFlushOnSize(t *testing.T) {
+	ctx := context.Background()
+	adapter := memory.New()
+	defer adapter.Close()
+	adapter.Create(ctx, "users", map[string]interface{}{"id": "user1", "email": "test@example.com"})
+
+	config := DefaultConfig()
+	config.EnableCookieStore = false
+	config.EnableRedisStore = false
+	config.UpdateAge = 0
+	config.BatchUpdates = true
+	config.UpdateBatchSize = 2
+	config.UpdateFlushInterval = time.Hour
+	manager, err := NewManager(config, adapter)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer manager.Close()
+
+	var tokens []string
+	var updated []time.Time
+	for i := 0; i < 2; i++ {
+		session, _, token, err := manager.Create(ctx, "user1", nil)
+		if err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		session.ExpiresAt = session.ExpiresAt.Add(-time.Hour)
+		if err := manager.Update(ctx, session); err != nil {
+			t.Fatalf("Update() error = %v", err)
+		}
+		tokens = append(tokens, token)
+		updated = append(updated, session.ExpiresAt)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for i, token := range tokens {
+		for {
+			stored, _, err := manager.dbStore.Get(ctx, token)
+			if err != nil {
+				t.Fatalf("dbStore.Get() error = %v", err)
+			}
+			if stored != nil && stored.ExpiresAt.Equal(updated[i]) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("full batch was not flushed")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+}
+
+func TestManager_BatchUpdatesNearExpiry(t *testing.T) {
+	ctx := context.Background()
+	adapter := memory.New()
+	defer adapter.Close()
+	adapter.Create(ctx, "users", map[string]interface{}{"id": "user1", "email": "test@example.com"})
+
+	config := DefaultConfig()
+	config.EnableCookieStore = false
+	config.EnableRedisStore = false
+	config.UpdateAge = 0
+	config.BatchUpdates = true
+	config.UpdateFlushInterval = time.Hour
+	manager, err := NewManager(config, adapter)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	defer manager.Close()
+
+	// A session that could lapse before the next flush is written at once
+	session, _, token, err := manager.Create(ctx, "user1", nil)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	session.ExpiresAt = time.Now().Add(time.Minute)
+	if err := manager.Update(ctx, session); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	stored, _, err := manager.dbStore.Get(ctx, token)
+	if err != nil || stored == nil || !stored.ExpiresAt.Equal(session.ExpiresAt) {
+		t.Errorf("stored session = %v, %v, want it written through", stored, err)
+	}
+}
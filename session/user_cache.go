@@ -0,0 +1,207 @@
+package session
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/redis/go-redis/v9"
+)
+
+// Defaults of UserCacheOptions
+const (
+	DefaultUserCacheSize    = 10000
+	DefaultUserCacheTTL     = 30 * time.Second
+	DefaultUserCacheChannel = "beaconauth:user-invalidations"
+)
+
+// UserCacheOptions configures a UserCache
+type UserCacheOptions struct {
+	// Size is how many users are kept; the least recently used are
+	// evicted first (0 = DefaultUserCacheSize)
+	Size int
+
+	// TTL is how long a user is served from the cache. It bounds how
+	// stale a user changed outside BeaconAuth can be, such as a ban set
+	// in the users table (0 = DefaultUserCacheTTL).
+	TTL time.Duration
+
+	// Redis, when set, publishes invalidations on Channel and drops the
+	// users other instances invalidate, so a user changed on one
+	// instance is not served stale by the others
+	Redis redis.UniversalClient
+
+	// Channel is the Redis pub/sub channel of invalidations
+	// (default DefaultUserCacheChannel)
+	Channel string
+}
+
+// UserCache is an in-process LRU cache of users with a TTL. It implements
+// core.UserCache; pass it to beaconauth.WithUserCache.
+type UserCache struct {
+	size    int
+	ttl     time.Duration
+	redis   redis.UniversalClient
+	channel string
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+
+	pubsub *redis.PubSub
+	done   chan struct{}
+}
+
+type userCacheEntry struct {
+	user    *core.User
+	expires time.Time
+}
+
+// NewUserCache creates a user cache. With opts.Redis, it subscribes to
+// the invalidation channel before returning.
+func NewUserCache(opts UserCacheOptions) (*UserCache, error) {
+	c := &UserCache{
+		size:    opts.Size,
+		ttl:     opts.TTL,
+		redis:   opts.Redis,
+		channel: opts.Channel,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+	if c.size <= 0 {
+		c.size = DefaultUserCacheSize
+	}
+	if c.ttl <= 0 {
+		c.ttl = DefaultUserCacheTTL
+	}
+	if c.channel == "" {
+		c.channel = DefaultUserCacheChannel
+	}
+
+	if c.redis != nil {
+		c.pubsub = c.redis.Subscribe(context.Background(), c.channel)
+		if _, err := c.pubsub.Receive(context.Background()); err != nil {
+			_ = c.pubsub.Close()
+			return nil, err
+		}
+		c.done = make(chan struct{})
+		go c.listen()
+	}
+	return c, nil
+}
+
+// GetUser returns a copy of the cached user, unless it expired
+func (c *UserCache) GetUser(_ context.Context, userID string) (*core.User, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[userID]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*userCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return cloneUser(entry.user), true
+}
+
+// SetUser caches a copy of user for the TTL
+func (c *UserCache) SetUser(_ context.Context, user *core.User) {
+	if user == nil || user.ID == "" {
+		return
+	}
+	entry := &userCacheEntry{user: cloneUser(user), expires: time.Now().Add(c.ttl)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[user.ID]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[user.ID] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+// InvalidateUser drops a user, and publishes the invalidation to the
+// other instances when the cache has Redis. Publishing is best effort;
+// instances that miss it serve the user until the TTL ends.
+func (c *UserCache) InvalidateUser(ctx context.Context, userID string) {
+	c.drop(userID)
+	if c.redis != nil {
+		_ = c.redis.Publish(ctx, c.channel, userID).Err()
+	}
+}
+
+// Len returns how many users are cached, including expired ones not yet
+// evicted
+func (c *UserCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Close stops listening for invalidations. The Redis client is left open.
+func (c *UserCache) Close() error {
+	if c.pubsub == nil {
+		return nil
+	}
+	err := c.pubsub.Close()
+	<-c.done
+	return err
+}
+
+// Ping checks the Redis connection used for invalidations, if any
+func (c *UserCache) Ping(ctx context.Context) error {
+	if c.redis == nil {
+		return nil
+	}
+	return c.redis.Ping(ctx).Err()
+}
+
+// listen drops the users other instances invalidate until Close
+func (c *UserCache) listen() {
+	defer close(c.done)
+	for msg := range c.pubsub.Channel() {
+		c.drop(msg.Payload)
+	}
+}
+
+func (c *UserCache) drop(userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[userID]; ok {
+		c.remove(elem)
+	}
+}
+
+// remove deletes an entry; the caller holds mu
+func (c *UserCache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*userCacheEntry).user.ID)
+}
+
+// cloneUser copies a user deeply enough that neither copy sees changes
+// made to the other
+func cloneUser(user *core.User) *core.User {
+	clone := *user
+	if user.BanExpires != nil {
+		expires := *user.BanExpires
+		clone.BanExpires = &expires
+	}
+	if user.Metadata != nil {
+		clone.Metadata = make(map[string]interface{}, len(user.Metadata))
+		for k, v := range user.Metadata {
+			clone.Metadata[k] = v
+		}
+	}
+	return &clone
+}
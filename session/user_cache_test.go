@@ -0,0 +1,84 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestUserCache_LRUAndTTL(t *testing.T) {
+	ctx := context.Background()
+	cache, err := NewUserCache(UserCacheOptions{Size: 2, TTL: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		cache.SetUser(ctx, &core.User{ID: fmt.Sprintf("u%d", i)})
+	}
+	cache.GetUser(ctx, "u1") // u2 is now the least recently used
+	cache.SetUser(ctx, &core.User{ID: "u3"})
+	if _, ok := cache.GetUser(ctx, "u2"); ok {
+		t.Error("least recently used user was not evicted")
+	}
+	if _, ok := cache.GetUser(ctx, "u1"); !ok {
+		t.Error("recently used user was evicted")
+	}
+
+	// Callers get copies
+	user, _ := cache.GetUser(ctx, "u1")
+	user.Banned = true
+	if cached, _ := cache.GetUser(ctx, "u1"); cached.Banned {
+		t.Error("changing a returned user changed the cache")
+	}
+
+	cache.InvalidateUser(ctx, "u1")
+	if _, ok := cache.GetUser(ctx, "u1"); ok {
+		t.Error("invalidated user still cached")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := cache.GetUser(ctx, "u3"); ok {
+		t.Error("expired user still served")
+	}
+	if cache.Len() != 0 {
+		t.Errorf("Len() = %d, want 0", cache.Len())
+	}
+}
+
+func TestUserCache_RedisInvalidation(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+
+	newCache := func() *UserCache {
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		t.Cleanup(func() { _ = client.Close() })
+		cache, err := NewUserCache(UserCacheOptions{Redis: client})
+		if err != nil {
+			t.Fatalf("NewUserCache() error = %v", err)
+		}
+		t.Cleanup(func() { _ = cache.Close() })
+		return cache
+	}
+	a, b := newCache(), newCache()
+
+	a.SetUser(ctx, &core.User{ID: "u1"})
+	b.SetUser(ctx, &core.User{ID: "u1"})
+	a.InvalidateUser(ctx, "u1")
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := b.GetUser(ctx, "u1"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("invalidation did not reach the other instance")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,152 @@
+package siem
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// ECSVersion is the Elastic Common Schema version of formatted events
+const ECSVersion = "8.11.0"
+
+// ecsSeverity maps severities to the numeric event.severity scale used by
+// Elastic detection rules
+var ecsSeverity = map[core.SecuritySeverity]int{
+	core.SeverityLow:      21,
+	core.SeverityMedium:   47,
+	core.SeverityHigh:     73,
+	core.SeverityCritical: 99,
+}
+
+// ecsClassification holds the event.category, event.type and
+// event.outcome of an event type
+type ecsClassification struct {
+	categories []string
+	types      []string
+	outcome    string
+}
+
+var ecsClassifications = map[core.SecurityEventType]ecsClassification{
+	core.EventLoginFailed:             {[]string{"authentication"}, []string{"start"}, "failure"},
+	core.EventLoginFailureSpike:       {[]string{"authentication", "intrusion_detection"}, []string{"info"}, "failure"},
+	core.EventTwoFactorFailed:         {[]string{"authentication"}, []string{"start"}, "failure"},
+	core.EventSessionBindingViolation: {[]string{"session", "intrusion_detection"}, []string{"denied"}, "failure"},
+	core.EventUserBanned:              {[]string{"iam"}, []string{"user", "change"}, "success"},
+	core.EventBannedUserRejected:      {[]string{"authentication"}, []string{"start"}, "failure"},
+	core.EventUserUnbanned:            {[]string{"iam"}, []string{"user", "change"}, "success"},
+	core.EventImpersonationStarted:    {[]string{"iam", "session"}, []string{"admin", "start"}, "success"},
+	core.EventRefreshTokenReuse:       {[]string{"authentication", "intrusion_detection"}, []string{"denied"}, "failure"},
+	core.EventUserDataExported:        {[]string{"iam"}, []string{"user", "access"}, "success"},
+}
+
+// ECS converts an event to an Elastic Common Schema document. High and
+// critical events are marked as alerts (event.kind "alert"). Fields
+// without an ECS equivalent are placed under "beaconauth".
+func ECS(event *core.SecurityEvent) map[string]interface{} {
+	class, ok := ecsClassifications[event.Type]
+	if !ok {
+		class = ecsClassification{categories: []string{"authentication"}, types: []string{"info"}, outcome: "unknown"}
+	}
+
+	kind := "event"
+	if event.Severity == core.SeverityHigh || event.Severity == core.SeverityCritical {
+		kind = "alert"
+	}
+
+	message := string(event.Type)
+	if event.Reason != "" {
+		message += ": " + event.Reason
+	}
+
+	ts := event.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	eventFields := map[string]interface{}{
+		"kind":     kind,
+		"category": class.categories,
+		"type":     class.types,
+		"action":   string(event.Type),
+		"outcome":  class.outcome,
+		"severity": ecsSeverity[event.Severity],
+		"dataset":  "beaconauth.security",
+		"provider": "beaconauth",
+		"created":  ts.UTC().Format(time.RFC3339Nano),
+	}
+	if event.Reason != "" {
+		eventFields["reason"] = event.Reason
+	}
+
+	doc := map[string]interface{}{
+		"@timestamp": ts.UTC().Format(time.RFC3339Nano),
+		"ecs":        map[string]interface{}{"version": ECSVersion},
+		"message":    message,
+		"event":      eventFields,
+		"labels":     map[string]interface{}{"severity": string(event.Severity)},
+	}
+
+	subject := map[string]interface{}{}
+	if event.UserID != "" {
+		subject["id"] = event.UserID
+	}
+	if event.Email != "" {
+		subject["email"] = event.Email
+	}
+	if event.ActorID != "" {
+		// The actor performed the action on the subject
+		user := map[string]interface{}{"id": event.ActorID}
+		if len(subject) > 0 {
+			user["target"] = subject
+		}
+		doc["user"] = user
+	} else if len(subject) > 0 {
+		doc["user"] = subject
+	}
+
+	if event.IPAddress != "" {
+		source := map[string]interface{}{"address": event.IPAddress}
+		if ip := sourceIP(event.IPAddress); ip != "" {
+			source["ip"] = ip
+		}
+		doc["source"] = source
+	}
+	if event.UserAgent != "" {
+		doc["user_agent"] = map[string]interface{}{"original": event.UserAgent}
+	}
+
+	beacon := map[string]interface{}{}
+	if event.SessionID != "" {
+		beacon["session_id"] = event.SessionID
+	}
+	if len(event.Metadata) > 0 {
+		beacon["metadata"] = event.Metadata
+	}
+	if len(beacon) > 0 {
+		doc["beaconauth"] = beacon
+	}
+
+	return doc
+}
+
+// MarshalECS encodes an event as a single-line ECS JSON document
+func MarshalECS(event *core.SecurityEvent) ([]byte, error) {
+	return json.Marshal(ECS(event))
+}
+
+// sourceIP extracts the client IP from an address that may be a
+// X-Forwarded-For list or include a port. It returns "" when no valid IP
+// is found.
+func sourceIP(address string) string {
+	address = strings.TrimSpace(strings.Split(address, ",")[0])
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+	if net.ParseIP(address) == nil {
+		return ""
+	}
+	return address
+}
@@ -0,0 +1,153 @@
+package siem
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// HTTPSOptions configures an HTTPSSink
+type HTTPSOptions struct {
+	// Headers are added to every request, e.g. Authorization or an
+	// ingest API key
+	Headers map[string]string
+
+	// TLSConfig customizes the TLS client, e.g. a private CA or a client
+	// certificate. Ignored when Client is set.
+	TLSConfig *tls.Config
+
+	// Client replaces the default HTTP client
+	Client *http.Client
+
+	// Timeout bounds each request (default 10s). Ignored when Client is set.
+	Timeout time.Duration
+
+	// MaxRetries is the number of retries after a network error, 429 or
+	// 5xx response (default 3, negative disables)
+	MaxRetries int
+
+	// RetryBackoff is the delay before the first retry, doubled for each
+	// further retry (default 500ms)
+	RetryBackoff time.Duration
+
+	// AllowInsecure permits http:// endpoints, e.g. a collector on
+	// localhost. Events contain personal data; do not use it across a
+	// network.
+	AllowInsecure bool
+}
+
+// HTTPSSink posts each event as an ECS JSON document to an HTTPS endpoint,
+// such as an Elastic, Splunk HEC or Logstash HTTP input
+type HTTPSSink struct {
+	endpoint string
+	client   *http.Client
+	headers  map[string]string
+	retries  int
+	backoff  time.Duration
+}
+
+// NewHTTPSSink creates a sink posting to endpoint
+func NewHTTPSSink(endpoint string, opts *HTTPSOptions) (*HTTPSSink, error) {
+	if opts == nil {
+		opts = &HTTPSOptions{}
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid SIEM endpoint: %q", endpoint)
+	}
+	switch u.Scheme {
+	case "https":
+	case "http":
+		if !opts.AllowInsecure {
+			return nil, errors.New("SIEM endpoint must use https (set AllowInsecure to permit http)")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported SIEM endpoint scheme: %q", u.Scheme)
+	}
+
+	s := &HTTPSSink{
+		endpoint: endpoint,
+		client:   opts.Client,
+		headers:  opts.Headers,
+		retries:  opts.MaxRetries,
+		backoff:  opts.RetryBackoff,
+	}
+	if s.client == nil {
+		timeout := opts.Timeout
+		if timeout <= 0 {
+			timeout = 10 * time.Second
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if opts.TLSConfig != nil {
+			transport.TLSClientConfig = opts.TLSConfig
+		}
+		s.client = &http.Client{Timeout: timeout, Transport: transport}
+	}
+	if s.retries == 0 {
+		s.retries = 3
+	}
+	if s.backoff <= 0 {
+		s.backoff = 500 * time.Millisecond
+	}
+	return s, nil
+}
+
+// Send posts the event, retrying transient failures
+func (s *HTTPSSink) Send(ctx context.Context, event *core.SecurityEvent) error {
+	body, err := MarshalECS(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	backoff := s.backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := s.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= s.retries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post sends one request and reports whether a failure is worth retrying
+func (s *HTTPSSink) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, fmt.Errorf("failed to post event: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("SIEM endpoint returned %s", resp.Status)
+}
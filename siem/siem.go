@@ -0,0 +1,335 @@
+// Package siem streams BeaconAuth security events to SIEM systems. A
+// Dispatcher queues events emitted on the request path and delivers them
+// in the background, formatted as Elastic Common Schema (ECS) JSON, to
+// HTTPS collectors or syslog servers.
+//
+//	dispatcher := siem.NewDispatcher(nil, httpsSink, syslogSink)
+//	auth, err := beaconauth.New(beaconauth.WithSecurityEvents(dispatcher), ...)
+package siem
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// Defaults for Options
+const (
+	DefaultBufferSize           = 1024
+	DefaultSendTimeout          = 10 * time.Second
+	DefaultFailedLoginThreshold = 10
+	DefaultFailedLoginWindow    = 5 * time.Minute
+)
+
+var (
+	// ErrQueueFull is returned by Emit when a sink's queue is full and the
+	// event was dropped for that sink
+	ErrQueueFull = errors.New("security event queue is full")
+
+	// ErrClosed is returned by Emit after the dispatcher is closed
+	ErrClosed = errors.New("security event dispatcher is closed")
+)
+
+// Sink delivers security events to an external system
+type Sink interface {
+	Send(ctx context.Context, event *core.SecurityEvent) error
+}
+
+// Options configures a Dispatcher
+type Options struct {
+	// BufferSize is the number of events queued per sink (default 1024)
+	BufferSize int
+
+	// SendTimeout bounds each delivery to a sink (default 10s)
+	SendTimeout time.Duration
+
+	// FailedLoginThreshold is the number of failed sign-ins from one IP
+	// address, or for one account, within FailedLoginWindow that raises
+	// an EventLoginFailureSpike (default 10, negative disables)
+	FailedLoginThreshold int
+
+	// FailedLoginWindow is the sliding window for FailedLoginThreshold
+	// (default 5m)
+	FailedLoginWindow time.Duration
+
+	// MinSeverity drops events below this severity (default: deliver all)
+	MinSeverity core.SecuritySeverity
+
+	// Logger reports delivery failures (nil = silent)
+	Logger core.Logger
+}
+
+// severityRank orders severities for MinSeverity
+var severityRank = map[core.SecuritySeverity]int{
+	core.SeverityLow:      1,
+	core.SeverityMedium:   2,
+	core.SeverityHigh:     3,
+	core.SeverityCritical: 4,
+}
+
+// Dispatcher fans security events out to sinks. Each sink has its own
+// queue and worker, so a slow collector does not delay the others or the
+// request that emitted the event. It implements core.SecurityEventSink.
+type Dispatcher struct {
+	opts    Options
+	sinks   []*sinkWorker
+	spikes  *failureTracker
+	dropped atomic.Uint64
+
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+type sinkWorker struct {
+	sink  Sink
+	queue chan *core.SecurityEvent
+}
+
+// NewDispatcher creates a dispatcher delivering to sinks
+func NewDispatcher(opts *Options, sinks ...Sink) *Dispatcher {
+	d := &Dispatcher{}
+	if opts != nil {
+		d.opts = *opts
+	}
+	if d.opts.BufferSize <= 0 {
+		d.opts.BufferSize = DefaultBufferSize
+	}
+	if d.opts.SendTimeout <= 0 {
+		d.opts.SendTimeout = DefaultSendTimeout
+	}
+	if d.opts.FailedLoginThreshold == 0 {
+		d.opts.FailedLoginThreshold = DefaultFailedLoginThreshold
+	}
+	if d.opts.FailedLoginWindow <= 0 {
+		d.opts.FailedLoginWindow = DefaultFailedLoginWindow
+	}
+	if d.opts.FailedLoginThreshold > 0 {
+		d.spikes = newFailureTracker(d.opts.FailedLoginThreshold, d.opts.FailedLoginWindow)
+	}
+
+	for _, sink := range sinks {
+		w := &sinkWorker{sink: sink, queue: make(chan *core.SecurityEvent, d.opts.BufferSize)}
+		d.sinks = append(d.sinks, w)
+		d.wg.Add(1)
+		go d.run(w)
+	}
+	return d
+}
+
+// Emit queues the event for every sink. It never blocks: when a sink's
+// queue is full the event is dropped for that sink and ErrQueueFull is
+// returned. Failed sign-ins are also counted towards spike detection.
+func (d *Dispatcher) Emit(ctx context.Context, event *core.SecurityEvent) error {
+	if event == nil {
+		return nil
+	}
+
+	err := d.enqueue(event)
+
+	if event.Type == core.EventLoginFailed && d.spikes != nil {
+		for _, spike := range d.spikes.record(event) {
+			if spikeErr := d.enqueue(spike); err == nil {
+				err = spikeErr
+			}
+		}
+	}
+
+	return err
+}
+
+func (d *Dispatcher) enqueue(event *core.SecurityEvent) error {
+	if min, ok := severityRank[d.opts.MinSeverity]; ok && severityRank[event.Severity] < min {
+		return nil
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return ErrClosed
+	}
+
+	var err error
+	for _, w := range d.sinks {
+		select {
+		case w.queue <- event:
+		default:
+			d.dropped.Add(1)
+			err = ErrQueueFull
+		}
+	}
+	return err
+}
+
+func (d *Dispatcher) run(w *sinkWorker) {
+	defer d.wg.Done()
+	for event := range w.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), d.opts.SendTimeout)
+		if err := w.sink.Send(ctx, event); err != nil && d.opts.Logger != nil {
+			d.opts.Logger.Warn("Failed to deliver security event", "type", event.Type, "error", err)
+		}
+		cancel()
+	}
+}
+
+// Dropped returns the number of deliveries dropped because a queue was full
+func (d *Dispatcher) Dropped() uint64 {
+	return d.dropped.Load()
+}
+
+// Close stops accepting events, delivers the queued ones and closes sinks
+// that implement io.Closer
+func (d *Dispatcher) Close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	for _, w := range d.sinks {
+		close(w.queue)
+	}
+	d.mu.Unlock()
+
+	d.wg.Wait()
+
+	var errs []error
+	for _, w := range d.sinks {
+		if closer, ok := w.sink.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DescribeSecurity reports the sink count and spike detection settings for
+// the security posture summary
+func (d *Dispatcher) DescribeSecurity() map[string]interface{} {
+	desc := map[string]interface{}{
+		"sinks": len(d.sinks),
+	}
+	if d.spikes != nil {
+		desc["failedLoginThreshold"] = d.opts.FailedLoginThreshold
+		desc["failedLoginWindow"] = d.opts.FailedLoginWindow.String()
+	}
+	if d.opts.MinSeverity != "" {
+		desc["minSeverity"] = string(d.opts.MinSeverity)
+	}
+	return desc
+}
+
+// failureTracker counts failed sign-ins per IP address and per account in
+// a sliding window and reports a spike once per window
+type failureTracker struct {
+	threshold int
+	window    time.Duration
+
+	mu       sync.Mutex
+	failures map[string][]time.Time
+	alerted  map[string]time.Time
+	records  int
+}
+
+func newFailureTracker(threshold int, window time.Duration) *failureTracker {
+	return &failureTracker{
+		threshold: threshold,
+		window:    window,
+		failures:  make(map[string][]time.Time),
+		alerted:   make(map[string]time.Time),
+	}
+}
+
+// record counts a failed sign-in and returns spike events for the keys
+// that crossed the threshold
+func (t *failureTracker) record(event *core.SecurityEvent) []*core.SecurityEvent {
+	now := event.Time
+	if now.IsZero() {
+		now = time.Now().UTC()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.records++
+	if t.records%1000 == 0 {
+		t.sweep(now)
+	}
+
+	var spikes []*core.SecurityEvent
+	for _, key := range failureKeys(event) {
+		times := append(prune(t.failures[key], now, t.window), now)
+		t.failures[key] = times
+
+		if len(times) < t.threshold {
+			continue
+		}
+		if last, ok := t.alerted[key]; ok && now.Sub(last) < t.window {
+			continue
+		}
+		t.alerted[key] = now
+
+		spike := &core.SecurityEvent{
+			Type:      core.EventLoginFailureSpike,
+			Severity:  core.SeverityHigh,
+			Time:      now,
+			IPAddress: event.IPAddress,
+			UserAgent: event.UserAgent,
+			Reason:    "failed sign-ins exceeded threshold",
+			Metadata: map[string]interface{}{
+				"failures": len(times),
+				"window":   t.window.String(),
+			},
+		}
+		if strings.HasPrefix(key, "email:") {
+			spike.Email = event.Email
+			spike.UserID = event.UserID
+			spike.Metadata["scope"] = "account"
+		} else {
+			spike.Metadata["scope"] = "ip"
+		}
+		spikes = append(spikes, spike)
+	}
+	return spikes
+}
+
+// sweep drops keys with no failures in the window
+func (t *failureTracker) sweep(now time.Time) {
+	for key, times := range t.failures {
+		if len(prune(times, now, t.window)) == 0 {
+			delete(t.failures, key)
+		}
+	}
+	for key, last := range t.alerted {
+		if now.Sub(last) >= t.window {
+			delete(t.alerted, key)
+		}
+	}
+}
+
+func failureKeys(event *core.SecurityEvent) []string {
+	var keys []string
+	if ip := sourceIP(event.IPAddress); ip != "" {
+		keys = append(keys, "ip:"+ip)
+	}
+	if event.Email != "" {
+		keys = append(keys, "email:"+strings.ToLower(event.Email))
+	}
+	return keys
+}
+
+// prune drops timestamps older than the window
+func prune(times []time.Time, now time.Time, window time.Duration) []time.Time {
+	i := 0
+	for i < len(times) && now.Sub(times[i]) >= window {
+		i++
+	}
+	return times[i:]
+}
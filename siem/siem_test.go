@@ -0,0 +1,289 @@
+package siem
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// recordingSink collects delivered events
+type recordingSink struct {
+	mu     sync.Mutex
+	events []*core.SecurityEvent
+	block  chan struct{}
+	closed bool
+}
+
+func (s *recordingSink) Send(ctx context.Context, event *core.SecurityEvent) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func (s *recordingSink) types() []core.SecurityEventType {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var types []core.SecurityEventType
+	for _, e := range s.events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func failedLogin(ip, email string) *core.SecurityEvent {
+	return &core.SecurityEvent{
+		Type:      core.EventLoginFailed,
+		Severity:  core.SeverityLow,
+		Time:      time.Now(),
+		IPAddress: ip,
+		Email:     email,
+	}
+}
+
+func TestDispatcher_DeliversAndDetectsSpikes(t *testing.T) {
+	sink := &recordingSink{}
+	d := NewDispatcher(&Options{FailedLoginThreshold: 3, FailedLoginWindow: time.Minute}, sink)
+
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		// Rotating accounts from one address only trips the IP threshold
+		if err := d.Emit(ctx, failedLogin("203.0.113.7:5123", "user"+strconv.Itoa(i)+"@example.com")); err != nil {
+			t.Fatalf("Emit() error = %v", err)
+		}
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	spikes := 0
+	for _, typ := range sink.types() {
+		if typ == core.EventLoginFailureSpike {
+			spikes++
+		}
+	}
+	if len(sink.events) != 6 || spikes != 1 {
+		t.Errorf("Expected 5 failures and 1 spike, got %v", sink.types())
+	}
+	if !sink.closed {
+		t.Error("Expected sink to be closed")
+	}
+	if err := d.Emit(ctx, failedLogin("203.0.113.7", "")); err != ErrClosed {
+		t.Errorf("Expected ErrClosed after Close, got %v", err)
+	}
+}
+
+func TestDispatcher_AccountSpike(t *testing.T) {
+	tracker := newFailureTracker(2, time.Minute)
+	tracker.record(failedLogin("203.0.113.1", "Ada@example.com"))
+	spikes := tracker.record(failedLogin("198.51.100.2", "ada@example.com"))
+
+	if len(spikes) != 1 || spikes[0].Metadata["scope"] != "account" || spikes[0].Email != "ada@example.com" {
+		t.Fatalf("Expected one account spike, got %+v", spikes)
+	}
+	if spikes := tracker.record(failedLogin("192.0.2.3", "ada@example.com")); len(spikes) != 0 {
+		t.Error("Expected one alert per window")
+	}
+}
+
+func TestDispatcher_QueueFullAndMinSeverity(t *testing.T) {
+	sink := &recordingSink{block: make(chan struct{})}
+	d := NewDispatcher(&Options{BufferSize: 1, FailedLoginThreshold: -1, MinSeverity: core.SeverityMedium}, sink)
+	ctx := context.Background()
+
+	// Below MinSeverity: ignored without error
+	if err := d.Emit(ctx, failedLogin("203.0.113.7", "")); err != nil {
+		t.Fatalf("Emit() error = %v", err)
+	}
+
+	high := &core.SecurityEvent{Type: core.EventSessionBindingViolation, Severity: core.SeverityHigh}
+	var full bool
+	for i := 0; i < 3; i++ {
+		if err := d.Emit(ctx, high); err == ErrQueueFull {
+			full = true
+		}
+	}
+	if !full || d.Dropped() == 0 {
+		t.Error("Expected events to be dropped when the queue is full")
+	}
+
+	close(sink.block)
+	_ = d.Close()
+	for _, typ := range sink.types() {
+		if typ == core.EventLoginFailed {
+			t.Error("Expected low severity event to be filtered")
+		}
+	}
+}
+
+func TestECS(t *testing.T) {
+	doc := ECS(&core.SecurityEvent{
+		Type:      core.EventImpersonationStarted,
+		Severity:  core.SeverityHigh,
+		Time:      time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		UserID:    "user1",
+		Email:     "ada@example.com",
+		ActorID:   "admin1",
+		SessionID: "sess1",
+		IPAddress: "203.0.113.7, 10.0.0.1",
+		UserAgent: "curl/8",
+		Reason:    "support ticket",
+	})
+
+	data, _ := json.Marshal(doc)
+	var got struct {
+		Timestamp string `json:"@timestamp"`
+		Event     struct {
+			Kind     string   `json:"kind"`
+			Action   string   `json:"action"`
+			Category []string `json:"category"`
+			Severity int      `json:"severity"`
+		} `json:"event"`
+		User struct {
+			ID     string `json:"id"`
+			Target struct {
+				ID    string `json:"id"`
+				Email string `json:"email"`
+			} `json:"target"`
+		} `json:"user"`
+		Source struct {
+			IP string `json:"ip"`
+		} `json:"source"`
+		Beacon struct {
+			SessionID string `json:"session_id"`
+		} `json:"beaconauth"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Timestamp != "2025-01-02T03:04:05Z" || got.Event.Kind != "alert" || got.Event.Action != "impersonation_started" || got.Event.Severity != 73 {
+		t.Errorf("Unexpected event fields: %s", data)
+	}
+	if got.User.ID != "admin1" || got.User.Target.ID != "user1" || got.User.Target.Email != "ada@example.com" {
+		t.Errorf("Expected actor as user and subject as user.target: %s", data)
+	}
+	if got.Source.IP != "203.0.113.7" || got.Beacon.SessionID != "sess1" {
+		t.Errorf("Unexpected source or session: %s", data)
+	}
+}
+
+func TestHTTPSSink(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "ApiKey secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var doc map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&doc); err != nil || doc["@timestamp"] == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	sink, err := NewHTTPSSink(server.URL, &HTTPSOptions{
+		Client:       server.Client(),
+		Headers:      map[string]string{"Authorization": "ApiKey secret"},
+		RetryBackoff: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewHTTPSSink() error = %v", err)
+	}
+
+	if err := sink.Send(context.Background(), failedLogin("203.0.113.7", "ada@example.com")); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if attempts.Load() != 2 {
+		t.Errorf("Expected a retry after 503, got %d attempts", attempts.Load())
+	}
+
+	if _, err := NewHTTPSSink("http://siem.example.com/ingest", nil); err == nil {
+		t.Error("Expected plain HTTP endpoint to be rejected")
+	}
+	if _, err := NewHTTPSSink("http://localhost:8080/ingest", &HTTPSOptions{AllowInsecure: true}); err != nil {
+		t.Errorf("Expected AllowInsecure to permit http, got %v", err)
+	}
+}
+
+func TestSyslogSink_TCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		length, _ := r.ReadString(' ')
+		n, _ := strconv.Atoi(strings.TrimSpace(length))
+		msg := make([]byte, n)
+		_, _ = io.ReadFull(r, msg)
+		received <- string(msg)
+	}()
+
+	sink, err := NewSyslogSink(ln.Addr().String(), &SyslogOptions{Network: SyslogTCP, Hostname: "auth-1"})
+	if err != nil {
+		t.Fatalf("NewSyslogSink() error = %v", err)
+	}
+	defer sink.Close()
+
+	event := &core.SecurityEvent{Type: core.EventRefreshTokenReuse, Severity: core.SeverityCritical, Time: time.Now()}
+	if err := sink.Send(context.Background(), event); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	select {
+	case msg := <-received:
+		// authpriv (10) * 8 + critical (2) = 82
+		if !strings.HasPrefix(msg, "<82>1 ") || !strings.Contains(msg, " auth-1 beaconauth ") || !strings.Contains(msg, " refresh_token_reuse - {") {
+			t.Errorf("Unexpected syslog message: %s", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for syslog message")
+	}
+}
+
+func TestNewSyslogSink_Validation(t *testing.T) {
+	if _, err := NewSyslogSink("no-port", nil); err == nil {
+		t.Error("Expected error for address without port")
+	}
+	if _, err := NewSyslogSink("localhost:514", &SyslogOptions{Network: "unix"}); err == nil {
+		t.Error("Expected error for unsupported network")
+	}
+	if _, err := NewSyslogSink("localhost:514", &SyslogOptions{Facility: 24}); err == nil {
+		t.Error("Expected error for invalid facility")
+	}
+}
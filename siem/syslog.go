@@ -0,0 +1,201 @@
+package siem
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// Syslog transports
+const (
+	SyslogUDP = "udp"
+	SyslogTCP = "tcp"
+	SyslogTLS = "tls"
+)
+
+// FacilityAuthPriv is the syslog facility for private authorization
+// messages (10), the default for SyslogSink
+const FacilityAuthPriv = 10
+
+// syslogSeverity maps event severities to syslog severities
+var syslogSeverity = map[core.SecuritySeverity]int{
+	core.SeverityLow:      5, // notice
+	core.SeverityMedium:   4, // warning
+	core.SeverityHigh:     3, // error
+	core.SeverityCritical: 2, // critical
+}
+
+// SyslogOptions configures a SyslogSink
+type SyslogOptions struct {
+	// Network is SyslogUDP, SyslogTCP or SyslogTLS (default SyslogTLS)
+	Network string
+
+	// TLSConfig configures SyslogTLS connections, e.g. a private CA or a
+	// client certificate
+	TLSConfig *tls.Config
+
+	// AppName is the RFC 5424 APP-NAME (default "beaconauth")
+	AppName string
+
+	// Hostname is the RFC 5424 HOSTNAME (default os.Hostname)
+	Hostname string
+
+	// Facility is the syslog facility (default FacilityAuthPriv; the kernel
+	// facility 0 cannot be selected)
+	Facility int
+
+	// DialTimeout bounds connection attempts (default 5s)
+	DialTimeout time.Duration
+}
+
+// SyslogSink writes events as RFC 5424 syslog messages whose MSG is the
+// ECS JSON document. TCP and TLS messages use octet-counting framing
+// (RFC 6587). The connection is opened on first use and re-established
+// after a write error.
+type SyslogSink struct {
+	addr     string
+	opts     SyslogOptions
+	hostname string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewSyslogSink creates a sink writing to the syslog server at addr
+// (host:port)
+func NewSyslogSink(addr string, opts *SyslogOptions) (*SyslogSink, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("invalid syslog address: %w", err)
+	}
+
+	s := &SyslogSink{addr: addr}
+	if opts != nil {
+		s.opts = *opts
+	}
+	switch s.opts.Network {
+	case "":
+		s.opts.Network = SyslogTLS
+	case SyslogUDP, SyslogTCP, SyslogTLS:
+	default:
+		return nil, fmt.Errorf("unsupported syslog network: %q", s.opts.Network)
+	}
+	if s.opts.Facility < 0 || s.opts.Facility > 23 {
+		return nil, fmt.Errorf("invalid syslog facility: %d", s.opts.Facility)
+	}
+	if s.opts.Facility == 0 {
+		s.opts.Facility = FacilityAuthPriv
+	}
+	if s.opts.AppName == "" {
+		s.opts.AppName = "beaconauth"
+	}
+	if s.opts.DialTimeout <= 0 {
+		s.opts.DialTimeout = 5 * time.Second
+	}
+
+	s.hostname = s.opts.Hostname
+	if s.hostname == "" {
+		s.hostname, _ = os.Hostname()
+	}
+	if s.hostname == "" {
+		s.hostname = "-"
+	}
+	return s, nil
+}
+
+// Send writes the event, reconnecting once if the connection was lost
+func (s *SyslogSink) Send(ctx context.Context, event *core.SecurityEvent) error {
+	msg, err := s.format(event)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		if s.conn == nil {
+			if s.conn, err = s.dial(ctx); err != nil {
+				return fmt.Errorf("failed to connect to syslog server: %w", err)
+			}
+		}
+
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = s.conn.SetWriteDeadline(deadline)
+		}
+		if _, err = s.conn.Write(msg); err == nil {
+			return nil
+		}
+
+		_ = s.conn.Close()
+		s.conn = nil
+		if attempt > 0 {
+			return fmt.Errorf("failed to write syslog message: %w", err)
+		}
+	}
+}
+
+// format builds the framed RFC 5424 message
+func (s *SyslogSink) format(event *core.SecurityEvent) ([]byte, error) {
+	body, err := MarshalECS(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	severity, ok := syslogSeverity[event.Severity]
+	if !ok {
+		severity = 6 // informational
+	}
+	ts := event.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		s.opts.Facility*8+severity,
+		ts.UTC().Format(time.RFC3339Nano),
+		s.hostname,
+		s.opts.AppName,
+		os.Getpid(),
+		event.Type,
+		body,
+	)
+
+	if s.opts.Network == SyslogUDP {
+		return []byte(msg), nil
+	}
+	return []byte(strconv.Itoa(len(msg)) + " " + msg), nil
+}
+
+func (s *SyslogSink) dial(ctx context.Context) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: s.opts.DialTimeout}
+	switch s.opts.Network {
+	case SyslogTLS:
+		config := s.opts.TLSConfig
+		if config == nil {
+			config = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		return (&tls.Dialer{NetDialer: dialer, Config: config}).DialContext(ctx, "tcp", s.addr)
+	default:
+		return dialer.DialContext(ctx, s.opts.Network, s.addr)
+	}
+}
+
+// Close closes the connection to the syslog server
+func (s *SyslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
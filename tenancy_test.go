@@ -0,0 +1,108 @@
+package beaconauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	beaconauth "github.com/marshallshelly/beacon-auth"
+	"github.com/marshallshelly/beacon-auth/adapters/sqlite"
+	"github.com/marshallshelly/beacon-auth/cmd/beacon/schema"
+	"github.com/marshallshelly/beacon-auth/core"
+	bahttp "github.com/marshallshelly/beacon-auth/integrations/http"
+	"github.com/marshallshelly/beacon-auth/middleware"
+	"github.com/marshallshelly/beacon-auth/plugins/emailpassword"
+	"github.com/marshallshelly/beacon-auth/session"
+)
+
+func TestTenancy(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlite.New(ctx, &sqlite.Config{InMemory: true})
+	if err != nil {
+		t.Fatalf("sqlite.New() error = %v", err)
+	}
+	script, err := schema.GenerateSQL(&schema.Config{Adapter: "sqlite", Tenancy: true})
+	if err != nil {
+		t.Fatalf("GenerateSQL() error = %v", err)
+	}
+	for _, stmt := range schema.SplitStatements(script, "sqlite") {
+		if err := db.Exec(ctx, stmt); err != nil {
+			t.Fatalf("Exec() error = %v", err)
+		}
+	}
+
+	auth, err := beaconauth.New(
+		beaconauth.WithAdapter(db),
+		beaconauth.WithSecret("test-secret-key-that-is-long-enough"),
+		beaconauth.WithBaseURL("http://localhost:8080"),
+		beaconauth.WithPlugins(emailpassword.New()),
+		beaconauth.WithTenancy(nil),
+		beaconauth.WithLogger(&SilentLogger{}),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer auth.Close()
+
+	app := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := core.GetUser(r.Context())
+		if user == nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(user.TenantID))
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/auth/", auth.Handler())
+	mux.Handle("/", middleware.SessionMiddleware(auth.Context().SessionManager.(*session.Manager))(app))
+	handler := bahttp.TenantMiddleware(nil)(mux)
+
+	post := func(tenant, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Tenant-ID", tenant)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	creds := `{"email":"dev@example.com","password":"correct-horse-battery"}`
+	for _, tenant := range []string{"acme", "globex"} {
+		if rec := post(tenant, "/auth/register", creds); rec.Code >= 300 {
+			t.Fatalf("register in %s: status %d: %s", tenant, rec.Code, rec.Body)
+		}
+	}
+	if rec := post("acme", "/auth/register", creds); rec.Code < 400 {
+		t.Errorf("second register in acme: status %d, want an error", rec.Code)
+	}
+	if rec := post("initech", "/auth/login", creds); rec.Code < 400 {
+		t.Errorf("login in a tenant without the user: status %d, want an error", rec.Code)
+	}
+
+	rec := post("acme", "/auth/login", creds)
+	if rec.Code >= 300 {
+		t.Fatalf("login: status %d: %s", rec.Code, rec.Body)
+	}
+
+	get := func(tenant string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+		req.Header.Set("X-Tenant-ID", tenant)
+		for _, c := range rec.Result().Cookies() {
+			req.AddCookie(c)
+		}
+		appRec := httptest.NewRecorder()
+		handler.ServeHTTP(appRec, req)
+		return appRec
+	}
+	if appRec := get("acme"); appRec.Code != http.StatusOK || appRec.Body.String() != "acme" {
+		t.Errorf("dashboard in acme: status %d, body %q", appRec.Code, appRec.Body)
+	}
+	if appRec := get("globex"); appRec.Code != http.StatusUnauthorized {
+		t.Errorf("dashboard in globex with an acme session: status %d, want 401", appRec.Code)
+	}
+	if appRec := get("bad tenant"); appRec.Code != http.StatusBadRequest {
+		t.Errorf("invalid tenant: status %d, want 400", appRec.Code)
+	}
+}
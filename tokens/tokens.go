@@ -0,0 +1,262 @@
+// Package tokens issues the single-use tokens of links sent to users, such
+// as email verification, password reset, magic link and invite links. A
+// token is created for a purpose and an identifier (usually a user ID or
+// email address), is only valid for that purpose, and can be consumed
+// once. Tokens are kept in the verifications table, which stores a SHA-256
+// hash of each token instead of the token itself.
+//
+//	svc := tokens.New(adapter, tokens.Config{})
+//	token, _, err := svc.Create(ctx, tokens.PasswordReset, user.ID, 0)
+//	// ... email a link containing token ...
+//	v, err := svc.Consume(ctx, tokens.PasswordReset, tokenFromLink)
+//	// v.Identifier is user.ID
+package tokens
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/crypto"
+	"github.com/marshallshelly/beacon-auth/repo"
+)
+
+// Purpose is what a token may be used for. It is stored in the type column
+// of the verifications table, so a token of one purpose is never accepted
+// for another.
+type Purpose string
+
+// Purposes of the built-in flows
+const (
+	EmailVerification Purpose = "email_verification"
+	PasswordReset     Purpose = "password_reset"
+	MagicLink         Purpose = "magic_link"
+	Invite            Purpose = "invite"
+
+	// SignupConfirmation tokens confirm a double opt-in sign-up. Their
+	// records are what unconfirmed sign-ups are purged by, so Cleanup
+	// leaves them alone unless asked for them.
+	SignupConfirmation Purpose = "signup_confirmation"
+
+	// TwoFactorPending tokens let a user who passed their first factor
+	// submit their second one (see BeginTwoFactor)
+	TwoFactorPending Purpose = "two_factor_pending"
+
+	// TwoFactorFailure records are the wrong second factors submitted
+	// for a pending sign-in (see FailTwoFactor)
+	TwoFactorFailure Purpose = "two_factor_failure"
+)
+
+// DefaultTTLs are the lifetimes of tokens created without one. Purposes
+// not listed here default to one hour.
+var DefaultTTLs = map[Purpose]time.Duration{
+	EmailVerification: 24 * time.Hour,
+	PasswordReset:     time.Hour,
+	MagicLink:         15 * time.Minute,
+	Invite:            7 * 24 * time.Hour,
+
+	SignupConfirmation: 48 * time.Hour,
+	TwoFactorPending:   5 * time.Minute,
+}
+
+// ErrInvalidToken is returned for unknown, used or expired tokens, and for
+// tokens of another purpose
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// Config configures a Service
+type Config struct {
+	// TableNames overrides the default table names (nil keeps the defaults)
+	TableNames *core.TableNames
+
+	// DatabaseIDs leaves the id column to the database, for schemas with
+	// serial or UUID ids (adapter.IDStrategyDatabase)
+	DatabaseIDs bool
+
+	// TTLs overrides DefaultTTLs per purpose
+	TTLs map[Purpose]time.Duration
+}
+
+// Service creates and redeems tokens
+type Service struct {
+	adapter     core.Adapter
+	table       string
+	databaseIDs bool
+	ttls        map[Purpose]time.Duration
+}
+
+// New creates a token service on adapter
+func New(adapter core.Adapter, cfg Config) *Service {
+	ttls := make(map[Purpose]time.Duration, len(DefaultTTLs)+len(cfg.TTLs))
+	for purpose, ttl := range DefaultTTLs {
+		ttls[purpose] = ttl
+	}
+	for purpose, ttl := range cfg.TTLs {
+		ttls[purpose] = ttl
+	}
+	return &Service{
+		adapter:     adapter,
+		table:       cfg.TableNames.Table(core.ModelVerifications),
+		databaseIDs: cfg.DatabaseIDs,
+		ttls:        ttls,
+	}
+}
+
+// WithAdapter returns a Service with the same configuration that runs its
+// queries on a, e.g. a transaction adapter
+func (s *Service) WithAdapter(a core.Adapter) *Service {
+	clone := *s
+	clone.adapter = a
+	return &clone
+}
+
+// TTL returns the lifetime of tokens of purpose created without one
+func (s *Service) TTL(purpose Purpose) time.Duration {
+	if ttl, ok := s.ttls[purpose]; ok && ttl > 0 {
+		return ttl
+	}
+	return time.Hour
+}
+
+// Hash returns the stored form of a token
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create issues a token of purpose for identifier that expires after ttl,
+// or after the purpose's TTL when ttl is zero. It returns the token and
+// the stored record; the token is returned only here, as the database
+// keeps its hash.
+func (s *Service) Create(ctx context.Context, purpose Purpose, identifier string, ttl time.Duration) (string, *core.Verification, error) {
+	token, err := crypto.GenerateVerificationToken()
+	if err != nil {
+		return "", nil, err
+	}
+	if ttl <= 0 {
+		ttl = s.TTL(purpose)
+	}
+
+	now := time.Now()
+	record := &core.Verification{
+		Identifier: identifier,
+		Token:      Hash(token),
+		Type:       string(purpose),
+		ExpiresAt:  now.Add(ttl),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if !s.databaseIDs {
+		if record.ID, err = crypto.GenerateID(); err != nil {
+			return "", nil, err
+		}
+	}
+	record, err = repo.Create(ctx, s.adapter, s.table, record)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, record, nil
+}
+
+// Peek returns the record of a valid token without using it up, e.g. to
+// show the reset password form before the new password is submitted
+func (s *Service) Peek(ctx context.Context, purpose Purpose, token string) (*core.Verification, error) {
+	if token == "" {
+		return nil, ErrInvalidToken
+	}
+	record, err := repo.FindOne[core.Verification](ctx, s.adapter, s.query(purpose, token))
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, ErrInvalidToken
+	}
+	return record, nil
+}
+
+// Consume returns the record of a valid token and deletes it. Of
+// concurrent calls for the same token, only the one whose delete removes
+// the record succeeds.
+func (s *Service) Consume(ctx context.Context, purpose Purpose, token string) (*core.Verification, error) {
+	record, err := s.Peek(ctx, purpose, token)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := s.adapter.DeleteMany(ctx, s.query(purpose, token))
+	if err != nil {
+		return nil, err
+	}
+	if deleted == 0 {
+		return nil, ErrInvalidToken
+	}
+	return record, nil
+}
+
+// Revoke deletes the tokens of purpose issued for identifier, e.g. the
+// pending reset links of a user who just changed their password
+func (s *Service) Revoke(ctx context.Context, purpose Purpose, identifier string) (int64, error) {
+	query := core.NewQuery(s.table).
+		Where("type", core.OpEqual, string(purpose)).
+		Where("identifier", core.OpEqual, identifier).
+		Build()
+	return s.adapter.DeleteMany(ctx, query)
+}
+
+// Pending reports whether identifier has a valid token of purpose, e.g.
+// an unused confirmation link
+func (s *Service) Pending(ctx context.Context, purpose Purpose, identifier string) (bool, error) {
+	query := core.NewQuery(s.table).
+		Where("type", core.OpEqual, string(purpose)).
+		Where("identifier", core.OpEqual, identifier).
+		Where("expires_at", core.OpGreaterThan, time.Now()).
+		Build()
+	n, err := s.adapter.Count(ctx, query)
+	return n > 0, err
+}
+
+// Expired returns the records of expired tokens of purpose, oldest first,
+// for flows that act on links that were never used
+func (s *Service) Expired(ctx context.Context, purpose Purpose) ([]*core.Verification, error) {
+	query := core.NewQuery(s.table).
+		Where("type", core.OpEqual, string(purpose)).
+		Where("expires_at", core.OpLessThan, time.Now()).
+		OrderBy("expires_at", false).
+		Build()
+	return repo.FindMany[core.Verification](ctx, s.adapter, query)
+}
+
+// Delete deletes a token's record, e.g. one returned by Expired
+func (s *Service) Delete(ctx context.Context, record *core.Verification) error {
+	_, err := s.adapter.DeleteMany(ctx, core.NewQuery(s.table).Where("id", core.OpEqual, record.ID).Build())
+	return err
+}
+
+// Cleanup deletes the expired tokens of purposes, or of the built-in
+// purposes when none are given
+func (s *Service) Cleanup(ctx context.Context, purposes ...Purpose) error {
+	if len(purposes) == 0 {
+		purposes = []Purpose{EmailVerification, PasswordReset, MagicLink, Invite}
+	}
+	types := make([]interface{}, len(purposes))
+	for i, purpose := range purposes {
+		types[i] = string(purpose)
+	}
+	query := core.NewQuery(s.table).
+		Where("type", core.OpIn, types).
+		Where("expires_at", core.OpLessThan, time.Now()).
+		Build()
+
+	_, err := s.adapter.DeleteMany(ctx, query)
+	return err
+}
+
+// query selects the record of token for purpose, unless it expired
+func (s *Service) query(purpose Purpose, token string) *core.Query {
+	return core.NewQuery(s.table).
+		Where("token", core.OpEqual, Hash(token)).
+		Where("type", core.OpEqual, string(purpose)).
+		Where("expires_at", core.OpGreaterThan, time.Now()).
+		Build()
+}
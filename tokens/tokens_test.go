@@ -0,0 +1,207 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/adapters/memory"
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+func TestService_CreateConsume(t *testing.T) {
+	ctx := context.Background()
+	db := memory.New()
+	svc := New(db, Config{})
+
+	token, record, err := svc.Create(ctx, PasswordReset, "user-1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.ID == "" || record.Type != string(PasswordReset) || record.Token != Hash(token) {
+		t.Errorf("Unexpected record %+v", record)
+	}
+	if ttl := time.Until(record.ExpiresAt); ttl < 59*time.Minute || ttl > time.Hour {
+		t.Errorf("Expected the password reset TTL, got %v", ttl)
+	}
+
+	stored, err := db.FindOne(ctx, core.NewQuery(core.ModelVerifications).Where("identifier", core.OpEqual, "user-1").Build())
+	if err != nil || stored == nil {
+		t.Fatalf("Expected the stored record, got %v %v", stored, err)
+	}
+	if stored["token"] == token {
+		t.Error("Expected the token to be stored hashed")
+	}
+
+	if _, err := svc.Peek(ctx, EmailVerification, token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected a token of another purpose to be rejected, got %v", err)
+	}
+	if v, err := svc.Peek(ctx, PasswordReset, token); err != nil || v.Identifier != "user-1" {
+		t.Fatalf("Peek() = %+v, %v", v, err)
+	}
+	if v, err := svc.Consume(ctx, PasswordReset, token); err != nil || v.Identifier != "user-1" {
+		t.Fatalf("Consume() = %+v, %v", v, err)
+	}
+	if _, err := svc.Consume(ctx, PasswordReset, token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected a consumed token to be rejected, got %v", err)
+	}
+}
+
+func TestService_ExpiryAndCleanup(t *testing.T) {
+	ctx := context.Background()
+	db := memory.New()
+	svc := New(db, Config{TTLs: map[Purpose]time.Duration{MagicLink: time.Millisecond}})
+
+	token, _, err := svc.Create(ctx, MagicLink, "ada@example.com", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := svc.Create(ctx, Invite, "ada@example.com", 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := svc.Consume(ctx, MagicLink, token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected an expired token to be rejected, got %v", err)
+	}
+	if err := svc.Cleanup(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := db.Count(ctx, core.NewQuery(core.ModelVerifications).Build()); n != 1 {
+		t.Errorf("Expected only the unexpired invite to remain, got %d", n)
+	}
+
+	if n, err := svc.Revoke(ctx, Invite, "ada@example.com"); err != nil || n != 1 {
+		t.Errorf("Revoke() = %d, %v", n, err)
+	}
+}
+
+func TestService_PendingAndExpired(t *testing.T) {
+	ctx := context.Background()
+	db := memory.New()
+	svc := New(db, Config{})
+
+	if _, _, err := svc.Create(ctx, SignupConfirmation, "ada@example.com", time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := svc.Create(ctx, SignupConfirmation, "bob@example.com", 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if pending, err := svc.Pending(ctx, SignupConfirmation, "ada@example.com"); err != nil || pending {
+		t.Errorf("Pending(ada) = %v, %v, want false", pending, err)
+	}
+	if pending, err := svc.Pending(ctx, SignupConfirmation, "bob@example.com"); err != nil || !pending {
+		t.Errorf("Pending(bob) = %v, %v, want true", pending, err)
+	}
+
+	// Cleanup leaves confirmations to the flow that purges by them
+	if err := svc.Cleanup(ctx); err != nil {
+		t.Fatal(err)
+	}
+	expired, err := svc.Expired(ctx, SignupConfirmation)
+	if err != nil || len(expired) != 1 || expired[0].Identifier != "ada@example.com" {
+		t.Fatalf("Expired() = %v, %v, want ada's record", expired, err)
+	}
+	if err := svc.Delete(ctx, expired[0]); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := db.Count(ctx, core.NewQuery(core.ModelVerifications).Build()); n != 1 {
+		t.Errorf("Expected only bob's record to remain, got %d", n)
+	}
+}
+
+func TestService_TwoFactor(t *testing.T) {
+	ctx := context.Background()
+	svc := New(memory.New(), Config{})
+
+	token, err := svc.BeginTwoFactor(ctx, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Peek(ctx, PasswordReset, token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Peek(PasswordReset) error = %v, want ErrInvalidToken", err)
+	}
+
+	// The sign-in stays pending until it completes
+	for i := 0; i < 2; i++ {
+		if userID, err := svc.PendingTwoFactor(ctx, token); err != nil || userID != "user-1" {
+			t.Fatalf("PendingTwoFactor() = %q, %v", userID, err)
+		}
+	}
+	if err := svc.CompleteTwoFactor(ctx, token); err != nil {
+		t.Fatalf("CompleteTwoFactor() error = %v", err)
+	}
+	if err := svc.CompleteTwoFactor(ctx, token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("second CompleteTwoFactor() error = %v, want ErrInvalidToken", err)
+	}
+	if _, err := svc.PendingTwoFactor(ctx, token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("PendingTwoFactor() after completion error = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestService_TwoFactorAttempts(t *testing.T) {
+	ctx := context.Background()
+	db := memory.New()
+	svc := New(db, Config{})
+
+	token, err := svc.BeginTwoFactor(ctx, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < MaxTwoFactorAttempts; i++ {
+		if userID, err := svc.BeginTwoFactorAttempt(ctx, token); err != nil || userID != "user-1" {
+			t.Fatalf("BeginTwoFactorAttempt() #%d = %q, %v", i, userID, err)
+		}
+		if err := svc.FailTwoFactor(ctx, token); err != nil {
+			t.Fatalf("FailTwoFactor() #%d error = %v", i, err)
+		}
+	}
+	if _, err := svc.BeginTwoFactorAttempt(ctx, token); err != nil {
+		t.Fatalf("last BeginTwoFactorAttempt() error = %v", err)
+	}
+	if err := svc.FailTwoFactor(ctx, token); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("last FailTwoFactor() error = %v, want ErrTooManyAttempts", err)
+	}
+	if _, err := svc.PendingTwoFactor(ctx, token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("PendingTwoFactor() after too many attempts error = %v, want ErrInvalidToken", err)
+	}
+	if n, _ := db.Count(ctx, core.NewQuery(core.ModelVerifications).Build()); n != 0 {
+		t.Errorf("Expected the sign-in and its failures to be deleted, %d records remain", n)
+	}
+}
+
+func TestService_TwoFactorAttemptsConcurrent(t *testing.T) {
+	ctx := context.Background()
+	svc := New(memory.New(), Config{})
+
+	token, err := svc.BeginTwoFactor(ctx, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Attempts are reserved before the factor is checked, so parallel
+	// attempts cannot exceed the limit
+	var (
+		wg      sync.WaitGroup
+		granted atomic.Int32
+	)
+	for i := 0; i < 3*MaxTwoFactorAttempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := svc.BeginTwoFactorAttempt(ctx, token); err == nil {
+				granted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := granted.Load(); n > MaxTwoFactorAttempts {
+		t.Errorf("%d attempts granted, want at most %d", n, MaxTwoFactorAttempts)
+	}
+}
@@ -0,0 +1,138 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/marshallshelly/beacon-auth/core"
+)
+
+// MaxTwoFactorAttempts is how many wrong second factors a pending
+// two-factor sign-in accepts before it is revoked
+const MaxTwoFactorAttempts = 5
+
+// ErrTooManyAttempts is returned by BeginTwoFactorAttempt and
+// FailTwoFactor when they revoke a pending sign-in. The user has to sign
+// in with their password again.
+var ErrTooManyAttempts = errors.New("too many two-factor attempts")
+
+// For returns the token service of an AuthContext: the one of its data
+// manager, which knows the ID strategy, or one on its adapter
+func For(c *core.AuthContext) *Service {
+	if dm, ok := c.DataManager.(interface{ Tokens() *Service }); ok {
+		return dm.Tokens()
+	}
+	return New(c.Adapter, Config{TableNames: c.Config.TableNames})
+}
+
+// BeginTwoFactor records that the user passed their first factor and
+// returns the TwoFactorPending token that lets them submit the second one.
+// The token grants nothing else.
+func (s *Service) BeginTwoFactor(ctx context.Context, userID string) (string, error) {
+	token, _, err := s.Create(ctx, TwoFactorPending, userID, 0)
+	return token, err
+}
+
+// PendingTwoFactor returns the user of a pending two-factor sign-in. The
+// sign-in stays pending, so a mistyped code can be retried until
+// CompleteTwoFactor is called or the token expires. It does not count as
+// an attempt, so handlers checking a second factor call
+// BeginTwoFactorAttempt instead.
+func (s *Service) PendingTwoFactor(ctx context.Context, token string) (string, error) {
+	record, err := s.Peek(ctx, TwoFactorPending, token)
+	if err != nil {
+		return "", err
+	}
+	if record.Identifier == "" {
+		return "", ErrInvalidToken
+	}
+	return record.Identifier, nil
+}
+
+// BeginTwoFactorAttempt reserves one of the MaxTwoFactorAttempts attempts
+// of a pending two-factor sign-in and returns its user. Call it before the
+// second factor is checked, so concurrent requests cannot check more
+// factors than the limit allows. The attempt counts as a failure unless
+// CompleteTwoFactor is called. Once the attempts are used up, the sign-in
+// is revoked and ErrTooManyAttempts is returned.
+func (s *Service) BeginTwoFactorAttempt(ctx context.Context, token string) (string, error) {
+	record, err := s.Peek(ctx, TwoFactorPending, token)
+	if err != nil {
+		return "", err
+	}
+	if record.Identifier == "" {
+		return "", ErrInvalidToken
+	}
+
+	// Each attempt is a record of its own, identified by the pending
+	// token's hash, so concurrent attempts are all counted
+	if _, _, err := s.Create(ctx, TwoFactorFailure, record.Token, time.Until(record.ExpiresAt)); err != nil {
+		return "", err
+	}
+	attempts, err := s.twoFactorAttempts(ctx, record.Token)
+	if err != nil {
+		return "", err
+	}
+	if attempts > MaxTwoFactorAttempts {
+		return "", s.revokeTwoFactor(ctx, token)
+	}
+
+	// A concurrent attempt may have revoked the sign-in and its attempts
+	// after this one was counted
+	if _, err := s.Peek(ctx, TwoFactorPending, token); err != nil {
+		return "", err
+	}
+	return record.Identifier, nil
+}
+
+// FailTwoFactor ends an attempt begun with BeginTwoFactorAttempt whose
+// second factor was wrong. If it was the MaxTwoFactorAttempts-th attempt,
+// the sign-in is revoked and ErrTooManyAttempts is returned.
+func (s *Service) FailTwoFactor(ctx context.Context, token string) error {
+	record, err := s.Peek(ctx, TwoFactorPending, token)
+	if err != nil {
+		return err
+	}
+	attempts, err := s.twoFactorAttempts(ctx, record.Token)
+	if err != nil {
+		return err
+	}
+	if attempts < MaxTwoFactorAttempts {
+		return nil
+	}
+	return s.revokeTwoFactor(ctx, token)
+}
+
+// CompleteTwoFactor ends a pending two-factor sign-in once the second
+// factor is verified. Of concurrent calls for the same token, only one
+// succeeds.
+func (s *Service) CompleteTwoFactor(ctx context.Context, token string) error {
+	if _, err := s.Consume(ctx, TwoFactorPending, token); err != nil {
+		return err
+	}
+	// The failures expire with the sign-in, so their deletion is best-effort
+	_, _ = s.Revoke(ctx, TwoFactorFailure, Hash(token))
+	return nil
+}
+
+// twoFactorAttempts counts the attempts of the pending sign-in whose
+// token hashes to hash
+func (s *Service) twoFactorAttempts(ctx context.Context, hash string) (int64, error) {
+	return s.adapter.Count(ctx, core.NewQuery(s.table).
+		Where("type", core.OpEqual, string(TwoFactorFailure)).
+		Where("identifier", core.OpEqual, hash).
+		Build())
+}
+
+// revokeTwoFactor deletes a pending sign-in that used up its attempts,
+// then the attempts, and returns ErrTooManyAttempts
+func (s *Service) revokeTwoFactor(ctx context.Context, token string) error {
+	if _, err := s.adapter.DeleteMany(ctx, s.query(TwoFactorPending, token)); err != nil {
+		return err
+	}
+	if _, err := s.Revoke(ctx, TwoFactorFailure, Hash(token)); err != nil {
+		return err
+	}
+	return ErrTooManyAttempts
+}
@@ -0,0 +1,152 @@
+package beaconauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	beaconauth "github.com/marshallshelly/beacon-auth"
+	"github.com/marshallshelly/beacon-auth/adapters/sqlite"
+	"github.com/marshallshelly/beacon-auth/cmd/beacon/schema"
+	"github.com/marshallshelly/beacon-auth/core"
+	"github.com/marshallshelly/beacon-auth/middleware"
+	"github.com/marshallshelly/beacon-auth/plugins/emailpassword"
+	"github.com/marshallshelly/beacon-auth/session"
+)
+
+// mapUserStore stands in for a user service
+type mapUserStore struct {
+	mu    sync.Mutex
+	users map[string]*core.User
+}
+
+func (s *mapUserStore) CreateUser(_ context.Context, email, name string) (*core.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.Email == email {
+			return nil, core.ErrDuplicate
+		}
+	}
+	u := &core.User{ID: "ext-" + email, Email: email, Name: name, CreatedAt: time.Now()}
+	s.users[u.ID] = u
+	return u, nil
+}
+
+func (s *mapUserStore) FindUserByID(_ context.Context, id string) (*core.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[id]; ok {
+		return u, nil
+	}
+	return nil, core.ErrUserNotFound
+}
+
+func (s *mapUserStore) FindUserByEmail(_ context.Context, email string) (*core.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return nil, core.ErrUserNotFound
+}
+
+func (s *mapUserStore) UpdateUser(_ context.Context, id string, data map[string]interface{}) (*core.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return nil, core.ErrUserNotFound
+	}
+	if v, ok := data["email_verified"].(bool); ok {
+		u.EmailVerified = v
+	}
+	return u, nil
+}
+
+func TestUserStore(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlite.New(ctx, &sqlite.Config{InMemory: true})
+	if err != nil {
+		t.Fatalf("sqlite.New() error = %v", err)
+	}
+	script, err := schema.GenerateSQL(&schema.Config{Adapter: "sqlite"})
+	if err != nil {
+		t.Fatalf("GenerateSQL() error = %v", err)
+	}
+	for _, stmt := range schema.SplitStatements(script, "sqlite") {
+		if err := db.Exec(ctx, stmt); err != nil {
+			t.Fatalf("Exec() error = %v", err)
+		}
+	}
+
+	store := &mapUserStore{users: make(map[string]*core.User)}
+	auth, err := beaconauth.New(
+		beaconauth.WithAdapter(db),
+		beaconauth.WithSecret("test-secret-key-that-is-long-enough"),
+		beaconauth.WithBaseURL("http://localhost:8080"),
+		beaconauth.WithPlugins(emailpassword.New()),
+		beaconauth.WithUserStore(store),
+		beaconauth.WithLogger(&SilentLogger{}),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer auth.Close()
+
+	app := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := core.GetUser(r.Context())
+		if user == nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(user.ID))
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/auth/", auth.Handler())
+	mux.Handle("/", middleware.SessionMiddleware(auth.Context().SessionManager.(*session.Manager))(app))
+
+	creds := `{"email":"dev@example.com","password":"correct-horse-battery"}`
+	post := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(creds))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := post("/auth/register"); rec.Code != http.StatusOK {
+		t.Fatalf("register: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := post("/auth/register"); rec.Code != http.StatusConflict {
+		t.Errorf("second register: status %d, want 409", rec.Code)
+	}
+	rec := post("/auth/login")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login: status %d: %s", rec.Code, rec.Body)
+	}
+
+	// The session resolves its user through the store
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range rec.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	res := httptest.NewRecorder()
+	mux.ServeHTTP(res, req)
+	if res.Code != http.StatusOK || res.Body.String() != "ext-dev@example.com" {
+		t.Errorf("session user: status %d, body %q", res.Code, res.Body)
+	}
+
+	// Users stay out of the database; the password and session do not
+	for table, want := range map[string]int64{"users": 0, "accounts": 1, "sessions": 2} {
+		if n, err := db.Count(ctx, core.NewQuery(table).Build()); err != nil || n != want {
+			t.Errorf("%s has %d rows (%v), want %d", table, n, err, want)
+		}
+	}
+}
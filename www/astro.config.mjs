@@ -63,6 +63,14 @@ export default defineConfig({
               label: "Role-Based Access Control",
               slug: "guides/rbac",
             },
+            {
+              label: "Localization",
+              slug: "guides/i18n",
+            },
+            {
+              label: "Link Tokens",
+              slug: "guides/tokens",
+            },
           ],
         },
         {
@@ -80,6 +88,22 @@ export default defineConfig({
               label: "Two-Factor Auth",
               slug: "plugins/twofa",
             },
+            {
+              label: "Hosted UI",
+              slug: "plugins/ui",
+            },
+            {
+              label: "Admin API",
+              slug: "plugins/admin",
+            },
+            {
+              label: "Data Export",
+              slug: "plugins/export",
+            },
+            {
+              label: "Data Retention",
+              slug: "plugins/retention",
+            },
           ],
         },
         {
@@ -110,6 +134,10 @@ export default defineConfig({
               label: "Standard net/http",
               slug: "integrations/http",
             },
+            {
+              label: "Router",
+              slug: "integrations/router",
+            },
             {
               label: "Chi",
               slug: "integrations/chi",
@@ -126,6 +154,14 @@ export default defineConfig({
               label: "Gorilla Mux",
               slug: "integrations/mux",
             },
+            {
+              label: "GraphQL",
+              slug: "integrations/graphql",
+            },
+            {
+              label: "Connect / gRPC",
+              slug: "integrations/connect",
+            },
           ],
         },
         {
@@ -135,6 +171,10 @@ export default defineConfig({
               label: "Configuration",
               slug: "reference/configuration",
             },
+            {
+              label: "Errors",
+              slug: "reference/errors",
+            },
           ],
         },
       ],